@@ -0,0 +1,386 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// AdminConfig exposes an HTTP API to drive the test, so that an external orchestrator can pause sending while the
+// system under test is disrupted, for example during a broker upgrade:
+//
+//	POST /start  starts sending when WaitForStart is set
+//	POST /pause  pauses sending
+//	POST /resume resumes sending
+//	POST /abort  stops sending and terminates the test, the received events are verified as usual
+//	GET  /report returns an interim report
+//	GET  /snapshot returns a snapshot of the state, including the outstanding events of each partition key
+//	POST /failure-domains/start?label=<label> tags a window of the test, see FailureDomainsConfig
+//	POST /failure-domains/end?label=<label>   ends the window of the label
+//	GET  /settings returns the live settings, see HotReloadConfig
+//	PUT  /settings changes the live settings
+//
+// Time spent paused doesn't count towards the test duration.
+type AdminConfig struct {
+	// Port is the port of the admin API.
+	Port int `json:"port" yaml:"port"`
+	// WaitForStart holds the sender until POST /start is called.
+	WaitForStart bool `json:"waitForStart" yaml:"waitForStart"`
+}
+
+func (c *AdminConfig) validate(config *Config) error {
+	if c.Port <= 0 || c.Port > 65535 {
+		return invalidErr("admin.port", fmt.Errorf("%d is not a valid port", c.Port))
+	}
+	if !config.Receiver.Disabled && c.Port == config.Receiver.Port {
+		return invalidErr("admin.port", fmt.Errorf("%d is the receiver port", c.Port))
+	}
+	if c.WaitForStart && config.Sender.Disabled {
+		return invalidErr("admin.waitForStart", errors.New("cannot be used when the sender is disabled"))
+	}
+	return nil
+}
+
+// SenderState is the state of the sender driven through the admin API.
+type SenderState string
+
+const (
+	// SenderStatePending is the state of a sender waiting for POST /start.
+	SenderStatePending SenderState = "pending"
+	SenderStateRunning SenderState = "running"
+	SenderStatePaused  SenderState = "paused"
+	// SenderStateAborted is the state of a sender stopped with POST /abort.
+	SenderStateAborted SenderState = "aborted"
+	// SenderStateDone is the state of a sender that sent events for the whole test duration.
+	SenderStateDone SenderState = "done"
+)
+
+// senderControl holds the sender while it is pending or paused, it is safe for concurrent use.
+type senderControl struct {
+	lock    sync.Mutex
+	changed *sync.Cond
+	state   SenderState
+	// stopped is true when the sender must stop, because the test has been aborted or the sender context is done.
+	stopped bool
+	// pausedSince is the time the current pause started, it is zero when the sender isn't pending nor paused.
+	pausedSince time.Time
+	// paused is the total time the sender has been pending or paused, excluding the current pause.
+	paused time.Duration
+	// closedLoop holds the sender while the backlog is too large, with sender.closedLoop.
+	closedLoop closedLoop
+	// settings are the live settings of the send rate, it is nil without hotReload.
+	settings *liveSettings
+}
+
+func newSenderControl(waitForStart bool) *senderControl {
+	c := &senderControl{state: SenderStateRunning}
+	c.changed = sync.NewCond(&c.lock)
+	if waitForStart {
+		c.state = SenderStatePending
+		c.pausedSince = time.Now()
+	}
+	return c
+}
+
+// transition moves the sender to the given state when it is in one of the given states.
+func (c *senderControl) transition(to SenderState, from ...SenderState) (SenderState, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || c.state == s
+	}
+	if !allowed {
+		return c.state, fmt.Errorf("sender is %s", c.state)
+	}
+
+	now := time.Now()
+	if !c.pausedSince.IsZero() {
+		c.paused += now.Sub(c.pausedSince)
+		c.pausedSince = time.Time{}
+	}
+	switch to {
+	case SenderStatePending, SenderStatePaused:
+		c.pausedSince = now
+	case SenderStateAborted, SenderStateDone:
+		c.stopped = true
+	}
+	c.state = to
+	c.changed.Broadcast()
+	return c.state, nil
+}
+
+// begin resets the paused time when the sender starts sending.
+func (c *senderControl) begin() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.paused = 0
+	if !c.pausedSince.IsZero() {
+		c.pausedSince = time.Now()
+	}
+	c.closedLoop.heldTotal = 0
+	if c.closedLoop.held {
+		c.closedLoop.heldSince = time.Now()
+	}
+}
+
+// stop unblocks and stops the sender.
+func (c *senderControl) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stopped = true
+	c.changed.Broadcast()
+}
+
+// waitRunning blocks while the sender is pending, paused or held, it returns the total paused and held times or false
+// when the sender must stop.
+func (c *senderControl) waitRunning() (time.Duration, time.Duration, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for !c.stopped && (c.state == SenderStatePending || c.state == SenderStatePaused || c.closedLoop.held) {
+		c.changed.Wait()
+	}
+	return c.paused, c.closedLoop.heldTotal, !c.stopped
+}
+
+func (c *senderControl) currentState() SenderState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.state
+}
+
+// controlledPacer paces requests with the given pacer excluding the time the sender has been paused, and stops
+// after the given duration of sending.
+type controlledPacer struct {
+	pacer    vegeta.Pacer
+	control  *senderControl
+	duration time.Duration
+}
+
+var _ vegeta.Pacer = controlledPacer{}
+
+// Pace implements vegeta.Pacer, it blocks while the sender is paused or held.
+func (p controlledPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	called := time.Now()
+	paused, held, ok := p.control.waitRunning()
+	if !ok {
+		return 0, true
+	}
+	elapsed += time.Since(called) - paused
+	if p.duration > 0 && elapsed >= p.duration {
+		return 0, true
+	}
+	// Requests not sent while held are not sent later.
+	elapsed -= held
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return p.pacer.Pace(elapsed, hits)
+}
+
+// Rate implements vegeta.Pacer.
+func (p controlledPacer) Rate(elapsed time.Duration) float64 {
+	return p.pacer.Rate(elapsed)
+}
+
+type senderControlKey struct{}
+
+func contextWithSenderControl(ctx context.Context, c *senderControl) context.Context {
+	return context.WithValue(ctx, senderControlKey{}, c)
+}
+
+// senderControlFromContext returns the sender control carried by the given context, or nil.
+func senderControlFromContext(ctx context.Context) *senderControl {
+	c, _ := ctx.Value(senderControlKey{}).(*senderControl)
+	return c
+}
+
+// adminReport is the response of GET /report.
+type adminReport struct {
+	State SenderState `json:"state"`
+	InterimReport
+}
+
+type adminServer struct {
+	control *senderControl
+	sm      *StateManager
+	// settings are the live settings, it is nil without hotReload.
+	settings *liveSettings
+	abort    func()
+	start    time.Time
+
+	lock     sync.Mutex
+	previous *InterimReport
+}
+
+func (s *adminServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/clock" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, clockResponse{Time: time.Now().UnixNano()})
+		return
+	}
+	if r.URL.Path == "/snapshot" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, s.sm.Snapshot())
+		return
+	}
+	if r.URL.Path == "/report" {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.lock.Lock()
+		report := s.sm.InterimReport(s.start, s.previous)
+		s.previous = &report
+		s.lock.Unlock()
+		writeAdminResponse(w, http.StatusOK, adminReport{State: s.control.currentState(), InterimReport: report})
+		return
+	}
+
+	if r.URL.Path == "/failure-domains/start" || r.URL.Path == "/failure-domains/end" {
+		s.serveFailureDomain(w, r)
+		return
+	}
+	if r.URL.Path == "/settings" {
+		s.serveSettings(w, r)
+		return
+	}
+
+	var state SenderState
+	var err error
+	switch r.URL.Path {
+	case "/start":
+		state, err = s.transitionOn(r, SenderStateRunning, SenderStatePending)
+	case "/pause":
+		state, err = s.transitionOn(r, SenderStatePaused, SenderStateRunning)
+	case "/resume":
+		state, err = s.transitionOn(r, SenderStateRunning, SenderStatePaused)
+	case "/abort":
+		state, err = s.transitionOn(r, SenderStateAborted, SenderStatePending, SenderStateRunning, SenderStatePaused)
+		if err == nil {
+			logger(LogComponentSender).Info("Test aborted through the admin API")
+			s.abort()
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if errors.Is(err, errMethodNotAllowed) {
+		http.Error(w, err.Error(), http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := struct {
+		State SenderState `json:"state"`
+		Error string      `json:"error,omitempty"`
+	}{State: state}
+	if err != nil {
+		response.Error = err.Error()
+		writeAdminResponse(w, http.StatusConflict, response)
+		return
+	}
+	logger(LogComponentSender).Infow("Sender state changed through the admin API", "state", state)
+	writeAdminResponse(w, http.StatusOK, response)
+}
+
+// serveFailureDomain starts or ends the failure domain window of the label query parameter.
+func (s *adminServer) serveFailureDomain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	label := r.URL.Query().Get("label")
+	var err error
+	if r.URL.Path == "/failure-domains/start" {
+		err = s.sm.startFailureDomain(label, time.Now())
+	} else {
+		err = s.sm.endFailureDomain(label, time.Now())
+	}
+
+	response := struct {
+		Label string `json:"label"`
+		Error string `json:"error,omitempty"`
+	}{Label: label}
+	if err != nil {
+		response.Error = err.Error()
+		writeAdminResponse(w, http.StatusConflict, response)
+		return
+	}
+	logger(LogComponentSender).Infow("Failure domain tagged through the admin API", "path", r.URL.Path, "label", label)
+	writeAdminResponse(w, http.StatusOK, response)
+}
+
+// serveSettings returns or changes the live settings.
+func (s *adminServer) serveSettings(w http.ResponseWriter, r *http.Request) {
+	if s.settings == nil {
+		http.Error(w, "hotReload is not enabled", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeAdminResponse(w, http.StatusOK, s.settings.current())
+		return
+	case http.MethodPut:
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var settings LiveSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode settings: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := s.settings.apply(settings, settingsSourceAdmin); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeAdminResponse(w, http.StatusOK, s.settings.current())
+}
+
+var errMethodNotAllowed = errors.New("method not allowed")
+
+func (s *adminServer) transitionOn(r *http.Request, to SenderState, from ...SenderState) (SenderState, error) {
+	if r.Method != http.MethodPost {
+		return "", errMethodNotAllowed
+	}
+	return s.control.transition(to, from...)
+}
+
+func writeAdminResponse(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// startAdminServer starts the admin API until the returned function is called, abort terminates the test.
+func startAdminServer(config *AdminConfig, control *senderControl, sm *StateManager, settings *liveSettings, abort func()) (func(), error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start admin API: %w", err)
+	}
+	s := &http.Server{Handler: &adminServer{control: control, sm: sm, settings: settings, abort: abort, start: time.Now()}}
+	go func() {
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger(LogComponentSender).Errorw("Admin API stopped", "error", err)
+		}
+	}()
+	return func() { _ = s.Close() }, nil
+}
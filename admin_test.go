@@ -0,0 +1,153 @@
+package sacura
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"go.uber.org/atomic"
+)
+
+func TestAdminConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			config: Config{Admin: &AdminConfig{Port: 8081, WaitForStart: true}, Receiver: ReceiverConfig{Port: 8080}},
+		},
+		{
+			name:    "invalid port",
+			config:  Config{Admin: &AdminConfig{}, Receiver: ReceiverConfig{Port: 8080}},
+			wantErr: true,
+		},
+		{
+			name:    "receiver port",
+			config:  Config{Admin: &AdminConfig{Port: 8080}, Receiver: ReceiverConfig{Port: 8080}},
+			wantErr: true,
+		},
+		{
+			name:    "wait for start without sender",
+			config:  Config{Admin: &AdminConfig{Port: 8081, WaitForStart: true}, Sender: SenderConfig{Disabled: true}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Admin.validate(&tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestControlledPacer(t *testing.T) {
+
+	control := newSenderControl(true)
+	p := controlledPacer{pacer: vegeta.ConstantPacer{Freq: 1, Per: time.Hour}, control: control, duration: time.Hour}
+	control.begin()
+
+	paced := make(chan time.Duration, 1)
+	go func() {
+		wait, _ := p.Pace(0, 0)
+		paced <- wait
+	}()
+	select {
+	case <-paced:
+		t.Fatal("expected pending sender to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if _, err := control.transition(SenderStateRunning, SenderStatePending); err != nil {
+		t.Fatal(err)
+	}
+	// The time spent pending is excluded from the elapsed time.
+	if wait := <-paced; wait < time.Hour-time.Second {
+		t.Errorf("expected to wait about an hour for the first hit, got %v", wait)
+	}
+
+	if _, err := control.transition(SenderStatePaused, SenderStateRunning); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if _, err := control.transition(SenderStateRunning, SenderStatePaused); err != nil {
+		t.Fatal(err)
+	}
+	// The time spent paused is excluded from the elapsed time, delaying the second hit.
+	if wait, stop := p.Pace(time.Hour, 1); stop || wait < time.Hour+100*time.Millisecond {
+		t.Errorf("expected to wait more than an hour for the second hit, got %v %v", wait, stop)
+	}
+
+	if _, err := control.transition(SenderStateRunning, SenderStatePending); err == nil {
+		t.Error("expected running sender not to start again")
+	}
+	control.stop()
+	if _, stop := p.Pace(0, 1); !stop {
+		t.Error("expected stopped sender to stop")
+	}
+}
+
+func TestAdminServer(t *testing.T) {
+
+	control := newSenderControl(true)
+	aborted := atomic.NewBool(false)
+	server := httptest.NewServer(&adminServer{
+		control: control,
+		sm:      newTestStateManager(t, Config{}),
+		abort:   func() { aborted.Store(true) },
+		start:   time.Now(),
+	})
+	defer server.Close()
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+		wantState  SenderState
+	}{
+		{method: http.MethodPost, path: "/pause", wantStatus: http.StatusConflict, wantState: SenderStatePending},
+		{method: http.MethodPost, path: "/start", wantStatus: http.StatusOK, wantState: SenderStateRunning},
+		{method: http.MethodGet, path: "/pause", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/pause", wantStatus: http.StatusOK, wantState: SenderStatePaused},
+		{method: http.MethodGet, path: "/report", wantStatus: http.StatusOK, wantState: SenderStatePaused},
+		{method: http.MethodGet, path: "/snapshot", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/snapshot", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/resume", wantStatus: http.StatusOK, wantState: SenderStateRunning},
+		{method: http.MethodPost, path: "/abort", wantStatus: http.StatusOK, wantState: SenderStateAborted},
+		{method: http.MethodPost, path: "/resume", wantStatus: http.StatusConflict, wantState: SenderStateAborted},
+		{method: http.MethodPost, path: "/unknown", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := adminReport{}
+		if tt.wantState != "" {
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+		}
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != tt.wantStatus || got.State != tt.wantState {
+			t.Errorf("%s %s expected %d %q, got %d %q", tt.method, tt.path, tt.wantStatus, tt.wantState, resp.StatusCode, got.State)
+		}
+	}
+
+	if !aborted.Load() {
+		t.Error("expected abort to terminate the test")
+	}
+}
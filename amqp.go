@@ -0,0 +1,432 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// AMQPConfig configures the CloudEvents AMQP protocol binding, events are sent in the binary content mode with AMQP
+// 1.0: attributes are application properties prefixed with cloudEvents:, datacontenttype is the content-type property
+// and data is a data section.
+type AMQPConfig struct {
+	// Address is the address of the node events are sent to or received from, for example a queue.
+	Address string `json:"address" yaml:"address"`
+	// Username and Password authenticate with the SASL PLAIN mechanism, SASL ANONYMOUS is used when no username is
+	// specified.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+}
+
+type ReceiverAMQPConfig struct {
+	AMQPConfig `yaml:",inline"`
+
+	// Broker is the URL of the broker the receiver receives from, either amqp://host[:port] or amqps://host[:port].
+	Broker string `json:"broker" yaml:"broker"`
+	// Credit is the number of messages the broker can deliver to the receiver before they are settled.
+	//
+	// Defaults to DefaultAMQPCredit.
+	Credit uint32 `json:"credit" yaml:"credit"`
+}
+
+// DefaultAMQPCredit is the link credit of the receiver when none is configured.
+const DefaultAMQPCredit = 100
+
+const (
+	amqpConnectTimeout = 30 * time.Second
+
+	// amqpCloudEventsPrefix is the prefix of the application properties carrying event attributes, the
+	// cloudEvents_ prefix is accepted as well.
+	amqpCloudEventsPrefix = "cloudEvents:"
+)
+
+func (c *AMQPConfig) validate(field string) error {
+	if c.Address == "" {
+		return invalidErr(field+".address", errors.New("cannot be empty"))
+	}
+	if c.Password != "" && c.Username == "" {
+		return invalidErr(field+".username", errors.New("must be specified with a password"))
+	}
+	return nil
+}
+
+func validateAMQPBroker(field, broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return invalidErr(field, err)
+	}
+	if (u.Scheme != "amqp" && u.Scheme != "amqps") || u.Hostname() == "" {
+		return invalidErr(field, fmt.Errorf("%q must be an amqp:// or amqps:// URL", broker))
+	}
+	return nil
+}
+
+func (c *SenderConfig) validateAMQP() error {
+	if c.AMQP == nil {
+		return invalidErr("sender.amqp", fmt.Errorf("must be specified with the %s protocol", ProtocolAMQP))
+	}
+	if err := validateAMQPBroker("sender.target", c.Target); err != nil {
+		return err
+	}
+	if err := c.AMQP.validate("sender.amqp"); err != nil {
+		return err
+	}
+	if c.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolAMQP))
+	}
+	if c.Auth != nil {
+		return invalidErr("sender.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol, use sender.amqp.username and sender.amqp.password", ProtocolAMQP))
+	}
+	return nil
+}
+
+func (c *ReceiverConfig) validateAMQP() error {
+	if c.AMQP == nil {
+		return invalidErr("receiver.amqp", fmt.Errorf("must be specified with the %s protocol", ProtocolAMQP))
+	}
+	if err := validateAMQPBroker("receiver.amqp.broker", c.AMQP.Broker); err != nil {
+		return err
+	}
+	if err := c.AMQP.validate("receiver.amqp"); err != nil {
+		return err
+	}
+	if c.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolAMQP))
+	}
+	if c.TLS != nil {
+		return invalidErr("receiver.tls", fmt.Errorf("the receiver doesn't terminate TLS with the %s protocol, use an amqps:// broker", ProtocolAMQP))
+	}
+	if c.Auth != nil {
+		return invalidErr("receiver.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol", ProtocolAMQP))
+	}
+	return nil
+}
+
+// newAMQPMessage returns the message sending the given event in the binary content mode, hdr carries the trace headers
+// of the request.
+func newAMQPMessage(e *ce.Event, hdr http.Header) (*amqp.Message, error) {
+	attributes, err := binaryAttributes(e)
+	if err != nil {
+		return nil, err
+	}
+	// Messages are durable so that brokers don't lose them on restarts.
+	msg := &amqp.Message{
+		Header:                &amqp.MessageHeader{Durable: true},
+		ApplicationProperties: make(map[string]interface{}, len(attributes)+len(traceHeaders)),
+	}
+	for _, a := range attributes {
+		msg.ApplicationProperties[amqpCloudEventsPrefix+a[0]] = a[1]
+	}
+	for _, h := range traceHeaders {
+		if v := hdr.Get(h); v != "" {
+			msg.ApplicationProperties[h] = v
+		}
+	}
+	if ct := e.DataContentType(); ct != "" {
+		msg.Properties = &amqp.MessageProperties{ContentType: &ct}
+	}
+	if data := e.Data(); len(data) > 0 {
+		msg.Data = [][]byte{data}
+	}
+	return msg, nil
+}
+
+func formatAMQPValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case time.Time:
+		return types.Format(types.Timestamp{Time: v})
+	case []byte:
+		return types.Format(v)
+	case nil:
+		return "", errors.New("null value")
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// amqpEvent returns the event of a message in the binary content mode, application properties without the CloudEvents
+// prefix are ignored.
+func amqpEvent(msg *amqp.Message) (*ce.Event, error) {
+	e := ce.NewEvent()
+	for name, v := range msg.ApplicationProperties {
+		if !strings.HasPrefix(name, amqpCloudEventsPrefix) && !strings.HasPrefix(name, "cloudEvents_") {
+			continue
+		}
+		value, err := formatAMQPValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid application property %s: %w", name, err)
+		}
+		if err := setBinaryAttribute(&e, name[len(amqpCloudEventsPrefix):], value); err != nil {
+			return nil, err
+		}
+	}
+	var contentType string
+	if msg.Properties != nil && msg.Properties.ContentType != nil {
+		contentType = *msg.Properties.ContentType
+	}
+	var data []byte
+	for _, d := range msg.Data {
+		data = append(data, d...)
+	}
+	switch v := msg.Value.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	}
+	setBinaryData(&e, contentType, data)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// amqpHeader returns the trace headers carried by a message.
+func amqpHeader(msg *amqp.Message) http.Header {
+	hdr := http.Header{}
+	for _, h := range traceHeaders {
+		if v, ok := msg.ApplicationProperties[h].(string); ok {
+			hdr.Set(h, v)
+		}
+	}
+	return hdr
+}
+
+// amqpBinding is the protocolBinding of ProtocolAMQP.
+type amqpBinding struct{}
+
+func (amqpBinding) validateSender(c *SenderConfig) error {
+	return c.validateAMQP()
+}
+
+func (amqpBinding) validateReceiver(c *ReceiverConfig) error {
+	return c.validateAMQP()
+}
+
+func (amqpBinding) newTransport(config *Config) senderTransport {
+	return newAMQPTransport(config)
+}
+
+func (amqpBinding) startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	return startAMQPReceiver(ctx, config, h)
+}
+
+func (amqpBinding) resumes() bool {
+	return false
+}
+
+// amqpTransport is an http.RoundTripper sending the events of the requests built by the targeter to the broker, so
+// that events sent with AMQP are paced, measured and accounted for like with HTTP.
+type amqpTransport struct {
+	broker    string
+	tlsConfig *tls.Config
+	config    *AMQPConfig
+
+	lock   sync.Mutex
+	client *amqp.Client
+	sender *amqp.Sender
+}
+
+func newAMQPTransport(config *Config) *amqpTransport {
+	t := &amqpTransport{broker: config.Sender.Target, config: config.Sender.AMQP}
+	if config.Sender.TLS != nil {
+		t.tlsConfig = config.Sender.TLS.Parsed
+	}
+	return t
+}
+
+func (t *amqpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	msg, err := newAMQPMessage(&e, req.Header)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := t.connect(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Send(req.Context(), msg); err != nil {
+		var rejected *amqp.Error
+		if !errors.As(err, &rejected) && req.Context().Err() == nil {
+			// The connection or the link has been lost.
+			t.reset(s)
+		}
+		return nil, fmt.Errorf("message not accepted by the broker: %w", err)
+	}
+	return acceptedResponse(req), nil
+}
+
+// connect returns the sender link, the broker is dialed again when the connection has been lost.
+func (t *amqpTransport) connect(ctx context.Context) (*amqp.Sender, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.sender != nil {
+		return t.sender, nil
+	}
+	c, err := dialAMQP(ctx, t.broker, t.tlsConfig, t.config)
+	if err != nil {
+		return nil, err
+	}
+	session, err := c.NewSession()
+	if err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("failed to begin session: %w", err)
+	}
+	s, err := session.NewSender(amqp.LinkTargetAddress(t.config.Address))
+	if err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("failed to attach sender link to %s: %w", t.config.Address, err)
+	}
+	t.client, t.sender = c, s
+	return s, nil
+}
+
+// reset closes the connection of the given sender link when it is still the current one.
+func (t *amqpTransport) reset(s *amqp.Sender) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.sender == s {
+		_ = t.client.Close()
+		t.client, t.sender = nil, nil
+	}
+}
+
+func (t *amqpTransport) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.client != nil {
+		_ = t.client.Close()
+	}
+}
+
+// startAMQPReceiver receives events from the broker until the given context is done, events failing the handler are
+// settled with the modified outcome so that the broker delivers them again. The receiver settles messages in the second
+// settlement mode since in the first one messages are accepted when received.
+func startAMQPReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	broker, _ := url.Parse(config.AMQP.Broker)
+	path := "/" + strings.TrimPrefix(config.AMQP.Address, "/")
+
+	c, err := dialAMQP(ctx, config.AMQP.Broker, nil, &config.AMQP.AMQPConfig)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	session, err := c.NewSession()
+	if err != nil {
+		return fmt.Errorf("failed to begin session: %w", err)
+	}
+	credit := config.AMQP.Credit
+	if credit == 0 {
+		credit = DefaultAMQPCredit
+	}
+	r, err := session.NewReceiver(
+		amqp.LinkSourceAddress(config.AMQP.Address),
+		amqp.LinkCredit(credit),
+		amqp.LinkReceiverSettle(amqp.ModeSecond),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to attach receiver link to %s: %w", config.AMQP.Address, err)
+	}
+	markReceiverReady(ctx)
+
+	for {
+		msg, err := r.Receive(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := handleAMQPMessage(ctx, config, r, msg, broker.Host, path, h); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to settle message: %w", err)
+		}
+	}
+}
+
+// handleAMQPMessage handles a received message and settles it with its outcome.
+func handleAMQPMessage(ctx context.Context, config *ReceiverConfig, r *amqp.Receiver, msg *amqp.Message, remoteAddr, path string, h func(context.Context, *ce.Event, *http.Request) error) error {
+	start := time.Now()
+	req := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: path},
+		Header:     amqpHeader(msg),
+		RemoteAddr: remoteAddr,
+	}
+	defer func() {
+		processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(req, config, processingLatencyHistogramLabels)...)
+	}()
+
+	e, err := amqpEvent(msg)
+	if err != nil {
+		logger(LogComponentReceiver).Warnw("Invalid event", "address", config.AMQP.Address, "error", err)
+		return r.RejectMessage(ctx, msg, &amqp.Error{Condition: amqp.ErrorDecodeError, Description: err.Error()})
+	}
+	if err := h(ctx, e, req); err != nil {
+		// delivery-failed
+		return r.ModifyMessage(ctx, msg, true, false, nil)
+	}
+	return r.AcceptMessage(ctx, msg)
+}
+
+// dialAMQP connects to the given broker and authenticates with SASL.
+func dialAMQP(ctx context.Context, broker string, tlsConfig *tls.Config, config *AMQPConfig) (*amqp.Client, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	d := &net.Dialer{Timeout: amqpConnectTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "amqp":
+		conn, err = d.DialContext(ctx, "tcp", hostPort(u, "5672"))
+	case "amqps":
+		conn, err = (&tls.Dialer{NetDialer: d, Config: tlsConfig}).DialContext(ctx, "tcp", hostPort(u, "5671"))
+	default:
+		return nil, fmt.Errorf("unsupported broker URL %q", broker)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker %s: %w", u.Host, err)
+	}
+
+	sasl := amqp.ConnSASLAnonymous()
+	if config.Username != "" {
+		sasl = amqp.ConnSASLPlain(config.Username, config.Password)
+	}
+	// New closes the connection when it fails.
+	c, err := amqp.New(conn, amqp.ConnServerHostname(u.Hostname()), amqp.ConnConnectTimeout(amqpConnectTimeout), sasl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker %s: %w", u.Host, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,692 @@
+package sacura
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-amqp"
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestAMQPMessageRoundTrip(t *testing.T) {
+
+	binaryEvent := cetest.FullEvent()
+	if err := binaryEvent.SetData("application/octet-stream", []byte{0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	largeEvent := cetest.FullEvent()
+	if err := largeEvent.SetData("text/plain", strings.Repeat("a", 1000)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		event ce.Event
+	}{
+		{
+			name:  "full event",
+			event: cetest.FullEvent(),
+		},
+		{
+			name:  "min event",
+			event: cetest.MinEvent(),
+		},
+		{
+			name:  "binary data",
+			event: binaryEvent,
+		},
+		{
+			name:  "large data",
+			event: largeEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := http.Header{}
+			hdr.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+			msg, err := newAMQPMessage(&tt.event, hdr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := msg.MarshalBinary()
+			if err != nil {
+				t.Fatal(err)
+			}
+			msg = &amqp.Message{}
+			if err := msg.UnmarshalBinary(b); err != nil {
+				t.Fatal(err)
+			}
+			if got := amqpHeader(msg).Get("traceparent"); got != hdr.Get("traceparent") {
+				t.Errorf("expected traceparent %s, got %s", hdr.Get("traceparent"), got)
+			}
+
+			got, err := amqpEvent(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Extensions are compared regardless of their order and, like with the HTTP binary content mode, their
+			// type.
+			attributes := func(e *ce.Event) map[string]string {
+				b, err := e.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := map[string]interface{}{}
+				if err := json.Unmarshal(b, &m); err != nil {
+					t.Fatal(err)
+				}
+				s := make(map[string]string, len(m))
+				for k, v := range m {
+					s[k] = fmt.Sprint(v)
+				}
+				return s
+			}
+			if diff := cmp.Diff(attributes(&tt.event), attributes(got)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestAMQPEventInvalid(t *testing.T) {
+	for name, msg := range map[string]*amqp.Message{
+		"null attribute": {ApplicationProperties: map[string]interface{}{
+			"cloudEvents:specversion": "1.0", "cloudEvents:id": "1", "cloudEvents:source": "/source", "cloudEvents:type": nil,
+		}},
+		"missing attributes": {ApplicationProperties: map[string]interface{}{"cloudEvents:specversion": "1.0"}},
+		"not prefixed":       {ApplicationProperties: map[string]interface{}{"specversion": "1.0", "id": "1", "source": "/source", "type": "type"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := amqpEvent(msg); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestAMQPConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sender   SenderConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			sender:   SenderConfig{Target: "amqp://localhost:5672", AMQP: &AMQPConfig{Address: "events"}},
+			receiver: ReceiverConfig{AMQP: &ReceiverAMQPConfig{AMQPConfig: AMQPConfig{Address: "events", Username: "user", Password: "password"}, Broker: "amqps://localhost"}},
+		},
+		{
+			name:     "missing amqp config",
+			sender:   SenderConfig{Target: "amqp://localhost:5672"},
+			receiver: ReceiverConfig{},
+			wantErr:  true,
+		},
+		{
+			name:     "http target",
+			sender:   SenderConfig{Target: "http://localhost:5672", AMQP: &AMQPConfig{Address: "events"}},
+			receiver: ReceiverConfig{AMQP: &ReceiverAMQPConfig{AMQPConfig: AMQPConfig{Address: "events"}, Broker: "http://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "empty address",
+			sender:   SenderConfig{Target: "amqp://localhost:5672", AMQP: &AMQPConfig{}},
+			receiver: ReceiverConfig{AMQP: &ReceiverAMQPConfig{Broker: "amqp://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "password without username",
+			sender:   SenderConfig{Target: "amqp://localhost:5672", AMQP: &AMQPConfig{Address: "events", Password: "password"}},
+			receiver: ReceiverConfig{AMQP: &ReceiverAMQPConfig{AMQPConfig: AMQPConfig{Address: "events", Password: "password"}, Broker: "amqp://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender batches and receiver auth",
+			sender:   SenderConfig{Target: "amqp://localhost:5672", AMQP: &AMQPConfig{Address: "events"}, BatchSize: 10},
+			receiver: ReceiverConfig{AMQP: &ReceiverAMQPConfig{AMQPConfig: AMQPConfig{Address: "events"}, Broker: "amqp://localhost"}, Auth: &ReceiverAuthConfig{Token: "token"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.validateAMQP(); (err != nil) != tt.wantErr {
+				t.Errorf("sender wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err := tt.receiver.validateAMQP(); (err != nil) != tt.wantErr {
+				t.Errorf("receiver wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// testAMQPBroker is a minimal broker forwarding the messages of sender links to the receiver links attached to the
+// same address, its small maximum frame size splits messages into several transfers.
+type testAMQPBroker struct {
+	listener net.Listener
+
+	lock         sync.Mutex
+	receivers    map[string][]*testAMQPConn
+	dispositions []uint64
+}
+
+type testAMQPConn struct {
+	lock sync.Mutex
+	conn net.Conn
+	// nextDeliveryID is the identifier of the next delivery sent to a receiver link.
+	nextDeliveryID uint32
+}
+
+func (c *testAMQPConn) write(typ byte, performative *testAMQPDescribed, payload []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_ = writeTestAMQPFrame(c.conn, typ, performative, payload)
+}
+
+const (
+	testAMQPMaxFrameSize = 512
+
+	// Performatives, outcomes and sections of the test broker.
+	testAMQPOpen        = 0x10
+	testAMQPBegin       = 0x11
+	testAMQPAttach      = 0x12
+	testAMQPFlow        = 0x13
+	testAMQPTransfer    = 0x14
+	testAMQPDisposition = 0x15
+	testAMQPClose       = 0x18
+	testAMQPAccepted    = 0x24
+	testAMQPModified    = 0x27
+	testAMQPSource      = 0x28
+	testAMQPTarget      = 0x29
+
+	testAMQPSASLMechanisms = 0x40
+	testAMQPSASLInit       = 0x41
+	testAMQPSASLOutcome    = 0x44
+
+	testAMQPFrameTypeAMQP = 0
+	testAMQPFrameTypeSASL = 1
+)
+
+var (
+	testAMQPSASLProtocolHeader = []byte{'A', 'M', 'Q', 'P', 3, 1, 0, 0}
+	testAMQPProtocolHeader     = []byte{'A', 'M', 'Q', 'P', 0, 1, 0, 0}
+)
+
+func startTestAMQPBroker(t *testing.T) *testAMQPBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testAMQPBroker{listener: l, receivers: map[string][]*testAMQPConn{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&testAMQPConn{conn: conn})
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return b
+}
+
+func (b *testAMQPBroker) url() string {
+	return "amqp://" + b.listener.Addr().String()
+}
+
+func (b *testAMQPBroker) serve(c *testAMQPConn) {
+	defer c.conn.Close()
+
+	r := bufio.NewReader(c.conn)
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return
+	}
+	_, _ = c.conn.Write(testAMQPSASLProtocolHeader)
+	c.write(testAMQPFrameTypeSASL, &testAMQPDescribed{descriptor: testAMQPSASLMechanisms, value: []interface{}{testAMQPSymbol("ANONYMOUS")}}, nil)
+
+	var address string
+	var deliveryID interface{}
+	var delivery []byte
+	for {
+		f, err := readTestAMQPFrame(r)
+		if err != nil {
+			return
+		}
+		if f.performative == nil {
+			continue
+		}
+		p := f.performative
+		switch p.descriptor {
+		case testAMQPSASLInit:
+			c.write(testAMQPFrameTypeSASL, &testAMQPDescribed{descriptor: testAMQPSASLOutcome, value: []interface{}{uint8(0)}}, nil)
+			if _, err := io.ReadFull(r, header); err != nil {
+				return
+			}
+			_, _ = c.conn.Write(testAMQPProtocolHeader)
+		case testAMQPOpen:
+			c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPOpen, value: []interface{}{"broker", nil, uint32(testAMQPMaxFrameSize)}}, nil)
+		case testAMQPBegin:
+			c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPBegin, value: []interface{}{uint16(0), uint32(0), uint32(10000), uint32(10000)}}, nil)
+		case testAMQPAttach:
+			role, _ := testAMQPField(p.value, 2).(bool)
+			source, _ := testAMQPField(p.value, 5).(*testAMQPDescribed)
+			target, _ := testAMQPField(p.value, 6).(*testAMQPDescribed)
+			// The settlement modes requested by the client are granted.
+			var senderSettleMode, receiverSettleMode, initialDeliveryCount interface{}
+			if m, ok := testAMQPField(p.value, 3).(uint64); ok {
+				senderSettleMode = uint8(m)
+			}
+			if m, ok := testAMQPField(p.value, 4).(uint64); ok {
+				receiverSettleMode = uint8(m)
+			}
+			if role {
+				address, _ = testAMQPField(source.value, 0).(string)
+				initialDeliveryCount = uint32(0)
+			} else {
+				address, _ = testAMQPField(target.value, 0).(string)
+			}
+			c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPAttach, value: []interface{}{
+				testAMQPField(p.value, 0), uint32(0), !role, senderSettleMode, receiverSettleMode,
+				&testAMQPDescribed{descriptor: testAMQPSource, value: []interface{}{address}},
+				&testAMQPDescribed{descriptor: testAMQPTarget, value: []interface{}{address}},
+				nil, false, initialDeliveryCount,
+			}}, nil)
+			if role {
+				b.lock.Lock()
+				b.receivers[address] = append(b.receivers[address], c)
+				b.lock.Unlock()
+			} else {
+				c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPFlow, value: []interface{}{
+					uint32(0), uint32(10000), uint32(0), uint32(10000), uint32(0), uint32(0), uint32(1000),
+				}}, nil)
+			}
+		case testAMQPTransfer:
+			// The delivery identifier is only set on the first transfer of a delivery.
+			if delivery == nil {
+				deliveryID = testAMQPField(p.value, 1)
+			}
+			delivery = append(delivery, f.payload...)
+			if more, _ := testAMQPField(p.value, 5).(bool); more {
+				continue
+			}
+			b.lock.Lock()
+			for _, s := range b.receivers[address] {
+				s.lock.Lock()
+				id := s.nextDeliveryID
+				s.nextDeliveryID++
+				s.lock.Unlock()
+				s.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPTransfer, value: []interface{}{
+					uint32(0), id, []byte{byte(id)}, uint32(0), false, false,
+				}}, delivery)
+			}
+			b.lock.Unlock()
+			delivery = nil
+			c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPDisposition, value: []interface{}{
+				true, uint32(testAMQPUint(deliveryID)), nil, true, &testAMQPDescribed{descriptor: testAMQPAccepted, value: []interface{}{}},
+			}}, nil)
+		case testAMQPDisposition:
+			outcome, ok := testAMQPField(p.value, 4).(*testAMQPDescribed)
+			if !ok {
+				continue
+			}
+			b.lock.Lock()
+			b.dispositions = append(b.dispositions, outcome.descriptor)
+			b.lock.Unlock()
+			// The receiver settles in the second mode, it waits for the broker to settle the delivery.
+			if settled, _ := testAMQPField(p.value, 3).(bool); !settled {
+				c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPDisposition, value: []interface{}{
+					false, uint32(testAMQPUint(testAMQPField(p.value, 1))), nil, true, outcome,
+				}}, nil)
+			}
+		case testAMQPClose:
+			c.write(testAMQPFrameTypeAMQP, &testAMQPDescribed{descriptor: testAMQPClose, value: []interface{}{}}, nil)
+			return
+		}
+	}
+}
+
+func TestStartReceiverAMQP(t *testing.T) {
+
+	broker := startTestAMQPBroker(t)
+	amqp := AMQPConfig{Address: "events"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Protocol: ProtocolAMQP,
+			AMQP:     &ReceiverAMQPConfig{AMQPConfig: amqp, Broker: broker.url()},
+		}, received, nil)
+	}()
+
+	// Wait for the receiver link, messages sent before it are not delivered.
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		broker.lock.Lock()
+		defer broker.lock.Unlock()
+		return len(broker.receivers) > 0, nil
+	})
+	if err != nil {
+		t.Fatal("receiver didn't attach", err)
+	}
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             broker.url(),
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolAMQP,
+			AMQP:               &amqp,
+		},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	var dispositions []uint64
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		broker.lock.Lock()
+		defer broker.lock.Unlock()
+		dispositions = broker.dispositions
+		return len(dispositions) == 10, nil
+	})
+	if err != nil {
+		t.Errorf("expected 10 dispositions, got %v", dispositions)
+	}
+	for _, d := range dispositions {
+		if d != testAMQPAccepted {
+			t.Errorf("expected accepted outcomes, got %v", dispositions)
+		}
+	}
+}
+
+// testAMQPFrame is a frame decoded by the test broker.
+type testAMQPFrame struct {
+	// performative is nil for empty frames.
+	performative *testAMQPDescribed
+	payload      []byte
+}
+
+func readTestAMQPFrame(r *bufio.Reader) (testAMQPFrame, error) {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return testAMQPFrame{}, err
+	}
+	size := binary.BigEndian.Uint32(header)
+	offset := int(header[4]) * 4
+	if size < 8 || offset < 8 || offset > int(size) {
+		return testAMQPFrame{}, fmt.Errorf("malformed frame header %v", header)
+	}
+	b := make([]byte, size-8)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return testAMQPFrame{}, err
+	}
+
+	body := b[offset-8:]
+	if len(body) == 0 {
+		return testAMQPFrame{}, nil
+	}
+	d := testAMQPDecoder{b: body}
+	v := d.value()
+	if d.err != nil {
+		return testAMQPFrame{}, fmt.Errorf("malformed frame: %w", d.err)
+	}
+	p, ok := v.(*testAMQPDescribed)
+	if !ok {
+		return testAMQPFrame{}, fmt.Errorf("malformed frame: expected a performative, got %T", v)
+	}
+	return testAMQPFrame{performative: p, payload: d.b}, nil
+}
+
+func writeTestAMQPFrame(w io.Writer, typ byte, performative *testAMQPDescribed, payload []byte) error {
+	b := make([]byte, 8, 64+len(payload))
+	b[4] = 2 // Data offset in 4 bytes words.
+	b[5] = typ
+	b, err := appendTestAMQP(b, performative)
+	if err != nil {
+		return err
+	}
+	b = append(b, payload...)
+	binary.BigEndian.PutUint32(b, uint32(len(b)))
+	_, err = w.Write(b)
+	return err
+}
+
+type testAMQPSymbol string
+
+// testAMQPDescribed is a described value, performatives, outcomes and message sections are lists or values described
+// by their code.
+type testAMQPDescribed struct {
+	descriptor uint64
+	value      interface{}
+}
+
+// testAMQPField returns the i-th field of the given list, or nil when the list is shorter.
+func testAMQPField(list interface{}, i int) interface{} {
+	if l, ok := list.([]interface{}); ok && i < len(l) {
+		return l[i]
+	}
+	return nil
+}
+
+// testAMQPUint returns the given decoded unsigned integer, or 0 when it is null.
+func testAMQPUint(v interface{}) uint64 {
+	n, _ := v.(uint64)
+	return n
+}
+
+// appendTestAMQP appends the AMQP encoding of the given value, the Go type of the value determines the AMQP type.
+func appendTestAMQP(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0x40), nil
+	case bool:
+		if v {
+			return append(b, 0x41), nil
+		}
+		return append(b, 0x42), nil
+	case uint8:
+		return append(b, 0x50, v), nil
+	case uint16:
+		return append(b, 0x60, byte(v>>8), byte(v)), nil
+	case uint32:
+		return appendTestAMQPUint32(append(b, 0x70), v), nil
+	case uint64:
+		if v < 256 {
+			return append(b, 0x53, byte(v)), nil
+		}
+		return appendTestAMQPUint32(appendTestAMQPUint32(append(b, 0x80), uint32(v>>32)), uint32(v)), nil
+	case string:
+		return appendTestAMQPVariable(b, 0xb1, []byte(v)), nil
+	case testAMQPSymbol:
+		return appendTestAMQPVariable(b, 0xb3, []byte(v)), nil
+	case []byte:
+		return appendTestAMQPVariable(b, 0xb0, v), nil
+	case []interface{}:
+		var items []byte
+		for _, item := range v {
+			var err error
+			if items, err = appendTestAMQP(items, item); err != nil {
+				return nil, err
+			}
+		}
+		// Lists are always encoded with four bytes sizes.
+		b = appendTestAMQPUint32(appendTestAMQPUint32(append(b, 0xd0), uint32(len(items)+4)), uint32(len(v)))
+		return append(b, items...), nil
+	case *testAMQPDescribed:
+		b, err := appendTestAMQP(append(b, 0x00), v.descriptor)
+		if err != nil {
+			return nil, err
+		}
+		return appendTestAMQP(b, v.value)
+	default:
+		return nil, fmt.Errorf("unsupported AMQP type %T", v)
+	}
+}
+
+// appendTestAMQPVariable appends a variable width value with the given four bytes size constructor.
+func appendTestAMQPVariable(b []byte, constructor byte, v []byte) []byte {
+	return append(appendTestAMQPUint32(append(b, constructor), uint32(len(v))), v...)
+}
+
+func appendTestAMQPUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// testAMQPDecoder decodes AMQP values, after the first error it returns nil values.
+//
+// Unsigned integers are decoded as uint64, signed integers as int64, lists, maps and arrays as []interface{} and
+// described values as *testAMQPDescribed, other types are skipped and decoded as nil.
+type testAMQPDecoder struct {
+	b   []byte
+	err error
+}
+
+func (d *testAMQPDecoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *testAMQPDecoder) uint(n int) uint64 {
+	var v uint64
+	for _, b := range d.next(n) {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func (d *testAMQPDecoder) value() interface{} {
+	constructor := d.uint(1)
+	if d.err != nil {
+		return nil
+	}
+	if constructor == 0x00 {
+		descriptor, _ := d.value().(uint64)
+		return &testAMQPDescribed{descriptor: descriptor, value: d.value()}
+	}
+	return d.valueOf(byte(constructor))
+}
+
+func (d *testAMQPDecoder) valueOf(constructor byte) interface{} {
+	switch constructor {
+	case 0x40:
+		return nil
+	case 0x41:
+		return true
+	case 0x42:
+		return false
+	case 0x56:
+		return d.uint(1) != 0
+	case 0x43, 0x44:
+		return uint64(0)
+	case 0x50, 0x52, 0x53:
+		return d.uint(1)
+	case 0x60:
+		return d.uint(2)
+	case 0x70:
+		return d.uint(4)
+	case 0x80:
+		return d.uint(8)
+	case 0x51, 0x54, 0x55:
+		return int64(int8(d.uint(1)))
+	case 0x61:
+		return int64(int16(d.uint(2)))
+	case 0x71:
+		return int64(int32(d.uint(4)))
+	case 0x81:
+		return int64(d.uint(8))
+	case 0x72, 0x73, 0x74:
+		d.next(4)
+		return nil
+	case 0x82, 0x83, 0x84:
+		d.next(8)
+		return nil
+	case 0x94, 0x98:
+		d.next(16)
+		return nil
+	case 0xa0, 0xb0, 0xa1, 0xb1, 0xa3, 0xb3:
+		size := 1
+		if constructor&0xf0 == 0xb0 {
+			size = 4
+		}
+		v := d.next(int(d.uint(size)))
+		switch constructor & 0x0f {
+		case 0x01:
+			return string(v)
+		case 0x03:
+			return testAMQPSymbol(v)
+		}
+		return append([]byte(nil), v...)
+	case 0x45:
+		return []interface{}{}
+	case 0xc0, 0xd0, 0xc1, 0xd1, 0xe0, 0xf0:
+		size := 1
+		if constructor&0xf0 != 0xc0 && constructor != 0xe0 {
+			size = 4
+		}
+		d.uint(size)
+		count := int(d.uint(size))
+		if count > len(d.b) {
+			d.err = fmt.Errorf("malformed compound of %d values", count)
+			return nil
+		}
+		var items []interface{}
+		if constructor == 0xe0 || constructor == 0xf0 {
+			element := byte(d.uint(1))
+			for i := 0; i < count && d.err == nil; i++ {
+				items = append(items, d.valueOf(element))
+			}
+		} else {
+			for i := 0; i < count && d.err == nil; i++ {
+				items = append(items, d.value())
+			}
+		}
+		return items
+	default:
+		if d.err == nil {
+			d.err = fmt.Errorf("unknown constructor 0x%02x", constructor)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,262 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+type AnomalyKind string
+
+const (
+	// AnomalyReceiveStall is a period longer than report.anomalies.receiveStall without any event received while
+	// sent events were outstanding.
+	AnomalyReceiveStall AnomalyKind = "receiveStall"
+	// AnomalyLatencySpike is a period whose median latency exceeds report.anomalies.latencySpikeFactor times the
+	// median latency of the test.
+	AnomalyLatencySpike AnomalyKind = "latencySpike"
+	// AnomalyDuplicateBurst is a period with at least report.anomalies.duplicateBurst duplicates per interval of the
+	// throughput timeline.
+	AnomalyDuplicateBurst AnomalyKind = "duplicateBurst"
+
+	// DefaultAnomalyReceiveStall is the default minimum duration of receive stalls.
+	DefaultAnomalyReceiveStall = 5 * time.Second
+	// DefaultAnomalyLatencySpikeFactor is the default ratio to the median latency of latency spikes.
+	DefaultAnomalyLatencySpikeFactor = 5
+	// DefaultAnomalyDuplicateBurst is the default minimum number of duplicates per interval of duplicate bursts.
+	DefaultAnomalyDuplicateBurst = 10
+)
+
+// AnomaliesConfig annotates the report with the anomalies found in the send, receive and latency series of the test,
+// like receive stalls, latency spikes and duplicate bursts, so that incident windows are found without eyeballing the
+// throughput timeline. Latency spikes and duplicate bursts are detected over the intervals of the throughput timeline.
+type AnomaliesConfig struct {
+	// ReceiveStall is the minimum duration of receive stalls, for example 5s.
+	//
+	// Defaults to DefaultAnomalyReceiveStall.
+	ReceiveStall string `json:"receiveStall" yaml:"receiveStall"`
+	// LatencySpikeFactor is the ratio to the median latency of the test above which the median latency of an
+	// interval is a spike.
+	//
+	// Defaults to DefaultAnomalyLatencySpikeFactor.
+	LatencySpikeFactor float64 `json:"latencySpikeFactor" yaml:"latencySpikeFactor"`
+	// DuplicateBurst is the minimum number of duplicates received during an interval for it to be a burst.
+	//
+	// Defaults to DefaultAnomalyDuplicateBurst.
+	DuplicateBurst int `json:"duplicateBurst" yaml:"duplicateBurst"`
+
+	ParsedReceiveStall time.Duration
+}
+
+func (c *AnomaliesConfig) validate(config *Config) error {
+	if config.Verification.Mode.streams() {
+		return invalidErr("report.anomalies", fmt.Errorf("is only supported in the %s verification mode", VerificationModeFull))
+	}
+	c.ParsedReceiveStall = DefaultAnomalyReceiveStall
+	if c.ReceiveStall != "" {
+		var err error
+		c.ParsedReceiveStall, err = time.ParseDuration(c.ReceiveStall)
+		if err != nil {
+			return invalidErr("report.anomalies.receiveStall", err)
+		}
+		if c.ParsedReceiveStall <= 0 {
+			return invalidErr("report.anomalies.receiveStall", fmt.Errorf("%v must be positive", c.ParsedReceiveStall))
+		}
+	}
+	if c.LatencySpikeFactor == 0 {
+		c.LatencySpikeFactor = DefaultAnomalyLatencySpikeFactor
+	}
+	if c.LatencySpikeFactor <= 1 {
+		return invalidErr("report.anomalies.latencySpikeFactor", fmt.Errorf("%v must be greater than 1", c.LatencySpikeFactor))
+	}
+	if c.DuplicateBurst < 0 {
+		return invalidErr("report.anomalies.duplicateBurst", errors.New("cannot be negative"))
+	}
+	if c.DuplicateBurst == 0 {
+		c.DuplicateBurst = DefaultAnomalyDuplicateBurst
+	}
+	return nil
+}
+
+// Anomaly is a period of the test annotated by report.anomalies.
+type Anomaly struct {
+	Kind  AnomalyKind `json:"kind"`
+	Start time.Time   `json:"start"`
+	End   time.Time   `json:"end"`
+	// Offset is the start of the anomaly from the first sent event, like the offsets of the throughput timeline.
+	Offset time.Duration `json:"offset"`
+	// Description describes the anomaly, for example "median latency 1.2s, 8.0x the median latency of the test".
+	Description string `json:"description"`
+}
+
+// recordDuplicateAt records the receive time of a duplicate, it must be called while holding the lock.
+func (s *StateManager) recordDuplicateAt(e *ReceivedEvent) {
+	if s.config.Report.Anomalies == nil || e.ReceivedAt.IsZero() {
+		return
+	}
+	s.duplicatesAt = append(s.duplicatesAt, e.ReceivedAt)
+}
+
+// anomaliesReport annotates the anomalies of the test, it must be called while holding the lock and after the
+// throughput timeline has been reported.
+func (s *StateManager) anomaliesReport(r *Report) {
+	config := s.config.Report.Anomalies
+	if config == nil {
+		return
+	}
+	var start time.Time
+	for _, t := range s.sentAt {
+		if !t.IsZero() && (start.IsZero() || t.Before(start)) {
+			start = t
+		}
+	}
+	if start.IsZero() {
+		return
+	}
+
+	anomalies := s.receiveStalls(config, start)
+	if interval := r.ThroughputInterval; interval > 0 {
+		anomalies = append(anomalies, s.latencySpikes(config, start, interval)...)
+		anomalies = append(anomalies, s.duplicateBursts(config, start, interval)...)
+	}
+	if len(anomalies) == 0 {
+		return
+	}
+	sort.SliceStable(anomalies, func(i, j int) bool { return anomalies[i].Start.Before(anomalies[j].Start) })
+	r.Anomalies = anomalies
+}
+
+// receiveStalls returns the gaps between consecutive receives longer than the configured stall while events were
+// outstanding for longer than the stall, the gap before the first receive counts from the first sent event. Gaps
+// while nothing was sent, like pauses of the sender, aren't stalls.
+func (s *StateManager) receiveStalls(config *AnomaliesConfig, start time.Time) []Anomaly {
+	received := make([]time.Time, 0, len(s.receivedAt))
+	for _, t := range s.receivedAt {
+		if !t.IsZero() && !t.Before(start) {
+			received = append(received, t)
+		}
+	}
+	sort.Slice(received, func(i, j int) bool { return received[i].Before(received[j]) })
+
+	var anomalies []Anomaly
+	previous := start
+	for _, t := range received {
+		if t.Sub(previous) > config.ParsedReceiveStall && s.outstanding(t.Add(-config.ParsedReceiveStall), t) {
+			anomalies = append(anomalies, Anomaly{
+				Kind:        AnomalyReceiveStall,
+				Start:       previous,
+				End:         t,
+				Offset:      previous.Sub(start),
+				Description: fmt.Sprintf("no events received for %v", t.Sub(previous)),
+			})
+		}
+		previous = t
+	}
+	return anomalies
+}
+
+// outstanding returns whether an event sent before sentBefore has been received at or after to, or never.
+func (s *StateManager) outstanding(sentBefore, to time.Time) bool {
+	for id, sentAt := range s.sentAt {
+		if sentAt.IsZero() || !sentAt.Before(sentBefore) {
+			continue
+		}
+		if receivedAt, ok := s.receivedAt[id]; !ok || !receivedAt.Before(to) {
+			return true
+		}
+	}
+	return false
+}
+
+// latencySpikes returns the consecutive intervals whose median latency, by receive time, exceeds the configured factor
+// times the median latency of the test.
+func (s *StateManager) latencySpikes(config *AnomaliesConfig, start time.Time, interval time.Duration) []Anomaly {
+	var all []time.Duration
+	byInterval := make(map[int][]time.Duration)
+	for id, receivedAt := range s.receivedAt {
+		sentAt, ok := s.sentAt[id]
+		if !ok || sentAt.IsZero() || receivedAt.Before(start) {
+			continue
+		}
+		latency := receivedAt.Sub(sentAt)
+		all = append(all, latency)
+		i := int(receivedAt.Sub(start) / interval)
+		byInterval[i] = append(byInterval[i], latency)
+	}
+	if len(all) == 0 {
+		return nil
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+	median := percentile(all, 0.5)
+	if median <= 0 {
+		return nil
+	}
+
+	medians := make(map[int]time.Duration, len(byInterval))
+	for i, latencies := range byInterval {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		if m := percentile(latencies, 0.5); float64(m) > config.LatencySpikeFactor*float64(median) {
+			medians[i] = m
+		}
+	}
+	indexes := make([]int, 0, len(medians))
+	for i := range medians {
+		indexes = append(indexes, i)
+	}
+	return intervalAnomalies(AnomalyLatencySpike, start, interval, indexes, func(first, last int) string {
+		peak := time.Duration(0)
+		for i := first; i <= last; i++ {
+			if medians[i] > peak {
+				peak = medians[i]
+			}
+		}
+		return fmt.Sprintf("median latency up to %v, %.1fx the median latency of the test %v", peak, float64(peak)/float64(median), median)
+	})
+}
+
+// duplicateBursts returns the consecutive intervals with at least the configured number of duplicates.
+func (s *StateManager) duplicateBursts(config *AnomaliesConfig, start time.Time, interval time.Duration) []Anomaly {
+	counts := make(map[int]int)
+	for _, t := range s.duplicatesAt {
+		if !t.Before(start) {
+			counts[int(t.Sub(start)/interval)]++
+		}
+	}
+	var indexes []int
+	for i, n := range counts {
+		if n >= config.DuplicateBurst {
+			indexes = append(indexes, i)
+		}
+	}
+	return intervalAnomalies(AnomalyDuplicateBurst, start, interval, indexes, func(first, last int) string {
+		total := 0
+		for i := first; i <= last; i++ {
+			total += counts[i]
+		}
+		return fmt.Sprintf("%d duplicates received", total)
+	})
+}
+
+// intervalAnomalies merges the anomalous intervals with the given indexes into anomalies spanning consecutive
+// intervals.
+func intervalAnomalies(kind AnomalyKind, start time.Time, interval time.Duration, indexes []int, describe func(first, last int) string) []Anomaly {
+	sort.Ints(indexes)
+
+	var anomalies []Anomaly
+	for n := 0; n < len(indexes); {
+		first, last := indexes[n], indexes[n]
+		for n++; n < len(indexes) && indexes[n] == last+1; n++ {
+			last = indexes[n]
+		}
+		offset := time.Duration(first) * interval
+		anomalies = append(anomalies, Anomaly{
+			Kind:        kind,
+			Start:       start.Add(offset),
+			End:         start.Add(time.Duration(last+1) * interval),
+			Offset:      offset,
+			Description: describe(first, last),
+		})
+	}
+	return anomalies
+}
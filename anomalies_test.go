@@ -0,0 +1,141 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnomaliesConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  AnomaliesConfig
+		mode    VerificationMode
+		want    AnomaliesConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+			want: AnomaliesConfig{LatencySpikeFactor: DefaultAnomalyLatencySpikeFactor, DuplicateBurst: DefaultAnomalyDuplicateBurst, ParsedReceiveStall: DefaultAnomalyReceiveStall},
+		},
+		{
+			name:   "custom",
+			config: AnomaliesConfig{ReceiveStall: "30s", LatencySpikeFactor: 2.5, DuplicateBurst: 100},
+			want:   AnomaliesConfig{ReceiveStall: "30s", LatencySpikeFactor: 2.5, DuplicateBurst: 100, ParsedReceiveStall: 30 * time.Second},
+		},
+		{name: "invalid stall", config: AnomaliesConfig{ReceiveStall: "5"}, wantErr: true},
+		{name: "zero stall", config: AnomaliesConfig{ReceiveStall: "0s"}, wantErr: true},
+		{name: "factor not above 1", config: AnomaliesConfig{LatencySpikeFactor: 1}, wantErr: true},
+		{name: "negative burst", config: AnomaliesConfig{DuplicateBurst: -1}, wantErr: true},
+		{name: "streaming", mode: VerificationModeStreaming, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&Config{Verification: VerificationConfig{Mode: tt.mode}})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerAnomalies(t *testing.T) {
+	config := Config{Report: ReportConfig{
+		ParsedThroughputInterval: time.Second,
+		Anomalies:                &AnomaliesConfig{},
+	}}
+	if err := config.Report.Anomalies.validate(&config); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	start := time.Now()
+	var sent []ce.Event
+	for i := 0; i < 20; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		setSentTimestamp(&e, start.Add(time.Duration(i)*100*time.Millisecond))
+		sent = append(sent, e)
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	// The first half is received within 10ms, then the receiver stalls until 12s, receives the second half late and
+	// a burst of redeliveries at 13s.
+	lastOnTime := start
+	for i := 0; i < 10; i++ {
+		lastOnTime = start.Add(time.Duration(i)*100*time.Millisecond + 10*time.Millisecond)
+		sm.recordReceived(&ReceivedEvent{Event: sent[i], ReceivedAt: lastOnTime})
+	}
+	for i := 10; i < 20; i++ {
+		sm.recordReceived(&ReceivedEvent{Event: sent[i], ReceivedAt: start.Add(12*time.Second + time.Duration(i)*time.Millisecond)})
+	}
+	for i := 0; i < DefaultAnomalyDuplicateBurst; i++ {
+		sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: start.Add(13*time.Second + time.Duration(i)*time.Millisecond)})
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 20})
+
+	report := sm.GenerateReport()
+	type anomaly struct {
+		Kind   AnomalyKind
+		Start  time.Time
+		End    time.Time
+		Offset time.Duration
+	}
+	var got []anomaly
+	for _, a := range report.Anomalies {
+		got = append(got, anomaly{Kind: a.Kind, Start: a.Start, End: a.End, Offset: a.Offset})
+	}
+	want := []anomaly{
+		{Kind: AnomalyReceiveStall, Start: lastOnTime, End: start.Add(12*time.Second + 10*time.Millisecond), Offset: lastOnTime.Sub(start)},
+		{Kind: AnomalyLatencySpike, Start: start.Add(12 * time.Second), End: start.Add(13 * time.Second), Offset: 12 * time.Second},
+		{Kind: AnomalyDuplicateBurst, Start: start.Add(13 * time.Second), End: start.Add(14 * time.Second), Offset: 13 * time.Second},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatal("(-want, +got)", diff)
+	}
+	if d := report.Anomalies[2].Description; d != "10 duplicates received" {
+		t.Errorf("unexpected description %q", d)
+	}
+}
+
+func TestStateManagerAnomaliesNone(t *testing.T) {
+	config := Config{Report: ReportConfig{Anomalies: &AnomaliesConfig{}}}
+	if err := config.Report.Anomalies.validate(&config); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+	start := time.Now()
+	sm.lock.Lock()
+	for i := 0; i < 10; i++ {
+		sentAt := start.Add(time.Duration(i) * time.Second)
+		if i >= 5 {
+			// The sender pauses for 10s, nothing is outstanding.
+			sentAt = sentAt.Add(10 * time.Second)
+		}
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		setSentTimestamp(&e, sentAt)
+		sm.recordSent(&e)
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: sentAt.Add(10 * time.Millisecond)})
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 10})
+
+	if report := sm.GenerateReport(); len(report.Anomalies) > 0 {
+		t.Errorf("want no anomalies, got %+v", report.Anomalies)
+	}
+}
@@ -0,0 +1,368 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// DefaultApproximateCapacity is the number of events waiting to be matched tracked in approximate verification mode
+// when none is configured.
+const DefaultApproximateCapacity = 1_000_000
+
+// ApproximateConfig configures the approximate verification mode, a streaming verification storing 16-bit
+// fingerprints of events in cuckoo filters instead of their IDs, so that memory drops from GBs to MBs in extreme-scale
+// runs at the cost of estimated lost and unexpected counts.
+type ApproximateConfig struct {
+	// Capacity is the maximum number of sent events not received yet, and of received events not sent yet, tracked
+	// at the same time. Memory is between 4 and 9 bytes for each event of capacity, events beyond it are untracked
+	// and fail the verification.
+	//
+	// Defaults to DefaultApproximateCapacity.
+	Capacity int `json:"capacity" yaml:"capacity"`
+}
+
+func (c *ApproximateConfig) validate(verification *VerificationConfig) error {
+	if c.Capacity < 0 {
+		return invalidErr("verification.approximate.capacity", fmt.Errorf("%d cannot be negative", c.Capacity))
+	}
+	if c.Capacity == 0 {
+		c.Capacity = DefaultApproximateCapacity
+	}
+	if verification.MaxDeliveryAge != "" {
+		return invalidErr("verification.maxDeliveryAge", errors.New("is not supported in approximate verification mode"))
+	}
+	if verification.Attributes != nil {
+		return invalidErr("verification.attributes", errors.New("is not supported in approximate verification mode"))
+	}
+	return nil
+}
+
+// ApproximateReport reports the error bound of the approximate verification mode.
+type ApproximateReport struct {
+	// FalsePositiveRate is the upper bound of the probability that looking up an event matches the fingerprint of
+	// another event.
+	FalsePositiveRate float64 `json:"falsePositiveRate"`
+	// LostCountErrorBound is the expected number of false positive matches, LostCount and UnexpectedCount are
+	// underestimated by at most as many events on average.
+	LostCountErrorBound int `json:"lostCountErrorBound"`
+	// Capacity is verification.approximate.capacity.
+	Capacity int `json:"capacity"`
+	// UntrackedCount is the number of events that didn't fit in the filters, the estimate isn't bounded unless it is
+	// 0.
+	UntrackedCount int `json:"untrackedCount"`
+	// MemoryBytes is the memory used by the filters.
+	MemoryBytes int `json:"memoryBytes"`
+}
+
+func verifyApproximate(report Report) error {
+	if report.Approximate == nil || report.Approximate.UntrackedCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events exceeded the approximate verification capacity %d, the lost count estimate isn't bounded, increase verification.approximate.capacity",
+		report.Approximate.UntrackedCount,
+		report.Approximate.Capacity,
+	)
+}
+
+// approximateState is the part of the streaming state specific to the approximate verification mode, outstanding
+// and unmatched events are fingerprints without partition key nor send time, so they are only counted, latencies are
+// measured from the send timestamp of received events.
+type approximateState struct {
+	outstanding *cuckooFilter
+	unmatched   *cuckooFilter
+	// matched are the fingerprints of the most recently matched events in two generations, matched[0] is filled
+	// until it holds maxMatched events, then it replaces matched[1].
+	matched    [2]*cuckooFilter
+	maxMatched int
+
+	capacity  int
+	untracked int
+	// falseMatches is the expected number of lookups in outstanding and unmatched matching another event.
+	falseMatches float64
+}
+
+func newApproximateState(config *ApproximateConfig, maxMatched int) *approximateState {
+	capacity := DefaultApproximateCapacity
+	if config != nil && config.Capacity > 0 {
+		capacity = config.Capacity
+	}
+	if maxMatched == 0 {
+		maxMatched = DefaultMaxMatchedIDs
+	}
+	return &approximateState{
+		outstanding: newCuckooFilter(capacity),
+		unmatched:   newCuckooFilter(capacity),
+		matched:     [2]*cuckooFilter{newCuckooFilter(maxMatched), newCuckooFilter(maxMatched)},
+		maxMatched:  maxMatched,
+		capacity:    capacity,
+	}
+}
+
+// lookup returns true if the given filter contains the given event, accounting for the probability of a false
+// positive match.
+func (a *approximateState) lookup(f *cuckooFilter, id string) bool {
+	ok, occupied := f.lookup(id)
+	a.falseMatches += float64(occupied) / cuckooFingerprints
+	return ok
+}
+
+// remember remembers a matched event, forgetting the oldest generation of matched events once the current one is
+// full.
+func (a *approximateState) remember(id string) {
+	if a.matched[0].count >= a.maxMatched {
+		a.matched[1].reset()
+		a.matched[0], a.matched[1] = a.matched[1], a.matched[0]
+	}
+	a.matched[0].insert(id)
+}
+
+func (a *approximateState) isMatched(id string) bool {
+	ok0, _ := a.matched[0].lookup(id)
+	ok1, _ := a.matched[1].lookup(id)
+	return ok0 || ok1
+}
+
+// forget removes a sent event not received, for example because its send failed.
+func (a *approximateState) forget(id string) {
+	if a == nil {
+		return
+	}
+	if ok, _ := a.outstanding.lookup(id); ok {
+		a.outstanding.delete(id)
+	}
+}
+
+// approximateSent records a sent event and returns true if it matched a previously received event.
+func (s *streamingState) approximateSent(id string, p *streamingPartition) bool {
+	a := s.approximate
+	if a.lookup(a.unmatched, id) {
+		a.unmatched.delete(id)
+		a.remember(id)
+		p.matched++
+		return true
+	}
+	if !a.outstanding.insert(id) {
+		a.untracked++
+	}
+	return false
+}
+
+// approximateReceived records a received event and returns true if it matched a previously sent event. Duplicates
+// are only counted.
+func (s *streamingState) approximateReceived(e *ReceivedEvent, p *streamingPartition, config *StateManagerConfig) bool {
+	a := s.approximate
+	id := e.Event.ID()
+	if a.lookup(a.outstanding, id) {
+		a.outstanding.delete(id)
+		a.remember(id)
+		p.received++
+		s.checkOrdering(&e.Event, p, config)
+		p.matched++
+		sentAt, _ := sentTimestamp(&e.Event)
+		s.recordLatency(p, sentAt, e.ReceivedAt)
+		return true
+	}
+	if ok, _ := a.unmatched.lookup(id); ok || a.isMatched(id) {
+		p.duplicateCount++
+		s.duplicateCount++
+		return false
+	}
+	p.received++
+	s.checkOrdering(&e.Event, p, config)
+	if !a.unmatched.insert(id) {
+		a.untracked++
+	}
+	return false
+}
+
+func (s *streamingState) approximateReport(r *Report) {
+	a := s.approximate
+	for _, p := range s.partitions {
+		r.DuplicateCount += p.duplicateCount
+	}
+	r.LostCount += a.outstanding.count
+	r.UnexpectedCount += a.unmatched.count
+	r.UnmatchedCount += a.unmatched.count
+	r.Approximate = &ApproximateReport{
+		FalsePositiveRate:   2 * cuckooBucketSize / float64(cuckooFingerprints),
+		LostCountErrorBound: int(math.Ceil(a.falseMatches)),
+		Capacity:            a.capacity,
+		UntrackedCount:      a.untracked,
+		MemoryBytes:         a.outstanding.memoryBytes() + a.unmatched.memoryBytes() + a.matched[0].memoryBytes() + a.matched[1].memoryBytes(),
+	}
+}
+
+const (
+	cuckooBucketSize = 4
+	// cuckooFingerprints is the number of distinct fingerprints, 0 marks an empty slot.
+	cuckooFingerprints = math.MaxUint16
+	cuckooMaxKicks     = 500
+	cuckooMaxLoad      = 0.95
+)
+
+// cuckooFilter is a cuckoo filter of 16-bit fingerprints in buckets of 4 slots. The same fingerprint can be inserted
+// more than once, so that events are deleted without deleting other events with the same fingerprint.
+type cuckooFilter struct {
+	slots []uint16
+	mask  uint64
+	count int
+	// victim is the fingerprint evicted by the last insertion into a full filter, further insertions fail until a
+	// deletion makes room for it.
+	victim      uint16
+	victimIndex uint64
+	rand        uint64
+}
+
+// newCuckooFilter returns a cuckoo filter sized for the given number of fingerprints.
+func newCuckooFilter(capacity int) *cuckooFilter {
+	buckets := uint64(1)
+	for float64(buckets*cuckooBucketSize)*cuckooMaxLoad < float64(capacity) {
+		buckets <<= 1
+	}
+	return &cuckooFilter{
+		slots: make([]uint16, buckets*cuckooBucketSize),
+		mask:  buckets - 1,
+		rand:  0x9e3779b97f4a7c15,
+	}
+}
+
+// hash returns the bucket index and the fingerprint of the given ID.
+func (f *cuckooFilter) hash(id string) (uint64, uint16) {
+	// FNV-1a followed by the murmur3 finalizer, so that the high bits used by the fingerprint are well mixed.
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(id); i++ {
+		h ^= uint64(id[i])
+		h *= 1099511628211
+	}
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+
+	fp := uint16(h >> 48)
+	if fp == 0 {
+		fp = 1
+	}
+	return h & f.mask, fp
+}
+
+// alt returns the alternate bucket index of a fingerprint, alt(alt(i, fp), fp) is i.
+func (f *cuckooFilter) alt(i uint64, fp uint16) uint64 {
+	return (i ^ (uint64(fp) * 0x5bd1e995)) & f.mask
+}
+
+func (f *cuckooFilter) bucket(i uint64) []uint16 {
+	return f.slots[i*cuckooBucketSize : (i+1)*cuckooBucketSize]
+}
+
+func (f *cuckooFilter) add(i uint64, fp uint16) bool {
+	b := f.bucket(i)
+	for j := range b {
+		if b[j] == 0 {
+			b[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (f *cuckooFilter) remove(i uint64, fp uint16) bool {
+	b := f.bucket(i)
+	for j := range b {
+		if b[j] == fp {
+			b[j] = 0
+			return true
+		}
+	}
+	return false
+}
+
+// insert inserts the given ID and returns false if the filter is full.
+func (f *cuckooFilter) insert(id string) bool {
+	if f.victim != 0 {
+		return false
+	}
+	i, fp := f.hash(id)
+	f.place(i, fp)
+	return true
+}
+
+// place places a fingerprint in one of its buckets, evicting fingerprints to their alternate bucket when both are
+// full.
+func (f *cuckooFilter) place(i uint64, fp uint16) {
+	f.count++
+	if f.add(i, fp) || f.add(f.alt(i, fp), fp) {
+		return
+	}
+	for n := 0; n < cuckooMaxKicks; n++ {
+		// xorshift64
+		f.rand ^= f.rand << 13
+		f.rand ^= f.rand >> 7
+		f.rand ^= f.rand << 17
+		b := f.bucket(i)
+		j := f.rand % cuckooBucketSize
+		fp, b[j] = b[j], fp
+		i = f.alt(i, fp)
+		if f.add(i, fp) {
+			return
+		}
+	}
+	f.victim, f.victimIndex = fp, i
+}
+
+// lookup returns true if the fingerprint of the given ID is in the filter along with the number of occupied slots
+// compared, each of them matches another ID with a probability of 1/cuckooFingerprints.
+func (f *cuckooFilter) lookup(id string) (bool, int) {
+	i1, fp := f.hash(id)
+	i2 := f.alt(i1, fp)
+	found, occupied := false, 0
+	for _, i := range [2]uint64{i1, i2} {
+		for _, s := range f.bucket(i) {
+			if s != 0 {
+				occupied++
+			}
+			found = found || s == fp
+		}
+	}
+	if f.victim != 0 {
+		occupied++
+		found = found || (f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2))
+	}
+	return found, occupied
+}
+
+// delete deletes the given ID, it must be in the filter.
+func (f *cuckooFilter) delete(id string) {
+	i1, fp := f.hash(id)
+	i2 := f.alt(i1, fp)
+	if f.victim == fp && (f.victimIndex == i1 || f.victimIndex == i2) {
+		f.victim = 0
+		f.count--
+		return
+	}
+	if !f.remove(i1, fp) && !f.remove(i2, fp) {
+		return
+	}
+	f.count--
+	if f.victim != 0 {
+		// Room has been made for the evicted fingerprint.
+		fp, i := f.victim, f.victimIndex
+		f.victim = 0
+		f.count--
+		f.place(i, fp)
+	}
+}
+
+func (f *cuckooFilter) reset() {
+	for i := range f.slots {
+		f.slots[i] = 0
+	}
+	f.count = 0
+	f.victim = 0
+}
+
+func (f *cuckooFilter) memoryBytes() int {
+	return 2 * len(f.slots)
+}
@@ -0,0 +1,180 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestCuckooFilter(t *testing.T) {
+	f := newCuckooFilter(1000)
+
+	for i := 0; i < 1000; i++ {
+		if !f.insert(fmt.Sprint(i)) {
+			t.Fatalf("expected %d to be inserted", i)
+		}
+	}
+	if f.count != 1000 {
+		t.Fatalf("want 1000 fingerprints, got %d", f.count)
+	}
+	for i := 0; i < 1000; i++ {
+		if ok, _ := f.lookup(fmt.Sprint(i)); !ok {
+			t.Fatalf("expected %d to be found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 101000; i++ {
+		if ok, _ := f.lookup(fmt.Sprint(i)); ok {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 100000; rate > 2*cuckooBucketSize/float64(cuckooFingerprints) {
+		t.Errorf("false positive rate %v exceeds the bound", rate)
+	}
+
+	for i := 0; i < 1000; i++ {
+		f.delete(fmt.Sprint(i))
+	}
+	if f.count != 0 {
+		t.Errorf("want no fingerprints, got %d", f.count)
+	}
+	for _, s := range f.slots {
+		if s != 0 {
+			t.Fatal("expected all slots to be empty")
+		}
+	}
+}
+
+func TestCuckooFilterFull(t *testing.T) {
+	f := newCuckooFilter(8)
+
+	inserted := 0
+	for i := 0; i < 100 && f.insert(fmt.Sprint(i)); i++ {
+		inserted++
+	}
+	if inserted < 8 || inserted >= 100 {
+		t.Fatalf("want the filter to be full after 8 insertions, got %d", inserted)
+	}
+	if f.count != inserted {
+		t.Fatalf("want %d fingerprints, got %d", inserted, f.count)
+	}
+
+	// Deleting makes room for the evicted fingerprint, so that no inserted event is lost.
+	f.delete("0")
+	for i := 1; i < inserted; i++ {
+		if ok, _ := f.lookup(fmt.Sprint(i)); !ok {
+			t.Fatalf("expected %d to be found", i)
+		}
+	}
+	if f.count != inserted-1 {
+		t.Errorf("want %d fingerprints, got %d", inserted-1, f.count)
+	}
+}
+
+func TestValidateApproximate(t *testing.T) {
+	tests := []struct {
+		name         string
+		verification VerificationConfig
+		wantCapacity int
+		wantErr      bool
+	}{
+		{
+			name:         "default capacity",
+			verification: VerificationConfig{Mode: VerificationModeApproximate},
+			wantCapacity: DefaultApproximateCapacity,
+		},
+		{
+			name:         "capacity",
+			verification: VerificationConfig{Mode: VerificationModeApproximate, Approximate: &ApproximateConfig{Capacity: 10}},
+			wantCapacity: 10,
+		},
+		{
+			name:         "negative capacity",
+			verification: VerificationConfig{Mode: VerificationModeApproximate, Approximate: &ApproximateConfig{Capacity: -1}},
+			wantErr:      true,
+		},
+		{
+			name:         "other mode",
+			verification: VerificationConfig{Mode: VerificationModeStreaming, Approximate: &ApproximateConfig{}},
+			wantErr:      true,
+		},
+		{
+			name:         "max delivery age",
+			verification: VerificationConfig{Mode: VerificationModeApproximate, MaxDeliveryAge: "1m"},
+			wantErr:      true,
+		},
+		{
+			name:         "attributes",
+			verification: VerificationConfig{Mode: VerificationModeApproximate, Attributes: &AttributeAuditConfig{}},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				Sender:       SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10},
+				Receiver:     ReceiverConfig{Timeout: "1m"},
+				Duration:     "1m",
+				Verification: tt.verification,
+			}
+			err := config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && config.Verification.Approximate.Capacity != tt.wantCapacity {
+				t.Errorf("want capacity %d, got %d", tt.wantCapacity, config.Verification.Approximate.Capacity)
+			}
+		})
+	}
+}
+
+func TestStateManagerApproximate(t *testing.T) {
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+
+	sm := newTestStateManager(t, Config{Verification: VerificationConfig{Mode: VerificationModeApproximate, Approximate: &ApproximateConfig{Capacity: 100}}})
+
+	sm.lock.Lock()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		e := event(id)
+		sm.recordSent(&e)
+	}
+	// 5 is received before being sent, 6 is never sent.
+	for _, id := range []string{"1", "1", "2", "5", "5", "6"} {
+		sm.recordReceived(&ReceivedEvent{Event: event(id), ReceivedAt: time.Now()})
+	}
+	e := event("5")
+	sm.recordSent(&e)
+	sm.recordFailedSends([]FailedSend{{ID: "4"}})
+	sm.lock.Unlock()
+
+	r := sm.GenerateReport()
+	if r.ReceivedCount != 3 || r.LostCount != 1 || r.DuplicateCount != 2 || r.UnexpectedCount != 1 {
+		t.Errorf("want 3 received, 1 lost, 2 duplicates and 1 unexpected events, got %d, %d, %d and %d", r.ReceivedCount, r.LostCount, r.DuplicateCount, r.UnexpectedCount)
+	}
+	if r.Approximate == nil {
+		t.Fatal("expected the approximate report")
+	}
+	if r.Approximate.Capacity != 100 || r.Approximate.UntrackedCount != 0 || r.Approximate.MemoryBytes == 0 {
+		t.Errorf("unexpected approximate report %+v", r.Approximate)
+	}
+	if r.Approximate.FalsePositiveRate <= 0 || r.Approximate.LostCountErrorBound != 1 {
+		t.Errorf("want a false positive rate and an error bound of at most 1 event, got %+v", r.Approximate)
+	}
+	if err := verifyApproximate(r); err != nil {
+		t.Error(err)
+	}
+
+	r.Approximate.UntrackedCount = 1
+	if err := verifyApproximate(r); err == nil {
+		t.Error("expected untracked events to fail the verification")
+	}
+}
@@ -0,0 +1,150 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	cesql "github.com/cloudevents/sdk-go/sql/v2"
+)
+
+// EventAssertionConfig is an assertion over received events, so that the content of events transformed by the
+// system under test, for example by a Flow or a Sequence, is validated.
+type EventAssertionConfig struct {
+	// Name identifies the assertion in the report, it must be unique.
+	Name string `json:"name" yaml:"name"`
+	// Expression is a CloudEvents SQL expression every received event must satisfy, for example
+	// "type = 'my.type' AND source LIKE 'sensor/%'". Events whose evaluation fails, for example because of a missing
+	// attribute, fail the assertion.
+	//
+	// AND, OR and XOR have the same precedence and group from the right, and both of their operands are always
+	// evaluated, so "EXISTS myextension AND myextension = 'a'" fails when myextension is missing.
+	Expression string `json:"expression" yaml:"expression"`
+}
+
+func validateAssertions(assertions []EventAssertionConfig) error {
+	names := make(map[string]struct{}, len(assertions))
+	for i, a := range assertions {
+		field := fmt.Sprintf("verification.assertions[%d]", i)
+		if a.Name == "" {
+			return invalidErr(field+".name", errors.New("cannot be empty"))
+		}
+		if _, ok := names[a.Name]; ok {
+			return invalidErr(field+".name", fmt.Errorf("duplicate name %q", a.Name))
+		}
+		names[a.Name] = struct{}{}
+		if strings.TrimSpace(a.Expression) == "" {
+			return invalidErr(field+".expression", errors.New("cannot be empty"))
+		}
+		if _, err := parseCESQL(a.Expression); err != nil {
+			return invalidErr(field+".expression", err)
+		}
+	}
+	return nil
+}
+
+// AssertionReport reports the received events failing an assertion of verification.assertions.
+type AssertionReport struct {
+	// EvaluatedCount is the number of deliveries the assertion was evaluated on, duplicates included.
+	EvaluatedCount int `json:"evaluatedCount"`
+	// FailedCount is the number of events failing the assertion.
+	FailedCount int `json:"failedCount"`
+	// ErrorCount is the number of events failing the assertion because its evaluation failed, for example because
+	// of a missing attribute.
+	ErrorCount int `json:"errorCount"`
+	// FailedEventsByPartitionKey collects the events failing the assertion by partition key.
+	FailedEventsByPartitionKey map[string][]string `json:"failedEvents,omitempty"`
+}
+
+// assertionsState tracks the received events failing each assertion.
+type assertionsState struct {
+	assertions []parsedAssertion
+	evaluated  []int
+	failed     []map[string][]string
+	// errored are the events whose evaluation failed, for each assertion.
+	errored []map[string]struct{}
+}
+
+type parsedAssertion struct {
+	name       string
+	expression cesql.Expression
+}
+
+// newAssertionsState returns the state of the given assertions, it returns nil without assertions.
+func newAssertionsState(assertions []EventAssertionConfig) (*assertionsState, error) {
+	if len(assertions) == 0 {
+		return nil, nil
+	}
+	s := &assertionsState{
+		evaluated: make([]int, len(assertions)),
+		failed:    make([]map[string][]string, len(assertions)),
+		errored:   make([]map[string]struct{}, len(assertions)),
+	}
+	for i, a := range assertions {
+		expression, err := parseCESQL(a.Expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid assertion %q: %w", a.Name, err)
+		}
+		s.assertions = append(s.assertions, parsedAssertion{name: a.Name, expression: expression})
+		s.failed[i] = make(map[string][]string)
+		s.errored[i] = make(map[string]struct{})
+	}
+	return s, nil
+}
+
+// recordAssertions evaluates the assertions on the given received event, it must be called while holding the lock.
+func (s *StateManager) recordAssertions(e *ReceivedEvent) {
+	if s.assertions == nil {
+		return
+	}
+	for i, a := range s.assertions.assertions {
+		s.assertions.evaluated[i]++
+		ok, err := evalCESQL(a.expression, &e.Event)
+		if ok {
+			continue
+		}
+		if err != nil {
+			s.assertions.errored[i][e.Event.ID()] = struct{}{}
+		}
+		logger(LogComponentState).Warnw("Received event failing assertion", "id", e.Event.ID(), "assertion", a.name, "error", err)
+		insert(&e.Event, s.assertions.failed[i], &s.stateManagerConfig)
+	}
+}
+
+// assertionsReport sets the events failing each assertion of the report, it must be called while holding the lock.
+func (s *StateManager) assertionsReport(r *Report) {
+	if s.assertions == nil {
+		return
+	}
+	r.Assertions = make(map[string]AssertionReport, len(s.assertions.assertions))
+	for i, a := range s.assertions.assertions {
+		report := AssertionReport{
+			EvaluatedCount:             s.assertions.evaluated[i],
+			ErrorCount:                 len(s.assertions.errored[i]),
+			FailedEventsByPartitionKey: make(map[string][]string),
+		}
+		for pk, ids := range s.assertions.failed[i] {
+			failed, _ := removeDuplicates(ids)
+			sort.Strings(failed)
+			report.FailedEventsByPartitionKey[pk] = failed
+			report.FailedCount += len(failed)
+		}
+		r.Assertions[a.name] = report
+	}
+}
+
+// verifyAssertions verifies no received event failed an assertion.
+func verifyAssertions(report Report) error {
+	var failed []string
+	for name, r := range report.Assertions {
+		if r.FailedCount > 0 {
+			failed = append(failed, fmt.Sprintf("%s: %d events failed", name, r.FailedCount))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("assertions failed:\n%s", strings.Join(failed, "\n"))
+}
@@ -0,0 +1,97 @@
+package sacura
+
+import (
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAssertions(t *testing.T) {
+	config := Config{Verification: VerificationConfig{Assertions: []EventAssertionConfig{
+		{Name: "type", Expression: "type = 'transformed'"},
+		{Name: "region", Expression: "region = 'eu'"},
+	}}}
+	if err := validateAssertions(config.Verification.Assertions); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	event := func(id, typ string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetType(typ)
+		return e
+	}
+	transformed := event("1", "transformed")
+	transformed.SetExtension("region", "eu")
+	sm.lock.Lock()
+	sm.recordReceived(&ReceivedEvent{Event: transformed})
+	sm.recordReceived(&ReceivedEvent{Event: event("2", "original")})
+	sm.recordReceived(&ReceivedEvent{Event: event("2", "original")})
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	want := map[string]AssertionReport{
+		"type": {
+			EvaluatedCount:             3,
+			FailedCount:                1,
+			FailedEventsByPartitionKey: map[string][]string{"unknown": {"2"}},
+		},
+		"region": {
+			EvaluatedCount:             3,
+			FailedCount:                1,
+			ErrorCount:                 1,
+			FailedEventsByPartitionKey: map[string][]string{"unknown": {"2"}},
+		},
+	}
+	if diff := cmp.Diff(want, report.Assertions); diff != "" {
+		t.Errorf("unexpected assertions (-want, +got):\n%s", diff)
+	}
+	if err := verifyAssertions(report); err == nil {
+		t.Error("expected failed assertions to fail the verification")
+	}
+}
+
+func TestValidateAssertions(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		assertions []EventAssertionConfig
+		wantErr    bool
+	}{
+		{
+			name:       "valid",
+			assertions: []EventAssertionConfig{{Name: "a", Expression: "type = 'a'"}, {Name: "b", Expression: "EXISTS b"}},
+		},
+		{
+			name:       "empty name",
+			assertions: []EventAssertionConfig{{Expression: "type = 'a'"}},
+			wantErr:    true,
+		},
+		{
+			name:       "duplicate name",
+			assertions: []EventAssertionConfig{{Name: "a", Expression: "type = 'a'"}, {Name: "a", Expression: "type = 'b'"}},
+			wantErr:    true,
+		},
+		{
+			name:       "empty expression",
+			assertions: []EventAssertionConfig{{Name: "a", Expression: " "}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid expression",
+			assertions: []EventAssertionConfig{{Name: "a", Expression: "type = "}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAssertions(tt.assertions); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
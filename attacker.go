@@ -1,45 +1,94 @@
 package sacura
 
 import (
+	"context"
+	"crypto/tls"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
-	"github.com/google/uuid"
 	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"golang.org/x/net/http2"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 func StartSender(config Config, sentOut chan<- ce.Event) Metrics {
+	return startSender(context.Background(), config, sentOut)
+}
 
-	rate := vegeta.Rate{
-		Freq: config.Sender.FrequencyPerSecond,
-		Per:  time.Second,
+// startSender sends events until the configured duration elapses or the given context is done.
+func startSender(ctx context.Context, config Config, sentOut chan<- ce.Event) Metrics {
+
+	duration := config.ParsedDuration
+	control := senderControlFromContext(ctx)
+	if control != nil {
+		// The duration excludes the time spent paused, so the pacer stops sending.
+		duration = 0
+		defer func() { _, _ = control.transition(SenderStateDone, SenderStateRunning) }()
+	}
+
+	var recorder *eventRecorder
+	if config.Sender.Record != nil {
+		var err error
+		recorder, err = newEventRecorder(config.Sender.Record)
+		if err != nil {
+			logger(LogComponentSender).Errorw("Failed to create event recorder", "error", err)
+			return Metrics{}
+		}
+		defer func() {
+			if err := recorder.close(); err != nil {
+				logger(LogComponentSender).Errorw("Failed to close record file", "path", config.Sender.Record.Path, "error", err)
+			}
+		}()
 	}
 
 	proposedCount := 0
+	warmupProposedCount := 0
+	warmupAcceptedCount := 0
 	proposed := make(chan ce.Event, cap(sentOut))
 	accepted := make(chan string, cap(sentOut))
 	var wg sync.WaitGroup
 	wg.Add(2)
 
+	proposedArr := make(map[string]ce.Event, 100)
+	// failures are the failures of the last attempt of events not accepted.
+	failures := newSendFailures()
 	go func() {
-		proposedArr := make(map[string]ce.Event, 100)
 		acceptedArr := sets.NewString()
 		var m sync.Mutex
 
+		// send must be called while holding m.
+		send := func(e ce.Event) {
+			if isWarmupEvent(&e) {
+				warmupAcceptedCount++
+			}
+			sentOut <- e
+		}
+
 		go func() {
 			defer wg.Done()
 
 			for e := range proposed {
+				if recorder != nil {
+					recorder.record(&e, time.Now())
+				}
 				func() {
 					m.Lock()
 					defer m.Unlock()
 
-					proposedCount++
+					if isWarmupEvent(&e) {
+						warmupProposedCount++
+					} else {
+						proposedCount++
+					}
 					proposedArr[e.ID()] = e
 					if acceptedArr.Has(e.ID()) {
-						sentOut <- e
+						send(e)
 						delete(proposedArr, e.ID())
 						acceptedArr.Delete(e.ID())
 					}
@@ -58,7 +107,7 @@ func StartSender(config Config, sentOut chan<- ce.Event) Metrics {
 
 					acceptedArr.Insert(id)
 					if v, ok := proposedArr[id]; ok {
-						sentOut <- v
+						send(v)
 						delete(proposedArr, id)
 						acceptedArr.Delete(id)
 					}
@@ -67,35 +116,317 @@ func StartSender(config Config, sentOut chan<- ce.Event) Metrics {
 		}()
 	}()
 
-	targeter := NewTargeterGenerator(config, uuid.New, proposed)
+	transport, closeTransport := newSenderTransport(&config)
+	defer closeTransport()
+	if sendDeadline(&config) > requestTimeout(&config) {
+		transport = attemptTimeoutTransport{timeout: requestTimeout(&config), next: transport}
+	}
+	var breaker *circuitBreaker
+	if config.Sender.CircuitBreaker != nil {
+		breaker = newCircuitBreaker(config.Sender.CircuitBreaker)
+		transport = newCircuitBreakerTransport(breaker, transport)
+	}
+	if config.Sender.Targets != nil && config.Sender.Targets.Strategy == TargetsStrategyFailover {
+		transport = newTargetHealthTransport(config.Sender.Targets.Health, transport)
+	}
+	throttling := newThrottling()
+	if config.Sender.Throttling != nil {
+		transport = newThrottlingTransport(config.Sender.Throttling, transport, throttling)
+	}
+	attempts := newSendAttempts()
+	if config.Sender.Retry != nil {
+		transport = newRetryTransport(config.Sender.Retry, transport, attempts, config.Sender.Throttling != nil)
+	}
+	transport = failedSendTransport{next: transport, failures: failures}
 
-	attacker := vegeta.NewAttacker(
-		vegeta.Workers(config.Sender.Workers),
-		vegeta.KeepAlive(config.Sender.KeepAlive),
-		vegeta.MaxWorkers(config.Sender.Workers),
-	)
+	client := &http.Client{Transport: transport, Timeout: sendDeadline(&config)}
+	var attacks []senderAttack
+	if config.Ordered != nil && config.Ordered.IndependentSenders {
+		attacks = partitionSenderAttacks(&config, client, control, proposed)
+	} else {
+		attacks = []senderAttack{{
+			attacker: vegeta.NewAttacker(
+				vegeta.Workers(config.Sender.Workers),
+				vegeta.MaxWorkers(maxWorkers(&config)),
+				vegeta.Client(client),
+			),
+			targeter: NewTargeterGenerator(config, newUUIDGenerator(config.Seed), proposed),
+			pacer:    senderPacer(&config, config.Sender.FrequencyPerSecond, control, newRand(config.Seed, "pacing")),
+		}}
+	}
 
-	var metrics vegeta.Metrics
+	metrics := newSendMetrics(config.Sender.Protocol)
+	targetMetrics := newTargetSendMetrics(&config)
 	var acceptedCount int
 
-	for res := range attacker.Attack(targeter, rate, config.ParsedDuration, "Sacura") {
-		metrics.Add(res)
-		if res.Error == "" && res.Code >= 200 && res.Code < 300 {
-			acceptedCount++
-			id := res.RequestHeaders.Get(CloudEventIdHeader)
-			if id != "" {
+	attackDone := make(chan struct{})
+	defer close(attackDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			if control != nil {
+				control.stop()
+			}
+			for _, a := range attacks {
+				a.attacker.Stop()
+			}
+		case <-attackDone:
+		}
+	}()
+
+	exporter := spanExporterFromContext(ctx)
+
+	if control != nil {
+		control.begin()
+	}
+	pacers := make([]vegeta.Pacer, 0, len(attacks))
+	for _, a := range attacks {
+		pacers = append(pacers, a.pacer)
+	}
+	metrics.paced(time.Now(), pacers...)
+	for res := range attack(attacks, duration) {
+		ok := res.Error == "" && res.Code >= 200 && res.Code < 300
+		if config.Sender.Protocol == ProtocolGRPC {
+			ok = ok && isGRPCAccepted(res.Headers)
+		}
+		result := newSendResult(config.Sender.Protocol, res, ok)
+		metrics.record(result)
+		targetMetrics.record(res.URL, result)
+		if exporter != nil {
+			if s, valid := sendSpan(res.RequestHeaders, res.Timestamp, res.Latency, int(res.Code), !ok); valid {
+				exporter.export(s)
+			}
+		}
+		if ok {
+			// Batched requests carry the ID of each event in the batch.
+			ids := res.RequestHeaders.Values(CloudEventIdHeader)
+			if len(ids) == 0 {
+				acceptedCount++
+			}
+			for _, id := range ids {
+				acceptedCount++
 				accepted <- id
 			}
+		} else {
+			failures.record(res.RequestHeaders.Values(CloudEventIdHeader), newFailedSend(res))
 		}
 	}
-	metrics.Close()
 	close(proposed)
 	close(accepted)
 	wg.Wait()
 
-	return Metrics{
-		ProposedCount: proposedCount,
-		AcceptedCount: acceptedCount,
-		Metrics:       metrics,
+	m := Metrics{
+		ProposedCount:       proposedCount,
+		AcceptedCount:       acceptedCount - warmupAcceptedCount,
+		WarmupProposedCount: warmupProposedCount,
+		WarmupAcceptedCount: warmupAcceptedCount,
+		FailedSends:         failedSends(proposedArr, failures.byID, &config),
+		Metrics:             metrics.close(),
+	}
+	m.NotSentCount = len(m.FailedSends)
+	if m.Metrics.TargetRate > 0 && m.Metrics.Rate < slowSenderRatio*m.Metrics.TargetRate {
+		logger(LogComponentSender).Warnw("The sender fell behind the target rate, events may be missing because they haven't been sent",
+			"rate", m.Metrics.Rate, "targetRate", m.Metrics.TargetRate)
+	}
+	for _, f := range m.FailedSends {
+		if f.ErrorClass == ErrorClassTimeout {
+			m.TimedOutCount++
+		}
+	}
+	attempts.metrics(&m)
+	throttling.report(&m)
+	if breaker != nil {
+		breaker.report(&m, time.Now())
+	}
+	if control != nil && config.Sender.ClosedLoop != nil {
+		control.closedLoopMetrics(&m)
+	}
+	if config.Sender.Targets != nil {
+		config.Sender.Targets.Health.metrics(&m)
+	}
+	targetMetrics.metrics(&m)
+	return m
+}
+
+// slowSenderRatio is the ratio of the target rate under which the sender is considered too slow.
+const slowSenderRatio = 0.9
+
+// senderAttack is an attack sending events generated by the targeter at the pace of the pacer.
+type senderAttack struct {
+	attacker *vegeta.Attacker
+	targeter vegeta.Targeter
+	pacer    vegeta.Pacer
+}
+
+// attack runs the given attacks concurrently and returns the results of all of them.
+func attack(attacks []senderAttack, duration time.Duration) <-chan *vegeta.Result {
+	if len(attacks) == 1 {
+		return attacks[0].attacker.Attack(attacks[0].targeter, attacks[0].pacer, duration, "Sacura")
+	}
+
+	results := make(chan *vegeta.Result)
+	var wg sync.WaitGroup
+	wg.Add(len(attacks))
+	for _, a := range attacks {
+		go func(a senderAttack) {
+			defer wg.Done()
+			for res := range a.attacker.Attack(a.targeter, a.pacer, duration, "Sacura") {
+				results <- res
+			}
+		}(a)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	return results
+}
+
+// senderPacer returns the pacer of requests sent at the given frequency, shaped by the load profile and the pacing of
+// the sender, or following the recorded pacing when replaying events.
+func senderPacer(config *Config, frequency int, control *senderControl, r *rand.Rand) vegeta.Pacer {
+	var pacer vegeta.Pacer = vegeta.Rate{
+		Freq: frequency,
+		Per:  time.Second,
+	}
+	if control != nil && control.settings != nil && config.Sender.FrequencyPerSecond > 0 {
+		// The share of the rate of the sender is kept when the rate changes.
+		pacer = &livePacer{settings: control.settings, scale: float64(frequency) / float64(config.Sender.FrequencyPerSecond)}
+	}
+	if config.Sender.TokenBucket != nil {
+		pacer = config.Sender.TokenBucket.pacer(frequency)
+	}
+	if config.Sender.LoadProfile != nil {
+		pacer = config.Sender.LoadProfile.pacer()
+	}
+	if config.Sender.Pacing != nil {
+		pacer = config.Sender.Pacing.pacer(pacer, r)
+	}
+	if config.Sender.Replay != nil {
+		pacer = newReplayPacer(config.Sender.Replay, config.Sender.BatchSize)
+	}
+	if config.Sender.EventCount > 0 {
+		pacer = eventCountPacer{pacer: pacer, requests: eventCountRequests(config)}
+	}
+	if control != nil {
+		pacer = controlledPacer{pacer: pacer, control: control, duration: config.ParsedDuration}
+	}
+	return pacer
+}
+
+// newSenderTransport returns the transport of the sender protocol and a function closing it.
+func newSenderTransport(config *Config) (http.RoundTripper, func()) {
+	if b, ok := protocolBindings[config.Sender.Protocol]; ok {
+		t := b.newTransport(config)
+		return t, t.close
+	}
+	if config.Sender.Protocol == ProtocolGRPC {
+		t := newGRPCTransport(config)
+		return t, t.close
+	}
+	return newHTTPTransport(config), func() {}
+}
+
+// newHTTPTransport returns the transport of HTTP requests, configured like the default transport of
+// vegeta.Attacker.
+func newHTTPTransport(config *Config) http.RoundTripper {
+	dialer := &net.Dialer{
+		LocalAddr: &net.TCPAddr{IP: vegeta.DefaultLocalAddr.IP, Zone: vegeta.DefaultLocalAddr.Zone},
+		KeepAlive: 30 * time.Second,
+	}
+	if !config.Sender.KeepAlive {
+		dialer.KeepAlive = 0
+	}
+	tlsConfig := vegeta.DefaultTLSConfig
+	if config.Sender.TLS != nil && config.Sender.TLS.Parsed != nil {
+		tlsConfig = config.Sender.TLS.Parsed
+	}
+	tr := &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		Dial:                dialer.Dial,
+		TLSClientConfig:     tlsConfig,
+		DisableKeepAlives:   !config.Sender.KeepAlive,
+		MaxIdleConnsPerHost: maxIdleConnections(config),
+		MaxConnsPerHost:     config.Sender.MaxConnections,
+	}
+	if !config.Sender.HTTP2 {
+		return tr
+	}
+	target := config.Sender.Target
+	if config.Sender.Targets != nil {
+		// Targets share the same scheme.
+		target = config.Sender.Targets.URLs[0]
+	}
+	if strings.HasPrefix(target, "https://") {
+		_ = http2.ConfigureTransport(tr)
+		return tr
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.Dial(network, addr)
+		},
+	}
+}
+
+// maxWorkers returns sender.maxWorkers, defaulting to sender.workers.
+func maxWorkers(config *Config) uint64 {
+	if config.Sender.MaxWorkers == 0 {
+		return config.Sender.Workers
+	}
+	return config.Sender.MaxWorkers
+}
+
+// maxIdleConnections returns sender.maxIdleConnections, defaulting to vegeta.DefaultConnections.
+func maxIdleConnections(config *Config) int {
+	if config.Sender.MaxIdleConnections == 0 {
+		return vegeta.DefaultConnections
+	}
+	return config.Sender.MaxIdleConnections
+}
+
+// requestTimeout returns sender.requestTimeout, defaulting to vegeta.DefaultTimeout.
+func requestTimeout(config *Config) time.Duration {
+	if config.Sender.ParsedRequestTimeout == 0 {
+		return vegeta.DefaultTimeout
 	}
+	return config.Sender.ParsedRequestTimeout
+}
+
+// sendDeadline returns sender.sendDeadline, defaulting to sender.requestTimeout.
+func sendDeadline(config *Config) time.Duration {
+	if config.Sender.ParsedSendDeadline == 0 {
+		return requestTimeout(config)
+	}
+	return config.Sender.ParsedSendDeadline
+}
+
+// attemptTimeoutTransport is an http.RoundTripper bounding each attempt of a request when the send deadline bounds
+// the request including its retries.
+type attemptTimeoutTransport struct {
+	timeout time.Duration
+	next    http.RoundTripper
+}
+
+func (t attemptTimeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil || resp.Body == nil {
+		cancel()
+		return resp, err
+	}
+	// The body of the response is read after the round trip.
+	resp.Body = cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnClose is a response body cancelling the context of its request when closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelOnClose) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
 }
@@ -0,0 +1,179 @@
+package sacura
+
+import (
+	"fmt"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// AttributeAuditConfig compares the attributes and extensions of received events with the ones of the corresponding
+// sent events, to detect brokers dropping, adding or mutating attributes.
+type AttributeAuditConfig struct {
+	// Ignore are attributes excluded from the comparison, for example attributes added by the broker on purpose.
+	Ignore []string `json:"ignore" yaml:"ignore"`
+	// Strict fails the verification when the attributes of a received event differ from the sent ones.
+	Strict bool `json:"strict" yaml:"strict"`
+}
+
+// AttributeDiff is the difference between the attributes of a sent event and the ones of the received event.
+type AttributeDiff struct {
+	// Dropped are attributes of the sent event missing in the received event.
+	Dropped []string `json:"dropped,omitempty"`
+	// Added are attributes of the received event missing in the sent event.
+	Added []string `json:"added,omitempty"`
+	// Mutated are attributes whose value changed by attribute name.
+	Mutated map[string]AttributeChange `json:"mutated,omitempty"`
+}
+
+// AttributeChange is the sent and received value of a mutated attribute.
+type AttributeChange struct {
+	Sent     string `json:"sent"`
+	Received string `json:"received"`
+}
+
+func (c *AttributeAuditConfig) validate() error {
+	for _, name := range c.Ignore {
+		if !isValidExtensionName(name) {
+			return invalidErr("verification.attributes.ignore", fmt.Errorf("%q is not a valid attribute name, expected lowercase letters and digits", name))
+		}
+	}
+	return nil
+}
+
+// eventAttributes returns all the attributes and extensions of the given event formatted as strings, except the
+// ignored ones.
+func eventAttributes(e *ce.Event, ignore []string) map[string]string {
+	formatted, err := binaryAttributes(e)
+	if err != nil {
+		logger(LogComponentState).Warnw("Failed to format attributes", "id", e.ID(), "error", err)
+	}
+	attributes := make(map[string]string, len(formatted)+1)
+	for _, a := range formatted {
+		attributes[a[0]] = a[1]
+	}
+	if ct := e.DataContentType(); ct != "" {
+		attributes["datacontenttype"] = ct
+	}
+	for _, name := range ignore {
+		delete(attributes, name)
+	}
+	return attributes
+}
+
+// diffAttributes returns the difference between sent and received attributes, it is nil when they are equal.
+func diffAttributes(sent, received map[string]string) *AttributeDiff {
+	d := AttributeDiff{}
+	for name, v := range sent {
+		r, ok := received[name]
+		if !ok {
+			d.Dropped = append(d.Dropped, name)
+			continue
+		}
+		if r != v {
+			if d.Mutated == nil {
+				d.Mutated = make(map[string]AttributeChange)
+			}
+			d.Mutated[name] = AttributeChange{Sent: v, Received: r}
+		}
+	}
+	for name := range received {
+		if _, ok := sent[name]; !ok {
+			d.Added = append(d.Added, name)
+		}
+	}
+	if len(d.Dropped) == 0 && len(d.Added) == 0 && len(d.Mutated) == 0 {
+		return nil
+	}
+	sort.Strings(d.Dropped)
+	sort.Strings(d.Added)
+	return &d
+}
+
+// attributeAuditState tracks attributes of sent events until the event is received, or of received events until
+// the event is recorded as sent.
+type attributeAuditState struct {
+	config *AttributeAuditConfig
+	// sent are the attributes of sent events by event ID, they are nil once the event has been compared.
+	sent     map[string]map[string]string
+	received map[string]map[string]string
+	diffs    map[string]AttributeDiff
+}
+
+func newAttributeAuditState(config *AttributeAuditConfig) *attributeAuditState {
+	if config == nil {
+		return nil
+	}
+	return &attributeAuditState{
+		config:   config,
+		sent:     make(map[string]map[string]string),
+		received: make(map[string]map[string]string),
+		diffs:    make(map[string]AttributeDiff),
+	}
+}
+
+// recordSentAttributes records the attributes of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentAttributes(e *ce.Event) {
+	a := s.attributeAudit
+	if a == nil {
+		return
+	}
+	sent := eventAttributes(e, a.config.Ignore)
+	if received, ok := a.received[e.ID()]; ok {
+		delete(a.received, e.ID())
+		a.sent[e.ID()] = nil
+		a.record(e.ID(), sent, received)
+		return
+	}
+	a.sent[e.ID()] = sent
+}
+
+// recordReceivedAttributes compares the attributes of the first delivery of the given received event with the sent
+// ones, it must be called while holding the lock.
+func (s *StateManager) recordReceivedAttributes(e *ce.Event) {
+	a := s.attributeAudit
+	if a == nil {
+		return
+	}
+	if _, ok := a.received[e.ID()]; ok {
+		return
+	}
+	sent, ok := a.sent[e.ID()]
+	if ok && sent == nil {
+		// Duplicates are not compared.
+		return
+	}
+	received := eventAttributes(e, a.config.Ignore)
+	if !ok {
+		// The event may be received before it is recorded as sent, or not sent at all.
+		a.received[e.ID()] = received
+		return
+	}
+	a.sent[e.ID()] = nil
+	a.record(e.ID(), sent, received)
+}
+
+func (a *attributeAuditState) record(id string, sent, received map[string]string) {
+	if d := diffAttributes(sent, received); d != nil {
+		a.diffs[id] = *d
+	}
+}
+
+// attributeAuditReport sets the attribute differences of the report, it must be called while holding the lock.
+func (s *StateManager) attributeAuditReport(r *Report) {
+	if s.attributeAudit == nil || len(s.attributeAudit.diffs) == 0 {
+		return
+	}
+	r.AttributeDiffsByEventID = make(map[string]AttributeDiff, len(s.attributeAudit.diffs))
+	for id, d := range s.attributeAudit.diffs {
+		r.AttributeDiffsByEventID[id] = d
+	}
+}
+
+// verifyAttributes verifies received events carry the attributes they have been sent with, when enabled.
+func verifyAttributes(config Config, report Report) error {
+	if config.Verification.Attributes == nil || !config.Verification.Attributes.Strict || len(report.AttributeDiffsByEventID) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events received with attributes different from the sent ones", len(report.AttributeDiffsByEventID))
+}
@@ -0,0 +1,102 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffAttributes(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sent     map[string]string
+		received map[string]string
+		want     *AttributeDiff
+	}{
+		{
+			name:     "equal",
+			sent:     map[string]string{"id": "1", "type": "a"},
+			received: map[string]string{"id": "1", "type": "a"},
+		},
+		{
+			name:     "dropped, added and mutated",
+			sent:     map[string]string{"id": "1", "type": "a", "tenant": "x", "region": "eu"},
+			received: map[string]string{"id": "1", "type": "b", "knativearrivaltime": "now", "traceparent": "00"},
+			want: &AttributeDiff{
+				Dropped: []string{"region", "tenant"},
+				Added:   []string{"knativearrivaltime", "traceparent"},
+				Mutated: map[string]AttributeChange{"type": {Sent: "a", Received: "b"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, diffAttributes(tt.sent, tt.received)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerAttributeAudit(t *testing.T) {
+
+	config := Config{Verification: VerificationConfig{Attributes: &AttributeAuditConfig{Ignore: []string{"knativearrivaltime"}}}}
+	sm := newTestStateManager(t, config)
+
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension("tenant", "acme")
+		return e
+	}
+	record := func(f func()) {
+		sm.lock.Lock()
+		defer sm.lock.Unlock()
+		f()
+	}
+
+	// Preserved, with an ignored attribute added by the broker.
+	sent := event("1")
+	received := event("1")
+	received.SetExtension("knativearrivaltime", "2021-01-01T00:00:00Z")
+	record(func() { sm.recordSent(&sent) })
+	record(func() { sm.recordReceived(&ReceivedEvent{Event: received, ReceivedAt: time.Now()}) })
+
+	// Extension stripped, received before being recorded as sent.
+	sent = event("2")
+	received = event("2")
+	delete(received.Context.(*ce.EventContextV1).Extensions, "tenant")
+	record(func() { sm.recordReceived(&ReceivedEvent{Event: received, ReceivedAt: time.Now()}) })
+	record(func() { sm.recordSent(&sent) })
+
+	// Type mutated on the first delivery, duplicates are not compared.
+	sent = event("3")
+	received = event("3")
+	received.SetType("com.example.mutated")
+	record(func() { sm.recordSent(&sent) })
+	record(func() { sm.recordReceived(&ReceivedEvent{Event: received, ReceivedAt: time.Now()}) })
+	duplicate := event("3")
+	record(func() { sm.recordReceived(&ReceivedEvent{Event: duplicate, ReceivedAt: time.Now()}) })
+
+	report := sm.GenerateReport()
+	want := map[string]AttributeDiff{
+		"2": {Dropped: []string{"tenant"}},
+		"3": {Mutated: map[string]AttributeChange{"type": {Sent: sent.Type(), Received: "com.example.mutated"}}},
+	}
+	if diff := cmp.Diff(want, report.AttributeDiffsByEventID); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if err := verifyAttributes(config, report); err != nil {
+		t.Errorf("expected differences to be reported only, got %v", err)
+	}
+	config.Verification.Attributes.Strict = true
+	if err := verifyAttributes(config, report); err == nil {
+		t.Error("expected attribute differences to fail the verification")
+	}
+}
@@ -0,0 +1,156 @@
+package sacura
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// EventAttributesConfig configures the context attributes and extensions of generated events, so that sent events match
+// the shape of real producers.
+//
+// Values are Go templates rendered for each event, see PayloadTemplateData for the available variables, for example
+// "com.example.order.{{.PartitionKey}}".
+type EventAttributesConfig struct {
+	// Source, Type, Subject, DataSchema and DataContentType replace the attributes of the sample event when specified.
+	Source          string `json:"source" yaml:"source"`
+	Type            string `json:"type" yaml:"type"`
+	Subject         string `json:"subject" yaml:"subject"`
+	DataSchema      string `json:"dataschema" yaml:"dataschema"`
+	DataContentType string `json:"datacontenttype" yaml:"datacontenttype"`
+	// Extensions are set on generated events.
+	Extensions map[string]string `json:"extensions" yaml:"extensions"`
+}
+
+// reservedExtensions are extensions set by sacura, they cannot be configured.
+var reservedExtensions = []string{BenchmarkTimestampAttribute, BenchmarkTimestampNanosAttribute, SequenceExtension, WarmupExtension, ChecksumExtension, ExpectedLossExtension, StreamExtension, ReplyToExtension, PayloadSizeExtension, TargetExtension, RunIDExtension, OverridesExtension, HopsExtension, IdentityExtension, DeliverAtExtension}
+
+func (c *EventAttributesConfig) validate(sender *SenderConfig, ordered *OrderedConfig) error {
+	if _, err := c.generator(); err != nil {
+		return err
+	}
+	if c.DataContentType != "" && sender.Payload != nil {
+		return invalidErr("sender.attributes.datacontenttype", errors.New("cannot be used with sender.payload, use sender.payload.contentType"))
+	}
+	if c.DataSchema != "" && !strings.Contains(c.DataSchema, "{{") {
+		if _, err := url.Parse(c.DataSchema); err != nil {
+			return invalidErr("sender.attributes.dataschema", err)
+		}
+	}
+
+	reserved := reservedExtensions
+	if ordered != nil {
+		reserved = append([]string{ordered.partitionKeyExtension()}, reserved...)
+	}
+	for name := range c.Extensions {
+		if !isValidExtensionName(name) {
+			return invalidErr("sender.attributes.extensions", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", name))
+		}
+		for _, r := range reserved {
+			if name == r {
+				return invalidErr("sender.attributes.extensions", fmt.Errorf("%q is set by sacura", name))
+			}
+		}
+	}
+	return nil
+}
+
+// attributeTemplate is a single configured attribute, constant values are not rendered.
+type attributeTemplate struct {
+	name     string
+	value    string
+	template *template.Template
+}
+
+// attributesGenerator sets the configured attributes on generated events, it is safe for concurrent use.
+type attributesGenerator struct {
+	attributes []attributeTemplate
+	extensions []attributeTemplate
+}
+
+func (c *EventAttributesConfig) generator() (*attributesGenerator, error) {
+	g := &attributesGenerator{}
+	parse := func(field, name, value string) (attributeTemplate, error) {
+		a := attributeTemplate{name: name, value: value}
+		if !strings.Contains(value, "{{") {
+			return a, nil
+		}
+		t, err := template.New(name).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return a, invalidErr(field, err)
+		}
+		a.template = t
+		return a, nil
+	}
+
+	for _, a := range []struct{ name, value string }{
+		{"source", c.Source},
+		{"type", c.Type},
+		{"subject", c.Subject},
+		{"dataschema", c.DataSchema},
+		{"datacontenttype", c.DataContentType},
+	} {
+		if a.value == "" {
+			continue
+		}
+		t, err := parse("sender.attributes."+a.name, a.name, a.value)
+		if err != nil {
+			return nil, err
+		}
+		g.attributes = append(g.attributes, t)
+	}
+	for name, value := range c.Extensions {
+		t, err := parse("sender.attributes.extensions."+name, name, value)
+		if err != nil {
+			return nil, err
+		}
+		g.extensions = append(g.extensions, t)
+	}
+	return g, nil
+}
+
+func (a *attributeTemplate) render(data PayloadTemplateData) (string, error) {
+	if a.template == nil {
+		return a.value, nil
+	}
+	var b bytes.Buffer
+	if err := a.template.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to execute %s template for event %s: %w", a.name, data.ID, err)
+	}
+	return b.String(), nil
+}
+
+// setAttributes sets the configured attributes on the given event.
+func (g *attributesGenerator) setAttributes(e *ce.Event, data PayloadTemplateData) error {
+	for i := range g.attributes {
+		v, err := g.attributes[i].render(data)
+		if err != nil {
+			return err
+		}
+		switch g.attributes[i].name {
+		case "source":
+			e.SetSource(v)
+		case "type":
+			e.SetType(v)
+		case "subject":
+			e.SetSubject(v)
+		case "dataschema":
+			e.SetDataSchema(v)
+		case "datacontenttype":
+			e.SetDataContentType(v)
+		}
+	}
+	for i := range g.extensions {
+		v, err := g.extensions[i].render(data)
+		if err != nil {
+			return err
+		}
+		e.SetExtension(g.extensions[i].name, v)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestEventAttributesConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  EventAttributesConfig
+		sender  SenderConfig
+		ordered *OrderedConfig
+		wantErr bool
+	}{
+		{
+			name: "constants and templates",
+			config: EventAttributesConfig{
+				Source:     "/orders",
+				Type:       "com.example.order.{{.PartitionKey}}",
+				Extensions: map[string]string{"tenant": "t{{.Index}}"},
+			},
+		},
+		{
+			name:    "invalid template",
+			config:  EventAttributesConfig{Subject: "{{.Index"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid extension name",
+			config:  EventAttributesConfig{Extensions: map[string]string{"Tenant": "a"}},
+			wantErr: true,
+		},
+		{
+			name:    "reserved extension",
+			config:  EventAttributesConfig{Extensions: map[string]string{SequenceExtension: "1"}},
+			wantErr: true,
+		},
+		{
+			name:    "partition key extension",
+			config:  EventAttributesConfig{Extensions: map[string]string{"key": "1"}},
+			ordered: &OrderedConfig{PartitionKeyExtension: "key"},
+			wantErr: true,
+		},
+		{
+			name:    "content type with payload",
+			config:  EventAttributesConfig{DataContentType: "application/xml"},
+			sender:  SenderConfig{Payload: &PayloadConfig{Size: 10}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.sender, tt.ordered); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorAttributes(t *testing.T) {
+
+	out := make(chan ce.Event, 2)
+	config := Config{
+		Sender: SenderConfig{
+			Target: "http://localhost:9090",
+			Attributes: &EventAttributesConfig{
+				Source:          "/orders/{{.PartitionKey}}",
+				Type:            "com.example.order.created",
+				Subject:         "order-{{.Index}}",
+				DataSchema:      "https://example.com/schemas/order.json",
+				DataContentType: "application/json",
+				Extensions:      map[string]string{"tenant": "acme", "eventid": "{{.ID}}"},
+			},
+			Variants: []EventVariantConfig{{Type: "com.example.order.updated"}, {}},
+		},
+		Ordered: &OrderedConfig{NumPartitionKeys: 1},
+	}
+	if err := config.Sender.Attributes.validate(&config.Sender, config.Ordered); err != nil {
+		t.Fatal(err)
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	for i, wantType := range []string{"com.example.order.updated", "com.example.order.created"} {
+		if err := f(&vegeta.Target{}); err != nil {
+			t.Fatal(err)
+		}
+		e := <-out
+		if err := e.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		if e.Source() != "/orders/0" {
+			t.Errorf("expected source /orders/0, got %s", e.Source())
+		}
+		if e.Type() != wantType {
+			t.Errorf("expected type %s, got %s", wantType, e.Type())
+		}
+		if want := fmt.Sprintf("order-%d", i); e.Subject() != want {
+			t.Errorf("expected subject %s, got %s", want, e.Subject())
+		}
+		if e.DataSchema() != "https://example.com/schemas/order.json" {
+			t.Errorf("unexpected dataschema %s", e.DataSchema())
+		}
+		if e.DataContentType() != "application/json" {
+			t.Errorf("unexpected datacontenttype %s", e.DataContentType())
+		}
+		if e.Extensions()["tenant"] != "acme" || e.Extensions()["eventid"] != e.ID() {
+			t.Errorf("unexpected extensions %v", e.Extensions())
+		}
+		if e.Extensions()[BenchmarkTimestampAttribute] == nil || e.Extensions()[DefaultPartitionKeyExtension] != "0" {
+			t.Errorf("expected sacura extensions to be set, got %v", e.Extensions())
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package sacura
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultTokenFileRefreshInterval is the interval at which token files are re-read when none is configured.
+	DefaultTokenFileRefreshInterval = time.Minute
+
+	// tokenExpiryDelta is how long before the expiry tokens acquired with the client credentials flow are refreshed.
+	tokenExpiryDelta = 30 * time.Second
+)
+
+type SenderAuthConfig struct {
+	// Token is a static token.
+	Token string `json:"token" yaml:"token" secret:"true"`
+	// TokenFile is the path of a file containing the token, for example a projected service account token, the
+	// file is re-read periodically so that rotated tokens are picked up.
+	TokenFile string `json:"tokenFile" yaml:"tokenFile"`
+	// TokenFileRefreshInterval is the interval at which TokenFile is re-read.
+	//
+	// Defaults to DefaultTokenFileRefreshInterval.
+	TokenFileRefreshInterval string `json:"tokenFileRefreshInterval" yaml:"tokenFileRefreshInterval"`
+	// ClientCredentials acquires tokens with the OAuth2 client credentials flow, tokens are refreshed before they
+	// expire.
+	ClientCredentials *ClientCredentialsConfig `json:"clientCredentials" yaml:"clientCredentials"`
+
+	ParsedTokenFileRefreshInterval time.Duration
+}
+
+type ClientCredentialsConfig struct {
+	// TokenURL is the token endpoint of the authorization server.
+	TokenURL     string `json:"tokenURL" yaml:"tokenURL"`
+	ClientID     string `json:"clientID" yaml:"clientID"`
+	ClientSecret string `json:"clientSecret" yaml:"clientSecret" secret:"true"`
+	// ClientSecretFile is the path of a file containing the client secret, it is an alternative to ClientSecret.
+	ClientSecretFile string   `json:"clientSecretFile" yaml:"clientSecretFile"`
+	Scopes           []string `json:"scopes" yaml:"scopes"`
+	// Audience is the audience of the requested token, when required by the authorization server.
+	Audience string `json:"audience" yaml:"audience"`
+}
+
+func (c *SenderAuthConfig) validate(field string) error {
+	sources := 0
+	for _, set := range []bool{c.Token != "", c.TokenFile != "", c.ClientCredentials != nil} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return invalidErr(field, errors.New("exactly one of token, tokenFile or clientCredentials must be specified"))
+	}
+
+	if c.TokenFile != "" {
+		if c.TokenFileRefreshInterval == "" {
+			c.ParsedTokenFileRefreshInterval = DefaultTokenFileRefreshInterval
+		} else {
+			var err error
+			c.ParsedTokenFileRefreshInterval, err = time.ParseDuration(c.TokenFileRefreshInterval)
+			if err != nil {
+				return invalidErr(field+".tokenFileRefreshInterval", err)
+			}
+			if c.ParsedTokenFileRefreshInterval <= 0 {
+				return invalidErr(field+".tokenFileRefreshInterval", errors.New("must be greater than 0"))
+			}
+		}
+	}
+
+	if cc := c.ClientCredentials; cc != nil {
+		if u, err := url.Parse(cc.TokenURL); err != nil || !u.IsAbs() {
+			return invalidErr(field+".clientCredentials.tokenURL", fmt.Errorf("%q must be an absolute URL: %v", cc.TokenURL, err))
+		}
+		if cc.ClientID == "" {
+			return invalidErr(field+".clientCredentials.clientID", errors.New("cannot be empty"))
+		}
+		if (cc.ClientSecret == "") == (cc.ClientSecretFile == "") {
+			return invalidErr(field+".clientCredentials", errors.New("exactly one of clientSecret or clientSecretFile must be specified"))
+		}
+	}
+	return nil
+}
+
+// tokenSource returns the token to attach to requests, it is safe for concurrent use.
+type tokenSource interface {
+	token() (string, error)
+}
+
+func newTokenSource(config *SenderAuthConfig) tokenSource {
+	switch {
+	case config.TokenFile != "":
+		return &cachedTokenSource{fetch: func() (string, time.Time, error) {
+			b, err := os.ReadFile(config.TokenFile)
+			if err != nil {
+				return "", time.Time{}, err
+			}
+			return strings.TrimSpace(string(b)), time.Now().Add(config.ParsedTokenFileRefreshInterval), nil
+		}}
+	case config.ClientCredentials != nil:
+		cc := &clientCredentials{config: config.ClientCredentials, client: &http.Client{Timeout: 30 * time.Second}}
+		return &cachedTokenSource{fetch: cc.fetch}
+	default:
+		return staticTokenSource(config.Token)
+	}
+}
+
+type staticTokenSource string
+
+func (s staticTokenSource) token() (string, error) {
+	return string(s), nil
+}
+
+// cachedTokenSource caches the fetched token until it expires, when a refresh fails the previous token is used until
+// a refresh succeeds so that a transient failure doesn't stop the test.
+type cachedTokenSource struct {
+	fetch func() (token string, expiry time.Time, err error)
+
+	lock   sync.Mutex
+	cached string
+	expiry time.Time
+}
+
+func (s *cachedTokenSource) token() (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cached != "" && time.Now().Before(s.expiry) {
+		return s.cached, nil
+	}
+
+	token, expiry, err := s.fetch()
+	if err == nil && token == "" {
+		err = errors.New("empty token")
+	}
+	if err != nil {
+		if s.cached == "" {
+			return "", fmt.Errorf("failed to acquire token: %w", err)
+		}
+		logger(LogComponentSender).Warnw("Failed to refresh token, using the previous token", "error", err)
+		return s.cached, nil
+	}
+
+	s.cached = token
+	s.expiry = expiry
+	return token, nil
+}
+
+type clientCredentials struct {
+	config *ClientCredentialsConfig
+	client *http.Client
+}
+
+type tokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func (c *clientCredentials) fetch() (string, time.Time, error) {
+	secret := c.config.ClientSecret
+	if c.config.ClientSecretFile != "" {
+		b, err := os.ReadFile(c.config.ClientSecretFile)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		secret = strings.TrimSpace(string(b))
+	}
+
+	form := url.Values{"grant_type": {"client_credentials"}}
+	if len(c.config.Scopes) > 0 {
+		form.Set("scope", strings.Join(c.config.Scopes, " "))
+	}
+	if c.config.Audience != "" {
+		form.Set("audience", c.config.Audience)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.config.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(secret))
+
+	start := time.Now()
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", time.Time{}, fmt.Errorf("expected status code 2xx from %s, got %d", c.config.TokenURL, resp.StatusCode)
+	}
+
+	tr := tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to decode token response: %w", err)
+	}
+	// Tokens without expiry are refreshed like token files.
+	expiry := start.Add(DefaultTokenFileRefreshInterval)
+	if tr.ExpiresIn > 0 {
+		expiry = start.Add(time.Duration(tr.ExpiresIn)*time.Second - tokenExpiryDelta)
+	}
+	return tr.AccessToken, expiry, nil
+}
+
+type ReceiverAuthConfig struct {
+	// Token is the static bearer token requests must carry.
+	Token string `json:"token" yaml:"token" secret:"true"`
+	// JWT requires requests to carry a bearer JWT signed by a trusted key, with the configured issuer and audience.
+	JWT *JWTConfig `json:"jwt" yaml:"jwt"`
+}
+
+func (c *ReceiverAuthConfig) validate() error {
+	if (c.Token == "") == (c.JWT == nil) {
+		return invalidErr("receiver.auth", errors.New("exactly one of token or jwt must be specified"))
+	}
+	if c.JWT != nil {
+		if (c.JWT.PublicKeyFile == "") == (c.JWT.JWKSURL == "") {
+			return invalidErr("receiver.auth.jwt", errors.New("exactly one of publicKeyFile or jwksURL must be specified"))
+		}
+		if c.JWT.JWKSURL != "" {
+			if u, err := url.Parse(c.JWT.JWKSURL); err != nil || !u.IsAbs() {
+				return invalidErr("receiver.auth.jwt.jwksURL", fmt.Errorf("%q must be an absolute URL: %v", c.JWT.JWKSURL, err))
+			}
+		}
+	}
+	return nil
+}
+
+const (
+	authRejectedMissingToken = "missing_token"
+	authRejectedInvalidToken = "invalid_token"
+)
+
+// requestAuthenticator verifies the bearer token of received requests.
+type requestAuthenticator struct {
+	token string
+	jwt   *jwtVerifier
+}
+
+func newRequestAuthenticator(config *ReceiverAuthConfig) (*requestAuthenticator, error) {
+	a := &requestAuthenticator{token: config.Token}
+	if config.JWT != nil {
+		v, err := newJWTVerifier(config.JWT)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load JWT verification keys: %w", err)
+		}
+		a.jwt = v
+	}
+	return a, nil
+}
+
+// authenticate returns the reason the given request is rejected and the cause, or nil when it is authenticated.
+func (a *requestAuthenticator) authenticate(req *http.Request) (string, error) {
+	header := req.Header.Get("Authorization")
+	if header == "" {
+		return authRejectedMissingToken, errors.New("missing Authorization header")
+	}
+	const prefix = "bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return authRejectedInvalidToken, errors.New("expected a bearer token")
+	}
+	token := header[len(prefix):]
+
+	if a.jwt != nil {
+		if err := a.jwt.verify(token, time.Now()); err != nil {
+			return authRejectedInvalidToken, err
+		}
+		return "", nil
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		return authRejectedInvalidToken, errors.New("unexpected token")
+	}
+	return "", nil
+}
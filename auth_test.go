@@ -0,0 +1,234 @@
+package sacura
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"go.uber.org/atomic"
+)
+
+func TestSenderAuthConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  SenderAuthConfig
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:   "static token",
+			config: SenderAuthConfig{Token: "token"},
+		},
+		{
+			name:   "token file default refresh interval",
+			config: SenderAuthConfig{TokenFile: "/var/run/secrets/tokens/token"},
+			want:   DefaultTokenFileRefreshInterval,
+		},
+		{
+			name:   "token file refresh interval",
+			config: SenderAuthConfig{TokenFile: "/var/run/secrets/tokens/token", TokenFileRefreshInterval: "10s"},
+			want:   10 * time.Second,
+		},
+		{
+			name:    "token file invalid refresh interval",
+			config:  SenderAuthConfig{TokenFile: "/var/run/secrets/tokens/token", TokenFileRefreshInterval: "-1s"},
+			wantErr: true,
+		},
+		{
+			name:    "no token source",
+			config:  SenderAuthConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "multiple token sources",
+			config:  SenderAuthConfig{Token: "token", TokenFile: "/var/run/secrets/tokens/token"},
+			wantErr: true,
+		},
+		{
+			name: "client credentials",
+			config: SenderAuthConfig{ClientCredentials: &ClientCredentialsConfig{
+				TokenURL:     "https://auth.example.com/token",
+				ClientID:     "sacura",
+				ClientSecret: "secret",
+			}},
+		},
+		{
+			name: "client credentials without secret",
+			config: SenderAuthConfig{ClientCredentials: &ClientCredentialsConfig{
+				TokenURL: "https://auth.example.com/token",
+				ClientID: "sacura",
+			}},
+			wantErr: true,
+		},
+		{
+			name: "client credentials relative token URL",
+			config: SenderAuthConfig{ClientCredentials: &ClientCredentialsConfig{
+				TokenURL:     "/token",
+				ClientID:     "sacura",
+				ClientSecret: "secret",
+			}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate("sender.auth")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if got := tt.config.ParsedTokenFileRefreshInterval; !tt.wantErr && got != tt.want {
+				t.Errorf("expected refresh interval %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTokenFileSource(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "token")
+	write := func(token string) {
+		if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tokens := newTokenSource(&SenderAuthConfig{TokenFile: path, ParsedTokenFileRefreshInterval: 10 * time.Millisecond})
+	if _, err := tokens.token(); err == nil {
+		t.Fatal("expected error for missing token file")
+	}
+
+	write("first")
+	if got, err := tokens.token(); err != nil || got != "first" {
+		t.Fatalf("expected token first, got %q %v", got, err)
+	}
+
+	write("second")
+	time.Sleep(20 * time.Millisecond)
+	if got, err := tokens.token(); err != nil || got != "second" {
+		t.Fatalf("expected rotated token second, got %q %v", got, err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got, err := tokens.token(); err != nil || got != "second" {
+		t.Fatalf("expected previous token when refresh fails, got %q %v", got, err)
+	}
+}
+
+func TestClientCredentialsTokenSource(t *testing.T) {
+
+	requests := atomic.NewInt64(0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "sacura" || secret != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.Form.Get("grant_type") != "client_credentials" || r.Form.Get("scope") != "a b" || r.Form.Get("audience") != "broker" {
+			t.Errorf("unexpected form %v", r.Form)
+		}
+		_ = json.NewEncoder(w).Encode(tokenResponse{AccessToken: "access", ExpiresIn: 3600})
+	}))
+	defer server.Close()
+
+	tokens := newTokenSource(&SenderAuthConfig{ClientCredentials: &ClientCredentialsConfig{
+		TokenURL:     server.URL,
+		ClientID:     "sacura",
+		ClientSecret: "secret",
+		Scopes:       []string{"a", "b"},
+		Audience:     "broker",
+	}})
+	for i := 0; i < 3; i++ {
+		if got, err := tokens.token(); err != nil || got != "access" {
+			t.Fatalf("expected token access, got %q %v", got, err)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("expected token to be cached until expiry, got %d requests", got)
+	}
+
+	wrongSecret := newTokenSource(&SenderAuthConfig{ClientCredentials: &ClientCredentialsConfig{
+		TokenURL:     server.URL,
+		ClientID:     "sacura",
+		ClientSecret: "wrong",
+	}})
+	if _, err := wrongSecret.token(); err == nil {
+		t.Error("expected error for rejected client credentials")
+	}
+}
+
+func TestNewTargeterGeneratorAuthorization(t *testing.T) {
+
+	out := make(chan ce.Event, 1)
+	config := Config{
+		Sender: SenderConfig{
+			Target: "http://localhost:9090",
+			Auth:   &SenderAuthConfig{Token: "token"},
+		},
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	target := vegeta.Target{}
+	if err := f(&target); err != nil {
+		t.Fatal(err)
+	}
+	if got := target.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("expected bearer token, got %q", got)
+	}
+}
+
+func TestReceiverAuthConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  ReceiverAuthConfig
+		wantErr bool
+	}{
+		{
+			name:   "static token",
+			config: ReceiverAuthConfig{Token: "token"},
+		},
+		{
+			name:   "JWT with JWKS",
+			config: ReceiverAuthConfig{JWT: &JWTConfig{Issuer: "https://issuer.example.com", JWKSURL: "https://issuer.example.com/keys"}},
+		},
+		{
+			name:    "token and JWT",
+			config:  ReceiverAuthConfig{Token: "token", JWT: &JWTConfig{PublicKeyFile: "/keys.pem"}},
+			wantErr: true,
+		},
+		{
+			name:    "JWT without keys",
+			config:  ReceiverAuthConfig{JWT: &JWTConfig{Issuer: "https://issuer.example.com"}},
+			wantErr: true,
+		},
+		{
+			name:    "JWT relative JWKS URL",
+			config:  ReceiverAuthConfig{JWT: &JWTConfig{JWKSURL: "/keys"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,192 @@
+package sacura
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/linkedin/goavro/v2"
+)
+
+// maxGeneratedDepth bounds the nesting of generated values of recursive schemas.
+const maxGeneratedDepth = 8
+
+// avroCodec encodes data with the Avro binary encoding. JSON values are standard JSON, union values aren't wrapped in
+// an object with the name of their branch, the branch is selected by the JSON type of the value.
+type avroCodec struct {
+	codec *goavro.Codec
+	// schema is the parsing canonical form of the schema decoded from JSON, values are generated from it.
+	schema interface{}
+	// names are the named types of the schema by full name, the canonical form references them by name after their
+	// definition, relative to the namespace of the enclosing named type.
+	names map[string]map[string]interface{}
+}
+
+func newAvroCodec(schema string) (*avroCodec, error) {
+	codec, err := goavro.NewCodecForStandardJSON(schema)
+	if err != nil {
+		return nil, err
+	}
+	c := &avroCodec{codec: codec, names: make(map[string]map[string]interface{})}
+	if err := json.Unmarshal([]byte(codec.CanonicalSchema()), &c.schema); err != nil {
+		return nil, err
+	}
+	c.collectNames(c.schema)
+	return c, nil
+}
+
+func (c *avroCodec) collectNames(schema interface{}) {
+	switch s := schema.(type) {
+	case []interface{}:
+		for _, b := range s {
+			c.collectNames(b)
+		}
+	case map[string]interface{}:
+		if name, ok := s["name"].(string); ok {
+			c.names[name] = s
+		}
+		fields, _ := s["fields"].([]interface{})
+		for _, f := range fields {
+			if f, ok := f.(map[string]interface{}); ok {
+				c.collectNames(f["type"])
+			}
+		}
+		c.collectNames(s["items"])
+		c.collectNames(s["values"])
+	}
+}
+
+func (c *avroCodec) generate(r *rand.Rand) ([]byte, error) {
+	v, err := c.generateValue(r, c.schema, "", 0)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return c.encode(data)
+}
+
+// generateValue returns a random JSON value of the given canonical schema, enclosed in the given namespace.
+func (c *avroCodec) generateValue(r *rand.Rand, schema interface{}, namespace string, depth int) (interface{}, error) {
+	if depth > maxGeneratedDepth {
+		return nil, fmt.Errorf("Avro schema %v is too deeply nested", schema)
+	}
+	switch s := schema.(type) {
+	case string:
+		switch s {
+		case "null":
+			return nil, nil
+		case "boolean":
+			return r.Intn(2) == 1, nil
+		case "int":
+			return r.Int31(), nil
+		case "long":
+			return r.Int63(), nil
+		case "float", "double":
+			return r.Float64(), nil
+		case "bytes", "string":
+			return randomString(r, 8+r.Intn(9)), nil
+		}
+		named, ok := c.names[s]
+		if !ok && namespace != "" {
+			named, ok = c.names[namespace+"."+s]
+		}
+		if !ok {
+			return nil, fmt.Errorf("unknown Avro type %q", s)
+		}
+		return c.generateValue(r, named, namespace, depth)
+	case []interface{}:
+		branch := s[r.Intn(len(s))]
+		if depth >= maxGeneratedDepth/2 {
+			// Recursive schemas terminate with their null branch.
+			for _, b := range s {
+				if b == "null" {
+					branch = b
+				}
+			}
+		}
+		return c.generateValue(r, branch, namespace, depth+1)
+	case map[string]interface{}:
+		if name, ok := s["name"].(string); ok {
+			if i := strings.LastIndexByte(name, '.'); i >= 0 {
+				namespace = name[:i]
+			}
+		}
+		switch s["type"] {
+		case "record":
+			fields, _ := s["fields"].([]interface{})
+			record := make(map[string]interface{}, len(fields))
+			for _, f := range fields {
+				f, _ := f.(map[string]interface{})
+				v, err := c.generateValue(r, f["type"], namespace, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				record[fmt.Sprint(f["name"])] = v
+			}
+			return record, nil
+		case "enum":
+			symbols, _ := s["symbols"].([]interface{})
+			return symbols[r.Intn(len(symbols))], nil
+		case "fixed":
+			size, _ := s["size"].(float64)
+			return randomString(r, int(size)), nil
+		case "array":
+			items := []interface{}{}
+			for i := r.Intn(3); i > 0 && depth < maxGeneratedDepth; i-- {
+				item, err := c.generateValue(r, s["items"], namespace, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, item)
+			}
+			return items, nil
+		case "map":
+			values := make(map[string]interface{})
+			for i := r.Intn(3); i > 0 && depth < maxGeneratedDepth; i-- {
+				value, err := c.generateValue(r, s["values"], namespace, depth+1)
+				if err != nil {
+					return nil, err
+				}
+				values[randomString(r, 8)] = value
+			}
+			return values, nil
+		}
+		return c.generateValue(r, s["type"], namespace, depth)
+	}
+	return nil, fmt.Errorf("unknown Avro schema %v", schema)
+}
+
+func randomString(r *rand.Rand, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = payloadAlphabet[r.Intn(len(payloadAlphabet))]
+	}
+	return string(b)
+}
+
+func (c *avroCodec) encode(data []byte) ([]byte, error) {
+	v, rest, err := c.codec.NativeFromTextual(data)
+	if err != nil {
+		return nil, err
+	}
+	if rest = bytes.TrimSpace(rest); len(rest) > 0 {
+		return nil, fmt.Errorf("%d trailing bytes", len(rest))
+	}
+	return c.codec.BinaryFromNative(nil, v)
+}
+
+func (c *avroCodec) verify(b []byte) error {
+	_, rest, err := c.codec.NativeFromBinary(b)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("%d trailing bytes", len(rest))
+	}
+	return nil
+}
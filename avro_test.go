@@ -0,0 +1,156 @@
+package sacura
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+const testAvroSchema = `{
+  "type": "record",
+  "name": "Order",
+  "namespace": "com.example",
+  "fields": [
+    {"name": "id", "type": "string"},
+    {"name": "quantity", "type": "int"},
+    {"name": "price", "type": "double"},
+    {"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "SHIPPED"]}},
+    {"name": "tags", "type": {"type": "array", "items": "string"}},
+    {"name": "attributes", "type": {"type": "map", "values": "long"}},
+    {"name": "note", "type": ["null", "string"]},
+    {"name": "next", "type": ["null", "Order"]}
+  ]
+}`
+
+func TestAvroCodecEncode(t *testing.T) {
+
+	c, err := newAvroCodec(testAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "record",
+			data: `{"id": "a", "quantity": -2, "price": 0, "status": "SHIPPED", "tags": ["x"], "attributes": {"k": 1}, "note": null, "next": null}`,
+			want: []byte{
+				2, 'a', // id
+				3,                      // quantity
+				0, 0, 0, 0, 0, 0, 0, 0, // price
+				2,            // status
+				2, 2, 'x', 0, // tags
+				2, 2, 'k', 2, 0, // attributes
+				0, // note
+				0, // next
+			},
+		},
+		{
+			name: "union branches",
+			data: `{"id": "a", "quantity": 1, "price": 0, "status": "NEW", "tags": [], "attributes": {}, "note": "n", "next": ` +
+				`{"id": "b", "quantity": 1, "price": 0, "status": "NEW", "tags": [], "attributes": {}, "note": null, "next": null}}`,
+			want: []byte{
+				2, 'a', 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+				2, 2, 'n', // note
+				2, 2, 'b', 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, // next
+			},
+		},
+		{name: "missing field", data: `{"id": "a"}`, wantErr: true},
+		{name: "unknown symbol", data: `{"id": "a", "quantity": 1, "price": 1, "status": "LOST", "tags": [], "attributes": {}, "note": null, "next": null}`, wantErr: true},
+		{name: "int out of range", data: `{"id": "a", "quantity": 1099511627776, "price": 1, "status": "NEW", "tags": [], "attributes": {}, "note": null, "next": null}`, wantErr: true},
+		{name: "invalid JSON", data: `{"id": `, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.encode([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+			if err := c.verify(got); err != nil {
+				t.Errorf("failed to verify %v: %v", got, err)
+			}
+		})
+	}
+}
+
+func TestAvroCodecVerify(t *testing.T) {
+
+	c, err := newAvroCodec(testAvroSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := newRand(nil, "avro")
+	for i := 0; i < 100; i++ {
+		b, err := c.generate(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.verify(b); err != nil {
+			t.Fatalf("failed to verify generated data %v: %v", b, err)
+		}
+		// Truncated data doesn't deserialize.
+		if err := c.verify(b[:len(b)/2]); err == nil && len(b) > 1 {
+			t.Fatalf("expected error verifying truncated data %v", b[:len(b)/2])
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "invalid symbol", data: []byte{2, 'a', 2, 0, 0, 0, 0, 0, 0, 0, 0, 4, 0, 0, 0, 0}},
+		{name: "trailing bytes", data: []byte{2, 'a', 2, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := c.verify(tt.data); err == nil {
+				t.Errorf("expected error verifying %v", tt.data)
+			}
+		})
+	}
+}
+
+func TestNewAvroCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		wantErr bool
+	}{
+		{name: "primitive", schema: `"string"`},
+		{name: "logical type", schema: `{"type": "record", "name": "A", "fields": [{"name": "t", "type": {"type": "long", "logicalType": "timestamp-millis"}}]}`},
+		{name: "fixed", schema: `{"type": "fixed", "name": "MD5", "size": 16}`},
+		{name: "unknown type", schema: `{"type": "record", "name": "A", "fields": [{"name": "b", "type": "B"}]}`, wantErr: true},
+		{name: "enum without symbols", schema: `{"type": "enum", "name": "E", "symbols": []}`, wantErr: true},
+		{name: "invalid JSON", schema: `{`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := newAvroCodec(tt.schema)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			b, err := c.generate(newRand(nil, tt.name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.verify(b); err != nil {
+				t.Errorf("failed to verify generated data %v: %v", b, err)
+			}
+		})
+	}
+}
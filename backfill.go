@@ -0,0 +1,431 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+type BackfillSource string
+
+const (
+	// BackfillSourceKafka reads the events of a Kafka topic in the binary content mode, from the earliest offset.
+	BackfillSourceKafka BackfillSource = "kafka"
+	// BackfillSourceS3 reads the objects of an S3 bucket, each object holds events in the structured JSON format as
+	// JSON lines or as a JSON array, objects with the .gz suffix are gzipped.
+	BackfillSourceS3 BackfillSource = "s3"
+	// BackfillSourceElasticsearch reads the documents of an Elasticsearch index, the source of each document is an
+	// event in the structured JSON format.
+	BackfillSourceElasticsearch BackfillSource = "elasticsearch"
+
+	// DefaultBackfillTimeout is the default maximum time spent reading the events from the store.
+	DefaultBackfillTimeout = 5 * time.Minute
+	// DefaultElasticsearchBatchSize is the default number of documents read with each Elasticsearch request.
+	DefaultElasticsearchBatchSize = 1000
+
+	// elasticsearchScroll is how long Elasticsearch keeps the search context between scroll requests.
+	elasticsearchScroll = "1m"
+)
+
+// BackfillConfig verifies a pipeline sacura can't subscribe to, like an archival or event sourcing pipeline, by
+// reading the delivered events from the external store the pipeline writes to once the send phase is done, instead
+// of receiving them live. The receiver isn't started.
+//
+// Backfilled events are received when they are read, so latencies include the backfill delay.
+type BackfillConfig struct {
+	// Source is the store events are read from, one of BackfillSourceKafka, BackfillSourceS3 or
+	// BackfillSourceElasticsearch.
+	Source BackfillSource `json:"source" yaml:"source"`
+	// Delay is the time waited after the send phase before reading the store, so that the pipeline stores the last
+	// events.
+	Delay string `json:"delay" yaml:"delay"`
+	// Timeout is the maximum time spent reading the store.
+	//
+	// Defaults to DefaultBackfillTimeout.
+	Timeout string `json:"timeout" yaml:"timeout"`
+
+	Kafka         *BackfillKafkaConfig         `json:"kafka" yaml:"kafka"`
+	S3            *BackfillS3Config            `json:"s3" yaml:"s3"`
+	Elasticsearch *BackfillElasticsearchConfig `json:"elasticsearch" yaml:"elasticsearch"`
+
+	ParsedDelay   time.Duration
+	ParsedTimeout time.Duration
+}
+
+type BackfillKafkaConfig struct {
+	KafkaConfig `yaml:",inline"`
+
+	// Bootstrap is the URL of a broker of the cluster, either kafka://host[:port] or kafkas://host[:port].
+	Bootstrap string `json:"bootstrap" yaml:"bootstrap"`
+}
+
+// BackfillS3Config reads the objects of an S3 bucket, credentials are read like with report.upload.
+type BackfillS3Config struct {
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Prefix selects the objects whose name starts with it, for example archive/2021/.
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Endpoint is the URL of the object store, for example http://minio.minio.svc:9000, buckets are addressed in the
+	// path.
+	//
+	// Defaults to https://s3.<region>.amazonaws.com.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Region is the region of the bucket.
+	//
+	// Defaults to AWS_REGION, AWS_DEFAULT_REGION or DefaultAWSRegion.
+	Region string `json:"region" yaml:"region"`
+}
+
+type BackfillElasticsearchConfig struct {
+	// URL is the URL of the cluster, for example http://elasticsearch.logging.svc:9200.
+	URL   string `json:"url" yaml:"url"`
+	Index string `json:"index" yaml:"index"`
+	// Username and Password authenticate with HTTP basic authentication.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+	// BatchSize is the number of documents read with each request.
+	//
+	// Defaults to DefaultElasticsearchBatchSize.
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+}
+
+func (c *BackfillConfig) validate(config *Config) error {
+	if config.Receiver.Disabled {
+		return invalidErr("backfill", errors.New("cannot be used with receiver.disabled"))
+	}
+	if config.Distributed != nil {
+		return invalidErr("backfill", errors.New("cannot be used in distributed mode"))
+	}
+
+	var err error
+	if c.Delay != "" {
+		c.ParsedDelay, err = time.ParseDuration(c.Delay)
+		if err != nil {
+			return invalidErr("backfill.delay", err)
+		}
+		if c.ParsedDelay < 0 {
+			return invalidErr("backfill.delay", fmt.Errorf("%v cannot be negative", c.ParsedDelay))
+		}
+	}
+	c.ParsedTimeout = DefaultBackfillTimeout
+	if c.Timeout != "" {
+		c.ParsedTimeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return invalidErr("backfill.timeout", err)
+		}
+		if c.ParsedTimeout <= 0 {
+			return invalidErr("backfill.timeout", fmt.Errorf("%v must be positive", c.ParsedTimeout))
+		}
+	}
+
+	switch c.Source {
+	case BackfillSourceKafka:
+		if c.Kafka == nil {
+			return invalidErr("backfill.kafka", fmt.Errorf("must be specified with the %s source", BackfillSourceKafka))
+		}
+		if err := validateKafkaBroker("backfill.kafka.bootstrap", c.Kafka.Bootstrap); err != nil {
+			return err
+		}
+		return c.Kafka.validate("backfill.kafka")
+	case BackfillSourceS3:
+		if c.S3 == nil {
+			return invalidErr("backfill.s3", fmt.Errorf("must be specified with the %s source", BackfillSourceS3))
+		}
+		return c.S3.validate()
+	case BackfillSourceElasticsearch:
+		if c.Elasticsearch == nil {
+			return invalidErr("backfill.elasticsearch", fmt.Errorf("must be specified with the %s source", BackfillSourceElasticsearch))
+		}
+		return c.Elasticsearch.validate()
+	default:
+		return invalidErr("backfill.source", fmt.Errorf("unknown source %q, expected one of %v", c.Source, []BackfillSource{
+			BackfillSourceKafka, BackfillSourceS3, BackfillSourceElasticsearch,
+		}))
+	}
+}
+
+func (c *BackfillS3Config) validate() error {
+	if c.Bucket == "" {
+		return invalidErr("backfill.s3.bucket", errors.New("cannot be empty"))
+	}
+	if c.Endpoint != "" {
+		if err := validateHTTPURL(c.Endpoint); err != nil {
+			return invalidErr("backfill.s3.endpoint", err)
+		}
+	}
+	return nil
+}
+
+func (c *BackfillElasticsearchConfig) validate() error {
+	if err := validateHTTPURL(c.URL); err != nil {
+		return invalidErr("backfill.elasticsearch.url", err)
+	}
+	if c.Index == "" {
+		return invalidErr("backfill.elasticsearch.index", errors.New("cannot be empty"))
+	}
+	if c.BatchSize < 0 {
+		return invalidErr("backfill.elasticsearch.batchSize", fmt.Errorf("%d cannot be negative", c.BatchSize))
+	}
+	if c.BatchSize == 0 {
+		c.BatchSize = DefaultElasticsearchBatchSize
+	}
+	return nil
+}
+
+// validateHTTPURL returns an error when the given string isn't an http or https URL.
+func validateHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q must be an http or https URL", s)
+	}
+	return nil
+}
+
+// BackfillReport reports the events read from the external store of backfill.
+type BackfillReport struct {
+	Source BackfillSource `json:"source"`
+	// ReadCount is the number of events read from the store, including duplicates.
+	ReadCount int `json:"readCount"`
+	// InvalidCount is the number of records of the store that aren't valid events, they are skipped.
+	InvalidCount int `json:"invalidCount"`
+	// Error is the error that interrupted reading the store, events read before the error are verified.
+	Error string `json:"error,omitempty"`
+}
+
+// backfill reads the delivered events from the store of the given config once done is closed and sends them to
+// received, which is closed once the store has been read.
+func (s *StateManager) backfill(ctx context.Context, config *BackfillConfig, done <-chan struct{}, received chan<- ReceivedEvent) {
+	defer close(received)
+
+	<-done
+	select {
+	case <-time.After(config.ParsedDelay):
+	case <-ctx.Done():
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.ParsedTimeout)
+	defer cancel()
+
+	logger(LogComponentReceiver).Infow("Reading delivered events from the store", "source", config.Source)
+	report := &BackfillReport{Source: config.Source}
+	err := readBackfill(ctx, config, func(e *ce.Event, err error) {
+		if err != nil {
+			report.InvalidCount++
+			logger(LogComponentReceiver).Warnw("Skipping invalid event of the store", "source", config.Source, "error", err)
+			return
+		}
+		report.ReadCount++
+		received <- ReceivedEvent{Event: *e, ReceivedAt: time.Now()}
+	})
+	if err != nil {
+		report.Error = err.Error()
+		logger(LogComponentReceiver).Errorw("Failed to read delivered events from the store", "source", config.Source, "error", err)
+	}
+	logger(LogComponentReceiver).Infow("Read delivered events from the store", "source", config.Source, "events", report.ReadCount, "invalid", report.InvalidCount)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.backfilled = report
+}
+
+// backfillReport sets the backfill section of the report, it must be called while holding the lock.
+func (s *StateManager) backfillReport(r *Report) {
+	if s.backfilled == nil {
+		return
+	}
+	backfilled := *s.backfilled
+	r.Backfill = &backfilled
+}
+
+// verifyBackfill returns an error when the store couldn't be read.
+func verifyBackfill(report Report) error {
+	if report.Backfill == nil || report.Backfill.Error == "" {
+		return nil
+	}
+	return fmt.Errorf("failed to read delivered events from %s after %d events: %s", report.Backfill.Source, report.Backfill.ReadCount, report.Backfill.Error)
+}
+
+// readBackfill reads the events of the store of the given config and calls handle with each event, or with the error
+// of records that aren't valid events.
+func readBackfill(ctx context.Context, config *BackfillConfig, handle func(*ce.Event, error)) error {
+	switch config.Source {
+	case BackfillSourceKafka:
+		return replayKafkaTopic(ctx, config.Kafka.Bootstrap, &config.Kafka.KafkaConfig, func(r *kgo.Record) {
+			handle(kafkaEvent(r))
+		})
+	case BackfillSourceS3:
+		return readS3Backfill(ctx, config.S3, handle)
+	case BackfillSourceElasticsearch:
+		return readElasticsearchBackfill(ctx, config.Elasticsearch, handle)
+	}
+	return fmt.Errorf("unknown source %q", config.Source)
+}
+
+// readS3Backfill reads the events of the objects of the bucket of the given config.
+func readS3Backfill(ctx context.Context, config *BackfillS3Config, handle func(*ce.Event, error)) error {
+	store, err := newS3Store(ctx, config.Bucket, config.Endpoint, config.Region)
+	if err != nil {
+		return err
+	}
+	keys, err := store.list(ctx, config.Prefix)
+	if err != nil {
+		return fmt.Errorf("failed to list objects: %w", err)
+	}
+	for _, key := range keys {
+		b, err := store.get(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to get object %s: %w", key, err)
+		}
+		if strings.HasSuffix(key, ".gz") {
+			if b, err = gunzip(bytes.NewReader(b)); err != nil {
+				return fmt.Errorf("failed to decompress object %s: %w", key, err)
+			}
+		}
+		decodeStructuredEvents(b, handle)
+	}
+	return nil
+}
+
+// decodeStructuredEvents decodes events in the structured JSON format, as JSON lines or as a JSON array.
+func decodeStructuredEvents(b []byte, handle func(*ce.Event, error)) {
+	b = bytes.TrimSpace(b)
+	if len(b) > 0 && b[0] == '[' {
+		var raw []json.RawMessage
+		if err := json.Unmarshal(b, &raw); err != nil {
+			handle(nil, err)
+			return
+		}
+		for _, m := range raw {
+			handle(decodeStructuredEvent(m))
+		}
+		return
+	}
+	for _, line := range bytes.Split(b, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		handle(decodeStructuredEvent(line))
+	}
+}
+
+func decodeStructuredEvent(b []byte) (*ce.Event, error) {
+	e := ce.NewEvent()
+	if err := json.Unmarshal(b, &e); err != nil {
+		return nil, err
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// list returns the names of the objects of the bucket starting with the given prefix, with the ListObjectsV2 API.
+func (s *s3Store) list(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{Bucket: aws.String(s.bucket), Prefix: aws.String(prefix)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			keys = append(keys, aws.ToString(o.Key))
+		}
+	}
+	return keys, nil
+}
+
+// get returns the content of the object with the given name.
+func (s *s3Store) get(ctx context.Context, name string) ([]byte, error) {
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(s.bucket), Key: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+	return io.ReadAll(out.Body)
+}
+
+// readElasticsearchBackfill reads the documents of the index of the given config with the scroll API.
+func readElasticsearchBackfill(ctx context.Context, config *BackfillElasticsearchConfig, handle func(*ce.Event, error)) error {
+	client := &http.Client{Timeout: time.Minute}
+	endpoint := strings.TrimSuffix(config.URL, "/")
+
+	type searchResponse struct {
+		ScrollID string `json:"_scroll_id"`
+		Hits     struct {
+			Hits []struct {
+				Source json.RawMessage `json:"_source"`
+			} `json:"hits"`
+		} `json:"hits"`
+	}
+	search := func(method, url string, body interface{}) (*searchResponse, error) {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if config.Username != "" {
+			req.SetBasicAuth(config.Username, config.Password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if err := checkHTTPResponse(resp); err != nil {
+			return nil, err
+		}
+		if method == http.MethodDelete {
+			return nil, nil
+		}
+		r := &searchResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(r); err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+
+	r, err := search(http.MethodPost, endpoint+"/"+url.PathEscape(config.Index)+"/_search?scroll="+elasticsearchScroll, map[string]interface{}{
+		"size": config.BatchSize,
+		"sort": []string{"_doc"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to search index %s: %w", config.Index, err)
+	}
+	defer func() {
+		if r.ScrollID == "" {
+			return
+		}
+		if _, err := search(http.MethodDelete, endpoint+"/_search/scroll", map[string]string{"scroll_id": r.ScrollID}); err != nil {
+			logger(LogComponentReceiver).Warnw("Failed to clear the search context", "index", config.Index, "error", err)
+		}
+	}()
+	for len(r.Hits.Hits) > 0 {
+		for _, hit := range r.Hits.Hits {
+			handle(decodeStructuredEvent(hit.Source))
+		}
+		next, err := search(http.MethodPost, endpoint+"/_search/scroll", map[string]string{"scroll": elasticsearchScroll, "scroll_id": r.ScrollID})
+		if err != nil {
+			return fmt.Errorf("failed to scroll index %s: %w", config.Index, err)
+		}
+		r = next
+	}
+	return nil
+}
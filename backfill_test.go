@@ -0,0 +1,259 @@
+package sacura
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBackfillConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  BackfillConfig
+		global  Config
+		wantErr bool
+	}{
+		{
+			name:   "kafka",
+			config: BackfillConfig{Source: BackfillSourceKafka, Delay: "10s", Kafka: &BackfillKafkaConfig{KafkaConfig: KafkaConfig{Topic: "archive"}, Bootstrap: "kafka://my-cluster-kafka-bootstrap:9092"}},
+		},
+		{
+			name:   "s3",
+			config: BackfillConfig{Source: BackfillSourceS3, S3: &BackfillS3Config{Bucket: "archive", Endpoint: "http://minio:9000"}},
+		},
+		{
+			name:   "elasticsearch",
+			config: BackfillConfig{Source: BackfillSourceElasticsearch, Elasticsearch: &BackfillElasticsearchConfig{URL: "http://elasticsearch:9200", Index: "events"}},
+		},
+		{name: "unknown source", config: BackfillConfig{Source: "pubsub"}, wantErr: true},
+		{name: "missing source config", config: BackfillConfig{Source: BackfillSourceS3}, wantErr: true},
+		{
+			name:    "invalid bootstrap",
+			config:  BackfillConfig{Source: BackfillSourceKafka, Kafka: &BackfillKafkaConfig{KafkaConfig: KafkaConfig{Topic: "archive"}, Bootstrap: "http://my-cluster:9092"}},
+			wantErr: true,
+		},
+		{name: "empty bucket", config: BackfillConfig{Source: BackfillSourceS3, S3: &BackfillS3Config{}}, wantErr: true},
+		{
+			name:    "invalid url",
+			config:  BackfillConfig{Source: BackfillSourceElasticsearch, Elasticsearch: &BackfillElasticsearchConfig{URL: "elasticsearch:9200", Index: "events"}},
+			wantErr: true,
+		},
+		{
+			name:    "negative delay",
+			config:  BackfillConfig{Source: BackfillSourceS3, Delay: "-1s", S3: &BackfillS3Config{Bucket: "archive"}},
+			wantErr: true,
+		},
+		{
+			name:    "receiver disabled",
+			config:  BackfillConfig{Source: BackfillSourceS3, S3: &BackfillS3Config{Bucket: "archive"}},
+			global:  Config{Receiver: ReceiverConfig{Disabled: true}},
+			wantErr: true,
+		},
+		{
+			name:    "distributed",
+			config:  BackfillConfig{Source: BackfillSourceS3, S3: &BackfillS3Config{Bucket: "archive"}},
+			global:  Config{Distributed: &DistributedConfig{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.global)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedTimeout != DefaultBackfillTimeout {
+				t.Errorf("want default timeout %v, got %v", DefaultBackfillTimeout, tt.config.ParsedTimeout)
+			}
+		})
+	}
+}
+
+func backfillEvent(t *testing.T, id string) []byte {
+	e := cetest.FullEvent()
+	e.SetID(id)
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// runBackfill backfills the given config and returns the report with the IDs of the received events.
+func runBackfill(t *testing.T, config *BackfillConfig) (*BackfillReport, []string) {
+	sm := newTestStateManager(t, Config{})
+	done := make(chan struct{})
+	close(done)
+	received := make(chan ReceivedEvent, 10)
+	go sm.backfill(context.Background(), config, done, received)
+	var ids []string
+	for e := range received {
+		ids = append(ids, e.Event.ID())
+	}
+	sort.Strings(ids)
+	report := sm.GenerateReport()
+	return report.Backfill, ids
+}
+
+func TestBackfillS3(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	_, _ = w.Write(append(append(backfillEvent(t, "3"), '\n'), backfillEvent(t, "4")...))
+	_ = w.Close()
+	objects := map[string][]byte{
+		"archive/1.jsonl":   append(append(backfillEvent(t, "1"), '\n'), []byte("{\"id\":\"invalid\"}\n")...),
+		"archive/2.json":    []byte("[" + string(backfillEvent(t, "2")) + "]"),
+		"archive/3.json.gz": gz.Bytes(),
+	}
+	keys := []string{"archive/1.jsonl", "archive/2.json", "archive/3.json.gz"}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/events" {
+			if r.URL.Query().Get("prefix") != "archive/" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// Objects are listed in pages of 2.
+			page, next := keys[:2], `<IsTruncated>true</IsTruncated><NextContinuationToken>2</NextContinuationToken>`
+			if r.URL.Query().Get("continuation-token") == "2" {
+				page, next = keys[2:], `<IsTruncated>false</IsTruncated>`
+			}
+			fmt.Fprint(w, `<ListBucketResult>`)
+			for _, k := range page {
+				fmt.Fprintf(w, `<Contents><Key>%s</Key></Contents>`, k)
+			}
+			fmt.Fprint(w, next+`</ListBucketResult>`)
+			return
+		}
+		o, ok := objects[strings.TrimPrefix(r.URL.Path, "/events/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(o)
+	}))
+	defer server.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	config := &BackfillConfig{Source: BackfillSourceS3, S3: &BackfillS3Config{Bucket: "events", Prefix: "archive/", Endpoint: server.URL}}
+	if err := config.validate(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	report, ids := runBackfill(t, config)
+	if diff := cmp.Diff(&BackfillReport{Source: BackfillSourceS3, ReadCount: 4, InvalidCount: 1}, report); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3", "4"}, ids); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestBackfillElasticsearch(t *testing.T) {
+	cleared := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if u, p, _ := r.BasicAuth(); u != "elastic" || p != "changeme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		hits := func(scrollID string, ids ...string) {
+			fmt.Fprintf(w, `{"_scroll_id":%q,"hits":{"hits":[`, scrollID)
+			for i, id := range ids {
+				if i > 0 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"_source":%s}`, backfillEvent(t, id))
+			}
+			fmt.Fprint(w, `]}}`)
+		}
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/events/_search":
+			if body["size"] != float64(2) || r.URL.Query().Get("scroll") == "" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			hits("scroll-1", "1", "2")
+		case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll" && body["scroll_id"] == "scroll-1":
+			hits("scroll-2", "3")
+		case r.Method == http.MethodPost && r.URL.Path == "/_search/scroll" && body["scroll_id"] == "scroll-2":
+			hits("scroll-2")
+		case r.Method == http.MethodDelete && r.URL.Path == "/_search/scroll":
+			cleared = true
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	config := &BackfillConfig{
+		Source:        BackfillSourceElasticsearch,
+		Elasticsearch: &BackfillElasticsearchConfig{URL: server.URL, Index: "events", Username: "elastic", Password: "changeme", BatchSize: 2},
+	}
+	if err := config.validate(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	report, ids := runBackfill(t, config)
+	if diff := cmp.Diff(&BackfillReport{Source: BackfillSourceElasticsearch, ReadCount: 3}, report); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if diff := cmp.Diff([]string{"1", "2", "3"}, ids); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if !cleared {
+		t.Error("want the search context to be cleared")
+	}
+}
+
+func TestBackfillKafka(t *testing.T) {
+	broker := startTestKafkaBroker(t, "archive", 2, "", "")
+	for i := 0; i < 3; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		record, err := newKafkaRecord(&e, http.Header{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Partition = int32(i % 2)
+		broker.produce(t, record)
+	}
+
+	config := &BackfillConfig{Source: BackfillSourceKafka, Kafka: &BackfillKafkaConfig{KafkaConfig: KafkaConfig{Topic: "archive"}, Bootstrap: broker.url()}}
+	if err := config.validate(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	report, ids := runBackfill(t, config)
+	if diff := cmp.Diff(&BackfillReport{Source: BackfillSourceKafka, ReadCount: 3}, report); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if diff := cmp.Diff([]string{"0", "1", "2"}, ids); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestVerifyBackfill(t *testing.T) {
+	if err := verifyBackfill(Report{Backfill: &BackfillReport{Source: BackfillSourceS3, ReadCount: 3}}); err != nil {
+		t.Error("want no error, got", err)
+	}
+	err := verifyBackfill(Report{Backfill: &BackfillReport{Source: BackfillSourceS3, ReadCount: 3, Error: "access denied"}})
+	if err == nil || !strings.Contains(err.Error(), "access denied") {
+		t.Error("want read error, got", err)
+	}
+}
@@ -0,0 +1,166 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultBenchmarkPrecision is the default precision of the search of the benchmark mode, in percent.
+const DefaultBenchmarkPrecision = 5
+
+// BenchmarkConfig searches the maximum sustainable throughput of the target: the test runs in steps of the test
+// duration, starting at sender.frequency and doubling the rate until a step fails, then binary searching the rate
+// between the last passed and the first failed step.
+//
+// A step fails when the verification fails or a threshold is violated, so that thresholds are the SLOs of the
+// benchmark, for example thresholds.maxLostPercentage and thresholds.maxP99Latency.
+type BenchmarkConfig struct {
+	// MaxRate is the maximum rate tried, in events per second.
+	MaxRate int `json:"maxRate" yaml:"maxRate"`
+	// Precision stops the search once the difference between the failed and the passed rate is at most this
+	// percentage of the passed rate.
+	//
+	// Defaults to DefaultBenchmarkPrecision.
+	Precision int `json:"precision" yaml:"precision"`
+}
+
+func (c *BenchmarkConfig) validate(config *Config) error {
+	if config.Sender.Disabled || config.Receiver.Disabled {
+		return invalidErr("benchmark", errors.New("both the sender and the receiver must be enabled"))
+	}
+	if config.Sender.LoadProfile != nil || config.Sender.Replay != nil {
+		return invalidErr("benchmark", errors.New("cannot be used with sender.loadProfile or sender.replay, the benchmark drives the rate"))
+	}
+	if config.Distributed != nil {
+		return invalidErr("benchmark", errors.New("cannot be used in distributed mode"))
+	}
+	if c.MaxRate < config.Sender.FrequencyPerSecond {
+		return invalidErr("benchmark.maxRate", fmt.Errorf("%d must be greater or equal to sender.frequency %d", c.MaxRate, config.Sender.FrequencyPerSecond))
+	}
+	if c.Precision < 0 || c.Precision >= 100 {
+		return invalidErr("benchmark.precision", fmt.Errorf("%d must be between 0 and 100", c.Precision))
+	}
+	if c.Precision == 0 {
+		c.Precision = DefaultBenchmarkPrecision
+	}
+	return nil
+}
+
+// BenchmarkReport is the outcome of the benchmark mode.
+type BenchmarkReport struct {
+	// MaxSustainableRate is the highest rate of a passed step, in events per second, it is 0 when no step passed.
+	MaxSustainableRate int `json:"maxSustainableRate"`
+	// LimitingRate is the lowest rate of a failed step, it is 0 when every step up to benchmark.maxRate passed.
+	LimitingRate int `json:"limitingRate,omitempty"`
+	// LimitingSymptom is the failure of the step at LimitingRate, for example the violated thresholds.
+	LimitingSymptom string          `json:"limitingSymptom,omitempty"`
+	Steps           []BenchmarkStep `json:"steps"`
+}
+
+// BenchmarkStep summarizes the report of a step of the benchmark.
+type BenchmarkStep struct {
+	Rate   int    `json:"rate"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+	// Throughput is the rate of accepted requests, in requests per second.
+	Throughput    float64       `json:"throughput"`
+	AcceptedCount int           `json:"acceptedCount"`
+	LostCount     int           `json:"lostCount"`
+	LatencyP99    time.Duration `json:"latencyP99"`
+}
+
+// searchMaxRate searches the maximum sustainable rate between start and config.MaxRate, run runs a step at the given
+// rate and returns its report and verification error.
+func searchMaxRate(ctx context.Context, config *BenchmarkConfig, start int, run func(rate int) (Report, error)) BenchmarkReport {
+	r := BenchmarkReport{}
+	step := func(rate int) bool {
+		logger(logComponentRun).Infow("Starting benchmark step", "rate", rate)
+		report, err := run(rate)
+		s := BenchmarkStep{
+			Rate:          rate,
+			Passed:        err == nil,
+			Throughput:    report.Metrics.Metrics.Throughput,
+			AcceptedCount: report.Metrics.AcceptedCount,
+			LostCount:     report.LostCount,
+			LatencyP99:    report.Latency.P99,
+		}
+		if err != nil {
+			s.Error = err.Error()
+		}
+		r.Steps = append(r.Steps, s)
+		logger(logComponentRun).Infow("Benchmark step done", "rate", rate, "passed", s.Passed, "error", s.Error)
+
+		if s.Passed {
+			r.MaxSustainableRate = rate
+		} else if r.LimitingRate == 0 || rate < r.LimitingRate {
+			r.LimitingRate, r.LimitingSymptom = rate, s.Error
+		}
+		return s.Passed
+	}
+
+	// Increase the rate until a step fails.
+	passed, failed := 0, 0
+	for rate := start; ctx.Err() == nil; {
+		if !step(rate) {
+			failed = rate
+			break
+		}
+		passed = rate
+		if rate == config.MaxRate {
+			return r
+		}
+		rate *= 2
+		if rate > config.MaxRate {
+			rate = config.MaxRate
+		}
+	}
+	if passed == 0 {
+		return r
+	}
+
+	// Back off, searching between the last passed and the first failed rate.
+	for ctx.Err() == nil && (failed-passed)*100 > config.Precision*passed && failed-passed > 1 {
+		rate := passed + (failed-passed)/2
+		if step(rate) {
+			passed = rate
+		} else {
+			failed = rate
+		}
+	}
+	return r
+}
+
+// runBenchmark runs the benchmark described by the given config and writes the report with the maximum sustainable
+// rate, the returned error is not nil when no step passed.
+func runBenchmark(ctx context.Context, config Config) (Report, error) {
+	// Steps don't write reports, the report destinations receive the benchmark report.
+	stepConfig := config
+	stepConfig.Benchmark = nil
+	stepConfig.Report.Writers = nil
+	stepConfig.Report.Kubernetes = nil
+
+	b := searchMaxRate(ctx, config.Benchmark, config.Sender.FrequencyPerSecond, func(rate int) (Report, error) {
+		c := stepConfig
+		c.Sender.FrequencyPerSecond = rate
+		return Run(ctx, c)
+	})
+	_ = configureLogging(config.Logging)
+
+	report := Report{Benchmark: &b, Aborted: ctx.Err() != nil}
+	var verificationErr error
+	if b.MaxSustainableRate == 0 {
+		verificationErr = fmt.Errorf("no sustainable rate found, the initial rate %d failed: %s", config.Sender.FrequencyPerSecond, b.LimitingSymptom)
+	}
+	logger(LogComponentReport).Infow("Benchmark done", "maxSustainableRate", b.MaxSustainableRate, "limitingRate", b.LimitingRate, "limitingSymptom", b.LimitingSymptom)
+
+	if err := writeReports(config.Report, report, verificationErr); err != nil {
+		if verificationErr != nil {
+			logger(LogComponentReport).Errorw("Failed to write reports", "error", err)
+			return report, verificationErr
+		}
+		return report, err
+	}
+	return report, verificationErr
+}
@@ -0,0 +1,167 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBenchmarkConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		config        Config
+		wantPrecision int
+		wantErr       bool
+	}{
+		{
+			name:          "default precision",
+			config:        Config{Sender: SenderConfig{FrequencyPerSecond: 100}, Benchmark: &BenchmarkConfig{MaxRate: 10000}},
+			wantPrecision: DefaultBenchmarkPrecision,
+		},
+		{
+			name:          "custom precision",
+			config:        Config{Sender: SenderConfig{FrequencyPerSecond: 100}, Benchmark: &BenchmarkConfig{MaxRate: 100, Precision: 1}},
+			wantPrecision: 1,
+		},
+		{
+			name:    "max rate lower than frequency",
+			config:  Config{Sender: SenderConfig{FrequencyPerSecond: 100}, Benchmark: &BenchmarkConfig{MaxRate: 10}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid precision",
+			config:  Config{Sender: SenderConfig{FrequencyPerSecond: 100}, Benchmark: &BenchmarkConfig{MaxRate: 1000, Precision: 100}},
+			wantErr: true,
+		},
+		{
+			name:    "receiver disabled",
+			config:  Config{Sender: SenderConfig{FrequencyPerSecond: 100}, Receiver: ReceiverConfig{Disabled: true}, Benchmark: &BenchmarkConfig{MaxRate: 1000}},
+			wantErr: true,
+		},
+		{
+			name:    "load profile",
+			config:  Config{Sender: SenderConfig{FrequencyPerSecond: 100, LoadProfile: &LoadProfileConfig{}}, Benchmark: &BenchmarkConfig{MaxRate: 1000}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Benchmark.validate(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Benchmark.Precision != tt.wantPrecision {
+				t.Errorf("expected precision %d, got %d", tt.wantPrecision, tt.config.Benchmark.Precision)
+			}
+		})
+	}
+}
+
+func TestSearchMaxRate(t *testing.T) {
+
+	sustainable := func(max int) func(rate int) (Report, error) {
+		return func(rate int) (Report, error) {
+			if rate > max {
+				return Report{LostCount: rate - max}, errors.New("too many lost events")
+			}
+			return Report{}, nil
+		}
+	}
+	rates := func(r BenchmarkReport) []int {
+		var rates []int
+		for _, s := range r.Steps {
+			rates = append(rates, s.Rate)
+		}
+		return rates
+	}
+
+	tests := []struct {
+		name        string
+		config      BenchmarkConfig
+		start       int
+		run         func(rate int) (Report, error)
+		wantMax     int
+		wantLimit   int
+		wantRates   []int
+		wantSymptom string
+	}{
+		{
+			name:        "binary search",
+			config:      BenchmarkConfig{MaxRate: 10000, Precision: 5},
+			start:       100,
+			run:         sustainable(370),
+			wantMax:     362,
+			wantLimit:   375,
+			wantRates:   []int{100, 200, 400, 300, 350, 375, 362},
+			wantSymptom: "too many lost events",
+		},
+		{
+			name:      "max rate sustained",
+			config:    BenchmarkConfig{MaxRate: 300, Precision: 5},
+			start:     100,
+			run:       sustainable(1000),
+			wantMax:   300,
+			wantRates: []int{100, 200, 300},
+		},
+		{
+			name:        "initial rate not sustained",
+			config:      BenchmarkConfig{MaxRate: 1000, Precision: 5},
+			start:       100,
+			run:         sustainable(50),
+			wantLimit:   100,
+			wantRates:   []int{100},
+			wantSymptom: "too many lost events",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := searchMaxRate(context.Background(), &tt.config, tt.start, tt.run)
+			if r.MaxSustainableRate != tt.wantMax || r.LimitingRate != tt.wantLimit || r.LimitingSymptom != tt.wantSymptom {
+				t.Errorf("expected max %d limited at %d by %q, got %d limited at %d by %q", tt.wantMax, tt.wantLimit, tt.wantSymptom, r.MaxSustainableRate, r.LimitingRate, r.LimitingSymptom)
+			}
+			if diff := cmp.Diff(tt.wantRates, rates(r)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestSearchMaxRateCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := searchMaxRate(ctx, &BenchmarkConfig{MaxRate: 10000, Precision: 5}, 100, func(rate int) (Report, error) {
+		cancel()
+		return Report{}, nil
+	})
+	if len(r.Steps) != 1 || r.MaxSustainableRate != 100 {
+		t.Errorf("expected the search to stop after the first step, got %+v", r)
+	}
+}
+
+func TestWriteBenchmarkReport(t *testing.T) {
+
+	report := Report{Benchmark: &BenchmarkReport{
+		MaxSustainableRate: 362,
+		LimitingRate:       375,
+		LimitingSymptom:    "too many lost events",
+		Steps:              []BenchmarkStep{{Rate: 362, Passed: true}, {Rate: 375, Error: "too many lost events"}},
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := writeHTMLReport(buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{"<h2>Benchmark</h2>", "Maximum sustainable rate: 362 events/s", "limited at 375 events/s by: too many lost events", "<td>375</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected HTML report to contain %q", want)
+		}
+	}
+}
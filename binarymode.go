@@ -0,0 +1,112 @@
+package sacura
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+)
+
+// traceHeaders are propagated by protocol bindings other than HTTP in properties of the same name, they are not event
+// attributes.
+var traceHeaders = []string{"traceparent", "tracestate"}
+
+// binaryAttributes returns the attributes of the given event except datacontenttype formatted as strings and sorted by
+// name, as carried by the binary content mode of protocol bindings other than HTTP.
+func binaryAttributes(e *ce.Event) ([][2]string, error) {
+	attributes := map[string]interface{}{
+		"specversion": e.SpecVersion(),
+		"id":          e.ID(),
+		"source":      e.Source(),
+		"type":        e.Type(),
+	}
+	if v := e.Subject(); v != "" {
+		attributes["subject"] = v
+	}
+	if v := e.DataSchema(); v != "" {
+		attributes["dataschema"] = v
+	}
+	if v := e.Time(); !v.IsZero() {
+		attributes["time"] = types.Timestamp{Time: v}
+	}
+	for k, v := range e.Extensions() {
+		attributes[k] = v
+	}
+
+	formatted := make([][2]string, 0, len(attributes))
+	for name, v := range attributes {
+		s, err := types.Format(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attribute %s: %w", name, err)
+		}
+		formatted = append(formatted, [2]string{name, s})
+	}
+	sort.Slice(formatted, func(i, j int) bool { return formatted[i][0] < formatted[j][0] })
+	return formatted, nil
+}
+
+// setBinaryAttribute sets the attribute of the given event formatted as a string, trace headers and names which aren't
+// valid attribute names are ignored.
+func setBinaryAttribute(e *ce.Event, name, v string) error {
+	switch name {
+	case "specversion":
+		e.SetSpecVersion(v)
+	case "id":
+		e.SetID(v)
+	case "source":
+		e.SetSource(v)
+	case "type":
+		e.SetType(v)
+	case "subject":
+		e.SetSubject(v)
+	case "dataschema":
+		e.SetDataSchema(v)
+	case "time":
+		t, err := types.ParseTime(v)
+		if err != nil {
+			return fmt.Errorf("invalid attribute time: %w", err)
+		}
+		e.SetTime(t)
+	case "traceparent", "tracestate":
+	default:
+		if isValidExtensionName(name) {
+			e.SetExtension(name, v)
+		}
+	}
+	return nil
+}
+
+// setBinaryData sets the data of the given event carried as is with the given content type.
+func setBinaryData(e *ce.Event, contentType string, data []byte) {
+	if contentType != "" {
+		e.SetDataContentType(contentType)
+	}
+	if len(data) > 0 {
+		e.DataEncoded = data
+		e.DataBase64 = !isTextDataContentType(contentType)
+	}
+}
+
+// isTextDataContentType returns whether data with the given content type is text, like JSON.
+func isTextDataContentType(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	return ct == "" || strings.HasPrefix(ct, "text/") || strings.HasSuffix(strings.SplitN(ct, ";", 2)[0], "json")
+}
+
+// acceptedResponse is the response of transports of protocol bindings other than HTTP to requests whose event has been
+// accepted by the broker.
+func acceptedResponse(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
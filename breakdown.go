@@ -0,0 +1,126 @@
+package sacura
+
+import (
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// AttributeGroupReport reports the events sent with a value of the type or source attribute.
+type AttributeGroupReport struct {
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// LostCount is the number of events never received, like the LostCount of the report.
+	LostCount int `json:"lostCount"`
+	// DuplicateCount is the number of redeliveries of the events, like the DuplicateCount of the report.
+	DuplicateCount int          `json:"duplicateCount"`
+	Latency        LatencyStats `json:"latency"`
+}
+
+// attributeGroup is the type and source of sent events.
+type attributeGroup struct {
+	eventType string
+	source    string
+}
+
+// attributeGroupsState tracks the type and source of sent events, since triggers often filter on them and failures
+// are frequently type-specific.
+type attributeGroupsState struct {
+	groups  []attributeGroup
+	indexes map[attributeGroup]int
+	// byID is the index of the group of each sent event.
+	byID map[string]int
+}
+
+func newAttributeGroupsState() *attributeGroupsState {
+	return &attributeGroupsState{indexes: make(map[attributeGroup]int), byID: make(map[string]int)}
+}
+
+// recordSentAttributeGroup records the type and source of the given sent event, it must be called while holding the
+// lock.
+func (s *StateManager) recordSentAttributeGroup(e *ce.Event) {
+	g := attributeGroup{eventType: e.Type(), source: e.Source()}
+	i, ok := s.attributeGroups.indexes[g]
+	if !ok {
+		i = len(s.attributeGroups.groups)
+		s.attributeGroups.groups = append(s.attributeGroups.groups, g)
+		s.attributeGroups.indexes[g] = i
+	}
+	s.attributeGroups.byID[e.ID()] = i
+}
+
+// attributeGroupsReport breaks the results of the report down by event type and by source when events have been sent
+// with several types or sources, it must be called while holding the lock. It is only reported with the full
+// verification mode.
+func (s *StateManager) attributeGroupsReport(r *Report, lost sets.String) {
+	types := sets.NewString()
+	sources := sets.NewString()
+	for _, g := range s.attributeGroups.groups {
+		types.Insert(g.eventType)
+		sources.Insert(g.source)
+	}
+	if types.Len() <= 1 && sources.Len() <= 1 {
+		return
+	}
+
+	duplicates := make(map[string]int)
+	for _, ids := range r.DuplicateEventsByPartitionKey {
+		for _, id := range ids {
+			duplicates[id]++
+		}
+	}
+	byType := make(map[string]*attributeGroupStats, types.Len())
+	bySource := make(map[string]*attributeGroupStats, sources.Len())
+	for id, i := range s.attributeGroups.byID {
+		sentAt, ok := s.sentAt[id]
+		if !ok {
+			continue
+		}
+		g := s.attributeGroups.groups[i]
+		for _, stats := range []*attributeGroupStats{groupStats(byType, g.eventType), groupStats(bySource, g.source)} {
+			stats.sent++
+			if lost.Has(id) {
+				stats.lost++
+			}
+			stats.duplicates += duplicates[id]
+			if receivedAt, ok := s.receivedAt[id]; ok {
+				stats.received++
+				if !sentAt.IsZero() {
+					stats.latencies = append(stats.latencies, receivedAt.Sub(sentAt))
+				}
+			}
+		}
+	}
+	r.ByEventType = attributeGroupReports(byType)
+	r.BySource = attributeGroupReports(bySource)
+}
+
+type attributeGroupStats struct {
+	sent       int
+	received   int
+	lost       int
+	duplicates int
+	latencies  []time.Duration
+}
+
+func groupStats(stats map[string]*attributeGroupStats, key string) *attributeGroupStats {
+	if _, ok := stats[key]; !ok {
+		stats[key] = &attributeGroupStats{}
+	}
+	return stats[key]
+}
+
+func attributeGroupReports(stats map[string]*attributeGroupStats) map[string]AttributeGroupReport {
+	reports := make(map[string]AttributeGroupReport, len(stats))
+	for key, s := range stats {
+		reports[key] = AttributeGroupReport{
+			SentCount:      s.sent,
+			ReceivedCount:  s.received,
+			LostCount:      s.lost,
+			DuplicateCount: s.duplicates,
+			Latency:        NewLatencyStats(s.latencies),
+		}
+	}
+	return reports
+}
@@ -0,0 +1,77 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAttributeGroupsReport(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+
+	now := time.Now()
+	event := func(id, eventType, source string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetType(eventType)
+		e.SetSource(source)
+		setSentTimestamp(&e, now)
+		return e
+	}
+	sent := []ce.Event{
+		event("1", "order.created", "shop"),
+		event("2", "order.created", "shop"),
+		event("3", "order.paid", "shop"),
+		event("4", "order.paid", "billing"),
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(10 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(20 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[2], ReceivedAt: now.Add(30 * time.Millisecond)})
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	counts := func(reports map[string]AttributeGroupReport) map[string][4]int {
+		got := make(map[string][4]int, len(reports))
+		for k, r := range reports {
+			got[k] = [4]int{r.SentCount, r.ReceivedCount, r.LostCount, r.DuplicateCount}
+		}
+		return got
+	}
+	wantTypes := map[string][4]int{
+		"order.created": {2, 1, 1, 1},
+		"order.paid":    {2, 1, 1, 0},
+	}
+	if diff := cmp.Diff(wantTypes, counts(report.ByEventType)); diff != "" {
+		t.Error("types (-want, +got)", diff)
+	}
+	wantSources := map[string][4]int{
+		"shop":    {3, 2, 1, 1},
+		"billing": {1, 0, 1, 0},
+	}
+	if diff := cmp.Diff(wantSources, counts(report.BySource)); diff != "" {
+		t.Error("sources (-want, +got)", diff)
+	}
+	if got := report.ByEventType["order.paid"].Latency.Max; got != 30*time.Millisecond {
+		t.Errorf("want max latency 30ms, got %v", got)
+	}
+}
+
+func TestAttributeGroupsReportSingleGroup(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	e := cetest.FullEvent()
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	if report.ByEventType != nil || report.BySource != nil {
+		t.Errorf("want no breakdown with a single type and source, got %+v %+v", report.ByEventType, report.BySource)
+	}
+}
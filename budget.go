@@ -0,0 +1,163 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// BudgetDuplicates is the name of the verification.duplicateBudget budget.
+	BudgetDuplicates = "duplicateBudget"
+	// BudgetLoss is the name of the verification.lossBudget budget.
+	BudgetLoss = "lossBudget"
+)
+
+// BudgetConfig is the number of events tolerated by the verification, for example duplicates of a broker with a known
+// small duplicate rate, the budget is exceeded when any of its limits is exceeded.
+type BudgetConfig struct {
+	// MaxCount is the maximum number of events.
+	MaxCount *int `json:"maxCount" yaml:"maxCount"`
+	// MaxPercentage is the maximum percentage of events, for example 0.01.
+	MaxPercentage *float64 `json:"maxPercentage" yaml:"maxPercentage"`
+	// PerPartitionKey are limits applying to each partition key, in addition to the limits over all events.
+	PerPartitionKey *BudgetConfig `json:"perPartitionKey" yaml:"perPartitionKey"`
+}
+
+func (c *BudgetConfig) validate(field string) error {
+	if c.MaxCount == nil && c.MaxPercentage == nil && c.PerPartitionKey == nil {
+		return invalidErr(field, errors.New("at least one of maxCount, maxPercentage or perPartitionKey must be specified"))
+	}
+	if c.MaxCount != nil && *c.MaxCount < 0 {
+		return invalidErr(field+".maxCount", errors.New("cannot be negative"))
+	}
+	if c.MaxPercentage != nil && (*c.MaxPercentage < 0 || *c.MaxPercentage > 100) {
+		return invalidErr(field+".maxPercentage", fmt.Errorf("%v must be between 0 and 100", *c.MaxPercentage))
+	}
+	if c.PerPartitionKey != nil {
+		if c.PerPartitionKey.PerPartitionKey != nil {
+			return invalidErr(field+".perPartitionKey.perPartitionKey", errors.New("cannot be nested"))
+		}
+		return c.PerPartitionKey.validate(field + ".perPartitionKey")
+	}
+	return nil
+}
+
+// BudgetViolation describes a budget exceeded by the final report.
+type BudgetViolation struct {
+	// Budget is the name of the exceeded budget, as in the config.
+	Budget string `json:"budget"`
+	// PartitionKey is the partition key exceeding the budget, it is empty when the budget is exceeded over all
+	// events.
+	PartitionKey string `json:"partitionKey,omitempty"`
+	// Limit is the name of the exceeded limit, either maxCount or maxPercentage.
+	Limit string `json:"limit"`
+	// Max is the configured value of the limit.
+	Max float64 `json:"max"`
+	// Actual is the observed number or percentage of events.
+	Actual float64 `json:"actual"`
+}
+
+// exceeded returns the violations of the given observed count of events out of total.
+func (c *BudgetConfig) exceeded(budget, partitionKey string, count, total int) []BudgetViolation {
+	var violations []BudgetViolation
+	if c.MaxCount != nil && count > *c.MaxCount {
+		violations = append(violations, BudgetViolation{Budget: budget, PartitionKey: partitionKey, Limit: "maxCount", Max: float64(*c.MaxCount), Actual: float64(count)})
+	}
+	if c.MaxPercentage != nil && total > 0 {
+		if p := 100 * float64(count) / float64(total); p > *c.MaxPercentage {
+			violations = append(violations, BudgetViolation{Budget: budget, PartitionKey: partitionKey, Limit: "maxPercentage", Max: *c.MaxPercentage, Actual: p})
+		}
+	}
+	return violations
+}
+
+// budgetsReport evaluates the configured budgets against the given report.
+func (s *StateManager) budgetsReport(r *Report) {
+	if b := s.config.Verification.DuplicateBudget; b != nil {
+		r.BudgetViolations = append(r.BudgetViolations, b.exceeded(BudgetDuplicates, "", r.DuplicateCount, r.DuplicateCount+r.ReceivedCount)...)
+		if b.PerPartitionKey != nil {
+			for _, c := range s.partitionBudgetCounts(r) {
+				r.BudgetViolations = append(r.BudgetViolations, b.PerPartitionKey.exceeded(BudgetDuplicates, c.partitionKey, c.duplicates, c.duplicates+c.received)...)
+			}
+		}
+	}
+
+	if b := s.config.Verification.LossBudget; b != nil && !s.config.Sender.Disabled {
+		// Events received by the dead-letter sink are accounted for, like in the verification.
+		lost := r.expectedCount() - r.ReceivedCount - r.DeadLetteredCount
+		if lost < 0 {
+			lost = 0
+		}
+		r.BudgetViolations = append(r.BudgetViolations, b.exceeded(BudgetLoss, "", lost, r.expectedCount())...)
+		if b.PerPartitionKey != nil {
+			for _, c := range s.partitionBudgetCounts(r) {
+				r.BudgetViolations = append(r.BudgetViolations, b.PerPartitionKey.exceeded(BudgetLoss, c.partitionKey, c.lost, c.sent)...)
+			}
+		}
+	}
+}
+
+// partitionCounts are the counts of events of a partition key the budgets are evaluated against.
+type partitionCounts struct {
+	partitionKey string
+	sent         int
+	received     int
+	duplicates   int
+	lost         int
+}
+
+// partitionBudgetCounts returns the counts of events of each partition key, sorted by partition key. The counts don't
+// depend on the lists of the report, which are truncated with sender.sequentialIds and verification.maxListedIds and
+// aren't filled in the streaming verification mode.
+func (s *StateManager) partitionBudgetCounts(r *Report) []partitionCounts {
+	var counts []partitionCounts
+	if s.streaming != nil {
+		for k, p := range s.streaming.partitions {
+			lost := p.sent - p.matched
+			if lost < 0 {
+				lost = 0
+			}
+			counts = append(counts, partitionCounts{
+				partitionKey: k,
+				sent:         p.sent,
+				received:     p.matched,
+				duplicates:   p.duplicateCount,
+				lost:         lost,
+			})
+		}
+	} else {
+		keys := sets.NewString()
+		for _, m := range []map[string][]string{r.ReceivedEventsByPartitionKey, r.DuplicateEventsByPartitionKey, r.LostEventsByPartitionKey} {
+			for k := range m {
+				keys.Insert(k)
+			}
+		}
+		for k := range r.LostEventsOmittedByPartitionKey {
+			keys.Insert(k)
+		}
+		for _, k := range keys.UnsortedList() {
+			received := len(r.ReceivedEventsByPartitionKey[k])
+			lost := len(r.LostEventsByPartitionKey[k]) + r.LostEventsOmittedByPartitionKey[k]
+			counts = append(counts, partitionCounts{
+				partitionKey: k,
+				sent:         lost + received + len(r.DeadLetteredEventsByPartitionKey[k]),
+				received:     received,
+				duplicates:   len(r.DuplicateEventsByPartitionKey[k]),
+				lost:         lost,
+			})
+		}
+	}
+	sort.Slice(counts, func(i, j int) bool { return counts[i].partitionKey < counts[j].partitionKey })
+	return counts
+}
+
+// verifyBudgets verifies the report doesn't exceed the configured budgets.
+func verifyBudgets(report Report) error {
+	if len(report.BudgetViolations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d budgets exceeded, listing violations:\n%+v", len(report.BudgetViolations), report.BudgetViolations)
+}
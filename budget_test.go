@@ -0,0 +1,227 @@
+package sacura
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+// budgetReport returns the report of 20 events sent to 2 partition keys, each event being received as many times as
+// deliveries returns.
+func budgetReport(t *testing.T, config Config, deliveries func(i int) int) Report {
+	sent := make(chan ce.Event, 20)
+	received := make(chan ReceivedEvent, 40)
+
+	sm := newTestStateManager(t, config)
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for i := 0; i < 20; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprintf("%d", i))
+		e.SetExtension(DefaultPartitionKeyExtension, fmt.Sprint(i%2))
+		sent <- e
+		for j := 0; j < deliveries(i); j++ {
+			received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+		}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 20})
+	return sm.GenerateReport()
+}
+
+func TestDuplicateBudget(t *testing.T) {
+	two := 2
+	one := 1
+	fifteen := 15.0
+
+	tests := []struct {
+		name           string
+		budget         *BudgetConfig
+		wantViolations []BudgetViolation
+		wantErr        bool
+	}{
+		{
+			name:    "no budget",
+			wantErr: true,
+		},
+		{
+			name:   "within budget",
+			budget: &BudgetConfig{MaxCount: &two, MaxPercentage: &fifteen},
+		},
+		{
+			name:           "count exceeded",
+			budget:         &BudgetConfig{MaxCount: &one},
+			wantViolations: []BudgetViolation{{Budget: BudgetDuplicates, Limit: "maxCount", Max: 1, Actual: 2}},
+			wantErr:        true,
+		},
+		{
+			name:           "partition percentage exceeded",
+			budget:         &BudgetConfig{MaxCount: &two, PerPartitionKey: &BudgetConfig{MaxPercentage: &fifteen}},
+			wantViolations: []BudgetViolation{{Budget: BudgetDuplicates, PartitionKey: "0", Limit: "maxPercentage", Max: 15, Actual: 100 * 2.0 / 12}},
+			wantErr:        true,
+		},
+	}
+
+	for _, mode := range []VerificationMode{VerificationModeFull, VerificationModeStreaming} {
+		for _, tt := range tests {
+			t.Run(string(mode)+"/"+tt.name, func(t *testing.T) {
+				config := Config{
+					DeliveryGuarantee: AtMostOnce,
+					Ordered:           &OrderedConfig{NumPartitionKeys: 2},
+					Verification:      VerificationConfig{Mode: mode, DuplicateBudget: tt.budget},
+				}
+				// Events 0 and 2 of partition key "0" are received twice.
+				report := budgetReport(t, config, func(i int) int {
+					if i == 0 || i == 2 {
+						return 2
+					}
+					return 1
+				})
+				if diff := cmp.Diff(tt.wantViolations, report.BudgetViolations); diff != "" {
+					t.Error("(-want, +got)", diff)
+				}
+				err := verify(config, report)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+				}
+				if err != nil && tt.budget != nil && !strings.Contains(err.Error(), "budgets exceeded") {
+					t.Errorf("want budgets exceeded error, got %v", err)
+				}
+			})
+		}
+	}
+}
+
+func TestLossBudget(t *testing.T) {
+	one := 1
+	five := 5.0
+	fifteen := 15.0
+
+	tests := []struct {
+		name           string
+		budget         *BudgetConfig
+		wantViolations []BudgetViolation
+		wantErr        bool
+	}{
+		{
+			name:    "no budget",
+			wantErr: true,
+		},
+		{
+			name:   "within budget",
+			budget: &BudgetConfig{MaxPercentage: &fifteen},
+		},
+		{
+			name:           "percentage exceeded",
+			budget:         &BudgetConfig{MaxPercentage: &five},
+			wantViolations: []BudgetViolation{{Budget: BudgetLoss, Limit: "maxPercentage", Max: 5, Actual: 10}},
+			wantErr:        true,
+		},
+		{
+			name:           "partition count exceeded",
+			budget:         &BudgetConfig{MaxPercentage: &fifteen, PerPartitionKey: &BudgetConfig{MaxCount: &one}},
+			wantViolations: []BudgetViolation{{Budget: BudgetLoss, PartitionKey: "1", Limit: "maxCount", Max: 1, Actual: 2}},
+			wantErr:        true,
+		},
+	}
+
+	for _, mode := range []VerificationMode{VerificationModeFull, VerificationModeStreaming} {
+		for _, tt := range tests {
+			t.Run(string(mode)+"/"+tt.name, func(t *testing.T) {
+				config := Config{
+					DeliveryGuarantee: AtLeastOnce,
+					Ordered:           &OrderedConfig{NumPartitionKeys: 2},
+					Verification:      VerificationConfig{Mode: mode, LossBudget: tt.budget},
+				}
+				// Events 1 and 3 of partition key "1" are lost.
+				report := budgetReport(t, config, func(i int) int {
+					if i == 1 || i == 3 {
+						return 0
+					}
+					return 1
+				})
+				if diff := cmp.Diff(tt.wantViolations, report.BudgetViolations); diff != "" {
+					t.Error("(-want, +got)", diff)
+				}
+				if err := verify(config, report); (err != nil) != tt.wantErr {
+					t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestLossBudgetTruncatedLostEvents(t *testing.T) {
+	four := 4
+	for _, mode := range []VerificationMode{VerificationModeFull, VerificationModeStreaming} {
+		t.Run(string(mode), func(t *testing.T) {
+			config := Config{
+				DeliveryGuarantee: AtLeastOnce,
+				Sender:            SenderConfig{SequentialIDs: true},
+				Verification: VerificationConfig{
+					Mode:         mode,
+					MaxListedIDs: 2,
+					LossBudget:   &BudgetConfig{PerPartitionKey: &BudgetConfig{MaxCount: &four}},
+				},
+			}
+			sm := newTestStateManager(t, config)
+
+			// 1 and 5 are received, 2-4 and 6-7 are lost and only 2 of them are listed.
+			sm.lock.Lock()
+			for seq := uint64(1); seq <= 7; seq++ {
+				e := cetest.FullEvent()
+				e.SetID(sequentialID("", "", seq))
+				sm.recordSent(&e)
+				if seq == 1 || seq == 5 {
+					sm.recordReceived(&ReceivedEvent{Event: e})
+				}
+			}
+			sm.lock.Unlock()
+			sm.Terminated(Metrics{AcceptedCount: 7})
+
+			want := []BudgetViolation{{Budget: BudgetLoss, PartitionKey: unknownPartitionKey, Limit: "maxCount", Max: 4, Actual: 5}}
+			if diff := cmp.Diff(want, sm.GenerateReport().BudgetViolations); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestBudgetConfigValidate(t *testing.T) {
+	one := 1
+	negative := -1
+	half := 0.5
+	tooMuch := 101.0
+
+	tests := []struct {
+		name    string
+		config  BudgetConfig
+		wantErr bool
+	}{
+		{name: "count", config: BudgetConfig{MaxCount: &one}},
+		{name: "percentage per partition key", config: BudgetConfig{PerPartitionKey: &BudgetConfig{MaxPercentage: &half}}},
+		{name: "no limit", config: BudgetConfig{}, wantErr: true},
+		{name: "negative count", config: BudgetConfig{MaxCount: &negative}, wantErr: true},
+		{name: "percentage out of range", config: BudgetConfig{MaxPercentage: &tooMuch}, wantErr: true},
+		{name: "empty per partition key", config: BudgetConfig{PerPartitionKey: &BudgetConfig{}}, wantErr: true},
+		{name: "nested per partition key", config: BudgetConfig{PerPartitionKey: &BudgetConfig{MaxCount: &one, PerPartitionKey: &BudgetConfig{MaxCount: &one}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate("verification.duplicateBudget"); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCardinalityGrowthInterval is the default interval at which partition keys are added.
+	DefaultCardinalityGrowthInterval = time.Second
+	// DefaultCardinalityMaxPartitionKeys is the default maximum number of partition keys.
+	DefaultCardinalityMaxPartitionKeys = 1000000
+)
+
+// PartitionKeyCardinalityConfig continuously grows the partition key space during the run, starting from
+// ordered.numPartitionKeys, to stress the per-key state of the broker.
+//
+// Each new key is assigned to the next event, the other events are assigned to the keys added so far with the
+// partition key strategy. The report summarizes partition keys in the partitionKeys section rather than enumerating
+// the latency and the balance of every key, keys are still listed by the sections of lost, duplicate and out of order
+// events.
+type PartitionKeyCardinalityConfig struct {
+	// GrowthInterval is the interval at which GrowthStep partition keys are added, for example 1s.
+	//
+	// Defaults to DefaultCardinalityGrowthInterval.
+	GrowthInterval string `json:"growthInterval" yaml:"growthInterval"`
+	// GrowthStep is the number of partition keys added every GrowthInterval.
+	//
+	// Defaults to 1.
+	GrowthStep int `json:"growthStep" yaml:"growthStep"`
+	// MaxPartitionKeys is the number of partition keys after which the key space stops growing.
+	//
+	// Defaults to DefaultCardinalityMaxPartitionKeys.
+	MaxPartitionKeys int `json:"maxPartitionKeys" yaml:"maxPartitionKeys"`
+
+	ParsedGrowthInterval time.Duration
+}
+
+func (c *PartitionKeyCardinalityConfig) validate(ordered *OrderedConfig) error {
+	if ordered.PartitionKeyStrategy != PartitionKeyStrategyRandom && ordered.PartitionKeyStrategy != PartitionKeyStrategyRoundRobin {
+		return invalidErr("ordered.cardinality", fmt.Errorf("is only supported with the %s and %s partition key strategies", PartitionKeyStrategyRandom, PartitionKeyStrategyRoundRobin))
+	}
+	if ordered.IndependentSenders {
+		return invalidErr("ordered.cardinality", errors.New("cannot be used with ordered.independentSenders"))
+	}
+	c.ParsedGrowthInterval = DefaultCardinalityGrowthInterval
+	if c.GrowthInterval != "" {
+		var err error
+		c.ParsedGrowthInterval, err = time.ParseDuration(c.GrowthInterval)
+		if err != nil {
+			return invalidErr("ordered.cardinality.growthInterval", err)
+		}
+		if c.ParsedGrowthInterval <= 0 {
+			return invalidErr("ordered.cardinality.growthInterval", fmt.Errorf("%v must be positive", c.ParsedGrowthInterval))
+		}
+	}
+	if c.GrowthStep < 0 {
+		return invalidErr("ordered.cardinality.growthStep", fmt.Errorf("%d cannot be negative", c.GrowthStep))
+	}
+	if c.GrowthStep == 0 {
+		c.GrowthStep = 1
+	}
+	if c.MaxPartitionKeys == 0 {
+		c.MaxPartitionKeys = DefaultCardinalityMaxPartitionKeys
+	}
+	if c.MaxPartitionKeys < int(ordered.NumPartitionKeys) {
+		return invalidErr("ordered.cardinality.maxPartitionKeys", fmt.Errorf("%d must be at least ordered.numPartitionKeys %d", c.MaxPartitionKeys, ordered.NumPartitionKeys))
+	}
+	return nil
+}
+
+// partitionKeyCount returns the number of partition keys after the given time since the start of the run.
+func (c *PartitionKeyCardinalityConfig) partitionKeyCount(initial uint64, elapsed time.Duration) uint64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	n := initial + uint64(c.GrowthStep)*uint64(elapsed/c.ParsedGrowthInterval)
+	if n > uint64(c.MaxPartitionKeys) {
+		return uint64(c.MaxPartitionKeys)
+	}
+	return n
+}
+
+// newGrowingPartitionKeyGenerator returns a function returning the partition key of the next event from a key space
+// growing since the given time, it is safe for concurrent use.
+func newGrowingPartitionKeyGenerator(config *OrderedConfig, r *rand.Rand, start time.Time, now func() time.Time) func() string {
+	var lock sync.Mutex
+	introduced := uint64(0)
+	next := uint64(0)
+	return func() string {
+		lock.Lock()
+		defer lock.Unlock()
+
+		n := config.Cardinality.partitionKeyCount(uint64(config.NumPartitionKeys), now().Sub(start))
+		if introduced < n {
+			// New keys are introduced as soon as they join the key space.
+			introduced++
+			return config.partitionKey(introduced - 1)
+		}
+		if config.PartitionKeyStrategy == PartitionKeyStrategyRoundRobin {
+			pk := next % n
+			next = pk + 1
+			return config.partitionKey(pk)
+		}
+		return config.partitionKey(uint64(r.Int63n(int64(n))))
+	}
+}
+
+// PartitionKeysSummary summarizes the partition keys of a run with ordered.cardinality.
+type PartitionKeysSummary struct {
+	// SentKeyCount and ReceivedKeyCount are the number of partition keys of sent and received events.
+	SentKeyCount     int `json:"sentKeyCount"`
+	ReceivedKeyCount int `json:"receivedKeyCount"`
+	// MinEventsPerKey, MaxEventsPerKey and MeanEventsPerKey are the distribution of sent events across keys.
+	MinEventsPerKey  int     `json:"minEventsPerKey"`
+	MaxEventsPerKey  int     `json:"maxEventsPerKey"`
+	MeanEventsPerKey float64 `json:"meanEventsPerKey"`
+	// LostKeyCount, DuplicateKeyCount and OrderingViolationKeyCount are the number of keys with at least one lost
+	// event, duplicate or ordering violation.
+	LostKeyCount              int `json:"lostKeyCount"`
+	DuplicateKeyCount         int `json:"duplicateKeyCount"`
+	OrderingViolationKeyCount int `json:"orderingViolationKeyCount"`
+}
+
+// highCardinality returns whether partition keys are summarized rather than enumerated.
+func (s *StateManager) highCardinality() bool {
+	return s.config.Ordered != nil && s.config.Ordered.Cardinality != nil
+}
+
+// partitionKeysSummaryReport sets the partition keys summary of the report and drops the sections enumerating every
+// partition key, it must be called while holding the lock and after the events of each key have been reported.
+func (s *StateManager) partitionKeysSummaryReport(r *Report) {
+	if !s.highCardinality() {
+		return
+	}
+	summary := &PartitionKeysSummary{
+		LostKeyCount:              len(r.LostEventsByPartitionKey),
+		DuplicateKeyCount:         len(r.DuplicateEventsByPartitionKey),
+		OrderingViolationKeyCount: len(r.OrderingViolationsByPartitionKey),
+	}
+	total := 0
+	add := func(sent, received int) {
+		if received > 0 {
+			summary.ReceivedKeyCount++
+		}
+		if sent == 0 {
+			return
+		}
+		if summary.SentKeyCount == 0 || sent < summary.MinEventsPerKey {
+			summary.MinEventsPerKey = sent
+		}
+		if sent > summary.MaxEventsPerKey {
+			summary.MaxEventsPerKey = sent
+		}
+		summary.SentKeyCount++
+		total += sent
+	}
+	if s.streaming != nil {
+		for _, p := range s.streaming.partitions {
+			add(p.sent, p.matched)
+		}
+	} else {
+		for k, ids := range s.sent {
+			add(len(ids), len(r.ReceivedEventsByPartitionKey[k]))
+		}
+	}
+	if summary.SentKeyCount > 0 {
+		summary.MeanEventsPerKey = float64(total) / float64(summary.SentKeyCount)
+	}
+	r.PartitionKeys = summary
+	r.LatencyByPartitionKey = nil
+	r.PartitionBalance = nil
+}
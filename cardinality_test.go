@@ -0,0 +1,138 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPartitionKeyCardinalityConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PartitionKeyCardinalityConfig
+		ordered OrderedConfig
+		want    PartitionKeyCardinalityConfig
+		wantErr bool
+	}{
+		{
+			name:    "defaults",
+			ordered: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyRandom},
+			want:    PartitionKeyCardinalityConfig{GrowthStep: 1, MaxPartitionKeys: DefaultCardinalityMaxPartitionKeys, ParsedGrowthInterval: DefaultCardinalityGrowthInterval},
+		},
+		{
+			name:    "custom",
+			config:  PartitionKeyCardinalityConfig{GrowthInterval: "100ms", GrowthStep: 10, MaxPartitionKeys: 5000},
+			ordered: OrderedConfig{NumPartitionKeys: 1, PartitionKeyStrategy: PartitionKeyStrategyRoundRobin},
+			want:    PartitionKeyCardinalityConfig{GrowthInterval: "100ms", GrowthStep: 10, MaxPartitionKeys: 5000, ParsedGrowthInterval: 100 * time.Millisecond},
+		},
+		{
+			name:    "zipf",
+			ordered: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyZipf},
+			wantErr: true,
+		},
+		{
+			name:    "independent senders",
+			ordered: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyRandom, IndependentSenders: true},
+			wantErr: true,
+		},
+		{
+			name:    "invalid growth interval",
+			config:  PartitionKeyCardinalityConfig{GrowthInterval: "0s"},
+			ordered: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyRandom},
+			wantErr: true,
+		},
+		{
+			name:    "max partition keys less than the initial keys",
+			config:  PartitionKeyCardinalityConfig{MaxPartitionKeys: 5},
+			ordered: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyRandom},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.ordered)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestGrowingPartitionKeyGenerator(t *testing.T) {
+	config := &OrderedConfig{
+		NumPartitionKeys:     2,
+		PartitionKeyStrategy: PartitionKeyStrategyRoundRobin,
+		PartitionKeyFormat:   "key-%d",
+		Cardinality:          &PartitionKeyCardinalityConfig{GrowthStep: 2, MaxPartitionKeys: 5},
+	}
+	if err := config.Cardinality.validate(config); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Unix(100, 0)
+	now := start
+	next := newGrowingPartitionKeyGenerator(config, newRand(nil, "partitionKeys"), start, func() time.Time { return now })
+
+	var keys []string
+	for _, elapsed := range []time.Duration{0, 0, 0, 0, time.Second, time.Second, time.Second, 10 * time.Second, 10 * time.Second} {
+		now = start.Add(elapsed)
+		keys = append(keys, next())
+	}
+	// New keys first, then round-robin across the keys so far.
+	want := []string{"key-0", "key-1", "key-0", "key-1", "key-2", "key-3", "key-2", "key-4", "key-3"}
+	if diff := cmp.Diff(want, keys); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStateManagerPartitionKeysSummary(t *testing.T) {
+	config := Config{Ordered: &OrderedConfig{NumPartitionKeys: 1, Cardinality: &PartitionKeyCardinalityConfig{}}}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	event := func(id, pk string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, pk)
+		setSentTimestamp(&e, now)
+		return e
+	}
+	sent := []ce.Event{event("a-1", "a"), event("a-2", "a"), event("a-3", "a"), event("b-1", "b"), event("c-1", "c"), event("c-2", "c")}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	for _, i := range []int{0, 1, 2, 3, 3} {
+		sm.recordReceived(&ReceivedEvent{Event: sent[i], ReceivedAt: now.Add(time.Millisecond)})
+	}
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	want := &PartitionKeysSummary{
+		SentKeyCount:      3,
+		ReceivedKeyCount:  2,
+		MinEventsPerKey:   1,
+		MaxEventsPerKey:   3,
+		MeanEventsPerKey:  2,
+		LostKeyCount:      1,
+		DuplicateKeyCount: 1,
+	}
+	if diff := cmp.Diff(want, report.PartitionKeys); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.LatencyByPartitionKey != nil || report.PartitionBalance != nil {
+		t.Errorf("want partition keys not enumerated, got %v and %v", report.LatencyByPartitionKey, report.PartitionBalance)
+	}
+	if report.Latency.Count != 4 {
+		t.Errorf("want the latency of 4 events, got %+v", report.Latency)
+	}
+}
@@ -0,0 +1,35 @@
+package sacura
+
+import (
+	"fmt"
+
+	cesql "github.com/cloudevents/sdk-go/sql/v2"
+	cesqlparser "github.com/cloudevents/sdk-go/sql/v2/parser"
+	cesqlutils "github.com/cloudevents/sdk-go/sql/v2/utils"
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// parseCESQL parses the given CloudEvents SQL v1 expression.
+//
+// The parser panics on some incomplete expressions, like "type =", the panic is returned as an error.
+func parseCESQL(expression string) (parsed cesql.Expression, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			parsed, err = nil, fmt.Errorf("syntax error: %v", r)
+		}
+	}()
+	return cesqlparser.Parse(expression)
+}
+
+// evalCESQL evaluates the given expression on the event, casting its result to a boolean.
+func evalCESQL(expression cesql.Expression, e *ce.Event) (bool, error) {
+	v, err := expression.Evaluate(*e)
+	if err != nil {
+		return false, err
+	}
+	b, err := cesqlutils.Cast(v, cesql.BooleanType)
+	if err != nil {
+		return false, err
+	}
+	return b.(bool), nil
+}
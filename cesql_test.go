@@ -0,0 +1,147 @@
+package sacura
+
+import (
+	"testing"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestCESQL(t *testing.T) {
+
+	event := cetest.FullEvent()
+	event.SetType("dev.sacura.order.created")
+	event.SetSource("sensor/1")
+	event.SetExtension("region", "eu")
+	event.SetExtension("priority", 5)
+	event.SetSubject("café.created")
+
+	tests := []struct {
+		name       string
+		expression string
+		want       bool
+		wantErr    bool
+	}{
+		{
+			name:       "equal",
+			expression: "type = 'dev.sacura.order.created' AND source LIKE 'sensor/%'",
+			want:       true,
+		},
+		{
+			name:       "not equal",
+			expression: `type <> "dev.sacura.order.created"`,
+		},
+		{
+			name:       "like single character",
+			expression: "source LIKE 'sensor/_'",
+			want:       true,
+		},
+		{
+			name:       "like multi-byte characters",
+			expression: "subject LIKE 'café%' AND subject LIKE '_afé.created'",
+			want:       true,
+		},
+		{
+			name:       "not like",
+			expression: "source NOT LIKE 'sensor/%'",
+		},
+		{
+			name:       "like escaped wildcard",
+			expression: "source LIKE 'sensor\\%'",
+		},
+		{
+			name:       "integer comparison",
+			expression: "priority >= 5 and priority < 10",
+			want:       true,
+		},
+		{
+			name:       "in",
+			expression: "region IN ('us', 'eu')",
+			want:       true,
+		},
+		{
+			name:       "not in",
+			expression: "region NOT IN ('us', 'eu')",
+		},
+		{
+			name:       "exists",
+			expression: "EXISTS region AND NOT EXISTS tenant",
+			want:       true,
+		},
+		{
+			name:       "same precedence",
+			expression: "region = 'us' AND type = 'a' OR region = 'eu'",
+		},
+		{
+			name:       "parentheses",
+			expression: "(region = 'us' AND type = 'a') OR region = 'eu'",
+			want:       true,
+		},
+		{
+			name:       "xor",
+			expression: "region = 'eu' XOR priority = 5",
+		},
+		{
+			name:       "function",
+			expression: "UPPER(region) = 'EU' AND LENGTH(type) = 24",
+			want:       true,
+		},
+		{
+			name:       "boolean literal",
+			expression: "TRUE",
+			want:       true,
+		},
+		{
+			name:       "missing attribute",
+			expression: "tenant = 'a'",
+			wantErr:    true,
+		},
+		{
+			name:       "missing attribute not short-circuited",
+			expression: "EXISTS tenant AND tenant = 'a'",
+			wantErr:    true,
+		},
+		{
+			name:       "not an integer",
+			expression: "region > 1",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expression, err := parseCESQL(tt.expression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := evalCESQL(expression, &event)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCESQLInvalid(t *testing.T) {
+
+	for _, expression := range []string{
+		"",
+		"type =",
+		"type = 'a",
+		"(type = 'a'",
+		"type = 'a' AND",
+		"source LIKE 1",
+		"region IN ('a' 'b')",
+		"EXISTS",
+		"type == 'a'",
+		"upper(type) = ",
+	} {
+		t.Run(expression, func(t *testing.T) {
+			if _, err := parseCESQL(expression); err == nil {
+				t.Errorf("expected an error parsing %q", expression)
+			}
+		})
+	}
+}
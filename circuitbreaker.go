@@ -0,0 +1,288 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultCircuitBreakerFailureThreshold is the default number of consecutive failed requests after which the
+	// circuit of a target opens.
+	DefaultCircuitBreakerFailureThreshold = 5
+	// DefaultCircuitBreakerOpenDuration is the default time the circuit of a target stays open before probing it.
+	DefaultCircuitBreakerOpenDuration = 10 * time.Second
+	// DefaultCircuitBreakerHalfOpenProbes is the default number of concurrent probe requests of a half-open circuit.
+	DefaultCircuitBreakerHalfOpenProbes = 1
+)
+
+// CircuitState is the state of the circuit breaker of a target.
+type CircuitState string
+
+const (
+	// CircuitClosed lets requests through.
+	CircuitClosed CircuitState = "closed"
+	// CircuitOpen rejects requests without sending them.
+	CircuitOpen CircuitState = "open"
+	// CircuitHalfOpen lets a limited number of probe requests through, the circuit closes when a probe succeeds and
+	// opens again when a probe fails.
+	CircuitHalfOpen CircuitState = "halfOpen"
+)
+
+// errCircuitOpen is the error of requests rejected by an open circuit, errorClass maps it to ErrorClassCircuitOpen.
+var errCircuitOpen = errors.New("circuit breaker open")
+
+// CircuitBreakerConfig stops sending to a target after consecutive failed requests, so that a failing broker isn't
+// hammered while it recovers, and the state transitions of each target are reported in the sender metrics to
+// correlate broker outages with gaps in the sent events.
+//
+// Requests fail with a transport error or a 5xx status code, requests rejected by an open circuit are reported as
+// not sent with the ErrorClassCircuitOpen error class. With sender.retry, rejected requests are retried.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the number of consecutive failed requests to a target after which its circuit opens.
+	//
+	// Defaults to DefaultCircuitBreakerFailureThreshold.
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// OpenDuration is the time a circuit stays open before letting probe requests through, for example 10s.
+	//
+	// Defaults to DefaultCircuitBreakerOpenDuration.
+	OpenDuration string `json:"openDuration" yaml:"openDuration"`
+	// HalfOpenProbes is the number of concurrent probe requests of a half-open circuit, the other requests are
+	// rejected.
+	//
+	// Defaults to DefaultCircuitBreakerHalfOpenProbes.
+	HalfOpenProbes int `json:"halfOpenProbes" yaml:"halfOpenProbes"`
+
+	ParsedOpenDuration time.Duration
+}
+
+func (c *CircuitBreakerConfig) validate() error {
+	if c.FailureThreshold < 0 {
+		return invalidErr("sender.circuitBreaker.failureThreshold", fmt.Errorf("%d cannot be negative", c.FailureThreshold))
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultCircuitBreakerFailureThreshold
+	}
+	if c.HalfOpenProbes < 0 {
+		return invalidErr("sender.circuitBreaker.halfOpenProbes", fmt.Errorf("%d cannot be negative", c.HalfOpenProbes))
+	}
+	if c.HalfOpenProbes == 0 {
+		c.HalfOpenProbes = DefaultCircuitBreakerHalfOpenProbes
+	}
+	c.ParsedOpenDuration = DefaultCircuitBreakerOpenDuration
+	if c.OpenDuration != "" {
+		var err error
+		c.ParsedOpenDuration, err = time.ParseDuration(c.OpenDuration)
+		if err != nil {
+			return invalidErr("sender.circuitBreaker.openDuration", err)
+		}
+		if c.ParsedOpenDuration <= 0 {
+			return invalidErr("sender.circuitBreaker.openDuration", fmt.Errorf("%v must be positive", c.ParsedOpenDuration))
+		}
+	}
+	return nil
+}
+
+// CircuitBreakerMetrics reports the state transitions of the circuit breakers of the targets.
+type CircuitBreakerMetrics struct {
+	// RejectedCount is the number of requests rejected by open circuits, including retried attempts.
+	RejectedCount int `json:"rejectedCount"`
+	// OpenCount is the number of times a circuit opened.
+	OpenCount int `json:"openCount"`
+	// OpenDuration is the time circuits have been open or half-open, summed across targets.
+	OpenDuration time.Duration `json:"openDuration"`
+	// Transitions are the state transitions of every target, in time order.
+	Transitions []CircuitTransition `json:"transitions"`
+}
+
+// CircuitTransition is a state transition of the circuit breaker of a target.
+type CircuitTransition struct {
+	Target string       `json:"target"`
+	From   CircuitState `json:"from"`
+	To     CircuitState `json:"to"`
+	At     time.Time    `json:"at"`
+	// Failures is the number of consecutive failed requests that opened the circuit.
+	Failures int `json:"failures,omitempty"`
+}
+
+// circuit is the circuit breaker of a target.
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	probes   int
+}
+
+// circuitBreaker tracks the circuit of each target.
+type circuitBreaker struct {
+	config *CircuitBreakerConfig
+
+	lock     sync.Mutex
+	circuits map[string]*circuit
+	metrics  CircuitBreakerMetrics
+}
+
+func newCircuitBreaker(config *CircuitBreakerConfig) *circuitBreaker {
+	return &circuitBreaker{config: config, circuits: make(map[string]*circuit)}
+}
+
+// allow returns whether a request to the given target can be sent at the given time, probe is true when the request
+// is a probe of a half-open circuit.
+func (b *circuitBreaker) allow(target string, now time.Time) (allowed bool, probe bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuit(target)
+	if c.state == CircuitOpen && now.Sub(c.openedAt) >= b.config.ParsedOpenDuration {
+		b.transition(target, c, CircuitHalfOpen, now)
+	}
+	switch c.state {
+	case CircuitClosed:
+		return true, false
+	case CircuitHalfOpen:
+		if c.probes < b.config.HalfOpenProbes {
+			c.probes++
+			return true, true
+		}
+	}
+	b.metrics.RejectedCount++
+	return false, false
+}
+
+// observe records the outcome of a request sent to the given target at the given time.
+func (b *circuitBreaker) observe(target string, probe bool, failed bool, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c := b.circuit(target)
+	if probe {
+		c.probes--
+	}
+	// The outcome of in-flight requests sent before the circuit opened is ignored.
+	switch c.state {
+	case CircuitClosed:
+		if !failed {
+			c.failures = 0
+			return
+		}
+		c.failures++
+		if c.failures >= b.config.FailureThreshold {
+			logger(LogComponentSender).Warnw("Opening the circuit of the target", "target", target, "failures", c.failures)
+			b.open(target, c, now)
+		}
+	case CircuitHalfOpen:
+		if !probe {
+			return
+		}
+		if failed {
+			c.failures++
+			logger(LogComponentSender).Warnw("Reopening the circuit of the target, the probe failed", "target", target)
+			b.open(target, c, now)
+			return
+		}
+		logger(LogComponentSender).Infow("Closing the circuit of the target, the probe succeeded", "target", target)
+		b.metrics.OpenDuration += now.Sub(c.openedAt)
+		b.transition(target, c, CircuitClosed, now)
+		c.failures = 0
+	}
+}
+
+// release releases a probe of the given target without outcome.
+func (b *circuitBreaker) release(target string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.circuit(target).probes--
+}
+
+func (b *circuitBreaker) circuit(target string) *circuit {
+	c, ok := b.circuits[target]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[target] = c
+	}
+	return c
+}
+
+func (b *circuitBreaker) open(target string, c *circuit, now time.Time) {
+	if c.state == CircuitHalfOpen {
+		b.metrics.OpenDuration += now.Sub(c.openedAt)
+	}
+	b.transition(target, c, CircuitOpen, now)
+	b.metrics.Transitions[len(b.metrics.Transitions)-1].Failures = c.failures
+	b.metrics.OpenCount++
+	c.openedAt = now
+}
+
+func (b *circuitBreaker) transition(target string, c *circuit, to CircuitState, now time.Time) {
+	b.metrics.Transitions = append(b.metrics.Transitions, CircuitTransition{Target: target, From: c.state, To: to, At: now})
+	c.state = to
+}
+
+// report sets the circuit breaker metrics at the given time, circuits still open count as open until then.
+func (b *circuitBreaker) report(m *Metrics, now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	metrics := b.metrics
+	metrics.Transitions = append([]CircuitTransition{}, b.metrics.Transitions...)
+	for _, c := range b.circuits {
+		if c.state != CircuitClosed {
+			metrics.OpenDuration += now.Sub(c.openedAt)
+		}
+	}
+	m.CircuitBreaker = &metrics
+}
+
+// circuitBreakerTransport is an http.RoundTripper rejecting requests to targets whose circuit is open.
+type circuitBreakerTransport struct {
+	breaker *circuitBreaker
+	next    http.RoundTripper
+}
+
+func newCircuitBreakerTransport(breaker *circuitBreaker, next http.RoundTripper) *circuitBreakerTransport {
+	return &circuitBreakerTransport{breaker: breaker, next: next}
+}
+
+func (t *circuitBreakerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.URL.String()
+	allowed, probe := t.breaker.allow(target, time.Now())
+	if !allowed {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, errCircuitOpen
+	}
+	resp, err := t.next.RoundTrip(req)
+	if req.Context().Err() != nil {
+		// Requests cancelled by the end of the test say nothing about the target.
+		if probe {
+			t.breaker.release(target)
+		}
+		return resp, err
+	}
+	t.breaker.observe(target, probe, err != nil || resp.StatusCode >= http.StatusInternalServerError, time.Now())
+	return resp, err
+}
+
+// mergeCircuitBreakerMetrics merges the circuit breaker metrics of senders running concurrently.
+func mergeCircuitBreakerMetrics(a, b *CircuitBreakerMetrics) *CircuitBreakerMetrics {
+	if a == nil && b == nil {
+		return nil
+	}
+	m := &CircuitBreakerMetrics{}
+	for _, cb := range []*CircuitBreakerMetrics{a, b} {
+		if cb == nil {
+			continue
+		}
+		m.RejectedCount += cb.RejectedCount
+		m.OpenCount += cb.OpenCount
+		m.OpenDuration += cb.OpenDuration
+		m.Transitions = append(m.Transitions, cb.Transitions...)
+	}
+	sort.SliceStable(m.Transitions, func(i, j int) bool { return m.Transitions[i].At.Before(m.Transitions[j].At) })
+	return m
+}
@@ -0,0 +1,210 @@
+package sacura
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCircuitBreakerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  CircuitBreakerConfig
+		want    CircuitBreakerConfig
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			config: CircuitBreakerConfig{},
+			want: CircuitBreakerConfig{
+				FailureThreshold:   DefaultCircuitBreakerFailureThreshold,
+				HalfOpenProbes:     DefaultCircuitBreakerHalfOpenProbes,
+				ParsedOpenDuration: DefaultCircuitBreakerOpenDuration,
+			},
+		},
+		{
+			name:   "custom",
+			config: CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: "1s", HalfOpenProbes: 3},
+			want:   CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: "1s", HalfOpenProbes: 3, ParsedOpenDuration: time.Second},
+		},
+		{name: "negative failure threshold", config: CircuitBreakerConfig{FailureThreshold: -1}, wantErr: true},
+		{name: "negative probes", config: CircuitBreakerConfig{HalfOpenProbes: -1}, wantErr: true},
+		{name: "invalid open duration", config: CircuitBreakerConfig{OpenDuration: "1"}, wantErr: true},
+		{name: "zero open duration", config: CircuitBreakerConfig{OpenDuration: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	config := &CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: "10s"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	b := newCircuitBreaker(config)
+	start := time.Unix(100, 0)
+	at := func(seconds int) time.Time { return start.Add(time.Duration(seconds) * time.Second) }
+	send := func(target string, now time.Time, failed bool) bool {
+		allowed, probe := b.allow(target, now)
+		if allowed {
+			b.observe(target, probe, failed, now)
+		}
+		return allowed
+	}
+
+	// Successes reset the consecutive failures.
+	for _, failed := range []bool{true, false, true} {
+		if !send("a", at(0), failed) {
+			t.Fatal("want requests allowed by a closed circuit")
+		}
+	}
+	if !send("a", at(1), true) {
+		t.Fatal("want requests allowed by a closed circuit")
+	}
+	// The circuit of the other target stays closed.
+	if !send("b", at(2), false) {
+		t.Fatal("want requests to b allowed")
+	}
+	if send("a", at(5), false) {
+		t.Fatal("want requests rejected by an open circuit")
+	}
+	// A failed probe opens the circuit again.
+	if !send("a", at(11), true) {
+		t.Fatal("want the probe of a half-open circuit allowed")
+	}
+	if send("a", at(12), false) {
+		t.Fatal("want requests rejected by an open circuit")
+	}
+	// Concurrent requests of a half-open circuit are rejected while the probe is in flight.
+	allowed, probe := b.allow("a", at(21))
+	if !allowed || !probe {
+		t.Fatalf("want the probe of a half-open circuit allowed, got %v %v", allowed, probe)
+	}
+	if allowed, _ := b.allow("a", at(21)); allowed {
+		t.Fatal("want requests rejected while the probe is in flight")
+	}
+	b.observe("a", true, false, at(22))
+	if !send("a", at(23), true) {
+		t.Fatal("want requests allowed by a closed circuit")
+	}
+
+	m := Metrics{}
+	b.report(&m, at(30))
+	want := &CircuitBreakerMetrics{
+		RejectedCount: 3,
+		OpenCount:     2,
+		OpenDuration:  21 * time.Second,
+		Transitions: []CircuitTransition{
+			{Target: "a", From: CircuitClosed, To: CircuitOpen, At: at(1), Failures: 2},
+			{Target: "a", From: CircuitOpen, To: CircuitHalfOpen, At: at(11)},
+			{Target: "a", From: CircuitHalfOpen, To: CircuitOpen, At: at(11), Failures: 3},
+			{Target: "a", From: CircuitOpen, To: CircuitHalfOpen, At: at(21)},
+			{Target: "a", From: CircuitHalfOpen, To: CircuitClosed, At: at(22)},
+		},
+	}
+	if diff := cmp.Diff(want, m.CircuitBreaker); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestCircuitBreakerTransport(t *testing.T) {
+	var requests, failing int32 = 0, 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := &CircuitBreakerConfig{FailureThreshold: 2, OpenDuration: "50ms"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	breaker := newCircuitBreaker(config)
+	client := &http.Client{Transport: newCircuitBreakerTransport(breaker, http.DefaultTransport)}
+	post := func() (int, error) {
+		resp, err := client.Post(server.URL, "text/plain", strings.NewReader("data"))
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, err := post(); err != nil || code != http.StatusServiceUnavailable {
+			t.Fatalf("want status %d, got %d %v", http.StatusServiceUnavailable, code, err)
+		}
+	}
+	_, err := post()
+	if err == nil || errorClass(err.Error()) != ErrorClassCircuitOpen {
+		t.Fatalf("want error class %s, got %v", ErrorClassCircuitOpen, err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("want 2 requests sent to the target, got %d", n)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if code, err := post(); err != nil || code != http.StatusAccepted {
+			t.Fatalf("want status %d, got %d %v", http.StatusAccepted, code, err)
+		}
+	}
+
+	m := Metrics{}
+	breaker.report(&m, time.Now())
+	var transitions []CircuitState
+	for _, tr := range m.CircuitBreaker.Transitions {
+		if tr.Target != server.URL {
+			t.Errorf("want target %s, got %s", server.URL, tr.Target)
+		}
+		transitions = append(transitions, tr.To)
+	}
+	if diff := cmp.Diff([]CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, transitions); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if m.CircuitBreaker.RejectedCount != 1 {
+		t.Errorf("want 1 rejected request, got %d", m.CircuitBreaker.RejectedCount)
+	}
+}
+
+func TestMergeCircuitBreakerMetrics(t *testing.T) {
+	if m := mergeCircuitBreakerMetrics(nil, nil); m != nil {
+		t.Errorf("want nil, got %+v", m)
+	}
+	a := &CircuitBreakerMetrics{RejectedCount: 1, OpenCount: 1, OpenDuration: time.Second, Transitions: []CircuitTransition{
+		{Target: "a", From: CircuitClosed, To: CircuitOpen, At: time.Unix(10, 0)},
+	}}
+	b := &CircuitBreakerMetrics{RejectedCount: 2, OpenCount: 1, OpenDuration: 2 * time.Second, Transitions: []CircuitTransition{
+		{Target: "b", From: CircuitClosed, To: CircuitOpen, At: time.Unix(5, 0)},
+	}}
+	want := &CircuitBreakerMetrics{RejectedCount: 3, OpenCount: 2, OpenDuration: 3 * time.Second, Transitions: []CircuitTransition{
+		{Target: "b", From: CircuitClosed, To: CircuitOpen, At: time.Unix(5, 0)},
+		{Target: "a", From: CircuitClosed, To: CircuitOpen, At: time.Unix(10, 0)},
+	}}
+	if diff := cmp.Diff(want, mergeCircuitBreakerMetrics(a, b)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
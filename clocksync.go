@@ -0,0 +1,158 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// DefaultClockSyncSamples is the default number of round trips to the sender clock endpoint.
+	DefaultClockSyncSamples = 8
+	// DefaultClockSyncTimeout is the default maximum time waiting for the sender clock endpoint.
+	DefaultClockSyncTimeout = time.Minute
+)
+
+// ClockSyncConfig compensates the skew between the clock of the receiver and the clock of the sender when they run on
+// different nodes, receive times are recorded according to the sender clock so that latencies aren't skewed.
+type ClockSyncConfig struct {
+	// URL is the clock endpoint of the admin API of the sender, for example http://sender:9091/clock, the offset is
+	// estimated from round trips to it before the receiver starts.
+	URL string `json:"url" yaml:"url"`
+	// Samples is the number of round trips, the offset estimated from the fastest round trip is used.
+	//
+	// Defaults to DefaultClockSyncSamples.
+	Samples int `json:"samples" yaml:"samples"`
+	// Timeout is the maximum time waiting for the sender clock endpoint to be available.
+	//
+	// Defaults to DefaultClockSyncTimeout.
+	Timeout string `json:"timeout" yaml:"timeout"`
+	// Offset is the known offset of the receiver clock relative to the sender clock, for example -150ms, it is used
+	// in place of URL.
+	Offset string `json:"offset" yaml:"offset"`
+
+	ParsedTimeout time.Duration
+	ParsedOffset  time.Duration
+}
+
+// ClockSkewReport is the clock skew compensated by the receiver.
+type ClockSkewReport struct {
+	// Offset is the offset of the receiver clock relative to the sender clock, subtracted from receive times.
+	Offset time.Duration `json:"offset"`
+	// RoundTrip is the round trip time of the sample the offset has been estimated from, the estimation error is at
+	// most half of it.
+	RoundTrip time.Duration `json:"roundTrip,omitempty"`
+	// Samples is the number of round trips the offset has been estimated from, it is 0 for a configured offset.
+	Samples int `json:"samples,omitempty"`
+}
+
+func (c *ClockSyncConfig) validate() error {
+	if (c.URL == "") == (c.Offset == "") {
+		return invalidErr("receiver.clockSync", errors.New("exactly one of url or offset must be specified"))
+	}
+	var err error
+	if c.Offset != "" {
+		c.ParsedOffset, err = time.ParseDuration(c.Offset)
+		if err != nil {
+			return invalidErr("receiver.clockSync.offset", err)
+		}
+		return nil
+	}
+	if u, err := url.Parse(c.URL); err != nil || !u.IsAbs() {
+		return invalidErr("receiver.clockSync.url", fmt.Errorf("%q must be an absolute URL: %v", c.URL, err))
+	}
+	if c.Samples < 0 {
+		return invalidErr("receiver.clockSync.samples", fmt.Errorf("%d cannot be negative", c.Samples))
+	}
+	if c.Samples == 0 {
+		c.Samples = DefaultClockSyncSamples
+	}
+	c.ParsedTimeout = DefaultClockSyncTimeout
+	if c.Timeout != "" {
+		c.ParsedTimeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return invalidErr("receiver.clockSync.timeout", err)
+		}
+		if c.ParsedTimeout <= 0 {
+			return invalidErr("receiver.clockSync.timeout", fmt.Errorf("%v must be greater than 0", c.ParsedTimeout))
+		}
+	}
+	return nil
+}
+
+// clockResponse is the response of the clock endpoint of the admin API.
+type clockResponse struct {
+	// Time is the current time in nanoseconds since the Unix epoch.
+	Time int64 `json:"time"`
+}
+
+// syncClock returns the clock skew to compensate, waiting for the sender clock endpoint to be available.
+func syncClock(ctx context.Context, config *ClockSyncConfig) (ClockSkewReport, error) {
+	if config.URL == "" {
+		return ClockSkewReport{Offset: config.ParsedOffset}, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.ParsedTimeout)
+	defer cancel()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	var skew ClockSkewReport
+	var lastErr error
+	err := wait.PollImmediateUntil(100*time.Millisecond, func() (bool, error) {
+		skew, lastErr = estimateClockSkew(ctx, client, config.URL, config.Samples)
+		return lastErr == nil, nil
+	}, ctx.Done())
+	if err != nil {
+		return ClockSkewReport{}, fmt.Errorf("failed to synchronize clock with %s: %v (last error: %v)", config.URL, err, lastErr)
+	}
+	return skew, nil
+}
+
+// estimateClockSkew estimates the offset of the local clock relative to the clock of the given endpoint, assuming
+// symmetric network delays, from the fastest of the given number of round trips.
+func estimateClockSkew(ctx context.Context, client *http.Client, url string, samples int) (ClockSkewReport, error) {
+	skew := ClockSkewReport{RoundTrip: -1}
+	for i := 0; i < samples; i++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return ClockSkewReport{}, err
+		}
+		t0 := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return ClockSkewReport{}, err
+		}
+		var clock clockResponse
+		err = json.NewDecoder(resp.Body).Decode(&clock)
+		resp.Body.Close()
+		t1 := time.Now()
+		if resp.StatusCode != http.StatusOK {
+			return ClockSkewReport{}, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		if err != nil {
+			return ClockSkewReport{}, fmt.Errorf("failed to decode clock response: %w", err)
+		}
+
+		rtt := t1.Sub(t0)
+		if skew.RoundTrip < 0 || rtt < skew.RoundTrip {
+			skew.RoundTrip = rtt
+			skew.Offset = t0.Add(rtt / 2).Sub(time.Unix(0, clock.Time))
+		}
+	}
+	skew.Samples = samples
+	return skew, nil
+}
+
+// setClockSkew records the clock skew compensated by the receiver.
+func (s *StateManager) setClockSkew(skew ClockSkewReport) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.clockSkew = &skew
+}
@@ -0,0 +1,145 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClockSyncConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClockSyncConfig
+		want    ClockSyncConfig
+		wantErr bool
+	}{
+		{
+			name:   "url defaults",
+			config: ClockSyncConfig{URL: "http://sender:9091/clock"},
+			want:   ClockSyncConfig{URL: "http://sender:9091/clock", Samples: DefaultClockSyncSamples, ParsedTimeout: DefaultClockSyncTimeout},
+		},
+		{
+			name:   "offset",
+			config: ClockSyncConfig{Offset: "-150ms"},
+			want:   ClockSyncConfig{Offset: "-150ms", ParsedOffset: -150 * time.Millisecond},
+		},
+		{
+			name:    "neither url nor offset",
+			config:  ClockSyncConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "both url and offset",
+			config:  ClockSyncConfig{URL: "http://sender:9091/clock", Offset: "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "relative url",
+			config:  ClockSyncConfig{URL: "/clock"},
+			wantErr: true,
+		},
+		{
+			name:    "negative samples",
+			config:  ClockSyncConfig{URL: "http://sender:9091/clock", Samples: -1},
+			wantErr: true,
+		},
+		{
+			name:    "zero timeout",
+			config:  ClockSyncConfig{URL: "http://sender:9091/clock", Timeout: "0s"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestSyncClock(t *testing.T) {
+	// The sender clock is 2 seconds behind the receiver clock.
+	skew := 2 * time.Second
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeAdminResponse(w, http.StatusOK, clockResponse{Time: time.Now().Add(-skew).UnixNano()})
+	}))
+	defer server.Close()
+
+	config := &ClockSyncConfig{URL: server.URL, Samples: 4}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := syncClock(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Samples != 4 {
+		t.Errorf("expected 4 samples, got %d", got.Samples)
+	}
+	if diff := got.Offset - skew; diff < -got.RoundTrip || diff > got.RoundTrip {
+		t.Errorf("expected offset %v within round trip %v, got %v", skew, got.RoundTrip, got.Offset)
+	}
+}
+
+func TestSyncClockOffset(t *testing.T) {
+	config := &ClockSyncConfig{Offset: "-150ms"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := syncClock(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(ClockSkewReport{Offset: -150 * time.Millisecond}, got); diff != "" {
+		t.Errorf("(-want, +got) %s", diff)
+	}
+}
+
+func TestSyncClockTimeout(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	config := &ClockSyncConfig{URL: server.URL, Timeout: "300ms"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := syncClock(context.Background(), config); err == nil {
+		t.Error("expected error for unavailable clock endpoint")
+	}
+}
+
+func TestAdminClock(t *testing.T) {
+	server := httptest.NewServer(&adminServer{})
+	defer server.Close()
+
+	before := time.Now()
+	skew, err := estimateClockSkew(context.Background(), http.DefaultClient, server.URL+"/clock", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if skew.Offset < -time.Since(before) || skew.Offset > time.Since(before) {
+		t.Errorf("expected no offset with the local clock, got %+v", skew)
+	}
+
+	resp, err := http.Post(server.URL+"/clock", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code %d, got %d", http.StatusMethodNotAllowed, resp.StatusCode)
+	}
+}
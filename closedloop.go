@@ -0,0 +1,165 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultClosedLoopCheckInterval is the default interval at which the backlog is checked in closed-loop mode.
+const DefaultClosedLoopCheckInterval = 100 * time.Millisecond
+
+// ClosedLoopConfig holds the sender while too many sent events haven't been received yet, so that tests measure the
+// steady state of the system under test rather than the unbounded growth of its queues.
+//
+// The backlog is the number of sent events not received yet, with verification.maxDeliveryAge expired events are not
+// part of the backlog anymore, otherwise lost events are part of the backlog for the rest of the test.
+//
+// Time spent held counts towards the test duration, but not towards the rate, so the sender doesn't send a burst of
+// the events it didn't send while held.
+type ClosedLoopConfig struct {
+	// HighWaterMark is the backlog at which the sender is held.
+	HighWaterMark int64 `json:"highWaterMark" yaml:"highWaterMark"`
+	// LowWaterMark is the backlog at which the held sender resumes.
+	//
+	// Defaults to half of HighWaterMark.
+	LowWaterMark *int64 `json:"lowWaterMark" yaml:"lowWaterMark"`
+	// CheckInterval is the interval at which the backlog is checked, for example 100ms.
+	//
+	// Defaults to DefaultClosedLoopCheckInterval.
+	CheckInterval string `json:"checkInterval" yaml:"checkInterval"`
+
+	ParsedCheckInterval time.Duration
+}
+
+func (c *ClosedLoopConfig) validate(config *Config) error {
+	if c.HighWaterMark <= 0 {
+		return invalidErr("sender.closedLoop.highWaterMark", fmt.Errorf("%d must be positive", c.HighWaterMark))
+	}
+	if c.LowWaterMark == nil {
+		low := c.HighWaterMark / 2
+		c.LowWaterMark = &low
+	}
+	if *c.LowWaterMark < 0 || *c.LowWaterMark >= c.HighWaterMark {
+		return invalidErr("sender.closedLoop.lowWaterMark", fmt.Errorf("%d must be between 0 and sender.closedLoop.highWaterMark %d excluded", *c.LowWaterMark, c.HighWaterMark))
+	}
+	c.ParsedCheckInterval = DefaultClosedLoopCheckInterval
+	if c.CheckInterval != "" {
+		var err error
+		c.ParsedCheckInterval, err = time.ParseDuration(c.CheckInterval)
+		if err != nil {
+			return invalidErr("sender.closedLoop.checkInterval", err)
+		}
+		if c.ParsedCheckInterval <= 0 {
+			return invalidErr("sender.closedLoop.checkInterval", fmt.Errorf("%v must be positive", c.ParsedCheckInterval))
+		}
+	}
+	if config.Receiver.Disabled || config.Distributed != nil {
+		return invalidErr("sender.closedLoop", errors.New("the backlog is only known when the receiver is enabled and not distributed"))
+	}
+	return nil
+}
+
+// ClosedLoopMetrics reports how long the sender has been held in closed-loop mode.
+type ClosedLoopMetrics struct {
+	// HoldCount is the number of times the backlog reached the high-water mark.
+	HoldCount int `json:"holdCount"`
+	// HeldDuration is the total time the sender has been held.
+	HeldDuration time.Duration `json:"heldDuration"`
+	// MaxBacklog is the maximum backlog observed.
+	MaxBacklog int64 `json:"maxBacklog"`
+}
+
+// closedLoop is the closed-loop state of the sender control.
+type closedLoop struct {
+	held       bool
+	heldSince  time.Time
+	heldTotal  time.Duration
+	holds      int
+	maxBacklog int64
+}
+
+// regulate holds the sender when the given backlog reaches the high-water mark and releases it once the backlog is
+// back to the low-water mark.
+func (c *senderControl) regulate(backlog int64, config *ClosedLoopConfig) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if backlog > c.closedLoop.maxBacklog {
+		c.closedLoop.maxBacklog = backlog
+	}
+	switch {
+	case !c.closedLoop.held && backlog >= config.HighWaterMark:
+		logger(LogComponentSender).Infow("Backlog reached the high-water mark, holding the sender", "backlog", backlog, "highWaterMark", config.HighWaterMark)
+		c.closedLoop.held = true
+		c.closedLoop.heldSince = time.Now()
+		c.closedLoop.holds++
+	case c.closedLoop.held && backlog <= *config.LowWaterMark:
+		logger(LogComponentSender).Infow("Backlog back to the low-water mark, resuming the sender", "backlog", backlog, "lowWaterMark", *config.LowWaterMark)
+		c.release()
+		c.changed.Broadcast()
+	}
+}
+
+// release releases the held sender, it must be called while holding the lock.
+func (c *senderControl) release() {
+	if !c.closedLoop.held {
+		return
+	}
+	c.closedLoop.held = false
+	c.closedLoop.heldTotal += time.Since(c.closedLoop.heldSince)
+	c.closedLoop.heldSince = time.Time{}
+}
+
+func (c *senderControl) closedLoopMetrics(m *Metrics) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	held := c.closedLoop.heldTotal
+	if c.closedLoop.held {
+		held += time.Since(c.closedLoop.heldSince)
+	}
+	m.ClosedLoop = &ClosedLoopMetrics{HoldCount: c.closedLoop.holds, HeldDuration: held, MaxBacklog: c.closedLoop.maxBacklog}
+}
+
+// backlog returns the number of sent events not received yet, excluding expired events.
+func (s *StateManager) backlog() int64 {
+	backlog := s.sentCount.Load() - s.matchedCount.Load() - s.expiredCount.Load()
+	if backlog < 0 {
+		return 0
+	}
+	return backlog
+}
+
+// startClosedLoop periodically regulates the given sender control according to the backlog until the returned
+// function is called.
+func (s *StateManager) startClosedLoop(config *ClosedLoopConfig, control *senderControl) func() {
+	if config == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(config.ParsedCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				control.regulate(s.backlog(), config)
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
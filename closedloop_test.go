@@ -0,0 +1,109 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestClosedLoopConfigValidate(t *testing.T) {
+	low := func(n int64) *int64 { return &n }
+	tests := []struct {
+		name    string
+		config  Config
+		want    ClosedLoopConfig
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 1000}}},
+			want:   ClosedLoopConfig{HighWaterMark: 1000, LowWaterMark: low(500), ParsedCheckInterval: DefaultClosedLoopCheckInterval},
+		},
+		{
+			name:   "custom",
+			config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 1000, LowWaterMark: low(0), CheckInterval: "1s"}}},
+			want:   ClosedLoopConfig{HighWaterMark: 1000, LowWaterMark: low(0), CheckInterval: "1s", ParsedCheckInterval: time.Second},
+		},
+		{name: "no high-water mark", config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{}}}, wantErr: true},
+		{name: "low-water mark too high", config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 10, LowWaterMark: low(10)}}}, wantErr: true},
+		{name: "negative low-water mark", config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 10, LowWaterMark: low(-1)}}}, wantErr: true},
+		{name: "invalid check interval", config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 10, CheckInterval: "0s"}}}, wantErr: true},
+		{name: "receiver disabled", config: Config{Sender: SenderConfig{ClosedLoop: &ClosedLoopConfig{HighWaterMark: 10}}, Receiver: ReceiverConfig{Disabled: true}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Sender.ClosedLoop.validate(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, *tt.config.Sender.ClosedLoop); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestSenderControlRegulate(t *testing.T) {
+	low := int64(2)
+	config := &ClosedLoopConfig{HighWaterMark: 5, LowWaterMark: &low}
+	control := newSenderControl(false)
+	control.begin()
+	p := controlledPacer{pacer: vegeta.ConstantPacer{Freq: 1, Per: time.Hour}, control: control, duration: time.Hour}
+
+	control.regulate(4, config)
+	if _, _, ok := control.waitRunning(); !ok {
+		t.Fatal("expected running sender")
+	}
+
+	control.regulate(5, config)
+	paced := make(chan time.Duration, 1)
+	go func() {
+		wait, _ := p.Pace(0, 1)
+		paced <- wait
+	}()
+	select {
+	case <-paced:
+		t.Fatal("expected held sender to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Still above the low-water mark.
+	control.regulate(3, config)
+	select {
+	case <-paced:
+		t.Fatal("expected held sender to block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	control.regulate(2, config)
+	// The time spent held doesn't count towards the rate, the next hit is due an hour after the first one.
+	if wait := <-paced; wait < time.Hour-time.Second {
+		t.Errorf("expected to wait about an hour for the second hit, got %v", wait)
+	}
+
+	var m Metrics
+	control.closedLoopMetrics(&m)
+	if m.ClosedLoop.HoldCount != 1 || m.ClosedLoop.MaxBacklog != 5 || m.ClosedLoop.HeldDuration < 100*time.Millisecond {
+		t.Errorf("unexpected closed-loop metrics %+v", m.ClosedLoop)
+	}
+}
+
+func TestStateManagerBacklog(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	sm.sentCount.Add(10)
+	sm.matchedCount.Add(4)
+	sm.expiredCount.Add(2)
+	if got := sm.backlog(); got != 4 {
+		t.Errorf("want backlog 4, got %d", got)
+	}
+	sm.expiredCount.Add(10)
+	if got := sm.backlog(); got != 0 {
+		t.Errorf("want backlog 0, got %d", got)
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 
 	_ "go.uber.org/automaxprocs"
 
@@ -15,12 +18,62 @@ import (
 
 const (
 	filePathFlag = "config"
+	// overrideFlag overrides a config field, it can be repeated and wins over SACURA_ environment variables.
+	overrideFlag = "set"
+	// progressFlag shows the live progress view, it is equivalent to --set report.progress.interval=1s.
+	progressFlag = "progress"
+
+	// verifyCommand verifies the state journals of separate sender and receiver runs.
+	verifyCommand = "verify"
+	// validateCommand validates the config and prints the effective config, with defaults applied and secrets
+	// redacted, without sending any traffic.
+	validateCommand = "validate"
+	// previewCommand prints the first requests the config would send and its pacing schedule, without sending any
+	// traffic.
+	previewCommand = "preview"
+	// requestsFlag is the number of requests previewed by the preview command.
+	requestsFlag = "requests"
+	// compareCommand compares two JSON reports and fails when the second one regressed over the first one.
+	compareCommand = "compare"
+
+	// thresholdsExitCode is the exit code when the test otherwise succeeded but violated the configured thresholds.
+	thresholdsExitCode = 2
 )
 
 func main() {
 
-	path := flag.String(filePathFlag, "", "Path to the configuration file")
-	flag.Parse()
+	flags := flag.CommandLine
+	command := run
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == compareCommand {
+		// Reports are compared without a config.
+		if err := compare(args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == verifyCommand {
+		flags = flag.NewFlagSet(verifyCommand, flag.ExitOnError)
+		command = verify
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == validateCommand {
+		flags = flag.NewFlagSet(validateCommand, flag.ExitOnError)
+		command = validate
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == previewCommand {
+		flags = flag.NewFlagSet(previewCommand, flag.ExitOnError)
+		requests := flags.Int(requestsFlag, sacura.DefaultPreviewRequests, "Number of previewed requests")
+		command = func(path string, overrides []sacura.ConfigOverride, _ []string) error {
+			return preview(path, overrides, *requests)
+		}
+		args = args[1:]
+	}
+
+	path := flags.String(filePathFlag, "", "Path to the configuration file")
+	var overrides overridesFlag
+	flags.Var(&overrides, overrideFlag, "Config field override in the path=value form, for example sender.frequency=1000")
+	progress := flags.Bool(progressFlag, false, "Show a live progress view of the test")
+	_ = flags.Parse(args)
 
 	if path == nil || *path == "" {
 		log.Printf("invalid flag %s", filePathFlag)
@@ -28,37 +81,184 @@ func main() {
 		return
 	}
 
-	if err := run(*path); err != nil {
+	overrides = append(sacura.EnvConfigOverrides(os.Environ()), overrides...)
+	if *progress {
+		overrides = append(overrides, sacura.ConfigOverride{Path: "report.progress.interval", Value: sacura.DefaultProgressInterval.String()})
+	}
+
+	if err := command(*path, overrides, flags.Args()); err != nil {
+		var thresholdsErr *sacura.ThresholdsError
+		if errors.As(err, &thresholdsErr) {
+			log.Println(err)
+			// Violations are written to stdout so that they can be parsed, logs go to stderr.
+			_ = json.NewEncoder(os.Stdout).Encode(thresholdsErr)
+			os.Exit(thresholdsExitCode)
+		}
 		log.Fatal(err)
 	}
 }
 
 func usage() {
 	log.Printf(`
-sacura --%s <absolute_path_to_config_file>
-`, filePathFlag)
+sacura --%s <absolute_path_to_config_file> [--%s path=value]... [--%s]
+sacura %s --%s <absolute_path_to_config_file> [--%s path=value]... [<state_journal>...]
+sacura %s --%s <absolute_path_to_config_file> [--%s path=value]...
+sacura %s --%s <absolute_path_to_config_file> [--%s path=value]... [--%s n]
+sacura %s [--%s percentage] [--%s points] [--%s points] [--%s percentage] <baseline_report> <report>
+
+Config fields can also be overridden with %s environment variables, for example %sSENDER_FREQUENCY=1000.
+`, filePathFlag, overrideFlag, progressFlag, verifyCommand, filePathFlag, overrideFlag, validateCommand, filePathFlag, overrideFlag,
+		previewCommand, filePathFlag, overrideFlag, requestsFlag,
+		compareCommand, maxLatencyIncreaseFlag, maxLostIncreaseFlag, maxDuplicateIncreaseFlag, maxThroughputDecreaseFlag,
+		sacura.EnvConfigOverridePrefix, sacura.EnvConfigOverridePrefix)
 }
 
-func run(path string) error {
+// overridesFlag collects the overrides of repeated --set flags.
+type overridesFlag []sacura.ConfigOverride
 
-	log.Println("Reading configuration ...")
+func (f *overridesFlag) String() string {
+	return fmt.Sprint(*f)
+}
+
+func (f *overridesFlag) Set(s string) error {
+	o, err := sacura.ParseConfigOverride(s)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, o)
+	return nil
+}
+
+func run(path string, overrides []sacura.ConfigOverride, _ []string) error {
+
+	config, err := readConfig(path, overrides)
+	if err != nil {
+		return err
+	}
+
+	return sacura.Main(NewContext(), config)
+}
+
+func verify(path string, overrides []sacura.ConfigOverride, journals []string) error {
+
+	config, err := readConfig(path, overrides)
+	if err != nil {
+		return err
+	}
+
+	_, err = sacura.Verify(config, journals...)
+	return err
+}
+
+func validate(path string, overrides []sacura.ConfigOverride, _ []string) error {
+
+	config, err := readConfig(path, overrides)
+	if err != nil {
+		return err
+	}
 
+	// The effective config is written to stdout so that it can be parsed, logs go to stderr. Secrets are redacted.
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(config.Redacted())
+}
+
+func preview(path string, overrides []sacura.ConfigOverride, requests int) error {
+
+	config, err := readConfig(path, overrides)
+	if err != nil {
+		return err
+	}
+
+	p, err := sacura.Preview(config, requests)
+	if err != nil {
+		return err
+	}
+
+	// The preview is written to stdout so that it can be parsed, logs go to stderr.
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	return e.Encode(p)
+}
+
+const (
+	maxLatencyIncreaseFlag    = "max-latency-increase"
+	maxLostIncreaseFlag       = "max-lost-increase"
+	maxDuplicateIncreaseFlag  = "max-duplicate-increase"
+	maxThroughputDecreaseFlag = "max-throughput-decrease"
+)
+
+func compare(args []string) error {
+
+	flags := flag.NewFlagSet(compareCommand, flag.ExitOnError)
+	latency := flags.Float64(maxLatencyIncreaseFlag, 10, "Maximum increase of each latency percentile, in percentage of the baseline")
+	lost := flags.Float64(maxLostIncreaseFlag, 0, "Maximum increase of the percentage of lost events, in percentage points")
+	duplicates := flags.Float64(maxDuplicateIncreaseFlag, 1, "Maximum increase of the percentage of duplicates, in percentage points")
+	throughput := flags.Float64(maxThroughputDecreaseFlag, 10, "Maximum decrease of the throughput, in percentage of the baseline")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		usage()
+		return errors.New("expected a baseline report and a report to compare")
+	}
+	baseline, err := readReport(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	current, err := readReport(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	comparison := sacura.CompareReports(baseline, current, sacura.RegressionTolerances{
+		MaxLatencyIncreasePercentage:    latency,
+		MaxLostPercentageIncrease:       lost,
+		MaxDuplicatePercentageIncrease:  duplicates,
+		MaxThroughputDecreasePercentage: throughput,
+	})
+
+	// The comparison is written to stdout so that it can be parsed, logs go to stderr.
+	e := json.NewEncoder(os.Stdout)
+	e.SetIndent("", "  ")
+	if err := e.Encode(comparison); err != nil {
+		return err
+	}
+	return comparison.Err()
+}
+
+func readReport(path string) (sacura.Report, error) {
 	f, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", path, err)
+		return sacura.Report{}, fmt.Errorf("failed to open file %s: %w", path, err)
 	}
 	defer f.Close()
 
-	config, err := sacura.FileConfig(f)
+	report, err := sacura.ReadReport(f)
 	if err != nil {
-		return fmt.Errorf("failef to read config from file %s: %w", path, err)
+		return sacura.Report{}, fmt.Errorf("failed to read report from file %s: %w", path, err)
 	}
+	return report, nil
+}
 
-	return sacura.Main(NewContext(), config)
+func readConfig(path string, overrides []sacura.ConfigOverride) (sacura.Config, error) {
+
+	log.Println("Reading configuration ...")
+
+	f, err := os.Open(path)
+	if err != nil {
+		return sacura.Config{}, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer f.Close()
+
+	config, err := sacura.FileConfig(f, overrides...)
+	if err != nil {
+		return sacura.Config{}, fmt.Errorf("failef to read config from file %s: %w", path, err)
+	}
+	return config, nil
 }
 
-// NewContext creates a new context with signal handling.
+// NewContext creates a new context done on SIGINT or SIGTERM, so that the test is aborted with a partial report.
 func NewContext() context.Context {
-	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	return ctx
 }
@@ -0,0 +1,154 @@
+package sacura
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// RegressionTolerances are the regressions of a report over a baseline report tolerated by CompareReports, metrics
+// with a nil tolerance are compared but never regress.
+type RegressionTolerances struct {
+	// MaxLatencyIncreasePercentage is the maximum increase of each end-to-end latency percentile, relative to the
+	// baseline.
+	MaxLatencyIncreasePercentage *float64 `json:"maxLatencyIncreasePercentage,omitempty"`
+	// MaxLostPercentageIncrease is the maximum increase, in percentage points, of the percentage of lost events.
+	MaxLostPercentageIncrease *float64 `json:"maxLostPercentageIncrease,omitempty"`
+	// MaxDuplicatePercentageIncrease is the maximum increase, in percentage points, of the percentage of duplicates.
+	MaxDuplicatePercentageIncrease *float64 `json:"maxDuplicatePercentageIncrease,omitempty"`
+	// MaxThroughputDecreasePercentage is the maximum decrease of the rate of requests accepted by the target,
+	// relative to the baseline.
+	MaxThroughputDecreasePercentage *float64 `json:"maxThroughputDecreasePercentage,omitempty"`
+}
+
+const (
+	ComparisonLatency             = "latency"
+	ComparisonLostPercentage      = "lostPercentage"
+	ComparisonDuplicatePercentage = "duplicatePercentage"
+	ComparisonThroughput          = "throughput"
+)
+
+// MetricDelta is the change of a metric between the baseline and the current report.
+type MetricDelta struct {
+	// Metric is the name of the metric, latency percentiles are named after the percentile, for example latency.99th.
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	// Delta is Current - Baseline, in the unit of the metric, latencies are in milliseconds.
+	Delta float64 `json:"delta"`
+	// ChangePercentage is Delta relative to Baseline, it is 0 when Baseline is 0.
+	ChangePercentage float64 `json:"changePercentage"`
+}
+
+// Regression is a metric that regressed beyond its tolerance.
+type Regression struct {
+	Metric string `json:"metric"`
+	// Tolerance is the configured tolerance and Actual the observed change, in the unit of the tolerance.
+	Tolerance float64 `json:"tolerance"`
+	Actual    float64 `json:"actual"`
+}
+
+// ReportComparison is the outcome of CompareReports.
+type ReportComparison struct {
+	Latency             []MetricDelta `json:"latency"`
+	LostPercentage      MetricDelta   `json:"lostPercentage"`
+	DuplicatePercentage MetricDelta   `json:"duplicatePercentage"`
+	Throughput          MetricDelta   `json:"throughput"`
+	// Regressions are the metrics regressed beyond their tolerance, the comparison fails when there is any.
+	Regressions []Regression `json:"regressions,omitempty"`
+	Passed      bool         `json:"passed"`
+}
+
+// RegressionError is returned when a report regressed over the baseline beyond the tolerances.
+type RegressionError struct {
+	Regressions []Regression `json:"regressions"`
+}
+
+func (e *RegressionError) Error() string {
+	b, _ := json.Marshal(e.Regressions)
+	return fmt.Sprintf("%d metrics regressed: %s", len(e.Regressions), b)
+}
+
+// Err returns a *RegressionError when the comparison failed, nil otherwise.
+func (c ReportComparison) Err() error {
+	if c.Passed {
+		return nil
+	}
+	return &RegressionError{Regressions: c.Regressions}
+}
+
+// ReadReport reads a report written by the JSON report writer.
+func ReadReport(r io.Reader) (Report, error) {
+	var report Report
+	if err := json.NewDecoder(r).Decode(&report); err != nil {
+		return Report{}, fmt.Errorf("failed to decode report: %w", err)
+	}
+	return report, nil
+}
+
+// CompareReports compares the current report with the baseline report, for example the report of the previous
+// release, the comparison fails when a metric regressed beyond its tolerance.
+func CompareReports(baseline, current Report, tolerances RegressionTolerances) ReportComparison {
+	c := ReportComparison{}
+	regressed := func(d MetricDelta, tolerance *float64, actual float64) {
+		if tolerance != nil && actual > *tolerance {
+			c.Regressions = append(c.Regressions, Regression{Metric: d.Metric, Tolerance: *tolerance, Actual: actual})
+		}
+	}
+
+	for _, p := range []struct {
+		name              string
+		baseline, current float64
+	}{
+		{"50th", milliseconds(baseline.Latency.P50), milliseconds(current.Latency.P50)},
+		{"90th", milliseconds(baseline.Latency.P90), milliseconds(current.Latency.P90)},
+		{"99th", milliseconds(baseline.Latency.P99), milliseconds(current.Latency.P99)},
+		{"max", milliseconds(baseline.Latency.Max), milliseconds(current.Latency.Max)},
+	} {
+		d := newMetricDelta(ComparisonLatency+"."+p.name, p.baseline, p.current)
+		c.Latency = append(c.Latency, d)
+		if p.baseline > 0 {
+			regressed(d, tolerances.MaxLatencyIncreasePercentage, d.ChangePercentage)
+		}
+	}
+
+	c.LostPercentage = newMetricDelta(ComparisonLostPercentage, baseline.lostPercentage(), current.lostPercentage())
+	regressed(c.LostPercentage, tolerances.MaxLostPercentageIncrease, c.LostPercentage.Delta)
+
+	c.DuplicatePercentage = newMetricDelta(ComparisonDuplicatePercentage, baseline.duplicatePercentage(), current.duplicatePercentage())
+	regressed(c.DuplicatePercentage, tolerances.MaxDuplicatePercentageIncrease, c.DuplicatePercentage.Delta)
+
+	c.Throughput = newMetricDelta(ComparisonThroughput, baseline.Metrics.Metrics.Throughput, current.Metrics.Metrics.Throughput)
+	if c.Throughput.Baseline > 0 {
+		regressed(c.Throughput, tolerances.MaxThroughputDecreasePercentage, -c.Throughput.ChangePercentage)
+	}
+
+	c.Passed = len(c.Regressions) == 0
+	return c
+}
+
+func newMetricDelta(metric string, baseline, current float64) MetricDelta {
+	d := MetricDelta{Metric: metric, Baseline: baseline, Current: current, Delta: current - baseline}
+	if baseline != 0 {
+		d.ChangePercentage = 100 * d.Delta / baseline
+	}
+	return d
+}
+
+// lostPercentage is the percentage of accepted events that are neither received nor dead-lettered.
+func (r Report) lostPercentage() float64 {
+	expected := r.expectedCount()
+	lost := expected - r.ReceivedCount - r.DeadLetteredCount
+	if lost <= 0 || expected <= 0 {
+		return 0
+	}
+	return 100 * float64(lost) / float64(expected)
+}
+
+// duplicatePercentage is the percentage of duplicates over all received events.
+func (r Report) duplicatePercentage() float64 {
+	if r.ReceivedCount <= 0 {
+		return 0
+	}
+	return 100 * float64(r.DuplicateCount) / float64(r.DuplicateCount+r.ReceivedCount)
+}
@@ -0,0 +1,115 @@
+package sacura
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCompareReports(t *testing.T) {
+	ten := 10.0
+	zero := 0.0
+	tolerances := RegressionTolerances{
+		MaxLatencyIncreasePercentage:    &ten,
+		MaxLostPercentageIncrease:       &zero,
+		MaxDuplicatePercentageIncrease:  &ten,
+		MaxThroughputDecreasePercentage: &ten,
+	}
+
+	report := func(p99 time.Duration, lost, duplicates int, throughput float64) Report {
+		return Report{
+			ReceivedCount:  100 - lost,
+			DuplicateCount: duplicates,
+			Latency:        LatencyStats{Count: 100 - lost, P50: 10 * time.Millisecond, P90: 20 * time.Millisecond, P99: p99, Max: p99},
+			Metrics:        Metrics{AcceptedCount: 100, Metrics: SendMetrics{Throughput: throughput}},
+		}
+	}
+	baseline := report(100*time.Millisecond, 0, 0, 1000)
+
+	tests := []struct {
+		name              string
+		current           Report
+		tolerances        RegressionTolerances
+		wantRegressions   []Regression
+		wantP99Change     float64
+		wantLostDelta     float64
+		wantThroughputPct float64
+	}{
+		{
+			name:              "within tolerances",
+			current:           report(105*time.Millisecond, 0, 1, 950),
+			tolerances:        tolerances,
+			wantP99Change:     5,
+			wantThroughputPct: -5,
+		},
+		{
+			name:       "regressions",
+			current:    report(150*time.Millisecond, 2, 0, 800),
+			tolerances: tolerances,
+			wantRegressions: []Regression{
+				{Metric: "latency.99th", Tolerance: 10, Actual: 50},
+				{Metric: "latency.max", Tolerance: 10, Actual: 50},
+				{Metric: ComparisonLostPercentage, Tolerance: 0, Actual: 2},
+				{Metric: ComparisonThroughput, Tolerance: 10, Actual: 20},
+			},
+			wantP99Change:     50,
+			wantLostDelta:     2,
+			wantThroughputPct: -20,
+		},
+		{
+			name:              "no tolerances",
+			current:           report(150*time.Millisecond, 2, 0, 800),
+			wantP99Change:     50,
+			wantLostDelta:     2,
+			wantThroughputPct: -20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := CompareReports(baseline, tt.current, tt.tolerances)
+			if diff := cmp.Diff(tt.wantRegressions, got.Regressions); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if got.Passed != (len(tt.wantRegressions) == 0) {
+				t.Errorf("want passed %v, got %v", len(tt.wantRegressions) == 0, got.Passed)
+			}
+			var regressionErr *RegressionError
+			if err := got.Err(); errors.As(err, &regressionErr) == got.Passed {
+				t.Errorf("unexpected error %v for passed %v", err, got.Passed)
+			}
+			if p99 := got.Latency[2]; p99.Metric != "latency.99th" || p99.ChangePercentage != tt.wantP99Change {
+				t.Errorf("want 99th percentile change %v, got %+v", tt.wantP99Change, p99)
+			}
+			if got.LostPercentage.Delta != tt.wantLostDelta {
+				t.Errorf("want lost percentage delta %v, got %+v", tt.wantLostDelta, got.LostPercentage)
+			}
+			if got.Throughput.ChangePercentage != tt.wantThroughputPct {
+				t.Errorf("want throughput change %v, got %+v", tt.wantThroughputPct, got.Throughput)
+			}
+		})
+	}
+}
+
+func TestReadReport(t *testing.T) {
+	report := Report{LostCount: 1, Latency: LatencyStats{Count: 2, P99: time.Second}}
+	b := &bytes.Buffer{}
+	if err := writeJSONReport(b, report, errors.New("lost events")); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ReadReport(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.LostCount != 1 || got.Latency != report.Latency {
+		t.Errorf("want %+v, got %+v", report, got)
+	}
+
+	if _, err := ReadReport(bytes.NewBufferString("{")); err == nil {
+		t.Error("expected error for invalid report")
+	}
+}
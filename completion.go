@@ -0,0 +1,83 @@
+package sacura
+
+import (
+	"errors"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// validateExitWhenComplete validates receiver.exitWhenComplete.
+func (c *Config) validateExitWhenComplete() error {
+	if !c.Receiver.ExitWhenComplete {
+		return nil
+	}
+	if c.Sender.Disabled || c.Receiver.Disabled {
+		return invalidErr("receiver.exitWhenComplete", errors.New("requires both the sender and the receiver"))
+	}
+	if c.Distributed != nil {
+		return invalidErr("receiver.exitWhenComplete", errors.New("cannot be used in distributed mode"))
+	}
+	return nil
+}
+
+// completionDetector signals once all sent events have been received, so that the receiver terminates without
+// waiting for the quiet period or its timeout.
+type completionDetector struct {
+	// eventCount is sender.eventCount, the sender is done once it has been sent.
+	eventCount int64
+	// sentDone is true once all sent events have been recorded.
+	sentDone *atomic.Bool
+	once     sync.Once
+	done     chan struct{}
+}
+
+// newCompletionDetector returns the completion detector, it returns nil when neither sender.eventCount nor
+// receiver.exitWhenComplete is set.
+func newCompletionDetector(config *Config) *completionDetector {
+	if config.Sender.EventCount == 0 && !config.Receiver.ExitWhenComplete {
+		return nil
+	}
+	return &completionDetector{
+		eventCount: int64(config.Sender.EventCount),
+		sentDone:   atomic.NewBool(false),
+		done:       make(chan struct{}),
+	}
+}
+
+// completed returns a channel closed once the sender is done and all sent events have been received, it is nil when
+// completion isn't detected.
+func (s *StateManager) completed() <-chan struct{} {
+	if s == nil || s.completion == nil {
+		return nil
+	}
+	return s.completion.done
+}
+
+// sentDone records that all sent events have been recorded.
+func (s *StateManager) sentDone() {
+	if s.completion == nil {
+		return
+	}
+	s.completion.sentDone.Store(true)
+	s.checkCompletion()
+}
+
+// checkCompletion signals the completion once the sender is done and all sent events have been received.
+func (s *StateManager) checkCompletion() {
+	c := s.completion
+	if c == nil {
+		return
+	}
+	sent := s.sentCount.Load()
+	if sent == 0 || s.matchedCount.Load() < sent {
+		return
+	}
+	if !c.sentDone.Load() && (c.eventCount == 0 || sent < c.eventCount) {
+		return
+	}
+	c.once.Do(func() {
+		logger(LogComponentState).Infow("All sent events received", "sent", sent)
+		close(c.done)
+	})
+}
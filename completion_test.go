@@ -0,0 +1,76 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestValidateExitWhenComplete(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "enabled", config: Config{Receiver: ReceiverConfig{ExitWhenComplete: true}}},
+		{name: "disabled", config: Config{Sender: SenderConfig{Disabled: true}}},
+		{name: "sender disabled", config: Config{Sender: SenderConfig{Disabled: true}, Receiver: ReceiverConfig{ExitWhenComplete: true}}, wantErr: true},
+		{name: "receiver disabled", config: Config{Receiver: ReceiverConfig{Disabled: true, ExitWhenComplete: true}}, wantErr: true},
+		{name: "distributed", config: Config{Receiver: ReceiverConfig{ExitWhenComplete: true}, Distributed: &DistributedConfig{}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validateExitWhenComplete(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStateManagerCompletion(t *testing.T) {
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{ExitWhenComplete: true}})
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 2)
+	sentSignal := sm.ReadSent(sent)
+	receivedSignal := sm.ReadReceived(received)
+
+	events := make([]ce.Event, 0, 2)
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		events = append(events, e)
+		sent <- e
+	}
+	for _, e := range events {
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+
+	// The sender may still send events.
+	select {
+	case <-sm.completed():
+		t.Fatal("expected no completion while the sender is running")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sent)
+	<-sentSignal
+	select {
+	case <-sm.completed():
+	case <-time.After(time.Second):
+		t.Fatal("expected completion once the sender is done")
+	}
+
+	close(received)
+	<-receivedSignal
+	if report := sm.GenerateReport(); report.ReceivedCount != 2 || report.LostCount != 0 {
+		t.Errorf("want 2 events received, got %+v", report)
+	}
+
+	if newTestStateManager(t, Config{}).completed() != nil {
+		t.Error("expected completion not to be detected")
+	}
+}
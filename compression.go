@@ -0,0 +1,212 @@
+package sacura
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// CompressionGzip is the gzip content encoding.
+const CompressionGzip = "gzip"
+
+// contentEncodingHeader is the header of the content encoding of request bodies.
+const contentEncodingHeader = "Content-Encoding"
+
+// CompressionConfig compresses the body of sent requests and sets the Content-Encoding header, the receiver
+// decompresses request bodies regardless.
+type CompressionConfig struct {
+	// Algorithm is the content encoding, only CompressionGzip is supported.
+	//
+	// Defaults to CompressionGzip.
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	// Level is the gzip compression level, between 1 and 9.
+	//
+	// Defaults to gzip.DefaultCompression.
+	Level int `json:"level" yaml:"level"`
+	// Passthrough fails the verification when events are received decompressed, to validate brokers claiming to pass
+	// compressed payloads through.
+	Passthrough bool `json:"passthrough" yaml:"passthrough"`
+}
+
+func (c *CompressionConfig) validate(protocol Protocol) error {
+	if protocol != "" && protocol != ProtocolHTTP {
+		return invalidErr("sender.compression", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = CompressionGzip
+	}
+	if c.Algorithm != CompressionGzip {
+		return invalidErr("sender.compression.algorithm", fmt.Errorf("unsupported algorithm %q, expected %s", c.Algorithm, CompressionGzip))
+	}
+	if c.Level == 0 {
+		c.Level = gzip.DefaultCompression
+	}
+	if c.Level != gzip.DefaultCompression && (c.Level < gzip.BestSpeed || c.Level > gzip.BestCompression) {
+		return invalidErr("sender.compression.level", fmt.Errorf("%d must be between %d and %d", c.Level, gzip.BestSpeed, gzip.BestCompression))
+	}
+	return nil
+}
+
+// compress compresses the given request body and sets the content encoding of the given headers.
+func (c *CompressionConfig) compress(hdr http.Header, body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w, err := gzip.NewWriterLevel(buf, c.Level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(body); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	hdr.Set(contentEncodingHeader, c.Algorithm)
+	return buf.Bytes(), nil
+}
+
+type compressionKey struct{}
+
+// requestCompression is the compression of a received request.
+type requestCompression struct {
+	compressed bool
+	// mangled is true when the compressed body cannot be decompressed.
+	mangled bool
+}
+
+// compressionFromRequest returns the compression of the given request decompressed by decompressRequest.
+func compressionFromRequest(r *http.Request) requestCompression {
+	c, _ := r.Context().Value(compressionKey{}).(requestCompression)
+	return c
+}
+
+// decompressRequest decompresses the body of the given gzip encoded request and records the compression in the
+// context of the returned request.
+//
+// When the body cannot be decompressed, it returns the events identified by the request headers, whose payload has
+// been mangled in transit: the event of binary requests or the events listed by the CloudEventIdHeader headers.
+func decompressRequest(r *http.Request) (*http.Request, []*ce.Event) {
+	if !strings.EqualFold(r.Header.Get(contentEncodingHeader), CompressionGzip) {
+		return r, nil
+	}
+	body, err := gunzip(r.Body)
+	if err != nil {
+		logger(LogComponentReceiver).Warnw("Failed to decompress request", "error", err)
+		r = r.WithContext(context.WithValue(r.Context(), compressionKey{}, requestCompression{compressed: true, mangled: true}))
+		return r, mangledEvents(r)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), compressionKey{}, requestCompression{compressed: true}))
+	r.Header.Del(contentEncodingHeader)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+	return r, nil
+}
+
+func gunzip(body io.Reader) ([]byte, error) {
+	r, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// mangledEvents returns the events identified by the headers of the given request.
+func mangledEvents(r *http.Request) []*ce.Event {
+	if e, err := binding.ToEvent(r.Context(), cehttp.NewMessage(r.Header, nil)); err == nil {
+		return []*ce.Event{e}
+	}
+	var events []*ce.Event
+	for _, id := range r.Header.Values(CloudEventIdHeader) {
+		e := ce.NewEvent()
+		e.SetID(id)
+		events = append(events, &e)
+	}
+	return events
+}
+
+// errMangled is the response to requests whose compressed body cannot be decompressed.
+var errMangled = &statusCodeError{statusCode: http.StatusBadRequest, message: "failed to decompress request body"}
+
+// CompressionReport reports the compression of received events.
+type CompressionReport struct {
+	// CompressedCount is the number of deliveries received compressed.
+	CompressedCount int `json:"compressedCount"`
+	// DecompressedCount is the number of deliveries received uncompressed while sent compressed, for example
+	// decompressed by the system under test.
+	DecompressedCount int `json:"decompressedCount"`
+	// MangledCount is the number of events whose compressed payload has been mangled in transit, these events aren't
+	// received.
+	MangledCount                int                 `json:"mangledCount"`
+	MangledEventsByPartitionKey map[string][]string `json:"mangledEvents,omitempty"`
+}
+
+// compressionState tracks the compression of received events.
+type compressionState struct {
+	compressed   int
+	decompressed int
+	mangled      map[string][]string
+}
+
+// recordMangled records the given delivery when its compressed payload has been mangled in transit, it returns true
+// when it is. It must be called while holding the lock.
+func (s *StateManager) recordMangled(e *ReceivedEvent) bool {
+	if !e.Mangled {
+		return false
+	}
+	logger(LogComponentState).Warnw("Received event with a mangled compressed payload", "id", e.Event.ID())
+	insert(&e.Event, s.compression.mangled, &s.stateManagerConfig)
+	return true
+}
+
+// recordCompression records the compression of the given delivery, it must be called while holding the lock.
+func (s *StateManager) recordCompression(e *ReceivedEvent) {
+	if e.Compressed {
+		s.compression.compressed++
+	} else if s.config.Sender.Compression != nil {
+		s.compression.decompressed++
+	}
+}
+
+// compressionReport sets the compression section of the report when compressed events have been sent or received,
+// it must be called while holding the lock.
+func (s *StateManager) compressionReport(r *Report) {
+	c := s.compression
+	if s.config.Sender.Compression == nil && c.compressed == 0 && len(c.mangled) == 0 {
+		return
+	}
+	report := &CompressionReport{CompressedCount: c.compressed, DecompressedCount: c.decompressed}
+	if len(c.mangled) > 0 {
+		report.MangledEventsByPartitionKey = make(map[string][]string, len(c.mangled))
+		for k, v := range c.mangled {
+			mangled, _ := removeDuplicates(v)
+			sort.Strings(mangled)
+			report.MangledEventsByPartitionKey[k] = mangled
+			report.MangledCount += len(mangled)
+		}
+	}
+	r.Compression = report
+}
+
+// verifyCompression verifies that no compressed payload has been mangled in transit and, with passthrough, that no
+// event has been decompressed.
+func verifyCompression(config Config, report Report) error {
+	if report.Compression == nil {
+		return nil
+	}
+	if report.Compression.MangledCount > 0 {
+		return fmt.Errorf("%d events with a mangled compressed payload received", report.Compression.MangledCount)
+	}
+	if c := config.Sender.Compression; c != nil && c.Passthrough && report.Compression.DecompressedCount > 0 {
+		return fmt.Errorf("%d deliveries received decompressed, expected %s payloads to be passed through", report.Compression.DecompressedCount, c.Algorithm)
+	}
+	return nil
+}
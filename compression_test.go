@@ -0,0 +1,178 @@
+package sacura
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestCompressionConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   CompressionConfig
+		protocol Protocol
+		want     CompressionConfig
+		wantErr  bool
+	}{
+		{name: "defaults", config: CompressionConfig{}, want: CompressionConfig{Algorithm: CompressionGzip, Level: gzip.DefaultCompression}},
+		{name: "level", config: CompressionConfig{Level: gzip.BestSpeed}, want: CompressionConfig{Algorithm: CompressionGzip, Level: gzip.BestSpeed}},
+		{name: "unsupported algorithm", config: CompressionConfig{Algorithm: "br"}, wantErr: true},
+		{name: "invalid level", config: CompressionConfig{Level: 10}, wantErr: true},
+		{name: "unsupported protocol", config: CompressionConfig{}, protocol: ProtocolGRPC, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStartReceiverCompression(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 2)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9235}, received, nil)
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &CompressionConfig{}
+	if err := config.validate(ProtocolHTTP); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(hdr http.Header, body []byte) int {
+		var statusCode int
+		err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+			req, err := http.NewRequest(http.MethodPost, "http://localhost:9235", bytes.NewReader(body))
+			if err != nil {
+				return false, err
+			}
+			req.Header = hdr
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				return false, nil
+			}
+			defer resp.Body.Close()
+			statusCode = resp.StatusCode
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal("failed to send event", err)
+		}
+		return statusCode
+	}
+
+	hdr := http.Header{"Content-Type": []string{"application/cloudevents+json"}}
+	compressed, err := config.compress(hdr, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode := send(hdr, compressed); statusCode != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, statusCode)
+	}
+	if r := <-received; !r.Compressed || r.Mangled || r.Event.ID() != e.ID() {
+		t.Errorf("expected compressed event %s, got %+v", e.ID(), r)
+	}
+
+	// The compressed payload of a binary event truncated in transit.
+	hdr = http.Header{
+		"Content-Type":   []string{"application/json"},
+		"Ce-Id":          []string{"mangled"},
+		"Ce-Source":      []string{"sacura"},
+		"Ce-Type":        []string{"sacura.event"},
+		"Ce-Specversion": []string{"1.0"},
+	}
+	compressed, err = config.compress(hdr, []byte(`{"hello":"world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode := send(hdr, compressed[:len(compressed)/2]); statusCode != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, statusCode)
+	}
+	if r := <-received; !r.Mangled || r.Event.ID() != "mangled" {
+		t.Errorf("expected mangled event, got %+v", r)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestStateManagerCompression(t *testing.T) {
+
+	config := Config{Sender: SenderConfig{Compression: &CompressionConfig{Passthrough: true}}}
+	sm := newTestStateManager(t, config)
+
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1"), Compressed: true},
+		{Event: event("2")},
+		{Event: event("3"), Compressed: true, Mangled: true},
+		{Event: event("3"), Compressed: true, Mangled: true},
+	} {
+		r := r
+		r.ReceivedAt = time.Now()
+		sm.lock.Lock()
+		sm.recordReceived(&r)
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := &CompressionReport{
+		CompressedCount:             1,
+		DecompressedCount:           1,
+		MangledCount:                1,
+		MangledEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"3"}},
+	}
+	if diff := cmp.Diff(want, report.Compression); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if n := len(sm.receivedAt); n != 2 {
+		t.Errorf("want 2 received events, mangled events excluded, got %d", n)
+	}
+
+	if err := verifyCompression(config, report); err == nil || !strings.Contains(err.Error(), "mangled") {
+		t.Errorf("expected mangled events error, got %v", err)
+	}
+	report.Compression.MangledCount = 0
+	if err := verifyCompression(config, report); err == nil || !strings.Contains(err.Error(), "decompressed") {
+		t.Errorf("expected decompressed deliveries error, got %v", err)
+	}
+	config.Sender.Compression.Passthrough = false
+	if err := verifyCompression(config, report); err != nil {
+		t.Error("unexpected error", err)
+	}
+	if err := verifyCompression(Config{}, Report{}); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/go-yaml/yaml"
@@ -20,11 +21,208 @@ type Config struct {
 	Duration string         `json:"duration" yaml:"duration"`
 	Ordered  *OrderedConfig `json:"ordered" yaml:"ordered"`
 
+	// DeliveryGuarantee is the delivery guarantee used to verify received events.
+	//
+	// Defaults to AtLeastOnce.
+	DeliveryGuarantee DeliveryGuarantee `json:"deliveryGuarantee" yaml:"deliveryGuarantee"`
+
+	Report ReportConfig `json:"report" yaml:"report"`
+
+	Verification VerificationConfig `json:"verification" yaml:"verification"`
+
+	// Distributed enables the distributed mode where multiple instances report to a single aggregator.
+	Distributed *DistributedConfig `json:"distributed" yaml:"distributed"`
+
+	// State enables persisting sent and received events so that a restarted instance can resume the test.
+	State *StateConfig `json:"state" yaml:"state"`
+
+	// Ingest tunes how sent and received events are recorded at high rates.
+	Ingest *IngestConfig `json:"ingest" yaml:"ingest"`
+
+	// Tracing enables W3C trace context propagation and the export of send, receive and end-to-end latency spans.
+	Tracing *TracingConfig `json:"tracing" yaml:"tracing"`
+
+	// Thresholds are SLOs the final report is evaluated against, a violated threshold fails the test.
+	Thresholds *ThresholdsConfig `json:"thresholds" yaml:"thresholds"`
+
+	// Admin exposes an HTTP API to start, pause, resume and abort the test and to fetch interim reports.
+	Admin *AdminConfig `json:"admin" yaml:"admin"`
+
+	// HotReload applies changes to the send rate, the receiver faults and the receiver processing delay on the fly.
+	HotReload *HotReloadConfig `json:"hotReload" yaml:"hotReload"`
+
+	// FailureDomains tags time windows of the test with labels, to attribute failures to them.
+	FailureDomains *FailureDomainsConfig `json:"failureDomains" yaml:"failureDomains"`
+
+	// Diagnostics exposes net/http/pprof and runtime and StateManager memory stats.
+	Diagnostics *DiagnosticsConfig `json:"diagnostics" yaml:"diagnostics"`
+
+	// Suite runs multiple named scenarios, each overriding fields of this config, and produces a combined report.
+	Suite *SuiteConfig `json:"suite" yaml:"suite"`
+
+	// Benchmark searches the maximum sustainable throughput of the target, running the test in steps at increasing
+	// rates.
+	Benchmark *BenchmarkConfig `json:"benchmark" yaml:"benchmark"`
+
+	// Logging configures the level, encoding and sampling of logs, globally and per component.
+	Logging *LoggingConfig `json:"logging" yaml:"logging"`
+
+	// Knative provisions the Knative resources routing events to the receiver before the test and deletes them
+	// after the test.
+	Knative *KnativeConfig `json:"knative" yaml:"knative"`
+
+	// Serialization encodes the data of sent events as Avro or Protobuf with a schema of a schema registry and
+	// verifies received data deserializes against it.
+	Serialization *SerializationConfig `json:"serialization" yaml:"serialization"`
+
+	// Streams run multiple logical streams in parallel, each with its own target, receiver path, rate and ordering
+	// expectation, and produce a combined report with a section per stream.
+	Streams []StreamConfig `json:"streams" yaml:"streams"`
+
+	// Backfill reads the delivered events from an external store once the send phase is done instead of receiving
+	// them live, to verify pipelines sacura can't subscribe to.
+	Backfill *BackfillConfig `json:"backfill" yaml:"backfill"`
+
+	// Seed makes the random choices of the sender and the receiver deterministic, so that the same logical traffic
+	// is generated run after run: event IDs, partition keys, payload sizes and contents, and injected faults and
+	// delays. Choices are made in the order events are generated and received, which is deterministic with a single
+	// sender worker.
+	//
+	// When not specified, choices are random.
+	Seed *int64 `json:"seed" yaml:"seed"`
+
+	// RunID is stamped on sent events with the RunIDExtension, received events carrying the run ID of another run
+	// are ignored and counted in the report, so that back-to-back runs against a shared broker don't pollute each
+	// other's reports. RunIDAuto generates a random run ID.
+	//
+	// When not specified, events aren't stamped and events of other runs are unexpected.
+	RunID string `json:"runId" yaml:"runId"`
+
+	// Verifiers plug custom verification logic when sacura is used as a library, their results are merged into the
+	// report.
+	Verifiers []Verifier `json:"-" yaml:"-"`
+
 	ParsedDuration time.Duration
 }
 
+type StateConfig struct {
+	// Path is the path of the journal sent and received events are appended to, a bbolt database created when it
+	// doesn't exist.
+	Path string `json:"path" yaml:"path"`
+	// Redis appends sent and received events to a Redis list shared by the instances of the test instead of a
+	// file, it is exclusive with Path.
+	Redis *RedisStateConfig `json:"redis" yaml:"redis"`
+}
+
+type ReportConfig struct {
+	// Writers are additional destinations for the final report, besides logs.
+	Writers []ReportWriterConfig `json:"writers" yaml:"writers"`
+	// Interim enables interim reports emitted periodically while the test is running.
+	Interim *InterimReportConfig `json:"interim" yaml:"interim"`
+	// Kubernetes writes the final report to a ConfigMap or to the container termination message when running
+	// in-cluster.
+	Kubernetes *KubernetesReportConfig `json:"kubernetes" yaml:"kubernetes"`
+	// ThroughputInterval is the size of the time buckets of the throughput series of the report, for example 1s.
+	//
+	// When empty, buckets are 1s long and grow with the duration of the test to keep the series at most 300 samples.
+	ThroughputInterval string `json:"throughputInterval" yaml:"throughputInterval"`
+	// Limits bounds the size of the logged and written reports, the HTML report lists a bounded number of events
+	// regardless.
+	Limits *ReportLimitsConfig `json:"limits" yaml:"limits"`
+	// LatencyHistogram adds a histogram of the end-to-end latency with fixed buckets to the report, it is also exposed
+	// in the OpenMetrics text format on LatencyHistogramPath of the metrics server.
+	LatencyHistogram *LatencyHistogramConfig `json:"latencyHistogram" yaml:"latencyHistogram"`
+	// EventLog streams a record of each sent and received event to a file while the test is running.
+	EventLog *EventLogConfig `json:"eventLog" yaml:"eventLog"`
+	// LostEvents writes the lost events of the final report to a file, without the limits of the report.
+	LostEvents *LostEventsExportConfig `json:"lostEvents" yaml:"lostEvents"`
+	// Interchange writes the sent and received events to a file in the interchange format once the test terminated.
+	Interchange *InterchangeExportConfig `json:"interchange" yaml:"interchange"`
+	// Upload uploads the final report, the written reports, the event log and the lost events to an object store
+	// bucket.
+	Upload *ReportUploadConfig `json:"upload" yaml:"upload"`
+	// Webhooks are notified of the outcome of the test once the reports are written.
+	Webhooks []WebhookConfig `json:"webhooks" yaml:"webhooks"`
+	// Progress shows a live progress view of the running test on the standard error.
+	Progress *ProgressReportConfig `json:"progress" yaml:"progress"`
+	// Anomalies annotates the report with receive stalls, latency spikes and duplicate bursts found in the series of
+	// the test.
+	Anomalies *AnomaliesConfig `json:"anomalies" yaml:"anomalies"`
+
+	ParsedThroughputInterval time.Duration
+}
+
+type ReportWriterConfig struct {
+	// Format is the format of the report, one of ReportFormatJSON, ReportFormatJUnit or ReportFormatHTML.
+	Format ReportFormat `json:"format" yaml:"format"`
+	// Path is the path of the file the report is written to.
+	Path string `json:"path" yaml:"path"`
+}
+
+type DeliveryGuarantee string
+
+const (
+	// AtLeastOnce tolerates duplicates but no loss.
+	AtLeastOnce DeliveryGuarantee = "at-least-once"
+	// AtMostOnce tolerates loss up to ReceiverConfig.MaxLostPercentage but no duplicates.
+	AtMostOnce DeliveryGuarantee = "at-most-once"
+	// ExactlyOnce tolerates neither loss nor duplicates.
+	ExactlyOnce DeliveryGuarantee = "exactly-once"
+)
+
+func (g DeliveryGuarantee) allowsDuplicates() bool {
+	return g == "" || g == AtLeastOnce
+}
+
+func (g DeliveryGuarantee) allowsLoss() bool {
+	return g == AtMostOnce
+}
+
 type OrderedConfig struct {
 	NumPartitionKeys uint8 `json:"numPartitionKeys" yaml:"numPartitionKeys"`
+	// PartitionKeyFormat is the naming scheme of partition keys, a format with a single integer verb receiving the
+	// index of the key, for example tenant-%03d.
+	//
+	// Defaults to %d.
+	PartitionKeyFormat string `json:"partitionKeyFormat" yaml:"partitionKeyFormat"`
+	// PartitionKeyExtension is the CloudEvents extension used as partition key.
+	//
+	// Defaults to DefaultPartitionKeyExtension.
+	PartitionKeyExtension string `json:"partitionKeyExtension" yaml:"partitionKeyExtension"`
+	// PartitionBySubject uses the subject attribute as partition key instead of PartitionKeyExtension, end-to-end,
+	// for brokers sharding on the subject natively.
+	PartitionBySubject bool `json:"partitionBySubject" yaml:"partitionBySubject"`
+	// PartitionKeyStrategy is the strategy used by the sender to assign partition keys to events.
+	//
+	// Defaults to PartitionKeyStrategyRandom.
+	PartitionKeyStrategy PartitionKeyStrategy `json:"partitionKeyStrategy" yaml:"partitionKeyStrategy"`
+	// ZipfExponent is the exponent of the Zipf distribution used by PartitionKeyStrategyZipf, it must be greater
+	// than 1, the higher the exponent the more skewed the distribution towards the first keys.
+	//
+	// Defaults to DefaultZipfExponent.
+	ZipfExponent float64 `json:"zipfExponent" yaml:"zipfExponent"`
+	// ToleranceWindow is the maximum displacement, in positions, of events received out of order that is tolerated,
+	// events received after events sent more than ToleranceWindow positions later than them are ordering violations.
+	//
+	// Defaults to 0, any out of order event is an ordering violation.
+	ToleranceWindow int `json:"toleranceWindow" yaml:"toleranceWindow"`
+	// IndependentSenders sends the events of each partition key with a dedicated sender, with its own sequence
+	// numbers and pacing, instead of assigning partition keys to the events of a single sender. See
+	// partitionSenderAttacks.
+	IndependentSenders bool `json:"independentSenders" yaml:"independentSenders"`
+	// Cardinality continuously grows the partition key space during the run, starting from NumPartitionKeys, and
+	// the report summarizes partition keys rather than enumerating them.
+	Cardinality *PartitionKeyCardinalityConfig `json:"cardinality" yaml:"cardinality"`
+	// Exclusions are time windows during which ordering isn't required to hold, for example an announced upgrade,
+	// ordering violations of events received during them are reported without failing the test.
+	Exclusions []OrderingExclusionConfig `json:"exclusions" yaml:"exclusions"`
+}
+
+func (c *OrderedConfig) partitionKeyExtension() string {
+	if c.PartitionKeyExtension == "" {
+		return DefaultPartitionKeyExtension
+	}
+	return c.PartitionKeyExtension
 }
 
 type SenderConfig struct {
@@ -33,17 +231,305 @@ type SenderConfig struct {
 	FrequencyPerSecond int    `json:"frequency" yaml:"frequency"`
 	Workers            uint64 `json:"workers" yaml:"workers"`
 	KeepAlive          bool   `json:"keepAlive" yaml:"keepAlive"`
+
+	// EventCount is the total number of events to send, including the warmup, the sender stops once they have been
+	// sent and the receiver terminates once all of them have been received. The duration is then optional, it
+	// bounds the time to send them when specified.
+	//
+	// Defaults to 0, events are sent at frequency for the duration.
+	EventCount int `json:"eventCount" yaml:"eventCount"`
+
+	// Targets sends events to multiple targets instead of Target, with a failover or weighted strategy.
+	Targets *TargetsConfig `json:"targets" yaml:"targets"`
+
+	// MaxWorkers is the maximum number of workers, workers beyond Workers are spawned when responses are too slow to
+	// sustain the rate.
+	//
+	// Defaults to Workers.
+	MaxWorkers uint64 `json:"maxWorkers" yaml:"maxWorkers"`
+	// MaxIdleConnections is the maximum number of idle connections kept open to the target.
+	//
+	// Defaults to vegeta.DefaultConnections.
+	MaxIdleConnections int `json:"maxIdleConnections" yaml:"maxIdleConnections"`
+	// MaxConnections is the maximum number of connections to the target, including active ones.
+	//
+	// Defaults to 0, no limit.
+	MaxConnections int `json:"maxConnections" yaml:"maxConnections"`
+	// HTTP2 sends requests with HTTP/2, negotiated with ALPN for HTTPS targets and with prior knowledge (h2c) for
+	// HTTP targets.
+	HTTP2 bool `json:"http2" yaml:"http2"`
+	// RequestTimeout is the maximum time to wait for the response to each attempt of a request, for example 5s,
+	// whatever the protocol.
+	//
+	// Defaults to vegeta.DefaultTimeout.
+	RequestTimeout string `json:"requestTimeout" yaml:"requestTimeout"`
+	// SendDeadline is the maximum time to send each request including its retries and their backoff, for example
+	// 30s. Events not accepted by then are reported as not sent and timed out.
+	//
+	// Defaults to RequestTimeout.
+	SendDeadline string `json:"sendDeadline" yaml:"sendDeadline"`
+	// StartDelay is the time to wait before sending the first event, so that the receiver and the system under test
+	// are ready, for example 0s when they already are.
+	//
+	// Defaults to DefaultSenderStartDelay.
+	StartDelay string `json:"startDelay" yaml:"startDelay"`
+	// Handshake waits after the start delay until the receiver is ready and events are routed to it before sending
+	// the first event.
+	Handshake *HandshakeConfig `json:"handshake" yaml:"handshake"`
+
+	// Retry retries requests failing with a transport error or a retryable status code, events never accepted are
+	// reported as not sent.
+	Retry *RetryConfig `json:"retry" yaml:"retry"`
+
+	// Throttling pauses workers receiving 429 Too Many Requests responses for the time requested by the Retry-After
+	// header, throttling episodes are reported in the sender metrics.
+	Throttling *ThrottlingConfig `json:"throttling" yaml:"throttling"`
+
+	// IdempotencyKey sends each event with an idempotency key header derived from its ID, the report verifies that
+	// retried events aren't duplicated.
+	IdempotencyKey *IdempotencyKeyConfig `json:"idempotencyKey" yaml:"idempotencyKey"`
+
+	// CircuitBreaker stops sending to a target after consecutive failed requests and probes it again after a while,
+	// the state transitions of each target are reported in the sender metrics.
+	CircuitBreaker *CircuitBreakerConfig `json:"circuitBreaker" yaml:"circuitBreaker"`
+
+	// ClosedLoop holds the sender while too many sent events haven't been received yet.
+	ClosedLoop *ClosedLoopConfig `json:"closedLoop" yaml:"closedLoop"`
+
+	// Payload configures the data of sent events, when not specified events carry a fixed sample payload.
+	Payload *PayloadConfig `json:"payload" yaml:"payload"`
+
+	// Attributes configures the attributes and extensions of sent events, when not specified events carry the
+	// attributes of a fixed sample event.
+	Attributes *EventAttributesConfig `json:"attributes" yaml:"attributes"`
+
+	// Variants vary the attributes of sent events, for example to verify a filter with verification.filter.
+	Variants []EventVariantConfig `json:"variants" yaml:"variants"`
+
+	// Overrides is a matrix of override groups, each setting extensions and headers on a share of sent events, and
+	// the report breaks results down per group.
+	Overrides []EventOverrideConfig `json:"overrides" yaml:"overrides"`
+
+	// ExpectedLoss sends a share of events expected not to be delivered, for example to verify that a filter drops
+	// them.
+	ExpectedLoss *ExpectedLossConfig `json:"expectedLoss" yaml:"expectedLoss"`
+
+	// TTL sends a share of events with a time to live the system under test is expected to enforce.
+	TTL *TTLConfig `json:"ttl" yaml:"ttl"`
+
+	// DelayedDelivery sends events with a delayed delivery the system under test is expected to honor.
+	DelayedDelivery *DelayedDeliveryConfig `json:"delayedDelivery" yaml:"delayedDelivery"`
+
+	// LoadProfile shapes the sending rate over time, when not specified events are sent at a constant rate.
+	LoadProfile *LoadProfileConfig `json:"loadProfile" yaml:"loadProfile"`
+
+	// Pacing adds jitter and bursts to the requests sent at the rate of frequency or loadProfile.
+	Pacing *PacingConfig `json:"pacing" yaml:"pacing"`
+
+	// TokenBucket bounds the requests sent back-to-back when the sender catches up with sender.frequency after it
+	// fell behind, when not specified the sender catches up with all the requests it fell behind.
+	TokenBucket *TokenBucketConfig `json:"tokenBucket" yaml:"tokenBucket"`
+
+	// TLS configures the client certificate and the CAs used when the target is an HTTPS URL.
+	TLS *TLSConfig `json:"tls" yaml:"tls"`
+
+	// Auth attaches a bearer token to sent requests.
+	Auth *SenderAuthConfig `json:"auth" yaml:"auth"`
+	// IdentityRotation rotates the identity sent requests are authenticated with, it is an alternative to Auth.
+	IdentityRotation *IdentityRotationConfig `json:"identityRotation" yaml:"identityRotation"`
+
+	// Protocol is the protocol events are sent with.
+	//
+	// Defaults to ProtocolHTTP.
+	Protocol Protocol `json:"protocol" yaml:"protocol"`
+
+	// MQTT configures the topic events are published to with ProtocolMQTT, the target is the URL of the broker.
+	MQTT *MQTTConfig `json:"mqtt" yaml:"mqtt"`
+
+	// AMQP configures the address events are sent to with ProtocolAMQP, the target is the URL of the broker.
+	AMQP *AMQPConfig `json:"amqp" yaml:"amqp"`
+
+	// NATS configures the subject events are published to with ProtocolNATS, the target is the URL of the server.
+	NATS *NATSConfig `json:"nats" yaml:"nats"`
+
+	// Kafka configures the topic events are produced to with ProtocolKafka, the target is the URL of a bootstrap
+	// broker.
+	Kafka *KafkaConfig `json:"kafka" yaml:"kafka"`
+
+	// BatchSize is the number of events sent in each request, batches of more than one event are sent in the
+	// application/cloudevents-batch+json format and sender.frequency is the number of requests per second.
+	//
+	// Defaults to 1.
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+
+	// ContentMode configures the HTTP content mode of sent events.
+	//
+	// Defaults to the structured content mode.
+	ContentMode *ContentModeConfig `json:"contentMode" yaml:"contentMode"`
+
+	// Compression compresses the body of sent requests.
+	Compression *CompressionConfig `json:"compression" yaml:"compression"`
+
+	// Record writes sent events to a file, so that they can be re-sent by a later run with Replay.
+	Record *RecordConfig `json:"record" yaml:"record"`
+
+	// Replay re-sends the events recorded by a previous run with Record, with the recorded pacing, instead of
+	// generating new events, frequency and loadProfile are ignored.
+	Replay *ReplayConfig `json:"replay" yaml:"replay"`
+
+	// Warmup is the initial part of the test during which events are sent but excluded from the verification, so that
+	// cold-start effects don't fail the test.
+	Warmup string `json:"warmup" yaml:"warmup"`
+
+	// SequentialIDs sends events with sequential IDs instead of UUIDs, per partition key in ordered mode, for example
+	// p1-42, so that missing events are summarized as ranges. IDs are only unique within a single run of a single
+	// sender.
+	SequentialIDs bool `json:"sequentialIds" yaml:"sequentialIds"`
+
+	// IDs configures the scheme of the IDs of sent events, sequentialIds is the sequential strategy without prefix.
+	//
+	// Defaults to random UUIDs.
+	IDs *IDsConfig `json:"ids" yaml:"ids"`
+
+	ParsedWarmup         time.Duration
+	ParsedRequestTimeout time.Duration
+	ParsedSendDeadline   time.Duration
+	ParsedStartDelay     time.Duration
+}
+
+// DefaultSenderStartDelay is the default SenderConfig.StartDelay.
+const DefaultSenderStartDelay = 10 * time.Second
+
+func (c *SenderConfig) startDelay() time.Duration {
+	if c.StartDelay == "" {
+		return DefaultSenderStartDelay
+	}
+	return c.ParsedStartDelay
 }
 
 type ReceiverConfig struct {
-	Port                      int    `json:"port" yaml:"port"`
-	Timeout                   string `json:"timeout" yaml:"timeout"`
-	MaxDuplicatesPercentage   *int   `json:"maxDuplicatesPercentage" yaml:"maxDuplicatesPercentage"`
-	IncludeRemoteAddressLabel *bool  `json:"includeRemoteAddressLabel" yaml:"includeRemoteAddressLabel"`
+	// Disabled runs the sender only, events are verified by a separate run of Verify with the state journals of the
+	// sender and of the receiver.
+	Disabled                bool   `json:"disabled" yaml:"disabled"`
+	Port                    int    `json:"port" yaml:"port"`
+	Timeout                 string `json:"timeout" yaml:"timeout"`
+	MaxDuplicatesPercentage *int   `json:"maxDuplicatesPercentage" yaml:"maxDuplicatesPercentage"`
+	// MaxLostPercentage is the maximum percentage of lost events tolerated with the AtMostOnce delivery guarantee.
+	//
+	// When not specified, any loss is tolerated.
+	MaxLostPercentage         *int  `json:"maxLostPercentage" yaml:"maxLostPercentage"`
+	IncludeRemoteAddressLabel *bool `json:"includeRemoteAddressLabel" yaml:"includeRemoteAddressLabel"`
+
+	// Protocol is the protocol events are received with.
+	//
+	// Defaults to ProtocolHTTP.
+	Protocol Protocol `json:"protocol" yaml:"protocol"`
+
+	// MQTT configures the broker and the topic the receiver subscribes to with ProtocolMQTT.
+	MQTT *ReceiverMQTTConfig `json:"mqtt" yaml:"mqtt"`
+
+	// AMQP configures the broker and the address the receiver receives from with ProtocolAMQP.
+	AMQP *ReceiverAMQPConfig `json:"amqp" yaml:"amqp"`
+
+	// NATS configures the server and the stream the receiver consumes with ProtocolNATS.
+	NATS *ReceiverNATSConfig `json:"nats" yaml:"nats"`
+
+	// Kafka configures the bootstrap broker and the topic the receiver consumes with ProtocolKafka.
+	Kafka *ReceiverKafkaConfig `json:"kafka" yaml:"kafka"`
+
+	// WebSocket configures the gateway the receiver connects to with ProtocolWebSocket, when not specified the
+	// receiver accepts WebSocket connections on Port.
+	WebSocket *ReceiverWebSocketConfig `json:"webSocket" yaml:"webSocket"`
+
+	// QuietPeriod terminates the receiver once no events have been received for the given period after the sender
+	// finished, Timeout is still the maximum time the receiver waits.
+	QuietPeriod string `json:"quietPeriod" yaml:"quietPeriod"`
+
+	// SuppressDuplicates drops redeliveries of events already accepted by the receiver before they are verified, like
+	// an idempotent consumer, duplicates delivered by the broker are still counted in the receiver metrics and in the
+	// suppressedDuplicates section of the report.
+	SuppressDuplicates bool `json:"suppressDuplicates" yaml:"suppressDuplicates"`
+
+	// InstanceIdentity attributes each delivery to the receiver instance that observed it, for example when the
+	// receiver is deployed as an autoscaled Knative Service.
+	InstanceIdentity *InstanceIdentityConfig `json:"instanceIdentity" yaml:"instanceIdentity"`
+
+	// ExitWhenComplete terminates the receiver as soon as all sent events have been received once the sender is done,
+	// rather than waiting for the quiet period or the timeout. Duplicates delivered later aren't detected.
+	//
+	// The receiver always terminates once all the events of sender.eventCount have been received.
+	ExitWhenComplete bool `json:"exitWhenComplete" yaml:"exitWhenComplete"`
+
+	// Drain extends Timeout as long as events keep arriving at a minimum rate, up to a hard maximum.
+	Drain *DrainConfig `json:"drain" yaml:"drain"`
+
+	// GracePeriod is the maximum time the receiver keeps receiving events after the test has been aborted, for
+	// example by a termination signal, Timeout is still the maximum time the receiver waits.
+	//
+	// Defaults to Timeout.
+	GracePeriod string `json:"gracePeriod" yaml:"gracePeriod"`
+
+	// Disruptions periodically stops the receiver and starts it again, to force restarts and rebalances.
+	Disruptions *DisruptionsConfig `json:"disruptions" yaml:"disruptions"`
+
+	// LateArrivals keeps the receiver listening for a short window after its timeout to report late arrivals.
+	LateArrivals *LateArrivalsConfig `json:"lateArrivals" yaml:"lateArrivals"`
 
 	ReceiverFaultConfig *ReceiverFaultConfig `json:"fault" yaml:"fault"`
 
-	ParsedTimeout time.Duration
+	// DeadLetterSinkPath is the request path on which the receiver acts as a dead-letter sink.
+	//
+	// Events received on this path are accounted for as dead-lettered rather than received.
+	DeadLetterSinkPath string `json:"deadLetterSinkPath" yaml:"deadLetterSinkPath"`
+
+	// FanOut verifies that each sent event is received exactly once by each of several sinks.
+	FanOut *FanOutConfig `json:"fanOut" yaml:"fanOut"`
+
+	// Endpoints classifies received events by the request path, or host and path, they have been received on.
+	Endpoints *EndpointsConfig `json:"endpoints" yaml:"endpoints"`
+
+	// StreamPayloads checksums the data of events received in the binary content mode while reading request bodies,
+	// without holding them in memory, for example for multi-megabyte payloads. The data of received events is
+	// dropped, integrity verification uses the streamed checksum.
+	StreamPayloads bool `json:"streamPayloads" yaml:"streamPayloads"`
+
+	// ContentTypes asserts the content type of each received event.
+	ContentTypes *ContentTypesConfig `json:"contentTypes" yaml:"contentTypes"`
+
+	// TLS enables TLS termination on the receiver, and client certificates verification when a CA is configured.
+	TLS *TLSConfig `json:"tls" yaml:"tls"`
+
+	// Auth requires received requests to carry a valid bearer token, requests without one are rejected with 401.
+	Auth *ReceiverAuthConfig `json:"auth" yaml:"auth"`
+
+	// Response configures the status code, the headers and the reply event of responses.
+	Response *ReceiverResponseConfig `json:"response" yaml:"response"`
+
+	// SlowConsumer bounds the number of requests processed concurrently and delays their processing.
+	SlowConsumer *SlowConsumerConfig `json:"slowConsumer" yaml:"slowConsumer"`
+
+	// RequestLog logs a sample of the received requests to a rotating file.
+	RequestLog *RequestLogConfig `json:"requestLog" yaml:"requestLog"`
+
+	// ClockSync compensates the skew between the receiver clock and the sender clock.
+	ClockSync *ClockSyncConfig `json:"clockSync" yaml:"clockSync"`
+
+	// Probes serves the liveness and readiness probes of the receiver on a dedicated port.
+	Probes *ReceiverProbesConfig `json:"probes" yaml:"probes"`
+
+	// Rebalancing detects partition keys whose deliveries switched source mid-run.
+	Rebalancing *RebalancingConfig `json:"rebalancing" yaml:"rebalancing"`
+
+	// OrderCheckpoint checkpoints the received sequence numbers so that ordering verification continues across
+	// restarts of the receiver.
+	OrderCheckpoint *OrderCheckpointConfig `json:"orderCheckpoint" yaml:"orderCheckpoint"`
+
+	// Echo echoes each received event to the next hop of a multi-hop topology and to a verification endpoint.
+	Echo *ReceiverEchoConfig `json:"echo" yaml:"echo"`
+
+	ParsedTimeout     time.Duration
+	ParsedQuietPeriod time.Duration
+	ParsedGracePeriod time.Duration
 }
 
 type ReceiverFaultConfig struct {
@@ -53,9 +539,54 @@ type ReceiverFaultConfig struct {
 	MinSleepDuration *time.Duration `json:"minSleepDuration" yaml:"minSleepDuration"`
 	// MaxSleepDuration is the maximum duration to sleep before sending the response.
 	MaxSleepDuration *time.Duration `json:"maxSleepDuration" yaml:"maxSleepDuration"`
+	// SleepPercentage is the percentage of requests for which the receiver sleeps before sending the response.
+	//
+	// Defaults to 100.
+	SleepPercentage *int `json:"sleepPercentage" yaml:"sleepPercentage"`
+
+	// Responses are failure responses returned in place of a successful response, events receiving a failure
+	// response are tracked as nacked.
+	Responses []ReceiverFaultResponseConfig `json:"responses" yaml:"responses"`
+}
+
+func (f *ReceiverFaultConfig) validate() error {
+	if f.MinSleepDuration != nil && f.MaxSleepDuration == nil {
+		return invalidErr(
+			"receiver.fault.maxSleepDuration",
+			fmt.Errorf("maxSleepDuration must be specified when minSleepDuration (%v) is configured", f.MinSleepDuration),
+		)
+	}
+	if f.MinSleepDuration != nil && *f.MaxSleepDuration < *f.MinSleepDuration {
+		return invalidErr("receiver.fault.maxSleepDuration", errors.New("maxSleepDuration cannot be less than minSleepDuration"))
+	}
+	if f.SleepPercentage != nil && (*f.SleepPercentage < 0 || *f.SleepPercentage > 100) {
+		return invalidErr("receiver.fault.sleepPercentage", errors.New("must be between 0 and 100"))
+	}
+	total := 0
+	for i, r := range f.Responses {
+		if r.StatusCode < 300 || r.StatusCode > 599 {
+			return invalidErr(fmt.Sprintf("receiver.fault.responses[%d].statusCode", i), fmt.Errorf("%d is not a failure status code", r.StatusCode))
+		}
+		if r.Percentage < 0 || r.Percentage > 100 {
+			return invalidErr(fmt.Sprintf("receiver.fault.responses[%d].percentage", i), errors.New("must be between 0 and 100"))
+		}
+		total += r.Percentage
+	}
+	if total > 100 {
+		return invalidErr("receiver.fault.responses", fmt.Errorf("percentages add up to %d, expected at most 100", total))
+	}
+	return nil
+}
+
+type ReceiverFaultResponseConfig struct {
+	// StatusCode is the HTTP status code of the failure response.
+	StatusCode int `json:"statusCode" yaml:"statusCode"`
+	// Percentage is the percentage of requests receiving this failure response.
+	Percentage int `json:"percentage" yaml:"percentage"`
 }
 
-func FileConfig(r io.Reader) (Config, error) {
+// FileConfig reads the YAML config from r, applies the given overrides in order and validates it.
+func FileConfig(r io.Reader, overrides ...ConfigOverride) (Config, error) {
 
 	b, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -66,6 +597,9 @@ func FileConfig(r io.Reader) (Config, error) {
 	if err := yaml.Unmarshal(b, config); err != nil {
 		return Config{}, fmt.Errorf("failed to unmarshal file content %s: %w", string(b), err)
 	}
+	if err := config.applyOverrides(overrides); err != nil {
+		return Config{}, err
+	}
 
 	return *config, config.validate()
 }
@@ -73,53 +607,769 @@ func FileConfig(r io.Reader) (Config, error) {
 func (c *Config) validate() error {
 	var err error
 
-	c.ParsedDuration, err = time.ParseDuration(c.Duration)
-	if err != nil {
-		return invalidErr("duration", err)
+	if c.Suite != nil {
+		// The suite config is only the base of the scenario configs.
+		return c.Suite.validate(c)
 	}
 
-	if !c.Sender.Disabled && c.Sender.FrequencyPerSecond <= 0 {
+	if err := c.validateEventCount(); err != nil {
+		return err
+	}
+	if err := c.validateExitWhenComplete(); err != nil {
+		return err
+	}
+	if c.Duration != "" || c.Sender.EventCount == 0 || c.Sender.Disabled {
+		c.ParsedDuration, err = time.ParseDuration(c.Duration)
+		if err != nil {
+			return invalidErr("duration", err)
+		}
+	}
+
+	if !c.Sender.Disabled && c.Sender.Replay == nil && c.Sender.FrequencyPerSecond <= 0 {
 		return invalidErr("sender.frequency", errors.New("frequency cannot be less or equal to 0"))
 	}
 
-	if !c.Sender.Disabled && c.Sender.Target == "" {
+	if c.Ordered != nil {
+		if err := c.Ordered.validatePartitionBySubject(&c.Sender); err != nil {
+			return err
+		}
+		if c.Ordered.PartitionKeyExtension == "" {
+			c.Ordered.PartitionKeyExtension = DefaultPartitionKeyExtension
+		}
+		if !isValidExtensionName(c.Ordered.PartitionKeyExtension) {
+			return invalidErr("ordered.partitionKeyExtension", fmt.Errorf("%q must only contain lowercase letters and digits", c.Ordered.PartitionKeyExtension))
+		}
+		if c.Ordered.NumPartitionKeys == 0 {
+			return invalidErr("ordered.numPartitionKeys", errors.New("must be greater than 0"))
+		}
+		if err := c.Ordered.validatePartitionKeyFormat(); err != nil {
+			return err
+		}
+		if c.Ordered.ToleranceWindow < 0 {
+			return invalidErr("ordered.toleranceWindow", fmt.Errorf("%d cannot be negative", c.Ordered.ToleranceWindow))
+		}
+		switch c.Ordered.PartitionKeyStrategy {
+		case "":
+			c.Ordered.PartitionKeyStrategy = PartitionKeyStrategyRandom
+		case PartitionKeyStrategyRandom, PartitionKeyStrategyRoundRobin, PartitionKeyStrategyFixed:
+		case PartitionKeyStrategyZipf:
+			if c.Ordered.ZipfExponent == 0 {
+				c.Ordered.ZipfExponent = DefaultZipfExponent
+			}
+			if c.Ordered.ZipfExponent <= 1 {
+				return invalidErr("ordered.zipfExponent", fmt.Errorf("%v must be greater than 1", c.Ordered.ZipfExponent))
+			}
+		default:
+			return invalidErr("ordered.partitionKeyStrategy", fmt.Errorf("unknown strategy %q, expected one of %v", c.Ordered.PartitionKeyStrategy, []PartitionKeyStrategy{
+				PartitionKeyStrategyRandom, PartitionKeyStrategyRoundRobin, PartitionKeyStrategyZipf, PartitionKeyStrategyFixed,
+			}))
+		}
+		if err := c.Ordered.validateIndependentSenders(&c.Sender); err != nil {
+			return err
+		}
+		if c.Ordered.Cardinality != nil {
+			if err := c.Ordered.Cardinality.validate(c.Ordered); err != nil {
+				return err
+			}
+		}
+		if err := c.Ordered.validateExclusions(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.Payload != nil {
+		if err := c.Sender.Payload.validate(); err != nil {
+			return err
+		}
+		if len(c.Sender.Payload.SizeClasses) > 0 {
+			if err := c.Sender.Payload.validateSizeClasses(&c.Sender); err != nil {
+				return err
+			}
+		}
+	}
+
+	if c.Sender.LoadProfile != nil {
+		if err := c.Sender.LoadProfile.validate(c.Sender.FrequencyPerSecond); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.Pacing != nil {
+		if err := c.Sender.Pacing.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.TokenBucket != nil {
+		if err := c.Sender.TokenBucket.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.Handshake != nil && !c.Sender.Disabled {
+		if err := c.Sender.Handshake.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Record != nil {
+		if err := c.Sender.Record.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Replay != nil && !c.Sender.Disabled {
+		if err := c.Sender.Replay.validate(&c.Sender); err != nil {
+			return err
+		}
+		if c.Sender.SequentialIDs {
+			return invalidErr("sender.sequentialIds", errors.New("replayed events keep their recorded IDs"))
+		}
+		if c.Sender.IDs != nil {
+			return invalidErr("sender.ids", errors.New("replayed events keep their recorded IDs"))
+		}
+	}
+	if c.Sender.IDs != nil {
+		if err := c.Sender.IDs.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+
+	if c.Knative != nil {
+		if err := c.Knative.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Serialization != nil {
+		if err := c.Serialization.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Targets != nil {
+		if err := c.Sender.Targets.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if !c.Sender.Disabled && c.Sender.Target == "" && c.Sender.Targets == nil && c.Knative == nil && len(c.Streams) == 0 {
 		return invalidErr("sender.target", errors.New("target cannot be empty"))
 	}
 
+	if err := c.Sender.validateWarmup(c.ParsedDuration); err != nil {
+		return err
+	}
+
 	if c.Receiver.MaxDuplicatesPercentage != nil && *c.Receiver.MaxDuplicatesPercentage < 0 {
 		return invalidErr("receiver.maxDuplicatesPercentage", errors.New("cannot be negative"))
 	}
 
-	if c.Receiver.ReceiverFaultConfig != nil && c.Receiver.ReceiverFaultConfig.MinSleepDuration != nil {
-		if c.Receiver.ReceiverFaultConfig.MaxSleepDuration == nil {
-			return invalidErr(
-				"receiver.fault.maxSleepDuration",
-				fmt.Errorf(
-					"maxSleepDuration must be specified when minSleepDuration (%v) is configured",
-					c.Receiver.ReceiverFaultConfig.MinSleepDuration,
-				),
-			)
+	if c.Receiver.MaxLostPercentage != nil && (*c.Receiver.MaxLostPercentage < 0 || *c.Receiver.MaxLostPercentage > 100) {
+		return invalidErr("receiver.maxLostPercentage", errors.New("must be between 0 and 100"))
+	}
+
+	if c.Receiver.ReceiverFaultConfig != nil {
+		if err := c.Receiver.ReceiverFaultConfig.validate(); err != nil {
+			return err
 		}
 	}
 
-	if u, err := url.Parse(c.Sender.Target); !c.Sender.Disabled && err != nil {
-		return invalidErr("sender.target", err)
-	} else if !c.Sender.Disabled && !u.IsAbs() {
-		return invalidErr("sender.target", errors.New("target must be an absolute URL"))
+	// Without a target, events are sent to the address of the provisioned Knative resources.
+	if (c.Sender.Target != "" || c.Knative == nil) && c.Sender.Targets == nil {
+		if u, err := url.Parse(c.Sender.Target); !c.Sender.Disabled && err != nil {
+			return invalidErr("sender.target", err)
+		} else if !c.Sender.Disabled && !u.IsAbs() {
+			return invalidErr("sender.target", errors.New("target must be an absolute URL"))
+		}
 	}
 
 	if c.Sender.Workers == 0 {
 		c.Sender.Workers = vegeta.DefaultWorkers
 	}
+	if c.Sender.MaxWorkers != 0 && c.Sender.MaxWorkers < c.Sender.Workers {
+		return invalidErr("sender.maxWorkers", fmt.Errorf("%d must be greater or equal to sender.workers %d", c.Sender.MaxWorkers, c.Sender.Workers))
+	}
+	if c.Sender.MaxIdleConnections < 0 {
+		return invalidErr("sender.maxIdleConnections", errors.New("cannot be negative"))
+	}
+	if c.Sender.MaxConnections < 0 {
+		return invalidErr("sender.maxConnections", errors.New("cannot be negative"))
+	}
+	if c.Sender.RequestTimeout != "" {
+		c.Sender.ParsedRequestTimeout, err = time.ParseDuration(c.Sender.RequestTimeout)
+		if err != nil {
+			return invalidErr("sender.requestTimeout", err)
+		}
+		if c.Sender.ParsedRequestTimeout <= 0 {
+			return invalidErr("sender.requestTimeout", fmt.Errorf("%v must be greater than 0", c.Sender.ParsedRequestTimeout))
+		}
+	}
+	if c.Sender.SendDeadline != "" {
+		c.Sender.ParsedSendDeadline, err = time.ParseDuration(c.Sender.SendDeadline)
+		if err != nil {
+			return invalidErr("sender.sendDeadline", err)
+		}
+		if timeout := requestTimeout(c); c.Sender.ParsedSendDeadline < timeout {
+			return invalidErr("sender.sendDeadline", fmt.Errorf("%v must be greater or equal to sender.requestTimeout %v", c.Sender.ParsedSendDeadline, timeout))
+		}
+	}
+	if c.Sender.StartDelay != "" {
+		c.Sender.ParsedStartDelay, err = time.ParseDuration(c.Sender.StartDelay)
+		if err != nil {
+			return invalidErr("sender.startDelay", err)
+		}
+		if c.Sender.ParsedStartDelay < 0 {
+			return invalidErr("sender.startDelay", errors.New("cannot be negative"))
+		}
+	}
+
+	if c.Sender.BatchSize < 0 {
+		return invalidErr("sender.batchSize", errors.New("cannot be negative"))
+	}
+
+	if err := validateProtocol("sender.protocol", c.Sender.Protocol); err != nil {
+		return err
+	}
+	if c.Sender.Retry != nil {
+		if err := c.Sender.Retry.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Throttling != nil {
+		if err := c.Sender.Throttling.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.IdempotencyKey != nil {
+		if err := c.Sender.IdempotencyKey.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if c.Sender.CircuitBreaker != nil {
+		if err := c.Sender.CircuitBreaker.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.HTTP2 && c.Sender.Protocol != "" && c.Sender.Protocol != ProtocolHTTP {
+		return invalidErr("sender.http2", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if c.Sender.Protocol == ProtocolGRPC && c.Sender.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolGRPC))
+	}
+	if c.Sender.ContentMode != nil {
+		if err := c.Sender.ContentMode.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Compression != nil {
+		if err := c.Sender.Compression.validate(c.Sender.Protocol); err != nil {
+			return err
+		}
+	}
+	if err := validateProtocol("receiver.protocol", c.Receiver.Protocol); err != nil {
+		return err
+	}
+	if c.Receiver.StreamPayloads && c.Receiver.Protocol != "" && c.Receiver.Protocol != ProtocolHTTP {
+		return invalidErr("receiver.streamPayloads", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if c.Receiver.ContentTypes != nil {
+		if err := c.Receiver.ContentTypes.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.InstanceIdentity != nil {
+		if err := c.Receiver.InstanceIdentity.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Protocol == ProtocolGRPC && c.Receiver.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolGRPC))
+	}
+	if b, ok := protocolBindings[c.Sender.Protocol]; ok && !c.Sender.Disabled {
+		if err := b.validateSender(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if b, ok := protocolBindings[c.Receiver.Protocol]; ok {
+		if err := b.validateReceiver(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Probes != nil {
+		if err := c.Receiver.Probes.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
 
 	c.Receiver.ParsedTimeout, err = time.ParseDuration(c.Receiver.Timeout)
 	if err != nil {
 		return invalidErr("receiver.timeout", err)
 	}
 
+	if c.Receiver.QuietPeriod != "" {
+		c.Receiver.ParsedQuietPeriod, err = time.ParseDuration(c.Receiver.QuietPeriod)
+		if err != nil {
+			return invalidErr("receiver.quietPeriod", err)
+		}
+		if c.Receiver.ParsedQuietPeriod <= 0 || c.Receiver.ParsedQuietPeriod > c.Receiver.ParsedTimeout {
+			return invalidErr("receiver.quietPeriod", fmt.Errorf("%v must be greater than 0 and at most the timeout %v", c.Receiver.ParsedQuietPeriod, c.Receiver.ParsedTimeout))
+		}
+	}
+
+	if c.Receiver.GracePeriod != "" {
+		c.Receiver.ParsedGracePeriod, err = time.ParseDuration(c.Receiver.GracePeriod)
+		if err != nil {
+			return invalidErr("receiver.gracePeriod", err)
+		}
+		if c.Receiver.ParsedGracePeriod <= 0 || c.Receiver.ParsedGracePeriod > c.Receiver.ParsedTimeout {
+			return invalidErr("receiver.gracePeriod", fmt.Errorf("%v must be greater than 0 and at most the timeout %v", c.Receiver.ParsedGracePeriod, c.Receiver.ParsedTimeout))
+		}
+	}
+	if c.Receiver.Drain != nil {
+		if err := c.Receiver.Drain.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Disruptions != nil {
+		if err := c.Receiver.Disruptions.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.LateArrivals != nil {
+		if err := c.Receiver.LateArrivals.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.TLS != nil && !c.Sender.Disabled {
+		if err := c.Sender.TLS.validateClient("sender.tls"); err != nil {
+			return err
+		}
+	}
+	if c.Sender.Auth != nil && !c.Sender.Disabled {
+		if err := c.Sender.Auth.validate("sender.auth"); err != nil {
+			return err
+		}
+	}
+	if c.Sender.IdentityRotation != nil && !c.Sender.Disabled {
+		if err := c.Sender.IdentityRotation.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.TLS != nil {
+		if err := c.Receiver.TLS.validateServer("receiver.tls"); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Auth != nil {
+		if err := c.Receiver.Auth.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Response != nil {
+		if err := c.Receiver.Response.validate(c.Receiver.Protocol); err != nil {
+			return err
+		}
+		if c.Receiver.Response.Reply != nil && c.Receiver.Response.Reply.Verify {
+			if err := c.Receiver.Response.Reply.validateVerify(c); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Receiver.SlowConsumer != nil {
+		if err := c.Receiver.SlowConsumer.validate(c.Receiver.Protocol); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.RequestLog != nil {
+		if err := c.Receiver.RequestLog.validate(c.Receiver.Protocol); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.ClockSync != nil {
+		if err := c.Receiver.ClockSync.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Echo != nil {
+		if err := c.Receiver.Echo.validate(c.Receiver.Protocol); err != nil {
+			return err
+		}
+	}
+
+	switch c.DeliveryGuarantee {
+	case "":
+		c.DeliveryGuarantee = AtLeastOnce
+	case AtLeastOnce, AtMostOnce, ExactlyOnce:
+	default:
+		return invalidErr("deliveryGuarantee", fmt.Errorf("unknown delivery guarantee %q, expected one of %v", c.DeliveryGuarantee, []DeliveryGuarantee{AtLeastOnce, AtMostOnce, ExactlyOnce}))
+	}
+	if c.Receiver.MaxLostPercentage != nil && !c.DeliveryGuarantee.allowsLoss() {
+		return invalidErr("receiver.maxLostPercentage", fmt.Errorf("loss isn't tolerated with the %s delivery guarantee, expected %s", c.DeliveryGuarantee, AtMostOnce))
+	}
+
+	switch c.Verification.Mode {
+	case "":
+		c.Verification.Mode = VerificationModeFull
+	case VerificationModeFull, VerificationModeStreaming, VerificationModeSoak, VerificationModeApproximate:
+	default:
+		return invalidErr("verification.mode", fmt.Errorf("unknown mode %q, expected one of %v", c.Verification.Mode, []VerificationMode{VerificationModeFull, VerificationModeStreaming, VerificationModeSoak, VerificationModeApproximate}))
+	}
+	if c.Verification.Mode == VerificationModeSoak {
+		if c.Verification.Soak == nil {
+			return invalidErr("verification.soak", fmt.Errorf("is required in %s verification mode", VerificationModeSoak))
+		}
+		if err := c.Verification.Soak.validate(&c.Verification); err != nil {
+			return err
+		}
+	} else if c.Verification.Soak != nil {
+		return invalidErr("verification.soak", fmt.Errorf("is only supported in %s verification mode", VerificationModeSoak))
+	}
+	if c.Verification.Mode == VerificationModeApproximate {
+		if c.Verification.Approximate == nil {
+			c.Verification.Approximate = &ApproximateConfig{}
+		}
+		if err := c.Verification.Approximate.validate(&c.Verification); err != nil {
+			return err
+		}
+	} else if c.Verification.Approximate != nil {
+		return invalidErr("verification.approximate", fmt.Errorf("is only supported in %s verification mode", VerificationModeApproximate))
+	}
+	if c.Verification.MaxListedIDs < 0 {
+		return invalidErr("verification.maxListedIds", fmt.Errorf("%d cannot be negative", c.Verification.MaxListedIDs))
+	}
+	if c.Verification.MaxMatchedIDs < 0 {
+		return invalidErr("verification.maxMatchedIds", fmt.Errorf("%d cannot be negative", c.Verification.MaxMatchedIDs))
+	} else if c.Verification.MaxMatchedIDs > 0 && !c.Verification.Mode.streams() {
+		return invalidErr("verification.maxMatchedIds", fmt.Errorf("is only supported in %s, %s and %s verification modes", VerificationModeStreaming, VerificationModeSoak, VerificationModeApproximate))
+	}
+
+	if p := c.Receiver.DeadLetterSinkPath; p != "" {
+		if !strings.HasPrefix(p, "/") || p == "/" {
+			return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("%q must be an absolute path other than /", p))
+		}
+		if c.Verification.Mode.streams() {
+			return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("dead-letter sink is not supported in %s verification mode", c.Verification.Mode))
+		}
+	}
+
+	if c.Sender.Attributes != nil {
+		if err := c.Sender.Attributes.validate(&c.Sender, c.Ordered); err != nil {
+			return err
+		}
+	}
+	for i := range c.Sender.Variants {
+		if err := c.Sender.Variants[i].validate(fmt.Sprintf("sender.variants[%d]", i)); err != nil {
+			return err
+		}
+	}
+	if err := validateOverrides(&c.Sender, c.Ordered); err != nil {
+		return err
+	}
+	if c.Sender.ExpectedLoss != nil {
+		if err := c.Sender.ExpectedLoss.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.TTL != nil {
+		if err := c.Sender.TTL.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if c.Sender.DelayedDelivery != nil {
+		if err := c.Sender.DelayedDelivery.validate(&c.Sender); err != nil {
+			return err
+		}
+	}
+	if c.Verification.Filter != nil {
+		if err := c.Verification.Filter.validate("verification.filter"); err != nil {
+			return err
+		}
+	}
+	if err := validateAssertions(c.Verification.Assertions); err != nil {
+		return err
+	}
+	if c.Verification.Attributes != nil {
+		if err := c.Verification.Attributes.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Verification.Topology != nil {
+		if err := c.Verification.Topology.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Verification.DuplicateBudget != nil {
+		if c.DeliveryGuarantee == ExactlyOnce {
+			return invalidErr("verification.duplicateBudget", fmt.Errorf("duplicates aren't tolerated with the %s delivery guarantee", ExactlyOnce))
+		}
+		if err := c.Verification.DuplicateBudget.validate("verification.duplicateBudget"); err != nil {
+			return err
+		}
+	}
+	if c.Verification.LossBudget != nil {
+		if err := c.Verification.LossBudget.validate("verification.lossBudget"); err != nil {
+			return err
+		}
+	}
+	if c.Verification.DeliveryAttempts != nil {
+		if err := c.Verification.DeliveryAttempts.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Receiver.Endpoints != nil {
+		if err := c.Receiver.Endpoints.validate(&c.Receiver); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.Rebalancing != nil {
+		if err := c.Receiver.Rebalancing.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.OrderCheckpoint != nil {
+		if err := c.Receiver.OrderCheckpoint.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Receiver.FanOut != nil {
+		if err := c.Receiver.FanOut.validate(&c.Receiver, c.Verification.Mode); err != nil {
+			return err
+		}
+	}
+
+	if c.State != nil {
+		if err := c.State.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Ingest != nil {
+		if err := c.Ingest.validate(c.Verification.Mode); err != nil {
+			return err
+		}
+	}
+
+	if c.Sender.Disabled && c.Receiver.Disabled {
+		return invalidErr("receiver.disabled", errors.New("sender and receiver cannot be both disabled"))
+	}
+
+	switch c.Verification.UnexpectedEvents {
+	case "":
+		c.Verification.UnexpectedEvents = UnexpectedEventsIgnore
+	case UnexpectedEventsIgnore, UnexpectedEventsFail:
+	default:
+		return invalidErr("verification.unexpectedEvents", fmt.Errorf("unknown policy %q, expected one of %v", c.Verification.UnexpectedEvents, []UnexpectedEventsPolicy{UnexpectedEventsIgnore, UnexpectedEventsFail}))
+	}
+
+	if c.Verification.MaxDeliveryAge != "" {
+		c.Verification.ParsedMaxDeliveryAge, err = time.ParseDuration(c.Verification.MaxDeliveryAge)
+		if err != nil {
+			return invalidErr("verification.maxDeliveryAge", err)
+		}
+		if c.Verification.ParsedMaxDeliveryAge <= 0 {
+			return invalidErr("verification.maxDeliveryAge", errors.New("must be greater than 0"))
+		}
+	}
+	if m := c.Verification.MaxExpiredEvents; m != nil {
+		if c.Verification.MaxDeliveryAge == "" {
+			return invalidErr("verification.maxExpiredEvents", errors.New("requires verification.maxDeliveryAge"))
+		}
+		if *m < 0 {
+			return invalidErr("verification.maxExpiredEvents", fmt.Errorf("%d cannot be negative", *m))
+		}
+	}
+	if m := c.Verification.MaxOrderingViolations; m != nil {
+		if c.Ordered == nil {
+			return invalidErr("verification.maxOrderingViolations", errors.New("requires ordered"))
+		}
+		if *m < 0 {
+			return invalidErr("verification.maxOrderingViolations", fmt.Errorf("%d cannot be negative", *m))
+		}
+	}
+
+	if c.Distributed != nil {
+		if err := c.Distributed.validate(); err != nil {
+			return err
+		}
+		if c.Distributed.ExclusivePartitions && c.Ordered == nil {
+			return invalidErr("distributed.exclusivePartitions", errors.New("requires ordered mode"))
+		}
+	}
+
+	if err := c.validateRunID(); err != nil {
+		return err
+	}
+
+	if c.Tracing != nil {
+		if err := c.Tracing.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Thresholds != nil {
+		if err := c.Thresholds.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Admin != nil {
+		if err := c.Admin.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.HotReload != nil {
+		if err := c.HotReload.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.FailureDomains != nil {
+		if err := c.FailureDomains.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Sender.ClosedLoop != nil {
+		if err := c.Sender.ClosedLoop.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Diagnostics != nil {
+		if err := c.Diagnostics.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Backfill != nil {
+		if err := c.Backfill.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Benchmark != nil {
+		if err := c.Benchmark.validate(c); err != nil {
+			return err
+		}
+	}
+
+	if c.Logging != nil {
+		if err := c.Logging.validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, w := range c.Report.Writers {
+		if _, err := newReportWriter(w); err != nil {
+			return invalidErr(fmt.Sprintf("report.writers[%d]", i), err)
+		}
+	}
+
+	if c.Report.Interim != nil {
+		if err := c.Report.Interim.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Report.Kubernetes != nil {
+		if err := c.Report.Kubernetes.validate(); err != nil {
+			return err
+		}
+	}
+
+	if c.Report.ThroughputInterval != "" {
+		c.Report.ParsedThroughputInterval, err = time.ParseDuration(c.Report.ThroughputInterval)
+		if err != nil {
+			return invalidErr("report.throughputInterval", err)
+		}
+		if c.Report.ParsedThroughputInterval <= 0 {
+			return invalidErr("report.throughputInterval", errors.New("must be greater than 0"))
+		}
+	}
+	if c.Report.Limits != nil {
+		if err := c.Report.Limits.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Report.LatencyHistogram != nil {
+		if err := c.Report.LatencyHistogram.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Report.EventLog != nil {
+		if err := c.Report.EventLog.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Report.LostEvents != nil {
+		if err := c.Report.LostEvents.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Report.Interchange != nil {
+		if err := c.Report.Interchange.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Report.Anomalies != nil {
+		if err := c.Report.Anomalies.validate(c); err != nil {
+			return err
+		}
+	}
+	if c.Report.Upload != nil {
+		if err := c.Report.Upload.validate(); err != nil {
+			return err
+		}
+	}
+	if c.Report.Progress != nil {
+		if err := c.Report.Progress.validate(); err != nil {
+			return err
+		}
+	}
+	for i := range c.Report.Webhooks {
+		if err := c.Report.Webhooks[i].validate(fmt.Sprintf("report.webhooks[%d]", i)); err != nil {
+			return err
+		}
+	}
+
+	if len(c.Streams) > 0 {
+		if err := validateStreams(c); err != nil {
+			return err
+		}
+	}
+
 	return err
 }
 
+func (c *DistributedConfig) validate() error {
+	switch c.Role {
+	case DistributedRoleAggregator, DistributedRoleController:
+		if c.Port <= 0 {
+			return invalidErr("distributed.port", errors.New("port must be greater than 0"))
+		}
+		if c.ExpectedInstances <= 0 {
+			return invalidErr("distributed.expectedInstances", errors.New("expected instances must be greater than 0"))
+		}
+	case DistributedRoleInstance, DistributedRoleAgent:
+		if u, err := url.Parse(c.AggregatorURL); err != nil {
+			return invalidErr("distributed.aggregatorURL", err)
+		} else if !u.IsAbs() {
+			return invalidErr("distributed.aggregatorURL", errors.New("aggregator URL must be an absolute URL"))
+		}
+		if c.Instance == "" {
+			c.Instance = defaultInstance()
+		}
+	default:
+		return invalidErr("distributed.role", fmt.Errorf("unknown role %q, expected one of %v", c.Role, []DistributedRole{DistributedRoleAggregator, DistributedRoleInstance, DistributedRoleController, DistributedRoleAgent}))
+	}
+	return c.validateAgentRole()
+}
+
+func isValidExtensionName(name string) bool {
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z') && !(c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
 func invalidErr(field string, err error) error {
 	return fmt.Errorf("invalid %s: %w", field, err)
 }
@@ -11,6 +11,11 @@ import (
 
 func TestFileConfig(t *testing.T) {
 
+	tenExpired := 10
+	halfPercent := 0.5
+	fivePercent := 5
+	oneDuplicate := 1
+
 	tests := []struct {
 		name    string
 		r       io.Reader
@@ -43,36 +48,158 @@ timeout: 1m
 					Timeout:       "1m",
 					ParsedTimeout: time.Minute,
 				},
-				Duration:       "1m",
-				ParsedDuration: time.Minute,
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
 			},
 			wantErr: false,
 		},
 		{
-			name: "invalid target",
+			name: "ordered default partition key extension",
 			r: strings.NewReader(`
 sender:
-  target: /target
+  target: http://localhost:8080
   frequency: 1000
   workers: 100
-  keepAlive: true
 receiver:
   port: 8080
   timeout: 1m
+ordered:
+  numPartitionKeys: 10
 duration: 1m
-timeout: 1m
 `),
 			want: Config{
 				Sender: SenderConfig{
-					Target:             "/target",
+					Target:             "http://localhost:8080",
 					FrequencyPerSecond: 1000,
 					Workers:            100,
-					KeepAlive:          true,
 				},
 				Receiver: ReceiverConfig{
 					Port:          8080,
 					Timeout:       "1m",
-					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+					ParsedTimeout: time.Minute,
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: DefaultPartitionKeyExtension,
+					PartitionKeyStrategy:  PartitionKeyStrategyRandom,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "ordered custom partition key extension",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 10
+  partitionKeyExtension: orderingkey
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: "orderingkey",
+					PartitionKeyStrategy:  PartitionKeyStrategyRandom,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "ordered zipf partition key strategy",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 10
+  partitionKeyStrategy: zipf
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: DefaultPartitionKeyExtension,
+					PartitionKeyStrategy:  PartitionKeyStrategyZipf,
+					ZipfExponent:          DefaultZipfExponent,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "ordered zipf exponent too small",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 10
+  partitionKeyStrategy: zipf
+  zipfExponent: 1
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: DefaultPartitionKeyExtension,
+					PartitionKeyStrategy:  PartitionKeyStrategyZipf,
+					ZipfExponent:          1,
 				},
 				Duration:       "1m",
 				ParsedDuration: time.Minute,
@@ -80,91 +207,1167 @@ timeout: 1m
 			wantErr: true,
 		},
 		{
-			name: "invalid frequency",
+			name: "ordered negative tolerance window",
 			r: strings.NewReader(`
 sender:
   target: http://localhost:8080
-  frequency: -1
+  frequency: 1000
   workers: 100
-  keepAlive: true
 receiver:
   port: 8080
   timeout: 1m
+ordered:
+  numPartitionKeys: 10
+  toleranceWindow: -1
 duration: 1m
-timeout: 1m
 `),
 			want: Config{
 				Sender: SenderConfig{
 					Target:             "http://localhost:8080",
-					FrequencyPerSecond: -1,
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: DefaultPartitionKeyExtension,
+					ToleranceWindow:       -1,
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ordered invalid partition key extension",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 10
+  partitionKeyExtension: ordering-key
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Ordered: &OrderedConfig{
+					NumPartitionKeys:      10,
+					PartitionKeyExtension: "ordering-key",
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "exactly once delivery guarantee",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+deliveryGuarantee: exactly-once
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
 					Workers:            100,
-					KeepAlive:          true,
 				},
 				Receiver: ReceiverConfig{
 					Port:          8080,
 					Timeout:       "1m",
-					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: ExactlyOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "duplicate budget with exactly once delivery guarantee",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+deliveryGuarantee: exactly-once
+verification:
+  duplicateBudget:
+    maxCount: 1
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: ExactlyOnce,
+				Verification: VerificationConfig{
+					Mode:            VerificationModeFull,
+					DuplicateBudget: &BudgetConfig{MaxCount: &oneDuplicate},
 				},
-				Duration:       "1m",
 				ParsedDuration: time.Minute,
 			},
 			wantErr: true,
 		},
 		{
-			name: "invalid duration",
+			name: "unknown delivery guarantee",
 			r: strings.NewReader(`
 sender:
   target: http://localhost:8080
   frequency: 1000
   workers: 100
-  keepAlive: true
 receiver:
   port: 8080
   timeout: 1m
-duration: 1H
-timeout: 1m
+duration: 1m
+deliveryGuarantee: once
 `),
 			want: Config{
 				Sender: SenderConfig{
 					Target:             "http://localhost:8080",
 					FrequencyPerSecond: 1000,
 					Workers:            100,
-					KeepAlive:          true,
 				},
 				Receiver: ReceiverConfig{
 					Port:          8080,
 					Timeout:       "1m",
-					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+					ParsedTimeout: time.Minute,
 				},
-				Duration:       "1H",
-				ParsedDuration: 0,
+				Duration:          "1m",
+				DeliveryGuarantee: "once",
+				ParsedDuration:    time.Minute,
 			},
 			wantErr: true,
 		},
 		{
-			name: "invalid timeout",
+			name: "streaming verification mode",
 			r: strings.NewReader(`
 sender:
   target: http://localhost:8080
   frequency: 1000
   workers: 100
-  keepAlive: true
 receiver:
   port: 8080
-  timeout: abc
-duration: 1h
+  timeout: 1m
+duration: 1m
+verification:
+  mode: streaming
 `),
 			want: Config{
 				Sender: SenderConfig{
 					Target:             "http://localhost:8080",
 					FrequencyPerSecond: 1000,
 					Workers:            100,
-					KeepAlive:          true,
 				},
 				Receiver: ReceiverConfig{
 					Port:          8080,
-					Timeout:       "abc",
-					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeStreaming, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "fault responses percentages above 100",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+  fault:
+    responses:
+    - statusCode: 500
+      percentage: 60
+    - statusCode: 429
+      percentage: 50
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+					ReceiverFaultConfig: &ReceiverFaultConfig{
+						Responses: []ReceiverFaultResponseConfig{
+							{StatusCode: 500, Percentage: 60},
+							{StatusCode: 429, Percentage: 50},
+						},
+					},
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "ramp load profile",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 100
+  workers: 100
+  loadProfile:
+    type: ramp
+    peakFrequency: 1000
+    duration: 30s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 100,
+					Workers:            100,
+					LoadProfile: &LoadProfileConfig{
+						Type:           LoadProfileRamp,
+						StartFrequency: 100,
+						PeakFrequency:  1000,
+						Duration:       "30s",
+						ParsedDuration: 30 * time.Second,
+					},
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "interim reports",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+report:
+  interim:
+    interval: 30s
+    path: /tmp/interim.jsonl
+  throughputInterval: 5s
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				Report: ReportConfig{
+					Interim:                  &InterimReportConfig{Interval: "30s", Path: "/tmp/interim.jsonl", ParsedInterval: 30 * time.Second},
+					ThroughputInterval:       "5s",
+					ParsedThroughputInterval: 5 * time.Second,
+				},
+				ParsedDuration: time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid interim reports interval",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+report:
+  interim:
+    interval: 0s
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				Report: ReportConfig{
+					Interim: &InterimReportConfig{Interval: "0s"},
+				},
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid throughput interval",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+report:
+  throughputInterval: -1s
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				Report:            ReportConfig{ThroughputInterval: "-1s", ParsedThroughputInterval: -time.Second},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max expired events without max delivery age",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  maxExpiredEvents: 10
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore, MaxExpiredEvents: &tenExpired},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max delivery age",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  maxDeliveryAge: 30s
+  maxExpiredEvents: 10
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification: VerificationConfig{
+					Mode:                 VerificationModeFull,
+					UnexpectedEvents:     UnexpectedEventsIgnore,
+					MaxDeliveryAge:       "30s",
+					MaxExpiredEvents:     &tenExpired,
+					ParsedMaxDeliveryAge: 30 * time.Second,
+				},
+				ParsedDuration: time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "quiet period longer than the timeout",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+  quietPeriod: 2m
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:              8080,
+					Timeout:           "1m",
+					QuietPeriod:       "2m",
+					ParsedTimeout:     time.Minute,
+					ParsedQuietPeriod: 2 * time.Minute,
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "grace period longer than the timeout",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+  gracePeriod: 2m
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:              8080,
+					Timeout:           "1m",
+					GracePeriod:       "2m",
+					ParsedTimeout:     time.Minute,
+					ParsedGracePeriod: 2 * time.Minute,
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "grpc sender with batches",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  protocol: grpc
+  batchSize: 10
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					Protocol:           ProtocolGRPC,
+					BatchSize:          10,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "thresholds",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+thresholds:
+  maxLostPercentage: 0.5
+  maxP99Latency: 2s
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				Thresholds: &ThresholdsConfig{
+					MaxLostPercentage:   &halfPercent,
+					MaxP99Latency:       "2s",
+					ParsedMaxP99Latency: 2 * time.Second,
+				},
+				ParsedDuration: time.Minute,
+			},
+			wantErr: false,
+		},
+		{
+			name: "empty state path",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+state: {}
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull},
+				State:             &StateConfig{},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown verification mode",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  mode: partial
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: "partial"},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid target",
+			r: strings.NewReader(`
+sender:
+  target: /target
+  frequency: 1000
+  workers: 100
+  keepAlive: true
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+timeout: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "/target",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					KeepAlive:          true,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid frequency",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: -1
+  workers: 100
+  keepAlive: true
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+timeout: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: -1,
+					Workers:            100,
+					KeepAlive:          true,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+				},
+				Duration:       "1m",
+				ParsedDuration: time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid duration",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  keepAlive: true
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1H
+timeout: 1m
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					KeepAlive:          true,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+				},
+				Duration:       "1H",
+				ParsedDuration: 0,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid timeout",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  keepAlive: true
+receiver:
+  port: 8080
+  timeout: abc
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					KeepAlive:          true,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "abc",
+					ParsedTimeout: 0, // it isn't set since we check the invalid field before checking timeout
+				},
+				Duration:       "1h",
+				ParsedDuration: time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max lost percentage with at least once delivery guarantee",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+  maxLostPercentage: 5
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:              8080,
+					Timeout:           "1m",
+					MaxLostPercentage: &fivePercent,
+					ParsedTimeout:     time.Minute,
+				},
+				Duration:          "1h",
+				DeliveryGuarantee: AtLeastOnce,
+				ParsedDuration:    time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "sender tuning",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 10
+  maxWorkers: 100
+  maxIdleConnections: 50
+  maxConnections: 200
+  http2: true
+  requestTimeout: 5s
+  startDelay: 2s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:               "http://localhost:8080",
+					FrequencyPerSecond:   1000,
+					Workers:              10,
+					MaxWorkers:           100,
+					MaxIdleConnections:   50,
+					MaxConnections:       200,
+					HTTP2:                true,
+					RequestTimeout:       "5s",
+					ParsedRequestTimeout: 5 * time.Second,
+					StartDelay:           "2s",
+					ParsedStartDelay:     2 * time.Second,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1h",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Hour,
+			},
+		},
+		{
+			name: "max workers lower than workers",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  maxWorkers: 10
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					MaxWorkers:         10,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Duration:       "1h",
+				ParsedDuration: time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "send deadline",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 10
+  requestTimeout: 5s
+  sendDeadline: 30s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:               "http://localhost:8080",
+					FrequencyPerSecond:   1000,
+					Workers:              10,
+					RequestTimeout:       "5s",
+					ParsedRequestTimeout: 5 * time.Second,
+					SendDeadline:         "30s",
+					ParsedSendDeadline:   30 * time.Second,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1h",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore},
+				ParsedDuration:    time.Hour,
+			},
+		},
+		{
+			name: "send deadline lower than request timeout",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 10
+  sendDeadline: 5s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            10,
+					SendDeadline:       "5s",
+					ParsedSendDeadline: 5 * time.Second,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Duration:       "1h",
+				ParsedDuration: time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "sequential ids",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  sequentialIds: true
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  maxListedIds: 100
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					SequentialIDs:      true,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, UnexpectedEvents: UnexpectedEventsIgnore, MaxListedIDs: 100},
+				ParsedDuration:    time.Minute,
+			},
+		},
+		{
+			name: "negative max listed ids",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  maxListedIds: -1
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, MaxListedIDs: -1},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "intern ids in streaming verification mode",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  mode: streaming
+ingest:
+  bufferSize: 100000
+  internIds: true
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeStreaming},
+				Ingest:            &IngestConfig{BufferSize: 100000, InternIDs: true},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "max matched ids in full verification mode",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+verification:
+  maxMatchedIds: 10
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+				},
+				Receiver: ReceiverConfig{
+					Port:          8080,
+					Timeout:       "1m",
+					ParsedTimeout: time.Minute,
+				},
+				Duration:          "1m",
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: VerificationModeFull, MaxMatchedIDs: 10},
+				ParsedDuration:    time.Minute,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative start delay",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  startDelay: -1s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					StartDelay:         "-1s",
+					ParsedStartDelay:   -time.Second,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Duration:       "1h",
+				ParsedDuration: time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "zero request timeout",
+			r: strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 1000
+  workers: 100
+  requestTimeout: 0s
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "http://localhost:8080",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					RequestTimeout:     "0s",
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
+				},
+				Duration:       "1h",
+				ParsedDuration: time.Hour,
+			},
+			wantErr: true,
+		},
+		{
+			name: "http2 with mqtt protocol",
+			r: strings.NewReader(`
+sender:
+  target: tcp://localhost:1883
+  frequency: 1000
+  workers: 100
+  protocol: mqtt
+  http2: true
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1h
+`),
+			want: Config{
+				Sender: SenderConfig{
+					Target:             "tcp://localhost:1883",
+					FrequencyPerSecond: 1000,
+					Workers:            100,
+					Protocol:           ProtocolMQTT,
+					HTTP2:              true,
+				},
+				Receiver: ReceiverConfig{
+					Port:    8080,
+					Timeout: "1m",
 				},
 				Duration:       "1h",
 				ParsedDuration: time.Hour,
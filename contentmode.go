@@ -0,0 +1,192 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// ContentMode is the HTTP content mode events are sent or received in.
+type ContentMode string
+
+const (
+	// ContentModeStructured carries the whole event in the body as application/cloudevents+json.
+	ContentModeStructured ContentMode = "structured"
+	// ContentModeBinary carries attributes in ce- headers and the data as is in the body.
+	ContentModeBinary ContentMode = "binary"
+	// ContentModeMixed sends ContentModeConfig.BinaryPercentage of events in the binary content mode and the others in
+	// the structured content mode.
+	ContentModeMixed ContentMode = "mixed"
+)
+
+// ContentModeConfig configures the HTTP content mode of sent events, the receiver records the content mode each event
+// arrived in.
+type ContentModeConfig struct {
+	// Mode is one of ContentModeStructured, ContentModeBinary or ContentModeMixed.
+	Mode ContentMode `json:"mode" yaml:"mode"`
+	// BinaryPercentage is the percentage of events sent in the binary content mode with ContentModeMixed, events are
+	// assigned a content mode by ID.
+	BinaryPercentage float64 `json:"binaryPercentage" yaml:"binaryPercentage"`
+	// Verify fails the verification when events are received in a different content mode than the one they have
+	// been sent in.
+	Verify bool `json:"verify" yaml:"verify"`
+}
+
+func (c *ContentModeConfig) validate(sender *SenderConfig) error {
+	switch c.Mode {
+	case ContentModeStructured, ContentModeBinary, ContentModeMixed:
+	default:
+		return invalidErr("sender.contentMode.mode", fmt.Errorf("unknown content mode %q, expected one of %v", c.Mode, []ContentMode{ContentModeStructured, ContentModeBinary, ContentModeMixed}))
+	}
+	if c.Mode != ContentModeMixed && c.BinaryPercentage != 0 {
+		return invalidErr("sender.contentMode.binaryPercentage", fmt.Errorf("can only be used with the %s content mode", ContentModeMixed))
+	}
+	if c.BinaryPercentage < 0 || c.BinaryPercentage > 100 {
+		return invalidErr("sender.contentMode.binaryPercentage", fmt.Errorf("%v must be between 0 and 100", c.BinaryPercentage))
+	}
+	if sender.Protocol != "" && sender.Protocol != ProtocolHTTP {
+		return invalidErr("sender.contentMode", fmt.Errorf("content modes are only supported with the %s protocol", ProtocolHTTP))
+	}
+	if c.Mode != ContentModeStructured && sender.BatchSize > 1 {
+		return invalidErr("sender.contentMode", errors.New("batches cannot be sent in the binary content mode"))
+	}
+	return nil
+}
+
+// modeOf returns the content mode the event with the given ID is sent in.
+func (c *ContentModeConfig) modeOf(id string) ContentMode {
+	if c.Mode != ContentModeMixed {
+		return c.Mode
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(id))
+	if float64(h.Sum32()%10000) < c.BinaryPercentage*100 {
+		return ContentModeBinary
+	}
+	return ContentModeStructured
+}
+
+// binaryRequestBody sets the attributes of the given event as headers of the binary content mode and returns the body
+// carrying its data.
+func binaryRequestBody(hdr http.Header, e *ce.Event) ([]byte, error) {
+	req := &http.Request{Header: hdr}
+	if err := cehttp.WriteRequest(binding.WithForceBinary(context.Background()), binding.ToMessage(e), req); err != nil {
+		return nil, err
+	}
+	if req.Body == nil {
+		return nil, nil
+	}
+	defer req.Body.Close()
+	return io.ReadAll(req.Body)
+}
+
+// requestContentMode returns the HTTP content mode of the given request, it is empty when the event hasn't been
+// received in the binary or structured content mode, for example with protocols other than HTTP.
+func requestContentMode(r *http.Request) ContentMode {
+	if r.Header.Get("Ce-Specversion") != "" {
+		return ContentModeBinary
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get(cehttp.ContentType)); mediaType == ce.ApplicationCloudEventsJSON {
+		return ContentModeStructured
+	}
+	return ""
+}
+
+// ContentModeReport reports the content mode events have been sent and received in.
+type ContentModeReport struct {
+	// SentCount is the number of sent events by content mode.
+	SentCount map[ContentMode]int `json:"sentCount"`
+	// ReceivedCount is the number of received events by content mode, including duplicates.
+	ReceivedCount map[ContentMode]int `json:"receivedCount"`
+	// MismatchedCount is the number of deliveries in a different content mode than the one the event has been sent
+	// in.
+	MismatchedCount int `json:"mismatchedCount"`
+	// MismatchedEventsByPartitionKey collects events received in a different content mode than the one they have
+	// been sent in by partition key.
+	MismatchedEventsByPartitionKey map[string][]string `json:"mismatchedEvents,omitempty"`
+}
+
+type contentModeState struct {
+	sent       map[ContentMode]int
+	received   map[ContentMode]int
+	mismatched map[string][]string
+}
+
+func newContentModeState(config *ContentModeConfig) *contentModeState {
+	if config == nil {
+		return nil
+	}
+	return &contentModeState{
+		sent:       make(map[ContentMode]int),
+		received:   make(map[ContentMode]int),
+		mismatched: make(map[string][]string),
+	}
+}
+
+// recordSentContentMode records the content mode of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentContentMode(e *ce.Event) {
+	if s.contentModes == nil {
+		return
+	}
+	s.contentModes.sent[s.config.Sender.ContentMode.modeOf(e.ID())]++
+}
+
+// recordReceivedContentMode records the content mode of the given received event, it must be called while holding
+// the lock.
+func (s *StateManager) recordReceivedContentMode(e *ReceivedEvent) {
+	if s.contentModes == nil || e.ContentMode == "" {
+		return
+	}
+	s.contentModes.received[e.ContentMode]++
+	if e.ContentMode != s.config.Sender.ContentMode.modeOf(e.Event.ID()) {
+		insert(&e.Event, s.contentModes.mismatched, &s.stateManagerConfig)
+	}
+}
+
+// contentModeReport sets the content mode report, it must be called while holding the lock.
+func (s *StateManager) contentModeReport(r *Report) {
+	if s.contentModes == nil {
+		return
+	}
+	cr := &ContentModeReport{
+		SentCount:     make(map[ContentMode]int, len(s.contentModes.sent)),
+		ReceivedCount: make(map[ContentMode]int, len(s.contentModes.received)),
+	}
+	for m, n := range s.contentModes.sent {
+		cr.SentCount[m] = n
+	}
+	for m, n := range s.contentModes.received {
+		cr.ReceivedCount[m] = n
+	}
+	for k, v := range s.contentModes.mismatched {
+		if cr.MismatchedEventsByPartitionKey == nil {
+			cr.MismatchedEventsByPartitionKey = make(map[string][]string, len(s.contentModes.mismatched))
+		}
+		mismatched := make([]string, len(v))
+		copy(mismatched, v)
+		sort.Strings(mismatched)
+		cr.MismatchedEventsByPartitionKey[k] = mismatched
+		cr.MismatchedCount += len(mismatched)
+	}
+	r.ContentModes = cr
+}
+
+// verifyContentModes verifies events have been received in the content mode they have been sent in, when enabled.
+func verifyContentModes(config Config, report Report) error {
+	if config.Sender.ContentMode == nil || !config.Sender.ContentMode.Verify || report.ContentModes == nil {
+		return nil
+	}
+	if report.ContentModes.MismatchedCount > 0 {
+		return fmt.Errorf("%d events received in a different content mode than the one they have been sent in", report.ContentModes.MismatchedCount)
+	}
+	return nil
+}
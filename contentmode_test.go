@@ -0,0 +1,191 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestContentModeConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  ContentModeConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{
+			name:   "binary",
+			config: ContentModeConfig{Mode: ContentModeBinary},
+		},
+		{
+			name:   "mixed",
+			config: ContentModeConfig{Mode: ContentModeMixed, BinaryPercentage: 30},
+		},
+		{
+			name:   "structured batches",
+			config: ContentModeConfig{Mode: ContentModeStructured},
+			sender: SenderConfig{BatchSize: 10},
+		},
+		{
+			name:    "unknown mode",
+			config:  ContentModeConfig{Mode: "batched"},
+			wantErr: true,
+		},
+		{
+			name:    "percentage without mixed mode",
+			config:  ContentModeConfig{Mode: ContentModeBinary, BinaryPercentage: 30},
+			wantErr: true,
+		},
+		{
+			name:    "percentage out of range",
+			config:  ContentModeConfig{Mode: ContentModeMixed, BinaryPercentage: 101},
+			wantErr: true,
+		},
+		{
+			name:    "binary batches",
+			config:  ContentModeConfig{Mode: ContentModeMixed, BinaryPercentage: 50},
+			sender:  SenderConfig{BatchSize: 10},
+			wantErr: true,
+		},
+		{
+			name:    "other protocol",
+			config:  ContentModeConfig{Mode: ContentModeBinary},
+			sender:  SenderConfig{Protocol: ProtocolMQTT},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.sender); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestContentModeOf(t *testing.T) {
+
+	config := ContentModeConfig{Mode: ContentModeMixed, BinaryPercentage: 25}
+	binary := 0
+	for i := 0; i < 10000; i++ {
+		id := uuid.New().String()
+		mode := config.modeOf(id)
+		if mode != config.modeOf(id) {
+			t.Fatalf("expected content mode of %s to be stable", id)
+		}
+		if mode == ContentModeBinary {
+			binary++
+		}
+	}
+	if binary < 2000 || binary > 3000 {
+		t.Errorf("expected about 2500 events in the binary content mode, got %d", binary)
+	}
+
+	for _, mode := range []ContentMode{ContentModeBinary, ContentModeStructured} {
+		if got := (&ContentModeConfig{Mode: mode}).modeOf("1"); got != mode {
+			t.Errorf("expected %s, got %s", mode, got)
+		}
+	}
+}
+
+func TestNewTargeterGeneratorContentMode(t *testing.T) {
+
+	for _, mode := range []ContentMode{ContentModeBinary, ContentModeStructured} {
+		t.Run(string(mode), func(t *testing.T) {
+			out := make(chan ce.Event, 1)
+			config := Config{Sender: SenderConfig{Target: "http://localhost:9090", ContentMode: &ContentModeConfig{Mode: mode}}}
+			f := NewTargeterGenerator(config, uuid.New, out)
+
+			target := &vegeta.Target{}
+			if err := f(target); err != nil {
+				t.Fatal(err)
+			}
+			sent := <-out
+
+			req, err := http.NewRequest(target.Method, target.URL, io.NopCloser(bytes.NewReader(target.Body)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header = target.Header
+
+			if got := requestContentMode(req); got != mode {
+				t.Errorf("expected content mode %s, got %s", mode, got)
+			}
+			if mode == ContentModeBinary && req.Header.Get("Ce-Id") != sent.ID() {
+				t.Errorf("expected Ce-Id header %s, got %v", sent.ID(), req.Header)
+			}
+			events, err := eventsFromRequest(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].ID() != sent.ID() || !bytes.Equal(events[0].Data(), sent.Data()) {
+				t.Errorf("expected event %s, got %v", sent, events)
+			}
+		})
+	}
+}
+
+func TestStateManagerContentModes(t *testing.T) {
+
+	config := &ContentModeConfig{Mode: ContentModeMixed, BinaryPercentage: 50}
+	sm := newTestStateManager(t, Config{Sender: SenderConfig{ContentMode: config}})
+
+	var ids []string
+	for i := 0; i < 10; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		ids = append(ids, e.ID())
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+
+	want := &ContentModeReport{
+		SentCount:                      map[ContentMode]int{},
+		ReceivedCount:                  map[ContentMode]int{},
+		MismatchedCount:                1,
+		MismatchedEventsByPartitionKey: map[string][]string{unknownPartitionKey: {ids[0]}},
+	}
+	for i, id := range ids {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		mode := config.modeOf(id)
+		want.SentCount[mode]++
+		if i == 0 {
+			// The broker changed the content mode of the first event.
+			mode = ContentModeBinary
+			if config.modeOf(id) == ContentModeBinary {
+				mode = ContentModeStructured
+			}
+		}
+		want.ReceivedCount[mode]++
+		sm.lock.Lock()
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now(), ContentMode: mode})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	if diff := cmp.Diff(want, report.ContentModes); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if err := verifyContentModes(Config{Sender: SenderConfig{ContentMode: config}}, report); err != nil {
+		t.Errorf("expected mismatches to be reported only, got %v", err)
+	}
+	config.Verify = true
+	if err := verifyContentModes(Config{Sender: SenderConfig{ContentMode: config}}, report); err == nil {
+		t.Error("expected mismatched content modes to fail the verification")
+	}
+}
@@ -0,0 +1,195 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"sort"
+	"strings"
+)
+
+const (
+	// ContentTypeAssertionDataContentType is the assertion of the datacontenttype attribute of received events.
+	ContentTypeAssertionDataContentType = "datacontenttype"
+	// ContentTypeAssertionContentType is the assertion of the HTTP Content-Type header of received requests.
+	ContentTypeAssertionContentType = "contentType"
+	// ContentTypeAssertionCharset is the assertion of the charset of the HTTP Content-Type header of received
+	// requests.
+	ContentTypeAssertionCharset = "charset"
+)
+
+// ContentTypesConfig asserts the content type of each received event, to catch content negotiation bugs of the system
+// under test, like events re-encoded or relabeled in transit.
+//
+// Media types are compared case-insensitively, the parameters of the expected media type must be present with the
+// same values, other parameters are ignored.
+type ContentTypesConfig struct {
+	// DataContentType is the expected datacontenttype attribute of received events, for example application/json.
+	DataContentType string `json:"datacontenttype" yaml:"datacontenttype"`
+	// ContentType is the expected HTTP Content-Type header of received requests, for example
+	// application/cloudevents+json for the structured content mode.
+	ContentType string `json:"contentType" yaml:"contentType"`
+	// Charset is the expected character encoding of received requests, the charset parameter of the HTTP
+	// Content-Type header, for example utf-8. Requests without charset don't match.
+	Charset string `json:"charset" yaml:"charset"`
+}
+
+func (c *ContentTypesConfig) validate(receiver *ReceiverConfig) error {
+	if c.DataContentType == "" && c.ContentType == "" && c.Charset == "" {
+		return invalidErr("receiver.contentTypes", errors.New("at least one of datacontenttype, contentType or charset must be specified"))
+	}
+	if c.DataContentType != "" {
+		if _, _, err := mime.ParseMediaType(c.DataContentType); err != nil {
+			return invalidErr("receiver.contentTypes.datacontenttype", err)
+		}
+	}
+	if c.ContentType != "" || c.Charset != "" {
+		if receiver.Protocol != "" && receiver.Protocol != ProtocolHTTP {
+			return invalidErr("receiver.contentTypes", fmt.Errorf("contentType and charset are only supported with the %s protocol", ProtocolHTTP))
+		}
+	}
+	if c.ContentType != "" {
+		if _, _, err := mime.ParseMediaType(c.ContentType); err != nil {
+			return invalidErr("receiver.contentTypes.contentType", err)
+		}
+	}
+	return nil
+}
+
+// matchesMediaType returns true when the given media type matches the expected one.
+func matchesMediaType(expected, got string) bool {
+	expectedType, expectedParams, err := mime.ParseMediaType(expected)
+	if err != nil {
+		return false
+	}
+	gotType, gotParams, err := mime.ParseMediaType(got)
+	if err != nil || !strings.EqualFold(expectedType, gotType) {
+		return false
+	}
+	for k, v := range expectedParams {
+		if !strings.EqualFold(gotParams[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+// charset returns the charset parameter of the given content type.
+func charset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}
+
+// ContentTypesReport reports the deliveries whose content type doesn't match the expected one.
+type ContentTypesReport struct {
+	// CheckedCount is the number of checked deliveries, excluding failure responses and the dead-letter sink.
+	CheckedCount int `json:"checkedCount"`
+	// MismatchCount is the number of deliveries failing at least one assertion.
+	MismatchCount int `json:"mismatchCount"`
+	// Mismatches reports the mismatches of each assertion, like ContentTypeAssertionDataContentType.
+	Mismatches map[string]ContentTypeMismatchReport `json:"mismatches,omitempty"`
+}
+
+// ContentTypeMismatchReport reports the mismatches of an assertion.
+type ContentTypeMismatchReport struct {
+	Expected string `json:"expected"`
+	Count    int    `json:"count"`
+	// Values counts the mismatching values by value, an empty value is a missing one.
+	Values               map[string]int      `json:"values"`
+	EventsByPartitionKey map[string][]string `json:"events"`
+}
+
+// contentTypesState tracks the deliveries whose content type doesn't match the expected one.
+type contentTypesState struct {
+	config     *ContentTypesConfig
+	checked    int
+	mismatches int
+	assertions map[string]*ContentTypeMismatchReport
+}
+
+func newContentTypesState(config *ContentTypesConfig) *contentTypesState {
+	if config == nil {
+		return nil
+	}
+	return &contentTypesState{config: config, assertions: make(map[string]*ContentTypeMismatchReport)}
+}
+
+// recordContentTypes checks the content type of the given delivery, it must be called while holding the lock.
+func (s *StateManager) recordContentTypes(e *ReceivedEvent) {
+	ct := s.contentTypes
+	if ct == nil {
+		return
+	}
+	ct.checked++
+
+	mismatched := false
+	mismatch := func(assertion, expected, got string) {
+		r, ok := ct.assertions[assertion]
+		if !ok {
+			r = &ContentTypeMismatchReport{Expected: expected, Values: make(map[string]int), EventsByPartitionKey: make(map[string][]string)}
+			ct.assertions[assertion] = r
+		}
+		r.Count++
+		r.Values[got]++
+		insert(&e.Event, r.EventsByPartitionKey, &s.stateManagerConfig)
+		mismatched = true
+	}
+	if expected := ct.config.DataContentType; expected != "" && !matchesMediaType(expected, e.Event.DataContentType()) {
+		mismatch(ContentTypeAssertionDataContentType, expected, e.Event.DataContentType())
+	}
+	if expected := ct.config.ContentType; expected != "" && !matchesMediaType(expected, e.ContentType) {
+		mismatch(ContentTypeAssertionContentType, expected, e.ContentType)
+	}
+	if expected := ct.config.Charset; expected != "" && !strings.EqualFold(expected, charset(e.ContentType)) {
+		mismatch(ContentTypeAssertionCharset, expected, charset(e.ContentType))
+	}
+	if mismatched {
+		ct.mismatches++
+	}
+}
+
+// contentTypesReport sets the content types section of the report, it must be called while holding the lock.
+func (s *StateManager) contentTypesReport(r *Report) {
+	ct := s.contentTypes
+	if ct == nil {
+		return
+	}
+	report := &ContentTypesReport{CheckedCount: ct.checked, MismatchCount: ct.mismatches}
+	if len(ct.assertions) > 0 {
+		report.Mismatches = make(map[string]ContentTypeMismatchReport, len(ct.assertions))
+		for assertion, m := range ct.assertions {
+			events := make(map[string][]string, len(m.EventsByPartitionKey))
+			for pk, ids := range m.EventsByPartitionKey {
+				ids, _ = removeDuplicates(ids)
+				sort.Strings(ids)
+				events[pk] = ids
+			}
+			values := make(map[string]int, len(m.Values))
+			for v, n := range m.Values {
+				values[v] = n
+			}
+			report.Mismatches[assertion] = ContentTypeMismatchReport{Expected: m.Expected, Count: m.Count, Values: values, EventsByPartitionKey: events}
+		}
+	}
+	r.ContentTypes = report
+}
+
+// verifyContentTypes verifies the content type of received events matches the expected one, when enabled.
+func verifyContentTypes(report Report) error {
+	if report.ContentTypes == nil || report.ContentTypes.MismatchCount == 0 {
+		return nil
+	}
+	assertions := make([]string, 0, len(report.ContentTypes.Mismatches))
+	for assertion := range report.ContentTypes.Mismatches {
+		assertions = append(assertions, assertion)
+	}
+	sort.Strings(assertions)
+	return fmt.Errorf("%d of %d deliveries with an unexpected content type, failed assertions %v",
+		report.ContentTypes.MismatchCount,
+		report.ContentTypes.CheckedCount,
+		assertions,
+	)
+}
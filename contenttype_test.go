@@ -0,0 +1,125 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestContentTypesConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ContentTypesConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{name: "datacontenttype", config: ContentTypesConfig{DataContentType: "application/json"}},
+		{name: "content type and charset", config: ContentTypesConfig{ContentType: "application/cloudevents+json", Charset: "utf-8"}, receiver: ReceiverConfig{Protocol: ProtocolHTTP}},
+		{name: "empty", config: ContentTypesConfig{}, wantErr: true},
+		{name: "invalid datacontenttype", config: ContentTypesConfig{DataContentType: "application/json;;"}, wantErr: true},
+		{name: "invalid content type", config: ContentTypesConfig{ContentType: "/json"}, wantErr: true},
+		{name: "datacontenttype with grpc", config: ContentTypesConfig{DataContentType: "application/json"}, receiver: ReceiverConfig{Protocol: ProtocolGRPC}},
+		{name: "charset with grpc", config: ContentTypesConfig{Charset: "utf-8"}, receiver: ReceiverConfig{Protocol: ProtocolGRPC}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.receiver); (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestMatchesMediaType(t *testing.T) {
+	tests := []struct {
+		expected string
+		got      string
+		want     bool
+	}{
+		{expected: "application/json", got: "application/json", want: true},
+		{expected: "application/json", got: "Application/JSON; charset=utf-8", want: true},
+		{expected: "application/json; charset=utf-8", got: "application/json; charset=UTF-8", want: true},
+		{expected: "application/json; charset=utf-8", got: "application/json", want: false},
+		{expected: "application/json", got: "text/plain", want: false},
+		{expected: "application/json", got: "", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expected+" "+tt.got, func(t *testing.T) {
+			if got := matchesMediaType(tt.expected, tt.got); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStateManagerContentTypes(t *testing.T) {
+
+	config := Config{Receiver: ReceiverConfig{ContentTypes: &ContentTypesConfig{
+		DataContentType: "application/json",
+		ContentType:     "application/cloudevents+json",
+		Charset:         "utf-8",
+	}}}
+	sm := newTestStateManager(t, config)
+
+	event := func(id, dataContentType string) ce.Event {
+		e := ce.NewEvent()
+		e.SetID(id)
+		e.SetSource("sacura")
+		e.SetType("sacura.event")
+		e.SetDataContentType(dataContentType)
+		return e
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1", "application/json"), ContentType: "application/cloudevents+json; charset=utf-8"},
+		{Event: event("2", "text/plain"), ContentType: "application/cloudevents+json; charset=utf-8"},
+		{Event: event("3", "application/json"), ContentType: "application/json"},
+		{Event: event("4", "application/json"), ContentType: "application/cloudevents+json; charset=utf-8", Nacked: true},
+	} {
+		r := r
+		r.ReceivedAt = time.Now()
+		sm.lock.Lock()
+		sm.recordReceived(&r)
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := &ContentTypesReport{
+		CheckedCount:  3,
+		MismatchCount: 2,
+		Mismatches: map[string]ContentTypeMismatchReport{
+			ContentTypeAssertionDataContentType: {
+				Expected:             "application/json",
+				Count:                1,
+				Values:               map[string]int{"text/plain": 1},
+				EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2"}},
+			},
+			ContentTypeAssertionContentType: {
+				Expected:             "application/cloudevents+json",
+				Count:                1,
+				Values:               map[string]int{"application/json": 1},
+				EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"3"}},
+			},
+			ContentTypeAssertionCharset: {
+				Expected:             "utf-8",
+				Count:                1,
+				Values:               map[string]int{"": 1},
+				EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"3"}},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, report.ContentTypes); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if err := verifyContentTypes(report); err == nil || !strings.Contains(err.Error(), "2 of 3") {
+		t.Errorf("expected content type mismatches error, got %v", err)
+	}
+	if err := verifyContentTypes(Report{}); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
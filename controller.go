@@ -0,0 +1,354 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AgentRole is the part of the distributed config an agent runs.
+type AgentRole string
+
+const (
+	// AgentRoleSender only runs the sender, each sender agent sends at sender.frequency.
+	AgentRoleSender AgentRole = "sender"
+	// AgentRoleReceiver only runs the receiver.
+	AgentRoleReceiver AgentRole = "receiver"
+	// AgentRoleSenderReceiver runs both the sender and the receiver.
+	AgentRoleSenderReceiver AgentRole = "senderReceiver"
+)
+
+// The controller HTTP API extends the aggregator HTTP API with the paths coordinating agents, the bodies of requests
+// are JSON controllerRequests.
+const (
+	// controllerRegisterPath registers an agent with its role, it responds with the JSON config of the test once all
+	// agents registered.
+	controllerRegisterPath = "/register"
+	// controllerPhasePath responds once all agents reached the phase of the request.
+	controllerPhasePath = "/phase"
+
+	// controllerPhaseStart is reached by agents once their receiver is ready, senders start once all agents reached
+	// it.
+	controllerPhaseStart = "start"
+	// controllerPhaseStop is reached by agents once their sender finished, receive-only agents terminate once all
+	// agents reached it.
+	controllerPhaseStop = "stop"
+
+	// controllerRegisterInterval is the interval between registrations while the controller isn't reachable.
+	controllerRegisterInterval = time.Second
+)
+
+// controllerRequest is the body of the requests of agents coordinating with the controller.
+type controllerRequest struct {
+	Agent string    `json:"agent"`
+	Role  AgentRole `json:"role,omitempty"`
+	Phase string    `json:"phase,omitempty"`
+}
+
+func (c *DistributedConfig) validateAgentRole() error {
+	if c.Role != DistributedRoleAgent {
+		if c.AgentRole != "" {
+			return invalidErr("distributed.agentRole", fmt.Errorf("is only supported with the %s role", DistributedRoleAgent))
+		}
+		return nil
+	}
+	switch c.AgentRole {
+	case "":
+		c.AgentRole = AgentRoleSenderReceiver
+	case AgentRoleSender, AgentRoleReceiver, AgentRoleSenderReceiver:
+	default:
+		return invalidErr("distributed.agentRole", fmt.Errorf("unknown role %q, expected one of %v", c.AgentRole, []AgentRole{AgentRoleSender, AgentRoleReceiver, AgentRoleSenderReceiver}))
+	}
+	return nil
+}
+
+// controlPlane serves the controller HTTP API, events and metrics of agents are recorded by the aggregator.
+type controlPlane struct {
+	aggregator *aggregator
+	// config is the JSON config distributed to agents.
+	config   []byte
+	expected int
+
+	lock       sync.Mutex
+	agents     map[string]AgentRole
+	registered chan struct{}
+	phases     map[string]*controllerBarrier
+}
+
+// controllerBarrier is a phase agents wait for each other at.
+type controllerBarrier struct {
+	arrived map[string]struct{}
+	done    chan struct{}
+}
+
+func newControlPlane(config Config, a *aggregator) (*controlPlane, error) {
+	// Agents run the test as instances of the controller.
+	config.Distributed = nil
+	b, err := json.Marshal(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal the config of agents: %w", err)
+	}
+	return &controlPlane{
+		aggregator: a,
+		config:     b,
+		expected:   a.expectedInstances,
+		agents:     make(map[string]AgentRole, a.expectedInstances),
+		registered: make(chan struct{}),
+		phases:     make(map[string]*controllerBarrier),
+	}, nil
+}
+
+func (c *controlPlane) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != controllerRegisterPath && r.URL.Path != controllerPhasePath {
+		c.aggregator.ServeHTTP(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req controllerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("malformed controller request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.Agent == "" {
+		http.Error(w, "controller request without agent", http.StatusBadRequest)
+		return
+	}
+
+	var resp []byte
+	var err error
+	if r.URL.Path == controllerRegisterPath {
+		resp, err = c.register(r.Context(), req.Agent, req.Role)
+	} else {
+		err = c.awaitPhase(r.Context(), req.Agent, req.Phase)
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case resp != nil:
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(resp)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// register registers the given agent and returns the config once all agents registered, registering again is a
+// no-op so that agents retry registrations.
+func (c *controlPlane) register(ctx context.Context, agent string, role AgentRole) ([]byte, error) {
+	c.lock.Lock()
+	if _, ok := c.agents[agent]; !ok {
+		if len(c.agents) == c.expected {
+			c.lock.Unlock()
+			return nil, fmt.Errorf("all %d agents are registered", c.expected)
+		}
+		c.agents[agent] = role
+		logger(LogComponentState).Infow("Agent registered", "agent", agent, "role", role, "registered", len(c.agents), "expected", c.expected)
+		if len(c.agents) == c.expected {
+			close(c.registered)
+		}
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-c.registered:
+		return c.config, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// awaitPhase returns once all agents reached the given phase.
+func (c *controlPlane) awaitPhase(ctx context.Context, agent, phase string) error {
+	c.lock.Lock()
+	if _, ok := c.agents[agent]; !ok {
+		c.lock.Unlock()
+		return fmt.Errorf("agent %s isn't registered", agent)
+	}
+	b, ok := c.phases[phase]
+	if !ok {
+		b = &controllerBarrier{arrived: make(map[string]struct{}, c.expected), done: make(chan struct{})}
+		c.phases[phase] = b
+	}
+	if _, ok := b.arrived[agent]; !ok {
+		b.arrived[agent] = struct{}{}
+		if len(b.arrived) == c.expected {
+			logger(LogComponentState).Infow("All agents reached phase", "phase", phase)
+			close(b.done)
+		}
+	}
+	c.lock.Unlock()
+
+	select {
+	case <-b.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// controllerClient calls the controller HTTP API on behalf of an agent.
+type controllerClient struct {
+	url    string
+	agent  string
+	client *http.Client
+
+	lock   sync.Mutex
+	phases map[string]*controllerPhase
+}
+
+// controllerPhase is the call waiting for a phase.
+type controllerPhase struct {
+	done chan struct{}
+	err  error
+}
+
+// controllerStatusError is a response of the controller with an unexpected status code.
+type controllerStatusError struct {
+	statusCode int
+	message    string
+}
+
+func (e *controllerStatusError) Error() string {
+	return fmt.Sprintf("controller responded with status code %d: %s", e.statusCode, e.message)
+}
+
+func newControllerClient(config *DistributedConfig) *controllerClient {
+	return &controllerClient{
+		url:   strings.TrimSuffix(config.AggregatorURL, "/"),
+		agent: config.Instance,
+		// Calls wait for the other agents, so they don't time out.
+		client: &http.Client{},
+		phases: make(map[string]*controllerPhase),
+	}
+}
+
+// call sends the given request to the given path and returns the body of the response.
+func (c *controllerClient) call(ctx context.Context, path string, req controllerRequest) ([]byte, error) {
+	req.Agent = c.agent
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, &controllerStatusError{statusCode: resp.StatusCode, message: strings.TrimSpace(string(body))}
+	}
+	return body, nil
+}
+
+// register registers the agent and returns the config distributed by the controller, it retries until the controller
+// is reachable, so that agents can start before the controller.
+func (c *controllerClient) register(ctx context.Context, role AgentRole) ([]byte, error) {
+	for attempt := 1; ; attempt++ {
+		b, err := c.call(ctx, controllerRegisterPath, controllerRequest{Role: role})
+		var statusErr *controllerStatusError
+		if err == nil || errors.As(err, &statusErr) || ctx.Err() != nil {
+			return b, err
+		}
+		logger(logComponentRun).Warnw("Failed to register to controller", "attempt", attempt, "error", err)
+		select {
+		case <-time.After(controllerRegisterInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// arrive reaches the given phase, once.
+func (c *controllerClient) arrive(ctx context.Context, phase string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.phases[phase]; ok {
+		return
+	}
+	p := &controllerPhase{done: make(chan struct{})}
+	c.phases[phase] = p
+	go func() {
+		defer close(p.done)
+		_, p.err = c.call(ctx, controllerPhasePath, controllerRequest{Phase: phase})
+	}()
+}
+
+// wait waits for all agents to reach the given phase, which must have been reached with arrive.
+func (c *controllerClient) wait(ctx context.Context, phase string) error {
+	c.lock.Lock()
+	p := c.phases[phase]
+	c.lock.Unlock()
+	select {
+	case <-p.done:
+		return p.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type controllerClientKey struct{}
+
+func contextWithControllerClient(ctx context.Context, c *controllerClient) context.Context {
+	return context.WithValue(ctx, controllerClientKey{}, c)
+}
+
+// controllerClientFromContext returns the controller client of an agent, or nil.
+func controllerClientFromContext(ctx context.Context) *controllerClient {
+	c, _ := ctx.Value(controllerClientKey{}).(*controllerClient)
+	return c
+}
+
+// runAgent registers to the controller and runs the config distributed by the controller as an instance.
+func runAgent(ctx context.Context, config Config) (Report, error) {
+	if err := config.Distributed.validate(); err != nil {
+		return Report{}, err
+	}
+	if err := configureLogging(config.Logging); err != nil {
+		return Report{}, err
+	}
+
+	c := newControllerClient(config.Distributed)
+	logger(logComponentRun).Infow("Registering to controller", "url", c.url, "agent", c.agent, "role", config.Distributed.AgentRole)
+	b, err := c.register(ctx, config.Distributed.AgentRole)
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to register to controller: %w", err)
+	}
+	test := Config{}
+	if err := json.Unmarshal(b, &test); err != nil {
+		return Report{}, fmt.Errorf("failed to unmarshal the config of the controller: %w", err)
+	}
+
+	test.Distributed = &DistributedConfig{Role: DistributedRoleInstance, AggregatorURL: config.Distributed.AggregatorURL, Instance: c.agent}
+	switch config.Distributed.AgentRole {
+	case AgentRoleSender:
+		test.Receiver.Disabled = true
+	case AgentRoleReceiver:
+		test.Sender.Disabled = true
+	}
+	if config.Logging != nil {
+		test.Logging = config.Logging
+	}
+	return Run(contextWithControllerClient(ctx, c), test)
+}
@@ -0,0 +1,146 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestControlPlaneRequests(t *testing.T) {
+	a := newAggregator(1, make(chan ce.Event, 1), make(chan ReceivedEvent, 1))
+	c, err := newControlPlane(Config{}, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		path           string
+		body           string
+		wantStatusCode int
+	}{
+		{name: "register", path: controllerRegisterPath, body: `{"agent": "agent-0", "role": "sender"}`, wantStatusCode: http.StatusOK},
+		{name: "register again", path: controllerRegisterPath, body: `{"agent": "agent-0", "role": "sender"}`, wantStatusCode: http.StatusOK},
+		{name: "register unexpected agent", path: controllerRegisterPath, body: `{"agent": "agent-1", "role": "sender"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "phase", path: controllerPhasePath, body: `{"agent": "agent-0", "phase": "start"}`, wantStatusCode: http.StatusNoContent},
+		{name: "phase of unknown agent", path: controllerPhasePath, body: `{"agent": "agent-1", "phase": "start"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "without agent", path: controllerPhasePath, body: `{"phase": "start"}`, wantStatusCode: http.StatusBadRequest},
+		{name: "malformed", path: controllerRegisterPath, body: `{`, wantStatusCode: http.StatusBadRequest},
+		{name: "aggregator", path: aggregatorSentPath, body: `[]`, wantStatusCode: http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c.ServeHTTP(w, httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body)))
+			if w.Code != tt.wantStatusCode {
+				t.Errorf("want status code %d, got %d (%s)", tt.wantStatusCode, w.Code, w.Body)
+			}
+		})
+	}
+}
+
+func TestValidateAgentRole(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DistributedConfig
+		want    AgentRole
+		wantErr bool
+	}{
+		{name: "default", config: DistributedConfig{Role: DistributedRoleAgent, AggregatorURL: "http://localhost:9310"}, want: AgentRoleSenderReceiver},
+		{name: "receiver", config: DistributedConfig{Role: DistributedRoleAgent, AggregatorURL: "http://localhost:9310", AgentRole: AgentRoleReceiver}, want: AgentRoleReceiver},
+		{name: "unknown", config: DistributedConfig{Role: DistributedRoleAgent, AggregatorURL: "http://localhost:9310", AgentRole: "broker"}, wantErr: true},
+		{name: "instance", config: DistributedConfig{Role: DistributedRoleInstance, AggregatorURL: "http://localhost:9310", AgentRole: AgentRoleSender}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.AgentRole != tt.want {
+				t.Errorf("want role %q, got %q", tt.want, tt.config.AgentRole)
+			}
+		})
+	}
+}
+
+func TestController(t *testing.T) {
+	const (
+		controllerPort = 9311
+		receiverPort   = 9312
+	)
+	config := Config{
+		Sender: SenderConfig{
+			Target:             fmt.Sprintf("http://localhost:%d", receiverPort),
+			FrequencyPerSecond: 50,
+			Workers:            1,
+			// Senders wait for receivers through the start phase.
+			StartDelay: "100ms",
+		},
+		Duration:          "1s",
+		Receiver:          ReceiverConfig{Port: receiverPort, Timeout: "30s", QuietPeriod: "1s"},
+		DeliveryGuarantee: AtLeastOnce,
+		Distributed: &DistributedConfig{
+			Role:              DistributedRoleController,
+			Port:              controllerPort,
+			ExpectedInstances: 2,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	type result struct {
+		report Report
+		err    error
+	}
+	run := func(config Config) <-chan result {
+		c := make(chan result, 1)
+		go func() {
+			report, err := Run(ctx, config)
+			c <- result{report: report, err: err}
+		}()
+		return c
+	}
+
+	agent := func(name string, role AgentRole) Config {
+		return Config{Distributed: &DistributedConfig{
+			Role:          DistributedRoleAgent,
+			AggregatorURL: fmt.Sprintf("http://localhost:%d", controllerPort),
+			Instance:      name,
+			AgentRole:     role,
+		}}
+	}
+
+	// Agents started before the controller retry registering.
+	sender := run(agent("sender-0", AgentRoleSender))
+	time.Sleep(200 * time.Millisecond)
+	controller := run(config)
+	// The sender agent waits for the receiver agent to be ready.
+	time.Sleep(500 * time.Millisecond)
+	receiver := run(agent("receiver-0", AgentRoleReceiver))
+
+	for name, c := range map[string]<-chan result{"sender": sender, "receiver": receiver} {
+		if r := <-c; r.err != nil {
+			t.Errorf("%s agent failed: %v", name, r.err)
+		}
+	}
+	r := <-controller
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	if r.report.Metrics.AcceptedCount == 0 || r.report.ReceivedCount != r.report.Metrics.AcceptedCount || r.report.LostCount != 0 {
+		t.Errorf("want all events accepted received, got %d and %d, %d lost", r.report.Metrics.AcceptedCount, r.report.ReceivedCount, r.report.LostCount)
+	}
+	if _, ok := r.report.Replicas["receiver-0"]; !ok {
+		t.Errorf("want events received by the receiver agent, got %+v", r.report.Replicas)
+	}
+}
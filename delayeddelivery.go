@@ -0,0 +1,336 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	// DeliverAtExtension is the extension carrying the time, in nanoseconds since the epoch, at which events sent
+	// with sender.delayedDelivery are scheduled to be delivered.
+	DeliverAtExtension = "sacuradeliverat"
+
+	// DefaultDelayedDeliveryTolerance is the default time after their scheduled time within which delayed events
+	// are expected to be delivered.
+	DefaultDelayedDeliveryTolerance = 5 * time.Second
+)
+
+// DelayFormat is the format of the delay of events sent with sender.delayedDelivery.
+type DelayFormat string
+
+const (
+	// DelayFormatSeconds is the delay in seconds, for example 30.
+	DelayFormatSeconds DelayFormat = "seconds"
+	// DelayFormatMilliseconds is the delay in milliseconds, for example 30000, like the x-delay header of the
+	// RabbitMQ delayed message exchange.
+	DelayFormatMilliseconds DelayFormat = "milliseconds"
+	// DelayFormatTime is the RFC 3339 time at which events are delivered, for example 2021-01-01T00:00:30Z.
+	DelayFormatTime DelayFormat = "time"
+	// DelayFormatUnixMilliseconds is the time at which events are delivered in milliseconds since the epoch, like
+	// the deliverAt time of Pulsar.
+	DelayFormatUnixMilliseconds DelayFormat = "unixMilliseconds"
+)
+
+// DelayedDeliveryConfig sends events with the delayed delivery extension or header supported by the target broker,
+// and verifies they are delivered no earlier than their scheduled time and within a tolerance after it.
+//
+// The receiver timeout must be longer than the delay, so that delayed events aren't reported as lost.
+type DelayedDeliveryConfig struct {
+	// Delay is the delay of events, for example 30s.
+	Delay string `json:"delay" yaml:"delay"`
+	// MaxDelay delays events by a uniformly distributed duration between Delay and MaxDelay when specified.
+	MaxDelay string `json:"maxDelay" yaml:"maxDelay"`
+	// Extension is the extension carrying the delay, exactly one of Extension and Header must be specified.
+	Extension string `json:"extension" yaml:"extension"`
+	// Header is the request header carrying the delay, it is only supported with the HTTP and gRPC protocols and
+	// without batching.
+	Header string `json:"header" yaml:"header"`
+	// Format is the format of the delay.
+	//
+	// Defaults to DelayFormatSeconds.
+	Format DelayFormat `json:"format" yaml:"format"`
+	// Tolerance is the time after their scheduled time within which events are expected to be delivered, events
+	// delivered later are reported as late.
+	//
+	// Defaults to DefaultDelayedDeliveryTolerance.
+	Tolerance string `json:"tolerance" yaml:"tolerance"`
+
+	ParsedDelay     time.Duration
+	ParsedMaxDelay  time.Duration
+	ParsedTolerance time.Duration
+}
+
+func (c *DelayedDeliveryConfig) validate(sender *SenderConfig) error {
+	var err error
+	c.ParsedDelay, err = time.ParseDuration(c.Delay)
+	if err != nil {
+		return invalidErr("sender.delayedDelivery.delay", err)
+	}
+	if c.ParsedDelay <= 0 {
+		return invalidErr("sender.delayedDelivery.delay", fmt.Errorf("%v must be positive", c.ParsedDelay))
+	}
+	c.ParsedMaxDelay = c.ParsedDelay
+	if c.MaxDelay != "" {
+		c.ParsedMaxDelay, err = time.ParseDuration(c.MaxDelay)
+		if err != nil {
+			return invalidErr("sender.delayedDelivery.maxDelay", err)
+		}
+		if c.ParsedMaxDelay < c.ParsedDelay {
+			return invalidErr("sender.delayedDelivery.maxDelay", fmt.Errorf("%v must be greater or equal to the delay %v", c.ParsedMaxDelay, c.ParsedDelay))
+		}
+	}
+	c.ParsedTolerance = DefaultDelayedDeliveryTolerance
+	if c.Tolerance != "" {
+		c.ParsedTolerance, err = time.ParseDuration(c.Tolerance)
+		if err != nil {
+			return invalidErr("sender.delayedDelivery.tolerance", err)
+		}
+		if c.ParsedTolerance < 0 {
+			return invalidErr("sender.delayedDelivery.tolerance", fmt.Errorf("%v cannot be negative", c.ParsedTolerance))
+		}
+	}
+
+	if (c.Extension == "") == (c.Header == "") {
+		return invalidErr("sender.delayedDelivery", errors.New("exactly one of extension or header must be specified"))
+	}
+	if c.Extension != "" {
+		if !isValidExtensionName(c.Extension) {
+			return invalidErr("sender.delayedDelivery.extension", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", c.Extension))
+		}
+		for _, reserved := range reservedExtensions {
+			if c.Extension == reserved {
+				return invalidErr("sender.delayedDelivery.extension", fmt.Errorf("%s is reserved", c.Extension))
+			}
+		}
+		if sender.Attributes != nil {
+			if _, ok := sender.Attributes.Extensions[c.Extension]; ok {
+				return invalidErr("sender.delayedDelivery.extension", fmt.Errorf("%s is already set by sender.attributes.extensions", c.Extension))
+			}
+		}
+	}
+	if c.Header != "" {
+		if sender.Protocol != "" && sender.Protocol != ProtocolHTTP && sender.Protocol != ProtocolGRPC {
+			return invalidErr("sender.delayedDelivery.header", fmt.Errorf("is only supported with the %s and %s protocols", ProtocolHTTP, ProtocolGRPC))
+		}
+		if sender.BatchSize > 1 {
+			return invalidErr("sender.delayedDelivery.header", errors.New("cannot be used with sender.batchSize, events of a batch have different schedules"))
+		}
+	}
+
+	switch c.Format {
+	case "":
+		c.Format = DelayFormatSeconds
+	case DelayFormatSeconds, DelayFormatMilliseconds, DelayFormatTime, DelayFormatUnixMilliseconds:
+	default:
+		return invalidErr("sender.delayedDelivery.format", fmt.Errorf("unknown format %q, expected one of %v", c.Format, []DelayFormat{DelayFormatSeconds, DelayFormatMilliseconds, DelayFormatTime, DelayFormatUnixMilliseconds}))
+	}
+	if unit := c.unit(); c.ParsedDelay%unit != 0 || c.ParsedMaxDelay%unit != 0 {
+		return invalidErr("sender.delayedDelivery.delay", fmt.Errorf("delays must be a whole number of %v with the %s format", unit, c.Format))
+	}
+	return nil
+}
+
+// unit returns the resolution of delays in the format.
+func (c *DelayedDeliveryConfig) unit() time.Duration {
+	switch c.Format {
+	case DelayFormatSeconds:
+		return time.Second
+	case DelayFormatMilliseconds, DelayFormatUnixMilliseconds:
+		return time.Millisecond
+	default:
+		return time.Nanosecond
+	}
+}
+
+// value returns the value of the delay of events sent at the given time and scheduled at the given time.
+func (c *DelayedDeliveryConfig) value(sentAt, deliverAt time.Time) string {
+	switch c.Format {
+	case DelayFormatMilliseconds:
+		return strconv.FormatInt(deliverAt.Sub(sentAt).Milliseconds(), 10)
+	case DelayFormatTime:
+		return deliverAt.UTC().Format(time.RFC3339Nano)
+	case DelayFormatUnixMilliseconds:
+		return strconv.FormatInt(deliverAt.UnixMilli(), 10)
+	default:
+		return strconv.FormatInt(int64(deliverAt.Sub(sentAt)/time.Second), 10)
+	}
+}
+
+// newDelayedDeliveryGenerator returns a function scheduling the delivery of events sent at the given time, delays
+// are deterministic with a seed.
+func newDelayedDeliveryGenerator(config *DelayedDeliveryConfig, seed *int64) func(e *ce.Event, sentAt time.Time) {
+	if config == nil {
+		return func(*ce.Event, time.Time) {}
+	}
+	r := newRand(seed, "delayedDelivery")
+	return func(e *ce.Event, sentAt time.Time) {
+		delay := config.ParsedDelay
+		if config.ParsedMaxDelay > config.ParsedDelay {
+			delay += time.Duration(r.Int63n(int64(config.ParsedMaxDelay-config.ParsedDelay) + 1)).Truncate(config.unit())
+		}
+		deliverAt := sentAt.Add(delay)
+		if config.Format == DelayFormatUnixMilliseconds {
+			// The scheduled time is rounded up to the resolution of the format, events can't be delivered before it.
+			deliverAt = time.UnixMilli(deliverAt.Add(time.Millisecond - 1).UnixMilli())
+		}
+		e.SetExtension(DeliverAtExtension, strconv.FormatInt(deliverAt.UnixNano(), 10))
+		if config.Extension != "" {
+			e.SetExtension(config.Extension, config.value(sentAt, deliverAt))
+		}
+	}
+}
+
+// setHeader sets the delay header of the request sending the given event.
+func (c *DelayedDeliveryConfig) setHeader(hdr http.Header, e *ce.Event) {
+	if c == nil || c.Header == "" {
+		return
+	}
+	sentAt, ok := sentTimestamp(e)
+	if !ok {
+		return
+	}
+	if deliverAt, ok := deliverAt(e); ok {
+		hdr.Set(c.Header, c.value(sentAt, deliverAt))
+	}
+}
+
+// deliverAt returns the time the given event is scheduled to be delivered at.
+func deliverAt(e *ce.Event) (time.Time, bool) {
+	v, ok := e.Extensions()[DeliverAtExtension]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(0, t), true
+}
+
+// DelayedDeliveryReport reports the deliveries of the events sent with sender.delayedDelivery.
+type DelayedDeliveryReport struct {
+	// ScheduledCount is the number of accepted events sent with a delay.
+	ScheduledCount int `json:"scheduledCount"`
+	// EarlyCount is the number of unique events delivered before their scheduled time, EarlyEventsByPartitionKey
+	// collects them by partition key.
+	EarlyCount                int                 `json:"earlyCount"`
+	EarlyEventsByPartitionKey map[string][]string `json:"earlyEvents,omitempty"`
+	// LateCount is the number of unique events delivered after their scheduled time and the tolerance,
+	// LateEventsByPartitionKey collects them by partition key.
+	LateCount                int                 `json:"lateCount"`
+	LateEventsByPartitionKey map[string][]string `json:"lateEvents,omitempty"`
+	// MaxEarliness is the maximum time before their scheduled time at which events have been delivered.
+	MaxEarliness time.Duration `json:"maxEarliness,omitempty"`
+	// Lateness is the time between the scheduled time and the delivery of events delivered no earlier than it.
+	Lateness LatencyStats `json:"lateness"`
+}
+
+// delayedDeliveryState tracks the deliveries of the events sent with a delay.
+type delayedDeliveryState struct {
+	config       *DelayedDeliveryConfig
+	scheduled    int
+	early        map[string][]string
+	late         map[string][]string
+	maxEarliness time.Duration
+	lateness     *latencyHistogram
+}
+
+// newDelayedDeliveryState returns the state of the events sent with a delay, it returns nil without
+// sender.delayedDelivery.
+func newDelayedDeliveryState(config *DelayedDeliveryConfig) *delayedDeliveryState {
+	if config == nil {
+		return nil
+	}
+	return &delayedDeliveryState{
+		config:   config,
+		early:    make(map[string][]string),
+		late:     make(map[string][]string),
+		lateness: newLatencyHistogram(),
+	}
+}
+
+// recordScheduled records sent events with a delay, it must be called while holding the lock.
+func (s *StateManager) recordScheduled(e *ce.Event) {
+	if s.delayedDelivery == nil {
+		return
+	}
+	if _, ok := deliverAt(e); ok {
+		s.delayedDelivery.scheduled++
+	}
+}
+
+// recordDelayedDelivery records the delivery of the given event sent with a delay, it must be called while holding
+// the lock.
+func (s *StateManager) recordDelayedDelivery(e *ReceivedEvent) {
+	if s.delayedDelivery == nil || e.ReceivedAt.IsZero() {
+		return
+	}
+	at, ok := deliverAt(&e.Event)
+	if !ok {
+		return
+	}
+	d := s.delayedDelivery
+	switch diff := e.ReceivedAt.Sub(at); {
+	case diff < 0:
+		logger(LogComponentState).Warnw("Received event before its scheduled time", "id", e.Event.ID(), "earliness", -diff)
+		insert(&e.Event, d.early, &s.stateManagerConfig)
+		if -diff > d.maxEarliness {
+			d.maxEarliness = -diff
+		}
+	case diff > d.config.ParsedTolerance:
+		logger(LogComponentState).Warnw("Received event late after its scheduled time", "id", e.Event.ID(), "lateness", diff)
+		insert(&e.Event, d.late, &s.stateManagerConfig)
+		d.lateness.record(diff)
+	default:
+		d.lateness.record(diff)
+	}
+}
+
+// delayedDeliveryReport sets the delayed delivery section of the report, it must be called while holding the lock.
+func (s *StateManager) delayedDeliveryReport(r *Report) {
+	if s.delayedDelivery == nil {
+		return
+	}
+	d := s.delayedDelivery
+	report := &DelayedDeliveryReport{ScheduledCount: d.scheduled, MaxEarliness: d.maxEarliness, Lateness: d.lateness.stats()}
+	if len(d.early) > 0 {
+		report.EarlyEventsByPartitionKey = make(map[string][]string, len(d.early))
+		for k, v := range d.early {
+			early, _ := removeDuplicates(v)
+			sort.Strings(early)
+			report.EarlyEventsByPartitionKey[k] = early
+			report.EarlyCount += len(early)
+		}
+	}
+	if len(d.late) > 0 {
+		report.LateEventsByPartitionKey = make(map[string][]string, len(d.late))
+		for k, v := range d.late {
+			late, _ := removeDuplicates(v)
+			sort.Strings(late)
+			report.LateEventsByPartitionKey[k] = late
+			report.LateCount += len(late)
+		}
+	}
+	r.DelayedDelivery = report
+}
+
+// verifyDelayedDelivery verifies the events sent with a delay have been delivered on schedule, when enabled.
+func verifyDelayedDelivery(report Report) error {
+	if report.DelayedDelivery == nil {
+		return nil
+	}
+	d := report.DelayedDelivery
+	if d.EarlyCount > 0 {
+		return fmt.Errorf("%d events received before their scheduled time, up to %v early", d.EarlyCount, d.MaxEarliness)
+	}
+	if d.LateCount > 0 {
+		return fmt.Errorf("%d events received later than the tolerance after their scheduled time, up to %v late", d.LateCount, d.Lateness.Max)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package sacura
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestDelayedDeliveryConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DelayedDeliveryConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "extension", config: DelayedDeliveryConfig{Delay: "30s", Extension: "deliverat"}},
+		{name: "header", config: DelayedDeliveryConfig{Delay: "30s", MaxDelay: "1m", Header: "x-delay", Format: DelayFormatMilliseconds}},
+		{name: "time format", config: DelayedDeliveryConfig{Delay: "1.5s", Extension: "deliverat", Format: DelayFormatTime, Tolerance: "1s"}},
+		{name: "invalid delay", config: DelayedDeliveryConfig{Delay: "0s", Extension: "deliverat"}, wantErr: true},
+		{name: "max delay lower than delay", config: DelayedDeliveryConfig{Delay: "30s", MaxDelay: "10s", Extension: "deliverat"}, wantErr: true},
+		{name: "negative tolerance", config: DelayedDeliveryConfig{Delay: "30s", Extension: "deliverat", Tolerance: "-1s"}, wantErr: true},
+		{name: "neither extension nor header", config: DelayedDeliveryConfig{Delay: "30s"}, wantErr: true},
+		{name: "extension and header", config: DelayedDeliveryConfig{Delay: "30s", Extension: "deliverat", Header: "x-delay"}, wantErr: true},
+		{name: "invalid extension", config: DelayedDeliveryConfig{Delay: "30s", Extension: "deliver-at"}, wantErr: true},
+		{name: "reserved extension", config: DelayedDeliveryConfig{Delay: "30s", Extension: DeliverAtExtension}, wantErr: true},
+		{name: "header with kafka", config: DelayedDeliveryConfig{Delay: "30s", Header: "x-delay"}, sender: SenderConfig{Protocol: ProtocolKafka}, wantErr: true},
+		{name: "header with batches", config: DelayedDeliveryConfig{Delay: "30s", Header: "x-delay"}, sender: SenderConfig{BatchSize: 10}, wantErr: true},
+		{name: "unknown format", config: DelayedDeliveryConfig{Delay: "30s", Extension: "deliverat", Format: "minutes"}, wantErr: true},
+		{name: "fractional seconds", config: DelayedDeliveryConfig{Delay: "1500ms", Extension: "deliverat"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (tt.config.Format == "" || tt.config.ParsedTolerance == 0 || tt.config.ParsedMaxDelay < tt.config.ParsedDelay) {
+				t.Errorf("expected defaults to be set, got %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestDelayedDeliveryGenerator(t *testing.T) {
+	sentAt := time.Date(2021, 1, 1, 0, 0, 0, 500, time.UTC)
+	tests := []struct {
+		format DelayFormat
+		want   string
+	}{
+		{format: DelayFormatSeconds, want: "30"},
+		{format: DelayFormatMilliseconds, want: "30000"},
+		{format: DelayFormatTime, want: "2021-01-01T00:00:30.0000005Z"},
+		{format: DelayFormatUnixMilliseconds, want: strconv.FormatInt(sentAt.Add(30*time.Second+time.Millisecond).UnixMilli(), 10)},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			config := &DelayedDeliveryConfig{Delay: "30s", Extension: "deliverat", Format: tt.format}
+			if err := config.validate(&SenderConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			e := cetest.FullEvent()
+			newDelayedDeliveryGenerator(config, nil)(&e, sentAt)
+			if got := e.Extensions()["deliverat"]; got != tt.want {
+				t.Errorf("want %s, got %v", tt.want, got)
+			}
+			at, ok := deliverAt(&e)
+			if !ok || at.Before(sentAt.Add(30*time.Second)) || at.After(sentAt.Add(30*time.Second+time.Millisecond)) {
+				t.Errorf("unexpected scheduled time %v", at)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorDelayedDeliveryHeader(t *testing.T) {
+	config := Config{Sender: SenderConfig{Target: "http://a", DelayedDelivery: &DelayedDeliveryConfig{
+		Delay:    "10s",
+		MaxDelay: "20s",
+		Header:   "x-delay",
+		Format:   DelayFormatMilliseconds,
+	}}}
+	if err := config.Sender.DelayedDelivery.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	for i := 0; i < 10; i++ {
+		target := &vegeta.Target{}
+		if err := f(target); err != nil {
+			t.Fatal(err)
+		}
+		e := <-out
+		sentAt, _ := sentTimestamp(&e)
+		at, ok := deliverAt(&e)
+		if !ok {
+			t.Fatal("expected the scheduled time extension")
+		}
+		if want := strconv.FormatInt(at.Sub(sentAt).Milliseconds(), 10); target.Header.Get("x-delay") != want {
+			t.Errorf("want header %s, got %s", want, target.Header.Get("x-delay"))
+		}
+		if delay := at.Sub(sentAt); delay < 10*time.Second || delay > 20*time.Second {
+			t.Errorf("want a delay between 10s and 20s, got %v", delay)
+		}
+	}
+}
+
+func TestStateManagerDelayedDelivery(t *testing.T) {
+	config := Config{Sender: SenderConfig{DelayedDelivery: &DelayedDeliveryConfig{Delay: "10s", Header: "x-delay"}}}
+	if err := config.Sender.DelayedDelivery.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	sentAt := time.Now()
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		e.SetExtension(DeliverAtExtension, strconv.FormatInt(sentAt.Add(10*time.Second).UnixNano(), 10))
+		return e
+	}
+	sent := []ce.Event{event("1"), event("2"), event("3")}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: sentAt.Add(11 * time.Second)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: sentAt.Add(time.Second)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: sentAt.Add(2 * time.Second)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[2], ReceivedAt: sentAt.Add(30 * time.Second)})
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	got := *report.DelayedDelivery
+	got.Lateness = LatencyStats{Count: got.Lateness.Count, Max: got.Lateness.Max}
+	want := DelayedDeliveryReport{
+		ScheduledCount:            3,
+		EarlyCount:                1,
+		EarlyEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2"}},
+		LateCount:                 1,
+		LateEventsByPartitionKey:  map[string][]string{unknownPartitionKey: {"3"}},
+		MaxEarliness:              9 * time.Second,
+		Lateness:                  LatencyStats{Count: 2, Max: 20 * time.Second},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if err := verifyDelayedDelivery(report); err == nil {
+		t.Error("expected early and late deliveries to fail the verification")
+	}
+}
+
+func TestVerifyDelayedDelivery(t *testing.T) {
+	if err := verifyDelayedDelivery(Report{}); err != nil {
+		t.Error(err)
+	}
+	if err := verifyDelayedDelivery(Report{DelayedDelivery: &DelayedDeliveryReport{ScheduledCount: 10}}); err != nil {
+		t.Error(err)
+	}
+	if err := verifyDelayedDelivery(Report{DelayedDelivery: &DelayedDeliveryReport{LateCount: 1}}); err == nil {
+		t.Error("expected late deliveries to fail the verification")
+	}
+}
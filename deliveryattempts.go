@@ -0,0 +1,176 @@
+package sacura
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	// KnativeErrorDestExtension is the extension Knative sets on events sent to a dead-letter sink to the
+	// destination the event failed to be delivered to.
+	KnativeErrorDestExtension = "knativeerrordest"
+	// KnativeErrorCodeExtension is the extension Knative sets on events sent to a dead-letter sink to the status
+	// code of the last failed delivery.
+	KnativeErrorCodeExtension = "knativeerrorcode"
+)
+
+// DeliveryAttemptsConfig verifies the number of delivery attempts of each event, so that the retry policy of the
+// system under test, for example the delivery spec of a Trigger, is verified with receiver.fault responses.
+//
+// Attempts are the deliveries of an event observed by the receiver, including failure responses and excluding
+// deliveries to the dead-letter sink, or the attempt number reported by the system under test when greater.
+type DeliveryAttemptsConfig struct {
+	// AttemptExtension is the extension the system under test sets to the attempt number of each delivery, starting
+	// at 1.
+	//
+	// When not specified, only the deliveries observed by the receiver are counted.
+	AttemptExtension string `json:"attemptExtension" yaml:"attemptExtension"`
+	// MaxAttempts is the number of attempts of the retry policy, including the first one, for example 4 with a
+	// Knative delivery retry of 3. Events attempted more often fail the verification.
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// ExhaustedBeforeDeadLetter fails the verification when events are sent to the dead-letter sink before being
+	// attempted MaxAttempts times.
+	ExhaustedBeforeDeadLetter bool `json:"exhaustedBeforeDeadLetter" yaml:"exhaustedBeforeDeadLetter"`
+}
+
+func (c *DeliveryAttemptsConfig) validate() error {
+	if c.MaxAttempts <= 0 {
+		return invalidErr("verification.deliveryAttempts.maxAttempts", fmt.Errorf("%d must be greater than 0", c.MaxAttempts))
+	}
+	if c.AttemptExtension != "" && !isValidExtensionName(c.AttemptExtension) {
+		return invalidErr("verification.deliveryAttempts.attemptExtension", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", c.AttemptExtension))
+	}
+	return nil
+}
+
+// DeliveryAttemptsReport reports the delivery attempts of received events.
+type DeliveryAttemptsReport struct {
+	// MaxAttempts is the highest number of attempts of an event.
+	MaxAttempts int `json:"maxAttempts"`
+	// AttemptsByEvent is the number of attempts of each event attempted more than once.
+	AttemptsByEvent map[string]int `json:"attemptsByEvent,omitempty"`
+	// DeadLetteredByErrorDest is the number of events received by the dead-letter sink by the KnativeErrorDestExtension
+	// and the KnativeErrorCodeExtension they carry, for example "http://sacura.e2e.svc.cluster.local 500".
+	DeadLetteredByErrorDest map[string]int `json:"deadLetteredByErrorDest,omitempty"`
+	// ViolationCount is the number of events violating the retry policy.
+	ViolationCount int `json:"violationCount,omitempty"`
+	// Violations lists the events violating the retry policy, sorted by event ID.
+	Violations []DeliveryAttemptsViolation `json:"violations,omitempty"`
+}
+
+// DeliveryAttemptsViolation is an event attempted more often than the retry policy allows or sent to the dead-letter
+// sink before the retries were exhausted.
+type DeliveryAttemptsViolation struct {
+	ID           string `json:"id"`
+	Attempts     int    `json:"attempts"`
+	DeadLettered bool   `json:"deadLettered,omitempty"`
+}
+
+// deliveryAttemptsState tracks the delivery attempts of received events.
+type deliveryAttemptsState struct {
+	config *DeliveryAttemptsConfig
+	events map[string]*deliveryAttempts
+	// deadLetteredByErrorDest counts events received by the dead-letter sink by error destination and code.
+	deadLetteredByErrorDest map[string]int
+}
+
+type deliveryAttempts struct {
+	// deliveries is the number of deliveries observed by the receiver, excluding the dead-letter sink.
+	deliveries int
+	// reported is the highest attempt number reported by the system under test.
+	reported     int
+	deadLettered bool
+}
+
+func (a *deliveryAttempts) attempts() int {
+	if a.reported > a.deliveries {
+		return a.reported
+	}
+	return a.deliveries
+}
+
+func newDeliveryAttemptsState(config *DeliveryAttemptsConfig) *deliveryAttemptsState {
+	if config == nil {
+		return nil
+	}
+	return &deliveryAttemptsState{
+		config:                  config,
+		events:                  make(map[string]*deliveryAttempts),
+		deadLetteredByErrorDest: make(map[string]int),
+	}
+}
+
+// recordDeliveryAttempt records a delivery of the given received event, it must be called while holding the lock.
+func (s *StateManager) recordDeliveryAttempt(e *ReceivedEvent) {
+	d := s.deliveryAttempts
+	if d == nil {
+		return
+	}
+	a, ok := d.events[e.Event.ID()]
+	if !ok {
+		a = &deliveryAttempts{}
+		d.events[e.Event.ID()] = a
+	}
+	if e.DeadLettered {
+		a.deadLettered = true
+		if dest, ok := eventAttribute(&e.Event, KnativeErrorDestExtension); ok {
+			code, _ := eventAttribute(&e.Event, KnativeErrorCodeExtension)
+			d.deadLetteredByErrorDest[fmt.Sprintf("%s %s", dest, code)]++
+		}
+		return
+	}
+	a.deliveries++
+	if d.config.AttemptExtension == "" {
+		return
+	}
+	v, ok := eventAttribute(&e.Event, d.config.AttemptExtension)
+	if !ok {
+		return
+	}
+	if attempt, err := strconv.Atoi(v); err == nil && attempt > a.reported {
+		a.reported = attempt
+	}
+}
+
+// deliveryAttemptsReport sets the delivery attempts of the report, it must be called while holding the lock.
+func (s *StateManager) deliveryAttemptsReport(r *Report) {
+	d := s.deliveryAttempts
+	if d == nil {
+		return
+	}
+	report := &DeliveryAttemptsReport{AttemptsByEvent: make(map[string]int)}
+	for id, a := range d.events {
+		attempts := a.attempts()
+		if attempts > report.MaxAttempts {
+			report.MaxAttempts = attempts
+		}
+		if attempts > 1 {
+			report.AttemptsByEvent[id] = attempts
+		}
+		if attempts > d.config.MaxAttempts || (a.deadLettered && d.config.ExhaustedBeforeDeadLetter && attempts < d.config.MaxAttempts) {
+			report.Violations = append(report.Violations, DeliveryAttemptsViolation{ID: id, Attempts: attempts, DeadLettered: a.deadLettered})
+		}
+	}
+	sort.Slice(report.Violations, func(i, j int) bool { return report.Violations[i].ID < report.Violations[j].ID })
+	report.ViolationCount = len(report.Violations)
+	if len(d.deadLetteredByErrorDest) > 0 {
+		report.DeadLetteredByErrorDest = make(map[string]int, len(d.deadLetteredByErrorDest))
+		for k, v := range d.deadLetteredByErrorDest {
+			report.DeadLetteredByErrorDest[k] = v
+		}
+	}
+	r.DeliveryAttempts = report
+}
+
+// verifyDeliveryAttempts verifies received events have been attempted as many times as the retry policy allows, when
+// enabled.
+func verifyDeliveryAttempts(config Config, report Report) error {
+	if config.Verification.DeliveryAttempts == nil || report.DeliveryAttempts == nil || report.DeliveryAttempts.ViolationCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events violating the retry policy of %d attempts received",
+		report.DeliveryAttempts.ViolationCount,
+		config.Verification.DeliveryAttempts.MaxAttempts,
+	)
+}
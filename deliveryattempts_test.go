@@ -0,0 +1,81 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerDeliveryAttempts(t *testing.T) {
+
+	config := Config{Verification: VerificationConfig{DeliveryAttempts: &DeliveryAttemptsConfig{AttemptExtension: "retryattempt", MaxAttempts: 3, ExhaustedBeforeDeadLetter: true}}}
+	sm := newTestStateManager(t, config)
+
+	receive := func(id string, nacked, deadLettered bool, extensions map[string]string) {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		for k, v := range extensions {
+			e.SetExtension(k, v)
+		}
+		sm.lock.Lock()
+		defer sm.lock.Unlock()
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now(), Nacked: nacked, DeadLettered: deadLettered})
+	}
+	// Delivered at the first attempt.
+	receive("1", false, false, nil)
+	// Retried until dead-lettered.
+	receive("2", true, false, nil)
+	receive("2", true, false, nil)
+	receive("2", true, false, nil)
+	receive("2", false, true, map[string]string{KnativeErrorDestExtension: "http://sacura", KnativeErrorCodeExtension: "500"})
+	// Dead-lettered before the retries are exhausted.
+	receive("3", true, false, nil)
+	receive("3", false, true, map[string]string{KnativeErrorDestExtension: "http://sacura", KnativeErrorCodeExtension: "500"})
+	// Attempted more often than the retry policy allows, as reported by the system under test.
+	receive("4", false, false, map[string]string{"retryattempt": "5"})
+
+	report := sm.GenerateReport()
+
+	want := &DeliveryAttemptsReport{
+		MaxAttempts:             5,
+		AttemptsByEvent:         map[string]int{"2": 3, "4": 5},
+		DeadLetteredByErrorDest: map[string]int{"http://sacura 500": 2},
+		ViolationCount:          2,
+		Violations:              []DeliveryAttemptsViolation{{ID: "3", Attempts: 1, DeadLettered: true}, {ID: "4", Attempts: 5}},
+	}
+	if diff := cmp.Diff(want, report.DeliveryAttempts); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	err := verifyDeliveryAttempts(config, report)
+	if err == nil || !strings.Contains(err.Error(), "2 events violating the retry policy of 3 attempts") {
+		t.Errorf("want retry policy violations, got %v", err)
+	}
+	if err := verifyDeliveryAttempts(Config{}, report); err != nil {
+		t.Errorf("want no verification when disabled, got %v", err)
+	}
+}
+
+func TestDeliveryAttemptsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DeliveryAttemptsConfig
+		wantErr bool
+	}{
+		{name: "max attempts", config: DeliveryAttemptsConfig{MaxAttempts: 4}},
+		{name: "attempt extension", config: DeliveryAttemptsConfig{MaxAttempts: 4, AttemptExtension: "retryattempt"}},
+		{name: "no max attempts", config: DeliveryAttemptsConfig{}, wantErr: true},
+		{name: "invalid attempt extension", config: DeliveryAttemptsConfig{MaxAttempts: 4, AttemptExtension: "retry-attempt"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
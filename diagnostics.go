@@ -0,0 +1,159 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+)
+
+// DiagnosticsConfig exposes an HTTP listener to profile sacura itself, for example when it becomes the bottleneck of
+// high-rate tests:
+//
+//	GET /debug/pprof/ net/http/pprof profiles
+//	GET /debug/stats  goroutine count, memory stats and StateManager memory stats
+type DiagnosticsConfig struct {
+	// Port is the port of the diagnostics listener.
+	Port int `json:"port" yaml:"port"`
+}
+
+func (c *DiagnosticsConfig) validate(config *Config) error {
+	if c.Port <= 0 || c.Port > 65535 {
+		return invalidErr("diagnostics.port", fmt.Errorf("%d is not a valid port", c.Port))
+	}
+	if !config.Receiver.Disabled && c.Port == config.Receiver.Port {
+		return invalidErr("diagnostics.port", fmt.Errorf("%d is the receiver port", c.Port))
+	}
+	if config.Admin != nil && c.Port == config.Admin.Port {
+		return invalidErr("diagnostics.port", fmt.Errorf("%d is the admin API port", c.Port))
+	}
+	return nil
+}
+
+// DiagnosticsStats is the response of GET /debug/stats.
+type DiagnosticsStats struct {
+	Goroutines int              `json:"goroutines"`
+	Memory     RuntimeMemStats  `json:"memory"`
+	State      StateMemoryStats `json:"state"`
+}
+
+// RuntimeMemStats is a subset of runtime.MemStats.
+type RuntimeMemStats struct {
+	HeapAllocBytes uint64 `json:"heapAllocBytes"`
+	HeapInuseBytes uint64 `json:"heapInuseBytes"`
+	HeapObjects    uint64 `json:"heapObjects"`
+	SysBytes       uint64 `json:"sysBytes"`
+	NumGC          uint32 `json:"numGC"`
+	PauseTotalNs   uint64 `json:"pauseTotalNs"`
+}
+
+// StateMemoryStats describes the events held by the StateManager.
+type StateMemoryStats struct {
+	// IDs is the number of event IDs held across all the maps.
+	IDs int `json:"ids"`
+	// Maps are the number of entries of each map, maps keyed by partition key count the IDs of all partitions.
+	Maps map[string]int `json:"maps"`
+}
+
+// MemoryStats returns the number of events held by the StateManager.
+func (s *StateManager) MemoryStats() StateMemoryStats {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	maps := map[string]int{
+		"sent":                    countIDs(s.sent),
+		"received":                countIDs(s.received),
+		"postTerminationReceived": countIDs(s.postTerminationReceived),
+		"corrupted":               countIDs(s.corrupted),
+		"deadLettered":            countIDs(s.deadLettered),
+		"leaked":                  countIDs(s.leaked),
+		"undropped":               countIDs(s.undropped),
+		"sentAt":                  len(s.sentAt),
+		"receivedAt":              len(s.receivedAt),
+		"sequences":               len(s.sequences),
+		"nacked":                  len(s.nacked),
+		"pending":                 len(s.pending),
+		"expired":                 len(s.expired),
+		"specViolations":          len(s.specViolations),
+	}
+	if s.attributeAudit != nil {
+		maps["attributeAuditSent"] = len(s.attributeAudit.sent)
+		maps["attributeAuditReceived"] = len(s.attributeAudit.received)
+		maps["attributeAuditDiffs"] = len(s.attributeAudit.diffs)
+	}
+	if s.contentModes != nil {
+		maps["contentModesMismatched"] = countIDs(s.contentModes.mismatched)
+	}
+	if s.streaming != nil {
+		maps["streamingOutstanding"] = len(s.streaming.outstanding)
+		maps["streamingUnmatched"] = len(s.streaming.unmatched)
+		maps["streamingPartitions"] = len(s.streaming.partitions)
+	}
+
+	stats := StateMemoryStats{Maps: maps}
+	for _, n := range maps {
+		stats.IDs += n
+	}
+	// Partitions aren't event IDs.
+	stats.IDs -= maps["streamingPartitions"]
+	return stats
+}
+
+func countIDs(m map[string][]string) int {
+	n := 0
+	for _, ids := range m {
+		n += len(ids)
+	}
+	return n
+}
+
+func diagnosticsStats(sm *StateManager) DiagnosticsStats {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return DiagnosticsStats{
+		Goroutines: runtime.NumGoroutine(),
+		Memory: RuntimeMemStats{
+			HeapAllocBytes: m.HeapAlloc,
+			HeapInuseBytes: m.HeapInuse,
+			HeapObjects:    m.HeapObjects,
+			SysBytes:       m.Sys,
+			NumGC:          m.NumGC,
+			PauseTotalNs:   m.PauseTotalNs,
+		},
+		State: sm.MemoryStats(),
+	}
+}
+
+func newDiagnosticsHandler(sm *StateManager) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		writeAdminResponse(w, http.StatusOK, diagnosticsStats(sm))
+	})
+	return mux
+}
+
+// startDiagnosticsServer starts the diagnostics listener until the returned function is called.
+func startDiagnosticsServer(config *DiagnosticsConfig, sm *StateManager) (func(), error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", config.Port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to start diagnostics listener: %w", err)
+	}
+	s := &http.Server{Handler: newDiagnosticsHandler(sm)}
+	go func() {
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger(logComponentRun).Errorw("Diagnostics listener stopped", "error", err)
+		}
+	}()
+	return func() { _ = s.Close() }, nil
+}
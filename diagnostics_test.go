@@ -0,0 +1,121 @@
+package sacura
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestDiagnosticsConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{
+			name:   "valid",
+			config: Config{Diagnostics: &DiagnosticsConfig{Port: 6060}, Receiver: ReceiverConfig{Port: 8080}},
+		},
+		{
+			name:   "receiver port with receiver disabled",
+			config: Config{Diagnostics: &DiagnosticsConfig{Port: 8080}, Receiver: ReceiverConfig{Disabled: true, Port: 8080}},
+		},
+		{
+			name:    "invalid port",
+			config:  Config{Diagnostics: &DiagnosticsConfig{Port: 70000}, Receiver: ReceiverConfig{Port: 8080}},
+			wantErr: true,
+		},
+		{
+			name:    "receiver port",
+			config:  Config{Diagnostics: &DiagnosticsConfig{Port: 8080}, Receiver: ReceiverConfig{Port: 8080}},
+			wantErr: true,
+		},
+		{
+			name:    "admin port",
+			config:  Config{Diagnostics: &DiagnosticsConfig{Port: 8081}, Admin: &AdminConfig{Port: 8081}, Receiver: ReceiverConfig{Port: 8080}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Diagnostics.validate(&tt.config); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+
+	sent := make(chan ce.Event, 3)
+	received := make(chan ReceivedEvent, 3)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for _, id := range []string{"1", "2", "3"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	s := httptest.NewServer(newDiagnosticsHandler(sm))
+	defer s.Close()
+
+	resp, err := http.Get(s.URL + "/debug/stats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected status code 200, got %d", resp.StatusCode)
+	}
+	var stats DiagnosticsStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Goroutines <= 0 || stats.Memory.HeapAllocBytes == 0 {
+		t.Errorf("expected runtime stats, got %+v", stats)
+	}
+	if stats.State.Maps["sent"] != 3 || stats.State.Maps["received"] != 2 {
+		t.Errorf("expected 3 sent and 2 received IDs, got %v", stats.State.Maps)
+	}
+	if want := sm.MemoryStats().IDs; stats.State.IDs != want || want < 5 {
+		t.Errorf("expected %d IDs, got %d", want, stats.State.IDs)
+	}
+
+	resp, err = http.Get(s.URL + "/debug/pprof/goroutine?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected status code 200, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(s.URL+"/debug/stats", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code 405, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,315 @@
+package sacura
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DiffReport is the structured difference between sent and received events.
+type DiffReport struct {
+	// Partitions collects differences by partition key, partitions without differences are omitted.
+	Partitions map[string]PartitionDiff `json:"partitions,omitempty"`
+}
+
+// PartitionDiff is the difference between the events sent and received for a single partition key.
+type PartitionDiff struct {
+	// Missing are events sent but never received.
+	Missing []string `json:"missing,omitempty"`
+	// MissingRanges are the ranges of sequence numbers of missing events, it is only populated with
+	// sender.sequentialIds, Missing is truncated to verification.maxListedIds then and MissingOmitted is the number of
+	// missing events not listed.
+	MissingRanges  []SequenceRange `json:"missingRanges,omitempty"`
+	MissingOmitted int             `json:"missingOmitted,omitempty"`
+	// NotSent are events the sender failed to send, they are not missing.
+	NotSent []string `json:"notSent,omitempty"`
+	// Unexpected are events received but never sent.
+	Unexpected []string `json:"unexpected,omitempty"`
+	// Duplicates are events received more than once.
+	//
+	// It is only populated when the configured delivery guarantee doesn't allow duplicates.
+	Duplicates []string `json:"duplicates,omitempty"`
+	// OrderingViolations are events received after an event sent later than them.
+	//
+	// It is only populated in ordered mode.
+	OrderingViolations []OrderingViolation `json:"orderingViolations,omitempty"`
+	// SequenceGaps are ranges of sequence numbers that were never received.
+	//
+	// It is only populated in ordered mode when events carry the SequenceExtension.
+	SequenceGaps []SequenceRange `json:"sequenceGaps,omitempty"`
+}
+
+// SequenceRange is an inclusive range of sequence numbers.
+type SequenceRange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+func (r SequenceRange) String() string {
+	if r.From == r.To {
+		return fmt.Sprint(r.From)
+	}
+	return fmt.Sprintf("%d-%d", r.From, r.To)
+}
+
+// OrderingViolation describes a single event received out of order.
+type OrderingViolation struct {
+	ID string `json:"id"`
+	// ExpectedPosition is the position of the event in the sent sequence.
+	ExpectedPosition int `json:"expectedPosition"`
+	// ActualPosition is the position of the event in the received sequence.
+	ActualPosition int `json:"actualPosition"`
+	// Displacement is the number of positions between the event and the latest sent event received before it.
+	Displacement int `json:"displacement"`
+	// Previous and Next are the events received right before and after the event, when known.
+	Previous string `json:"previous,omitempty"`
+	Next     string `json:"next,omitempty"`
+}
+
+// OrderingReport summarizes the ordering violations of a single partition key.
+type OrderingReport struct {
+	Violations []OrderingViolation `json:"violations"`
+	// MaxDisplacement and MeanDisplacement are the maximum and the mean displacement of the violations.
+	MaxDisplacement  int     `json:"maxDisplacement"`
+	MeanDisplacement float64 `json:"meanDisplacement"`
+}
+
+func newOrderingReport(violations []OrderingViolation) OrderingReport {
+	r := OrderingReport{Violations: violations}
+	total := 0
+	for _, v := range violations {
+		total += v.Displacement
+		if v.Displacement > r.MaxDisplacement {
+			r.MaxDisplacement = v.Displacement
+		}
+	}
+	if len(violations) > 0 {
+		r.MeanDisplacement = float64(total) / float64(len(violations))
+	}
+	return r
+}
+
+func (d PartitionDiff) empty() bool {
+	return len(d.Missing) == 0 &&
+		len(d.NotSent) == 0 &&
+		len(d.Unexpected) == 0 &&
+		len(d.Duplicates) == 0 &&
+		len(d.OrderingViolations) == 0 &&
+		len(d.SequenceGaps) == 0
+}
+
+// Empty returns true when no differences were found.
+func (d DiffReport) Empty() bool {
+	for _, p := range d.Partitions {
+		if !p.empty() {
+			return false
+		}
+	}
+	return true
+}
+
+func (d DiffReport) String() string {
+	if d.Empty() {
+		return ""
+	}
+
+	keys := make([]string, 0, len(d.Partitions))
+	for k := range d.Partitions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	sb := strings.Builder{}
+	for _, k := range keys {
+		p := d.Partitions[k]
+		if p.empty() {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("partition key %s:\n", k))
+		if len(p.MissingRanges) > 0 {
+			sb.WriteString(fmt.Sprintf("  missing ranges (%d): %v\n", len(p.MissingRanges), p.MissingRanges))
+		}
+		if len(p.Missing) > 0 {
+			if p.MissingOmitted > 0 {
+				sb.WriteString(fmt.Sprintf("  missing (%d): %v and %d more\n", len(p.Missing)+p.MissingOmitted, p.Missing, p.MissingOmitted))
+			} else {
+				sb.WriteString(fmt.Sprintf("  missing (%d): %v\n", len(p.Missing), p.Missing))
+			}
+		}
+		if len(p.NotSent) > 0 {
+			sb.WriteString(fmt.Sprintf("  not sent (%d): %v\n", len(p.NotSent), p.NotSent))
+		}
+		if len(p.Unexpected) > 0 {
+			sb.WriteString(fmt.Sprintf("  unexpected (%d): %v\n", len(p.Unexpected), p.Unexpected))
+		}
+		if len(p.Duplicates) > 0 {
+			sb.WriteString(fmt.Sprintf("  duplicates (%d): %v\n", len(p.Duplicates), p.Duplicates))
+		}
+		if len(p.OrderingViolations) > 0 {
+			sb.WriteString(fmt.Sprintf("  ordering violations (%d):\n", len(p.OrderingViolations)))
+			for _, v := range p.OrderingViolations {
+				sb.WriteString(fmt.Sprintf("    %s (expected position %d, actual position %d, displacement %d)\n", v.ID, v.ExpectedPosition, v.ActualPosition, v.Displacement))
+			}
+		}
+		if len(p.SequenceGaps) > 0 {
+			sb.WriteString(fmt.Sprintf("  sequence gaps (%d): %v\n", len(p.SequenceGaps), p.SequenceGaps))
+		}
+	}
+	return sb.String()
+}
+
+// diffPartition computes the difference between sent and received events of a single partition.
+//
+// received must not contain duplicates.
+//
+// When sequences are provided, ordering is verified using the sequence number of each event instead of the order in
+// which events have been sent.
+//
+// Events displaced by at most toleranceWindow positions are not ordering violations.
+func diffPartition(sent, received []string, ordered bool, sequences map[string]uint64, toleranceWindow int) PartitionDiff {
+	d := PartitionDiff{}
+
+	sentPositions := make(map[string]int, len(sent))
+	for i, id := range sent {
+		sentPositions[id] = i
+	}
+	receivedSet := make(map[string]struct{}, len(received))
+	for _, id := range received {
+		receivedSet[id] = struct{}{}
+	}
+
+	for _, id := range sent {
+		if _, ok := receivedSet[id]; !ok {
+			d.Missing = append(d.Missing, id)
+		}
+	}
+
+	for _, id := range received {
+		if _, ok := sentPositions[id]; !ok {
+			d.Unexpected = append(d.Unexpected, id)
+		}
+	}
+
+	if ordered {
+		d.OrderingViolations = partitionOrderingViolations(received, sentPositions, sequences, toleranceWindow)
+		if sequences != nil {
+			d.SequenceGaps = sequenceGaps(sent, received, sequences)
+		}
+	}
+
+	if !ordered {
+		sort.Strings(d.Missing)
+		sort.Strings(d.Unexpected)
+	}
+
+	return d
+}
+
+// partitionOrderingViolations returns the events of a single partition received out of order, using sequence numbers
+// when provided.
+func partitionOrderingViolations(received []string, sentPositions map[string]int, sequences map[string]uint64, toleranceWindow int) []OrderingViolation {
+	if sequences != nil {
+		return sequenceOrderingViolations(received, sequences, toleranceWindow)
+	}
+	return orderingViolations(received, sentPositions, toleranceWindow)
+}
+
+// neighbors returns the events received right before and after the event at position i.
+func neighbors(received []string, i int) (string, string) {
+	var previous, next string
+	if i > 0 {
+		previous = received[i-1]
+	}
+	if i+1 < len(received) {
+		next = received[i+1]
+	}
+	return previous, next
+}
+
+func orderingViolations(received []string, sentPositions map[string]int, toleranceWindow int) []OrderingViolation {
+	var violations []OrderingViolation
+	maxSentPosition := -1
+	for i, id := range received {
+		pos, ok := sentPositions[id]
+		if !ok {
+			continue
+		}
+		if pos < maxSentPosition {
+			if displacement := maxSentPosition - pos; displacement > toleranceWindow {
+				previous, next := neighbors(received, i)
+				violations = append(violations, OrderingViolation{
+					ID:               id,
+					ExpectedPosition: pos,
+					ActualPosition:   i,
+					Displacement:     displacement,
+					Previous:         previous,
+					Next:             next,
+				})
+			}
+		} else {
+			maxSentPosition = pos
+		}
+	}
+	return violations
+}
+
+func sequenceOrderingViolations(received []string, sequences map[string]uint64, toleranceWindow int) []OrderingViolation {
+	var violations []OrderingViolation
+	var maxSequence uint64
+	for i, id := range received {
+		seq, ok := sequences[id]
+		if !ok {
+			continue
+		}
+		if seq < maxSequence {
+			if displacement := int(maxSequence - seq); displacement > toleranceWindow {
+				previous, next := neighbors(received, i)
+				violations = append(violations, OrderingViolation{
+					ID:               id,
+					ExpectedPosition: int(seq) - 1,
+					ActualPosition:   i,
+					Displacement:     displacement,
+					Previous:         previous,
+					Next:             next,
+				})
+			}
+		} else {
+			maxSequence = seq
+		}
+	}
+	return violations
+}
+
+// sequenceGaps returns ranges of sequence numbers of sent events that were never received. Sequence numbers are
+// only taken from sent events, so that received events that were never sent, possibly with foreign sequence numbers,
+// don't widen the gaps.
+//
+// sent must not contain failed sends, whose sequence numbers are assigned before the send.
+func sequenceGaps(sent, received []string, sequences map[string]uint64) []SequenceRange {
+	receivedSet := make(map[string]struct{}, len(received))
+	for _, id := range received {
+		receivedSet[id] = struct{}{}
+	}
+	var missing []uint64
+	for _, id := range sent {
+		if _, ok := receivedSet[id]; ok {
+			continue
+		}
+		if seq, ok := sequences[id]; ok {
+			missing = append(missing, seq)
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i] < missing[j] })
+
+	var gaps []SequenceRange
+	for _, seq := range missing {
+		if n := len(gaps); n > 0 && seq <= gaps[n-1].To+1 {
+			if seq > gaps[n-1].To {
+				gaps[n-1].To = seq
+			}
+			continue
+		}
+		gaps = append(gaps, SequenceRange{From: seq, To: seq})
+	}
+	return gaps
+}
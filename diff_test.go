@@ -0,0 +1,206 @@
+package sacura
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDiffPartition(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		sent            []string
+		received        []string
+		ordered         bool
+		sequences       map[string]uint64
+		toleranceWindow int
+		want            PartitionDiff
+	}{
+		{
+			name:     "no differences",
+			sent:     []string{"1", "2", "3"},
+			received: []string{"3", "1", "2"},
+			want:     PartitionDiff{},
+		},
+		{
+			name:     "missing and unexpected",
+			sent:     []string{"1", "2", "3"},
+			received: []string{"4", "1"},
+			want: PartitionDiff{
+				Missing:    []string{"2", "3"},
+				Unexpected: []string{"4"},
+			},
+		},
+		{
+			name:     "ordering violation",
+			sent:     []string{"1", "2", "3", "4"},
+			received: []string{"1", "3", "2", "4"},
+			ordered:  true,
+			want: PartitionDiff{
+				OrderingViolations: []OrderingViolation{
+					{ID: "2", ExpectedPosition: 1, ActualPosition: 2, Displacement: 1, Previous: "3", Next: "4"},
+				},
+			},
+		},
+		{
+			name:            "reordering within the tolerance window",
+			sent:            []string{"1", "2", "3", "4", "5"},
+			received:        []string{"1", "3", "2", "5", "4"},
+			ordered:         true,
+			toleranceWindow: 1,
+			want:            PartitionDiff{},
+		},
+		{
+			name:            "reordering beyond the tolerance window",
+			sent:            []string{"1", "2", "3", "4", "5"},
+			received:        []string{"1", "4", "2", "3", "5"},
+			ordered:         true,
+			toleranceWindow: 1,
+			want: PartitionDiff{
+				OrderingViolations: []OrderingViolation{
+					{ID: "2", ExpectedPosition: 1, ActualPosition: 2, Displacement: 2, Previous: "4", Next: "3"},
+				},
+			},
+		},
+		{
+			name:     "ordering violation with missing event",
+			sent:     []string{"1", "2", "3", "4"},
+			received: []string{"4", "1", "2"},
+			ordered:  true,
+			want: PartitionDiff{
+				Missing: []string{"3"},
+				OrderingViolations: []OrderingViolation{
+					{ID: "1", ExpectedPosition: 0, ActualPosition: 1, Displacement: 3, Previous: "4", Next: "2"},
+					{ID: "2", ExpectedPosition: 1, ActualPosition: 2, Displacement: 2, Previous: "1"},
+				},
+			},
+		},
+		{
+			name:     "sequence order takes precedence over send order",
+			sent:     []string{"a", "b", "c", "d", "e", "f"},
+			received: []string{"b", "a", "c", "f"},
+			ordered:  true,
+			sequences: map[string]uint64{
+				"a": 2, "b": 1, "c": 3, "d": 4, "e": 5, "f": 6,
+			},
+			want: PartitionDiff{
+				Missing:      []string{"d", "e"},
+				SequenceGaps: []SequenceRange{{From: 4, To: 5}},
+			},
+		},
+		{
+			name:     "sequence ordering violation",
+			sent:     []string{"a", "b", "c"},
+			received: []string{"a", "c", "b"},
+			ordered:  true,
+			sequences: map[string]uint64{
+				"a": 1, "b": 2, "c": 3,
+			},
+			want: PartitionDiff{
+				OrderingViolations: []OrderingViolation{
+					{ID: "b", ExpectedPosition: 1, ActualPosition: 2, Displacement: 1, Previous: "c"},
+				},
+			},
+		},
+		{
+			name:     "sequence reordering beyond the tolerance window",
+			sent:     []string{"a", "b", "c", "d"},
+			received: []string{"b", "d", "a", "c"},
+			ordered:  true,
+			sequences: map[string]uint64{
+				"a": 1, "b": 2, "c": 3, "d": 4,
+			},
+			toleranceWindow: 2,
+			want: PartitionDiff{
+				OrderingViolations: []OrderingViolation{
+					{ID: "a", ExpectedPosition: 0, ActualPosition: 2, Displacement: 3, Previous: "d", Next: "c"},
+				},
+			},
+		},
+		{
+			name:     "sequence gaps of sent events only",
+			sent:     []string{"a", "b", "d", "e"},
+			received: []string{"a", "stray"},
+			ordered:  true,
+			sequences: map[string]uint64{
+				"a": 1, "b": 2, "d": 4, "e": 5, "stray": 1 << 40,
+			},
+			want: PartitionDiff{
+				Missing:      []string{"b", "d", "e"},
+				Unexpected:   []string{"stray"},
+				SequenceGaps: []SequenceRange{{From: 2, To: 2}, {From: 4, To: 5}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := diffPartition(tt.sent, tt.received, tt.ordered, tt.sequences, tt.toleranceWindow)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestDiffReportString(t *testing.T) {
+	d := DiffReport{Partitions: map[string]PartitionDiff{
+		"b": {Missing: []string{"1"}},
+		"a": {OrderingViolations: []OrderingViolation{{ID: "2", ExpectedPosition: 0, ActualPosition: 1, Displacement: 1}}},
+		"c": {},
+	}}
+
+	got := d.String()
+	if strings.Index(got, "partition key a") > strings.Index(got, "partition key b") {
+		t.Errorf("expected partitions to be sorted, got:\n%s", got)
+	}
+	if strings.Contains(got, "partition key c") {
+		t.Errorf("expected empty partitions to be omitted, got:\n%s", got)
+	}
+	if !strings.Contains(got, "2 (expected position 0, actual position 1, displacement 1)") {
+		t.Errorf("expected ordering violation, got:\n%s", got)
+	}
+
+	if s := (DiffReport{}).String(); s != "" {
+		t.Errorf("expected empty string, got %s", s)
+	}
+}
+
+func TestStateManagerDiffSequenceGaps(t *testing.T) {
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}})
+
+	event := func(id, seq string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, "0")
+		e.SetExtension(SequenceExtension, seq)
+		return e
+	}
+	sent := []ce.Event{event("1", "1"), event("2", "2"), event("3", "3")}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	// The send of 3 failed, a stray event with a huge sequence number is received.
+	sm.recordFailedSends([]FailedSend{{ID: "3", PartitionKey: "0"}})
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: time.Now()})
+	sm.recordReceived(&ReceivedEvent{Event: event("stray", fmt.Sprint(uint64(1)<<40)), ReceivedAt: time.Now()})
+	sm.lock.Unlock()
+
+	done := make(chan DiffReport)
+	go func() { done <- sm.Diff() }()
+	select {
+	case d := <-done:
+		if diff := cmp.Diff([]SequenceRange{{From: 2, To: 2}}, d.Partitions["0"].SequenceGaps); diff != "" {
+			t.Error("(-want, +got)", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("diff did not return")
+	}
+}
@@ -0,0 +1,222 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultDisruptionDowntime is the default time the receiver stays down at each disruption.
+const DefaultDisruptionDowntime = time.Second
+
+// DisruptionsConfig periodically stops the receiver and starts it again after a downtime, to force the system under
+// test through consumer restarts and rebalances. The HTTP and gRPC receivers close their listener and their
+// connections, aborting in-flight requests, the Kafka receiver closes its connections and resumes from the offsets it
+// handled.
+//
+// Disruption windows are reported with the duplicates and the ordering violations recorded until the next
+// disruption, so that they can be correlated with each disruption.
+type DisruptionsConfig struct {
+	// Interval is the time the receiver runs before each disruption, for example 30s.
+	Interval string `json:"interval" yaml:"interval"`
+	// Downtime is the time the receiver stays down at each disruption, for example 5s.
+	//
+	// Defaults to DefaultDisruptionDowntime.
+	Downtime string `json:"downtime" yaml:"downtime"`
+	// Count is the maximum number of disruptions.
+	//
+	// Defaults to 0, the receiver is disrupted until the end of the test.
+	Count int `json:"count" yaml:"count"`
+
+	ParsedInterval time.Duration
+	ParsedDowntime time.Duration
+}
+
+func (c *DisruptionsConfig) validate(receiver *ReceiverConfig) error {
+	var err error
+	c.ParsedInterval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return invalidErr("receiver.disruptions.interval", err)
+	}
+	if c.ParsedInterval <= 0 {
+		return invalidErr("receiver.disruptions.interval", fmt.Errorf("%v must be positive", c.ParsedInterval))
+	}
+	c.ParsedDowntime = DefaultDisruptionDowntime
+	if c.Downtime != "" {
+		c.ParsedDowntime, err = time.ParseDuration(c.Downtime)
+		if err != nil {
+			return invalidErr("receiver.disruptions.downtime", err)
+		}
+		if c.ParsedDowntime <= 0 {
+			return invalidErr("receiver.disruptions.downtime", fmt.Errorf("%v must be positive", c.ParsedDowntime))
+		}
+	}
+	if c.Count < 0 {
+		return invalidErr("receiver.disruptions.count", fmt.Errorf("%d cannot be negative", c.Count))
+	}
+	if b, ok := protocolBindings[receiver.Protocol]; ok && !b.resumes() {
+		return invalidErr("receiver.disruptions", fmt.Errorf("not supported with the %s protocol, events published while the receiver is down aren't redelivered", receiver.Protocol))
+	}
+	if receiver.Disabled {
+		return invalidErr("receiver.disruptions", errors.New("cannot be used with receiver.disabled"))
+	}
+	return nil
+}
+
+// DisruptionsReport reports the disruptions of the receiver.
+type DisruptionsReport struct {
+	// Count is the number of disruptions.
+	Count int `json:"count"`
+	// Windows are the disruptions in the order they happened.
+	Windows []DisruptionWindow `json:"windows"`
+	// BaselineDuplicateCount is the number of duplicates recorded before the first disruption.
+	BaselineDuplicateCount int64 `json:"baselineDuplicateCount"`
+	// BaselineOrderingViolationCount is the number of ordering violations recorded before the first disruption.
+	BaselineOrderingViolationCount int64 `json:"baselineOrderingViolationCount"`
+}
+
+// DisruptionWindow is a disruption of the receiver.
+type DisruptionWindow struct {
+	// Start is the time at which the receiver has been stopped.
+	Start time.Time `json:"start"`
+	// End is the time at which the receiver has been started again, it is zero when the test ended during the
+	// disruption.
+	End time.Time `json:"end"`
+	// DuplicateCount is the number of duplicates recorded from the start of the disruption to the start of the next
+	// one.
+	DuplicateCount int64 `json:"duplicateCount"`
+	// OrderingViolationCount is the number of ordering violations recorded from the start of the disruption to the
+	// start of the next one, it only includes events with a sequence number.
+	OrderingViolationCount int64 `json:"orderingViolationCount"`
+}
+
+// disruptionsState tracks the disruptions of the receiver.
+type disruptionsState struct {
+	windows []disruptionWindow
+}
+
+type disruptionWindow struct {
+	start time.Time
+	end   time.Time
+	// duplicates and orderingViolations are the live counters at the start of the disruption.
+	duplicates         int64
+	orderingViolations int64
+}
+
+// newDisruptionsState returns the state of disruptions, it returns nil without receiver.disruptions.
+func newDisruptionsState(config *DisruptionsConfig) *disruptionsState {
+	if config == nil {
+		return nil
+	}
+	return &disruptionsState{}
+}
+
+// startDisruption records the start of a disruption of the receiver.
+func (s *StateManager) startDisruption(start time.Time) {
+	if s == nil || s.disruptions == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.disruptions.windows = append(s.disruptions.windows, disruptionWindow{
+		start:              start,
+		duplicates:         s.duplicateCount.Load(),
+		orderingViolations: s.orderingViolationCount.Load(),
+	})
+}
+
+// endDisruption records the end of the last disruption of the receiver.
+func (s *StateManager) endDisruption(end time.Time) {
+	if s == nil || s.disruptions == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if n := len(s.disruptions.windows); n > 0 {
+		s.disruptions.windows[n-1].end = end
+	}
+}
+
+// disruptionsReport sets the disruptions section of the report, it must be called while holding the lock.
+func (s *StateManager) disruptionsReport(r *Report) {
+	if s.disruptions == nil {
+		return
+	}
+	report := &DisruptionsReport{
+		Count:                          len(s.disruptions.windows),
+		Windows:                        make([]DisruptionWindow, 0, len(s.disruptions.windows)),
+		BaselineDuplicateCount:         s.duplicateCount.Load(),
+		BaselineOrderingViolationCount: s.orderingViolationCount.Load(),
+	}
+	if len(s.disruptions.windows) > 0 {
+		report.BaselineDuplicateCount = s.disruptions.windows[0].duplicates
+		report.BaselineOrderingViolationCount = s.disruptions.windows[0].orderingViolations
+	}
+	for i, w := range s.disruptions.windows {
+		duplicates, orderingViolations := s.duplicateCount.Load(), s.orderingViolationCount.Load()
+		if i+1 < len(s.disruptions.windows) {
+			next := s.disruptions.windows[i+1]
+			duplicates, orderingViolations = next.duplicates, next.orderingViolations
+		}
+		report.Windows = append(report.Windows, DisruptionWindow{
+			Start:                  w.start,
+			End:                    w.end,
+			DuplicateCount:         duplicates - w.duplicates,
+			OrderingViolationCount: orderingViolations - w.orderingViolations,
+		})
+	}
+	r.Disruptions = report
+}
+
+// runDisruptedReceiver runs the receiver until the given context is done, stopping it for the downtime at each
+// disruption when configured. now returns the current time according to the sender clock.
+func runDisruptedReceiver(ctx context.Context, config *DisruptionsConfig, sm *StateManager, now func() time.Time, run func(context.Context) error) error {
+	if config == nil {
+		return run(ctx)
+	}
+	// The Kafka receiver consumes the partitions without committed offsets from the start of its first run, so that
+	// the events produced while it was disrupted are received.
+	ctx = contextWithKafkaStart(ctx, time.Now())
+
+	for i := 0; ; i++ {
+		runCtx, cancel := context.WithCancel(ctx)
+		errs := make(chan error, 1)
+		go func() {
+			errs <- run(runCtx)
+		}()
+
+		var disrupt <-chan time.Time
+		if config.Count == 0 || i < config.Count {
+			disrupt = time.After(config.ParsedInterval)
+		}
+
+		select {
+		case <-ctx.Done():
+			cancel()
+			return <-errs
+		case err := <-errs:
+			cancel()
+			return err
+		case <-disrupt:
+		}
+
+		logger(LogComponentReceiver).Infow("Disrupting the receiver", "disruption", i+1, "downtime", config.ParsedDowntime)
+		sm.startDisruption(now())
+		markReceiverNotReady(ctx)
+		cancel()
+		if err := <-errs; err != nil {
+			logger(LogComponentReceiver).Infow("Receiver stopped", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(config.ParsedDowntime):
+		}
+		logger(LogComponentReceiver).Infow("Restarting the receiver", "disruption", i+1)
+		sm.endDisruption(now())
+	}
+}
@@ -0,0 +1,125 @@
+package sacura
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDisruptionsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   DisruptionsConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{name: "defaults", config: DisruptionsConfig{Interval: "30s"}},
+		{name: "kafka", config: DisruptionsConfig{Interval: "30s", Downtime: "5s", Count: 3}, receiver: ReceiverConfig{Protocol: ProtocolKafka}},
+		{name: "no interval", config: DisruptionsConfig{}, wantErr: true},
+		{name: "negative interval", config: DisruptionsConfig{Interval: "-1s"}, wantErr: true},
+		{name: "invalid downtime", config: DisruptionsConfig{Interval: "30s", Downtime: "0s"}, wantErr: true},
+		{name: "negative count", config: DisruptionsConfig{Interval: "30s", Count: -1}, wantErr: true},
+		{name: "unsupported protocol", config: DisruptionsConfig{Interval: "30s"}, receiver: ReceiverConfig{Protocol: ProtocolMQTT}, wantErr: true},
+		{name: "receiver disabled", config: DisruptionsConfig{Interval: "30s"}, receiver: ReceiverConfig{Disabled: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.receiver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (tt.config.ParsedInterval == 0 || tt.config.ParsedDowntime == 0) {
+				t.Errorf("expected durations to be parsed, got %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestRunDisruptedReceiver(t *testing.T) {
+	config := &DisruptionsConfig{Interval: "50ms", Downtime: "20ms", Count: 2}
+	if err := config.validate(&ReceiverConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{Disruptions: config}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runs := 0
+	var start time.Time
+	err := runDisruptedReceiver(ctx, config, sm, time.Now, func(ctx context.Context) error {
+		runs++
+		// The start of the Kafka receiver is kept across restarts.
+		if runs == 1 {
+			start = kafkaStartFromContext(ctx)
+		}
+		if got := kafkaStartFromContext(ctx); got.IsZero() || !got.Equal(start) {
+			t.Errorf("want start %v, got %v", start, got)
+		}
+		sm.duplicateCount.Inc()
+		if runs == 3 {
+			go func() {
+				time.Sleep(100 * time.Millisecond)
+				cancel()
+			}()
+		}
+		<-ctx.Done()
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 3 {
+		t.Errorf("want 3 runs of the receiver, got %d", runs)
+	}
+
+	report := sm.GenerateReport()
+	if report.Disruptions == nil || report.Disruptions.Count != 2 {
+		t.Fatalf("want 2 disruptions, got %+v", report.Disruptions)
+	}
+	for i, w := range report.Disruptions.Windows {
+		if downtime := w.End.Sub(w.Start); downtime < 20*time.Millisecond {
+			t.Errorf("want disruption %d to last at least 20ms, got %v", i, downtime)
+		}
+		if w.DuplicateCount != 1 {
+			t.Errorf("want 1 duplicate after disruption %d, got %d", i, w.DuplicateCount)
+		}
+	}
+	if report.Disruptions.BaselineDuplicateCount != 1 {
+		t.Errorf("want 1 duplicate before the first disruption, got %d", report.Disruptions.BaselineDuplicateCount)
+	}
+}
+
+func TestStateManagerDisruptionsReport(t *testing.T) {
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{Disruptions: &DisruptionsConfig{}}})
+	start := time.Now()
+
+	sm.duplicateCount.Add(2)
+	sm.startDisruption(start)
+	sm.endDisruption(start.Add(time.Second))
+	sm.duplicateCount.Add(5)
+	sm.orderingViolationCount.Add(3)
+	// The test ended during the second disruption.
+	sm.startDisruption(start.Add(time.Minute))
+	sm.orderingViolationCount.Add(1)
+
+	report := sm.GenerateReport()
+	want := &DisruptionsReport{
+		Count: 2,
+		Windows: []DisruptionWindow{
+			{Start: start, End: start.Add(time.Second), DuplicateCount: 5, OrderingViolationCount: 3},
+			{Start: start.Add(time.Minute), OrderingViolationCount: 1},
+		},
+		BaselineDuplicateCount: 2,
+	}
+	if diff := cmp.Diff(want, report.Disruptions); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if report := newTestStateManager(t, Config{}).GenerateReport(); report.Disruptions != nil {
+		t.Errorf("want no disruptions section, got %+v", report.Disruptions)
+	}
+}
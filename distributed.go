@@ -0,0 +1,520 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+type DistributedRole string
+
+const (
+	// DistributedRoleAggregator owns the StateManager and produces the consolidated report.
+	DistributedRoleAggregator DistributedRole = "aggregator"
+	// DistributedRoleInstance runs the sender and/or the receiver and reports sent and received events to the
+	// aggregator.
+	DistributedRoleInstance DistributedRole = "instance"
+	// DistributedRoleController is an aggregator serving the controller HTTP API, it registers agents, distributes
+	// its config to them and starts them in lockstep.
+	DistributedRoleController DistributedRole = "controller"
+	// DistributedRoleAgent registers to the controller at AggregatorURL, runs the config distributed by the
+	// controller as an instance and reports sent and received events to the controller.
+	DistributedRoleAgent DistributedRole = "agent"
+
+	aggregatorSentPath     = "/sent"
+	aggregatorReceivedPath = "/received"
+	aggregatorDonePath     = "/done"
+
+	aggregatorBatchSize     = 100
+	aggregatorFlushInterval = time.Second
+)
+
+var errAggregatorClosed = errors.New("aggregator closed")
+
+type DistributedConfig struct {
+	Role DistributedRole `json:"role" yaml:"role"`
+
+	// AggregatorURL is the URL of the aggregator instances report to.
+	AggregatorURL string `json:"aggregatorURL" yaml:"aggregatorURL"`
+
+	// Port is the port the aggregator listens on.
+	Port int `json:"port" yaml:"port"`
+	// ExpectedInstances is the number of instances the aggregator waits for before producing the report.
+	ExpectedInstances int `json:"expectedInstances" yaml:"expectedInstances"`
+
+	// ExclusivePartitions fails the verification when events of a partition key are received by more than one
+	// instance, as with consumer groups assigning each partition to a single consumer. It requires ordered mode.
+	ExclusivePartitions bool `json:"exclusivePartitions" yaml:"exclusivePartitions"`
+
+	// Instance identifies the instance to the aggregator, events received by the instance are attributed to it.
+	//
+	// Defaults to the hostname, or to a random ID when the hostname is not available.
+	Instance string `json:"instance" yaml:"instance"`
+
+	// AgentRole is the part of the distributed config an agent runs.
+	//
+	// Defaults to AgentRoleSenderReceiver.
+	AgentRole AgentRole `json:"agentRole" yaml:"agentRole"`
+}
+
+// hostname returns the hostname used as default instance, it is a variable so that tests can replace it.
+var hostname = os.Hostname
+
+// defaultInstance returns the hostname, or a random ID when the hostname is not available.
+func defaultInstance() string {
+	name, err := hostname()
+	if err == nil && name != "" {
+		return name
+	}
+	id := "sacura-" + uuid.New().String()
+	logger(logComponentRun).Warnw("Failed to get the hostname, using a random instance ID", "instance", id, "error", err)
+	return id
+}
+
+type aggregatedReceivedEvent struct {
+	Event          ce.Event    `json:"event"`
+	ReceivedAt     time.Time   `json:"receivedAt"`
+	Nacked         bool        `json:"nacked,omitempty"`
+	DeadLettered   bool        `json:"deadLettered,omitempty"`
+	Sink           string      `json:"sink,omitempty"`
+	Endpoint       string      `json:"endpoint,omitempty"`
+	ContentMode    ContentMode `json:"contentMode,omitempty"`
+	Replica        string      `json:"replica,omitempty"`
+	Compressed     bool        `json:"compressed,omitempty"`
+	Mangled        bool        `json:"mangled,omitempty"`
+	DataChecksum   string      `json:"dataChecksum,omitempty"`
+	ContentType    string      `json:"contentType,omitempty"`
+	DeliverySource string      `json:"deliverySource,omitempty"`
+	Suppressed     bool        `json:"suppressed,omitempty"`
+}
+
+type aggregatedDone struct {
+	Instance string  `json:"instance"`
+	Metrics  Metrics `json:"metrics"`
+}
+
+// isAggregator returns true when the given config runs the aggregator of the distributed mode.
+func isAggregator(config Config) bool {
+	return config.Distributed != nil && (config.Distributed.Role == DistributedRoleAggregator || config.Distributed.Role == DistributedRoleController)
+}
+
+// aggregatorClient forwards sent and received events to the aggregator.
+type aggregatorClient struct {
+	url    string
+	client *http.Client
+	wg     sync.WaitGroup
+	// instance identifies this instance, received events are attributed to it.
+	instance string
+}
+
+func newAggregatorClient(config *DistributedConfig) *aggregatorClient {
+	instance := config.Instance
+	if instance == "" {
+		instance = defaultInstance()
+	}
+	return &aggregatorClient{
+		url:      config.AggregatorURL,
+		client:   &http.Client{Timeout: 30 * time.Second},
+		instance: instance,
+	}
+}
+
+// forwardSent forwards sent events to the aggregator and returns a channel mirroring the given one.
+func (c *aggregatorClient) forwardSent(sent <-chan ce.Event) <-chan ce.Event {
+	out := make(chan ce.Event, cap(sent))
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(out)
+
+		batch := make([]ce.Event, 0, aggregatorBatchSize)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			c.post(aggregatorSentPath, batch)
+			batch = batch[:0]
+		}
+		ticker := time.NewTicker(aggregatorFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-sent:
+				if !ok {
+					flush()
+					return
+				}
+				out <- e
+				batch = append(batch, e)
+				if len(batch) == aggregatorBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return out
+}
+
+// forwardReceived forwards received events to the aggregator and returns a channel mirroring the given one.
+func (c *aggregatorClient) forwardReceived(received <-chan ReceivedEvent) <-chan ReceivedEvent {
+	out := make(chan ReceivedEvent, cap(received))
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer close(out)
+
+		batch := make([]aggregatedReceivedEvent, 0, aggregatorBatchSize)
+		flush := func() {
+			if len(batch) == 0 {
+				return
+			}
+			c.post(aggregatorReceivedPath, batch)
+			batch = batch[:0]
+		}
+		ticker := time.NewTicker(aggregatorFlushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case e, ok := <-received:
+				if !ok {
+					flush()
+					return
+				}
+				out <- e
+				replica := e.Replica
+				if replica == "" {
+					replica = c.instance
+				}
+				batch = append(batch, aggregatedReceivedEvent{Event: e.Event, ReceivedAt: e.ReceivedAt, Nacked: e.Nacked, DeadLettered: e.DeadLettered, Sink: e.Sink, Endpoint: e.Endpoint, ContentMode: e.ContentMode, Replica: replica, Compressed: e.Compressed, Mangled: e.Mangled, DataChecksum: e.DataChecksum, ContentType: e.ContentType, DeliverySource: e.DeliverySource, Suppressed: e.Suppressed})
+				if len(batch) == aggregatorBatchSize {
+					flush()
+				}
+			case <-ticker.C:
+				flush()
+			}
+		}
+	}()
+	return out
+}
+
+// done waits for all events to be forwarded and notifies the aggregator that this instance is done.
+func (c *aggregatorClient) done(metrics Metrics) {
+	c.wg.Wait()
+
+	c.post(aggregatorDonePath, aggregatedDone{Instance: c.instance, Metrics: metrics})
+}
+
+func (c *aggregatorClient) post(path string, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		logger(LogComponentState).Errorw("Failed to marshal request for aggregator", "path", path, "error", err)
+		return
+	}
+
+	// Retry until the aggregator accepts the request, losing forwarded events would result in false losses.
+	for attempt := 1; ; attempt++ {
+		err := c.doPost(path, b)
+		if err == nil {
+			return
+		}
+		if errors.Is(err, errAggregatorClosed) {
+			logger(LogComponentState).Warnw("Aggregator closed, dropping request", "path", path)
+			return
+		}
+		logger(LogComponentState).Warnw("Failed to send request to aggregator", "path", path, "attempt", attempt, "error", err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (c *aggregatorClient) doPost(path string, body []byte) error {
+	resp, err := c.client.Post(c.url+path, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusGone {
+		return errAggregatorClosed
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("expected status code 2xx, got %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// runAggregator collects sent and received events from instances and produces the consolidated report.
+func runAggregator(ctx context.Context, config Config) (Report, error) {
+
+	sent := make(chan ce.Event, aggregatorBatchSize)
+	received := make(chan ReceivedEvent, aggregatorBatchSize)
+
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		return Report{}, err
+	}
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+	stopInterimReports := sm.startInterimReports(config.Report.Interim)
+	// The aggregator can't stop instances, so it only records expired events.
+	stopExpiration := sm.startExpiration(func() {})
+
+	aggregator := newAggregator(config.Distributed.ExpectedInstances, sent, received)
+
+	s := http.Server{
+		Addr:    fmt.Sprintf(":%d", config.Distributed.Port),
+		Handler: aggregator,
+	}
+	if config.Distributed.Role == DistributedRoleController {
+		c, err := newControlPlane(config, aggregator)
+		if err != nil {
+			return Report{}, err
+		}
+		s.Handler = c
+	}
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- s.ListenAndServe()
+	}()
+
+	logger(LogComponentState).Infow("Waiting for instances to report", "expected", config.Distributed.ExpectedInstances)
+	select {
+	case <-ctx.Done():
+		logger(LogComponentState).Infow("Aggregator context done", "error", ctx.Err())
+	case <-aggregator.allDone:
+		logger(LogComponentState).Info("All instances reported")
+	case err := <-errChan:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return Report{}, fmt.Errorf("failed to start aggregator: %w", err)
+		}
+	}
+	_ = s.Close()
+
+	metrics := aggregator.close()
+	<-receivedSignal
+	<-sentSignal
+	stopInterimReports()
+	stopExpiration()
+
+	sm.Terminated(metrics)
+	report := sm.GenerateReport()
+	logReport(config.Report, report)
+
+	// Instances are the ones sending events, so the aggregator always verifies accepted events.
+	verifyConfig := config
+	verifyConfig.Sender.Disabled = false
+
+	err = verifyAndWriteReports(verifyConfig, &report)
+	return report, err
+}
+
+type aggregator struct {
+	lock   sync.Mutex
+	closed bool
+
+	sent     chan<- ce.Event
+	received chan<- ReceivedEvent
+
+	expectedInstances int
+	doneInstances     int
+	metrics           Metrics
+	allDone           chan struct{}
+
+	mux *http.ServeMux
+}
+
+func newAggregator(expectedInstances int, sent chan<- ce.Event, received chan<- ReceivedEvent) *aggregator {
+	a := &aggregator{
+		sent:              sent,
+		received:          received,
+		expectedInstances: expectedInstances,
+		allDone:           make(chan struct{}),
+		mux:               http.NewServeMux(),
+	}
+	a.mux.HandleFunc(aggregatorSentPath, a.handleSent)
+	a.mux.HandleFunc(aggregatorReceivedPath, a.handleReceived)
+	a.mux.HandleFunc(aggregatorDonePath, a.handleDone)
+	return a
+}
+
+func (a *aggregator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.mux.ServeHTTP(w, r)
+}
+
+func (a *aggregator) handleSent(w http.ResponseWriter, r *http.Request) {
+	a.handle(w, r, a.recordSent)
+}
+
+func (a *aggregator) handleReceived(w http.ResponseWriter, r *http.Request) {
+	a.handle(w, r, a.recordReceived)
+}
+
+func (a *aggregator) handleDone(w http.ResponseWriter, r *http.Request) {
+	a.handle(w, r, a.recordDone)
+}
+
+// handle serves a request of instances with the given record function.
+func (a *aggregator) handle(w http.ResponseWriter, r *http.Request, record func([]byte) error) {
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	err = record(b)
+	switch {
+	case errors.Is(err, errAggregatorClosed):
+		http.Error(w, err.Error(), http.StatusGone)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// recordSent records the given JSON array of sent events.
+func (a *aggregator) recordSent(b []byte) error {
+	var events []ce.Event
+	if err := json.Unmarshal(b, &events); err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return errAggregatorClosed
+	}
+	for _, e := range events {
+		a.sent <- e
+	}
+	return nil
+}
+
+// recordReceived records the given JSON array of received events.
+func (a *aggregator) recordReceived(b []byte) error {
+	var events []aggregatedReceivedEvent
+	if err := json.Unmarshal(b, &events); err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return errAggregatorClosed
+	}
+	for _, e := range events {
+		a.received <- ReceivedEvent{Event: e.Event, ReceivedAt: e.ReceivedAt, Nacked: e.Nacked, DeadLettered: e.DeadLettered, Sink: e.Sink, Endpoint: e.Endpoint, ContentMode: e.ContentMode, Replica: e.Replica, Compressed: e.Compressed, Mangled: e.Mangled, DataChecksum: e.DataChecksum, ContentType: e.ContentType, DeliverySource: e.DeliverySource, Suppressed: e.Suppressed}
+	}
+	return nil
+}
+
+// recordDone records the JSON metrics of an instance done.
+func (a *aggregator) recordDone(b []byte) error {
+	done := aggregatedDone{}
+	if err := json.Unmarshal(b, &done); err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.closed {
+		return errAggregatorClosed
+	}
+
+	logger(LogComponentState).Infow("Instance done", "instance", done.Instance, "accepted", done.Metrics.AcceptedCount)
+
+	a.metrics = mergeMetrics(a.metrics, done.Metrics)
+	a.doneInstances++
+	if a.doneInstances == a.expectedInstances {
+		close(a.allDone)
+	}
+	return nil
+}
+
+// close stops accepting events and returns the merged metrics of all instances.
+func (a *aggregator) close() Metrics {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if !a.closed {
+		a.closed = true
+		close(a.sent)
+		close(a.received)
+	}
+	return a.metrics
+}
+
+func mergeMetrics(a, b Metrics) Metrics {
+	m := Metrics{
+		ProposedCount:       a.ProposedCount + b.ProposedCount,
+		AcceptedCount:       a.AcceptedCount + b.AcceptedCount,
+		WarmupProposedCount: a.WarmupProposedCount + b.WarmupProposedCount,
+		WarmupAcceptedCount: a.WarmupAcceptedCount + b.WarmupAcceptedCount,
+		NotSentCount:        a.NotSentCount + b.NotSentCount,
+		TimedOutCount:       a.TimedOutCount + b.TimedOutCount,
+		SendRetryCount:      a.SendRetryCount + b.SendRetryCount,
+		TargetFailoverCount: a.TargetFailoverCount + b.TargetFailoverCount,
+		Metrics:             a.Metrics,
+	}
+	if len(a.FailedSends)+len(b.FailedSends) > 0 {
+		m.FailedSends = append(append([]FailedSend{}, a.FailedSends...), b.FailedSends...)
+		sort.Slice(m.FailedSends, func(i, j int) bool { return m.FailedSends[i].ID < m.FailedSends[j].ID })
+	}
+	if len(a.SendAttempts)+len(b.SendAttempts) > 0 {
+		m.SendAttempts = make(map[string]int, len(a.SendAttempts)+len(b.SendAttempts))
+		for _, attempts := range []map[string]int{a.SendAttempts, b.SendAttempts} {
+			for id, n := range attempts {
+				m.SendAttempts[id] = n
+			}
+		}
+	}
+	if a.Throttling != nil || b.Throttling != nil {
+		t := ThrottlingMetrics{}
+		for _, throttling := range []*ThrottlingMetrics{a.Throttling, b.Throttling} {
+			if throttling == nil {
+				continue
+			}
+			t.ThrottledCount += throttling.ThrottledCount
+			t.EpisodeCount += throttling.EpisodeCount
+			t.Duration += throttling.Duration
+			t.PausedDuration += throttling.PausedDuration
+			if throttling.LongestEpisode > t.LongestEpisode {
+				t.LongestEpisode = throttling.LongestEpisode
+			}
+		}
+		m.Throttling = &t
+	}
+
+	m.CircuitBreaker = mergeCircuitBreakerMetrics(a.CircuitBreaker, b.CircuitBreaker)
+
+	m.Metrics = mergeSendMetrics(a.Metrics, b.Metrics)
+	for _, targets := range []map[string]SendMetrics{a.TargetMetrics, b.TargetMetrics} {
+		for target, tm := range targets {
+			if m.TargetMetrics == nil {
+				m.TargetMetrics = make(map[string]SendMetrics)
+			}
+			if merged, ok := m.TargetMetrics[target]; ok {
+				tm = mergeSendMetrics(merged, tm)
+			}
+			m.TargetMetrics[target] = tm
+		}
+	}
+
+	return m
+}
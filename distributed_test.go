@@ -0,0 +1,188 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/uuid"
+)
+
+func TestAggregator(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sent     int
+		received int
+		wantErr  bool
+	}{
+		{
+			name:     "all received",
+			sent:     250,
+			received: 250,
+		},
+		{
+			name:     "lost events",
+			sent:     250,
+			received: 200,
+			wantErr:  true,
+		},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			port := 9301 + i
+			distributed := &DistributedConfig{
+				Role:              DistributedRoleAggregator,
+				Port:              port,
+				ExpectedInstances: 2,
+			}
+			config := Config{Distributed: distributed, DeliveryGuarantee: AtLeastOnce}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			defer cancel()
+
+			errChan := make(chan error, 1)
+			var report Report
+			go func() {
+				var err error
+				report, err = runAggregator(ctx, config)
+				errChan <- err
+			}()
+
+			instance := &DistributedConfig{
+				Role:          DistributedRoleInstance,
+				AggregatorURL: fmt.Sprintf("http://localhost:%d", port),
+			}
+
+			senderClient := newAggregatorClient(instance)
+			sent := make(chan ce.Event, tt.sent)
+			for i := 0; i < tt.sent; i++ {
+				e := cetest.FullEvent()
+				e.SetID(fmt.Sprint(i))
+				sent <- e
+			}
+			close(sent)
+			for range senderClient.forwardSent(sent) {
+			}
+			senderClient.done(Metrics{ProposedCount: tt.sent, AcceptedCount: tt.sent})
+
+			receiverClient := newAggregatorClient(instance)
+			received := make(chan ReceivedEvent, tt.received)
+			for i := 0; i < tt.received; i++ {
+				e := cetest.FullEvent()
+				e.SetID(fmt.Sprint(i))
+				received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+			}
+			close(received)
+			for range receiverClient.forwardReceived(received) {
+			}
+			receiverClient.done(Metrics{})
+
+			if err := <-errChan; (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if report.ReceivedCount != tt.received {
+				t.Errorf("expected received count %d, got %d", tt.received, report.ReceivedCount)
+			}
+		})
+	}
+}
+
+func TestMergeMetrics(t *testing.T) {
+	a := Metrics{ProposedCount: 10, AcceptedCount: 9}
+	a.Metrics.Requests = 10
+	a.Metrics.Successes = 9
+	a.Metrics.StatusCodes = map[string]int{"200": 9, "500": 1}
+
+	b := Metrics{ProposedCount: 5, AcceptedCount: 4, WarmupProposedCount: 1, WarmupAcceptedCount: 1}
+	b.Metrics.Requests = 6
+	b.Metrics.Successes = 5
+	b.Metrics.StatusCodes = map[string]int{"200": 5}
+
+	m := mergeMetrics(mergeMetrics(Metrics{}, a), b)
+	if m.ProposedCount != 15 || m.AcceptedCount != 13 || m.WarmupAcceptedCount != 1 || m.Metrics.Requests != 16 {
+		t.Errorf("unexpected merged metrics %+v", m)
+	}
+	if m.Metrics.Success != 14.0/16 {
+		t.Errorf("expected success ratio to include the warmup, got %v", m.Metrics.Success)
+	}
+	if m.Metrics.StatusCodes["200"] != 14 || m.Metrics.StatusCodes["500"] != 1 {
+		t.Errorf("unexpected merged status codes %+v", m.Metrics.StatusCodes)
+	}
+
+	a.TargetMetrics = map[string]SendMetrics{"http://a": {Requests: 4, StatusCodes: map[string]int{"202": 4}}}
+	b.TargetMetrics = map[string]SendMetrics{
+		"http://a": {Requests: 2, StatusCodes: map[string]int{"503": 2}},
+		"http://b": {Requests: 1, StatusCodes: map[string]int{"202": 1}},
+	}
+	m = mergeMetrics(mergeMetrics(Metrics{}, a), b)
+	if got := m.TargetMetrics["http://a"]; got.Requests != 6 || got.StatusCodes["202"] != 4 || got.StatusCodes["503"] != 2 {
+		t.Errorf("unexpected merged metrics of target http://a %+v", got)
+	}
+	if got := m.TargetMetrics["http://b"]; got.Requests != 1 {
+		t.Errorf("unexpected merged metrics of target http://b %+v", got)
+	}
+}
+
+func TestDistributedInstance(t *testing.T) {
+	tests := []struct {
+		name       string
+		instance   string
+		hostname   func() (string, error)
+		want       string
+		wantRandom bool
+	}{
+		{
+			name:     "configured",
+			instance: "sacura-0",
+			hostname: func() (string, error) { return "host", nil },
+			want:     "sacura-0",
+		},
+		{
+			name:     "hostname",
+			hostname: func() (string, error) { return "host", nil },
+			want:     "host",
+		},
+		{
+			name:       "hostname error",
+			hostname:   func() (string, error) { return "", errors.New("no hostname") },
+			wantRandom: true,
+		},
+		{
+			name:       "empty hostname",
+			hostname:   func() (string, error) { return "", nil },
+			wantRandom: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(h func() (string, error)) { hostname = h }(hostname)
+			hostname = tt.hostname
+
+			config := &DistributedConfig{Role: DistributedRoleInstance, AggregatorURL: "http://localhost:9300", Instance: tt.instance}
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			got := newAggregatorClient(config).instance
+			if got != config.Instance {
+				t.Errorf("want client instance %q, got %q", config.Instance, got)
+			}
+			if tt.wantRandom {
+				if _, err := uuid.Parse(strings.TrimPrefix(got, "sacura-")); err != nil || got == defaultInstance() {
+					t.Errorf("want random instance ID, got %q", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("want instance %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// DefaultDrainWindow is the default window the receive rate is measured over by receiver.drain.
+const DefaultDrainWindow = 10 * time.Second
+
+// DrainConfig extends the receiver timeout as long as events keep arriving, up to a hard maximum, so that slow but
+// steady brokers still draining their backlog aren't reported as losing events.
+type DrainConfig struct {
+	// MinRate is the receive rate, in events per second, at or above which the wait is extended.
+	MinRate float64 `json:"minRate" yaml:"minRate"`
+	// Window is the window the receive rate is measured over before the timeout, and the length of each extension.
+	// It must be at most receiver.timeout.
+	//
+	// Defaults to DefaultDrainWindow, or to receiver.timeout when shorter.
+	Window string `json:"window" yaml:"window"`
+	// MaxTimeout is the maximum time the receiver waits, extensions included, it must be greater than
+	// receiver.timeout.
+	MaxTimeout string `json:"maxTimeout" yaml:"maxTimeout"`
+
+	ParsedWindow     time.Duration
+	ParsedMaxTimeout time.Duration
+}
+
+func (c *DrainConfig) validate(receiver *ReceiverConfig) error {
+	if c.MinRate <= 0 {
+		return invalidErr("receiver.drain.minRate", fmt.Errorf("%v must be greater than 0", c.MinRate))
+	}
+	if c.MaxTimeout == "" {
+		return invalidErr("receiver.drain.maxTimeout", errors.New("cannot be empty"))
+	}
+	var err error
+	c.ParsedMaxTimeout, err = time.ParseDuration(c.MaxTimeout)
+	if err != nil {
+		return invalidErr("receiver.drain.maxTimeout", err)
+	}
+	if c.ParsedMaxTimeout <= receiver.ParsedTimeout {
+		return invalidErr("receiver.drain.maxTimeout", fmt.Errorf("%v must be greater than the timeout %v", c.ParsedMaxTimeout, receiver.ParsedTimeout))
+	}
+	c.ParsedWindow = DefaultDrainWindow
+	if c.ParsedWindow > receiver.ParsedTimeout {
+		c.ParsedWindow = receiver.ParsedTimeout
+	}
+	if c.Window != "" {
+		c.ParsedWindow, err = time.ParseDuration(c.Window)
+		if err != nil {
+			return invalidErr("receiver.drain.window", err)
+		}
+		if c.ParsedWindow <= 0 || c.ParsedWindow > receiver.ParsedTimeout {
+			return invalidErr("receiver.drain.window", fmt.Errorf("%v must be greater than 0 and at most the timeout %v", c.ParsedWindow, receiver.ParsedTimeout))
+		}
+	}
+	return nil
+}
+
+// drainer decides whether the receiver timeout is extended.
+type drainer struct {
+	config   *DrainConfig
+	received func() int64
+	deadline time.Time
+	// mark is the number of received events at the start of the current window.
+	mark int64
+}
+
+// newDrainer returns the drainer of the given config for a wait started at start, it returns nil when draining is
+// disabled.
+func newDrainer(config *DrainConfig, received func() int64, start time.Time) *drainer {
+	if config == nil {
+		return nil
+	}
+	return &drainer{config: config, received: received, deadline: start.Add(config.ParsedMaxTimeout)}
+}
+
+// windowStart returns the time at which the receive rate starts being measured for a timeout at the given deadline.
+func (d *drainer) windowStart(deadline time.Time) time.Time {
+	return deadline.Add(-d.config.ParsedWindow)
+}
+
+// startWindow starts measuring the receive rate.
+func (d *drainer) startWindow() {
+	d.mark = d.received()
+}
+
+// extension returns the extension of the timeout reached at now, it returns 0 when events aren't arriving at the
+// minimum rate anymore or when the maximum timeout has been reached.
+func (d *drainer) extension(now time.Time) time.Duration {
+	if d == nil {
+		return 0
+	}
+	rate := float64(d.received()-d.mark) / d.config.ParsedWindow.Seconds()
+	remaining := d.deadline.Sub(now)
+	if rate < d.config.MinRate || remaining <= 0 {
+		return 0
+	}
+	d.startWindow()
+	logger(LogComponentReceiver).Infow("Events still arriving, extending the receiver timeout", "rate", rate, "minRate", d.config.MinRate)
+	if remaining < d.config.ParsedWindow {
+		return remaining
+	}
+	return d.config.ParsedWindow
+}
@@ -0,0 +1,88 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDrainConfigValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     DrainConfig
+		timeout    time.Duration
+		wantErr    bool
+		wantWindow time.Duration
+	}{
+		{name: "default window", config: DrainConfig{MinRate: 10, MaxTimeout: "5m"}, timeout: time.Minute, wantWindow: DefaultDrainWindow},
+		{name: "default window longer than the timeout", config: DrainConfig{MinRate: 10, MaxTimeout: "1m"}, timeout: 5 * time.Second, wantWindow: 5 * time.Second},
+		{name: "window", config: DrainConfig{MinRate: 0.5, Window: "30s", MaxTimeout: "5m"}, timeout: time.Minute, wantWindow: 30 * time.Second},
+		{name: "no rate", config: DrainConfig{MaxTimeout: "5m"}, timeout: time.Minute, wantErr: true},
+		{name: "no max timeout", config: DrainConfig{MinRate: 10}, timeout: time.Minute, wantErr: true},
+		{name: "max timeout before timeout", config: DrainConfig{MinRate: 10, MaxTimeout: "1m"}, timeout: time.Minute, wantErr: true},
+		{name: "window longer than the timeout", config: DrainConfig{MinRate: 10, Window: "2m", MaxTimeout: "5m"}, timeout: time.Minute, wantErr: true},
+		{name: "invalid window", config: DrainConfig{MinRate: 10, Window: "10", MaxTimeout: "5m"}, timeout: time.Minute, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&ReceiverConfig{ParsedTimeout: tt.timeout})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedWindow != tt.wantWindow {
+				t.Errorf("want window %v, got %v", tt.wantWindow, tt.config.ParsedWindow)
+			}
+		})
+	}
+}
+
+func TestWaitReceiverTerminationDrain(t *testing.T) {
+	tests := []struct {
+		name      string
+		receiving time.Duration
+		min       time.Duration
+		max       time.Duration
+	}{
+		{
+			name: "no events",
+			min:  200 * time.Millisecond,
+			max:  400 * time.Millisecond,
+		},
+		{
+			name:      "extended while events arrive",
+			receiving: 350 * time.Millisecond,
+			min:       400 * time.Millisecond,
+			max:       600 * time.Millisecond,
+		},
+		{
+			name:      "max timeout",
+			receiving: time.Hour,
+			min:       700 * time.Millisecond,
+			max:       900 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := ReceiverConfig{
+				ParsedTimeout: 200 * time.Millisecond,
+				Drain:         &DrainConfig{MinRate: 100, ParsedWindow: 100 * time.Millisecond, ParsedMaxTimeout: 700 * time.Millisecond},
+			}
+			start := time.Now()
+			// Events are received at 1000/s.
+			received := func() int64 {
+				elapsed := time.Since(start)
+				if elapsed > tt.receiving {
+					elapsed = tt.receiving
+				}
+				return elapsed.Milliseconds()
+			}
+
+			waitReceiverTermination(&config, time.Now, received, nil, nil)
+
+			if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("expected termination after %v to %v, got %v", tt.min, tt.max, elapsed)
+			}
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package sacura
+
+import (
+	"time"
+)
+
+// DuplicateDelayBuckets are the upper bounds of the buckets of the duplicate delay histogram.
+var DuplicateDelayBuckets = []time.Duration{time.Second, 10 * time.Second, time.Minute}
+
+// DuplicateDelayReport reports when duplicates arrived relative to the first delivery of the original event.
+//
+// Duplicates arriving shortly after the original event are usually caused by retries, duplicates arriving much later
+// by replays, for example after a consumer group rebalance.
+type DuplicateDelayReport struct {
+	// Delay are the percentiles of the delay of duplicates.
+	Delay LatencyStats `json:"delay"`
+	// Buckets are the cumulative number of duplicates received within each of the DuplicateDelayBuckets.
+	Buckets []DuplicateDelayBucket `json:"buckets"`
+}
+
+type DuplicateDelayBucket struct {
+	Within time.Duration `json:"within"`
+	Count  int           `json:"count"`
+}
+
+// recordDuplicateDelay records the delay of the given duplicate since the first delivery of the original event, it
+// must be called while holding the lock.
+func (s *StateManager) recordDuplicateDelay(e *ReceivedEvent) {
+	first, ok := s.receivedAt[e.Event.ID()]
+	if !ok || e.ReceivedAt.IsZero() {
+		return
+	}
+	delay := e.ReceivedAt.Sub(first)
+	if delay < 0 {
+		delay = 0
+	}
+	s.duplicateDelays.record(delay)
+}
+
+// duplicateDelayReport returns the report of the delay of duplicates, it returns nil when no duplicates have been
+// received. It must be called while holding the lock.
+func (s *StateManager) duplicateDelayReport() *DuplicateDelayReport {
+	if s.duplicateDelays.count == 0 {
+		return nil
+	}
+	r := &DuplicateDelayReport{
+		Delay:   s.duplicateDelays.stats(),
+		Buckets: make([]DuplicateDelayBucket, len(DuplicateDelayBuckets)),
+	}
+	for i, within := range DuplicateDelayBuckets {
+		r.Buckets[i].Within = within
+		for ms, n := range s.duplicateDelays.buckets {
+			if time.Duration(ms)*time.Millisecond <= within {
+				r.Buckets[i].Count += n
+			}
+		}
+	}
+	return r
+}
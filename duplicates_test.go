@@ -0,0 +1,66 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerDuplicateDelays(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{})
+
+	receivedAt := time.Now()
+	for i, delays := range [][]time.Duration{
+		{},
+		{500 * time.Millisecond},
+		{time.Second, 5 * time.Second},
+		{2 * time.Minute},
+	} {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: receivedAt})
+		for _, d := range delays {
+			sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: receivedAt.Add(d)})
+		}
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+
+	if report.DuplicateCount != 4 {
+		t.Errorf("expected 4 duplicates, got %d", report.DuplicateCount)
+	}
+	want := &DuplicateDelayReport{
+		Delay: LatencyStats{Count: 4, P50: time.Second, P90: 2 * time.Minute, P99: 2 * time.Minute, Max: 2 * time.Minute},
+		Buckets: []DuplicateDelayBucket{
+			{Within: time.Second, Count: 2},
+			{Within: 10 * time.Second, Count: 3},
+			{Within: time.Minute, Count: 3},
+		},
+	}
+	if diff := cmp.Diff(want, report.DuplicateDelays); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStateManagerNoDuplicateDelays(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{})
+
+	e := cetest.FullEvent()
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+	sm.lock.Unlock()
+
+	if r := sm.GenerateReport().DuplicateDelays; r != nil {
+		t.Errorf("expected no duplicate delays, got %+v", r)
+	}
+}
@@ -0,0 +1,94 @@
+package sacura
+
+import (
+	"sort"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// duplicateSuppressor tracks the events accepted by the receiver with receiver.suppressDuplicates, like an
+// idempotent consumer.
+type duplicateSuppressor struct {
+	lock     sync.Mutex
+	accepted sets.String
+}
+
+// newDuplicateSuppressor returns a duplicate suppressor, it returns nil when duplicates aren't suppressed.
+func newDuplicateSuppressor(config *ReceiverConfig) *duplicateSuppressor {
+	if !config.SuppressDuplicates {
+		return nil
+	}
+	return &duplicateSuppressor{accepted: sets.NewString()}
+}
+
+// suppress records the acceptance of the event with the given ID and returns whether it has already been accepted.
+func (d *duplicateSuppressor) suppress(id string) bool {
+	if d == nil {
+		return false
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.accepted.Has(id) {
+		return true
+	}
+	d.accepted.Insert(id)
+	return false
+}
+
+// forget forgets the acceptance of the event with the given ID, for example when its processing failed after
+// suppress returned false.
+func (d *duplicateSuppressor) forget(id string) {
+	if d == nil {
+		return
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.accepted.Delete(id)
+}
+
+// SuppressedDuplicatesReport reports the duplicates dropped by receiver.suppressDuplicates before verification, so
+// that a single run reports both the duplicates delivered by the broker and the duplicates seen by an idempotent
+// application.
+type SuppressedDuplicatesReport struct {
+	// Count is the number of suppressed duplicates, EventsByPartitionKey collects them by partition key, an event is
+	// listed once per suppressed delivery.
+	Count                int                 `json:"count"`
+	EventsByPartitionKey map[string][]string `json:"events,omitempty"`
+	// RawDuplicateCount is the number of duplicates delivered by the broker, including the suppressed ones, while
+	// the DuplicateCount of the report excludes them.
+	RawDuplicateCount int `json:"rawDuplicateCount"`
+}
+
+// recordSuppressedDuplicate records the given event if it has been suppressed by the receiver, it must be called
+// while holding the lock. Suppressed events aren't recorded as received.
+func (s *StateManager) recordSuppressedDuplicate(e *ReceivedEvent) bool {
+	if !e.Suppressed {
+		return false
+	}
+	if s.suppressedDuplicates == nil {
+		s.suppressedDuplicates = make(map[string][]string)
+	}
+	k := partitionKey(&e.Event, &s.stateManagerConfig)
+	s.suppressedDuplicates[k] = append(s.suppressedDuplicates[k], e.Event.ID())
+	return true
+}
+
+// suppressedDuplicatesReport sets the suppressed duplicates section of the report, it must be called while holding
+// the lock and after duplicates have been reported.
+func (s *StateManager) suppressedDuplicatesReport(r *Report) {
+	if !s.config.Receiver.SuppressDuplicates && s.suppressedDuplicates == nil {
+		return
+	}
+	report := &SuppressedDuplicatesReport{EventsByPartitionKey: make(map[string][]string, len(s.suppressedDuplicates))}
+	for k, ids := range s.suppressedDuplicates {
+		suppressed := append([]string{}, ids...)
+		sort.Strings(suppressed)
+		report.EventsByPartitionKey[k] = suppressed
+		report.Count += len(suppressed)
+	}
+	report.RawDuplicateCount = r.DuplicateCount + report.Count
+	r.SuppressedDuplicates = report
+}
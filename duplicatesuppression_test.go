@@ -0,0 +1,121 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestDuplicateSuppressor(t *testing.T) {
+	if s := newDuplicateSuppressor(&ReceiverConfig{}); s != nil || s.suppress("1") {
+		t.Fatal("want no suppression when disabled")
+	}
+	s := newDuplicateSuppressor(&ReceiverConfig{SuppressDuplicates: true})
+	if s.suppress("1") {
+		t.Error("want the first delivery of 1 accepted")
+	}
+	if !s.suppress("1") {
+		t.Error("want the second delivery of 1 suppressed")
+	}
+	if s.suppress("2") {
+		t.Error("want the first delivery of 2 accepted")
+	}
+	// The processing of 2 failed.
+	s.forget("2")
+	if s.suppress("2") {
+		t.Error("want the redelivery of 2 accepted")
+	}
+}
+
+func TestStartReceiverSuppressDuplicates(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 2)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9241, SuppressDuplicates: true}, received, nil)
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		var statusCode int
+		err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+			resp, err := http.Post("http://localhost:9241", "application/cloudevents+json", strings.NewReader(string(body)))
+			if err != nil {
+				return false, nil
+			}
+			defer resp.Body.Close()
+			statusCode = resp.StatusCode
+			return true, nil
+		})
+		if err != nil {
+			t.Fatal("failed to send event", err)
+		}
+		if statusCode != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, statusCode)
+		}
+	}
+	if r := <-received; r.Suppressed {
+		t.Errorf("expected the first delivery not suppressed, got %+v", r)
+	}
+	if r := <-received; !r.Suppressed || r.Event.ID() != e.ID() {
+		t.Errorf("expected the second delivery suppressed, got %+v", r)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestStateManagerSuppressedDuplicates(t *testing.T) {
+	config := Config{
+		Ordered:  &OrderedConfig{NumPartitionKeys: 2},
+		Receiver: ReceiverConfig{SuppressDuplicates: true},
+	}
+	sm := newTestStateManager(t, config)
+
+	var sent []ce.Event
+	for _, id := range []string{"0-1", "0-2", "1-1"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, id[:1])
+		sent = append(sent, e)
+	}
+	now := time.Now()
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+		sm.recordReceived(&ReceivedEvent{Event: sent[i], ReceivedAt: now})
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now, Suppressed: true})
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now, Suppressed: true})
+	sm.recordReceived(&ReceivedEvent{Event: sent[2], ReceivedAt: now, Suppressed: true})
+	// Duplicates received concurrently with their first delivery aren't suppressed.
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: now})
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	if report.DuplicateCount != 1 || report.ReceivedCount != 3 {
+		t.Errorf("want 3 received events and 1 duplicate, got %d received and %d duplicates", report.ReceivedCount, report.DuplicateCount)
+	}
+	want := &SuppressedDuplicatesReport{
+		Count:                3,
+		EventsByPartitionKey: map[string][]string{"0": {"0-1", "0-1"}, "1": {"1-1"}},
+		RawDuplicateCount:    4,
+	}
+	if diff := cmp.Diff(want, report.SuppressedDuplicates); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
@@ -0,0 +1,145 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+const (
+	// HopsExtension is the extension of echoed events carrying the number of echo hops they went through.
+	HopsExtension = "sacurahops"
+
+	// DefaultEchoTimeout is the default timeout of the requests echoing an event.
+	DefaultEchoTimeout = 10 * time.Second
+)
+
+// ReceiverEchoConfig echoes each received event to the next hop of a multi-hop topology and to a verification
+// endpoint, so that the receiver acts both as an intermediate hop and as a sink, for example between two brokers.
+//
+// Echoed events are sent in binary content mode with their HopsExtension incremented. Events that cannot be echoed
+// are nacked, so that the system under test redelivers them.
+type ReceiverEchoConfig struct {
+	// URL is the URL of the next hop, for example the ingress of the second broker.
+	URL string `json:"url" yaml:"url"`
+	// VerificationURL is the URL of the verification endpoint, for example the receiver of the sacura run verifying
+	// the last hop.
+	VerificationURL string `json:"verificationUrl" yaml:"verificationUrl"`
+	// Timeout is the timeout of each echo request.
+	//
+	// Defaults to DefaultEchoTimeout.
+	Timeout string `json:"timeout" yaml:"timeout"`
+
+	ParsedTimeout time.Duration
+}
+
+func (c *ReceiverEchoConfig) validate(protocol Protocol) error {
+	if protocol != "" && protocol != ProtocolHTTP {
+		return invalidErr("receiver.echo", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if c.URL == "" {
+		return invalidErr("receiver.echo.url", errors.New("cannot be empty"))
+	}
+	if err := validateEchoURL("receiver.echo.url", c.URL); err != nil {
+		return err
+	}
+	if c.VerificationURL != "" {
+		if err := validateEchoURL("receiver.echo.verificationUrl", c.VerificationURL); err != nil {
+			return err
+		}
+	}
+	c.ParsedTimeout = DefaultEchoTimeout
+	if c.Timeout != "" {
+		d, err := time.ParseDuration(c.Timeout)
+		if err != nil {
+			return invalidErr("receiver.echo.timeout", err)
+		}
+		if d <= 0 {
+			return invalidErr("receiver.echo.timeout", fmt.Errorf("%s must be positive", c.Timeout))
+		}
+		c.ParsedTimeout = d
+	}
+	return nil
+}
+
+func validateEchoURL(field, v string) error {
+	if u, err := url.Parse(v); err != nil || !u.IsAbs() {
+		return invalidErr(field, fmt.Errorf("%q must be an absolute URL: %v", v, err))
+	}
+	return nil
+}
+
+// echoer echoes received events, it is safe for concurrent use.
+type echoer struct {
+	urls   []string
+	client *http.Client
+}
+
+// newEchoer returns the echoer of the given config, it returns nil when echoing is disabled.
+func newEchoer(config *ReceiverEchoConfig) *echoer {
+	if config == nil {
+		return nil
+	}
+	urls := []string{config.URL}
+	if config.VerificationURL != "" {
+		urls = append(urls, config.VerificationURL)
+	}
+	return &echoer{urls: urls, client: &http.Client{Timeout: config.ParsedTimeout}}
+}
+
+// echo sends the given event with its HopsExtension incremented to the next hop and to the verification endpoint.
+func (e *echoer) echo(ctx context.Context, event *ce.Event) error {
+	if e == nil {
+		return nil
+	}
+	echoed := event.Clone()
+	echoed.SetExtension(HopsExtension, hops(event)+1)
+	for _, u := range e.urls {
+		if err := e.send(ctx, u, &echoed); err != nil {
+			return fmt.Errorf("failed to echo event to %s: %w", u, err)
+		}
+	}
+	return nil
+}
+
+func (e *echoer) send(ctx context.Context, u string, event *ce.Event) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	if err != nil {
+		return err
+	}
+	if err := cehttp.WriteRequest(binding.WithForceBinary(ctx), binding.ToMessage(event), req); err != nil {
+		return err
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// hops returns the number of echo hops the given event went through.
+func hops(e *ce.Event) int {
+	v, ok := e.Extensions()[HopsExtension]
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil {
+		return 0
+	}
+	return n
+}
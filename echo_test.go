@@ -0,0 +1,92 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestReceiverEchoConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ReceiverEchoConfig
+		protocol Protocol
+		wantErr  bool
+	}{
+		{name: "url", config: ReceiverEchoConfig{URL: "http://broker-b/ns/default"}},
+		{name: "verification url", config: ReceiverEchoConfig{URL: "http://broker-b", VerificationURL: "http://verifier:8080", Timeout: "2s"}},
+		{name: "no url", config: ReceiverEchoConfig{VerificationURL: "http://verifier:8080"}, wantErr: true},
+		{name: "relative url", config: ReceiverEchoConfig{URL: "/broker-b"}, wantErr: true},
+		{name: "relative verification url", config: ReceiverEchoConfig{URL: "http://broker-b", VerificationURL: "verifier"}, wantErr: true},
+		{name: "invalid timeout", config: ReceiverEchoConfig{URL: "http://broker-b", Timeout: "0s"}, wantErr: true},
+		{name: "kafka", config: ReceiverEchoConfig{URL: "http://broker-b"}, protocol: ProtocolKafka, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedTimeout <= 0 {
+				t.Errorf("want timeout, got %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestEchoer(t *testing.T) {
+	var lock sync.Mutex
+	echoed := make(map[string][]int)
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e, err := binding.ToEvent(r.Context(), cehttp.NewMessageFromHttpRequest(r))
+		if err != nil || r.Header.Get("Ce-Specversion") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		echoed[r.URL.Path] = append(echoed[r.URL.Path], hops(e))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	config := &ReceiverEchoConfig{URL: server.URL + "/hop", VerificationURL: server.URL + "/verify"}
+	if err := config.validate(ProtocolHTTP); err != nil {
+		t.Fatal(err)
+	}
+	echo := newEchoer(config)
+
+	e := cetest.FullEvent()
+	if err := echo.echo(context.Background(), &e); err != nil {
+		t.Fatal(err)
+	}
+	e.SetExtension(HopsExtension, 1)
+	if err := echo.echo(context.Background(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if hops(&e) != 1 {
+		t.Errorf("want the received event unchanged, got %d hops", hops(&e))
+	}
+	for _, path := range []string{"/hop", "/verify"} {
+		if got := echoed[path]; len(got) != 2 || got[0] != 1 || got[1] != 2 {
+			t.Errorf("%s: want hops [1 2], got %v", path, got)
+		}
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := echo.echo(context.Background(), &e); err == nil {
+		t.Error("expected an error when the next hop fails")
+	}
+
+	if err := newEchoer(nil).echo(context.Background(), &e); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,149 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// EndpointsConfig classifies received events by the endpoint they have been received on, so that a single receiver
+// verifies topologies routing events to different endpoints, for example the steps of a Sequence or the branches of a
+// Parallel subscribed to different paths of the receiver.
+//
+// The endpoint of an event is the request path, for example "/sink-a", or the request host and path with ByHost, for
+// example "sink-a.e2e.svc.cluster.local/". Events received by the dead-letter sink have no endpoint.
+type EndpointsConfig struct {
+	// ByHost classifies events by the request host in addition to the request path, for example when the receiver is
+	// exposed by a Service per sink.
+	ByHost bool `json:"byHost" yaml:"byHost"`
+	// Expected are the endpoints events are expected on, the verification fails when events are received on other
+	// endpoints or when an expected endpoint receives no events.
+	//
+	// When not specified, events are accepted on any endpoint.
+	Expected []string `json:"expected" yaml:"expected"`
+}
+
+func (c *EndpointsConfig) validate(receiver *ReceiverConfig) error {
+	if receiver.Protocol != "" && receiver.Protocol != ProtocolHTTP {
+		return invalidErr("receiver.endpoints", fmt.Errorf("endpoints are request paths, expected %s", ProtocolHTTP))
+	}
+	seen := sets.NewString()
+	for i, e := range c.Expected {
+		field := fmt.Sprintf("receiver.endpoints.expected[%d]", i)
+		path := e
+		if c.ByHost {
+			j := strings.Index(e, "/")
+			if j <= 0 {
+				return invalidErr(field, fmt.Errorf("%q must be a host followed by a path", e))
+			}
+			path = e[j:]
+		}
+		if !strings.HasPrefix(path, "/") {
+			return invalidErr(field, fmt.Errorf("%q must be an absolute path", e))
+		}
+		if path == receiver.DeadLetterSinkPath {
+			return invalidErr(field, errors.New("the dead-letter sink path is not an endpoint"))
+		}
+		if seen.Has(e) {
+			return invalidErr(field, fmt.Errorf("%q is a duplicate endpoint", e))
+		}
+		seen.Insert(e)
+	}
+	return nil
+}
+
+// endpoint returns the endpoint of the given request.
+func (c *EndpointsConfig) endpoint(req *http.Request) string {
+	if c.ByHost {
+		return req.Host + req.URL.Path
+	}
+	return req.URL.Path
+}
+
+// EndpointReport reports the events received on a single endpoint.
+type EndpointReport struct {
+	// ReceivedCount is the number of deliveries received on the endpoint, including duplicates and failure responses.
+	ReceivedCount int `json:"receivedCount"`
+	// EventCount is the number of distinct events received on the endpoint.
+	EventCount int `json:"eventCount"`
+	// Unexpected is true when the endpoint is not one of the expected endpoints.
+	Unexpected bool `json:"unexpected,omitempty"`
+}
+
+// endpointState tracks the events received on an endpoint.
+type endpointState struct {
+	received int
+	ids      sets.String
+}
+
+// newEndpointsState returns the state of the expected endpoints, it returns nil when endpoints classification is
+// disabled.
+func newEndpointsState(config *EndpointsConfig) map[string]*endpointState {
+	if config == nil {
+		return nil
+	}
+	endpoints := make(map[string]*endpointState, len(config.Expected))
+	for _, e := range config.Expected {
+		endpoints[e] = &endpointState{ids: sets.NewString()}
+	}
+	return endpoints
+}
+
+// recordEndpoint records the given event as received on its endpoint, it must be called while holding the lock.
+func (s *StateManager) recordEndpoint(e *ReceivedEvent) {
+	if s.endpoints == nil || e.Endpoint == "" {
+		return
+	}
+	endpoint, ok := s.endpoints[e.Endpoint]
+	if !ok {
+		endpoint = &endpointState{ids: sets.NewString()}
+		s.endpoints[e.Endpoint] = endpoint
+	}
+	endpoint.received++
+	endpoint.ids.Insert(e.Event.ID())
+}
+
+// endpointsReport adds the report of each endpoint to the given report, it must be called while holding the lock.
+func (s *StateManager) endpointsReport(r *Report) {
+	if s.endpoints == nil {
+		return
+	}
+	expected := sets.NewString(s.config.Receiver.Endpoints.Expected...)
+	r.Endpoints = make(map[string]EndpointReport, len(s.endpoints))
+	for name, e := range s.endpoints {
+		r.Endpoints[name] = EndpointReport{
+			ReceivedCount: e.received,
+			EventCount:    e.ids.Len(),
+			Unexpected:    expected.Len() > 0 && !expected.Has(name),
+		}
+	}
+}
+
+// verifyEndpoints verifies that events have been received only on the expected endpoints and that each expected
+// endpoint received events.
+func verifyEndpoints(config Config, report Report) error {
+	if config.Receiver.Endpoints == nil || len(config.Receiver.Endpoints.Expected) == 0 {
+		return nil
+	}
+	var unexpected, missing []string
+	for name, e := range report.Endpoints {
+		if e.Unexpected {
+			unexpected = append(unexpected, name)
+		} else if e.ReceivedCount == 0 && !config.Sender.Disabled {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(unexpected)
+	sort.Strings(missing)
+	if len(unexpected) > 0 {
+		return fmt.Errorf("events received on %d unexpected endpoints %v, expected %v", len(unexpected), unexpected, config.Receiver.Endpoints.Expected)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no events received on %d expected endpoints %v", len(missing), missing)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package sacura
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerEndpoints(t *testing.T) {
+
+	config := Config{Receiver: ReceiverConfig{Endpoints: &EndpointsConfig{Expected: []string{"/step-1", "/step-2", "/step-3"}}}}
+	sm := newTestStateManager(t, config)
+
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+	for _, r := range []struct {
+		id       string
+		endpoint string
+		nacked   bool
+	}{
+		{"1", "/step-1", false}, {"2", "/step-1", true}, {"2", "/step-1", false},
+		{"1", "/step-2", false}, {"2", "/other", false},
+		{"1", "", false},
+	} {
+		sm.lock.Lock()
+		sm.recordReceived(&ReceivedEvent{Event: event(r.id), ReceivedAt: time.Now(), Endpoint: r.endpoint, Nacked: r.nacked})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := map[string]EndpointReport{
+		"/step-1": {ReceivedCount: 3, EventCount: 2},
+		"/step-2": {ReceivedCount: 1, EventCount: 1},
+		"/step-3": {},
+		"/other":  {ReceivedCount: 1, EventCount: 1, Unexpected: true},
+	}
+	if diff := cmp.Diff(want, report.Endpoints); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if err := verifyEndpoints(config, report); err == nil {
+		t.Error("expected error for the unexpected endpoint")
+	}
+	delete(report.Endpoints, "/other")
+	if err := verifyEndpoints(config, report); err == nil {
+		t.Error("expected error for the endpoint without events")
+	}
+	delete(report.Endpoints, "/step-3")
+	if err := verifyEndpoints(config, report); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
+
+func TestEndpointsConfig(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		config       EndpointsConfig
+		receiver     ReceiverConfig
+		url          string
+		wantEndpoint string
+		wantErr      bool
+	}{
+		{
+			name:         "path",
+			config:       EndpointsConfig{Expected: []string{"/sink-a", "/sink-b"}},
+			url:          "http://sacura.e2e.svc.cluster.local:8080/sink-a",
+			wantEndpoint: "/sink-a",
+		},
+		{
+			name:         "host and path",
+			config:       EndpointsConfig{ByHost: true, Expected: []string{"sink-a.e2e.svc.cluster.local/"}},
+			url:          "http://sink-a.e2e.svc.cluster.local/",
+			wantEndpoint: "sink-a.e2e.svc.cluster.local/",
+		},
+		{name: "relative path", config: EndpointsConfig{Expected: []string{"sink-a"}}, wantErr: true},
+		{name: "no host", config: EndpointsConfig{ByHost: true, Expected: []string{"/sink-a"}}, wantErr: true},
+		{name: "duplicate", config: EndpointsConfig{Expected: []string{"/sink-a", "/sink-a"}}, wantErr: true},
+		{name: "dead-letter sink", config: EndpointsConfig{Expected: []string{"/dls"}}, receiver: ReceiverConfig{DeadLetterSinkPath: "/dls"}, wantErr: true},
+		{name: "protocol", config: EndpointsConfig{}, receiver: ReceiverConfig{Protocol: ProtocolMQTT}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.receiver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if got := tt.config.endpoint(httptest.NewRequest("POST", tt.url, nil)); got != tt.wantEndpoint {
+				t.Errorf("want endpoint %q, got %q", tt.wantEndpoint, got)
+			}
+		})
+	}
+}
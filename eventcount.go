@@ -0,0 +1,79 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// validateEventCount validates sender.eventCount, it must be called before the duration is parsed.
+func (c *Config) validateEventCount() error {
+	if c.Sender.EventCount < 0 {
+		return invalidErr("sender.eventCount", fmt.Errorf("%d cannot be negative", c.Sender.EventCount))
+	}
+	if c.Sender.EventCount == 0 || c.Sender.Disabled {
+		return nil
+	}
+	if c.Sender.Replay != nil {
+		return invalidErr("sender.eventCount", errors.New("cannot be used with sender.replay, all recorded events are replayed"))
+	}
+	if c.Ordered != nil && c.Ordered.IndependentSenders {
+		return invalidErr("sender.eventCount", errors.New("cannot be used with ordered.independentSenders"))
+	}
+	if c.Duration == "" && c.Sender.LoadProfile != nil {
+		return invalidErr("sender.eventCount", errors.New("sender.loadProfile requires duration"))
+	}
+	if c.Distributed != nil {
+		return invalidErr("sender.eventCount", errors.New("cannot be used in distributed mode"))
+	}
+	return nil
+}
+
+// eventCountRequests returns the number of requests sending sender.eventCount events, it is 0 without
+// sender.eventCount.
+func eventCountRequests(config *Config) uint64 {
+	batch := config.Sender.BatchSize
+	if batch < 1 {
+		batch = 1
+	}
+	return uint64((config.Sender.EventCount + batch - 1) / batch)
+}
+
+// eventCountPacer is a vegeta.Pacer stopping once the requests sending sender.eventCount events have been sent.
+type eventCountPacer struct {
+	pacer    vegeta.Pacer
+	requests uint64
+}
+
+var _ vegeta.Pacer = eventCountPacer{}
+
+// Pace implements vegeta.Pacer.
+func (p eventCountPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	if hits >= p.requests {
+		return 0, true
+	}
+	return p.pacer.Pace(elapsed, hits)
+}
+
+// Rate implements vegeta.Pacer.
+func (p eventCountPacer) Rate(elapsed time.Duration) float64 {
+	return p.pacer.Rate(elapsed)
+}
+
+// progressPercentage returns the percentage of the test completed after the given elapsed time: the percentage of
+// sender.eventCount events sent, or the percentage of the duration elapsed.
+func (s *StateManager) progressPercentage(elapsed time.Duration) float64 {
+	var p float64
+	switch {
+	case s.config.Sender.EventCount > 0:
+		p = 100 * float64(s.sentCount.Load()) / float64(s.config.Sender.EventCount)
+	case s.config.ParsedDuration > 0:
+		p = 100 * float64(elapsed) / float64(s.config.ParsedDuration)
+	}
+	if p > 100 {
+		return 100
+	}
+	return p
+}
@@ -0,0 +1,162 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestValidateEventCount(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		wantDuration time.Duration
+		wantErr      bool
+	}{
+		{
+			name:   "without duration",
+			config: Config{Sender: SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, EventCount: 100}},
+		},
+		{
+			name:         "with duration",
+			config:       Config{Sender: SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, EventCount: 100}, Duration: "1m"},
+			wantDuration: time.Minute,
+		},
+		{
+			name:    "without duration nor event count",
+			config:  Config{Sender: SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10}},
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			config:  Config{Sender: SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, EventCount: -1}, Duration: "1m"},
+			wantErr: true,
+		},
+		{
+			name: "independent senders",
+			config: Config{
+				Sender:   SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, EventCount: 100},
+				Ordered:  &OrderedConfig{NumPartitionKeys: 2, IndependentSenders: true},
+				Duration: "1m",
+			},
+			wantErr: true,
+		},
+		{
+			name: "load profile without duration",
+			config: Config{
+				Sender: SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, EventCount: 100, LoadProfile: &LoadProfileConfig{}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Receiver.Timeout = "1m"
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedDuration != tt.wantDuration {
+				t.Errorf("want duration %v, got %v", tt.wantDuration, tt.config.ParsedDuration)
+			}
+		})
+	}
+}
+
+func TestEventCountPacer(t *testing.T) {
+	config := &Config{Sender: SenderConfig{EventCount: 10, BatchSize: 3}}
+	if got := eventCountRequests(config); got != 4 {
+		t.Fatalf("want 4 requests, got %d", got)
+	}
+	p := eventCountPacer{pacer: vegeta.Rate{Freq: 1, Per: time.Second}, requests: eventCountRequests(config)}
+	if _, stop := p.Pace(time.Hour, 3); stop {
+		t.Error("expected the pacer to keep sending the last batch")
+	}
+	if _, stop := p.Pace(0, 4); !stop {
+		t.Error("expected the pacer to stop once all batches have been sent")
+	}
+}
+
+func TestStartSenderEventCount(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := Config{
+		Sender:   SenderConfig{Target: server.URL, FrequencyPerSecond: 100, Workers: 1, EventCount: 15},
+		Receiver: ReceiverConfig{Timeout: "1m"},
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan ce.Event, 100)
+	metrics := startSender(context.Background(), config, sent)
+	close(sent)
+
+	if metrics.ProposedCount != 15 || metrics.AcceptedCount != 15 {
+		t.Errorf("want 15 events sent, got %+v", metrics)
+	}
+}
+
+func TestStateManagerEventCountProgress(t *testing.T) {
+	sm := newTestStateManager(t, Config{Sender: SenderConfig{EventCount: 4}})
+
+	if p := sm.progressPercentage(time.Hour); p != 0 {
+		t.Errorf("want no progress, got %v", p)
+	}
+
+	events := make([]ce.Event, 0, 4)
+	sm.lock.Lock()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		events = append(events, e)
+		sm.recordSent(&e)
+	}
+	sm.lock.Unlock()
+	if p := sm.progressPercentage(0); p != 100 {
+		t.Errorf("want all events sent, got %v", p)
+	}
+
+	sm.lock.Lock()
+	for _, e := range events[:3] {
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+	}
+	sm.lock.Unlock()
+	sm.checkCompletion()
+	select {
+	case <-sm.completed():
+		t.Error("expected an event not received yet")
+	default:
+	}
+
+	sm.lock.Lock()
+	sm.recordReceived(&ReceivedEvent{Event: events[3], ReceivedAt: time.Now()})
+	sm.lock.Unlock()
+	sm.checkCompletion()
+	select {
+	case <-sm.completed():
+	default:
+		t.Error("expected all events received")
+	}
+
+	duration := newTestStateManager(t, Config{ParsedDuration: time.Minute})
+	if p := duration.progressPercentage(15 * time.Second); p != 25 {
+		t.Errorf("want 25%% of the duration elapsed, got %v", p)
+	}
+	if p := duration.progressPercentage(time.Hour); p != 100 {
+		t.Errorf("want the duration elapsed, got %v", p)
+	}
+	if duration.completed() != nil {
+		t.Error("expected completion not to be detected")
+	}
+}
@@ -0,0 +1,353 @@
+package sacura
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+type EventLogFormat string
+
+const (
+	// EventLogFormatJSONL writes one JSON record per line.
+	EventLogFormatJSONL EventLogFormat = "jsonl"
+	// EventLogFormatCSV writes one CSV record per line, after a header line.
+	EventLogFormatCSV EventLogFormat = "csv"
+)
+
+const (
+	eventLogRecordSent     = "sent"
+	eventLogRecordReceived = "received"
+	eventLogRecordRetried  = "retried"
+)
+
+// EventLogConfig streams a record of each sent and received event to a file while the test is running, for analysis
+// of the raw data beyond the report.
+//
+// Sent events have a record of kind "sent" and each delivery of an event has a record of kind "received", with its
+// delivery number. Send attempts are known once the sender is done, so events sent more than once have an additional
+// record of kind "retried", with the number of attempts, at the end of the test.
+type EventLogConfig struct {
+	// Path is the path of the file the records are appended to.
+	Path string `json:"path" yaml:"path"`
+	// Format is the format of the records, one of EventLogFormatJSONL or EventLogFormatCSV.
+	//
+	// Defaults to EventLogFormatJSONL.
+	Format EventLogFormat `json:"format" yaml:"format"`
+	// Shards splits the event log into shards by partition key, records of unordered tests are sharded by ID.
+	Shards *OutputShardsConfig `json:"shards" yaml:"shards"`
+}
+
+func (c *EventLogConfig) validate() error {
+	if c.Path == "" {
+		return invalidErr("report.eventLog.path", errors.New("cannot be empty"))
+	}
+	switch c.Format {
+	case "":
+		c.Format = EventLogFormatJSONL
+	case EventLogFormatJSONL, EventLogFormatCSV:
+	default:
+		return invalidErr("report.eventLog.format", fmt.Errorf("unknown format %q, expected one of %q or %q", c.Format, EventLogFormatJSONL, EventLogFormatCSV))
+	}
+	if c.Shards != nil {
+		return c.Shards.validate("report.eventLog.shards")
+	}
+	return nil
+}
+
+// eventLogRecord is a single record of the event log.
+type eventLogRecord struct {
+	Kind         string     `json:"kind"`
+	ID           string     `json:"id"`
+	PartitionKey string     `json:"partitionKey,omitempty"`
+	SentAt       *time.Time `json:"sentAt,omitempty"`
+	ReceivedAt   *time.Time `json:"receivedAt,omitempty"`
+	// Delivery is the number of deliveries of the event up to this one, it is greater than 1 for redeliveries.
+	Delivery     int  `json:"delivery,omitempty"`
+	Attempts     int  `json:"attempts,omitempty"`
+	Nacked       bool `json:"nacked,omitempty"`
+	DeadLettered bool `json:"deadLettered,omitempty"`
+	Warmup       bool `json:"warmup,omitempty"`
+	// Endpoint is the endpoint of received events, when receiver.endpoints is enabled.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+var eventLogCSVHeader = []string{"kind", "id", "partitionKey", "sentAt", "receivedAt", "delivery", "attempts", "nacked", "deadLettered", "warmup", "endpoint"}
+
+func (r *eventLogRecord) csv() []string {
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	formatInt := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	return []string{
+		r.Kind,
+		r.ID,
+		r.PartitionKey,
+		formatTime(r.SentAt),
+		formatTime(r.ReceivedAt),
+		formatInt(r.Delivery),
+		formatInt(r.Attempts),
+		strconv.FormatBool(r.Nacked),
+		strconv.FormatBool(r.DeadLettered),
+		strconv.FormatBool(r.Warmup),
+		r.Endpoint,
+	}
+}
+
+// eventLog is an append-only log of event records.
+type eventLog struct {
+	// lock serializes appends, which happen outside the lock of the StateManager so that file I/O doesn't block
+	// recording events.
+	lock sync.Mutex
+	f    *os.File
+	w    *bufio.Writer
+	enc  *json.Encoder
+	csv  *csv.Writer
+	// shards is the sharded event log, records are encoded to buf and then written to their shard. It is nil when
+	// the event log isn't sharded.
+	shards *shardedWriter
+	buf    *bytes.Buffer
+	// deliveries are the number of deliveries of each received event.
+	deliveries map[string]int
+}
+
+// openEventLog opens the event log of the given config, records are appended to an existing file so that a restarted
+// test keeps the records logged before the restart.
+func openEventLog(config *EventLogConfig) (*eventLog, error) {
+	if config.Shards != nil {
+		return openShardedEventLog(config)
+	}
+
+	f, err := os.OpenFile(config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+
+	w := bufio.NewWriter(f)
+	l := &eventLog{f: f, w: w, deliveries: make(map[string]int)}
+	if config.Format == EventLogFormatCSV {
+		l.csv = csv.NewWriter(w)
+		if info.Size() == 0 {
+			l.append(eventLogRecord{}, eventLogCSVHeader)
+		}
+	} else {
+		l.enc = json.NewEncoder(w)
+	}
+	return l, nil
+}
+
+func openShardedEventLog(config *EventLogConfig) (*eventLog, error) {
+	buf := &bytes.Buffer{}
+	l := &eventLog{buf: buf, deliveries: make(map[string]int)}
+	var header []byte
+	if config.Format == EventLogFormatCSV {
+		l.csv = csv.NewWriter(buf)
+		_ = l.csv.Write(eventLogCSVHeader)
+		l.csv.Flush()
+		header = append(header, buf.Bytes()...)
+		buf.Reset()
+	} else {
+		l.enc = json.NewEncoder(buf)
+	}
+	shards, err := openShardedWriter(config.Path, config.Shards, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	l.shards = shards
+	return l, nil
+}
+
+// eventLogWriter returns the event log and registers a pending append, which must be done with logSent and
+// logReceived after releasing the lock, it returns nil when the event log is disabled. It must be called while holding
+// the lock.
+func (s *StateManager) eventLogWriter() *eventLog {
+	if s.eventLog != nil {
+		s.eventLogAppends.Add(1)
+	}
+	return s.eventLog
+}
+
+// logSent appends the given sent events to the given event log returned by eventLogWriter.
+func (s *StateManager) logSent(l *eventLog, events []ce.Event) {
+	if l == nil {
+		return
+	}
+	defer s.eventLogAppends.Done()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for i := range events {
+		l.append(s.eventLogRecord(eventLogRecordSent, &events[i]), nil)
+	}
+	l.flush()
+}
+
+// logReceived appends the given received events to the given event log returned by eventLogWriter.
+func (s *StateManager) logReceived(l *eventLog, events []*ReceivedEvent) {
+	if l == nil {
+		return
+	}
+	defer s.eventLogAppends.Done()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, e := range events {
+		r := s.eventLogRecord(eventLogRecordReceived, &e.Event)
+		receivedAt := e.ReceivedAt
+		r.ReceivedAt = &receivedAt
+		l.deliveries[e.Event.ID()]++
+		r.Delivery = l.deliveries[e.Event.ID()]
+		r.Nacked = e.Nacked
+		r.DeadLettered = e.DeadLettered
+		r.Endpoint = e.Endpoint
+		l.append(r, nil)
+	}
+	l.flush()
+}
+
+func (s *StateManager) eventLogRecord(kind string, e *ce.Event) eventLogRecord {
+	r := eventLogRecord{Kind: kind, ID: e.ID(), Warmup: isWarmupEvent(e)}
+	if s.stateManagerConfig.Ordered {
+		r.PartitionKey = partitionKey(e, &s.stateManagerConfig)
+	}
+	if t, ok := sentTimestamp(e); ok {
+		r.SentAt = &t
+	}
+	return r
+}
+
+// sentPartitionKeys returns the partition keys of the given sent events in ordered mode, it must be called while
+// holding the lock.
+func (s *StateManager) sentPartitionKeys(ids map[string]int) map[string]string {
+	if !s.stateManagerConfig.Ordered || len(ids) == 0 {
+		return nil
+	}
+	keys := make(map[string]string, len(ids))
+	for pk, sent := range s.sent {
+		for _, id := range sent {
+			if _, ok := ids[id]; ok {
+				keys[id] = pk
+			}
+		}
+	}
+	return keys
+}
+
+// logRetried appends a record of each event sent more than once, sorted by ID, with their partition key when known,
+// it must be called once no more events are appended.
+func (l *eventLog) logRetried(attempts map[string]int, partitionKeys map[string]string) {
+	ids := make([]string, 0, len(attempts))
+	for id := range attempts {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, id := range ids {
+		l.append(eventLogRecord{Kind: eventLogRecordRetried, ID: id, PartitionKey: partitionKeys[id], Attempts: attempts[id]}, nil)
+	}
+}
+
+// append encodes the given record, or the given CSV row when it is not nil, it must be called while holding the lock
+// of the event log.
+func (l *eventLog) append(r eventLogRecord, row []string) {
+	var err error
+	if l.csv != nil {
+		if row == nil {
+			row = r.csv()
+		}
+		err = l.csv.Write(row)
+	} else {
+		err = l.enc.Encode(r)
+	}
+	if err == nil && l.shards != nil {
+		err = l.appendShard(r)
+	}
+	if err != nil {
+		logger(LogComponentState).Errorw("Failed to append record to event log", "kind", r.Kind, "id", r.ID, "error", err)
+	}
+}
+
+// appendShard writes the encoded record to the shard of its partition key, or of its ID when it has none.
+func (l *eventLog) appendShard(r eventLogRecord) error {
+	defer l.buf.Reset()
+	if l.csv != nil {
+		l.csv.Flush()
+		if err := l.csv.Error(); err != nil {
+			return err
+		}
+	}
+	key := r.PartitionKey
+	if key == "" {
+		key = r.ID
+	}
+	return l.shards.write(key, l.buf.Bytes())
+}
+
+// flush writes the buffered records to the file, it must be called while holding the lock of the event log.
+func (l *eventLog) flush() {
+	if l.shards != nil {
+		if err := l.shards.flush(); err != nil {
+			logger(LogComponentState).Errorw("Failed to write event log", "error", err)
+		}
+		return
+	}
+	if l.csv != nil {
+		l.csv.Flush()
+	}
+	if err := l.w.Flush(); err != nil {
+		logger(LogComponentState).Errorw("Failed to write event log", "error", err)
+	}
+}
+
+// closeEventLog closes the event log of a StateManager that is not used.
+func (s *StateManager) closeEventLog() {
+	if s.eventLog == nil {
+		return
+	}
+	if err := s.eventLog.close(); err != nil {
+		logger(LogComponentState).Errorw("Failed to close event log", "error", err)
+	}
+	s.eventLog = nil
+}
+
+func (l *eventLog) close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.shards != nil {
+		return l.shards.close()
+	}
+	if l.csv != nil {
+		l.csv.Flush()
+	}
+	if err := l.w.Flush(); err != nil {
+		_ = l.f.Close()
+		return err
+	}
+	return l.f.Close()
+}
@@ -0,0 +1,142 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+// runEventLog sends and receives the given events with a StateManager logging events with the given format.
+func runEventLog(t *testing.T, format EventLogFormat, sentAt, receivedAt time.Time) string {
+	config := Config{Report: ReportConfig{EventLog: &EventLogConfig{Path: filepath.Join(t.TempDir(), "events"), Format: format}}}
+	if err := config.Report.EventLog.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 3)
+	sentSignal := sm.ReadSent(sent)
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		sent <- e
+	}
+	close(sent)
+	<-sentSignal
+
+	receivedSignal := sm.ReadReceived(received)
+	for _, nacked := range []bool{true, false} {
+		e := cetest.FullEvent()
+		e.SetID("1")
+		setSentTimestamp(&e, sentAt)
+		received <- ReceivedEvent{Event: e, ReceivedAt: receivedAt, Nacked: nacked}
+	}
+	close(received)
+	<-receivedSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 2, SendAttempts: map[string]int{"2": 3}})
+	return config.Report.EventLog.Path
+}
+
+func TestEventLogJSONL(t *testing.T) {
+	sentAt := time.Unix(100, 1).UTC()
+	receivedAt := time.Unix(101, 2).UTC()
+	path := runEventLog(t, EventLogFormatJSONL, sentAt, receivedAt)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var got []eventLogRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := eventLogRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+
+	want := []eventLogRecord{
+		{Kind: eventLogRecordSent, ID: "1", SentAt: &sentAt},
+		{Kind: eventLogRecordSent, ID: "2", SentAt: &sentAt},
+		{Kind: eventLogRecordReceived, ID: "1", SentAt: &sentAt, ReceivedAt: &receivedAt, Delivery: 1, Nacked: true},
+		{Kind: eventLogRecordReceived, ID: "1", SentAt: &sentAt, ReceivedAt: &receivedAt, Delivery: 2},
+		{Kind: eventLogRecordRetried, ID: "2", Attempts: 3},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected event log (-want, +got) %s", diff)
+	}
+}
+
+func TestEventLogCSV(t *testing.T) {
+	sentAt := time.Unix(100, 1)
+	receivedAt := time.Unix(101, 2)
+	path := runEventLog(t, EventLogFormatCSV, sentAt, receivedAt)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := "1970-01-01T00:01:40.000000001Z"
+	r := "1970-01-01T00:01:41.000000002Z"
+	want := [][]string{
+		eventLogCSVHeader,
+		{"sent", "1", "", s, "", "", "", "false", "false", "false", ""},
+		{"sent", "2", "", s, "", "", "", "false", "false", "false", ""},
+		{"received", "1", "", s, r, "1", "", "true", "false", "false", ""},
+		{"received", "1", "", s, r, "2", "", "false", "false", "false", ""},
+		{"retried", "2", "", "", "", "", "3", "false", "false", "false", ""},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("unexpected event log (-want, +got) %s", diff)
+	}
+}
+
+func TestEventLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     EventLogConfig
+		wantFormat EventLogFormat
+		wantErr    bool
+	}{
+		{name: "default format", config: EventLogConfig{Path: "events.jsonl"}, wantFormat: EventLogFormatJSONL},
+		{name: "csv", config: EventLogConfig{Path: "events.csv", Format: EventLogFormatCSV}, wantFormat: EventLogFormatCSV},
+		{name: "no path", config: EventLogConfig{}, wantErr: true},
+		{name: "unknown format", config: EventLogConfig{Path: "events", Format: "parquet"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Format != tt.wantFormat {
+				t.Errorf("want format %q, got %q", tt.wantFormat, tt.config.Format)
+			}
+		})
+	}
+}
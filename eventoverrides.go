@@ -0,0 +1,268 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"golang.org/x/net/http/httpguts"
+)
+
+// OverridesExtension is the extension carrying the comma separated names of the override groups applied to an event.
+const OverridesExtension = "sacuraoverrides"
+
+// EventOverrideConfig is an override group of the override matrix of sender.overrides: a share of events carries
+// the extensions of the group and is sent with the headers of the group, so that brokers routing on headers or
+// extensions are exercised. Each group is applied independently, an event can be in several groups.
+type EventOverrideConfig struct {
+	// Name is the name of the group the report breaks results down by.
+	Name string `json:"name" yaml:"name"`
+	// Percentage is the percentage of events in the group, for example 20.
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+	// Extensions are set on the events of the group, for example priority: high.
+	Extensions map[string]string `json:"extensions" yaml:"extensions"`
+	// Headers are set on the requests of the events of the group, for example X-Custom: foo. They are only supported
+	// with the HTTP and gRPC protocols and without batching.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+}
+
+func validateOverrides(sender *SenderConfig, ordered *OrderedConfig) error {
+	if len(sender.Overrides) > 0 && sender.Replay != nil {
+		return invalidErr("sender.overrides", errors.New("cannot be used with sender.replay, which sends the recorded events"))
+	}
+	reserved := reservedExtensions
+	if ordered != nil {
+		reserved = append([]string{ordered.partitionKeyExtension()}, reserved...)
+	}
+	names := make(map[string]bool, len(sender.Overrides))
+	for i, o := range sender.Overrides {
+		field := fmt.Sprintf("sender.overrides[%d]", i)
+		if o.Name == "" || strings.Contains(o.Name, ",") {
+			return invalidErr(field+".name", fmt.Errorf("%q must be non empty and cannot contain commas", o.Name))
+		}
+		if names[o.Name] {
+			return invalidErr(field+".name", fmt.Errorf("%q is not unique", o.Name))
+		}
+		names[o.Name] = true
+		if o.Percentage <= 0 || o.Percentage > 100 {
+			return invalidErr(field+".percentage", fmt.Errorf("%v must be greater than 0 and at most 100", o.Percentage))
+		}
+		if len(o.Extensions) == 0 && len(o.Headers) == 0 {
+			return invalidErr(field, errors.New("extensions or headers are required"))
+		}
+		for name := range o.Extensions {
+			if !isValidExtensionName(name) {
+				return invalidErr(field+".extensions", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", name))
+			}
+			for _, r := range reserved {
+				if name == r {
+					return invalidErr(field+".extensions", fmt.Errorf("%q is set by sacura", name))
+				}
+			}
+		}
+		if len(o.Headers) == 0 {
+			continue
+		}
+		switch sender.Protocol {
+		case "", ProtocolHTTP, ProtocolGRPC:
+		default:
+			return invalidErr(field+".headers", fmt.Errorf("not supported with the %s protocol", sender.Protocol))
+		}
+		if sender.BatchSize > 1 {
+			return invalidErr(field+".headers", errors.New("cannot be used with sender.batchSize, requests carry several events"))
+		}
+		for name, value := range o.Headers {
+			if !httpguts.ValidHeaderFieldName(name) || !httpguts.ValidHeaderFieldValue(value) {
+				return invalidErr(field+".headers", fmt.Errorf("%q: %q is not a valid header", name, value))
+			}
+		}
+	}
+	return nil
+}
+
+// overridesGenerator applies the override groups to events, it is safe for concurrent use.
+type overridesGenerator struct {
+	overrides []EventOverrideConfig
+	r         *rand.Rand
+}
+
+// newOverridesGenerator returns the generator of the given override groups, the choice of the groups of each event
+// is deterministic with a seed. It returns nil without override groups.
+func newOverridesGenerator(overrides []EventOverrideConfig, seed *int64) *overridesGenerator {
+	if len(overrides) == 0 {
+		return nil
+	}
+	return &overridesGenerator{overrides: overrides, r: newRand(seed, "overrides")}
+}
+
+// apply sets the extensions of the groups drawn for the given event and the OverridesExtension.
+func (g *overridesGenerator) apply(e *ce.Event) {
+	if g == nil {
+		return
+	}
+	var names []string
+	for i := range g.overrides {
+		if g.r.Float64()*100 >= g.overrides[i].Percentage {
+			continue
+		}
+		for name, value := range g.overrides[i].Extensions {
+			e.SetExtension(name, value)
+		}
+		names = append(names, g.overrides[i].Name)
+	}
+	if len(names) > 0 {
+		e.SetExtension(OverridesExtension, strings.Join(names, ","))
+	}
+}
+
+// setHeaders sets the headers of the groups applied to the given event.
+func (g *overridesGenerator) setHeaders(hdr http.Header, e *ce.Event) {
+	if g == nil {
+		return
+	}
+	groups := overrideGroups(e)
+	for i := range g.overrides {
+		for _, name := range groups {
+			if name != g.overrides[i].Name {
+				continue
+			}
+			for k, v := range g.overrides[i].Headers {
+				hdr.Set(k, v)
+			}
+		}
+	}
+}
+
+// overrideGroups returns the override groups applied to the given event.
+func overrideGroups(e *ce.Event) []string {
+	v, ok := e.Extensions()[OverridesExtension]
+	if !ok {
+		return nil
+	}
+	s := fmt.Sprint(v)
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// OverrideGroupReport reports the events of an override group.
+type OverrideGroupReport struct {
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// LostCount is the number of events of the group never received, excluding events the sender failed to send and
+	// dead-lettered events.
+	LostCount int `json:"lostCount"`
+	// Latency is the end-to-end latency of the events of the group.
+	Latency LatencyStats `json:"latency"`
+}
+
+// overrideGroupState tracks the events of an override group.
+type overrideGroupState struct {
+	sent     int
+	received int
+	latency  *latencyHistogram
+}
+
+// overridesState tracks the events of each override group.
+type overridesState struct {
+	groups map[string]*overrideGroupState
+	// pending are the groups of sent events not received yet by ID.
+	pending map[string][]string
+}
+
+// newOverridesState returns the state of the given override groups, it returns nil without override groups.
+func newOverridesState(overrides []EventOverrideConfig) *overridesState {
+	if len(overrides) == 0 {
+		return nil
+	}
+	groups := make(map[string]*overrideGroupState, len(overrides))
+	for _, o := range overrides {
+		groups[o.Name] = &overrideGroupState{latency: newLatencyHistogram()}
+	}
+	return &overridesState{groups: groups, pending: make(map[string][]string)}
+}
+
+// recordSentOverrides records the override groups of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentOverrides(e *ce.Event) {
+	if s.overrides == nil {
+		return
+	}
+	var groups []string
+	for _, name := range overrideGroups(e) {
+		if _, ok := s.overrides.groups[name]; ok {
+			groups = append(groups, name)
+		}
+	}
+	if len(groups) == 0 {
+		return
+	}
+	receivedAt, received := s.receivedAt[e.ID()]
+	for _, name := range groups {
+		gs := s.overrides.groups[name]
+		gs.sent++
+		if !received {
+			continue
+		}
+		// Received before being recorded as sent.
+		gs.received++
+		if sentAt, ok := sentTimestamp(e); ok {
+			gs.latency.record(receivedAt.Sub(sentAt))
+		}
+	}
+	if !received {
+		s.overrides.pending[e.ID()] = groups
+	}
+}
+
+// recordReceivedOverrides records the delivery of the given event to the receiver, it must be called while holding
+// the lock. Only the first delivery is recorded, according to the groups recorded by the sender since brokers can drop
+// extensions.
+func (s *StateManager) recordReceivedOverrides(e *ReceivedEvent) {
+	if s.overrides == nil {
+		return
+	}
+	groups, ok := s.overrides.pending[e.Event.ID()]
+	if !ok {
+		return
+	}
+	delete(s.overrides.pending, e.Event.ID())
+	if e.DeadLettered {
+		return
+	}
+	for _, name := range groups {
+		gs := s.overrides.groups[name]
+		gs.received++
+		if sentAt, ok := sentTimestamp(&e.Event); ok && !e.ReceivedAt.IsZero() {
+			gs.latency.record(e.ReceivedAt.Sub(sentAt))
+		}
+	}
+}
+
+// overridesReport sets the override groups section of the report, it must be called while holding the lock.
+func (s *StateManager) overridesReport(r *Report) {
+	if s.overrides == nil {
+		return
+	}
+	lost := make(map[string]int, len(s.overrides.groups))
+	for id, groups := range s.overrides.pending {
+		if _, ok := s.failedSends[id]; ok {
+			continue
+		}
+		for _, name := range groups {
+			lost[name]++
+		}
+	}
+	r.Overrides = make(map[string]OverrideGroupReport, len(s.overrides.groups))
+	for name, gs := range s.overrides.groups {
+		r.Overrides[name] = OverrideGroupReport{
+			SentCount:     gs.sent,
+			ReceivedCount: gs.received,
+			LostCount:     lost[name],
+			Latency:       gs.latency.stats(),
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestValidateOverrides(t *testing.T) {
+	priority := EventOverrideConfig{Name: "priority", Percentage: 20, Extensions: map[string]string{"priority": "high"}}
+	custom := EventOverrideConfig{Name: "custom", Percentage: 10, Headers: map[string]string{"X-Custom": "foo"}}
+	tests := []struct {
+		name    string
+		sender  SenderConfig
+		ordered *OrderedConfig
+		wantErr bool
+	}{
+		{name: "none", sender: SenderConfig{}},
+		{name: "valid", sender: SenderConfig{Overrides: []EventOverrideConfig{priority, custom}}},
+		{name: "no name", sender: SenderConfig{Overrides: []EventOverrideConfig{{Percentage: 20, Extensions: priority.Extensions}}}, wantErr: true},
+		{name: "duplicate name", sender: SenderConfig{Overrides: []EventOverrideConfig{priority, priority}}, wantErr: true},
+		{name: "no percentage", sender: SenderConfig{Overrides: []EventOverrideConfig{{Name: "a", Extensions: priority.Extensions}}}, wantErr: true},
+		{name: "empty", sender: SenderConfig{Overrides: []EventOverrideConfig{{Name: "a", Percentage: 10}}}, wantErr: true},
+		{name: "reserved extension", sender: SenderConfig{Overrides: []EventOverrideConfig{{Name: "a", Percentage: 10, Extensions: map[string]string{SequenceExtension: "1"}}}}, wantErr: true},
+		{
+			name:    "partition key extension",
+			sender:  SenderConfig{Overrides: []EventOverrideConfig{{Name: "a", Percentage: 10, Extensions: map[string]string{"partitionkey": "1"}}}},
+			ordered: &OrderedConfig{},
+			wantErr: true,
+		},
+		{name: "invalid header", sender: SenderConfig{Overrides: []EventOverrideConfig{{Name: "a", Percentage: 10, Headers: map[string]string{"X Custom": "foo"}}}}, wantErr: true},
+		{name: "headers with batches", sender: SenderConfig{BatchSize: 2, Overrides: []EventOverrideConfig{custom}}, wantErr: true},
+		{name: "headers with kafka", sender: SenderConfig{Protocol: ProtocolKafka, Overrides: []EventOverrideConfig{custom}}, wantErr: true},
+		{name: "extensions with kafka", sender: SenderConfig{Protocol: ProtocolKafka, Overrides: []EventOverrideConfig{priority}}},
+		{name: "replay", sender: SenderConfig{Replay: &ReplayConfig{}, Overrides: []EventOverrideConfig{priority}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateOverrides(&tt.sender, tt.ordered); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorOverrides(t *testing.T) {
+	seed := int64(1)
+	config := Config{Seed: &seed, Sender: SenderConfig{Overrides: []EventOverrideConfig{
+		{Name: "priority", Percentage: 20, Extensions: map[string]string{"priority": "high"}},
+		{Name: "custom", Percentage: 10, Headers: map[string]string{"X-Custom": "foo"}},
+	}}}
+	if err := validateOverrides(&config.Sender, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		target := &vegeta.Target{}
+		if err := f(target); err != nil {
+			t.Fatal(err)
+		}
+		e := <-out
+		groups := overrideGroups(&e)
+		_, priority := e.Extensions()["priority"]
+		custom := target.Header.Get("X-Custom") == "foo"
+		for _, g := range groups {
+			counts[g]++
+		}
+		if want := containsString(groups, "priority"); priority != want {
+			t.Fatalf("want priority extension %v, got %v for groups %v", want, priority, groups)
+		}
+		if want := containsString(groups, "custom"); custom != want {
+			t.Fatalf("want custom header %v, got %v for groups %v", want, custom, groups)
+		}
+	}
+	if counts["priority"] < 1800 || counts["priority"] > 2200 {
+		t.Errorf("want about 2000 events in the priority group, got %d", counts["priority"])
+	}
+	if counts["custom"] < 850 || counts["custom"] > 1150 {
+		t.Errorf("want about 1000 events in the custom group, got %d", counts["custom"])
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStateManagerOverrides(t *testing.T) {
+	config := Config{Sender: SenderConfig{Overrides: []EventOverrideConfig{
+		{Name: "priority", Percentage: 20, Extensions: map[string]string{"priority": "high"}},
+		{Name: "custom", Percentage: 10, Headers: map[string]string{"X-Custom": "foo"}},
+	}}}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	event := func(id, groups string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		if groups != "" {
+			e.SetExtension(OverridesExtension, groups)
+		}
+		setSentTimestamp(&e, now)
+		return e
+	}
+	sent := []ce.Event{event("1", "priority"), event("2", "priority,custom"), event("3", "custom"), event("4", ""), event("5", "custom")}
+	sm.lock.Lock()
+	// Received before being recorded as sent.
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(10 * time.Millisecond)})
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: now.Add(20 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: now.Add(30 * time.Millisecond)})
+	sm.lock.Unlock()
+	sm.recordFailedSends([]FailedSend{{ID: "5"}})
+
+	report := sm.GenerateReport()
+	got := make(map[string][3]int, len(report.Overrides))
+	for name, r := range report.Overrides {
+		got[name] = [3]int{r.SentCount, r.ReceivedCount, r.LostCount}
+	}
+	want := map[string][3]int{
+		"priority": {2, 2, 0},
+		"custom":   {3, 1, 1},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.Overrides["priority"].Latency.Count != 2 {
+		t.Errorf("want 2 latency samples, got %+v", report.Overrides["priority"].Latency)
+	}
+}
@@ -0,0 +1,101 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// ExpectedLossExtension is the extension marking events expected not to be delivered, for example events a filter
+// under test drops or events expiring before delivery.
+const ExpectedLossExtension = "sacuraexpectedloss"
+
+// ExpectedLossConfig sends a share of events expected not to be delivered, the verification passes only when exactly
+// those events are missing, any of them received is reported as undropped and fails the verification.
+//
+// Events expected not to be delivered carry the ExpectedLossExtension and the attributes of Variant, so that the
+// system under test drops them.
+type ExpectedLossConfig struct {
+	// Percentage is the percentage of sent events expected not to be delivered, for example 10.
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+	// Variant configures the attributes of events expected not to be delivered, for example a type a Trigger filter
+	// doesn't match or a short TTL extension, the weight is ignored.
+	//
+	// When not specified, the system under test is expected to drop events by the ExpectedLossExtension.
+	Variant *EventVariantConfig `json:"variant" yaml:"variant"`
+}
+
+func (c *ExpectedLossConfig) validate() error {
+	if c.Percentage <= 0 || c.Percentage >= 100 {
+		return invalidErr("sender.expectedLoss.percentage", fmt.Errorf("%v must be greater than 0 and less than 100", c.Percentage))
+	}
+	if c.Variant != nil {
+		if err := c.Variant.validate("sender.expectedLoss.variant"); err != nil {
+			return err
+		}
+		if _, ok := c.Variant.Extensions[ExpectedLossExtension]; ok {
+			return invalidErr("sender.expectedLoss.variant.extensions", errors.New(ExpectedLossExtension+" is reserved"))
+		}
+	}
+	return nil
+}
+
+// newExpectedLossGenerator returns a function marking the given share of events as expected not to be delivered, the
+// choice is deterministic with a seed.
+func newExpectedLossGenerator(config *ExpectedLossConfig, seed *int64) func(e *ce.Event) {
+	if config == nil {
+		return func(*ce.Event) {}
+	}
+	r := newRand(seed, "expectedLoss")
+	applyVariant := func(*ce.Event) {}
+	if config.Variant != nil {
+		applyVariant = newVariantGenerator([]EventVariantConfig{*config.Variant})
+	}
+	return func(e *ce.Event) {
+		if r.Float64()*100 >= config.Percentage {
+			return
+		}
+		applyVariant(e)
+		e.SetExtension(ExpectedLossExtension, "true")
+	}
+}
+
+func isExpectedLossEvent(e *ce.Event) bool {
+	v, ok := e.Extensions()[ExpectedLossExtension]
+	return ok && fmt.Sprint(v) == "true"
+}
+
+// recordExpectedLoss records sent events expected not to be delivered, it returns true when the event is expected
+// not to be delivered. It must be called while holding the lock.
+func (s *StateManager) recordExpectedLoss(e *ce.Event) bool {
+	if !isExpectedLossEvent(e) {
+		return false
+	}
+	s.expectedLossCount++
+	return true
+}
+
+// recordUndropped records received events expected not to be delivered, it returns true when the event is expected
+// not to be delivered. It must be called while holding the lock.
+func (s *StateManager) recordUndropped(e *ce.Event) bool {
+	if !isExpectedLossEvent(e) {
+		return false
+	}
+	logger(LogComponentState).Warnw("Received event expected not to be delivered", "id", e.ID())
+	insert(e, s.undropped, &s.stateManagerConfig)
+	return true
+}
+
+// expectedLossReport adds events expected not to be delivered and undropped events to the given report, it must be
+// called while holding the lock.
+func (s *StateManager) expectedLossReport(r *Report) {
+	r.ExpectedLossCount = s.expectedLossCount
+	for k, v := range s.undropped {
+		undropped, _ := removeDuplicates(v)
+		sort.Strings(undropped)
+		r.UndroppedEventsByPartitionKey[k] = undropped
+		r.UndroppedCount += len(undropped)
+	}
+}
@@ -0,0 +1,102 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExpectedLossGenerator(t *testing.T) {
+	seed := int64(42)
+	mark := newExpectedLossGenerator(&ExpectedLossConfig{Percentage: 10, Variant: &EventVariantConfig{Type: "dropped", Extensions: map[string]string{"ttl": "0"}}}, &seed)
+
+	marked := 0
+	for i := 0; i < 1000; i++ {
+		e := cetest.FullEvent()
+		mark(&e)
+		if !isExpectedLossEvent(&e) {
+			if e.Type() == "dropped" {
+				t.Fatal("want the variant applied to events expected not to be delivered only")
+			}
+			continue
+		}
+		marked++
+		if e.Type() != "dropped" || e.Extensions()["ttl"] != "0" {
+			t.Fatalf("want the variant applied, got %s", e)
+		}
+	}
+	if marked < 50 || marked > 150 {
+		t.Errorf("want about 10%% of events expected not to be delivered, got %d", marked)
+	}
+
+	e := cetest.FullEvent()
+	newExpectedLossGenerator(nil, &seed)(&e)
+	if isExpectedLossEvent(&e) {
+		t.Error("want no event marked without config")
+	}
+}
+
+func TestStateManagerExpectedLoss(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{})
+
+	event := func(id string, expectedLoss bool) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		if expectedLoss {
+			e.SetExtension(ExpectedLossExtension, "true")
+		}
+		return e
+	}
+	for _, e := range []ce.Event{event("1", false), event("2", true), event("3", false), event("4", true)} {
+		e := e
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+	for _, e := range []ce.Event{event("1", false), event("3", false), event("4", true), event("4", true)} {
+		sm.lock.Lock()
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+
+	if report.ReceivedCount != 2 || report.LostCount != 0 || report.ExpectedLossCount != 2 || report.UndroppedCount != 1 {
+		t.Errorf("expected 2 received, 0 lost, 2 expected loss and 1 undropped events, got %d, %d, %d and %d", report.ReceivedCount, report.LostCount, report.ExpectedLossCount, report.UndroppedCount)
+	}
+	if diff := cmp.Diff(map[string][]string{unknownPartitionKey: {"4"}}, report.UndroppedEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	report.Metrics.AcceptedCount = 4
+	if got := report.expectedCount(); got != 2 {
+		t.Errorf("expected 2 events to be received, got %d", got)
+	}
+}
+
+func TestExpectedLossConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ExpectedLossConfig
+		wantErr bool
+	}{
+		{name: "percentage", config: ExpectedLossConfig{Percentage: 10}},
+		{name: "variant", config: ExpectedLossConfig{Percentage: 0.5, Variant: &EventVariantConfig{Type: "dropped"}}},
+		{name: "no percentage", config: ExpectedLossConfig{}, wantErr: true},
+		{name: "all events", config: ExpectedLossConfig{Percentage: 100}, wantErr: true},
+		{name: "invalid variant extension", config: ExpectedLossConfig{Percentage: 10, Variant: &EventVariantConfig{Extensions: map[string]string{"Bad-Name": "x"}}}, wantErr: true},
+		{name: "reserved extension", config: ExpectedLossConfig{Percentage: 10, Variant: &EventVariantConfig{Extensions: map[string]string{ExpectedLossExtension: "false"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package sacura
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxExpirationInterval bounds the interval at which sent events are checked against the max delivery age.
+const maxExpirationInterval = time.Second
+
+// ExpiredEvent is a sent event that hasn't been received within the max delivery age.
+type ExpiredEvent struct {
+	ID     string    `json:"id"`
+	SentAt time.Time `json:"sentAt"`
+	// ExpiredAt is the time at which the event has been recorded as lost.
+	ExpiredAt time.Time `json:"expiredAt"`
+	// Late is true when the event has been received after it expired.
+	Late bool `json:"late"`
+}
+
+// pendingEvent is a sent event waiting to be received within the max delivery age.
+type pendingEvent struct {
+	id           string
+	partitionKey string
+	sentAt       time.Time
+}
+
+// expiredEvent is an event recorded as lost by age.
+type expiredEvent struct {
+	partitionKey string
+	sentAt       time.Time
+	expiredAt    time.Time
+}
+
+// trackDeliveryAge queues the given sent event for the max delivery age check, it must be called while holding the
+// lock.
+func (s *StateManager) trackDeliveryAge(id, pk string, sentAt time.Time) {
+	if s.config.Verification.ParsedMaxDeliveryAge <= 0 || sentAt.IsZero() {
+		return
+	}
+	s.pending = append(s.pending, pendingEvent{id: id, partitionKey: pk, sentAt: sentAt})
+}
+
+// expire records as lost sent events not received within the max delivery age at the given time and returns the
+// total number of expired events.
+func (s *StateManager) expire(now time.Time) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	age := s.config.Verification.ParsedMaxDeliveryAge
+
+	// Events are queued in send order, so the scan stops at the first event that is still within the window.
+	i := 0
+	for ; i < len(s.pending) && now.Sub(s.pending[i].sentAt) > age; i++ {
+		p := s.pending[i]
+		if s.delivered(p.id, p.partitionKey) {
+			continue
+		}
+		logger(LogComponentState).Warnw("Event not received within the max age", "id", p.id, "maxAge", age, "sentAt", p.sentAt)
+		s.expired[p.id] = expiredEvent{partitionKey: p.partitionKey, sentAt: p.sentAt, expiredAt: now}
+		s.expiredCount.Inc()
+	}
+	s.pending = s.pending[i:]
+
+	return len(s.expired)
+}
+
+// delivered returns true if the given event has been received or dead-lettered, it must be called while holding
+// the lock.
+func (s *StateManager) delivered(id, pk string) bool {
+	if s.streaming != nil {
+		_, outstanding := s.streaming.outstanding[id]
+		return !outstanding
+	}
+	if _, ok := s.receivedAt[id]; ok {
+		return true
+	}
+	for _, dl := range s.deadLettered[pk] {
+		if dl == id {
+			return true
+		}
+	}
+	return false
+}
+
+// startExpiration periodically records as lost events not received within the max delivery age until the returned
+// function is called, onThreshold is called once when the number of expired events exceeds
+// verification.maxExpiredEvents.
+func (s *StateManager) startExpiration(onThreshold func()) func() {
+	age := s.config.Verification.ParsedMaxDeliveryAge
+	if age <= 0 {
+		return func() {}
+	}
+	interval := age / 2
+	if interval > maxExpirationInterval {
+		interval = maxExpirationInterval
+	}
+	maxExpired := s.config.Verification.MaxExpiredEvents
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		crossed := false
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				expired := s.expire(now)
+				if !crossed && maxExpired != nil && expired > *maxExpired {
+					crossed = true
+					logger(LogComponentState).Errorw("Too many events not received within the max age, stopping the test", "expired", expired, "maxAge", age, "maxExpired", *maxExpired)
+					onThreshold()
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// expiredReport adds expired events to the given report, it must be called while holding the lock.
+func (s *StateManager) expiredReport(r *Report) {
+	for id, e := range s.expired {
+		r.ExpiredEventsByPartitionKey[e.partitionKey] = append(r.ExpiredEventsByPartitionKey[e.partitionKey], ExpiredEvent{
+			ID:        id,
+			SentAt:    e.sentAt,
+			ExpiredAt: e.expiredAt,
+			Late:      s.delivered(id, e.partitionKey),
+		})
+		r.ExpiredCount++
+	}
+	for _, events := range r.ExpiredEventsByPartitionKey {
+		sort.Slice(events, func(i, j int) bool { return events[i].ID < events[j].ID })
+	}
+}
@@ -0,0 +1,100 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestStateManagerExpire(t *testing.T) {
+
+	tests := []struct {
+		name string
+		mode VerificationMode
+	}{
+		{name: "full", mode: VerificationModeFull},
+		{name: "streaming", mode: VerificationModeStreaming},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, Config{Verification: VerificationConfig{Mode: tt.mode, ParsedMaxDeliveryAge: time.Minute}})
+
+			now := time.Now()
+			event := func(id string, sentAt time.Time) ce.Event {
+				e := cetest.FullEvent()
+				e.SetID(id)
+				e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(sentAt.UnixMilli()))
+				return e
+			}
+			received := func(e ce.Event) {
+				sm.lock.Lock()
+				defer sm.lock.Unlock()
+				sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: now})
+			}
+
+			old := []ce.Event{event("1", now.Add(-2*time.Minute)), event("2", now.Add(-2*time.Minute))}
+			recent := event("3", now.Add(-time.Second))
+			for _, e := range append(old, recent) {
+				e := e
+				sm.lock.Lock()
+				sm.recordSent(&e)
+				sm.lock.Unlock()
+			}
+			received(old[0])
+
+			if got := sm.expire(now); got != 1 {
+				t.Fatalf("expected 1 expired event, got %d", got)
+			}
+			if got := sm.expire(now); got != 1 {
+				t.Fatalf("expected expired events to be recorded once, got %d", got)
+			}
+			if got := sm.expiredCount.Load(); got != 1 {
+				t.Errorf("expected expired count 1, got %d", got)
+			}
+
+			report := sm.GenerateReport()
+			expired := report.ExpiredEventsByPartitionKey[unknownPartitionKey]
+			if report.ExpiredCount != 1 || len(expired) != 1 || expired[0].ID != "2" || expired[0].Late {
+				t.Errorf("expected event 2 to be expired, got %+v", report.ExpiredEventsByPartitionKey)
+			}
+			if !expired[0].ExpiredAt.Equal(now) {
+				t.Errorf("expected expired at %v, got %v", now, expired[0].ExpiredAt)
+			}
+
+			received(old[1])
+			report = sm.GenerateReport()
+			if expired := report.ExpiredEventsByPartitionKey[unknownPartitionKey]; len(expired) != 1 || !expired[0].Late {
+				t.Errorf("expected event 2 to be late, got %+v", report.ExpiredEventsByPartitionKey)
+			}
+		})
+	}
+}
+
+func TestStateManagerStartExpiration(t *testing.T) {
+
+	zero := 0
+	sm := newTestStateManager(t, Config{Verification: VerificationConfig{
+		ParsedMaxDeliveryAge: 10 * time.Millisecond,
+		MaxExpiredEvents:     &zero,
+	}})
+
+	e := cetest.FullEvent()
+	e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(time.Now().UnixMilli()))
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.lock.Unlock()
+
+	crossed := make(chan struct{})
+	stop := sm.startExpiration(func() { close(crossed) })
+	defer stop()
+
+	select {
+	case <-crossed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected threshold to be crossed")
+	}
+}
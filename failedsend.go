@@ -0,0 +1,143 @@
+package sacura
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// FailedSend is an event the sender failed to send, not even after retries, so it is not expected to be received.
+type FailedSend struct {
+	ID           string `json:"id"`
+	PartitionKey string `json:"partitionKey"`
+	// StatusCode is the status code of the last attempt, it is 0 when the last attempt failed without a response.
+	StatusCode int `json:"statusCode,omitempty"`
+	// Error is the error of the last attempt.
+	Error string `json:"error,omitempty"`
+	// ErrorClass is the class of the error of the last attempt when it failed without a response, for example
+	// ErrorClassTimeout.
+	ErrorClass string `json:"errorClass,omitempty"`
+	// Identity is the identity the event has been sent with, when sender.identityRotation is set.
+	Identity string `json:"identity,omitempty"`
+}
+
+// newFailedSend returns the failure of the given result of a request neither failing nor accepted.
+func newFailedSend(res *vegeta.Result) FailedSend {
+	f := FailedSend{StatusCode: int(res.Code), Error: res.Error}
+	if f.Error != "" && f.StatusCode == 0 {
+		f.ErrorClass = errorClass(f.Error)
+	}
+	if f.Error == "" {
+		if s := res.Headers.Get(grpcStatusHeader); s != "" {
+			f.Error = "grpc-status " + s
+		}
+	}
+	return f
+}
+
+// sendFailures records the failures of the last attempt of events not accepted by ID.
+type sendFailures struct {
+	lock sync.Mutex
+	byID map[string]FailedSend
+}
+
+func newSendFailures() *sendFailures {
+	return &sendFailures{byID: make(map[string]FailedSend)}
+}
+
+func (s *sendFailures) record(ids []string, f FailedSend) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range ids {
+		s.byID[id] = f
+	}
+}
+
+// failedSendTransport is an http.RoundTripper recording the failures of requests failing without a response, the
+// results of vegeta don't carry the headers of these requests.
+type failedSendTransport struct {
+	next     http.RoundTripper
+	failures *sendFailures
+}
+
+func (t failedSendTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		t.failures.record(req.Header.Values(CloudEventIdHeader), FailedSend{Error: err.Error(), ErrorClass: errorClass(err.Error())})
+	}
+	return resp, err
+}
+
+// failedSends returns the given proposed events never accepted by the target, excluding warmup events, sorted by ID.
+func failedSends(proposed map[string]ce.Event, failures map[string]FailedSend, config *Config) []FailedSend {
+	smConfig := stateManagerConfigFromConfig(*config)
+	failed := make([]FailedSend, 0, len(proposed))
+	for id, e := range proposed {
+		if isWarmupEvent(&e) {
+			continue
+		}
+		f := failures[id]
+		f.ID = id
+		f.PartitionKey = partitionKey(&e, &smConfig)
+		f.Identity, _ = eventIdentity(&e)
+		failed = append(failed, f)
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ID < failed[j].ID })
+	return failed
+}
+
+// recordFailedSends records the sends failed by the sender, it must be called while holding the lock.
+func (s *StateManager) recordFailedSends(failed []FailedSend) {
+	for _, f := range failed {
+		s.failedSends[f.ID] = f
+		if s.streaming != nil {
+			delete(s.streaming.outstanding, f.ID)
+			s.streaming.approximate.forget(f.ID)
+		}
+	}
+}
+
+// withoutFailedSends returns the given sent events without the ones the sender failed to send, it must be called
+// while holding the lock.
+func (s *StateManager) withoutFailedSends(sent []string) []string {
+	if len(s.failedSends) == 0 {
+		return sent
+	}
+	r := make([]string, 0, len(sent))
+	for _, id := range sent {
+		if _, ok := s.failedSends[id]; !ok {
+			r = append(r, id)
+		}
+	}
+	return r
+}
+
+// failedSendsReport adds failed sends to the given report, it must be called while holding the lock.
+func (s *StateManager) failedSendsReport(r *Report) {
+	// Failed sends are reported by partition key only.
+	r.Metrics.FailedSends = nil
+	for _, f := range s.failedSends {
+		r.FailedSendsByPartitionKey[f.PartitionKey] = append(r.FailedSendsByPartitionKey[f.PartitionKey], f)
+		r.FailedSendCount++
+	}
+	for _, failed := range r.FailedSendsByPartitionKey {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].ID < failed[j].ID })
+	}
+}
+
+// failedSendsDiff adds failed sends to the given diff, it must be called while holding the lock.
+func (s *StateManager) failedSendsDiff(d *DiffReport) {
+	for _, f := range s.failedSends {
+		p := d.Partitions[f.PartitionKey]
+		p.NotSent = append(p.NotSent, f.ID)
+		d.Partitions[f.PartitionKey] = p
+	}
+	for pk, p := range d.Partitions {
+		sort.Strings(p.NotSent)
+		d.Partitions[pk] = p
+	}
+}
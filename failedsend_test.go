@@ -0,0 +1,136 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestNewFailedSend(t *testing.T) {
+	tests := []struct {
+		name string
+		res  vegeta.Result
+		want FailedSend
+	}{
+		{
+			name: "status code",
+			res:  vegeta.Result{Code: http.StatusServiceUnavailable},
+			want: FailedSend{StatusCode: http.StatusServiceUnavailable},
+		},
+		{
+			name: "error",
+			res:  vegeta.Result{Error: "connection refused"},
+			want: FailedSend{Error: "connection refused", ErrorClass: ErrorClassConnectionRefused},
+		},
+		{
+			name: "grpc status",
+			res:  vegeta.Result{Code: http.StatusOK, Headers: http.Header{grpcStatusHeader: []string{"14"}}},
+			want: FailedSend{StatusCode: http.StatusOK, Error: "grpc-status 14"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, newFailedSend(&tt.res)); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestFailedSends(t *testing.T) {
+	event := func(id string, warmup bool) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		if warmup {
+			e.SetExtension(WarmupExtension, true)
+		}
+		return e
+	}
+
+	proposed := map[string]ce.Event{
+		"2": event("2", false),
+		"1": event("1", false),
+		"3": event("3", true),
+	}
+	withIdentity := proposed["2"]
+	withIdentity.SetExtension(IdentityExtension, "a")
+	proposed["2"] = withIdentity
+	failures := map[string]FailedSend{
+		"1": {StatusCode: http.StatusServiceUnavailable},
+	}
+
+	want := []FailedSend{
+		{ID: "1", PartitionKey: unknownPartitionKey, StatusCode: http.StatusServiceUnavailable},
+		{ID: "2", PartitionKey: unknownPartitionKey, Identity: "a"},
+	}
+	if diff := cmp.Diff(want, failedSends(proposed, failures, &Config{})); diff != "" {
+		t.Errorf("(-want, +got) %s", diff)
+	}
+}
+
+func TestStateManagerFailedSends(t *testing.T) {
+	tests := []struct {
+		name string
+		mode VerificationMode
+	}{
+		{
+			name: "full",
+			mode: VerificationModeFull,
+		},
+		{
+			name: "streaming",
+			mode: VerificationModeStreaming,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, Config{
+				DeliveryGuarantee: AtLeastOnce,
+				Verification:      VerificationConfig{Mode: tt.mode},
+			})
+
+			event := func(id string) ce.Event {
+				e := cetest.FullEvent()
+				e.SetID(id)
+				return e
+			}
+
+			// "1" is received, "2" is lost and "3" failed to send but landed in sent anyway.
+			sm.lock.Lock()
+			for _, id := range []string{"1", "2", "3"} {
+				e := event(id)
+				sm.recordSent(&e)
+			}
+			sm.recordReceived(&ReceivedEvent{Event: event("1")})
+			sm.lock.Unlock()
+
+			failed := FailedSend{ID: "3", PartitionKey: unknownPartitionKey, StatusCode: http.StatusBadGateway}
+			sm.Terminated(Metrics{AcceptedCount: 2, NotSentCount: 1, FailedSends: []FailedSend{failed}})
+			report := sm.GenerateReport()
+
+			if report.LostCount != 1 || report.LostEventsByPartitionKey[unknownPartitionKey][0] != "2" {
+				t.Errorf("expected event 2 to be lost, got %+v", report.LostEventsByPartitionKey)
+			}
+			if report.FailedSendCount != 1 {
+				t.Errorf("expected 1 failed send, got %d", report.FailedSendCount)
+			}
+			if diff := cmp.Diff([]FailedSend{failed}, report.FailedSendsByPartitionKey[unknownPartitionKey]); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if report.Metrics.FailedSends != nil {
+				t.Errorf("expected failed sends to be reported by partition key only, got %+v", report.Metrics.FailedSends)
+			}
+
+			want := PartitionDiff{Missing: []string{"2"}, NotSent: []string{"3"}}
+			if diff := cmp.Diff(want, sm.Diff().Partitions[unknownPartitionKey]); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
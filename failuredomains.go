@@ -0,0 +1,215 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// FailureDomainsConfig tags time windows of the test with labels, for example "broker-upgrade" or "node-drain", so
+// that losses, duplicates and latency spikes are attributed to the windows they overlap with. Windows are scheduled
+// here or tagged at runtime through the admin API:
+//
+//	POST /failure-domains/start?label=broker-upgrade
+//	POST /failure-domains/end?label=broker-upgrade
+type FailureDomainsConfig struct {
+	// Schedule are the windows tagged at fixed offsets from the beginning of the test.
+	Schedule []FailureDomainWindowConfig `json:"schedule" yaml:"schedule"`
+}
+
+// FailureDomainWindowConfig is a scheduled failure domain window.
+type FailureDomainWindowConfig struct {
+	// Label is the label of the window, for example "broker-upgrade".
+	Label string `json:"label" yaml:"label"`
+	// Start is the offset from the beginning of the test at which the window starts, for example 1m.
+	Start string `json:"start" yaml:"start"`
+	// Duration is the duration of the window, for example 30s.
+	Duration string `json:"duration" yaml:"duration"`
+
+	ParsedStart    time.Duration
+	ParsedDuration time.Duration
+}
+
+func (c *FailureDomainsConfig) validate() error {
+	for i := range c.Schedule {
+		w := &c.Schedule[i]
+		field := fmt.Sprintf("failureDomains.schedule[%d]", i)
+		if w.Label == "" {
+			return invalidErr(field+".label", errors.New("label is required"))
+		}
+		var err error
+		w.ParsedStart, err = time.ParseDuration(w.Start)
+		if err != nil {
+			return invalidErr(field+".start", err)
+		}
+		if w.ParsedStart < 0 {
+			return invalidErr(field+".start", fmt.Errorf("%v cannot be negative", w.ParsedStart))
+		}
+		w.ParsedDuration, err = time.ParseDuration(w.Duration)
+		if err != nil {
+			return invalidErr(field+".duration", err)
+		}
+		if w.ParsedDuration <= 0 {
+			return invalidErr(field+".duration", fmt.Errorf("%v must be positive", w.ParsedDuration))
+		}
+	}
+	return nil
+}
+
+// FailureDomainsReport attributes losses, duplicates and latencies to the tagged windows of the test, events are
+// attributed to windows by send time and events sent during overlapping windows are attributed to each of them. It is
+// only reported with the full verification mode.
+type FailureDomainsReport struct {
+	// Windows are the tagged windows in the order they started.
+	Windows []FailureDomainWindow `json:"windows"`
+	// UntaggedLostCount is the number of lost events sent outside any window.
+	UntaggedLostCount int `json:"untaggedLostCount"`
+}
+
+// FailureDomainWindow is a tagged window of the test.
+type FailureDomainWindow struct {
+	Label string    `json:"label"`
+	Start time.Time `json:"start"`
+	// End is zero when the window was still open at the end of the test.
+	End           time.Time `json:"end"`
+	SentCount     int       `json:"sentCount"`
+	ReceivedCount int       `json:"receivedCount"`
+	LostCount     int       `json:"lostCount"`
+	// DuplicateCount is the number of duplicates recorded during the window.
+	DuplicateCount int64 `json:"duplicateCount"`
+	// Latency is the latency of the events sent during the window, to compare with the latency of the whole test.
+	Latency LatencyStats `json:"latency"`
+}
+
+type failureDomainWindow struct {
+	label string
+	start time.Time
+	end   time.Time
+	// duplicates is the live duplicate counter at the start of the window, endDuplicates at the end.
+	duplicates    int64
+	endDuplicates int64
+}
+
+// startFailureDomain tags a window with the given label from the given time, a label can't be started again before
+// its window ended.
+func (s *StateManager) startFailureDomain(label string, start time.Time) error {
+	if label == "" {
+		return errors.New("label is required")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, w := range s.failureDomains {
+		if w.label == label && w.end.IsZero() {
+			return fmt.Errorf("failure domain %q already started", label)
+		}
+	}
+	s.failureDomains = append(s.failureDomains, failureDomainWindow{
+		label:      label,
+		start:      start,
+		duplicates: s.duplicateCount.Load(),
+	})
+	return nil
+}
+
+// endFailureDomain ends the window of the given label at the given time.
+func (s *StateManager) endFailureDomain(label string, end time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i := range s.failureDomains {
+		if w := &s.failureDomains[i]; w.label == label && w.end.IsZero() {
+			w.end = end
+			w.endDuplicates = s.duplicateCount.Load()
+			return nil
+		}
+	}
+	return fmt.Errorf("failure domain %q not started", label)
+}
+
+// startFailureDomains tags the scheduled windows from now until the returned function is called.
+func (s *StateManager) startFailureDomains(config *FailureDomainsConfig) func() {
+	if config == nil || len(config.Schedule) == 0 {
+		return func() {}
+	}
+	var lock sync.Mutex
+	var timers []*time.Timer
+	for _, w := range config.Schedule {
+		w := w
+		lock.Lock()
+		timers = append(timers, time.AfterFunc(w.ParsedStart, func() {
+			if err := s.startFailureDomain(w.Label, time.Now()); err != nil {
+				logger(logComponentRun).Warnw("Failed to start scheduled failure domain", "label", w.Label, "error", err)
+				return
+			}
+			logger(logComponentRun).Infow("Failure domain started", "label", w.Label)
+			lock.Lock()
+			defer lock.Unlock()
+			timers = append(timers, time.AfterFunc(w.ParsedDuration, func() {
+				if err := s.endFailureDomain(w.Label, time.Now()); err == nil {
+					logger(logComponentRun).Infow("Failure domain ended", "label", w.Label)
+				}
+			}))
+		}))
+		lock.Unlock()
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			lock.Lock()
+			defer lock.Unlock()
+			for _, t := range timers {
+				t.Stop()
+			}
+		})
+	}
+}
+
+// failureDomainsReport attributes sent events to the tagged windows, it must be called while holding the lock.
+func (s *StateManager) failureDomainsReport(lost sets.String) *FailureDomainsReport {
+	if len(s.failureDomains) == 0 {
+		return nil
+	}
+	report := &FailureDomainsReport{Windows: make([]FailureDomainWindow, len(s.failureDomains))}
+	latencies := make([][]time.Duration, len(s.failureDomains))
+	for i, w := range s.failureDomains {
+		report.Windows[i] = FailureDomainWindow{Label: w.label, Start: w.start, End: w.end}
+		if w.end.IsZero() {
+			report.Windows[i].DuplicateCount = s.duplicateCount.Load() - w.duplicates
+		} else {
+			report.Windows[i].DuplicateCount = w.endDuplicates - w.duplicates
+		}
+	}
+
+	for id, sentAt := range s.sentAt {
+		if sentAt.IsZero() {
+			continue
+		}
+		tagged := false
+		for i, w := range s.failureDomains {
+			if sentAt.Before(w.start) || (!w.end.IsZero() && !sentAt.Before(w.end)) {
+				continue
+			}
+			tagged = true
+			report.Windows[i].SentCount++
+			if lost.Has(id) {
+				report.Windows[i].LostCount++
+			}
+			if receivedAt, ok := s.receivedAt[id]; ok {
+				report.Windows[i].ReceivedCount++
+				latencies[i] = append(latencies[i], receivedAt.Sub(sentAt))
+			}
+		}
+		if !tagged && lost.Has(id) {
+			report.UntaggedLostCount++
+		}
+	}
+	for i := range report.Windows {
+		report.Windows[i].Latency = NewLatencyStats(latencies[i])
+	}
+	return report
+}
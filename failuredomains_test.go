@@ -0,0 +1,150 @@
+package sacura
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestFailureDomainsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  FailureDomainsConfig
+		wantErr bool
+	}{
+		{name: "empty", config: FailureDomainsConfig{}},
+		{name: "valid", config: FailureDomainsConfig{Schedule: []FailureDomainWindowConfig{{Label: "broker-upgrade", Start: "1m", Duration: "30s"}}}},
+		{name: "no label", config: FailureDomainsConfig{Schedule: []FailureDomainWindowConfig{{Start: "1m", Duration: "30s"}}}, wantErr: true},
+		{name: "negative start", config: FailureDomainsConfig{Schedule: []FailureDomainWindowConfig{{Label: "a", Start: "-1s", Duration: "30s"}}}, wantErr: true},
+		{name: "no duration", config: FailureDomainsConfig{Schedule: []FailureDomainWindowConfig{{Label: "a", Start: "0s"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFailureDomainsReport(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	start := time.Now()
+
+	if err := sm.startFailureDomain("broker-upgrade", start.Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.startFailureDomain("broker-upgrade", start.Add(time.Second)); err == nil {
+		t.Error("want error starting a started failure domain")
+	}
+	if err := sm.startFailureDomain("node-drain", start.Add(2*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	sm.duplicateCount.Inc()
+	if err := sm.endFailureDomain("broker-upgrade", start.Add(3*time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.endFailureDomain("broker-upgrade", start.Add(3*time.Second)); err == nil {
+		t.Error("want error ending an ended failure domain")
+	}
+	sm.duplicateCount.Inc()
+
+	sm.sentAt = map[string]time.Time{
+		"before":  start,
+		"upgrade": start.Add(1500 * time.Millisecond),
+		"both":    start.Add(2500 * time.Millisecond),
+		"drain":   start.Add(4 * time.Second),
+	}
+	sm.receivedAt = map[string]time.Time{
+		"upgrade": start.Add(1600 * time.Millisecond),
+		"drain":   start.Add(5 * time.Second),
+	}
+	report := sm.failureDomainsReport(sets.NewString("before", "both"))
+	if report == nil || len(report.Windows) != 2 {
+		t.Fatalf("want 2 windows, got %+v", report)
+	}
+	if report.UntaggedLostCount != 1 {
+		t.Errorf("want 1 untagged lost event, got %d", report.UntaggedLostCount)
+	}
+
+	upgrade, drain := report.Windows[0], report.Windows[1]
+	if upgrade.Label != "broker-upgrade" || upgrade.SentCount != 2 || upgrade.LostCount != 1 || upgrade.ReceivedCount != 1 || upgrade.DuplicateCount != 1 {
+		t.Errorf("unexpected broker-upgrade window %+v", upgrade)
+	}
+	if upgrade.Latency.Max != 100*time.Millisecond {
+		t.Errorf("want broker-upgrade max latency 100ms, got %v", upgrade.Latency.Max)
+	}
+	if !drain.End.IsZero() || drain.SentCount != 2 || drain.LostCount != 1 || drain.DuplicateCount != 2 {
+		t.Errorf("unexpected node-drain window %+v", drain)
+	}
+	if drain.Latency.Max != time.Second {
+		t.Errorf("want node-drain max latency 1s, got %v", drain.Latency.Max)
+	}
+
+	if got := newTestStateManager(t, Config{}).failureDomainsReport(sets.NewString()); got != nil {
+		t.Errorf("want no report without windows, got %+v", got)
+	}
+}
+
+func TestStartFailureDomains(t *testing.T) {
+	config := &FailureDomainsConfig{Schedule: []FailureDomainWindowConfig{{Label: "node-drain", Start: "10ms", Duration: "20ms"}}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, Config{})
+	stop := sm.startFailureDomains(config)
+	defer stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sm.lock.RLock()
+		ended := len(sm.failureDomains) == 1 && !sm.failureDomains[0].end.IsZero()
+		sm.lock.RUnlock()
+		if ended {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("scheduled failure domain didn't end")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestAdminServerFailureDomains(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	server := httptest.NewServer(&adminServer{control: newSenderControl(false), sm: sm, start: time.Now()})
+	defer server.Close()
+
+	tests := []struct {
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{method: http.MethodPost, path: "/failure-domains/end?label=broker-upgrade", wantStatus: http.StatusConflict},
+		{method: http.MethodPost, path: "/failure-domains/start", wantStatus: http.StatusConflict},
+		{method: http.MethodGet, path: "/failure-domains/start?label=broker-upgrade", wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodPost, path: "/failure-domains/start?label=broker-upgrade", wantStatus: http.StatusOK},
+		{method: http.MethodPost, path: "/failure-domains/end?label=broker-upgrade", wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s %s: want status %d, got %d", tt.method, tt.path, tt.wantStatus, resp.StatusCode)
+		}
+	}
+	if len(sm.failureDomains) != 1 || sm.failureDomains[0].end.IsZero() {
+		t.Errorf("want an ended failure domain, got %+v", sm.failureDomains)
+	}
+}
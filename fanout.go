@@ -0,0 +1,195 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// FanOutConfig configures the verification of events delivered to several sinks, like the subscriptions of a broker
+// pointing to different paths of the receiver.
+type FanOutConfig struct {
+	// Sinks are the request paths on which the receiver acts as a sink, each sink is expected to receive every sent
+	// event exactly once.
+	//
+	// When not specified, each request path on which events are received is a sink.
+	Sinks []string `json:"sinks" yaml:"sinks"`
+	// Factor is the number of sinks each sent event is expected to be delivered to.
+	//
+	// Defaults to the number of sinks.
+	Factor int `json:"factor" yaml:"factor"`
+}
+
+// FanOutReport reports loss and duplicates for each sink.
+type FanOutReport struct {
+	Factor int                   `json:"factor"`
+	Sinks  map[string]SinkReport `json:"sinks"`
+}
+
+type SinkReport struct {
+	// ReceivedCount is the number of sent events received by the sink, excluding duplicates.
+	ReceivedCount int `json:"receivedCount"`
+	// LostCount is the number of sent events not received by the sink.
+	LostCount                int                 `json:"lostCount"`
+	LostEventsByPartitionKey map[string][]string `json:"lostEvents"`
+	// DuplicateCount is the number of events received more than once by the sink.
+	DuplicateCount                int                 `json:"duplicateCount"`
+	DuplicateEventsByPartitionKey map[string][]string `json:"duplicateEvents"`
+}
+
+// sinkState tracks the events received by a sink.
+type sinkState struct {
+	// received collects received events by partition key, including duplicates.
+	received map[string][]string
+	ids      sets.String
+}
+
+func (c *FanOutConfig) validate(receiver *ReceiverConfig, mode VerificationMode) error {
+	if len(c.Sinks) == 0 && c.Factor == 0 {
+		return invalidErr("receiver.fanOut", errors.New("sinks or factor must be specified"))
+	}
+	if c.Factor < 0 {
+		return invalidErr("receiver.fanOut.factor", fmt.Errorf("%d cannot be negative", c.Factor))
+	}
+	if len(c.Sinks) > 0 && c.Factor > 0 && c.Factor != len(c.Sinks) {
+		return invalidErr("receiver.fanOut.factor", fmt.Errorf("%d doesn't match the %d sinks", c.Factor, len(c.Sinks)))
+	}
+	seen := sets.NewString()
+	for i, p := range c.Sinks {
+		if !strings.HasPrefix(p, "/") {
+			return invalidErr(fmt.Sprintf("receiver.fanOut.sinks[%d]", i), fmt.Errorf("%q must be an absolute path", p))
+		}
+		if p == receiver.DeadLetterSinkPath {
+			return invalidErr(fmt.Sprintf("receiver.fanOut.sinks[%d]", i), fmt.Errorf("%q is the dead-letter sink path", p))
+		}
+		if seen.Has(p) {
+			return invalidErr(fmt.Sprintf("receiver.fanOut.sinks[%d]", i), fmt.Errorf("%q is a duplicate sink", p))
+		}
+		seen.Insert(p)
+	}
+	if mode.streams() {
+		return invalidErr("receiver.fanOut", fmt.Errorf("fan-out is not supported in %s verification mode", mode))
+	}
+	if c.Factor == 0 {
+		c.Factor = len(c.Sinks)
+	}
+	return nil
+}
+
+// newFanOutState returns the state of the configured sinks, it returns nil when fan-out verification is disabled.
+func newFanOutState(config *FanOutConfig) map[string]*sinkState {
+	if config == nil {
+		return nil
+	}
+	sinks := make(map[string]*sinkState, config.Factor)
+	for _, p := range config.Sinks {
+		sinks[p] = newSinkState()
+	}
+	return sinks
+}
+
+func newSinkState() *sinkState {
+	return &sinkState{received: make(map[string][]string), ids: sets.NewString()}
+}
+
+// recordFanOut records the given event as received by its sink, it returns false when the event is a copy of an event
+// already received by another sink, which is not a duplicate. It must be called while holding the lock.
+func (s *StateManager) recordFanOut(e *ReceivedEvent) bool {
+	sink, ok := s.fanOut[e.Sink]
+	if !ok {
+		sink = newSinkState()
+		s.fanOut[e.Sink] = sink
+	}
+	insert(&e.Event, sink.received, &s.stateManagerConfig)
+
+	id := e.Event.ID()
+	if sink.ids.Has(id) {
+		return true
+	}
+	sink.ids.Insert(id)
+	_, receivedByOtherSink := s.receivedAt[id]
+	return !receivedByOtherSink
+}
+
+// fanOutReport adds the report of each sink to the given report, it must be called while holding the lock.
+func (s *StateManager) fanOutReport(r *Report) {
+	if s.fanOut == nil {
+		return
+	}
+	r.FanOut = &FanOutReport{Factor: s.config.Receiver.FanOut.Factor, Sinks: make(map[string]SinkReport, len(s.fanOut))}
+	for path, sink := range s.fanOut {
+		sr := SinkReport{
+			LostEventsByPartitionKey:      make(map[string][]string),
+			DuplicateEventsByPartitionKey: make(map[string][]string),
+		}
+		for k, v := range s.sent {
+			received, duplicates := removeDuplicates(sink.received[k])
+			sent, _ := withoutDeadLettered(v, s.receivedIDs(k), s.deadLettered[k])
+			received, _ = splitUnexpected(sent, received)
+
+			if lost := sets.NewString(sent...).Difference(sets.NewString(received...)).List(); len(lost) > 0 {
+				sr.LostEventsByPartitionKey[k] = lost
+				sr.LostCount += len(lost)
+			}
+			if len(duplicates) > 0 {
+				sort.Strings(duplicates)
+				sr.DuplicateEventsByPartitionKey[k] = duplicates
+				sr.DuplicateCount += len(duplicates)
+			}
+			sr.ReceivedCount += len(received)
+		}
+		r.FanOut.Sinks[path] = sr
+	}
+}
+
+// receivedIDs returns the events of the given partition received by any sink, it must be called while holding the
+// lock.
+func (s *StateManager) receivedIDs(pk string) []string {
+	received, _ := removeDuplicates(s.received[pk])
+	return received
+}
+
+// verifyFanOut verifies that each sent event has been received by each sink of the given report.
+func verifyFanOut(config Config, report Report) error {
+	if report.FanOut == nil || config.Sender.Disabled || report.expectedCount() <= 0 {
+		return nil
+	}
+
+	paths := make([]string, 0, len(report.FanOut.Sinks))
+	for p := range report.FanOut.Sinks {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	if len(paths) > report.FanOut.Factor {
+		return fmt.Errorf("events received by %d sinks %v, expected a fan-out factor of %d", len(paths), paths, report.FanOut.Factor)
+	}
+	if missing := report.FanOut.Factor - len(paths); missing > 0 {
+		// Sinks that haven't received any event lost all of them.
+		if !config.DeliveryGuarantee.allowsLoss() || (config.Receiver.MaxLostPercentage != nil && *config.Receiver.MaxLostPercentage < 100) {
+			return fmt.Errorf("events received by %d sinks %v, expected a fan-out factor of %d", len(paths), paths, report.FanOut.Factor)
+		}
+	}
+
+	for _, p := range paths {
+		sink := report.FanOut.Sinks[p]
+		if sink.LostCount == 0 {
+			continue
+		}
+		if !config.DeliveryGuarantee.allowsLoss() {
+			return fmt.Errorf("%d events lost by sink %s", sink.LostCount, p)
+		}
+		lostPercentage := 100 * sink.LostCount / report.expectedCount()
+		if config.Receiver.MaxLostPercentage != nil && lostPercentage > *config.Receiver.MaxLostPercentage {
+			return fmt.Errorf("too many lost events detected by sink %s %d, expected at most %d",
+				p,
+				lostPercentage,
+				*config.Receiver.MaxLostPercentage,
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerFanOut(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{FanOut: &FanOutConfig{Sinks: []string{"/a", "/b", "/c"}, Factor: 3}}})
+
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+	for _, id := range []string{"1", "2", "3"} {
+		e := event(id)
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+	for _, r := range []struct {
+		id   string
+		sink string
+	}{
+		{"1", "/a"}, {"2", "/a"}, {"3", "/a"},
+		{"1", "/b"}, {"2", "/b"}, {"2", "/b"}, {"3", "/b"},
+		{"1", "/c"}, {"3", "/c"},
+	} {
+		sm.lock.Lock()
+		sm.recordReceived(&ReceivedEvent{Event: event(r.id), ReceivedAt: time.Now(), Sink: r.sink})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+
+	// Copies received by other sinks are not duplicates, a duplicate within a sink is.
+	if report.ReceivedCount != 3 || report.LostCount != 0 || report.DuplicateCount != 1 {
+		t.Errorf("expected 3 received events and 1 duplicate, got received %d, lost %d, duplicates %d", report.ReceivedCount, report.LostCount, report.DuplicateCount)
+	}
+	want := &FanOutReport{
+		Factor: 3,
+		Sinks: map[string]SinkReport{
+			"/a": {
+				ReceivedCount:                 3,
+				LostEventsByPartitionKey:      map[string][]string{},
+				DuplicateEventsByPartitionKey: map[string][]string{},
+			},
+			"/b": {
+				ReceivedCount:                 3,
+				LostEventsByPartitionKey:      map[string][]string{},
+				DuplicateCount:                1,
+				DuplicateEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2"}},
+			},
+			"/c": {
+				ReceivedCount:                 2,
+				LostCount:                     1,
+				LostEventsByPartitionKey:      map[string][]string{unknownPartitionKey: {"2"}},
+				DuplicateEventsByPartitionKey: map[string][]string{},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, report.FanOut); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	report.Metrics.AcceptedCount = 3
+	if err := verifyFanOut(Config{DeliveryGuarantee: AtLeastOnce}, report); err == nil {
+		t.Error("expected error for the event lost by /c")
+	}
+}
+
+func TestVerifyFanOut(t *testing.T) {
+
+	fifty := 50
+	sinks := func(lost ...int) map[string]SinkReport {
+		s := make(map[string]SinkReport, len(lost))
+		for i, l := range lost {
+			s[string(rune('a'+i))] = SinkReport{ReceivedCount: 10 - l, LostCount: l}
+		}
+		return s
+	}
+
+	tests := []struct {
+		name    string
+		config  Config
+		fanOut  *FanOutReport
+		wantErr bool
+	}{
+		{
+			name:   "disabled",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+		},
+		{
+			name:   "all sinks received all events",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+			fanOut: &FanOutReport{Factor: 2, Sinks: sinks(0, 0)},
+		},
+		{
+			name:    "loss in a sink",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			fanOut:  &FanOutReport{Factor: 2, Sinks: sinks(0, 1)},
+			wantErr: true,
+		},
+		{
+			name:   "tolerated loss in a sink",
+			config: Config{DeliveryGuarantee: AtMostOnce, Receiver: ReceiverConfig{MaxLostPercentage: &fifty}},
+			fanOut: &FanOutReport{Factor: 2, Sinks: sinks(0, 5)},
+		},
+		{
+			name:    "too many lost events in a sink",
+			config:  Config{DeliveryGuarantee: AtMostOnce, Receiver: ReceiverConfig{MaxLostPercentage: &fifty}},
+			fanOut:  &FanOutReport{Factor: 2, Sinks: sinks(6, 0)},
+			wantErr: true,
+		},
+		{
+			name:    "missing sink",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			fanOut:  &FanOutReport{Factor: 3, Sinks: sinks(0, 0)},
+			wantErr: true,
+		},
+		{
+			name:    "unexpected sink",
+			config:  Config{DeliveryGuarantee: AtMostOnce},
+			fanOut:  &FanOutReport{Factor: 1, Sinks: sinks(0, 0)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := Report{FanOut: tt.fanOut, Metrics: Metrics{AcceptedCount: 10}}
+			if err := verifyFanOut(tt.config, report); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFanOutConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		config     FanOutConfig
+		mode       VerificationMode
+		wantFactor int
+		wantErr    bool
+	}{
+		{
+			name:       "sinks",
+			config:     FanOutConfig{Sinks: []string{"/a", "/b"}},
+			wantFactor: 2,
+		},
+		{
+			name:       "factor",
+			config:     FanOutConfig{Factor: 3},
+			wantFactor: 3,
+		},
+		{
+			name:    "empty",
+			config:  FanOutConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "factor not matching sinks",
+			config:  FanOutConfig{Sinks: []string{"/a", "/b"}, Factor: 3},
+			wantErr: true,
+		},
+		{
+			name:    "relative sink",
+			config:  FanOutConfig{Sinks: []string{"a"}},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate sink",
+			config:  FanOutConfig{Sinks: []string{"/a", "/a"}},
+			wantErr: true,
+		},
+		{
+			name:    "dead-letter sink",
+			config:  FanOutConfig{Sinks: []string{"/a", "/dls"}},
+			wantErr: true,
+		},
+		{
+			name:    "streaming",
+			config:  FanOutConfig{Factor: 2},
+			mode:    VerificationModeStreaming,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&ReceiverConfig{DeadLetterSinkPath: "/dls"}, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && tt.config.Factor != tt.wantFactor {
+				t.Errorf("expected factor %d, got %d", tt.wantFactor, tt.config.Factor)
+			}
+		})
+	}
+}
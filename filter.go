@@ -0,0 +1,233 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/types"
+	"go.uber.org/atomic"
+)
+
+// EventVariantConfig configures attributes of sent events, so that events match a filter under test or not.
+type EventVariantConfig struct {
+	// Type, Source and Subject replace the attributes of the sample event when specified.
+	Type    string `json:"type" yaml:"type"`
+	Source  string `json:"source" yaml:"source"`
+	Subject string `json:"subject" yaml:"subject"`
+	// Extensions are set on sent events.
+	Extensions map[string]string `json:"extensions" yaml:"extensions"`
+	// Weight is the number of events sent with this variant for each cycle over the variants.
+	//
+	// Defaults to 1.
+	Weight int `json:"weight" yaml:"weight"`
+}
+
+// FilterPredicate is a predicate on event attributes with the semantics of Knative Trigger filters, all the specified
+// conditions must hold and the empty predicate matches all events.
+//
+// Attributes are context attributes, like type or source, or extensions, events without an attribute don't match
+// conditions on it.
+type FilterPredicate struct {
+	// Exact, Prefix and Suffix match attribute values exactly, by prefix and by suffix.
+	Exact  map[string]string `json:"exact" yaml:"exact"`
+	Prefix map[string]string `json:"prefix" yaml:"prefix"`
+	Suffix map[string]string `json:"suffix" yaml:"suffix"`
+	// All matches when all the predicates match, Any when at least one of them matches.
+	All []FilterPredicate `json:"all" yaml:"all"`
+	Any []FilterPredicate `json:"any" yaml:"any"`
+	// Not matches when the predicate doesn't match.
+	Not *FilterPredicate `json:"not" yaml:"not"`
+}
+
+func (c *EventVariantConfig) validate(field string) error {
+	if c.Weight < 0 {
+		return invalidErr(field+".weight", fmt.Errorf("%d cannot be negative", c.Weight))
+	}
+	for name := range c.Extensions {
+		if !isValidExtensionName(name) {
+			return invalidErr(field+".extensions", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", name))
+		}
+	}
+	return nil
+}
+
+func (p *FilterPredicate) validate(field string) error {
+	for _, attributes := range []struct {
+		field string
+		m     map[string]string
+	}{{"exact", p.Exact}, {"prefix", p.Prefix}, {"suffix", p.Suffix}} {
+		for name := range attributes.m {
+			if !isValidExtensionName(name) {
+				return invalidErr(field+"."+attributes.field, fmt.Errorf("%q is not a valid attribute name, expected lowercase letters and digits", name))
+			}
+		}
+	}
+	for i := range p.All {
+		if err := p.All[i].validate(fmt.Sprintf("%s.all[%d]", field, i)); err != nil {
+			return err
+		}
+	}
+	for i := range p.Any {
+		if err := p.Any[i].validate(fmt.Sprintf("%s.any[%d]", field, i)); err != nil {
+			return err
+		}
+	}
+	if p.Any != nil && len(p.Any) == 0 {
+		return invalidErr(field+".any", errors.New("cannot be empty"))
+	}
+	if p.Not != nil {
+		return p.Not.validate(field + ".not")
+	}
+	return nil
+}
+
+// matches returns true when the given event matches the predicate.
+func (p *FilterPredicate) matches(e *ce.Event) bool {
+	for name, v := range p.Exact {
+		if a, ok := eventAttribute(e, name); !ok || a != v {
+			return false
+		}
+	}
+	for name, v := range p.Prefix {
+		if a, ok := eventAttribute(e, name); !ok || !strings.HasPrefix(a, v) {
+			return false
+		}
+	}
+	for name, v := range p.Suffix {
+		if a, ok := eventAttribute(e, name); !ok || !strings.HasSuffix(a, v) {
+			return false
+		}
+	}
+	for i := range p.All {
+		if !p.All[i].matches(e) {
+			return false
+		}
+	}
+	if len(p.Any) > 0 {
+		matched := false
+		for i := range p.Any {
+			matched = matched || p.Any[i].matches(e)
+		}
+		if !matched {
+			return false
+		}
+	}
+	return p.Not == nil || !p.Not.matches(e)
+}
+
+// eventAttribute returns the value of the given context attribute or extension of the event formatted as a string.
+func eventAttribute(e *ce.Event, name string) (string, bool) {
+	var v string
+	switch name {
+	case "specversion":
+		v = e.SpecVersion()
+	case "id":
+		v = e.ID()
+	case "type":
+		v = e.Type()
+	case "source":
+		v = e.Source()
+	case "subject":
+		v = e.Subject()
+	case "dataschema":
+		v = e.DataSchema()
+	case "datacontenttype":
+		v = e.DataContentType()
+	case "time":
+		if e.Time().IsZero() {
+			return "", false
+		}
+		v = types.FormatTime(e.Time())
+	default:
+		ext, ok := e.Extensions()[name]
+		if !ok {
+			return "", false
+		}
+		s, err := types.Format(ext)
+		if err != nil {
+			return "", false
+		}
+		return s, true
+	}
+	return v, v != ""
+}
+
+// newVariantGenerator returns a function setting the attributes of the next variant on events, variants are applied in
+// turn according to their weight.
+func newVariantGenerator(variants []EventVariantConfig) func(e *ce.Event) {
+	var cycle []int
+	for i, v := range variants {
+		weight := v.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		for j := 0; j < weight; j++ {
+			cycle = append(cycle, i)
+		}
+	}
+	index := atomic.NewUint64(0)
+
+	return func(e *ce.Event) {
+		if len(cycle) == 0 {
+			return
+		}
+		v := &variants[cycle[(index.Inc()-1)%uint64(len(cycle))]]
+		if v.Type != "" {
+			e.SetType(v.Type)
+		}
+		if v.Source != "" {
+			e.SetSource(v.Source)
+		}
+		if v.Subject != "" {
+			e.SetSubject(v.Subject)
+		}
+		for name, value := range v.Extensions {
+			e.SetExtension(name, value)
+		}
+	}
+}
+
+// recordFiltered records sent events not matching the filter, they are expected not to be received, it returns true
+// when the event doesn't match. It must be called while holding the lock.
+func (s *StateManager) recordFiltered(e *ce.Event) bool {
+	if s.config.Verification.Filter == nil || s.config.Verification.Filter.matches(e) {
+		return false
+	}
+	s.filteredCount++
+	return true
+}
+
+// recordLeaked records received events not matching the filter, it returns true when the event doesn't match. It
+// must be called while holding the lock.
+func (s *StateManager) recordLeaked(e *ce.Event) bool {
+	if s.config.Verification.Filter == nil || s.config.Verification.Filter.matches(e) {
+		return false
+	}
+	logger(LogComponentState).Warnw("Received event not matching the filter", "id", e.ID())
+	insert(e, s.leaked, &s.stateManagerConfig)
+	return true
+}
+
+// filterReport adds filtered and leaked events to the given report, it must be called while holding the lock.
+func (s *StateManager) filterReport(r *Report) {
+	r.FilteredCount = s.filteredCount
+	for k, v := range s.leaked {
+		leaked, _ := removeDuplicates(v)
+		sort.Strings(leaked)
+		r.LeakedEventsByPartitionKey[k] = leaked
+		r.LeakedCount += len(leaked)
+	}
+}
+
+// expectedCount returns the number of accepted events expected to be received, events not matching the filter and
+// events marked by sender.expectedLoss or sent with sender.ttl are expected not to be received.
+func (r *Report) expectedCount() int {
+	expected := r.Metrics.AcceptedCount - r.FilteredCount - r.ExpectedLossCount
+	if r.TTL != nil {
+		expected -= r.TTL.ExpiringCount
+	}
+	return expected
+}
@@ -0,0 +1,177 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFilterPredicateMatches(t *testing.T) {
+
+	event := cetest.FullEvent()
+	event.SetType("dev.sacura.order.created")
+	event.SetSource("/orders")
+	event.SetExtension("region", "eu")
+
+	tests := []struct {
+		name      string
+		predicate FilterPredicate
+		want      bool
+	}{
+		{
+			name:      "empty",
+			predicate: FilterPredicate{},
+			want:      true,
+		},
+		{
+			name:      "exact",
+			predicate: FilterPredicate{Exact: map[string]string{"type": "dev.sacura.order.created", "source": "/orders"}},
+			want:      true,
+		},
+		{
+			name:      "exact not matching",
+			predicate: FilterPredicate{Exact: map[string]string{"type": "dev.sacura.order.deleted"}},
+		},
+		{
+			name:      "prefix",
+			predicate: FilterPredicate{Prefix: map[string]string{"type": "dev.sacura.order."}},
+			want:      true,
+		},
+		{
+			name:      "suffix",
+			predicate: FilterPredicate{Suffix: map[string]string{"type": ".deleted"}},
+		},
+		{
+			name:      "extension",
+			predicate: FilterPredicate{Exact: map[string]string{"region": "eu"}},
+			want:      true,
+		},
+		{
+			name:      "missing attribute",
+			predicate: FilterPredicate{Prefix: map[string]string{"tenant": ""}},
+		},
+		{
+			name: "all",
+			predicate: FilterPredicate{All: []FilterPredicate{
+				{Exact: map[string]string{"region": "eu"}},
+				{Exact: map[string]string{"source": "/payments"}},
+			}},
+		},
+		{
+			name: "any",
+			predicate: FilterPredicate{Any: []FilterPredicate{
+				{Exact: map[string]string{"region": "us"}},
+				{Exact: map[string]string{"source": "/orders"}},
+			}},
+			want: true,
+		},
+		{
+			name:      "not",
+			predicate: FilterPredicate{Not: &FilterPredicate{Exact: map[string]string{"region": "eu"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.predicate.matches(&event); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestVariantGenerator(t *testing.T) {
+
+	apply := newVariantGenerator([]EventVariantConfig{
+		{Type: "a", Weight: 2},
+		{Type: "b", Extensions: map[string]string{"region": "eu"}},
+	})
+
+	var got []string
+	for i := 0; i < 6; i++ {
+		e := cetest.FullEvent()
+		apply(&e)
+		region, _ := eventAttribute(&e, "region")
+		got = append(got, e.Type()+region)
+	}
+	if diff := cmp.Diff([]string{"a", "a", "beu", "a", "a", "beu"}, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStateManagerFilter(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{Verification: VerificationConfig{Filter: &FilterPredicate{Exact: map[string]string{"type": "match"}}}})
+
+	event := func(id, typ string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetType(typ)
+		return e
+	}
+	for _, e := range []ce.Event{event("1", "match"), event("2", "other"), event("3", "match"), event("4", "other")} {
+		e := e
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+	for _, e := range []ce.Event{event("1", "match"), event("3", "match"), event("4", "other")} {
+		sm.lock.Lock()
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+
+	if report.ReceivedCount != 2 || report.LostCount != 0 || report.FilteredCount != 2 || report.LeakedCount != 1 {
+		t.Errorf("expected 2 received, 0 lost, 2 filtered and 1 leaked events, got %d, %d, %d and %d", report.ReceivedCount, report.LostCount, report.FilteredCount, report.LeakedCount)
+	}
+	if diff := cmp.Diff(map[string][]string{unknownPartitionKey: {"4"}}, report.LeakedEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	report.Metrics.AcceptedCount = 4
+	if got := report.expectedCount(); got != 2 {
+		t.Errorf("expected 2 events to be received, got %d", got)
+	}
+}
+
+func TestFilterPredicateValidate(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		predicate FilterPredicate
+		wantErr   bool
+	}{
+		{
+			name:      "valid",
+			predicate: FilterPredicate{Exact: map[string]string{"type": "a"}, Not: &FilterPredicate{Prefix: map[string]string{"source": "/b"}}},
+		},
+		{
+			name:      "invalid attribute",
+			predicate: FilterPredicate{Suffix: map[string]string{"Type": "a"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid nested attribute",
+			predicate: FilterPredicate{All: []FilterPredicate{{Exact: map[string]string{"my-ext": "a"}}}},
+			wantErr:   true,
+		},
+		{
+			name:      "empty any",
+			predicate: FilterPredicate{Any: []FilterPredicate{}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.predicate.validate("verification.filter"); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
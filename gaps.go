@@ -0,0 +1,118 @@
+package sacura
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sequentialID returns the ID of the event with the given sequence number sent with sender.sequentialIds, events
+// with a partition key are prefixed with it, and with the prefix of sender.ids before it.
+func sequentialID(prefix, partitionKey string, seq uint64) string {
+	return sequentialIDPrefix(prefix, partitionKey) + strconv.FormatUint(seq, 10)
+}
+
+// sequentialIDPrefix returns the part of the sequential IDs of the given partition key before the sequence number.
+func sequentialIDPrefix(prefix, partitionKey string) string {
+	var b strings.Builder
+	for _, p := range []string{prefix, partitionKey} {
+		if p != "" {
+			b.WriteString(p)
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// parseSequentialID returns the sequence number of an ID returned by sequentialID for the given prefix and partition
+// key.
+func parseSequentialID(prefix, partitionKey, id string) (uint64, bool) {
+	id = strings.TrimPrefix(id, sequentialIDPrefix(prefix, ""))
+	seq, err := strconv.ParseUint(strings.TrimPrefix(id, partitionKey+"-"), 10, 64)
+	return seq, err == nil
+}
+
+// idRanges summarizes the sequential IDs of a single partition as contiguous ranges of sequence numbers and sorts the
+// IDs by sequence number, it returns false when any of the IDs isn't sequential.
+func idRanges(prefix, partitionKey string, ids []string) ([]SequenceRange, bool) {
+	sequences := make([]uint64, len(ids))
+	for i, id := range ids {
+		seq, ok := parseSequentialID(prefix, partitionKey, id)
+		if !ok {
+			return nil, false
+		}
+		sequences[i] = seq
+	}
+	sort.Sort(bySequence{ids: ids, sequences: sequences})
+
+	var ranges []SequenceRange
+	for _, seq := range sequences {
+		if n := len(ranges); n > 0 && (ranges[n-1].To == seq || ranges[n-1].To == seq-1) {
+			ranges[n-1].To = seq
+			continue
+		}
+		ranges = append(ranges, SequenceRange{From: seq, To: seq})
+	}
+	return ranges, true
+}
+
+type bySequence struct {
+	ids       []string
+	sequences []uint64
+}
+
+func (s bySequence) Len() int           { return len(s.ids) }
+func (s bySequence) Less(i, j int) bool { return s.sequences[i] < s.sequences[j] }
+func (s bySequence) Swap(i, j int) {
+	s.ids[i], s.ids[j] = s.ids[j], s.ids[i]
+	s.sequences[i], s.sequences[j] = s.sequences[j], s.sequences[i]
+}
+
+// truncateIDs returns at most max of the given IDs and the number of IDs omitted, max 0 means no limit.
+func truncateIDs(ids []string, max int) ([]string, int) {
+	if max <= 0 || len(ids) <= max {
+		return ids, 0
+	}
+	return ids[:max], len(ids) - max
+}
+
+// missingRangesDiff summarizes missing events as ranges with sequential IDs, truncating the list of missing events to
+// verification.maxListedIds, it must be called while holding the lock.
+func (s *StateManager) missingRangesDiff(d *DiffReport) {
+	if !s.stateManagerConfig.SequentialIDs {
+		return
+	}
+	for pk, p := range d.Partitions {
+		ranges, ok := idRanges(s.stateManagerConfig.IDPrefix, pk, p.Missing)
+		if !ok {
+			continue
+		}
+		p.MissingRanges = ranges
+		p.Missing, p.MissingOmitted = truncateIDs(p.Missing, s.stateManagerConfig.MaxListedIDs)
+		d.Partitions[pk] = p
+	}
+}
+
+// lostRangesReport summarizes lost events as ranges with sequential IDs, truncating the list of lost events to
+// verification.maxListedIds, it must be called while holding the lock.
+func (s *StateManager) lostRangesReport(r *Report) {
+	if !s.stateManagerConfig.SequentialIDs {
+		return
+	}
+	r.LostRangesByPartitionKey = make(map[string][]SequenceRange, len(r.LostEventsByPartitionKey))
+	for pk, ids := range r.LostEventsByPartitionKey {
+		ranges, ok := idRanges(s.stateManagerConfig.IDPrefix, pk, ids)
+		if !ok {
+			continue
+		}
+		r.LostRangesByPartitionKey[pk] = ranges
+		var omitted int
+		r.LostEventsByPartitionKey[pk], omitted = truncateIDs(ids, s.stateManagerConfig.MaxListedIDs)
+		if omitted > 0 {
+			if r.LostEventsOmittedByPartitionKey == nil {
+				r.LostEventsOmittedByPartitionKey = make(map[string]int)
+			}
+			r.LostEventsOmittedByPartitionKey[pk] = omitted
+		}
+	}
+}
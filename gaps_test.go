@@ -0,0 +1,151 @@
+package sacura
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestIDRanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		partitionKey string
+		ids          []string
+		want         []SequenceRange
+		wantIDs      []string
+		wantOk       bool
+	}{
+		{
+			name:         "contiguous ranges",
+			partitionKey: unknownPartitionKey,
+			ids:          []string{"10", "3", "4", "2", "7"},
+			want:         []SequenceRange{{From: 2, To: 4}, {From: 7, To: 7}, {From: 10, To: 10}},
+			wantIDs:      []string{"2", "3", "4", "7", "10"},
+			wantOk:       true,
+		},
+		{
+			name:         "partition key prefix",
+			partitionKey: "p1",
+			ids:          []string{"p1-5", "p1-6", "p1-8"},
+			want:         []SequenceRange{{From: 5, To: 6}, {From: 8, To: 8}},
+			wantIDs:      []string{"p1-5", "p1-6", "p1-8"},
+			wantOk:       true,
+		},
+		{
+			name:         "not sequential",
+			partitionKey: "p1",
+			ids:          []string{"p1-5", "8da9496e-f4a1-4103-b6dd-3183c9d6e5ee"},
+			wantIDs:      []string{"p1-5", "8da9496e-f4a1-4103-b6dd-3183c9d6e5ee"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := idRanges("", tt.partitionKey, tt.ids)
+			if ok != tt.wantOk {
+				t.Fatalf("want ok %v, got %v", tt.wantOk, ok)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantIDs, tt.ids); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorSequentialIDs(t *testing.T) {
+	n := 4
+	out := make(chan ce.Event, n)
+	config := Config{
+		Sender:  SenderConfig{Target: "http://localhost:9090", SequentialIDs: true},
+		Ordered: &OrderedConfig{NumPartitionKeys: 1},
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+	for i := 0; i < n; i++ {
+		if err := f(&vegeta.Target{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(out)
+
+	seq := 1
+	for e := range out {
+		pk := e.Extensions()[config.Ordered.partitionKeyExtension()]
+		if want := fmt.Sprintf("%s-%d", pk, seq); e.ID() != want {
+			t.Errorf("want ID %s, got %s", want, e.ID())
+		}
+		seq++
+	}
+}
+
+func TestStateManagerLostRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		mode VerificationMode
+	}{
+		{
+			name: "full",
+			mode: VerificationModeFull,
+		},
+		{
+			name: "streaming",
+			mode: VerificationModeStreaming,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, Config{
+				DeliveryGuarantee: AtLeastOnce,
+				Sender:            SenderConfig{SequentialIDs: true},
+				Verification:      VerificationConfig{Mode: tt.mode, MaxListedIDs: 2},
+			})
+
+			// 1 and 5 are received, 2-4 and 6-7 are lost.
+			sm.lock.Lock()
+			for seq := uint64(1); seq <= 7; seq++ {
+				e := cetest.FullEvent()
+				e.SetID(sequentialID("", "", seq))
+				sm.recordSent(&e)
+				if seq == 1 || seq == 5 {
+					sm.recordReceived(&ReceivedEvent{Event: e})
+				}
+			}
+			sm.lock.Unlock()
+			sm.Terminated(Metrics{AcceptedCount: 7})
+
+			wantRanges := []SequenceRange{{From: 2, To: 4}, {From: 6, To: 7}}
+
+			report := sm.GenerateReport()
+			if report.LostCount != 5 {
+				t.Errorf("want 5 lost events, got %d", report.LostCount)
+			}
+			if diff := cmp.Diff(wantRanges, report.LostRangesByPartitionKey[unknownPartitionKey]); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if diff := cmp.Diff([]string{"2", "3"}, report.LostEventsByPartitionKey[unknownPartitionKey]); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if got := report.LostEventsOmittedByPartitionKey[unknownPartitionKey]; got != 3 {
+				t.Errorf("want 3 omitted lost events, got %d", got)
+			}
+
+			d := sm.Diff()
+			want := PartitionDiff{Missing: []string{"2", "3"}, MissingRanges: wantRanges, MissingOmitted: 3}
+			if diff := cmp.Diff(want, d.Partitions[unknownPartitionKey]); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if s := d.String(); !strings.Contains(s, "missing ranges (2): [2-4 6-7]") || !strings.Contains(s, "missing (5): [2 3] and 3 more") {
+				t.Errorf("unexpected diff %s", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+
+	ceprotobuf "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/pierdipi/sacura/internal/cloudeventsv1"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+const (
+	grpcStatusHeader  = "Grpc-Status"
+	grpcMessageHeader = "Grpc-Message"
+)
+
+// isGRPCAccepted returns whether the given response headers of a successful HTTP response carry a gRPC error status.
+func isGRPCAccepted(hdr http.Header) bool {
+	s := hdr.Get(grpcStatusHeader)
+	return s == "" || s == strconv.Itoa(int(codes.OK))
+}
+
+// grpcStatusCode maps an HTTP status code to a gRPC status code, as described by the gRPC HTTP to gRPC status code
+// mapping.
+func grpcStatusCode(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
+
+// grpcTransport is an http.RoundTripper publishing the events of the requests built by the targeter with the Publish
+// method of the CloudEvents gRPC service of the target, so that events sent with gRPC are paced, measured and
+// accounted for like with HTTP.
+//
+// Request headers are sent as metadata. Failed calls respond with their status in the Grpc-Status and Grpc-Message
+// headers, like a gRPC response without messages.
+type grpcTransport struct {
+	tlsConfig *tls.Config
+
+	lock sync.Mutex
+	// conns are the connections by target host.
+	conns map[string]*grpc.ClientConn
+}
+
+func newGRPCTransport(config *Config) *grpcTransport {
+	tlsConfig := vegeta.DefaultTLSConfig
+	if config.Sender.TLS != nil && config.Sender.TLS.Parsed != nil {
+		tlsConfig = config.Sender.TLS.Parsed
+	}
+	return &grpcTransport{tlsConfig: tlsConfig, conns: make(map[string]*grpc.ClientConn)}
+}
+
+func (t *grpcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	event, err := ceprotobuf.ToProto(&e)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := t.conn(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	md := metadata.MD{}
+	for k, v := range req.Header {
+		md.Append(k, v...)
+	}
+	ctx := metadata.NewOutgoingContext(req.Context(), md)
+	_, err = cloudeventsv1.NewCloudEventServiceClient(c).Publish(ctx, &cloudeventsv1.PublishRequest{Event: event})
+
+	resp := acceptedResponse(req)
+	if err != nil {
+		s, ok := status.FromError(err)
+		if !ok {
+			return nil, err
+		}
+		resp.Header.Set(grpcStatusHeader, strconv.Itoa(int(s.Code())))
+		resp.Header.Set(grpcMessageHeader, s.Message())
+	}
+	return resp, nil
+}
+
+// conn returns the connection to the host of the given URL, TLS is used with the https scheme.
+func (t *grpcTransport) conn(u *url.URL) (*grpc.ClientConn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if c, ok := t.conns[u.Host]; ok {
+		return c, nil
+	}
+	creds, port := insecure.NewCredentials(), "80"
+	if u.Scheme == "https" {
+		creds, port = credentials.NewTLS(t.tlsConfig), "443"
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	c, err := grpc.Dial(net.JoinHostPort(u.Hostname(), port), grpc.WithTransportCredentials(creds))
+	if err != nil {
+		return nil, err
+	}
+	t.conns[u.Host] = c
+	return c, nil
+}
+
+func (t *grpcTransport) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, c := range t.conns {
+		_ = c.Close()
+	}
+}
+
+// grpcRequestKey is the context key of the HTTP request of a call served by serveGRPC.
+type grpcRequestKey struct{}
+
+// cloudEventService serves the Publish method, the handler error is mapped to the call status.
+type cloudEventService struct {
+	cloudeventsv1.UnimplementedCloudEventServiceServer
+
+	ctx context.Context
+	h   func(context.Context, *ce.Event, *http.Request) error
+}
+
+// newGRPCServer returns the server of the CloudEvents gRPC service handling events with h, calls are served with
+// serveGRPC.
+func newGRPCServer(ctx context.Context, h func(context.Context, *ce.Event, *http.Request) error) *grpc.Server {
+	s := grpc.NewServer()
+	cloudeventsv1.RegisterCloudEventServiceServer(s, &cloudEventService{ctx: ctx, h: h})
+	return s
+}
+
+// serveGRPC serves the call of the given HTTP/2 request, the request is passed to the handler with the event.
+func serveGRPC(s *grpc.Server, w http.ResponseWriter, r *http.Request) {
+	s.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), grpcRequestKey{}, r)))
+}
+
+func (s *cloudEventService) Publish(ctx context.Context, req *cloudeventsv1.PublishRequest) (*emptypb.Empty, error) {
+	if req.GetEvent() == nil {
+		return nil, status.Error(codes.InvalidArgument, "publish request without event")
+	}
+	e, err := ceprotobuf.FromProto(req.GetEvent())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := e.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	r, _ := ctx.Value(grpcRequestKey{}).(*http.Request)
+	if err := s.h(s.ctx, e, r); err != nil {
+		code := codes.Unknown
+		var sce *statusCodeError
+		if errors.As(err, &sce) {
+			code = grpcStatusCode(sce.statusCode)
+		}
+		return nil, status.Error(code, err.Error())
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// hijackedConns tracks the connections hijacked from an http.Server, like the ones served by the h2c handler, since
+// closing the server doesn't close them.
+type hijackedConns struct {
+	lock  sync.Mutex
+	conns []net.Conn
+}
+
+// connState is the http.Server ConnState hook.
+func (c *hijackedConns) connState(conn net.Conn, state http.ConnState) {
+	if state != http.StateHijacked {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.conns = append(c.conns, conn)
+}
+
+func (c *hijackedConns) close() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for _, conn := range c.conns {
+		_ = conn.Close()
+	}
+}
@@ -0,0 +1,112 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	ceprotobuf "github.com/cloudevents/sdk-go/binding/format/protobuf/v2"
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/pierdipi/sacura/internal/cloudeventsv1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestStartReceiverGRPC(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Port:     9208,
+			Protocol: ProtocolGRPC,
+			Auth:     &ReceiverAuthConfig{Token: "token"},
+		}, received, nil)
+	}()
+
+	conn, err := grpc.Dial("localhost:9208", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := cloudeventsv1.NewCloudEventServiceClient(conn)
+	e := cetest.FullEvent()
+	event, err := ceprotobuf.ToProto(&e)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Calls without a token are rejected with the UNAUTHENTICATED status.
+	var code codes.Code
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		_, err = client.Publish(context.Background(), &cloudeventsv1.PublishRequest{Event: event})
+		code = status.Code(err)
+		return code != codes.Unavailable, nil
+	})
+	if err != nil {
+		t.Fatal("failed to call receiver", err)
+	}
+	if code != codes.Unauthenticated {
+		t.Errorf("expected status %v, got %v", codes.Unauthenticated, code)
+	}
+
+	authorized := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer token")
+	if _, err := client.Publish(authorized, &cloudeventsv1.PublishRequest{}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected status %v for a request without event, got %v", codes.InvalidArgument, err)
+	}
+
+	// Events are received with all their attributes.
+	if _, err := client.Publish(authorized, &cloudeventsv1.PublishRequest{Event: event}); err != nil {
+		t.Fatal(err)
+	}
+	attributes := func(e *ce.Event) map[string]interface{} {
+		b, err := e.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := map[string]interface{}{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	r := <-received
+	if diff := cmp.Diff(attributes(&e), attributes(&r.Event)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             "http://localhost:9208",
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolGRPC,
+			Auth:               &SenderAuthConfig{Token: "token"},
+		},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
@@ -5,4 +5,10 @@ set -euo pipefail
 go mod tidy
 go mod vendor
 
+cloudevents_pb=github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb
+protoc -I . -I "vendor/${cloudevents_pb}" \
+  --go_out=. --go_opt=paths=source_relative --go_opt="Mcloudevent.proto=${cloudevents_pb}" \
+  --go-grpc_out=. --go-grpc_opt=paths=source_relative --go-grpc_opt="Mcloudevent.proto=${cloudevents_pb}" \
+  internal/cloudeventsv1/cloudevents_service.proto
+
 git apply hack/patches/*.patch
@@ -0,0 +1,248 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	// DefaultHandshakeInterval is the interval between readiness checks and probe events when none is configured.
+	DefaultHandshakeInterval = time.Second
+	// DefaultHandshakeTimeout is the maximum time the sender waits for the handshake when none is configured.
+	DefaultHandshakeTimeout = time.Minute
+)
+
+// HandshakeConfig delays the start of the sender until the receiver is ready and events are routed to it, so that
+// events sent while a trigger or a subscription is not routing yet aren't reported as lost.
+//
+// The handshake starts after sender.startDelay, the test fails when it doesn't complete within the timeout.
+type HandshakeConfig struct {
+	// ReadinessURL is polled until it responds with a 2xx status code, for example the ReadyzPath of a receiver
+	// deployed separately, http://sacura-receiver:8081/readyz.
+	ReadinessURL string `json:"readinessURL" yaml:"readinessURL"`
+	// Probe sends probe events like the events of the test to the target until the receiver receives one of them,
+	// probe events are dropped by the receiver and excluded from the verification.
+	//
+	// Probe requires the receiver to run in the same process as the sender.
+	Probe bool `json:"probe" yaml:"probe"`
+	// Interval is the interval between readiness checks and probe events, for example 500ms.
+	//
+	// Defaults to DefaultHandshakeInterval.
+	Interval string `json:"interval" yaml:"interval"`
+	// Timeout is the maximum time to wait for the handshake, for example 5m.
+	//
+	// Defaults to DefaultHandshakeTimeout.
+	Timeout string `json:"timeout" yaml:"timeout"`
+
+	ParsedInterval time.Duration
+	ParsedTimeout  time.Duration
+}
+
+func (c *HandshakeConfig) validate(receiver *ReceiverConfig) error {
+	if c.ReadinessURL == "" && !c.Probe {
+		return invalidErr("sender.handshake", errors.New("at least one of readinessURL or probe must be specified"))
+	}
+	if c.ReadinessURL != "" {
+		if u, err := url.Parse(c.ReadinessURL); err != nil || !u.IsAbs() {
+			return invalidErr("sender.handshake.readinessURL", fmt.Errorf("%q must be an absolute URL: %v", c.ReadinessURL, err))
+		}
+	}
+	if c.Probe && receiver.Disabled {
+		return invalidErr("sender.handshake.probe", errors.New("cannot be used with receiver.disabled, probe events must be received by this run"))
+	}
+
+	c.ParsedInterval = DefaultHandshakeInterval
+	if c.Interval != "" {
+		var err error
+		c.ParsedInterval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return invalidErr("sender.handshake.interval", err)
+		}
+		if c.ParsedInterval <= 0 {
+			return invalidErr("sender.handshake.interval", errors.New("must be greater than 0"))
+		}
+	}
+	c.ParsedTimeout = DefaultHandshakeTimeout
+	if c.Timeout != "" {
+		var err error
+		c.ParsedTimeout, err = time.ParseDuration(c.Timeout)
+		if err != nil {
+			return invalidErr("sender.handshake.timeout", err)
+		}
+		if c.ParsedTimeout <= 0 {
+			return invalidErr("sender.handshake.timeout", errors.New("must be greater than 0"))
+		}
+	}
+	return nil
+}
+
+// handshake tracks the probe events sent by the sender, so that the receiver recognizes and drops them.
+type handshake struct {
+	lock   sync.Mutex
+	probes sets.String
+	// routed is closed once a probe event has been received.
+	routed chan struct{}
+	once   sync.Once
+}
+
+func newHandshake() *handshake {
+	return &handshake{probes: sets.NewString(), routed: make(chan struct{})}
+}
+
+type handshakeKey struct{}
+
+func contextWithHandshake(ctx context.Context, h *handshake) context.Context {
+	return context.WithValue(ctx, handshakeKey{}, h)
+}
+
+// handshakeFromContext returns the handshake of the sender, or nil.
+func handshakeFromContext(ctx context.Context) *handshake {
+	h, _ := ctx.Value(handshakeKey{}).(*handshake)
+	return h
+}
+
+// isProbe returns true when the given received event is a probe event, and completes the handshake.
+func (h *handshake) isProbe(id string) bool {
+	if h == nil {
+		return false
+	}
+	h.lock.Lock()
+	probe := h.probes.Has(id)
+	h.lock.Unlock()
+	if probe {
+		h.once.Do(func() { close(h.routed) })
+	}
+	return probe
+}
+
+// wait waits for the receiver to be ready and, when configured, for a probe event to be received.
+func (h *handshake) wait(ctx context.Context, config Config) error {
+	handshake := config.Sender.Handshake
+	ctx, cancel := context.WithTimeout(ctx, handshake.ParsedTimeout)
+	defer cancel()
+
+	if handshake.ReadinessURL != "" {
+		logger(logComponentRun).Infow("Waiting for the receiver to be ready", "url", handshake.ReadinessURL)
+		if err := waitReady(ctx, handshake); err != nil {
+			return fmt.Errorf("receiver not ready: %w", err)
+		}
+	}
+	if handshake.Probe {
+		logger(logComponentRun).Info("Sending probe events until one is received")
+		if err := h.probe(ctx, config); err != nil {
+			return fmt.Errorf("probe events not received: %w", err)
+		}
+	}
+	logger(logComponentRun).Info("Handshake completed")
+	return nil
+}
+
+// waitReady polls the readiness URL until it responds with a 2xx status code.
+func waitReady(ctx context.Context, config *HandshakeConfig) error {
+	client := &http.Client{Timeout: config.ParsedInterval}
+	ticker := time.NewTicker(config.ParsedInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, config.ReadinessURL, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+				return nil
+			}
+			err = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		}
+		if ctx.Err() == nil {
+			// Requests interrupted by the timeout don't hide the previous error.
+			lastErr = err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w, last error: %v", ctx.Err(), lastErr)
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe sends probe events to the target until one of them is received.
+func (h *handshake) probe(ctx context.Context, config Config) error {
+	// Probe events are generated like the events of the test, without consuming the events to replay, the
+	// sequences of partition keys or the sequential IDs of the test.
+	probeConfig := config
+	probeConfig.Sender.Replay = nil
+	probeConfig.Sender.BatchSize = 1
+	probeConfig.Sender.SequentialIDs = false
+	probeConfig.Sender.IDs = nil
+	out := make(chan ce.Event, 1)
+	var nextPartitionKey func() string
+	if config.Ordered != nil {
+		nextPartitionKey = newPartitionKeyGenerator(config.Ordered, newRand(nil, "probe.partitionKeys"))
+	}
+	targeter := newTargeterGenerator(probeConfig, uuid.New, nextPartitionKey, out)
+
+	transport, closeTransport := newSenderTransport(&config)
+	defer closeTransport()
+	client := &http.Client{Transport: transport, Timeout: requestTimeout(&config)}
+
+	ticker := time.NewTicker(config.Sender.Handshake.ParsedInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		if err := h.sendProbe(ctx, client, targeter, out); err != nil && ctx.Err() == nil {
+			lastErr = err
+		}
+
+		select {
+		case <-h.routed:
+			return nil
+		case <-ctx.Done():
+			if lastErr != nil {
+				return fmt.Errorf("%w, last error: %v", ctx.Err(), lastErr)
+			}
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *handshake) sendProbe(ctx context.Context, client *http.Client, targeter vegeta.Targeter, out <-chan ce.Event) error {
+	target := vegeta.Target{}
+	if err := targeter(&target); err != nil {
+		return err
+	}
+	e := <-out
+	h.lock.Lock()
+	h.probes.Insert(e.ID())
+	h.lock.Unlock()
+
+	req, err := target.Request()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
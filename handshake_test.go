@@ -0,0 +1,112 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+func TestHandshakeWaitReadinessURL(t *testing.T) {
+	requests := atomic.NewInt32(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Inc() < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer s.Close()
+
+	config := Config{Sender: SenderConfig{Handshake: &HandshakeConfig{ReadinessURL: s.URL + ReadyzPath, Interval: "10ms"}}}
+	if err := config.Sender.Handshake.validate(&config.Receiver); err != nil {
+		t.Fatal(err)
+	}
+	if err := newHandshake().wait(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Errorf("want readiness polled until ready, got %d requests", got)
+	}
+}
+
+func TestHandshakeWaitTimeout(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer s.Close()
+
+	config := Config{Sender: SenderConfig{Handshake: &HandshakeConfig{ReadinessURL: s.URL, Interval: "10ms", Timeout: "50ms"}}}
+	if err := config.Sender.Handshake.validate(&config.Receiver); err != nil {
+		t.Fatal(err)
+	}
+	err := newHandshake().wait(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "receiver not ready") || !strings.Contains(err.Error(), "503") {
+		t.Errorf("want receiver not ready error with the last status code, got %v", err)
+	}
+}
+
+func TestHandshakeWaitProbe(t *testing.T) {
+	h := newHandshake()
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(contextWithHandshake(ctx, h), ReceiverConfig{Port: 9233}, received, nil)
+	}()
+
+	// Probe events sent before the receiver is listening fail and are retried.
+	config := Config{Sender: SenderConfig{Target: "http://localhost:9233", Handshake: &HandshakeConfig{Probe: true, Interval: "50ms", Timeout: "10s"}}}
+	if err := config.Sender.Handshake.validate(&config.Receiver); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.wait(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	for e := range received {
+		t.Errorf("want probe events dropped by the receiver, got %s", e.Event.ID())
+	}
+	if h.isProbe("not-a-probe") {
+		t.Error("want events of the test not recognized as probe events")
+	}
+}
+
+func TestHandshakeConfigValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       HandshakeConfig
+		receiver     ReceiverConfig
+		wantInterval time.Duration
+		wantTimeout  time.Duration
+		wantErr      bool
+	}{
+		{name: "probe", config: HandshakeConfig{Probe: true}, wantInterval: DefaultHandshakeInterval, wantTimeout: DefaultHandshakeTimeout},
+		{name: "readiness URL", config: HandshakeConfig{ReadinessURL: "http://receiver:8081/readyz", Interval: "100ms", Timeout: "5m"}, receiver: ReceiverConfig{Disabled: true}, wantInterval: 100 * time.Millisecond, wantTimeout: 5 * time.Minute},
+		{name: "nothing to wait for", config: HandshakeConfig{}, wantErr: true},
+		{name: "relative readiness URL", config: HandshakeConfig{ReadinessURL: "/readyz"}, wantErr: true},
+		{name: "probe without receiver", config: HandshakeConfig{Probe: true}, receiver: ReceiverConfig{Disabled: true}, wantErr: true},
+		{name: "invalid interval", config: HandshakeConfig{Probe: true, Interval: "fast"}, wantErr: true},
+		{name: "zero timeout", config: HandshakeConfig{Probe: true, Timeout: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.receiver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (tt.config.ParsedInterval != tt.wantInterval || tt.config.ParsedTimeout != tt.wantTimeout) {
+				t.Errorf("want interval %v and timeout %v, got %v and %v", tt.wantInterval, tt.wantTimeout, tt.config.ParsedInterval, tt.config.ParsedTimeout)
+			}
+		})
+	}
+}
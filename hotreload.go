@@ -0,0 +1,370 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/go-yaml/yaml"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// DefaultHotReloadInterval is the default interval at which the config file is checked for changes.
+const DefaultHotReloadInterval = time.Second
+
+// HotReloadConfig applies changes to the send rate, the receiver faults and the receiver processing delay on the fly,
+// without restarting the run, so that operators can adjust the load interactively during exploratory testing.
+//
+// Changes are read from the watched config file or accepted through the admin API:
+//
+//	GET /settings returns the current settings
+//	PUT /settings applies the settings of the body, see LiveSettings
+//
+// Only sender.frequency, receiver.fault and receiver.slowConsumer.delay are applied, other changes to the config file
+// are ignored. The applied changes are listed in the report.
+type HotReloadConfig struct {
+	// Path is the path of the config file to watch, usually the config file of the run. Command line overrides are
+	// not applied to the watched file.
+	//
+	// It is required without admin.
+	Path string `json:"path" yaml:"path"`
+	// Interval is the interval at which the config file is checked for changes.
+	//
+	// Defaults to DefaultHotReloadInterval.
+	Interval string `json:"interval" yaml:"interval"`
+
+	ParsedInterval time.Duration
+}
+
+func (c *HotReloadConfig) validate(config *Config) error {
+	if c.Path == "" && config.Admin == nil {
+		return invalidErr("hotReload.path", errors.New("is required without admin"))
+	}
+	c.ParsedInterval = DefaultHotReloadInterval
+	if c.Interval != "" {
+		var err error
+		c.ParsedInterval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return invalidErr("hotReload.interval", err)
+		}
+		if c.ParsedInterval <= 0 {
+			return invalidErr("hotReload.interval", fmt.Errorf("%v must be positive", c.ParsedInterval))
+		}
+	}
+	return nil
+}
+
+// LiveSettings are the settings changed on the fly with hotReload, unset settings are left unchanged.
+type LiveSettings struct {
+	// FrequencyPerSecond is the send rate, see SenderConfig.FrequencyPerSecond. It cannot be changed with
+	// sender.loadProfile, sender.tokenBucket or sender.replay.
+	FrequencyPerSecond *int `json:"frequency,omitempty" yaml:"frequency"`
+	// Fault replaces receiver.fault, an empty fault config disables faults.
+	Fault *ReceiverFaultConfig `json:"fault,omitempty" yaml:"fault"`
+	// Delay replaces receiver.slowConsumer.delay, a fixed delay of 0s disables the processing delay.
+	Delay *ProcessingDelayConfig `json:"delay,omitempty" yaml:"delay"`
+}
+
+// SettingsChange is a change of the live settings.
+type SettingsChange struct {
+	At time.Time `json:"at"`
+	// Source is the source of the change, file or admin.
+	Source   string       `json:"source"`
+	Settings LiveSettings `json:"settings"`
+}
+
+const (
+	settingsSourceFile  = "file"
+	settingsSourceAdmin = "admin"
+)
+
+// liveSettings holds the settings changed on the fly, it is safe for concurrent use.
+type liveSettings struct {
+	config *Config
+
+	lock      sync.RWMutex
+	frequency int
+	fault     *ReceiverFaultConfig
+	delay     *ProcessingDelayConfig
+	changes   []SettingsChange
+}
+
+// newLiveSettings returns the live settings of the given config, it returns nil without hotReload.
+func newLiveSettings(config *Config) *liveSettings {
+	if config.HotReload == nil {
+		return nil
+	}
+	s := &liveSettings{config: config, frequency: config.Sender.FrequencyPerSecond, fault: config.Receiver.ReceiverFaultConfig}
+	if config.Receiver.SlowConsumer != nil {
+		s.delay = config.Receiver.SlowConsumer.Delay
+	}
+	return s
+}
+
+// currentFrequency returns the current send rate.
+func (s *liveSettings) currentFrequency() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.frequency
+}
+
+// receiverFault returns the current receiver faults, or the configured ones without hotReload.
+func (s *liveSettings) receiverFault(configured *ReceiverFaultConfig) *ReceiverFaultConfig {
+	if s == nil {
+		return configured
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.fault
+}
+
+// processingDelay returns the current processing delay, or the configured one without hotReload.
+func (s *liveSettings) processingDelay(configured *ProcessingDelayConfig) *ProcessingDelayConfig {
+	if s == nil {
+		return configured
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.delay
+}
+
+func (s *liveSettings) current() LiveSettings {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	frequency := s.frequency
+	return LiveSettings{FrequencyPerSecond: &frequency, Fault: s.fault, Delay: s.delay}
+}
+
+// apply validates and applies the given settings, the settings are left unchanged when they are invalid.
+func (s *liveSettings) apply(settings LiveSettings, source string) error {
+	if err := s.validate(&settings); err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if settings.FrequencyPerSecond != nil {
+		s.frequency = *settings.FrequencyPerSecond
+	}
+	if settings.Fault != nil {
+		s.fault = settings.Fault
+	}
+	if settings.Delay != nil {
+		s.delay = settings.Delay
+	}
+	s.changes = append(s.changes, SettingsChange{At: time.Now(), Source: source, Settings: settings})
+	logger(LogComponentSender).Infow("Applied live settings", "source", source, "settings", settings)
+	return nil
+}
+
+func (s *liveSettings) validate(settings *LiveSettings) error {
+	if settings.FrequencyPerSecond == nil && settings.Fault == nil && settings.Delay == nil {
+		return errors.New("no settings to apply")
+	}
+	if f := settings.FrequencyPerSecond; f != nil {
+		if s.config.Sender.Disabled {
+			return invalidErr("sender.frequency", errors.New("cannot be changed when the sender is disabled"))
+		}
+		if s.config.Sender.LoadProfile != nil || s.config.Sender.TokenBucket != nil || s.config.Sender.Replay != nil {
+			return invalidErr("sender.frequency", errors.New("cannot be changed with sender.loadProfile, sender.tokenBucket or sender.replay"))
+		}
+		if *f <= 0 {
+			return invalidErr("sender.frequency", fmt.Errorf("%d must be positive", *f))
+		}
+	}
+	if (settings.Fault != nil || settings.Delay != nil) && s.config.Receiver.Disabled {
+		return invalidErr("receiver", errors.New("cannot be changed when the receiver is disabled"))
+	}
+	if settings.Fault != nil {
+		if err := settings.Fault.validate(); err != nil {
+			return err
+		}
+	}
+	if settings.Delay != nil {
+		if err := (&SlowConsumerConfig{Delay: settings.Delay}).validate(s.config.Receiver.Protocol); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settingsChanges returns the applied changes.
+func (s *liveSettings) settingsChanges() []SettingsChange {
+	if s == nil {
+		return nil
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return append([]SettingsChange(nil), s.changes...)
+}
+
+// fileSettings are the live settings of the config file.
+type fileSettings struct {
+	Sender struct {
+		FrequencyPerSecond *int `yaml:"frequency"`
+	} `yaml:"sender"`
+	Receiver struct {
+		Fault        *ReceiverFaultConfig `yaml:"fault"`
+		SlowConsumer *struct {
+			Delay *ProcessingDelayConfig `yaml:"delay"`
+		} `yaml:"slowConsumer"`
+	} `yaml:"receiver"`
+}
+
+func readFileSettings(path string) (fileSettings, error) {
+	var settings fileSettings
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return settings, err
+	}
+	if err := yaml.Unmarshal(b, &settings); err != nil {
+		return settings, fmt.Errorf("failed to unmarshal %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// diff returns the settings of the file changed since the given previous settings.
+func (f fileSettings) diff(previous fileSettings) LiveSettings {
+	var settings LiveSettings
+	if f.Sender.FrequencyPerSecond != nil && !reflect.DeepEqual(f.Sender.FrequencyPerSecond, previous.Sender.FrequencyPerSecond) {
+		frequency := *f.Sender.FrequencyPerSecond
+		settings.FrequencyPerSecond = &frequency
+	}
+	if !reflect.DeepEqual(f.Receiver.Fault, previous.Receiver.Fault) {
+		// Removing the faults from the file disables them.
+		fault := ReceiverFaultConfig{}
+		if f.Receiver.Fault != nil {
+			fault = *f.Receiver.Fault
+		}
+		settings.Fault = &fault
+	}
+	var delay, previousDelay *ProcessingDelayConfig
+	if f.Receiver.SlowConsumer != nil {
+		delay = f.Receiver.SlowConsumer.Delay
+	}
+	if previous.Receiver.SlowConsumer != nil {
+		previousDelay = previous.Receiver.SlowConsumer.Delay
+	}
+	if !reflect.DeepEqual(delay, previousDelay) {
+		// Removing the delay from the file disables it.
+		d := ProcessingDelayConfig{Distribution: DelayDistributionFixed, Duration: "0s"}
+		if delay != nil {
+			d = *delay
+		}
+		settings.Delay = &d
+	}
+	return settings
+}
+
+// startHotReload watches the config file of hotReload.path and applies the changes of the live settings, the returned
+// function stops watching it.
+func (s *liveSettings) startHotReload() func() {
+	if s == nil || s.config.HotReload.Path == "" {
+		return func() {}
+	}
+	path := s.config.HotReload.Path
+
+	previous, err := readFileSettings(path)
+	if err != nil {
+		logger(LogComponentSender).Warnw("Failed to read hot reload config file", "path", path, "error", err)
+	}
+	var modTime time.Time
+	if info, err := os.Stat(path); err == nil {
+		modTime = info.ModTime()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(s.config.HotReload.ParsedInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(path)
+			if err != nil || info.ModTime().Equal(modTime) {
+				continue
+			}
+			modTime = info.ModTime()
+			next, err := readFileSettings(path)
+			if err != nil {
+				logger(LogComponentSender).Warnw("Failed to read hot reload config file", "path", path, "error", err)
+				continue
+			}
+			settings := next.diff(previous)
+			previous = next
+			if settings.FrequencyPerSecond == nil && settings.Fault == nil && settings.Delay == nil {
+				continue
+			}
+			if err := s.apply(settings, settingsSourceFile); err != nil {
+				logger(LogComponentSender).Warnw("Failed to apply hot reload config file", "path", path, "error", err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+type liveSettingsKey struct{}
+
+func contextWithLiveSettings(ctx context.Context, s *liveSettings) context.Context {
+	return context.WithValue(ctx, liveSettingsKey{}, s)
+}
+
+// liveSettingsFromContext returns the live settings carried by the given context, or nil.
+func liveSettingsFromContext(ctx context.Context) *liveSettings {
+	s, _ := ctx.Value(liveSettingsKey{}).(*liveSettings)
+	return s
+}
+
+// livePacer paces requests at the live send rate, scaled down for senders sending a share of the rate.
+//
+// It is not safe for concurrent use, vegeta calls Pace from a single goroutine.
+type livePacer struct {
+	settings *liveSettings
+	scale    float64
+
+	// rate is the rate of requests per second since the elapsed time since, when hits requests had been sent.
+	rate  float64
+	since time.Duration
+	hits  uint64
+}
+
+var _ vegeta.Pacer = &livePacer{}
+
+// Pace implements vegeta.Pacer.
+func (p *livePacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	if rate := p.Rate(elapsed); rate != p.rate {
+		p.rate, p.since, p.hits = rate, elapsed, hits
+	}
+	if p.rate <= 0 {
+		// The share of the rate rounds down to no request, wait for the rate to change.
+		return time.Second, false
+	}
+	sent := float64(hits - p.hits)
+	if expected := float64(elapsed-p.since) * p.rate / float64(time.Second); sent < expected {
+		return 0, false
+	}
+	next := p.since + time.Duration((sent+1)*float64(time.Second)/p.rate)
+	return next - elapsed, false
+}
+
+// Rate implements vegeta.Pacer.
+func (p *livePacer) Rate(time.Duration) float64 {
+	return float64(p.settings.currentFrequency()) * p.scale
+}
@@ -0,0 +1,278 @@
+package sacura
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestHotReloadConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "path", config: Config{HotReload: &HotReloadConfig{Path: "config.yaml"}}, want: DefaultHotReloadInterval},
+		{name: "admin", config: Config{Admin: &AdminConfig{Port: 8081}, HotReload: &HotReloadConfig{Interval: "5s"}}, want: 5 * time.Second},
+		{name: "no path without admin", config: Config{HotReload: &HotReloadConfig{}}, wantErr: true},
+		{name: "invalid interval", config: Config{HotReload: &HotReloadConfig{Path: "config.yaml", Interval: "often"}}, wantErr: true},
+		{name: "negative interval", config: Config{HotReload: &HotReloadConfig{Path: "config.yaml", Interval: "-1s"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.HotReload.validate(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.HotReload.ParsedInterval != tt.want {
+				t.Errorf("want interval %v, got %v", tt.want, tt.config.HotReload.ParsedInterval)
+			}
+		})
+	}
+}
+
+func TestLiveSettingsApply(t *testing.T) {
+	frequency := func(f int) *int { return &f }
+	tests := []struct {
+		name     string
+		config   Config
+		settings LiveSettings
+		wantErr  bool
+	}{
+		{name: "frequency", settings: LiveSettings{FrequencyPerSecond: frequency(50)}},
+		{name: "fault", settings: LiveSettings{Fault: &ReceiverFaultConfig{Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusServiceUnavailable, Percentage: 10}}}}},
+		{name: "delay", settings: LiveSettings{Delay: &ProcessingDelayConfig{Duration: "10ms"}}},
+		{name: "empty", settings: LiveSettings{}, wantErr: true},
+		{name: "zero frequency", settings: LiveSettings{FrequencyPerSecond: frequency(0)}, wantErr: true},
+		{name: "frequency with load profile", config: Config{Sender: SenderConfig{LoadProfile: &LoadProfileConfig{}}}, settings: LiveSettings{FrequencyPerSecond: frequency(50)}, wantErr: true},
+		{name: "frequency with disabled sender", config: Config{Sender: SenderConfig{Disabled: true}}, settings: LiveSettings{FrequencyPerSecond: frequency(50)}, wantErr: true},
+		{name: "fault with disabled receiver", config: Config{Receiver: ReceiverConfig{Disabled: true}}, settings: LiveSettings{Fault: &ReceiverFaultConfig{}}, wantErr: true},
+		{name: "invalid fault", settings: LiveSettings{Fault: &ReceiverFaultConfig{Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusOK, Percentage: 10}}}}, wantErr: true},
+		{name: "invalid delay", settings: LiveSettings{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionUniform}}, wantErr: true},
+		{name: "delay with kafka", config: Config{Receiver: ReceiverConfig{Protocol: ProtocolKafka}}, settings: LiveSettings{Delay: &ProcessingDelayConfig{Duration: "10ms"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Sender.FrequencyPerSecond = 10
+			tt.config.HotReload = &HotReloadConfig{}
+			s := newLiveSettings(&tt.config)
+			err := s.apply(tt.settings, settingsSourceAdmin)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			changes := s.settingsChanges()
+			if tt.wantErr {
+				if len(changes) != 0 || s.currentFrequency() != 10 {
+					t.Errorf("want settings unchanged, got %+v", changes)
+				}
+				return
+			}
+			if len(changes) != 1 || changes[0].Source != settingsSourceAdmin {
+				t.Errorf("want 1 change from the admin API, got %+v", changes)
+			}
+			if tt.settings.FrequencyPerSecond != nil && s.currentFrequency() != *tt.settings.FrequencyPerSecond {
+				t.Errorf("want frequency %d, got %d", *tt.settings.FrequencyPerSecond, s.currentFrequency())
+			}
+			if tt.settings.Fault != nil && s.receiverFault(nil) != tt.settings.Fault {
+				t.Errorf("want fault %+v, got %+v", tt.settings.Fault, s.receiverFault(nil))
+			}
+			if tt.settings.Delay != nil && s.processingDelay(nil) != tt.settings.Delay {
+				t.Errorf("want delay %+v, got %+v", tt.settings.Delay, s.processingDelay(nil))
+			}
+		})
+	}
+}
+
+func TestLiveSettingsDisabled(t *testing.T) {
+	var s *liveSettings
+	fault := &ReceiverFaultConfig{}
+	delay := &ProcessingDelayConfig{}
+	if got := s.receiverFault(fault); got != fault {
+		t.Errorf("want the configured fault, got %+v", got)
+	}
+	if got := s.processingDelay(delay); got != delay {
+		t.Errorf("want the configured delay, got %+v", got)
+	}
+	if got := s.settingsChanges(); got != nil {
+		t.Errorf("want no change, got %+v", got)
+	}
+}
+
+func TestLivePacer(t *testing.T) {
+	config := Config{Sender: SenderConfig{FrequencyPerSecond: 10}, HotReload: &HotReloadConfig{}}
+	s := newLiveSettings(&config)
+	p := &livePacer{settings: s, scale: 0.5}
+
+	// Like vegeta.Rate, the first request is sent after an interval.
+	if wait, stop := p.Pace(0, 0); wait != 200*time.Millisecond || stop {
+		t.Fatalf("want 200ms between requests at 5 requests per second, got %v %v", wait, stop)
+	}
+	if wait, _ := p.Pace(200*time.Millisecond, 0); wait != 0 {
+		t.Fatalf("want a due request sent immediately, got %v", wait)
+	}
+	if wait, _ := p.Pace(200*time.Millisecond, 1); wait != 200*time.Millisecond {
+		t.Fatalf("want 200ms between requests at 5 requests per second, got %v", wait)
+	}
+	if rate := p.Rate(time.Second); rate != 5 {
+		t.Fatalf("want rate 5, got %v", rate)
+	}
+
+	frequency := 100
+	if err := s.apply(LiveSettings{FrequencyPerSecond: &frequency}, settingsSourceAdmin); err != nil {
+		t.Fatal(err)
+	}
+	// The rate changes at the time of the change, past requests don't make up for the new rate.
+	if wait, _ := p.Pace(time.Second, 5); wait != 20*time.Millisecond {
+		t.Fatalf("want 20ms between requests at 50 requests per second, got %v", wait)
+	}
+	if wait, _ := p.Pace(time.Second+30*time.Millisecond, 5); wait != 0 {
+		t.Fatalf("want a late request sent immediately, got %v", wait)
+	}
+}
+
+func TestFileSettingsDiff(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	read := func(content string) fileSettings {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		s, err := readFileSettings(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	initial := read(`
+sender:
+  frequency: 10
+  target: http://localhost:8080
+receiver:
+  slowConsumer:
+    delay:
+      duration: 10ms
+`)
+	if diff := initial.diff(initial); diff.FrequencyPerSecond != nil || diff.Fault != nil || diff.Delay != nil {
+		t.Errorf("want no change, got %+v", diff)
+	}
+
+	changed := read(`
+sender:
+  frequency: 20
+  target: http://localhost:9090
+receiver:
+  fault:
+    responses:
+    - statusCode: 503
+      percentage: 10
+`)
+	frequency := 20
+	want := LiveSettings{
+		FrequencyPerSecond: &frequency,
+		Fault:              &ReceiverFaultConfig{Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusServiceUnavailable, Percentage: 10}}},
+		Delay:              &ProcessingDelayConfig{Distribution: DelayDistributionFixed, Duration: "0s"},
+	}
+	if diff := cmp.Diff(want, changed.diff(initial)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStartHotReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("sender:\n  frequency: 10\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{Sender: SenderConfig{FrequencyPerSecond: 10}, HotReload: &HotReloadConfig{Path: path, ParsedInterval: 10 * time.Millisecond}}
+	s := newLiveSettings(&config)
+	stop := s.startHotReload()
+	defer stop()
+
+	// The modification time must change for the file to be reloaded.
+	time.Sleep(20 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("sender:\n  frequency: 42\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for s.currentFrequency() != 42 {
+		if time.Now().After(deadline) {
+			t.Fatalf("want frequency 42, got %d", s.currentFrequency())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop()
+	changes := s.settingsChanges()
+	if len(changes) != 1 || changes[0].Source != settingsSourceFile {
+		t.Errorf("want 1 change from the file, got %+v", changes)
+	}
+}
+
+func TestAdminServerSettings(t *testing.T) {
+	config := Config{Sender: SenderConfig{FrequencyPerSecond: 10}, HotReload: &HotReloadConfig{}}
+	settings := newLiveSettings(&config)
+	server := httptest.NewServer(&adminServer{control: newSenderControl(false), settings: settings, start: time.Now()})
+	defer server.Close()
+
+	tests := []struct {
+		method        string
+		body          string
+		wantStatus    int
+		wantFrequency int
+	}{
+		{method: http.MethodGet, wantStatus: http.StatusOK, wantFrequency: 10},
+		{method: http.MethodPut, body: `{"frequency": 25}`, wantStatus: http.StatusOK, wantFrequency: 25},
+		{method: http.MethodPut, body: `{"frequency": -1}`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPut, body: `{`, wantStatus: http.StatusBadRequest},
+		{method: http.MethodPost, body: `{"frequency": 25}`, wantStatus: http.StatusMethodNotAllowed},
+		{method: http.MethodGet, wantStatus: http.StatusOK, wantFrequency: 25},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest(tt.method, server.URL+"/settings", strings.NewReader(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.wantStatus {
+			t.Fatalf("%s %s: want status %d, got %d", tt.method, tt.body, tt.wantStatus, resp.StatusCode)
+		}
+		if tt.wantFrequency != 0 {
+			var got LiveSettings
+			if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+			if got.FrequencyPerSecond == nil || *got.FrequencyPerSecond != tt.wantFrequency {
+				t.Errorf("%s %s: want frequency %d, got %v", tt.method, tt.body, tt.wantFrequency, got.FrequencyPerSecond)
+			}
+		}
+		_ = resp.Body.Close()
+	}
+
+	disabled := httptest.NewServer(&adminServer{control: newSenderControl(false), start: time.Now()})
+	defer disabled.Close()
+	resp, err := http.Get(disabled.URL + "/settings")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("want status %d without hotReload, got %d", http.StatusNotFound, resp.StatusCode)
+	}
+}
@@ -0,0 +1,93 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultIdempotencyKeyHeader is the default header carrying the idempotency key of sent events.
+const DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotencyKeyConfig sends each event with an idempotency key derived from its ID, the same for every attempt of
+// the request, to verify that the target ingests retried requests idempotently: events sent more than once with
+// sender.retry are expected to be received exactly once.
+type IdempotencyKeyConfig struct {
+	// Header is the header carrying the idempotency key.
+	//
+	// Defaults to DefaultIdempotencyKeyHeader.
+	Header string `json:"header" yaml:"header"`
+	// Prefix is prepended to the ID of events, for example to scope keys to a run when event IDs are sequential.
+	Prefix string `json:"prefix" yaml:"prefix"`
+}
+
+func (c *IdempotencyKeyConfig) validate(sender *SenderConfig) error {
+	if sender.Protocol != "" && sender.Protocol != ProtocolHTTP {
+		return invalidErr("sender.idempotencyKey", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if sender.BatchSize > 1 {
+		return invalidErr("sender.idempotencyKey", errors.New("cannot be used with batches, a key identifies a single event"))
+	}
+	if c.Header == "" {
+		c.Header = DefaultIdempotencyKeyHeader
+	}
+	if http.CanonicalHeaderKey(c.Header) == CloudEventIdHeader {
+		return invalidErr("sender.idempotencyKey.header", fmt.Errorf("%q is reserved", c.Header))
+	}
+	return nil
+}
+
+// setHeader sets the idempotency key header of the request sending the given event.
+func (c *IdempotencyKeyConfig) setHeader(hdr http.Header, e *ce.Event) {
+	if c == nil {
+		return
+	}
+	hdr.Set(c.Header, c.Prefix+e.ID())
+}
+
+// IdempotencyReport reports whether the target deduplicated retried requests carrying the same idempotency key.
+type IdempotencyReport struct {
+	// Header is the header carrying the idempotency key.
+	Header string `json:"header"`
+	// RetriedCount is the number of events sent more than once.
+	RetriedCount int `json:"retriedCount"`
+	// DuplicateCount is the number of events sent more than once and received more than once, DuplicateEvents are
+	// their IDs. They are expected to be zero with idempotent ingestion.
+	DuplicateCount  int      `json:"duplicateCount"`
+	DuplicateEvents []string `json:"duplicateEvents,omitempty"`
+}
+
+// idempotencyReport sets the idempotency section of the report, it must be called while holding the lock and after
+// duplicates have been reported.
+func (s *StateManager) idempotencyReport(r *Report) {
+	if s.config.Sender.IdempotencyKey == nil {
+		return
+	}
+	duplicates := sets.NewString()
+	for _, ids := range r.DuplicateEventsByPartitionKey {
+		duplicates.Insert(ids...)
+	}
+	report := &IdempotencyReport{Header: s.config.Sender.IdempotencyKey.Header, RetriedCount: len(s.metrics.SendAttempts)}
+	for id := range s.metrics.SendAttempts {
+		if duplicates.Has(id) {
+			report.DuplicateEvents = append(report.DuplicateEvents, id)
+		}
+	}
+	sort.Strings(report.DuplicateEvents)
+	report.DuplicateCount = len(report.DuplicateEvents)
+	r.Idempotency = report
+}
+
+func verifyIdempotency(report Report) error {
+	if report.Idempotency == nil || report.Idempotency.DuplicateCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d retried events with the same %s header received more than once",
+		report.Idempotency.DuplicateCount,
+		report.Idempotency.Header,
+	)
+}
@@ -0,0 +1,98 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestIdempotencyKeyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  IdempotencyKeyConfig
+		sender  SenderConfig
+		want    IdempotencyKeyConfig
+		wantErr bool
+	}{
+		{name: "defaults", want: IdempotencyKeyConfig{Header: DefaultIdempotencyKeyHeader}},
+		{name: "custom", config: IdempotencyKeyConfig{Header: "X-Dedup-Key", Prefix: "run-1/"}, want: IdempotencyKeyConfig{Header: "X-Dedup-Key", Prefix: "run-1/"}},
+		{name: "kafka", sender: SenderConfig{Protocol: ProtocolKafka}, wantErr: true},
+		{name: "batches", sender: SenderConfig{BatchSize: 10}, wantErr: true},
+		{name: "reserved header", config: IdempotencyKeyConfig{Header: "cloudevent-id"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorIdempotencyKey(t *testing.T) {
+	config := Config{Sender: SenderConfig{Target: "http://localhost", IdempotencyKey: &IdempotencyKeyConfig{Prefix: "run-1/"}}}
+	if err := config.Sender.IdempotencyKey.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	target := &vegeta.Target{}
+	if err := f(target); err != nil {
+		t.Fatal(err)
+	}
+	e := <-out
+	if got := target.Header.Get(DefaultIdempotencyKeyHeader); got != "run-1/"+e.ID() {
+		t.Errorf("want idempotency key run-1/%s, got %q", e.ID(), got)
+	}
+}
+
+func TestStateManagerIdempotency(t *testing.T) {
+	config := Config{Sender: SenderConfig{IdempotencyKey: &IdempotencyKeyConfig{Header: DefaultIdempotencyKeyHeader}}}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	var sent []ce.Event
+	for _, id := range []string{"1", "2", "3", "4"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, now)
+		sent = append(sent, e)
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+		sm.recordReceived(&ReceivedEvent{Event: sent[i], ReceivedAt: now})
+	}
+	// Retried and duplicated.
+	sm.recordReceived(&ReceivedEvent{Event: sent[1], ReceivedAt: now})
+	// Duplicated but not retried.
+	sm.recordReceived(&ReceivedEvent{Event: sent[3], ReceivedAt: now})
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 4, SendAttempts: map[string]int{"1": 2, "2": 3}})
+
+	report := sm.GenerateReport()
+	want := &IdempotencyReport{Header: DefaultIdempotencyKeyHeader, RetriedCount: 2, DuplicateCount: 1, DuplicateEvents: []string{"2"}}
+	if diff := cmp.Diff(want, report.Idempotency); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if err := verifyIdempotency(report); err == nil {
+		t.Error("want error for duplicated retried events")
+	}
+	if err := verifyIdempotency(Report{Idempotency: &IdempotencyReport{RetriedCount: 2}}); err != nil {
+		t.Errorf("want nil, got %v", err)
+	}
+}
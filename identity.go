@@ -0,0 +1,270 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// IdentityExtension is the extension carrying the name of the identity events have been sent with by
+// sender.identityRotation.
+const IdentityExtension = "sacuraidentity"
+
+// IdentityRotationConfig rotates the identity requests are sent with on a schedule, so that the authorization
+// policies of the system under test and its handling of token refreshes are verified. Each event carries the name of
+// its identity in the IdentityExtension and the report breaks down the delivery results by identity.
+//
+// Identities are bearer tokens, the client certificate of sender.tls is used for all identities.
+type IdentityRotationConfig struct {
+	// Identities are the identities, in rotation order.
+	Identities []SenderIdentityConfig `json:"identities" yaml:"identities"`
+	// Interval is the time requests are sent with an identity before rotating to the next one, for example 30s.
+	Interval string `json:"interval" yaml:"interval"`
+
+	ParsedInterval time.Duration
+}
+
+// SenderIdentityConfig is an identity of sender.identityRotation.
+type SenderIdentityConfig struct {
+	// Name identifies the identity in the report, it must be unique.
+	Name string `json:"name" yaml:"name"`
+	// Auth is the token of the identity.
+	Auth *SenderAuthConfig `json:"auth" yaml:"auth"`
+	// Denied marks identities the system under test must reject, their requests are expected to fail with 401 or 403
+	// and events accepted with them fail the verification. Requests of the other identities failing with 401 or 403
+	// fail the verification.
+	Denied bool `json:"denied" yaml:"denied"`
+}
+
+func (c *IdentityRotationConfig) validate(sender *SenderConfig) error {
+	if sender.Auth != nil {
+		return invalidErr("sender.identityRotation", errors.New("cannot be used with sender.auth"))
+	}
+	if sender.Protocol != "" && sender.Protocol != ProtocolHTTP && sender.Protocol != ProtocolGRPC {
+		return invalidErr("sender.identityRotation", fmt.Errorf("is only supported with the %s and %s protocols", ProtocolHTTP, ProtocolGRPC))
+	}
+	if len(c.Identities) < 2 {
+		return invalidErr("sender.identityRotation.identities", errors.New("at least 2 identities must be specified"))
+	}
+	names := make(map[string]struct{}, len(c.Identities))
+	for i := range c.Identities {
+		identity := &c.Identities[i]
+		field := fmt.Sprintf("sender.identityRotation.identities[%d]", i)
+		if identity.Name == "" {
+			return invalidErr(field+".name", errors.New("cannot be empty"))
+		}
+		if _, ok := names[identity.Name]; ok {
+			return invalidErr(field+".name", fmt.Errorf("duplicate name %q", identity.Name))
+		}
+		names[identity.Name] = struct{}{}
+		if identity.Auth == nil {
+			return invalidErr(field+".auth", errors.New("cannot be empty"))
+		}
+		if err := identity.Auth.validate(field + ".auth"); err != nil {
+			return err
+		}
+	}
+	if c.Interval == "" {
+		return invalidErr("sender.identityRotation.interval", errors.New("cannot be empty"))
+	}
+	var err error
+	c.ParsedInterval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return invalidErr("sender.identityRotation.interval", err)
+	}
+	if c.ParsedInterval <= 0 {
+		return invalidErr("sender.identityRotation.interval", fmt.Errorf("%v must be positive", c.ParsedInterval))
+	}
+	return nil
+}
+
+// identityRotation returns the identity of requests, it is safe for concurrent use.
+type identityRotation struct {
+	config *IdentityRotationConfig
+	start  time.Time
+	// tokens are the token sources of the identities, a token source is nil when the identity has no auth.
+	tokens []tokenSource
+}
+
+func newIdentityRotation(config *IdentityRotationConfig, start time.Time) *identityRotation {
+	r := &identityRotation{config: config, start: start, tokens: make([]tokenSource, len(config.Identities))}
+	for i, identity := range config.Identities {
+		if identity.Auth != nil {
+			r.tokens[i] = newTokenSource(identity.Auth)
+		}
+	}
+	return r
+}
+
+// identity returns the name and the token source of the identity of requests sent at the given time.
+func (r *identityRotation) identity(now time.Time) (string, tokenSource) {
+	i := 0
+	if elapsed := now.Sub(r.start); elapsed > 0 {
+		i = int(elapsed/r.config.ParsedInterval) % len(r.config.Identities)
+	}
+	return r.config.Identities[i].Name, r.tokens[i]
+}
+
+// eventIdentity returns the identity the given event has been sent with.
+func eventIdentity(e *ce.Event) (string, bool) {
+	v, ok := e.Extensions()[IdentityExtension]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// IdentityReport reports the delivery results of the events sent with an identity.
+type IdentityReport struct {
+	// Denied is true when the identity is expected to be rejected, see SenderIdentityConfig.Denied.
+	Denied bool `json:"denied,omitempty"`
+	// SentCount is the number of events accepted by the target.
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// LostCount is the number of events sent with the identity and never received, excluding events the sender
+	// failed to send and dead-lettered events.
+	LostCount int `json:"lostCount"`
+	// RejectedCount is the number of events the sender failed to send because the target rejected the identity with
+	// 401 or 403.
+	RejectedCount int `json:"rejectedCount"`
+	// FailedSendCount is the number of events the sender failed to send for other reasons.
+	FailedSendCount int `json:"failedSendCount"`
+	// Latency is the end-to-end latency of the events sent with the identity.
+	Latency LatencyStats `json:"latency"`
+}
+
+// identityState tracks the events sent with an identity.
+type identityState struct {
+	denied   bool
+	sent     int
+	received int
+	latency  *latencyHistogram
+}
+
+// identitiesState tracks the events sent with each identity.
+type identitiesState struct {
+	identities map[string]*identityState
+	// pending are the identities of sent events not received yet by ID.
+	pending map[string]string
+}
+
+// newIdentitiesState returns the state of the given identity rotation, it returns nil without
+// sender.identityRotation.
+func newIdentitiesState(config *IdentityRotationConfig) *identitiesState {
+	if config == nil {
+		return nil
+	}
+	identities := make(map[string]*identityState, len(config.Identities))
+	for _, identity := range config.Identities {
+		identities[identity.Name] = &identityState{denied: identity.Denied, latency: newLatencyHistogram()}
+	}
+	return &identitiesState{identities: identities, pending: make(map[string]string)}
+}
+
+// recordSentIdentity records the identity of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentIdentity(e *ce.Event) {
+	if s.identities == nil {
+		return
+	}
+	identity, ok := eventIdentity(e)
+	if !ok {
+		return
+	}
+	is, ok := s.identities.identities[identity]
+	if !ok {
+		return
+	}
+	is.sent++
+	if receivedAt, ok := s.receivedAt[e.ID()]; ok {
+		// Received before being recorded as sent.
+		is.received++
+		if sentAt, ok := sentTimestamp(e); ok {
+			is.latency.record(receivedAt.Sub(sentAt))
+		}
+		return
+	}
+	s.identities.pending[e.ID()] = identity
+}
+
+// recordReceivedIdentity records the delivery of the given event to the receiver, it must be called while holding
+// the lock. Only the first delivery is recorded, according to the identity recorded by the sender since brokers can
+// drop extensions.
+func (s *StateManager) recordReceivedIdentity(e *ReceivedEvent) {
+	if s.identities == nil {
+		return
+	}
+	identity, ok := s.identities.pending[e.Event.ID()]
+	if !ok {
+		return
+	}
+	delete(s.identities.pending, e.Event.ID())
+	if e.DeadLettered {
+		return
+	}
+	is := s.identities.identities[identity]
+	is.received++
+	if sentAt, ok := sentTimestamp(&e.Event); ok && !e.ReceivedAt.IsZero() {
+		is.latency.record(e.ReceivedAt.Sub(sentAt))
+	}
+}
+
+// identitiesReport sets the identities section of the report, it must be called while holding the lock.
+func (s *StateManager) identitiesReport(r *Report) {
+	if s.identities == nil {
+		return
+	}
+	lost := make(map[string]int, len(s.identities.identities))
+	for id, identity := range s.identities.pending {
+		if _, ok := s.failedSends[id]; !ok {
+			lost[identity]++
+		}
+	}
+	rejected := make(map[string]int, len(s.identities.identities))
+	failed := make(map[string]int, len(s.identities.identities))
+	for _, f := range s.failedSends {
+		if f.Identity == "" {
+			continue
+		}
+		if f.StatusCode == http.StatusUnauthorized || f.StatusCode == http.StatusForbidden {
+			rejected[f.Identity]++
+		} else {
+			failed[f.Identity]++
+		}
+	}
+	r.Identities = make(map[string]IdentityReport, len(s.identities.identities))
+	for identity, is := range s.identities.identities {
+		r.Identities[identity] = IdentityReport{
+			Denied:          is.denied,
+			SentCount:       is.sent,
+			ReceivedCount:   is.received,
+			LostCount:       lost[identity],
+			RejectedCount:   rejected[identity],
+			FailedSendCount: failed[identity],
+			Latency:         is.latency.stats(),
+		}
+	}
+}
+
+// verifyIdentities verifies that the events of denied identities have been rejected and that the events of the
+// other identities haven't.
+func verifyIdentities(report Report) error {
+	var failed []string
+	for identity, r := range report.Identities {
+		if r.Denied && r.SentCount > 0 {
+			failed = append(failed, fmt.Sprintf("%s: %d events accepted with a denied identity", identity, r.SentCount))
+		}
+		if !r.Denied && r.RejectedCount > 0 {
+			failed = append(failed, fmt.Sprintf("%s: %d events rejected with 401 or 403", identity, r.RejectedCount))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("identities failed:\n%s", strings.Join(failed, "\n"))
+}
@@ -0,0 +1,188 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestIdentityRotationConfigValidate(t *testing.T) {
+	identities := []SenderIdentityConfig{
+		{Name: "allowed", Auth: &SenderAuthConfig{Token: "a"}},
+		{Name: "denied", Auth: &SenderAuthConfig{Token: "b"}, Denied: true},
+	}
+	tests := []struct {
+		name    string
+		config  IdentityRotationConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "valid", config: IdentityRotationConfig{Identities: identities, Interval: "10s"}},
+		{name: "grpc", config: IdentityRotationConfig{Identities: identities, Interval: "10s"}, sender: SenderConfig{Protocol: ProtocolGRPC}},
+		{name: "with auth", config: IdentityRotationConfig{Identities: identities, Interval: "10s"}, sender: SenderConfig{Auth: &SenderAuthConfig{Token: "a"}}, wantErr: true},
+		{name: "unsupported protocol", config: IdentityRotationConfig{Identities: identities, Interval: "10s"}, sender: SenderConfig{Protocol: ProtocolKafka}, wantErr: true},
+		{name: "single identity", config: IdentityRotationConfig{Identities: identities[:1], Interval: "10s"}, wantErr: true},
+		{name: "empty name", config: IdentityRotationConfig{Identities: []SenderIdentityConfig{identities[0], {Auth: &SenderAuthConfig{Token: "b"}}}, Interval: "10s"}, wantErr: true},
+		{name: "duplicate name", config: IdentityRotationConfig{Identities: []SenderIdentityConfig{identities[0], identities[0]}, Interval: "10s"}, wantErr: true},
+		{name: "without auth", config: IdentityRotationConfig{Identities: []SenderIdentityConfig{identities[0], {Name: "b"}}, Interval: "10s"}, wantErr: true},
+		{name: "invalid auth", config: IdentityRotationConfig{Identities: []SenderIdentityConfig{identities[0], {Name: "b", Auth: &SenderAuthConfig{}}}, Interval: "10s"}, wantErr: true},
+		{name: "empty interval", config: IdentityRotationConfig{Identities: identities}, wantErr: true},
+		{name: "invalid interval", config: IdentityRotationConfig{Identities: identities, Interval: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedInterval != 10*time.Second {
+				t.Errorf("want interval 10s, got %v", tt.config.ParsedInterval)
+			}
+		})
+	}
+}
+
+func TestIdentityRotation(t *testing.T) {
+	config := &IdentityRotationConfig{
+		Identities: []SenderIdentityConfig{
+			{Name: "a", Auth: &SenderAuthConfig{Token: "token-a"}},
+			{Name: "b", Auth: &SenderAuthConfig{Token: "token-b"}},
+			{Name: "c", Auth: &SenderAuthConfig{Token: "token-c"}},
+		},
+		ParsedInterval: time.Minute,
+	}
+	start := time.Now()
+	r := newIdentityRotation(config, start)
+
+	for _, tt := range []struct {
+		elapsed time.Duration
+		want    string
+	}{
+		{0, "a"},
+		{59 * time.Second, "a"},
+		{time.Minute, "b"},
+		{2*time.Minute + time.Second, "c"},
+		{3 * time.Minute, "a"},
+	} {
+		name, tokens := r.identity(start.Add(tt.elapsed))
+		if name != tt.want {
+			t.Errorf("%v: want identity %s, got %s", tt.elapsed, tt.want, name)
+		}
+		if token, err := tokens.token(); err != nil || token != "token-"+tt.want {
+			t.Errorf("%v: want token token-%s, got %s (%v)", tt.elapsed, tt.want, token, err)
+		}
+	}
+}
+
+func TestNewTargeterGeneratorIdentityRotation(t *testing.T) {
+	config := Config{Sender: SenderConfig{Target: "http://a", IdentityRotation: &IdentityRotationConfig{
+		Identities: []SenderIdentityConfig{
+			{Name: "a", Auth: &SenderAuthConfig{Token: "token-a"}},
+			{Name: "b", Auth: &SenderAuthConfig{Token: "token-b"}},
+		},
+		Interval: "1h",
+	}}}
+	if err := config.Sender.IdentityRotation.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	target := &vegeta.Target{}
+	if err := f(target); err != nil {
+		t.Fatal(err)
+	}
+	e := <-out
+	if got := e.Extensions()[IdentityExtension]; got != "a" {
+		t.Errorf("want identity a, got %v", got)
+	}
+	if got := target.Header.Get("Authorization"); got != "Bearer token-a" {
+		t.Errorf("want the token of identity a, got %q", got)
+	}
+}
+
+func TestStateManagerIdentities(t *testing.T) {
+	config := Config{Sender: SenderConfig{IdentityRotation: &IdentityRotationConfig{
+		Identities: []SenderIdentityConfig{{Name: "allowed"}, {Name: "denied", Denied: true}},
+	}}}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	event := func(id, identity string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(IdentityExtension, identity)
+		setSentTimestamp(&e, now)
+		return e
+	}
+	sent := []ce.Event{event("1", "allowed"), event("2", "allowed"), event("3", "allowed")}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(10 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(20 * time.Millisecond)})
+	sm.lock.Unlock()
+	sm.recordFailedSends([]FailedSend{
+		{ID: "3", StatusCode: http.StatusUnauthorized, Identity: "allowed"},
+		{ID: "4", StatusCode: http.StatusForbidden, Identity: "denied"},
+		{ID: "5", StatusCode: http.StatusServiceUnavailable, Identity: "denied"},
+	})
+
+	report := sm.GenerateReport()
+	for identity, r := range report.Identities {
+		r.Latency = LatencyStats{}
+		report.Identities[identity] = r
+	}
+	want := map[string]IdentityReport{
+		"allowed": {SentCount: 3, ReceivedCount: 1, LostCount: 1, RejectedCount: 1},
+		"denied":  {Denied: true, RejectedCount: 1, FailedSendCount: 1},
+	}
+	if diff := cmp.Diff(want, report.Identities); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if err := verifyIdentities(report); err == nil {
+		t.Error("expected rejected events of an allowed identity to fail the verification")
+	}
+}
+
+func TestVerifyIdentities(t *testing.T) {
+	tests := []struct {
+		name       string
+		identities map[string]IdentityReport
+		wantErr    bool
+	}{
+		{
+			name: "expected results",
+			identities: map[string]IdentityReport{
+				"allowed": {SentCount: 10, ReceivedCount: 10, FailedSendCount: 1},
+				"denied":  {Denied: true, RejectedCount: 10},
+			},
+		},
+		{
+			name:       "denied identity accepted",
+			identities: map[string]IdentityReport{"denied": {Denied: true, SentCount: 1, RejectedCount: 9}},
+			wantErr:    true,
+		},
+		{
+			name:       "allowed identity rejected",
+			identities: map[string]IdentityReport{"allowed": {SentCount: 9, RejectedCount: 1}},
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifyIdentities(Report{Identities: tt.identities}); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
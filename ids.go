@@ -0,0 +1,173 @@
+package sacura
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IDStrategy is the scheme of the IDs of sent events.
+type IDStrategy string
+
+const (
+	// IDStrategyUUIDv4 sends events with random UUIDs.
+	IDStrategyUUIDv4 IDStrategy = "uuidv4"
+	// IDStrategyUUIDv7 sends events with time-ordered UUIDs, the first 48 bits are the milliseconds since the epoch at
+	// which the event has been generated.
+	IDStrategyUUIDv7 IDStrategy = "uuidv7"
+	// IDStrategySequential sends events with monotonically increasing integers, per partition key in ordered mode,
+	// so that missing events are summarized as ranges.
+	IDStrategySequential IDStrategy = "sequential"
+	// IDStrategyTemplate sends events with the IDs rendered by a Go template.
+	IDStrategyTemplate IDStrategy = "template"
+)
+
+// IDsConfig configures the IDs of sent events.
+type IDsConfig struct {
+	// Strategy is the scheme of the IDs.
+	//
+	// Defaults to IDStrategyUUIDv4.
+	Strategy IDStrategy `json:"strategy" yaml:"strategy"`
+
+	// Prefix prefixes the IDs of the IDStrategySequential strategy, for example with the name of the run, so that
+	// events of separate runs have distinct IDs, for example run-42-p1-7.
+	Prefix string `json:"prefix" yaml:"prefix"`
+
+	// Template is a Go template rendered as the ID of each event with IDStrategyTemplate, see IDTemplateData for the
+	// available variables, for example "order-{{.PartitionKey}}-{{.Sequence}}". Rendered IDs must be unique, events
+	// with the same ID are verified as duplicates.
+	Template string `json:"template" yaml:"template"`
+}
+
+// IDTemplateData are the variables available to ID templates.
+type IDTemplateData struct {
+	// Index is the index of the event, starting at 0.
+	Index uint64
+	// Sequence is the sequence number of the event, per partition key in ordered mode, starting at 1.
+	Sequence uint64
+	// PartitionKey is the partition key of the event, it is empty when events are not ordered.
+	PartitionKey string
+	// Timestamp is the time at which the event has been generated.
+	Timestamp time.Time
+	// UUID is a random UUID.
+	UUID string
+}
+
+func (c *IDsConfig) validate(sender *SenderConfig) error {
+	switch c.Strategy {
+	case "":
+		c.Strategy = IDStrategyUUIDv4
+	case IDStrategyUUIDv4, IDStrategyUUIDv7, IDStrategySequential, IDStrategyTemplate:
+	default:
+		return invalidErr("sender.ids.strategy", fmt.Errorf("unknown strategy %q, expected one of %v", c.Strategy, []IDStrategy{IDStrategyUUIDv4, IDStrategyUUIDv7, IDStrategySequential, IDStrategyTemplate}))
+	}
+	if sender.SequentialIDs && c.Strategy != IDStrategySequential {
+		return invalidErr("sender.sequentialIds", fmt.Errorf("cannot be used with the %s strategy of sender.ids", c.Strategy))
+	}
+	if c.Prefix != "" && c.Strategy != IDStrategySequential {
+		return invalidErr("sender.ids.prefix", fmt.Errorf("is only supported with the %s strategy", IDStrategySequential))
+	}
+	if c.Template != "" && c.Strategy != IDStrategyTemplate {
+		return invalidErr("sender.ids.template", fmt.Errorf("is only supported with the %s strategy", IDStrategyTemplate))
+	}
+	if c.Strategy == IDStrategyTemplate {
+		if c.Template == "" {
+			return invalidErr("sender.ids.template", errors.New("template is required"))
+		}
+		if _, err := c.template(); err != nil {
+			return invalidErr("sender.ids.template", err)
+		}
+	}
+	// The sequential strategy is sender.sequentialIds with a prefix.
+	sender.SequentialIDs = c.Strategy == IDStrategySequential
+	return nil
+}
+
+func (c *IDsConfig) template() (*template.Template, error) {
+	return template.New("id").Option("missingkey=error").Parse(c.Template)
+}
+
+// idPrefix returns the prefix of sequential IDs, it returns an empty prefix when the config is nil.
+func (c *IDsConfig) idPrefix() string {
+	if c == nil {
+		return ""
+	}
+	return c.Prefix
+}
+
+// idGenerator generates the IDs of sent events, it is safe for concurrent use.
+type idGenerator struct {
+	strategy IDStrategy
+	prefix   string
+	template *template.Template
+	newUUID  func() uuid.UUID
+}
+
+// newIDGenerator returns the generator of the IDs of the given config, random bits are read from newUUID so that IDs
+// are deterministic with a seed.
+func newIDGenerator(config *IDsConfig, sequentialIDs bool, newUUID func() uuid.UUID) (*idGenerator, error) {
+	g := &idGenerator{strategy: IDStrategyUUIDv4, newUUID: newUUID}
+	if sequentialIDs {
+		g.strategy = IDStrategySequential
+	}
+	if config == nil {
+		return g, nil
+	}
+	if config.Strategy != "" {
+		g.strategy = config.Strategy
+	}
+	g.prefix = config.Prefix
+	if g.strategy == IDStrategyTemplate {
+		t, err := config.template()
+		if err != nil {
+			return nil, invalidErr("sender.ids.template", err)
+		}
+		g.template = t
+	}
+	return g, nil
+}
+
+// sequential returns true when IDs are generated from sequence numbers.
+func (g *idGenerator) sequential() bool {
+	return g.strategy == IDStrategySequential || g.strategy == IDStrategyTemplate
+}
+
+// nextID returns the ID of the event with the given data.
+func (g *idGenerator) nextID(data IDTemplateData) (string, error) {
+	switch g.strategy {
+	case IDStrategySequential:
+		return sequentialID(g.prefix, data.PartitionKey, data.Sequence), nil
+	case IDStrategyUUIDv7:
+		return uuidV7(g.newUUID(), data.Timestamp).String(), nil
+	case IDStrategyTemplate:
+		data.UUID = g.newUUID().String()
+		var b bytes.Buffer
+		if err := g.template.Execute(&b, data); err != nil {
+			return "", fmt.Errorf("failed to execute ID template for event %d: %w", data.Index, err)
+		}
+		id := strings.TrimSpace(b.String())
+		if id == "" {
+			return "", fmt.Errorf("ID template rendered an empty ID for event %d", data.Index)
+		}
+		return id, nil
+	default:
+		return g.newUUID().String(), nil
+	}
+}
+
+// uuidV7 returns a version 7 UUID with the given timestamp and the random bits of the given UUID.
+func uuidV7(random uuid.UUID, t time.Time) uuid.UUID {
+	u := random
+	var ms [8]byte
+	binary.BigEndian.PutUint64(ms[:], uint64(t.UnixMilli()))
+	copy(u[:6], ms[2:])
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return u
+}
@@ -0,0 +1,127 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestIDsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name              string
+		config            IDsConfig
+		sequentialIDs     bool
+		want              IDStrategy
+		wantSequentialIDs bool
+		wantErr           bool
+	}{
+		{name: "default", want: IDStrategyUUIDv4},
+		{name: "sequential", config: IDsConfig{Strategy: IDStrategySequential, Prefix: "run-1"}, want: IDStrategySequential, wantSequentialIDs: true},
+		{name: "sequentialIds", config: IDsConfig{Strategy: IDStrategySequential}, sequentialIDs: true, want: IDStrategySequential, wantSequentialIDs: true},
+		{name: "sequentialIds with uuidv7", config: IDsConfig{Strategy: IDStrategyUUIDv7}, sequentialIDs: true, wantErr: true},
+		{name: "prefix without sequential", config: IDsConfig{Strategy: IDStrategyUUIDv7, Prefix: "run-1"}, wantErr: true},
+		{name: "template", config: IDsConfig{Strategy: IDStrategyTemplate, Template: "{{.PartitionKey}}-{{.Sequence}}"}, want: IDStrategyTemplate},
+		{name: "missing template", config: IDsConfig{Strategy: IDStrategyTemplate}, wantErr: true},
+		{name: "invalid template", config: IDsConfig{Strategy: IDStrategyTemplate, Template: "{{.Sequence"}, wantErr: true},
+		{name: "unknown", config: IDsConfig{Strategy: "snowflake"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sender := SenderConfig{SequentialIDs: tt.sequentialIDs}
+			err := tt.config.validate(&sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if tt.config.Strategy != tt.want {
+				t.Errorf("want strategy %q, got %q", tt.want, tt.config.Strategy)
+			}
+			if sender.SequentialIDs != tt.wantSequentialIDs {
+				t.Errorf("want sequentialIds %v, got %v", tt.wantSequentialIDs, sender.SequentialIDs)
+			}
+		})
+	}
+}
+
+func TestUUIDV7(t *testing.T) {
+	ts := time.UnixMilli(1700000000123)
+	u := uuidV7(uuid.New(), ts)
+	if u.Version() != 7 {
+		t.Errorf("want version 7, got %d", u.Version())
+	}
+	if u.Variant() != uuid.RFC4122 {
+		t.Errorf("want RFC 4122 variant, got %v", u.Variant())
+	}
+	var ms int64
+	for _, b := range u[:6] {
+		ms = ms<<8 | int64(b)
+	}
+	if ms != ts.UnixMilli() {
+		t.Errorf("want timestamp %d, got %d", ts.UnixMilli(), ms)
+	}
+	if later := uuidV7(uuid.New(), ts.Add(time.Millisecond)); later.String() <= u.String() {
+		t.Errorf("want time-ordered IDs, got %s before %s", u, later)
+	}
+}
+
+func TestNewTargeterGeneratorIDs(t *testing.T) {
+	tests := []struct {
+		name string
+		ids  IDsConfig
+		want []string
+	}{
+		{
+			name: "sequential with prefix",
+			ids:  IDsConfig{Strategy: IDStrategySequential, Prefix: "run-1"},
+			want: []string{"run-1-p0-1", "run-1-p0-2", "run-1-p0-3"},
+		},
+		{
+			name: "template",
+			ids:  IDsConfig{Strategy: IDStrategyTemplate, Template: "order-{{.Index}}-{{.PartitionKey}}-{{.Sequence}}"},
+			want: []string{"order-0-p0-1", "order-1-p0-2", "order-2-p0-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				Sender:  SenderConfig{Target: "http://localhost:9090", IDs: &tt.ids},
+				Ordered: &OrderedConfig{NumPartitionKeys: 1},
+			}
+			out := make(chan ce.Event, len(tt.want))
+			f := newTargeterGenerator(config, uuid.New, func() string { return "p0" }, out)
+			for range tt.want {
+				if err := f(&vegeta.Target{Header: http.Header{}}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			close(out)
+
+			var got []string
+			for e := range out {
+				got = append(got, e.ID())
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestParseSequentialIDPrefix(t *testing.T) {
+	ranges, ok := idRanges("run-1", "p1", []string{"run-1-p1-3", "run-1-p1-1", "run-1-p1-2"})
+	if !ok {
+		t.Fatal("want sequential IDs")
+	}
+	if diff := cmp.Diff([]SequenceRange{{From: 1, To: 3}}, ranges); diff != "" {
+		t.Errorf("(-want, +got) %s", diff)
+	}
+}
@@ -0,0 +1,84 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	// DefaultIngestBatchSize is the default IngestConfig.BatchSize.
+	DefaultIngestBatchSize = 1024
+	// DefaultIngestBufferSize is the default IngestConfig.BufferSize.
+	DefaultIngestBufferSize = 8 * DefaultIngestBatchSize
+)
+
+// IngestConfig tunes how sent and received events are recorded by the StateManager at high rates.
+type IngestConfig struct {
+	// BufferSize is the capacity of the channels of sent and received events, so that the sender and the receiver
+	// aren't blocked while a batch is being recorded.
+	//
+	// Defaults to DefaultIngestBufferSize.
+	BufferSize int `json:"bufferSize" yaml:"bufferSize"`
+	// BatchSize is the maximum number of events recorded while holding the lock once, so that the sender and the
+	// receiver don't contend for the lock on each event.
+	//
+	// Defaults to DefaultIngestBatchSize.
+	BatchSize int `json:"batchSize" yaml:"batchSize"`
+	// InternIDs keeps a single copy of the ID of each event, shared by the sent event and all its deliveries, instead
+	// of a copy per delivery. It costs a table entry per event, so it pays off when events are delivered more than
+	// once. It cannot be used in streaming verification mode.
+	InternIDs bool `json:"internIds" yaml:"internIds"`
+}
+
+func (c *IngestConfig) validate(mode VerificationMode) error {
+	if c.BufferSize < 0 {
+		return invalidErr("ingest.bufferSize", errors.New("cannot be negative"))
+	}
+	if c.BatchSize < 0 {
+		return invalidErr("ingest.batchSize", errors.New("cannot be negative"))
+	}
+	if c.InternIDs && mode.streams() {
+		return invalidErr("ingest.internIds", fmt.Errorf("cannot be used with verification mode %q", mode))
+	}
+	return nil
+}
+
+func (c *IngestConfig) bufferSize() int {
+	if c == nil || c.BufferSize == 0 {
+		return DefaultIngestBufferSize
+	}
+	return c.BufferSize
+}
+
+func (c *IngestConfig) batchSize() int {
+	if c == nil || c.BatchSize == 0 {
+		return DefaultIngestBatchSize
+	}
+	return c.BatchSize
+}
+
+// idInterner maps event IDs to the first copy of each ID recorded.
+type idInterner map[string]string
+
+func newIDInterner(config *IngestConfig) idInterner {
+	if config == nil || !config.InternIDs {
+		return nil
+	}
+	return make(idInterner)
+}
+
+// intern replaces the ID of the given event with the first recorded copy of the same ID, it is a no-op when the
+// interner is nil.
+func (in idInterner) intern(e *ce.Event) {
+	if in == nil {
+		return
+	}
+	id := e.ID()
+	if interned, ok := in[id]; ok {
+		e.SetID(interned)
+		return
+	}
+	in[id] = id
+}
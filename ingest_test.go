@@ -0,0 +1,123 @@
+package sacura
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+	"unsafe"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestIngestConfigDefaults(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *IngestConfig
+		wantBuffer    int
+		wantBatchSize int
+	}{
+		{
+			name:          "not configured",
+			wantBuffer:    DefaultIngestBufferSize,
+			wantBatchSize: DefaultIngestBatchSize,
+		},
+		{
+			name:          "defaults",
+			config:        &IngestConfig{InternIDs: true},
+			wantBuffer:    DefaultIngestBufferSize,
+			wantBatchSize: DefaultIngestBatchSize,
+		},
+		{
+			name:          "configured",
+			config:        &IngestConfig{BufferSize: 10, BatchSize: 2},
+			wantBuffer:    10,
+			wantBatchSize: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.bufferSize(); got != tt.wantBuffer {
+				t.Errorf("want buffer size %d, got %d", tt.wantBuffer, got)
+			}
+			if got := tt.config.batchSize(); got != tt.wantBatchSize {
+				t.Errorf("want batch size %d, got %d", tt.wantBatchSize, got)
+			}
+		})
+	}
+}
+
+func TestIngestConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  IngestConfig
+		mode    VerificationMode
+		wantErr bool
+	}{
+		{name: "valid", config: IngestConfig{BufferSize: 10, BatchSize: 2, InternIDs: true}, mode: VerificationModeFull},
+		{name: "negative buffer size", config: IngestConfig{BufferSize: -1}, mode: VerificationModeFull, wantErr: true},
+		{name: "negative batch size", config: IngestConfig{BatchSize: -1}, mode: VerificationModeFull, wantErr: true},
+		{name: "intern ids in soak mode", config: IngestConfig{InternIDs: true}, mode: VerificationModeSoak, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(tt.mode); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func stringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data
+}
+
+func TestStateManagerInternIDs(t *testing.T) {
+	config := Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}, Ingest: &IngestConfig{BatchSize: 2, InternIDs: true}}
+	sm := newTestStateManager(t, config)
+
+	sent := make(chan ce.Event, 10)
+	received := make(chan ReceivedEvent, 10)
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	event := func(id int) ce.Event {
+		e := cetest.FullEvent()
+		// The ID is formatted for each event, so that sent and received events don't share it.
+		e.SetID(fmt.Sprintf("id-%d", id))
+		e.SetExtension(DefaultPartitionKeyExtension, "0")
+		return e
+	}
+	for i := 0; i < 3; i++ {
+		sent <- event(i)
+	}
+	close(sent)
+	<-sentSignal
+	for _, id := range []int{0, 1, 1, 2} {
+		received <- ReceivedEvent{Event: event(id), ReceivedAt: time.Now()}
+	}
+	close(received)
+	<-receivedSignal
+	sm.Terminated(Metrics{AcceptedCount: 3})
+
+	sm.lock.RLock()
+	for i, id := range sm.received["0"] {
+		if want := sm.ids[id]; stringData(id) != stringData(want) {
+			t.Errorf("want received ID %d %q to be interned", i, id)
+		}
+	}
+	for i, id := range sm.sent["0"] {
+		if want := sm.ids[id]; stringData(id) != stringData(want) {
+			t.Errorf("want sent ID %d %q to be interned", i, id)
+		}
+	}
+	sm.lock.RUnlock()
+
+	report := sm.GenerateReport()
+	if report.ReceivedCount != 3 || report.DuplicateCount != 1 || report.LostCount != 0 {
+		t.Errorf("want 3 received events and 1 duplicate, got received %d, duplicates %d, lost %d", report.ReceivedCount, report.DuplicateCount, report.LostCount)
+	}
+}
@@ -0,0 +1,152 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultInstanceIdentityEnv are the environment variables identifying the receiver instance by default, POD_NAME is
+// usually set to metadata.name with the downward API and HOSTNAME defaults to the pod name.
+var DefaultInstanceIdentityEnv = []string{"POD_NAME", "HOSTNAME"}
+
+// lookupEnv looks up environment variables, it is a variable so that tests can replace it.
+var lookupEnv = os.LookupEnv
+
+// InstanceIdentityConfig attributes each delivery to the receiver instance that observed it, for example when the
+// receiver is deployed as an autoscaled Knative Service, so that the report shows how deliveries were distributed
+// across instances and whether scaling caused duplicates or reordering.
+type InstanceIdentityConfig struct {
+	// Env are the environment variables identifying the instance, the first one set is used. When none is set, the
+	// instance is identified by its hostname.
+	//
+	// Defaults to DefaultInstanceIdentityEnv.
+	Env []string `json:"env" yaml:"env"`
+}
+
+func (c *InstanceIdentityConfig) validate(receiver *ReceiverConfig) error {
+	if receiver.Protocol != "" && receiver.Protocol != ProtocolHTTP {
+		return invalidErr("receiver.instanceIdentity", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if len(c.Env) == 0 {
+		c.Env = DefaultInstanceIdentityEnv
+	}
+	for i, name := range c.Env {
+		if name == "" {
+			return invalidErr(fmt.Sprintf("receiver.instanceIdentity.env[%d]", i), errors.New("cannot be empty"))
+		}
+	}
+	return nil
+}
+
+// instance returns the identity of this receiver instance, it returns an empty string when the instance identity
+// isn't reported.
+func (c *InstanceIdentityConfig) instance() string {
+	if c == nil {
+		return ""
+	}
+	for _, name := range c.Env {
+		if v, ok := lookupEnv(name); ok && v != "" {
+			return v
+		}
+	}
+	return defaultInstance()
+}
+
+// InstancesReport reports how deliveries were distributed across the receiver instances with
+// receiver.instanceIdentity.
+type InstancesReport struct {
+	Instances map[string]InstanceReport `json:"instances"`
+	// CrossInstanceDuplicateCount is the number of duplicates received by another instance than the first delivery
+	// of the event, CrossInstanceDuplicates are the IDs of these events.
+	CrossInstanceDuplicateCount int      `json:"crossInstanceDuplicateCount"`
+	CrossInstanceDuplicates     []string `json:"crossInstanceDuplicates,omitempty"`
+	// CrossInstanceOrderingViolationCount is the number of ordering violations whose event and previously received
+	// event have been received by different instances.
+	CrossInstanceOrderingViolationCount int `json:"crossInstanceOrderingViolationCount"`
+}
+
+// InstanceReport reports the deliveries observed by a single receiver instance.
+type InstanceReport struct {
+	// ReceivedCount is the number of deliveries received by the instance, including duplicates.
+	ReceivedCount  int `json:"receivedCount"`
+	DuplicateCount int `json:"duplicateCount"`
+	// FirstReceivedAt and LastReceivedAt bound the deliveries of the instance, showing when it scaled up and down.
+	FirstReceivedAt time.Time `json:"firstReceivedAt"`
+	LastReceivedAt  time.Time `json:"lastReceivedAt"`
+}
+
+// instancesState tracks deliveries by receiver instance.
+type instancesState struct {
+	instances map[string]*InstanceReport
+	// firstInstance is the instance of the first delivery of each event by ID.
+	firstInstance map[string]string
+	// crossInstanceDuplicates are the duplicates received by another instance than the first delivery.
+	crossInstanceDuplicates []string
+}
+
+// recordInstance records the delivery of the given event to the instance that observed it, it must be called while
+// holding the lock.
+func (s *StateManager) recordInstance(e *ReceivedEvent) {
+	if s.config.Receiver.InstanceIdentity == nil || e.Replica == "" || e.Nacked || e.DeadLettered {
+		return
+	}
+	if s.instances == nil {
+		s.instances = &instancesState{instances: make(map[string]*InstanceReport), firstInstance: make(map[string]string)}
+	}
+	ir, ok := s.instances.instances[e.Replica]
+	if !ok {
+		ir = &InstanceReport{FirstReceivedAt: e.ReceivedAt, LastReceivedAt: e.ReceivedAt}
+		s.instances.instances[e.Replica] = ir
+	}
+	ir.ReceivedCount++
+	if e.ReceivedAt.Before(ir.FirstReceivedAt) {
+		ir.FirstReceivedAt = e.ReceivedAt
+	}
+	if e.ReceivedAt.After(ir.LastReceivedAt) {
+		ir.LastReceivedAt = e.ReceivedAt
+	}
+
+	id := e.Event.ID()
+	first, ok := s.instances.firstInstance[id]
+	if !ok {
+		s.instances.firstInstance[id] = e.Replica
+		return
+	}
+	ir.DuplicateCount++
+	if first != e.Replica {
+		s.instances.crossInstanceDuplicates = append(s.instances.crossInstanceDuplicates, id)
+	}
+}
+
+// instancesReport sets the instances section of the report, it must be called while holding the lock and after
+// ordering violations have been reported.
+func (s *StateManager) instancesReport(r *Report) {
+	if s.instances == nil {
+		return
+	}
+	report := &InstancesReport{
+		Instances:                   make(map[string]InstanceReport, len(s.instances.instances)),
+		CrossInstanceDuplicateCount: len(s.instances.crossInstanceDuplicates),
+	}
+	for instance, ir := range s.instances.instances {
+		report.Instances[instance] = *ir
+	}
+	if len(s.instances.crossInstanceDuplicates) > 0 {
+		report.CrossInstanceDuplicates = append([]string{}, s.instances.crossInstanceDuplicates...)
+		sort.Strings(report.CrossInstanceDuplicates)
+	}
+	for _, ordering := range r.OrderingViolationsByPartitionKey {
+		for _, v := range ordering.Violations {
+			if v.Previous == "" {
+				continue
+			}
+			if s.instances.firstInstance[v.ID] != s.instances.firstInstance[v.Previous] {
+				report.CrossInstanceOrderingViolationCount++
+			}
+		}
+	}
+	r.Instances = report
+}
@@ -0,0 +1,113 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestInstanceIdentityConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   InstanceIdentityConfig
+		receiver ReceiverConfig
+		want     InstanceIdentityConfig
+		wantErr  bool
+	}{
+		{name: "defaults", want: InstanceIdentityConfig{Env: DefaultInstanceIdentityEnv}},
+		{name: "custom", config: InstanceIdentityConfig{Env: []string{"K_POD"}}, want: InstanceIdentityConfig{Env: []string{"K_POD"}}},
+		{name: "kafka", receiver: ReceiverConfig{Protocol: ProtocolKafka}, wantErr: true},
+		{name: "empty env", config: InstanceIdentityConfig{Env: []string{"POD_NAME", ""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.receiver)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestInstanceIdentityConfigInstance(t *testing.T) {
+	defer func(l func(string) (string, bool)) { lookupEnv = l }(lookupEnv)
+	defer func(h func() (string, error)) { hostname = h }(hostname)
+	env := map[string]string{"HOSTNAME": "receiver-7d9f-abcde", "EMPTY": ""}
+	lookupEnv = func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	hostname = func() (string, error) { return "host", nil }
+
+	var disabled *InstanceIdentityConfig
+	if got := disabled.instance(); got != "" {
+		t.Errorf("want no instance when disabled, got %q", got)
+	}
+	if got := (&InstanceIdentityConfig{Env: DefaultInstanceIdentityEnv}).instance(); got != "receiver-7d9f-abcde" {
+		t.Errorf("want instance receiver-7d9f-abcde, got %q", got)
+	}
+	if got := (&InstanceIdentityConfig{Env: []string{"EMPTY", "POD_NAME"}}).instance(); got != "host" {
+		t.Errorf("want the hostname when no variable is set, got %q", got)
+	}
+}
+
+func TestStateManagerInstances(t *testing.T) {
+	config := Config{
+		Ordered:  &OrderedConfig{NumPartitionKeys: 1},
+		Receiver: ReceiverConfig{InstanceIdentity: &InstanceIdentityConfig{}},
+	}
+	sm := newTestStateManager(t, config)
+
+	var sent []ce.Event
+	for _, id := range []string{"0-1", "0-2", "0-3"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, "0")
+		sent = append(sent, e)
+	}
+	start := time.Now()
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	for i, d := range []struct {
+		event    int
+		instance string
+	}{
+		{0, "a"},
+		// Instance b scaled up and received 0-3 before instance a received 0-2.
+		{2, "b"},
+		{1, "a"},
+		// Redelivered to another instance.
+		{0, "b"},
+		// Redelivered to the same instance.
+		{2, "b"},
+	} {
+		sm.recordReceived(&ReceivedEvent{Event: sent[d.event], ReceivedAt: start.Add(time.Duration(i) * time.Second), Replica: d.instance})
+	}
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	want := &InstancesReport{
+		Instances: map[string]InstanceReport{
+			"a": {ReceivedCount: 2, FirstReceivedAt: start, LastReceivedAt: start.Add(2 * time.Second)},
+			"b": {ReceivedCount: 3, DuplicateCount: 2, FirstReceivedAt: start.Add(time.Second), LastReceivedAt: start.Add(4 * time.Second)},
+		},
+		CrossInstanceDuplicateCount:         1,
+		CrossInstanceDuplicates:             []string{"0-1"},
+		CrossInstanceOrderingViolationCount: 1,
+	}
+	if diff := cmp.Diff(want, report.Instances); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
@@ -0,0 +1,33 @@
+package sacura
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// ChecksumExtension is the extension carrying the hex-encoded SHA-256 checksum of the event data when integrity
+// verification is enabled.
+const ChecksumExtension = "datachecksum"
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// setChecksum sets the checksum extension of the given event.
+func setChecksum(e *ce.Event) {
+	e.SetExtension(ChecksumExtension, checksum(e.Data()))
+}
+
+// verifyChecksum returns false when the data of the given event doesn't match its checksum extension, events without
+// checksum are considered valid.
+func verifyChecksum(e *ce.Event) bool {
+	v, ok := e.Extensions()[ChecksumExtension]
+	if !ok {
+		return true
+	}
+	return fmt.Sprint(v) == checksum(e.Data())
+}
@@ -0,0 +1,73 @@
+package sacura
+
+import (
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		event func() ce.Event
+		want  bool
+	}{
+		{
+			name:  "no checksum",
+			event: cetest.FullEvent,
+			want:  true,
+		},
+		{
+			name: "valid checksum",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				setChecksum(&e)
+				return e
+			},
+			want: true,
+		},
+		{
+			name: "valid checksum after encoding round trip",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				if err := e.SetData("application/json", map[string]string{"hello": "world"}); err != nil {
+					t.Fatal(err)
+				}
+				setChecksum(&e)
+				b, err := e.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				decoded := ce.NewEvent()
+				if err := decoded.UnmarshalJSON(b); err != nil {
+					t.Fatal(err)
+				}
+				return decoded
+			},
+			want: true,
+		},
+		{
+			name: "mutated data",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				setChecksum(&e)
+				if err := e.SetData("text/json", "mutated"); err != nil {
+					t.Fatal(err)
+				}
+				return e
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event()
+			if got := verifyChecksum(&e); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package sacura
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	// InterchangeFormat identifies the interchange format in the header of interchange files.
+	InterchangeFormat = "sacura.interchange"
+	// InterchangeVersion is the version of the interchange format written by Export, Import reads every version up
+	// to it.
+	InterchangeVersion = 1
+
+	// InterchangeRecordSent and InterchangeRecordReceived are the kinds of interchange records.
+	InterchangeRecordSent     = "sent"
+	InterchangeRecordReceived = "received"
+
+	// interchangeEventSource and interchangeEventType are the attributes of events imported from records without
+	// the full event.
+	interchangeEventSource = "sacura/interchange"
+	interchangeEventType   = "sacura.interchange.event"
+)
+
+// InterchangeSchema is the JSON schema of the lines of an interchange file, the first line is the header and every
+// other line is a record.
+const InterchangeSchema = `{
+  "$schema": "https://json-schema.org/draft/2020-12/schema",
+  "$id": "https://github.com/pierdipi/sacura/interchange/v1",
+  "oneOf": [
+    {
+      "title": "header",
+      "type": "object",
+      "required": ["format", "version"],
+      "properties": {
+        "format": {"const": "sacura.interchange"},
+        "version": {"type": "integer", "minimum": 1}
+      }
+    },
+    {
+      "title": "record",
+      "type": "object",
+      "required": ["kind", "id"],
+      "properties": {
+        "kind": {"enum": ["sent", "received"]},
+        "id": {"type": "string", "minLength": 1},
+        "partitionKey": {"type": "string"},
+        "sequence": {"type": "integer", "minimum": 1, "description": "ignored for received records"},
+        "sentAt": {"type": "string", "format": "date-time"},
+        "receivedAt": {"type": "string", "format": "date-time"},
+        "event": {"type": "object", "description": "CloudEvent in the JSON format"}
+      }
+    }
+  ]
+}`
+
+// InterchangeHeader is the first line of an interchange file.
+type InterchangeHeader struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+}
+
+// InterchangeRecord is a sent or received event of an interchange file, a received record is a single delivery.
+//
+// Records don't need the full event, events are rebuilt from the ID, the partition key, the sequence number and the
+// send time, so that state captured by other tools can be verified. Records of received events are in receive order.
+//
+// The sequence numbers of received events are the ones of the sent records, sequence numbers of received records are
+// ignored so that events received but never sent don't bring foreign sequence numbers into the verification.
+type InterchangeRecord struct {
+	Kind         string     `json:"kind"`
+	ID           string     `json:"id"`
+	PartitionKey string     `json:"partitionKey,omitempty"`
+	Sequence     uint64     `json:"sequence,omitempty"`
+	SentAt       *time.Time `json:"sentAt,omitempty"`
+	ReceivedAt   *time.Time `json:"receivedAt,omitempty"`
+	// Event is the full event, when known, the other fields are ignored except for the kind and the receive time.
+	Event *ce.Event `json:"event,omitempty"`
+}
+
+// InterchangeExportConfig exports the sent and received events of the run in the interchange format once it
+// terminated.
+type InterchangeExportConfig struct {
+	// Path is the path of the file the events are written to, it is replaced when it exists.
+	Path string `json:"path" yaml:"path"`
+}
+
+func (c *InterchangeExportConfig) validate(config *Config) error {
+	if c.Path == "" {
+		return invalidErr("report.interchange.path", errors.New("cannot be empty"))
+	}
+	if config.Verification.Mode.streams() {
+		return invalidErr("report.interchange", fmt.Errorf("is only supported in the %s verification mode", VerificationModeFull))
+	}
+	return nil
+}
+
+// Export writes the sent and received events in the interchange format, sorted by partition key. Received records
+// carry the time of the first delivery of the event.
+func (s *StateManager) Export(w io.Writer) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.streaming != nil {
+		return fmt.Errorf("events are only retained in the %s verification mode", VerificationModeFull)
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	if err := enc.Encode(InterchangeHeader{Format: InterchangeFormat, Version: InterchangeVersion}); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(s.sent))
+	for k := range s.sent {
+		keys = append(keys, k)
+	}
+	for k := range s.received {
+		if _, ok := s.sent[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		pk := k
+		if !s.stateManagerConfig.Ordered {
+			pk = ""
+		}
+		for _, id := range s.sent[k] {
+			r := InterchangeRecord{Kind: InterchangeRecordSent, ID: id, PartitionKey: pk, Sequence: s.sequences[id], SentAt: interchangeTime(s.sentAt[id])}
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		for _, id := range s.received[k] {
+			r := InterchangeRecord{Kind: InterchangeRecordReceived, ID: id, PartitionKey: pk, ReceivedAt: interchangeTime(s.receivedAt[id])}
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// interchangeTime returns the given time of a record, or nil when it is unknown.
+func interchangeTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// exportInterchange writes the sent and received events to the file of the given config.
+func (s *StateManager) exportInterchange(config *InterchangeExportConfig) error {
+	f, err := os.Create(config.Path)
+	if err != nil {
+		return err
+	}
+	if err := s.Export(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Import records the sent and received events of the given interchange file and returns the number of sent and
+// received records.
+//
+// State journals in the JSON lines format, like the entries of state.redis, which have no header, are imported as
+// well.
+func (s *StateManager) Import(r io.Reader) (sent int, received int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	reader := bufio.NewReader(r)
+	first, err := reader.ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return 0, 0, err
+	}
+	header := InterchangeHeader{}
+	if len(bytes.TrimSpace(first)) == 0 || json.Unmarshal(first, &header) != nil || header.Format != InterchangeFormat {
+		// State journals predate the interchange format.
+		sent, received, _, err := s.replayEntries(bufio.NewReader(io.MultiReader(bytes.NewReader(first), reader)))
+		return sent, received, err
+	}
+	if header.Version < 1 || header.Version > InterchangeVersion {
+		return 0, 0, fmt.Errorf("unsupported interchange version %d, expected at most %d", header.Version, InterchangeVersion)
+	}
+
+	for line := 2; ; line++ {
+		b, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(b)) > 0 {
+			record := InterchangeRecord{}
+			if err := json.Unmarshal(b, &record); err != nil {
+				return sent, received, fmt.Errorf("invalid record at line %d: %w", line, err)
+			}
+			switch record.Kind {
+			case InterchangeRecordSent:
+				e := record.event(&s.stateManagerConfig)
+				s.recordSent(&e)
+				if !isWarmupEvent(&e) {
+					sent++
+				}
+			case InterchangeRecordReceived:
+				e := ReceivedEvent{Event: record.event(&s.stateManagerConfig)}
+				if record.ReceivedAt != nil {
+					e.ReceivedAt = *record.ReceivedAt
+				}
+				s.recordReceived(&e)
+				received++
+			default:
+				return sent, received, fmt.Errorf("unknown record kind %q at line %d", record.Kind, line)
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return sent, received, nil
+		}
+		if err != nil {
+			return sent, received, err
+		}
+	}
+}
+
+// event returns the event of the record, events of received records have no sequence number.
+func (r *InterchangeRecord) event(config *StateManagerConfig) ce.Event {
+	if r.Event != nil {
+		e := r.Event.Clone()
+		if r.Kind == InterchangeRecordReceived {
+			e.SetExtension(SequenceExtension, nil)
+		}
+		return e
+	}
+	e := ce.NewEvent()
+	e.SetID(r.ID)
+	e.SetSource(interchangeEventSource)
+	e.SetType(interchangeEventType)
+	if r.PartitionKey != "" {
+		setEventPartitionKey(&e, config.partitionKeyAttribute(), r.PartitionKey)
+	}
+	if r.Sequence > 0 && r.Kind == InterchangeRecordSent {
+		e.SetExtension(SequenceExtension, fmt.Sprint(r.Sequence))
+	}
+	if r.SentAt != nil {
+		setSentTimestamp(&e, *r.SentAt)
+	}
+	return e
+}
@@ -0,0 +1,197 @@
+package sacura
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerExportImport(t *testing.T) {
+	config := Config{Ordered: &OrderedConfig{NumPartitionKeys: 2}, DeliveryGuarantee: AtLeastOnce}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	var sent []ce.Event
+	for _, id := range []string{"0-1", "0-2", "0-3", "1-1"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, id[:1])
+		e.SetExtension(SequenceExtension, id[2:])
+		setSentTimestamp(&e, now)
+		sent = append(sent, e)
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	// 0-3 is lost, 0-2 is received before 0-1 and duplicated.
+	for i, j := range []int{1, 0, 1, 3} {
+		sm.recordReceived(&ReceivedEvent{Event: sent[j], ReceivedAt: now.Add(time.Duration(i+1) * time.Millisecond)})
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 4})
+	want := sm.GenerateReport()
+
+	var b bytes.Buffer
+	if err := sm.Export(&b); err != nil {
+		t.Fatal(err)
+	}
+	header := InterchangeHeader{}
+	if err := json.Unmarshal(bytes.SplitN(b.Bytes(), []byte("\n"), 2)[0], &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Format != InterchangeFormat || header.Version != InterchangeVersion {
+		t.Errorf("unexpected header %+v", header)
+	}
+
+	imported := newTestStateManager(t, config)
+	nSent, nReceived, err := imported.Import(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nSent != 4 || nReceived != 4 {
+		t.Errorf("want 4 sent and 4 received records, got %d and %d", nSent, nReceived)
+	}
+	imported.Terminated(Metrics{AcceptedCount: nSent})
+	got := imported.GenerateReport()
+
+	if got.ReceivedCount != want.ReceivedCount || got.LostCount != want.LostCount || got.DuplicateCount != want.DuplicateCount ||
+		got.OrderingViolationCount != want.OrderingViolationCount || got.Latency.Count != want.Latency.Count {
+		t.Errorf("want %d received, %d lost, %d duplicates, %d ordering violations and %d latencies, got %d, %d, %d, %d and %d",
+			want.ReceivedCount, want.LostCount, want.DuplicateCount, want.OrderingViolationCount, want.Latency.Count,
+			got.ReceivedCount, got.LostCount, got.DuplicateCount, got.OrderingViolationCount, got.Latency.Count)
+	}
+	if got.LostCount != 1 || got.OrderingViolationCount != 1 {
+		t.Errorf("want 1 lost event and 1 ordering violation, got %d and %d", got.LostCount, got.OrderingViolationCount)
+	}
+}
+
+func TestStateManagerImport(t *testing.T) {
+	journal := func() string {
+		e := cetest.FullEvent()
+		e.SetID("1")
+		b, err := json.Marshal(journalEntry{Kind: journalEntrySent, Event: e})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b) + "\n"
+	}
+
+	tests := []struct {
+		name         string
+		input        string
+		wantSent     int
+		wantReceived int
+		wantErr      bool
+	}{
+		{
+			name: "records of other tools",
+			input: `{"format":"sacura.interchange","version":1}
+{"kind":"sent","id":"1"}
+{"kind":"sent","id":"2","sentAt":"2021-01-01T00:00:00Z"}
+
+{"kind":"received","id":"2","receivedAt":"2021-01-01T00:00:01Z"}`,
+			wantSent:     2,
+			wantReceived: 1,
+		},
+		{name: "state journal", input: journal(), wantSent: 1},
+		{name: "empty", input: ""},
+		{name: "unsupported version", input: `{"format":"sacura.interchange","version":2}` + "\n", wantErr: true},
+		{name: "unknown kind", input: `{"format":"sacura.interchange","version":1}` + "\n" + `{"kind":"nacked","id":"1"}` + "\n", wantErr: true},
+		{name: "invalid record", input: `{"format":"sacura.interchange","version":1}` + "\n" + `{"kind":` + "\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, Config{})
+			sent, received, err := sm.Import(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if sent != tt.wantSent || received != tt.wantReceived {
+				t.Errorf("want %d sent and %d received, got %d and %d", tt.wantSent, tt.wantReceived, sent, received)
+			}
+		})
+	}
+}
+
+func TestStateManagerExportUnknownTimes(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	e := cetest.FullEvent()
+	e.SetID("1")
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.lock.Unlock()
+
+	var b bytes.Buffer
+	if err := sm.Export(&b); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); strings.Contains(s, "sentAt") || strings.Contains(s, "receivedAt") {
+		t.Errorf("want no unknown times, got %s", s)
+	}
+}
+
+func TestStateManagerImportForeignSequences(t *testing.T) {
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}})
+	input := `{"format":"sacura.interchange","version":1}
+{"kind":"sent","id":"0-1","partitionKey":"0","sequence":1}
+{"kind":"sent","id":"0-2","partitionKey":"0","sequence":2}
+{"kind":"received","id":"0-1","partitionKey":"0","sequence":1}
+{"kind":"received","id":"stray","partitionKey":"0","sequence":1099511627776}
+`
+	if _, _, err := sm.Import(strings.NewReader(input)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sm.sequences["stray"]; ok {
+		t.Error("want no sequence number for the event never sent")
+	}
+
+	done := make(chan DiffReport)
+	go func() { done <- sm.Diff() }()
+	select {
+	case d := <-done:
+		if diff := cmp.Diff([]SequenceRange{{From: 2, To: 2}}, d.Partitions["0"].SequenceGaps); diff != "" {
+			t.Error("(-want, +got)", diff)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("diff didn't complete")
+	}
+}
+
+func TestVerifyInterchange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	content := `{"format":"sacura.interchange","version":1}
+{"kind":"sent","id":"1"}
+{"kind":"sent","id":"2"}
+{"kind":"received","id":"2"}
+{"kind":"received","id":"1"}
+`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Sender:            SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, Workers: 1, Disabled: true},
+		Receiver:          ReceiverConfig{Port: 8080, Timeout: "1m"},
+		DeliveryGuarantee: AtLeastOnce,
+		Duration:          "1m",
+	}
+	report, err := Verify(config, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Metrics.AcceptedCount != 2 || report.ReceivedCount != 2 {
+		t.Errorf("want 2 accepted and received events, got %d and %d", report.Metrics.AcceptedCount, report.ReceivedCount)
+	}
+}
@@ -0,0 +1,154 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+type InterimReportConfig struct {
+	// Interval is the interval at which interim reports are emitted, for example 60s.
+	Interval string `json:"interval" yaml:"interval"`
+	// Path is the path of the file interim reports are appended to as JSON lines, interim reports are only logged
+	// when empty.
+	Path string `json:"path" yaml:"path"`
+
+	ParsedInterval time.Duration
+}
+
+// InterimReport is a snapshot of the state of a running test.
+type InterimReport struct {
+	Time time.Time `json:"time"`
+	// Elapsed is the time elapsed since the first interim report period started.
+	Elapsed time.Duration `json:"elapsed"`
+	// ProgressPercentage is the percentage of sender.eventCount events sent or, without sender.eventCount, the
+	// percentage of the duration elapsed.
+	ProgressPercentage float64 `json:"progressPercentage"`
+	// SentCount is the number of events sent and accepted.
+	SentCount int64 `json:"sentCount"`
+	// ReceivedCount is the number of events received, including duplicates.
+	ReceivedCount     int64 `json:"receivedCount"`
+	DuplicateCount    int64 `json:"duplicateCount"`
+	NackedCount       int64 `json:"nackedCount"`
+	DeadLetteredCount int64 `json:"deadLetteredCount"`
+	// ExpiredCount is the number of events not received within the max delivery age.
+	ExpiredCount int64 `json:"expiredCount"`
+	// OutstandingCount is the number of events sent and not received yet, it is the current loss estimate.
+	OutstandingCount int64 `json:"outstandingCount"`
+	// OutstandingPercentage is the percentage of sent events not received yet.
+	OutstandingPercentage float64 `json:"outstandingPercentage"`
+	// SentPerSecond is the number of events sent per second since the previous interim report.
+	SentPerSecond float64 `json:"sentPerSecond"`
+	// ReceivedPerSecond is the number of events received per second since the previous interim report.
+	ReceivedPerSecond float64 `json:"receivedPerSecond"`
+}
+
+func (c *InterimReportConfig) validate() error {
+	var err error
+	c.ParsedInterval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return invalidErr("report.interim.interval", err)
+	}
+	if c.ParsedInterval <= 0 {
+		return invalidErr("report.interim.interval", errors.New("must be greater than 0"))
+	}
+	return nil
+}
+
+// InterimReport returns a snapshot of the live counters, throughput is computed since the given previous report,
+// when the previous report is nil throughput is computed since the given start time.
+func (s *StateManager) InterimReport(start time.Time, previous *InterimReport) InterimReport {
+	now := time.Now()
+	r := InterimReport{
+		Time:              now,
+		Elapsed:           now.Sub(start),
+		SentCount:         s.sentCount.Load(),
+		ReceivedCount:     s.receivedCount.Load(),
+		DuplicateCount:    s.duplicateCount.Load(),
+		NackedCount:       s.nackedCount.Load(),
+		DeadLetteredCount: s.deadLetteredCount.Load(),
+		ExpiredCount:      s.expiredCount.Load(),
+		OutstandingCount:  s.sentCount.Load() - s.matchedCount.Load(),
+	}
+	r.ProgressPercentage = s.progressPercentage(r.Elapsed)
+	if r.SentCount > 0 {
+		r.OutstandingPercentage = 100 * float64(r.OutstandingCount) / float64(r.SentCount)
+	}
+
+	since := start
+	var sent, received int64
+	if previous != nil {
+		since = previous.Time
+		sent = previous.SentCount
+		received = previous.ReceivedCount
+	}
+	if elapsed := now.Sub(since).Seconds(); elapsed > 0 {
+		r.SentPerSecond = float64(r.SentCount-sent) / elapsed
+		r.ReceivedPerSecond = float64(r.ReceivedCount-received) / elapsed
+	}
+	return r
+}
+
+// startInterimReports periodically logs interim reports and appends them to the configured file until the returned
+// function is called.
+func (s *StateManager) startInterimReports(config *InterimReportConfig) func() {
+	if config == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(config.ParsedInterval)
+		defer ticker.Stop()
+
+		start := time.Now()
+		var previous *InterimReport
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r := s.InterimReport(start, previous)
+				previous = &r
+				if err := writeInterimReport(config.Path, r); err != nil {
+					logger(LogComponentReport).Errorw("Failed to write interim report", "error", err)
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+func writeInterimReport(path string, r InterimReport) error {
+	logger(LogComponentReport).Infow("Interim report", "report", r)
+
+	if path == "" {
+		return nil
+	}
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,85 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestStateManagerInterimReport(t *testing.T) {
+
+	sent := make(chan ce.Event, 4)
+	received := make(chan ReceivedEvent, 4)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	for _, id := range []string{"1", "2", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	start := time.Now().Add(-2 * time.Second)
+	r := sm.InterimReport(start, nil)
+	if r.SentCount != 4 || r.ReceivedCount != 3 || r.DuplicateCount != 1 || r.OutstandingCount != 2 {
+		t.Errorf("unexpected counts %+v", r)
+	}
+	if r.OutstandingPercentage != 50 {
+		t.Errorf("expected outstanding percentage 50, got %v", r.OutstandingPercentage)
+	}
+	if r.SentPerSecond <= 0 || r.SentPerSecond > 2 {
+		t.Errorf("expected sent throughput around 2/s, got %v", r.SentPerSecond)
+	}
+
+	next := sm.InterimReport(start, &r)
+	if next.SentPerSecond != 0 || next.ReceivedPerSecond != 0 {
+		t.Errorf("expected no throughput since previous report, got %+v", next)
+	}
+}
+
+func TestStateManagerStartInterimReports(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "interim.jsonl")
+
+	sm := newTestStateManager(t, Config{})
+	stop := sm.startInterimReports(&InterimReportConfig{Path: path, ParsedInterval: 10 * time.Millisecond})
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	stop()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r := InterimReport{}
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		lines++
+	}
+	if lines < 2 {
+		t.Errorf("expected at least 2 interim reports, got %d", lines)
+	}
+}
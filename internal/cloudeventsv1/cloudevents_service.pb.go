@@ -0,0 +1,165 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.27.1
+// 	protoc        (unknown)
+// source: internal/cloudeventsv1/cloudevents_service.proto
+
+package cloudeventsv1
+
+import (
+	pb "github.com/cloudevents/sdk-go/binding/format/protobuf/v2/pb"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type PublishRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The event, in the CloudEvents protobuf format.
+	Event *pb.CloudEvent `protobuf:"bytes,1,opt,name=event,proto3" json:"event,omitempty"`
+}
+
+func (x *PublishRequest) Reset() {
+	*x = PublishRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_internal_cloudeventsv1_cloudevents_service_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PublishRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PublishRequest) ProtoMessage() {}
+
+func (x *PublishRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_cloudeventsv1_cloudevents_service_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PublishRequest.ProtoReflect.Descriptor instead.
+func (*PublishRequest) Descriptor() ([]byte, []int) {
+	return file_internal_cloudeventsv1_cloudevents_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *PublishRequest) GetEvent() *pb.CloudEvent {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+var File_internal_cloudeventsv1_cloudevents_service_proto protoreflect.FileDescriptor
+
+var file_internal_cloudeventsv1_cloudevents_service_proto_rawDesc = []byte{
+	0x0a, 0x30, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x63, 0x6c, 0x6f, 0x75, 0x64,
+	0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x76, 0x31, 0x2f, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x65, 0x76,
+	0x65, 0x6e, 0x74, 0x73, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x12, 0x11, 0x69, 0x6f, 0x2e, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x65, 0x76, 0x65, 0x6e,
+	0x74, 0x73, 0x2e, 0x76, 0x31, 0x1a, 0x10, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x65, 0x76, 0x65, 0x6e,
+	0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a, 0x1b, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f, 0x65, 0x6d, 0x70, 0x74, 0x79, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x22, 0x36, 0x0a, 0x0e, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x24, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0e, 0x2e, 0x70, 0x62, 0x2e, 0x43, 0x6c, 0x6f, 0x75, 0x64,
+	0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x32, 0x59, 0x0a, 0x11,
+	0x43, 0x6c, 0x6f, 0x75, 0x64, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63,
+	0x65, 0x12, 0x44, 0x0a, 0x07, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x12, 0x21, 0x2e, 0x69,
+	0x6f, 0x2e, 0x63, 0x6c, 0x6f, 0x75, 0x64, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x2e, 0x76, 0x31,
+	0x2e, 0x50, 0x75, 0x62, 0x6c, 0x69, 0x73, 0x68, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x16, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75,
+	0x66, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x42, 0x33, 0x5a, 0x31, 0x67, 0x69, 0x74, 0x68, 0x75,
+	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x70, 0x69, 0x65, 0x72, 0x64, 0x69, 0x70, 0x69, 0x2f, 0x73,
+	0x61, 0x63, 0x75, 0x72, 0x61, 0x2f, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x6e, 0x61, 0x6c, 0x2f, 0x63,
+	0x6c, 0x6f, 0x75, 0x64, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x73, 0x76, 0x31, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_internal_cloudeventsv1_cloudevents_service_proto_rawDescOnce sync.Once
+	file_internal_cloudeventsv1_cloudevents_service_proto_rawDescData = file_internal_cloudeventsv1_cloudevents_service_proto_rawDesc
+)
+
+func file_internal_cloudeventsv1_cloudevents_service_proto_rawDescGZIP() []byte {
+	file_internal_cloudeventsv1_cloudevents_service_proto_rawDescOnce.Do(func() {
+		file_internal_cloudeventsv1_cloudevents_service_proto_rawDescData = protoimpl.X.CompressGZIP(file_internal_cloudeventsv1_cloudevents_service_proto_rawDescData)
+	})
+	return file_internal_cloudeventsv1_cloudevents_service_proto_rawDescData
+}
+
+var file_internal_cloudeventsv1_cloudevents_service_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_internal_cloudeventsv1_cloudevents_service_proto_goTypes = []interface{}{
+	(*PublishRequest)(nil), // 0: io.cloudevents.v1.PublishRequest
+	(*pb.CloudEvent)(nil),  // 1: pb.CloudEvent
+	(*emptypb.Empty)(nil),  // 2: google.protobuf.Empty
+}
+var file_internal_cloudeventsv1_cloudevents_service_proto_depIdxs = []int32{
+	1, // 0: io.cloudevents.v1.PublishRequest.event:type_name -> pb.CloudEvent
+	0, // 1: io.cloudevents.v1.CloudEventService.Publish:input_type -> io.cloudevents.v1.PublishRequest
+	2, // 2: io.cloudevents.v1.CloudEventService.Publish:output_type -> google.protobuf.Empty
+	2, // [2:3] is the sub-list for method output_type
+	1, // [1:2] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_internal_cloudeventsv1_cloudevents_service_proto_init() }
+func file_internal_cloudeventsv1_cloudevents_service_proto_init() {
+	if File_internal_cloudeventsv1_cloudevents_service_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_internal_cloudeventsv1_cloudevents_service_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PublishRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_internal_cloudeventsv1_cloudevents_service_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_internal_cloudeventsv1_cloudevents_service_proto_goTypes,
+		DependencyIndexes: file_internal_cloudeventsv1_cloudevents_service_proto_depIdxs,
+		MessageInfos:      file_internal_cloudeventsv1_cloudevents_service_proto_msgTypes,
+	}.Build()
+	File_internal_cloudeventsv1_cloudevents_service_proto = out.File
+	file_internal_cloudeventsv1_cloudevents_service_proto_rawDesc = nil
+	file_internal_cloudeventsv1_cloudevents_service_proto_goTypes = nil
+	file_internal_cloudeventsv1_cloudevents_service_proto_depIdxs = nil
+}
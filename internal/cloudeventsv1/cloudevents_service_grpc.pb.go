@@ -0,0 +1,108 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: internal/cloudeventsv1/cloudevents_service.proto
+
+package cloudeventsv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+	emptypb "google.golang.org/protobuf/types/known/emptypb"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CloudEventServiceClient is the client API for CloudEventService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CloudEventServiceClient interface {
+	// Publish publishes the event of the request.
+	Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*emptypb.Empty, error)
+}
+
+type cloudEventServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCloudEventServiceClient(cc grpc.ClientConnInterface) CloudEventServiceClient {
+	return &cloudEventServiceClient{cc}
+}
+
+func (c *cloudEventServiceClient) Publish(ctx context.Context, in *PublishRequest, opts ...grpc.CallOption) (*emptypb.Empty, error) {
+	out := new(emptypb.Empty)
+	err := c.cc.Invoke(ctx, "/io.cloudevents.v1.CloudEventService/Publish", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CloudEventServiceServer is the server API for CloudEventService service.
+// All implementations must embed UnimplementedCloudEventServiceServer
+// for forward compatibility
+type CloudEventServiceServer interface {
+	// Publish publishes the event of the request.
+	Publish(context.Context, *PublishRequest) (*emptypb.Empty, error)
+	mustEmbedUnimplementedCloudEventServiceServer()
+}
+
+// UnimplementedCloudEventServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedCloudEventServiceServer struct {
+}
+
+func (UnimplementedCloudEventServiceServer) Publish(context.Context, *PublishRequest) (*emptypb.Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Publish not implemented")
+}
+func (UnimplementedCloudEventServiceServer) mustEmbedUnimplementedCloudEventServiceServer() {}
+
+// UnsafeCloudEventServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CloudEventServiceServer will
+// result in compilation errors.
+type UnsafeCloudEventServiceServer interface {
+	mustEmbedUnimplementedCloudEventServiceServer()
+}
+
+func RegisterCloudEventServiceServer(s grpc.ServiceRegistrar, srv CloudEventServiceServer) {
+	s.RegisterService(&CloudEventService_ServiceDesc, srv)
+}
+
+func _CloudEventService_Publish_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PublishRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CloudEventServiceServer).Publish(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/io.cloudevents.v1.CloudEventService/Publish",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CloudEventServiceServer).Publish(ctx, req.(*PublishRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CloudEventService_ServiceDesc is the grpc.ServiceDesc for CloudEventService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CloudEventService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "io.cloudevents.v1.CloudEventService",
+	HandlerType: (*CloudEventServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Publish",
+			Handler:    _CloudEventService_Publish_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "internal/cloudeventsv1/cloudevents_service.proto",
+}
@@ -0,0 +1,249 @@
+package sacura
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v3"
+	"github.com/go-jose/go-jose/v3/jwt"
+)
+
+const (
+	// jwtLeeway is the clock skew tolerated when checking the exp and nbf claims.
+	jwtLeeway = 30 * time.Second
+	// jwksMinRefreshInterval bounds how often the JWKS is fetched again when a token is signed by an unknown key.
+	jwksMinRefreshInterval = time.Minute
+)
+
+type JWTConfig struct {
+	// Issuer is the expected iss claim, it isn't checked when empty.
+	Issuer string `json:"issuer" yaml:"issuer"`
+	// Audience is the audience expected in the aud claim, it isn't checked when empty.
+	Audience string `json:"audience" yaml:"audience"`
+	// PublicKeyFile is the path of a file containing PEM encoded public keys tokens are verified with.
+	PublicKeyFile string `json:"publicKeyFile" yaml:"publicKeyFile"`
+	// JWKSURL is the URL of the JSON Web Key Set tokens are verified with, the key set is fetched again when a token
+	// is signed by an unknown key.
+	JWKSURL string `json:"jwksURL" yaml:"jwksURL"`
+	// AllowMissingExpiry accepts tokens without the exp claim, which are otherwise rejected since they never expire.
+	AllowMissingExpiry bool `json:"allowMissingExpiry" yaml:"allowMissingExpiry"`
+}
+
+// jwtAlgorithms are the supported signature algorithms, with the curve of the keys of ECDSA algorithms.
+var jwtAlgorithms = map[string]string{
+	string(jose.RS256): "", string(jose.RS384): "", string(jose.RS512): "",
+	string(jose.ES256): "P-256", string(jose.ES384): "P-384", string(jose.ES512): "P-521",
+}
+
+// jwtVerifier verifies signed JWTs, it is safe for concurrent use.
+type jwtVerifier struct {
+	config *JWTConfig
+	client *http.Client
+
+	lock      sync.RWMutex
+	keys      map[string]jose.JSONWebKey
+	fetchedAt time.Time
+}
+
+func newJWTVerifier(config *JWTConfig) (*jwtVerifier, error) {
+	v := &jwtVerifier{config: config, client: &http.Client{Timeout: 30 * time.Second}}
+	if config.PublicKeyFile != "" {
+		keys, err := loadPublicKeys(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.keys = keys
+		return v, nil
+	}
+	if err := v.fetchKeys(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// verify verifies the signature and the claims of the given token.
+func (v *jwtVerifier) verify(token string, now time.Time) error {
+	tok, err := jwt.ParseSigned(token)
+	if err != nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+	header := tok.Headers[0]
+	if _, ok := jwtAlgorithms[header.Algorithm]; !ok {
+		return fmt.Errorf("unsupported algorithm %q", header.Algorithm)
+	}
+
+	claims := jwt.Claims{}
+	if err := v.verifySignature(tok, header, &claims); err != nil {
+		return err
+	}
+	if claims.Expiry == nil && !v.config.AllowMissingExpiry {
+		return errors.New("token without exp claim")
+	}
+	expected := jwt.Expected{Issuer: v.config.Issuer, Time: now}
+	if v.config.Audience != "" {
+		expected.Audience = jwt.Audience{v.config.Audience}
+	}
+	return claims.ValidateWithLeeway(expected, jwtLeeway)
+}
+
+// verifySignature verifies the signature of the token with the candidate keys of its key ID and decodes its claims.
+func (v *jwtVerifier) verifySignature(tok *jwt.JSONWebToken, header jose.Header, claims *jwt.Claims) error {
+	keys := v.candidateKeys(header.KeyID)
+	if len(keys) == 0 {
+		return fmt.Errorf("unknown key %q", header.KeyID)
+	}
+	for _, key := range keys {
+		if !jwkAllows(key, header.Algorithm) {
+			continue
+		}
+		if err := tok.Claims(key.Key, claims); err == nil {
+			return nil
+		}
+	}
+	return errors.New("invalid signature")
+}
+
+// jwkAllows reports whether the given key verifies signatures of the given algorithm, ECDSA algorithms are bound to
+// the curve of the key.
+func jwkAllows(key jose.JSONWebKey, alg string) bool {
+	if key.Algorithm != "" && key.Algorithm != alg {
+		return false
+	}
+	switch k := key.Key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS")
+	case *ecdsa.PublicKey:
+		return jwtAlgorithms[alg] == k.Curve.Params().Name
+	default:
+		return false
+	}
+}
+
+// candidateKeys returns the keys a token signed by the given key ID may be verified with, fetching the key set again
+// when the key is unknown.
+func (v *jwtVerifier) candidateKeys(kid string) []jose.JSONWebKey {
+	keys := v.lookup(kid)
+	if len(keys) > 0 || v.config.JWKSURL == "" {
+		return keys
+	}
+
+	v.lock.RLock()
+	stale := time.Since(v.fetchedAt) > jwksMinRefreshInterval
+	v.lock.RUnlock()
+	if !stale {
+		return nil
+	}
+	if err := v.fetchKeys(); err != nil {
+		logger(LogComponentReceiver).Warnw("Failed to refresh JWKS", "error", err)
+		return nil
+	}
+	return v.lookup(kid)
+}
+
+func (v *jwtVerifier) lookup(kid string) []jose.JSONWebKey {
+	v.lock.RLock()
+	defer v.lock.RUnlock()
+
+	if kid != "" {
+		if k, ok := v.keys[kid]; ok {
+			return []jose.JSONWebKey{k}
+		}
+		if v.config.JWKSURL != "" {
+			return nil
+		}
+	}
+	// Keys loaded from files have no key ID.
+	keys := make([]jose.JSONWebKey, 0, len(v.keys))
+	for _, k := range v.keys {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+func (v *jwtVerifier) fetchKeys() error {
+	resp, err := v.client.Get(v.config.JWKSURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("expected status code 2xx from %s, got %d", v.config.JWKSURL, resp.StatusCode)
+	}
+
+	// Keys are decoded one by one, so that unsupported keys are skipped rather than failing the whole set.
+	set := struct {
+		Keys []json.RawMessage `json:"keys"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("failed to decode JWKS: %w", err)
+	}
+	keys := make(map[string]jose.JSONWebKey, len(set.Keys))
+	for i, raw := range set.Keys {
+		k := jose.JSONWebKey{}
+		if err := k.UnmarshalJSON(raw); err != nil {
+			logger(LogComponentReceiver).Warnw("Skipping JWKS key", "index", i, "error", err)
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if !k.IsPublic() {
+			logger(LogComponentReceiver).Warnw("Skipping JWKS key", "index", i, "kid", k.KeyID, "error", "not a public key")
+			continue
+		}
+		keys[k.KeyID] = k
+	}
+
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	v.keys = keys
+	v.fetchedAt = time.Now()
+	return nil
+}
+
+func loadPublicKeys(path string) (map[string]jose.JSONWebKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys := make(map[string]jose.JSONWebKey)
+	for i := 0; ; i++ {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			break
+		}
+		var key crypto.PublicKey
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+			cert, err = x509.ParseCertificate(block.Bytes)
+			if err == nil {
+				key = cert.PublicKey
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %d in %s: %w", i, path, err)
+		}
+		keys[fmt.Sprint(i)] = jose.JSONWebKey{Key: key}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no PEM encoded public keys found in %s", path)
+	}
+	return keys, nil
+}
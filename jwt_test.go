@@ -0,0 +1,257 @@
+package sacura
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v3"
+	"go.uber.org/atomic"
+)
+
+func signTestJWT(t *testing.T, key crypto.Signer, alg, kid string, claims map[string]interface{}) string {
+	encode := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestJWTVerifier(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	var pemKeys []byte
+	for _, pub := range []crypto.PublicKey{&rsaKey.PublicKey, &ecKey.PublicKey} {
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pemKeys = append(pemKeys, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})...)
+	}
+	if err := os.WriteFile(path, pemKeys, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := newJWTVerifier(&JWTConfig{Issuer: "https://issuer.example.com", Audience: "sacura", PublicKeyFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss": "https://issuer.example.com",
+			"aud": []string{"broker", "sacura"},
+			"exp": now.Add(time.Hour).Unix(),
+			"nbf": now.Add(-time.Minute).Unix(),
+		}
+	}
+	with := func(k string, val interface{}) map[string]interface{} {
+		c := valid()
+		c[k] = val
+		return c
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "RS256",
+			token: signTestJWT(t, rsaKey, "RS256", "", valid()),
+		},
+		{
+			name:  "ES256",
+			token: signTestJWT(t, ecKey, "ES256", "", valid()),
+		},
+		{
+			name:  "string audience",
+			token: signTestJWT(t, rsaKey, "RS256", "", with("aud", "sacura")),
+		},
+		{
+			name:    "untrusted key",
+			token:   signTestJWT(t, otherKey, "RS256", "", valid()),
+			wantErr: true,
+		},
+		{
+			name:    "unexpected issuer",
+			token:   signTestJWT(t, rsaKey, "RS256", "", with("iss", "https://other.example.com")),
+			wantErr: true,
+		},
+		{
+			name:    "unexpected audience",
+			token:   signTestJWT(t, rsaKey, "RS256", "", with("aud", "broker")),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   signTestJWT(t, rsaKey, "RS256", "", with("exp", now.Add(-time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			name:    "not valid yet",
+			token:   signTestJWT(t, rsaKey, "RS256", "", with("nbf", now.Add(time.Hour).Unix())),
+			wantErr: true,
+		},
+		{
+			name: "missing exp",
+			token: signTestJWT(t, rsaKey, "RS256", "", map[string]interface{}{
+				"iss": "https://issuer.example.com",
+				"aud": "sacura",
+			}),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			token:   signTestJWT(t, rsaKey, "none", "", valid()),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-jwt",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := v.verify(tt.token, now); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierAllowMissingExpiry(t *testing.T) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := newJWTVerifier(&JWTConfig{PublicKeyFile: path, AllowMissingExpiry: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.verify(signTestJWT(t, key, "ES256", "", map[string]interface{}{"sub": "sacura"}), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	// The curve of the key is bound to the algorithm.
+	if err := v.verify(signTestJWT(t, key, "ES384", "", map[string]interface{}{"sub": "sacura"}), time.Now()); err == nil {
+		t.Fatal("expected ES384 token signed by a P-256 key to be rejected")
+	}
+}
+
+func TestJWTVerifierJWKS(t *testing.T) {
+
+	first, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaJWK := jose.JSONWebKey{Key: &first.PublicKey, KeyID: "first", Use: "sig"}
+	ecJWK := jose.JSONWebKey{Key: &rotated.PublicKey, KeyID: "rotated"}
+	// Encryption keys and keys of unsupported types are skipped.
+	encJWK := jose.JSONWebKey{Key: &rotated.PublicKey, KeyID: "encryption", Use: "enc"}
+	unsupported := json.RawMessage(`{"kty":"unknown","kid":"unsupported"}`)
+
+	fetches := atomic.NewInt64(0)
+	var lock sync.Mutex
+	keys := []interface{}{rsaJWK, encJWK, unsupported}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Inc()
+		lock.Lock()
+		defer lock.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer server.Close()
+
+	v, err := newJWTVerifier(&JWTConfig{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix()}
+	if err := v.verify(signTestJWT(t, first, "RS256", "first", claims), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown keys are only fetched again after the minimum refresh interval.
+	lock.Lock()
+	keys = []interface{}{rsaJWK, ecJWK}
+	lock.Unlock()
+	token := signTestJWT(t, rotated, "ES256", "rotated", claims)
+	if err := v.verify(token, time.Now()); err == nil {
+		t.Fatal("expected unknown key to be rejected before the refresh interval")
+	}
+	v.lock.Lock()
+	v.fetchedAt = time.Now().Add(-2 * jwksMinRefreshInterval)
+	v.lock.Unlock()
+	if err := v.verify(token, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if got := fetches.Load(); got != 2 {
+		t.Errorf("expected 2 JWKS fetches, got %d", got)
+	}
+}
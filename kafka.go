@@ -0,0 +1,461 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/google/uuid"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+)
+
+// KafkaConfig configures the CloudEvents Kafka protocol binding, events are produced in the binary content mode:
+// attributes are headers prefixed with ce_, datacontenttype is the content-type header, data is the value and, in
+// ordered mode, the partition key is the key of the record.
+type KafkaConfig struct {
+	// Topic is the topic events are produced to or consumed from.
+	Topic string `json:"topic" yaml:"topic"`
+	// Username and Password authenticate with the brokers with the SASL PLAIN mechanism.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+}
+
+type ReceiverKafkaConfig struct {
+	KafkaConfig `yaml:",inline"`
+
+	// Bootstrap is the URL of a broker of the cluster the receiver consumes from, either kafka://host[:port] or
+	// kafkas://host[:port].
+	Bootstrap string `json:"bootstrap" yaml:"bootstrap"`
+	// Group is the consumer group the receiver joins, the offsets of handled events are committed to the group so
+	// that a receiver joining the same group resumes from them. When not specified the receiver joins a group unique
+	// to the test.
+	Group string `json:"group" yaml:"group"`
+	// FromBeginning consumes the partitions without committed offsets from their earliest offset, when not specified
+	// the receiver consumes the events produced after it started.
+	FromBeginning bool `json:"fromBeginning" yaml:"fromBeginning"`
+	// VerifyPersisted re-consumes the topic from the earliest offset after the test and cross-checks the persisted
+	// events with the received events, so that lost events are reported as not delivered to the consumer or as never
+	// persisted.
+	VerifyPersisted bool `json:"verifyPersisted" yaml:"verifyPersisted"`
+}
+
+const (
+	kafkaCEPrefix    = "ce_"
+	kafkaContentType = "content-type"
+	kafkaClientID    = "sacura"
+
+	// kafkaFetchMaxWait is how long the broker waits for records before responding to a fetch request.
+	kafkaFetchMaxWait = 500 * time.Millisecond
+	// kafkaRedeliveryDelay is how long the receiver waits before handling again an event failing the handler.
+	kafkaRedeliveryDelay = 100 * time.Millisecond
+
+	kafkaConnectTimeout = 30 * time.Second
+	kafkaProduceTimeout = 30 * time.Second
+
+	// kafkaOffsetLatest and kafkaOffsetEarliest are the timestamps of the ListOffsets request returning the latest
+	// and the earliest offset of a partition.
+	kafkaOffsetLatest   int64 = -1
+	kafkaOffsetEarliest int64 = -2
+)
+
+func (c *KafkaConfig) validate(field string) error {
+	if !validKafkaTopic(c.Topic) {
+		return invalidErr(field+".topic", fmt.Errorf("%q must be a topic name", c.Topic))
+	}
+	if c.Password != "" && c.Username == "" {
+		return invalidErr(field+".username", errors.New("must be specified with a password"))
+	}
+	return nil
+}
+
+// validKafkaTopic reports whether the given topic name is a legal Kafka topic name.
+func validKafkaTopic(topic string) bool {
+	if topic == "" || topic == "." || topic == ".." || len(topic) > 249 {
+		return false
+	}
+	for _, r := range topic {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '.' && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func validateKafkaBroker(field, broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return invalidErr(field, err)
+	}
+	if (u.Scheme != "kafka" && u.Scheme != "kafkas") || u.Hostname() == "" {
+		return invalidErr(field, fmt.Errorf("%q must be a kafka:// or kafkas:// URL", broker))
+	}
+	return nil
+}
+
+func (c *SenderConfig) validateKafka() error {
+	if c.Kafka == nil {
+		return invalidErr("sender.kafka", fmt.Errorf("must be specified with the %s protocol", ProtocolKafka))
+	}
+	if err := validateKafkaBroker("sender.target", c.Target); err != nil {
+		return err
+	}
+	if err := c.Kafka.validate("sender.kafka"); err != nil {
+		return err
+	}
+	if c.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolKafka))
+	}
+	if c.Auth != nil {
+		return invalidErr("sender.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol, use sender.kafka.username", ProtocolKafka))
+	}
+	return nil
+}
+
+func (c *ReceiverConfig) validateKafka() error {
+	if c.Kafka == nil {
+		return invalidErr("receiver.kafka", fmt.Errorf("must be specified with the %s protocol", ProtocolKafka))
+	}
+	if err := validateKafkaBroker("receiver.kafka.bootstrap", c.Kafka.Bootstrap); err != nil {
+		return err
+	}
+	if err := c.Kafka.validate("receiver.kafka"); err != nil {
+		return err
+	}
+	if c.Kafka.Group == "" {
+		c.Kafka.Group = "sacura-" + uuid.New().String()
+	}
+	if c.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolKafka))
+	}
+	if c.TLS != nil {
+		return invalidErr("receiver.tls", fmt.Errorf("the receiver doesn't terminate TLS with the %s protocol, use a kafkas:// bootstrap broker", ProtocolKafka))
+	}
+	if c.Auth != nil {
+		return invalidErr("receiver.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol", ProtocolKafka))
+	}
+	return nil
+}
+
+// newKafkaRecord returns the record producing the given event in the binary content mode, hdr carries the trace
+// headers of the request and partitionKeyAttribute is the partition key attribute in ordered mode.
+func newKafkaRecord(e *ce.Event, hdr http.Header, partitionKeyAttribute string) (*kgo.Record, error) {
+	r := &kgo.Record{Value: e.Data()}
+
+	attributes, err := binaryAttributes(e)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range attributes {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: kafkaCEPrefix + a[0], Value: []byte(a[1])})
+	}
+	if ct := e.DataContentType(); ct != "" {
+		r.Headers = append(r.Headers, kgo.RecordHeader{Key: kafkaContentType, Value: []byte(ct)})
+	}
+	if pk, ok := eventPartitionKey(e, partitionKeyAttribute); ok {
+		r.Key = []byte(fmt.Sprint(pk))
+	}
+	for _, h := range traceHeaders {
+		if v := hdr.Get(h); v != "" {
+			r.Headers = append(r.Headers, kgo.RecordHeader{Key: h, Value: []byte(v)})
+		}
+	}
+	return r, nil
+}
+
+// kafkaHeader returns the value of the given header of a record regardless of its case.
+func kafkaHeader(r *kgo.Record, name string) string {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Key, name) {
+			return string(h.Value)
+		}
+	}
+	return ""
+}
+
+// kafkaEvent returns the event of a record in the binary content mode, headers without the ce_ prefix are ignored.
+func kafkaEvent(r *kgo.Record) (*ce.Event, error) {
+	e := ce.NewEvent()
+	for _, h := range r.Headers {
+		if len(h.Key) <= len(kafkaCEPrefix) || !strings.EqualFold(h.Key[:len(kafkaCEPrefix)], kafkaCEPrefix) {
+			continue
+		}
+		if err := setBinaryAttribute(&e, strings.ToLower(h.Key[len(kafkaCEPrefix):]), string(h.Value)); err != nil {
+			return nil, err
+		}
+	}
+	setBinaryData(&e, kafkaHeader(r, kafkaContentType), r.Value)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// kafkaHTTPHeader returns the trace headers carried by the record.
+func kafkaHTTPHeader(r *kgo.Record) http.Header {
+	hdr := http.Header{}
+	for _, h := range traceHeaders {
+		if v := kafkaHeader(r, h); v != "" {
+			hdr.Set(h, v)
+		}
+	}
+	return hdr
+}
+
+// kafkaClientOpts returns the options of a client of the cluster of the given bootstrap broker URL.
+func kafkaClientOpts(bootstrap string, tlsConfig *tls.Config, config *KafkaConfig) ([]kgo.Opt, error) {
+	u, err := url.Parse(bootstrap)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: kafkaConnectTimeout}
+	opts := []kgo.Opt{kgo.ClientID(kafkaClientID)}
+	switch u.Scheme {
+	case "kafka":
+		opts = append(opts, kgo.SeedBrokers(hostPort(u, "9092")), kgo.Dialer(dialer.DialContext))
+	case "kafkas":
+		opts = append(opts, kgo.SeedBrokers(hostPort(u, "9093")), kgo.Dialer((&tls.Dialer{NetDialer: dialer, Config: tlsConfig}).DialContext))
+	default:
+		return nil, fmt.Errorf("unsupported broker URL %q", bootstrap)
+	}
+	if config.Username != "" {
+		opts = append(opts, kgo.SASL(plain.Auth{User: config.Username, Pass: config.Password}.AsMechanism()))
+	}
+	return opts, nil
+}
+
+// kafkaBinding is the protocolBinding of ProtocolKafka.
+type kafkaBinding struct{}
+
+func (kafkaBinding) validateSender(c *SenderConfig) error {
+	return c.validateKafka()
+}
+
+func (kafkaBinding) validateReceiver(c *ReceiverConfig) error {
+	return c.validateKafka()
+}
+
+func (kafkaBinding) newTransport(config *Config) senderTransport {
+	return newKafkaTransport(config)
+}
+
+func (kafkaBinding) startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	return startKafkaReceiver(ctx, config, h)
+}
+
+// resumes is true, a receiver restarting resumes from the offsets committed to its consumer group.
+func (kafkaBinding) resumes() bool {
+	return true
+}
+
+// kafkaTransport is an http.RoundTripper producing the events of the requests built by the targeter to the topic, so
+// that events sent with Kafka are paced, measured and accounted for like with HTTP.
+type kafkaTransport struct {
+	client                *kgo.Client
+	clientErr             error
+	partitionKeyAttribute string
+}
+
+func newKafkaTransport(config *Config) *kafkaTransport {
+	var tlsConfig *tls.Config
+	if config.Sender.TLS != nil {
+		tlsConfig = config.Sender.TLS.Parsed
+	}
+	t := &kafkaTransport{}
+	opts, err := kafkaClientOpts(config.Sender.Target, tlsConfig, config.Sender.Kafka)
+	if err != nil {
+		t.clientErr = err
+	} else {
+		// Records with a key are assigned to partitions like the default partitioner of the Java client.
+		opts = append(opts, kgo.DefaultProduceTopic(config.Sender.Kafka.Topic), kgo.ProduceRequestTimeout(kafkaProduceTimeout))
+		t.client, t.clientErr = kgo.NewClient(opts...)
+	}
+	if config.Ordered != nil {
+		t.partitionKeyAttribute = config.Ordered.partitionKeyAttribute()
+	}
+	return t
+}
+
+func (t *kafkaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.clientErr != nil {
+		return nil, t.clientErr
+	}
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	record, err := newKafkaRecord(&e, req.Header, t.partitionKeyAttribute)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.client.ProduceSync(req.Context(), record).FirstErr(); err != nil {
+		return nil, err
+	}
+	return acceptedResponse(req), nil
+}
+
+func (t *kafkaTransport) close() {
+	if t.client != nil {
+		t.client.Close()
+	}
+}
+
+// startKafkaReceiver joins the consumer group of the receiver and handles the events of the partitions assigned to it
+// until the given context is done, the events of each partition are handled in order and an event failing the handler
+// is handled again, like a redelivery, after kafkaRedeliveryDelay. The offsets of handled events are committed.
+func startKafkaReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	bootstrap, err := url.Parse(config.Kafka.Bootstrap)
+	if err != nil {
+		return err
+	}
+	opts, err := kafkaClientOpts(config.Kafka.Bootstrap, nil, &config.Kafka.KafkaConfig)
+	if err != nil {
+		return err
+	}
+
+	start := kafkaStartFromContext(ctx)
+	if start.IsZero() {
+		start = time.Now()
+	}
+	offset := kgo.NewOffset().AfterMilli(start.UnixMilli())
+	if config.Kafka.FromBeginning {
+		offset = kgo.NewOffset().AtStart()
+	}
+	opts = append(opts,
+		kgo.ConsumerGroup(config.Kafka.Group),
+		kgo.ConsumeTopics(config.Kafka.Topic),
+		kgo.ConsumeResetOffset(offset),
+		kgo.FetchMaxWait(kafkaFetchMaxWait),
+		// Only the offsets of handled events are committed, periodically and when partitions are revoked.
+		kgo.AutoCommitMarks(),
+		kgo.OnPartitionsAssigned(func(context.Context, *kgo.Client, map[string][]int32) {
+			markReceiverReady(ctx)
+		}),
+	)
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for {
+		fetches := client.PollFetches(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		for _, fe := range fetches.Errors() {
+			var dataLoss *kgo.ErrDataLoss
+			if !errors.As(fe.Err, &dataLoss) {
+				return fmt.Errorf("partition %d: %w", fe.Partition, fe.Err)
+			}
+			logger(LogComponentReceiver).Warnw("Records lost", "topic", fe.Topic, "partition", fe.Partition, "error", fe.Err)
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			for ctx.Err() == nil {
+				if err := handleKafkaRecord(ctx, config, bootstrap.Host, r, h); err == nil {
+					client.MarkCommitRecords(r)
+					return
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(kafkaRedeliveryDelay):
+				}
+			}
+		})
+	}
+}
+
+// handleKafkaRecord handles the event of the given record, records that aren't valid events are skipped.
+func handleKafkaRecord(ctx context.Context, config *ReceiverConfig, remoteAddr string, r *kgo.Record, h func(context.Context, *ce.Event, *http.Request) error) error {
+	start := time.Now()
+	req := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: "/" + r.Topic},
+		Header:     kafkaHTTPHeader(r),
+		RemoteAddr: remoteAddr,
+	}
+	defer func() {
+		processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(req, config, processingLatencyHistogramLabels)...)
+	}()
+
+	e, err := kafkaEvent(r)
+	if err != nil {
+		logger(LogComponentReceiver).Warnw("Invalid event", "topic", r.Topic, "partition", r.Partition, "offset", r.Offset, "error", err)
+		return nil
+	}
+	return h(ctx, e, req)
+}
+
+type kafkaStartKey struct{}
+
+// contextWithKafkaStart returns a context carrying the time from which the Kafka receiver consumes the partitions
+// without committed offsets, so that it is kept across restarts of the receiver.
+func contextWithKafkaStart(ctx context.Context, start time.Time) context.Context {
+	return context.WithValue(ctx, kafkaStartKey{}, start)
+}
+
+// kafkaStartFromContext returns the start time carried by the given context, or the zero time.
+func kafkaStartFromContext(ctx context.Context) time.Time {
+	start, _ := ctx.Value(kafkaStartKey{}).(time.Time)
+	return start
+}
+
+// kafkaPartitionOffsets returns the offsets of the partitions of the topic listed with the given timestamp, either
+// kafkaOffsetEarliest or kafkaOffsetLatest.
+func kafkaPartitionOffsets(ctx context.Context, client *kgo.Client, topic string, timestamp int64) (map[int32]int64, error) {
+	metadata := kmsg.NewPtrMetadataRequest()
+	mt := kmsg.NewMetadataRequestTopic()
+	mt.Topic = kmsg.StringPtr(topic)
+	metadata.Topics = append(metadata.Topics, mt)
+	md, err := metadata.RequestWith(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	if len(md.Topics) != 1 {
+		return nil, fmt.Errorf("unexpected metadata of %d topics", len(md.Topics))
+	}
+	if err := kerr.ErrorForCode(md.Topics[0].ErrorCode); err != nil {
+		return nil, err
+	}
+
+	list := kmsg.NewPtrListOffsetsRequest()
+	lt := kmsg.NewListOffsetsRequestTopic()
+	lt.Topic = topic
+	for _, p := range md.Topics[0].Partitions {
+		lp := kmsg.NewListOffsetsRequestTopicPartition()
+		lp.Partition = p.Partition
+		lp.Timestamp = timestamp
+		lt.Partitions = append(lt.Partitions, lp)
+	}
+	list.Topics = append(list.Topics, lt)
+	listed, err := list.RequestWith(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	offsets := make(map[int32]int64)
+	for _, t := range listed.Topics {
+		for _, p := range t.Partitions {
+			if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+				return nil, fmt.Errorf("partition %d: %w", p.Partition, err)
+			}
+			offsets[p.Partition] = p.Offset
+		}
+	}
+	return offsets, nil
+}
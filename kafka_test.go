@@ -0,0 +1,794 @@
+package sacura
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/kmsg"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+func TestKafkaRecordRoundTrip(t *testing.T) {
+
+	binaryEvent := cetest.FullEvent()
+	if err := binaryEvent.SetData("application/octet-stream", []byte{0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	orderedEvent := cetest.FullEvent()
+	orderedEvent.SetExtension(DefaultPartitionKeyExtension, "3")
+
+	tests := []struct {
+		name    string
+		event   ce.Event
+		wantKey []byte
+	}{
+		{
+			name:  "full event",
+			event: cetest.FullEvent(),
+		},
+		{
+			name:  "min event",
+			event: cetest.MinEvent(),
+		},
+		{
+			name:  "binary data",
+			event: binaryEvent,
+		},
+		{
+			name:    "partition key",
+			event:   orderedEvent,
+			wantKey: []byte("3"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := http.Header{}
+			hdr.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+			record, err := newKafkaRecord(&tt.event, hdr, DefaultPartitionKeyExtension)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.wantKey, record.Key); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+			if v := kafkaHTTPHeader(record).Get("traceparent"); v != hdr.Get("traceparent") {
+				t.Errorf("expected traceparent %s, got %s", hdr.Get("traceparent"), v)
+			}
+
+			e, err := kafkaEvent(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Extensions are compared regardless of their order and, like with the HTTP binary content mode, their
+			// type.
+			attributes := func(e *ce.Event) map[string]string {
+				b, err := e.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := map[string]interface{}{}
+				if err := json.Unmarshal(b, &m); err != nil {
+					t.Fatal(err)
+				}
+				s := make(map[string]string, len(m))
+				for k, v := range m {
+					s[k] = fmt.Sprint(v)
+				}
+				return s
+			}
+			if diff := cmp.Diff(attributes(&tt.event), attributes(e)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestKafkaConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sender   SenderConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			sender:   SenderConfig{Target: "kafka://localhost:9092", Kafka: &KafkaConfig{Topic: "sacura.events"}},
+			receiver: ReceiverConfig{Kafka: &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "sacura-events", Username: "user", Password: "password"}, Bootstrap: "kafkas://localhost"}},
+		},
+		{
+			name:     "missing kafka config",
+			sender:   SenderConfig{Target: "kafka://localhost:9092"},
+			receiver: ReceiverConfig{},
+			wantErr:  true,
+		},
+		{
+			name:     "http target",
+			sender:   SenderConfig{Target: "http://localhost:9092", Kafka: &KafkaConfig{Topic: "events"}},
+			receiver: ReceiverConfig{Kafka: &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "events"}, Bootstrap: "localhost:9092"}},
+			wantErr:  true,
+		},
+		{
+			name:     "invalid topics",
+			sender:   SenderConfig{Target: "kafka://localhost:9092", Kafka: &KafkaConfig{Topic: "events/1"}},
+			receiver: ReceiverConfig{Kafka: &ReceiverKafkaConfig{Bootstrap: "kafka://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "password without username",
+			sender:   SenderConfig{Target: "kafka://localhost:9092", Kafka: &KafkaConfig{Topic: "events", Password: "password"}},
+			receiver: ReceiverConfig{Kafka: &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "events", Password: "password"}, Bootstrap: "kafka://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender batches and receiver dead-letter sink",
+			sender:   SenderConfig{Target: "kafka://localhost:9092", Kafka: &KafkaConfig{Topic: "events"}, BatchSize: 10},
+			receiver: ReceiverConfig{Kafka: &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "events"}, Bootstrap: "kafka://localhost"}, DeadLetterSinkPath: "/dls"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.validateKafka(); (err != nil) != tt.wantErr {
+				t.Errorf("sender wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err := tt.receiver.validateKafka(); (err != nil) != tt.wantErr {
+				t.Errorf("receiver wantErr %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && tt.receiver.Kafka.Group == "" {
+				t.Error("expected a consumer group")
+			}
+		})
+	}
+}
+
+// testKafkaBroker is a minimal single broker cluster with a single topic and a group coordinator, record batches
+// produced to a partition are appended to its log as they are and returned by fetch requests.
+type testKafkaBroker struct {
+	listener net.Listener
+	topic    string
+	username string
+	password string
+
+	lock sync.Mutex
+	// logs are the record batches of each partition.
+	logs [][]testKafkaBatch
+	// groups are the consumer groups by name.
+	groups map[string]*testKafkaGroup
+}
+
+type testKafkaBatch struct {
+	firstOffset  int64
+	records      int64
+	maxTimestamp int64
+	b            []byte
+}
+
+type testKafkaGroup struct {
+	generation int32
+	members    int
+	member     string
+	assignment []byte
+	// offsets are the committed offsets by partition.
+	offsets map[int32]int64
+}
+
+// testKafkaAPIVersions are the API versions supported by the broker.
+var testKafkaAPIVersions = map[int16][2]int16{
+	0:  {3, 7}, // Produce.
+	1:  {4, 6}, // Fetch.
+	2:  {1, 3}, // ListOffsets.
+	3:  {1, 6}, // Metadata.
+	8:  {2, 5}, // OffsetCommit.
+	9:  {1, 4}, // OffsetFetch.
+	10: {0, 2}, // FindCoordinator.
+	11: {0, 4}, // JoinGroup.
+	12: {0, 2}, // Heartbeat.
+	13: {0, 2}, // LeaveGroup.
+	14: {0, 2}, // SyncGroup.
+	17: {1, 1}, // SaslHandshake.
+	18: {0, 3}, // ApiVersions.
+	22: {0, 1}, // InitProducerId.
+	36: {0, 1}, // SaslAuthenticate.
+}
+
+func startTestKafkaBroker(t *testing.T, topic string, partitions int, username, password string) *testKafkaBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testKafkaBroker{
+		listener: l,
+		topic:    topic,
+		username: username,
+		password: password,
+		logs:     make([][]testKafkaBatch, partitions),
+		groups:   make(map[string]*testKafkaGroup),
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return b
+}
+
+func (b *testKafkaBroker) url() string {
+	return "kafka://" + b.listener.Addr().String()
+}
+
+// produce produces the given records to their partition.
+func (b *testKafkaBroker) produce(t *testing.T, records ...*kgo.Record) {
+	opts, err := kafkaClientOpts(b.url(), nil, &KafkaConfig{Username: b.username, Password: b.password})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := kgo.NewClient(append(opts, kgo.DefaultProduceTopic(b.topic), kgo.RecordPartitioner(kgo.ManualPartitioner()))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if err := client.ProduceSync(context.Background(), records...).FirstErr(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// records returns the number of records of each partition.
+func (b *testKafkaBroker) records() []int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	records := make([]int64, len(b.logs))
+	for p := range b.logs {
+		records[p] = b.logEnd(int32(p))
+	}
+	return records
+}
+
+// logEnd returns the offset of the next record of the given partition, the caller holds the lock.
+func (b *testKafkaBroker) logEnd(partition int32) int64 {
+	log := b.logs[partition]
+	if len(log) == 0 {
+		return 0
+	}
+	return log[len(log)-1].firstOffset + log[len(log)-1].records
+}
+
+func (b *testKafkaBroker) serve(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	authenticated := b.username == ""
+	for {
+		size := make([]byte, 4)
+		if _, err := io.ReadFull(r, size); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint32(size))
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		d := kbin.Reader{Src: buf}
+		key, version, correlationID := d.Int16(), d.Int16(), d.Int32()
+		d.NullableString() // Client ID.
+		req := kmsg.RequestForKey(key)
+		if req == nil {
+			return
+		}
+		req.SetVersion(version)
+		if req.IsFlexible() {
+			for n := d.Uvarint(); n > 0; n-- {
+				d.Uvarint()
+				d.Span(int(d.Uvarint()))
+			}
+		}
+		if err := req.ReadFrom(d.Src); err != nil {
+			return
+		}
+
+		var resp kmsg.Response
+		switch req := req.(type) {
+		case *kmsg.ApiVersionsRequest:
+			resp = b.apiVersions()
+		case *kmsg.SASLHandshakeRequest:
+			resp = &kmsg.SASLHandshakeResponse{SupportedMechanisms: []string{"PLAIN"}}
+		case *kmsg.SASLAuthenticateRequest:
+			r := kmsg.NewPtrSASLAuthenticateResponse()
+			if string(req.SASLAuthBytes) == "\x00"+b.username+"\x00"+b.password {
+				authenticated = true
+			} else {
+				r.ErrorCode = kerr.SaslAuthenticationFailed.Code
+				r.ErrorMessage = kmsg.StringPtr("invalid credentials")
+			}
+			resp = r
+		default:
+			if !authenticated {
+				return
+			}
+			resp = b.handle(req)
+		}
+
+		resp.SetVersion(version)
+		out := make([]byte, 8, 64)
+		binary.BigEndian.PutUint32(out[4:], uint32(correlationID))
+		if resp.IsFlexible() && key != kmsg.ApiVersions.Int16() {
+			// The response header of flexible versions has tagged fields, but the one of ApiVersions.
+			out = append(out, 0)
+		}
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func (b *testKafkaBroker) apiVersions() kmsg.Response {
+	resp := kmsg.NewPtrApiVersionsResponse()
+	for key, versions := range testKafkaAPIVersions {
+		v := kmsg.NewApiVersionsResponseApiKey()
+		v.ApiKey, v.MinVersion, v.MaxVersion = key, versions[0], versions[1]
+		resp.ApiKeys = append(resp.ApiKeys, v)
+	}
+	return resp
+}
+
+func (b *testKafkaBroker) handle(req kmsg.Request) kmsg.Response {
+	switch req := req.(type) {
+	case *kmsg.MetadataRequest:
+		return b.metadata(req)
+	case *kmsg.InitProducerIDRequest:
+		resp := kmsg.NewPtrInitProducerIDResponse()
+		resp.ProducerID = 1
+		return resp
+	case *kmsg.ProduceRequest:
+		return b.produceRecords(req)
+	case *kmsg.ListOffsetsRequest:
+		return b.listOffsets(req)
+	case *kmsg.FetchRequest:
+		return b.fetch(req)
+	case *kmsg.FindCoordinatorRequest:
+		host, port := b.hostPort()
+		resp := kmsg.NewPtrFindCoordinatorResponse()
+		resp.NodeID, resp.Host, resp.Port = 1, host, port
+		return resp
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	switch req := req.(type) {
+	case *kmsg.JoinGroupRequest:
+		g := b.group(req.Group)
+		g.generation++
+		g.members++
+		g.member = fmt.Sprintf("member-%d", g.members)
+		if req.MemberID != "" {
+			g.member = req.MemberID
+		}
+		resp := kmsg.NewPtrJoinGroupResponse()
+		resp.Generation, resp.Protocol, resp.LeaderID, resp.MemberID = g.generation, &req.Protocols[0].Name, g.member, g.member
+		m := kmsg.NewJoinGroupResponseMember()
+		m.MemberID, m.ProtocolMetadata = g.member, req.Protocols[0].Metadata
+		resp.Members = append(resp.Members, m)
+		return resp
+	case *kmsg.SyncGroupRequest:
+		g := b.group(req.Group)
+		for _, a := range req.GroupAssignment {
+			if a.MemberID == req.MemberID {
+				g.assignment = a.MemberAssignment
+			}
+		}
+		resp := kmsg.NewPtrSyncGroupResponse()
+		resp.MemberAssignment = g.assignment
+		return resp
+	case *kmsg.HeartbeatRequest:
+		return kmsg.NewPtrHeartbeatResponse()
+	case *kmsg.LeaveGroupRequest:
+		return kmsg.NewPtrLeaveGroupResponse()
+	case *kmsg.OffsetCommitRequest:
+		g := b.group(req.Group)
+		resp := kmsg.NewPtrOffsetCommitResponse()
+		for _, t := range req.Topics {
+			rt := kmsg.NewOffsetCommitResponseTopic()
+			rt.Topic = t.Topic
+			for _, p := range t.Partitions {
+				g.offsets[p.Partition] = p.Offset
+				rp := kmsg.NewOffsetCommitResponseTopicPartition()
+				rp.Partition = p.Partition
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+		}
+		return resp
+	case *kmsg.OffsetFetchRequest:
+		g := b.group(req.Group)
+		resp := kmsg.NewPtrOffsetFetchResponse()
+		for _, t := range req.Topics {
+			rt := kmsg.NewOffsetFetchResponseTopic()
+			rt.Topic = t.Topic
+			for _, p := range t.Partitions {
+				rp := kmsg.NewOffsetFetchResponseTopicPartition()
+				rp.Partition, rp.Offset = p, -1
+				if offset, ok := g.offsets[p]; ok {
+					rp.Offset = offset
+				}
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+		}
+		return resp
+	}
+	return req.ResponseKind()
+}
+
+// group returns the group with the given name, the caller holds the lock.
+func (b *testKafkaBroker) group(name string) *testKafkaGroup {
+	g, ok := b.groups[name]
+	if !ok {
+		g = &testKafkaGroup{offsets: make(map[int32]int64)}
+		b.groups[name] = g
+	}
+	return g
+}
+
+// committed returns the offsets committed by the given group.
+func (b *testKafkaBroker) committed(name string) map[int32]int64 {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	offsets := make(map[int32]int64)
+	if g, ok := b.groups[name]; ok {
+		for p, offset := range g.offsets {
+			offsets[p] = offset
+		}
+	}
+	return offsets
+}
+
+func (b *testKafkaBroker) hostPort() (string, int32) {
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return host, int32(p)
+}
+
+func (b *testKafkaBroker) metadata(req *kmsg.MetadataRequest) kmsg.Response {
+	resp := kmsg.NewPtrMetadataResponse()
+	broker := kmsg.NewMetadataResponseBroker()
+	broker.NodeID = 1
+	broker.Host, broker.Port = b.hostPort()
+	resp.Brokers = append(resp.Brokers, broker)
+	resp.ControllerID = 1
+
+	topics := []string{b.topic}
+	if req.Topics != nil {
+		topics = nil
+		for _, t := range req.Topics {
+			topics = append(topics, *t.Topic)
+		}
+	}
+	for _, topic := range topics {
+		t := kmsg.NewMetadataResponseTopic()
+		t.Topic = kmsg.StringPtr(topic)
+		if topic != b.topic {
+			t.ErrorCode = kerr.UnknownTopicOrPartition.Code
+		} else {
+			for i := range b.logs {
+				p := kmsg.NewMetadataResponseTopicPartition()
+				p.Partition, p.Leader, p.Replicas, p.ISR = int32(i), 1, []int32{1}, []int32{1}
+				t.Partitions = append(t.Partitions, p)
+			}
+		}
+		resp.Topics = append(resp.Topics, t)
+	}
+	return resp
+}
+
+func (b *testKafkaBroker) produceRecords(req *kmsg.ProduceRequest) kmsg.Response {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	resp := kmsg.NewPtrProduceResponse()
+	for _, t := range req.Topics {
+		rt := kmsg.NewProduceResponseTopic()
+		rt.Topic = t.Topic
+		for _, p := range t.Partitions {
+			rp := kmsg.NewProduceResponseTopicPartition()
+			rp.Partition = p.Partition
+			batch := kmsg.NewRecordBatch()
+			switch {
+			case t.Topic != b.topic || int(p.Partition) >= len(b.logs):
+				rp.ErrorCode = kerr.UnknownTopicOrPartition.Code
+			case batch.ReadFrom(p.Records) != nil:
+				rp.ErrorCode = kerr.CorruptMessage.Code
+			default:
+				// The batch is appended as it is, with the offset of its first record and the leader epoch set like
+				// brokers do, neither is covered by the CRC of the batch.
+				rp.BaseOffset = b.logEnd(p.Partition)
+				raw := append([]byte(nil), p.Records...)
+				binary.BigEndian.PutUint64(raw, uint64(rp.BaseOffset))
+				binary.BigEndian.PutUint32(raw[12:], 0)
+				b.logs[p.Partition] = append(b.logs[p.Partition], testKafkaBatch{
+					firstOffset:  rp.BaseOffset,
+					records:      int64(batch.LastOffsetDelta) + 1,
+					maxTimestamp: batch.MaxTimestamp,
+					b:            raw,
+				})
+			}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+	}
+	return resp
+}
+
+func (b *testKafkaBroker) listOffsets(req *kmsg.ListOffsetsRequest) kmsg.Response {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	resp := kmsg.NewPtrListOffsetsResponse()
+	for _, t := range req.Topics {
+		rt := kmsg.NewListOffsetsResponseTopic()
+		rt.Topic = t.Topic
+		for _, p := range t.Partitions {
+			rp := kmsg.NewListOffsetsResponseTopicPartition()
+			rp.Partition = p.Partition
+			switch p.Timestamp {
+			case kafkaOffsetEarliest:
+				rp.Offset = 0
+			case kafkaOffsetLatest:
+				rp.Offset = b.logEnd(p.Partition)
+			default:
+				// The first batch with records at or after the timestamp.
+				rp.Offset = -1
+				for _, batch := range b.logs[p.Partition] {
+					if batch.maxTimestamp >= p.Timestamp {
+						rp.Offset = batch.firstOffset
+						break
+					}
+				}
+			}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+	}
+	return resp
+}
+
+func (b *testKafkaBroker) fetch(req *kmsg.FetchRequest) kmsg.Response {
+	// Wait for records to fetch, like a broker does up to the max wait.
+	deadline := time.Now().Add(time.Duration(req.MaxWaitMillis) * time.Millisecond)
+	for {
+		b.lock.Lock()
+		available := false
+		for _, t := range req.Topics {
+			for _, p := range t.Partitions {
+				available = available || (t.Topic == b.topic && b.logEnd(p.Partition) > p.FetchOffset)
+			}
+		}
+		if available || time.Now().After(deadline) {
+			break
+		}
+		b.lock.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	defer b.lock.Unlock()
+
+	resp := kmsg.NewPtrFetchResponse()
+	for _, t := range req.Topics {
+		rt := kmsg.NewFetchResponseTopic()
+		rt.Topic = t.Topic
+		for _, p := range t.Partitions {
+			rp := kmsg.NewFetchResponseTopicPartition()
+			rp.Partition = p.Partition
+			if t.Topic != b.topic {
+				rp.ErrorCode = kerr.UnknownTopicOrPartition.Code
+			} else {
+				rp.HighWatermark = b.logEnd(p.Partition)
+				rp.LastStableOffset = rp.HighWatermark
+				// Batches are returned whole, including the records before the fetch offset.
+				for _, batch := range b.logs[p.Partition] {
+					if batch.firstOffset+batch.records > p.FetchOffset {
+						rp.RecordBatches = append(rp.RecordBatches, batch.b...)
+					}
+				}
+			}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+	}
+	return resp
+}
+
+func TestStartReceiverKafka(t *testing.T) {
+
+	broker := startTestKafkaBroker(t, "events", 3, "user", "password")
+	kafka := KafkaConfig{Topic: "events", Username: "user", Password: "password"}
+	receiver := ReceiverConfig{
+		Protocol: ProtocolKafka,
+		Kafka:    &ReceiverKafkaConfig{KafkaConfig: kafka, Bootstrap: broker.url(), Group: "sacura"},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, receiver, received, nil)
+	}()
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             broker.url(),
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolKafka,
+			Kafka:              &kafka,
+		},
+		Ordered:        &OrderedConfig{NumPartitionKeys: 2},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+
+	// Events of the same partition key are produced to the same partition and received in order.
+	want := make(map[string][]string)
+	for e := range sent {
+		pk := fmt.Sprint(e.Extensions()[DefaultPartitionKeyExtension])
+		want[pk] = append(want[pk], e.ID())
+	}
+	got := make(map[string][]string)
+	for i := 0; i < 10; i++ {
+		r := <-received
+		pk := fmt.Sprint(r.Event.Extensions()[DefaultPartitionKeyExtension])
+		got[pk] = append(got[pk], r.Event.ID())
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// The offsets of the handled events are committed when the receiver leaves the group.
+	records := broker.records()
+	wantCommitted := make(map[int32]int64)
+	for p, n := range records {
+		if n > 0 {
+			wantCommitted[int32(p)] = n
+		}
+	}
+	if diff := cmp.Diff(wantCommitted, broker.committed("sacura")); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStartKafkaReceiverRedelivery(t *testing.T) {
+
+	broker := startTestKafkaBroker(t, "events", 1, "", "")
+	if processingLatencyHistogram == nil {
+		// The receiver records processing latencies in the histogram created by StartReceiver.
+		var err error
+		processingLatencyHistogram, err = global.Meter("sacura").SyncInt64().Histogram("processing_latency_ms")
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	event := func(id string) *kgo.Record {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		record, err := newKafkaRecord(&e, http.Header{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return record
+	}
+	broker.produce(t, event("0"), event("1"), event("2"))
+
+	config := &ReceiverConfig{Kafka: &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "events"}, Bootstrap: broker.url(), Group: "sacura", FromBeginning: true}}
+	handled := make(chan string, 10)
+	receive := func(ctx context.Context, failID string) chan error {
+		failed := false
+		errChan := make(chan error, 1)
+		go func() {
+			errChan <- startKafkaReceiver(ctx, config, func(ctx context.Context, e *ce.Event, r *http.Request) error {
+				handled <- e.ID()
+				if e.ID() == failID && !failed {
+					failed = true
+					return errors.New("injected failure")
+				}
+				return nil
+			})
+		}()
+		return errChan
+	}
+	wait := func(n int) []string {
+		var got []string
+		for len(got) < n {
+			select {
+			case id := <-handled:
+				got = append(got, id)
+			case <-time.After(10 * time.Second):
+				t.Fatalf("expected %d handled events, got %v", n, got)
+			}
+		}
+		return got
+	}
+
+	// The receiver handles again the event failing the handler.
+	ctx, cancel := context.WithCancel(context.Background())
+	errChan := receive(ctx, "1")
+	if diff := cmp.Diff([]string{"0", "1", "1", "2"}, wait(4)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	// A receiver joining the same group resumes from the committed offsets.
+	broker.produce(t, event("3"))
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	errChan = receive(ctx, "")
+	if diff := cmp.Diff([]string{"3"}, wait(1)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestKafkaTransportUnknownTopic(t *testing.T) {
+
+	broker := startTestKafkaBroker(t, "events", 1, "", "")
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, broker.url(), strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := newKafkaTransport(&Config{Sender: SenderConfig{Target: broker.url(), Kafka: &KafkaConfig{Topic: "other"}}})
+	defer transport.close()
+	if _, err := transport.RoundTrip(req); !errors.Is(err, kerr.UnknownTopicOrPartition) {
+		t.Errorf("expected unknown topic error, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// kafkaReplayTimeout bounds the time spent re-consuming the topic of the receiver after the test.
+const kafkaReplayTimeout = 5 * time.Minute
+
+// KafkaReplayReport classifies lost events by whether they have been persisted in the topic of the Kafka receiver,
+// re-consumed from the earliest offset after the test.
+type KafkaReplayReport struct {
+	// PersistedCount is the number of unique events found in the topic.
+	PersistedCount int `json:"persistedCount"`
+	// NotDeliveredCount is the number of lost events persisted in the topic, they haven't been delivered to the
+	// consumer. NotDeliveredEventsByPartitionKey collects them by partition key.
+	NotDeliveredCount                int                 `json:"notDeliveredCount"`
+	NotDeliveredEventsByPartitionKey map[string][]string `json:"notDeliveredEvents,omitempty"`
+	// NeverPersistedCount is the number of lost events not found in the topic, they have never been persisted.
+	// NeverPersistedEventsByPartitionKey collects them by partition key.
+	NeverPersistedCount                int                 `json:"neverPersistedCount"`
+	NeverPersistedEventsByPartitionKey map[string][]string `json:"neverPersistedEvents,omitempty"`
+}
+
+// replayKafkaTopic re-consumes the topic from the earliest offset of each partition up to its latest offset when it
+// is called, and calls handle with each record.
+func replayKafkaTopic(ctx context.Context, bootstrapURL string, config *KafkaConfig, handle func(*kgo.Record)) error {
+	opts, err := kafkaClientOpts(bootstrapURL, nil, config)
+	if err != nil {
+		return err
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	earliest, err := kafkaPartitionOffsets(ctx, client, config.Topic, kafkaOffsetEarliest)
+	if err != nil {
+		client.Close()
+		return err
+	}
+	latest, err := kafkaPartitionOffsets(ctx, client, config.Topic, kafkaOffsetLatest)
+	client.Close()
+	if err != nil {
+		return err
+	}
+
+	partitions := make(map[int32]kgo.Offset)
+	for p, offset := range earliest {
+		if offset < latest[p] {
+			partitions[p] = kgo.NewOffset().At(offset)
+		}
+	}
+	if len(partitions) == 0 {
+		return nil
+	}
+	// Control records are consumed too, so that partitions ending with a transaction marker are read up to their
+	// latest offset.
+	client, err = kgo.NewClient(append(opts, kgo.ConsumePartitions(map[string]map[int32]kgo.Offset{config.Topic: partitions}), kgo.KeepControlRecords())...)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	for len(partitions) > 0 {
+		fetches := client.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		for _, fe := range fetches.Errors() {
+			return fmt.Errorf("partition %d: %w", fe.Partition, fe.Err)
+		}
+		fetches.EachRecord(func(r *kgo.Record) {
+			if _, ok := partitions[r.Partition]; !ok || r.Offset >= latest[r.Partition] {
+				return
+			}
+			if !r.Attrs.IsControl() {
+				handle(r)
+			}
+			if r.Offset+1 >= latest[r.Partition] {
+				delete(partitions, r.Partition)
+			}
+		})
+	}
+	return nil
+}
+
+// recordKafkaReplay re-consumes the topic of the Kafka receiver and records the persisted events, lost events are
+// left unclassified when the topic can't be re-consumed.
+func (s *StateManager) recordKafkaReplay(ctx context.Context, config *ReceiverKafkaConfig) {
+	logger(LogComponentReceiver).Infow("Re-consuming topic from the earliest offset", "topic", config.Topic)
+	ctx, cancel := context.WithTimeout(ctx, kafkaReplayTimeout)
+	defer cancel()
+	persisted := make(map[string]struct{})
+	err := replayKafkaTopic(ctx, config.Bootstrap, &config.KafkaConfig, func(r *kgo.Record) {
+		if id := kafkaHeader(r, kafkaCEPrefix+"id"); id != "" {
+			persisted[id] = struct{}{}
+		}
+	})
+	if err != nil {
+		logger(LogComponentReceiver).Errorw("Failed to re-consume topic", "topic", config.Topic, "error", err)
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.persisted = persisted
+}
+
+// kafkaReplayReport classifies the lost events of the given report, it must be called while holding the lock and
+// before lost events are truncated.
+func (s *StateManager) kafkaReplayReport(r *Report) {
+	if s.persisted == nil {
+		return
+	}
+	kr := &KafkaReplayReport{
+		PersistedCount:                     len(s.persisted),
+		NotDeliveredEventsByPartitionKey:   make(map[string][]string),
+		NeverPersistedEventsByPartitionKey: make(map[string][]string),
+	}
+	for pk, ids := range r.LostEventsByPartitionKey {
+		for _, id := range ids {
+			if _, ok := s.persisted[id]; ok {
+				kr.NotDeliveredEventsByPartitionKey[pk] = append(kr.NotDeliveredEventsByPartitionKey[pk], id)
+				kr.NotDeliveredCount++
+			} else {
+				kr.NeverPersistedEventsByPartitionKey[pk] = append(kr.NeverPersistedEventsByPartitionKey[pk], id)
+				kr.NeverPersistedCount++
+			}
+		}
+	}
+	for _, m := range []map[string][]string{kr.NotDeliveredEventsByPartitionKey, kr.NeverPersistedEventsByPartitionKey} {
+		for _, ids := range m {
+			sort.Strings(ids)
+		}
+	}
+	r.KafkaReplay = kr
+}
@@ -0,0 +1,78 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestStateManagerKafkaReplay(t *testing.T) {
+	broker := startTestKafkaBroker(t, "events", 2, "", "")
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+	// Events 0 to 3 are persisted, event 4 is not.
+	for i := 0; i < 4; i++ {
+		e := event(fmt.Sprint(i))
+		record, err := newKafkaRecord(&e, http.Header{}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		record.Partition = int32(i % 2)
+		broker.produce(t, record)
+	}
+
+	sent := make(chan ce.Event, 5)
+	received := make(chan ReceivedEvent, 1)
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+	for i := 0; i < 5; i++ {
+		sent <- event(fmt.Sprint(i))
+	}
+	received <- ReceivedEvent{Event: event("0")}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	sm.recordKafkaReplay(context.Background(), &ReceiverKafkaConfig{KafkaConfig: KafkaConfig{Topic: "events"}, Bootstrap: broker.url(), VerifyPersisted: true})
+	sm.Terminated(Metrics{AcceptedCount: 5})
+	report := sm.GenerateReport()
+
+	want := &KafkaReplayReport{
+		PersistedCount:                     4,
+		NotDeliveredCount:                  3,
+		NotDeliveredEventsByPartitionKey:   map[string][]string{unknownPartitionKey: {"1", "2", "3"}},
+		NeverPersistedCount:                1,
+		NeverPersistedEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"4"}},
+	}
+	if diff := cmp.Diff(want, report.KafkaReplay); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.LostCount != 4 {
+		t.Errorf("want 4 lost events, got %d", report.LostCount)
+	}
+}
+
+func TestReplayKafkaTopicEmpty(t *testing.T) {
+	broker := startTestKafkaBroker(t, "events", 3, "", "")
+	var ids []string
+	err := replayKafkaTopic(context.Background(), broker.url(), &KafkaConfig{Topic: "events"}, func(r *kgo.Record) {
+		ids = append(ids, kafkaHeader(r, kafkaCEPrefix+"id"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("want no persisted events, got %v", ids)
+	}
+}
@@ -0,0 +1,370 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// DefaultKnativeResourceName is the name of the provisioned Knative resources when none is configured.
+	DefaultKnativeResourceName = "sacura"
+	// DefaultKnativeChannelAPIVersion is the API version of the provisioned channel when none is configured.
+	DefaultKnativeChannelAPIVersion = "messaging.knative.dev/v1"
+	// DefaultKnativeChannelKind is the kind of the provisioned channel when none is configured.
+	DefaultKnativeChannelKind = "InMemoryChannel"
+	// DefaultKnativeReadyTimeout is the maximum time to wait for the provisioned resources to be ready when none is
+	// configured.
+	DefaultKnativeReadyTimeout = 2 * time.Minute
+)
+
+// knativeReadyInterval is the interval between readiness checks of the provisioned resources.
+var knativeReadyInterval = time.Second
+
+// KnativeConfig provisions a Broker and a Trigger, or a channel and a Subscription, routing events to the receiver,
+// before the test and deletes them after the test, so that sacura runs as a self-contained conformance job.
+//
+// sacura must run in-cluster, the service account of the pod must be allowed to patch, get and delete the resources.
+// When sender.target is not specified, events are sent to the address of the Broker or of the channel.
+type KnativeConfig struct {
+	// Namespace is the namespace of the resources.
+	//
+	// Defaults to the namespace of the pod.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// Broker provisions a Broker and a Trigger.
+	Broker *KnativeBrokerConfig `json:"broker" yaml:"broker"`
+	// Channel provisions a channel and a Subscription.
+	Channel *KnativeChannelConfig `json:"channel" yaml:"channel"`
+	// SubscriberURI is the URI of the receiver the Trigger or the Subscription delivers events to, for example
+	// http://sacura.e2e.svc.cluster.local:8080.
+	SubscriberURI string `json:"subscriberURI" yaml:"subscriberURI"`
+	// ReadyTimeout is the maximum time to wait for the resources to be ready, for example 5m.
+	//
+	// Defaults to DefaultKnativeReadyTimeout.
+	ReadyTimeout string `json:"readyTimeout" yaml:"readyTimeout"`
+	// Keep keeps the resources after the test, for example to inspect them when the test fails.
+	Keep bool `json:"keep" yaml:"keep"`
+
+	ParsedReadyTimeout time.Duration
+}
+
+// KnativeBrokerConfig configures the provisioned Broker and Trigger.
+type KnativeBrokerConfig struct {
+	// Name is the name of the Broker.
+	//
+	// Defaults to DefaultKnativeResourceName.
+	Name string `json:"name" yaml:"name"`
+	// Class is the eventing.knative.dev/broker.class annotation of the Broker, for example Kafka.
+	//
+	// Defaults to the default class of the cluster.
+	Class string `json:"class" yaml:"class"`
+	// TriggerName is the name of the Trigger.
+	//
+	// Defaults to the name of the Broker.
+	TriggerName string `json:"triggerName" yaml:"triggerName"`
+	// Filter is the attributes filter of the Trigger, events not matching it aren't delivered.
+	Filter map[string]string `json:"filter" yaml:"filter"`
+}
+
+// KnativeChannelConfig configures the provisioned channel and Subscription.
+type KnativeChannelConfig struct {
+	// Name is the name of the channel.
+	//
+	// Defaults to DefaultKnativeResourceName.
+	Name string `json:"name" yaml:"name"`
+	// APIVersion is the API version of the channel, for example messaging.knative.dev/v1beta1 for a KafkaChannel.
+	//
+	// Defaults to DefaultKnativeChannelAPIVersion.
+	APIVersion string `json:"apiVersion" yaml:"apiVersion"`
+	// Kind is the kind of the channel, for example KafkaChannel.
+	//
+	// Defaults to DefaultKnativeChannelKind.
+	Kind string `json:"kind" yaml:"kind"`
+	// SubscriptionName is the name of the Subscription.
+	//
+	// Defaults to the name of the channel.
+	SubscriptionName string `json:"subscriptionName" yaml:"subscriptionName"`
+}
+
+func (c *KnativeConfig) validate() error {
+	if (c.Broker == nil) == (c.Channel == nil) {
+		return invalidErr("knative", errors.New("exactly one of broker or channel must be specified"))
+	}
+	if c.Namespace != "" && !isDNSSubdomain(c.Namespace) {
+		return invalidErr("knative.namespace", fmt.Errorf("%q is not a valid namespace", c.Namespace))
+	}
+	if u, err := url.Parse(c.SubscriberURI); err != nil || !u.IsAbs() {
+		return invalidErr("knative.subscriberURI", fmt.Errorf("%q must be an absolute URI: %v", c.SubscriberURI, err))
+	}
+
+	if c.Broker != nil {
+		if c.Broker.Name == "" {
+			c.Broker.Name = DefaultKnativeResourceName
+		}
+		if c.Broker.TriggerName == "" {
+			c.Broker.TriggerName = c.Broker.Name
+		}
+		for _, name := range []string{c.Broker.Name, c.Broker.TriggerName} {
+			if !isDNSSubdomain(name) {
+				return invalidErr("knative.broker", fmt.Errorf("%q is not a valid name", name))
+			}
+		}
+	}
+	if c.Channel != nil {
+		if c.Channel.Name == "" {
+			c.Channel.Name = DefaultKnativeResourceName
+		}
+		if c.Channel.SubscriptionName == "" {
+			c.Channel.SubscriptionName = c.Channel.Name
+		}
+		if c.Channel.APIVersion == "" {
+			c.Channel.APIVersion = DefaultKnativeChannelAPIVersion
+		}
+		if c.Channel.Kind == "" {
+			c.Channel.Kind = DefaultKnativeChannelKind
+		}
+		for _, name := range []string{c.Channel.Name, c.Channel.SubscriptionName} {
+			if !isDNSSubdomain(name) {
+				return invalidErr("knative.channel", fmt.Errorf("%q is not a valid name", name))
+			}
+		}
+		if !strings.Contains(c.Channel.APIVersion, "/") {
+			return invalidErr("knative.channel.apiVersion", fmt.Errorf("%q must be of the form group/version", c.Channel.APIVersion))
+		}
+	}
+
+	c.ParsedReadyTimeout = DefaultKnativeReadyTimeout
+	if c.ReadyTimeout != "" {
+		var err error
+		c.ParsedReadyTimeout, err = time.ParseDuration(c.ReadyTimeout)
+		if err != nil {
+			return invalidErr("knative.readyTimeout", err)
+		}
+		if c.ParsedReadyTimeout <= 0 {
+			return invalidErr("knative.readyTimeout", errors.New("must be greater than 0"))
+		}
+	}
+	return nil
+}
+
+// knativeResource is a provisioned Knative resource.
+type knativeResource struct {
+	resource schema.GroupVersionResource
+	object   *unstructured.Unstructured
+}
+
+func (r knativeResource) String() string {
+	return r.resource.GroupVersion().String() + "/" + r.resource.Resource + "/" + r.object.GetName()
+}
+
+// knativeResourceStatus is the part of a Knative resource sacura reads, following the Knative duck types.
+type knativeResourceStatus struct {
+	Metadata struct {
+		Generation int64 `json:"generation"`
+	} `json:"metadata"`
+	Status struct {
+		ObservedGeneration int64 `json:"observedGeneration"`
+		Conditions         []struct {
+			Type    string `json:"type"`
+			Status  string `json:"status"`
+			Reason  string `json:"reason"`
+			Message string `json:"message"`
+		} `json:"conditions"`
+		Address struct {
+			URL string `json:"url"`
+		} `json:"address"`
+	} `json:"status"`
+}
+
+// ready returns true when the resource is ready, otherwise the reason why it isn't.
+func (s *knativeResourceStatus) ready() (bool, string) {
+	if s.Status.ObservedGeneration < s.Metadata.Generation {
+		return false, fmt.Sprintf("generation %d not observed yet", s.Metadata.Generation)
+	}
+	for _, c := range s.Status.Conditions {
+		if c.Type == "Ready" {
+			return c.Status == "True", fmt.Sprintf("%s: %s", c.Reason, c.Message)
+		}
+	}
+	return false, "no Ready condition"
+}
+
+// knativeResources returns the resources to provision in the order they're created, events are sent to the address
+// of the first one.
+func knativeResources(config *KnativeConfig, namespace string) []knativeResource {
+	object := func(apiVersion, kind, name string, annotations map[string]string, spec map[string]interface{}) *unstructured.Unstructured {
+		u := &unstructured.Unstructured{}
+		u.SetAPIVersion(apiVersion)
+		u.SetKind(kind)
+		u.SetName(name)
+		u.SetNamespace(namespace)
+		u.SetLabels(map[string]string{"app.kubernetes.io/name": "sacura"})
+		if len(annotations) > 0 {
+			u.SetAnnotations(annotations)
+		}
+		if spec != nil {
+			u.Object["spec"] = spec
+		}
+		return u
+	}
+	subscriber := map[string]interface{}{"uri": config.SubscriberURI}
+
+	if b := config.Broker; b != nil {
+		var annotations map[string]string
+		if b.Class != "" {
+			annotations = map[string]string{"eventing.knative.dev/broker.class": b.Class}
+		}
+		trigger := map[string]interface{}{"broker": b.Name, "subscriber": subscriber}
+		if len(b.Filter) > 0 {
+			attributes := make(map[string]interface{}, len(b.Filter))
+			for k, v := range b.Filter {
+				attributes[k] = v
+			}
+			trigger["filter"] = map[string]interface{}{"attributes": attributes}
+		}
+		eventing := schema.GroupVersion{Group: "eventing.knative.dev", Version: "v1"}
+		return []knativeResource{
+			{
+				resource: eventing.WithResource("brokers"),
+				object:   object(eventing.String(), "Broker", b.Name, annotations, nil),
+			},
+			{
+				resource: eventing.WithResource("triggers"),
+				object:   object(eventing.String(), "Trigger", b.TriggerName, nil, trigger),
+			},
+		}
+	}
+
+	ch := config.Channel
+	// The API version is validated.
+	channel, _ := schema.ParseGroupVersion(ch.APIVersion)
+	channelResource, _ := meta.UnsafeGuessKindToResource(channel.WithKind(ch.Kind))
+	messaging := schema.GroupVersion{Group: "messaging.knative.dev", Version: "v1"}
+	return []knativeResource{
+		{
+			resource: channelResource,
+			object:   object(ch.APIVersion, ch.Kind, ch.Name, nil, nil),
+		},
+		{
+			resource: messaging.WithResource("subscriptions"),
+			object: object(messaging.String(), "Subscription", ch.SubscriptionName, nil, map[string]interface{}{
+				"channel":    map[string]interface{}{"apiVersion": ch.APIVersion, "kind": ch.Kind, "name": ch.Name},
+				"subscriber": subscriber,
+			}),
+		},
+	}
+}
+
+// provisionKnative creates the configured Knative resources, waits for them to be ready and returns the address
+// events are sent to and a function deleting the resources.
+func provisionKnative(ctx context.Context, config *KnativeConfig) (string, func(), error) {
+	restConfig, err := kubernetesConfig()
+	if err != nil {
+		return "", nil, err
+	}
+	client, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return "", nil, err
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		if namespace, err = podNamespace(); err != nil {
+			return "", nil, err
+		}
+	}
+	resources := knativeResources(config, namespace)
+
+	var created []knativeResource
+	teardown := func() {
+		if config.Keep {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		for i := len(created) - 1; i >= 0; i-- {
+			r := created[i]
+			err := client.Resource(r.resource).Namespace(namespace).Delete(ctx, r.object.GetName(), metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				logger(logComponentRun).Errorw("Failed to delete Knative resource", "resource", r.String(), "error", err)
+				continue
+			}
+			logger(logComponentRun).Infow("Deleted Knative resource", "resource", r.String())
+		}
+	}
+
+	force := true
+	for _, r := range resources {
+		// Server-side apply, the dynamic client has no Apply method.
+		b, err := r.object.MarshalJSON()
+		if err == nil {
+			_, err = client.Resource(r.resource).Namespace(namespace).Patch(ctx, r.object.GetName(), types.ApplyPatchType, b, metav1.PatchOptions{FieldManager: kubernetesFieldManager, Force: &force})
+		}
+		if err != nil {
+			teardown()
+			return "", nil, fmt.Errorf("failed to apply %s: %w", r, err)
+		}
+		created = append(created, r)
+		logger(logComponentRun).Infow("Applied Knative resource", "resource", r.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.ParsedReadyTimeout)
+	defer cancel()
+
+	var address string
+	for i, r := range resources {
+		status, err := waitKnativeResourceReady(ctx, client.Resource(r.resource).Namespace(namespace), r.object.GetName())
+		if err != nil {
+			teardown()
+			return "", nil, fmt.Errorf("%s not ready: %w", r, err)
+		}
+		if i == 0 {
+			address = status.Status.Address.URL
+		}
+	}
+	if address == "" {
+		teardown()
+		return "", nil, fmt.Errorf("%s has no address", resources[0])
+	}
+	return address, teardown, nil
+}
+
+// waitKnativeResourceReady polls the resource with the given name until it is ready.
+func waitKnativeResourceReady(ctx context.Context, client dynamic.ResourceInterface, name string) (*knativeResourceStatus, error) {
+	var status *knativeResourceStatus
+	var reason string
+	err := wait.PollImmediateUntilWithContext(ctx, knativeReadyInterval, func(ctx context.Context) (bool, error) {
+		u, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			// The last status is more relevant than the errors of the requests failing because of the timeout.
+			if status == nil {
+				reason = err.Error()
+			}
+			return false, nil
+		}
+		status = &knativeResourceStatus{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, status); err != nil {
+			return false, err
+		}
+		var ready bool
+		ready, reason = status.ready()
+		return ready, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w, last status: %s", err, reason)
+	}
+	return status, nil
+}
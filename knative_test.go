@@ -0,0 +1,200 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fakeKnativeAPI is a Kubernetes API serving applied Knative resources, resources become ready after readyAfter
+// readiness checks and never when readyAfter is negative.
+type fakeKnativeAPI struct {
+	lock       sync.Mutex
+	readyAfter int
+	applied    map[string]map[string]interface{}
+	gets       map[string]int
+	requests   []string
+}
+
+func newFakeKnativeAPI(t *testing.T, readyAfter int) *fakeKnativeAPI {
+	api := &fakeKnativeAPI{readyAfter: readyAfter, applied: map[string]map[string]interface{}{}, gets: map[string]int{}}
+	server := httptest.NewTLSServer(api)
+	t.Cleanup(server.Close)
+	useInClusterServer(t, server)
+
+	previous := knativeReadyInterval
+	knativeReadyInterval = 10 * time.Millisecond
+	t.Cleanup(func() { knativeReadyInterval = previous })
+	return api
+}
+
+func (api *fakeKnativeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	api.requests = append(api.requests, r.Method+" "+r.URL.Path)
+
+	switch r.Method {
+	case http.MethodPatch:
+		object := map[string]interface{}{}
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &object); err != nil || r.URL.Query().Get("fieldManager") != "sacura" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		api.applied[r.URL.Path] = object
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(b)
+	case http.MethodGet:
+		object, ok := api.applied[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		api.gets[r.URL.Path]++
+		status := map[string]interface{}{
+			"observedGeneration": 1,
+			"conditions":         []map[string]string{{"type": "Ready", "status": "False", "reason": "NotReconciled", "message": "waiting"}},
+		}
+		if api.readyAfter >= 0 && api.gets[r.URL.Path] > api.readyAfter {
+			status["conditions"] = []map[string]string{{"type": "Ready", "status": "True"}}
+			status["address"] = map[string]string{"url": "http://broker-ingress.knative-eventing.svc.cluster.local" + r.URL.Path}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"apiVersion": object["apiVersion"],
+			"kind":       object["kind"],
+			"metadata":   map[string]interface{}{"name": path.Base(r.URL.Path), "generation": 1},
+			"status":     status,
+		})
+	case http.MethodDelete:
+		delete(api.applied, r.URL.Path)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func TestProvisionKnativeBroker(t *testing.T) {
+	api := newFakeKnativeAPI(t, 2)
+	config := &KnativeConfig{
+		Broker:        &KnativeBrokerConfig{Class: "Kafka", Filter: map[string]string{"type": "sacura"}},
+		SubscriberURI: "http://sacura.e2e.svc.cluster.local:8080",
+	}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	address, teardown, err := provisionKnative(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	brokerPath := "/apis/eventing.knative.dev/v1/namespaces/e2e/brokers/sacura"
+	triggerPath := "/apis/eventing.knative.dev/v1/namespaces/e2e/triggers/sacura"
+	if want := "http://broker-ingress.knative-eventing.svc.cluster.local" + brokerPath; address != want {
+		t.Errorf("want address %s, got %s", want, address)
+	}
+
+	api.lock.Lock()
+	broker, trigger := api.applied[brokerPath], api.applied[triggerPath]
+	api.lock.Unlock()
+	metadata, _ := broker["metadata"].(map[string]interface{})
+	if diff := cmp.Diff(map[string]interface{}{"eventing.knative.dev/broker.class": "Kafka"}, metadata["annotations"]); diff != "" {
+		t.Error("unexpected Broker annotations (-want, +got)", diff)
+	}
+	wantSpec := map[string]interface{}{
+		"broker":     "sacura",
+		"filter":     map[string]interface{}{"attributes": map[string]interface{}{"type": "sacura"}},
+		"subscriber": map[string]interface{}{"uri": "http://sacura.e2e.svc.cluster.local:8080"},
+	}
+	if diff := cmp.Diff(wantSpec, trigger["spec"]); diff != "" {
+		t.Error("unexpected Trigger spec (-want, +got)", diff)
+	}
+
+	teardown()
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	if len(api.applied) != 0 {
+		t.Errorf("want resources deleted, got %v", api.applied)
+	}
+	wantRequests := []string{"PATCH " + brokerPath, "PATCH " + triggerPath, "DELETE " + triggerPath, "DELETE " + brokerPath}
+	var got []string
+	for _, r := range api.requests {
+		if !strings.HasPrefix(r, "GET ") {
+			got = append(got, r)
+		}
+	}
+	if diff := cmp.Diff(wantRequests, got); diff != "" {
+		t.Error("unexpected requests (-want, +got)", diff)
+	}
+}
+
+func TestProvisionKnativeNotReady(t *testing.T) {
+	api := newFakeKnativeAPI(t, -1)
+	config := &KnativeConfig{Channel: &KnativeChannelConfig{}, SubscriberURI: "http://sacura:8080", ReadyTimeout: "50ms", Keep: true}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := provisionKnative(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "inmemorychannels/sacura not ready") || !strings.Contains(err.Error(), "NotReconciled: waiting") {
+		t.Errorf("want channel not ready error with the last status, got %v", err)
+	}
+	api.lock.Lock()
+	defer api.lock.Unlock()
+	if len(api.applied) != 2 {
+		t.Errorf("want resources kept, got %v", api.applied)
+	}
+}
+
+func TestKnativeConfigValidate(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        KnativeConfig
+		wantResources []string
+		wantErr       bool
+	}{
+		{
+			name:          "broker",
+			config:        KnativeConfig{Broker: &KnativeBrokerConfig{Name: "default", TriggerName: "sacura"}, SubscriberURI: "http://sacura:8080"},
+			wantResources: []string{"eventing.knative.dev/v1/brokers/default", "eventing.knative.dev/v1/triggers/sacura"},
+		},
+		{
+			name:          "channel",
+			config:        KnativeConfig{Channel: &KnativeChannelConfig{APIVersion: "messaging.knative.dev/v1beta1", Kind: "KafkaChannel"}, SubscriberURI: "http://sacura:8080"},
+			wantResources: []string{"messaging.knative.dev/v1beta1/kafkachannels/sacura", "messaging.knative.dev/v1/subscriptions/sacura"},
+		},
+		{name: "broker and channel", config: KnativeConfig{Broker: &KnativeBrokerConfig{}, Channel: &KnativeChannelConfig{}, SubscriberURI: "http://sacura:8080"}, wantErr: true},
+		{name: "nothing to provision", config: KnativeConfig{SubscriberURI: "http://sacura:8080"}, wantErr: true},
+		{name: "no subscriber", config: KnativeConfig{Broker: &KnativeBrokerConfig{}}, wantErr: true},
+		{name: "invalid name", config: KnativeConfig{Broker: &KnativeBrokerConfig{Name: "Default"}, SubscriberURI: "http://sacura:8080"}, wantErr: true},
+		{name: "invalid api version", config: KnativeConfig{Channel: &KnativeChannelConfig{APIVersion: "v1"}, SubscriberURI: "http://sacura:8080"}, wantErr: true},
+		{name: "invalid ready timeout", config: KnativeConfig{Broker: &KnativeBrokerConfig{}, SubscriberURI: "http://sacura:8080", ReadyTimeout: "soon"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			var got []string
+			for _, r := range knativeResources(&tt.config, "e2e") {
+				got = append(got, r.String())
+			}
+			if diff := cmp.Diff(tt.wantResources, got); diff != "" {
+				t.Error("unexpected resources (-want, +got)", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	corev1 "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+const (
+	// DefaultTerminationMessagePath is the default path of the container termination message.
+	DefaultTerminationMessagePath = "/dev/termination-log"
+
+	// ConfigMapReportKey is the key of the JSON report in the ConfigMap written with report.kubernetes.configMap.
+	ConfigMapReportKey = "report.json"
+	// ConfigMapPassedKey is the key of the verification outcome in the ConfigMap, either "true" or "false".
+	ConfigMapPassedKey = "passed"
+
+	// maxTerminationMessageSize is the size of the termination message the kubelet retains.
+	maxTerminationMessageSize = 4096
+)
+
+// serviceAccountDir is the directory of the credentials of the pod service account, it includes the namespace of the pod.
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// KubernetesReportConfig writes the final JSON report to the Kubernetes API when running in-cluster, so that e2e
+// frameworks can fetch results without scraping logs.
+type KubernetesReportConfig struct {
+	// ConfigMap is the name of the ConfigMap the report is written to, the ConfigMap is created or updated with the
+	// report under the ConfigMapReportKey key and the outcome under the ConfigMapPassedKey key.
+	//
+	// The service account of the pod must be allowed to patch ConfigMaps.
+	ConfigMap string `json:"configMap" yaml:"configMap"`
+	// Namespace is the namespace of the ConfigMap.
+	//
+	// Defaults to the namespace of the pod.
+	Namespace string `json:"namespace" yaml:"namespace"`
+	// TerminationMessage writes the report to the container termination message, reports larger than 4096 bytes
+	// are reduced to a summary of the counts.
+	TerminationMessage bool `json:"terminationMessage" yaml:"terminationMessage"`
+	// TerminationMessagePath is the terminationMessagePath of the container.
+	//
+	// Defaults to DefaultTerminationMessagePath.
+	TerminationMessagePath string `json:"terminationMessagePath" yaml:"terminationMessagePath"`
+}
+
+func (c *KubernetesReportConfig) validate() error {
+	if c.ConfigMap == "" && !c.TerminationMessage {
+		return invalidErr("report.kubernetes", errors.New("at least one of configMap or terminationMessage must be specified"))
+	}
+	if c.ConfigMap != "" && !isDNSSubdomain(c.ConfigMap) {
+		return invalidErr("report.kubernetes.configMap", fmt.Errorf("%q is not a valid ConfigMap name", c.ConfigMap))
+	}
+	if c.Namespace != "" && (c.ConfigMap == "" || !isDNSSubdomain(c.Namespace)) {
+		return invalidErr("report.kubernetes.namespace", fmt.Errorf("%q must be a valid namespace and requires configMap", c.Namespace))
+	}
+	if c.TerminationMessagePath == "" {
+		c.TerminationMessagePath = DefaultTerminationMessagePath
+	}
+	return nil
+}
+
+// isDNSSubdomain returns true when the given name is a valid DNS subdomain, as required for Kubernetes object names.
+func isDNSSubdomain(name string) bool {
+	return len(validation.IsDNS1123Subdomain(name)) == 0
+}
+
+// writeKubernetesReport writes the given report as configured.
+func writeKubernetesReport(ctx context.Context, config *KubernetesReportConfig, report Report, verificationErr error) error {
+	b := &bytes.Buffer{}
+	if err := writeJSONReport(b, report, verificationErr); err != nil {
+		return err
+	}
+
+	if config.TerminationMessage {
+		if err := writeTerminationMessage(config.TerminationMessagePath, b.Bytes(), report, verificationErr); err != nil {
+			return fmt.Errorf("failed to write termination message to %s: %w", config.TerminationMessagePath, err)
+		}
+	}
+	if config.ConfigMap != "" {
+		if err := applyReportConfigMap(ctx, config, b.String(), verificationErr == nil); err != nil {
+			return fmt.Errorf("failed to write report to ConfigMap %s: %w", config.ConfigMap, err)
+		}
+	}
+	return nil
+}
+
+// reportSummary is the termination message of reports exceeding the termination message size.
+type reportSummary struct {
+	Passed            bool   `json:"passed"`
+	Error             string `json:"error,omitempty"`
+	AcceptedCount     int    `json:"acceptedCount"`
+	ReceivedCount     int    `json:"receivedCount"`
+	LostCount         int    `json:"lostCount"`
+	DuplicateCount    int    `json:"duplicateCount"`
+	UnexpectedCount   int    `json:"unexpectedCount"`
+	CorruptedCount    int    `json:"corruptedCount"`
+	DeadLetteredCount int    `json:"deadLetteredCount"`
+	Truncated         bool   `json:"truncated,omitempty"`
+}
+
+// newReportSummary returns the summary of the given report, the error is truncated to maxErrorSize bytes.
+func newReportSummary(report Report, verificationErr error, maxErrorSize int) reportSummary {
+	s := reportSummary{
+		Passed:            verificationErr == nil,
+		AcceptedCount:     report.Metrics.AcceptedCount,
+		ReceivedCount:     report.ReceivedCount,
+		LostCount:         report.LostCount,
+		DuplicateCount:    report.DuplicateCount,
+		UnexpectedCount:   report.UnexpectedCount,
+		CorruptedCount:    report.CorruptedCount,
+		DeadLetteredCount: report.DeadLetteredCount,
+	}
+	if verificationErr != nil {
+		s.Error = verificationErr.Error()
+		// The error may list events.
+		if len(s.Error) > maxErrorSize {
+			s.Error = s.Error[:maxErrorSize] + "..."
+		}
+	}
+	return s
+}
+
+func writeTerminationMessage(path string, b []byte, report Report, verificationErr error) error {
+	if len(b) > maxTerminationMessageSize {
+		// The summary must fit the termination message.
+		s := newReportSummary(report, verificationErr, maxTerminationMessageSize/2)
+		s.Truncated = true
+		var err error
+		b, err = json.Marshal(s)
+		if err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// kubernetesConfig returns the config of clients of the Kubernetes API authenticated with the pod service account.
+var kubernetesConfig = rest.InClusterConfig
+
+// kubernetesFieldManager is the field manager of the objects sacura applies.
+const kubernetesFieldManager = "sacura"
+
+// podNamespace returns the namespace of the pod service account.
+func podNamespace() (string, error) {
+	namespace, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read service account namespace: %w", err)
+	}
+	return strings.TrimSpace(string(namespace)), nil
+}
+
+// applyReportConfigMap creates or updates the report ConfigMap with a server-side apply.
+func applyReportConfigMap(ctx context.Context, config *KubernetesReportConfig, report string, passed bool) error {
+	restConfig, err := kubernetesConfig()
+	if err != nil {
+		return err
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return err
+	}
+	namespace := config.Namespace
+	if namespace == "" {
+		if namespace, err = podNamespace(); err != nil {
+			return err
+		}
+	}
+
+	configMap := corev1.ConfigMap(config.ConfigMap, namespace).
+		WithLabels(map[string]string{"app.kubernetes.io/name": "sacura"}).
+		WithData(map[string]string{
+			ConfigMapReportKey: report,
+			ConfigMapPassedKey: fmt.Sprint(passed),
+		})
+	_, err = client.CoreV1().ConfigMaps(namespace).Apply(ctx, configMap, metav1.ApplyOptions{FieldManager: kubernetesFieldManager, Force: true})
+	return err
+}
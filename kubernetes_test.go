@@ -0,0 +1,171 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestKubernetesReportConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		config   KubernetesReportConfig
+		wantPath string
+		wantErr  bool
+	}{
+		{
+			name:     "config map",
+			config:   KubernetesReportConfig{ConfigMap: "sacura-report", Namespace: "e2e"},
+			wantPath: DefaultTerminationMessagePath,
+		},
+		{
+			name:     "termination message",
+			config:   KubernetesReportConfig{TerminationMessage: true, TerminationMessagePath: "/tmp/termination-log"},
+			wantPath: "/tmp/termination-log",
+		},
+		{
+			name:    "nothing to write",
+			config:  KubernetesReportConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid config map name",
+			config:  KubernetesReportConfig{ConfigMap: "Sacura_Report"},
+			wantErr: true,
+		},
+		{
+			name:    "namespace without config map",
+			config:  KubernetesReportConfig{TerminationMessage: true, Namespace: "e2e"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && tt.config.TerminationMessagePath != tt.wantPath {
+				t.Errorf("expected termination message path %s, got %s", tt.wantPath, tt.config.TerminationMessagePath)
+			}
+		})
+	}
+}
+
+// useInClusterServer makes the given server the Kubernetes API of in-cluster clients, authenticated with the "secret"
+// token of a service account of the "e2e" namespace.
+func useInClusterServer(t *testing.T, server *httptest.Server) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "namespace"), []byte("e2e"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	previous := serviceAccountDir
+	serviceAccountDir = dir
+	t.Cleanup(func() { serviceAccountDir = previous })
+
+	previousConfig := kubernetesConfig
+	kubernetesConfig = func() (*rest.Config, error) {
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+		// Readiness is polled every few milliseconds.
+		return &rest.Config{Host: server.URL, BearerToken: "secret", TLSClientConfig: rest.TLSClientConfig{CAData: ca}, QPS: 1000, Burst: 1000}, nil
+	}
+	t.Cleanup(func() { kubernetesConfig = previousConfig })
+}
+
+func TestWriteKubernetesReportConfigMap(t *testing.T) {
+
+	var gotPath, gotQuery, gotAuth, gotContentType string
+	var gotBody map[string]interface{}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+		gotAuth, gotContentType = r.Header.Get("Authorization"), r.Header.Get("Content-Type")
+		b, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(b, &gotBody); err != nil {
+			t.Error(err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(b)
+	}))
+	defer server.Close()
+	useInClusterServer(t, server)
+
+	config := &KubernetesReportConfig{ConfigMap: "sacura-report"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeKubernetesReport(context.Background(), config, Report{LostCount: 1}, errors.New("lost count: 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotPath != "/api/v1/namespaces/e2e/configmaps/sacura-report" || gotQuery != "fieldManager=sacura&force=true" {
+		t.Errorf("unexpected request %s?%s", gotPath, gotQuery)
+	}
+	if gotAuth != "Bearer secret" || gotContentType != "application/apply-patch+yaml" {
+		t.Errorf("unexpected headers, authorization %q, content type %q", gotAuth, gotContentType)
+	}
+	data, _ := gotBody["data"].(map[string]interface{})
+	if data[ConfigMapPassedKey] != "false" || !strings.Contains(data[ConfigMapReportKey].(string), `"lostCount": 1`) {
+		t.Errorf("unexpected ConfigMap data %v", data)
+	}
+}
+
+func TestWriteKubernetesReportTerminationMessage(t *testing.T) {
+
+	dir := t.TempDir()
+
+	tests := []struct {
+		name          string
+		report        Report
+		wantTruncated bool
+	}{
+		{
+			name:   "full report",
+			report: Report{ReceivedCount: 10},
+		},
+		{
+			name:          "summary",
+			report:        Report{ReceivedCount: 10, LostCount: 1000, LostEventsByPartitionKey: map[string][]string{"0": make([]string, 1000)}},
+			wantTruncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &KubernetesReportConfig{TerminationMessage: true, TerminationMessagePath: filepath.Join(dir, "termination-log")}
+			if err := writeKubernetesReport(context.Background(), config, tt.report, nil); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(config.TerminationMessagePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(b) > maxTerminationMessageSize {
+				t.Errorf("expected termination message of at most %d bytes, got %d", maxTerminationMessageSize, len(b))
+			}
+			got := struct {
+				Passed        bool `json:"passed"`
+				ReceivedCount int  `json:"receivedCount"`
+				Truncated     bool `json:"truncated"`
+			}{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.Passed || got.ReceivedCount != 10 || got.Truncated != tt.wantTruncated {
+				t.Errorf("unexpected termination message %s", b)
+			}
+		})
+	}
+}
@@ -0,0 +1,210 @@
+package sacura
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+)
+
+// PayloadSizeExtension is the extension carrying the size class in bytes of the data of events sent with
+// sender.payload.sizeClasses.
+const PayloadSizeExtension = "sacurapayloadsize"
+
+// validateSizeClasses validates the size classes of the payload against the given sender config.
+//
+// Payloads of a size class are generated once and shared by the events of the class, they are sent in the binary
+// content mode so that request bodies are the payloads themselves, without copies.
+func (c *PayloadConfig) validateSizeClasses(sender *SenderConfig) error {
+	seen := make(map[int]bool, len(c.SizeClasses))
+	for i, size := range c.SizeClasses {
+		if size <= 0 {
+			return invalidErr(fmt.Sprintf("sender.payload.sizeClasses[%d]", i), fmt.Errorf("%d must be positive", size))
+		}
+		if seen[size] {
+			return invalidErr(fmt.Sprintf("sender.payload.sizeClasses[%d]", i), fmt.Errorf("%d is a duplicate size class", size))
+		}
+		seen[size] = true
+	}
+	sort.Ints(c.SizeClasses)
+
+	if sender.Protocol != "" && sender.Protocol != ProtocolHTTP {
+		return invalidErr("sender.payload.sizeClasses", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if sender.BatchSize > 1 {
+		return invalidErr("sender.payload.sizeClasses", errors.New("cannot be used with sender.batchSize, payloads are sent one per request"))
+	}
+	if sender.ContentMode != nil && sender.ContentMode.Mode != ContentModeBinary {
+		return invalidErr("sender.payload.sizeClasses", fmt.Errorf("payloads are sent in the %s content mode", ContentModeBinary))
+	}
+	if sender.Compression != nil {
+		return invalidErr("sender.payload.sizeClasses", errors.New("cannot be used with sender.compression, payloads are sent uncompressed"))
+	}
+	if sender.Record != nil {
+		return invalidErr("sender.payload.sizeClasses", errors.New("cannot be used with sender.record, payloads are not recorded"))
+	}
+	return nil
+}
+
+// sizeClassPayload is the shared payload of a size class.
+type sizeClassPayload struct {
+	size     int
+	checksum string
+}
+
+// newSizeClassPayloads returns the payloads of the given size classes, slices of the given filler checksummed once.
+func newSizeClassPayloads(sizes []int, filler []byte) []sizeClassPayload {
+	payloads := make([]sizeClassPayload, 0, len(sizes))
+	for _, size := range sizes {
+		payloads = append(payloads, sizeClassPayload{size: size, checksum: checksum(filler[:size])})
+	}
+	return payloads
+}
+
+// streamedRequestBody sets the headers of the given event in the binary content mode and returns its data as the
+// request body, without copying it.
+func streamedRequestBody(hdr http.Header, e *ce.Event) ([]byte, error) {
+	headers := *e
+	headers.DataEncoded = nil
+	req := &http.Request{Header: hdr}
+	if err := cehttp.WriteRequest(binding.WithForceBinary(context.Background()), binding.ToMessage(&headers), req); err != nil {
+		return nil, err
+	}
+	return e.Data(), nil
+}
+
+type streamedPayloadKey struct{}
+
+// streamedPayload is the data of an event streamed by the receiver.
+type streamedPayload struct {
+	checksum string
+}
+
+// streamedPayloadFromRequest returns the data of the given request streamed by streamRequestBody.
+func streamedPayloadFromRequest(r *http.Request) (streamedPayload, bool) {
+	p, ok := r.Context().Value(streamedPayloadKey{}).(streamedPayload)
+	return p, ok
+}
+
+// streamRequestBody checksums the body of the given binary request while reading it, without holding it in memory,
+// and returns a request without body recording the checksum in its context. Other requests are returned as is.
+func streamRequestBody(r *http.Request) (*http.Request, error) {
+	if requestContentMode(r) != ContentModeBinary {
+		return r, nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, r.Body); err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	r = r.WithContext(context.WithValue(r.Context(), streamedPayloadKey{}, streamedPayload{checksum: hex.EncodeToString(h.Sum(nil))}))
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	return r, nil
+}
+
+// validChecksum returns false when the data of the given event doesn't match its checksum extension, the checksum
+// of streamed data is the one computed while receiving it.
+func (e *ReceivedEvent) validChecksum() bool {
+	if e.DataChecksum == "" {
+		return verifyChecksum(&e.Event)
+	}
+	v, ok := e.Event.Extensions()[ChecksumExtension]
+	if !ok {
+		return true
+	}
+	return fmt.Sprint(v) == e.DataChecksum
+}
+
+// PayloadSizeReport reports the events of a size class.
+type PayloadSizeReport struct {
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// CorruptedCount is the number of deliveries whose data doesn't match its checksum, for example payloads
+	// truncated by brokers limiting the message size, when verification.integrity is enabled.
+	CorruptedCount int `json:"corruptedCount,omitempty"`
+	// Latency is the end-to-end latency of the deliveries of the size class.
+	Latency LatencyStats `json:"latency"`
+}
+
+// payloadSizeState tracks the events of a size class.
+type payloadSizeState struct {
+	sent      int
+	received  int
+	corrupted int
+	latency   *latencyHistogram
+}
+
+// newPayloadSizesState returns the state of the given size classes, it returns nil without size classes.
+func newPayloadSizesState(config *PayloadConfig) map[int]*payloadSizeState {
+	if config == nil || len(config.SizeClasses) == 0 {
+		return nil
+	}
+	sizes := make(map[int]*payloadSizeState, len(config.SizeClasses))
+	for _, size := range config.SizeClasses {
+		sizes[size] = &payloadSizeState{latency: newLatencyHistogram()}
+	}
+	return sizes
+}
+
+// payloadSize returns the state of the size class of the given event.
+func (s *StateManager) payloadSize(e *ce.Event) *payloadSizeState {
+	if s.payloadSizes == nil {
+		return nil
+	}
+	v, ok := e.Extensions()[PayloadSizeExtension]
+	if !ok {
+		return nil
+	}
+	size, err := strconv.Atoi(fmt.Sprint(v))
+	if err != nil {
+		return nil
+	}
+	return s.payloadSizes[size]
+}
+
+// recordSentPayloadSize records the size class of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentPayloadSize(e *ce.Event) {
+	if ps := s.payloadSize(e); ps != nil {
+		ps.sent++
+	}
+}
+
+// recordReceivedPayloadSize records the size class of the given delivery, it must be called while holding the lock.
+func (s *StateManager) recordReceivedPayloadSize(e *ReceivedEvent, corrupted bool) {
+	ps := s.payloadSize(&e.Event)
+	if ps == nil {
+		return
+	}
+	ps.received++
+	if corrupted {
+		ps.corrupted++
+	}
+	if sentAt, ok := sentTimestamp(&e.Event); ok && !e.ReceivedAt.IsZero() {
+		ps.latency.record(e.ReceivedAt.Sub(sentAt))
+	}
+}
+
+// payloadSizesReport sets the size classes section of the report, it must be called while holding the lock.
+func (s *StateManager) payloadSizesReport(r *Report) {
+	if s.payloadSizes == nil {
+		return
+	}
+	r.PayloadSizes = make(map[int]PayloadSizeReport, len(s.payloadSizes))
+	for size, ps := range s.payloadSizes {
+		r.PayloadSizes[size] = PayloadSizeReport{
+			SentCount:      ps.sent,
+			ReceivedCount:  ps.received,
+			CorruptedCount: ps.corrupted,
+			Latency:        ps.latency.stats(),
+		}
+	}
+}
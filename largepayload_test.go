@@ -0,0 +1,150 @@
+package sacura
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPayloadConfigValidateSizeClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PayloadConfig
+		sender  SenderConfig
+		want    []int
+		wantErr bool
+	}{
+		{name: "sorted", config: PayloadConfig{SizeClasses: []int{4 << 20, 1 << 20}}, want: []int{1 << 20, 4 << 20}},
+		{name: "binary content mode", config: PayloadConfig{SizeClasses: []int{1 << 20}}, sender: SenderConfig{ContentMode: &ContentModeConfig{Mode: ContentModeBinary}}, want: []int{1 << 20}},
+		{name: "not positive", config: PayloadConfig{SizeClasses: []int{0}}, wantErr: true},
+		{name: "duplicate", config: PayloadConfig{SizeClasses: []int{1, 1}}, wantErr: true},
+		{name: "batch", config: PayloadConfig{SizeClasses: []int{1}}, sender: SenderConfig{BatchSize: 2}, wantErr: true},
+		{name: "structured content mode", config: PayloadConfig{SizeClasses: []int{1}}, sender: SenderConfig{ContentMode: &ContentModeConfig{Mode: ContentModeStructured}}, wantErr: true},
+		{name: "compression", config: PayloadConfig{SizeClasses: []int{1}}, sender: SenderConfig{Compression: &CompressionConfig{}}, wantErr: true},
+		{name: "protocol", config: PayloadConfig{SizeClasses: []int{1}}, sender: SenderConfig{Protocol: ProtocolGRPC}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validateSizeClasses(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil {
+				if diff := cmp.Diff(tt.want, tt.config.SizeClasses); diff != "" {
+					t.Error("(-want, +got)", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestStreamRequestBody(t *testing.T) {
+
+	config := &PayloadConfig{SizeClasses: []int{2 << 20}}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	g, err := newPayloadGenerator(config, newRand(nil, "payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := cetest.FullEvent()
+	if err := g.setData(&e, PayloadTemplateData{ID: e.ID()}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		name      string
+		truncate  bool
+		wantValid bool
+	}{
+		{name: "intact", wantValid: true},
+		{name: "truncated", truncate: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := http.Header{}
+			body, err := streamedRequestBody(hdr, &e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(body) != 2<<20 || &body[0] != &e.Data()[0] {
+				t.Fatal("expected the event data as the request body")
+			}
+			if tt.truncate {
+				body = body[:len(body)-1]
+			}
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+			req.Header = hdr
+
+			req, err = streamRequestBody(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, ok := streamedPayloadFromRequest(req)
+			if !ok {
+				t.Fatal("expected streamed payload")
+			}
+			events, err := eventsFromRequest(req.Context(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(events) != 1 || events[0].ID() != e.ID() || len(events[0].Data()) != 0 {
+				t.Fatalf("expected event %s without data, got %v", e.ID(), events)
+			}
+			r := ReceivedEvent{Event: *events[0], DataChecksum: payload.checksum}
+			if got := r.validChecksum(); got != tt.wantValid {
+				t.Errorf("want valid checksum %v, got %v", tt.wantValid, got)
+			}
+		})
+	}
+}
+
+func TestStateManagerPayloadSizes(t *testing.T) {
+
+	config := Config{
+		Sender:       SenderConfig{Payload: &PayloadConfig{SizeClasses: []int{1024, 4096}}},
+		Verification: VerificationConfig{Integrity: true},
+	}
+	sm := newTestStateManager(t, config)
+
+	sentAt := time.Now()
+	event := func(id string, size string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(PayloadSizeExtension, size)
+		e.SetExtension(ChecksumExtension, "checksum")
+		setSentTimestamp(&e, sentAt)
+		return e
+	}
+	sm.lock.Lock()
+	for _, e := range []ce.Event{event("1", "1024"), event("2", "1024"), event("3", "4096")} {
+		e := e
+		sm.recordSent(&e)
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1", "1024"), ReceivedAt: sentAt.Add(10 * time.Millisecond), DataChecksum: "checksum"},
+		{Event: event("3", "4096"), ReceivedAt: sentAt.Add(40 * time.Millisecond), DataChecksum: "truncated"},
+	} {
+		r := r
+		sm.recordReceived(&r)
+	}
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	if got := report.PayloadSizes[1024]; got.SentCount != 2 || got.ReceivedCount != 1 || got.CorruptedCount != 0 || got.Latency.Max != 10*time.Millisecond {
+		t.Errorf("unexpected report of size class 1024: %+v", got)
+	}
+	if got := report.PayloadSizes[4096]; got.SentCount != 1 || got.ReceivedCount != 1 || got.CorruptedCount != 1 || got.Latency.Max != 40*time.Millisecond {
+		t.Errorf("unexpected report of size class 4096: %+v", got)
+	}
+	if diff := cmp.Diff(map[string][]string{unknownPartitionKey: {"3"}}, report.CorruptedEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
@@ -0,0 +1,196 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// DefaultLateArrivalsWindow is the default time the receiver keeps listening for late arrivals after its timeout.
+const DefaultLateArrivalsWindow = 10 * time.Second
+
+// lateArrivalsCheckInterval is the interval at which the receiver checks whether events are still missing during the
+// late arrivals window.
+const lateArrivalsCheckInterval = 100 * time.Millisecond
+
+// LateArrivalsConfig keeps the receiver listening for a short window after its timeout, events received during the
+// window are reported as late rather than lost, to distinguish lost events from very slow ones.
+//
+// Late events are still missing from the received events, the verification fails like it does for lost events.
+type LateArrivalsConfig struct {
+	// Window is how long the receiver keeps listening after its timeout, for example 10s. The window ends early once
+	// no sent event is missing anymore.
+	//
+	// Defaults to DefaultLateArrivalsWindow.
+	Window string `json:"window" yaml:"window"`
+
+	ParsedWindow time.Duration
+}
+
+func (c *LateArrivalsConfig) validate(config *Config) error {
+	c.ParsedWindow = DefaultLateArrivalsWindow
+	if c.Window != "" {
+		var err error
+		c.ParsedWindow, err = time.ParseDuration(c.Window)
+		if err != nil {
+			return invalidErr("receiver.lateArrivals.window", err)
+		}
+		if c.ParsedWindow <= 0 {
+			return invalidErr("receiver.lateArrivals.window", fmt.Errorf("%v must be positive", c.ParsedWindow))
+		}
+	}
+	if config.Verification.Mode.streams() {
+		return invalidErr("receiver.lateArrivals", fmt.Errorf("cannot be used with the %s verification mode", config.Verification.Mode))
+	}
+	if config.Distributed != nil {
+		return invalidErr("receiver.lateArrivals", errors.New("cannot be used in distributed mode"))
+	}
+	return nil
+}
+
+// LateEvent is a sent event received after the receiver timeout.
+type LateEvent struct {
+	ID string `json:"id"`
+	// Lateness is the time after the receiver timeout at which the event has been received.
+	Lateness time.Duration `json:"lateness"`
+	// Latency is the end-to-end latency of the event, it is zero when the send time is unknown.
+	Latency time.Duration `json:"latency,omitempty"`
+}
+
+// lateArrivalsState tracks the events received during the late arrivals window.
+type lateArrivalsState struct {
+	// since is the receiver timeout, it is zero until the window starts.
+	since  time.Time
+	events map[string]lateEvent
+}
+
+type lateEvent struct {
+	partitionKey string
+	lateness     time.Duration
+	latency      time.Duration
+}
+
+// newLateArrivalsState returns the state of late arrivals, it returns nil without receiver.lateArrivals.
+func newLateArrivalsState(config *LateArrivalsConfig) *lateArrivalsState {
+	if config == nil {
+		return nil
+	}
+	return &lateArrivalsState{events: make(map[string]lateEvent)}
+}
+
+// startLateArrivals records events received after the given receiver timeout as late and returns the number of sent
+// events not received yet.
+func (s *StateManager) startLateArrivals(since time.Time) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.late.since = since
+	return s.missingLateArrivals()
+}
+
+// lateArrivalsPending returns the number of sent events neither received before the receiver timeout nor during the
+// late arrivals window.
+func (s *StateManager) lateArrivalsPending() int64 {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.missingLateArrivals()
+}
+
+// missingLateArrivals returns the number of sent events not received yet, it must be called while holding the lock.
+func (s *StateManager) missingLateArrivals() int64 {
+	return s.sentCount.Load() - s.matchedCount.Load() - int64(len(s.late.events))
+}
+
+// recordLate records events received after the receiver timeout, it returns true when the event has been received
+// after the timeout. Only the first receipt of sent events not received before the timeout is recorded. It must be
+// called while holding the lock.
+func (s *StateManager) recordLate(e *ReceivedEvent) bool {
+	if s.late == nil || s.late.since.IsZero() || !e.ReceivedAt.After(s.late.since) {
+		return false
+	}
+	id := e.Event.ID()
+	if e.Nacked {
+		return true
+	}
+	if _, ok := s.receivedAt[id]; ok {
+		return true
+	}
+	if _, ok := s.late.events[id]; ok {
+		return true
+	}
+	sentAt, ok := s.sentAt[id]
+	if !ok {
+		return true
+	}
+	late := lateEvent{partitionKey: partitionKey(&e.Event, &s.stateManagerConfig), lateness: e.ReceivedAt.Sub(s.late.since)}
+	if !sentAt.IsZero() {
+		late.latency = e.ReceivedAt.Sub(sentAt)
+	}
+	logger(LogComponentState).Warnw("Received event after the receiver timeout", "id", id, "lateness", late.lateness)
+	s.late.events[id] = late
+	return true
+}
+
+// splitLate removes the events received after the receiver timeout from the given lost events of a partition and
+// adds them to the report, it returns the remaining lost events. It must be called while holding the lock.
+func (s *StateManager) splitLate(r *Report, pk string, lost []string) []string {
+	if s.late == nil || len(s.late.events) == 0 {
+		return lost
+	}
+	remaining := lost[:0]
+	for _, id := range lost {
+		late, ok := s.late.events[id]
+		if !ok {
+			remaining = append(remaining, id)
+			continue
+		}
+		r.LateEventsByPartitionKey[pk] = append(r.LateEventsByPartitionKey[pk], LateEvent{ID: id, Lateness: late.lateness, Latency: late.latency})
+		r.LateCount++
+		if late.lateness > r.MaxLateness {
+			r.MaxLateness = late.lateness
+		}
+	}
+	sort.Slice(r.LateEventsByPartitionKey[pk], func(i, j int) bool {
+		return r.LateEventsByPartitionKey[pk][i].ID < r.LateEventsByPartitionKey[pk][j].ID
+	})
+	return remaining
+}
+
+// waitLateArrivals keeps the receiver listening for late arrivals after the receiver timeout, until the window ends,
+// no sent event is missing anymore or the test is aborted.
+func waitLateArrivals(config *LateArrivalsConfig, sm *StateManager, since time.Time, aborted <-chan struct{}) {
+	if sm.startLateArrivals(since) <= 0 {
+		return
+	}
+	logger(LogComponentReceiver).Infow("Listening for late arrivals", "window", config.ParsedWindow)
+
+	window := time.NewTimer(config.ParsedWindow)
+	defer window.Stop()
+	ticker := time.NewTicker(lateArrivalsCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-window.C:
+			logger(LogComponentReceiver).Info("Late arrivals window ended")
+			return
+		case <-aborted:
+			return
+		case <-ticker.C:
+			if sm.lateArrivalsPending() <= 0 {
+				logger(LogComponentReceiver).Info("No event is missing anymore, ending the late arrivals window")
+				return
+			}
+		}
+	}
+}
+
+// lateSummary describes the lost events received after the receiver timeout, it is empty when there are none.
+func lateSummary(report Report) string {
+	if report.LateCount == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d of them received up to %v after the receiver timeout", report.LateCount, report.MaxLateness)
+}
@@ -0,0 +1,146 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLateArrivalsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "defaults", config: Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{}}}, want: DefaultLateArrivalsWindow},
+		{name: "window", config: Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{Window: "1m"}}}, want: time.Minute},
+		{name: "invalid window", config: Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{Window: "1"}}}, wantErr: true},
+		{name: "negative window", config: Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{Window: "-1s"}}}, wantErr: true},
+		{
+			name:    "streaming",
+			config:  Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{}}, Verification: VerificationConfig{Mode: VerificationModeStreaming}},
+			wantErr: true,
+		},
+		{
+			name:    "distributed",
+			config:  Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{}}, Distributed: &DistributedConfig{}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Receiver.LateArrivals.validate(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Receiver.LateArrivals.ParsedWindow != tt.want {
+				t.Errorf("want window %v, got %v", tt.want, tt.config.Receiver.LateArrivals.ParsedWindow)
+			}
+		})
+	}
+}
+
+func TestStateManagerLateArrivals(t *testing.T) {
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{LateArrivals: &LateArrivalsConfig{}}})
+
+	sentAt := time.Now()
+	timeout := sentAt.Add(time.Minute)
+	events := make(map[string]ce.Event, 4)
+	sm.lock.Lock()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		events[id] = e
+		sm.recordSent(&e)
+	}
+	sm.recordReceived(&ReceivedEvent{Event: events["1"], ReceivedAt: sentAt.Add(time.Second)})
+	sm.lock.Unlock()
+
+	if pending := sm.startLateArrivals(timeout); pending != 3 {
+		t.Fatalf("want 3 events missing at the receiver timeout, got %d", pending)
+	}
+
+	received := make(chan ReceivedEvent, 4)
+	signal := sm.ReadReceived(received)
+	// Received before the timeout and recorded after it.
+	received <- ReceivedEvent{Event: events["3"], ReceivedAt: timeout.Add(-time.Second)}
+	received <- ReceivedEvent{Event: events["2"], ReceivedAt: timeout.Add(time.Second)}
+	received <- ReceivedEvent{Event: events["2"], ReceivedAt: timeout.Add(2 * time.Second)}
+	received <- ReceivedEvent{Event: events["1"], ReceivedAt: timeout.Add(time.Second)}
+	close(received)
+	<-signal
+
+	if pending := sm.lateArrivalsPending(); pending != 1 {
+		t.Errorf("want 1 event still missing, got %d", pending)
+	}
+
+	report := sm.GenerateReport()
+	want := map[string][]LateEvent{
+		unknownPartitionKey: {{ID: "2", Lateness: time.Second, Latency: time.Minute + time.Second}},
+	}
+	if diff := cmp.Diff(want, report.LateEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.LateCount != 1 || report.MaxLateness != time.Second {
+		t.Errorf("want 1 late event up to 1s late, got %d up to %v", report.LateCount, report.MaxLateness)
+	}
+	if report.ReceivedCount != 2 || report.DuplicateCount != 0 {
+		t.Errorf("want 2 received events and no duplicates, got %d and %d", report.ReceivedCount, report.DuplicateCount)
+	}
+	if diff := cmp.Diff(map[string][]string{unknownPartitionKey: {"4"}}, report.LostEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	report.Metrics.AcceptedCount = 4
+	err := verify(Config{}, report)
+	if err == nil || !strings.Contains(err.Error(), "1 of them received up to 1s after the receiver timeout") {
+		t.Errorf("expected lost events error mentioning late events, got %v", err)
+	}
+}
+
+func TestWaitLateArrivals(t *testing.T) {
+	config := &LateArrivalsConfig{Window: "1h"}
+	if err := config.validate(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{LateArrivals: config}})
+
+	// No event missing.
+	start := time.Now()
+	waitLateArrivals(config, sm, start, nil)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected no late arrivals window, waited %v", elapsed)
+	}
+
+	e := cetest.FullEvent()
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		waitLateArrivals(config, sm, time.Now(), nil)
+	}()
+	select {
+	case <-done:
+		t.Fatal("expected the window to wait for the missing event")
+	case <-time.After(3 * lateArrivalsCheckInterval):
+	}
+
+	sm.lock.Lock()
+	sm.recordLate(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+	sm.lock.Unlock()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("expected the window to end once no event is missing")
+	}
+}
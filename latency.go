@@ -0,0 +1,98 @@
+package sacura
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// LatencyStats are latency percentiles computed over a set of events.
+type LatencyStats struct {
+	Count int           `json:"count"`
+	P50   time.Duration `json:"50th"`
+	P90   time.Duration `json:"90th"`
+	P99   time.Duration `json:"99th"`
+	Max   time.Duration `json:"max"`
+}
+
+// NewLatencyStats computes latency percentiles of the given latencies.
+func NewLatencyStats(latencies []time.Duration) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := make([]time.Duration, len(latencies))
+	copy(sorted, latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return LatencyStats{
+		Count: len(sorted),
+		P50:   percentile(sorted, 0.50),
+		P90:   percentile(sorted, 0.90),
+		P99:   percentile(sorted, 0.99),
+		Max:   sorted[len(sorted)-1],
+	}
+}
+
+// percentile returns the nearest-rank percentile p of the given sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// latencyHistogram tracks latencies with millisecond resolution using memory proportional to the number of distinct
+// latency values rather than the number of events.
+type latencyHistogram struct {
+	count   int
+	buckets map[int64]int
+}
+
+func newLatencyHistogram() *latencyHistogram {
+	return &latencyHistogram{buckets: make(map[int64]int, 64)}
+}
+
+func (h *latencyHistogram) record(latency time.Duration) {
+	h.count++
+	h.buckets[latency.Milliseconds()]++
+}
+
+func (h *latencyHistogram) stats() LatencyStats {
+	if h.count == 0 {
+		return LatencyStats{}
+	}
+
+	values := make([]int64, 0, len(h.buckets))
+	for v := range h.buckets {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	at := func(p float64) time.Duration {
+		rank := int(math.Ceil(p * float64(h.count)))
+		if rank < 1 {
+			rank = 1
+		}
+		seen := 0
+		for _, v := range values {
+			seen += h.buckets[v]
+			if seen >= rank {
+				return time.Duration(v) * time.Millisecond
+			}
+		}
+		return time.Duration(values[len(values)-1]) * time.Millisecond
+	}
+
+	return LatencyStats{
+		Count: h.count,
+		P50:   at(0.50),
+		P90:   at(0.90),
+		P99:   at(0.99),
+		Max:   time.Duration(values[len(values)-1]) * time.Millisecond,
+	}
+}
@@ -0,0 +1,66 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		latencies []time.Duration
+		want      LatencyStats
+	}{
+		{
+			name: "empty",
+			want: LatencyStats{},
+		},
+		{
+			name:      "single",
+			latencies: []time.Duration{time.Second},
+			want: LatencyStats{
+				Count: 1,
+				P50:   time.Second,
+				P90:   time.Second,
+				P99:   time.Second,
+				Max:   time.Second,
+			},
+		},
+		{
+			name: "unsorted",
+			latencies: func() []time.Duration {
+				latencies := make([]time.Duration, 0, 100)
+				for i := 100; i > 0; i-- {
+					latencies = append(latencies, time.Duration(i)*time.Millisecond)
+				}
+				return latencies
+			}(),
+			want: LatencyStats{
+				Count: 100,
+				P50:   50 * time.Millisecond,
+				P90:   90 * time.Millisecond,
+				P99:   99 * time.Millisecond,
+				Max:   100 * time.Millisecond,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, NewLatencyStats(tt.latencies)); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+
+			h := newLatencyHistogram()
+			for _, l := range tt.latencies {
+				h.record(l)
+			}
+			if diff := cmp.Diff(tt.want, h.stats()); diff != "" {
+				t.Errorf("histogram (-want, +got) %s", diff)
+			}
+		})
+	}
+}
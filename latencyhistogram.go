@@ -0,0 +1,146 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// LatencyHistogramPath is the path of the metrics server exposing the latency histogram in the OpenMetrics text
+	// format.
+	LatencyHistogramPath = "/metrics/latency"
+
+	latencyHistogramMetric = "latency_e2e_slo_seconds"
+	openMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+// DefaultLatencyBuckets are the default upper bounds of the buckets of the latency histogram.
+var DefaultLatencyBuckets = []string{"5ms", "10ms", "25ms", "50ms", "100ms", "250ms", "500ms", "1s", "2.5s", "5s", "10s", "30s", "1m"}
+
+// LatencyHistogramConfig configures a histogram of the end-to-end latency of received events with fixed buckets, so
+// that SLO burn rates can be computed from the report and from the metrics server.
+type LatencyHistogramConfig struct {
+	// Buckets are the upper bounds of the buckets, for example 100ms, in increasing order.
+	//
+	// Defaults to DefaultLatencyBuckets.
+	Buckets []string `json:"buckets" yaml:"buckets"`
+
+	ParsedBuckets []time.Duration
+}
+
+// LatencyHistogramReport is the cumulative histogram of the end-to-end latency of received events.
+type LatencyHistogramReport struct {
+	// Buckets are the number of events received within each upper bound, the last bucket has no upper bound.
+	Buckets []LatencyBucket `json:"buckets"`
+	Count   int             `json:"count"`
+	Sum     time.Duration   `json:"sum"`
+}
+
+// LatencyBucket is the number of events received with a latency less than or equal to LE, LE is 0 for the bucket
+// without upper bound.
+type LatencyBucket struct {
+	LE    time.Duration `json:"le"`
+	Count int           `json:"count"`
+}
+
+func (c *LatencyHistogramConfig) validate() error {
+	buckets := c.Buckets
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	c.ParsedBuckets = make([]time.Duration, len(buckets))
+	for i, b := range buckets {
+		d, err := time.ParseDuration(b)
+		if err != nil {
+			return invalidErr(fmt.Sprintf("report.latencyHistogram.buckets[%d]", i), err)
+		}
+		if d <= 0 {
+			return invalidErr(fmt.Sprintf("report.latencyHistogram.buckets[%d]", i), errors.New("must be greater than 0"))
+		}
+		if i > 0 && d <= c.ParsedBuckets[i-1] {
+			return invalidErr(fmt.Sprintf("report.latencyHistogram.buckets[%d]", i), fmt.Errorf("%v must be greater than the previous bucket", d))
+		}
+		c.ParsedBuckets[i] = d
+	}
+	return nil
+}
+
+// bucketedLatencyHistogram counts latencies in fixed buckets, it is safe for concurrent use so that it is exported
+// while events are received.
+type bucketedLatencyHistogram struct {
+	lock   sync.Mutex
+	bounds []time.Duration
+	// counts are the non-cumulative counts of each bucket, the last one counts latencies above all bounds.
+	counts []int
+	sum    time.Duration
+}
+
+func newBucketedLatencyHistogram(bounds []time.Duration) *bucketedLatencyHistogram {
+	return &bucketedLatencyHistogram{bounds: bounds, counts: make([]int, len(bounds)+1)}
+}
+
+func (h *bucketedLatencyHistogram) record(latency time.Duration) {
+	i := sort.Search(len(h.bounds), func(i int) bool { return latency <= h.bounds[i] })
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.counts[i]++
+	h.sum += latency
+}
+
+func (h *bucketedLatencyHistogram) report() *LatencyHistogramReport {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	r := &LatencyHistogramReport{Buckets: make([]LatencyBucket, len(h.counts)), Sum: h.sum}
+	for i, n := range h.counts {
+		r.Count += n
+		r.Buckets[i].Count = r.Count
+		if i < len(h.bounds) {
+			r.Buckets[i].LE = h.bounds[i]
+		}
+	}
+	return r
+}
+
+// ServeHTTP writes the histogram in the OpenMetrics text format.
+func (h *bucketedLatencyHistogram) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	r := h.report()
+	w.Header().Set("Content-Type", openMetricsContentType)
+	_, _ = fmt.Fprintf(w, "# TYPE %s histogram\n", latencyHistogramMetric)
+	_, _ = fmt.Fprintf(w, "# UNIT %s seconds\n", latencyHistogramMetric)
+	_, _ = fmt.Fprintf(w, "# HELP %s End-to-end latency of received events since %s.\n", latencyHistogramMetric, BenchmarkTimestampAttribute)
+	for i, b := range r.Buckets {
+		le := "+Inf"
+		if i < len(r.Buckets)-1 {
+			le = strconv.FormatFloat(b.LE.Seconds(), 'g', -1, 64)
+		}
+		_, _ = fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", latencyHistogramMetric, le, b.Count)
+	}
+	_, _ = fmt.Fprintf(w, "%s_sum %s\n", latencyHistogramMetric, strconv.FormatFloat(r.Sum.Seconds(), 'g', -1, 64))
+	_, _ = fmt.Fprintf(w, "%s_count %d\n", latencyHistogramMetric, r.Count)
+	_, _ = fmt.Fprint(w, "# EOF\n")
+}
+
+// recordLatencyHistogram records the end-to-end latency of the given event received for the first time, it must be
+// called while holding the lock.
+func (s *StateManager) recordLatencyHistogram(e *ReceivedEvent) {
+	if s.latencyHistogram == nil {
+		return
+	}
+	if t, ok := sentTimestamp(&e.Event); ok {
+		s.latencyHistogram.record(e.ReceivedAt.Sub(t))
+	}
+}
+
+// latencyHistogramReport adds the latency histogram to the given report.
+func (s *StateManager) latencyHistogramReport(r *Report) {
+	if s.latencyHistogram != nil {
+		r.LatencyHistogram = s.latencyHistogram.report()
+	}
+}
@@ -0,0 +1,87 @@
+package sacura
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLatencyHistogramConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		buckets []string
+		want    []time.Duration
+		wantErr bool
+	}{
+		{
+			name: "default",
+			want: []time.Duration{5 * time.Millisecond, 10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond, time.Second, 2500 * time.Millisecond, 5 * time.Second, 10 * time.Second, 30 * time.Second, time.Minute},
+		},
+		{
+			name:    "buckets",
+			buckets: []string{"100ms", "1s"},
+			want:    []time.Duration{100 * time.Millisecond, time.Second},
+		},
+		{
+			name:    "not increasing",
+			buckets: []string{"1s", "100ms"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid",
+			buckets: []string{"100"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := LatencyHistogramConfig{Buckets: tt.buckets}
+			err := c.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(tt.want, c.ParsedBuckets); !tt.wantErr && diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestBucketedLatencyHistogram(t *testing.T) {
+	h := newBucketedLatencyHistogram([]time.Duration{100 * time.Millisecond, time.Second})
+	for _, l := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second} {
+		h.record(l)
+	}
+
+	want := &LatencyHistogramReport{
+		Buckets: []LatencyBucket{{LE: 100 * time.Millisecond, Count: 2}, {LE: time.Second, Count: 3}, {Count: 4}},
+		Count:   4,
+		Sum:     2650 * time.Millisecond,
+	}
+	if diff := cmp.Diff(want, h.report()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, LatencyHistogramPath, nil))
+	wantBody := `# TYPE latency_e2e_slo_seconds histogram
+# UNIT latency_e2e_slo_seconds seconds
+# HELP latency_e2e_slo_seconds End-to-end latency of received events since ` + BenchmarkTimestampAttribute + `.
+latency_e2e_slo_seconds_bucket{le="0.1"} 2
+latency_e2e_slo_seconds_bucket{le="1"} 3
+latency_e2e_slo_seconds_bucket{le="+Inf"} 4
+latency_e2e_slo_seconds_sum 2.65
+latency_e2e_slo_seconds_count 4
+# EOF
+`
+	if diff := cmp.Diff(wantBody, w.Body.String()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != openMetricsContentType {
+		t.Errorf("want content type %s, got %s", openMetricsContentType, ct)
+	}
+}
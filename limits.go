@@ -0,0 +1,340 @@
+package sacura
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+type ReportSampling string
+
+const (
+	// ReportSamplingFirst keeps the first event IDs of each section, in partition key order.
+	ReportSamplingFirst ReportSampling = "first"
+	// ReportSamplingRandom keeps a random sample of the event IDs of each section.
+	ReportSamplingRandom ReportSampling = "random"
+)
+
+// ReportLimitsConfig bounds the size of the logged and written reports on large runs, counts are always exact.
+type ReportLimitsConfig struct {
+	// MaxIDsPerSection is the maximum number of events listed in each section of the report, for example lostEvents,
+	// the number of events omitted from each section is reported in omittedIds.
+	//
+	// Defaults to 0, no limit.
+	MaxIDsPerSection int `json:"maxIdsPerSection" yaml:"maxIdsPerSection"`
+	// Sampling is how the events listed in a truncated section are chosen.
+	//
+	// Defaults to ReportSamplingFirst.
+	Sampling ReportSampling `json:"sampling" yaml:"sampling"`
+	// SummaryOnly omits every list of events from the report, leaving counts and statistics only.
+	SummaryOnly bool `json:"summaryOnly" yaml:"summaryOnly"`
+}
+
+func (c *ReportLimitsConfig) validate() error {
+	if c.MaxIDsPerSection < 0 {
+		return invalidErr("report.limits.maxIdsPerSection", fmt.Errorf("%d cannot be negative", c.MaxIDsPerSection))
+	}
+	if c.SummaryOnly && c.MaxIDsPerSection > 0 {
+		return invalidErr("report.limits.maxIdsPerSection", fmt.Errorf("cannot be specified together with summaryOnly"))
+	}
+	switch c.Sampling {
+	case "":
+		c.Sampling = ReportSamplingFirst
+	case ReportSamplingFirst, ReportSamplingRandom:
+	default:
+		return invalidErr("report.limits.sampling", fmt.Errorf("unknown sampling %q, expected one of %v", c.Sampling, []ReportSampling{ReportSamplingFirst, ReportSamplingRandom}))
+	}
+	return nil
+}
+
+// limited returns the given report with its sections truncated as configured, the given report isn't modified.
+func (c *ReportLimitsConfig) limited(r Report) Report {
+	if c == nil || (!c.SummaryOnly && c.MaxIDsPerSection == 0) {
+		return r
+	}
+	limit := c.MaxIDsPerSection
+	if c.SummaryOnly {
+		limit = 0
+	}
+
+	l := reportLimiter{sampling: c.Sampling, limit: limit, omitted: make(map[string]int)}
+	r.LostEventsByPartitionKey = l.ids("lostEvents", r.LostEventsByPartitionKey)
+	r.DuplicateEventsByPartitionKey = l.ids("duplicateEvents", r.DuplicateEventsByPartitionKey)
+	r.UnexpectedEventsByPartitionKey = l.ids("unexpectedEvents", r.UnexpectedEventsByPartitionKey)
+	r.CorruptedEventsByPartitionKey = l.ids("corruptedEvents", r.CorruptedEventsByPartitionKey)
+	r.PostTerminationReceivedEventsByPartitionKey = l.ids("postTerminationReceivedEvents", r.PostTerminationReceivedEventsByPartitionKey)
+	r.NackedEventsByPartitionKey = l.ids("nackedEvents", r.NackedEventsByPartitionKey)
+	r.DeadLetteredEventsByPartitionKey = l.ids("deadLetteredEvents", r.DeadLetteredEventsByPartitionKey)
+	r.LeakedEventsByPartitionKey = l.ids("leakedEvents", r.LeakedEventsByPartitionKey)
+	r.UndroppedEventsByPartitionKey = l.ids("undroppedEvents", r.UndroppedEventsByPartitionKey)
+	r.RetriesByEvent = l.counts("retriesByEvent", r.RetriesByEvent)
+	if r.SuppressedDuplicates != nil {
+		suppressed := *r.SuppressedDuplicates
+		suppressed.EventsByPartitionKey = l.ids("suppressedDuplicates.events", suppressed.EventsByPartitionKey)
+		r.SuppressedDuplicates = &suppressed
+	}
+	if r.DeliveryAttempts != nil {
+		attempts := *r.DeliveryAttempts
+		attempts.AttemptsByEvent = l.counts("deliveryAttempts.attemptsByEvent", attempts.AttemptsByEvent)
+		r.DeliveryAttempts = &attempts
+	}
+	if r.Reply != nil {
+		reply := *r.Reply
+		reply.MissingEventsByPartitionKey = l.ids("reply.missingEvents", reply.MissingEventsByPartitionKey)
+		r.Reply = &reply
+	}
+	if r.Topology != nil && len(r.Topology.Steps) > 0 {
+		topology := *r.Topology
+		topology.Steps = make(map[string]TopologyStepReport, len(r.Topology.Steps))
+		for step, sr := range r.Topology.Steps {
+			sr.EventsByPartitionKey = l.ids("topology.steps."+step+".events", sr.EventsByPartitionKey)
+			topology.Steps[step] = sr
+		}
+		r.Topology = &topology
+	}
+	if r.Compression != nil {
+		compression := *r.Compression
+		compression.MangledEventsByPartitionKey = l.ids("compression.mangledEvents", compression.MangledEventsByPartitionKey)
+		r.Compression = &compression
+	}
+	if r.Serialization != nil {
+		serialization := *r.Serialization
+		serialization.InvalidEventsByPartitionKey = l.ids("serialization.invalidEvents", serialization.InvalidEventsByPartitionKey)
+		r.Serialization = &serialization
+	}
+	if r.TTL != nil {
+		ttl := *r.TTL
+		ttl.ViolationsByPartitionKey = l.ids("ttl.violations", ttl.ViolationsByPartitionKey)
+		r.TTL = &ttl
+	}
+	if r.ContentTypes != nil {
+		contentTypes := *r.ContentTypes
+		contentTypes.Mismatches = make(map[string]ContentTypeMismatchReport, len(r.ContentTypes.Mismatches))
+		for assertion, m := range r.ContentTypes.Mismatches {
+			m.EventsByPartitionKey = l.ids("contentTypes.mismatches."+assertion+".events", m.EventsByPartitionKey)
+			contentTypes.Mismatches[assertion] = m
+		}
+		r.ContentTypes = &contentTypes
+	}
+	r.Metrics.SendAttempts = l.counts("metrics.sendAttempts", r.Metrics.SendAttempts)
+	r.ExpiredEventsByPartitionKey = l.expiredEvents(r.ExpiredEventsByPartitionKey)
+	r.LateEventsByPartitionKey = l.lateEvents(r.LateEventsByPartitionKey)
+	r.FailedSendsByPartitionKey = l.failedSends(r.FailedSendsByPartitionKey)
+	r.OrderingViolationsByPartitionKey = l.orderingViolations("orderingViolations", r.OrderingViolationsByPartitionKey)
+	if r.ExcludedOrdering != nil {
+		excluded := *r.ExcludedOrdering
+		excluded.ViolationsByPartitionKey = l.orderingViolations("excludedOrdering.violations", excluded.ViolationsByPartitionKey)
+		r.ExcludedOrdering = &excluded
+	}
+	r.SpecViolations = l.specViolations(r.SpecViolations)
+	r.AttributeDiffsByEventID = l.attributeDiffs(r.AttributeDiffsByEventID)
+
+	if len(r.Scenarios) > 0 {
+		scenarios := make([]ScenarioReport, len(r.Scenarios))
+		for i, s := range r.Scenarios {
+			s.Report = c.limited(s.Report)
+			scenarios[i] = s
+		}
+		r.Scenarios = scenarios
+	}
+	if len(r.Streams) > 0 {
+		streams := make([]StreamReport, len(r.Streams))
+		for i, s := range r.Streams {
+			s.Report = c.limited(s.Report)
+			streams[i] = s
+		}
+		r.Streams = streams
+	}
+
+	if len(l.omitted) > 0 {
+		r.OmittedIDs = l.omitted
+	}
+	return r
+}
+
+// reportLimiter truncates the sections of a report to limit entries each.
+type reportLimiter struct {
+	sampling ReportSampling
+	limit    int
+	// omitted is the number of entries omitted by section.
+	omitted map[string]int
+}
+
+// keep returns the sorted keys of a section with the given number of entries by key and the indexes of the entries
+// to keep by key, it returns nil indexes when the whole section fits.
+func (l *reportLimiter) keep(section string, sizes map[string]int) ([]string, map[string][]int) {
+	keys := make([]string, 0, len(sizes))
+	total := 0
+	for k, n := range sizes {
+		keys = append(keys, k)
+		total += n
+	}
+	sort.Strings(keys)
+	if total <= l.limit {
+		return keys, nil
+	}
+	l.omitted[section] = total - l.limit
+
+	selected := make([]int, 0, l.limit)
+	if l.sampling == ReportSamplingRandom {
+		selected = append(selected, rand.Perm(total)[:l.limit]...)
+		sort.Ints(selected)
+	} else {
+		for i := 0; i < l.limit; i++ {
+			selected = append(selected, i)
+		}
+	}
+
+	indexes := make(map[string][]int)
+	offset := 0
+	for _, k := range keys {
+		for len(selected) > 0 && selected[0] < offset+sizes[k] {
+			indexes[k] = append(indexes[k], selected[0]-offset)
+			selected = selected[1:]
+		}
+		offset += sizes[k]
+	}
+	return keys, indexes
+}
+
+func (l *reportLimiter) ids(section string, m map[string][]string) map[string][]string {
+	sizes := make(map[string]int, len(m))
+	for k, v := range m {
+		sizes[k] = len(v)
+	}
+	keys, indexes := l.keep(section, sizes)
+	if indexes == nil {
+		return m
+	}
+	out := make(map[string][]string, len(indexes))
+	for _, k := range keys {
+		for _, i := range indexes[k] {
+			out[k] = append(out[k], m[k][i])
+		}
+	}
+	return out
+}
+
+// counts truncates a section of counts by event ID.
+func (l *reportLimiter) counts(section string, m map[string]int) map[string]int {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	_, indexes := l.keep(section, map[string]int{"": len(ids)})
+	if indexes == nil {
+		return m
+	}
+	sort.Strings(ids)
+	out := make(map[string]int, len(indexes[""]))
+	for _, i := range indexes[""] {
+		out[ids[i]] = m[ids[i]]
+	}
+	return out
+}
+
+func (l *reportLimiter) expiredEvents(m map[string][]ExpiredEvent) map[string][]ExpiredEvent {
+	sizes := make(map[string]int, len(m))
+	for k, v := range m {
+		sizes[k] = len(v)
+	}
+	keys, indexes := l.keep("expiredEvents", sizes)
+	if indexes == nil {
+		return m
+	}
+	out := make(map[string][]ExpiredEvent, len(indexes))
+	for _, k := range keys {
+		for _, i := range indexes[k] {
+			out[k] = append(out[k], m[k][i])
+		}
+	}
+	return out
+}
+
+func (l *reportLimiter) lateEvents(m map[string][]LateEvent) map[string][]LateEvent {
+	sizes := make(map[string]int, len(m))
+	for k, v := range m {
+		sizes[k] = len(v)
+	}
+	keys, indexes := l.keep("lateEvents", sizes)
+	if indexes == nil {
+		return m
+	}
+	out := make(map[string][]LateEvent, len(indexes))
+	for _, k := range keys {
+		for _, i := range indexes[k] {
+			out[k] = append(out[k], m[k][i])
+		}
+	}
+	return out
+}
+
+func (l *reportLimiter) failedSends(m map[string][]FailedSend) map[string][]FailedSend {
+	sizes := make(map[string]int, len(m))
+	for k, v := range m {
+		sizes[k] = len(v)
+	}
+	keys, indexes := l.keep("failedSends", sizes)
+	if indexes == nil {
+		return m
+	}
+	out := make(map[string][]FailedSend, len(indexes))
+	for _, k := range keys {
+		for _, i := range indexes[k] {
+			out[k] = append(out[k], m[k][i])
+		}
+	}
+	return out
+}
+
+// orderingViolations truncates the violations of each partition, keeping the displacement statistics.
+func (l *reportLimiter) orderingViolations(section string, m map[string]OrderingReport) map[string]OrderingReport {
+	sizes := make(map[string]int, len(m))
+	for k, v := range m {
+		sizes[k] = len(v.Violations)
+	}
+	keys, indexes := l.keep(section, sizes)
+	if indexes == nil {
+		return m
+	}
+	out := make(map[string]OrderingReport, len(m))
+	for _, k := range keys {
+		r := m[k]
+		violations := make([]OrderingViolation, 0, len(indexes[k]))
+		for _, i := range indexes[k] {
+			violations = append(violations, r.Violations[i])
+		}
+		r.Violations = violations
+		out[k] = r
+	}
+	return out
+}
+
+func (l *reportLimiter) specViolations(violations []SpecViolation) []SpecViolation {
+	_, indexes := l.keep("specViolations", map[string]int{"": len(violations)})
+	if indexes == nil {
+		return violations
+	}
+	out := make([]SpecViolation, 0, len(indexes[""]))
+	for _, i := range indexes[""] {
+		out = append(out, violations[i])
+	}
+	return out
+}
+
+func (l *reportLimiter) attributeDiffs(m map[string]AttributeDiff) map[string]AttributeDiff {
+	ids := make([]string, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	_, indexes := l.keep("attributeDiffsByEventId", map[string]int{"": len(ids)})
+	if indexes == nil {
+		return m
+	}
+	sort.Strings(ids)
+	out := make(map[string]AttributeDiff, len(indexes[""]))
+	for _, i := range indexes[""] {
+		out[ids[i]] = m[ids[i]]
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package sacura
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestReportLimitsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ReportLimitsConfig
+		want    ReportLimitsConfig
+		wantErr bool
+	}{
+		{
+			name:   "default sampling",
+			config: ReportLimitsConfig{MaxIDsPerSection: 10},
+			want:   ReportLimitsConfig{MaxIDsPerSection: 10, Sampling: ReportSamplingFirst},
+		},
+		{
+			name:   "summary only",
+			config: ReportLimitsConfig{SummaryOnly: true},
+			want:   ReportLimitsConfig{SummaryOnly: true, Sampling: ReportSamplingFirst},
+		},
+		{
+			name:    "negative max ids",
+			config:  ReportLimitsConfig{MaxIDsPerSection: -1},
+			wantErr: true,
+		},
+		{
+			name:    "summary only with max ids",
+			config:  ReportLimitsConfig{MaxIDsPerSection: 10, SummaryOnly: true},
+			wantErr: true,
+		},
+		{
+			name:    "unknown sampling",
+			config:  ReportLimitsConfig{MaxIDsPerSection: 10, Sampling: "last"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestReportLimitsConfigLimited(t *testing.T) {
+	report := func() Report {
+		return Report{
+			LostCount: 5,
+			LostEventsByPartitionKey: map[string][]string{
+				"p1": {"1", "2", "3"},
+				"p2": {"4", "5"},
+			},
+			DuplicateCount:                1,
+			DuplicateEventsByPartitionKey: map[string][]string{"p1": {"6"}},
+			RetriesByEvent:                map[string]int{"a": 1, "b": 2, "c": 3},
+			OrderingViolationsByPartitionKey: map[string]OrderingReport{
+				"p1": {Violations: []OrderingViolation{{ID: "1"}, {ID: "2"}, {ID: "3"}}, MaxDisplacement: 4},
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		config *ReportLimitsConfig
+		want   Report
+	}{
+		{
+			name:   "no limits",
+			config: nil,
+			want:   report(),
+		},
+		{
+			name:   "first",
+			config: &ReportLimitsConfig{MaxIDsPerSection: 2, Sampling: ReportSamplingFirst},
+			want: Report{
+				LostCount:                     5,
+				LostEventsByPartitionKey:      map[string][]string{"p1": {"1", "2"}},
+				DuplicateCount:                1,
+				DuplicateEventsByPartitionKey: map[string][]string{"p1": {"6"}},
+				RetriesByEvent:                map[string]int{"a": 1, "b": 2},
+				OrderingViolationsByPartitionKey: map[string]OrderingReport{
+					"p1": {Violations: []OrderingViolation{{ID: "1"}, {ID: "2"}}, MaxDisplacement: 4},
+				},
+				OmittedIDs: map[string]int{"lostEvents": 3, "retriesByEvent": 1, "orderingViolations": 1},
+			},
+		},
+		{
+			name:   "summary only",
+			config: &ReportLimitsConfig{SummaryOnly: true, Sampling: ReportSamplingFirst},
+			want: Report{
+				LostCount:                     5,
+				LostEventsByPartitionKey:      map[string][]string{},
+				DuplicateCount:                1,
+				DuplicateEventsByPartitionKey: map[string][]string{},
+				RetriesByEvent:                map[string]int{},
+				OrderingViolationsByPartitionKey: map[string]OrderingReport{
+					"p1": {Violations: []OrderingViolation{}, MaxDisplacement: 4},
+				},
+				OmittedIDs: map[string]int{"lostEvents": 5, "duplicateEvents": 1, "retriesByEvent": 3, "orderingViolations": 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := report()
+			got := tt.config.limited(r)
+			ignoreMetrics := cmpopts.IgnoreFields(Report{}, "Metrics")
+			if diff := cmp.Diff(tt.want, got, ignoreMetrics); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if diff := cmp.Diff(report(), r, ignoreMetrics); diff != "" {
+				t.Errorf("the given report has been modified (-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestReportLimitsConfigLimitedRandom(t *testing.T) {
+	r := Report{LostEventsByPartitionKey: map[string][]string{
+		"p1": {"1", "2", "3", "4"},
+		"p2": {"5", "6", "7", "8"},
+	}}
+	config := &ReportLimitsConfig{MaxIDsPerSection: 3, Sampling: ReportSamplingRandom}
+
+	got := config.limited(r)
+	sampled := map[string]bool{}
+	for pk, ids := range got.LostEventsByPartitionKey {
+		for _, id := range ids {
+			found := false
+			for _, sent := range r.LostEventsByPartitionKey[pk] {
+				found = found || sent == id
+			}
+			if !found || sampled[id] {
+				t.Errorf("unexpected sampled event %s of partition %s", id, pk)
+			}
+			sampled[id] = true
+		}
+	}
+	if len(sampled) != 3 {
+		t.Errorf("expected 3 sampled events, got %v", got.LostEventsByPartitionKey)
+	}
+	if got.OmittedIDs["lostEvents"] != 5 {
+		t.Errorf("expected 5 omitted events, got %v", got.OmittedIDs)
+	}
+}
+
+func TestWriteReportsLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "report.json")
+	config := ReportConfig{
+		Writers: []ReportWriterConfig{{Format: ReportFormatJSON, Path: path}},
+		Limits:  &ReportLimitsConfig{SummaryOnly: true},
+	}
+	report := Report{LostCount: 2, LostEventsByPartitionKey: map[string][]string{"p1": {"1", "2"}}}
+
+	if err := writeReports(config, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.LostCount != 2 || len(got.LostEventsByPartitionKey) != 0 || got.OmittedIDs["lostEvents"] != 2 {
+		t.Errorf("expected lost events to be omitted with an exact count, got %s", string(b))
+	}
+}
@@ -0,0 +1,370 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// LoadPhaseExtension is the extension carrying the name of the load profile phase events have been sent in.
+const LoadPhaseExtension = "sacuraloadphase"
+
+type LoadProfileType string
+
+const (
+	// LoadProfileConstant sends events at sender.frequency for the whole test.
+	LoadProfileConstant LoadProfileType = "constant"
+	// LoadProfileRamp linearly increases the rate from the start to the peak frequency over the profile duration, then
+	// keeps sending at the peak frequency.
+	LoadProfileRamp LoadProfileType = "ramp"
+	// LoadProfileStep increases the rate from the start to the peak frequency in equal steps, each step lasting the
+	// profile duration.
+	LoadProfileStep LoadProfileType = "step"
+	// LoadProfileSpike sends at the start frequency and at the peak frequency for the profile duration after the
+	// configured offset.
+	LoadProfileSpike LoadProfileType = "spike"
+	// LoadProfileSine oscillates between the start and the peak frequency with a period equal to the profile duration.
+	LoadProfileSine LoadProfileType = "sine"
+
+	// loadPhaseMaxWait bounds the wait between hits so that rate changes are picked up when the rate is close to 0.
+	loadPhaseMaxWait = 100 * time.Millisecond
+)
+
+type LoadProfileConfig struct {
+	Type LoadProfileType `json:"type" yaml:"type"`
+
+	// StartFrequency is the number of events per second sent at the beginning of the test.
+	//
+	// Defaults to sender.frequency.
+	StartFrequency int `json:"startFrequency" yaml:"startFrequency"`
+	// PeakFrequency is the highest number of events per second sent during the test.
+	PeakFrequency int `json:"peakFrequency" yaml:"peakFrequency"`
+	// Duration is the duration of the ramp, of each step or of the spike, or the period of the sine wave.
+	Duration string `json:"duration" yaml:"duration"`
+	// Steps is the number of steps of the step profile.
+	//
+	// Defaults to 1.
+	Steps int `json:"steps" yaml:"steps"`
+	// At is the offset from the beginning of the test at which the spike starts.
+	At string `json:"at" yaml:"at"`
+
+	ParsedDuration time.Duration
+	ParsedAt       time.Duration
+}
+
+// loadPhase is a phase of a load profile during which the rate changes linearly.
+type loadPhase struct {
+	name       string
+	start      time.Duration
+	end        time.Duration
+	startFreq  float64
+	endFreq    float64
+	unbounded  bool
+	hitsBefore float64
+}
+
+func (c *LoadProfileConfig) validate(frequency int) error {
+	switch c.Type {
+	case LoadProfileConstant:
+		return nil
+	case LoadProfileRamp, LoadProfileStep, LoadProfileSpike, LoadProfileSine:
+	default:
+		return invalidErr("sender.loadProfile.type", fmt.Errorf("unknown type %q, expected one of %v", c.Type, []LoadProfileType{
+			LoadProfileConstant, LoadProfileRamp, LoadProfileStep, LoadProfileSpike, LoadProfileSine,
+		}))
+	}
+
+	if c.StartFrequency == 0 {
+		c.StartFrequency = frequency
+	}
+	if c.StartFrequency < 0 {
+		return invalidErr("sender.loadProfile.startFrequency", errors.New("cannot be negative"))
+	}
+	if c.PeakFrequency <= c.StartFrequency {
+		return invalidErr("sender.loadProfile.peakFrequency", fmt.Errorf("must be greater than the start frequency %d", c.StartFrequency))
+	}
+	if c.Type == LoadProfileSine && c.StartFrequency == 0 {
+		return invalidErr("sender.loadProfile.startFrequency", errors.New("must be greater than 0 for the sine profile"))
+	}
+
+	var err error
+	c.ParsedDuration, err = time.ParseDuration(c.Duration)
+	if err != nil {
+		return invalidErr("sender.loadProfile.duration", err)
+	}
+	if c.ParsedDuration <= 0 {
+		return invalidErr("sender.loadProfile.duration", errors.New("must be greater than 0"))
+	}
+
+	if c.Type == LoadProfileStep {
+		if c.Steps == 0 {
+			c.Steps = 1
+		}
+		if c.Steps < 0 {
+			return invalidErr("sender.loadProfile.steps", errors.New("cannot be negative"))
+		}
+	}
+
+	if c.Type == LoadProfileSpike {
+		c.ParsedAt, err = time.ParseDuration(c.At)
+		if err != nil {
+			return invalidErr("sender.loadProfile.at", err)
+		}
+		if c.ParsedAt < 0 {
+			return invalidErr("sender.loadProfile.at", errors.New("cannot be negative"))
+		}
+	}
+
+	return nil
+}
+
+// pacer returns the vegeta.Pacer implementing the load profile.
+func (c *LoadProfileConfig) pacer() vegeta.Pacer {
+	if c.Type == LoadProfileSine {
+		return vegeta.SinePacer{
+			Period:  c.ParsedDuration,
+			Mean:    vegeta.Rate{Freq: (c.StartFrequency + c.PeakFrequency) / 2, Per: time.Second},
+			Amp:     vegeta.Rate{Freq: (c.PeakFrequency - c.StartFrequency) / 2, Per: time.Second},
+			StartAt: vegeta.Trough,
+		}
+	}
+	return phasedPacer(c.phases(0))
+}
+
+// phases returns the phases of the load profile up to the given test duration, the last phase is unbounded when
+// the duration is 0.
+func (c *LoadProfileConfig) phases(duration time.Duration) []loadPhase {
+	start := float64(c.StartFrequency)
+	peak := float64(c.PeakFrequency)
+
+	var phases []loadPhase
+	add := func(name string, length time.Duration, startFreq, endFreq float64) {
+		var begin time.Duration
+		if len(phases) > 0 {
+			begin = phases[len(phases)-1].end
+		}
+		phases = append(phases, loadPhase{name: name, start: begin, end: begin + length, startFreq: startFreq, endFreq: endFreq})
+	}
+
+	switch c.Type {
+	case LoadProfileRamp:
+		add("ramp-up", c.ParsedDuration, start, peak)
+		add("peak", 0, peak, peak)
+	case LoadProfileStep:
+		for i := 0; i < c.Steps; i++ {
+			f := start + (peak-start)*float64(i)/float64(c.Steps)
+			add(fmt.Sprintf("step-%d", i), c.ParsedDuration, f, f)
+		}
+		add(fmt.Sprintf("step-%d", c.Steps), 0, peak, peak)
+	case LoadProfileSpike:
+		if c.ParsedAt > 0 {
+			add("baseline", c.ParsedAt, start, start)
+		}
+		add("spike", c.ParsedDuration, peak, peak)
+		add("recovery", 0, start, start)
+	case LoadProfileSine:
+		// The sine wave starts at its trough, the rate rises for half a period and falls for the other half.
+		half := c.ParsedDuration / 2
+		for i := 0; duration > 0 && time.Duration(i)*half < duration; i++ {
+			if i%2 == 0 {
+				add(fmt.Sprintf("rising-%d", i/2), half, start, peak)
+			} else {
+				add(fmt.Sprintf("falling-%d", i/2), half, peak, start)
+			}
+		}
+	default:
+		add("constant", 0, start, start)
+	}
+
+	hits := 0.0
+	for i := range phases {
+		phases[i].hitsBefore = hits
+		hits += phases[i].hits(phases[i].end - phases[i].start)
+	}
+	if c.Type != LoadProfileSine {
+		phases[len(phases)-1].unbounded = true
+	}
+
+	if duration > 0 {
+		clipped := phases[:0]
+		for _, p := range phases {
+			if p.start >= duration {
+				break
+			}
+			if p.unbounded || p.end > duration {
+				p.endFreq = p.rate(duration - p.start)
+				p.end = duration
+			}
+			clipped = append(clipped, p)
+		}
+		phases = clipped
+	}
+	return phases
+}
+
+// loadPhaseIndex returns the index of the phase including the given offset from the beginning of the test, offsets
+// past the last phase belong to the last phase.
+func loadPhaseIndex(phases []loadPhase, offset time.Duration) int {
+	i := 0
+	for i < len(phases)-1 && offset >= phases[i].end {
+		i++
+	}
+	return i
+}
+
+// rate returns the rate in hits per second at the given offset from the beginning of the phase.
+func (p *loadPhase) rate(offset time.Duration) float64 {
+	length := p.end - p.start
+	if p.unbounded || length <= 0 || p.startFreq == p.endFreq {
+		return p.startFreq
+	}
+	return p.startFreq + (p.endFreq-p.startFreq)*float64(offset)/float64(length)
+}
+
+// hits returns the number of hits sent from the beginning of the phase to the given offset.
+func (p *loadPhase) hits(offset time.Duration) float64 {
+	if offset <= 0 {
+		return 0
+	}
+	return (p.startFreq + p.rate(offset)) / 2 * offset.Seconds()
+}
+
+// phasedPacer paces an attack following piecewise linear load phases.
+type phasedPacer []loadPhase
+
+var _ vegeta.Pacer = phasedPacer{}
+
+func (pp phasedPacer) phase(elapsed time.Duration) *loadPhase {
+	for i := range pp {
+		if pp[i].unbounded || elapsed < pp[i].end {
+			return &pp[i]
+		}
+	}
+	return &pp[len(pp)-1]
+}
+
+func (pp phasedPacer) hits(elapsed time.Duration) float64 {
+	p := pp.phase(elapsed)
+	return p.hitsBefore + p.hits(elapsed-p.start)
+}
+
+// Pace implements vegeta.Pacer.
+func (pp phasedPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	expected := pp.hits(elapsed)
+	if float64(hits) < expected {
+		// Running behind, send next hit immediately.
+		return 0, false
+	}
+
+	rate := pp.Rate(elapsed)
+	if rate <= 0 {
+		return loadPhaseMaxWait, false
+	}
+	wait := time.Duration((float64(hits) + 1 - expected) / rate * float64(time.Second))
+	return time.Duration(math.Min(float64(wait), float64(loadPhaseMaxWait))), false
+}
+
+// Rate implements vegeta.Pacer.
+func (pp phasedPacer) Rate(elapsed time.Duration) float64 {
+	p := pp.phase(elapsed)
+	return p.rate(elapsed - p.start)
+}
+
+// LoadPhaseReport correlates events with a phase of the load profile, events are attributed to the phase carried by
+// their LoadPhaseExtension or, when missing, to phases by send time.
+type LoadPhaseReport struct {
+	Name string `json:"name"`
+	// Start is the offset from the beginning of the test at which the phase starts.
+	Start time.Duration `json:"start"`
+	// End is the offset from the beginning of the test at which the phase ends.
+	End            time.Duration `json:"end"`
+	StartFrequency float64       `json:"startFrequency"`
+	EndFrequency   float64       `json:"endFrequency"`
+	SentCount      int           `json:"sentCount"`
+	ReceivedCount  int           `json:"receivedCount"`
+	LostCount      int           `json:"lostCount"`
+	// DuplicateCount is the number of duplicates of events sent during the phase.
+	DuplicateCount int          `json:"duplicateCount"`
+	Latency        LatencyStats `json:"latency"`
+}
+
+// recordSentLoadPhase records the load profile phase the given event has been sent in, it must be called while
+// holding the lock.
+func (s *StateManager) recordSentLoadPhase(e *ce.Event) {
+	if s.config.Sender.LoadProfile == nil {
+		return
+	}
+	v, ok := e.Extensions()[LoadPhaseExtension]
+	if !ok {
+		return
+	}
+	if s.loadPhases == nil {
+		s.loadPhases = make(map[string]string)
+	}
+	s.loadPhases[e.ID()] = fmt.Sprint(v)
+}
+
+// loadPhasesReport attributes sent events to load profile phases, it must be called while holding the lock and after
+// lost events and duplicates have been reported.
+func (s *StateManager) loadPhasesReport(r *Report, lost sets.String) {
+	profile := s.config.Sender.LoadProfile
+	startedAt := s.metrics.Metrics.Earliest
+	if profile == nil || startedAt.IsZero() {
+		return
+	}
+
+	phases := profile.phases(s.config.ParsedDuration)
+	if len(phases) == 0 {
+		return
+	}
+	reports := make([]LoadPhaseReport, len(phases))
+	latencies := make([][]time.Duration, len(phases))
+	byName := make(map[string]int, len(phases))
+	for i, p := range phases {
+		reports[i] = LoadPhaseReport{
+			Name:           p.name,
+			Start:          p.start,
+			End:            p.end,
+			StartFrequency: p.startFreq,
+			EndFrequency:   p.endFreq,
+		}
+		byName[p.name] = i
+	}
+	duplicates := make(map[string]int)
+	for _, ids := range r.DuplicateEventsByPartitionKey {
+		for _, id := range ids {
+			duplicates[id]++
+		}
+	}
+
+	for id, sentAt := range s.sentAt {
+		i, ok := byName[s.loadPhases[id]]
+		if !ok {
+			if sentAt.IsZero() {
+				continue
+			}
+			i = loadPhaseIndex(phases, sentAt.Sub(startedAt))
+		}
+
+		reports[i].SentCount++
+		reports[i].DuplicateCount += duplicates[id]
+		if lost.Has(id) {
+			reports[i].LostCount++
+		}
+		if receivedAt, ok := s.receivedAt[id]; ok {
+			reports[i].ReceivedCount++
+			if !sentAt.IsZero() {
+				latencies[i] = append(latencies[i], receivedAt.Sub(sentAt))
+			}
+		}
+	}
+	for i := range reports {
+		reports[i].Latency = NewLatencyStats(latencies[i])
+	}
+	r.LoadPhases = reports
+}
@@ -0,0 +1,217 @@
+package sacura
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestLoadProfilePhases(t *testing.T) {
+
+	type phase struct {
+		Name       string
+		Start, End time.Duration
+		From, To   float64
+	}
+
+	tests := []struct {
+		name     string
+		config   LoadProfileConfig
+		duration time.Duration
+		want     []phase
+	}{
+		{
+			name:     "ramp",
+			config:   LoadProfileConfig{Type: LoadProfileRamp, StartFrequency: 10, PeakFrequency: 110, ParsedDuration: 10 * time.Second},
+			duration: time.Minute,
+			want: []phase{
+				{Name: "ramp-up", Start: 0, End: 10 * time.Second, From: 10, To: 110},
+				{Name: "peak", Start: 10 * time.Second, End: time.Minute, From: 110, To: 110},
+			},
+		},
+		{
+			name:     "ramp longer than the test",
+			config:   LoadProfileConfig{Type: LoadProfileRamp, StartFrequency: 10, PeakFrequency: 110, ParsedDuration: 10 * time.Second},
+			duration: 5 * time.Second,
+			want: []phase{
+				{Name: "ramp-up", Start: 0, End: 5 * time.Second, From: 10, To: 60},
+			},
+		},
+		{
+			name:     "step",
+			config:   LoadProfileConfig{Type: LoadProfileStep, StartFrequency: 10, PeakFrequency: 30, Steps: 2, ParsedDuration: 10 * time.Second},
+			duration: time.Minute,
+			want: []phase{
+				{Name: "step-0", Start: 0, End: 10 * time.Second, From: 10, To: 10},
+				{Name: "step-1", Start: 10 * time.Second, End: 20 * time.Second, From: 20, To: 20},
+				{Name: "step-2", Start: 20 * time.Second, End: time.Minute, From: 30, To: 30},
+			},
+		},
+		{
+			name:     "spike",
+			config:   LoadProfileConfig{Type: LoadProfileSpike, StartFrequency: 10, PeakFrequency: 100, ParsedAt: 20 * time.Second, ParsedDuration: 5 * time.Second},
+			duration: time.Minute,
+			want: []phase{
+				{Name: "baseline", Start: 0, End: 20 * time.Second, From: 10, To: 10},
+				{Name: "spike", Start: 20 * time.Second, End: 25 * time.Second, From: 100, To: 100},
+				{Name: "recovery", Start: 25 * time.Second, End: time.Minute, From: 10, To: 10},
+			},
+		},
+		{
+			name:     "sine",
+			config:   LoadProfileConfig{Type: LoadProfileSine, StartFrequency: 10, PeakFrequency: 100, ParsedDuration: time.Minute},
+			duration: 90 * time.Second,
+			want: []phase{
+				{Name: "rising-0", Start: 0, End: 30 * time.Second, From: 10, To: 100},
+				{Name: "falling-0", Start: 30 * time.Second, End: time.Minute, From: 100, To: 10},
+				{Name: "rising-1", Start: time.Minute, End: 90 * time.Second, From: 10, To: 100},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []phase
+			for _, p := range tt.config.phases(tt.duration) {
+				got = append(got, phase{Name: p.name, Start: p.start, End: p.end, From: p.startFreq, To: p.endFreq})
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestPhasedPacer(t *testing.T) {
+
+	config := LoadProfileConfig{Type: LoadProfileRamp, StartFrequency: 10, PeakFrequency: 110, ParsedDuration: 10 * time.Second}
+	pacer := config.pacer()
+
+	if got := pacer.Rate(5 * time.Second); got != 60 {
+		t.Errorf("expected rate 60 in the middle of the ramp, got %v", got)
+	}
+	if got := pacer.Rate(time.Minute); got != 110 {
+		t.Errorf("expected peak rate 110 after the ramp, got %v", got)
+	}
+
+	// Simulate an attack and count hits.
+	hits := uint64(0)
+	for elapsed := time.Duration(0); elapsed < 20*time.Second; {
+		wait, stop := pacer.Pace(elapsed, hits)
+		if stop {
+			t.Fatal("unexpected stop")
+		}
+		if wait == 0 {
+			hits++
+			continue
+		}
+		elapsed += wait
+	}
+	// (10 + 110) / 2 * 10s + 110 * 10s
+	if want := 1700.0; math.Abs(float64(hits)-want) > 2 {
+		t.Errorf("expected about %v hits, got %d", want, hits)
+	}
+
+	if _, ok := (&LoadProfileConfig{Type: LoadProfileSine, StartFrequency: 10, PeakFrequency: 100, ParsedDuration: time.Minute}).pacer().(vegeta.SinePacer); !ok {
+		t.Error("expected sine pacer for the sine profile")
+	}
+}
+
+func TestStateManagerLoadPhases(t *testing.T) {
+
+	startedAt := time.UnixMilli(time.Now().UnixMilli())
+	config := Config{
+		Sender: SenderConfig{LoadProfile: &LoadProfileConfig{
+			Type:           LoadProfileSpike,
+			StartFrequency: 10,
+			PeakFrequency:  100,
+			ParsedAt:       10 * time.Second,
+			ParsedDuration: 10 * time.Second,
+		}},
+		ParsedDuration: 30 * time.Second,
+	}
+
+	sent := make(chan ce.Event, 4)
+	received := make(chan ReceivedEvent, 5)
+	sm := newTestStateManager(t, config)
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	// One event per phase, the event sent during the spike is lost and the event sent during the recovery is
+	// duplicated.
+	for i, offset := range []time.Duration{time.Second, 15 * time.Second, 25 * time.Second} {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(startedAt.Add(offset).UnixMilli()))
+		sent <- e
+		if i != 1 {
+			received <- ReceivedEvent{Event: e, ReceivedAt: startedAt.Add(offset + time.Second)}
+		}
+		if i == 2 {
+			received <- ReceivedEvent{Event: e, ReceivedAt: startedAt.Add(offset + 2*time.Second)}
+		}
+	}
+	// The phase tagged by the sender takes precedence over the send time.
+	tagged := cetest.FullEvent()
+	tagged.SetID("3")
+	tagged.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(startedAt.Add(20*time.Second).UnixMilli()))
+	tagged.SetExtension(LoadPhaseExtension, "spike")
+	sent <- tagged
+	received <- ReceivedEvent{Event: tagged, ReceivedAt: startedAt.Add(23 * time.Second)}
+	close(sent)
+	close(received)
+	<-sentSignal
+	<-receivedSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 4, Metrics: SendMetrics{Earliest: startedAt}})
+	report := sm.GenerateReport()
+
+	if len(report.LoadPhases) != 3 {
+		t.Fatalf("expected 3 load phases, got %+v", report.LoadPhases)
+	}
+	for i, want := range []struct {
+		name                             string
+		sent, received, lost, duplicates int
+		maxLatency                       time.Duration
+	}{
+		{"baseline", 1, 1, 0, 0, time.Second},
+		{"spike", 2, 1, 1, 0, 3 * time.Second},
+		{"recovery", 1, 1, 0, 1, time.Second},
+	} {
+		p := report.LoadPhases[i]
+		if p.Name != want.name || p.SentCount != want.sent || p.ReceivedCount != want.received || p.LostCount != want.lost ||
+			p.DuplicateCount != want.duplicates || p.Latency.Max != want.maxLatency {
+			t.Errorf("unexpected phase %d %+v", i, p)
+		}
+	}
+}
+
+func TestNewTargeterGeneratorLoadPhase(t *testing.T) {
+	config := Config{Sender: SenderConfig{
+		Target: "http://localhost",
+		LoadProfile: &LoadProfileConfig{
+			Type:           LoadProfileSpike,
+			StartFrequency: 10,
+			PeakFrequency:  100,
+			ParsedAt:       time.Hour,
+			ParsedDuration: time.Minute,
+		},
+	}}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	if err := f(&vegeta.Target{}); err != nil {
+		t.Fatal(err)
+	}
+	e := <-out
+	if got := e.Extensions()[LoadPhaseExtension]; got != "baseline" {
+		t.Errorf("want load phase baseline, got %v", got)
+	}
+}
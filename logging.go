@@ -0,0 +1,165 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogComponent is a component whose verbosity can be configured with LoggingConfig.Components.
+type LogComponent string
+
+const (
+	LogComponentSender   LogComponent = "sender"
+	LogComponentReceiver LogComponent = "receiver"
+	LogComponentState    LogComponent = "state"
+	LogComponentReport   LogComponent = "report"
+
+	// logComponentRun is the component of the test lifecycle logs, its level is LoggingConfig.Level.
+	logComponentRun LogComponent = ""
+)
+
+var logComponents = []LogComponent{LogComponentSender, LogComponentReceiver, LogComponentState, LogComponentReport}
+
+const (
+	LogEncodingConsole = "console"
+	LogEncodingJSON    = "json"
+)
+
+// LoggingConfig configures structured, leveled logs written to stderr.
+type LoggingConfig struct {
+	// Level is the minimum level of logged entries, one of debug, info, warn or error.
+	//
+	// Defaults to info.
+	Level string `json:"level" yaml:"level"`
+	// Components overrides Level for the given components, one of sender, receiver, state or report.
+	Components map[LogComponent]string `json:"components" yaml:"components"`
+	// Encoding is LogEncodingConsole or LogEncodingJSON.
+	//
+	// Defaults to LogEncodingConsole.
+	Encoding string `json:"encoding" yaml:"encoding"`
+	// Sampling limits the entries logged with the same message, so that per-event logs of high-rate runs don't
+	// drown other entries.
+	Sampling *LogSamplingConfig `json:"sampling" yaml:"sampling"`
+}
+
+// LogSamplingConfig logs the first Initial entries with the same level and message each second of each component and
+// then one every Thereafter entries.
+type LogSamplingConfig struct {
+	Initial    int `json:"initial" yaml:"initial"`
+	Thereafter int `json:"thereafter" yaml:"thereafter"`
+}
+
+func (c *LoggingConfig) validate() error {
+	if _, err := parseLogLevel(c.Level); err != nil {
+		return invalidErr("logging.level", err)
+	}
+	for component, level := range c.Components {
+		if !isLogComponent(component) {
+			return invalidErr("logging.components", fmt.Errorf("unknown component %q, expected one of %v", component, logComponents))
+		}
+		if _, err := parseLogLevel(level); err != nil {
+			return invalidErr(fmt.Sprintf("logging.components.%s", component), err)
+		}
+	}
+	switch c.Encoding {
+	case "", LogEncodingConsole, LogEncodingJSON:
+	default:
+		return invalidErr("logging.encoding", fmt.Errorf("unknown encoding %q, expected one of %v", c.Encoding, []string{LogEncodingConsole, LogEncodingJSON}))
+	}
+	if s := c.Sampling; s != nil && (s.Initial <= 0 || s.Thereafter <= 0) {
+		return invalidErr("logging.sampling", errors.New("initial and thereafter must be greater than 0"))
+	}
+	return nil
+}
+
+func isLogComponent(component LogComponent) bool {
+	for _, c := range logComponents {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLogLevel(level string) (zapcore.Level, error) {
+	l := zapcore.InfoLevel
+	if level == "" {
+		return l, nil
+	}
+	err := l.UnmarshalText([]byte(level))
+	return l, err
+}
+
+// loggers are the loggers of each component.
+type loggers map[LogComponent]*zap.SugaredLogger
+
+// currentLoggers holds the loggers configured by the last test, so that they can be replaced while goroutines of a
+// previous test are still logging.
+var currentLoggers atomic.Value
+
+func init() {
+	l, err := newLoggers(&LoggingConfig{}, os.Stderr)
+	if err != nil {
+		panic(err)
+	}
+	currentLoggers.Store(l)
+}
+
+func newLoggers(config *LoggingConfig, w zapcore.WriteSyncer) (loggers, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	if config.Encoding == LogEncodingJSON {
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	} else {
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	}
+	out := zapcore.Lock(w)
+
+	l := make(loggers, len(logComponents)+1)
+	for _, component := range append([]LogComponent{logComponentRun}, logComponents...) {
+		level := config.Level
+		if v, ok := config.Components[component]; ok {
+			level = v
+		}
+		lvl, err := parseLogLevel(level)
+		if err != nil {
+			return nil, err
+		}
+		core := zapcore.NewCore(encoder, out, lvl)
+		if config.Sampling != nil {
+			core = zapcore.NewSamplerWithOptions(core, time.Second, config.Sampling.Initial, config.Sampling.Thereafter)
+		}
+		logger := zap.New(core)
+		if component != logComponentRun {
+			logger = logger.Named(string(component))
+		}
+		l[component] = logger.Sugar()
+	}
+	return l, nil
+}
+
+// configureLogging replaces the loggers of all the components, the default config is used when config is nil.
+func configureLogging(config *LoggingConfig) error {
+	if config == nil {
+		config = &LoggingConfig{}
+	}
+	l, err := newLoggers(config, os.Stderr)
+	if err != nil {
+		return err
+	}
+	currentLoggers.Store(l)
+	return nil
+}
+
+// logger returns the logger of the given component.
+func logger(component LogComponent) *zap.SugaredLogger {
+	return currentLoggers.Load().(loggers)[component]
+}
@@ -0,0 +1,120 @@
+package sacura
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggingConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  LoggingConfig
+		wantErr bool
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "levels and sampling",
+			config: LoggingConfig{
+				Level:      "warn",
+				Components: map[LogComponent]string{LogComponentSender: "debug", LogComponentReport: "error"},
+				Encoding:   LogEncodingJSON,
+				Sampling:   &LogSamplingConfig{Initial: 10, Thereafter: 100},
+			},
+		},
+		{
+			name:    "unknown level",
+			config:  LoggingConfig{Level: "verbose"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown component",
+			config:  LoggingConfig{Components: map[LogComponent]string{"aggregator": "info"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown component level",
+			config:  LoggingConfig{Components: map[LogComponent]string{LogComponentState: "verbose"}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown encoding",
+			config:  LoggingConfig{Encoding: "logfmt"},
+			wantErr: true,
+		},
+		{
+			name:    "zero initial sampling",
+			config:  LoggingConfig{Sampling: &LogSamplingConfig{Thereafter: 100}},
+			wantErr: true,
+		},
+		{
+			name:    "zero thereafter sampling",
+			config:  LoggingConfig{Sampling: &LogSamplingConfig{Initial: 10}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoggers(t *testing.T) {
+
+	buf := &bytes.Buffer{}
+	l, err := newLoggers(&LoggingConfig{
+		Level:      "warn",
+		Components: map[LogComponent]string{LogComponentSender: "debug", LogComponentReport: "error"},
+		Encoding:   LogEncodingJSON,
+		Sampling:   &LogSamplingConfig{Initial: 2, Thereafter: 100},
+	}, zapcore.AddSync(buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l[logComponentRun].Info("run info")
+	l[logComponentRun].Warn("run warn")
+	l[LogComponentSender].Debugw("sender debug", "id", "1")
+	l[LogComponentReceiver].Info("receiver info")
+	l[LogComponentReport].Warn("report warn")
+	l[LogComponentReport].Error("report error")
+	for i := 0; i < 5; i++ {
+		l[LogComponentState].Warnw("state warn", "id", i)
+	}
+
+	type entry struct {
+		Level   string `json:"level"`
+		Logger  string `json:"logger"`
+		Message string `json:"msg"`
+	}
+	var got []entry
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var e entry
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err, line)
+		}
+		got = append(got, e)
+	}
+
+	want := []entry{
+		{Level: "warn", Message: "run warn"},
+		{Level: "debug", Logger: "sender", Message: "sender debug"},
+		{Level: "error", Logger: "report", Message: "report error"},
+		{Level: "warn", Logger: "state", Message: "state warn"},
+		{Level: "warn", Logger: "state", Message: "state warn"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
@@ -2,73 +2,466 @@ package sacura
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
-	"math"
+	"os"
+	"sync"
 	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
 )
 
+// Main runs the test described by the given config and returns an error when the verification fails.
 func Main(ctx context.Context, config Config) error {
+	_, err := Run(ctx, config)
+	return err
+}
+
+// Run runs the test described by the given config, it starts the sender and the receiver, blocks until the test
+// terminates and returns the final report.
+//
+// The config is validated and defaulted, like FileConfig does. When the verification fails, the returned error
+// describes the failure and the report is still returned.
+func Run(ctx context.Context, config Config) (Report, error) {
+
+	if config.Distributed != nil && config.Distributed.Role == DistributedRoleAgent {
+		// The config of agents is distributed by the controller.
+		return runAgent(ctx, config)
+	}
+	if err := config.validate(); err != nil {
+		return Report{}, err
+	}
+	if config.Suite != nil {
+		return runSuite(ctx, config)
+	}
+	if config.Benchmark != nil {
+		return runBenchmark(ctx, config)
+	}
+	if err := configureLogging(config.Logging); err != nil {
+		return Report{}, err
+	}
+
+	logger(logComponentRun).Infow("Config", "config", config.Redacted())
+
+	if err := resolveSerialization(ctx, &config); err != nil {
+		return Report{}, err
+	}
+
+	if len(config.Streams) > 0 {
+		return runStreams(ctx, config)
+	}
+
+	if isAggregator(config) {
+		logger(logComponentRun).Info("Starting aggregator ...")
+		return runAggregator(ctx, config)
+	}
 
-	c, _ := json.Marshal(&config)
-	log.Println("config", string(c))
+	if config.Knative != nil {
+		logger(logComponentRun).Info("Provisioning Knative resources ...")
+		address, teardown, err := provisionKnative(ctx, config.Knative)
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to provision Knative resources: %w", err)
+		}
+		defer teardown()
+		if config.Sender.Target == "" {
+			config.Sender.Target = address
+		}
+		logger(logComponentRun).Infow("Knative resources ready", "address", address)
+	}
+
+	logger(logComponentRun).Info("Creating state manager ...")
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		return Report{}, err
+	}
 
-	ctx, cancel := context.WithCancel(ctx)
+	exporter := newSpanExporter(config.Tracing)
+	defer exporter.shutdown()
 
-	log.Println("Creating channels")
-	buffer := int(math.Min(float64(int(config.ParsedDuration)*config.Sender.FrequencyPerSecond), math.MaxInt8))
+	parent := ctx
+	aborted := make(chan struct{})
+	ctx, cancel := context.WithCancel(contextWithAborted(contextWithSpanExporter(ctx, exporter), aborted))
+	// The sender is stopped early when too many events are not received within the max delivery age or when the test
+	// is aborted.
+	senderCtx, stopSender := context.WithCancel(contextWithSpanExporter(context.Background(), exporter))
+	defer stopSender()
+
+	var abortOnce sync.Once
+	abort := func() {
+		abortOnce.Do(func() {
+			close(aborted)
+			stopSender()
+			cancel()
+		})
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-parent.Done():
+			logger(logComponentRun).Infow("Test aborted, stopping the sender", "error", parent.Err())
+			abort()
+		case <-done:
+		}
+	}()
+
+	settings := newLiveSettings(&config)
+	ctx = contextWithLiveSettings(ctx, settings)
+	var control *senderControl
+	if config.Admin != nil || config.Sender.ClosedLoop != nil || settings != nil {
+		control = newSenderControl(config.Admin != nil && config.Admin.WaitForStart)
+		control.settings = settings
+		senderCtx = contextWithSenderControl(senderCtx, control)
+	}
+	if config.Admin != nil {
+		stopAdmin, err := startAdminServer(config.Admin, control, sm, settings, abort)
+		if err != nil {
+			cancel()
+			return Report{}, err
+		}
+		defer stopAdmin()
+		logger(logComponentRun).Infow("Admin API listening", "port", config.Admin.Port)
+	}
 
-	sent := make(chan ce.Event, buffer)
-	received := make(chan ce.Event, buffer)
+	if config.Diagnostics != nil {
+		stopDiagnostics, err := startDiagnosticsServer(config.Diagnostics, sm)
+		if err != nil {
+			cancel()
+			return Report{}, err
+		}
+		defer stopDiagnostics()
+		logger(logComponentRun).Infow("Diagnostics listening", "port", config.Diagnostics.Port)
+	}
+
+	logger(logComponentRun).Info("Creating channels")
+	sent := make(chan ce.Event, config.Ingest.bufferSize())
+	received := make(chan ReceivedEvent, config.Ingest.bufferSize())
 	var metrics Metrics
+	var handshakeErr error
+	handshake := newHandshake()
 
 	go func() {
 		defer close(sent)
 
 		if !config.Sender.Disabled {
 			defer cancel()
-			log.Println("Starting attacker ...")
-			time.Sleep(time.Second * 10) // Waiting for receiver to start
-			metrics = StartSender(config, sent)
+			logger(logComponentRun).Info("Starting attacker ...")
+			time.Sleep(config.Sender.startDelay()) // Waiting for receiver to start
+			if config.Sender.Handshake != nil {
+				if handshakeErr = handshake.wait(senderCtx, config); handshakeErr != nil {
+					logger(logComponentRun).Errorw("Handshake failed", "error", handshakeErr)
+					return
+				}
+			}
+			if c := controllerClientFromContext(ctx); c != nil {
+				// Senders reach the stop phase even when failing, so that receive-only agents terminate.
+				defer c.arrive(parent, controllerPhaseStop)
+				if config.Receiver.Disabled {
+					c.arrive(ctx, controllerPhaseStart)
+				}
+				logger(logComponentRun).Info("Waiting for all agents to start ...")
+				if err := c.wait(senderCtx, controllerPhaseStart); err != nil {
+					logger(logComponentRun).Errorw("Failed to wait for agents", "error", err)
+					return
+				}
+			}
+			metrics = startSender(senderCtx, config, sent)
 		}
 	}()
 
-	log.Println("Creating state manager ...")
-	sm := NewStateManager(config)
-	receivedSignal := sm.ReadReceived(received)
-	sentSignal := sm.ReadSent(sent)
+	var smSent <-chan ce.Event = sent
+	var smReceived <-chan ReceivedEvent = received
+	var aggregator *aggregatorClient
+	if config.Distributed != nil && config.Distributed.Role == DistributedRoleInstance {
+		logger(logComponentRun).Infow("Forwarding events to aggregator", "url", config.Distributed.AggregatorURL)
+		aggregator = newAggregatorClient(config.Distributed)
+		smSent = aggregator.forwardSent(sent)
+		smReceived = aggregator.forwardReceived(received)
+	}
+
+	receivedSignal := sm.ReadReceived(smReceived)
+	sentSignal := sm.ReadSent(smSent)
+	stopInterimReports := sm.startInterimReports(config.Report.Interim)
+	stopProgress := sm.startProgress(config.Report.Progress, os.Stderr)
+	stopExpiration := sm.startExpiration(func() {
+		stopSender()
+		cancel()
+	})
+	stopSoak := sm.startSoak()
+	stopClosedLoop := sm.startClosedLoop(config.Sender.ClosedLoop, control)
+	stopFailureDomains := sm.startFailureDomains(config.FailureDomains)
+	stopResourceUsage := sm.startResourceUsage()
+	stopOrderCheckpoint := sm.startOrderCheckpoint()
+	stopHotReload := settings.startHotReload()
 
-	log.Println("Starting receiver ...")
-	if err := StartReceiver(ctx, config.Receiver, received); err != nil {
-		return fmt.Errorf("failed to start receiver: %w", err)
+	if c := controllerClientFromContext(ctx); c != nil && config.Sender.Disabled {
+		// Receive-only agents are terminated once all senders finished.
+		c.arrive(parent, controllerPhaseStop)
+		go func() {
+			if err := c.wait(ctx, controllerPhaseStop); err == nil {
+				logger(logComponentRun).Info("All agents stopped sending, stopping the receiver")
+				cancel()
+			}
+		}()
+	}
+
+	if config.Backfill != nil {
+		go sm.backfill(parent, config.Backfill, ctx.Done(), received)
+	} else if !config.Receiver.Disabled {
+		logger(logComponentRun).Info("Starting receiver ...")
+		if err := StartReceiver(contextWithHandshake(ctx, handshake), config.Receiver, received, sm); err != nil {
+			return Report{}, fmt.Errorf("failed to start receiver: %w", err)
+		}
+	} else {
+		go func() {
+			<-ctx.Done()
+			close(received)
+		}()
 	}
 
 	if !config.Sender.Disabled {
-		log.Println("Waiting for attacker to finish ...")
+		logger(logComponentRun).Info("Waiting for attacker to finish ...")
 	} else {
-		log.Println("Waiting for term signals")
+		logger(logComponentRun).Info("Waiting for term signals")
 	}
 	<-ctx.Done()
 
-	log.Println("Waiting for received channel signal")
+	logger(logComponentRun).Info("Waiting for received channel signal")
 	<-receivedSignal
 
-	log.Println("Waiting for sent channel signal")
+	logger(logComponentRun).Info("Waiting for sent channel signal")
 	<-sentSignal
+	stopInterimReports()
+	stopProgress()
+	stopExpiration()
+	stopSoak()
+	stopClosedLoop()
+	stopFailureDomains()
+	stopResourceUsage()
+	stopOrderCheckpoint()
+	stopHotReload()
+
+	if k := config.Receiver.Kafka; k != nil && k.VerifyPersisted && config.Receiver.Protocol == ProtocolKafka && !config.Receiver.Disabled {
+		sm.recordKafkaReplay(parent, k)
+	}
+
+	if aggregator != nil {
+		logger(logComponentRun).Info("Notifying aggregator")
+		aggregator.done(metrics)
+	}
 
 	sm.Terminated(metrics)
 	report := sm.GenerateReport()
-	logReport(report)
+	if config.Report.Interchange != nil {
+		if err := sm.exportInterchange(config.Report.Interchange); err != nil {
+			logger(LogComponentReport).Errorw("Failed to export events", "path", config.Report.Interchange.Path, "error", err)
+		}
+	}
+	if config.State != nil && config.State.Redis != nil && !config.Receiver.Disabled {
+		// Events of other instances are only in the shared state.
+		shared, err := sharedReport(parent, config, metrics)
+		if err != nil {
+			return report, err
+		}
+		if report.StateWriteErrorCount > shared.StateWriteErrorCount {
+			// Recording the write errors of this instance in the shared state might have failed as well.
+			shared.StateWriteErrorCount, shared.StateWriteError = report.StateWriteErrorCount, report.StateWriteError
+		}
+		report = shared
+	}
+	report.SettingsChanges = settings.settingsChanges()
+	select {
+	case <-aborted:
+		// Receive-only runs are expected to be terminated.
+		report.Aborted = !config.Sender.Disabled
+	default:
+	}
+	logReport(config.Report, report)
+
+	if handshakeErr != nil {
+		// No event was sent, the report isn't verified.
+		return report, fmt.Errorf("handshake failed: %w", handshakeErr)
+	}
+	if aggregator != nil {
+		// Instances only see a subset of events, the aggregator verifies the consolidated report.
+		return report, nil
+	}
+	if config.Receiver.Disabled {
+		// Sent events are verified by Verify together with the events received by a separate run.
+		return report, nil
+	}
+
+	err = verifyAndWriteReports(config, &report)
+	return report, err
+}
+
+// verifyAndWriteReports verifies the given report and writes it to the configured writers, the verification error
+// takes precedence over writers errors.
+func verifyAndWriteReports(config Config, report *Report) error {
+	verificationErr := verifyReport(config, report)
+	if err := writeReports(config.Report, *report, verificationErr); err != nil {
+		if verificationErr != nil {
+			logger(LogComponentReport).Errorw("Failed to write reports", "error", err)
+			return verificationErr
+		}
+		return err
+	}
+	return verificationErr
+}
 
+// verifyReport verifies the given report and records the violated thresholds and the failure reasons.
+//
+// Threshold violations are reported as a *ThresholdsError when the verification otherwise succeeds.
+func verifyReport(config Config, report *Report) error {
+	runReportVerifiers(config, report)
+	report.ThresholdViolations = evaluateThresholds(config, *report)
+	err := verify(config, *report)
+	if err == nil && len(report.ThresholdViolations) > 0 {
+		err = &ThresholdsError{Violations: report.ThresholdViolations}
+	}
+	report.FailureReasons = failureReasons(*report, err)
+	return err
+}
+
+// verify verifies the given report against the given config.
+func verify(config Config, report Report) error {
+	if report.StateWriteErrorCount > 0 {
+		return failure(VerdictReasonStateWriteFailed, fmt.Errorf("%d events couldn't be written to the state, the report is incomplete: %s", report.StateWriteErrorCount, report.StateWriteError))
+	}
 	if !config.Sender.Disabled && report.Metrics.AcceptedCount == 0 {
-		return fmt.Errorf("no events were accepted: %+v", report.Metrics)
+		return failure(VerdictReasonSenderErrors, fmt.Errorf("no events were accepted: %d requests, status codes %v, error classes %v", report.Metrics.Metrics.Requests, report.Metrics.Metrics.StatusCodes, report.Metrics.Metrics.ErrorClasses))
+	}
+
+	if err := verifyBackfill(report); err != nil {
+		return err
+	}
+
+	if report.LeakedCount > 0 {
+		return fmt.Errorf("%d events not matching the filter received", report.LeakedCount)
+	}
+	if report.UndroppedCount > 0 {
+		return fmt.Errorf("%d events expected not to be delivered received", report.UndroppedCount)
+	}
+	if err := verifyTTL(report); err != nil {
+		return err
+	}
+	if err := verifyDelayedDelivery(report); err != nil {
+		return err
+	}
+	if err := verifyVerifiers(report); err != nil {
+		return err
+	}
+	if err := verifyAssertions(report); err != nil {
+		return err
+	}
+	if err := verifyIdentities(report); err != nil {
+		return failure(VerdictReasonSenderErrors, err)
+	}
+	if err := verifyIdempotency(report); err != nil {
+		return failure(VerdictReasonDuplicatesFound, err)
+	}
+
+	// Events received by the dead-letter sink are accounted for, events not matching the filter and events expected
+	// not to be delivered are not expected. Lost events within the loss budget or thresholds.maxLostPercentage are
+	// tolerated regardless of the delivery guarantee.
+	if lost := report.expectedCount() - report.ReceivedCount - report.DeadLetteredCount; !config.Sender.Disabled && lost != 0 && config.Verification.LossBudget == nil && !config.Thresholds.gatesLoss() {
+		if !config.DeliveryGuarantee.allowsLoss() {
+			return failure(VerdictReasonLossExceeded, fmt.Errorf("lost count (accepted and expected but not received nor dead-lettered): %d - %d - %d - %d = %d%s", report.Metrics.AcceptedCount, report.Metrics.AcceptedCount-report.expectedCount(), report.ReceivedCount, report.DeadLetteredCount, lost, lateSummary(report)))
+		}
+
+		lostPercentage := 0
+		if expected := report.expectedCount(); expected > 0 {
+			lostPercentage = 100 * lost / expected
+		}
+
+		logger(LogComponentReport).Infow("Lost percentage", "percentage", lostPercentage)
+
+		if config.Receiver.MaxLostPercentage != nil && lostPercentage > *config.Receiver.MaxLostPercentage {
+			return failure(VerdictReasonLossExceeded, fmt.Errorf("too many lost events detected %d, expected at most %d",
+				lostPercentage,
+				*config.Receiver.MaxLostPercentage,
+			))
+		}
+	}
+
+	if err := verifyFanOut(config, report); err != nil {
+		return err
+	}
+	if err := verifyEndpoints(config, report); err != nil {
+		return err
+	}
+	if err := verifyReplies(report); err != nil {
+		return err
+	}
+	if err := verifyTopology(report); err != nil {
+		return err
+	}
+	if err := verifyApproximate(report); err != nil {
+		return err
+	}
+	if err := verifyCompression(config, report); err != nil {
+		return err
+	}
+	if err := verifySerialization(report); err != nil {
+		return err
+	}
+	if err := verifyContentTypes(report); err != nil {
+		return err
+	}
+
+	if err := verifyContentModes(config, report); err != nil {
+		return err
+	}
+
+	if err := verifyAttributes(config, report); err != nil {
+		return err
+	}
+
+	if err := verifyDeliveryAttempts(config, report); err != nil {
+		return err
+	}
+
+	if config.Verification.SpecConformance && report.SpecViolationCount > 0 {
+		return fmt.Errorf("%d events violating the CloudEvents specification received", report.SpecViolationCount)
+	}
+
+	if m := config.Verification.MaxExpiredEvents; m != nil && report.ExpiredCount > *m {
+		return failure(VerdictReasonTimeout, fmt.Errorf("too many events not received within %v detected %d, expected at most %d",
+			config.Verification.ParsedMaxDeliveryAge,
+			report.ExpiredCount,
+			*m,
+		))
+	}
+
+	if m := config.Verification.MaxOrderingViolations; m != nil && report.OrderingViolationCount > *m {
+		return failure(VerdictReasonOrderingViolation, fmt.Errorf("too many ordering violations detected %d, expected at most %d",
+			report.OrderingViolationCount,
+			*m,
+		))
 	}
 
-	if lost := report.Metrics.AcceptedCount - report.ReceivedCount; !config.Sender.Disabled && lost != 0 {
-		return fmt.Errorf("lost count (accepted but not received): %d - %d = %d", report.Metrics.AcceptedCount, sm.ReceivedCount(), lost)
+	if report.CorruptedCount > 0 {
+		return fmt.Errorf("%d corrupted events (data not matching the checksum) detected", report.CorruptedCount)
+	}
+
+	if config.Distributed != nil && config.Distributed.ExclusivePartitions && len(report.SharedPartitionKeys) > 0 {
+		return fmt.Errorf("%d partition keys received by more than one replica", len(report.SharedPartitionKeys))
+	}
+
+	if config.Verification.UnexpectedEvents == UnexpectedEventsFail && report.UnexpectedCount > 0 {
+		return fmt.Errorf("%d unexpected events (received but never sent) detected", report.UnexpectedCount)
+	}
+
+	if err := verifyBudgets(report); err != nil {
+		return failure(budgetReason(report.BudgetViolations[0].Budget), err)
+	}
+
+	// Duplicates within the duplicate budget or thresholds.maxDuplicatePercentage are tolerated regardless of the
+	// delivery guarantee.
+	if !config.DeliveryGuarantee.allowsDuplicates() && report.DuplicateCount > 0 && config.Verification.DuplicateBudget == nil && !config.Thresholds.gatesDuplicates() {
+		return failure(VerdictReasonDuplicatesFound, fmt.Errorf("%d duplicates detected with %s delivery guarantee",
+			report.DuplicateCount,
+			config.DeliveryGuarantee,
+		))
 	}
 
 	if report.ReceivedCount > 0 {
@@ -77,26 +470,32 @@ func Main(ctx context.Context, config Config) error {
 		// x = 100 * duplicateCount / (duplicateCount + receivedCount)
 		duplicatesPercentage := 100 * report.DuplicateCount / (report.DuplicateCount + report.ReceivedCount)
 
-		log.Printf("Duplicates percentage %d", duplicatesPercentage)
+		logger(LogComponentReport).Infow("Duplicates percentage", "percentage", duplicatesPercentage)
 
 		if config.Receiver.MaxDuplicatesPercentage != nil && duplicatesPercentage > *config.Receiver.MaxDuplicatesPercentage {
-			return fmt.Errorf("too many duplicates detected %d, expected at most %d, listing duplicates:\n%+v",
+			return failure(VerdictReasonDuplicatesFound, fmt.Errorf("too many duplicates detected %d, expected at most %d",
 				duplicatesPercentage,
 				*config.Receiver.MaxDuplicatesPercentage,
-				report.DuplicateEventsByPartitionKey,
-			)
+			))
 		}
 	}
 
 	return nil
 }
 
-func logReport(report Report) {
-	jsonReport, err := json.MarshalIndent(report, "", "  ")
-	if err != nil {
-		log.Println("failed to marshal report", err)
-		return
-	}
+func logReport(config ReportConfig, report Report) {
+	logger(LogComponentReport).Infow("Report", "report", config.Limits.limited(report))
+}
+
+type abortedKey struct{}
+
+// contextWithAborted returns a context carrying the channel closed when the test is aborted.
+func contextWithAborted(ctx context.Context, aborted <-chan struct{}) context.Context {
+	return context.WithValue(ctx, abortedKey{}, aborted)
+}
 
-	log.Println("report", string(jsonReport))
+// abortedFromContext returns the channel closed when the test is aborted, or nil.
+func abortedFromContext(ctx context.Context) <-chan struct{} {
+	aborted, _ := ctx.Value(abortedKey{}).(<-chan struct{})
+	return aborted
 }
@@ -3,6 +3,7 @@ package sacura
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
 	"time"
 )
@@ -80,3 +81,132 @@ func Test_Main(t *testing.T) {
 		})
 	}
 }
+
+func TestVerify(t *testing.T) {
+
+	one := 1
+
+	tests := []struct {
+		name    string
+		config  Config
+		report  Report
+		wantErr bool
+	}{
+		{
+			name:   "all received",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+			report: Report{ReceivedCount: 10, Metrics: Metrics{AcceptedCount: 10}},
+		},
+		{
+			name:    "lost",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			report:  Report{ReceivedCount: 9, Metrics: Metrics{AcceptedCount: 10}},
+			wantErr: true,
+		},
+		{
+			name:   "lost events accounted for by the dead-letter sink",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+			report: Report{ReceivedCount: 9, DeadLetteredCount: 1, Metrics: Metrics{AcceptedCount: 10}},
+		},
+		{
+			name:   "unexpected events ignored",
+			config: Config{DeliveryGuarantee: AtLeastOnce, Verification: VerificationConfig{UnexpectedEvents: UnexpectedEventsIgnore}},
+			report: Report{ReceivedCount: 10, UnexpectedCount: 1, Metrics: Metrics{AcceptedCount: 10}},
+		},
+		{
+			name:    "unexpected events fail",
+			config:  Config{DeliveryGuarantee: AtLeastOnce, Verification: VerificationConfig{UnexpectedEvents: UnexpectedEventsFail}},
+			report:  Report{ReceivedCount: 10, UnexpectedCount: 1, UnexpectedEventsByPartitionKey: map[string][]string{"p": {"listed-id"}}, Metrics: Metrics{AcceptedCount: 10}},
+			wantErr: true,
+		},
+		{
+			name:    "corrupted events",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			report:  Report{ReceivedCount: 10, CorruptedCount: 1, CorruptedEventsByPartitionKey: map[string][]string{"p": {"listed-id"}}, Metrics: Metrics{AcceptedCount: 10}},
+			wantErr: true,
+		},
+		{
+			name:   "expired events within threshold",
+			config: Config{DeliveryGuarantee: AtLeastOnce, Verification: VerificationConfig{MaxExpiredEvents: &one}},
+			report: Report{ReceivedCount: 10, ExpiredCount: 1, Metrics: Metrics{AcceptedCount: 10}},
+		},
+		{
+			name:    "too many expired events",
+			config:  Config{DeliveryGuarantee: AtLeastOnce, Verification: VerificationConfig{MaxExpiredEvents: &one}},
+			report:  Report{ReceivedCount: 10, ExpiredCount: 2, Metrics: Metrics{AcceptedCount: 10}},
+			wantErr: true,
+		},
+		{
+			name:   "expected loss missing",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+			report: Report{ReceivedCount: 9, ExpectedLossCount: 1, Metrics: Metrics{AcceptedCount: 10}},
+		},
+		{
+			name:    "expected loss received",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			report:  Report{ReceivedCount: 9, ExpectedLossCount: 1, UndroppedCount: 1, UndroppedEventsByPartitionKey: map[string][]string{"p": {"listed-id"}}, Metrics: Metrics{AcceptedCount: 10}},
+			wantErr: true,
+		},
+		{
+			name:    "nothing accepted",
+			config:  Config{DeliveryGuarantee: AtLeastOnce},
+			report:  Report{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verify(tt.config, tt.report)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			// Errors are printed without the report limits, they only include counts.
+			if err != nil && strings.Contains(err.Error(), "listed-id") {
+				t.Errorf("unexpected event IDs in error %v", err)
+			}
+		})
+	}
+}
+
+func TestRunInvalidConfig(t *testing.T) {
+	if _, err := Run(context.Background(), Config{Duration: "1m"}); err == nil {
+		t.Error("expected error for invalid config")
+	}
+}
+
+func TestRunAborted(t *testing.T) {
+
+	config := Config{
+		Sender: SenderConfig{
+			Target:             "http://localhost:9217",
+			FrequencyPerSecond: 100,
+			StartDelay:         "1s",
+		},
+		Receiver: ReceiverConfig{
+			Port:        9217,
+			Timeout:     "1m",
+			GracePeriod: "1s",
+		},
+		Duration: "1m",
+	}
+
+	// The sender starts after 1 second.
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	report, err := Run(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("expected the test to terminate after the grace period, got %v", elapsed)
+	}
+	if !report.Aborted {
+		t.Error("expected report to be marked as aborted")
+	}
+	if report.Metrics.AcceptedCount == 0 || report.ReceivedCount != report.Metrics.AcceptedCount {
+		t.Errorf("expected accepted events to be received, got accepted %d, received %d", report.Metrics.AcceptedCount, report.ReceivedCount)
+	}
+}
@@ -0,0 +1,97 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// registerMetrics registers instruments observing the live state of the StateManager.
+func (s *StateManager) registerMetrics(meter metric.Meter) error {
+	sent, err := meter.AsyncInt64().Counter("events_sent_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events sent and accepted"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create sent events counter: %w", err)
+	}
+	received, err := meter.AsyncInt64().Counter("events_received_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events received, including duplicates"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create received events counter: %w", err)
+	}
+	duplicates, err := meter.AsyncInt64().Counter("events_duplicate_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of duplicate events received"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create duplicate events counter: %w", err)
+	}
+	nacked, err := meter.AsyncInt64().Counter("events_nacked_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of injected failure responses sent by the receiver"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create nacked events counter: %w", err)
+	}
+	deadLettered, err := meter.AsyncInt64().Counter("events_dead_lettered_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events received by the dead-letter sink, including duplicates"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create dead-lettered events counter: %w", err)
+	}
+	expired, err := meter.AsyncInt64().Counter("events_expired_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events not received within the max delivery age"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create expired events counter: %w", err)
+	}
+	orderingViolations, err := meter.AsyncInt64().Counter("ordering_violations_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events received out of order in ordered mode"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create ordering violations counter: %w", err)
+	}
+	lost, err := meter.AsyncInt64().Gauge("events_lost",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of events sent and not received yet"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create lost events gauge: %w", err)
+	}
+
+	return meter.RegisterCallback(
+		[]instrument.Asynchronous{sent, received, duplicates, nacked, deadLettered, expired, orderingViolations, lost},
+		func(ctx context.Context) {
+			sent.Observe(ctx, s.sentCount.Load())
+			received.Observe(ctx, s.receivedCount.Load())
+			duplicates.Observe(ctx, s.duplicateCount.Load())
+			nacked.Observe(ctx, s.nackedCount.Load())
+			deadLettered.Observe(ctx, s.deadLetteredCount.Load())
+			expired.Observe(ctx, s.expiredCount.Load())
+			orderingViolations.Observe(ctx, s.orderingViolationCount.Load())
+			lost.Observe(ctx, s.sentCount.Load()-s.matchedCount.Load())
+		},
+	)
+}
+
+func registerInFlightRequestsGauge(meter metric.Meter, inFlightRequests func() int64) error {
+	gauge, err := meter.AsyncInt64().Gauge("in_flight_requests_current",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of requests currently being processed by the receiver"),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create in-flight requests gauge: %w", err)
+	}
+	return meter.RegisterCallback([]instrument.Asynchronous{gauge}, func(ctx context.Context) {
+		gauge.Observe(ctx, inFlightRequests())
+	})
+}
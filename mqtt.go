@@ -0,0 +1,464 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/google/uuid"
+)
+
+// MQTTConfig configures the CloudEvents MQTT protocol binding, events are published in the binary content mode with
+// MQTT v5: attributes are user properties, datacontenttype is the content type and data is the payload.
+type MQTTConfig struct {
+	// Topic is the topic events are published to, or the topic filter the receiver subscribes to.
+	Topic string `json:"topic" yaml:"topic"`
+	// QoS is the quality of service events are published and subscribed with, either 0 or 1.
+	//
+	// Defaults to 1.
+	QoS *int `json:"qos" yaml:"qos"`
+	// ClientID is the client identifier, when not specified a random client identifier is used.
+	ClientID string `json:"clientID" yaml:"clientID"`
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+	// PartitionKey is how the partition key of events sent in ordered mode is mapped to MQTT, either
+	// MQTTPartitionKeyUserProperty or MQTTPartitionKeyTopic.
+	//
+	// Defaults to MQTTPartitionKeyUserProperty.
+	PartitionKey MQTTPartitionKeyMapping `json:"partitionKey" yaml:"partitionKey"`
+	// PartitionKeyUserProperty is the user property the sender sets to the partition key with
+	// MQTTPartitionKeyUserProperty.
+	//
+	// Defaults to the partition key extension, which is a user property like any other attribute.
+	PartitionKeyUserProperty string `json:"partitionKeyUserProperty" yaml:"partitionKeyUserProperty"`
+}
+
+type ReceiverMQTTConfig struct {
+	MQTTConfig `yaml:",inline"`
+
+	// Broker is the URL of the broker the receiver subscribes to, either mqtt://host[:port] or mqtts://host[:port].
+	Broker string `json:"broker" yaml:"broker"`
+}
+
+type MQTTPartitionKeyMapping string
+
+const (
+	// MQTTPartitionKeyUserProperty carries the partition key in a user property.
+	MQTTPartitionKeyUserProperty MQTTPartitionKeyMapping = "userProperty"
+	// MQTTPartitionKeyTopic publishes events to the <topic>/<partition key> topic, and the receiver subscribes to
+	// <topic>/+.
+	MQTTPartitionKeyTopic MQTTPartitionKeyMapping = "topic"
+)
+
+const (
+	// mqttMaxPacketSize is the maximum size of received packets, it is advertised to the broker.
+	mqttMaxPacketSize = 16 << 20
+
+	mqttKeepAlive      = 30 * time.Second
+	mqttConnectTimeout = 30 * time.Second
+)
+
+func (c *MQTTConfig) qos() byte {
+	if c.QoS == nil {
+		return 1
+	}
+	return byte(*c.QoS)
+}
+
+// topicFilter returns the topic filter the receiver subscribes to.
+func (c *MQTTConfig) topicFilter() string {
+	if c.PartitionKey == MQTTPartitionKeyTopic {
+		return c.Topic + "/+"
+	}
+	return c.Topic
+}
+
+func (c *MQTTConfig) validate(field string) error {
+	if c.Topic == "" {
+		return invalidErr(field+".topic", errors.New("cannot be empty"))
+	}
+	if c.QoS != nil && *c.QoS != 0 && *c.QoS != 1 {
+		return invalidErr(field+".qos", fmt.Errorf("%d is not supported, expected 0 or 1", *c.QoS))
+	}
+	switch c.PartitionKey {
+	case "", MQTTPartitionKeyUserProperty, MQTTPartitionKeyTopic:
+	default:
+		return invalidErr(field+".partitionKey", fmt.Errorf("unknown mapping %q, expected one of %v", c.PartitionKey, []MQTTPartitionKeyMapping{MQTTPartitionKeyUserProperty, MQTTPartitionKeyTopic}))
+	}
+	if c.PartitionKeyUserProperty != "" && c.PartitionKey == MQTTPartitionKeyTopic {
+		return invalidErr(field+".partitionKeyUserProperty", fmt.Errorf("cannot be used with the %s mapping", MQTTPartitionKeyTopic))
+	}
+	return nil
+}
+
+func validateMQTTBroker(field, broker string) error {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return invalidErr(field, err)
+	}
+	if (u.Scheme != "mqtt" && u.Scheme != "mqtts") || u.Hostname() == "" {
+		return invalidErr(field, fmt.Errorf("%q must be an mqtt:// or mqtts:// URL", broker))
+	}
+	return nil
+}
+
+func (c *SenderConfig) validateMQTT() error {
+	if c.MQTT == nil {
+		return invalidErr("sender.mqtt", fmt.Errorf("must be specified with the %s protocol", ProtocolMQTT))
+	}
+	if err := validateMQTTBroker("sender.target", c.Target); err != nil {
+		return err
+	}
+	if err := c.MQTT.validate("sender.mqtt"); err != nil {
+		return err
+	}
+	if strings.ContainsAny(c.MQTT.Topic, "+#") {
+		return invalidErr("sender.mqtt.topic", fmt.Errorf("%q cannot contain wildcards", c.MQTT.Topic))
+	}
+	if c.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolMQTT))
+	}
+	if c.Auth != nil {
+		return invalidErr("sender.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol, use sender.mqtt.username and sender.mqtt.password", ProtocolMQTT))
+	}
+	return nil
+}
+
+func (c *ReceiverConfig) validateMQTT() error {
+	if c.MQTT == nil {
+		return invalidErr("receiver.mqtt", fmt.Errorf("must be specified with the %s protocol", ProtocolMQTT))
+	}
+	if err := validateMQTTBroker("receiver.mqtt.broker", c.MQTT.Broker); err != nil {
+		return err
+	}
+	if err := c.MQTT.validate("receiver.mqtt"); err != nil {
+		return err
+	}
+	if c.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolMQTT))
+	}
+	if c.TLS != nil {
+		return invalidErr("receiver.tls", fmt.Errorf("the receiver doesn't terminate TLS with the %s protocol, use an mqtts:// broker", ProtocolMQTT))
+	}
+	if c.Auth != nil {
+		return invalidErr("receiver.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol", ProtocolMQTT))
+	}
+	return nil
+}
+
+// newMQTTPublish returns the message publishing the given event in the binary content mode, hdr carries the trace
+// headers of the request and partitionKeyAttribute is the partition key attribute in ordered mode.
+func newMQTTPublish(e *ce.Event, hdr http.Header, config *MQTTConfig, partitionKeyAttribute string) (*paho.Publish, error) {
+	attributes, err := binaryAttributes(e)
+	if err != nil {
+		return nil, err
+	}
+	p := &paho.Publish{
+		QoS:        config.qos(),
+		Topic:      config.Topic,
+		Properties: &paho.PublishProperties{ContentType: e.DataContentType()},
+		Payload:    e.Data(),
+	}
+	for _, a := range attributes {
+		p.Properties.User.Add(a[0], a[1])
+	}
+
+	if pk, ok := eventPartitionKey(e, partitionKeyAttribute); ok {
+		if config.PartitionKey == MQTTPartitionKeyTopic {
+			p.Topic += "/" + fmt.Sprint(pk)
+		} else if up := config.PartitionKeyUserProperty; up != "" && up != partitionKeyAttribute {
+			p.Properties.User.Add(up, fmt.Sprint(pk))
+		}
+	}
+	for _, h := range traceHeaders {
+		if v := hdr.Get(h); v != "" {
+			p.Properties.User.Add(h, v)
+		}
+	}
+	return p, nil
+}
+
+// mqttEvent returns the event of a message in the binary content mode.
+func mqttEvent(p *paho.Publish) (*ce.Event, error) {
+	e := ce.NewEvent()
+	var contentType string
+	if p.Properties != nil {
+		contentType = p.Properties.ContentType
+		for _, u := range p.Properties.User {
+			if err := setBinaryAttribute(&e, u.Key, u.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	setBinaryData(&e, contentType, p.Payload)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// mqttHeader returns the trace headers carried by a message.
+func mqttHeader(p *paho.Publish) http.Header {
+	hdr := http.Header{}
+	if p.Properties == nil {
+		return hdr
+	}
+	for _, h := range traceHeaders {
+		if v := p.Properties.User.Get(h); v != "" {
+			hdr.Set(h, v)
+		}
+	}
+	return hdr
+}
+
+// mqttBinding is the protocolBinding of ProtocolMQTT.
+type mqttBinding struct{}
+
+func (mqttBinding) validateSender(c *SenderConfig) error {
+	return c.validateMQTT()
+}
+
+func (mqttBinding) validateReceiver(c *ReceiverConfig) error {
+	return c.validateMQTT()
+}
+
+func (mqttBinding) newTransport(config *Config) senderTransport {
+	return newMQTTTransport(config)
+}
+
+func (mqttBinding) startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	return startMQTTReceiver(ctx, config, h)
+}
+
+func (mqttBinding) resumes() bool {
+	return false
+}
+
+// mqttTransport is an http.RoundTripper publishing the events of the requests built by the targeter to the broker, so
+// that events sent with MQTT are paced, measured and accounted for like with HTTP.
+type mqttTransport struct {
+	broker                string
+	tlsConfig             *tls.Config
+	config                *MQTTConfig
+	partitionKeyAttribute string
+
+	lock   sync.Mutex
+	client *mqttClient
+}
+
+func newMQTTTransport(config *Config) *mqttTransport {
+	t := &mqttTransport{broker: config.Sender.Target, config: config.Sender.MQTT}
+	if config.Sender.TLS != nil {
+		t.tlsConfig = config.Sender.TLS.Parsed
+	}
+	if config.Ordered != nil {
+		t.partitionKeyAttribute = config.Ordered.partitionKeyAttribute()
+	}
+	return t
+}
+
+func (t *mqttTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	p, err := newMQTTPublish(&e, req.Header, t.config, t.partitionKeyAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := t.connect(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	// Publishes rejected with an error reason code fail too.
+	if _, err := c.Publish(req.Context(), p); err != nil {
+		return nil, err
+	}
+	return acceptedResponse(req), nil
+}
+
+// connect returns the connected client, the broker is dialed again when the connection has been lost.
+func (t *mqttTransport) connect(ctx context.Context) (*mqttClient, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.client != nil && t.client.failure() == nil {
+		return t.client, nil
+	}
+	c, err := dialMQTT(ctx, t.broker, t.tlsConfig, t.config, nil)
+	if err != nil {
+		return nil, err
+	}
+	t.client = c
+	return c, nil
+}
+
+func (t *mqttTransport) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.client != nil {
+		t.client.close()
+	}
+}
+
+// startMQTTReceiver subscribes to the broker and handles received events until the given context is done. Messages
+// are acknowledged once handled, including invalid events and events failing the handler since the client doesn't
+// set the reason code of acknowledgements.
+func startMQTTReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	broker, _ := url.Parse(config.MQTT.Broker)
+
+	c, err := dialMQTT(ctx, config.MQTT.Broker, nil, &config.MQTT.MQTTConfig, paho.NewSingleHandlerRouter(func(p *paho.Publish) {
+		start := time.Now()
+		req := &http.Request{
+			Method:     http.MethodPost,
+			URL:        &url.URL{Path: "/" + p.Topic},
+			Header:     mqttHeader(p),
+			RemoteAddr: broker.Host,
+		}
+		defer func() {
+			processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(req, config, processingLatencyHistogramLabels)...)
+		}()
+
+		e, err := mqttEvent(p)
+		if err != nil {
+			logger(LogComponentReceiver).Warnw("Invalid event", "topic", p.Topic, "error", err)
+			return
+		}
+		_ = h(ctx, e, req)
+	}))
+	if err != nil {
+		return err
+	}
+	defer c.close()
+
+	filter := config.MQTT.topicFilter()
+	// Subscriptions refused with an error reason code fail too.
+	_, err = c.Subscribe(ctx, &paho.Subscribe{
+		Subscriptions: map[string]paho.SubscribeOptions{filter: {QoS: config.MQTT.qos()}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", filter, err)
+	}
+	markReceiverReady(ctx)
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-c.done:
+		return c.failure()
+	}
+}
+
+// mqttClient is a paho client connected to a broker, done is closed when the connection is lost.
+type mqttClient struct {
+	*paho.Client
+
+	lock sync.Mutex
+	done chan struct{}
+	err  error
+}
+
+// dialMQTT connects to the given broker, received messages are routed by the given router.
+func dialMQTT(ctx context.Context, broker string, tlsConfig *tls.Config, config *MQTTConfig, router paho.Router) (*mqttClient, error) {
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, err
+	}
+	d := &net.Dialer{Timeout: mqttConnectTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "mqtt":
+		conn, err = d.DialContext(ctx, "tcp", hostPort(u, "1883"))
+	case "mqtts":
+		conn, err = (&tls.Dialer{NetDialer: d, Config: tlsConfig}).DialContext(ctx, "tcp", hostPort(u, "8883"))
+	default:
+		return nil, fmt.Errorf("unsupported broker URL %q", broker)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to broker %s: %w", u.Host, err)
+	}
+
+	c := &mqttClient{done: make(chan struct{})}
+	c.Client = paho.NewClient(paho.ClientConfig{
+		Conn:          conn,
+		Router:        router,
+		PacketTimeout: mqttConnectTimeout,
+		OnClientError: c.fail,
+		OnServerDisconnect: func(d *paho.Disconnect) {
+			c.fail(fmt.Errorf("disconnected by the broker with reason code 0x%02x", d.ReasonCode))
+		},
+	})
+
+	clientID := config.ClientID
+	if clientID == "" {
+		clientID = "sacura-" + uuid.New().String()
+	}
+	maxPacketSize := uint32(mqttMaxPacketSize)
+	cp := &paho.Connect{
+		ClientID:     clientID,
+		KeepAlive:    uint16(mqttKeepAlive / time.Second),
+		CleanStart:   true,
+		Username:     config.Username,
+		UsernameFlag: config.Username != "",
+		Password:     []byte(config.Password),
+		PasswordFlag: config.Password != "",
+		Properties:   &paho.ConnectProperties{MaximumPacketSize: &maxPacketSize},
+	}
+	// Connect closes the connection when it fails.
+	if _, err := c.Connect(ctx, cp); err != nil {
+		return nil, fmt.Errorf("failed to connect to broker %s: %w", u.Host, err)
+	}
+	return c, nil
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), defaultPort)
+	}
+	return u.Host
+}
+
+// fail records the first error that closed the connection.
+func (c *mqttClient) fail(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+// failure returns the error that closed the connection, or nil when it is open.
+func (c *mqttClient) failure() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.err
+}
+
+// close disconnects from the broker and waits for the message being handled.
+func (c *mqttClient) close() {
+	if c.failure() == nil {
+		_ = c.Disconnect(&paho.Disconnect{ReasonCode: 0})
+	}
+	c.fail(errors.New("connection closed"))
+}
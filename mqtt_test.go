@@ -0,0 +1,345 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/eclipse/paho.golang/packets"
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestMQTTPublishRoundTrip(t *testing.T) {
+
+	binaryEvent := cetest.FullEvent()
+	if err := binaryEvent.SetData("application/octet-stream", []byte{0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	orderedEvent := cetest.FullEvent()
+	orderedEvent.SetExtension(DefaultPartitionKeyExtension, "3")
+
+	tests := []struct {
+		name      string
+		event     ce.Event
+		config    MQTTConfig
+		wantTopic string
+		wantProp  [2]string
+	}{
+		{
+			name:      "full event",
+			event:     cetest.FullEvent(),
+			config:    MQTTConfig{Topic: "events"},
+			wantTopic: "events",
+		},
+		{
+			name:      "min event",
+			event:     cetest.MinEvent(),
+			config:    MQTTConfig{Topic: "events"},
+			wantTopic: "events",
+		},
+		{
+			name:      "binary data",
+			event:     binaryEvent,
+			config:    MQTTConfig{Topic: "events"},
+			wantTopic: "events",
+		},
+		{
+			name:      "partition key topic",
+			event:     orderedEvent,
+			config:    MQTTConfig{Topic: "events", PartitionKey: MQTTPartitionKeyTopic},
+			wantTopic: "events/3",
+		},
+		{
+			name:      "partition key user property",
+			event:     orderedEvent,
+			config:    MQTTConfig{Topic: "events", PartitionKeyUserProperty: "key"},
+			wantTopic: "events",
+			wantProp:  [2]string{"key", "3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := http.Header{}
+			hdr.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+			p, err := newMQTTPublish(&tt.event, hdr, &tt.config, DefaultPartitionKeyExtension)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Topic != tt.wantTopic {
+				t.Errorf("expected topic %s, got %s", tt.wantTopic, p.Topic)
+			}
+			if tt.wantProp[0] != "" {
+				if got := p.Properties.User.Get(tt.wantProp[0]); got != tt.wantProp[1] {
+					t.Errorf("expected user property %v, got %v", tt.wantProp, p.Properties.User)
+				}
+			}
+			if got := mqttHeader(p).Get("traceparent"); got != hdr.Get("traceparent") {
+				t.Errorf("expected traceparent %s, got %s", hdr.Get("traceparent"), got)
+			}
+
+			got, err := mqttEvent(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Extensions are compared regardless of their order and, like with the HTTP binary content mode, their
+			// type.
+			attributes := func(e *ce.Event) map[string]string {
+				b, err := e.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := map[string]interface{}{}
+				if err := json.Unmarshal(b, &m); err != nil {
+					t.Fatal(err)
+				}
+				s := make(map[string]string, len(m))
+				for k, v := range m {
+					s[k] = fmt.Sprint(v)
+				}
+				return s
+			}
+			want := attributes(&tt.event)
+			if tt.wantProp[0] != "" {
+				want[tt.wantProp[0]] = tt.wantProp[1]
+			}
+			if diff := cmp.Diff(want, attributes(got)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestMQTTConfigValidate(t *testing.T) {
+
+	two := 2
+
+	tests := []struct {
+		name     string
+		sender   SenderConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883", MQTT: &MQTTConfig{Topic: "events"}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{MQTTConfig: MQTTConfig{Topic: "$share/sacura/events"}, Broker: "mqtts://localhost"}},
+		},
+		{
+			name:     "missing mqtt config",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883"},
+			receiver: ReceiverConfig{},
+			wantErr:  true,
+		},
+		{
+			name:     "http target",
+			sender:   SenderConfig{Target: "http://localhost:1883", MQTT: &MQTTConfig{Topic: "events"}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{MQTTConfig: MQTTConfig{Topic: "events"}, Broker: "http://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "empty topic",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883", MQTT: &MQTTConfig{}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{Broker: "mqtt://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported QoS",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883", MQTT: &MQTTConfig{Topic: "events", QoS: &two}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{MQTTConfig: MQTTConfig{Topic: "events", QoS: &two}, Broker: "mqtt://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "user property with topic mapping",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883", MQTT: &MQTTConfig{Topic: "events", PartitionKey: MQTTPartitionKeyTopic, PartitionKeyUserProperty: "key"}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{MQTTConfig: MQTTConfig{Topic: "events", PartitionKey: "partition"}, Broker: "mqtt://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender wildcard topic and receiver auth",
+			sender:   SenderConfig{Target: "mqtt://localhost:1883", MQTT: &MQTTConfig{Topic: "events/#"}},
+			receiver: ReceiverConfig{MQTT: &ReceiverMQTTConfig{MQTTConfig: MQTTConfig{Topic: "events/#"}, Broker: "mqtt://localhost"}, Auth: &ReceiverAuthConfig{Token: "token"}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.validateMQTT(); (err != nil) != tt.wantErr {
+				t.Errorf("sender wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err := tt.receiver.validateMQTT(); (err != nil) != tt.wantErr {
+				t.Errorf("receiver wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// testMQTTBroker is a minimal broker forwarding messages to the clients subscribed to a matching topic filter.
+type testMQTTBroker struct {
+	listener net.Listener
+
+	lock          sync.Mutex
+	subscriptions map[string][]*testMQTTConn
+	pubackCodes   []byte
+}
+
+type testMQTTConn struct {
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func (c *testMQTTConn) write(p io.WriterTo) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, _ = p.WriteTo(c.conn)
+}
+
+func startTestMQTTBroker(t *testing.T) *testMQTTBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &testMQTTBroker{listener: l, subscriptions: map[string][]*testMQTTConn{}}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(&testMQTTConn{conn: conn})
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return b
+}
+
+func (b *testMQTTBroker) url() string {
+	return "mqtt://" + b.listener.Addr().String()
+}
+
+func (b *testMQTTBroker) serve(c *testMQTTConn) {
+	defer c.conn.Close()
+
+	for {
+		cp, err := packets.ReadPacket(c.conn)
+		if err != nil {
+			return
+		}
+		switch p := cp.Content.(type) {
+		case *packets.Connect:
+			c.write(&packets.Connack{Properties: &packets.Properties{}})
+		case *packets.Subscribe:
+			var reasons []byte
+			b.lock.Lock()
+			for filter, options := range p.Subscriptions {
+				b.subscriptions[filter] = append(b.subscriptions[filter], c)
+				reasons = append(reasons, options.QoS)
+			}
+			b.lock.Unlock()
+			c.write(&packets.Suback{PacketID: p.PacketID, Reasons: reasons, Properties: &packets.Properties{}})
+		case *packets.Publish:
+			b.lock.Lock()
+			for filter, conns := range b.subscriptions {
+				prefix := strings.TrimSuffix(filter, "+")
+				if filter == p.Topic || (prefix != filter && strings.HasPrefix(p.Topic, prefix) && !strings.Contains(p.Topic[len(prefix):], "/")) {
+					for _, s := range conns {
+						s.write(p)
+					}
+				}
+			}
+			b.lock.Unlock()
+			c.write(&packets.Puback{PacketID: p.PacketID, ReasonCode: packets.PubackSuccess, Properties: &packets.Properties{}})
+		case *packets.Puback:
+			b.lock.Lock()
+			b.pubackCodes = append(b.pubackCodes, p.ReasonCode)
+			b.lock.Unlock()
+		case *packets.Pingreq:
+			c.write(&packets.Pingresp{})
+		case *packets.Disconnect:
+			return
+		}
+	}
+}
+
+func TestStartReceiverMQTT(t *testing.T) {
+
+	broker := startTestMQTTBroker(t)
+	mqtt := MQTTConfig{Topic: "events", PartitionKey: MQTTPartitionKeyTopic}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Protocol: ProtocolMQTT,
+			MQTT:     &ReceiverMQTTConfig{MQTTConfig: mqtt, Broker: broker.url()},
+		}, received, nil)
+	}()
+
+	// Wait for the receiver subscription, messages published before it are not delivered.
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		broker.lock.Lock()
+		defer broker.lock.Unlock()
+		return len(broker.subscriptions) > 0, nil
+	})
+	if err != nil {
+		t.Fatal("receiver didn't subscribe", err)
+	}
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             broker.url(),
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolMQTT,
+			MQTT:               &mqtt,
+		},
+		Ordered:        &OrderedConfig{NumPartitionKeys: 2},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	var codes []byte
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		broker.lock.Lock()
+		defer broker.lock.Unlock()
+		codes = broker.pubackCodes
+		return len(codes) == 10, nil
+	})
+	if err != nil {
+		t.Errorf("expected 10 acknowledgements, got %v", codes)
+	}
+	for _, code := range codes {
+		if code != packets.PubackSuccess {
+			t.Errorf("expected success reason code, got %v", codes)
+		}
+	}
+}
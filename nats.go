@@ -0,0 +1,413 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"github.com/nats-io/nats.go"
+)
+
+// NATSConfig configures the CloudEvents NATS protocol binding with JetStream, events are published in the binary
+// content mode: attributes are headers prefixed with ce-, datacontenttype is the content-type header and data is the
+// payload.
+type NATSConfig struct {
+	// Subject is the subject events are published to, events sent in ordered mode are published to
+	// <subject>.<partition key>.
+	//
+	// The receiver consumes the events of the stream matching the subject, which can contain wildcards, when not
+	// specified it consumes all the events of the stream.
+	Subject string `json:"subject" yaml:"subject"`
+	// Username and Password, or Token, authenticate with the server.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+	Token    string `json:"token" yaml:"token" secret:"true"`
+}
+
+type ReceiverNATSConfig struct {
+	NATSConfig `yaml:",inline"`
+
+	// Server is the URL of the server the receiver consumes from, either nats://host[:port] or tls://host[:port].
+	Server string `json:"server" yaml:"server"`
+	// Stream is the JetStream stream the receiver consumes from.
+	Stream string `json:"stream" yaml:"stream"`
+	// Durable is the name of the durable consumer the receiver creates or resumes, when not specified the receiver
+	// creates an ephemeral consumer receiving the events published after it started.
+	Durable string `json:"durable" yaml:"durable"`
+	// MaxAckPending is the number of events the server delivers to the receiver before they are acknowledged.
+	//
+	// Defaults to DefaultNATSMaxAckPending.
+	MaxAckPending int `json:"maxAckPending" yaml:"maxAckPending"`
+}
+
+// DefaultNATSMaxAckPending is the number of unacknowledged events of the receiver when none is configured.
+const DefaultNATSMaxAckPending = 1000
+
+const (
+	natsCEPrefix    = "ce-"
+	natsContentType = "content-type"
+
+	natsConnectTimeout = 30 * time.Second
+)
+
+func (c *NATSConfig) validate(field string) error {
+	if c.Password != "" && c.Username == "" {
+		return invalidErr(field+".username", errors.New("must be specified with a password"))
+	}
+	if c.Token != "" && c.Username != "" {
+		return invalidErr(field+".token", errors.New("cannot be used with a username"))
+	}
+	return nil
+}
+
+func validateNATSServer(field, server string) error {
+	u, err := url.Parse(server)
+	if err != nil {
+		return invalidErr(field, err)
+	}
+	if (u.Scheme != "nats" && u.Scheme != "tls") || u.Hostname() == "" {
+		return invalidErr(field, fmt.Errorf("%q must be a nats:// or tls:// URL", server))
+	}
+	return nil
+}
+
+// validNATSToken reports whether the given subject token or name has no whitespace, dots or wildcards.
+func validNATSToken(s string) bool {
+	return s != "" && !strings.ContainsAny(s, " \t\r\n.*>")
+}
+
+func (c *SenderConfig) validateNATS() error {
+	if c.NATS == nil {
+		return invalidErr("sender.nats", fmt.Errorf("must be specified with the %s protocol", ProtocolNATS))
+	}
+	if err := validateNATSServer("sender.target", c.Target); err != nil {
+		return err
+	}
+	for _, token := range strings.Split(c.NATS.Subject, ".") {
+		if !validNATSToken(token) {
+			return invalidErr("sender.nats.subject", fmt.Errorf("%q must be a subject without wildcards", c.NATS.Subject))
+		}
+	}
+	if err := c.NATS.validate("sender.nats"); err != nil {
+		return err
+	}
+	if c.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolNATS))
+	}
+	if c.Auth != nil {
+		return invalidErr("sender.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol, use sender.nats.token", ProtocolNATS))
+	}
+	return nil
+}
+
+func (c *ReceiverConfig) validateNATS() error {
+	if c.NATS == nil {
+		return invalidErr("receiver.nats", fmt.Errorf("must be specified with the %s protocol", ProtocolNATS))
+	}
+	if err := validateNATSServer("receiver.nats.server", c.NATS.Server); err != nil {
+		return err
+	}
+	if !validNATSToken(c.NATS.Stream) {
+		return invalidErr("receiver.nats.stream", fmt.Errorf("%q must be a stream name", c.NATS.Stream))
+	}
+	if c.NATS.Durable != "" && !validNATSToken(c.NATS.Durable) {
+		return invalidErr("receiver.nats.durable", fmt.Errorf("%q must be a consumer name", c.NATS.Durable))
+	}
+	if strings.ContainsAny(c.NATS.Subject, " \t\r\n") {
+		return invalidErr("receiver.nats.subject", fmt.Errorf("%q must be a subject", c.NATS.Subject))
+	}
+	if c.NATS.MaxAckPending < 0 {
+		return invalidErr("receiver.nats.maxAckPending", errors.New("cannot be negative"))
+	}
+	if err := c.NATS.validate("receiver.nats"); err != nil {
+		return err
+	}
+	if c.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolNATS))
+	}
+	if c.TLS != nil {
+		return invalidErr("receiver.tls", fmt.Errorf("the receiver doesn't terminate TLS with the %s protocol, use a tls:// server", ProtocolNATS))
+	}
+	if c.Auth != nil {
+		return invalidErr("receiver.auth", fmt.Errorf("bearer tokens are not supported with the %s protocol", ProtocolNATS))
+	}
+	return nil
+}
+
+// newNATSMsg returns the message publishing the given event in the binary content mode, hdr carries the trace headers
+// of the request and partitionKeyAttribute is the partition key attribute in ordered mode.
+func newNATSMsg(e *ce.Event, hdr http.Header, config *NATSConfig, partitionKeyAttribute string) (*nats.Msg, error) {
+	msg := &nats.Msg{Subject: config.Subject, Header: nats.Header{}, Data: e.Data()}
+
+	attributes, err := binaryAttributes(e)
+	if err != nil {
+		return nil, err
+	}
+	// Headers are set without canonicalization, the binding names them in lower case.
+	for _, a := range attributes {
+		msg.Header[natsCEPrefix+a[0]] = []string{a[1]}
+	}
+	if ct := e.DataContentType(); ct != "" {
+		msg.Header[natsContentType] = []string{ct}
+	}
+	if pk, ok := eventPartitionKey(e, partitionKeyAttribute); ok {
+		msg.Subject += "." + fmt.Sprint(pk)
+	}
+	for _, h := range traceHeaders {
+		if v := hdr.Get(h); v != "" {
+			msg.Header[h] = []string{v}
+		}
+	}
+	return msg, nil
+}
+
+// natsHeader returns the value of the given header of a message regardless of its case.
+func natsHeader(msg *nats.Msg, name string) string {
+	for k, v := range msg.Header {
+		if strings.EqualFold(k, name) && len(v) > 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// natsEvent returns the event of a message in the binary content mode, headers without the ce- prefix are ignored.
+func natsEvent(msg *nats.Msg) (*ce.Event, error) {
+	e := ce.NewEvent()
+	for k, v := range msg.Header {
+		if len(k) <= len(natsCEPrefix) || !strings.EqualFold(k[:len(natsCEPrefix)], natsCEPrefix) || len(v) == 0 {
+			continue
+		}
+		if err := setBinaryAttribute(&e, strings.ToLower(k[len(natsCEPrefix):]), v[0]); err != nil {
+			return nil, err
+		}
+	}
+	setBinaryData(&e, natsHeader(msg, natsContentType), msg.Data)
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// natsHTTPHeader returns the trace headers carried by the message.
+func natsHTTPHeader(msg *nats.Msg) http.Header {
+	hdr := http.Header{}
+	for _, h := range traceHeaders {
+		if v := natsHeader(msg, h); v != "" {
+			hdr.Set(h, v)
+		}
+	}
+	return hdr
+}
+
+// natsBinding is the protocolBinding of ProtocolNATS.
+type natsBinding struct{}
+
+func (natsBinding) validateSender(c *SenderConfig) error {
+	return c.validateNATS()
+}
+
+func (natsBinding) validateReceiver(c *ReceiverConfig) error {
+	return c.validateNATS()
+}
+
+func (natsBinding) newTransport(config *Config) senderTransport {
+	return newNATSTransport(config)
+}
+
+func (natsBinding) startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	return startNATSReceiver(ctx, config, h)
+}
+
+func (natsBinding) resumes() bool {
+	return false
+}
+
+// natsTransport is an http.RoundTripper publishing the events of the requests built by the targeter to JetStream, so
+// that events sent with NATS are paced, measured and accounted for like with HTTP.
+type natsTransport struct {
+	server                string
+	tlsConfig             *tls.Config
+	config                *NATSConfig
+	partitionKeyAttribute string
+
+	lock sync.Mutex
+	conn *nats.Conn
+	js   nats.JetStreamContext
+}
+
+func newNATSTransport(config *Config) *natsTransport {
+	t := &natsTransport{server: config.Sender.Target, config: config.Sender.NATS}
+	if config.Sender.TLS != nil {
+		t.tlsConfig = config.Sender.TLS.Parsed
+	}
+	if config.Ordered != nil {
+		t.partitionKeyAttribute = config.Ordered.partitionKeyAttribute()
+	}
+	return t
+}
+
+func (t *natsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+	msg, err := newNATSMsg(&e, req.Header, t.config, t.partitionKeyAttribute)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := js.PublishMsg(msg, nats.Context(req.Context())); err != nil {
+		if errors.Is(err, nats.ErrNoStreamResponse) {
+			return nil, fmt.Errorf("no stream captures subject %s", msg.Subject)
+		}
+		return nil, fmt.Errorf("publish rejected: %w", err)
+	}
+	return acceptedResponse(req), nil
+}
+
+// connect returns the JetStream context of the connection, the server is dialed again when the client gave up
+// reconnecting.
+func (t *natsTransport) connect() (nats.JetStreamContext, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn != nil && !t.conn.IsClosed() {
+		return t.js, nil
+	}
+	nc, err := connectNATS(t.server, t.tlsConfig, t.config)
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	t.conn, t.js = nc, js
+	return js, nil
+}
+
+func (t *natsTransport) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn != nil {
+		t.conn.Close()
+	}
+}
+
+// startNATSReceiver creates a push consumer on the stream and handles delivered events until the given context is
+// done, events failing the handler are negatively acknowledged so that the server delivers them again.
+func startNATSReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	server, _ := url.Parse(config.NATS.Server)
+
+	closed := make(chan struct{})
+	nc, err := connectNATS(config.NATS.Server, nil, &config.NATS.NATSConfig, nats.ClosedHandler(func(*nats.Conn) { close(closed) }))
+	if err != nil {
+		return err
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		return err
+	}
+
+	maxAckPending := config.NATS.MaxAckPending
+	if maxAckPending == 0 {
+		maxAckPending = DefaultNATSMaxAckPending
+	}
+	opts := []nats.SubOpt{
+		nats.BindStream(config.NATS.Stream),
+		nats.ManualAck(),
+		nats.AckExplicit(),
+		nats.DeliverNew(),
+		nats.MaxAckPending(maxAckPending),
+	}
+	if config.NATS.Durable != "" {
+		opts = append(opts, nats.Durable(config.NATS.Durable))
+	}
+	// The server delivers at most maxAckPending unacknowledged events, messages are handled one at a time.
+	msgs := make(chan *nats.Msg, maxAckPending)
+	if _, err := js.ChanSubscribe(config.NATS.Subject, msgs, opts...); err != nil {
+		return fmt.Errorf("failed to create consumer on stream %s: %w", config.NATS.Stream, err)
+	}
+	markReceiverReady(ctx)
+
+	for {
+		select {
+		case <-ctx.Done():
+			// Unacknowledged events are delivered again once their acknowledgement wait expires.
+			return nil
+		case <-closed:
+			if err := nc.LastError(); err != nil {
+				return err
+			}
+			return errors.New("connection closed")
+		case msg := <-msgs:
+			handleNATSMsg(ctx, config, server, msg, h)
+		}
+	}
+}
+
+func handleNATSMsg(ctx context.Context, config *ReceiverConfig, server *url.URL, msg *nats.Msg, h func(context.Context, *ce.Event, *http.Request) error) {
+	start := time.Now()
+	req := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: "/" + msg.Subject},
+		Header:     natsHTTPHeader(msg),
+		RemoteAddr: server.Host,
+	}
+	defer func() {
+		processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(req, config, processingLatencyHistogramLabels)...)
+	}()
+
+	e, err := natsEvent(msg)
+	if err != nil {
+		logger(LogComponentReceiver).Warnw("Invalid event", "subject", msg.Subject, "error", err)
+		_ = msg.Term()
+		return
+	}
+	if err := h(ctx, e, req); err != nil {
+		_ = msg.Nak()
+		return
+	}
+	_ = msg.Ack()
+}
+
+// connectNATS connects to the given server, the client reconnects to it when the connection is lost.
+func connectNATS(server string, tlsConfig *tls.Config, config *NATSConfig, opts ...nats.Option) (*nats.Conn, error) {
+	opts = append(opts, nats.Name("sacura"), nats.Timeout(natsConnectTimeout))
+	if config.Username != "" {
+		opts = append(opts, nats.UserInfo(config.Username, config.Password))
+	}
+	if config.Token != "" {
+		opts = append(opts, nats.Token(config.Token))
+	}
+	if tlsConfig != nil {
+		opts = append(opts, nats.Secure(tlsConfig))
+	}
+	nc, err := nats.Connect(server, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to server %s: %w", server, err)
+	}
+	return nc, nil
+}
@@ -0,0 +1,432 @@
+package sacura
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/nats-io/nats.go"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestNATSMsgRoundTrip(t *testing.T) {
+
+	binaryEvent := cetest.FullEvent()
+	if err := binaryEvent.SetData("application/octet-stream", []byte{0, 1, 2, 3}); err != nil {
+		t.Fatal(err)
+	}
+	orderedEvent := cetest.FullEvent()
+	orderedEvent.SetExtension(DefaultPartitionKeyExtension, "3")
+
+	tests := []struct {
+		name        string
+		event       ce.Event
+		wantSubject string
+	}{
+		{
+			name:        "full event",
+			event:       cetest.FullEvent(),
+			wantSubject: "events",
+		},
+		{
+			name:        "min event",
+			event:       cetest.MinEvent(),
+			wantSubject: "events",
+		},
+		{
+			name:        "binary data",
+			event:       binaryEvent,
+			wantSubject: "events",
+		},
+		{
+			name:        "partition key",
+			event:       orderedEvent,
+			wantSubject: "events.3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hdr := http.Header{}
+			hdr.Set("traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+
+			msg, err := newNATSMsg(&tt.event, hdr, &NATSConfig{Subject: "events"}, DefaultPartitionKeyExtension)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if msg.Subject != tt.wantSubject {
+				t.Errorf("expected subject %s, got %s", tt.wantSubject, msg.Subject)
+			}
+
+			// The message goes through the encoding of headers, which doesn't preserve their case.
+			var b bytes.Buffer
+			if err := http.Header(msg.Header).Write(&b); err != nil {
+				t.Fatal(err)
+			}
+			b.WriteString("\r\n")
+			mh, err := textproto.NewReader(bufio.NewReader(&b)).ReadMIMEHeader()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := &nats.Msg{Subject: msg.Subject, Header: nats.Header(mh), Data: msg.Data}
+			if v := natsHTTPHeader(got).Get("traceparent"); v != hdr.Get("traceparent") {
+				t.Errorf("expected traceparent %s, got %s", hdr.Get("traceparent"), v)
+			}
+
+			e, err := natsEvent(got)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Extensions are compared regardless of their order and, like with the HTTP binary content mode, their
+			// type.
+			attributes := func(e *ce.Event) map[string]string {
+				b, err := e.MarshalJSON()
+				if err != nil {
+					t.Fatal(err)
+				}
+				m := map[string]interface{}{}
+				if err := json.Unmarshal(b, &m); err != nil {
+					t.Fatal(err)
+				}
+				s := make(map[string]string, len(m))
+				for k, v := range m {
+					s[k] = fmt.Sprint(v)
+				}
+				return s
+			}
+			if diff := cmp.Diff(attributes(&tt.event), attributes(e)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestNATSConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sender   SenderConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			sender:   SenderConfig{Target: "nats://localhost:4222", NATS: &NATSConfig{Subject: "sacura.events"}},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{NATSConfig: NATSConfig{Subject: "sacura.events.>", Token: "token"}, Server: "tls://localhost", Stream: "SACURA"}},
+		},
+		{
+			name:     "missing nats config",
+			sender:   SenderConfig{Target: "nats://localhost:4222"},
+			receiver: ReceiverConfig{},
+			wantErr:  true,
+		},
+		{
+			name:     "http target",
+			sender:   SenderConfig{Target: "http://localhost:4222", NATS: &NATSConfig{Subject: "events"}},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{Server: "http://localhost", Stream: "SACURA"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender wildcard subject and missing stream",
+			sender:   SenderConfig{Target: "nats://localhost:4222", NATS: &NATSConfig{Subject: "events.*"}},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{Server: "nats://localhost"}},
+			wantErr:  true,
+		},
+		{
+			name:     "empty subject and invalid durable",
+			sender:   SenderConfig{Target: "nats://localhost:4222", NATS: &NATSConfig{}},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{Server: "nats://localhost", Stream: "SACURA", Durable: "sacura.receiver"}},
+			wantErr:  true,
+		},
+		{
+			name:     "token with username",
+			sender:   SenderConfig{Target: "nats://localhost:4222", NATS: &NATSConfig{Subject: "events", Username: "user", Token: "token"}},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{NATSConfig: NATSConfig{Username: "user", Token: "token"}, Server: "nats://localhost", Stream: "SACURA"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender batches and receiver dead-letter sink",
+			sender:   SenderConfig{Target: "nats://localhost:4222", NATS: &NATSConfig{Subject: "events"}, BatchSize: 10},
+			receiver: ReceiverConfig{NATS: &ReceiverNATSConfig{Server: "nats://localhost", Stream: "SACURA"}, DeadLetterSinkPath: "/dls"},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.validateNATS(); (err != nil) != tt.wantErr {
+				t.Errorf("sender wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err := tt.receiver.validateNATS(); (err != nil) != tt.wantErr {
+				t.Errorf("receiver wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// testNATSServer is a minimal JetStream server with a single stream capturing the subjects matching streamSubject,
+// messages published to the stream are delivered to the push consumers created on it.
+type testNATSServer struct {
+	listener      net.Listener
+	streamSubject string
+
+	lock      sync.Mutex
+	subs      []testNATSSub
+	consumers []testNATSConsumer
+	seq       int
+	acks      []string
+}
+
+type testNATSSub struct {
+	subject string
+	sid     string
+	conn    *testNATSConn
+}
+
+type testNATSConsumer struct {
+	deliverSubject string
+	filterSubject  string
+}
+
+type testNATSConn struct {
+	lock sync.Mutex
+	conn net.Conn
+}
+
+func (c *testNATSConn) write(s string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	_, _ = c.conn.Write([]byte(s))
+}
+
+// natsSubjectMatches reports whether the subject matches the given subject with wildcards.
+func natsSubjectMatches(pattern, subject string) bool {
+	p, s := strings.Split(pattern, "."), strings.Split(subject, ".")
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) || (token != "*" && token != s[i]) {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
+
+func startTestNATSServer(t *testing.T, streamSubject string) *testNATSServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &testNATSServer{listener: l, streamSubject: streamSubject}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(&testNATSConn{conn: conn})
+		}
+	}()
+	t.Cleanup(func() { _ = l.Close() })
+	return s
+}
+
+func (s *testNATSServer) url() string {
+	return "nats://" + s.listener.Addr().String()
+}
+
+// deliver sends the message to the subscriptions matching the subject, the caller holds the lock.
+func (s *testNATSServer) deliver(subject, reply, hdr, data string) {
+	for _, sub := range s.subs {
+		if !natsSubjectMatches(sub.subject, subject) {
+			continue
+		}
+		if reply != "" {
+			reply += " "
+		}
+		if hdr == "" {
+			sub.conn.write(fmt.Sprintf("MSG %s %s %s%d\r\n%s\r\n", subject, sub.sid, reply, len(data), data))
+		} else {
+			sub.conn.write(fmt.Sprintf("HMSG %s %s %s%d %d\r\n%s%s\r\n", subject, sub.sid, reply, len(hdr), len(hdr)+len(data), hdr, data))
+		}
+	}
+}
+
+func (s *testNATSServer) serve(c *testNATSConn) {
+	defer c.conn.Close()
+
+	c.write(`INFO {"server_id":"test","headers":true,"jetstream":true,"max_payload":1048576}` + "\r\n")
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) == 0 {
+			continue
+		}
+		switch args[0] {
+		case "PING":
+			c.write("PONG\r\n")
+		case "SUB":
+			s.lock.Lock()
+			s.subs = append(s.subs, testNATSSub{subject: args[1], sid: args[len(args)-1], conn: c})
+			s.lock.Unlock()
+		case "PUB", "HPUB":
+			total, _ := strconv.Atoi(args[len(args)-1])
+			hdrLen := 0
+			if args[0] == "HPUB" {
+				hdrLen, _ = strconv.Atoi(args[len(args)-2])
+			}
+			b := make([]byte, total+2)
+			if _, err := io.ReadFull(r, b); err != nil {
+				return
+			}
+			subject, reply := args[1], ""
+			if (args[0] == "PUB" && len(args) == 4) || (args[0] == "HPUB" && len(args) == 5) {
+				reply = args[2]
+			}
+			s.publish(subject, reply, string(b[:hdrLen]), string(b[hdrLen:total]))
+		}
+	}
+}
+
+func (s *testNATSServer) publish(subject, reply, hdr, data string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	switch {
+	case strings.HasPrefix(subject, "$JS.API.CONSUMER."):
+		req := struct {
+			Stream string          `json:"stream_name"`
+			Config json.RawMessage `json:"config"`
+		}{}
+		_ = json.Unmarshal([]byte(data), &req)
+		config := struct {
+			DeliverSubject string `json:"deliver_subject"`
+			FilterSubject  string `json:"filter_subject"`
+		}{}
+		_ = json.Unmarshal(req.Config, &config)
+		s.consumers = append(s.consumers, testNATSConsumer{deliverSubject: config.DeliverSubject, filterSubject: config.FilterSubject})
+		s.deliver(reply, "", "", fmt.Sprintf(`{"type":"io.nats.jetstream.api.v1.consumer_create_response","stream_name":%q,"name":"consumer-%d","config":%s}`, req.Stream, len(s.consumers), req.Config))
+	case strings.HasPrefix(subject, "$JS.ACK."):
+		s.acks = append(s.acks, data)
+	case natsSubjectMatches(s.streamSubject, subject):
+		s.seq++
+		for _, c := range s.consumers {
+			if c.filterSubject == "" || natsSubjectMatches(c.filterSubject, subject) {
+				s.deliver(c.deliverSubject, fmt.Sprintf("$JS.ACK.STREAM.consumer.1.%d.%d.0.0", s.seq, s.seq), hdr, data)
+			}
+		}
+		s.deliver(reply, "", "", fmt.Sprintf(`{"stream":"SACURA","seq":%d}`, s.seq))
+	default:
+		s.deliver(reply, "", "NATS/1.0 503\r\n\r\n", "")
+	}
+}
+
+func TestStartReceiverNATS(t *testing.T) {
+
+	server := startTestNATSServer(t, "events.>")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Protocol: ProtocolNATS,
+			NATS:     &ReceiverNATSConfig{NATSConfig: NATSConfig{Subject: "events.>"}, Server: server.url(), Stream: "SACURA"},
+		}, received, nil)
+	}()
+
+	// Wait for the receiver consumer, messages published before it are not delivered.
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		return len(server.consumers) > 0, nil
+	})
+	if err != nil {
+		t.Fatal("receiver didn't create a consumer", err)
+	}
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             server.url(),
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolNATS,
+			NATS:               &NATSConfig{Subject: "events"},
+		},
+		Ordered:        &OrderedConfig{NumPartitionKeys: 2},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+
+	var acks []string
+	err = wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		server.lock.Lock()
+		defer server.lock.Unlock()
+		acks = server.acks
+		return len(acks) == 10, nil
+	})
+	if err != nil {
+		t.Errorf("expected 10 acknowledgements, got %v", acks)
+	}
+	for _, ack := range acks {
+		if ack != "+ACK" {
+			t.Errorf("expected +ACK acknowledgements, got %v", acks)
+		}
+	}
+}
+
+func TestNATSTransportNoResponders(t *testing.T) {
+
+	server := startTestNATSServer(t, "events.>")
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest(http.MethodPost, server.url(), strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transport := newNATSTransport(&Config{Sender: SenderConfig{Target: server.url(), NATS: &NATSConfig{Subject: "other"}}})
+	defer transport.close()
+	if _, err := transport.RoundTrip(req); err == nil || !strings.Contains(err.Error(), "no stream") {
+		t.Errorf("expected no stream error, got %v", err)
+	}
+}
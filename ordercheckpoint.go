@@ -0,0 +1,328 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultOrderCheckpointInterval is the default interval at which the received sequence numbers are checkpointed.
+const DefaultOrderCheckpointInterval = time.Second
+
+// OrderCheckpointConfig checkpoints the sequence numbers received for each partition key to a file, so that ordering
+// verification continues across intentional restarts of the receiver, for example to simulate rolling upgrades,
+// rather than starting from scratch and missing the events received out of order across the restart.
+//
+// The checkpoint is restored when the receiver starts, events received after the restart with a sequence number lower
+// than the last sequence number received before the restart, beyond ordered.toleranceWindow, are ordering violations.
+// Redeliveries of events received before the restart are not violations.
+//
+// The checkpoint must be removed between runs since sequence numbers start over with each run.
+type OrderCheckpointConfig struct {
+	// Path is the path of the checkpoint file, it is created when it doesn't exist.
+	Path string `json:"path" yaml:"path"`
+	// Interval is the interval at which the checkpoint is written, the checkpoint is also written when the receiver
+	// stops.
+	//
+	// Defaults to DefaultOrderCheckpointInterval.
+	Interval string `json:"interval" yaml:"interval"`
+
+	ParsedInterval time.Duration
+}
+
+func (c *OrderCheckpointConfig) validate(config *Config) error {
+	if config.Ordered == nil {
+		return invalidErr("receiver.orderCheckpoint", errors.New("requires ordered"))
+	}
+	if c.Path == "" {
+		return invalidErr("receiver.orderCheckpoint.path", errors.New("cannot be empty"))
+	}
+	c.ParsedInterval = DefaultOrderCheckpointInterval
+	if c.Interval != "" {
+		var err error
+		c.ParsedInterval, err = time.ParseDuration(c.Interval)
+		if err != nil {
+			return invalidErr("receiver.orderCheckpoint.interval", err)
+		}
+		if c.ParsedInterval <= 0 {
+			return invalidErr("receiver.orderCheckpoint.interval", fmt.Errorf("%v must be positive", c.ParsedInterval))
+		}
+	}
+	return nil
+}
+
+// partitionCheckpoint is the checkpoint of the sequence numbers received for a partition key.
+type partitionCheckpoint struct {
+	// Contiguous is the sequence number up to which all sequence numbers have been received.
+	Contiguous uint64 `json:"contiguous"`
+	// Received are the sequence numbers received above Contiguous, in increasing order.
+	Received []uint64 `json:"received,omitempty"`
+}
+
+// orderCheckpoint is the content of the checkpoint file.
+type orderCheckpoint struct {
+	Partitions map[string]*partitionCheckpoint `json:"partitions"`
+}
+
+// partitionSequences tracks the sequence numbers received for a partition key.
+type partitionSequences struct {
+	contiguous uint64
+	received   map[uint64]struct{}
+	max        uint64
+}
+
+func (p *partitionSequences) add(seq uint64) {
+	if seq > p.max {
+		p.max = seq
+	}
+	if seq <= p.contiguous {
+		return
+	}
+	p.received[seq] = struct{}{}
+	for {
+		if _, ok := p.received[p.contiguous+1]; !ok {
+			return
+		}
+		p.contiguous++
+		delete(p.received, p.contiguous)
+	}
+}
+
+func (p *partitionSequences) has(seq uint64) bool {
+	if seq <= p.contiguous {
+		return true
+	}
+	_, ok := p.received[seq]
+	return ok
+}
+
+func (p *partitionSequences) checkpoint() *partitionCheckpoint {
+	c := &partitionCheckpoint{Contiguous: p.contiguous}
+	for seq := range p.received {
+		c.Received = append(c.Received, seq)
+	}
+	sort.Slice(c.Received, func(i, j int) bool { return c.Received[i] < c.Received[j] })
+	return c
+}
+
+func newPartitionSequences(c *partitionCheckpoint) *partitionSequences {
+	p := &partitionSequences{contiguous: c.Contiguous, received: make(map[uint64]struct{}, len(c.Received)), max: c.Contiguous}
+	for _, seq := range c.Received {
+		p.add(seq)
+	}
+	return p
+}
+
+// RestartOrderingViolation is an event received after a restart of the receiver with a sequence number lower than the
+// last sequence number received before the restart.
+type RestartOrderingViolation struct {
+	ID       string `json:"id"`
+	Sequence uint64 `json:"sequence"`
+	// CheckpointSequence is the last sequence number of the partition key received before the restart.
+	CheckpointSequence uint64 `json:"checkpointSequence"`
+	// Displacement is the number of sequence numbers between the event and CheckpointSequence.
+	Displacement int `json:"displacement"`
+}
+
+// RestartOrderingReport reports the ordering violations across restarts of the receiver, see
+// receiver.orderCheckpoint.
+type RestartOrderingReport struct {
+	// RestoredPartitionCount is the number of partition keys restored from the checkpoint.
+	RestoredPartitionCount int `json:"restoredPartitionCount"`
+	// ViolationCount is the number of events received out of order across the restart, they are included in
+	// Report.OrderingViolationCount.
+	ViolationCount           int                                   `json:"violationCount"`
+	ViolationsByPartitionKey map[string][]RestartOrderingViolation `json:"violationsByPartitionKey,omitempty"`
+}
+
+// orderCheckpointState tracks the sequence numbers received for each partition key.
+type orderCheckpointState struct {
+	config *OrderCheckpointConfig
+	// restored are the partitions restored from the checkpoint, they are not modified.
+	restored   map[string]*partitionSequences
+	partitions map[string]*partitionSequences
+	// violations are the ordering violations across the restart by partition key, seen deduplicates them by ID.
+	violations map[string][]RestartOrderingViolation
+	seen       map[string]struct{}
+}
+
+// newOrderCheckpointState returns the state of the given checkpoint, it returns nil without
+// receiver.orderCheckpoint.
+func newOrderCheckpointState(config *OrderCheckpointConfig) *orderCheckpointState {
+	if config == nil {
+		return nil
+	}
+	return &orderCheckpointState{
+		config:     config,
+		restored:   make(map[string]*partitionSequences),
+		partitions: make(map[string]*partitionSequences),
+		violations: make(map[string][]RestartOrderingViolation),
+		seen:       make(map[string]struct{}),
+	}
+}
+
+// loadOrderCheckpoint restores the checkpoint of receiver.orderCheckpoint, when it exists.
+func (s *StateManager) loadOrderCheckpoint() error {
+	if s.orderCheckpoint == nil {
+		return nil
+	}
+	path := s.orderCheckpoint.config.Path
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read order checkpoint: %w", err)
+	}
+	var c orderCheckpoint
+	if err := json.Unmarshal(b, &c); err != nil {
+		return fmt.Errorf("failed to decode order checkpoint %s: %w", path, err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for pk, p := range c.Partitions {
+		if p == nil {
+			continue
+		}
+		s.orderCheckpoint.restored[pk] = newPartitionSequences(p)
+		s.orderCheckpoint.partitions[pk] = newPartitionSequences(p)
+	}
+	logger(LogComponentState).Infow("Restored order checkpoint", "partitions", len(c.Partitions), "path", path)
+	return nil
+}
+
+// startOrderCheckpoint periodically writes the checkpoint of receiver.orderCheckpoint, the returned function stops
+// writing it and writes it a last time.
+func (s *StateManager) startOrderCheckpoint() func() {
+	if s.orderCheckpoint == nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(s.orderCheckpoint.config.ParsedInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.writeOrderCheckpoint()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			s.writeOrderCheckpoint()
+		})
+	}
+}
+
+// writeOrderCheckpoint writes the checkpoint of receiver.orderCheckpoint, it replaces the previous checkpoint
+// atomically so that a restart while writing doesn't corrupt it.
+func (s *StateManager) writeOrderCheckpoint() {
+	s.lock.RLock()
+	c := orderCheckpoint{Partitions: make(map[string]*partitionCheckpoint, len(s.orderCheckpoint.partitions))}
+	for pk, p := range s.orderCheckpoint.partitions {
+		c.Partitions[pk] = p.checkpoint()
+	}
+	s.lock.RUnlock()
+
+	path := s.orderCheckpoint.config.Path
+	if err := writeFileAtomically(path, c); err != nil {
+		logger(LogComponentState).Warnw("Failed to write order checkpoint", "path", path, "error", err)
+	}
+}
+
+func writeFileAtomically(path string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// recordOrderCheckpoint records the sequence number of the given received event and checks it against the sequence
+// numbers received before the restart, it must be called while holding the lock.
+func (s *StateManager) recordOrderCheckpoint(e *ReceivedEvent) {
+	if s.orderCheckpoint == nil {
+		return
+	}
+	v, ok := e.Event.Extensions()[SequenceExtension]
+	if !ok {
+		return
+	}
+	seq, err := strconv.ParseUint(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return
+	}
+	pk := partitionKey(&e.Event, &s.stateManagerConfig)
+
+	if restored, ok := s.orderCheckpoint.restored[pk]; ok && !restored.has(seq) && seq < restored.max {
+		_, seen := s.orderCheckpoint.seen[e.Event.ID()]
+		if displacement := int(restored.max - seq); !seen && displacement > s.stateManagerConfig.ToleranceWindow {
+			s.orderCheckpoint.seen[e.Event.ID()] = struct{}{}
+			s.orderCheckpoint.violations[pk] = append(s.orderCheckpoint.violations[pk], RestartOrderingViolation{
+				ID:                 e.Event.ID(),
+				Sequence:           seq,
+				CheckpointSequence: restored.max,
+				Displacement:       displacement,
+			})
+		}
+	}
+
+	p, ok := s.orderCheckpoint.partitions[pk]
+	if !ok {
+		p = &partitionSequences{received: make(map[uint64]struct{})}
+		s.orderCheckpoint.partitions[pk] = p
+	}
+	p.add(seq)
+}
+
+// restartOrderingReport sets the restart ordering section of the report, it must be called while holding the lock
+// and after the ordering violations have been set.
+func (s *StateManager) restartOrderingReport(r *Report) {
+	if s.orderCheckpoint == nil {
+		return
+	}
+	report := &RestartOrderingReport{RestoredPartitionCount: len(s.orderCheckpoint.restored)}
+	if len(s.orderCheckpoint.violations) > 0 {
+		report.ViolationsByPartitionKey = make(map[string][]RestartOrderingViolation, len(s.orderCheckpoint.violations))
+	}
+	for pk, violations := range s.orderCheckpoint.violations {
+		report.ViolationsByPartitionKey[pk] = append([]RestartOrderingViolation(nil), violations...)
+		report.ViolationCount += len(violations)
+	}
+	r.RestartOrdering = report
+	r.OrderingViolationCount += report.ViolationCount
+}
@@ -0,0 +1,136 @@
+package sacura
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOrderCheckpointConfigValidate(t *testing.T) {
+	ordered := &OrderedConfig{NumPartitionKeys: 2}
+	tests := []struct {
+		name    string
+		config  Config
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "default interval", config: Config{Ordered: ordered, Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: "checkpoint.json"}}}, want: DefaultOrderCheckpointInterval},
+		{name: "interval", config: Config{Ordered: ordered, Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: "checkpoint.json", Interval: "5s"}}}, want: 5 * time.Second},
+		{name: "unordered", config: Config{Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: "checkpoint.json"}}}, wantErr: true},
+		{name: "no path", config: Config{Ordered: ordered, Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{}}}, wantErr: true},
+		{name: "invalid interval", config: Config{Ordered: ordered, Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: "checkpoint.json", Interval: "soon"}}}, wantErr: true},
+		{name: "zero interval", config: Config{Ordered: ordered, Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: "checkpoint.json", Interval: "0s"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Receiver.OrderCheckpoint.validate(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Receiver.OrderCheckpoint.ParsedInterval != tt.want {
+				t.Errorf("want interval %v, got %v", tt.want, tt.config.Receiver.OrderCheckpoint.ParsedInterval)
+			}
+		})
+	}
+}
+
+func TestPartitionSequences(t *testing.T) {
+	p := &partitionSequences{received: make(map[uint64]struct{})}
+	for _, seq := range []uint64{1, 2, 4, 6, 3} {
+		p.add(seq)
+	}
+	want := &partitionCheckpoint{Contiguous: 4, Received: []uint64{6}}
+	if diff := cmp.Diff(want, p.checkpoint()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	restored := newPartitionSequences(p.checkpoint())
+	if restored.max != 6 {
+		t.Errorf("want max 6, got %d", restored.max)
+	}
+	for seq, want := range map[uint64]bool{1: true, 4: true, 5: false, 6: true, 7: false} {
+		if got := restored.has(seq); got != want {
+			t.Errorf("sequence %d: want %v, got %v", seq, want, got)
+		}
+	}
+}
+
+func TestOrderCheckpointAcrossRestarts(t *testing.T) {
+	config := Config{
+		Ordered:  &OrderedConfig{NumPartitionKeys: 2},
+		Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: filepath.Join(t.TempDir(), "checkpoint.json")}},
+	}
+	if err := config.Receiver.OrderCheckpoint.validate(&config); err != nil {
+		t.Fatal(err)
+	}
+
+	receive := func(sm *StateManager, pk string, sequences ...uint64) {
+		sm.lock.Lock()
+		defer sm.lock.Unlock()
+		for _, seq := range sequences {
+			e := cetest.FullEvent()
+			e.SetID(fmt.Sprintf("%s-%d", pk, seq))
+			e.SetExtension(DefaultPartitionKeyExtension, pk)
+			e.SetExtension(SequenceExtension, fmt.Sprint(seq))
+			sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+		}
+	}
+
+	before, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := before.startOrderCheckpoint()
+	receive(before, "0", 1, 2, 3, 5)
+	receive(before, "1", 1, 2)
+	stop()
+	if report := before.GenerateReport(); report.RestartOrdering == nil || report.RestartOrdering.RestoredPartitionCount != 0 {
+		t.Fatalf("want no restored partition, got %+v", report.RestartOrdering)
+	}
+	if _, err := os.Stat(config.Receiver.OrderCheckpoint.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3 is a redelivery of an event received before the restart, 4 has been sent before 5 and is received after it.
+	receive(after, "0", 3, 4, 4, 6)
+	receive(after, "1", 3)
+
+	report := after.GenerateReport()
+	want := &RestartOrderingReport{
+		RestoredPartitionCount: 2,
+		ViolationCount:         1,
+		ViolationsByPartitionKey: map[string][]RestartOrderingViolation{
+			"0": {{ID: "0-4", Sequence: 4, CheckpointSequence: 5, Displacement: 1}},
+		},
+	}
+	if diff := cmp.Diff(want, report.RestartOrdering); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.OrderingViolationCount < 1 {
+		t.Errorf("want the restart ordering violations in the ordering violation count, got %d", report.OrderingViolationCount)
+	}
+}
+
+func TestOpenStateManagerInvalidOrderCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	if err := os.WriteFile(path, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Ordered:  &OrderedConfig{NumPartitionKeys: 2},
+		Receiver: ReceiverConfig{OrderCheckpoint: &OrderCheckpointConfig{Path: path, ParsedInterval: time.Second}},
+	}
+	if _, err := OpenStateManager(config); err == nil {
+		t.Fatal("want error for an invalid checkpoint")
+	}
+}
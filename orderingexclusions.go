@@ -0,0 +1,143 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// OrderingExclusionConfig is a time window during which ordering isn't required to hold, for example an announced
+// broker upgrade. Ordering violations of events received during the window are reported in the excludedOrdering
+// section of the report and don't count towards verification.maxOrderingViolations.
+type OrderingExclusionConfig struct {
+	// Label is the label of the window, for example "broker-upgrade".
+	Label string `json:"label" yaml:"label"`
+	// Start is either the offset from the first sent event at which the window starts, for example 1m, or the time
+	// the window starts at in the RFC 3339 format, for example 2021-06-01T10:00:00Z.
+	Start string `json:"start" yaml:"start"`
+	// Duration is the duration of the window, for example 5m.
+	Duration string `json:"duration" yaml:"duration"`
+
+	// ParsedStart is set when Start is an offset, ParsedStartTime when Start is a time.
+	ParsedStart     time.Duration
+	ParsedStartTime time.Time
+	ParsedDuration  time.Duration
+}
+
+func (c *OrderedConfig) validateExclusions(config *Config) error {
+	if len(c.Exclusions) == 0 {
+		return nil
+	}
+	if config.Verification.Mode.streams() {
+		return invalidErr("ordered.exclusions", fmt.Errorf("is only supported in the %s verification mode", VerificationModeFull))
+	}
+	for i := range c.Exclusions {
+		w := &c.Exclusions[i]
+		field := fmt.Sprintf("ordered.exclusions[%d]", i)
+		if w.Label == "" {
+			return invalidErr(field+".label", errors.New("label is required"))
+		}
+		var err error
+		if w.ParsedStartTime, err = time.Parse(time.RFC3339, w.Start); err != nil {
+			w.ParsedStartTime = time.Time{}
+			w.ParsedStart, err = time.ParseDuration(w.Start)
+			if err != nil {
+				return invalidErr(field+".start", fmt.Errorf("%q must be an offset or an RFC 3339 time", w.Start))
+			}
+			if w.ParsedStart < 0 {
+				return invalidErr(field+".start", fmt.Errorf("%v cannot be negative", w.ParsedStart))
+			}
+		}
+		w.ParsedDuration, err = time.ParseDuration(w.Duration)
+		if err != nil {
+			return invalidErr(field+".duration", err)
+		}
+		if w.ParsedDuration <= 0 {
+			return invalidErr(field+".duration", fmt.Errorf("%v must be positive", w.ParsedDuration))
+		}
+	}
+	return nil
+}
+
+// window returns the bounds of the window given the time of the first sent event.
+func (c *OrderingExclusionConfig) window(firstSentAt time.Time) (time.Time, time.Time) {
+	start := c.ParsedStartTime
+	if start.IsZero() {
+		start = firstSentAt.Add(c.ParsedStart)
+	}
+	return start, start.Add(c.ParsedDuration)
+}
+
+// ExcludedOrderingReport reports the ordering violations of events received during ordered.exclusions windows, they
+// are informational and aren't part of the ordering violations of the report.
+type ExcludedOrderingReport struct {
+	Windows                  []ExcludedOrderingWindow  `json:"windows"`
+	ViolationCount           int                       `json:"violationCount"`
+	ViolationsByPartitionKey map[string]OrderingReport `json:"violations,omitempty"`
+}
+
+// ExcludedOrderingWindow is an ordered.exclusions window resolved to the times of the test.
+type ExcludedOrderingWindow struct {
+	Label string    `json:"label"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// ViolationCount is the number of ordering violations of events received during the window.
+	ViolationCount int `json:"violationCount"`
+}
+
+// excludedOrderingReport moves the ordering violations of events received during ordered.exclusions windows to the
+// excludedOrdering section of the report, it must be called while holding the lock after ordering violations have
+// been reported.
+func (s *StateManager) excludedOrderingReport(r *Report) {
+	if s.config.Ordered == nil || len(s.config.Ordered.Exclusions) == 0 {
+		return
+	}
+	var firstSentAt time.Time
+	for _, t := range s.sentAt {
+		if !t.IsZero() && (firstSentAt.IsZero() || t.Before(firstSentAt)) {
+			firstSentAt = t
+		}
+	}
+	report := &ExcludedOrderingReport{Windows: make([]ExcludedOrderingWindow, len(s.config.Ordered.Exclusions))}
+	for i := range s.config.Ordered.Exclusions {
+		w := &s.config.Ordered.Exclusions[i]
+		start, end := w.window(firstSentAt)
+		report.Windows[i] = ExcludedOrderingWindow{Label: w.Label, Start: start, End: end}
+	}
+	sort.SliceStable(report.Windows, func(i, j int) bool { return report.Windows[i].Start.Before(report.Windows[j].Start) })
+
+	for pk, ordering := range r.OrderingViolationsByPartitionKey {
+		var kept, excluded []OrderingViolation
+		for _, v := range ordering.Violations {
+			receivedAt := s.receivedAt[v.ID]
+			inWindow := false
+			for i, w := range report.Windows {
+				if !receivedAt.IsZero() && !receivedAt.Before(w.Start) && receivedAt.Before(w.End) {
+					report.Windows[i].ViolationCount++
+					inWindow = true
+				}
+			}
+			if inWindow {
+				excluded = append(excluded, v)
+			} else {
+				kept = append(kept, v)
+			}
+		}
+		if len(excluded) == 0 {
+			continue
+		}
+		if report.ViolationsByPartitionKey == nil {
+			report.ViolationsByPartitionKey = make(map[string]OrderingReport)
+		}
+		report.ViolationsByPartitionKey[pk] = newOrderingReport(excluded)
+		report.ViolationCount += len(excluded)
+		r.OrderingViolationCount -= len(excluded)
+		if len(kept) == 0 {
+			delete(r.OrderingViolationsByPartitionKey, pk)
+		} else {
+			r.OrderingViolationsByPartitionKey[pk] = newOrderingReport(kept)
+		}
+	}
+	r.ExcludedOrdering = report
+}
@@ -0,0 +1,120 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOrderedConfigValidateExclusions(t *testing.T) {
+	tests := []struct {
+		name       string
+		exclusions []OrderingExclusionConfig
+		mode       VerificationMode
+		want       []OrderingExclusionConfig
+		wantErr    bool
+	}{
+		{
+			name:       "offset",
+			exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "1m", Duration: "5m"}},
+			want:       []OrderingExclusionConfig{{Label: "upgrade", Start: "1m", Duration: "5m", ParsedStart: time.Minute, ParsedDuration: 5 * time.Minute}},
+		},
+		{
+			name:       "time",
+			exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "2021-06-01T10:00:00Z", Duration: "5m"}},
+			want: []OrderingExclusionConfig{{
+				Label: "upgrade", Start: "2021-06-01T10:00:00Z", Duration: "5m",
+				ParsedStartTime: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC), ParsedDuration: 5 * time.Minute,
+			}},
+		},
+		{name: "missing label", exclusions: []OrderingExclusionConfig{{Start: "1m", Duration: "5m"}}, wantErr: true},
+		{name: "invalid start", exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "10:00", Duration: "5m"}}, wantErr: true},
+		{name: "negative start", exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "-1m", Duration: "5m"}}, wantErr: true},
+		{name: "zero duration", exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "1m", Duration: "0s"}}, wantErr: true},
+		{
+			name:       "streaming",
+			exclusions: []OrderingExclusionConfig{{Label: "upgrade", Start: "1m", Duration: "5m"}},
+			mode:       VerificationModeStreaming,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{Ordered: &OrderedConfig{Exclusions: tt.exclusions}, Verification: VerificationConfig{Mode: tt.mode}}
+			err := config.Ordered.validateExclusions(config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, config.Ordered.Exclusions); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerExcludedOrdering(t *testing.T) {
+	one := 1
+	config := Config{
+		Ordered: &OrderedConfig{
+			NumPartitionKeys: 1,
+			Exclusions:       []OrderingExclusionConfig{{Label: "upgrade", ParsedStart: 5 * time.Minute, ParsedDuration: 10 * time.Minute}},
+		},
+		Verification: VerificationConfig{MaxOrderingViolations: &one},
+	}
+	sm := newTestStateManager(t, config)
+
+	start := time.Now()
+	var sent []ce.Event
+	for _, id := range []string{"0-1", "0-2", "0-3", "0-4"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, "0")
+		setSentTimestamp(&e, start)
+		sent = append(sent, e)
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	// 0-1 is received out of order before the upgrade, 0-3 during the upgrade.
+	for _, d := range []struct {
+		event int
+		at    time.Duration
+	}{
+		{1, time.Second},
+		{0, 2 * time.Second},
+		{3, 10 * time.Minute},
+		{2, 10*time.Minute + time.Second},
+	} {
+		sm.recordReceived(&ReceivedEvent{Event: sent[d.event], ReceivedAt: start.Add(d.at)})
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 4})
+
+	report := sm.GenerateReport()
+	if report.OrderingViolationCount != 1 || len(report.OrderingViolationsByPartitionKey["0"].Violations) != 1 {
+		t.Fatalf("want 1 ordering violation outside the window, got %d: %+v", report.OrderingViolationCount, report.OrderingViolationsByPartitionKey)
+	}
+	if report.ExcludedOrdering == nil {
+		t.Fatal("want excluded ordering report")
+	}
+	wantWindows := []ExcludedOrderingWindow{{Label: "upgrade", Start: start.Add(5 * time.Minute), End: start.Add(15 * time.Minute), ViolationCount: 1}}
+	if diff := cmp.Diff(wantWindows, report.ExcludedOrdering.Windows); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	excluded := report.ExcludedOrdering.ViolationsByPartitionKey["0"].Violations
+	if report.ExcludedOrdering.ViolationCount != 1 || len(excluded) != 1 || excluded[0].ID == report.OrderingViolationsByPartitionKey["0"].Violations[0].ID {
+		t.Errorf("want 1 excluded violation distinct from the reported one, got %+v", report.ExcludedOrdering)
+	}
+
+	if err := verify(config, report); err != nil {
+		t.Error("want violations during the window not to fail the test, got", err)
+	}
+}
@@ -0,0 +1,137 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/go-yaml/yaml"
+)
+
+// EnvConfigOverridePrefix is the prefix of the environment variables overriding config fields.
+const EnvConfigOverridePrefix = "SACURA_"
+
+// ConfigOverride overrides a field of the config file, so that runs can be tweaked without templating the whole file.
+type ConfigOverride struct {
+	// Path is the dot separated path of YAML keys of the field, for example sender.frequency.
+	Path string
+	// Value is the YAML value of the field, for example 1000.
+	Value string
+}
+
+// ParseConfigOverride parses an override in the path=value form, for example sender.frequency=1000.
+func ParseConfigOverride(s string) (ConfigOverride, error) {
+	i := strings.Index(s, "=")
+	if i <= 0 {
+		return ConfigOverride{}, fmt.Errorf("invalid override %q, expected path=value", s)
+	}
+	o := ConfigOverride{Path: s[:i], Value: s[i+1:]}
+	if _, ok := configPaths()[o.Path]; !ok {
+		return ConfigOverride{}, invalidErr(o.Path, errors.New("unknown config field"))
+	}
+	return o, nil
+}
+
+// EnvConfigOverrides returns the overrides of the environment variables in environ, in the form returned by
+// os.Environ.
+//
+// The variable of a field is EnvConfigOverridePrefix followed by the path of the field in upper snake case, for
+// example SACURA_SENDER_FREQUENCY overrides sender.frequency and SACURA_SENDER_KEEP_ALIVE overrides sender.keepAlive.
+// Variables not matching any field are ignored, since Kubernetes defines variables like SACURA_SERVICE_HOST for a
+// service named sacura.
+func EnvConfigOverrides(environ []string) []ConfigOverride {
+	paths := make(map[string]string)
+	for path, env := range configPaths() {
+		paths[env] = path
+	}
+
+	var overrides []ConfigOverride
+	for _, kv := range environ {
+		i := strings.Index(kv, "=")
+		if i < 0 || !strings.HasPrefix(kv[:i], EnvConfigOverridePrefix) {
+			continue
+		}
+		if path, ok := paths[kv[:i]]; ok {
+			overrides = append(overrides, ConfigOverride{Path: path, Value: kv[i+1:]})
+		}
+	}
+	return overrides
+}
+
+// applyOverrides applies the given overrides in order, so that later overrides of the same field win.
+func (c *Config) applyOverrides(overrides []ConfigOverride) error {
+	paths := configPaths()
+	for _, o := range overrides {
+		if _, ok := paths[o.Path]; !ok {
+			return invalidErr(o.Path, errors.New("unknown config field"))
+		}
+
+		var value interface{}
+		if err := yaml.Unmarshal([]byte(o.Value), &value); err != nil {
+			return invalidErr(o.Path, err)
+		}
+		keys := strings.Split(o.Path, ".")
+		for i := len(keys) - 1; i >= 0; i-- {
+			value = map[string]interface{}{keys[i]: value}
+		}
+		b, err := yaml.Marshal(value)
+		if err != nil {
+			return invalidErr(o.Path, err)
+		}
+		// Nested structs are decoded in place, so only the overridden field changes.
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return invalidErr(o.Path, err)
+		}
+	}
+	return nil
+}
+
+// configPaths returns the environment variable of each field of Config by path, including fields of nested structs.
+func configPaths() map[string]string {
+	paths := make(map[string]string)
+	addConfigPaths(paths, reflect.TypeOf(Config{}), "", EnvConfigOverridePrefix, map[reflect.Type]bool{})
+	return paths
+}
+
+func addConfigPaths(paths map[string]string, t reflect.Type, path, env string, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		key := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if key == "" || key == "-" {
+			continue
+		}
+		p, e := key, env+upperSnakeCase(key)
+		if path != "" {
+			p = path + "." + key
+		}
+		paths[p] = e
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			addConfigPaths(paths, ft, p, e+"_", visited)
+		}
+	}
+}
+
+// upperSnakeCase converts a camel case YAML key to upper snake case, for example keepAlive to KEEP_ALIVE.
+func upperSnakeCase(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i > 0 && unicode.IsUpper(r) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
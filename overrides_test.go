@@ -0,0 +1,152 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEnvConfigOverrides(t *testing.T) {
+
+	environ := []string{
+		"HOME=/root",
+		"SACURA_SENDER_FREQUENCY=1000",
+		"SACURA_SENDER_KEEP_ALIVE=true",
+		"SACURA_REPORT_KUBERNETES_CONFIG_MAP=report",
+		"SACURA_SERVICE_HOST=10.0.0.1",
+		"SACURA_RECEIVER_TIMEOUT=",
+	}
+
+	want := []ConfigOverride{
+		{Path: "sender.frequency", Value: "1000"},
+		{Path: "sender.keepAlive", Value: "true"},
+		{Path: "report.kubernetes.configMap", Value: "report"},
+		{Path: "receiver.timeout", Value: ""},
+	}
+	if diff := cmp.Diff(want, EnvConfigOverrides(environ)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestParseConfigOverride(t *testing.T) {
+
+	tests := []struct {
+		s       string
+		want    ConfigOverride
+		wantErr bool
+	}{
+		{s: "sender.frequency=1000", want: ConfigOverride{Path: "sender.frequency", Value: "1000"}},
+		{s: "sender.target=http://localhost:8080?a=b", want: ConfigOverride{Path: "sender.target", Value: "http://localhost:8080?a=b"}},
+		{s: "ordered=", want: ConfigOverride{Path: "ordered"}},
+		{s: "sender.frequency", wantErr: true},
+		{s: "=1000", wantErr: true},
+		{s: "sender.unknown=1", wantErr: true},
+		{s: "sender.parsedwarmup=1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseConfigOverride(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestFileConfigOverrides(t *testing.T) {
+
+	file := `
+sender:
+  target: http://localhost:8080
+  frequency: 10
+  workers: 1
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 10
+duration: 1m
+`
+
+	tests := []struct {
+		name      string
+		overrides []ConfigOverride
+		check     func(t *testing.T, c Config)
+		wantErr   bool
+	}{
+		{
+			name: "last override wins",
+			overrides: []ConfigOverride{
+				{Path: "sender.frequency", Value: "100"},
+				{Path: "sender.frequency", Value: "1000"},
+				{Path: "receiver.timeout", Value: "2m"},
+			},
+			check: func(t *testing.T, c Config) {
+				if c.Sender.FrequencyPerSecond != 1000 || c.Sender.Target != "http://localhost:8080" || c.Receiver.ParsedTimeout != 2*time.Minute {
+					t.Errorf("unexpected config %+v", c)
+				}
+			},
+		},
+		{
+			name:      "nested struct",
+			overrides: []ConfigOverride{{Path: "ordered.partitionKeyStrategy", Value: "round-robin"}},
+			check: func(t *testing.T, c Config) {
+				if c.Ordered.NumPartitionKeys != 10 || c.Ordered.PartitionKeyStrategy != PartitionKeyStrategyRoundRobin {
+					t.Errorf("unexpected ordered config %+v", c.Ordered)
+				}
+			},
+		},
+		{
+			name:      "unset nested struct",
+			overrides: []ConfigOverride{{Path: "report.interim.interval", Value: "10s"}},
+			check: func(t *testing.T, c Config) {
+				if c.Report.Interim == nil || c.Report.Interim.ParsedInterval != 10*time.Second {
+					t.Errorf("unexpected interim report config %+v", c.Report.Interim)
+				}
+			},
+		},
+		{
+			name:      "list",
+			overrides: []ConfigOverride{{Path: "report.writers", Value: "[{format: json, path: /tmp/report.json}]"}},
+			check: func(t *testing.T, c Config) {
+				want := []ReportWriterConfig{{Format: ReportFormatJSON, Path: "/tmp/report.json"}}
+				if diff := cmp.Diff(want, c.Report.Writers); diff != "" {
+					t.Error("(-want, +got)", diff)
+				}
+			},
+		},
+		{
+			name:      "invalid value type",
+			overrides: []ConfigOverride{{Path: "sender.frequency", Value: "fast"}},
+			wantErr:   true,
+		},
+		{
+			name:      "invalid value",
+			overrides: []ConfigOverride{{Path: "sender.frequency", Value: "0"}},
+			wantErr:   true,
+		},
+		{
+			name:      "unknown field",
+			overrides: []ConfigOverride{{Path: "sender.unknown", Value: "1"}},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileConfig(strings.NewReader(file), tt.overrides...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
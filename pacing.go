@@ -0,0 +1,124 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// PacingConfig shapes the intervals between requests, since perfectly even intervals hide batching and bursting bugs
+// of brokers.
+type PacingConfig struct {
+	// JitterPercentage shifts each request by a random offset of at most the given percentage of the interval between
+	// requests, earlier or later, the average rate is unchanged.
+	JitterPercentage int `json:"jitterPercentage" yaml:"jitterPercentage"`
+	// Burst sends bursts of requests back-to-back on top of the rate of sender.frequency or sender.loadProfile.
+	Burst *BurstConfig `json:"burst" yaml:"burst"`
+}
+
+type BurstConfig struct {
+	// Size is the number of requests sent back-to-back in each burst.
+	Size int `json:"size" yaml:"size"`
+	// Interval is the time between the beginning of two bursts, for example 10s, the first burst is sent at the
+	// beginning of the test.
+	Interval string `json:"interval" yaml:"interval"`
+
+	ParsedInterval time.Duration
+}
+
+func (c *PacingConfig) validate(sender *SenderConfig) error {
+	if sender.Replay != nil {
+		return invalidErr("sender.pacing", errors.New("cannot be used with sender.replay, which follows the recorded pacing"))
+	}
+	if c.JitterPercentage < 0 || c.JitterPercentage > 100 {
+		return invalidErr("sender.pacing.jitterPercentage", errors.New("must be between 0 and 100"))
+	}
+	if c.Burst == nil {
+		return nil
+	}
+	if c.Burst.Size <= 0 {
+		return invalidErr("sender.pacing.burst.size", errors.New("must be greater than 0"))
+	}
+	var err error
+	c.Burst.ParsedInterval, err = time.ParseDuration(c.Burst.Interval)
+	if err != nil {
+		return invalidErr("sender.pacing.burst.interval", err)
+	}
+	if c.Burst.ParsedInterval <= 0 {
+		return invalidErr("sender.pacing.burst.interval", fmt.Errorf("%v must be greater than 0", c.Burst.ParsedInterval))
+	}
+	return nil
+}
+
+// pacer returns a pacer shaping the requests paced by the given pacer.
+func (c *PacingConfig) pacer(pacer vegeta.Pacer, r *rand.Rand) vegeta.Pacer {
+	return &shapedPacer{pacer: pacer, jitter: float64(c.JitterPercentage) / 100, burst: c.Burst, rand: r}
+}
+
+// shapedPacer adds jitter and bursts to the requests paced by a pacer.
+//
+// It is not safe for concurrent use, vegeta calls Pace from a single goroutine.
+type shapedPacer struct {
+	pacer  vegeta.Pacer
+	jitter float64
+	burst  *BurstConfig
+	rand   *rand.Rand
+
+	// offset is the jitter of the request number hit, Pace is called again for the same request until it is sent.
+	hit    uint64
+	offset time.Duration
+	// drawn is true once the offset of the first request has been drawn.
+	drawn bool
+}
+
+var _ vegeta.Pacer = &shapedPacer{}
+
+// Pace implements vegeta.Pacer.
+func (p *shapedPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	var nextBurst time.Duration
+	if p.burst != nil {
+		bursts := uint64(elapsed/p.burst.ParsedInterval) + 1
+		due := bursts * uint64(p.burst.Size)
+		if hits < due {
+			// The current burst is not over, send next hit immediately.
+			return 0, false
+		}
+		hits -= due
+		nextBurst = time.Duration(bursts)*p.burst.ParsedInterval - elapsed
+	}
+
+	if p.jitter > 0 {
+		if !p.drawn || hits != p.hit {
+			p.hit, p.drawn = hits, true
+			p.offset = 0
+			if rate := p.pacer.Rate(elapsed); rate > 0 {
+				interval := float64(time.Second) / rate
+				p.offset = time.Duration((2*p.rand.Float64() - 1) * p.jitter * interval)
+			}
+		}
+		// A positive offset delays the request, a negative offset anticipates it.
+		elapsed -= p.offset
+		if elapsed < 0 {
+			elapsed = 0
+		}
+	}
+
+	wait, stop := p.pacer.Pace(elapsed, hits)
+	if stop || p.burst == nil {
+		return wait, stop
+	}
+	return time.Duration(math.Min(float64(wait), float64(nextBurst))), false
+}
+
+// Rate implements vegeta.Pacer.
+func (p *shapedPacer) Rate(elapsed time.Duration) float64 {
+	rate := p.pacer.Rate(elapsed)
+	if p.burst != nil {
+		rate += float64(p.burst.Size) / p.burst.ParsedInterval.Seconds()
+	}
+	return rate
+}
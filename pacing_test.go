@@ -0,0 +1,103 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// simulatePacer returns the offsets at which vegeta sends requests paced by the given pacer during the given duration.
+func simulatePacer(p vegeta.Pacer, duration time.Duration) []time.Duration {
+	var hits []time.Duration
+	elapsed := time.Duration(0)
+	for elapsed < duration {
+		wait, stop := p.Pace(elapsed, uint64(len(hits)))
+		if stop {
+			break
+		}
+		if wait > 0 {
+			elapsed += wait
+			continue
+		}
+		hits = append(hits, elapsed)
+	}
+	return hits
+}
+
+func TestShapedPacerBurst(t *testing.T) {
+	config := &PacingConfig{Burst: &BurstConfig{Size: 5, Interval: "1s"}}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	p := config.pacer(vegeta.Rate{Freq: 10, Per: time.Second}, newRand(nil, "pacing"))
+
+	// The rate sends its first hit after one interval, its hit at 3s is past the duration.
+	hits := simulatePacer(p, 3*time.Second)
+	if want := 3*10 - 1 + 3*5; len(hits) != want {
+		t.Errorf("want %d hits, got %d", want, len(hits))
+	}
+	at := make(map[time.Duration]int)
+	for _, h := range hits {
+		at[h]++
+	}
+	for _, start := range []time.Duration{0, time.Second, 2 * time.Second} {
+		if at[start] < 5 {
+			t.Errorf("want a burst of 5 hits at %v, got %d", start, at[start])
+		}
+	}
+	if got := p.Rate(0); got != 15 {
+		t.Errorf("want rate 15, got %v", got)
+	}
+}
+
+func TestShapedPacerJitter(t *testing.T) {
+	seed := int64(1)
+	config := &PacingConfig{JitterPercentage: 50}
+	p := config.pacer(vegeta.Rate{Freq: 10, Per: time.Second}, newRand(&seed, "pacing"))
+
+	hits := simulatePacer(p, 10*time.Second)
+	if len(hits) < 99 || len(hits) > 101 {
+		t.Fatalf("want about 100 hits, got %d", len(hits))
+	}
+
+	interval := 100 * time.Millisecond
+	intervals := make(map[time.Duration]struct{})
+	for i, h := range hits {
+		nominal := time.Duration(i+1) * interval
+		if h < nominal-interval/2 || h > nominal+interval/2 {
+			t.Errorf("want hit %d within %v of %v, got %v", i, interval/2, nominal, h)
+		}
+		if i > 0 {
+			intervals[h-hits[i-1]] = struct{}{}
+		}
+	}
+	if len(intervals) < 10 {
+		t.Errorf("want jittered intervals, got %d distinct intervals", len(intervals))
+	}
+}
+
+func TestPacingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  PacingConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "valid", config: PacingConfig{JitterPercentage: 100, Burst: &BurstConfig{Size: 1, Interval: "1s"}}},
+		{name: "negative jitter", config: PacingConfig{JitterPercentage: -1}, wantErr: true},
+		{name: "jitter over 100", config: PacingConfig{JitterPercentage: 101}, wantErr: true},
+		{name: "burst without size", config: PacingConfig{Burst: &BurstConfig{Interval: "1s"}}, wantErr: true},
+		{name: "burst without interval", config: PacingConfig{Burst: &BurstConfig{Size: 1}}, wantErr: true},
+		{name: "zero burst interval", config: PacingConfig{Burst: &BurstConfig{Size: 1, Interval: "0s"}}, wantErr: true},
+		{name: "replay", config: PacingConfig{JitterPercentage: 10}, sender: SenderConfig{Replay: &ReplayConfig{}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.sender); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
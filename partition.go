@@ -0,0 +1,149 @@
+package sacura
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+type PartitionKeyStrategy string
+
+const (
+	// PartitionKeyStrategyRandom assigns partition keys uniformly at random.
+	PartitionKeyStrategyRandom PartitionKeyStrategy = "random"
+	// PartitionKeyStrategyRoundRobin assigns partition keys in turn.
+	PartitionKeyStrategyRoundRobin PartitionKeyStrategy = "round-robin"
+	// PartitionKeyStrategyZipf assigns partition keys following a Zipf distribution, the lower the key the more
+	// events are assigned to it.
+	PartitionKeyStrategyZipf PartitionKeyStrategy = "zipf"
+	// PartitionKeyStrategyFixed assigns the same partition key to every event.
+	PartitionKeyStrategyFixed PartitionKeyStrategy = "fixed"
+
+	DefaultZipfExponent = 1.5
+)
+
+// newPartitionKeyGenerator returns a function returning the partition key of the next event, it is safe for
+// concurrent use.
+func newPartitionKeyGenerator(config *OrderedConfig, r *rand.Rand) func() string {
+	if config.Cardinality != nil {
+		return newGrowingPartitionKeyGenerator(config, r, time.Now(), time.Now)
+	}
+	n := uint64(config.NumPartitionKeys)
+
+	switch config.PartitionKeyStrategy {
+	case PartitionKeyStrategyRoundRobin:
+		var lock sync.Mutex
+		next := uint64(0)
+		return func() string {
+			lock.Lock()
+			defer lock.Unlock()
+
+			pk := next
+			next = (next + 1) % n
+			return config.partitionKey(pk)
+		}
+	case PartitionKeyStrategyZipf:
+		exponent := config.ZipfExponent
+		if exponent == 0 {
+			exponent = DefaultZipfExponent
+		}
+		var lock sync.Mutex
+		zipf := rand.NewZipf(r, exponent, 1, n-1)
+		return func() string {
+			lock.Lock()
+			defer lock.Unlock()
+
+			return config.partitionKey(zipf.Uint64())
+		}
+	case PartitionKeyStrategyFixed:
+		return func() string {
+			return config.partitionKey(0)
+		}
+	default:
+		return func() string {
+			return config.partitionKey(uint64(r.Int() % int(n)))
+		}
+	}
+}
+
+// partitionKey returns the name of the partition key with the given index.
+func (c *OrderedConfig) partitionKey(i uint64) string {
+	if c.PartitionKeyFormat == "" {
+		return fmt.Sprint(i)
+	}
+	return fmt.Sprintf(c.PartitionKeyFormat, i)
+}
+
+// partitionKeys returns the names of all partition keys.
+func (c *OrderedConfig) partitionKeys() []string {
+	keys := make([]string, 0, c.NumPartitionKeys)
+	for i := uint64(0); i < uint64(c.NumPartitionKeys); i++ {
+		keys = append(keys, c.partitionKey(i))
+	}
+	return keys
+}
+
+func (c *OrderedConfig) validatePartitionKeyFormat() error {
+	if c.PartitionKeyFormat == "" {
+		return nil
+	}
+	first, second := fmt.Sprintf(c.PartitionKeyFormat, 0), fmt.Sprintf(c.PartitionKeyFormat, 1)
+	if strings.Contains(first, "%!") || first == second {
+		return invalidErr("ordered.partitionKeyFormat", fmt.Errorf("%q must contain a single integer verb, for example key-%%d", c.PartitionKeyFormat))
+	}
+	return nil
+}
+
+// PartitionKeyBalance is the share of events of a single partition key.
+type PartitionKeyBalance struct {
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// SentPercentage and ReceivedPercentage are the percentages of all sent and received events.
+	SentPercentage     float64 `json:"sentPercentage"`
+	ReceivedPercentage float64 `json:"receivedPercentage"`
+}
+
+// partitionBalanceReport reports the events sent and received for each partition key and the imbalance of received
+// events across partition keys, it must be called while holding the lock.
+func (s *StateManager) partitionBalanceReport(r *Report) {
+	if s.config.Ordered == nil || s.highCardinality() {
+		return
+	}
+
+	r.PartitionBalance = make(map[string]PartitionKeyBalance, s.config.Ordered.NumPartitionKeys)
+	for _, k := range s.config.Ordered.partitionKeys() {
+		r.PartitionBalance[k] = PartitionKeyBalance{}
+	}
+	sent, received := 0, 0
+	for k, v := range s.sent {
+		b := r.PartitionBalance[k]
+		b.SentCount = len(s.withoutFailedSends(v))
+		sent += b.SentCount
+		r.PartitionBalance[k] = b
+	}
+	for k, v := range r.ReceivedEventsByPartitionKey {
+		b := r.PartitionBalance[k]
+		b.ReceivedCount = len(v)
+		received += b.ReceivedCount
+		r.PartitionBalance[k] = b
+	}
+
+	max := 0
+	for k, b := range r.PartitionBalance {
+		if sent > 0 {
+			b.SentPercentage = 100 * float64(b.SentCount) / float64(sent)
+		}
+		if received > 0 {
+			b.ReceivedPercentage = 100 * float64(b.ReceivedCount) / float64(received)
+		}
+		if b.ReceivedCount > max {
+			max = b.ReceivedCount
+		}
+		r.PartitionBalance[k] = b
+	}
+	if received > 0 {
+		r.PartitionImbalance = float64(max) * float64(len(r.PartitionBalance)) / float64(received)
+	}
+}
@@ -0,0 +1,146 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNewPartitionKeyGenerator(t *testing.T) {
+
+	n := 10000
+
+	tests := []struct {
+		name   string
+		config OrderedConfig
+		check  func(t *testing.T, counts map[string]int)
+	}{
+		{
+			name:   "random",
+			config: OrderedConfig{NumPartitionKeys: 4, PartitionKeyStrategy: PartitionKeyStrategyRandom},
+			check: func(t *testing.T, counts map[string]int) {
+				if len(counts) != 4 {
+					t.Errorf("expected 4 partition keys, got %v", counts)
+				}
+			},
+		},
+		{
+			name:   "round robin",
+			config: OrderedConfig{NumPartitionKeys: 4, PartitionKeyStrategy: PartitionKeyStrategyRoundRobin},
+			check: func(t *testing.T, counts map[string]int) {
+				for i := 0; i < 4; i++ {
+					if got := counts[fmt.Sprint(i)]; got != n/4 {
+						t.Errorf("expected %d events for partition key %d, got %d", n/4, i, got)
+					}
+				}
+			},
+		},
+		{
+			name:   "zipf",
+			config: OrderedConfig{NumPartitionKeys: 10, PartitionKeyStrategy: PartitionKeyStrategyZipf, ZipfExponent: 2},
+			check: func(t *testing.T, counts map[string]int) {
+				if len(counts) > 10 {
+					t.Errorf("expected at most 10 partition keys, got %v", counts)
+				}
+				if counts["0"] < n/2 || counts["0"] <= counts["1"] || counts["1"] <= counts["9"] {
+					t.Errorf("expected skewed distribution, got %v", counts)
+				}
+			},
+		},
+		{
+			name:   "zipf single key",
+			config: OrderedConfig{NumPartitionKeys: 1, PartitionKeyStrategy: PartitionKeyStrategyZipf},
+			check: func(t *testing.T, counts map[string]int) {
+				if counts["0"] != n {
+					t.Errorf("expected all events for partition key 0, got %v", counts)
+				}
+			},
+		},
+		{
+			name:   "round robin with format",
+			config: OrderedConfig{NumPartitionKeys: 2, PartitionKeyStrategy: PartitionKeyStrategyRoundRobin, PartitionKeyFormat: "tenant-%03d"},
+			check: func(t *testing.T, counts map[string]int) {
+				if counts["tenant-000"] != n/2 || counts["tenant-001"] != n/2 {
+					t.Errorf("expected %d events for partition keys tenant-000 and tenant-001, got %v", n/2, counts)
+				}
+			},
+		},
+		{
+			name:   "fixed",
+			config: OrderedConfig{NumPartitionKeys: 4, PartitionKeyStrategy: PartitionKeyStrategyFixed},
+			check: func(t *testing.T, counts map[string]int) {
+				if counts["0"] != n {
+					t.Errorf("expected all events for partition key 0, got %v", counts)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := newPartitionKeyGenerator(&tt.config, newRand(nil, "partitionKeys"))
+			counts := make(map[string]int)
+			for i := 0; i < n; i++ {
+				counts[next()]++
+			}
+			tt.check(t, counts)
+		})
+	}
+}
+
+func TestOrderedConfigValidatePartitionKeyFormat(t *testing.T) {
+	tests := []struct {
+		format  string
+		wantErr bool
+	}{
+		{format: ""},
+		{format: "key-%d"},
+		{format: "tenant-%03x"},
+		{format: "key", wantErr: true},
+		{format: "key-%s", wantErr: true},
+		{format: "key-%d-%d", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			c := OrderedConfig{NumPartitionKeys: 2, PartitionKeyFormat: tt.format}
+			if err := c.validatePartitionKeyFormat(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestStateManagerPartitionBalance(t *testing.T) {
+	ordered := &OrderedConfig{NumPartitionKeys: 3, PartitionKeyFormat: "key-%d"}
+	sm := newTestStateManager(t, Config{DeliveryGuarantee: AtLeastOnce, Ordered: ordered})
+
+	// key-0 gets 3 events, key-1 one event that is lost and key-2 no event.
+	sm.lock.Lock()
+	for i, pk := range []string{"key-0", "key-0", "key-0", "key-1"} {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension(ordered.partitionKeyExtension(), pk)
+		sm.recordSent(&e)
+		if pk == "key-0" {
+			sm.recordReceived(&ReceivedEvent{Event: e})
+		}
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 4})
+
+	report := sm.GenerateReport()
+	want := map[string]PartitionKeyBalance{
+		"key-0": {SentCount: 3, ReceivedCount: 3, SentPercentage: 75, ReceivedPercentage: 100},
+		"key-1": {SentCount: 1, SentPercentage: 25},
+		"key-2": {},
+	}
+	if diff := cmp.Diff(want, report.PartitionBalance); diff != "" {
+		t.Errorf("(-want, +got) %s", diff)
+	}
+	if report.PartitionImbalance != 3 {
+		t.Errorf("want partition imbalance 3, got %v", report.PartitionImbalance)
+	}
+}
@@ -0,0 +1,51 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func (c *OrderedConfig) validateIndependentSenders(sender *SenderConfig) error {
+	if !c.IndependentSenders || sender.Disabled {
+		return nil
+	}
+	if sender.LoadProfile != nil {
+		return invalidErr("ordered.independentSenders", errors.New("cannot be used with sender.loadProfile"))
+	}
+	if sender.Replay != nil {
+		return invalidErr("ordered.independentSenders", errors.New("cannot be used with sender.replay"))
+	}
+	if sender.FrequencyPerSecond < int(c.NumPartitionKeys) {
+		return invalidErr("ordered.independentSenders", fmt.Errorf("sender.frequency %d must be at least the number of partition keys %d", sender.FrequencyPerSecond, c.NumPartitionKeys))
+	}
+	return nil
+}
+
+// partitionSenderAttacks returns an attack for each partition key, sending the events of the partition key in order.
+//
+// The frequency of the sender is split evenly across partition keys, and the pacing of the sender applies to each
+// partition key independently. Each attack sends one request at a time, so that events of the same partition key are
+// never in flight concurrently and the rate of each partition key is bounded by the latency of the target.
+func partitionSenderAttacks(config *Config, client *http.Client, control *senderControl, out chan<- ce.Event) []senderAttack {
+	keys := config.Ordered.partitionKeys()
+	newUUID := newUUIDGenerator(config.Seed)
+
+	attacks := make([]senderAttack, 0, len(keys))
+	for i, pk := range keys {
+		frequency := config.Sender.FrequencyPerSecond / len(keys)
+		if i < config.Sender.FrequencyPerSecond%len(keys) {
+			frequency++
+		}
+		pk := pk
+		attacks = append(attacks, senderAttack{
+			attacker: vegeta.NewAttacker(vegeta.Workers(1), vegeta.MaxWorkers(1), vegeta.Client(client)),
+			targeter: newTargeterGenerator(*config, newUUID, func() string { return pk }, out),
+			pacer:    senderPacer(config, frequency, control, newRand(config.Seed, "pacing."+pk)),
+		})
+	}
+	return attacks
+}
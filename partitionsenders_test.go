@@ -0,0 +1,108 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestStartSenderIndependentSenders(t *testing.T) {
+	var lock sync.Mutex
+	sequences := make(map[string][]uint64)
+	inFlight := make(map[string]int)
+	concurrent := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events, err := eventsFromRequest(r.Context(), r)
+		if err != nil || len(events) != 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		e := events[0]
+		pk := e.Extensions()[DefaultPartitionKeyExtension].(string)
+		seq, _ := strconv.ParseUint(e.Extensions()[SequenceExtension].(string), 10, 64)
+
+		lock.Lock()
+		inFlight[pk]++
+		concurrent = concurrent || inFlight[pk] > 1
+		sequences[pk] = append(sequences[pk], seq)
+		lock.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		lock.Lock()
+		inFlight[pk]--
+		lock.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	config := Config{
+		Sender: SenderConfig{
+			Target:             server.URL,
+			FrequencyPerSecond: 31,
+			Workers:            10,
+		},
+		Ordered:        &OrderedConfig{NumPartitionKeys: 3, IndependentSenders: true},
+		ParsedDuration: time.Second,
+	}
+	if err := config.Ordered.validateIndependentSenders(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan ce.Event, 100)
+	metrics := startSender(context.Background(), config, sent)
+	close(sent)
+
+	lock.Lock()
+	defer lock.Unlock()
+	if concurrent {
+		t.Error("want events of the same partition key never in flight concurrently")
+	}
+	total := 0
+	for _, pk := range config.Ordered.partitionKeys() {
+		seqs := sequences[pk]
+		// The first partition key gets the remainder of the frequency.
+		if len(seqs) < 9 || len(seqs) > 11 {
+			t.Errorf("want about 10 events for partition key %s, got %d", pk, len(seqs))
+		}
+		for i, seq := range seqs {
+			if seq != uint64(i+1) {
+				t.Errorf("want sequence %d at position %d for partition key %s, got %v", i+1, i, pk, seqs)
+				break
+			}
+		}
+		total += len(seqs)
+	}
+	if metrics.AcceptedCount != total || len(sent) != total {
+		t.Errorf("want %d accepted and sent events, got accepted %d, sent %d", total, metrics.AcceptedCount, len(sent))
+	}
+}
+
+func TestOrderedConfigValidateIndependentSenders(t *testing.T) {
+	tests := []struct {
+		name    string
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "valid", sender: SenderConfig{FrequencyPerSecond: 3}},
+		{name: "frequency lower than the number of partition keys", sender: SenderConfig{FrequencyPerSecond: 2}, wantErr: true},
+		{name: "load profile", sender: SenderConfig{FrequencyPerSecond: 3, LoadProfile: &LoadProfileConfig{}}, wantErr: true},
+		{name: "replay", sender: SenderConfig{Replay: &ReplayConfig{}}, wantErr: true},
+		{name: "sender disabled", sender: SenderConfig{Disabled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &OrderedConfig{NumPartitionKeys: 3, IndependentSenders: true}
+			if err := config.validateIndependentSenders(&tt.sender); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// SubjectAttribute is the partition key attribute with ordered.partitionBySubject, it is the subject context
+// attribute rather than an extension.
+const SubjectAttribute = "subject"
+
+func (c *OrderedConfig) validatePartitionBySubject(sender *SenderConfig) error {
+	if !c.PartitionBySubject {
+		return nil
+	}
+	if c.PartitionKeyExtension != "" && c.PartitionKeyExtension != DefaultPartitionKeyExtension {
+		return invalidErr("ordered.partitionBySubject", errors.New("cannot be used with ordered.partitionKeyExtension"))
+	}
+	if sender.Attributes != nil && sender.Attributes.Subject != "" {
+		return invalidErr("sender.attributes.subject", errors.New("cannot be used with ordered.partitionBySubject, the subject is the partition key"))
+	}
+	return nil
+}
+
+// partitionKeyAttribute returns the attribute carrying the partition key, either SubjectAttribute or the partition key
+// extension.
+func (c *OrderedConfig) partitionKeyAttribute() string {
+	if c.PartitionBySubject {
+		return SubjectAttribute
+	}
+	return c.partitionKeyExtension()
+}
+
+// eventPartitionKey returns the partition key of the given event carried by the given attribute, as returned by
+// partitionKeyAttribute.
+func eventPartitionKey(e *ce.Event, attribute string) (string, bool) {
+	if attribute == "" {
+		return "", false
+	}
+	if attribute == SubjectAttribute {
+		return e.Subject(), e.Subject() != ""
+	}
+	v, ok := e.Extensions()[attribute]
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprint(v), true
+}
+
+// setEventPartitionKey sets the partition key of the given event on the given attribute, as returned by
+// partitionKeyAttribute.
+func setEventPartitionKey(e *ce.Event, attribute, pk string) {
+	if attribute == SubjectAttribute {
+		e.SetSubject(pk)
+		return
+	}
+	e.SetExtension(attribute, pk)
+}
@@ -0,0 +1,98 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestOrderedConfigValidatePartitionBySubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		ordered OrderedConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "disabled", ordered: OrderedConfig{PartitionKeyExtension: "orderingkey"}, sender: SenderConfig{Attributes: &EventAttributesConfig{Subject: "orders"}}},
+		{name: "enabled", ordered: OrderedConfig{PartitionBySubject: true}},
+		{name: "default extension", ordered: OrderedConfig{PartitionBySubject: true, PartitionKeyExtension: DefaultPartitionKeyExtension}},
+		{name: "custom extension", ordered: OrderedConfig{PartitionBySubject: true, PartitionKeyExtension: "orderingkey"}, wantErr: true},
+		{name: "sender subject", ordered: OrderedConfig{PartitionBySubject: true}, sender: SenderConfig{Attributes: &EventAttributesConfig{Subject: "orders"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ordered.validatePartitionBySubject(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorPartitionBySubject(t *testing.T) {
+	config := Config{
+		Sender:  SenderConfig{Target: "http://localhost"},
+		Ordered: &OrderedConfig{NumPartitionKeys: 1, PartitionBySubject: true, PartitionKeyStrategy: PartitionKeyStrategyRoundRobin},
+	}
+	out := make(chan ce.Event, 1)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	if err := f(&vegeta.Target{}); err != nil {
+		t.Fatal(err)
+	}
+	e := <-out
+	if e.Subject() != "0" {
+		t.Errorf("want subject 0, got %q", e.Subject())
+	}
+	if _, ok := e.Extensions()[DefaultPartitionKeyExtension]; ok {
+		t.Errorf("want no partition key extension, got %v", e.Extensions())
+	}
+}
+
+func TestStateManagerPartitionBySubject(t *testing.T) {
+	config := Config{Ordered: &OrderedConfig{NumPartitionKeys: 2, PartitionBySubject: true}}
+	sm := newTestStateManager(t, config)
+
+	var sent []ce.Event
+	for _, id := range []string{"a-1", "a-2", "b-1"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetSubject(id[:1])
+		e.SetExtension(SequenceExtension, id[2:])
+		sent = append(sent, e)
+	}
+	sm.lock.Lock()
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	for _, i := range []int{1, 0, 2} {
+		sm.recordReceived(&ReceivedEvent{Event: sent[i]})
+	}
+	sm.lock.Unlock()
+	sm.Terminated(Metrics{AcceptedCount: 3})
+
+	report := sm.GenerateReport()
+	if len(report.ReceivedEventsByPartitionKey["a"]) != 2 || len(report.ReceivedEventsByPartitionKey["b"]) != 1 {
+		t.Errorf("want events keyed by subject, got %v", report.ReceivedEventsByPartitionKey)
+	}
+	if report.OrderingViolationCount != 1 || len(report.OrderingViolationsByPartitionKey["a"].Violations) != 1 {
+		t.Errorf("want 1 ordering violation for subject a, got %+v", report.OrderingViolationsByPartitionKey)
+	}
+}
+
+func TestNewKafkaRecordPartitionBySubject(t *testing.T) {
+	e := cetest.FullEvent()
+	e.SetSubject("tenant-7")
+	r, err := newKafkaRecord(&e, http.Header{}, SubjectAttribute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(r.Key) != "tenant-7" {
+		t.Errorf("want key tenant-7, got %q", r.Key)
+	}
+}
@@ -0,0 +1,168 @@
+package sacura
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"text/template"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	defaultPayloadContentType         = "text/plain"
+	defaultPayloadTemplateContentType = "application/json"
+
+	payloadAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
+
+type PayloadConfig struct {
+	// Size is the size in bytes of the data of each event.
+	Size int `json:"size" yaml:"size"`
+	// MinSize and MaxSize are the bounds of the random size in bytes of the data of each event.
+	MinSize int `json:"minSize" yaml:"minSize"`
+	MaxSize int `json:"maxSize" yaml:"maxSize"`
+	// SizeClasses are sizes in bytes, for example multi-megabyte sizes testing broker limits around message size,
+	// each event draws the size of its data among them. The report includes the latency of each size class.
+	SizeClasses []int `json:"sizeClasses" yaml:"sizeClasses"`
+	// Template is a Go template rendered as the data of each event, see PayloadTemplateData for the available
+	// variables.
+	Template string `json:"template" yaml:"template"`
+	// ContentType is the content type of the data.
+	//
+	// Defaults to text/plain for sized payloads and to application/json for templates.
+	ContentType string `json:"contentType" yaml:"contentType"`
+}
+
+// PayloadTemplateData are the variables available to payload templates.
+type PayloadTemplateData struct {
+	// Index is the index of the event, starting at 0.
+	Index uint64
+	// ID is the event ID.
+	ID string
+	// PartitionKey is the partition key of the event, it is empty when events are not ordered.
+	PartitionKey string
+	// Timestamp is the time at which the event has been generated.
+	Timestamp time.Time
+}
+
+func (c *PayloadConfig) validate() error {
+	modes := 0
+	if c.Size != 0 {
+		modes++
+	}
+	if c.MinSize != 0 || c.MaxSize != 0 {
+		modes++
+	}
+	if len(c.SizeClasses) > 0 {
+		modes++
+	}
+	if c.Template != "" {
+		modes++
+	}
+	if modes != 1 {
+		return invalidErr("sender.payload", errors.New("exactly one of size, minSize and maxSize, sizeClasses, or template must be specified"))
+	}
+
+	if c.Size < 0 {
+		return invalidErr("sender.payload.size", errors.New("cannot be negative"))
+	}
+	if c.MinSize < 0 || c.MaxSize < c.MinSize {
+		return invalidErr("sender.payload.maxSize", fmt.Errorf("must be greater than or equal to minSize %d", c.MinSize))
+	}
+	if c.Template != "" {
+		if _, err := c.template(); err != nil {
+			return invalidErr("sender.payload.template", err)
+		}
+	}
+
+	if c.ContentType == "" {
+		c.ContentType = defaultPayloadContentType
+		if c.Template != "" {
+			c.ContentType = defaultPayloadTemplateContentType
+		}
+	}
+	return nil
+}
+
+func (c *PayloadConfig) template() (*template.Template, error) {
+	return template.New("payload").Option("missingkey=error").Parse(c.Template)
+}
+
+// payloadGenerator generates event data according to a PayloadConfig.
+type payloadGenerator struct {
+	config      *PayloadConfig
+	contentType string
+	template    *template.Template
+	// filler is sliced to generate sized payloads without allocating random data for every event.
+	filler []byte
+	// rand draws the size of payloads between MinSize and MaxSize, or among the size classes.
+	rand *rand.Rand
+	// sizeClasses are the checksummed payloads of the size classes.
+	sizeClasses []sizeClassPayload
+}
+
+func newPayloadGenerator(config *PayloadConfig, r *rand.Rand) (*payloadGenerator, error) {
+	g := &payloadGenerator{config: config, contentType: config.ContentType, rand: r}
+	if g.contentType == "" {
+		g.contentType = defaultPayloadContentType
+		if config.Template != "" {
+			g.contentType = defaultPayloadTemplateContentType
+		}
+	}
+
+	if config.Template != "" {
+		t, err := config.template()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse payload template: %w", err)
+		}
+		g.template = t
+		return g, nil
+	}
+
+	size := config.Size
+	if config.MaxSize > size {
+		size = config.MaxSize
+	}
+	for _, s := range config.SizeClasses {
+		if s > size {
+			size = s
+		}
+	}
+	g.filler = make([]byte, size)
+	for i := range g.filler {
+		g.filler[i] = payloadAlphabet[r.Intn(len(payloadAlphabet))]
+	}
+	g.sizeClasses = newSizeClassPayloads(config.SizeClasses, g.filler)
+	return g, nil
+}
+
+// setData sets the data of the given event.
+func (g *payloadGenerator) setData(e *ce.Event, data PayloadTemplateData) error {
+	var payload []byte
+	switch {
+	case g.template != nil:
+		var b bytes.Buffer
+		if err := g.template.Execute(&b, data); err != nil {
+			return fmt.Errorf("failed to execute payload template for event %s: %w", data.ID, err)
+		}
+		payload = b.Bytes()
+	case len(g.sizeClasses) > 0:
+		p := g.sizeClasses[g.rand.Intn(len(g.sizeClasses))]
+		payload = g.filler[:p.size]
+		e.SetExtension(PayloadSizeExtension, strconv.Itoa(p.size))
+		e.SetExtension(ChecksumExtension, p.checksum)
+	case g.config.Size > 0:
+		payload = g.filler[:g.config.Size]
+	default:
+		payload = g.filler[:g.config.MinSize+g.rand.Intn(g.config.MaxSize-g.config.MinSize+1)]
+	}
+
+	e.SetDataContentType(g.contentType)
+	e.DataEncoded = payload
+	e.DataBase64 = false
+	return nil
+}
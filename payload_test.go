@@ -0,0 +1,139 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestPayloadConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		config          PayloadConfig
+		wantContentType string
+		wantErr         bool
+	}{
+		{
+			name:            "fixed size",
+			config:          PayloadConfig{Size: 1024},
+			wantContentType: "text/plain",
+		},
+		{
+			name:            "random size",
+			config:          PayloadConfig{MinSize: 1024, MaxSize: 1024 * 1024},
+			wantContentType: "text/plain",
+		},
+		{
+			name:            "template",
+			config:          PayloadConfig{Template: `{"index": {{.Index}}}`},
+			wantContentType: "application/json",
+		},
+		{
+			name:            "custom content type",
+			config:          PayloadConfig{Template: `{{.ID}}`, ContentType: "text/plain"},
+			wantContentType: "text/plain",
+		},
+		{
+			name:    "none",
+			config:  PayloadConfig{},
+			wantErr: true,
+		},
+		{
+			name:    "size and template",
+			config:  PayloadConfig{Size: 10, Template: `{{.ID}}`},
+			wantErr: true,
+		},
+		{
+			name:    "max size less than min size",
+			config:  PayloadConfig{MinSize: 10, MaxSize: 5},
+			wantErr: true,
+		},
+		{
+			name:    "invalid template",
+			config:  PayloadConfig{Template: `{{.ID`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ContentType != tt.wantContentType {
+				t.Errorf("expected content type %s, got %s", tt.wantContentType, tt.config.ContentType)
+			}
+		})
+	}
+}
+
+func TestPayloadGenerator(t *testing.T) {
+
+	data := PayloadTemplateData{Index: 3, ID: "abc", PartitionKey: "1", Timestamp: time.UnixMilli(1000)}
+
+	tests := []struct {
+		name     string
+		config   PayloadConfig
+		wantData string
+		minSize  int
+		maxSize  int
+	}{
+		{
+			name:    "fixed size",
+			config:  PayloadConfig{Size: 1024},
+			minSize: 1024,
+			maxSize: 1024,
+		},
+		{
+			name:    "random size",
+			config:  PayloadConfig{MinSize: 10, MaxSize: 20},
+			minSize: 10,
+			maxSize: 20,
+		},
+		{
+			name:    "size classes",
+			config:  PayloadConfig{SizeClasses: []int{4096, 1024}},
+			minSize: 1024,
+			maxSize: 4096,
+		},
+		{
+			name:     "template",
+			config:   PayloadConfig{Template: `{"index":{{.Index}},"id":"{{.ID}}","pk":"{{.PartitionKey}}","ts":{{.Timestamp.UnixMilli}}}`},
+			wantData: `{"index":3,"id":"abc","pk":"1","ts":1000}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			g, err := newPayloadGenerator(&tt.config, newRand(nil, "payload"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 10; i++ {
+				e := cetest.FullEvent()
+				if err := g.setData(&e, data); err != nil {
+					t.Fatal(err)
+				}
+				if e.DataContentType() != tt.config.ContentType {
+					t.Errorf("expected content type %s, got %s", tt.config.ContentType, e.DataContentType())
+				}
+				if tt.wantData != "" && string(e.Data()) != tt.wantData {
+					t.Errorf("expected data %s, got %s", tt.wantData, string(e.Data()))
+				}
+				if tt.wantData == "" && (len(e.Data()) < tt.minSize || len(e.Data()) > tt.maxSize) {
+					t.Errorf("expected data size between %d and %d, got %d", tt.minSize, tt.maxSize, len(e.Data()))
+				}
+				if _, err := e.MarshalJSON(); err != nil {
+					t.Errorf("failed to marshal event: %v", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package sacura
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/go-redis/redis/v8"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	journalEntrySent     = "sent"
+	journalEntryReceived = "received"
+	// journalEntryWriteError records entries of an instance that couldn't be appended to state.redis.
+	journalEntryWriteError = "writeError"
+
+	// journalOpenTimeout is the maximum time to wait for the lock of a journal opened by another process.
+	journalOpenTimeout = 10 * time.Second
+)
+
+var (
+	// journalBucket holds the JSON journal entries keyed by their big-endian sequence number, in append order.
+	journalBucket = []byte("journal")
+	// journalMetaBucket holds the number of entries that couldn't be written under journalFailedKey, so that the
+	// report of a restarted run accounts for them.
+	journalMetaBucket = []byte("meta")
+	journalFailedKey  = []byte("failedEntries")
+)
+
+func (c *StateConfig) validate(config *Config) error {
+	if c.Redis == nil {
+		if c.Path == "" {
+			return invalidErr("state.path", errors.New("path cannot be empty"))
+		}
+		return nil
+	}
+	if c.Path != "" {
+		return invalidErr("state.redis", errors.New("cannot be used with state.path"))
+	}
+	if config.Distributed != nil {
+		return invalidErr("state.redis", errors.New("cannot be used in distributed mode"))
+	}
+	return c.Redis.validate()
+}
+
+// journalEntry is a single entry of the state journal.
+type journalEntry struct {
+	Kind           string      `json:"kind"`
+	Event          ce.Event    `json:"event"`
+	ReceivedAt     time.Time   `json:"receivedAt,omitempty"`
+	Nacked         bool        `json:"nacked,omitempty"`
+	DeadLettered   bool        `json:"deadLettered,omitempty"`
+	Sink           string      `json:"sink,omitempty"`
+	Endpoint       string      `json:"endpoint,omitempty"`
+	ContentMode    ContentMode `json:"contentMode,omitempty"`
+	Replica        string      `json:"replica,omitempty"`
+	Compressed     bool        `json:"compressed,omitempty"`
+	Mangled        bool        `json:"mangled,omitempty"`
+	DataChecksum   string      `json:"dataChecksum,omitempty"`
+	ContentType    string      `json:"contentType,omitempty"`
+	DeliverySource string      `json:"deliverySource,omitempty"`
+	Suppressed     bool        `json:"suppressed,omitempty"`
+}
+
+// journalWriteError is the entry of the shared state recording entries that couldn't be appended to it, so that every
+// instance reports the shared state as incomplete.
+type journalWriteError struct {
+	Kind  string `json:"kind"`
+	Count int    `json:"count"`
+	Error string `json:"error"`
+}
+
+// stateJournal is an append-only journal of sent and received events stored in a bbolt database, each batch of
+// events is written in a single transaction.
+type stateJournal struct {
+	// lock serializes appends, which happen outside the lock of the StateManager so that I/O doesn't block recording
+	// events.
+	lock sync.Mutex
+	db   *bolt.DB
+	// pending are the encoded entries not written yet.
+	pending [][]byte
+
+	// redis replaces the database with state.redis.
+	redis    *redis.Client
+	redisKey string
+
+	// failedCount is the number of entries that couldn't be written, including the ones of previous runs, and
+	// failedErr is the last write error.
+	failedCount int
+	failedErr   error
+}
+
+// OpenStateManager creates a StateManager that persists sent and received events to config.State.Path.
+//
+// Events journaled by a previous run are replayed, so that the final report includes events observed before a
+// restart. When persistence is disabled, it is equivalent to NewStateManager.
+//
+// It also opens the event log of config.Report.EventLog, when enabled.
+func OpenStateManager(config Config) (*StateManager, error) {
+	sm, err := NewStateManager(config)
+	if err != nil {
+		return nil, err
+	}
+	if config.Report.EventLog != nil {
+		l, err := openEventLog(config.Report.EventLog)
+		if err != nil {
+			return nil, err
+		}
+		sm.eventLog = l
+	}
+	if err := sm.loadOrderCheckpoint(); err != nil {
+		sm.closeEventLog()
+		return nil, err
+	}
+	if config.State == nil {
+		return sm, nil
+	}
+	if config.State.Redis != nil {
+		// The shared state includes the events of other instances, it is replayed for the final report only.
+		j, err := openRedisJournal(context.Background(), config.State.Redis)
+		if err != nil {
+			sm.closeEventLog()
+			return nil, fmt.Errorf("failed to open shared state: %w", err)
+		}
+		sm.journal = j
+		return sm, nil
+	}
+
+	db, err := bolt.Open(config.State.Path, 0o644, &bolt.Options{Timeout: journalOpenTimeout})
+	if err != nil {
+		sm.closeEventLog()
+		return nil, fmt.Errorf("failed to open state journal: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{journalBucket, journalMetaBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		sm.closeEventLog()
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to initialize state journal %s: %w", config.State.Path, err)
+	}
+
+	sent, received, failed, err := sm.replayDB(db)
+	if err != nil {
+		sm.closeEventLog()
+		_ = db.Close()
+		return nil, fmt.Errorf("failed to replay state journal %s: %w", config.State.Path, err)
+	}
+	if sent > 0 || received > 0 {
+		logger(LogComponentState).Infow("Replayed state journal", "sent", sent, "received", received, "path", config.State.Path)
+	}
+	if failed > 0 {
+		logger(LogComponentState).Warnw("State journal is missing entries that couldn't be written", "entries", failed, "path", config.State.Path)
+	}
+
+	sm.journal = &stateJournal{db: db, failedCount: failed}
+	sm.replayedSentCount = sent
+	return sm, nil
+}
+
+// replayDB replays the entries of the given journal database and returns the number of entries previous runs failed
+// to write.
+func (s *StateManager) replayDB(db *bolt.DB) (sent int, received int, failed int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(journalMetaBucket); meta != nil {
+			if v := meta.Get(journalFailedKey); len(v) == 8 {
+				failed = int(binary.BigEndian.Uint64(v))
+			}
+		}
+		b := tx.Bucket(journalBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			entry := journalEntry{}
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return fmt.Errorf("invalid entry %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			n, m, err := s.replayEntry(&entry)
+			if err != nil {
+				return fmt.Errorf("entry %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			sent += n
+			received += m
+			return nil
+		})
+	})
+	return sent, received, failed, err
+}
+
+// replayEntries records the JSON lines entries of the given reader, like the entries of state.redis, and returns the
+// offset after the last complete entry, it must be called while holding the lock.
+func (s *StateManager) replayEntries(reader *bufio.Reader) (sent int, received int, offset int64, err error) {
+	for {
+		line, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// A partial trailing line is the result of a crash while writing it, it is discarded.
+			if len(line) > 0 {
+				logger(LogComponentState).Warnw("Discarding partial state journal entry", "offset", offset)
+			}
+			break
+		}
+		if err != nil {
+			return sent, received, offset, err
+		}
+
+		entry := journalEntry{}
+		if err := json.Unmarshal(line, &entry); err != nil {
+			return sent, received, offset, fmt.Errorf("invalid entry at offset %d: %w", offset, err)
+		}
+		if entry.Kind == journalEntryWriteError {
+			writeError := journalWriteError{}
+			if err := json.Unmarshal(line, &writeError); err != nil {
+				return sent, received, offset, fmt.Errorf("invalid entry at offset %d: %w", offset, err)
+			}
+			s.stateWriteErrorCount += writeError.Count
+			s.stateWriteError = writeError.Error
+			offset += int64(len(line))
+			continue
+		}
+		n, m, err := s.replayEntry(&entry)
+		if err != nil {
+			return sent, received, offset, fmt.Errorf("%w at offset %d", err, offset)
+		}
+		sent += n
+		received += m
+		offset += int64(len(line))
+	}
+	return sent, received, offset, nil
+}
+
+// replayEntry records the given entry and returns the number of sent and received events it accounts for, it must be
+// called while holding the lock.
+func (s *StateManager) replayEntry(entry *journalEntry) (sent int, received int, err error) {
+	switch entry.Kind {
+	case journalEntrySent:
+		s.recordSent(&entry.Event)
+		// Replayed events are added to the accepted count, which doesn't include the warmup.
+		if !isWarmupEvent(&entry.Event) {
+			return 1, 0, nil
+		}
+		return 0, 0, nil
+	case journalEntryReceived:
+		s.recordReceived(&ReceivedEvent{Event: entry.Event, ReceivedAt: entry.ReceivedAt, Nacked: entry.Nacked, DeadLettered: entry.DeadLettered, Sink: entry.Sink, Endpoint: entry.Endpoint, ContentMode: entry.ContentMode, Replica: entry.Replica, Compressed: entry.Compressed, Mangled: entry.Mangled, DataChecksum: entry.DataChecksum, ContentType: entry.ContentType, DeliverySource: entry.DeliverySource, Suppressed: entry.Suppressed})
+		return 0, 1, nil
+	default:
+		return 0, 0, fmt.Errorf("unknown entry kind %q", entry.Kind)
+	}
+}
+
+// journalWriter returns the journal and registers a pending append, which must be done with journalSent and
+// journalReceived after releasing the lock, it returns nil when persistence is disabled. It must be called while
+// holding the lock.
+func (s *StateManager) journalWriter() *stateJournal {
+	if s.journal != nil {
+		s.journalAppends.Add(1)
+	}
+	return s.journal
+}
+
+// journalSent appends the given sent events to the given journal returned by journalWriter.
+func (s *StateManager) journalSent(j *stateJournal, events []ce.Event) {
+	if j == nil {
+		return
+	}
+	defer s.journalAppends.Done()
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for i := range events {
+		j.append(journalEntry{Kind: journalEntrySent, Event: events[i]})
+	}
+	j.flush()
+}
+
+// journalReceived appends the given received events to the given journal returned by journalWriter.
+func (s *StateManager) journalReceived(j *stateJournal, events []*ReceivedEvent) {
+	if j == nil {
+		return
+	}
+	defer s.journalAppends.Done()
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for _, e := range events {
+		j.append(journalEntry{Kind: journalEntryReceived, Event: e.Event, ReceivedAt: e.ReceivedAt, Nacked: e.Nacked, DeadLettered: e.DeadLettered, Sink: e.Sink, Endpoint: e.Endpoint, ContentMode: e.ContentMode, Replica: e.Replica, Compressed: e.Compressed, Mangled: e.Mangled, DataChecksum: e.DataChecksum, ContentType: e.ContentType, DeliverySource: e.DeliverySource, Suppressed: e.Suppressed})
+	}
+	j.flush()
+}
+
+// append encodes the given entry, it must be called while holding the lock of the journal.
+func (j *stateJournal) append(entry journalEntry) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		j.failed(1, err)
+		return
+	}
+	j.pending = append(j.pending, b)
+}
+
+// flush writes the pending entries, it must be called while holding the lock of the journal.
+func (j *stateJournal) flush() {
+	if len(j.pending) == 0 {
+		return
+	}
+	defer func() { j.pending = j.pending[:0] }()
+
+	if j.redis != nil {
+		if err := j.redis.RPush(context.Background(), j.redisKey, redisStrings(j.pending)...).Err(); err != nil {
+			j.failed(len(j.pending), fmt.Errorf("failed to write shared state %s: %w", j.redisKey, err))
+		}
+		return
+	}
+	err := j.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(journalBucket)
+		for _, entry := range j.pending {
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err := b.Put(key, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		j.failed(len(j.pending), fmt.Errorf("failed to write state journal: %w", err))
+	}
+}
+
+// failed records that the given number of entries couldn't be written, it must be called while holding the lock of
+// the journal.
+//
+// The number of entries is also stored in the journal, when possible, so that a restarted run, or another instance
+// sharing state.redis, doesn't report the events it is missing as lost, or as unexpected, without signaling that its
+// state is incomplete.
+func (j *stateJournal) failed(n int, err error) {
+	j.failedCount += n
+	j.failedErr = err
+	logger(LogComponentState).Errorw("Failed to journal events, the report is incomplete", "entries", n, "error", err)
+
+	if j.redis != nil {
+		b, err := json.Marshal(journalWriteError{Kind: journalEntryWriteError, Count: n, Error: err.Error()})
+		if err == nil {
+			err = j.redis.RPush(context.Background(), j.redisKey, string(b)).Err()
+		}
+		if err != nil {
+			logger(LogComponentState).Errorw("Failed to record the shared state entries that couldn't be written", "key", j.redisKey, "error", err)
+		}
+		return
+	}
+	err = j.db.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(j.failedCount))
+		return tx.Bucket(journalMetaBucket).Put(journalFailedKey, v)
+	})
+	if err != nil {
+		logger(LogComponentState).Errorw("Failed to record the journal entries that couldn't be written", "error", err)
+	}
+}
+
+// writeErrors returns the number of entries that couldn't be written and the last write error.
+func (j *stateJournal) writeErrors() (int, string) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.failedErr == nil {
+		return j.failedCount, ""
+	}
+	return j.failedCount, j.failedErr.Error()
+}
+
+func (j *stateJournal) close() error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	if j.redis != nil {
+		return j.redis.Close()
+	}
+	return j.db.Close()
+}
+
+// Verify verifies the events of the given state journals against the given config and returns the final report, like
+// Run does.
+//
+// It verifies runs where the sender and the receiver are separate instances, for example in different clusters: the
+// sender runs with receiver.disabled, the receiver with sender.disabled, both with state.path, and their journals are
+// verified together once both runs terminated. Only the events journaled by the sender are accounted for as accepted.
+//
+// Files in the interchange format, for example written by report.interchange or by other tools, are verified like
+// journals.
+//
+// Without journals, it verifies the events of the shared state of state.redis.
+func Verify(config Config, journals ...string) (Report, error) {
+	if err := config.validate(); err != nil {
+		return Report{}, err
+	}
+	shared := config.State != nil && config.State.Redis != nil
+	if len(journals) == 0 && !shared {
+		return Report{}, errors.New("no state journals to verify")
+	}
+	if err := configureLogging(config.Logging); err != nil {
+		return Report{}, err
+	}
+	// Both the sender and the receiver were enabled, in separate runs.
+	config.Sender.Disabled = false
+	config.Receiver.Disabled = false
+	if err := resolveSerialization(context.Background(), &config); err != nil {
+		return Report{}, err
+	}
+	if len(journals) == 0 {
+		report, err := sharedReport(context.Background(), config, Metrics{})
+		if err != nil {
+			return Report{}, err
+		}
+		logReport(config.Report, report)
+		err = verifyAndWriteReports(config, &report)
+		return report, err
+	}
+	config.State = nil
+
+	sm, err := NewStateManager(config)
+	if err != nil {
+		return Report{}, err
+	}
+	accepted := 0
+	for _, path := range journals {
+		sent, received, err := sm.replayJournal(path)
+		if err != nil {
+			return Report{}, fmt.Errorf("failed to replay state journal %s: %w", path, err)
+		}
+		logger(LogComponentState).Infow("Replayed state journal", "sent", sent, "received", received, "path", path)
+		accepted += sent
+	}
+
+	sm.Terminated(Metrics{ProposedCount: accepted, AcceptedCount: accepted})
+	report := sm.GenerateReport()
+	logReport(config.Report, report)
+
+	err = verifyAndWriteReports(config, &report)
+	return report, err
+}
+
+// replayJournal replays the journal or the interchange file at the given path without modifying it.
+func (s *StateManager) replayJournal(path string) (int, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	// Interchange files start with a JSON header.
+	if first, err := r.Peek(1); err != nil || first[0] == '{' {
+		return s.Import(r)
+	}
+
+	db, err := bolt.Open(path, 0, &bolt.Options{ReadOnly: true, Timeout: journalOpenTimeout})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer db.Close()
+
+	sent, received, failed, err := s.replayDB(db)
+	if failed > 0 {
+		s.lock.Lock()
+		s.stateWriteErrorCount += failed
+		s.lock.Unlock()
+	}
+	return sent, received, err
+}
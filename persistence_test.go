@@ -0,0 +1,223 @@
+package sacura
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestOpenStateManagerReplay(t *testing.T) {
+
+	config := Config{State: &StateConfig{Path: filepath.Join(t.TempDir(), "state.db")}}
+
+	run := func(t *testing.T, sentIDs, receivedIDs []string) *StateManager {
+		sm, err := OpenStateManager(config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sent := make(chan ce.Event, len(sentIDs))
+		received := make(chan ReceivedEvent, len(receivedIDs))
+		receivedSignal := sm.ReadReceived(received)
+		sentSignal := sm.ReadSent(sent)
+
+		for _, id := range sentIDs {
+			e := cetest.FullEvent()
+			e.SetID(id)
+			sent <- e
+		}
+		for _, id := range receivedIDs {
+			e := cetest.FullEvent()
+			e.SetID(id)
+			received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+		}
+		close(sent)
+		close(received)
+		<-sentSignal
+		<-receivedSignal
+		return sm
+	}
+
+	// The first run crashes before termination, "2" and "3" are received by the second run.
+	crashed := run(t, []string{"1", "2"}, []string{"1"})
+	if err := crashed.journal.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sm := run(t, []string{"3", "4"}, []string{"2", "3"})
+	sm.Terminated(Metrics{ProposedCount: 2, AcceptedCount: 2})
+	report := sm.GenerateReport()
+
+	if report.Metrics.AcceptedCount != 4 {
+		t.Errorf("expected accepted count 4, got %d", report.Metrics.AcceptedCount)
+	}
+	if report.ReceivedCount != 3 {
+		t.Errorf("expected received count 3, got %d", report.ReceivedCount)
+	}
+	if got := fmt.Sprint(report.LostEventsByPartitionKey[unknownPartitionKey]); report.LostCount != 1 || got != "[4]" {
+		t.Errorf("expected event 4 to be lost, got %s", got)
+	}
+}
+
+func TestOpenStateManagerInvalidJournal(t *testing.T) {
+
+	dir := t.TempDir()
+
+	unknown := filepath.Join(dir, "unknown.db")
+	db, err := bolt.Open(unknown, 0o644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket(journalBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put(make([]byte, 8), []byte(`{"kind":"unknown"}`))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	notDB := filepath.Join(dir, "state.jsonl")
+	if err := os.WriteFile(notDB, []byte("{\"kind\":\"sent\"}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{unknown, notDB} {
+		if _, err := OpenStateManager(Config{State: &StateConfig{Path: path}}); err == nil {
+			t.Errorf("expected error opening %s", path)
+		}
+	}
+}
+
+func TestStateJournalWriteErrors(t *testing.T) {
+
+	config := Config{
+		Sender:            SenderConfig{Disabled: true},
+		DeliveryGuarantee: AtLeastOnce,
+		State:             &StateConfig{Path: filepath.Join(t.TempDir(), "state.db")},
+	}
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Writes fail once the database is closed.
+	if err := sm.journal.db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan ce.Event, 2)
+	sentSignal := sm.ReadSent(sent)
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	close(sent)
+	<-sentSignal
+	sm.Terminated(Metrics{ProposedCount: 2, AcceptedCount: 2})
+	report := sm.GenerateReport()
+
+	if report.StateWriteErrorCount != 2 || report.StateWriteError == "" {
+		t.Errorf("expected 2 state write errors, got %d: %q", report.StateWriteErrorCount, report.StateWriteError)
+	}
+	err = verify(config, report)
+	if diff := cmp.Diff([]VerdictReason{VerdictReasonStateWriteFailed}, failureReasons(report, err)); diff != "" {
+		t.Error("unexpected failure reasons (-want, +got)", diff)
+	}
+
+	// Restarted runs account for the entries recorded as missing.
+	db, err := bolt.Open(config.State.Path, 0o644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, 3)
+		return tx.Bucket(journalMetaBucket).Put(journalFailedKey, v)
+	})
+	_ = db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted.Terminated(Metrics{})
+	if got := restarted.GenerateReport().StateWriteErrorCount; got != 3 {
+		t.Errorf("expected 3 state write errors after a restart, got %d", got)
+	}
+}
+
+func TestVerifyJournals(t *testing.T) {
+
+	dir := t.TempDir()
+
+	journal := func(t *testing.T, name string, sentIDs, receivedIDs []string) string {
+		path := filepath.Join(dir, name)
+		sm, err := OpenStateManager(Config{State: &StateConfig{Path: path}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		sent := make(chan ce.Event, len(sentIDs))
+		received := make(chan ReceivedEvent, len(receivedIDs))
+		receivedSignal := sm.ReadReceived(received)
+		sentSignal := sm.ReadSent(sent)
+		for _, id := range sentIDs {
+			e := cetest.FullEvent()
+			e.SetID(id)
+			sent <- e
+		}
+		for _, id := range receivedIDs {
+			e := cetest.FullEvent()
+			e.SetID(id)
+			received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+		}
+		close(sent)
+		close(received)
+		<-sentSignal
+		<-receivedSignal
+		sm.Terminated(Metrics{})
+		return path
+	}
+
+	sender := journal(t, "sender.db", []string{"1", "2", "3"}, nil)
+	receiver := journal(t, "receiver.db", nil, []string{"3", "1", "2", "2"})
+	partialReceiver := journal(t, "partial-receiver.db", nil, []string{"1"})
+
+	config := func() Config {
+		return Config{
+			Sender:            SenderConfig{Target: "http://localhost:8080", FrequencyPerSecond: 10, Workers: 1, Disabled: true},
+			Receiver:          ReceiverConfig{Port: 8080, Timeout: "1m"},
+			DeliveryGuarantee: AtLeastOnce,
+			Duration:          "1m",
+		}
+	}
+
+	report, err := Verify(config(), sender, receiver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Metrics.AcceptedCount != 3 || report.ReceivedCount != 3 || report.DuplicateCount != 1 {
+		t.Errorf("expected 3 accepted and received events and 1 duplicate, got %d, %d and %d", report.Metrics.AcceptedCount, report.ReceivedCount, report.DuplicateCount)
+	}
+
+	if _, err := Verify(config(), sender, partialReceiver); err == nil {
+		t.Error("expected error for lost events")
+	}
+	if _, err := Verify(config(), filepath.Join(dir, "missing.db")); err == nil {
+		t.Error("expected error for missing journal")
+	}
+}
@@ -0,0 +1,184 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// DefaultPreviewRequests is the default number of requests previewed by Preview.
+const DefaultPreviewRequests = 10
+
+// TrafficPreview is the traffic a config would generate, see Preview.
+type TrafficPreview struct {
+	// Requests are the first requests in send order.
+	Requests []RequestPreview `json:"requests"`
+	// Schedule is the target send rate over the duration of the test, or over the previewed requests when the
+	// duration is unknown, for example with sender.eventCount.
+	Schedule []ScheduleSample `json:"schedule"`
+}
+
+// RequestPreview is a request that would be sent.
+type RequestPreview struct {
+	// Offset is the time since the start of the test at which the request would be sent according to the pacing.
+	Offset   time.Duration  `json:"offset"`
+	URL      string         `json:"url"`
+	BodySize int            `json:"bodySize"`
+	Events   []EventPreview `json:"events"`
+}
+
+// EventPreview is an event that would be sent.
+type EventPreview struct {
+	ID           string `json:"id"`
+	PartitionKey string `json:"partitionKey,omitempty"`
+	// Attributes are the context attributes and extensions of the event.
+	Attributes map[string]string `json:"attributes"`
+	// DataSize is the size of the data of the event.
+	DataSize int `json:"dataSize"`
+}
+
+// ScheduleSample is the target send rate, in requests per second, of an interval starting at Offset.
+type ScheduleSample struct {
+	Offset time.Duration `json:"offset"`
+	Rate   float64       `json:"rate"`
+}
+
+// Preview returns the first requests the given validated config would send and its pacing schedule, without sending
+// anything, so that configs can be reviewed before expensive runs.
+//
+// Requests aren't authenticated and the data of events isn't serialized with serialization, since both need
+// external services.
+func Preview(config Config, requests int) (TrafficPreview, error) {
+	if requests <= 0 {
+		return TrafficPreview{}, fmt.Errorf("the number of requests %d must be greater than 0", requests)
+	}
+	if config.Sender.Disabled {
+		return TrafficPreview{}, errors.New("the sender is disabled")
+	}
+	config.Sender.Auth = nil
+	if rotation := config.Sender.IdentityRotation; rotation != nil {
+		identities := make([]SenderIdentityConfig, len(rotation.Identities))
+		for i, identity := range rotation.Identities {
+			identity.Auth = nil
+			identities[i] = identity
+		}
+		config.Sender.IdentityRotation = &IdentityRotationConfig{Identities: identities, ParsedInterval: rotation.ParsedInterval}
+	}
+	config.Serialization = nil
+
+	batchSize := config.Sender.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	out := make(chan ce.Event, batchSize)
+	var attacks []senderAttack
+	if config.Ordered != nil && config.Ordered.IndependentSenders {
+		attacks = partitionSenderAttacks(&config, http.DefaultClient, nil, out)
+	} else {
+		attacks = []senderAttack{{
+			targeter: NewTargeterGenerator(config, newUUIDGenerator(config.Seed), out),
+			pacer:    senderPacer(&config, config.Sender.FrequencyPerSecond, nil, newRand(config.Seed, "pacing")),
+		}}
+	}
+
+	preview := TrafficPreview{}
+	schedules := make([]*pacingSchedule, len(attacks))
+	for i := range attacks {
+		schedules[i] = &pacingSchedule{pacer: attacks[i].pacer, duration: config.ParsedDuration}
+	}
+	for len(preview.Requests) < requests {
+		// Requests of independent senders are sent in the order of their pacing.
+		next := -1
+		for i, s := range schedules {
+			if s.next() && (next < 0 || s.offset < schedules[next].offset) {
+				next = i
+			}
+		}
+		if next < 0 {
+			break
+		}
+		target := vegeta.Target{}
+		if err := attacks[next].targeter(&target); err != nil {
+			if errors.Is(err, errReplayed) {
+				break
+			}
+			return preview, fmt.Errorf("failed to generate request %d: %w", len(preview.Requests), err)
+		}
+		request := RequestPreview{Offset: schedules[next].offset, URL: target.URL, BodySize: len(target.Body)}
+	events:
+		for {
+			select {
+			case e := <-out:
+				event := EventPreview{ID: e.ID(), Attributes: eventAttributes(&e, nil), DataSize: len(e.Data())}
+				if config.Ordered != nil {
+					event.PartitionKey, _ = eventPartitionKey(&e, config.Ordered.partitionKeyAttribute())
+				}
+				request.Events = append(request.Events, event)
+			default:
+				break events
+			}
+		}
+		preview.Requests = append(preview.Requests, request)
+		schedules[next].hits++
+	}
+
+	duration := config.ParsedDuration
+	if duration <= 0 && len(preview.Requests) > 0 {
+		duration = preview.Requests[len(preview.Requests)-1].Offset.Truncate(time.Second) + time.Second
+	}
+	preview.Schedule = pacingScheduleSamples(attacks, duration)
+	return preview, nil
+}
+
+// pacingSchedule simulates the pacing of requests.
+type pacingSchedule struct {
+	pacer    vegeta.Pacer
+	duration time.Duration
+	hits     uint64
+	// offset is the offset of the next request.
+	offset time.Duration
+	done   bool
+}
+
+// next computes the offset of the next request, it returns false when no more requests are sent.
+func (s *pacingSchedule) next() bool {
+	for !s.done {
+		wait, stop := s.pacer.Pace(s.offset, s.hits)
+		if stop || (s.duration > 0 && s.offset >= s.duration) {
+			s.done = true
+			break
+		}
+		if wait <= 0 {
+			return true
+		}
+		s.offset += wait
+	}
+	return false
+}
+
+// pacingScheduleSamples returns the target send rate of the given attacks over the given duration.
+func pacingScheduleSamples(attacks []senderAttack, duration time.Duration) []ScheduleSample {
+	seconds := int((duration + time.Second - 1) / time.Second)
+	interval := 1
+	if seconds >= maxTimelineSamples {
+		interval = seconds/maxTimelineSamples + 1
+	}
+	samples := make([]ScheduleSample, 0, (seconds+interval-1)/interval)
+	for i := 0; i < seconds; i += interval {
+		sample := ScheduleSample{Offset: time.Duration(i) * time.Second}
+		n := 0
+		for s := i; s < i+interval && s < seconds; s++ {
+			for _, a := range attacks {
+				sample.Rate += a.pacer.Rate(time.Duration(s)*time.Second + time.Second/2)
+			}
+			n++
+		}
+		sample.Rate /= float64(n)
+		samples = append(samples, sample)
+	}
+	return samples
+}
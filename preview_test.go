@@ -0,0 +1,98 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPreview(t *testing.T) {
+	config, err := FileConfig(strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 10
+  workers: 1
+  batchSize: 2
+receiver:
+  port: 8080
+  timeout: 1m
+ordered:
+  numPartitionKeys: 2
+duration: 3s
+timeout: 1m
+seed: 42
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := Preview(config, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Requests) != 5 {
+		t.Fatalf("want 5 requests, got %d", len(preview.Requests))
+	}
+	for i, r := range preview.Requests {
+		if want := time.Duration(i+1) * 100 * time.Millisecond; r.Offset != want {
+			t.Errorf("request %d: want offset %v, got %v", i, want, r.Offset)
+		}
+		if r.URL != "http://localhost:8080" || r.BodySize == 0 || len(r.Events) != 2 {
+			t.Errorf("request %d: want a batch of 2 events to the target, got %+v", i, r)
+		}
+		for _, e := range r.Events {
+			if e.ID == "" || e.DataSize == 0 || (e.PartitionKey != "0" && e.PartitionKey != "1") || e.Attributes["type"] == "" {
+				t.Errorf("request %d: unexpected event %+v", i, e)
+			}
+		}
+	}
+
+	if len(preview.Schedule) != 3 {
+		t.Fatalf("want a sample per second, got %+v", preview.Schedule)
+	}
+	for i, s := range preview.Schedule {
+		if s.Offset != time.Duration(i)*time.Second || s.Rate != 10 {
+			t.Errorf("sample %d: want a rate of 10, got %+v", i, s)
+		}
+	}
+
+	again, err := Preview(config, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Requests[0].Events[0].ID != preview.Requests[0].Events[0].ID {
+		t.Errorf("want the same events with a seed, got %s and %s", preview.Requests[0].Events[0].ID, again.Requests[0].Events[0].ID)
+	}
+}
+
+func TestPreviewEventCount(t *testing.T) {
+	config, err := FileConfig(strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 100
+  workers: 1
+  eventCount: 3
+receiver:
+  port: 8080
+  timeout: 1m
+timeout: 1m
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	preview, err := Preview(config, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(preview.Requests) != 3 {
+		t.Errorf("want the 3 requests of the event count, got %d", len(preview.Requests))
+	}
+	if len(preview.Schedule) != 1 {
+		t.Errorf("want the schedule of the previewed requests, got %+v", preview.Schedule)
+	}
+
+	if _, err := Preview(config, 0); err == nil {
+		t.Error("expected an error without requests")
+	}
+}
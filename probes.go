@@ -0,0 +1,113 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	// HealthzPath is the path of the liveness probe of the receiver, it responds 200 once the receiver is started.
+	HealthzPath = "/healthz"
+	// ReadyzPath is the path of the readiness probe of the receiver, it responds 200 once the receiver is listening or
+	// subscribed and 503 before.
+	ReadyzPath = "/readyz"
+)
+
+// ReceiverProbesConfig serves the HealthzPath and ReadyzPath probes on a dedicated port, so that deployments of
+// receivers can gate the start of senders on the readiness of receivers.
+//
+// With HTTP and gRPC, probes are also served on the receiver port.
+type ReceiverProbesConfig struct {
+	// Port is the port the probes are served on.
+	Port int `json:"port" yaml:"port"`
+}
+
+func (c *ReceiverProbesConfig) validate(receiver *ReceiverConfig) error {
+	if c.Port <= 0 {
+		return invalidErr("receiver.probes.port", errors.New("port must be greater than 0"))
+	}
+	if c.Port == receiver.Port && (receiver.Protocol == "" || receiver.Protocol == ProtocolHTTP || receiver.Protocol == ProtocolGRPC) {
+		return invalidErr("receiver.probes.port", fmt.Errorf("port %d is the receiver port, probes are already served on it", c.Port))
+	}
+	return nil
+}
+
+// receiverProbes tracks the readiness of the receiver.
+type receiverProbes struct {
+	ready *atomic.Bool
+	// onReady is called the first time the receiver is ready, it is nil when there is nothing to notify.
+	onReady   func()
+	readyOnce sync.Once
+}
+
+func newReceiverProbes() *receiverProbes {
+	return &receiverProbes{ready: atomic.NewBool(false)}
+}
+
+type receiverProbesKey struct{}
+
+func contextWithReceiverProbes(ctx context.Context, p *receiverProbes) context.Context {
+	return context.WithValue(ctx, receiverProbesKey{}, p)
+}
+
+// receiverProbesFromContext returns the probes of the receiver, or nil.
+func receiverProbesFromContext(ctx context.Context) *receiverProbes {
+	p, _ := ctx.Value(receiverProbesKey{}).(*receiverProbes)
+	return p
+}
+
+// markReceiverReady marks the receiver of the given context ready, once it is listening or subscribed.
+func markReceiverReady(ctx context.Context) {
+	if p := receiverProbesFromContext(ctx); p != nil {
+		p.ready.Store(true)
+		if p.onReady != nil {
+			p.readyOnce.Do(p.onReady)
+		}
+	}
+}
+
+// markReceiverNotReady marks the receiver of the given context not ready, while it is disrupted.
+func markReceiverNotReady(ctx context.Context) {
+	if p := receiverProbesFromContext(ctx); p != nil {
+		p.ready.Store(false)
+	}
+}
+
+// handler serves the probes, other requests are served by next.
+//
+// Only GET requests are probes, so that events sent to the probe paths are still received.
+func (p *receiverProbes) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || (r.URL.Path != HealthzPath && r.URL.Path != ReadyzPath) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.URL.Path == ReadyzPath && !p.ready.Load() {
+			http.Error(w, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+}
+
+// startServer serves the probes on the given port until the returned function is called.
+func (p *receiverProbes) startServer(port int) (func(), error) {
+	l, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on probes port %d: %w", port, err)
+	}
+	s := &http.Server{Handler: p.handler(http.NotFoundHandler())}
+	go func() {
+		if err := s.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger(LogComponentReceiver).Errorw("Probes server failed", "error", err)
+		}
+	}()
+	return func() { _ = s.Close() }, nil
+}
@@ -0,0 +1,120 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestReceiverProbesHandler(t *testing.T) {
+	p := newReceiverProbes()
+	h := p.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	status := func(method, path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w.Code
+	}
+
+	if got := status(http.MethodGet, HealthzPath); got != http.StatusOK {
+		t.Errorf("want healthy, got %d", got)
+	}
+	if got := status(http.MethodGet, ReadyzPath); got != http.StatusServiceUnavailable {
+		t.Errorf("want not ready before the receiver is listening, got %d", got)
+	}
+	markReceiverReady(contextWithReceiverProbes(context.Background(), p))
+	if got := status(http.MethodGet, ReadyzPath); got != http.StatusOK {
+		t.Errorf("want ready, got %d", got)
+	}
+	if got := status(http.MethodPost, ReadyzPath); got != http.StatusAccepted {
+		t.Errorf("want events sent to the probe paths received, got %d", got)
+	}
+	if got := status(http.MethodGet, "/"); got != http.StatusAccepted {
+		t.Errorf("want other requests served by the receiver, got %d", got)
+	}
+
+	// Receivers without probes are started without panicking.
+	markReceiverReady(context.Background())
+}
+
+func TestStartReceiverProbes(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9231, Probes: &ReceiverProbesConfig{Port: 9232}}, received, nil)
+	}()
+
+	for _, u := range []string{"http://localhost:9231", "http://localhost:9232"} {
+		err := wait.PollImmediate(50*time.Millisecond, 10*time.Second, func() (bool, error) {
+			resp, err := http.Get(u + ReadyzPath)
+			if err != nil {
+				return false, nil
+			}
+			resp.Body.Close()
+			return resp.StatusCode == http.StatusOK, nil
+		})
+		if err != nil {
+			t.Fatalf("want receiver ready on %s: %v", u, err)
+		}
+		resp, err := http.Get(u + HealthzPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("want healthy receiver on %s, got %d", u, resp.StatusCode)
+		}
+	}
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post("http://localhost:9231", "application/cloudevents+json", strings.NewReader(string(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if r := <-received; r.Event.ID() != e.ID() {
+		t.Errorf("want event %s received, got %s", e.ID(), r.Event.ID())
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+	if _, err := http.Get("http://localhost:9232" + HealthzPath); err == nil {
+		t.Error("want the probes server stopped with the receiver")
+	}
+}
+
+func TestReceiverProbesConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ReceiverProbesConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{name: "valid", config: ReceiverProbesConfig{Port: 8081}, receiver: ReceiverConfig{Port: 8080}},
+		{name: "no port", config: ReceiverProbesConfig{}, receiver: ReceiverConfig{Port: 8080}, wantErr: true},
+		{name: "receiver port", config: ReceiverProbesConfig{Port: 8080}, receiver: ReceiverConfig{Port: 8080}, wantErr: true},
+		{name: "receiver port of a broker protocol", config: ReceiverProbesConfig{Port: 8080}, receiver: ReceiverConfig{Port: 8080, Protocol: ProtocolKafka}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.receiver); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
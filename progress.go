@@ -0,0 +1,146 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultProgressInterval is the refresh interval of the progress view when none is configured.
+const DefaultProgressInterval = time.Second
+
+// ProgressReportConfig shows a live progress view of the running test, for engineers running sacura locally against
+// a development broker.
+//
+// On a terminal the view is refreshed in place, otherwise a progress line is printed at each refresh.
+type ProgressReportConfig struct {
+	// Interval is the refresh interval of the view, for example 500ms.
+	//
+	// Defaults to DefaultProgressInterval.
+	Interval string `json:"interval" yaml:"interval"`
+
+	ParsedInterval time.Duration
+}
+
+func (c *ProgressReportConfig) validate() error {
+	if c.Interval == "" {
+		c.ParsedInterval = DefaultProgressInterval
+		return nil
+	}
+	var err error
+	c.ParsedInterval, err = time.ParseDuration(c.Interval)
+	if err != nil {
+		return invalidErr("report.progress.interval", err)
+	}
+	if c.ParsedInterval <= 0 {
+		return invalidErr("report.progress.interval", errors.New("must be greater than 0"))
+	}
+	return nil
+}
+
+// recordProgressLatency records the end-to-end latency of the given event received for the first time, it must be
+// called while holding the lock.
+func (s *StateManager) recordProgressLatency(e *ReceivedEvent) {
+	if s.progressLatency == nil {
+		return
+	}
+	if t, ok := sentTimestamp(&e.Event); ok {
+		s.progressLatency.record(e.ReceivedAt.Sub(t))
+	}
+}
+
+// progressLatencyStats returns the latency percentiles of the events received so far.
+func (s *StateManager) progressLatencyStats() LatencyStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.progressLatency == nil {
+		return LatencyStats{}
+	}
+	return s.progressLatency.stats()
+}
+
+// startProgress periodically renders the progress view to the given writer until the returned function is called.
+func (s *StateManager) startProgress(config *ProgressReportConfig, w io.Writer) func() {
+	if config == nil {
+		return func() {}
+	}
+	interactive := isTerminal(w)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(config.ParsedInterval)
+		defer ticker.Stop()
+
+		start := time.Now()
+		var previous *InterimReport
+		lines := 0
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r := s.InterimReport(start, previous)
+				previous = &r
+				lines = renderProgress(w, r, s.progressLatencyStats(), interactive, lines)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
+
+// isTerminal returns true when the given writer is a terminal.
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// renderProgress writes the progress view of the given report and returns the number of lines written.
+//
+// When interactive, the given number of lines previously written is erased so that the view is refreshed in place.
+func renderProgress(w io.Writer, r InterimReport, latency LatencyStats, interactive bool, previousLines int) int {
+	if !interactive {
+		_, _ = fmt.Fprintf(w, "elapsed %v (%.1f%%) sent %d (%.1f/s) received %d (%.1f/s) outstanding %d (%.2f%%) duplicates %d latency p50 %v p99 %v\n",
+			r.Elapsed.Round(time.Second), r.ProgressPercentage, r.SentCount, r.SentPerSecond, r.ReceivedCount, r.ReceivedPerSecond,
+			r.OutstandingCount, r.OutstandingPercentage, r.DuplicateCount, latency.P50, latency.P99)
+		return 1
+	}
+
+	b := &strings.Builder{}
+	if previousLines > 0 {
+		// Move the cursor to the beginning of the previous view and erase it.
+		fmt.Fprintf(b, "\x1b[%dA\r\x1b[J", previousLines)
+	}
+	lines := []string{
+		fmt.Sprintf("sacura      elapsed %v  progress %.1f%%", r.Elapsed.Round(time.Second), r.ProgressPercentage),
+		fmt.Sprintf("sent        %10d  %10.1f/s", r.SentCount, r.SentPerSecond),
+		fmt.Sprintf("received    %10d  %10.1f/s", r.ReceivedCount, r.ReceivedPerSecond),
+		fmt.Sprintf("outstanding %10d  %9.2f%%", r.OutstandingCount, r.OutstandingPercentage),
+		fmt.Sprintf("duplicates  %10d  nacked %d  dead-lettered %d  expired %d", r.DuplicateCount, r.NackedCount, r.DeadLetteredCount, r.ExpiredCount),
+		fmt.Sprintf("latency     p50 %v  p90 %v  p99 %v  max %v", latency.P50, latency.P90, latency.P99, latency.Max),
+	}
+	for _, l := range lines {
+		b.WriteString(l)
+		b.WriteString("\n")
+	}
+	_, _ = io.WriteString(w, b.String())
+	return len(lines)
+}
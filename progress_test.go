@@ -0,0 +1,140 @@
+package sacura
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+)
+
+func TestRenderProgress(t *testing.T) {
+	r := InterimReport{Elapsed: 61 * time.Second, SentCount: 100, ReceivedCount: 90, DuplicateCount: 2, OutstandingCount: 12, OutstandingPercentage: 12, SentPerSecond: 10}
+	latency := LatencyStats{Count: 88, P50: 5 * time.Millisecond, P90: 9 * time.Millisecond, P99: 20 * time.Millisecond, Max: 30 * time.Millisecond}
+
+	b := &bytes.Buffer{}
+	lines := renderProgress(b, r, latency, true, 0)
+	first := b.String()
+	if lines != strings.Count(first, "\n") || strings.Contains(first, "\x1b") {
+		t.Errorf("want %d lines without escape codes, got %q", lines, first)
+	}
+	for _, want := range []string{"elapsed 1m1s", "sent               100        10.0/s", "outstanding         12      12.00%", "p99 20ms"} {
+		if !strings.Contains(first, want) {
+			t.Errorf("want %q in view %q", want, first)
+		}
+	}
+
+	b.Reset()
+	renderProgress(b, r, latency, true, lines)
+	if want := "\x1b[6A\r\x1b[J"; !strings.HasPrefix(b.String(), want) || strings.TrimPrefix(b.String(), want) != first {
+		t.Errorf("want the previous view erased and the view redrawn, got %q", b.String())
+	}
+
+	b.Reset()
+	if n := renderProgress(b, r, latency, false, lines); n != 1 || strings.Contains(b.String(), "\x1b") || strings.Count(b.String(), "\n") != 1 {
+		t.Errorf("want a single line without escape codes, got %q", b.String())
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe for concurrent use.
+type lockedBuffer struct {
+	lock sync.Mutex
+	b    bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.b.String()
+}
+
+func TestStateManagerStartProgress(t *testing.T) {
+	config := Config{Report: ReportConfig{Progress: &ProgressReportConfig{Interval: "10ms"}}}
+	if err := config.Report.Progress.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 2)
+	sentSignal := sm.ReadSent(sent)
+	receivedSignal := sm.ReadReceived(received)
+	sentAt := time.Now()
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		sent <- e
+	}
+	e := cetest.FullEvent()
+	e.SetID("1")
+	setSentTimestamp(&e, sentAt)
+	received <- ReceivedEvent{Event: e, ReceivedAt: sentAt.Add(42 * time.Millisecond)}
+	// Duplicates don't count towards latency.
+	received <- ReceivedEvent{Event: e, ReceivedAt: sentAt.Add(time.Second)}
+	close(sent)
+	close(received)
+	<-sentSignal
+	<-receivedSignal
+
+	if got := sm.progressLatencyStats(); got.Count != 1 || got.Max != 42*time.Millisecond {
+		t.Errorf("want latency of the first delivery only, got %+v", got)
+	}
+
+	w := &lockedBuffer{}
+	stop := sm.startProgress(config.Report.Progress, w)
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	stop()
+
+	lines := strings.Split(strings.TrimSpace(w.String()), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("want periodic progress lines, got %q", w.String())
+	}
+	if !strings.Contains(lines[0], "sent 2 ") || !strings.Contains(lines[0], "outstanding 1 (50.00%)") || !strings.Contains(lines[0], "p50 42ms") {
+		t.Errorf("unexpected progress line %q", lines[0])
+	}
+}
+
+func TestStateManagerStartProgressDisabled(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	sm.startProgress(nil, &lockedBuffer{})()
+	if got := sm.progressLatencyStats(); got.Count != 0 {
+		t.Errorf("want no latency tracked, got %+v", got)
+	}
+}
+
+func TestProgressReportConfigValidate(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       ProgressReportConfig
+		wantInterval time.Duration
+		wantErr      bool
+	}{
+		{name: "default interval", wantInterval: DefaultProgressInterval},
+		{name: "interval", config: ProgressReportConfig{Interval: "500ms"}, wantInterval: 500 * time.Millisecond},
+		{name: "invalid interval", config: ProgressReportConfig{Interval: "fast"}, wantErr: true},
+		{name: "zero interval", config: ProgressReportConfig{Interval: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.ParsedInterval != tt.wantInterval {
+				t.Errorf("want interval %v, got %v", tt.wantInterval, tt.config.ParsedInterval)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+
+	"github.com/jhump/protoreflect/desc"
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// protoSchemaFile is the name the schema is parsed as, imports other than the well-known types aren't resolved.
+const protoSchemaFile = "schema.proto"
+
+// protobufCodec encodes data as a message of a Protobuf schema, prefixed with the indexes of the message in the schema.
+// JSON values use the Protobuf JSON mapping.
+type protobufCodec struct {
+	message protoreflect.MessageDescriptor
+	// index is the path of indexes of the message, from the top-level message of the schema.
+	index []int
+}
+
+func newProtobufCodec(schema, message string) (*protobufCodec, error) {
+	p := protoparse.Parser{Accessor: protoparse.FileContentsFromMap(map[string]string{protoSchemaFile: schema})}
+	parsed, err := p.ParseFiles(protoSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	files, err := protodesc.NewFiles(desc.ToFileDescriptorSet(parsed...))
+	if err != nil {
+		return nil, err
+	}
+	fd, err := files.FindFileByPath(protoSchemaFile)
+	if err != nil {
+		return nil, err
+	}
+	var md protoreflect.MessageDescriptor
+	if message == "" {
+		if fd.Messages().Len() == 0 {
+			return nil, errors.New("schema has no message")
+		}
+		md = fd.Messages().Get(0)
+	} else {
+		d, err := files.FindDescriptorByName(protoreflect.FullName(message))
+		if err != nil || d.ParentFile().Path() != protoSchemaFile {
+			return nil, fmt.Errorf("unknown message %q", message)
+		}
+		if md, _ = d.(protoreflect.MessageDescriptor); md == nil {
+			return nil, fmt.Errorf("%q is not a message", message)
+		}
+	}
+
+	var index []int
+	for d := protoreflect.Descriptor(md); ; d = d.Parent() {
+		if _, ok := d.(protoreflect.MessageDescriptor); !ok {
+			break
+		}
+		index = append([]int{d.Index()}, index...)
+	}
+	return &protobufCodec{message: md, index: index}, nil
+}
+
+// appendIndexes appends the message indexes in the schema registry wire format to b.
+func (c *protobufCodec) appendIndexes(b []byte) []byte {
+	if len(c.index) == 1 && c.index[0] == 0 {
+		// The indexes of the first message are encoded as a single 0.
+		return append(b, 0)
+	}
+	b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(len(c.index))))
+	for _, i := range c.index {
+		b = protowire.AppendVarint(b, protowire.EncodeZigZag(int64(i)))
+	}
+	return b
+}
+
+func (c *protobufCodec) generate(r *rand.Rand) ([]byte, error) {
+	m := dynamicpb.NewMessage(c.message)
+	generateProtoMessage(r, m, 0)
+	return proto.MarshalOptions{}.MarshalAppend(c.appendIndexes(nil), m)
+}
+
+// generateProtoMessage sets random values to the fields of the given message, a single field of each oneof is set.
+func generateProtoMessage(r *rand.Rand, m protoreflect.Message, depth int) {
+	fields := m.Descriptor().Fields()
+	oneofs := make(map[protoreflect.FullName]bool)
+	for i := 0; i < fields.Len(); i++ {
+		f := fields.Get(i)
+		if o := f.ContainingOneof(); o != nil {
+			if oneofs[o.FullName()] {
+				continue
+			}
+			oneofs[o.FullName()] = true
+		}
+		if f.Message() != nil && depth >= maxGeneratedDepth {
+			// Message, list and map fields are optional, recursive messages terminate without them.
+			continue
+		}
+		switch {
+		case f.IsList():
+			l := m.Mutable(f).List()
+			for n := r.Intn(3); n > 0; n-- {
+				if f.Message() == nil {
+					l.Append(generateProtoValue(r, f))
+					continue
+				}
+				v := l.NewElement()
+				generateProtoMessage(r, v.Message(), depth+1)
+				l.Append(v)
+			}
+		case f.IsMap():
+			mv := m.Mutable(f).Map()
+			for n := r.Intn(3); n > 0; n-- {
+				k := generateProtoValue(r, f.MapKey()).MapKey()
+				if f.MapValue().Message() == nil {
+					mv.Set(k, generateProtoValue(r, f.MapValue()))
+					continue
+				}
+				v := mv.NewValue()
+				generateProtoMessage(r, v.Message(), depth+1)
+				mv.Set(k, v)
+			}
+		case f.Message() != nil:
+			generateProtoMessage(r, m.Mutable(f).Message(), depth+1)
+		default:
+			m.Set(f, generateProtoValue(r, f))
+		}
+	}
+}
+
+// generateProtoValue returns a random value of the given scalar or enum field.
+func generateProtoValue(r *rand.Rand, f protoreflect.FieldDescriptor) protoreflect.Value {
+	switch f.Kind() {
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(r.Intn(2) == 1)
+	case protoreflect.EnumKind:
+		values := f.Enum().Values()
+		return protoreflect.ValueOfEnum(values.Get(r.Intn(values.Len())).Number())
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(r.Int31())
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(r.Uint32())
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(r.Int63())
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return protoreflect.ValueOfUint64(r.Uint64())
+	case protoreflect.FloatKind:
+		return protoreflect.ValueOfFloat32(r.Float32())
+	case protoreflect.DoubleKind:
+		return protoreflect.ValueOfFloat64(r.Float64())
+	case protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes([]byte(randomString(r, 8+r.Intn(9))))
+	default:
+		return protoreflect.ValueOfString(randomString(r, 8+r.Intn(9)))
+	}
+}
+
+func (c *protobufCodec) encode(data []byte) ([]byte, error) {
+	m := dynamicpb.NewMessage(c.message)
+	if err := protojson.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	return proto.MarshalOptions{}.MarshalAppend(c.appendIndexes(nil), m)
+}
+
+func (c *protobufCodec) verify(b []byte) error {
+	consume := func() (int64, error) {
+		v, n := protowire.ConsumeVarint(b)
+		if n < 0 {
+			return 0, errors.New("invalid message indexes")
+		}
+		b = b[n:]
+		return protowire.DecodeZigZag(v), nil
+	}
+	count, err := consume()
+	if err != nil {
+		return err
+	}
+	indexes := []int{0}
+	if count != 0 {
+		if count < 0 || count > int64(len(b)) {
+			return errors.New("invalid message indexes")
+		}
+		indexes = make([]int, 0, count)
+		for ; count > 0; count-- {
+			i, err := consume()
+			if err != nil {
+				return err
+			}
+			indexes = append(indexes, int(i))
+		}
+	}
+	if fmt.Sprint(indexes) != fmt.Sprint(c.index) {
+		return fmt.Errorf("message indexes %v, expected %v of message %s", indexes, c.index, c.message.FullName())
+	}
+
+	m := dynamicpb.NewMessage(c.message)
+	if err := proto.Unmarshal(b, m); err != nil {
+		return err
+	}
+	return checkUnknownFields(m)
+}
+
+// checkUnknownFields returns an error when the given message or its nested messages have unknown fields, data of
+// other messages or fields with the wrong wire type are decoded as unknown fields.
+func checkUnknownFields(m protoreflect.Message) error {
+	if len(m.GetUnknown()) > 0 {
+		return fmt.Errorf("unknown fields in message %s", m.Descriptor().FullName())
+	}
+	var err error
+	m.Range(func(f protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		switch {
+		case f.IsList() && f.Message() != nil:
+			for i := 0; i < v.List().Len() && err == nil; i++ {
+				err = checkUnknownFields(v.List().Get(i).Message())
+			}
+		case f.IsMap() && f.MapValue().Message() != nil:
+			v.Map().Range(func(_ protoreflect.MapKey, v protoreflect.Value) bool {
+				err = checkUnknownFields(v.Message())
+				return err == nil
+			})
+		case !f.IsList() && !f.IsMap() && f.Message() != nil:
+			err = checkUnknownFields(v.Message())
+		}
+		return err == nil
+	})
+	return err
+}
@@ -0,0 +1,164 @@
+package sacura
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const testProtoSchema = `
+syntax = "proto3";
+package com.example;
+
+// Order is an order.
+message Order {
+  string id = 1;
+  repeated int32 quantities = 2 [packed = true];
+  Status status = 3;
+  map<string, int64> attributes = 4;
+  Item item = 5;
+  oneof payment {
+    string card = 6;
+    string iban = 7;
+  }
+  message Item {
+    /* The SKU. */
+    string sku = 1;
+    double price = 2;
+  }
+}
+
+enum Status {
+  NEW = 0;
+  SHIPPED = 1;
+}
+
+message Duration {
+  int64 seconds = 1;
+  int32 nanos = 2;
+}
+`
+
+func TestProtobufCodecEncode(t *testing.T) {
+
+	// The encoding is the one of the well-known Duration message, after its message indexes.
+	d, err := newProtobufCodec(testProtoSchema, "com.example.Duration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]int{1}, d.index); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	b, err := d.encode([]byte(`{"seconds": 42, "nanos": -7}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte{2, 2}, b[:2]); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	got := &durationpb.Duration{}
+	if err := proto.Unmarshal(b[2:], got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Seconds != 42 || got.Nanos != -7 {
+		t.Errorf("want 42s and -7ns, got %v", got)
+	}
+
+	item, err := newProtobufCodec(testProtoSchema, "com.example.Order.Item")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The entry message of the attributes map is the first nested message of Order.
+	if diff := cmp.Diff([]int{0, 1}, item.index); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	order, err := newProtobufCodec(testProtoSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = order.encode([]byte(`{"id": "a", "quantities": [1, 2], "status": "SHIPPED", "attributes": {"k": 1}, "item": {"sku": "s", "price": 1.5}, "card": "1234"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b[0] != 0 {
+		t.Errorf("want the message indexes of the first message, got %v", b)
+	}
+	if err := order.verify(b); err != nil {
+		t.Errorf("failed to verify %v: %v", b, err)
+	}
+
+	if _, err := order.encode([]byte(`{"status": "LOST"}`)); err == nil {
+		t.Error("expected error encoding an unknown enum value")
+	}
+	if _, err := order.encode([]byte(`{"unknown": 1}`)); err == nil {
+		t.Error("expected error encoding an unknown field")
+	}
+}
+
+func TestProtobufCodecVerify(t *testing.T) {
+
+	order, err := newProtobufCodec(testProtoSchema, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := newRand(nil, "protobuf")
+	for i := 0; i < 100; i++ {
+		b, err := order.generate(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := order.verify(b); err != nil {
+			t.Fatalf("failed to verify generated data %v: %v", b, err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "unknown field", data: []byte{0, 0x40, 1}},
+		{name: "wrong wire type", data: []byte{0, 0x08, 1}},
+		{name: "truncated", data: []byte{0, 0x0a, 5, 'a'}},
+		{name: "invalid nested message", data: []byte{0, 0x2a, 2, 0x78, 1}},
+		{name: "wrong message indexes", data: []byte{2, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := order.verify(tt.data); err == nil {
+				t.Errorf("expected error verifying %v", tt.data)
+			}
+		})
+	}
+}
+
+func TestNewProtobufCodec(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  string
+		message string
+		wantErr bool
+	}{
+		{name: "options", schema: `syntax = "proto3"; option go_package = "x"; message A { option deprecated = true; reserved 2; string b = 1 [deprecated = true]; }`},
+		{name: "qualified type", schema: `syntax = "proto3"; package p; message A { .p.B b = 1; } message B {}`},
+		{name: "proto2", schema: `syntax = "proto2"; message A { optional string b = 1; }`},
+		{name: "well-known import", schema: `syntax = "proto3"; import "google/protobuf/timestamp.proto"; message A { google.protobuf.Timestamp t = 1; }`},
+		{name: "import", schema: `syntax = "proto3"; import "other.proto"; message A {}`, wantErr: true},
+		{name: "unknown type", schema: `syntax = "proto3"; message A { B b = 1; }`, wantErr: true},
+		{name: "duplicate number", schema: `syntax = "proto3"; message A { string a = 1; string b = 1; }`, wantErr: true},
+		{name: "no message", schema: `syntax = "proto3";`, wantErr: true},
+		{name: "unknown message", schema: `syntax = "proto3"; message A {}`, message: "B", wantErr: true},
+		{name: "message of an import", schema: `syntax = "proto3"; import "google/protobuf/timestamp.proto"; message A {}`, message: "google.protobuf.Timestamp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newProtobufCodec(tt.schema, tt.message); (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
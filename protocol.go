@@ -0,0 +1,86 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// Protocol is the protocol events are sent or received with.
+type Protocol string
+
+const (
+	ProtocolHTTP Protocol = "http"
+	// ProtocolGRPC implements the Publish method of the CloudEvents gRPC protocol binding
+	// (io.cloudevents.v1.CloudEventService), plaintext connections use HTTP/2 with prior knowledge.
+	ProtocolGRPC Protocol = "grpc"
+	// ProtocolMQTT implements the CloudEvents MQTT protocol binding with MQTT v5, the sender publishes events to a
+	// broker and the receiver subscribes to it.
+	ProtocolMQTT Protocol = "mqtt"
+	// ProtocolAMQP implements the CloudEvents AMQP protocol binding with AMQP 1.0, the sender sends events to a node of
+	// a broker, like a queue, and the receiver receives from it.
+	ProtocolAMQP Protocol = "amqp"
+	// ProtocolNATS implements the CloudEvents NATS protocol binding with JetStream, the sender publishes events to a
+	// subject captured by a stream and the receiver consumes the stream with a push consumer.
+	ProtocolNATS Protocol = "nats"
+	// ProtocolKafka implements the CloudEvents Kafka protocol binding, the sender produces events to a topic and the
+	// receiver consumes the topic as a member of a consumer group.
+	ProtocolKafka Protocol = "kafka"
+	// ProtocolWebSocket implements the CloudEvents WebSocket protocol binding with the cloudevents.json subprotocol,
+	// every message is an event in the structured content mode. The sender connects to the target and the receiver
+	// either accepts connections or connects to a gateway pushing events.
+	ProtocolWebSocket Protocol = "websocket"
+)
+
+// protocolBinding sends and receives events with a protocol other than HTTP and gRPC, which are served by the HTTP
+// server of the receiver.
+type protocolBinding interface {
+	// validateSender validates the protocol configuration of the given sender.
+	validateSender(c *SenderConfig) error
+	// validateReceiver validates the protocol configuration of the given receiver.
+	validateReceiver(c *ReceiverConfig) error
+	// newTransport returns the transport of the sender, it sends the event of each request and responds with
+	// acceptedResponse once the event is accepted.
+	newTransport(config *Config) senderTransport
+	// startReceiver receives events and handles them with h until the given context is done.
+	startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error
+	// resumes reports whether a receiver restarting receives the events published while it was down.
+	resumes() bool
+}
+
+// senderTransport is the transport of a protocolBinding.
+type senderTransport interface {
+	http.RoundTripper
+	// close closes the connections of the transport.
+	close()
+}
+
+// protocolBindings are the bindings of the protocols other than HTTP and gRPC.
+var protocolBindings = map[Protocol]protocolBinding{
+	ProtocolMQTT:      mqttBinding{},
+	ProtocolAMQP:      amqpBinding{},
+	ProtocolNATS:      natsBinding{},
+	ProtocolKafka:     kafkaBinding{},
+	ProtocolWebSocket: webSocketBinding{},
+}
+
+// validateProtocol validates the given protocol, the empty protocol is ProtocolHTTP.
+func validateProtocol(field string, p Protocol) error {
+	if _, ok := protocolBindings[p]; ok || p == "" || p == ProtocolHTTP || p == ProtocolGRPC {
+		return nil
+	}
+	return invalidErr(field, fmt.Errorf("unknown protocol %q, expected one of %v", p, protocols()))
+}
+
+// protocols returns the supported protocols, HTTP and gRPC first and then the protocol bindings by name.
+func protocols() []Protocol {
+	bindings := make([]Protocol, 0, len(protocolBindings))
+	for p := range protocolBindings {
+		bindings = append(bindings, p)
+	}
+	sort.Slice(bindings, func(i, j int) bool { return bindings[i] < bindings[j] })
+	return append([]Protocol{ProtocolHTTP, ProtocolGRPC}, bindings...)
+}
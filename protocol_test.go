@@ -0,0 +1,36 @@
+package sacura
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestValidateProtocol(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol Protocol
+		wantErr  bool
+	}{
+		{name: "default"},
+		{name: "http", protocol: ProtocolHTTP},
+		{name: "grpc", protocol: ProtocolGRPC},
+		{name: "binding", protocol: ProtocolKafka},
+		{name: "unknown", protocol: "stomp", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateProtocol("sender.protocol", tt.protocol); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestProtocols(t *testing.T) {
+	want := []Protocol{ProtocolHTTP, ProtocolGRPC, ProtocolAMQP, ProtocolKafka, ProtocolMQTT, ProtocolNATS, ProtocolWebSocket}
+	if diff := cmp.Diff(want, protocols()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
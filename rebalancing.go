@@ -0,0 +1,142 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// RebalancingConfig detects partition keys whose deliveries switched source mid-run, for example because the broker
+// reassigned the Kafka partition or the consumer handling the key, since ordering may silently reset when it happens.
+//
+// The source of a delivery is read from a request header or from an extension of the received event, exactly one of
+// them must be specified.
+type RebalancingConfig struct {
+	// Header is the request header carrying the delivery source, for example a header with the Kafka partition id set
+	// by the dispatcher. It is only supported with the HTTP and gRPC protocols.
+	Header string `json:"header" yaml:"header"`
+	// Extension is the extension of received events carrying the delivery source, for example partition.
+	Extension string `json:"extension" yaml:"extension"`
+}
+
+func (c *RebalancingConfig) validate(config *Config) error {
+	if config.Ordered == nil {
+		return invalidErr("receiver.rebalancing", errors.New("requires ordered, sources are tracked by partition key"))
+	}
+	if (c.Header == "") == (c.Extension == "") {
+		return invalidErr("receiver.rebalancing", errors.New("exactly one of header or extension must be specified"))
+	}
+	if c.Header != "" {
+		switch config.Receiver.Protocol {
+		case "", ProtocolHTTP, ProtocolGRPC:
+		default:
+			return invalidErr("receiver.rebalancing.header", fmt.Errorf("not supported with the %s protocol", config.Receiver.Protocol))
+		}
+	}
+	if c.Extension != "" && !isValidExtensionName(c.Extension) {
+		return invalidErr("receiver.rebalancing.extension", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", c.Extension))
+	}
+	return nil
+}
+
+// source returns the delivery source of the given event received with the given request.
+func (c *RebalancingConfig) source(e *ce.Event, req *http.Request) string {
+	if c == nil {
+		return ""
+	}
+	if c.Header != "" {
+		if req == nil {
+			return ""
+		}
+		return req.Header.Get(c.Header)
+	}
+	v, ok := e.Extensions()[c.Extension]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// RebalancingReport reports the partition keys whose deliveries switched source, when receiver.rebalancing is
+// enabled.
+type RebalancingReport struct {
+	// SwitchCount is the number of times the deliveries of a partition key switched source.
+	SwitchCount int `json:"switchCount"`
+	// CorrelatedSwitchCount is the number of switches followed by ordering violations.
+	CorrelatedSwitchCount int `json:"correlatedSwitchCount"`
+	// SwitchesByPartitionKey collects the switches by partition key.
+	SwitchesByPartitionKey map[string][]SourceSwitch `json:"switches,omitempty"`
+}
+
+// SourceSwitch is a switch of the delivery source of a partition key.
+type SourceSwitch struct {
+	// ID is the event of the first delivery from the new source.
+	ID         string    `json:"id"`
+	From       string    `json:"from"`
+	To         string    `json:"to"`
+	ReceivedAt time.Time `json:"receivedAt"`
+	// OrderingViolations are the events received out of order from the new source before the next switch.
+	OrderingViolations []string `json:"orderingViolations,omitempty"`
+}
+
+// partitionSources tracks the delivery sources of a partition key.
+type partitionSources struct {
+	source   string
+	switches []SourceSwitch
+	// segments is the number of switches before the first delivery of each event.
+	segments map[string]int
+}
+
+// recordDeliverySource records the delivery source of the given event, it must be called while holding the lock.
+func (s *StateManager) recordDeliverySource(e *ReceivedEvent) {
+	if e.DeliverySource == "" || e.DeadLettered {
+		return
+	}
+	pk := partitionKey(&e.Event, &s.stateManagerConfig)
+	p, ok := s.deliverySources[pk]
+	if !ok {
+		p = &partitionSources{source: e.DeliverySource, segments: make(map[string]int)}
+		s.deliverySources[pk] = p
+	}
+	if p.source != e.DeliverySource {
+		p.switches = append(p.switches, SourceSwitch{ID: e.Event.ID(), From: p.source, To: e.DeliverySource, ReceivedAt: e.ReceivedAt})
+		p.source = e.DeliverySource
+	}
+	if _, ok := p.segments[e.Event.ID()]; !ok {
+		p.segments[e.Event.ID()] = len(p.switches)
+	}
+}
+
+// rebalancingReport sets the source switches of the report, it must be called while holding the lock once the
+// ordering violations have been reported.
+func (s *StateManager) rebalancingReport(r *Report) {
+	if s.config.Receiver.Rebalancing == nil {
+		return
+	}
+	report := &RebalancingReport{SwitchesByPartitionKey: make(map[string][]SourceSwitch)}
+	for pk, p := range s.deliverySources {
+		if len(p.switches) == 0 {
+			continue
+		}
+		switches := make([]SourceSwitch, len(p.switches))
+		copy(switches, p.switches)
+		for _, v := range r.OrderingViolationsByPartitionKey[pk].Violations {
+			if i := p.segments[v.ID]; i > 0 {
+				switches[i-1].OrderingViolations = append(switches[i-1].OrderingViolations, v.ID)
+			}
+		}
+		for i := range switches {
+			sort.Strings(switches[i].OrderingViolations)
+			if len(switches[i].OrderingViolations) > 0 {
+				report.CorrelatedSwitchCount++
+			}
+		}
+		report.SwitchCount += len(switches)
+		report.SwitchesByPartitionKey[pk] = switches
+	}
+	r.Rebalancing = report
+}
@@ -0,0 +1,103 @@
+package sacura
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRebalancingConfigValidate(t *testing.T) {
+	ordered := &OrderedConfig{NumPartitionKeys: 2}
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "header", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{Header: "Kafka-Partition"}}}},
+		{name: "extension", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Protocol: ProtocolKafka, Rebalancing: &RebalancingConfig{Extension: "partition"}}}},
+		{name: "unordered", config: Config{Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{Header: "Kafka-Partition"}}}, wantErr: true},
+		{name: "none", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{}}}, wantErr: true},
+		{name: "both", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{Header: "Kafka-Partition", Extension: "partition"}}}, wantErr: true},
+		{name: "header with kafka", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Protocol: ProtocolKafka, Rebalancing: &RebalancingConfig{Header: "Kafka-Partition"}}}, wantErr: true},
+		{name: "invalid extension", config: Config{Ordered: ordered, Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{Extension: "Kafka-Partition"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Receiver.Rebalancing.validate(&tt.config); (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRebalancingConfigSource(t *testing.T) {
+	e := cetest.FullEvent()
+	e.SetExtension("partition", 3)
+	req := &http.Request{Header: http.Header{"Kafka-Partition": []string{"7"}}}
+
+	if got := (&RebalancingConfig{Header: "Kafka-Partition"}).source(&e, req); got != "7" {
+		t.Errorf("want source 7 from the header, got %q", got)
+	}
+	if got := (&RebalancingConfig{Extension: "partition"}).source(&e, req); got != "3" {
+		t.Errorf("want source 3 from the extension, got %q", got)
+	}
+	var disabled *RebalancingConfig
+	if got := disabled.source(&e, req); got != "" {
+		t.Errorf("want no source, got %q", got)
+	}
+}
+
+func TestRebalancingReport(t *testing.T) {
+	sm := newTestStateManager(t, Config{
+		Ordered:  &OrderedConfig{NumPartitionKeys: 2},
+		Receiver: ReceiverConfig{Rebalancing: &RebalancingConfig{Extension: "partition"}},
+	})
+
+	events := make(map[string]ce.Event)
+	now := time.Now()
+	sm.lock.Lock()
+	for i := 1; i <= 6; i++ {
+		for _, pk := range []string{"0", "1"} {
+			e := cetest.FullEvent()
+			e.SetID(pk + "-" + fmt.Sprint(i))
+			e.SetExtension(DefaultPartitionKeyExtension, pk)
+			events[e.ID()] = e
+			sm.recordSent(&e)
+		}
+	}
+	deliveries := []struct {
+		id     string
+		source string
+	}{
+		{"0-1", "a"}, {"0-4", "a"}, {"0-2", "b"}, {"0-3", "b"}, {"0-6", "b"}, {"0-5", "a"},
+		{"1-1", "c"}, {"1-2", "c"}, {"1-3", "c"}, {"1-4", "d"}, {"1-5", "d"}, {"1-6", "d"},
+	}
+	for i, d := range deliveries {
+		sm.recordReceived(&ReceivedEvent{Event: events[d.id], ReceivedAt: now.Add(time.Duration(i) * time.Second), DeliverySource: d.source})
+	}
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	want := &RebalancingReport{
+		SwitchCount:           3,
+		CorrelatedSwitchCount: 2,
+		SwitchesByPartitionKey: map[string][]SourceSwitch{
+			"0": {
+				{ID: "0-2", From: "a", To: "b", ReceivedAt: now.Add(2 * time.Second), OrderingViolations: []string{"0-2", "0-3"}},
+				{ID: "0-5", From: "b", To: "a", ReceivedAt: now.Add(5 * time.Second), OrderingViolations: []string{"0-5"}},
+			},
+			"1": {
+				{ID: "1-4", From: "c", To: "d", ReceivedAt: now.Add(9 * time.Second)},
+			},
+		},
+	}
+	if diff := cmp.Diff(want, report.Rebalancing); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
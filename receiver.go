@@ -2,11 +2,14 @@ package sacura
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"math/rand"
+	"mime"
+	"net"
 	"net/http"
 	"strconv"
 	"sync"
@@ -27,7 +30,11 @@ import (
 	"go.opentelemetry.io/otel/sdk/metric/export/aggregation"
 	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
 	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/atomic"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 )
 
 var (
@@ -39,17 +46,137 @@ var (
 
 	inFlightRequestsHistogram       syncint64.Histogram  = nil
 	inFlightRequestsHistogramLabels []attribute.KeyValue = nil
+
+	rejectedRequestsCounter       syncint64.Counter    = nil
+	rejectedRequestsCounterLabels []attribute.KeyValue = nil
+
+	suppressedDuplicatesCounter       syncint64.Counter    = nil
+	suppressedDuplicatesCounterLabels []attribute.KeyValue = nil
 )
 
 const (
 	BenchmarkTimestampAttribute = "benchmarktimestamp"
+	// BenchmarkTimestampNanosAttribute is the send time in nanoseconds, the end-to-end latency of the report is
+	// measured from it, since BenchmarkTimestampAttribute in milliseconds biases sub-millisecond latencies.
+	BenchmarkTimestampNanosAttribute = "benchmarktimestampns"
 )
 
-func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- ce.Event) error {
+// ReceivedEvent is an event received by the receiver.
+type ReceivedEvent struct {
+	Event ce.Event
+	// ReceivedAt is the time at which the receiver received the event.
+	ReceivedAt time.Time
+	// Nacked is true when the receiver responded with an injected failure response.
+	Nacked bool
+	// DeadLettered is true when the event has been received by the dead-letter sink.
+	DeadLettered bool
+	// Sink is the request path on which the event has been received, when fan-out verification is enabled.
+	Sink string
+	// Path is the request path on which the event has been received, it is empty for other protocols than HTTP.
+	Path string
+	// Endpoint is the endpoint on which the event has been received, when receiver.endpoints is enabled.
+	Endpoint string
+	// ContentMode is the HTTP content mode the event has been received in, it is empty for other protocols and
+	// batches.
+	ContentMode ContentMode
+	// Replica is the instance that received the event in distributed mode, it is empty otherwise.
+	Replica string
+	// Compressed is true when the event has been received in a compressed request body.
+	Compressed bool
+	// Mangled is true when the compressed request body of the event cannot be decompressed, only the attributes
+	// carried by the request headers are set.
+	Mangled bool
+	// DataChecksum is the checksum of the data computed while streaming the request body, when
+	// receiver.streamPayloads is enabled, the data of the event is not set.
+	DataChecksum string
+	// ContentType is the HTTP Content-Type header of the request the event has been received in.
+	ContentType string
+	// DeliverySource is the source the event has been delivered from, when receiver.rebalancing is enabled.
+	DeliverySource string
+	// Suppressed is true when the event is a duplicate suppressed by receiver.suppressDuplicates, it is only
+	// counted.
+	Suppressed bool
+}
+
+// statusCodeError is returned by receiver handlers to respond with a specific status code.
+type statusCodeError struct {
+	statusCode int
+	// message is the response message, it defaults to an injected failure response message.
+	message string
+}
+
+func (e *statusCodeError) Error() string {
+	if e.message != "" {
+		return e.message
+	}
+	return fmt.Sprintf("injected failure response %d", e.statusCode)
+}
+
+// StartReceiver starts the receiver and forwards received events to the given channel.
+//
+// When a StateManager is provided, its live state is exposed as metrics.
+func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- ReceivedEvent, sm *StateManager) error {
 	defer close(received)
 
+	var authenticator *requestAuthenticator
+	if config.Auth != nil {
+		var err error
+		authenticator, err = newRequestAuthenticator(config.Auth)
+		if err != nil {
+			return err
+		}
+	}
+
+	var clockOffset time.Duration
+	faults := newRand(sm.seed(), "receiver.fault")
+	settings := liveSettingsFromContext(ctx)
+	if config.ClockSync != nil {
+		skew, err := syncClock(ctx, config.ClockSync)
+		if err != nil {
+			return err
+		}
+		logger(LogComponentReceiver).Infow("Clock synchronized with the sender", "offset", skew.Offset, "roundTrip", skew.RoundTrip)
+		clockOffset = skew.Offset
+		if sm != nil {
+			sm.setClockSkew(skew)
+		}
+	}
+
+	inFlightRequests := atomic.NewInt64(0)
+	lastReceived := atomic.NewInt64(0)
+	receivedCount := atomic.NewInt64(0)
+	exporter := spanExporterFromContext(ctx)
+
+	probes := newReceiverProbes()
+	if c := controllerClientFromContext(ctx); c != nil {
+		// Agents reach the start phase once their receiver is ready.
+		probes.onReady = func() { c.arrive(ctx, controllerPhaseStart) }
+	}
+	if config.Probes != nil {
+		stopProbes, err := probes.startServer(config.Probes.Port)
+		if err != nil {
+			return err
+		}
+		defer stopProbes()
+	}
+
 	innerCtx, cancel := context.WithCancel(context.Background())
-	wait := exportMetrics(innerCtx)
+	innerCtx = contextWithReceiverProbes(innerCtx, probes)
+	if config.RequestLog != nil {
+		l, err := openRequestLog(config.RequestLog, newRand(sm.seed(), "receiver.requestLog"))
+		if err != nil {
+			cancel()
+			return err
+		}
+		defer func() {
+			if err := l.close(); err != nil {
+				logger(LogComponentReceiver).Errorw("Failed to close request log", "path", config.RequestLog.Path, "error", err)
+			}
+		}()
+		innerCtx = contextWithRequestLog(innerCtx, l)
+	}
+	handshake := handshakeFromContext(ctx)
+	wait := exportMetrics(innerCtx, inFlightRequests.Load, sm)
 	defer wait()
 
 	go func() {
@@ -57,16 +184,26 @@ func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- c
 
 		<-ctx.Done()
 		if err := ctx.Err(); err != nil {
-			log.Println(err)
+			logger(LogComponentReceiver).Infow("Receiver context done", "error", err)
+		}
+		waitReceiverTermination(&config, func() time.Time { return time.Unix(0, lastReceived.Load()) }, receivedCount.Load, sm.completed(), abortedFromContext(ctx))
+		if config.LateArrivals != nil {
+			waitLateArrivals(config.LateArrivals, sm, time.Now().Add(-clockOffset), abortedFromContext(ctx))
 		}
-		<-time.After(config.ParsedTimeout)
-
-		log.Println("Receiver timeout reached")
 	}()
 
-	inFlightRequests := atomic.NewInt64(0)
+	delays := newRand(sm.seed(), "receiver.slowConsumer")
+	echo := newEchoer(config.Echo)
+	suppressor := newDuplicateSuppressor(&config)
+	instance := config.InstanceIdentity.instance()
+	if instance != "" {
+		logger(LogComponentReceiver).Infow("Reporting the receiver instance identity", "instance", instance)
+	}
+	handle := func(ctx context.Context, event *ce.Event, req *http.Request) error {
+		// Receive times are recorded according to the sender clock.
+		receivedAt := time.Now().Add(-clockOffset)
+		logRequestEvent(req, event)
 
-	err := startReceiver(innerCtx, &config, func(ctx context.Context, event *ce.Event, req *http.Request) error {
 		inFlightRequests.Inc()
 		inFlightRequestsHistogramReqLabels := addRequestLabels(req, &config, inFlightRequestsHistogramLabels)
 		inFlightRequestsHistogram.Record(ctx, inFlightRequests.Load(), inFlightRequestsHistogramReqLabels...)
@@ -75,6 +212,33 @@ func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- c
 			inFlightRequestsHistogram.Record(ctx, inFlightRequests.Load(), inFlightRequestsHistogramReqLabels...)
 		}()
 
+		if authenticator != nil {
+			if reason, err := authenticator.authenticate(req); err != nil {
+				labels := append(addRequestLabels(req, &config, rejectedRequestsCounterLabels), attribute.String("reason", reason))
+				rejectedRequestsCounter.Add(ctx, 1, labels...)
+				logger(LogComponentReceiver).Warnw("Rejected event", "id", event.ID(), "error", err)
+				return &statusCodeError{statusCode: http.StatusUnauthorized, message: err.Error()}
+			}
+		}
+		if handshake.isProbe(event.ID()) {
+			// Probe events of the handshake aren't part of the test.
+			return nil
+		}
+		lastReceived.Store(receivedAt.Add(clockOffset).UnixNano())
+		receivedCount.Inc()
+
+		compression := compressionFromRequest(req)
+		payload, _ := streamedPayloadFromRequest(req)
+		if compression.mangled {
+			received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, Path: req.URL.Path, Compressed: true, Mangled: true}
+			return errMangled
+		}
+
+		var parent trace.SpanContext
+		if exporter != nil {
+			parent = extractTraceParent(req.Header)
+		}
+
 		exstensions := event.Extensions()
 		if v, ok := exstensions[BenchmarkTimestampAttribute]; ok {
 			t, err := strconv.ParseInt(v.(string), 10, 64)
@@ -82,25 +246,76 @@ func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- c
 				panic(err)
 			}
 			start := time.UnixMilli(t)
-			e2eLatency := time.Since(start)
+			e2eLatency := receivedAt.Sub(start)
 			if e2eLatency.Milliseconds() < 0 {
-				log.Printf("Negative e2e latency %d\n", e2eLatency.Milliseconds())
+				logger(LogComponentReceiver).Warnw("Negative e2e latency", "id", event.ID(), "latencyMs", e2eLatency.Milliseconds())
 			} else {
 				e2eLatencyHistogram.Record(ctx, e2eLatency.Milliseconds(), addRequestLabels(req, &config, e2eLatencyHistogramLabels)...)
 			}
+			if parent.IsValid() {
+				exporter.export(newChildSpan("e2e", trace.SpanKindInternal, parent, start, receivedAt, map[string]string{
+					"cloudevents.event_id": event.ID(),
+				}))
+			}
+		}
+
+		if parent.IsValid() {
+			defer func() {
+				exporter.export(newChildSpan("receive", trace.SpanKindConsumer, parent, receivedAt, time.Now().Add(-clockOffset), map[string]string{
+					"cloudevents.event_id": event.ID(),
+					"http.target":          req.URL.Path,
+				}))
+			}()
+		}
+
+		if config.DeadLetterSinkPath != "" && req.URL.Path == config.DeadLetterSinkPath {
+			received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, DeadLettered: true, Path: req.URL.Path, Compressed: compression.compressed, DataChecksum: payload.checksum}
+			return nil
 		}
 
-		maybeSleep(config)
-		received <- *event
+		var sink string
+		if config.FanOut != nil {
+			sink = req.URL.Path
+		}
+		var endpoint string
+		if config.Endpoints != nil {
+			endpoint = config.Endpoints.endpoint(req)
+		}
+		contentMode := requestContentMode(req)
+		source := config.Rebalancing.source(event, req)
+
+		fault := settings.receiverFault(config.ReceiverFaultConfig)
+		maybeSleep(fault, faults)
+		if statusCode := faultStatusCode(fault, faults); statusCode != 0 {
+			received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, Nacked: true, Sink: sink, Path: req.URL.Path, Endpoint: endpoint, ContentMode: contentMode, Compressed: compression.compressed, DataChecksum: payload.checksum, ContentType: req.Header.Get("Content-Type"), DeliverySource: source}
+			return &statusCodeError{statusCode: statusCode}
+		}
+		if suppressor.suppress(event.ID()) {
+			// Duplicates are acknowledged without being processed again, like an idempotent consumer would.
+			suppressedDuplicatesCounter.Add(ctx, 1, addRequestLabels(req, &config, suppressedDuplicatesCounterLabels)...)
+			received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, Sink: sink, Path: req.URL.Path, Endpoint: endpoint, ContentMode: contentMode, Compressed: compression.compressed, DataChecksum: payload.checksum, ContentType: req.Header.Get("Content-Type"), DeliverySource: source, Suppressed: true}
+			return nil
+		}
+		if err := echo.echo(ctx, event); err != nil {
+			suppressor.forget(event.ID())
+			logger(LogComponentReceiver).Warnw("Failed to echo event", "id", event.ID(), "error", err)
+			received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, Nacked: true, Sink: sink, Path: req.URL.Path, Endpoint: endpoint, ContentMode: contentMode, Compressed: compression.compressed, DataChecksum: payload.checksum, ContentType: req.Header.Get("Content-Type"), DeliverySource: source}
+			return &statusCodeError{statusCode: http.StatusBadGateway, message: err.Error()}
+		}
+		received <- ReceivedEvent{Event: *event, ReceivedAt: receivedAt, Replica: instance, Sink: sink, Path: req.URL.Path, Endpoint: endpoint, ContentMode: contentMode, Compressed: compression.compressed, DataChecksum: payload.checksum, ContentType: req.Header.Get("Content-Type"), DeliverySource: source}
 
 		return nil
+	}
+	now := func() time.Time { return time.Now().Add(-clockOffset) }
+	err := runDisruptedReceiver(innerCtx, config.Disruptions, sm, now, func(ctx context.Context) error {
+		return startReceiver(ctx, &config, delays, handle)
 	})
 	if err != nil {
 		select {
 		case <-innerCtx.Done():
 			// There is not way ATM to know whether the receiver has been terminated because of the cancelled context or
 			// because there was an error, so if context is done suppress the error.
-			log.Println(err)
+			logger(LogComponentReceiver).Infow("Receiver stopped", "error", err)
 		default:
 			return fmt.Errorf("failed to start receiver: %w", err)
 		}
@@ -109,6 +324,80 @@ func StartReceiver(ctx context.Context, config ReceiverConfig, received chan<- c
 	return nil
 }
 
+// waitReceiverTermination waits for the receiver timeout or, when a quiet period is configured, until no events have
+// been received for the quiet period, whichever comes first. The receiver also terminates once complete is closed.
+//
+// When draining is configured, the timeout is extended as long as events keep arriving at the minimum rate, received
+// is the number of events received so far.
+//
+// Once aborted is closed, the receiver waits at most the grace period.
+func waitReceiverTermination(config *ReceiverConfig, lastReceived func() time.Time, received func() int64, complete <-chan struct{}, aborted <-chan struct{}) {
+	deadline := time.Now().Add(config.ParsedTimeout)
+	timeout := time.NewTimer(config.ParsedTimeout)
+	defer timeout.Stop()
+
+	drain := newDrainer(config.Drain, received, time.Now())
+	var window <-chan time.Time
+	if drain != nil {
+		t := time.NewTimer(time.Until(drain.windowStart(deadline)))
+		defer t.Stop()
+		window = t.C
+	}
+
+	var check <-chan time.Time
+	if config.ParsedQuietPeriod > 0 {
+		interval := config.ParsedQuietPeriod / 10
+		if interval > time.Second {
+			interval = time.Second
+		} else if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		check = ticker.C
+	}
+
+	start := time.Now()
+	for {
+		select {
+		case <-window:
+			window = nil
+			drain.startWindow()
+		case <-timeout.C:
+			if extension := drain.extension(time.Now()); extension > 0 {
+				deadline = time.Now().Add(extension)
+				timeout.Reset(extension)
+				continue
+			}
+			logger(LogComponentReceiver).Info("Receiver timeout reached")
+			return
+		case <-aborted:
+			aborted = nil
+			// The grace period is the maximum time the receiver keeps receiving events once aborted.
+			drain = nil
+			if config.ParsedGracePeriod > 0 && time.Now().Add(config.ParsedGracePeriod).Before(deadline) {
+				logger(LogComponentReceiver).Infow("Test aborted, draining the receiver", "gracePeriod", config.ParsedGracePeriod)
+				if !timeout.Stop() {
+					<-timeout.C
+				}
+				timeout.Reset(config.ParsedGracePeriod)
+			}
+		case <-complete:
+			logger(LogComponentReceiver).Info("All sent events received, terminating receiver")
+			return
+		case now := <-check:
+			last := lastReceived()
+			if last.Before(start) {
+				last = start
+			}
+			if now.Sub(last) >= config.ParsedQuietPeriod {
+				logger(LogComponentReceiver).Infow("No events received for the quiet period, terminating receiver", "quietPeriod", config.ParsedQuietPeriod)
+				return
+			}
+		}
+	}
+}
+
 func addRequestLabels(req *http.Request, config *ReceiverConfig, latencyHistogramLabels []attribute.KeyValue) []attribute.KeyValue {
 	labels := make([]attribute.KeyValue, 0, len(latencyHistogramLabels)+2)
 	copy(labels, latencyHistogramLabels)
@@ -123,18 +412,42 @@ func addRequestLabels(req *http.Request, config *ReceiverConfig, latencyHistogra
 	return labels
 }
 
-func maybeSleep(config ReceiverConfig) {
-	if config.ReceiverFaultConfig == nil || config.ReceiverFaultConfig.MinSleepDuration == nil {
+func maybeSleep(config *ReceiverFaultConfig, r *rand.Rand) {
+	if config == nil || config.MinSleepDuration == nil {
 		return
 	}
 
-	max := *config.ReceiverFaultConfig.MaxSleepDuration
-	min := *config.ReceiverFaultConfig.MinSleepDuration
+	if p := config.SleepPercentage; p != nil && r.Intn(100) >= *p {
+		return
+	}
+
+	max := *config.MaxSleepDuration
+	min := *config.MinSleepDuration
 
-	time.Sleep(min + time.Duration(rand.Int63n(int64(max-min))))
+	if max == min {
+		time.Sleep(min)
+		return
+	}
+	time.Sleep(min + time.Duration(r.Int63n(int64(max-min))))
 }
 
-func exportMetrics(ctx context.Context) (wait func()) {
+// faultStatusCode returns the status code of the failure response to inject, or 0 for a successful response.
+func faultStatusCode(config *ReceiverFaultConfig, r *rand.Rand) int {
+	if config == nil || len(config.Responses) == 0 {
+		return 0
+	}
+
+	n := r.Intn(100)
+	for _, r := range config.Responses {
+		if n < r.Percentage {
+			return r.StatusCode
+		}
+		n -= r.Percentage
+	}
+	return 0
+}
+
+func exportMetrics(ctx context.Context, inFlightRequests func() int64, sm *StateManager) (wait func()) {
 	config := prometheus.Config{
 		DefaultHistogramBoundaries: []float64{
 			10, 20, 50, 100, 500, 1000, // < 1s
@@ -183,28 +496,55 @@ func exportMetrics(ctx context.Context) (wait func()) {
 	if err != nil {
 		panic(err)
 	}
+	rejectedRequestsCounter, err = meter.SyncInt64().Counter("requests_rejected_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of requests rejected because of a missing or invalid bearer token"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	suppressedDuplicatesCounter, err = meter.SyncInt64().Counter("duplicates_suppressed_total",
+		instrument.WithUnit(unit.Dimensionless),
+		instrument.WithDescription("Number of duplicates suppressed by the receiver"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	if err := registerInFlightRequestsGauge(meter, inFlightRequests); err != nil {
+		panic(err)
+	}
+	if sm != nil {
+		if err := sm.registerMetrics(meter); err != nil {
+			panic(err)
+		}
+	}
 
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
 
+		mux := http.NewServeMux()
+		mux.Handle("/", promExporter)
+		if sm != nil && sm.latencyHistogram != nil {
+			mux.Handle(LatencyHistogramPath, sm.latencyHistogram)
+		}
 		s := http.Server{
-			Handler: http.HandlerFunc(promExporter.ServeHTTP),
+			Handler: mux,
 			Addr:    ":9090",
 		}
 		defer s.Close()
 
 		go func() {
 			if err := s.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-				log.Fatal(err)
+				logger(LogComponentReceiver).Fatalw("Metrics server failed", "error", err)
 			}
 		}()
 
 		<-ctx.Done()
 		scrapeMetrics()
 
-		log.Println("Metrics server closed")
+		logger(LogComponentReceiver).Info("Metrics server closed")
 	}()
 
 	return wg.Wait
@@ -222,39 +562,138 @@ func scrapeMetrics() {
 	if err != nil {
 		panic(err)
 	}
-	log.Println("Metrics\n", string(body))
+	logger(LogComponentReport).Infof("Metrics\n%s", body)
 }
 
-func startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *event.Event, *http.Request) error) error {
-	s := http.Server{
-		Addr: fmt.Sprintf(":%d", config.Port),
-		Handler: http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
-			start := time.Now()
-			defer func() {
-				processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(r, config, processingLatencyHistogramLabels)...)
-			}()
+// eventsFromRequest returns the events of the given request, which is either a single event in any mode or a batch of
+// events in the application/cloudevents-batch+json format.
+func eventsFromRequest(ctx context.Context, r *http.Request) ([]*event.Event, error) {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get(cehttp.ContentType)); mediaType != event.ApplicationCloudEventsBatchJSON {
+		e, err := binding.ToEvent(ctx, cehttp.NewMessageFromHttpRequest(r))
+		if err != nil {
+			return nil, err
+		}
+		return []*event.Event{e}, nil
+	}
 
-			msg := cehttp.NewMessageFromHttpRequest(r)
-			e, err := binding.ToEvent(ctx, msg)
-			if err != nil {
+	var events []*event.Event
+	if err := json.NewDecoder(r.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to decode batch: %w", err)
+	}
+	for i, e := range events {
+		if e == nil {
+			return nil, fmt.Errorf("invalid event %d in batch: null", i)
+		}
+		if err := e.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid event %d in batch: %w", i, err)
+		}
+	}
+	return events, nil
+}
+
+func startReceiver(ctx context.Context, config *ReceiverConfig, delays *rand.Rand, h func(context.Context, *event.Event, *http.Request) error) error {
+	if b, ok := protocolBindings[config.Protocol]; ok {
+		return b.startReceiver(ctx, config, h)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Parsed
+	}
+
+	var grpcServer *grpc.Server
+	if config.Protocol == ProtocolGRPC {
+		grpcServer = newGRPCServer(ctx, h)
+	}
+	var handler http.Handler = slowConsumerHandler(config.SlowConsumer, liveSettingsFromContext(ctx), delays, http.HandlerFunc(func(writer http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		defer func() {
+			processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(r, config, processingLatencyHistogramLabels)...)
+		}()
+
+		if config.Protocol == ProtocolGRPC {
+			serveGRPC(grpcServer, writer, r)
+			return
+		}
+
+		r, mangled := decompressRequest(r)
+		if compressionFromRequest(r).mangled {
+			// The events identified by the request headers are recorded as mangled in transit.
+			for _, e := range mangled {
+				_ = h(ctx, e, r)
+			}
+			http.Error(writer, errMangled.Error(), errMangled.statusCode)
+			return
+		}
+
+		if config.StreamPayloads {
+			var err error
+			if r, err = streamRequestBody(r); err != nil {
 				http.Error(writer, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if err := h(ctx, e, r); err != nil {
-				http.Error(writer, err.Error(), http.StatusInternalServerError)
-				return
+		}
+
+		events, err := eventsFromRequest(ctx, r)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Every event of a batch is handled, the response is the one of the first failure.
+		var handlerErr error
+		for _, e := range events {
+			if err := h(ctx, e, r); err != nil && handlerErr == nil {
+				handlerErr = err
 			}
-			writer.WriteHeader(http.StatusOK)
-		}),
+		}
+		if handlerErr != nil {
+			statusCode := http.StatusInternalServerError
+			var sce *statusCodeError
+			if errors.As(handlerErr, &sce) {
+				statusCode = sce.statusCode
+			}
+			config.Response.writeHeaders(writer)
+			http.Error(writer, handlerErr.Error(), statusCode)
+			return
+		}
+		config.Response.writeSuccess(ctx, writer, events)
+	}))
+	if l := requestLogFromContext(ctx); l != nil {
+		handler = l.handler(handler)
+	}
+	if p := receiverProbesFromContext(ctx); p != nil {
+		handler = p.handler(handler)
 	}
+	if config.Protocol == ProtocolGRPC && tlsConfig == nil {
+		// Plaintext gRPC connections use HTTP/2 with prior knowledge.
+		handler = h2c.NewHandler(handler, &http2.Server{})
+	}
+	var hijacked hijackedConns
+	s := http.Server{
+		Addr:      fmt.Sprintf(":%d", config.Port),
+		TLSConfig: tlsConfig,
+		Handler:   handler,
+		ConnState: hijacked.connState,
+	}
+
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	markReceiverReady(ctx)
 
 	errChan := make(chan error, 1)
 	go func() {
-		errChan <- s.ListenAndServe()
+		if s.TLSConfig != nil {
+			errChan <- s.ServeTLS(l, "", "")
+			return
+		}
+		errChan <- s.Serve(l)
 	}()
 
 	select {
 	case <-ctx.Done():
+		hijacked.close()
 		return s.Close()
 	case err := <-errChan:
 		return err
@@ -2,16 +2,26 @@ package sacura
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
 func TestStartReceiverContextCancelled(t *testing.T) {
 
 	ctx, cancel := context.WithCancel(context.Background())
-	received := make(chan ce.Event)
+	received := make(chan ReceivedEvent)
 
 	go func() {
 		defer cancel()
@@ -19,7 +29,7 @@ func TestStartReceiverContextCancelled(t *testing.T) {
 		<-time.After(time.Second)
 	}()
 
-	err := StartReceiver(ctx, ReceiverConfig{Port: 9201}, received)
+	err := StartReceiver(ctx, ReceiverConfig{Port: 9201}, received, nil)
 
 	if err != nil {
 		t.Fatal("expected nil, got", err)
@@ -27,3 +37,406 @@ func TestStartReceiverContextCancelled(t *testing.T) {
 
 	<-ctx.Done()
 }
+
+func TestStartReceiverStateMetrics(t *testing.T) {
+
+	sent := make(chan ce.Event, 2)
+	sm := newTestStateManager(t, Config{})
+	sentSignal := sm.ReadSent(sent)
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	close(sent)
+	<-sentSignal
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9202}, received, sm)
+	}()
+
+	var body string
+	err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		resp, err := http.Get("http://localhost:9090/metrics")
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return false, err
+		}
+		body = string(b)
+		return strings.Contains(body, "events_sent_total"), nil
+	})
+	cancel()
+	if err != nil {
+		t.Fatal("failed to scrape metrics", err, body)
+	}
+
+	for name, value := range map[string]int{"events_sent_total": 2, "events_received_total": 0, "events_lost": 2} {
+		if !regexp.MustCompile(fmt.Sprintf(`(?m)^%s(\{.*\})? %d$`, name, value)).MatchString(body) {
+			t.Errorf("expected %s %d in metrics, got:\n%s", name, value, body)
+		}
+	}
+
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestFaultStatusCode(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		config ReceiverConfig
+		want   int
+	}{
+		{
+			name:   "no fault config",
+			config: ReceiverConfig{},
+			want:   0,
+		},
+		{
+			name: "no responses",
+			config: ReceiverConfig{ReceiverFaultConfig: &ReceiverFaultConfig{
+				Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusTooManyRequests, Percentage: 0}},
+			}},
+			want: 0,
+		},
+		{
+			name: "all requests",
+			config: ReceiverConfig{ReceiverFaultConfig: &ReceiverFaultConfig{
+				Responses: []ReceiverFaultResponseConfig{
+					{StatusCode: http.StatusTooManyRequests, Percentage: 0},
+					{StatusCode: http.StatusServiceUnavailable, Percentage: 100},
+				},
+			}},
+			want: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				if got := faultStatusCode(tt.config.ReceiverFaultConfig, newRand(nil, "receiver.fault")); got != tt.want {
+					t.Fatalf("expected status code %d, got %d", tt.want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStartReceiverFaultResponses(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Port: 9203,
+			ReceiverFaultConfig: &ReceiverFaultConfig{
+				Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusServiceUnavailable, Percentage: 100}},
+			},
+		}, received, nil)
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statusCode int
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		resp, err := http.Post("http://localhost:9203", "application/cloudevents+json", strings.NewReader(string(body)))
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+		statusCode = resp.StatusCode
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal("failed to send event", err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, statusCode)
+	}
+	if r := <-received; !r.Nacked || r.Event.ID() != e.ID() {
+		t.Errorf("expected nacked event %s, got %+v", e.ID(), r)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestStartReceiverDeadLetterSink(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Port:               9204,
+			DeadLetterSinkPath: "/dls",
+			// Failure responses are not injected on the dead-letter sink.
+			ReceiverFaultConfig: &ReceiverFaultConfig{
+				Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusServiceUnavailable, Percentage: 100}},
+			},
+		}, received, nil)
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var statusCode int
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		resp, err := http.Post("http://localhost:9204/dls", "application/cloudevents+json", strings.NewReader(string(body)))
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+		statusCode = resp.StatusCode
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal("failed to send event", err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, statusCode)
+	}
+	if r := <-received; !r.DeadLettered || r.Nacked {
+		t.Errorf("expected dead-lettered event, got %+v", r)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestStartReceiverAuth(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Port: 9206,
+			Auth: &ReceiverAuthConfig{Token: "token"},
+		}, received, nil)
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(authorization string) (int, error) {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:9206", strings.NewReader(string(body)))
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Content-Type", "application/cloudevents+json")
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	var statusCode int
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		statusCode, err = post("")
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatal("failed to send event", err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code %d without token, got %d", http.StatusUnauthorized, statusCode)
+	}
+	if statusCode, err := post("Bearer wrong"); err != nil || statusCode != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with wrong token, got %d %v", http.StatusUnauthorized, statusCode, err)
+	}
+	if statusCode, err := post("Bearer token"); err != nil || statusCode != http.StatusOK {
+		t.Errorf("expected status code %d with valid token, got %d %v", http.StatusOK, statusCode, err)
+	}
+	if r := <-received; r.Event.ID() != e.ID() {
+		t.Errorf("expected event %s, got %+v", e.ID(), r)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestWaitReceiverTermination(t *testing.T) {
+
+	tests := []struct {
+		name string
+		// receiving is how long events keep being received.
+		receiving time.Duration
+		// abortAfter is when the test is aborted, the test is not aborted when zero.
+		abortAfter time.Duration
+		// completeAfter is when all sent events have been received, completion isn't detected when zero.
+		completeAfter time.Duration
+		config        ReceiverConfig
+		min           time.Duration
+		max           time.Duration
+	}{
+		{
+			name:   "timeout",
+			config: ReceiverConfig{ParsedTimeout: 100 * time.Millisecond},
+			min:    100 * time.Millisecond,
+			max:    time.Second,
+		},
+		{
+			name:      "quiet period",
+			receiving: 200 * time.Millisecond,
+			config:    ReceiverConfig{ParsedTimeout: 10 * time.Second, ParsedQuietPeriod: 100 * time.Millisecond},
+			min:       300 * time.Millisecond,
+			max:       2 * time.Second,
+		},
+		{
+			name:      "timeout before quiet period",
+			receiving: 10 * time.Second,
+			config:    ReceiverConfig{ParsedTimeout: 200 * time.Millisecond, ParsedQuietPeriod: 100 * time.Millisecond},
+			min:       200 * time.Millisecond,
+			max:       2 * time.Second,
+		},
+		{
+			name:          "all events received",
+			receiving:     10 * time.Second,
+			completeAfter: 200 * time.Millisecond,
+			config:        ReceiverConfig{ParsedTimeout: 10 * time.Second, ParsedQuietPeriod: time.Second},
+			min:           200 * time.Millisecond,
+			max:           time.Second,
+		},
+		{
+			name:          "all events received without quiet period",
+			completeAfter: 200 * time.Millisecond,
+			config:        ReceiverConfig{ParsedTimeout: 10 * time.Second},
+			min:           200 * time.Millisecond,
+			max:           time.Second,
+		},
+		{
+			name:       "grace period after abort",
+			abortAfter: 100 * time.Millisecond,
+			config:     ReceiverConfig{ParsedTimeout: 10 * time.Second, ParsedGracePeriod: 200 * time.Millisecond},
+			min:        300 * time.Millisecond,
+			max:        2 * time.Second,
+		},
+		{
+			name:       "timeout before grace period",
+			abortAfter: 100 * time.Millisecond,
+			config:     ReceiverConfig{ParsedTimeout: 200 * time.Millisecond, ParsedGracePeriod: 200 * time.Millisecond},
+			min:        200 * time.Millisecond,
+			max:        time.Second,
+		},
+		{
+			name:       "abort without grace period",
+			abortAfter: 50 * time.Millisecond,
+			config:     ReceiverConfig{ParsedTimeout: 300 * time.Millisecond},
+			min:        300 * time.Millisecond,
+			max:        2 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			lastReceived := func() time.Time {
+				if now := time.Now(); now.Sub(start) < tt.receiving {
+					return now
+				}
+				return start.Add(tt.receiving)
+			}
+
+			var aborted chan struct{}
+			if tt.abortAfter > 0 {
+				aborted = make(chan struct{})
+				time.AfterFunc(tt.abortAfter, func() { close(aborted) })
+			}
+
+			var complete chan struct{}
+			if tt.completeAfter > 0 {
+				complete = make(chan struct{})
+				time.AfterFunc(tt.completeAfter, func() { close(complete) })
+			}
+
+			waitReceiverTermination(&tt.config, lastReceived, func() int64 { return 0 }, complete, aborted)
+
+			if elapsed := time.Since(start); elapsed < tt.min || elapsed > tt.max {
+				t.Errorf("expected termination after %v to %v, got %v", tt.min, tt.max, elapsed)
+			}
+		})
+	}
+}
+
+func TestStartReceiverBatch(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 3)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9207}, received, nil)
+	}()
+
+	sent := make(chan ce.Event, 3)
+	f := NewTargeterGenerator(Config{Sender: SenderConfig{Target: "http://localhost:9207", BatchSize: 3}}, uuid.New, sent)
+	target := vegeta.Target{}
+	if err := f(&target); err != nil {
+		t.Fatal(err)
+	}
+	close(sent)
+
+	post := func(body string) (int, error) {
+		resp, err := http.Post(target.URL, target.Header.Get(cehttp.ContentType), strings.NewReader(body))
+		if err != nil {
+			return 0, err
+		}
+		defer resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	var statusCode int
+	err := wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		statusCode, err = post(string(target.Body))
+		return err == nil, nil
+	})
+	if err != nil {
+		t.Fatal("failed to send batch", err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("expected status code %d, got %d", http.StatusOK, statusCode)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	if statusCode, err := post(`[{"specversion":"1.0"}]`); err != nil || statusCode != http.StatusBadRequest {
+		t.Errorf("expected status code %d for invalid batch, got %d %v", http.StatusBadRequest, statusCode, err)
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
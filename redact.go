@@ -0,0 +1,110 @@
+package sacura
+
+import (
+	"net/url"
+	"reflect"
+)
+
+// redactedSecret replaces secrets, like url.URL.Redacted replaces passwords.
+const redactedSecret = "xxxxx"
+
+// Redacted returns a copy of the config with the secrets replaced, so that it can be logged or printed. Fields with
+// the tag secret:"true" are secrets, fields with the tag secret:"url" are URLs whose password is a secret.
+//
+// Nested structs containing secrets are copied, the config itself is left unchanged.
+func (c Config) Redacted() Config {
+	redactValue(reflect.ValueOf(&c).Elem(), map[reflect.Type]bool{})
+	return c
+}
+
+// redactValue replaces the secrets of the given settable value, copying the pointers, slices and maps leading to them.
+func redactValue(v reflect.Value, secrets map[reflect.Type]bool) {
+	if !hasSecrets(v.Type(), secrets) {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.New(v.Type().Elem())
+		c.Elem().Set(v.Elem())
+		redactValue(c.Elem(), secrets)
+		v.Set(c)
+	case reflect.Slice:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		reflect.Copy(c, v)
+		for i := 0; i < c.Len(); i++ {
+			redactValue(c.Index(i), secrets)
+		}
+		v.Set(c)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			redactValue(v.Index(i), secrets)
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			return
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(iter.Value())
+			redactValue(e, secrets)
+			c.SetMapIndex(iter.Key(), e)
+		}
+		v.Set(c)
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			f := v.Field(i)
+			if !f.CanSet() {
+				continue
+			}
+			switch v.Type().Field(i).Tag.Get("secret") {
+			case "true":
+				if f.String() != "" {
+					f.SetString(redactedSecret)
+				}
+			case "url":
+				if u, err := url.Parse(f.String()); err == nil {
+					f.SetString(u.Redacted())
+				} else if f.String() != "" {
+					f.SetString(redactedSecret)
+				}
+			default:
+				redactValue(f, secrets)
+			}
+		}
+	}
+}
+
+// hasSecrets reports whether values of the given type contain fields tagged as secrets.
+func hasSecrets(t reflect.Type, secrets map[reflect.Type]bool) bool {
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+		return hasSecrets(t.Elem(), secrets)
+	case reflect.Struct:
+		if has, ok := secrets[t]; ok {
+			return has
+		}
+		// Recursive types are assumed not to contain secrets while they are visited.
+		secrets[t] = false
+		has := false
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if f.Tag.Get("secret") != "" || hasSecrets(f.Type, secrets) {
+				has = true
+			}
+		}
+		secrets[t] = has
+		return has
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package sacura
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// DefaultRedisStateKey is the Redis list sent and received events are appended to when none is configured.
+const DefaultRedisStateKey = "sacura:state"
+
+const (
+	redisConnectTimeout = 30 * time.Second
+	// redisReplayBatch is the number of entries fetched at a time when replaying the shared state.
+	redisReplayBatch = 10000
+)
+
+// RedisStateConfig stores sent and received events in a Redis list shared by the instances of a test, for example a
+// sender in one cluster and a receiver in another, so that any of them can produce the final report.
+//
+// Instances append their events to the list while the test is running, the final report of a run is generated from
+// all the events of the list: a run with the receiver enabled verifies the events of every instance once it
+// terminates, `sacura verify` without state journals verifies them once all runs terminated.
+type RedisStateConfig struct {
+	// URL is the URL of the Redis server, redis://[user:password@]host[:port][/db], rediss:// connects with TLS.
+	URL string `json:"url" yaml:"url" secret:"url"`
+	// Key is the list events are appended to, it must be unique to the test since events already in the list are
+	// verified together with the events of the test.
+	//
+	// Defaults to DefaultRedisStateKey.
+	Key string `json:"key" yaml:"key"`
+}
+
+func (c *RedisStateConfig) validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil {
+		return invalidErr("state.redis.url", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return invalidErr("state.redis.url", fmt.Errorf("unsupported scheme %q, expected redis or rediss", u.Scheme))
+	}
+	if u.Hostname() == "" {
+		return invalidErr("state.redis.url", errors.New("host cannot be empty"))
+	}
+	if _, err := redis.ParseURL(c.URL); err != nil {
+		return invalidErr("state.redis.url", err)
+	}
+	if c.Key == "" {
+		c.Key = DefaultRedisStateKey
+	}
+	return nil
+}
+
+// newRedisClient returns a client of the server of the given config, the client authenticates with the credentials
+// of the URL, selects its database and reconnects when connections are lost.
+func newRedisClient(config *RedisStateConfig) (*redis.Client, error) {
+	opts, err := redis.ParseURL(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	opts.DialTimeout = redisConnectTimeout
+	return redis.NewClient(opts), nil
+}
+
+// redisStrings returns the given values as string arguments of a command.
+func redisStrings(values [][]byte) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = string(v)
+	}
+	return args
+}
+
+// openRedisJournal returns a journal appending entries to the list of the given config.
+func openRedisJournal(ctx context.Context, config *RedisStateConfig) (*stateJournal, error) {
+	c, err := newRedisClient(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Ping(ctx).Err(); err != nil {
+		_ = c.Close()
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &stateJournal{redis: c, redisKey: config.Key}, nil
+}
+
+// replayRedis replays the entries of the list of the given config, it must be called while holding the lock.
+func (s *StateManager) replayRedis(ctx context.Context, config *RedisStateConfig) (sent int, received int, err error) {
+	c, err := newRedisClient(config)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer c.Close()
+
+	for start := 0; ; start += redisReplayBatch {
+		values, err := c.LRange(ctx, config.Key, int64(start), int64(start+redisReplayBatch-1)).Result()
+		if err != nil {
+			return sent, received, err
+		}
+		var b bytes.Buffer
+		for _, v := range values {
+			b.WriteString(v)
+			b.WriteByte('\n')
+		}
+		n, m, _, err := s.replayEntries(bufio.NewReader(&b))
+		sent += n
+		received += m
+		if err != nil {
+			return sent, received, fmt.Errorf("entry %d: %w", start, err)
+		}
+		if len(values) < redisReplayBatch {
+			return sent, received, nil
+		}
+	}
+}
+
+// sharedReport returns the report of the events appended to the Redis list by every instance of the test, the
+// metrics of this instance account for the events sent by every instance as accepted.
+func sharedReport(ctx context.Context, config Config, metrics Metrics) (Report, error) {
+	config.Sender.Disabled = false
+	config.Receiver.Disabled = false
+	config.Receiver.ExitWhenComplete = false
+	shared := config.State.Redis
+	config.State = nil
+	config.Report.EventLog = nil
+
+	sm, err := NewStateManager(config)
+	if err != nil {
+		return Report{}, err
+	}
+	sm.lock.Lock()
+	sent, received, err := sm.replayRedis(ctx, shared)
+	sm.lock.Unlock()
+	if err != nil {
+		return Report{}, fmt.Errorf("failed to replay shared state %s: %w", shared.Key, err)
+	}
+	logger(LogComponentState).Infow("Replayed shared state", "sent", sent, "received", received, "key", shared.Key)
+
+	metrics.ProposedCount += sent - metrics.AcceptedCount
+	metrics.AcceptedCount = sent
+	sm.Terminated(metrics)
+	return sm.GenerateReport(), nil
+}
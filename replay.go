@@ -0,0 +1,199 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// RecordConfig records sent events, so that a later run can re-send them with sender.replay.
+type RecordConfig struct {
+	// Path is the file sent events are written to, one JSON entry per line with the offset at which the event has
+	// been sent.
+	Path string `json:"path" yaml:"path"`
+}
+
+// ReplayConfig re-sends events recorded with sender.record instead of generating new events, so that a failure can
+// be reproduced with the same events, in the same order and with the same pacing.
+type ReplayConfig struct {
+	// Path is the file written by sender.record.
+	Path string `json:"path" yaml:"path"`
+	// Speed scales the recorded pacing, 2 replays events twice as fast and 0.5 at half the speed.
+	//
+	// Defaults to 1, the original pacing.
+	Speed float64 `json:"speed" yaml:"speed"`
+
+	Parsed []recordedEvent `json:"-" yaml:"-"`
+}
+
+// recordedEvent is a single line of a record file.
+type recordedEvent struct {
+	// Offset is the time elapsed between the first recorded event and the event.
+	Offset time.Duration `json:"offset"`
+	Event  ce.Event      `json:"event"`
+}
+
+func (c *RecordConfig) validate() error {
+	if c.Path == "" {
+		return invalidErr("sender.record.path", errors.New("cannot be empty"))
+	}
+	return nil
+}
+
+func (c *ReplayConfig) validate(sender *SenderConfig) error {
+	if c.Path == "" {
+		return invalidErr("sender.replay.path", errors.New("cannot be empty"))
+	}
+	if c.Speed < 0 {
+		return invalidErr("sender.replay.speed", fmt.Errorf("%v cannot be negative", c.Speed))
+	}
+	if c.Speed == 0 {
+		c.Speed = 1
+	}
+	if sender.LoadProfile != nil {
+		return invalidErr("sender.replay", errors.New("cannot be used with sender.loadProfile, events are paced as recorded"))
+	}
+	if sender.Record != nil && sender.Record.Path == c.Path {
+		return invalidErr("sender.record.path", fmt.Errorf("%q is the replayed file", c.Path))
+	}
+
+	events, err := readRecordedEvents(c.Path)
+	if err != nil {
+		return invalidErr("sender.replay.path", err)
+	}
+	if len(events) == 0 {
+		return invalidErr("sender.replay.path", fmt.Errorf("no events recorded in %s", c.Path))
+	}
+	c.Parsed = events
+	return nil
+}
+
+func readRecordedEvents(path string) ([]recordedEvent, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var events []recordedEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		e := recordedEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("invalid entry at line %d: %w", line, err)
+		}
+		events = append(events, e)
+	}
+	return events, scanner.Err()
+}
+
+// eventRecorder writes sent events to a record file.
+type eventRecorder struct {
+	f     *os.File
+	w     *bufio.Writer
+	enc   *json.Encoder
+	start time.Time
+}
+
+func newEventRecorder(config *RecordConfig) (*eventRecorder, error) {
+	f, err := os.Create(config.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create record file: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	return &eventRecorder{f: f, w: w, enc: json.NewEncoder(w)}, nil
+}
+
+// record writes the given event sent at the given time, it is not safe for concurrent use.
+func (r *eventRecorder) record(e *ce.Event, at time.Time) {
+	if r.start.IsZero() {
+		r.start = at
+	}
+	if err := r.enc.Encode(recordedEvent{Offset: at.Sub(r.start), Event: *e}); err != nil {
+		logger(LogComponentSender).Errorw("Failed to record event", "id", e.ID(), "error", err)
+	}
+}
+
+func (r *eventRecorder) close() error {
+	if err := r.w.Flush(); err != nil {
+		_ = r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+// errReplayed is returned once all recorded events have been replayed.
+var errReplayed = errors.New("all recorded events have been replayed")
+
+// replaySource returns recorded events in order, it is safe for concurrent use.
+type replaySource struct {
+	lock   sync.Mutex
+	events []recordedEvent
+	next   int
+}
+
+func newReplaySource(config *ReplayConfig) *replaySource {
+	return &replaySource{events: config.Parsed}
+}
+
+// nextEvent returns the next recorded event, timestamped with the given send time.
+func (s *replaySource) nextEvent(now time.Time) (ce.Event, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.next >= len(s.events) {
+		return ce.Event{}, errReplayed
+	}
+	event := s.events[s.next].Event.Clone()
+	s.next++
+
+	// The latency is measured from the time the event is replayed.
+	setSentTimestamp(&event, now)
+	return event, nil
+}
+
+// replayPacer paces requests following the recorded offset of the first event of each request.
+type replayPacer []time.Duration
+
+var _ vegeta.Pacer = replayPacer(nil)
+
+func newReplayPacer(config *ReplayConfig, batchSize int) replayPacer {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	offsets := make(replayPacer, 0, len(config.Parsed)/batchSize+1)
+	for i := 0; i < len(config.Parsed); i += batchSize {
+		offsets = append(offsets, time.Duration(float64(config.Parsed[i].Offset)/config.Speed))
+	}
+	return offsets
+}
+
+// Pace implements vegeta.Pacer.
+func (p replayPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	if hits >= uint64(len(p)) {
+		return 0, true
+	}
+	if next := p[hits]; next > elapsed {
+		return next - elapsed, false
+	}
+	return 0, false
+}
+
+// Rate implements vegeta.Pacer, it is the number of requests recorded in the second following elapsed.
+func (p replayPacer) Rate(elapsed time.Duration) float64 {
+	from := sort.Search(len(p), func(i int) bool { return p[i] >= elapsed })
+	to := sort.Search(len(p), func(i int) bool { return p[i] >= elapsed+time.Second })
+	return float64(to - from)
+}
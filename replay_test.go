@@ -0,0 +1,153 @@
+package sacura
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	recorder, err := newEventRecorder(&RecordConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	var recorded []ce.Event
+	for i := 0; i < 5; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension("index", fmt.Sprint(i))
+		recorder.record(&e, start.Add(time.Duration(i)*time.Second))
+		recorded = append(recorded, e)
+	}
+	if err := recorder.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	config := Config{Sender: SenderConfig{Target: "http://localhost:9090", BatchSize: 2, Replay: &ReplayConfig{Path: path, Speed: 2}}}
+	if err := config.Sender.Replay.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+
+	wantOffsets := replayPacer{0, time.Second, 2 * time.Second}
+	if diff := cmp.Diff(wantOffsets, newReplayPacer(config.Sender.Replay, config.Sender.BatchSize)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	out := make(chan ce.Event, len(recorded))
+	f := NewTargeterGenerator(config, uuid.New, out)
+	for i := 0; i < 3; i++ {
+		if err := f(&vegeta.Target{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f(&vegeta.Target{}); err == nil {
+		t.Error("expected error once all recorded events have been replayed")
+	}
+	close(out)
+
+	i := 0
+	for e := range out {
+		if e.ID() != recorded[i].ID() || e.Extensions()["index"] != recorded[i].Extensions()["index"] || string(e.Data()) != string(recorded[i].Data()) {
+			t.Errorf("expected replayed event %d to match the recorded event, got %s", i, e)
+		}
+		i++
+	}
+	if i != len(recorded) {
+		t.Errorf("expected %d replayed events, got %d", len(recorded), i)
+	}
+}
+
+func TestReplayPacer(t *testing.T) {
+
+	p := replayPacer{0, time.Second, time.Second, 3 * time.Second}
+
+	tests := []struct {
+		elapsed  time.Duration
+		hits     uint64
+		wantWait time.Duration
+		wantStop bool
+	}{
+		{elapsed: 0, hits: 0},
+		{elapsed: 100 * time.Millisecond, hits: 1, wantWait: 900 * time.Millisecond},
+		{elapsed: 2 * time.Second, hits: 2},
+		{elapsed: 2 * time.Second, hits: 3, wantWait: time.Second},
+		{elapsed: 3 * time.Second, hits: 4, wantStop: true},
+	}
+	for _, tt := range tests {
+		wait, stop := p.Pace(tt.elapsed, tt.hits)
+		if wait != tt.wantWait || stop != tt.wantStop {
+			t.Errorf("Pace(%v, %d) expected %v %v, got %v %v", tt.elapsed, tt.hits, tt.wantWait, tt.wantStop, wait, stop)
+		}
+	}
+
+	if got := p.Rate(500 * time.Millisecond); got != 2 {
+		t.Errorf("expected rate 2, got %v", got)
+	}
+}
+
+func TestReplayConfigValidate(t *testing.T) {
+
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty.jsonl")
+	if err := os.WriteFile(empty, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalid := filepath.Join(dir, "invalid.jsonl")
+	if err := os.WriteFile(invalid, []byte("{\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		sender SenderConfig
+	}{
+		{
+			name:   "missing path",
+			sender: SenderConfig{Replay: &ReplayConfig{}},
+		},
+		{
+			name:   "missing file",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: filepath.Join(dir, "missing.jsonl")}},
+		},
+		{
+			name:   "no events",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: empty}},
+		},
+		{
+			name:   "invalid entry",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: invalid}},
+		},
+		{
+			name:   "negative speed",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: empty, Speed: -1}},
+		},
+		{
+			name:   "load profile",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: empty}, LoadProfile: &LoadProfileConfig{}},
+		},
+		{
+			name:   "recording to the replayed file",
+			sender: SenderConfig{Replay: &ReplayConfig{Path: empty}, Record: &RecordConfig{Path: empty}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.Replay.validate(&tt.sender); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
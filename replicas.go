@@ -0,0 +1,74 @@
+package sacura
+
+import (
+	"sort"
+)
+
+// ReplicaReport is the share of received events of a single receiver replica.
+type ReplicaReport struct {
+	// ReceivedCount is the number of events received by the replica, including duplicates.
+	ReceivedCount int `json:"receivedCount"`
+	// PartitionKeys are the partition keys of the events received by the replica.
+	PartitionKeys []string `json:"partitionKeys"`
+}
+
+// recordReplica counts the given event for the replica that received it, it must be called while holding the lock.
+func (s *StateManager) recordReplica(e *ReceivedEvent) {
+	if e.Replica == "" {
+		return
+	}
+	partitions, ok := s.replicas[e.Replica]
+	if !ok {
+		partitions = make(map[string]int)
+		s.replicas[e.Replica] = partitions
+	}
+	partitions[partitionKey(&e.Event, &s.stateManagerConfig)]++
+}
+
+// replicasReport reports the events received by each replica and the partition keys shared by replicas, it must be
+// called while holding the lock.
+func (s *StateManager) replicasReport(r *Report) {
+	if len(s.replicas) == 0 {
+		return
+	}
+
+	r.Replicas = make(map[string]ReplicaReport, len(s.replicas))
+	replicasByPartitionKey := make(map[string][]string)
+	for replica, partitions := range s.replicas {
+		rr := ReplicaReport{PartitionKeys: make([]string, 0, len(partitions))}
+		for pk, n := range partitions {
+			rr.ReceivedCount += n
+			rr.PartitionKeys = append(rr.PartitionKeys, pk)
+			replicasByPartitionKey[pk] = append(replicasByPartitionKey[pk], replica)
+		}
+		sort.Strings(rr.PartitionKeys)
+		r.Replicas[replica] = rr
+	}
+
+	if !s.stateManagerConfig.Ordered {
+		return
+	}
+	for pk, replicas := range replicasByPartitionKey {
+		if len(replicas) < 2 {
+			continue
+		}
+		if r.SharedPartitionKeys == nil {
+			r.SharedPartitionKeys = make(map[string][]string)
+		}
+		sort.Strings(replicas)
+		r.SharedPartitionKeys[pk] = replicas
+	}
+}
+
+// inReceiveOrder returns the given received events of a single partition sorted by receive time when configured, it
+// must be called while holding the lock.
+func (s *StateManager) inReceiveOrder(received []string) []string {
+	if !s.stateManagerConfig.OrderByReceiveTime {
+		return received
+	}
+	sorted := append([]string{}, received...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return s.receivedAt[sorted[i]].Before(s.receivedAt[sorted[j]])
+	})
+	return sorted
+}
@@ -0,0 +1,104 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerReplicas(t *testing.T) {
+	ordered := &OrderedConfig{NumPartitionKeys: 2}
+	aggregator := &DistributedConfig{Role: DistributedRoleAggregator, Port: 9300, ExpectedInstances: 2, ExclusivePartitions: true}
+	config := Config{DeliveryGuarantee: AtLeastOnce, Ordered: ordered, Distributed: aggregator}
+
+	event := func(pk string, seq int) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprintf("%s-%d", pk, seq))
+		e.SetExtension(ordered.partitionKeyExtension(), pk)
+		return e
+	}
+
+	tests := []struct {
+		name           string
+		received       []ReceivedEvent
+		wantReplicas   map[string]ReplicaReport
+		wantShared     map[string][]string
+		wantViolations int
+	}{
+		{
+			name: "partitions assigned to a single replica, recorded out of order",
+			received: func() []ReceivedEvent {
+				start := time.Now()
+				// Replica b forwards its batch first, receive times are in order.
+				return []ReceivedEvent{
+					{Event: event("1", 1), ReceivedAt: start.Add(time.Millisecond), Replica: "b"},
+					{Event: event("1", 2), ReceivedAt: start.Add(3 * time.Millisecond), Replica: "b"},
+					{Event: event("0", 1), ReceivedAt: start, Replica: "a"},
+					{Event: event("0", 2), ReceivedAt: start.Add(2 * time.Millisecond), Replica: "a"},
+				}
+			}(),
+			wantReplicas: map[string]ReplicaReport{
+				"a": {ReceivedCount: 2, PartitionKeys: []string{"0"}},
+				"b": {ReceivedCount: 2, PartitionKeys: []string{"1"}},
+			},
+		},
+		{
+			name: "partition shared by replicas",
+			received: func() []ReceivedEvent {
+				start := time.Now()
+				// Partition 0 moved from replica a to replica b, which forwards its batch first.
+				return []ReceivedEvent{
+					{Event: event("1", 1), ReceivedAt: start, Replica: "b"},
+					{Event: event("0", 2), ReceivedAt: start.Add(time.Millisecond), Replica: "b"},
+					{Event: event("1", 2), ReceivedAt: start.Add(time.Millisecond), Replica: "b"},
+					{Event: event("0", 1), ReceivedAt: start, Replica: "a"},
+				}
+			}(),
+			wantReplicas: map[string]ReplicaReport{
+				"a": {ReceivedCount: 1, PartitionKeys: []string{"0"}},
+				"b": {ReceivedCount: 3, PartitionKeys: []string{"0", "1"}},
+			},
+			wantShared: map[string][]string{"0": {"a", "b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, config)
+			sm.lock.Lock()
+			for _, pk := range []string{"0", "1"} {
+				for seq := 1; seq <= 2; seq++ {
+					e := event(pk, seq)
+					sm.recordSent(&e)
+				}
+			}
+			for i := range tt.received {
+				sm.recordReceived(&tt.received[i])
+			}
+			sm.lock.Unlock()
+			sm.Terminated(Metrics{AcceptedCount: 4})
+
+			report := sm.GenerateReport()
+			if diff := cmp.Diff(tt.wantReplicas, report.Replicas); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if diff := cmp.Diff(tt.wantShared, report.SharedPartitionKeys); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+			if report.OrderingViolationCount != tt.wantViolations {
+				t.Errorf("want %d ordering violations, got %+v", tt.wantViolations, report.OrderingViolationsByPartitionKey)
+			}
+			if d := sm.Diff(); !d.Empty() {
+				t.Errorf("want no differences, got %s", d)
+			}
+
+			if err := verify(config, report); (err != nil) != (len(tt.wantShared) > 0) {
+				t.Errorf("unexpected verification error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// ReplyToExtension is the extension of reply events carrying the ID of the event they reply to.
+const ReplyToExtension = "sacurareplyto"
+
+// validateVerify validates the verification of replies against the given config.
+func (c *ReceiverReplyConfig) validateVerify(config *Config) error {
+	if config.Verification.Mode.streams() {
+		return invalidErr("receiver.response.reply.verify", fmt.Errorf("is not supported in %s verification mode", config.Verification.Mode))
+	}
+	if config.Sender.BatchSize > 1 {
+		return invalidErr("receiver.response.reply.verify", errors.New("cannot be used with sender.batchSize, batches are not replied to"))
+	}
+	return nil
+}
+
+// ReplyReport reports the request/reply round trips of received events, when receiver.response.reply.verify is
+// enabled.
+type ReplyReport struct {
+	// ExpectedCount is the number of received events expecting a reply, excluding events received by the dead-letter
+	// sink.
+	ExpectedCount int `json:"expectedCount"`
+	// ReceivedCount is the number of received events whose reply has been received back, excluding duplicates.
+	ReceivedCount int `json:"receivedCount"`
+	// DuplicateCount is the number of replies received more than once, for example replies to redeliveries.
+	DuplicateCount int `json:"duplicateCount,omitempty"`
+	// MissingCount is the number of received events whose reply has not been received back.
+	MissingCount                int                 `json:"missingCount"`
+	MissingEventsByPartitionKey map[string][]string `json:"missingEvents,omitempty"`
+	// RoundTrip is the latency between sending an event and receiving its reply back.
+	RoundTrip LatencyStats `json:"roundTrip"`
+}
+
+// replyState tracks the replies received back.
+type replyState struct {
+	// replies counts received replies by the ID of the event they reply to.
+	replies   map[string]int
+	roundTrip *latencyHistogram
+}
+
+// newReplyState returns the state of received replies, it returns nil when the verification of replies is disabled.
+func newReplyState(config *ReceiverResponseConfig) *replyState {
+	if config == nil || config.Reply == nil || !config.Reply.Verify {
+		return nil
+	}
+	return &replyState{replies: make(map[string]int), roundTrip: newLatencyHistogram()}
+}
+
+// replyTo returns the ID of the event the given reply event replies to.
+func replyTo(e *ce.Event) (string, bool) {
+	v, ok := e.Extensions()[ReplyToExtension]
+	if !ok {
+		return "", false
+	}
+	id := fmt.Sprint(v)
+	return id, id != ""
+}
+
+// recordReply records the given received reply event, it returns true when the event is a reply. It must be called
+// while holding the lock.
+func (s *StateManager) recordReply(e *ReceivedEvent) bool {
+	if s.replies == nil {
+		return false
+	}
+	id, ok := replyTo(&e.Event)
+	if !ok {
+		return false
+	}
+	s.replies.replies[id]++
+	if s.replies.replies[id] > 1 {
+		return true
+	}
+	if sentAt := s.sentAt[id]; !sentAt.IsZero() && !e.ReceivedAt.IsZero() {
+		s.replies.roundTrip.record(e.ReceivedAt.Sub(sentAt))
+	}
+	return true
+}
+
+// replyReport sets the request/reply round trips of the report, it must be called while holding the lock.
+func (s *StateManager) replyReport(r *Report) {
+	if s.replies == nil {
+		return
+	}
+	report := &ReplyReport{MissingEventsByPartitionKey: make(map[string][]string)}
+	for pk, v := range s.received {
+		received, _ := removeDuplicates(v)
+		for _, id := range received {
+			report.ExpectedCount++
+			n := s.replies.replies[id]
+			if n == 0 {
+				report.MissingEventsByPartitionKey[pk] = append(report.MissingEventsByPartitionKey[pk], id)
+				report.MissingCount++
+				continue
+			}
+			report.ReceivedCount++
+			report.DuplicateCount += n - 1
+		}
+		sort.Strings(report.MissingEventsByPartitionKey[pk])
+	}
+	report.RoundTrip = s.replies.roundTrip.stats()
+	r.Reply = report
+}
+
+// verifyReplies verifies that the reply to each received event has been received back, when enabled.
+func verifyReplies(report Report) error {
+	if report.Reply == nil || report.Reply.MissingCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d replies of %d received events not received back", report.Reply.MissingCount, report.Reply.ExpectedCount)
+}
@@ -0,0 +1,94 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestStateManagerReplies(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{Receiver: ReceiverConfig{Response: &ReceiverResponseConfig{Reply: &ReceiverReplyConfig{Verify: true}}}})
+
+	event := func(id string, sentAt time.Time) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		return e
+	}
+	reply := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID("reply-" + id)
+		e.SetExtension(ReplyToExtension, id)
+		return e
+	}
+
+	sentAt := time.Now()
+	for _, id := range []string{"1", "2", "3"} {
+		e := event(id, sentAt)
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1", sentAt), ReceivedAt: sentAt.Add(10 * time.Millisecond)},
+		{Event: event("2", sentAt), ReceivedAt: sentAt.Add(10 * time.Millisecond)},
+		{Event: event("3", sentAt), ReceivedAt: sentAt.Add(10 * time.Millisecond), DeadLettered: true},
+		{Event: reply("1"), ReceivedAt: sentAt.Add(100 * time.Millisecond)},
+		{Event: reply("1"), ReceivedAt: sentAt.Add(200 * time.Millisecond)},
+	} {
+		r := r
+		sm.lock.Lock()
+		sm.recordReceived(&r)
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := &ReplyReport{
+		ExpectedCount:               2,
+		ReceivedCount:               1,
+		DuplicateCount:              1,
+		MissingCount:                1,
+		MissingEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2"}},
+	}
+	if diff := cmp.Diff(want, report.Reply, cmpopts.IgnoreFields(ReplyReport{}, "RoundTrip")); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.Reply.RoundTrip.P50 != 100*time.Millisecond {
+		t.Errorf("want round trip of 100ms, got %+v", report.Reply.RoundTrip)
+	}
+	// Replies are not received events.
+	if report.ReceivedCount != 2 || report.UnexpectedCount != 0 {
+		t.Errorf("want 2 received events and no unexpected events, got %d and %d", report.ReceivedCount, report.UnexpectedCount)
+	}
+
+	if err := verifyReplies(report); err == nil || !strings.Contains(err.Error(), "1 replies of 2 received events") {
+		t.Errorf("expected error for the missing reply, got %v", err)
+	}
+}
+
+func TestReceiverReplyConfigValidateVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "full verification", config: Config{}},
+		{name: "streaming verification", config: Config{Verification: VerificationConfig{Mode: VerificationModeStreaming}}, wantErr: true},
+		{name: "batches", config: Config{Sender: SenderConfig{BatchSize: 10}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := (&ReceiverReplyConfig{Verify: true}).validateVerify(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -1,25 +1,286 @@
 package sacura
 
 import (
-	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"time"
 )
 
 type Metrics struct {
-	ProposedCount int            `json:"proposedCount"`
-	AcceptedCount int            `json:"acceptedCount"`
-	Metrics       vegeta.Metrics `json:"metrics"`
+	// ProposedCount and AcceptedCount don't include events sent during the warmup.
+	ProposedCount int `json:"proposedCount"`
+	AcceptedCount int `json:"acceptedCount"`
+	// WarmupProposedCount and WarmupAcceptedCount are the events sent during the warmup.
+	WarmupProposedCount int `json:"warmupProposedCount,omitempty"`
+	WarmupAcceptedCount int `json:"warmupAcceptedCount,omitempty"`
+	// NotSentCount is the number of events never accepted by the target, not even after retries, FailedSends are
+	// the failures of their last attempt. Unlike lost events, they never made it past the sender.
+	NotSentCount int          `json:"notSentCount"`
+	FailedSends  []FailedSend `json:"failedSends,omitempty"`
+	// TimedOutCount is the number of events not sent because their last attempt timed out, with sender.requestTimeout
+	// or sender.sendDeadline, they are included in NotSentCount.
+	TimedOutCount int `json:"timedOutCount,omitempty"`
+	// SendRetryCount is the number of retried requests attempts, SendAttempts are the attempts of events sent more
+	// than once by ID.
+	SendRetryCount int            `json:"sendRetryCount,omitempty"`
+	SendAttempts   map[string]int `json:"sendAttempts,omitempty"`
+	// Throttling reports how much the target throttled the sender with 429 responses, when sender.throttling is
+	// enabled.
+	Throttling *ThrottlingMetrics `json:"throttling,omitempty"`
+	// CircuitBreaker reports the state transitions of the circuit of each target, when sender.circuitBreaker is
+	// enabled.
+	CircuitBreaker *CircuitBreakerMetrics `json:"circuitBreaker,omitempty"`
+	// TargetFailoverCount is the number of failovers to the next target with the failover strategy of
+	// sender.targets.
+	TargetFailoverCount int `json:"targetFailoverCount,omitempty"`
+	// TargetMetrics are the metrics of the requests sent to each target by URL, when sender.targets is set. Requests
+	// aren't paced per target, so the target rate isn't reported.
+	TargetMetrics map[string]SendMetrics `json:"targetMetrics,omitempty"`
+	// ClosedLoop reports how long the sender has been held by the backlog, when sender.closedLoop is enabled.
+	ClosedLoop *ClosedLoopMetrics `json:"closedLoop,omitempty"`
+	// Metrics are the metrics of all requests, including the warmup, whatever the protocol.
+	Metrics SendMetrics `json:"metrics"`
 }
 
 type Report struct {
 	LostCount                int                 `json:"lostCount"`
 	LostEventsByPartitionKey map[string][]string `json:"lostEvents"`
-	DuplicateCount           int                 `json:"duplicateCount"`
+	// LostRangesByPartitionKey collects the ranges of sequence numbers of lost events by partition key, it is only
+	// populated with sender.sequentialIds, LostEventsByPartitionKey is truncated to verification.maxListedIds then
+	// and LostEventsOmittedByPartitionKey is the number of lost events not listed.
+	LostRangesByPartitionKey        map[string][]SequenceRange `json:"lostRanges,omitempty"`
+	LostEventsOmittedByPartitionKey map[string]int             `json:"lostEventsOmitted,omitempty"`
+	DuplicateCount                  int                        `json:"duplicateCount"`
 	// DuplicateEventsByPartitionKey collects duplicate events by
 	DuplicateEventsByPartitionKey map[string][]string `json:"duplicateEvents"`
+	// DuplicateDelays reports when duplicates arrived relative to the original event, it is only populated in full
+	// verification mode.
+	DuplicateDelays *DuplicateDelayReport `json:"duplicateDelays,omitempty"`
+	// FailedSendCount is the number of events the sender failed to send, FailedSendsByPartitionKey collects them by
+	// partition key. They are neither expected to be received nor counted as lost.
+	FailedSendCount           int                     `json:"failedSendCount"`
+	FailedSendsByPartitionKey map[string][]FailedSend `json:"failedSends,omitempty"`
+	// Replicas reports the events received by each receiver replica in distributed mode.
+	Replicas map[string]ReplicaReport `json:"replicas,omitempty"`
+	// SharedPartitionKeys collects the replicas that received events of partition keys received by more than one
+	// replica by partition key, it is only populated in ordered mode.
+	SharedPartitionKeys map[string][]string `json:"sharedPartitionKeys,omitempty"`
+	// Rebalancing reports the partition keys whose deliveries switched source, when receiver.rebalancing is enabled.
+	Rebalancing *RebalancingReport `json:"rebalancing,omitempty"`
+	// RestartOrdering reports the ordering violations across restarts of the receiver, when receiver.orderCheckpoint
+	// is set.
+	RestartOrdering *RestartOrderingReport `json:"restartOrdering,omitempty"`
+	// ClockSkew is the clock skew compensated by the receiver, latencies are measured according to the sender clock.
+	ClockSkew *ClockSkewReport `json:"clockSkew,omitempty"`
+	// ResourceUsage is the resource usage of sacura itself during the run.
+	ResourceUsage *ResourceUsageReport `json:"resourceUsage,omitempty"`
 	// ReceivedCount is the number of events received, including duplicates
 	ReceivedCount int `json:"receivedCount"`
 	// ReceivedEventsByPartitionKey collects all events by partition, including duplicates
 	ReceivedEventsByPartitionKey map[string][]string `json:"-"`
 	Terminated                   bool                `json:"terminated"`
-	Metrics                      Metrics             `json:"metrics"`
+	// VerificationMode is the mode used to verify received events.
+	VerificationMode VerificationMode `json:"verificationMode"`
+	// Approximate reports the error bound of the lost and unexpected counts in approximate verification mode.
+	Approximate *ApproximateReport `json:"approximate,omitempty"`
+	// UnexpectedCount is the number of unique events received but never sent, these events are not counted in
+	// ReceivedCount.
+	UnexpectedCount int `json:"unexpectedCount"`
+	// UnexpectedEventsByPartitionKey collects events received but never sent by partition key.
+	UnexpectedEventsByPartitionKey map[string][]string `json:"unexpectedEvents"`
+	// CorruptedCount is the number of unique received events whose data doesn't match their checksum.
+	CorruptedCount int `json:"corruptedCount"`
+	// CorruptedEventsByPartitionKey collects received events whose data doesn't match their checksum by partition
+	// key.
+	CorruptedEventsByPartitionKey map[string][]string `json:"corruptedEvents"`
+	// UnmatchedCount is the number of received events that were never matched with a sent event.
+	//
+	// It is only populated in streaming verification mode, where it also includes duplicates received after the
+	// original event has been matched and pruned.
+	UnmatchedCount int `json:"unmatchedCount,omitempty"`
+	// DeliveryGuarantee is the delivery guarantee used to verify received events.
+	DeliveryGuarantee DeliveryGuarantee `json:"deliveryGuarantee"`
+	Metrics           Metrics           `json:"metrics"`
+	// Latency is the end-to-end latency of received events, from the send time to the first receive time.
+	Latency LatencyStats `json:"latency"`
+	// ThroughputInterval is the interval of the samples of Throughput.
+	ThroughputInterval time.Duration `json:"throughputInterval,omitempty"`
+	// Throughput is the number of events sent, received and lost over time in buckets of ThroughputInterval, it is
+	// only populated in full verification mode.
+	Throughput []ThroughputSample `json:"throughput,omitempty"`
+	// Anomalies are the receive stalls, latency spikes and duplicate bursts of the test in the order they started,
+	// when report.anomalies is set.
+	Anomalies []Anomaly `json:"anomalies,omitempty"`
+	// PartitionBalance is the share of sent and received events of each partition key, including keys no event has
+	// been sent with, it is only populated in ordered and full verification mode.
+	PartitionBalance map[string]PartitionKeyBalance `json:"partitionBalance,omitempty"`
+	// PartitionImbalance is the ratio between the received events of the busiest partition key and the mean received
+	// events of partition keys, 1 when events are evenly distributed.
+	PartitionImbalance float64 `json:"partitionImbalance,omitempty"`
+	// LatencyHistogram is the histogram of the end-to-end latency of received events, when report.latencyHistogram is
+	// set.
+	LatencyHistogram *LatencyHistogramReport `json:"latencyHistogram,omitempty"`
+	// PartitionKeys summarizes the partition keys when ordered.cardinality grows the key space, LatencyByPartitionKey
+	// and PartitionBalance aren't reported then.
+	PartitionKeys *PartitionKeysSummary `json:"partitionKeys,omitempty"`
+	// LatencyByPartitionKey is the end-to-end latency of received events by partition key.
+	LatencyByPartitionKey map[string]LatencyStats `json:"latencyByPartitionKey"`
+	// ByEventType and BySource break the results down by the type and the source of sent events, when events have
+	// been sent with several types or sources.
+	ByEventType map[string]AttributeGroupReport `json:"byEventType,omitempty"`
+	BySource    map[string]AttributeGroupReport `json:"bySource,omitempty"`
+	// LoadPhases correlates events with the phases of the sender load profile, when configured.
+	LoadPhases []LoadPhaseReport `json:"loadPhases,omitempty"`
+	// FailureDomains attributes losses, duplicates and latencies to the tagged windows of the test, when windows have
+	// been tagged.
+	FailureDomains *FailureDomainsReport `json:"failureDomains,omitempty"`
+	// PostTerminationReceivedCount is the number of events received after termination.
+	PostTerminationReceivedCount int `json:"postTerminationReceivedCount"`
+	// PostTerminationReceivedEventsByPartitionKey collects events received after termination by partition key,
+	// these events are not counted in ReceivedCount.
+	PostTerminationReceivedEventsByPartitionKey map[string][]string `json:"postTerminationReceivedEvents"`
+	// KafkaReplay classifies lost events by whether they have been persisted in the topic of the Kafka receiver, when
+	// receiver.kafka.verifyPersisted is set.
+	KafkaReplay *KafkaReplayReport `json:"kafkaReplay,omitempty"`
+	// Disruptions reports the disruptions of the receiver, when receiver.disruptions is set.
+	Disruptions *DisruptionsReport `json:"disruptions,omitempty"`
+	// LateCount is the number of sent events received after the receiver timeout, during the receiver.lateArrivals
+	// window, these events are neither counted in ReceivedCount nor in LostCount.
+	LateCount int `json:"lateCount,omitempty"`
+	// LateEventsByPartitionKey collects sent events received after the receiver timeout by partition key.
+	LateEventsByPartitionKey map[string][]LateEvent `json:"lateEvents,omitempty"`
+	// MaxLateness is the maximum time after the receiver timeout at which late events have been received.
+	MaxLateness time.Duration `json:"maxLateness,omitempty"`
+	// NackedCount is the number of injected failure responses sent by the receiver.
+	NackedCount int `json:"nackedCount"`
+	// NackedEventsByPartitionKey collects events that received at least one failure response by partition key.
+	NackedEventsByPartitionKey map[string][]string `json:"nackedEvents"`
+	// RetryCount is the number of retries observed for nacked events.
+	RetryCount int `json:"retryCount"`
+	// RetriesByEvent is the number of retries observed for each nacked event after the first failure response.
+	RetriesByEvent map[string]int `json:"retriesByEvent"`
+	// DeadLetteredCount is the number of sent events received by the dead-letter sink only, these events are not
+	// counted as lost.
+	DeadLetteredCount int `json:"deadLetteredCount"`
+	// DeadLetteredEventsByPartitionKey collects sent events received by the dead-letter sink only by partition key.
+	DeadLetteredEventsByPartitionKey map[string][]string `json:"deadLetteredEvents"`
+	// OrderingViolationCount is the number of events received out of order in ordered mode, events displaced within
+	// ordered.toleranceWindow are not counted.
+	OrderingViolationCount int `json:"orderingViolationCount,omitempty"`
+	// OrderingViolationsByPartitionKey collects ordering violations by partition key.
+	OrderingViolationsByPartitionKey map[string]OrderingReport `json:"orderingViolations,omitempty"`
+	// ExcludedOrdering reports the ordering violations of events received during ordered.exclusions windows, they
+	// are not part of OrderingViolationCount.
+	ExcludedOrdering *ExcludedOrderingReport `json:"excludedOrdering,omitempty"`
+	// ExpiredCount is the number of sent events not received within the max delivery age, including events received
+	// after they expired.
+	ExpiredCount int `json:"expiredCount"`
+	// ExpiredEventsByPartitionKey collects sent events not received within the max delivery age by partition key.
+	ExpiredEventsByPartitionKey map[string][]ExpiredEvent `json:"expiredEvents"`
+	// WarmupSentCount is the number of events sent during the warmup, these events are not verified.
+	WarmupSentCount int `json:"warmupSentCount,omitempty"`
+	// WarmupReceivedCount is the number of events sent during the warmup that have been received, including
+	// duplicates.
+	WarmupReceivedCount int `json:"warmupReceivedCount,omitempty"`
+	// OtherRunCount is the number of received events carrying the run ID of another run, including duplicates,
+	// these events are not verified. OtherRunsByRunID counts them by run ID.
+	OtherRunCount    int            `json:"otherRunCount,omitempty"`
+	OtherRunsByRunID map[string]int `json:"otherRuns,omitempty"`
+	// FilteredCount is the number of accepted events not matching verification.filter, these events are expected not
+	// to be received.
+	FilteredCount int `json:"filteredCount,omitempty"`
+	// LeakedCount is the number of unique received events not matching verification.filter, these events are not
+	// counted in ReceivedCount.
+	LeakedCount int `json:"leakedCount,omitempty"`
+	// LeakedEventsByPartitionKey collects received events not matching verification.filter by partition key.
+	LeakedEventsByPartitionKey map[string][]string `json:"leakedEvents,omitempty"`
+	// ExpectedLossCount is the number of accepted events marked by sender.expectedLoss, these events are expected not
+	// to be received.
+	ExpectedLossCount int `json:"expectedLossCount,omitempty"`
+	// UndroppedCount is the number of unique received events marked by sender.expectedLoss, these events are not
+	// counted in ReceivedCount.
+	UndroppedCount int `json:"undroppedCount,omitempty"`
+	// UndroppedEventsByPartitionKey collects received events marked by sender.expectedLoss by partition key.
+	UndroppedEventsByPartitionKey map[string][]string `json:"undroppedEvents,omitempty"`
+	// TTL reports the events sent with a TTL, which are expected not to be received, when sender.ttl is set.
+	TTL *TTLReport `json:"ttl,omitempty"`
+	// DelayedDelivery reports the early and late deliveries of the events sent with a delay, when
+	// sender.delayedDelivery is set.
+	DelayedDelivery *DelayedDeliveryReport `json:"delayedDelivery,omitempty"`
+	// FanOut reports loss and duplicates for each sink, when fan-out verification is enabled.
+	FanOut *FanOutReport `json:"fanOut,omitempty"`
+	// Endpoints reports the events received on each endpoint, when receiver.endpoints is enabled.
+	Endpoints map[string]EndpointReport `json:"endpoints,omitempty"`
+	// Reply reports the request/reply round trips, when receiver.response.reply.verify is enabled.
+	Reply *ReplyReport `json:"reply,omitempty"`
+	// Topology reports the deliveries that didn't pass through the expected steps, when verification.topology is
+	// enabled.
+	Topology *TopologyReport `json:"topology,omitempty"`
+	// Compression reports the compression of received events, when sender.compression is enabled or compressed
+	// events have been received.
+	Compression *CompressionReport `json:"compression,omitempty"`
+	// PayloadSizes reports the events of each size class in bytes, when sender.payload.sizeClasses is set.
+	PayloadSizes map[int]PayloadSizeReport `json:"payloadSizes,omitempty"`
+	// Serialization reports the deliveries whose data doesn't deserialize against the expected schema version, when
+	// serialization is enabled.
+	Serialization *SerializationReport `json:"serialization,omitempty"`
+	// ContentTypes reports the deliveries whose content type doesn't match the expected one, when
+	// receiver.contentTypes is set.
+	ContentTypes *ContentTypesReport `json:"contentTypes,omitempty"`
+	// Targets reports the events sent to each target by URL, when sender.targets is set.
+	Targets map[string]TargetReport `json:"targets,omitempty"`
+	// SuppressedDuplicates reports the duplicates dropped by the receiver before verification, when
+	// receiver.suppressDuplicates is enabled.
+	SuppressedDuplicates *SuppressedDuplicatesReport `json:"suppressedDuplicates,omitempty"`
+	// Instances reports how deliveries were distributed across the receiver instances, when
+	// receiver.instanceIdentity is set.
+	Instances *InstancesReport `json:"instances,omitempty"`
+	// Backfill reports the events read from the external store, when backfill is set.
+	Backfill *BackfillReport `json:"backfill,omitempty"`
+	// Idempotency reports whether the target deduplicated retried requests, when sender.idempotencyKey is set.
+	Idempotency *IdempotencyReport `json:"idempotency,omitempty"`
+	// Identities reports the delivery results of the events sent with each identity by name, when
+	// sender.identityRotation is set.
+	Identities map[string]IdentityReport `json:"identities,omitempty"`
+	// Overrides reports the events of each override group by name, when sender.overrides is set.
+	Overrides map[string]OverrideGroupReport `json:"overrides,omitempty"`
+	// Verifiers reports the results of each Verifier by name, when Config.Verifiers is set.
+	Verifiers map[string]VerifierReport `json:"verifiers,omitempty"`
+	// Assertions reports the received events failing each assertion by name, when verification.assertions is set.
+	Assertions map[string]AssertionReport `json:"assertions,omitempty"`
+	// SpecViolationCount is the number of received events violating the CloudEvents v1.0 specification.
+	SpecViolationCount int `json:"specViolationCount,omitempty"`
+	// SpecViolations lists the rules of the specification violated by received events, sorted by event ID.
+	SpecViolations []SpecViolation `json:"specViolations,omitempty"`
+	// AttributeDiffsByEventID collects the differences between the attributes of received and sent events by event
+	// ID, when verification.attributes is set.
+	AttributeDiffsByEventID map[string]AttributeDiff `json:"attributeDiffsByEventId,omitempty"`
+	// DeliveryAttempts reports the delivery attempts of received events, when verification.deliveryAttempts is set.
+	DeliveryAttempts *DeliveryAttemptsReport `json:"deliveryAttempts,omitempty"`
+	// ContentModes reports the content mode events have been sent and received in, when sender.contentMode is set.
+	ContentModes *ContentModeReport `json:"contentModes,omitempty"`
+	// SettingsChanges are the changes of the send rate, the receiver faults and the receiver processing delay applied
+	// during the run, when hotReload is set.
+	SettingsChanges []SettingsChange `json:"settingsChanges,omitempty"`
+	// Aborted is true when the test has been cut short, by a termination signal or through the admin API, the report
+	// only covers the events sent until then.
+	Aborted bool `json:"aborted,omitempty"`
+	// StateWriteErrorCount is the number of sent and received events that couldn't be written to state.path or
+	// state.redis, the report is incomplete and fails verification since the events are missing from the state
+	// reports are generated from after a restart or by other instances. StateWriteError is the last write error.
+	StateWriteErrorCount int    `json:"stateWriteErrorCount,omitempty"`
+	StateWriteError      string `json:"stateWriteError,omitempty"`
+	// BudgetViolations are the verification budgets the report exceeds.
+	BudgetViolations []BudgetViolation `json:"budgetViolations,omitempty"`
+	// ThresholdViolations are the configured thresholds the report violates.
+	ThresholdViolations []ThresholdViolation `json:"thresholdViolations,omitempty"`
+	// FailureReasons are the classes of the verification failures, see Verdict.
+	FailureReasons []VerdictReason `json:"failureReasons,omitempty"`
+	// Scenarios are the reports of the scenarios of a suite, the other fields are empty in the combined report.
+	Scenarios []ScenarioReport `json:"scenarios,omitempty"`
+	// Streams are the reports of the streams of a multi-tenant test, the other fields are empty in the combined report.
+	Streams []StreamReport `json:"streams,omitempty"`
+	// Benchmark is the outcome of the benchmark mode, the other fields are empty in the benchmark report.
+	Benchmark *BenchmarkReport `json:"benchmark,omitempty"`
+	// OmittedIDs is the number of entries omitted by section when report.limits truncates the logged and written
+	// report, counts include them.
+	OmittedIDs map[string]int `json:"omittedIds,omitempty"`
 }
@@ -0,0 +1,339 @@
+package sacura
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// htmlChartWidth and htmlChartHeight are the size of the plot area of HTML report charts.
+	htmlChartWidth  = 800
+	htmlChartHeight = 200
+
+	// htmlMaxListedEvents is the maximum number of event IDs listed for each partition in the diff summary.
+	htmlMaxListedEvents = 20
+)
+
+// htmlReport is the data rendered by htmlReportTemplate.
+type htmlReport struct {
+	Report
+	Passed      bool
+	Error       string
+	GeneratedAt string
+
+	Throughput *htmlThroughputChart
+	Latency    []htmlBar
+	Partitions []htmlPartition
+}
+
+type htmlThroughputChart struct {
+	Sent, Received, Lost string
+	MaxCount             int
+	Duration             time.Duration
+	Interval             time.Duration
+}
+
+type htmlBar struct {
+	Label string
+	Value string
+	// Width is the width of the bar as a percentage of the largest bar.
+	Width float64
+}
+
+type htmlPartition struct {
+	Key                string
+	Received           int
+	Lost               int
+	Duplicates         int
+	Unexpected         int
+	OrderingViolations int
+	// LostWidth and DuplicatesWidth are the widths of the loss and duplicates bars as percentages.
+	LostWidth       float64
+	DuplicatesWidth float64
+	Latency         LatencyStats
+
+	LostEvents       htmlEventList
+	DuplicateEvents  htmlEventList
+	UnexpectedEvents htmlEventList
+	Violations       []OrderingViolation
+}
+
+// htmlEventList is a list of event IDs truncated to htmlMaxListedEvents.
+type htmlEventList struct {
+	IDs     []string
+	Omitted int
+}
+
+func newHTMLEventList(ids []string) htmlEventList {
+	if len(ids) <= htmlMaxListedEvents {
+		return htmlEventList{IDs: ids}
+	}
+	return htmlEventList{IDs: ids[:htmlMaxListedEvents], Omitted: len(ids) - htmlMaxListedEvents}
+}
+
+func (l htmlEventList) String() string {
+	s := strings.Join(l.IDs, ", ")
+	if l.Omitted > 0 {
+		s += fmt.Sprintf(" and %d more", l.Omitted)
+	}
+	return s
+}
+
+// writeHTMLReport writes the report as a self-contained HTML page, charts are inline SVG so that the page can be
+// attached to CI artifacts and viewed offline.
+func writeHTMLReport(w io.Writer, report Report, verificationErr error) error {
+	r := htmlReport{
+		Report:      report,
+		Passed:      verificationErr == nil,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+		Throughput:  newHTMLThroughputChart(report.ThroughputInterval, report.Throughput),
+		Latency:     newHTMLLatencyBars(report.Latency),
+		Partitions:  newHTMLPartitions(report),
+	}
+	if verificationErr != nil {
+		r.Error = verificationErr.Error()
+	}
+	return htmlReportTemplate.Execute(w, r)
+}
+
+func newHTMLThroughputChart(interval time.Duration, samples []ThroughputSample) *htmlThroughputChart {
+	if len(samples) == 0 {
+		return nil
+	}
+	c := &htmlThroughputChart{Interval: interval, Duration: time.Duration(len(samples)) * interval}
+	for _, s := range samples {
+		if s.SentCount > c.MaxCount {
+			c.MaxCount = s.SentCount
+		}
+		if s.ReceivedCount > c.MaxCount {
+			c.MaxCount = s.ReceivedCount
+		}
+	}
+	if c.MaxCount == 0 {
+		c.MaxCount = 1
+	}
+
+	points := func(count func(s ThroughputSample) int) string {
+		sb := strings.Builder{}
+		for i, s := range samples {
+			x := float64(htmlChartWidth) * (float64(i) + 0.5) / float64(len(samples))
+			y := float64(htmlChartHeight) * (1 - float64(count(s))/float64(c.MaxCount))
+			sb.WriteString(fmt.Sprintf("%.1f,%.1f ", x, y))
+		}
+		return strings.TrimSpace(sb.String())
+	}
+	c.Sent = points(func(s ThroughputSample) int { return s.SentCount })
+	c.Received = points(func(s ThroughputSample) int { return s.ReceivedCount })
+	c.Lost = points(func(s ThroughputSample) int { return s.LostCount })
+	return c
+}
+
+func newHTMLLatencyBars(l LatencyStats) []htmlBar {
+	if l.Count == 0 || l.Max <= 0 {
+		return nil
+	}
+	bars := make([]htmlBar, 0, 4)
+	for _, p := range []struct {
+		label string
+		value time.Duration
+	}{{"50th", l.P50}, {"90th", l.P90}, {"99th", l.P99}, {"max", l.Max}} {
+		bars = append(bars, htmlBar{Label: p.label, Value: p.value.String(), Width: 100 * float64(p.value) / float64(l.Max)})
+	}
+	return bars
+}
+
+func newHTMLPartitions(report Report) []htmlPartition {
+	keys := make(map[string]struct{})
+	for _, m := range []map[string][]string{
+		report.ReceivedEventsByPartitionKey,
+		report.LostEventsByPartitionKey,
+		report.DuplicateEventsByPartitionKey,
+		report.UnexpectedEventsByPartitionKey,
+	} {
+		for k := range m {
+			keys[k] = struct{}{}
+		}
+	}
+	for k := range report.OrderingViolationsByPartitionKey {
+		keys[k] = struct{}{}
+	}
+
+	partitions := make([]htmlPartition, 0, len(keys))
+	for k := range keys {
+		p := htmlPartition{
+			Key:                k,
+			Received:           len(report.ReceivedEventsByPartitionKey[k]),
+			Lost:               len(report.LostEventsByPartitionKey[k]) + report.LostEventsOmittedByPartitionKey[k],
+			Duplicates:         len(report.DuplicateEventsByPartitionKey[k]),
+			Unexpected:         len(report.UnexpectedEventsByPartitionKey[k]),
+			OrderingViolations: len(report.OrderingViolationsByPartitionKey[k].Violations),
+			Latency:            report.LatencyByPartitionKey[k],
+			LostEvents:         newHTMLEventList(report.LostEventsByPartitionKey[k]),
+			DuplicateEvents:    newHTMLEventList(report.DuplicateEventsByPartitionKey[k]),
+			UnexpectedEvents:   newHTMLEventList(report.UnexpectedEventsByPartitionKey[k]),
+			Violations:         report.OrderingViolationsByPartitionKey[k].Violations,
+		}
+		p.LostEvents.Omitted += report.LostEventsOmittedByPartitionKey[k]
+		if len(p.Violations) > htmlMaxListedEvents {
+			p.Violations = p.Violations[:htmlMaxListedEvents]
+		}
+		if expected := p.Received + p.Lost; expected > 0 {
+			p.LostWidth = 100 * float64(p.Lost) / float64(expected)
+		}
+		if total := p.Received + p.Duplicates; total > 0 {
+			p.DuplicatesWidth = 100 * float64(p.Duplicates) / float64(total)
+		}
+		partitions = append(partitions, p)
+	}
+	sort.Slice(partitions, func(i, j int) bool { return partitions[i].Key < partitions[j].Key })
+	return partitions
+}
+
+func (p htmlPartition) HasDiff() bool {
+	return p.Lost > 0 || p.Duplicates > 0 || p.Unexpected > 0 || p.OrderingViolations > 0
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"percent": func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sacura report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+h1 .outcome { padding: 0.1em 0.5em; border-radius: 0.2em; color: #fff; }
+.passed { background: #2e7d32; }
+.failed { background: #c62828; }
+pre { background: #f5f5f5; padding: 1em; white-space: pre-wrap; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+th, td { border: 1px solid #ddd; padding: 0.3em 0.7em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+.bar { display: inline-block; height: 0.8em; min-width: 1px; }
+.bar.latency { background: #1565c0; }
+.bar.lost { background: #c62828; }
+.bar.duplicates { background: #ef6c00; }
+.track { width: 10em; background: #eee; }
+.sent { stroke: #1565c0; color: #1565c0; }
+.received { stroke: #2e7d32; color: #2e7d32; }
+.lost { stroke: #c62828; color: #c62828; }
+svg polyline { fill: none; stroke-width: 2; }
+svg text { font-size: 12px; fill: #555; }
+</style>
+</head>
+<body>
+<h1>Sacura report <span class="outcome {{if .Passed}}passed{{else}}failed{{end}}">{{if .Passed}}passed{{else}}failed{{end}}</span></h1>
+<p>Generated at {{.GeneratedAt}}, {{.DeliveryGuarantee}} delivery guarantee, {{.VerificationMode}} verification mode.</p>
+{{with .Approximate}}<p>Lost and unexpected counts are estimates, underestimated by {{.LostCountErrorBound}} events on average (false positive rate {{printf "%.2g" .FalsePositiveRate}}, {{.MemoryBytes}} bytes of filters{{if .UntrackedCount}}, {{.UntrackedCount}} untracked events{{end}}).</p>{{end}}
+{{if .Error}}<pre>{{.Error}}</pre>{{end}}
+{{with .Benchmark}}
+<h2>Benchmark</h2>
+<p>Maximum sustainable rate: {{.MaxSustainableRate}} events/s{{if .LimitingRate}}, limited at {{.LimitingRate}} events/s by: {{.LimitingSymptom}}{{end}}.</p>
+<table>
+<tr><th>Rate</th><th>Outcome</th><th>Throughput</th><th>Accepted</th><th>Lost</th><th>99th latency</th></tr>
+{{range .Steps}}<tr>
+<td>{{.Rate}}</td>
+<td><span class="outcome {{if .Passed}}passed{{else}}failed{{end}}">{{if .Passed}}passed{{else}}failed{{end}}</span></td>
+<td>{{printf "%.1f" .Throughput}}/s</td><td>{{.AcceptedCount}}</td><td>{{.LostCount}}</td><td>{{.LatencyP99}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+{{if .Scenarios}}
+<h2>Scenarios</h2>
+<table>
+<tr><th>Scenario</th><th>Outcome</th><th>Accepted</th><th>Received</th><th>Lost</th><th>Duplicates</th><th>Error</th></tr>
+{{range .Scenarios}}<tr>
+<td>{{.Name}}</td>
+<td><span class="outcome {{if .Passed}}passed{{else}}failed{{end}}">{{if .Skipped}}skipped{{else if .Passed}}passed{{else}}failed{{end}}</span></td>
+<td>{{.Report.Metrics.AcceptedCount}}</td><td>{{.Report.ReceivedCount}}</td><td>{{.Report.LostCount}}</td><td>{{.Report.DuplicateCount}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+{{if .Streams}}
+<h2>Streams</h2>
+<table>
+<tr><th>Stream</th><th>Path</th><th>Outcome</th><th>Accepted</th><th>Received</th><th>Lost</th><th>Duplicates</th><th>Misrouted</th><th>Error</th></tr>
+{{range .Streams}}<tr>
+<td>{{.Name}}</td><td>{{.Path}}</td>
+<td><span class="outcome {{if .Passed}}passed{{else}}failed{{end}}">{{if .Passed}}passed{{else}}failed{{end}}</span></td>
+<td>{{.Report.Metrics.AcceptedCount}}</td><td>{{.Report.ReceivedCount}}</td><td>{{.Report.LostCount}}</td><td>{{.Report.DuplicateCount}}</td><td>{{.MisroutedCount}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+{{end}}
+
+<h2>Summary</h2>
+<table>
+<tr><th>Accepted</th><td>{{.Metrics.AcceptedCount}}</td></tr>
+<tr><th>Not sent</th><td>{{.Metrics.NotSentCount}}</td></tr>
+<tr><th>Timed out</th><td>{{.Metrics.TimedOutCount}}</td></tr>
+<tr><th>Received</th><td>{{.ReceivedCount}}</td></tr>
+<tr><th>Lost</th><td>{{.LostCount}}</td></tr>
+<tr><th>Duplicates</th><td>{{.DuplicateCount}}</td></tr>
+<tr><th>Unexpected</th><td>{{.UnexpectedCount}}</td></tr>
+<tr><th>Dead-lettered</th><td>{{.DeadLetteredCount}}</td></tr>
+<tr><th>Corrupted</th><td>{{.CorruptedCount}}</td></tr>
+<tr><th>Expired</th><td>{{.ExpiredCount}}</td></tr>
+<tr><th>Ordering violations</th><td>{{.OrderingViolationCount}}</td></tr>
+{{if .Metrics.SendRetryCount}}<tr><th>Send retries</th><td>{{.Metrics.SendRetryCount}}</td></tr>
+{{end}}{{with .Metrics.Throttling}}<tr><th>Throttled</th><td>{{.ThrottledCount}} responses, {{.EpisodeCount}} episodes, {{.Duration}}</td></tr>
+{{end}}<tr><th>Sender throughput</th><td>{{printf "%.1f" .Metrics.Metrics.Throughput}}/s</td></tr>
+</table>
+
+<h2>Throughput</h2>
+{{with .Throughput}}
+<svg width="880" height="240" viewBox="-60 -10 880 240" role="img" aria-label="Events sent and received over time">
+<line x1="0" y1="200" x2="800" y2="200" stroke="#999"/>
+<line x1="0" y1="0" x2="0" y2="200" stroke="#999"/>
+<text x="-8" y="4" text-anchor="end">{{.MaxCount}}</text>
+<text x="-8" y="204" text-anchor="end">0</text>
+<text x="800" y="220" text-anchor="end">{{.Duration}}</text>
+<polyline class="sent" points="{{.Sent}}"/>
+<polyline class="received" points="{{.Received}}"/>
+<polyline class="lost" points="{{.Lost}}"/>
+</svg>
+<p>Events per {{.Interval}}: <span class="sent">&#9632;</span> sent, <span class="received">&#9632;</span> received, <span class="lost">&#9632;</span> lost by send time.</p>
+{{else}}<p>No throughput samples.</p>{{end}}
+
+<h2>Latency</h2>
+{{if .Latency}}
+<table>
+{{range .Latency}}<tr><th>{{.Label}}</th><td>{{.Value}}</td><td class="track"><span class="bar latency" style="width: {{percent .Width}}"></span></td></tr>
+{{end}}</table>
+{{else}}<p>No latencies.</p>{{end}}
+
+<h2>Partitions</h2>
+{{if .Partitions}}
+<table>
+<tr><th>Partition key</th><th>Received</th><th>Lost</th><th></th><th>Duplicates</th><th></th><th>Unexpected</th><th>Ordering violations</th><th>50th</th><th>99th</th></tr>
+{{range .Partitions}}<tr>
+<td>{{.Key}}</td><td>{{.Received}}</td>
+<td>{{.Lost}}</td><td class="track"><span class="bar lost" style="width: {{percent .LostWidth}}"></span></td>
+<td>{{.Duplicates}}</td><td class="track"><span class="bar duplicates" style="width: {{percent .DuplicatesWidth}}"></span></td>
+<td>{{.Unexpected}}</td><td>{{.OrderingViolations}}</td>
+<td>{{.Latency.P50}}</td><td>{{.Latency.P99}}</td>
+</tr>
+{{end}}</table>
+{{else}}<p>No partitions.</p>{{end}}
+
+<h2>Diff</h2>
+{{$diff := false}}{{range .Partitions}}{{if .HasDiff}}{{$diff = true}}
+<h3>Partition key {{.Key}}</h3>
+<ul>
+{{if .Lost}}<li>lost ({{.Lost}}): {{.LostEvents}}</li>{{end}}
+{{if .Duplicates}}<li>duplicates ({{.Duplicates}}): {{.DuplicateEvents}}</li>{{end}}
+{{if .Unexpected}}<li>unexpected ({{.Unexpected}}): {{.UnexpectedEvents}}</li>{{end}}
+{{if .OrderingViolations}}<li>ordering violations ({{.OrderingViolations}}):
+<ul>{{range .Violations}}<li>{{.ID}} (expected position {{.ExpectedPosition}}, actual position {{.ActualPosition}}, displacement {{.Displacement}})</li>{{end}}</ul>
+</li>{{end}}
+</ul>
+{{end}}{{end}}
+{{if not $diff}}<p>No differences between sent and received events.</p>{{end}}
+</body>
+</html>
+`))
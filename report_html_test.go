@@ -0,0 +1,79 @@
+package sacura
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteHTMLReport(t *testing.T) {
+
+	lost := make([]string, 25)
+	for i := range lost {
+		lost[i] = fmt.Sprintf("lost-%d", i)
+	}
+	report := Report{
+		LostCount:                     25,
+		LostEventsByPartitionKey:      map[string][]string{"b": lost},
+		DuplicateCount:                1,
+		DuplicateEventsByPartitionKey: map[string][]string{"a": {"dup-1"}},
+		ReceivedCount:                 75,
+		ReceivedEventsByPartitionKey:  map[string][]string{"a": make([]string, 50), "b": make([]string, 25)},
+		UnexpectedEventsByPartitionKey: map[string][]string{
+			"c": {"<script>alert(1)</script>"},
+		},
+		OrderingViolationsByPartitionKey: map[string]OrderingReport{
+			"a": newOrderingReport([]OrderingViolation{{ID: "2", ExpectedPosition: 1, ActualPosition: 2, Displacement: 1}}),
+		},
+		Latency:            LatencyStats{Count: 75, P50: time.Second, P90: 2 * time.Second, P99: 3 * time.Second, Max: 4 * time.Second},
+		ThroughputInterval: time.Second,
+		Throughput: []ThroughputSample{
+			{SentCount: 50},
+			{Offset: time.Second, SentCount: 50, ReceivedCount: 40, LostCount: 25},
+			{Offset: 2 * time.Second, ReceivedCount: 35},
+		},
+	}
+
+	b := &bytes.Buffer{}
+	if err := writeHTMLReport(b, report, errors.New("lost count: 25")); err != nil {
+		t.Fatal(err)
+	}
+	got := b.String()
+
+	for _, want := range []string{
+		`class="outcome failed"`,
+		"<pre>lost count: 25</pre>",
+		`<polyline class="sent" points="133.3,0.0 400.0,0.0 666.7,200.0"/>`,
+		`<polyline class="received" points="133.3,200.0 400.0,40.0 666.7,60.0"/>`,
+		`<polyline class="lost" points="133.3,200.0 400.0,100.0 666.7,200.0"/>`,
+		`style="width: 25.0%"`,
+		"<h3>Partition key a</h3>",
+		"lost (25): lost-0, lost-1",
+		"and 5 more",
+		"2 (expected position 1, actual position 2, displacement 1)",
+		"&lt;script&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected HTML report to contain %q, got:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "<script>") {
+		t.Error("expected event IDs to be escaped")
+	}
+}
+
+func TestWriteHTMLReportEmpty(t *testing.T) {
+
+	b := &bytes.Buffer{}
+	if err := writeHTMLReport(b, Report{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`class="outcome passed"`, "No throughput samples.", "No differences between sent and received events."} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected HTML report to contain %q, got:\n%s", want, b)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type ReportFormat string
+
+const (
+	ReportFormatJSON  ReportFormat = "json"
+	ReportFormatJUnit ReportFormat = "junit"
+	// ReportFormatHTML is a self-contained HTML page with charts.
+	ReportFormatHTML ReportFormat = "html"
+)
+
+// ReportWriter writes the final report together with the verification outcome.
+type ReportWriter interface {
+	Write(w io.Writer, report Report, verificationErr error) error
+}
+
+type ReportWriterFunc func(w io.Writer, report Report, verificationErr error) error
+
+func (f ReportWriterFunc) Write(w io.Writer, report Report, verificationErr error) error {
+	return f(w, report, verificationErr)
+}
+
+func newReportWriter(config ReportWriterConfig) (ReportWriter, error) {
+	if config.Path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+	switch config.Format {
+	case ReportFormatJSON:
+		return ReportWriterFunc(writeJSONReport), nil
+	case ReportFormatJUnit:
+		return ReportWriterFunc(writeJUnitReport), nil
+	case ReportFormatHTML:
+		return ReportWriterFunc(writeHTMLReport), nil
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected one of %v", config.Format, []ReportFormat{ReportFormatJSON, ReportFormatJUnit, ReportFormatHTML})
+	}
+}
+
+func writeReports(config ReportConfig, report Report, verificationErr error) error {
+	limited := config.Limits.limited(report)
+	for _, c := range config.Writers {
+		w, err := newReportWriter(c)
+		if err != nil {
+			return err
+		}
+		r := limited
+		if c.Format == ReportFormatHTML {
+			// The HTML report needs every event to count events by partition and lists a bounded number of them.
+			r = report
+		}
+		if err := writeReportFile(c.Path, w, r, verificationErr); err != nil {
+			return fmt.Errorf("failed to write %s report to %s: %w", c.Format, c.Path, err)
+		}
+	}
+	if config.LostEvents != nil {
+		if err := writeLostEvents(config.LostEvents, report); err != nil {
+			return fmt.Errorf("failed to write lost events to %s: %w", config.LostEvents.Path, err)
+		}
+	}
+	if config.Kubernetes != nil {
+		if err := writeKubernetesReport(context.Background(), config.Kubernetes, limited, verificationErr); err != nil {
+			return err
+		}
+	}
+	if config.Upload != nil {
+		if err := uploadReports(context.Background(), config, limited, verificationErr); err != nil {
+			return err
+		}
+	}
+	if len(config.Webhooks) > 0 {
+		if err := notifyWebhooks(context.Background(), config.Webhooks, limited, verificationErr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeReportFile(path string, w ReportWriter, report Report, verificationErr error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := w.Write(f, report, verificationErr); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func writeJSONReport(w io.Writer, report Report, verificationErr error) error {
+	r := struct {
+		Report
+		Passed bool   `json:"passed"`
+		Error  string `json:"error,omitempty"`
+	}{
+		Report: report,
+		Passed: verificationErr == nil,
+	}
+	if verificationErr != nil {
+		r.Error = verificationErr.Error()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+func writeJUnitReport(w io.Writer, report Report, verificationErr error) error {
+	summary, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal report: %w", err)
+	}
+
+	duration := fmt.Sprintf("%.3f", report.Metrics.Metrics.Duration.Seconds())
+
+	tc := junitTestCase{
+		Name:      "verification",
+		ClassName: "sacura",
+		Time:      duration,
+		SystemOut: string(summary),
+	}
+	failures := 0
+	if verificationErr != nil {
+		failures = 1
+		tc.Failure = &junitFailure{
+			Message: "verification failed",
+			Content: verificationErr.Error(),
+		}
+	}
+	testCases := []junitTestCase{tc}
+
+	if len(report.Scenarios) > 0 {
+		// Suites have a test case per scenario.
+		testCases, failures = nil, 0
+		var total time.Duration
+		for _, s := range report.Scenarios {
+			summary, err := json.MarshalIndent(s.Report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report of scenario %s: %w", s.Name, err)
+			}
+			d := s.Report.Metrics.Metrics.Duration
+			total += d
+			tc := junitTestCase{
+				Name:      s.Name,
+				ClassName: "sacura",
+				Time:      fmt.Sprintf("%.3f", d.Seconds()),
+				SystemOut: string(summary),
+			}
+			if !s.Passed {
+				failures++
+				tc.Failure = &junitFailure{Message: "verification failed", Content: s.Error}
+				if s.Skipped {
+					tc.Failure.Message = "skipped"
+				}
+			}
+			testCases = append(testCases, tc)
+		}
+		duration = fmt.Sprintf("%.3f", total.Seconds())
+	}
+	if len(report.Streams) > 0 {
+		// Multi-tenant tests have a test case per stream, streams run in parallel.
+		testCases, failures = nil, 0
+		var longest time.Duration
+		for _, s := range report.Streams {
+			summary, err := json.MarshalIndent(s.Report, "", "  ")
+			if err != nil {
+				return fmt.Errorf("failed to marshal report of stream %s: %w", s.Name, err)
+			}
+			d := s.Report.Metrics.Metrics.Duration
+			if d > longest {
+				longest = d
+			}
+			tc := junitTestCase{
+				Name:      s.Name,
+				ClassName: "sacura",
+				Time:      fmt.Sprintf("%.3f", d.Seconds()),
+				SystemOut: string(summary),
+			}
+			if !s.Passed {
+				failures++
+				tc.Failure = &junitFailure{Message: "verification failed", Content: s.Error}
+			}
+			testCases = append(testCases, tc)
+		}
+		duration = fmt.Sprintf("%.3f", longest.Seconds())
+	}
+
+	suites := junitTestSuites{
+		Suites: []junitTestSuite{
+			{
+				Name:      "sacura",
+				Tests:     len(testCases),
+				Failures:  failures,
+				Time:      duration,
+				Timestamp: time.Now().UTC().Format(time.RFC3339),
+				TestCases: testCases,
+			},
+		},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
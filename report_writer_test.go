@@ -0,0 +1,104 @@
+package sacura
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteReports(t *testing.T) {
+
+	tests := []struct {
+		name            string
+		verificationErr error
+	}{
+		{
+			name: "passed",
+		},
+		{
+			name:            "failed",
+			verificationErr: errors.New("lost count (accepted but not received): 10 - 9 = 1"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			config := ReportConfig{
+				Writers: []ReportWriterConfig{
+					{Format: ReportFormatJSON, Path: filepath.Join(dir, "report.json")},
+					{Format: ReportFormatJUnit, Path: filepath.Join(dir, "junit.xml")},
+					{Format: ReportFormatHTML, Path: filepath.Join(dir, "report.html")},
+				},
+			}
+			report := Report{LostCount: 1, ReceivedCount: 9}
+
+			if err := writeReports(config, report, tt.verificationErr); err != nil {
+				t.Fatal(err)
+			}
+
+			b, err := os.ReadFile(filepath.Join(dir, "report.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := struct {
+				LostCount int    `json:"lostCount"`
+				Passed    bool   `json:"passed"`
+				Error     string `json:"error"`
+			}{}
+			if err := json.Unmarshal(b, &got); err != nil {
+				t.Fatal(err)
+			}
+			if got.LostCount != report.LostCount {
+				t.Errorf("expected lost count %d, got %d", report.LostCount, got.LostCount)
+			}
+			if got.Passed != (tt.verificationErr == nil) {
+				t.Errorf("expected passed %v, got %v", tt.verificationErr == nil, got.Passed)
+			}
+
+			b, err = os.ReadFile(filepath.Join(dir, "junit.xml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			suites := junitTestSuites{}
+			if err := xml.Unmarshal(b, &suites); err != nil {
+				t.Fatal(err)
+			}
+			if len(suites.Suites) != 1 || len(suites.Suites[0].TestCases) != 1 {
+				t.Fatalf("expected 1 test suite with 1 test case, got %+v", suites)
+			}
+			tc := suites.Suites[0].TestCases[0]
+			if (tc.Failure != nil) != (tt.verificationErr != nil) {
+				t.Errorf("expected failure %v, got %+v", tt.verificationErr, tc.Failure)
+			}
+			if tt.verificationErr != nil && tc.Failure.Content != tt.verificationErr.Error() {
+				t.Errorf("expected failure content %q, got %q", tt.verificationErr.Error(), tc.Failure.Content)
+			}
+
+			b, err = os.ReadFile(filepath.Join(dir, "report.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			outcome := "passed"
+			if tt.verificationErr != nil {
+				outcome = "failed"
+			}
+			if !strings.Contains(string(b), `class="outcome `+outcome+`"`) {
+				t.Errorf("expected HTML report to be %s, got:\n%s", outcome, b)
+			}
+		})
+	}
+}
+
+func TestNewReportWriterInvalid(t *testing.T) {
+	if _, err := newReportWriter(ReportWriterConfig{Format: "yaml", Path: "report.yaml"}); err == nil {
+		t.Error("expected error for unknown format")
+	}
+	if _, err := newReportWriter(ReportWriterConfig{Format: ReportFormatJSON}); err == nil {
+		t.Error("expected error for empty path")
+	}
+}
@@ -0,0 +1,316 @@
+package sacura
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	// DefaultRequestLogMaxBodyBytes is the default number of bytes of the body of logged requests.
+	DefaultRequestLogMaxBodyBytes = 1024
+	// DefaultRequestLogMaxFileBytes is the default size of the request log file at which it is rotated.
+	DefaultRequestLogMaxFileBytes = 100 << 20
+	// DefaultRequestLogMaxFiles is the default number of rotated request log files kept besides the current one.
+	DefaultRequestLogMaxFiles = 5
+)
+
+// RequestLogConfig logs a sample of the requests of the HTTP and gRPC receivers to a rotating file, with their
+// headers, the attributes of their events and the beginning of their body, so that malformed deliveries can be
+// inspected without logging every request of high-rate runs.
+type RequestLogConfig struct {
+	// Path is the path of the file the requests are logged to as JSON lines. Rotated files have the suffix .1 to
+	// .<maxFiles>, .1 being the most recent.
+	Path string `json:"path" yaml:"path"`
+	// SamplePercentage is the percentage of requests logged, for example 0.1 logs 10 requests per second at 10k/s.
+	SamplePercentage float64 `json:"samplePercentage" yaml:"samplePercentage"`
+	// MaxBodyBytes is the number of bytes of the body of logged requests.
+	//
+	// Defaults to DefaultRequestLogMaxBodyBytes.
+	MaxBodyBytes int `json:"maxBodyBytes" yaml:"maxBodyBytes"`
+	// MaxFileBytes is the size at which the file is rotated.
+	//
+	// Defaults to DefaultRequestLogMaxFileBytes.
+	MaxFileBytes int64 `json:"maxFileBytes" yaml:"maxFileBytes"`
+	// MaxFiles is the number of rotated files kept, older ones are deleted.
+	//
+	// Defaults to DefaultRequestLogMaxFiles.
+	MaxFiles int `json:"maxFiles" yaml:"maxFiles"`
+}
+
+func (c *RequestLogConfig) validate(protocol Protocol) error {
+	switch protocol {
+	case "", ProtocolHTTP, ProtocolGRPC:
+	default:
+		return invalidErr("receiver.requestLog", fmt.Errorf("not supported with the %s protocol", protocol))
+	}
+	if c.Path == "" {
+		return invalidErr("receiver.requestLog.path", errors.New("cannot be empty"))
+	}
+	if c.SamplePercentage <= 0 || c.SamplePercentage > 100 {
+		return invalidErr("receiver.requestLog.samplePercentage", fmt.Errorf("%v must be greater than 0 and at most 100", c.SamplePercentage))
+	}
+	if c.MaxBodyBytes < 0 {
+		return invalidErr("receiver.requestLog.maxBodyBytes", fmt.Errorf("%d cannot be negative", c.MaxBodyBytes))
+	}
+	if c.MaxBodyBytes == 0 {
+		c.MaxBodyBytes = DefaultRequestLogMaxBodyBytes
+	}
+	if c.MaxFileBytes < 0 {
+		return invalidErr("receiver.requestLog.maxFileBytes", fmt.Errorf("%d cannot be negative", c.MaxFileBytes))
+	}
+	if c.MaxFileBytes == 0 {
+		c.MaxFileBytes = DefaultRequestLogMaxFileBytes
+	}
+	if c.MaxFiles < 0 {
+		return invalidErr("receiver.requestLog.maxFiles", fmt.Errorf("%d cannot be negative", c.MaxFiles))
+	}
+	if c.MaxFiles == 0 {
+		c.MaxFiles = DefaultRequestLogMaxFiles
+	}
+	return nil
+}
+
+// requestLogRecord is a logged request.
+type requestLogRecord struct {
+	Time       time.Time           `json:"time"`
+	Method     string              `json:"method"`
+	Path       string              `json:"path"`
+	RemoteAddr string              `json:"remoteAddr"`
+	Headers    map[string][]string `json:"headers"`
+	// Events are the attributes of the events decoded from the request, it is empty when the request is malformed.
+	Events []map[string]string `json:"events,omitempty"`
+	// Body is the beginning of the body, BodyTruncated is true when the body is longer.
+	Body          string `json:"body"`
+	BodyTruncated bool   `json:"bodyTruncated,omitempty"`
+	StatusCode    int    `json:"statusCode"`
+}
+
+// requestLog logs a sample of the requests of the receiver, it is safe for concurrent use.
+type requestLog struct {
+	config *RequestLogConfig
+
+	lock   sync.Mutex
+	sample *rand.Rand
+	f      *os.File
+	w      *bufio.Writer
+	size   int64
+}
+
+// openRequestLog opens the request log of the given config, requests are appended to an existing file.
+func openRequestLog(config *RequestLogConfig, sample *rand.Rand) (*requestLog, error) {
+	l := &requestLog{config: config, sample: sample}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// open opens the log file, it must be called while holding the lock.
+func (l *requestLog) open() error {
+	f, err := os.OpenFile(l.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open request log: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to open request log: %w", err)
+	}
+	l.f, l.w, l.size = f, bufio.NewWriter(f), info.Size()
+	return nil
+}
+
+// sampled returns true when the next request is logged.
+func (l *requestLog) sampled() bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.sample.Float64()*100 < l.config.SamplePercentage
+}
+
+// append writes the given record, rotating the file once it reaches the maximum size.
+func (l *requestLog) append(r *requestLogRecord) {
+	b, err := json.Marshal(r)
+	if err != nil {
+		logger(LogComponentReceiver).Errorw("Failed to encode request log record", "error", err)
+		return
+	}
+	b = append(b, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.f == nil {
+		return
+	}
+	if l.size > 0 && l.size+int64(len(b)) > l.config.MaxFileBytes {
+		if err := l.rotate(); err != nil {
+			logger(LogComponentReceiver).Errorw("Failed to rotate request log", "path", l.config.Path, "error", err)
+			return
+		}
+	}
+	n, err := l.w.Write(b)
+	l.size += int64(n)
+	if err == nil {
+		err = l.w.Flush()
+	}
+	if err != nil {
+		logger(LogComponentReceiver).Errorw("Failed to write request log", "path", l.config.Path, "error", err)
+	}
+}
+
+// rotate shifts the rotated files, deleting the oldest one, and opens a new file, it must be called while holding the
+// lock.
+func (l *requestLog) rotate() error {
+	if err := l.closeFile(); err != nil {
+		return err
+	}
+	path := l.config.Path
+	_ = os.Remove(fmt.Sprintf("%s.%d", path, l.config.MaxFiles))
+	for i := l.config.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", path, i), fmt.Sprintf("%s.%d", path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(path, path+".1"); err != nil {
+		return err
+	}
+	return l.open()
+}
+
+// closeFile flushes and closes the log file, it must be called while holding the lock.
+func (l *requestLog) closeFile() error {
+	f := l.f
+	l.f = nil
+	if err := l.w.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (l *requestLog) close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.f == nil {
+		return nil
+	}
+	return l.closeFile()
+}
+
+// handler returns a handler logging a sample of the requests served by the given handler.
+func (l *requestLog) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !l.sampled() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		record := &requestLogRecord{
+			Time:       time.Now(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			RemoteAddr: r.RemoteAddr,
+			Headers:    r.Header.Clone(),
+		}
+		body := &capturingReader{r: r.Body, max: l.config.MaxBodyBytes}
+		r.Body = body
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		entry := &requestLogEntry{}
+
+		next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), requestLogEntryKey{}, entry)))
+
+		record.Events = entry.events
+		record.Body, record.BodyTruncated = string(body.captured), body.truncated
+		record.StatusCode = recorder.statusCode
+		l.append(record)
+	})
+}
+
+// requestLogEntry collects the attributes of the events of a logged request, it is safe for concurrent use.
+type requestLogEntry struct {
+	lock   sync.Mutex
+	events []map[string]string
+}
+
+type requestLogEntryKey struct{}
+
+// logRequestEvent adds the attributes of the given event to the log entry of the given request, when it is logged.
+func logRequestEvent(req *http.Request, e *ce.Event) {
+	if req == nil {
+		return
+	}
+	entry, ok := req.Context().Value(requestLogEntryKey{}).(*requestLogEntry)
+	if !ok {
+		return
+	}
+	entry.lock.Lock()
+	defer entry.lock.Unlock()
+	entry.events = append(entry.events, eventAttributes(e, nil))
+}
+
+// capturingReader captures the first max bytes read from r.
+type capturingReader struct {
+	r         io.ReadCloser
+	max       int
+	captured  []byte
+	truncated bool
+}
+
+func (c *capturingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if remaining := c.max - len(c.captured); remaining > 0 {
+		if n > remaining {
+			c.captured = append(c.captured, p[:remaining]...)
+			c.truncated = true
+		} else {
+			c.captured = append(c.captured, p[:n]...)
+		}
+	} else if n > 0 {
+		c.truncated = true
+	}
+	return n, err
+}
+
+func (c *capturingReader) Close() error {
+	return c.r.Close()
+}
+
+// statusRecorder records the status code of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+// Flush implements http.Flusher, gRPC responses are flushed before their trailers.
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type requestLogKey struct{}
+
+func contextWithRequestLog(ctx context.Context, l *requestLog) context.Context {
+	return context.WithValue(ctx, requestLogKey{}, l)
+}
+
+// requestLogFromContext returns the request log carried by the given context, or nil.
+func requestLogFromContext(ctx context.Context) *requestLog {
+	l, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	return l
+}
@@ -0,0 +1,149 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+func TestRequestLogConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   RequestLogConfig
+		protocol Protocol
+		wantErr  bool
+	}{
+		{name: "defaults", config: RequestLogConfig{Path: "requests.jsonl", SamplePercentage: 1}},
+		{name: "grpc", config: RequestLogConfig{Path: "requests.jsonl", SamplePercentage: 0.5}, protocol: ProtocolGRPC},
+		{name: "no path", config: RequestLogConfig{SamplePercentage: 1}, wantErr: true},
+		{name: "no sample", config: RequestLogConfig{Path: "requests.jsonl"}, wantErr: true},
+		{name: "sample over 100", config: RequestLogConfig{Path: "requests.jsonl", SamplePercentage: 101}, wantErr: true},
+		{name: "negative body", config: RequestLogConfig{Path: "requests.jsonl", SamplePercentage: 1, MaxBodyBytes: -1}, wantErr: true},
+		{name: "kafka", config: RequestLogConfig{Path: "requests.jsonl", SamplePercentage: 1}, protocol: ProtocolKafka, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && (tt.config.MaxBodyBytes != DefaultRequestLogMaxBodyBytes || tt.config.MaxFileBytes != DefaultRequestLogMaxFileBytes || tt.config.MaxFiles != DefaultRequestLogMaxFiles) {
+				t.Errorf("want defaults, got %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestRequestLogHandler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	config := &RequestLogConfig{Path: path, SamplePercentage: 100, MaxBodyBytes: 8}
+	if err := config.validate(ProtocolHTTP); err != nil {
+		t.Fatal(err)
+	}
+	l, err := openRequestLog(config, newRand(nil, "receiver.requestLog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(l.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		e := ce.NewEvent()
+		e.SetID("1")
+		e.SetSource("sacura")
+		e.SetType("sacura.test")
+		logRequestEvent(r, &e)
+		b := make([]byte, 64)
+		for {
+			if _, err := r.Body.Read(b); err != nil {
+				break
+			}
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/events", strings.NewReader("0123456789"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Ce-Id", "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []requestLogRecord
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r requestLogRecord
+		if err := json.Unmarshal(s.Bytes(), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 1 {
+		t.Fatalf("want 1 record, got %+v", records)
+	}
+	r := records[0]
+	if r.Path != "/events" || r.StatusCode != http.StatusAccepted || r.Body != "01234567" || !r.BodyTruncated {
+		t.Errorf("unexpected record %+v", r)
+	}
+	if got := r.Headers["Ce-Id"]; len(got) != 1 || got[0] != "1" {
+		t.Errorf("want header Ce-Id 1, got %v", got)
+	}
+	if len(r.Events) != 1 || r.Events[0]["type"] != "sacura.test" {
+		t.Errorf("want the attributes of the event, got %+v", r.Events)
+	}
+}
+
+func TestRequestLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "requests.jsonl")
+	config := &RequestLogConfig{Path: path, SamplePercentage: 100, MaxFileBytes: 1, MaxFiles: 2}
+	if err := config.validate(ProtocolHTTP); err != nil {
+		t.Fatal(err)
+	}
+	l, err := openRequestLog(config, newRand(nil, "receiver.requestLog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/1", "/2", "/3", "/4"} {
+		l.append(&requestLogRecord{Path: p})
+	}
+	if err := l.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Each record is rotated out by the next one, the oldest is deleted.
+	for suffix, want := range map[string]string{"": "/4", ".1": "/3", ".2": "/2"} {
+		b, err := os.ReadFile(path + suffix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r requestLogRecord
+		if err := json.Unmarshal(b, &r); err != nil {
+			t.Fatal(err)
+		}
+		if r.Path != want {
+			t.Errorf("want %s in %s, got %s", want, path+suffix, r.Path)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("want no third rotated file, got %v", err)
+	}
+}
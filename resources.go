@@ -0,0 +1,155 @@
+package sacura
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// resourceUsageInterval is the interval at which the resource usage of sacura is sampled.
+const resourceUsageInterval = time.Second
+
+// ResourceUsageReport is the resource usage of sacura itself during the run, so that consumers of the report can tell
+// when sacura was resource-starved and its results, like latencies, might be unreliable.
+type ResourceUsageReport struct {
+	// PeakRSSBytes is the peak resident set size of the process, it is only reported on Linux. It includes the memory
+	// used before the run when sacura is used as a library.
+	PeakRSSBytes uint64 `json:"peakRssBytes,omitempty"`
+	// PeakHeapAllocBytes and PeakHeapInuseBytes are the peak heap usage, see runtime.MemStats.
+	PeakHeapAllocBytes uint64 `json:"peakHeapAllocBytes"`
+	PeakHeapInuseBytes uint64 `json:"peakHeapInuseBytes"`
+	// PeakGoroutines is the peak number of goroutines.
+	PeakGoroutines int `json:"peakGoroutines"`
+	// GCCount is the number of garbage collections during the run.
+	GCCount uint32 `json:"gcCount"`
+	// GCPauseTotal is the total stop-the-world pause of the garbage collections during the run, MaxGCPause is the
+	// longest one.
+	GCPauseTotal time.Duration `json:"gcPauseTotal"`
+	MaxGCPause   time.Duration `json:"maxGcPause"`
+}
+
+// resourceUsage tracks the resource usage of sacura since the start of the run.
+type resourceUsage struct {
+	started bool
+	// numGC and pauseTotalNs are the garbage collection stats at the start of the run.
+	numGC        uint32
+	pauseTotalNs uint64
+	// lastNumGC is the number of garbage collections at the last sample.
+	lastNumGC uint32
+	report    ResourceUsageReport
+}
+
+// startResourceUsage samples the resource usage of sacura until the returned function is called, which takes a last
+// sample.
+func (s *StateManager) startResourceUsage() func() {
+	s.sampleResourceUsage()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(resourceUsageInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				s.sampleResourceUsage()
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			s.sampleResourceUsage()
+		})
+	}
+}
+
+// sampleResourceUsage records a sample of the resource usage of sacura.
+func (s *StateManager) sampleResourceUsage() {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	goroutines := runtime.NumGoroutine()
+	rss := peakRSS()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	u := &s.resourceUsage
+	if !u.started {
+		u.started = true
+		u.numGC, u.pauseTotalNs, u.lastNumGC = m.NumGC, m.PauseTotalNs, m.NumGC
+	}
+	r := &u.report
+	r.PeakRSSBytes = maxUint64(r.PeakRSSBytes, rss)
+	r.PeakHeapAllocBytes = maxUint64(r.PeakHeapAllocBytes, m.HeapAlloc)
+	r.PeakHeapInuseBytes = maxUint64(r.PeakHeapInuseBytes, m.HeapInuse)
+	if goroutines > r.PeakGoroutines {
+		r.PeakGoroutines = goroutines
+	}
+	r.GCCount = m.NumGC - u.numGC
+	r.GCPauseTotal = time.Duration(m.PauseTotalNs - u.pauseTotalNs)
+	// PauseNs is a circular buffer of the most recent pauses, older pauses of runs sampled less often are lost.
+	for n := u.lastNumGC + 1; n <= m.NumGC && m.NumGC-n < uint32(len(m.PauseNs)); n++ {
+		if pause := time.Duration(m.PauseNs[(n+uint32(len(m.PauseNs))-1)%uint32(len(m.PauseNs))]); pause > r.MaxGCPause {
+			r.MaxGCPause = pause
+		}
+	}
+	u.lastNumGC = m.NumGC
+}
+
+// resourceUsageReport sets the resource usage of the report, it must be called while holding the lock.
+func (s *StateManager) resourceUsageReport(r *Report) {
+	if !s.resourceUsage.started {
+		return
+	}
+	report := s.resourceUsage.report
+	r.ResourceUsage = &report
+}
+
+// peakRSS returns the peak resident set size of the process, it returns 0 when it is unknown.
+func peakRSS() uint64 {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// For example "VmHWM:	   10240 kB".
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmHWM:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "VmHWM:"))
+		if len(fields) != 2 || fields[1] != "kB" {
+			return 0
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0
+		}
+		return kb * 1024
+	}
+	return 0
+}
+
+func maxUint64(a, b uint64) uint64 {
+	if a > b {
+		return a
+	}
+	return b
+}
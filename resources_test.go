@@ -0,0 +1,33 @@
+package sacura
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestResourceUsageReport(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	if r := sm.GenerateReport(); r.ResourceUsage != nil {
+		t.Fatalf("want no resource usage before sampling, got %+v", r.ResourceUsage)
+	}
+
+	stop := sm.startResourceUsage()
+	runtime.GC()
+	runtime.GC()
+	stop()
+	stop()
+
+	r := sm.GenerateReport().ResourceUsage
+	if r == nil {
+		t.Fatal("want resource usage")
+	}
+	if r.PeakHeapAllocBytes == 0 || r.PeakHeapInuseBytes == 0 || r.PeakGoroutines == 0 {
+		t.Errorf("want peak usage, got %+v", r)
+	}
+	if r.GCCount < 2 || r.GCPauseTotal <= 0 || r.MaxGCPause <= 0 || r.MaxGCPause > r.GCPauseTotal {
+		t.Errorf("want the 2 garbage collections of the run, got %+v", r)
+	}
+	if runtime.GOOS == "linux" && r.PeakRSSBytes == 0 {
+		t.Errorf("want peak RSS on linux, got %+v", r)
+	}
+}
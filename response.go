@@ -0,0 +1,120 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultReplyType is the default type of reply events.
+	DefaultReplyType = "sacura.reply"
+	// DefaultReplySource is the default source of reply events.
+	DefaultReplySource = "sacura"
+)
+
+// ReceiverResponseConfig configures the responses of the receiver, to exercise the delivery response contract of
+// the system under test, like the one of Knative Eventing.
+type ReceiverResponseConfig struct {
+	// StatusCode is the status code of successful responses, one of 200, 202 and 204.
+	//
+	// Defaults to 200.
+	StatusCode int `json:"statusCode" yaml:"statusCode"`
+	// Headers are added to every response, including injected failure responses, for example Retry-After.
+	Headers map[string]string `json:"headers" yaml:"headers"`
+	// Reply responds to requests carrying a single event with a reply event in binary content mode, it is not
+	// supported with the 204 status code.
+	Reply *ReceiverReplyConfig `json:"reply" yaml:"reply"`
+}
+
+// ReceiverReplyConfig configures the reply events, the data of a reply event is the data of the received event and
+// its ReplyToExtension is the ID of the received event. Reply events aren't replied to.
+type ReceiverReplyConfig struct {
+	// Type is the type of reply events.
+	//
+	// Defaults to DefaultReplyType.
+	Type string `json:"type" yaml:"type"`
+	// Source is the source of reply events.
+	//
+	// Defaults to DefaultReplySource.
+	Source string `json:"source" yaml:"source"`
+	// Verify verifies that the reply to each received event is received back by the receiver, for example routed by
+	// a Trigger filtering on the reply type, and reports the round-trip latency.
+	Verify bool `json:"verify" yaml:"verify"`
+}
+
+func (c *ReceiverResponseConfig) validate(protocol Protocol) error {
+	if protocol != "" && protocol != ProtocolHTTP {
+		return invalidErr("receiver.response", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	switch c.StatusCode {
+	case 0:
+		c.StatusCode = http.StatusOK
+	case http.StatusOK, http.StatusAccepted, http.StatusNoContent:
+	default:
+		return invalidErr("receiver.response.statusCode", fmt.Errorf("unsupported status code %d, expected one of %v", c.StatusCode, []int{http.StatusOK, http.StatusAccepted, http.StatusNoContent}))
+	}
+	for k := range c.Headers {
+		if k == "" {
+			return invalidErr("receiver.response.headers", errors.New("header name cannot be empty"))
+		}
+	}
+	if c.Reply != nil {
+		if c.StatusCode == http.StatusNoContent {
+			return invalidErr("receiver.response.reply", fmt.Errorf("is not supported with the %d status code", http.StatusNoContent))
+		}
+		if c.Reply.Type == "" {
+			c.Reply.Type = DefaultReplyType
+		}
+		if c.Reply.Source == "" {
+			c.Reply.Source = DefaultReplySource
+		}
+	}
+	return nil
+}
+
+// writeHeaders adds the configured headers to the given response.
+func (c *ReceiverResponseConfig) writeHeaders(w http.ResponseWriter) {
+	if c == nil {
+		return
+	}
+	for k, v := range c.Headers {
+		w.Header().Set(k, v)
+	}
+}
+
+// writeSuccess writes the successful response to a request carrying the given events.
+func (c *ReceiverResponseConfig) writeSuccess(ctx context.Context, w http.ResponseWriter, events []*ce.Event) {
+	if c == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	c.writeHeaders(w)
+	if c.Reply == nil || len(events) != 1 {
+		w.WriteHeader(c.StatusCode)
+		return
+	}
+	if _, ok := replyTo(events[0]); ok {
+		// Replying to replies would loop through the system under test.
+		w.WriteHeader(c.StatusCode)
+		return
+	}
+
+	reply := ce.NewEvent()
+	reply.SetID(uuid.New().String())
+	reply.SetType(c.Reply.Type)
+	reply.SetSource(c.Reply.Source)
+	reply.SetExtension(ReplyToExtension, events[0].ID())
+	if data := events[0].Data(); data != nil {
+		_ = reply.SetData(events[0].DataContentType(), data)
+	}
+	if err := cehttp.WriteResponseWriter(ctx, binding.ToMessage(&reply), c.StatusCode, w); err != nil {
+		logger(LogComponentReceiver).Warnw("Failed to write reply event", "id", events[0].ID(), "error", err)
+	}
+}
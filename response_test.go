@@ -0,0 +1,170 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/cloudevents/sdk-go/v2/binding"
+	cehttp "github.com/cloudevents/sdk-go/v2/protocol/http"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReceiverResponseConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ReceiverResponseConfig
+		protocol Protocol
+		want     ReceiverResponseConfig
+		wantErr  bool
+	}{
+		{
+			name:   "defaults",
+			config: ReceiverResponseConfig{},
+			want:   ReceiverResponseConfig{StatusCode: http.StatusOK},
+		},
+		{
+			name:   "reply defaults",
+			config: ReceiverResponseConfig{StatusCode: http.StatusAccepted, Reply: &ReceiverReplyConfig{}},
+			want: ReceiverResponseConfig{
+				StatusCode: http.StatusAccepted,
+				Reply:      &ReceiverReplyConfig{Type: DefaultReplyType, Source: DefaultReplySource},
+			},
+		},
+		{
+			name:    "unsupported status code",
+			config:  ReceiverResponseConfig{StatusCode: http.StatusCreated},
+			wantErr: true,
+		},
+		{
+			name:    "reply with no content",
+			config:  ReceiverResponseConfig{StatusCode: http.StatusNoContent, Reply: &ReceiverReplyConfig{}},
+			wantErr: true,
+		},
+		{
+			name:    "empty header name",
+			config:  ReceiverResponseConfig{Headers: map[string]string{"": "1"}},
+			wantErr: true,
+		},
+		{
+			name:     "unsupported protocol",
+			config:   ReceiverResponseConfig{},
+			protocol: ProtocolMQTT,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestReceiverResponseConfigWriteSuccess(t *testing.T) {
+	event := cetest.FullEvent()
+	headers := map[string]string{"Retry-After": "10"}
+	replyEvent := cetest.FullEvent()
+	replyEvent.SetExtension(ReplyToExtension, "1")
+
+	tests := []struct {
+		name       string
+		config     *ReceiverResponseConfig
+		events     []*ce.Event
+		wantCode   int
+		wantHeader string
+		wantReply  bool
+	}{
+		{
+			name:     "default",
+			events:   []*ce.Event{&event},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "status code and headers",
+			config:     &ReceiverResponseConfig{StatusCode: http.StatusNoContent, Headers: headers},
+			events:     []*ce.Event{&event},
+			wantCode:   http.StatusNoContent,
+			wantHeader: "10",
+		},
+		{
+			name:      "reply",
+			config:    &ReceiverResponseConfig{StatusCode: http.StatusAccepted, Reply: &ReceiverReplyConfig{Type: "reply", Source: "test"}},
+			events:    []*ce.Event{&event},
+			wantCode:  http.StatusAccepted,
+			wantReply: true,
+		},
+		{
+			name:     "no reply to replies",
+			config:   &ReceiverResponseConfig{StatusCode: http.StatusOK, Reply: &ReceiverReplyConfig{Type: "reply", Source: "test"}},
+			events:   []*ce.Event{&replyEvent},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "no reply to batches",
+			config:   &ReceiverResponseConfig{StatusCode: http.StatusOK, Reply: &ReceiverReplyConfig{Type: "reply", Source: "test"}},
+			events:   []*ce.Event{&event, &event},
+			wantCode: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			tt.config.writeSuccess(context.Background(), w, tt.events)
+
+			if w.Code != tt.wantCode {
+				t.Errorf("want status code %d, got %d", tt.wantCode, w.Code)
+			}
+			if got := w.Header().Get("Retry-After"); got != tt.wantHeader {
+				t.Errorf("want Retry-After %q, got %q", tt.wantHeader, got)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", w.Body)
+			req.Header = w.Header()
+			reply, err := binding.ToEvent(context.Background(), cehttp.NewMessageFromHttpRequest(req))
+			if !tt.wantReply {
+				if err == nil {
+					t.Errorf("expected no reply event, got %v", reply)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reply.Type() != "reply" || reply.Source() != "test" || reply.ID() == "" || reply.Extensions()[ReplyToExtension] != event.ID() {
+				t.Errorf("unexpected reply event %v", reply)
+			}
+			if string(reply.Data()) != string(event.Data()) {
+				t.Errorf("want reply data %q, got %q", string(event.Data()), string(reply.Data()))
+			}
+		})
+	}
+}
+
+func TestReceiverResponseConfigWriteHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	config := &ReceiverResponseConfig{Headers: map[string]string{"Retry-After": "5"}}
+	config.writeHeaders(w)
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("want Retry-After 5, got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	(*ReceiverResponseConfig)(nil).writeHeaders(w)
+	if len(w.Header()) != 0 {
+		t.Errorf("want no headers, got %v", w.Header())
+	}
+}
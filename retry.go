@@ -0,0 +1,223 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultRetryMaxAttempts is the default number of attempts of each request, including the first one.
+	DefaultRetryMaxAttempts = 3
+	// DefaultRetryInitialBackoff is the default time to wait before the first retry.
+	DefaultRetryInitialBackoff = 100 * time.Millisecond
+	// DefaultRetryMaxBackoff is the default maximum time to wait between retries.
+	DefaultRetryMaxBackoff = 5 * time.Second
+	// DefaultRetryMultiplier is the default factor the backoff is multiplied by after each retry.
+	DefaultRetryMultiplier = 2.0
+)
+
+// DefaultRetryStatusCodes are the status codes retried by default.
+var DefaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryConfig configures the retries of requests failing with a transport error or with one of StatusCodes.
+//
+// sender.requestTimeout bounds each attempt and sender.sendDeadline bounds each request including its retries.
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts of each request, including the first one.
+	//
+	// Defaults to DefaultRetryMaxAttempts.
+	MaxAttempts int `json:"maxAttempts" yaml:"maxAttempts"`
+	// InitialBackoff is the time to wait before the first retry, for example 100ms.
+	//
+	// Defaults to DefaultRetryInitialBackoff.
+	InitialBackoff string `json:"initialBackoff" yaml:"initialBackoff"`
+	// MaxBackoff is the maximum time to wait between retries, for example 5s.
+	//
+	// Defaults to DefaultRetryMaxBackoff.
+	MaxBackoff string `json:"maxBackoff" yaml:"maxBackoff"`
+	// Multiplier is the factor the backoff is multiplied by after each retry.
+	//
+	// Defaults to DefaultRetryMultiplier.
+	Multiplier float64 `json:"multiplier" yaml:"multiplier"`
+	// StatusCodes are the response status codes to retry.
+	//
+	// Defaults to DefaultRetryStatusCodes.
+	StatusCodes []int `json:"statusCodes" yaml:"statusCodes"`
+
+	ParsedInitialBackoff time.Duration
+	ParsedMaxBackoff     time.Duration
+}
+
+func (c *RetryConfig) validate() error {
+	if c.MaxAttempts < 0 {
+		return invalidErr("sender.retry.maxAttempts", fmt.Errorf("%d cannot be negative", c.MaxAttempts))
+	}
+	if c.MaxAttempts == 0 {
+		c.MaxAttempts = DefaultRetryMaxAttempts
+	}
+
+	var err error
+	c.ParsedInitialBackoff = DefaultRetryInitialBackoff
+	if c.InitialBackoff != "" {
+		c.ParsedInitialBackoff, err = time.ParseDuration(c.InitialBackoff)
+		if err != nil {
+			return invalidErr("sender.retry.initialBackoff", err)
+		}
+		if c.ParsedInitialBackoff < 0 {
+			return invalidErr("sender.retry.initialBackoff", fmt.Errorf("%v cannot be negative", c.ParsedInitialBackoff))
+		}
+	}
+	c.ParsedMaxBackoff = DefaultRetryMaxBackoff
+	if c.MaxBackoff != "" {
+		c.ParsedMaxBackoff, err = time.ParseDuration(c.MaxBackoff)
+		if err != nil {
+			return invalidErr("sender.retry.maxBackoff", err)
+		}
+	}
+	if c.ParsedMaxBackoff < c.ParsedInitialBackoff {
+		return invalidErr("sender.retry.maxBackoff", fmt.Errorf("%v must be greater or equal to sender.retry.initialBackoff %v", c.ParsedMaxBackoff, c.ParsedInitialBackoff))
+	}
+
+	if c.Multiplier == 0 {
+		c.Multiplier = DefaultRetryMultiplier
+	}
+	if c.Multiplier < 1 {
+		return invalidErr("sender.retry.multiplier", fmt.Errorf("%v must be greater or equal to 1", c.Multiplier))
+	}
+
+	if len(c.StatusCodes) == 0 {
+		c.StatusCodes = append([]int{}, DefaultRetryStatusCodes...)
+	}
+	for _, code := range c.StatusCodes {
+		if code < 100 || code > 599 {
+			return invalidErr("sender.retry.statusCodes", fmt.Errorf("%d is not a valid status code", code))
+		}
+		if code >= 200 && code < 300 {
+			return invalidErr("sender.retry.statusCodes", errors.New("successful status codes cannot be retried"))
+		}
+	}
+	return nil
+}
+
+// backoff returns the time to wait before the given retry, starting from 1.
+func (c *RetryConfig) backoff(retry int) time.Duration {
+	b := float64(c.ParsedInitialBackoff)
+	for i := 1; i < retry && b < float64(c.ParsedMaxBackoff); i++ {
+		b *= c.Multiplier
+	}
+	if b > float64(c.ParsedMaxBackoff) {
+		return c.ParsedMaxBackoff
+	}
+	return time.Duration(b)
+}
+
+func (c *RetryConfig) retryable(code int) bool {
+	for _, retryable := range c.StatusCodes {
+		if retryable == code {
+			return true
+		}
+	}
+	return false
+}
+
+// sendAttempts records the attempts of events sent more than once.
+type sendAttempts struct {
+	lock    sync.Mutex
+	retries int
+	byEvent map[string]int
+}
+
+func newSendAttempts() *sendAttempts {
+	return &sendAttempts{byEvent: make(map[string]int)}
+}
+
+func (a *sendAttempts) record(ids []string, attempts int) {
+	if attempts <= 1 {
+		return
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.retries += attempts - 1
+	for _, id := range ids {
+		a.byEvent[id] = attempts
+	}
+}
+
+func (a *sendAttempts) metrics(m *Metrics) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	m.SendRetryCount = a.retries
+	if len(a.byEvent) > 0 {
+		m.SendAttempts = make(map[string]int, len(a.byEvent))
+		for id, n := range a.byEvent {
+			m.SendAttempts[id] = n
+		}
+	}
+}
+
+// retryTransport is an http.RoundTripper retrying requests according to the sender retry policy.
+type retryTransport struct {
+	config   *RetryConfig
+	next     http.RoundTripper
+	attempts *sendAttempts
+	// throttled is true when next pauses after 429 responses, they are retried without further backoff.
+	throttled bool
+}
+
+func newRetryTransport(config *RetryConfig, next http.RoundTripper, attempts *sendAttempts, throttled bool) *retryTransport {
+	return &retryTransport{config: config, next: next, attempts: attempts, throttled: throttled}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	attempt := 1
+	defer func() { t.attempts.record(req.Header.Values(CloudEventIdHeader), attempt) }()
+
+	for ; ; attempt++ {
+		r := req
+		if attempt > 1 {
+			r = req.Clone(ctx)
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				r.Body = body
+			}
+		}
+
+		resp, err := t.next.RoundTrip(r)
+		if attempt >= t.config.MaxAttempts || ctx.Err() != nil || (req.Body != nil && req.GetBody == nil) {
+			return resp, err
+		}
+		if err == nil && !t.config.retryable(resp.StatusCode) {
+			return resp, nil
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			_ = resp.Body.Close()
+			if t.throttled && resp.StatusCode == http.StatusTooManyRequests {
+				continue
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(t.config.backoff(attempt)):
+		}
+	}
+}
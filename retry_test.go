@@ -0,0 +1,359 @@
+package sacura
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRetryConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  RetryConfig
+		want    RetryConfig
+		wantErr bool
+	}{
+		{
+			name:   "defaults",
+			config: RetryConfig{},
+			want: RetryConfig{
+				MaxAttempts:          DefaultRetryMaxAttempts,
+				Multiplier:           DefaultRetryMultiplier,
+				StatusCodes:          DefaultRetryStatusCodes,
+				ParsedInitialBackoff: DefaultRetryInitialBackoff,
+				ParsedMaxBackoff:     DefaultRetryMaxBackoff,
+			},
+		},
+		{
+			name:   "custom",
+			config: RetryConfig{MaxAttempts: 5, InitialBackoff: "1s", MaxBackoff: "10s", Multiplier: 1.5, StatusCodes: []int{500}},
+			want: RetryConfig{
+				MaxAttempts:          5,
+				InitialBackoff:       "1s",
+				MaxBackoff:           "10s",
+				Multiplier:           1.5,
+				StatusCodes:          []int{500},
+				ParsedInitialBackoff: time.Second,
+				ParsedMaxBackoff:     10 * time.Second,
+			},
+		},
+		{
+			name:    "negative max attempts",
+			config:  RetryConfig{MaxAttempts: -1},
+			wantErr: true,
+		},
+		{
+			name:    "invalid initial backoff",
+			config:  RetryConfig{InitialBackoff: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "max backoff lower than initial backoff",
+			config:  RetryConfig{InitialBackoff: "10s", MaxBackoff: "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "multiplier lower than 1",
+			config:  RetryConfig{Multiplier: 0.5},
+			wantErr: true,
+		},
+		{
+			name:    "successful status code",
+			config:  RetryConfig{StatusCodes: []int{202}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid status code",
+			config:  RetryConfig{StatusCodes: []int{1000}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestRetryConfigBackoff(t *testing.T) {
+	config := RetryConfig{InitialBackoff: "100ms", MaxBackoff: "1s"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, w := range want {
+		if got := config.backoff(i + 1); got != w {
+			t.Errorf("retry %d: want backoff %v, got %v", i+1, w, got)
+		}
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		code         int
+		wantCode     int
+		wantAttempts int
+	}{
+		{
+			name:         "no failures",
+			wantCode:     http.StatusAccepted,
+			wantAttempts: 1,
+		},
+		{
+			name:         "succeeds after retries",
+			failures:     2,
+			code:         http.StatusServiceUnavailable,
+			wantCode:     http.StatusAccepted,
+			wantAttempts: 3,
+		},
+		{
+			name:         "attempts exhausted",
+			failures:     5,
+			code:         http.StatusServiceUnavailable,
+			wantCode:     http.StatusServiceUnavailable,
+			wantAttempts: 3,
+		},
+		{
+			name:         "status code not retried",
+			failures:     5,
+			code:         http.StatusBadRequest,
+			wantCode:     http.StatusBadRequest,
+			wantAttempts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts++
+				if body, _ := ioutil.ReadAll(r.Body); string(body) != "data" {
+					t.Errorf("attempt %d: expected body data, got %q", attempts, string(body))
+				}
+				if attempts <= tt.failures {
+					w.WriteHeader(tt.code)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			config := &RetryConfig{InitialBackoff: "1ms"}
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			sa := newSendAttempts()
+			client := &http.Client{Transport: newRetryTransport(config, http.DefaultTransport, sa, false)}
+
+			req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("data"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Add(CloudEventIdHeader, "1")
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantCode {
+				t.Errorf("want status code %d, got %d", tt.wantCode, resp.StatusCode)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("want %d attempts, got %d", tt.wantAttempts, attempts)
+			}
+			var m Metrics
+			sa.metrics(&m)
+			if m.SendRetryCount != tt.wantAttempts-1 {
+				t.Errorf("want %d retries, got %d", tt.wantAttempts-1, m.SendRetryCount)
+			}
+			if tt.wantAttempts > 1 && m.SendAttempts["1"] != tt.wantAttempts {
+				t.Errorf("want %d attempts recorded, got %v", tt.wantAttempts, m.SendAttempts)
+			}
+		})
+	}
+}
+
+func TestStartSenderRetry(t *testing.T) {
+	tests := []struct {
+		name        string
+		retry       *RetryConfig
+		wantNotSent bool
+	}{
+		{
+			name:  "retried",
+			retry: &RetryConfig{InitialBackoff: "1ms"},
+		},
+		{
+			name:        "not retried",
+			wantNotSent: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			seen := make(map[string]bool)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				defer lock.Unlock()
+
+				// The first attempt of each event is rejected.
+				id := r.Header.Get(CloudEventIdHeader)
+				if !seen[id] {
+					seen[id] = true
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			config := Config{
+				Sender: SenderConfig{
+					Target:             server.URL,
+					FrequencyPerSecond: 10,
+					Workers:            1,
+					Retry:              tt.retry,
+				},
+				ParsedDuration: time.Second,
+			}
+			if tt.retry != nil {
+				if err := tt.retry.validate(); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			sent := make(chan ce.Event, 100)
+			metrics := startSender(context.Background(), config, sent)
+			close(sent)
+
+			if metrics.ProposedCount == 0 {
+				t.Fatalf("expected proposed events, got %+v", metrics)
+			}
+			if tt.wantNotSent {
+				if metrics.AcceptedCount != 0 || metrics.NotSentCount != metrics.ProposedCount || len(metrics.FailedSends) != metrics.ProposedCount {
+					t.Errorf("expected all events not sent, got %+v", metrics)
+				}
+				if metrics.SendRetryCount != 0 || len(metrics.SendAttempts) != 0 {
+					t.Errorf("expected no retries, got %+v", metrics)
+				}
+				return
+			}
+			if metrics.AcceptedCount != metrics.ProposedCount || metrics.NotSentCount != 0 {
+				t.Errorf("expected all events accepted, got %+v", metrics)
+			}
+			if metrics.SendRetryCount != metrics.ProposedCount || len(metrics.SendAttempts) != metrics.ProposedCount {
+				t.Errorf("expected one retry per event, got %+v", metrics)
+			}
+			for id, attempts := range metrics.SendAttempts {
+				if attempts != 2 {
+					t.Errorf("expected 2 attempts for event %s, got %d", id, attempts)
+				}
+			}
+		})
+	}
+}
+
+func TestStartSenderSendDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		retry        *RetryConfig
+		wantTimedOut bool
+	}{
+		{
+			name:  "retried within the deadline",
+			retry: &RetryConfig{InitialBackoff: "1ms"},
+		},
+		{
+			name:         "timed out",
+			wantTimedOut: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lock sync.Mutex
+			seen := make(map[string]bool)
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				lock.Lock()
+				id := r.Header.Get(CloudEventIdHeader)
+				first := !seen[id]
+				seen[id] = true
+				lock.Unlock()
+
+				// The first attempt of each event outlasts the request timeout.
+				if first {
+					select {
+					case <-r.Context().Done():
+					case <-time.After(time.Second):
+					}
+					return
+				}
+				w.WriteHeader(http.StatusAccepted)
+			}))
+			defer server.Close()
+
+			config := Config{
+				Sender: SenderConfig{
+					Target:             server.URL,
+					FrequencyPerSecond: 10,
+					Workers:            10,
+					RequestTimeout:     "50ms",
+					SendDeadline:       "500ms",
+					Retry:              tt.retry,
+				},
+				Receiver:       ReceiverConfig{Timeout: "1m"},
+				Duration:       "500ms",
+				ParsedDuration: 500 * time.Millisecond,
+			}
+			if err := config.validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			sent := make(chan ce.Event, 100)
+			metrics := startSender(context.Background(), config, sent)
+			close(sent)
+
+			if metrics.ProposedCount == 0 {
+				t.Fatalf("expected proposed events, got %+v", metrics)
+			}
+			if tt.wantTimedOut {
+				if metrics.NotSentCount != metrics.ProposedCount || metrics.TimedOutCount != metrics.NotSentCount {
+					t.Errorf("expected all events timed out, got %+v", metrics)
+				}
+				if metrics.Metrics.ErrorClasses[ErrorClassTimeout] != metrics.ProposedCount {
+					t.Errorf("expected timed out requests, got %+v", metrics.Metrics.ErrorClasses)
+				}
+				return
+			}
+			if metrics.AcceptedCount != metrics.ProposedCount || metrics.NotSentCount != 0 || metrics.TimedOutCount != 0 {
+				t.Errorf("expected all events accepted after a retry, got %+v", metrics)
+			}
+			if metrics.SendRetryCount != metrics.ProposedCount {
+				t.Errorf("expected a retry of each event, got %d retries for %d events", metrics.SendRetryCount, metrics.ProposedCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/uuid"
+)
+
+const (
+	// RunIDExtension is the extension carrying the run ID of sent events, received events of other runs are ignored.
+	RunIDExtension = "sacurarunid"
+
+	// RunIDAuto generates a random run ID when the test starts.
+	RunIDAuto = "auto"
+)
+
+func (c *Config) validateRunID() error {
+	if c.RunID != RunIDAuto {
+		return nil
+	}
+	// The sender and the receiver must share the run ID.
+	if c.Sender.Disabled || c.Receiver.Disabled {
+		return invalidErr("runId", fmt.Errorf("%q requires the sender and the receiver in the same run, set an explicit run ID", RunIDAuto))
+	}
+	if c.Distributed != nil && c.Distributed.Role == DistributedRoleInstance {
+		return invalidErr("runId", fmt.Errorf("%q requires the sender and the receiver in the same run, set an explicit run ID", RunIDAuto))
+	}
+	if c.Distributed != nil && c.Distributed.Role == DistributedRoleAggregator {
+		return invalidErr("runId", errors.New("the run ID of instances must be set explicitly"))
+	}
+	c.RunID = "run-" + uuid.New().String()
+	logger(logComponentRun).Infow("Generated run ID", "runId", c.RunID)
+	return nil
+}
+
+// setRunID stamps the run ID on the given sent event.
+func (c *Config) setRunID(e *ce.Event) {
+	if c.RunID != "" {
+		e.SetExtension(RunIDExtension, c.RunID)
+	}
+}
+
+// recordOtherRun records received events of other runs, it returns true when the event carries the run ID of
+// another run. It must be called while holding the lock.
+func (s *StateManager) recordOtherRun(e *ce.Event) bool {
+	if s.config.RunID == "" {
+		return false
+	}
+	runID, ok := eventAttribute(e, RunIDExtension)
+	if !ok || runID == s.config.RunID {
+		return false
+	}
+	if s.otherRuns == nil {
+		s.otherRuns = make(map[string]int)
+	}
+	s.otherRuns[runID]++
+	return true
+}
+
+// otherRunsReport adds the events of other runs to the given report, it must be called while holding the lock.
+func (s *StateManager) otherRunsReport(r *Report) {
+	if len(s.otherRuns) == 0 {
+		return
+	}
+	r.OtherRunsByRunID = make(map[string]int, len(s.otherRuns))
+	for runID, n := range s.otherRuns {
+		r.OtherRunsByRunID[runID] = n
+		r.OtherRunCount += n
+	}
+}
@@ -0,0 +1,117 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestConfigValidateRunID(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   Config
+		wantAuto bool
+		wantErr  bool
+	}{
+		{
+			name:   "explicit",
+			config: Config{RunID: "ci-42"},
+		},
+		{
+			name:     "auto",
+			config:   Config{RunID: RunIDAuto},
+			wantAuto: true,
+		},
+		{
+			name:    "auto with receiver disabled",
+			config:  Config{RunID: RunIDAuto, Receiver: ReceiverConfig{Disabled: true}},
+			wantErr: true,
+		},
+		{
+			name:    "auto with distributed instance",
+			config:  Config{RunID: RunIDAuto, Distributed: &DistributedConfig{Role: DistributedRoleInstance}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runID := tt.config.RunID
+			err := tt.config.validateRunID()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+			if tt.wantAuto && !strings.HasPrefix(tt.config.RunID, "run-") {
+				t.Errorf("want a generated run ID, got %q", tt.config.RunID)
+			}
+			if !tt.wantAuto && tt.config.RunID != runID {
+				t.Errorf("want run ID %q, got %q", runID, tt.config.RunID)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorRunID(t *testing.T) {
+	out := make(chan ce.Event, 3)
+	config := Config{Sender: SenderConfig{Target: "http://localhost:9090", BatchSize: 3}, RunID: "ci-42"}
+	f := NewTargeterGenerator(config, uuid.New, out)
+	if err := f(&vegeta.Target{}); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	for e := range out {
+		if v, _ := eventAttribute(&e, RunIDExtension); v != "ci-42" {
+			t.Errorf("want run ID ci-42, got %q", v)
+		}
+	}
+}
+
+func TestStateManagerOtherRuns(t *testing.T) {
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 5)
+
+	sm := newTestStateManager(t, Config{RunID: "ci-42"})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	event := func(id, runID string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		if runID != "" {
+			e.SetExtension(RunIDExtension, runID)
+		}
+		return e
+	}
+	sent <- event("1", "ci-42")
+	sent <- event("2", "ci-42")
+	for _, e := range []ce.Event{event("1", "ci-42"), event("2", "ci-42"), event("1", "ci-41"), event("1", "ci-41"), event("3", "ci-40")} {
+		received <- ReceivedEvent{Event: e}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 2})
+	report := sm.GenerateReport()
+	if report.ReceivedCount != 2 || report.DuplicateCount != 0 || report.UnexpectedCount != 0 {
+		t.Errorf("want events of other runs to be ignored, got received %d, duplicates %d, unexpected %d", report.ReceivedCount, report.DuplicateCount, report.UnexpectedCount)
+	}
+	if report.OtherRunCount != 3 {
+		t.Errorf("want 3 events of other runs, got %d", report.OtherRunCount)
+	}
+	if diff := cmp.Diff(map[string]int{"ci-41": 2, "ci-40": 1}, report.OtherRunsByRunID); diff != "" {
+		t.Errorf("(-want, +got) %s", diff)
+	}
+	if err := verify(Config{DeliveryGuarantee: ExactlyOnce}, report); err != nil {
+		t.Error("want events of other runs not to fail the verification", err)
+	}
+}
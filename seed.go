@@ -0,0 +1,76 @@
+package sacura
+
+import (
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// lockedSource is a rand.Source safe for concurrent use.
+type lockedSource struct {
+	lock sync.Mutex
+	src  rand.Source64
+}
+
+var _ rand.Source64 = &lockedSource{}
+
+func (s *lockedSource) Int63() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Int63()
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.src.Uint64()
+}
+
+func (s *lockedSource) Seed(seed int64) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.src.Seed(seed)
+}
+
+// newRand returns the source of the random choices of the given component, it is safe for concurrent use except for
+// Read.
+//
+// With a seed, the choices of each component are derived from the seed and the name of the component, so that they
+// don't change when another component makes more or fewer choices. Without a seed, they are seeded with the current
+// time.
+func newRand(seed *int64, component string) *rand.Rand {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(component))
+	s := time.Now().UnixNano()
+	if seed != nil {
+		s = *seed
+	}
+	return rand.New(&lockedSource{src: rand.NewSource(s ^ int64(h.Sum64())).(rand.Source64)})
+}
+
+// newUUIDGenerator returns a generator of random event IDs, the IDs are deterministic with a seed.
+func newUUIDGenerator(seed *int64) func() uuid.UUID {
+	if seed == nil {
+		return uuid.New
+	}
+	var lock sync.Mutex
+	r := newRand(seed, "ids")
+	return func() uuid.UUID {
+		lock.Lock()
+		defer lock.Unlock()
+
+		// Reading from a rand.Rand never fails.
+		return uuid.Must(uuid.NewRandomFromReader(r))
+	}
+}
+
+// seed returns the seed of the config of the StateManager, it returns nil when the StateManager is nil.
+func (s *StateManager) seed() *int64 {
+	if s == nil {
+		return nil
+	}
+	return s.config.Seed
+}
@@ -0,0 +1,94 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestNewRand(t *testing.T) {
+	seed := int64(42)
+	draw := func(seed *int64, component string) []int {
+		r := newRand(seed, component)
+		d := make([]int, 10)
+		for i := range d {
+			d[i] = r.Intn(1000)
+		}
+		return d
+	}
+
+	if diff := cmp.Diff(draw(&seed, "a"), draw(&seed, "a")); diff != "" {
+		t.Errorf("want the same choices with the same seed (-want, +got) %s", diff)
+	}
+	if cmp.Equal(draw(&seed, "a"), draw(&seed, "b")) {
+		t.Error("want independent choices for different components")
+	}
+	other := int64(43)
+	if cmp.Equal(draw(&seed, "a"), draw(&other, "a")) {
+		t.Error("want different choices with different seeds")
+	}
+}
+
+func TestNewTargeterGeneratorSeed(t *testing.T) {
+	type generated struct {
+		ID           string
+		PartitionKey interface{}
+		Data         string
+	}
+
+	generate := func(seed *int64) []generated {
+		n := 20
+		config := Config{
+			Sender: SenderConfig{
+				Target:  "http://localhost:9090",
+				Payload: &PayloadConfig{MinSize: 1, MaxSize: 100},
+			},
+			Ordered: &OrderedConfig{NumPartitionKeys: 10},
+			Seed:    seed,
+		}
+		out := make(chan ce.Event, n)
+		f := NewTargeterGenerator(config, newUUIDGenerator(config.Seed), out)
+		for i := 0; i < n; i++ {
+			if err := f(&vegeta.Target{Header: http.Header{}}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		close(out)
+
+		var events []generated
+		for e := range out {
+			events = append(events, generated{ID: e.ID(), PartitionKey: e.Extensions()[DefaultPartitionKeyExtension], Data: string(e.Data())})
+		}
+		return events
+	}
+
+	seed := int64(7)
+	want := generate(&seed)
+	if diff := cmp.Diff(want, generate(&seed)); diff != "" {
+		t.Errorf("want the same events with the same seed (-want, +got) %s", diff)
+	}
+	if cmp.Equal(want, generate(nil)) {
+		t.Error("want random events without a seed")
+	}
+}
+
+func TestFaultStatusCodeSeed(t *testing.T) {
+	seed := int64(1)
+	config := ReceiverConfig{ReceiverFaultConfig: &ReceiverFaultConfig{
+		Responses: []ReceiverFaultResponseConfig{{StatusCode: http.StatusServiceUnavailable, Percentage: 50}},
+	}}
+	draw := func() []int {
+		r := newRand(&seed, "receiver.fault")
+		codes := make([]int, 50)
+		for i := range codes {
+			codes[i] = faultStatusCode(config.ReceiverFaultConfig, r)
+		}
+		return codes
+	}
+	if diff := cmp.Diff(draw(), draw()); diff != "" {
+		t.Errorf("want the same injected faults with the same seed (-want, +got) %s", diff)
+	}
+}
@@ -0,0 +1,375 @@
+package sacura
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"google.golang.org/grpc/codes"
+)
+
+const (
+	// SendStatusAccepted is the status of events accepted by the broker with the MQTT, AMQP, NATS and Kafka protocols.
+	SendStatusAccepted = "accepted"
+	// SendStatusError is the status of requests that failed without a response, whatever the protocol.
+	SendStatusError = "error"
+)
+
+const (
+	// ErrorClassTimeout is the class of requests that timed out.
+	ErrorClassTimeout = "timeout"
+	// ErrorClassConnectionRefused is the class of requests whose connection has been refused by the target.
+	ErrorClassConnectionRefused = "connectionRefused"
+	// ErrorClassConnectionReset is the class of requests whose connection has been reset or closed by the target.
+	ErrorClassConnectionReset = "connectionReset"
+	// ErrorClassDNS is the class of requests whose target host couldn't be resolved.
+	ErrorClassDNS = "dns"
+	// ErrorClassTLS is the class of requests that failed the TLS handshake.
+	ErrorClassTLS = "tls"
+	// ErrorClassCircuitOpen is the class of requests rejected by the open circuit of sender.circuitBreaker.
+	ErrorClassCircuitOpen = "circuitOpen"
+	// ErrorClassOther is the class of the other errors.
+	ErrorClassOther = "other"
+)
+
+// SendMetrics are the metrics of the requests of the sender, whatever the protocol they have been sent with.
+type SendMetrics struct {
+	// Protocol is the protocol of the sender.
+	Protocol Protocol `json:"protocol,omitempty"`
+	// Requests is the number of requests, including retried attempts and the warmup.
+	Requests int `json:"requests"`
+	// Successes is the number of requests accepted by the target, Success is the ratio of accepted requests.
+	Successes int     `json:"successes"`
+	Success   float64 `json:"success"`
+	// StatusCodes is the distribution of the status of requests: the HTTP status code with the HTTP protocol, the
+	// gRPC status code with the gRPC protocol and SendStatusAccepted with the other protocols. Requests that failed
+	// without a response have the SendStatusError status.
+	StatusCodes map[string]int `json:"statusCodes"`
+	// ErrorClasses is the distribution of the class of requests that failed without a response, for example
+	// ErrorClassTimeout, to tell failures of the sender side apart from the ones of the target.
+	ErrorClasses map[string]int `json:"errorClasses,omitempty"`
+	// Errors are the unique errors of failed requests.
+	Errors []string `json:"errors,omitempty"`
+	// Latencies is the latency of requests.
+	Latencies LatencyStats `json:"latencies"`
+	// Earliest and Latest are the times at which the first and the last request have been sent.
+	Earliest time.Time `json:"earliest"`
+	Latest   time.Time `json:"latest"`
+	// Duration is the time between the first and the last request.
+	Duration time.Duration `json:"duration"`
+	// Rate is the number of requests per second, Throughput is the number of successful requests per second until
+	// the last response.
+	Rate       float64 `json:"rate"`
+	Throughput float64 `json:"throughput"`
+	// TargetRate is the average number of requests per second the sender has been paced at, a Rate lower than the
+	// TargetRate means the sender couldn't keep up, for example because all workers were busy, and events missing
+	// from the receiver may never have been sent rather than lost by the system under test.
+	TargetRate float64 `json:"targetRate,omitempty"`
+	// Rates are the target and the achieved rate over time.
+	Rates []RateSample `json:"rates,omitempty"`
+	// BytesIn and BytesOut are the total size of the bodies of responses and requests.
+	BytesIn  uint64 `json:"bytesIn"`
+	BytesOut uint64 `json:"bytesOut"`
+}
+
+// sendResult is the result of a request of a sender, whatever the protocol and the library it has been sent with.
+type sendResult struct {
+	// Status is the status of the request according to the protocol, as reported in SendMetrics.StatusCodes.
+	Status string
+	// Accepted is true when the target accepted the request.
+	Accepted bool
+	// Error is the error of the request, requests that failed without a response have the SendStatusError status.
+	Error string
+	// Timestamp is the time at which the request has been sent, Latency is the time until its response.
+	Timestamp time.Time
+	Latency   time.Duration
+	// BytesIn and BytesOut are the size of the bodies of the response and the request.
+	BytesIn  uint64
+	BytesOut uint64
+}
+
+// newSendResult returns the result of the given request sent by the attacker, ok is true when the target accepted the
+// request.
+func newSendResult(protocol Protocol, res *vegeta.Result, ok bool) sendResult {
+	return sendResult{
+		Status:    sendStatus(protocol, res),
+		Accepted:  ok,
+		Error:     res.Error,
+		Timestamp: res.Timestamp,
+		Latency:   res.Latency,
+		BytesIn:   res.BytesIn,
+		BytesOut:  res.BytesOut,
+	}
+}
+
+// metricsRecorder accumulates the metrics of the requests of a sender. Senders record the result of each request
+// regardless of their protocol, so that the reported SendMetrics don't depend on how requests are sent.
+type metricsRecorder interface {
+	// record records the result of a request.
+	record(res sendResult)
+	// close returns the metrics of the recorded results.
+	close() SendMetrics
+}
+
+// sendMetrics is the metricsRecorder of senders, it keeps the latencies in a histogram.
+type sendMetrics struct {
+	metrics   SendMetrics
+	latencies *latencyHistogram
+	errors    map[string]struct{}
+	// end is the time at which the last response has been received.
+	end time.Time
+
+	// start is the time at which the attack began, the target rate of pacers is sampled from it and requests are
+	// counted per second since it.
+	start    time.Time
+	pacers   []vegeta.Pacer
+	requests map[int]int
+}
+
+// RateSample is the target and the achieved number of requests per second during an interval of the attack.
+type RateSample struct {
+	// Offset is the start of the interval from the beginning of the attack.
+	Offset   time.Duration `json:"offset"`
+	Target   float64       `json:"target"`
+	Achieved float64       `json:"achieved"`
+}
+
+func newSendMetrics(protocol Protocol) *sendMetrics {
+	if protocol == "" {
+		protocol = ProtocolHTTP
+	}
+	return &sendMetrics{
+		metrics:   SendMetrics{Protocol: protocol, StatusCodes: make(map[string]int)},
+		latencies: newLatencyHistogram(),
+		errors:    make(map[string]struct{}),
+		requests:  make(map[int]int),
+	}
+}
+
+// paced samples the target rate of the given pacers, whose attacks begin at start.
+func (m *sendMetrics) paced(start time.Time, pacers ...vegeta.Pacer) {
+	m.start = start
+	m.pacers = pacers
+}
+
+func (m *sendMetrics) record(res sendResult) {
+	m.metrics.Requests++
+	if res.Accepted {
+		m.metrics.Successes++
+	}
+	m.metrics.StatusCodes[res.Status]++
+	if res.Error != "" {
+		m.errors[res.Error] = struct{}{}
+		if res.Status == SendStatusError {
+			if m.metrics.ErrorClasses == nil {
+				m.metrics.ErrorClasses = make(map[string]int)
+			}
+			m.metrics.ErrorClasses[errorClass(res.Error)]++
+		}
+	}
+	m.latencies.record(res.Latency)
+	m.metrics.BytesIn += res.BytesIn
+	m.metrics.BytesOut += res.BytesOut
+
+	if m.metrics.Earliest.IsZero() || res.Timestamp.Before(m.metrics.Earliest) {
+		m.metrics.Earliest = res.Timestamp
+	}
+	if res.Timestamp.After(m.metrics.Latest) {
+		m.metrics.Latest = res.Timestamp
+	}
+	if end := res.Timestamp.Add(res.Latency); end.After(m.end) {
+		m.end = end
+	}
+	if !m.start.IsZero() && !res.Timestamp.Before(m.start) {
+		m.requests[int(res.Timestamp.Sub(m.start)/time.Second)]++
+	}
+}
+
+func (m *sendMetrics) close() SendMetrics {
+	metrics := m.metrics
+	metrics.Latencies = m.latencies.stats()
+	for err := range m.errors {
+		metrics.Errors = append(metrics.Errors, err)
+	}
+	sort.Strings(metrics.Errors)
+	if metrics.Requests == 0 {
+		return metrics
+	}
+	metrics.Success = float64(metrics.Successes) / float64(metrics.Requests)
+	metrics.Duration = metrics.Latest.Sub(metrics.Earliest)
+	if metrics.Duration > 0 {
+		metrics.Rate = float64(metrics.Requests) / metrics.Duration.Seconds()
+	}
+	if elapsed := m.end.Sub(metrics.Earliest); elapsed > 0 {
+		metrics.Throughput = float64(metrics.Successes) / elapsed.Seconds()
+	}
+	metrics.TargetRate, metrics.Rates = m.rates()
+	return metrics
+}
+
+// rates returns the average target rate and the target and achieved rates over time, the target rate of each second
+// is the sum of the rate of the pacers in the middle of the second. Like the throughput timeline, the interval grows
+// with the duration of the attack. The last interval ends with the last request, its achieved rate can be lower than
+// its target rate.
+func (m *sendMetrics) rates() (float64, []RateSample) {
+	if m.start.IsZero() || len(m.pacers) == 0 || m.metrics.Latest.Before(m.start) {
+		return 0, nil
+	}
+	seconds := int(m.metrics.Latest.Sub(m.start)/time.Second) + 1
+	interval := 1
+	if seconds >= maxTimelineSamples {
+		interval = seconds/maxTimelineSamples + 1
+	}
+	samples := make([]RateSample, 0, (seconds+interval-1)/interval)
+	var total float64
+	for i := 0; i < seconds; i += interval {
+		sample := RateSample{Offset: time.Duration(i) * time.Second}
+		n := 0
+		for s := i; s < i+interval && s < seconds; s++ {
+			for _, p := range m.pacers {
+				rate := p.Rate(time.Duration(s)*time.Second + time.Second/2)
+				sample.Target += rate
+				total += rate
+			}
+			sample.Achieved += float64(m.requests[s])
+			n++
+		}
+		sample.Target /= float64(n)
+		sample.Achieved /= float64(n)
+		samples = append(samples, sample)
+	}
+	return total / float64(seconds), samples
+}
+
+// sendStatus returns the status of the given result according to the protocol.
+func sendStatus(protocol Protocol, res *vegeta.Result) string {
+	if res.Code == 0 {
+		return SendStatusError
+	}
+	if protocol == ProtocolGRPC {
+		if res.Code != http.StatusOK {
+			return strconv.Itoa(int(grpcStatusCode(int(res.Code))))
+		}
+		if s := res.Headers.Get(grpcStatusHeader); s != "" {
+			return s
+		}
+		return strconv.Itoa(int(codes.OK))
+	}
+	// The transports of protocol bindings respond with acceptedResponse.
+	if _, ok := protocolBindings[protocol]; ok && res.Code == http.StatusOK {
+		return SendStatusAccepted
+	}
+	return strconv.Itoa(int(res.Code))
+}
+
+// errorClass returns the class of the given error of a request that failed without a response.
+func errorClass(err string) string {
+	switch {
+	case strings.Contains(err, errCircuitOpen.Error()):
+		return ErrorClassCircuitOpen
+	case strings.Contains(err, "no such host") || strings.Contains(err, "server misbehaving") || strings.Contains(err, "lookup "):
+		return ErrorClassDNS
+	case strings.Contains(err, "timeout") || strings.Contains(err, "deadline exceeded"):
+		return ErrorClassTimeout
+	case strings.Contains(err, "connection refused"):
+		return ErrorClassConnectionRefused
+	case strings.Contains(err, "connection reset") || strings.Contains(err, "broken pipe") || strings.HasSuffix(err, "EOF"):
+		return ErrorClassConnectionReset
+	case strings.Contains(err, "tls:") || strings.Contains(err, "x509:"):
+		return ErrorClassTLS
+	default:
+		return ErrorClassOther
+	}
+}
+
+// mergeSendMetrics merges the metrics of senders running concurrently. Latency percentiles can't be merged, the
+// merged latencies are the highest of each percentile.
+func mergeSendMetrics(a, b SendMetrics) SendMetrics {
+	m := SendMetrics{
+		Protocol:    a.Protocol,
+		Requests:    a.Requests + b.Requests,
+		Successes:   a.Successes + b.Successes,
+		StatusCodes: make(map[string]int, len(a.StatusCodes)+len(b.StatusCodes)),
+		Latencies: LatencyStats{
+			Count: a.Latencies.Count + b.Latencies.Count,
+			P50:   maxDuration(a.Latencies.P50, b.Latencies.P50),
+			P90:   maxDuration(a.Latencies.P90, b.Latencies.P90),
+			P99:   maxDuration(a.Latencies.P99, b.Latencies.P99),
+			Max:   maxDuration(a.Latencies.Max, b.Latencies.Max),
+		},
+		Earliest:   a.Earliest,
+		Latest:     a.Latest,
+		Rate:       a.Rate + b.Rate,
+		Throughput: a.Throughput + b.Throughput,
+		TargetRate: a.TargetRate + b.TargetRate,
+		Rates:      mergeRateSamples(a.Rates, b.Rates),
+		BytesIn:    a.BytesIn + b.BytesIn,
+		BytesOut:   a.BytesOut + b.BytesOut,
+	}
+	if m.Protocol == "" {
+		m.Protocol = b.Protocol
+	}
+	for _, codes := range []map[string]int{a.StatusCodes, b.StatusCodes} {
+		for code, count := range codes {
+			m.StatusCodes[code] += count
+		}
+	}
+	for _, classes := range []map[string]int{a.ErrorClasses, b.ErrorClasses} {
+		for class, count := range classes {
+			if m.ErrorClasses == nil {
+				m.ErrorClasses = make(map[string]int)
+			}
+			m.ErrorClasses[class] += count
+		}
+	}
+	errs := make(map[string]struct{}, len(a.Errors)+len(b.Errors))
+	for _, err := range append(append([]string{}, a.Errors...), b.Errors...) {
+		if _, ok := errs[err]; !ok {
+			errs[err] = struct{}{}
+			m.Errors = append(m.Errors, err)
+		}
+	}
+	sort.Strings(m.Errors)
+	if m.Earliest.IsZero() || (!b.Earliest.IsZero() && b.Earliest.Before(m.Earliest)) {
+		m.Earliest = b.Earliest
+	}
+	if b.Latest.After(m.Latest) {
+		m.Latest = b.Latest
+	}
+	m.Duration = m.Latest.Sub(m.Earliest)
+	if m.Requests > 0 {
+		m.Success = float64(m.Successes) / float64(m.Requests)
+	}
+	return m
+}
+
+// mergeRateSamples merges the rates over time of senders running concurrently, samples with the same offset are added.
+func mergeRateSamples(a, b []RateSample) []RateSample {
+	if len(a) == 0 || len(b) == 0 {
+		return append(append([]RateSample(nil), a...), b...)
+	}
+	byOffset := make(map[time.Duration]RateSample, len(a)+len(b))
+	for _, s := range append(append([]RateSample(nil), a...), b...) {
+		merged := byOffset[s.Offset]
+		merged.Offset = s.Offset
+		merged.Target += s.Target
+		merged.Achieved += s.Achieved
+		byOffset[s.Offset] = merged
+	}
+	merged := make([]RateSample, 0, len(byOffset))
+	for _, s := range byOffset {
+		merged = append(merged, s)
+	}
+	sort.Slice(merged, func(i, j int) bool { return merged[i].Offset < merged[j].Offset })
+	return merged
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,150 @@
+package sacura
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestSendStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol Protocol
+		res      vegeta.Result
+		want     string
+	}{
+		{name: "http", protocol: ProtocolHTTP, res: vegeta.Result{Code: http.StatusAccepted}, want: "202"},
+		{name: "http error", protocol: ProtocolHTTP, res: vegeta.Result{Error: "connection refused"}, want: SendStatusError},
+		{name: "grpc ok", protocol: ProtocolGRPC, res: vegeta.Result{Code: http.StatusOK}, want: "0"},
+		{
+			name:     "grpc status",
+			protocol: ProtocolGRPC,
+			res:      vegeta.Result{Code: http.StatusOK, Headers: http.Header{grpcStatusHeader: []string{"14"}}},
+			want:     "14",
+		},
+		{name: "grpc http status", protocol: ProtocolGRPC, res: vegeta.Result{Code: http.StatusServiceUnavailable}, want: "14"},
+		{name: "kafka accepted", protocol: ProtocolKafka, res: vegeta.Result{Code: http.StatusOK}, want: SendStatusAccepted},
+		{name: "mqtt error", protocol: ProtocolMQTT, res: vegeta.Result{Error: "not connected"}, want: SendStatusError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sendStatus(tt.protocol, &tt.res); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  string
+		want string
+	}{
+		{err: `Post "http://localhost:8080": context deadline exceeded (Client.Timeout exceeded while awaiting headers)`, want: ErrorClassTimeout},
+		{err: "read tcp 127.0.0.1:4000->127.0.0.1:8080: i/o timeout", want: ErrorClassTimeout},
+		{err: `Post "http://localhost:8080": dial tcp 127.0.0.1:8080: connect: connection refused`, want: ErrorClassConnectionRefused},
+		{err: "read tcp 127.0.0.1:4000->127.0.0.1:8080: read: connection reset by peer", want: ErrorClassConnectionReset},
+		{err: `Post "http://localhost:8080": EOF`, want: ErrorClassConnectionReset},
+		{err: `Post "http://broker.invalid": dial tcp: lookup broker.invalid: no such host`, want: ErrorClassDNS},
+		{err: "dial tcp: lookup broker on 10.0.0.10:53: read udp: i/o timeout", want: ErrorClassDNS},
+		{err: "x509: certificate signed by unknown authority", want: ErrorClassTLS},
+		{err: "kafka: client has run out of available brokers", want: ErrorClassOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Errorf("want %q for %q, got %q", tt.want, tt.err, got)
+			}
+		})
+	}
+}
+
+func TestSendMetrics(t *testing.T) {
+	start := time.Now()
+	m := newSendMetrics(ProtocolKafka)
+	m.record(sendResult{Status: SendStatusAccepted, Accepted: true, Timestamp: start, Latency: 10 * time.Millisecond, BytesOut: 100})
+	m.record(sendResult{Status: SendStatusAccepted, Accepted: true, Timestamp: start.Add(time.Second), Latency: 20 * time.Millisecond, BytesOut: 100})
+	m.record(sendResult{Status: SendStatusError, Error: "i/o timeout", Timestamp: start.Add(2 * time.Second), Latency: time.Second})
+	m.record(sendResult{Status: SendStatusError, Error: "i/o timeout", Timestamp: start.Add(500 * time.Millisecond), Latency: time.Second})
+
+	got := m.close()
+	want := SendMetrics{
+		Protocol:     ProtocolKafka,
+		Requests:     4,
+		Successes:    2,
+		Success:      0.5,
+		StatusCodes:  map[string]int{SendStatusAccepted: 2, SendStatusError: 2},
+		ErrorClasses: map[string]int{ErrorClassTimeout: 2},
+		Errors:       []string{"i/o timeout"},
+		Latencies:    got.Latencies,
+		Earliest:     start,
+		Latest:       start.Add(2 * time.Second),
+		Duration:     2 * time.Second,
+		Rate:         2,
+		Throughput:   2.0 / 3.0,
+		BytesOut:     200,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if got.Latencies.Count != 4 || got.Latencies.Max != time.Second {
+		t.Errorf("want 4 latencies up to 1s, got %+v", got.Latencies)
+	}
+
+	empty := newSendMetrics("").close()
+	if empty.Protocol != ProtocolHTTP || empty.Requests != 0 || empty.Success != 0 {
+		t.Errorf("want empty HTTP metrics, got %+v", empty)
+	}
+}
+
+func TestMergeSendMetrics(t *testing.T) {
+	start := time.Now()
+	a := SendMetrics{
+		Protocol:    ProtocolGRPC,
+		Requests:    3,
+		Successes:   3,
+		StatusCodes: map[string]int{"0": 3},
+		Latencies:   LatencyStats{Count: 3, P50: time.Millisecond, P90: 5 * time.Millisecond, P99: 5 * time.Millisecond, Max: 5 * time.Millisecond},
+		Earliest:    start.Add(time.Second),
+		Latest:      start.Add(3 * time.Second),
+		Rate:        1,
+		Throughput:  1,
+		BytesOut:    30,
+	}
+	b := SendMetrics{
+		Protocol:     ProtocolGRPC,
+		Requests:     2,
+		StatusCodes:  map[string]int{"14": 1, SendStatusError: 1},
+		ErrorClasses: map[string]int{ErrorClassConnectionRefused: 1},
+		Errors:       []string{"connection refused", "unavailable"},
+		Latencies:    LatencyStats{Count: 2, P50: 2 * time.Millisecond, P90: 2 * time.Millisecond, P99: 2 * time.Millisecond, Max: 2 * time.Millisecond},
+		Earliest:     start,
+		Latest:       start,
+		BytesOut:     10,
+	}
+
+	want := SendMetrics{
+		Protocol:     ProtocolGRPC,
+		Requests:     5,
+		Successes:    3,
+		Success:      0.6,
+		StatusCodes:  map[string]int{"0": 3, "14": 1, SendStatusError: 1},
+		ErrorClasses: map[string]int{ErrorClassConnectionRefused: 1},
+		Errors:       []string{"connection refused", "unavailable"},
+		Latencies:    LatencyStats{Count: 5, P50: 2 * time.Millisecond, P90: 5 * time.Millisecond, P99: 5 * time.Millisecond, Max: 5 * time.Millisecond},
+		Earliest:     start,
+		Latest:       start.Add(3 * time.Second),
+		Duration:     3 * time.Second,
+		Rate:         1,
+		Throughput:   1,
+		BytesOut:     40,
+	}
+	if diff := cmp.Diff(want, mergeSendMetrics(a, b)); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
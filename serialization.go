@@ -0,0 +1,409 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+const (
+	SerializationAvro     = "avro"
+	SerializationProtobuf = "protobuf"
+
+	// DefaultSchemaVersion is the default version of the schema fetched from the schema registry.
+	DefaultSchemaVersion = "latest"
+
+	schemaRegistryContentType = "application/vnd.schemaregistry.v1+json"
+	// schemaRegistryMagicByte is the first byte of data in the schema registry wire format, followed by the schema ID
+	// as a 4 bytes big-endian integer.
+	schemaRegistryMagicByte = 0
+)
+
+// SerializationConfig encodes the data of sent events as Avro or Protobuf, in the wire format of Confluent-compatible
+// schema registries: a magic byte, the schema ID and, for Protobuf, the message indexes, followed by the encoded data.
+// The data of received events is verified to deserialize against the expected schema version.
+//
+// Data is generated from the schema, or decoded from the JSON rendered by sender.payload.template when set: union
+// branches of Avro values are selected by their JSON type, Protobuf values use the Protobuf JSON mapping. Protobuf
+// schemas can only import the well-known types.
+type SerializationConfig struct {
+	// Format is either SerializationAvro or SerializationProtobuf.
+	Format string `json:"format" yaml:"format"`
+	// Registry is the schema registry the schema is fetched from or registered in.
+	Registry SchemaRegistryConfig `json:"registry" yaml:"registry"`
+	// Subject is the subject of the schema.
+	Subject string `json:"subject" yaml:"subject"`
+	// Version is the version of the schema fetched from the registry, ignored when Schema is specified.
+	//
+	// Defaults to DefaultSchemaVersion.
+	Version string `json:"version" yaml:"version"`
+	// Schema is registered in the subject when the test starts, the registered version is the expected one.
+	Schema string `json:"schema" yaml:"schema"`
+	// Message is the full name of the Protobuf message data is encoded as.
+	//
+	// Defaults to the first message of the schema.
+	Message string `json:"message" yaml:"message"`
+
+	// Resolved is the schema resolved from the registry when the test starts.
+	Resolved *RegisteredSchema `json:"-" yaml:"-"`
+}
+
+// SchemaRegistryConfig configures the Confluent-compatible schema registry.
+type SchemaRegistryConfig struct {
+	// URL is the URL of the schema registry.
+	URL string `json:"url" yaml:"url"`
+	// Username and Password authenticate with the HTTP basic authentication.
+	Username string `json:"username" yaml:"username"`
+	Password string `json:"password" yaml:"password" secret:"true"`
+}
+
+// RegisteredSchema is a version of a schema in the schema registry.
+type RegisteredSchema struct {
+	Subject string `json:"subject"`
+	ID      int    `json:"id"`
+	Version int    `json:"version"`
+	Schema  string `json:"schema"`
+	// SchemaType is AVRO when empty.
+	SchemaType string `json:"schemaType,omitempty"`
+}
+
+func (c *SerializationConfig) validate(config *Config) error {
+	switch c.Format {
+	case SerializationAvro, SerializationProtobuf:
+	default:
+		return invalidErr("serialization.format", fmt.Errorf("unknown format %q, expected one of %q or %q", c.Format, SerializationAvro, SerializationProtobuf))
+	}
+	if u, err := url.Parse(c.Registry.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidErr("serialization.registry.url", fmt.Errorf("%q must be an http or https URL", c.Registry.URL))
+	}
+	if c.Registry.Password != "" && c.Registry.Username == "" {
+		return invalidErr("serialization.registry.username", errors.New("must be specified with a password"))
+	}
+	if c.Subject == "" {
+		return invalidErr("serialization.subject", errors.New("must be specified"))
+	}
+	if c.Version == "" {
+		c.Version = DefaultSchemaVersion
+	}
+	if v, err := strconv.Atoi(c.Version); c.Version != DefaultSchemaVersion && (err != nil || v < 1) {
+		return invalidErr("serialization.version", fmt.Errorf("%q must be %s or a positive version", c.Version, DefaultSchemaVersion))
+	}
+	if c.Message != "" && c.Format != SerializationProtobuf {
+		return invalidErr("serialization.message", fmt.Errorf("is only supported with the %s format", SerializationProtobuf))
+	}
+	if c.Schema != "" {
+		if _, err := newSchemaCodec(c.Format, c.Schema, c.Message); err != nil {
+			return invalidErr("serialization.schema", err)
+		}
+	}
+
+	if p := config.Sender.Payload; p != nil && p.Template == "" {
+		return invalidErr("serialization", errors.New("data is generated from the schema, sender.payload can only be a template"))
+	}
+	if a := config.Sender.Attributes; a != nil && a.DataContentType != "" {
+		return invalidErr("sender.attributes.datacontenttype", errors.New("cannot be used with serialization"))
+	}
+	if config.Receiver.StreamPayloads {
+		return invalidErr("receiver.streamPayloads", errors.New("cannot be used with serialization, the data of received events is verified"))
+	}
+	return nil
+}
+
+// schemaType returns the schema type of the format in the schema registry.
+func (c *SerializationConfig) schemaType() string {
+	if c.Format == SerializationProtobuf {
+		return "PROTOBUF"
+	}
+	return "AVRO"
+}
+
+// schemaCodec generates, encodes and verifies data of a schema, without the schema registry wire format header.
+type schemaCodec interface {
+	// generate returns the encoding of a random value of the schema.
+	generate(r *rand.Rand) ([]byte, error)
+	// encode returns the encoding of the given JSON value of the schema.
+	encode(data []byte) ([]byte, error)
+	// verify returns an error when the given data doesn't deserialize against the schema.
+	verify(b []byte) error
+}
+
+func newSchemaCodec(format, schema, message string) (schemaCodec, error) {
+	if format == SerializationProtobuf {
+		return newProtobufCodec(schema, message)
+	}
+	return newAvroCodec(schema)
+}
+
+// schemaRegistryClient is a client of the schema registry API.
+type schemaRegistryClient struct {
+	config *SerializationConfig
+	client *http.Client
+}
+
+// resolveSerialization resolves the schema of the given config from the schema registry, registering it when
+// specified, and validates it. It does nothing when serialization is disabled.
+func resolveSerialization(ctx context.Context, config *Config) error {
+	c := config.Serialization
+	if c == nil || c.Resolved != nil {
+		return nil
+	}
+	client := &schemaRegistryClient{config: c, client: &http.Client{Timeout: 30 * time.Second}}
+	s, err := client.resolve(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to resolve schema of subject %s: %w", c.Subject, err)
+	}
+	schemaType := s.SchemaType
+	if schemaType == "" {
+		schemaType = "AVRO"
+	}
+	if schemaType != c.schemaType() {
+		return fmt.Errorf("schema %d of subject %s is a %s schema, expected %s", s.ID, c.Subject, schemaType, c.schemaType())
+	}
+	if _, err := newSchemaCodec(c.Format, s.Schema, c.Message); err != nil {
+		return fmt.Errorf("invalid schema %d of subject %s: %w", s.ID, c.Subject, err)
+	}
+	logger(logComponentRun).Infow("Resolved schema", "subject", s.Subject, "version", s.Version, "id", s.ID)
+	c.Resolved = s
+	return nil
+}
+
+func (c *schemaRegistryClient) resolve(ctx context.Context) (*RegisteredSchema, error) {
+	subject := "/subjects/" + url.PathEscape(c.config.Subject)
+	if c.config.Schema == "" {
+		s := &RegisteredSchema{}
+		if err := c.do(ctx, http.MethodGet, subject+"/versions/"+url.PathEscape(c.config.Version), nil, s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	schema := &RegisteredSchema{Schema: c.config.Schema}
+	if c.config.Format != SerializationAvro {
+		schema.SchemaType = c.config.schemaType()
+	}
+	if err := c.do(ctx, http.MethodPost, subject+"/versions", schema, &RegisteredSchema{}); err != nil {
+		return nil, fmt.Errorf("failed to register schema: %w", err)
+	}
+	// Looking up the registered schema returns its version.
+	s := &RegisteredSchema{}
+	if err := c.do(ctx, http.MethodPost, subject, schema, s); err != nil {
+		return nil, fmt.Errorf("failed to look up registered schema: %w", err)
+	}
+	if s.Schema == "" {
+		s.Schema = c.config.Schema
+	}
+	return s, nil
+}
+
+func (c *schemaRegistryClient) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(c.config.Registry.URL, "/")+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", schemaRegistryContentType)
+	if in != nil {
+		req.Header.Set("Content-Type", schemaRegistryContentType)
+	}
+	if c.config.Registry.Username != "" {
+		req.SetBasicAuth(c.config.Registry.Username, c.config.Registry.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// serializer sets the data of sent events encoded in the schema registry wire format.
+type serializer struct {
+	codec       schemaCodec
+	header      []byte
+	contentType string
+	dataSchema  string
+	rand        *rand.Rand
+}
+
+func newSerializer(config *SerializationConfig, r *rand.Rand) (*serializer, error) {
+	if config.Resolved == nil {
+		return nil, fmt.Errorf("schema of subject %s not resolved", config.Subject)
+	}
+	codec, err := newSchemaCodec(config.Format, config.Resolved.Schema, config.Message)
+	if err != nil {
+		return nil, err
+	}
+	s := &serializer{
+		codec:       codec,
+		header:      schemaRegistryHeader(config.Resolved.ID),
+		contentType: "application/avro",
+		dataSchema:  fmt.Sprintf("%s/schemas/ids/%d", strings.TrimSuffix(config.Registry.URL, "/"), config.Resolved.ID),
+		rand:        r,
+	}
+	if config.Format == SerializationProtobuf {
+		s.contentType = "application/x-protobuf"
+	}
+	return s, nil
+}
+
+func schemaRegistryHeader(id int) []byte {
+	b := make([]byte, 5)
+	b[0] = schemaRegistryMagicByte
+	binary.BigEndian.PutUint32(b[1:], uint32(id))
+	return b
+}
+
+// setData encodes the JSON data of the given event, or data generated from the schema when the event has no data.
+func (s *serializer) setData(e *ce.Event) error {
+	var b []byte
+	var err error
+	if data := e.Data(); len(data) > 0 {
+		if b, err = s.codec.encode(data); err != nil {
+			return fmt.Errorf("failed to encode data of event %s: %w", e.ID(), err)
+		}
+	} else if b, err = s.codec.generate(s.rand); err != nil {
+		return err
+	}
+	e.SetDataContentType(s.contentType)
+	if e.DataSchema() == "" {
+		e.SetDataSchema(s.dataSchema)
+	}
+	e.DataEncoded = append(append(make([]byte, 0, len(s.header)+len(b)), s.header...), b...)
+	e.DataBase64 = false
+	return nil
+}
+
+// SerializationReport reports the deliveries whose data doesn't deserialize against the expected schema version.
+type SerializationReport struct {
+	Format   string `json:"format"`
+	Subject  string `json:"subject"`
+	Version  int    `json:"version"`
+	SchemaID int    `json:"schemaId"`
+	// CheckedCount is the number of checked deliveries, excluding failure responses and the dead-letter sink.
+	CheckedCount int `json:"checkedCount"`
+	// InvalidCount is the number of deliveries whose data doesn't deserialize against the expected schema version.
+	InvalidCount int `json:"invalidCount"`
+	// WrongSchemaCount is the number of invalid deliveries whose data is encoded with another schema ID.
+	WrongSchemaCount            int                 `json:"wrongSchemaCount,omitempty"`
+	InvalidEventsByPartitionKey map[string][]string `json:"invalidEvents,omitempty"`
+}
+
+// serializationState tracks the deliveries whose data doesn't deserialize against the expected schema version.
+type serializationState struct {
+	config        *SerializationConfig
+	codec         schemaCodec
+	checked       int
+	invalid       int
+	wrongSchema   int
+	invalidEvents map[string][]string
+}
+
+// newSerializationState returns the state of the serialization verification, it returns nil when serialization is
+// disabled or the schema has not been resolved.
+func newSerializationState(config *SerializationConfig) *serializationState {
+	if config == nil || config.Resolved == nil {
+		return nil
+	}
+	codec, err := newSchemaCodec(config.Format, config.Resolved.Schema, config.Message)
+	if err != nil {
+		logger(LogComponentState).Errorw("Invalid schema, data of received events is not verified", "error", err)
+		return nil
+	}
+	return &serializationState{config: config, codec: codec, invalidEvents: make(map[string][]string)}
+}
+
+// verifyData returns an error when the given data doesn't deserialize against the expected schema version, wrong is
+// true when the data is encoded with another schema ID.
+func (s *serializationState) verifyData(data []byte) (wrong bool, err error) {
+	if len(data) < 5 || data[0] != schemaRegistryMagicByte {
+		return false, errors.New("data is not in the schema registry wire format")
+	}
+	if id := int(binary.BigEndian.Uint32(data[1:5])); id != s.config.Resolved.ID {
+		return true, fmt.Errorf("data is encoded with schema %d, expected %d", id, s.config.Resolved.ID)
+	}
+	return false, s.codec.verify(data[5:])
+}
+
+// recordSerialization verifies the data of the given delivery, it must be called while holding the lock.
+func (s *StateManager) recordSerialization(e *ReceivedEvent) {
+	st := s.serialization
+	if st == nil {
+		return
+	}
+	st.checked++
+	wrong, err := st.verifyData(e.Event.Data())
+	if err == nil {
+		return
+	}
+	logger(LogComponentState).Warnw("Received event with invalid data", "id", e.Event.ID(), "error", err)
+	st.invalid++
+	if wrong {
+		st.wrongSchema++
+	}
+	insert(&e.Event, st.invalidEvents, &s.stateManagerConfig)
+}
+
+// serializationReport sets the serialization section of the report, it must be called while holding the lock.
+func (s *StateManager) serializationReport(r *Report) {
+	st := s.serialization
+	if st == nil {
+		return
+	}
+	report := &SerializationReport{
+		Format:           st.config.Format,
+		Subject:          st.config.Resolved.Subject,
+		Version:          st.config.Resolved.Version,
+		SchemaID:         st.config.Resolved.ID,
+		CheckedCount:     st.checked,
+		InvalidCount:     st.invalid,
+		WrongSchemaCount: st.wrongSchema,
+	}
+	if len(st.invalidEvents) > 0 {
+		report.InvalidEventsByPartitionKey = make(map[string][]string, len(st.invalidEvents))
+		for k, v := range st.invalidEvents {
+			invalid, _ := removeDuplicates(v)
+			sort.Strings(invalid)
+			report.InvalidEventsByPartitionKey[k] = invalid
+		}
+	}
+	r.Serialization = report
+}
+
+// verifySerialization verifies the data of received events deserializes against the expected schema version, when
+// enabled.
+func verifySerialization(report Report) error {
+	if report.Serialization == nil || report.Serialization.InvalidCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d deliveries don't deserialize against version %d of schema %s (%d with another schema)",
+		report.Serialization.InvalidCount,
+		report.Serialization.CheckedCount,
+		report.Serialization.Version,
+		report.Serialization.Subject,
+		report.Serialization.WrongSchemaCount,
+	)
+}
@@ -0,0 +1,250 @@
+package sacura
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSerializationConfigValidate(t *testing.T) {
+	valid := func() SerializationConfig {
+		return SerializationConfig{Format: SerializationAvro, Registry: SchemaRegistryConfig{URL: "http://registry:8081"}, Subject: "orders-value"}
+	}
+	tests := []struct {
+		name    string
+		config  func(c *SerializationConfig, root *Config)
+		wantErr bool
+	}{
+		{name: "valid", config: func(c *SerializationConfig, root *Config) {}},
+		{name: "version", config: func(c *SerializationConfig, root *Config) { c.Version = "3" }},
+		{name: "schema", config: func(c *SerializationConfig, root *Config) { c.Schema = testAvroSchema }},
+		{name: "protobuf message", config: func(c *SerializationConfig, root *Config) {
+			c.Format, c.Schema, c.Message = SerializationProtobuf, testProtoSchema, "com.example.Order.Item"
+		}},
+		{name: "payload template", config: func(c *SerializationConfig, root *Config) {
+			root.Sender.Payload = &PayloadConfig{Template: `{"id": "{{.ID}}"}`}
+		}},
+		{name: "unknown format", config: func(c *SerializationConfig, root *Config) { c.Format = "json" }, wantErr: true},
+		{name: "invalid registry", config: func(c *SerializationConfig, root *Config) { c.Registry.URL = "registry:8081" }, wantErr: true},
+		{name: "password without username", config: func(c *SerializationConfig, root *Config) { c.Registry.Password = "p" }, wantErr: true},
+		{name: "no subject", config: func(c *SerializationConfig, root *Config) { c.Subject = "" }, wantErr: true},
+		{name: "invalid version", config: func(c *SerializationConfig, root *Config) { c.Version = "0" }, wantErr: true},
+		{name: "avro message", config: func(c *SerializationConfig, root *Config) { c.Message = "A" }, wantErr: true},
+		{name: "invalid schema", config: func(c *SerializationConfig, root *Config) { c.Schema = "{" }, wantErr: true},
+		{name: "unknown message", config: func(c *SerializationConfig, root *Config) {
+			c.Format, c.Schema, c.Message = SerializationProtobuf, testProtoSchema, "Unknown"
+		}, wantErr: true},
+		{name: "sized payload", config: func(c *SerializationConfig, root *Config) {
+			root.Sender.Payload = &PayloadConfig{Size: 10}
+		}, wantErr: true},
+		{name: "streamed payloads", config: func(c *SerializationConfig, root *Config) { root.Receiver.StreamPayloads = true }, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			root := &Config{}
+			tt.config(&c, root)
+			err := c.validate(root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && c.Version == "" {
+				t.Error("want default version")
+			}
+		})
+	}
+}
+
+// newTestSchemaRegistry returns a schema registry serving the given schemas of subject orders-value by version,
+// registered schemas are appended.
+func newTestSchemaRegistry(t *testing.T, schemas []RegisteredSchema) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, _ := r.BasicAuth(); user != "user" || password != "password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", schemaRegistryContentType)
+		switch {
+		case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/subjects/orders-value/versions/"):
+			version := strings.TrimPrefix(r.URL.Path, "/subjects/orders-value/versions/")
+			if version == DefaultSchemaVersion {
+				_ = json.NewEncoder(w).Encode(schemas[len(schemas)-1])
+				return
+			}
+			for _, s := range schemas {
+				if version == string(rune('0'+s.Version)) {
+					_ = json.NewEncoder(w).Encode(s)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/orders-value/versions":
+			s := RegisteredSchema{}
+			_ = json.NewDecoder(r.Body).Decode(&s)
+			s.Subject, s.ID, s.Version = "orders-value", 100+len(schemas), len(schemas)+1
+			schemas = append(schemas, s)
+			_ = json.NewEncoder(w).Encode(map[string]int{"id": s.ID})
+		case r.Method == http.MethodPost && r.URL.Path == "/subjects/orders-value":
+			s := RegisteredSchema{}
+			_ = json.NewDecoder(r.Body).Decode(&s)
+			for _, registered := range schemas {
+				if registered.Schema == s.Schema {
+					_ = json.NewEncoder(w).Encode(registered)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestResolveSerialization(t *testing.T) {
+
+	registry := newTestSchemaRegistry(t, []RegisteredSchema{
+		{Subject: "orders-value", ID: 1, Version: 1, Schema: `"string"`},
+		{Subject: "orders-value", ID: 7, Version: 2, Schema: testAvroSchema},
+	})
+	defer registry.Close()
+
+	tests := []struct {
+		name    string
+		config  SerializationConfig
+		want    *RegisteredSchema
+		wantErr bool
+	}{
+		{
+			name:   "latest",
+			config: SerializationConfig{Format: SerializationAvro, Version: DefaultSchemaVersion},
+			want:   &RegisteredSchema{Subject: "orders-value", ID: 7, Version: 2, Schema: testAvroSchema},
+		},
+		{
+			name:   "version",
+			config: SerializationConfig{Format: SerializationAvro, Version: "1"},
+			want:   &RegisteredSchema{Subject: "orders-value", ID: 1, Version: 1, Schema: `"string"`},
+		},
+		{
+			name:   "register",
+			config: SerializationConfig{Format: SerializationProtobuf, Schema: testProtoSchema},
+			want:   &RegisteredSchema{Subject: "orders-value", ID: 102, Version: 3, Schema: testProtoSchema, SchemaType: "PROTOBUF"},
+		},
+		{name: "unknown version", config: SerializationConfig{Format: SerializationAvro, Version: "9"}, wantErr: true},
+		{name: "wrong schema type", config: SerializationConfig{Format: SerializationProtobuf, Version: "1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Registry = SchemaRegistryConfig{URL: registry.URL, Username: "user", Password: "password"}
+			tt.config.Subject = "orders-value"
+			config := &Config{Serialization: &tt.config}
+			err := resolveSerialization(context.Background(), config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if diff := cmp.Diff(tt.want, config.Serialization.Resolved); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerSerialization(t *testing.T) {
+
+	for _, format := range []string{SerializationAvro, SerializationProtobuf} {
+		t.Run(format, func(t *testing.T) {
+			schema := testAvroSchema
+			if format == SerializationProtobuf {
+				schema = testProtoSchema
+			}
+			c := &SerializationConfig{
+				Format:   format,
+				Registry: SchemaRegistryConfig{URL: "http://registry:8081"},
+				Subject:  "orders-value",
+				Resolved: &RegisteredSchema{Subject: "orders-value", ID: 7, Version: 2, Schema: schema},
+			}
+			s, err := newSerializer(c, newRand(nil, "serialization"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			other, err := newSerializer(&SerializationConfig{Format: format, Resolved: &RegisteredSchema{ID: 8, Schema: schema}}, newRand(nil, "serialization"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			event := func(id string, s *serializer) ce.Event {
+				e := ce.NewEvent()
+				e.SetID(id)
+				e.SetSource("sacura")
+				e.SetType("sacura.order")
+				if s != nil {
+					if err := s.setData(&e); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return e
+			}
+			valid := event("1", s)
+			if valid.DataSchema() != "http://registry:8081/schemas/ids/7" {
+				t.Errorf("unexpected dataschema %s", valid.DataSchema())
+			}
+			truncated := event("4", s)
+			truncated.DataEncoded = truncated.DataEncoded[:len(truncated.DataEncoded)-1]
+
+			sm := newTestStateManager(t, Config{Serialization: c})
+			sm.lock.Lock()
+			for _, e := range []ce.Event{valid, event("2", other), event("3", nil), truncated} {
+				sm.recordReceived(&ReceivedEvent{Event: e})
+			}
+			sm.lock.Unlock()
+
+			report := sm.GenerateReport()
+			want := &SerializationReport{
+				Format:                      format,
+				Subject:                     "orders-value",
+				Version:                     2,
+				SchemaID:                    7,
+				CheckedCount:                4,
+				InvalidCount:                3,
+				WrongSchemaCount:            1,
+				InvalidEventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2", "3", "4"}},
+			}
+			if diff := cmp.Diff(want, report.Serialization); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+			if err := verifySerialization(report); err == nil {
+				t.Error("expected error for invalid data")
+			}
+		})
+	}
+}
+
+func TestSerializerTemplate(t *testing.T) {
+
+	c := &SerializationConfig{Format: SerializationAvro, Resolved: &RegisteredSchema{ID: 1, Schema: `{"type": "record", "name": "A", "fields": [{"name": "id", "type": "string"}]}`}}
+	s, err := newSerializer(c, newRand(nil, "serialization"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := cetest.FullEvent()
+	if err := e.SetData("application/json", map[string]string{"id": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.setData(&e); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]byte{0, 0, 0, 0, 1, 6, 'a', 'b', 'c'}, e.Data()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if e.DataContentType() != "application/avro" {
+		t.Errorf("unexpected datacontenttype %s", e.DataContentType())
+	}
+}
@@ -0,0 +1,358 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutputShardsHash is the hash function assigning records to shards, the FNV-1a 32-bit hash of the partition key
+// modulo the number of shards.
+const OutputShardsHash = "fnv1a32"
+
+// OutputShardsConfig splits an output file into shards by partition key hash, with an index file listing the files of
+// every shard, so that downstream tools can process the output of large runs in parallel and no file exceeds a
+// maximum size.
+//
+// The files of the output <dir>/<name><ext> are <dir>/<name>-<shard>-<part><ext>, for example events-0003-0000.jsonl,
+// and the index is <dir>/<name>.index.json.
+type OutputShardsConfig struct {
+	// Count is the number of shards, records are assigned to the shard of their partition key, or of their ID when
+	// they have none.
+	Count int `json:"count" yaml:"count"`
+	// MaxFileBytes is the size at which the file of a shard is closed, its records continue in a new part.
+	//
+	// Defaults to 0, no limit.
+	MaxFileBytes int64 `json:"maxFileBytes" yaml:"maxFileBytes"`
+}
+
+func (c *OutputShardsConfig) validate(field string) error {
+	if c.Count <= 0 {
+		return invalidErr(field+".count", fmt.Errorf("%d must be greater than 0", c.Count))
+	}
+	if c.MaxFileBytes < 0 {
+		return invalidErr(field+".maxFileBytes", fmt.Errorf("%d cannot be negative", c.MaxFileBytes))
+	}
+	return nil
+}
+
+// OutputShardsIndex is the index file of a sharded output.
+type OutputShardsIndex struct {
+	// Shards is the number of shards.
+	Shards int `json:"shards"`
+	// Hash is the hash function assigning records to shards, OutputShardsHash.
+	Hash string `json:"hash"`
+	// Files are the files of the shards, by shard and part.
+	Files []OutputShardFile `json:"files"`
+}
+
+// OutputShardFile is a file of a shard.
+type OutputShardFile struct {
+	// Path is the path of the file relative to the index.
+	Path  string `json:"path"`
+	Shard int    `json:"shard"`
+	// Part is the index of the file among the files of the shard, records are in order across parts.
+	Part    int   `json:"part"`
+	Records int64 `json:"records"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// shardIndexPath returns the path of the index of the sharded output at the given path.
+func shardIndexPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + ".index.json"
+}
+
+// shardFileName returns the name of the given part of the given shard of the output at the given path.
+func shardFileName(path string, shard, part int) string {
+	ext := filepath.Ext(path)
+	return fmt.Sprintf("%s-%04d-%04d%s", filepath.Base(strings.TrimSuffix(path, ext)), shard, part, ext)
+}
+
+// shardOf returns the shard of the given partition key among count shards.
+func shardOf(key string, count int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(count))
+}
+
+// outputShard is the file of a shard records are appended to.
+type outputShard struct {
+	f    *os.File
+	w    *bufio.Writer
+	file int
+}
+
+// shardedWriter writes records to the shards of an output, it isn't safe for concurrent use.
+type shardedWriter struct {
+	config *OutputShardsConfig
+	path   string
+	dir    string
+	// header is written at the beginning of every file, for example the header line of CSV files.
+	header []byte
+	index  OutputShardsIndex
+	shards []*outputShard
+}
+
+// openShardedWriter opens the sharded output at the given path, records are appended to the last part of each shard
+// of an existing index so that a restarted test keeps the records written before the restart.
+func openShardedWriter(path string, config *OutputShardsConfig, header []byte) (*shardedWriter, error) {
+	w := &shardedWriter{
+		config: config,
+		path:   path,
+		dir:    filepath.Dir(path),
+		header: header,
+		index:  OutputShardsIndex{Shards: config.Count, Hash: OutputShardsHash},
+		shards: make([]*outputShard, config.Count),
+	}
+
+	last := make(map[int]int)
+	if b, err := os.ReadFile(shardIndexPath(path)); err == nil {
+		index := OutputShardsIndex{}
+		if err := json.Unmarshal(b, &index); err != nil {
+			return nil, fmt.Errorf("failed to read index %s: %w", shardIndexPath(path), err)
+		}
+		if index.Shards != config.Count || index.Hash != OutputShardsHash {
+			return nil, fmt.Errorf("index %s has %d %s shards, expected %d %s shards", shardIndexPath(path), index.Shards, index.Hash, config.Count, OutputShardsHash)
+		}
+		w.index.Files = index.Files
+		for i, f := range index.Files {
+			if j, ok := last[f.Shard]; !ok || f.Part > index.Files[j].Part {
+				last[f.Shard] = i
+			}
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read index %s: %w", shardIndexPath(path), err)
+	}
+
+	for shard := range w.shards {
+		i, ok := last[shard]
+		if !ok {
+			w.index.Files = append(w.index.Files, OutputShardFile{Path: shardFileName(path, shard, 0), Shard: shard})
+			i = len(w.index.Files) - 1
+		}
+		if err := w.open(shard, i); err != nil {
+			_ = w.close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// open opens the given file of the index for the given shard.
+func (w *shardedWriter) open(shard, file int) error {
+	path := filepath.Join(w.dir, w.index.Files[file].Path)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	s := &outputShard{f: f, w: bufio.NewWriter(f), file: file}
+	w.shards[shard] = s
+	w.index.Files[file].Bytes = info.Size()
+	if info.Size() == 0 && len(w.header) > 0 {
+		n, _ := s.w.Write(w.header)
+		w.index.Files[file].Bytes += int64(n)
+	}
+	return nil
+}
+
+// write appends the given record to the shard of the given partition key, the file of the shard is rolled over when
+// the record would exceed the maximum size.
+func (w *shardedWriter) write(key string, record []byte) error {
+	shard := shardOf(key, w.config.Count)
+	s := w.shards[shard]
+	file := &w.index.Files[s.file]
+	if w.config.MaxFileBytes > 0 && file.Records > 0 && file.Bytes+int64(len(record)) > w.config.MaxFileBytes {
+		if err := w.roll(shard); err != nil {
+			return err
+		}
+		s = w.shards[shard]
+		file = &w.index.Files[s.file]
+	}
+	n, err := s.w.Write(record)
+	file.Bytes += int64(n)
+	if err != nil {
+		return err
+	}
+	file.Records++
+	return nil
+}
+
+// roll closes the file of the given shard and opens the next part, the index is written so that it lists the closed
+// file.
+func (w *shardedWriter) roll(shard int) error {
+	s := w.shards[shard]
+	if err := closeShard(s); err != nil {
+		return err
+	}
+	part := w.index.Files[s.file].Part + 1
+	w.index.Files = append(w.index.Files, OutputShardFile{Path: shardFileName(w.path, shard, part), Shard: shard, Part: part})
+	if err := w.open(shard, len(w.index.Files)-1); err != nil {
+		return err
+	}
+	return w.writeIndex()
+}
+
+// flush writes the buffered records of every shard to their files.
+func (w *shardedWriter) flush() error {
+	var err error
+	for _, s := range w.shards {
+		if s == nil {
+			continue
+		}
+		if ferr := s.w.Flush(); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return err
+}
+
+func (w *shardedWriter) writeIndex() error {
+	files := append([]OutputShardFile(nil), w.index.Files...)
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Shard != files[j].Shard {
+			return files[i].Shard < files[j].Shard
+		}
+		return files[i].Part < files[j].Part
+	})
+	return writeFileAtomically(shardIndexPath(w.path), OutputShardsIndex{Shards: w.index.Shards, Hash: w.index.Hash, Files: files})
+}
+
+// close closes the files of every shard and writes the index.
+func (w *shardedWriter) close() error {
+	var err error
+	for i, s := range w.shards {
+		if s == nil {
+			continue
+		}
+		if cerr := closeShard(s); cerr != nil && err == nil {
+			err = cerr
+		}
+		w.shards[i] = nil
+	}
+	if ierr := w.writeIndex(); ierr != nil && err == nil {
+		err = ierr
+	}
+	return err
+}
+
+func closeShard(s *outputShard) error {
+	if err := s.w.Flush(); err != nil {
+		_ = s.f.Close()
+		return err
+	}
+	return s.f.Close()
+}
+
+// shardedOutputFiles returns the paths of the index and of the files of the sharded output at the given path.
+func shardedOutputFiles(path string) ([]string, error) {
+	b, err := os.ReadFile(shardIndexPath(path))
+	if err != nil {
+		return nil, err
+	}
+	index := OutputShardsIndex{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		return nil, fmt.Errorf("failed to read index %s: %w", shardIndexPath(path), err)
+	}
+	paths := []string{shardIndexPath(path)}
+	for _, f := range index.Files {
+		paths = append(paths, filepath.Join(filepath.Dir(path), f.Path))
+	}
+	return paths, nil
+}
+
+// LostEventsExportConfig writes the lost events of the report to a file as JSON lines, without the limits of the
+// logged and written reports, so that they can be reprocessed or compared across runs.
+type LostEventsExportConfig struct {
+	// Path is the path of the file the lost events are written to, it is replaced when it exists.
+	Path string `json:"path" yaml:"path"`
+	// Shards splits the file into shards by partition key.
+	Shards *OutputShardsConfig `json:"shards" yaml:"shards"`
+}
+
+func (c *LostEventsExportConfig) validate() error {
+	if c.Path == "" {
+		return invalidErr("report.lostEvents.path", errors.New("cannot be empty"))
+	}
+	if c.Shards != nil {
+		return c.Shards.validate("report.lostEvents.shards")
+	}
+	return nil
+}
+
+// lostEventRecord is a record of the lost events file.
+type lostEventRecord struct {
+	ID           string `json:"id"`
+	PartitionKey string `json:"partitionKey,omitempty"`
+}
+
+// writeLostEvents writes the lost events of the given report, sorted by partition key.
+func writeLostEvents(config *LostEventsExportConfig, report Report) error {
+	keys := make([]string, 0, len(report.LostEventsByPartitionKey))
+	for k := range report.LostEventsByPartitionKey {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	if config.Shards != nil {
+		// A new run replaces the shards of a previous one.
+		if paths, err := shardedOutputFiles(config.Path); err == nil {
+			for _, p := range paths {
+				_ = os.Remove(p)
+			}
+		}
+		w, err := openShardedWriter(config.Path, config.Shards, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			for _, id := range report.LostEventsByPartitionKey[k] {
+				b, err := json.Marshal(lostEventRecord{ID: id, PartitionKey: k})
+				if err != nil {
+					_ = w.close()
+					return err
+				}
+				key := k
+				if key == "" {
+					key = id
+				}
+				if err := w.write(key, append(b, '\n')); err != nil {
+					_ = w.close()
+					return err
+				}
+			}
+		}
+		return w.close()
+	}
+
+	f, err := os.Create(config.Path)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, k := range keys {
+		for _, id := range report.LostEventsByPartitionKey[k] {
+			if err := enc.Encode(lostEventRecord{ID: id, PartitionKey: k}); err != nil {
+				_ = f.Close()
+				return err
+			}
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
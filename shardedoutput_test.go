@@ -0,0 +1,250 @@
+package sacura
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOutputShardsConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  OutputShardsConfig
+		wantErr bool
+	}{
+		{name: "valid", config: OutputShardsConfig{Count: 16, MaxFileBytes: 1 << 30}},
+		{name: "no size limit", config: OutputShardsConfig{Count: 1}},
+		{name: "no shards", config: OutputShardsConfig{}, wantErr: true},
+		{name: "negative size", config: OutputShardsConfig{Count: 4, MaxFileBytes: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate("report.eventLog.shards"); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestShardFileNames(t *testing.T) {
+	if got := shardFileName("/tmp/out/events.jsonl", 3, 12); got != "events-0003-0012.jsonl" {
+		t.Errorf("want events-0003-0012.jsonl, got %s", got)
+	}
+	if got := shardIndexPath("/tmp/out/events.jsonl"); got != "/tmp/out/events.index.json" {
+		t.Errorf("want /tmp/out/events.index.json, got %s", got)
+	}
+}
+
+// readShards returns the lines of every shard of the sharded output at the given path, by shard, and its index.
+func readShards(t *testing.T, path string) (map[int][]string, OutputShardsIndex) {
+	t.Helper()
+	b, err := os.ReadFile(shardIndexPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := OutputShardsIndex{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	lines := make(map[int][]string)
+	for _, f := range index.Files {
+		file, err := os.Open(filepath.Join(filepath.Dir(path), f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int64
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			lines[f.Shard] = append(lines[f.Shard], scanner.Text())
+			n++
+		}
+		_ = file.Close()
+		if n != f.Records {
+			t.Errorf("%s: index has %d records, got %d", f.Path, f.Records, n)
+		}
+	}
+	return lines, index
+}
+
+func TestShardedWriter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	config := &OutputShardsConfig{Count: 2, MaxFileBytes: 16}
+
+	write := func(keys ...string) {
+		w, err := openShardedWriter(path, config, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, k := range keys {
+			if err := w.write(k, []byte(fmt.Sprintf("%s-%d\n", k, i))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Records of each key are 4 bytes long, files hold at most 4 records.
+	write("a", "b", "a", "b", "a", "a", "a")
+	// Records of a restarted test are appended.
+	write("a", "b")
+
+	lines, index := readShards(t, path)
+	a, b := shardOf("a", 2), shardOf("b", 2)
+	if a == b {
+		t.Fatal("want a and b in different shards")
+	}
+	want := map[int][]string{
+		a: {"a-0", "a-2", "a-4", "a-5", "a-6", "a-0"},
+		b: {"b-1", "b-3", "b-1"},
+	}
+	if diff := cmp.Diff(want, lines); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if index.Shards != 2 || index.Hash != OutputShardsHash {
+		t.Errorf("want 2 %s shards, got %+v", OutputShardsHash, index)
+	}
+	var parts []string
+	for _, f := range index.Files {
+		if f.Bytes > config.MaxFileBytes {
+			t.Errorf("%s: %d bytes exceed %d bytes", f.Path, f.Bytes, config.MaxFileBytes)
+		}
+		parts = append(parts, f.Path)
+	}
+	sort.Strings(parts)
+	wantParts := []string{
+		shardFileName(path, a, 0), shardFileName(path, a, 1),
+		shardFileName(path, b, 0),
+	}
+	sort.Strings(wantParts)
+	if diff := cmp.Diff(wantParts, parts); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if _, err := openShardedWriter(path, &OutputShardsConfig{Count: 3}, nil); err == nil {
+		t.Error("want error for an index with a different number of shards")
+	}
+}
+
+func TestShardedEventLog(t *testing.T) {
+	config := Config{
+		Ordered: &OrderedConfig{NumPartitionKeys: 2},
+		Report: ReportConfig{EventLog: &EventLogConfig{
+			Path:   filepath.Join(t.TempDir(), "events.csv"),
+			Format: EventLogFormatCSV,
+			Shards: &OutputShardsConfig{Count: 2},
+		}},
+	}
+	if err := config.Report.EventLog.validate(); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := make(chan ce.Event, 3)
+	sentSignal := sm.ReadSent(sent)
+	for _, id := range []string{"0-1", "0-2", "1-1"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, id[:1])
+		setSentTimestamp(&e, time.Unix(100, 0))
+		sent <- e
+	}
+	close(sent)
+	<-sentSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 3, SendAttempts: map[string]int{"0-2": 2}})
+
+	b, err := os.ReadFile(shardIndexPath(config.Report.EventLog.Path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	index := OutputShardsIndex{}
+	if err := json.Unmarshal(b, &index); err != nil {
+		t.Fatal(err)
+	}
+	rows := make(map[string][][]string)
+	for _, f := range index.Files {
+		file, err := os.Open(filepath.Join(filepath.Dir(config.Report.EventLog.Path), f.Path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, err := csv.NewReader(file).ReadAll()
+		_ = file.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) == 0 || !cmp.Equal(records[0], eventLogCSVHeader) {
+			t.Errorf("%s: want the CSV header, got %v", f.Path, records)
+			continue
+		}
+		for _, r := range records[1:] {
+			// Records of a partition key are in the same shard.
+			rows[r[2]] = append(rows[r[2]], []string{r[0], r[1], fmt.Sprint(f.Shard)})
+		}
+	}
+
+	s0, s1 := fmt.Sprint(shardOf("0", 2)), fmt.Sprint(shardOf("1", 2))
+	want := map[string][][]string{
+		"0": {{"sent", "0-1", s0}, {"sent", "0-2", s0}, {"retried", "0-2", s0}},
+		"1": {{"sent", "1-1", s1}},
+	}
+	if diff := cmp.Diff(want, rows); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestWriteLostEvents(t *testing.T) {
+	report := Report{LostEventsByPartitionKey: map[string][]string{"1": {"1-3"}, "0": {"0-1", "0-2"}}}
+
+	t.Run("single file", func(t *testing.T) {
+		config := &LostEventsExportConfig{Path: filepath.Join(t.TempDir(), "lost.jsonl")}
+		if err := writeLostEvents(config, report); err != nil {
+			t.Fatal(err)
+		}
+		b, err := os.ReadFile(config.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"id":"0-1","partitionKey":"0"}
+{"id":"0-2","partitionKey":"0"}
+{"id":"1-3","partitionKey":"1"}
+`
+		if diff := cmp.Diff(want, string(b)); diff != "" {
+			t.Error("(-want, +got)", diff)
+		}
+	})
+
+	t.Run("shards", func(t *testing.T) {
+		config := &LostEventsExportConfig{Path: filepath.Join(t.TempDir(), "lost.jsonl"), Shards: &OutputShardsConfig{Count: 2}}
+		// A previous run is replaced.
+		if err := writeLostEvents(config, Report{LostEventsByPartitionKey: map[string][]string{"0": {"0-9"}}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeLostEvents(config, report); err != nil {
+			t.Fatal(err)
+		}
+		lines, _ := readShards(t, config.Path)
+		want := map[int][]string{
+			shardOf("0", 2): {`{"id":"0-1","partitionKey":"0"}`, `{"id":"0-2","partitionKey":"0"}`},
+			shardOf("1", 2): {`{"id":"1-3","partitionKey":"1"}`},
+		}
+		if diff := cmp.Diff(want, lines); diff != "" {
+			t.Error("(-want, +got)", diff)
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+type DelayDistribution string
+
+const (
+	// DelayDistributionFixed delays each request by ProcessingDelayConfig.Duration.
+	DelayDistributionFixed DelayDistribution = "fixed"
+	// DelayDistributionUniform delays each request by a uniformly distributed duration between
+	// ProcessingDelayConfig.Min and ProcessingDelayConfig.Max.
+	DelayDistributionUniform DelayDistribution = "uniform"
+	// DelayDistributionNormal delays each request by a normally distributed duration with mean
+	// ProcessingDelayConfig.Duration and standard deviation ProcessingDelayConfig.StdDev.
+	DelayDistributionNormal DelayDistribution = "normal"
+	// DelayDistributionExponential delays each request by an exponentially distributed duration with mean
+	// ProcessingDelayConfig.Duration.
+	DelayDistributionExponential DelayDistribution = "exponential"
+	// DelayDistributionPareto delays each request by a Pareto distributed duration with scale, the minimum delay,
+	// ProcessingDelayConfig.Min and shape ProcessingDelayConfig.Shape, so that a few requests have a long processing
+	// time like real consumers.
+	DelayDistributionPareto DelayDistribution = "pareto"
+)
+
+// SlowConsumerConfig simulates a slow consumer, to verify that the system under test applies backpressure or buffers
+// events without losing them.
+type SlowConsumerConfig struct {
+	// MaxConcurrency is the maximum number of requests processed concurrently, further requests wait for a request to
+	// complete before being processed.
+	//
+	// Defaults to 0, no limit.
+	MaxConcurrency int `json:"maxConcurrency" yaml:"maxConcurrency"`
+	// Delay is the processing delay of each request, requests are processed after the delay.
+	Delay *ProcessingDelayConfig `json:"delay" yaml:"delay"`
+}
+
+type ProcessingDelayConfig struct {
+	// Distribution is the distribution of delays.
+	//
+	// Defaults to DelayDistributionFixed.
+	Distribution DelayDistribution `json:"distribution" yaml:"distribution"`
+	// Duration is the delay with DelayDistributionFixed and the mean delay with DelayDistributionNormal and
+	// DelayDistributionExponential, for example 100ms.
+	Duration string `json:"duration" yaml:"duration"`
+	// StdDev is the standard deviation of delays with DelayDistributionNormal.
+	StdDev string `json:"stdDev" yaml:"stdDev"`
+	// Min is the minimum delay with DelayDistributionUniform and DelayDistributionPareto.
+	Min string `json:"min" yaml:"min"`
+	// Max is the maximum delay, it is required with DelayDistributionUniform and it caps the delays of the other
+	// distributions when specified.
+	Max string `json:"max" yaml:"max"`
+	// Shape is the shape of delays with DelayDistributionPareto, the lower the shape the heavier the tail, for
+	// example 1.5.
+	Shape float64 `json:"shape" yaml:"shape"`
+
+	ParsedDuration time.Duration
+	ParsedStdDev   time.Duration
+	ParsedMin      time.Duration
+	ParsedMax      time.Duration
+}
+
+func (c *SlowConsumerConfig) validate(protocol Protocol) error {
+	if protocol != "" && protocol != ProtocolHTTP && protocol != ProtocolGRPC {
+		return invalidErr("receiver.slowConsumer", fmt.Errorf("is only supported with the %s and %s protocols", ProtocolHTTP, ProtocolGRPC))
+	}
+	if c.MaxConcurrency < 0 {
+		return invalidErr("receiver.slowConsumer.maxConcurrency", fmt.Errorf("%d cannot be negative", c.MaxConcurrency))
+	}
+	if c.Delay != nil {
+		if err := c.Delay.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *ProcessingDelayConfig) validate() error {
+	parse := func(field, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, invalidErr(field, err)
+		}
+		if d < 0 {
+			return 0, invalidErr(field, fmt.Errorf("%v cannot be negative", d))
+		}
+		return d, nil
+	}
+
+	var err error
+	if c.ParsedDuration, err = parse("receiver.slowConsumer.delay.duration", c.Duration); err != nil {
+		return err
+	}
+	if c.ParsedStdDev, err = parse("receiver.slowConsumer.delay.stdDev", c.StdDev); err != nil {
+		return err
+	}
+	if c.ParsedMin, err = parse("receiver.slowConsumer.delay.min", c.Min); err != nil {
+		return err
+	}
+	if c.ParsedMax, err = parse("receiver.slowConsumer.delay.max", c.Max); err != nil {
+		return err
+	}
+
+	switch c.Distribution {
+	case "":
+		c.Distribution = DelayDistributionFixed
+	case DelayDistributionFixed, DelayDistributionUniform, DelayDistributionNormal, DelayDistributionExponential, DelayDistributionPareto:
+	default:
+		return invalidErr("receiver.slowConsumer.delay.distribution", fmt.Errorf("unknown distribution %q, expected one of %v", c.Distribution, []DelayDistribution{DelayDistributionFixed, DelayDistributionUniform, DelayDistributionNormal, DelayDistributionExponential, DelayDistributionPareto}))
+	}
+	if c.Shape != 0 && c.Distribution != DelayDistributionPareto {
+		return invalidErr("receiver.slowConsumer.delay.shape", fmt.Errorf("is only supported with the %s distribution", DelayDistributionPareto))
+	}
+
+	if c.Distribution == DelayDistributionPareto {
+		if c.ParsedMin <= 0 {
+			return invalidErr("receiver.slowConsumer.delay.min", fmt.Errorf("must be greater than 0 with the %s distribution", DelayDistributionPareto))
+		}
+		if c.Shape <= 0 {
+			return invalidErr("receiver.slowConsumer.delay.shape", fmt.Errorf("%v must be greater than 0", c.Shape))
+		}
+		if c.Max != "" && c.ParsedMax < c.ParsedMin {
+			return invalidErr("receiver.slowConsumer.delay.max", fmt.Errorf("%v must be greater or equal to min %v", c.ParsedMax, c.ParsedMin))
+		}
+		return nil
+	}
+
+	if c.Distribution == DelayDistributionUniform {
+		if c.Max == "" {
+			return invalidErr("receiver.slowConsumer.delay.max", fmt.Errorf("is required with the %s distribution", DelayDistributionUniform))
+		}
+		if c.ParsedMax < c.ParsedMin {
+			return invalidErr("receiver.slowConsumer.delay.max", fmt.Errorf("%v must be greater or equal to min %v", c.ParsedMax, c.ParsedMin))
+		}
+		return nil
+	}
+	if c.Duration == "" {
+		return invalidErr("receiver.slowConsumer.delay.duration", fmt.Errorf("is required with the %s distribution", c.Distribution))
+	}
+	if c.Distribution == DelayDistributionNormal && c.StdDev == "" {
+		return invalidErr("receiver.slowConsumer.delay.stdDev", fmt.Errorf("is required with the %s distribution", DelayDistributionNormal))
+	}
+	if c.Max != "" && c.ParsedMax < c.ParsedDuration {
+		return invalidErr("receiver.slowConsumer.delay.max", errors.New("must be greater or equal to duration"))
+	}
+	return nil
+}
+
+// next returns the delay of the next request.
+func (c *ProcessingDelayConfig) next(r *rand.Rand) time.Duration {
+	var d time.Duration
+	switch c.Distribution {
+	case DelayDistributionUniform:
+		d = c.ParsedMin
+		if c.ParsedMax > c.ParsedMin {
+			d += time.Duration(r.Int63n(int64(c.ParsedMax - c.ParsedMin)))
+		}
+	case DelayDistributionNormal:
+		d = c.ParsedDuration + time.Duration(r.NormFloat64()*float64(c.ParsedStdDev))
+	case DelayDistributionExponential:
+		d = time.Duration(r.ExpFloat64() * float64(c.ParsedDuration))
+	case DelayDistributionPareto:
+		// Inverse transform sampling, 1-r.Float64() is in (0, 1].
+		if v := float64(c.ParsedMin) / math.Pow(1-r.Float64(), 1/c.Shape); v < math.MaxInt64 {
+			d = time.Duration(v)
+		} else {
+			d = math.MaxInt64
+		}
+	default:
+		d = c.ParsedDuration
+	}
+	if d < 0 {
+		d = 0
+	}
+	if c.Max != "" && d > c.ParsedMax {
+		d = c.ParsedMax
+	}
+	return d
+}
+
+// slowConsumerHandler returns a handler processing requests with the given handler with bounded concurrency and after
+// the processing delay, the live processing delay with hotReload.
+func slowConsumerHandler(config *SlowConsumerConfig, settings *liveSettings, delays *rand.Rand, next http.Handler) http.Handler {
+	if config == nil && settings == nil {
+		return next
+	}
+
+	var slots chan struct{}
+	var configured *ProcessingDelayConfig
+	if config != nil {
+		if config.MaxConcurrency > 0 {
+			slots = make(chan struct{}, config.MaxConcurrency)
+		}
+		configured = config.Delay
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+				defer func() { <-slots }()
+			case <-r.Context().Done():
+				// The client gave up waiting.
+				return
+			}
+		}
+		if delay := settings.processingDelay(configured); delay != nil {
+			select {
+			case <-time.After(delay.next(delays)):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,236 @@
+package sacura
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"go.uber.org/atomic"
+)
+
+func TestSlowConsumerConfigValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   SlowConsumerConfig
+		protocol Protocol
+		want     SlowConsumerConfig
+		wantErr  bool
+	}{
+		{
+			name:   "fixed delay by default",
+			config: SlowConsumerConfig{MaxConcurrency: 2, Delay: &ProcessingDelayConfig{Duration: "100ms"}},
+			want: SlowConsumerConfig{
+				MaxConcurrency: 2,
+				Delay:          &ProcessingDelayConfig{Distribution: DelayDistributionFixed, Duration: "100ms", ParsedDuration: 100 * time.Millisecond},
+			},
+		},
+		{
+			name:   "uniform delay",
+			config: SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionUniform, Min: "10ms", Max: "20ms"}},
+			want: SlowConsumerConfig{
+				Delay: &ProcessingDelayConfig{Distribution: DelayDistributionUniform, Min: "10ms", Max: "20ms", ParsedMin: 10 * time.Millisecond, ParsedMax: 20 * time.Millisecond},
+			},
+		},
+		{
+			name:   "pareto delay",
+			config: SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms", Shape: 1.5}},
+			want: SlowConsumerConfig{
+				Delay: &ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms", Shape: 1.5, ParsedMin: 10 * time.Millisecond},
+			},
+		},
+		{
+			name:     "gRPC protocol",
+			config:   SlowConsumerConfig{MaxConcurrency: 1},
+			protocol: ProtocolGRPC,
+			want:     SlowConsumerConfig{MaxConcurrency: 1},
+		},
+		{
+			name:     "unsupported protocol",
+			config:   SlowConsumerConfig{MaxConcurrency: 1},
+			protocol: ProtocolNATS,
+			wantErr:  true,
+		},
+		{
+			name:    "negative max concurrency",
+			config:  SlowConsumerConfig{MaxConcurrency: -1},
+			wantErr: true,
+		},
+		{
+			name:    "unknown distribution",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: "zipf", Duration: "1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "uniform without max",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionUniform, Min: "1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "uniform max lower than min",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionUniform, Min: "2s", Max: "1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "normal without standard deviation",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionNormal, Duration: "1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "exponential without duration",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionExponential}},
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Duration: "-1s"}},
+			wantErr: true,
+		},
+		{
+			name:    "pareto without min",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionPareto, Shape: 1.5}},
+			wantErr: true,
+		},
+		{
+			name:    "pareto without shape",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms"}},
+			wantErr: true,
+		},
+		{
+			name:    "pareto max lower than min",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms", Max: "1ms", Shape: 1.5}},
+			wantErr: true,
+		},
+		{
+			name:    "shape without pareto",
+			config:  SlowConsumerConfig{Delay: &ProcessingDelayConfig{Duration: "10ms", Shape: 1.5}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(tt.protocol)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Errorf("(-want, +got) %s", diff)
+			}
+		})
+	}
+}
+
+func TestProcessingDelayConfigNext(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   ProcessingDelayConfig
+		min, max time.Duration
+	}{
+		{
+			name:   "fixed",
+			config: ProcessingDelayConfig{Duration: "10ms"},
+			min:    10 * time.Millisecond,
+			max:    10 * time.Millisecond,
+		},
+		{
+			name:   "uniform",
+			config: ProcessingDelayConfig{Distribution: DelayDistributionUniform, Min: "10ms", Max: "20ms"},
+			min:    10 * time.Millisecond,
+			max:    20 * time.Millisecond,
+		},
+		{
+			name:   "normal capped",
+			config: ProcessingDelayConfig{Distribution: DelayDistributionNormal, Duration: "10ms", StdDev: "10ms", Max: "15ms"},
+			min:    0,
+			max:    15 * time.Millisecond,
+		},
+		{
+			name:   "exponential capped",
+			config: ProcessingDelayConfig{Distribution: DelayDistributionExponential, Duration: "10ms", Max: "30ms"},
+			min:    0,
+			max:    30 * time.Millisecond,
+		},
+		{
+			name:   "pareto",
+			config: ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms", Shape: 0.5},
+			min:    10 * time.Millisecond,
+			max:    math.MaxInt64,
+		},
+		{
+			name:   "pareto capped",
+			config: ProcessingDelayConfig{Distribution: DelayDistributionPareto, Min: "10ms", Max: "50ms", Shape: 1.5},
+			min:    10 * time.Millisecond,
+			max:    50 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 1000; i++ {
+				if d := tt.config.next(newRand(nil, "receiver.slowConsumer")); d < tt.min || d > tt.max {
+					t.Fatalf("expected delay within [%v, %v], got %v", tt.min, tt.max, d)
+				}
+			}
+		})
+	}
+}
+
+func TestSlowConsumerHandler(t *testing.T) {
+	config := &SlowConsumerConfig{MaxConcurrency: 2, Delay: &ProcessingDelayConfig{Duration: "20ms"}}
+	if err := config.validate(ProtocolHTTP); err != nil {
+		t.Fatal(err)
+	}
+
+	inFlight := atomic.NewInt64(0)
+	maxInFlight := atomic.NewInt64(0)
+	server := httptest.NewServer(slowConsumerHandler(config, nil, newRand(nil, "receiver.slowConsumer"), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Inc()
+		defer inFlight.Dec()
+		for {
+			max := maxInFlight.Load()
+			if n <= max || maxInFlight.CAS(max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		w.WriteHeader(http.StatusAccepted)
+	})))
+	defer server.Close()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := http.Post(server.URL, "text/plain", nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusAccepted {
+				t.Errorf("expected status code %d, got %d", http.StatusAccepted, resp.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if max := maxInFlight.Load(); max > 2 {
+		t.Errorf("expected at most 2 concurrent requests, got %d", max)
+	}
+	// 10 requests, 2 at a time, taking at least 30ms each.
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("expected requests to be delayed, took %v", elapsed)
+	}
+}
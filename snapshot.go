@@ -0,0 +1,135 @@
+package sacura
+
+import (
+	"sort"
+	"time"
+)
+
+// StateSnapshot is a copy of the state of a running test, it isn't modified by events recorded after it has been
+// taken.
+type StateSnapshot struct {
+	Time time.Time `json:"time"`
+	// SentCount is the number of events sent and accepted.
+	SentCount int64 `json:"sentCount"`
+	// ReceivedCount is the number of events received, including duplicates, MatchedCount is the number of sent events
+	// received.
+	ReceivedCount          int64 `json:"receivedCount"`
+	MatchedCount           int64 `json:"matchedCount"`
+	DuplicateCount         int64 `json:"duplicateCount"`
+	NackedCount            int64 `json:"nackedCount"`
+	DeadLetteredCount      int64 `json:"deadLetteredCount"`
+	ExpiredCount           int64 `json:"expiredCount"`
+	OrderingViolationCount int64 `json:"orderingViolationCount"`
+	// OutstandingCount is the number of events sent and not received yet.
+	OutstandingCount int64 `json:"outstandingCount"`
+	// Partitions are the snapshots of each partition key.
+	Partitions map[string]PartitionSnapshot `json:"partitions"`
+}
+
+// PartitionSnapshot is a copy of the state of a partition key.
+type PartitionSnapshot struct {
+	SentCount int `json:"sentCount"`
+	// ReceivedCount is the number of unique events received.
+	ReceivedCount  int `json:"receivedCount"`
+	DuplicateCount int `json:"duplicateCount"`
+	// OutstandingIDs are the IDs of events sent and not received yet, in send order in full verification mode and
+	// sorted in streaming verification modes.
+	OutstandingIDs []string `json:"outstandingIds"`
+}
+
+// Snapshot returns a copy of the state of the test. The lock is only held to copy the events recorded so far, the
+// outstanding events are computed once it has been released, so that taking a snapshot doesn't block ingestion.
+func (s *StateManager) Snapshot() StateSnapshot {
+	snapshot := StateSnapshot{Partitions: make(map[string]PartitionSnapshot)}
+	if s.streaming != nil {
+		s.streamingSnapshot(&snapshot)
+	} else {
+		s.fullSnapshot(&snapshot)
+	}
+	return snapshot
+}
+
+// fullSnapshot sets the partitions of the given snapshot in full verification mode.
+func (s *StateManager) fullSnapshot(snapshot *StateSnapshot) {
+	s.lock.RLock()
+	s.snapshotCounters(snapshot)
+	// Recorded events are only appended, the events recorded so far are never modified.
+	sent := make(map[string][]string, len(s.sent))
+	for pk, ids := range s.sent {
+		sent[pk] = ids[:len(ids):len(ids)]
+	}
+	received := make(map[string][]string, len(s.received))
+	for pk, ids := range s.received {
+		received[pk] = ids[:len(ids):len(ids)]
+	}
+	s.lock.RUnlock()
+
+	for pk, ids := range sent {
+		snapshot.Partitions[pk] = partitionSnapshot(ids, received[pk])
+	}
+	for pk, ids := range received {
+		if _, ok := sent[pk]; !ok {
+			snapshot.Partitions[pk] = partitionSnapshot(nil, ids)
+		}
+	}
+}
+
+// partitionSnapshot returns the snapshot of a partition with the given sent and received events.
+func partitionSnapshot(sent, received []string) PartitionSnapshot {
+	p := PartitionSnapshot{SentCount: len(sent), OutstandingIDs: make([]string, 0)}
+	unique := make(map[string]struct{}, len(received))
+	for _, id := range received {
+		if _, ok := unique[id]; ok {
+			p.DuplicateCount++
+		}
+		unique[id] = struct{}{}
+	}
+	p.ReceivedCount = len(unique)
+	for _, id := range sent {
+		if _, ok := unique[id]; !ok {
+			p.OutstandingIDs = append(p.OutstandingIDs, id)
+		}
+	}
+	return p
+}
+
+// streamingSnapshot sets the partitions of the given snapshot in streaming verification modes, matched events aren't
+// retained so the outstanding events are copied while holding the lock.
+func (s *StateManager) streamingSnapshot(snapshot *StateSnapshot) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	s.snapshotCounters(snapshot)
+	for pk, p := range s.streaming.partitions {
+		snapshot.Partitions[pk] = PartitionSnapshot{
+			SentCount:      p.sent,
+			ReceivedCount:  p.received,
+			DuplicateCount: p.duplicateCount,
+			OutstandingIDs: make([]string, 0),
+		}
+	}
+	for id, e := range s.streaming.outstanding {
+		p := snapshot.Partitions[e.partitionKey]
+		p.OutstandingIDs = append(p.OutstandingIDs, id)
+		snapshot.Partitions[e.partitionKey] = p
+	}
+	for pk, p := range snapshot.Partitions {
+		sort.Strings(p.OutstandingIDs)
+		snapshot.Partitions[pk] = p
+	}
+}
+
+// snapshotCounters sets the live counters of the given snapshot, it must be called while holding the lock so that
+// counters are consistent with the copied events.
+func (s *StateManager) snapshotCounters(snapshot *StateSnapshot) {
+	snapshot.Time = time.Now()
+	snapshot.SentCount = s.sentCount.Load()
+	snapshot.ReceivedCount = s.receivedCount.Load()
+	snapshot.MatchedCount = s.matchedCount.Load()
+	snapshot.DuplicateCount = s.duplicateCount.Load()
+	snapshot.NackedCount = s.nackedCount.Load()
+	snapshot.DeadLetteredCount = s.deadLetteredCount.Load()
+	snapshot.ExpiredCount = s.expiredCount.Load()
+	snapshot.OrderingViolationCount = s.orderingViolationCount.Load()
+	snapshot.OutstandingCount = snapshot.SentCount - snapshot.MatchedCount
+}
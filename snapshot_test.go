@@ -0,0 +1,132 @@
+package sacura
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestStateManagerSnapshot(t *testing.T) {
+	event := func(id, pk string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, pk)
+		return e
+	}
+
+	tests := []struct {
+		name string
+		mode VerificationMode
+		want StateSnapshot
+	}{
+		{
+			name: "full",
+			mode: VerificationModeFull,
+			want: StateSnapshot{
+				SentCount:        4,
+				ReceivedCount:    4,
+				MatchedCount:     2,
+				DuplicateCount:   1,
+				OutstandingCount: 2,
+				Partitions: map[string]PartitionSnapshot{
+					"a": {SentCount: 3, ReceivedCount: 1, DuplicateCount: 1, OutstandingIDs: []string{"3", "2"}},
+					"b": {SentCount: 1, ReceivedCount: 1, OutstandingIDs: []string{}},
+					"c": {ReceivedCount: 1, OutstandingIDs: []string{}},
+				},
+			},
+		},
+		{
+			name: "streaming",
+			mode: VerificationModeStreaming,
+			want: StateSnapshot{
+				SentCount:        4,
+				ReceivedCount:    4,
+				MatchedCount:     2,
+				DuplicateCount:   1,
+				OutstandingCount: 2,
+				Partitions: map[string]PartitionSnapshot{
+					"a": {SentCount: 3, ReceivedCount: 1, DuplicateCount: 1, OutstandingIDs: []string{"2", "3"}},
+					"b": {SentCount: 1, ReceivedCount: 1, OutstandingIDs: []string{}},
+					"c": {ReceivedCount: 1, OutstandingIDs: []string{}},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, Config{
+				Ordered:      &OrderedConfig{PartitionKeyExtension: DefaultPartitionKeyExtension},
+				Verification: VerificationConfig{Mode: tt.mode},
+			})
+
+			sm.lock.Lock()
+			for _, e := range []ce.Event{event("1", "a"), event("3", "a"), event("2", "a"), event("4", "b")} {
+				sm.recordSent(&e)
+			}
+			for _, e := range []ce.Event{event("1", "a"), event("1", "a"), event("4", "b"), event("5", "c")} {
+				sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+			}
+			sm.lock.Unlock()
+
+			got := sm.Snapshot()
+			if diff := cmp.Diff(tt.want, got, cmpopts.IgnoreFields(StateSnapshot{}, "Time")); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+			if got.Time.IsZero() {
+				t.Error("expected the time of the snapshot")
+			}
+		})
+	}
+}
+
+func TestStateManagerSnapshotConcurrentIngestion(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	sent := make(chan ce.Event, 10)
+	received := make(chan ReceivedEvent, 10)
+	sentSignal := sm.ReadSent(sent)
+	receivedSignal := sm.ReadReceived(received)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			snapshot := sm.Snapshot()
+			if snapshot.OutstandingCount < 0 || snapshot.MatchedCount > snapshot.SentCount {
+				t.Errorf("inconsistent snapshot %+v", snapshot)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 1000; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		sent <- e
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-sentSignal
+	<-receivedSignal
+	close(done)
+	wg.Wait()
+
+	snapshot := sm.Snapshot()
+	if snapshot.SentCount != 1000 || snapshot.OutstandingCount != 0 || len(snapshot.Partitions[unknownPartitionKey].OutstandingIDs) != 0 {
+		t.Errorf("want all events received, got %+v", snapshot)
+	}
+}
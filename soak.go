@@ -0,0 +1,166 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultSoakMaxRetainedEvents is the default number of event IDs retained for each kind of failure and partition in
+// soak verification mode.
+const DefaultSoakMaxRetainedEvents = 1000
+
+// SoakConfig configures the soak verification mode, a streaming verification over a sliding time window that keeps
+// memory bounded by the events within the window, so that the test can run for days.
+type SoakConfig struct {
+	// Window is how long a sent event waits to be received, and a received event waits for the matching sent event,
+	// for example 5m.
+	//
+	// Events matched within the window are pruned from memory, sent events aging out of the window are reported as
+	// lost and received events aging out of it as unexpected.
+	Window string `json:"window" yaml:"window"`
+	// MaxRetainedEvents is the maximum number of event IDs of lost, duplicate, unexpected and out of order events
+	// retained for the report by partition, older IDs are dropped and only counted.
+	//
+	// Defaults to DefaultSoakMaxRetainedEvents.
+	MaxRetainedEvents int `json:"maxRetainedEvents" yaml:"maxRetainedEvents"`
+
+	ParsedWindow time.Duration
+}
+
+func (c *SoakConfig) validate(verification *VerificationConfig) error {
+	var err error
+	c.ParsedWindow, err = time.ParseDuration(c.Window)
+	if err != nil {
+		return invalidErr("verification.soak.window", err)
+	}
+	if c.ParsedWindow <= 0 {
+		return invalidErr("verification.soak.window", fmt.Errorf("%v must be greater than 0", c.ParsedWindow))
+	}
+	if c.MaxRetainedEvents < 0 {
+		return invalidErr("verification.soak.maxRetainedEvents", fmt.Errorf("%d cannot be negative", c.MaxRetainedEvents))
+	}
+	if c.MaxRetainedEvents == 0 {
+		c.MaxRetainedEvents = DefaultSoakMaxRetainedEvents
+	}
+	if verification.MaxDeliveryAge != "" {
+		return invalidErr("verification.maxDeliveryAge", errors.New("is not supported in soak verification mode, events age out of verification.soak.window"))
+	}
+	if verification.Attributes != nil {
+		return invalidErr("verification.attributes", errors.New("is not supported in soak verification mode"))
+	}
+	return nil
+}
+
+// soakEntry is an unmatched event queued for aging out of the soak window.
+type soakEntry struct {
+	id string
+	at time.Time
+}
+
+// soakAgedEvent is an event aged out of the soak window.
+type soakAgedEvent struct {
+	id           string
+	partitionKey string
+}
+
+// ageOut records as lost sent events and as unexpected received events that have been waiting for longer than the
+// window at the given time and prunes them.
+func (s *streamingState) ageOut(now time.Time, window time.Duration) (lost, unexpected []soakAgedEvent) {
+	i := 0
+	for ; i < len(s.sentQueue) && now.Sub(s.sentQueue[i].at) > window; i++ {
+		q := s.sentQueue[i]
+		e, ok := s.outstanding[q.id]
+		if !ok {
+			continue
+		}
+		delete(s.outstanding, q.id)
+		p := s.partition(e.partitionKey)
+		p.lost++
+		p.lostEvents = retain(p.lostEvents, q.id, s.maxRetained)
+		lost = append(lost, soakAgedEvent{id: q.id, partitionKey: e.partitionKey})
+	}
+	s.sentQueue = s.sentQueue[i:]
+
+	i = 0
+	for ; i < len(s.receivedQueue) && now.Sub(s.receivedQueue[i].at) > window; i++ {
+		q := s.receivedQueue[i]
+		e, ok := s.unmatched[q.id]
+		// The event may have been matched and received again since it was queued.
+		if !ok || !e.at.Equal(q.at) {
+			continue
+		}
+		delete(s.unmatched, q.id)
+		p := s.partition(e.partitionKey)
+		p.unexpected++
+		p.unexpectedReceived += e.received
+		p.unexpectedEvents = retain(p.unexpectedEvents, q.id, s.maxRetained)
+		unexpected = append(unexpected, soakAgedEvent{id: q.id, partitionKey: e.partitionKey})
+	}
+	s.receivedQueue = s.receivedQueue[i:]
+
+	return lost, unexpected
+}
+
+// retain appends id to ids, dropping the oldest IDs beyond max, max is 0 when IDs are unbounded.
+func retain(ids []string, id string, max int) []string {
+	ids = append(ids, id)
+	if max > 0 && len(ids) > max {
+		ids = append(ids[:0], ids[len(ids)-max:]...)
+	}
+	return ids
+}
+
+// ageOutSoak prunes events aged out of the soak window at the given time.
+func (s *StateManager) ageOutSoak(now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	window := s.config.Verification.Soak.ParsedWindow
+	lost, unexpected := s.streaming.ageOut(now, window)
+	for _, e := range lost {
+		logger(LogComponentState).Warnw("Event not received within the soak window", "id", e.id, "partitionKey", e.partitionKey, "window", window)
+	}
+	for _, e := range unexpected {
+		logger(LogComponentState).Warnw("Received event not sent within the soak window", "id", e.id, "partitionKey", e.partitionKey, "window", window)
+	}
+}
+
+// startSoak periodically prunes events aged out of the soak window until the returned function is called.
+func (s *StateManager) startSoak() func() {
+	if s.config.Verification.Mode != VerificationModeSoak {
+		return func() {}
+	}
+	interval := s.config.Verification.Soak.ParsedWindow / 2
+	if interval > maxExpirationInterval {
+		interval = maxExpirationInterval
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				s.ageOutSoak(now)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+		})
+	}
+}
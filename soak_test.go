@@ -0,0 +1,206 @@
+package sacura
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSoakConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name         string
+		verification VerificationConfig
+		wantRetained int
+		wantErr      bool
+	}{
+		{
+			name:         "default retained events",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5m"}},
+			wantRetained: DefaultSoakMaxRetainedEvents,
+		},
+		{
+			name:         "custom retained events",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5m", MaxRetainedEvents: 10}},
+			wantRetained: 10,
+		},
+		{
+			name:         "invalid window",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5"}},
+			wantErr:      true,
+		},
+		{
+			name:         "zero window",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "0s"}},
+			wantErr:      true,
+		},
+		{
+			name:         "negative retained events",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5m", MaxRetainedEvents: -1}},
+			wantErr:      true,
+		},
+		{
+			name:         "max delivery age",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5m"}, MaxDeliveryAge: "1m"},
+			wantErr:      true,
+		},
+		{
+			name:         "attributes audit",
+			verification: VerificationConfig{Soak: &SoakConfig{Window: "5m"}, Attributes: &AttributeAuditConfig{}},
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.verification.Soak.validate(&tt.verification)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.verification.Soak.MaxRetainedEvents != tt.wantRetained {
+				t.Errorf("expected %d retained events, got %d", tt.wantRetained, tt.verification.Soak.MaxRetainedEvents)
+			}
+		})
+	}
+}
+
+func TestStateManagerSoak(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{
+		DeliveryGuarantee: AtLeastOnce,
+		Verification: VerificationConfig{
+			Mode: VerificationModeSoak,
+			Soak: &SoakConfig{Window: "1m", MaxRetainedEvents: 2, ParsedWindow: time.Minute},
+		},
+	})
+
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		return e
+	}
+	send := func(ids ...string) {
+		sm.lock.Lock()
+		defer sm.lock.Unlock()
+		for _, id := range ids {
+			e := event(id)
+			sm.recordSent(&e)
+		}
+	}
+	receive := func(at time.Time, ids ...string) {
+		sm.lock.Lock()
+		defer sm.lock.Unlock()
+		for _, id := range ids {
+			sm.recordReceived(&ReceivedEvent{Event: event(id), ReceivedAt: at})
+		}
+	}
+
+	// "1" is received, "2" to "5" are lost and "x" is never sent.
+	send("1", "2", "3", "4", "5")
+	receive(time.Now(), "1", "x", "x")
+
+	sm.ageOutSoak(time.Now().Add(30 * time.Second))
+	if got := len(sm.streaming.outstanding); got != 4 {
+		t.Fatalf("expected events within the window to be outstanding, got %d", got)
+	}
+
+	sm.ageOutSoak(time.Now().Add(2 * time.Minute))
+	if len(sm.streaming.outstanding) != 0 || len(sm.streaming.unmatched) != 0 || len(sm.streaming.sentQueue) != 0 || len(sm.streaming.receivedQueue) != 0 {
+		t.Fatalf("expected aged out events to be pruned, got %+v", sm.streaming)
+	}
+
+	// "6" is still within the window when the test terminates.
+	send("6")
+	sm.Terminated(Metrics{})
+	r := sm.GenerateReport()
+
+	if r.ReceivedCount != 1 || r.LostCount != 5 || r.UnexpectedCount != 1 || r.UnmatchedCount != 2 {
+		t.Errorf("unexpected counts: received %d, lost %d, unexpected %d, unmatched %d", r.ReceivedCount, r.LostCount, r.UnexpectedCount, r.UnmatchedCount)
+	}
+	wantLost := map[string][]string{unknownPartitionKey: {"4", "5", "6"}}
+	if diff := cmp.Diff(wantLost, r.LostEventsByPartitionKey); diff != "" {
+		t.Error("expected the last aged out events to be retained (-want, +got)", diff)
+	}
+	wantUnexpected := map[string][]string{unknownPartitionKey: {"x"}}
+	if diff := cmp.Diff(wantUnexpected, r.UnexpectedEventsByPartitionKey); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestRetain(t *testing.T) {
+
+	var ids []string
+	for i := 0; i < 5; i++ {
+		ids = retain(ids, fmt.Sprint(i), 3)
+	}
+	if diff := cmp.Diff([]string{"2", "3", "4"}, ids); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	ids = nil
+	for i := 0; i < 5; i++ {
+		ids = retain(ids, fmt.Sprint(i), 0)
+	}
+	if len(ids) != 5 {
+		t.Errorf("expected unbounded IDs, got %v", ids)
+	}
+}
+
+func TestSoakVerificationMode(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		config  string
+		wantErr bool
+	}{
+		{
+			name: "soak mode",
+			config: `
+verification:
+  mode: soak
+  soak:
+    window: 5m
+`,
+		},
+		{
+			name: "missing soak config",
+			config: `
+verification:
+  mode: soak
+`,
+			wantErr: true,
+		},
+		{
+			name: "soak config in streaming mode",
+			config: `
+verification:
+  mode: streaming
+  soak:
+    window: 5m
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := FileConfig(strings.NewReader(`
+sender:
+  target: http://localhost:8080
+  frequency: 10
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 72h
+` + tt.config))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/url"
+	"sort"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// Rules of the CloudEvents v1.0 specification received events are checked against.
+const (
+	// SpecRuleRequiredAttribute requires the id, source, specversion and type attributes.
+	SpecRuleRequiredAttribute = "requiredAttribute"
+	// SpecRuleSpecVersion requires specversion 1.0.
+	SpecRuleSpecVersion = "specVersion"
+	// SpecRuleExtensionName requires extension names to consist of lowercase letters and digits.
+	SpecRuleExtensionName = "extensionName"
+	// SpecRuleDataSchema requires dataschema to be an absolute URI.
+	SpecRuleDataSchema = "dataSchema"
+	// SpecRuleContentType requires datacontenttype to be a valid media type consistent with the data.
+	SpecRuleContentType = "contentType"
+)
+
+// SpecViolation is a rule of the CloudEvents specification violated by a received event.
+type SpecViolation struct {
+	ID      string `json:"id"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+func (v SpecViolation) String() string {
+	return fmt.Sprintf("%s (%s): %s", v.ID, v.Rule, v.Message)
+}
+
+// specViolations returns the rules of the CloudEvents v1.0 specification violated by the given event.
+func specViolations(e *ce.Event) []SpecViolation {
+	var violations []SpecViolation
+	violated := func(rule, format string, args ...interface{}) {
+		violations = append(violations, SpecViolation{ID: e.ID(), Rule: rule, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, a := range []struct{ name, value string }{
+		{"id", e.ID()},
+		{"source", e.Source()},
+		{"specversion", e.SpecVersion()},
+		{"type", e.Type()},
+	} {
+		if a.value == "" {
+			violated(SpecRuleRequiredAttribute, "%s is required", a.name)
+		}
+	}
+	if v := e.SpecVersion(); v != "" && v != ce.VersionV1 {
+		violated(SpecRuleSpecVersion, "unsupported specversion %q, expected %s", v, ce.VersionV1)
+	}
+
+	names := make([]string, 0, len(e.Extensions()))
+	for name := range e.Extensions() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !isValidExtensionName(name) {
+			violated(SpecRuleExtensionName, "%q is not a valid extension name, expected lowercase letters and digits", name)
+		}
+	}
+
+	if s := e.DataSchema(); s != "" {
+		if u, err := url.Parse(s); err != nil || !u.IsAbs() {
+			violated(SpecRuleDataSchema, "%q is not an absolute URI", s)
+		}
+	}
+
+	if ct := e.DataContentType(); ct != "" {
+		mediaType, _, err := mime.ParseMediaType(ct)
+		if err == nil && !isTypeSubtype(mediaType) {
+			err = errors.New("expected type/subtype")
+		}
+		if err != nil {
+			violated(SpecRuleContentType, "invalid datacontenttype %q: %v", ct, err)
+		} else if isJSONMediaType(mediaType) && len(e.Data()) > 0 && !e.DataBase64 && !json.Valid(e.Data()) {
+			violated(SpecRuleContentType, "data is not valid JSON, but datacontenttype is %q", ct)
+		}
+	}
+	return violations
+}
+
+func isTypeSubtype(mediaType string) bool {
+	parts := strings.Split(mediaType, "/")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+func isJSONMediaType(mediaType string) bool {
+	mediaType = strings.ToLower(mediaType)
+	return mediaType == "application/json" || mediaType == "text/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// recordSpecViolations records the rules of the specification violated by the given received event, only the first
+// delivery of a violating event is recorded. It must be called while holding the lock.
+func (s *StateManager) recordSpecViolations(e *ce.Event) {
+	if _, ok := s.specViolations[e.ID()]; ok {
+		return
+	}
+	if violations := specViolations(e); len(violations) > 0 {
+		s.specViolations[e.ID()] = violations
+	}
+}
+
+// specViolationsReport sets the spec violations of the report, it must be called while holding the lock.
+func (s *StateManager) specViolationsReport(r *Report) {
+	if len(s.specViolations) == 0 {
+		return
+	}
+	ids := make([]string, 0, len(s.specViolations))
+	for id := range s.specViolations {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		r.SpecViolations = append(r.SpecViolations, s.specViolations[id]...)
+	}
+	r.SpecViolationCount = len(ids)
+}
@@ -0,0 +1,143 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSpecViolations(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		event func() ce.Event
+		want  []SpecViolation
+	}{
+		{
+			name:  "conformant",
+			event: cetest.FullEvent,
+		},
+		{
+			name: "missing required attributes",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.Context = e.Context.AsV1()
+				e.Context.(*ce.EventContextV1).Source = ce.URIRef{}
+				e.Context.(*ce.EventContextV1).Type = ""
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleRequiredAttribute, Message: "source is required"},
+				{ID: "1", Rule: SpecRuleRequiredAttribute, Message: "type is required"},
+			},
+		},
+		{
+			name: "unsupported specversion",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.SetSpecVersion(ce.VersionV03)
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleSpecVersion, Message: `unsupported specversion "0.3", expected 1.0`},
+			},
+		},
+		{
+			name: "invalid extension name",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.Context.(*ce.EventContextV1).Extensions["Tenant_ID"] = "a"
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleExtensionName, Message: `"Tenant_ID" is not a valid extension name, expected lowercase letters and digits`},
+			},
+		},
+		{
+			name: "relative dataschema",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.SetDataSchema("/schemas/order.json")
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleDataSchema, Message: `"/schemas/order.json" is not an absolute URI`},
+			},
+		},
+		{
+			name: "data inconsistent with content type",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.SetDataContentType("application/cloudevents-order+json")
+				e.DataEncoded = []byte("not json")
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleContentType, Message: `data is not valid JSON, but datacontenttype is "application/cloudevents-order+json"`},
+			},
+		},
+		{
+			name: "invalid content type",
+			event: func() ce.Event {
+				e := cetest.FullEvent()
+				e.SetID("1")
+				e.SetDataContentType("json")
+				return e
+			},
+			want: []SpecViolation{
+				{ID: "1", Rule: SpecRuleContentType, Message: `invalid datacontenttype "json": expected type/subtype`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.event()
+			if diff := cmp.Diff(tt.want, specViolations(&e)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerSpecViolations(t *testing.T) {
+
+	sm := newTestStateManager(t, Config{})
+
+	invalid := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetSpecVersion(ce.VersionV03)
+		return e
+	}
+	valid := cetest.FullEvent()
+	valid.SetID("0")
+	for _, e := range []ce.Event{invalid("2"), valid, invalid("1"), invalid("2")} {
+		e := e
+		sent := e.Clone()
+		sm.lock.Lock()
+		sm.recordSent(&sent)
+		sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := []SpecViolation{
+		{ID: "1", Rule: SpecRuleSpecVersion, Message: `unsupported specversion "0.3", expected 1.0`},
+		{ID: "2", Rule: SpecRuleSpecVersion, Message: `unsupported specversion "0.3", expected 1.0`},
+	}
+	if report.SpecViolationCount != 2 {
+		t.Errorf("expected 2 events violating the spec, got %d", report.SpecViolationCount)
+	}
+	if diff := cmp.Diff(want, report.SpecViolations); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
@@ -1,102 +1,676 @@
 package sacura
 
 import (
-	"encoding/json"
+	"fmt"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
+	"go.uber.org/atomic"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 const (
 	unknownPartitionKey = "unknown"
+
+	// DefaultPartitionKeyExtension is the CloudEvents extension used as partition key when none is configured.
+	DefaultPartitionKeyExtension = "partitionkey"
 )
 
 type StateManager struct {
 	lock     sync.RWMutex
 	received map[string][]string
 	sent     map[string][]string
+	// postTerminationReceived collects events received after Terminated has been called, these events are
+	// not taken into account for loss and duplicates detection since metrics are frozen at termination.
+	postTerminationReceived map[string][]string
+
+	// sentAt tracks the time at which each event has been sent, the time is zero when the send time is unknown.
+	sentAt map[string]time.Time
+	// receivedAt tracks the time at which each event has been received for the first time.
+	receivedAt map[string]time.Time
+	// duplicateDelays tracks the delay of duplicates since the first delivery of the original event.
+	duplicateDelays *latencyHistogram
+	// progressLatency tracks the latency of received events for the progress view, it is nil when the progress view
+	// is disabled.
+	progressLatency *latencyHistogram
+	// latencyHistogram counts the latency of received events in the buckets of report.latencyHistogram, it is nil
+	// when report.latencyHistogram is not set.
+	latencyHistogram *bucketedLatencyHistogram
+	// sequences tracks the per-partition sequence number of each event, when available.
+	sequences map[string]uint64
+	// maxReceivedSequences tracks the highest sequence number received by partition key, to detect ordering
+	// violations as events are received.
+	maxReceivedSequences map[string]uint64
+	// corrupted collects received events whose data doesn't match their checksum.
+	corrupted map[string][]string
+	// failedSends are the events the sender failed to send by ID.
+	failedSends map[string]FailedSend
+	// deadLettered collects events received by the dead-letter sink.
+	deadLettered map[string][]string
+	// nacked tracks events that received at least one injected failure response.
+	nacked map[string]*nackedEvent
+	// suppressedDuplicates are the duplicates suppressed by the receiver by partition key.
+	suppressedDuplicates map[string][]string
+	// instances tracks deliveries by receiver instance, when receiver.instanceIdentity is set.
+	instances *instancesState
+	// backfilled reports the events read from the external store, when backfill is set.
+	backfilled *BackfillReport
+	// duplicatesAt are the receive times of duplicates, when report.anomalies is set.
+	duplicatesAt []time.Time
+	// loadPhases tracks the load profile phase each event has been sent in by ID, when tagged by the sender.
+	loadPhases map[string]string
+	// pending are sent events waiting for the max delivery age check, in send order.
+	pending []pendingEvent
+	// expired collects sent events not received within the max delivery age.
+	expired map[string]expiredEvent
+	// filteredCount is the number of sent events not matching the filter.
+	filteredCount int
+	// leaked collects received events not matching the filter.
+	leaked map[string][]string
+	// expectedLossCount is the number of sent events expected not to be delivered.
+	expectedLossCount int
+	// undropped collects received events expected not to be delivered.
+	undropped map[string][]string
+	// fanOut tracks received events by sink, it is nil when fan-out verification is disabled.
+	fanOut map[string]*sinkState
+	// specViolations are the rules of the specification violated by received events by event ID.
+	specViolations map[string][]SpecViolation
+	// attributeAudit tracks the attributes of sent and received events, it is nil when verification.attributes is not
+	// set.
+	attributeAudit *attributeAuditState
+	// deliveryAttempts tracks the delivery attempts of received events, it is nil when verification.deliveryAttempts
+	// is not set.
+	deliveryAttempts *deliveryAttemptsState
+	// clockSkew is the clock skew compensated by the receiver, it is nil when receiver.clockSync is not set.
+	clockSkew *ClockSkewReport
+	// contentModes tracks the content mode of sent and received events, it is nil when sender.contentMode is not set.
+	contentModes *contentModeState
+
+	// Live counters exposed as metrics while the test is running.
+	sentCount      *atomic.Int64
+	receivedCount  *atomic.Int64
+	duplicateCount *atomic.Int64
+	// matchedCount is the number of sent events that have been received at least once.
+	matchedCount *atomic.Int64
+	// nackedCount is the number of injected failure responses.
+	nackedCount *atomic.Int64
+	// deadLetteredCount is the number of events received by the dead-letter sink, including duplicates.
+	deadLetteredCount *atomic.Int64
+	// expiredCount is the number of events not received within the max delivery age.
+	expiredCount *atomic.Int64
+	// orderingViolationCount is the number of events received out of order so far.
+	orderingViolationCount *atomic.Int64
+
+	// warmupSentCount and warmupReceivedCount count events sent during the warmup, which are otherwise ignored.
+	warmupSentCount     int
+	warmupReceivedCount int
+	// persisted are the IDs of the events persisted in the topic of the Kafka receiver, it is nil unless
+	// receiver.kafka.verifyPersisted is set.
+	persisted map[string]struct{}
+	// otherRuns counts received events of other runs by run ID, it is nil until such an event is received.
+	otherRuns map[string]int
+	// failureDomains are the tagged windows of the test in the order they started.
+	failureDomains []failureDomainWindow
 
 	config             Config
 	stateManagerConfig StateManagerConfig
 
 	terminated bool
 	metrics    Metrics
+
+	// replicas counts received events by replica and partition key in distributed mode.
+	replicas map[string]map[string]int
+	// deliverySources tracks the delivery sources of each partition key, when receiver.rebalancing is enabled.
+	deliverySources map[string]*partitionSources
+	// endpoints tracks received events by endpoint, it is nil when endpoints classification is disabled.
+	endpoints map[string]*endpointState
+	// replies tracks the replies received back, it is nil when the verification of replies is disabled.
+	replies *replyState
+	// topology tracks the deliveries that didn't pass through the expected steps, it is nil when the topology
+	// verification is disabled.
+	topology *topologyState
+	// compression tracks the compression of received events.
+	compression *compressionState
+	// payloadSizes tracks events by size class, it is nil without sender.payload.sizeClasses.
+	payloadSizes map[int]*payloadSizeState
+	// serialization tracks the deliveries whose data doesn't deserialize against the expected schema version, it is
+	// nil when serialization is disabled.
+	serialization *serializationState
+	// contentTypes tracks the deliveries whose content type doesn't match the expected one, it is nil without
+	// receiver.contentTypes.
+	contentTypes *contentTypesState
+	// targets tracks the events sent to each target, it is nil without sender.targets.
+	targets *targetsState
+	// identities tracks the events sent with each identity, it is nil without sender.identityRotation.
+	identities *identitiesState
+	// overrides tracks the events of each override group, it is nil without sender.overrides.
+	overrides *overridesState
+	// attributeGroups tracks the type and source of sent events.
+	attributeGroups *attributeGroupsState
+	// verifiers pairs sent and received events for the verifiers of the config, it is nil without verifiers.
+	verifiers *verifiersState
+	// assertions tracks the received events failing verification.assertions, it is nil without assertions.
+	assertions *assertionsState
+	// resourceUsage tracks the resource usage of sacura itself, once started.
+	resourceUsage resourceUsage
+	// ttl tracks the events sent with a TTL, it is nil without sender.ttl.
+	ttl *ttlState
+	// delayedDelivery tracks the deliveries of the events sent with a delay, it is nil without
+	// sender.delayedDelivery.
+	delayedDelivery *delayedDeliveryState
+	// orderCheckpoint tracks the received sequence numbers, it is nil without receiver.orderCheckpoint.
+	orderCheckpoint *orderCheckpointState
+	// disruptions tracks the disruptions of the receiver, it is nil without receiver.disruptions.
+	disruptions *disruptionsState
+	// late tracks the events received after the receiver timeout, it is nil without receiver.lateArrivals.
+	late *lateArrivalsState
+	// completion signals once all sent events have been received, it is nil without sender.eventCount and
+	// receiver.exitWhenComplete.
+	completion *completionDetector
+
+	// streaming is the state of the streaming verification mode, it is nil in full verification mode.
+	streaming *streamingState
+
+	// journal persists sent and received events, it is nil when persistence is disabled.
+	journal *stateJournal
+	// journalAppends are the batches of events recorded and not journaled yet.
+	journalAppends sync.WaitGroup
+	// eventLog logs sent and received events, it is nil when the event log is disabled.
+	eventLog *eventLog
+	// eventLogAppends are the batches of events recorded and not logged yet.
+	eventLogAppends sync.WaitGroup
+	// replayedSentCount is the number of sent events replayed from the journal.
+	replayedSentCount int
+	// stateWriteErrorCount is the number of events that couldn't be journaled once the journal is closed, or
+	// replayed journals are missing, and stateWriteError is the last error journaling them.
+	stateWriteErrorCount int
+	stateWriteError      string
+
+	// ids interns the IDs of recorded events, it is nil when ingest.internIds is not set.
+	ids idInterner
+}
+
+type nackedEvent struct {
+	partitionKey string
+	// nacks is the number of failure responses sent for the event.
+	nacks int
+	// deliveries is the number of delivery attempts observed since the first failure response.
+	deliveries int
 }
 
 type StateManagerConfig struct {
 	Ordered bool
 	OrderedConfig
+
+	DeliveryGuarantee DeliveryGuarantee
+
+	VerificationMode VerificationMode
+
+	// SequentialIDs summarizes missing events as ranges of sequence numbers, MaxListedIDs caps the number of missing
+	// events listed for each partition then.
+	SequentialIDs bool
+	MaxListedIDs  int
+	// IDPrefix is the prefix of sequential IDs.
+	IDPrefix string
+
+	// OrderByReceiveTime verifies ordering by the receive time of events instead of the order in which they have
+	// been recorded, events forwarded by several receiver replicas are recorded in batches.
+	OrderByReceiveTime bool
 }
 
 func stateManagerConfigFromConfig(config Config) StateManagerConfig {
 	if config.Ordered != nil {
 		return StateManagerConfig{
-			OrderedConfig: *config.Ordered,
-			Ordered:       true,
+			OrderedConfig:      *config.Ordered,
+			Ordered:            true,
+			DeliveryGuarantee:  config.DeliveryGuarantee,
+			VerificationMode:   config.Verification.Mode,
+			SequentialIDs:      config.Sender.SequentialIDs,
+			MaxListedIDs:       config.Verification.MaxListedIDs,
+			IDPrefix:           config.Sender.IDs.idPrefix(),
+			OrderByReceiveTime: isAggregator(config),
 		}
 	}
-	return StateManagerConfig{Ordered: false}
+	return StateManagerConfig{
+		Ordered:            false,
+		DeliveryGuarantee:  config.DeliveryGuarantee,
+		VerificationMode:   config.Verification.Mode,
+		SequentialIDs:      config.Sender.SequentialIDs,
+		MaxListedIDs:       config.Verification.MaxListedIDs,
+		IDPrefix:           config.Sender.IDs.idPrefix(),
+		OrderByReceiveTime: isAggregator(config),
+	}
 }
 
-func NewStateManager(config Config) *StateManager {
-	return &StateManager{
-		received:           make(map[string][]string),
-		sent:               make(map[string][]string),
-		config:             config,
-		stateManagerConfig: stateManagerConfigFromConfig(config),
+func NewStateManager(config Config) (*StateManager, error) {
+	assertions, err := newAssertionsState(config.Verification.Assertions)
+	if err != nil {
+		return nil, err
+	}
+	sm := &StateManager{
+		received:                make(map[string][]string),
+		sent:                    make(map[string][]string),
+		postTerminationReceived: make(map[string][]string),
+		sentAt:                  make(map[string]time.Time),
+		receivedAt:              make(map[string]time.Time),
+		duplicateDelays:         newLatencyHistogram(),
+		sequences:               make(map[string]uint64),
+		maxReceivedSequences:    make(map[string]uint64),
+		nacked:                  make(map[string]*nackedEvent),
+		deadLettered:            make(map[string][]string),
+		failedSends:             make(map[string]FailedSend),
+		replicas:                make(map[string]map[string]int),
+		deliverySources:         make(map[string]*partitionSources),
+		endpoints:               newEndpointsState(config.Receiver.Endpoints),
+		replies:                 newReplyState(config.Receiver.Response),
+		topology:                newTopologyState(config.Verification.Topology),
+		compression:             &compressionState{mangled: make(map[string][]string)},
+		payloadSizes:            newPayloadSizesState(config.Sender.Payload),
+		serialization:           newSerializationState(config.Serialization),
+		contentTypes:            newContentTypesState(config.Receiver.ContentTypes),
+		targets:                 newTargetsState(config.Sender.Targets),
+		identities:              newIdentitiesState(config.Sender.IdentityRotation),
+		overrides:               newOverridesState(config.Sender.Overrides),
+		attributeGroups:         newAttributeGroupsState(),
+		verifiers:               newVerifiersState(config.Verifiers),
+		assertions:              assertions,
+		ttl:                     newTTLState(config.Sender.TTL),
+		delayedDelivery:         newDelayedDeliveryState(config.Sender.DelayedDelivery),
+		orderCheckpoint:         newOrderCheckpointState(config.Receiver.OrderCheckpoint),
+		late:                    newLateArrivalsState(config.Receiver.LateArrivals),
+		disruptions:             newDisruptionsState(config.Receiver.Disruptions),
+		completion:              newCompletionDetector(&config),
+		corrupted:               make(map[string][]string),
+		expired:                 make(map[string]expiredEvent),
+		leaked:                  make(map[string][]string),
+		undropped:               make(map[string][]string),
+		fanOut:                  newFanOutState(config.Receiver.FanOut),
+		contentModes:            newContentModeState(config.Sender.ContentMode),
+		specViolations:          make(map[string][]SpecViolation),
+		attributeAudit:          newAttributeAuditState(config.Verification.Attributes),
+		deliveryAttempts:        newDeliveryAttemptsState(config.Verification.DeliveryAttempts),
+		ids:                     newIDInterner(config.Ingest),
+		sentCount:               atomic.NewInt64(0),
+		receivedCount:           atomic.NewInt64(0),
+		duplicateCount:          atomic.NewInt64(0),
+		matchedCount:            atomic.NewInt64(0),
+		nackedCount:             atomic.NewInt64(0),
+		deadLetteredCount:       atomic.NewInt64(0),
+		expiredCount:            atomic.NewInt64(0),
+		orderingViolationCount:  atomic.NewInt64(0),
+		config:                  config,
+		stateManagerConfig:      stateManagerConfigFromConfig(config),
+	}
+	if sm.stateManagerConfig.VerificationMode.streams() {
+		sm.streaming = newStreamingState(config.Verification.Soak, config.Verification.MaxMatchedIDs)
+		if sm.stateManagerConfig.VerificationMode == VerificationModeApproximate {
+			sm.streaming.approximate = newApproximateState(config.Verification.Approximate, config.Verification.MaxMatchedIDs)
+		}
+	}
+	if config.Report.Progress != nil {
+		sm.progressLatency = newLatencyHistogram()
+	}
+	if config.Report.LatencyHistogram != nil {
+		sm.latencyHistogram = newBucketedLatencyHistogram(config.Report.LatencyHistogram.ParsedBuckets)
 	}
+	return sm, nil
 }
 
 func (s *StateManager) ReadSent(sent <-chan ce.Event) <-chan struct{} {
 	sg := make(chan struct{})
 	go func(set *StateManager) {
+		batch := make([]ce.Event, 0, s.config.Ingest.batchSize())
 		for e := range sent {
-			func() {
-				s.lock.RLock()
-				defer s.lock.RUnlock()
-				insert(&e, s.sent, &s.stateManagerConfig)
-			}()
+			batch = append(batch[:0], e)
+			batch = drainSent(sent, batch)
+
+			s.lock.Lock()
+			for i := range batch {
+				s.recordSent(&batch[i])
+			}
+			journal := s.journalWriter()
+			eventLog := s.eventLogWriter()
+			s.lock.Unlock()
+
+			s.journalSent(journal, batch)
+			s.logSent(eventLog, batch)
 		}
+		s.sentDone()
 		sg <- struct{}{}
 	}(s)
 	return sg
 }
 
-func (s *StateManager) ReadReceived(received <-chan ce.Event) <-chan struct{} {
+func (s *StateManager) ReadReceived(received <-chan ReceivedEvent) <-chan struct{} {
 	sg := make(chan struct{})
 	go func(set *StateManager) {
+		batch := make([]ReceivedEvent, 0, s.config.Ingest.batchSize())
+		journaled := make([]*ReceivedEvent, 0, s.config.Ingest.batchSize())
 		for e := range received {
-			func() {
-				s.lock.RLock()
-				defer s.lock.RUnlock()
-				insert(&e, s.received, &s.stateManagerConfig)
-			}()
+			batch = append(batch[:0], e)
+			batch = drainReceived(received, batch)
+			journaled = journaled[:0]
+
+			s.lock.Lock()
+			for i := range batch {
+				e := &batch[i]
+				if s.terminated {
+					logger(LogComponentState).Warnw("Received event after termination", "id", e.Event.ID())
+					insert(&e.Event, s.postTerminationReceived, &s.stateManagerConfig)
+					continue
+				}
+				if s.recordLate(e) {
+					continue
+				}
+
+				s.recordReceived(e)
+				journaled = append(journaled, e)
+			}
+			journal := s.journalWriter()
+			eventLog := s.eventLogWriter()
+			s.lock.Unlock()
+
+			s.journalReceived(journal, journaled)
+			s.logReceived(eventLog, journaled)
+			s.checkCompletion()
 		}
 		sg <- struct{}{}
 	}(s)
 	return sg
 }
 
-func insert(e *ce.Event, store map[string][]string, config *StateManagerConfig) {
-	pk := unknownPartitionKey
+// drainSent appends to the given batch the events already buffered in the given channel, without blocking.
+func drainSent(sent <-chan ce.Event, batch []ce.Event) []ce.Event {
+	for len(batch) < cap(batch) {
+		select {
+		case e, ok := <-sent:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// drainReceived appends to the given batch the events already buffered in the given channel, without blocking.
+func drainReceived(received <-chan ReceivedEvent, batch []ReceivedEvent) []ReceivedEvent {
+	for len(batch) < cap(batch) {
+		select {
+		case e, ok := <-received:
+			if !ok {
+				return batch
+			}
+			batch = append(batch, e)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+// recordSent records the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSent(e *ce.Event) {
+	s.ids.intern(e)
+	if isWarmupEvent(e) {
+		s.warmupSentCount++
+		return
+	}
+	if s.recordFiltered(e) || s.recordExpectedLoss(e) || s.recordExpiring(e) {
+		return
+	}
+	s.recordSentContentMode(e)
+	s.recordSentAttributes(e)
+	s.recordSentPayloadSize(e)
+	s.recordSentTarget(e)
+	s.recordSentIdentity(e)
+	s.recordScheduled(e)
+	s.recordSentOverrides(e)
+	s.recordSentPair(e)
+
+	t, _ := sentTimestamp(e)
+	s.trackDeliveryAge(e.ID(), partitionKey(e, &s.stateManagerConfig), t)
+
+	if s.streaming != nil {
+		s.sentCount.Inc()
+		if s.streaming.sent(e, &s.stateManagerConfig) {
+			s.matchedCount.Inc()
+		}
+		s.duplicateCount.Store(int64(s.streaming.duplicateCount))
+		return
+	}
+
+	insert(e, s.sent, &s.stateManagerConfig)
+	s.sentAt[e.ID()] = t
+	s.recordSentLoadPhase(e)
+	s.recordSentAttributeGroup(e)
+	s.trackSequence(e)
+
+	s.sentCount.Inc()
+	if _, ok := s.receivedAt[e.ID()]; ok {
+		s.matchedCount.Inc()
+	}
+}
+
+// recordReceived records the given received event, it must be called while holding the lock.
+func (s *StateManager) recordReceived(e *ReceivedEvent) {
+	s.ids.intern(&e.Event)
+	if s.recordMangled(e) {
+		// Only the ID of events whose payload has been mangled in transit is known.
+		return
+	}
+	if s.recordOtherRun(&e.Event) {
+		return
+	}
+	s.recordSpecViolations(&e.Event)
+	if isWarmupEvent(&e.Event) {
+		s.warmupReceivedCount++
+		return
+	}
+	if s.recordReply(e) {
+		return
+	}
+	if s.recordLeaked(&e.Event) || s.recordUndropped(&e.Event) || s.recordTTLViolation(e) {
+		return
+	}
+	if s.recordSuppressedDuplicate(e) {
+		return
+	}
+	s.recordReplica(e)
+	s.recordInstance(e)
+	s.recordDeliverySource(e)
+	s.recordEndpoint(e)
+	s.recordCompression(e)
+	s.recordDeliveryAttempt(e)
+
+	n, ok := s.nacked[e.Event.ID()]
+	if ok {
+		n.deliveries++
+	}
+	if e.Nacked {
+		s.nackedCount.Inc()
+		if !ok {
+			s.nacked[e.Event.ID()] = &nackedEvent{partitionKey: partitionKey(&e.Event, &s.stateManagerConfig), nacks: 1, deliveries: 1}
+		} else {
+			n.nacks++
+		}
+		return
+	}
+	corrupted := s.config.Verification.Integrity && !e.validChecksum()
+	if corrupted {
+		logger(LogComponentState).Warnw("Received corrupted event", "id", e.Event.ID())
+		insert(&e.Event, s.corrupted, &s.stateManagerConfig)
+	}
+	s.recordReceivedTarget(e)
+	s.recordReceivedIdentity(e)
+	s.recordReceivedOverrides(e)
+	s.recordReceivedPair(e)
+	if e.DeadLettered {
+		insert(&e.Event, s.deadLettered, &s.stateManagerConfig)
+		s.deadLetteredCount.Inc()
+		return
+	}
+	s.recordTopology(e)
+	s.recordReceivedPayloadSize(e, corrupted)
+	s.recordSerialization(e)
+	s.recordContentTypes(e)
+	s.recordReceivedContentMode(e)
+	s.recordReceivedAttributes(&e.Event)
+	s.recordAssertions(e)
+	s.recordDelayedDelivery(e)
+	s.recordOrderCheckpoint(e)
+
+	if s.streaming != nil {
+		s.receivedCount.Inc()
+		if s.streaming.received(e, &s.stateManagerConfig) {
+			s.matchedCount.Inc()
+			s.recordProgressLatency(e)
+			s.recordLatencyHistogram(e)
+		}
+		s.duplicateCount.Store(int64(s.streaming.duplicateCount))
+		s.orderingViolationCount.Store(int64(s.streaming.orderingViolationCount))
+		return
+	}
+	if s.fanOut != nil && !s.recordFanOut(e) {
+		s.receivedCount.Inc()
+		return
+	}
+	insert(&e.Event, s.received, &s.stateManagerConfig)
+
+	s.receivedCount.Inc()
+	if _, ok := s.receivedAt[e.Event.ID()]; ok {
+		s.duplicateCount.Inc()
+		s.recordDuplicateDelay(e)
+		s.recordDuplicateAt(e)
+		return
+	}
+	s.receivedAt[e.Event.ID()] = e.ReceivedAt
+	s.trackSequence(&e.Event)
+	s.recordLiveOrdering(&e.Event)
+	s.recordProgressLatency(e)
+	s.recordLatencyHistogram(e)
+	if _, ok := s.sentAt[e.Event.ID()]; ok {
+		s.matchedCount.Inc()
+	}
+}
+
+func partitionKey(e *ce.Event, config *StateManagerConfig) string {
 	if config.Ordered {
-		extenstions := e.Extensions()
-		if v, ok := extenstions["partitionkey"]; ok {
-			pk = v.(string)
+		if pk, ok := eventPartitionKey(e, config.partitionKeyAttribute()); ok {
+			return pk
 		}
 	}
+	return unknownPartitionKey
+}
+
+func insert(e *ce.Event, store map[string][]string, config *StateManagerConfig) {
+	pk := partitionKey(e, config)
 	if _, ok := store[pk]; !ok {
 		store[pk] = make([]string, 0, 100)
 	}
 	store[pk] = append(store[pk], e.ID())
 }
 
+// orderingViolations returns the events received out of order of a single partition, it must be called while holding
+// the lock.
+func (s *StateManager) orderingViolations(sent, received []string) []OrderingViolation {
+	if !s.stateManagerConfig.Ordered {
+		return nil
+	}
+	var sequences map[string]uint64
+	if len(s.sequences) > 0 {
+		sequences = s.sequences
+	}
+	sentPositions := make(map[string]int, len(sent))
+	for i, id := range sent {
+		sentPositions[id] = i
+	}
+	return partitionOrderingViolations(received, sentPositions, sequences, s.stateManagerConfig.ToleranceWindow)
+}
+
+// trackSequence records the sequence number of the given event, it must be called while holding the lock.
+func (s *StateManager) trackSequence(e *ce.Event) {
+	if !s.stateManagerConfig.Ordered {
+		return
+	}
+	if _, ok := s.sequences[e.ID()]; ok {
+		return
+	}
+	v, ok := e.Extensions()[SequenceExtension]
+	if !ok {
+		return
+	}
+	seq, err := strconv.ParseUint(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		logger(LogComponentState).Warnw("Invalid sequence extension", "extension", SequenceExtension, "value", v, "id", e.ID(), "error", err)
+		return
+	}
+	s.sequences[e.ID()] = seq
+}
+
+// recordLiveOrdering counts the first receipt of the given event as an ordering violation when an event of the same
+// partition with a higher sequence number has already been received, like the final report does, so that the
+// ordering_violations_total metric shows ordering breakage as it happens. Events without a sequence number and
+// events recorded in batches by the aggregator, which are only ordered by receive time in the final report, are not
+// checked. It must be called while holding the lock.
+func (s *StateManager) recordLiveOrdering(e *ce.Event) {
+	if !s.stateManagerConfig.Ordered || s.stateManagerConfig.OrderByReceiveTime {
+		return
+	}
+	seq, ok := s.sequences[e.ID()]
+	if !ok {
+		return
+	}
+	pk := partitionKey(e, &s.stateManagerConfig)
+	maxSequence := s.maxReceivedSequences[pk]
+	if seq >= maxSequence {
+		s.maxReceivedSequences[pk] = seq
+		return
+	}
+	if displacement := int(maxSequence - seq); displacement > s.stateManagerConfig.ToleranceWindow {
+		s.orderingViolationCount.Inc()
+	}
+}
+
+// setSentTimestamp sets the send time of the given event, in milliseconds and nanoseconds.
+func setSentTimestamp(e *ce.Event, t time.Time) {
+	e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(t.UnixMilli()))
+	e.SetExtension(BenchmarkTimestampNanosAttribute, fmt.Sprint(t.UnixNano()))
+}
+
+// sentTimestamp returns the send time of the given event, in nanoseconds when the event has the
+// BenchmarkTimestampNanosAttribute extension, in milliseconds otherwise.
+func sentTimestamp(e *ce.Event) (time.Time, bool) {
+	extensions := e.Extensions()
+	if v, ok := extensions[BenchmarkTimestampNanosAttribute]; ok {
+		if t, err := strconv.ParseInt(fmt.Sprint(v), 10, 64); err == nil {
+			return time.Unix(0, t), true
+		}
+	}
+	v, ok := extensions[BenchmarkTimestampAttribute]
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := strconv.ParseInt(fmt.Sprint(v), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(t), true
+}
+
 func (s *StateManager) ReceivedCount() int {
 	s.lock.RLock()
 	defer s.lock.RUnlock()
 
+	if s.streaming != nil {
+		return s.streaming.receivedCount()
+	}
+
 	count := 0
 	for _, v := range s.received {
 		count += len(v)
@@ -104,13 +678,48 @@ func (s *StateManager) ReceivedCount() int {
 	return count
 }
 
-func (s *StateManager) Diff() string {
-	report := s.GenerateReport()
-	if len(report.LostEventsByPartitionKey) > 0 {
-		b, _ := json.MarshalIndent(report.LostEventsByPartitionKey, "", " ")
-		return "lost events by partition key:\n" + string(b)
+// Diff returns the structured difference between sent and received events.
+func (s *StateManager) Diff() DiffReport {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.streaming != nil {
+		d := s.streaming.diff(&s.stateManagerConfig)
+		s.failedSendsDiff(&d)
+		s.missingRangesDiff(&d)
+		return d
+	}
+
+	d := DiffReport{Partitions: make(map[string]PartitionDiff, len(s.sent))}
+
+	keys := sets.NewString()
+	for k := range s.sent {
+		keys.Insert(k)
+	}
+	for k := range s.received {
+		keys.Insert(k)
+	}
+
+	for _, k := range keys.List() {
+		received, duplicates := removeDuplicates(s.received[k])
+		received = s.inReceiveOrder(received)
+		var sequences map[string]uint64
+		if s.stateManagerConfig.Ordered && len(s.sequences) > 0 {
+			sequences = s.sequences
+		}
+		sent, _ := withoutDeadLettered(s.withoutFailedSends(s.sent[k]), received, s.deadLettered[k])
+		p := diffPartition(sent, received, s.stateManagerConfig.Ordered, sequences, s.stateManagerConfig.ToleranceWindow)
+		if !s.stateManagerConfig.DeliveryGuarantee.allowsDuplicates() && len(duplicates) > 0 {
+			p.Duplicates = duplicates
+		}
+		if !p.empty() {
+			d.Partitions[k] = p
+		}
 	}
-	return ""
+	s.failedSendsDiff(&d)
+	s.missingRangesDiff(&d)
+
+	return d
 }
 
 func (s *StateManager) GenerateReport() Report {
@@ -124,15 +733,108 @@ func (s *StateManager) GenerateReport() Report {
 		DuplicateEventsByPartitionKey: make(map[string][]string, 8),
 		ReceivedEventsByPartitionKey:  make(map[string][]string, 8),
 		Terminated:                    s.terminated,
+		DeliveryGuarantee:             s.stateManagerConfig.DeliveryGuarantee,
+		VerificationMode:              s.stateManagerConfig.VerificationMode,
+		PostTerminationReceivedEventsByPartitionKey: make(map[string][]string, len(s.postTerminationReceived)),
+		LatencyByPartitionKey:                       make(map[string]LatencyStats, 8),
+		NackedEventsByPartitionKey:                  make(map[string][]string, 8),
+		RetriesByEvent:                              make(map[string]int, len(s.nacked)),
+		DeadLetteredEventsByPartitionKey:            make(map[string][]string, len(s.deadLettered)),
+		UnexpectedEventsByPartitionKey:              make(map[string][]string, 8),
+		CorruptedEventsByPartitionKey:               make(map[string][]string, len(s.corrupted)),
+		ExpiredEventsByPartitionKey:                 make(map[string][]ExpiredEvent, 8),
+		LateEventsByPartitionKey:                    make(map[string][]LateEvent),
+		OrderingViolationsByPartitionKey:            make(map[string]OrderingReport, 8),
+		LeakedEventsByPartitionKey:                  make(map[string][]string, len(s.leaked)),
+		UndroppedEventsByPartitionKey:               make(map[string][]string, len(s.undropped)),
+		FailedSendsByPartitionKey:                   make(map[string][]FailedSend, 8),
+		WarmupSentCount:                             s.warmupSentCount,
+		WarmupReceivedCount:                         s.warmupReceivedCount,
+		ClockSkew:                                   s.clockSkew,
+		StateWriteErrorCount:                        s.stateWriteErrorCount,
+		StateWriteError:                             s.stateWriteError,
+	}
+	if s.journal != nil {
+		r.StateWriteErrorCount, r.StateWriteError = s.journal.writeErrors()
+	}
+
+	for k, v := range s.postTerminationReceived {
+		received := make([]string, len(v))
+		copy(received, v)
+		r.PostTerminationReceivedEventsByPartitionKey[k] = received
+		r.PostTerminationReceivedCount += len(received)
+	}
+
+	for id, n := range s.nacked {
+		r.NackedEventsByPartitionKey[n.partitionKey] = append(r.NackedEventsByPartitionKey[n.partitionKey], id)
+		r.NackedCount += n.nacks
+		if n.deliveries > 1 {
+			r.RetriesByEvent[id] = n.deliveries - 1
+			r.RetryCount += n.deliveries - 1
+		}
+	}
+	for _, ids := range r.NackedEventsByPartitionKey {
+		sort.Strings(ids)
+	}
+
+	for k, v := range s.corrupted {
+		corrupted, _ := removeDuplicates(v)
+		sort.Strings(corrupted)
+		r.CorruptedEventsByPartitionKey[k] = corrupted
+		r.CorruptedCount += len(corrupted)
 	}
 
+	s.expiredReport(&r)
+	s.failedSendsReport(&r)
+	s.filterReport(&r)
+	s.otherRunsReport(&r)
+	s.expectedLossReport(&r)
+	s.ttlReport(&r)
+	s.delayedDeliveryReport(&r)
+	s.contentModeReport(&r)
+	s.specViolationsReport(&r)
+	s.attributeAuditReport(&r)
+	s.deliveryAttemptsReport(&r)
+	s.replicasReport(&r)
+	s.endpointsReport(&r)
+	s.replyReport(&r)
+	s.topologyReport(&r)
+	s.compressionReport(&r)
+	s.payloadSizesReport(&r)
+	s.serializationReport(&r)
+	s.contentTypesReport(&r)
+	s.targetsReport(&r)
+	s.identitiesReport(&r)
+	s.overridesReport(&r)
+	s.verifiersReport(&r)
+	s.assertionsReport(&r)
+	s.resourceUsageReport(&r)
+	s.disruptionsReport(&r)
+	s.latencyHistogramReport(&r)
+
+	if s.streaming != nil {
+		s.streaming.report(&r)
+		s.rebalancingReport(&r)
+		s.restartOrderingReport(&r)
+		s.kafkaReplayReport(&r)
+		s.lostRangesReport(&r)
+		s.partitionKeysSummaryReport(&r)
+		s.suppressedDuplicatesReport(&r)
+		s.instancesReport(&r)
+		s.backfillReport(&r)
+		s.idempotencyReport(&r)
+		s.budgetsReport(&r)
+		return r
+	}
+
+	latencies := make([]time.Duration, 0, len(s.receivedAt))
 	for k, v := range s.sent {
-		var sent []string
-		copy(sent, v)
+		sent := append([]string{}, s.withoutFailedSends(v)...)
 		var received []string
 		var duplicates []string
 		if v, ok := s.received[k]; ok {
-			received, duplicates = removeDuplicates(v) // at least once TODO configurable delivery guarantee
+			received, duplicates = removeDuplicates(v)
+			received = s.inReceiveOrder(received)
 		}
 
 		if !s.stateManagerConfig.Ordered {
@@ -141,7 +843,24 @@ func (s *StateManager) GenerateReport() Report {
 			sort.Strings(duplicates)
 		}
 
+		received, unexpected := splitUnexpected(sent, received)
+		if len(unexpected) > 0 {
+			r.UnexpectedEventsByPartitionKey[k] = unexpected
+			r.UnexpectedCount += len(unexpected)
+		}
+		if violations := s.orderingViolations(sent, received); len(violations) > 0 {
+			r.OrderingViolationsByPartitionKey[k] = newOrderingReport(violations)
+			r.OrderingViolationCount += len(violations)
+		}
+
+		sent, deadLettered := withoutDeadLettered(sent, received, s.deadLettered[k])
+		if len(deadLettered) > 0 {
+			r.DeadLetteredEventsByPartitionKey[k] = deadLettered
+			r.DeadLetteredCount += len(deadLettered)
+		}
+
 		diff := sets.NewString(sent...).Difference(sets.NewString(received...)).List()
+		diff = s.splitLate(&r, k, diff)
 		if len(diff) > 0 {
 			r.LostEventsByPartitionKey[k] = diff
 			r.LostCount += len(r.LostEventsByPartitionKey[k])
@@ -154,17 +873,136 @@ func (s *StateManager) GenerateReport() Report {
 			r.ReceivedEventsByPartitionKey[k] = received
 			r.ReceivedCount += len(received)
 		}
+
+		partitionLatencies := s.latencies(received)
+		if len(partitionLatencies) > 0 {
+			if !s.highCardinality() {
+				r.LatencyByPartitionKey[k] = NewLatencyStats(partitionLatencies)
+			}
+			latencies = append(latencies, partitionLatencies...)
+		}
 	}
 
+	for k, v := range s.received {
+		if _, ok := s.sent[k]; ok {
+			continue
+		}
+		unexpected, _ := removeDuplicates(v)
+		sort.Strings(unexpected)
+		r.UnexpectedEventsByPartitionKey[k] = unexpected
+		r.UnexpectedCount += len(unexpected)
+	}
+
+	r.Latency = NewLatencyStats(latencies)
+	r.DuplicateDelays = s.duplicateDelayReport()
+	s.partitionBalanceReport(&r)
+	s.fanOutReport(&r)
+	s.rebalancingReport(&r)
+	s.restartOrderingReport(&r)
+	s.excludedOrderingReport(&r)
+
+	lost := sets.NewString()
+	for _, ids := range r.LostEventsByPartitionKey {
+		lost.Insert(ids...)
+	}
+	r.ThroughputInterval, r.Throughput = s.throughputTimeline(lost)
+	s.anomaliesReport(&r)
+	s.loadPhasesReport(&r, lost)
+	r.FailureDomains = s.failureDomainsReport(lost)
+	s.attributeGroupsReport(&r, lost)
+	s.kafkaReplayReport(&r)
+	s.lostRangesReport(&r)
+	s.partitionKeysSummaryReport(&r)
+	s.suppressedDuplicatesReport(&r)
+	s.instancesReport(&r)
+	s.backfillReport(&r)
+	s.idempotencyReport(&r)
+	s.budgetsReport(&r)
+
 	return r
 }
 
+// latencies returns the end-to-end latency of the given received events, it must be called while holding the lock.
+func (s *StateManager) latencies(received []string) []time.Duration {
+	latencies := make([]time.Duration, 0, len(received))
+	for _, id := range received {
+		sentAt, ok := s.sentAt[id]
+		if !ok || sentAt.IsZero() {
+			continue
+		}
+		receivedAt, ok := s.receivedAt[id]
+		if !ok {
+			continue
+		}
+		latencies = append(latencies, receivedAt.Sub(sentAt))
+	}
+	return latencies
+}
+
 func (s *StateManager) Terminated(metrics Metrics) {
 	s.lock.Lock()
 	defer s.lock.Unlock()
 
 	s.terminated = true
 	s.metrics = metrics
+	s.recordFailedSends(metrics.FailedSends)
+
+	if s.journal != nil {
+		// Events sent before a restart have been accepted, otherwise they wouldn't have been journaled.
+		s.metrics.ProposedCount += s.replayedSentCount
+		s.metrics.AcceptedCount += s.replayedSentCount
+
+		// Recorded events are journaled before closing the journal, journaling doesn't take the lock.
+		s.journalAppends.Wait()
+		s.stateWriteErrorCount, s.stateWriteError = s.journal.writeErrors()
+		if err := s.journal.close(); err != nil {
+			logger(LogComponentState).Errorw("Failed to close state journal", "error", err)
+		}
+		s.journal = nil
+	}
+
+	if s.eventLog != nil {
+		// Recorded events are logged before closing the event log, logging doesn't take the lock.
+		s.eventLogAppends.Wait()
+		s.eventLog.logRetried(metrics.SendAttempts, s.sentPartitionKeys(metrics.SendAttempts))
+		if err := s.eventLog.close(); err != nil {
+			logger(LogComponentState).Errorw("Failed to close event log", "error", err)
+		}
+		s.eventLog = nil
+	}
+}
+
+// splitUnexpected splits received events into the ones that have been sent and the unexpected ones, that have never
+// been sent, preserving their order.
+func splitUnexpected(sent, received []string) ([]string, []string) {
+	sentSet := sets.NewString(sent...)
+	expected := make([]string, 0, len(received))
+	var unexpected []string
+	for _, id := range received {
+		if sentSet.Has(id) {
+			expected = append(expected, id)
+		} else {
+			unexpected = append(unexpected, id)
+		}
+	}
+	return expected, unexpected
+}
+
+// withoutDeadLettered returns the sent events not accounted for by the dead-letter sink, preserving their order, and
+// the sorted sent events that have been received by the dead-letter sink only.
+func withoutDeadLettered(sent, received, deadLettered []string) ([]string, []string) {
+	if len(deadLettered) == 0 {
+		return sent, nil
+	}
+
+	deadLetteredOnly := sets.NewString(deadLettered...).Difference(sets.NewString(received...)).Intersection(sets.NewString(sent...))
+	remaining := make([]string, 0, len(sent))
+	for _, id := range sent {
+		if !deadLetteredOnly.Has(id) {
+			remaining = append(remaining, id)
+		}
+	}
+	return remaining, deadLetteredOnly.List()
 }
 
 func removeDuplicates(a []string) ([]string, []string) {
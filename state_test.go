@@ -2,12 +2,15 @@ package sacura
 
 import (
 	"fmt"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
 	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
@@ -44,11 +47,11 @@ func TestStateManager(t *testing.T) {
 
 			n := tc.N
 
-			received := make(chan ce.Event, n)
+			received := make(chan ReceivedEvent, n)
 
 			sent := make(chan ce.Event, n)
 
-			sm := NewStateManager(Config{})
+			sm := newTestStateManager(t, Config{})
 			receivedSignal := sm.ReadReceived(received)
 			sentSignal := sm.ReadSent(sent)
 
@@ -68,7 +71,7 @@ func TestStateManager(t *testing.T) {
 				for i := 0; i < n; i++ {
 					e := cetest.FullEvent()
 					e.SetID(fmt.Sprintf("%d", i))
-					received <- e
+					received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
 				}
 				wg.Done()
 			}()
@@ -84,9 +87,768 @@ func TestStateManager(t *testing.T) {
 				return len(received) == 0 && len(sent) == 0, nil
 			})
 
-			if diff := sm.Diff(); (diff != "") != tc.wantDiff {
+			if diff := sm.Diff(); !diff.Empty() != tc.wantDiff {
 				t.Errorf("wanted diff? %v, got %s", tc.wantDiff, diff)
 			}
 		})
 	}
 }
+
+func TestStateManagerReceivedAfterTermination(t *testing.T) {
+
+	n := 100
+	m := 10
+
+	received := make(chan ReceivedEvent, n+m)
+	sent := make(chan ce.Event, n)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for i := 0; i < n; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprintf("%d", i))
+		sent <- e
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	<-sentSignal
+
+	_ = wait.PollInfinite(10*time.Millisecond, func() (done bool, err error) {
+		return sm.ReceivedCount() == n, nil
+	})
+
+	sm.Terminated(Metrics{})
+
+	for i := n; i < n+m; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprintf("%d", i))
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(received)
+	<-receivedSignal
+
+	report := sm.GenerateReport()
+	if report.ReceivedCount != n {
+		t.Errorf("expected received count %d, got %d", n, report.ReceivedCount)
+	}
+	if report.PostTerminationReceivedCount != m {
+		t.Errorf("expected post termination received count %d, got %d", m, report.PostTerminationReceivedCount)
+	}
+	if got := len(report.PostTerminationReceivedEventsByPartitionKey[unknownPartitionKey]); got != m {
+		t.Errorf("expected %d post termination received events, got %d", m, got)
+	}
+}
+
+func TestStateManagerDiffDuplicates(t *testing.T) {
+
+	tt := []struct {
+		name              string
+		deliveryGuarantee DeliveryGuarantee
+		wantDiff          bool
+	}{
+		{
+			name:              "at least once",
+			deliveryGuarantee: AtLeastOnce,
+			wantDiff:          false,
+		},
+		{
+			name:              "at most once",
+			deliveryGuarantee: AtMostOnce,
+			wantDiff:          true,
+		},
+		{
+			name:              "exactly once",
+			deliveryGuarantee: ExactlyOnce,
+			wantDiff:          true,
+		},
+	}
+
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			sent := make(chan ce.Event, 2)
+			received := make(chan ReceivedEvent, 3)
+
+			sm := newTestStateManager(t, Config{DeliveryGuarantee: tc.deliveryGuarantee})
+			receivedSignal := sm.ReadReceived(received)
+			sentSignal := sm.ReadSent(sent)
+
+			for _, id := range []string{"1", "2"} {
+				e := cetest.FullEvent()
+				e.SetID(id)
+				sent <- e
+			}
+			for _, id := range []string{"1", "2", "2"} {
+				e := cetest.FullEvent()
+				e.SetID(id)
+				received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+			}
+			close(sent)
+			close(received)
+			<-receivedSignal
+			<-sentSignal
+
+			diff := sm.Diff()
+			if !diff.Empty() != tc.wantDiff {
+				t.Errorf("wanted diff? %v, got %s", tc.wantDiff, diff)
+			}
+			if tc.wantDiff && len(diff.Partitions[unknownPartitionKey].Duplicates) != 1 {
+				t.Errorf("expected 1 duplicate, got %s", diff)
+			}
+		})
+	}
+}
+
+func TestStateManagerLatency(t *testing.T) {
+
+	sent := make(chan ce.Event, 10)
+	received := make(chan ReceivedEvent, 10)
+
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 2}})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	sentAt := time.UnixMilli(time.Now().UnixMilli())
+	for i := 0; i < 10; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprintf("%d", i))
+		e.SetExtension(DefaultPartitionKeyExtension, fmt.Sprint(i%2))
+		e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(sentAt.UnixMilli()))
+		sent <- e
+		received <- ReceivedEvent{Event: e, ReceivedAt: sentAt.Add(time.Duration(i+1) * time.Second)}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	report := sm.GenerateReport()
+	if report.Latency.Count != 10 {
+		t.Errorf("expected 10 latencies, got %d", report.Latency.Count)
+	}
+	if report.Latency.Max != 10*time.Second {
+		t.Errorf("expected max latency %v, got %v", 10*time.Second, report.Latency.Max)
+	}
+	if report.Latency.P50 != 5*time.Second {
+		t.Errorf("expected p50 latency %v, got %v", 5*time.Second, report.Latency.P50)
+	}
+	if got := report.LatencyByPartitionKey["1"].Max; got != 10*time.Second {
+		t.Errorf("expected max latency for partition 1 %v, got %v", 10*time.Second, got)
+	}
+	if got := report.LatencyByPartitionKey["0"].Max; got != 9*time.Second {
+		t.Errorf("expected max latency for partition 0 %v, got %v", 9*time.Second, got)
+	}
+}
+
+func TestSentTimestamp(t *testing.T) {
+	sentAt := time.Unix(1700000000, 123456789)
+
+	tests := []struct {
+		name       string
+		extensions map[string]string
+		want       time.Time
+		wantOk     bool
+	}{
+		{
+			name: "nanoseconds",
+			extensions: map[string]string{
+				BenchmarkTimestampAttribute:      fmt.Sprint(sentAt.UnixMilli()),
+				BenchmarkTimestampNanosAttribute: fmt.Sprint(sentAt.UnixNano()),
+			},
+			want:   sentAt,
+			wantOk: true,
+		},
+		{
+			name:       "milliseconds",
+			extensions: map[string]string{BenchmarkTimestampAttribute: fmt.Sprint(sentAt.UnixMilli())},
+			want:       time.UnixMilli(sentAt.UnixMilli()),
+			wantOk:     true,
+		},
+		{
+			name: "invalid nanoseconds",
+			extensions: map[string]string{
+				BenchmarkTimestampAttribute:      fmt.Sprint(sentAt.UnixMilli()),
+				BenchmarkTimestampNanosAttribute: "abc",
+			},
+			want:   time.UnixMilli(sentAt.UnixMilli()),
+			wantOk: true,
+		},
+		{
+			name: "no timestamp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := cetest.FullEvent()
+			for k, v := range tt.extensions {
+				e.SetExtension(k, v)
+			}
+			got, ok := sentTimestamp(&e)
+			if ok != tt.wantOk || !got.Equal(tt.want) {
+				t.Errorf("want %v %v, got %v %v", tt.want, tt.wantOk, got, ok)
+			}
+		})
+	}
+
+	e := cetest.FullEvent()
+	setSentTimestamp(&e, sentAt)
+	if got, _ := sentTimestamp(&e); !got.Equal(sentAt) {
+		t.Errorf("want %v, got %v", sentAt, got)
+	}
+	if got := e.Extensions()[BenchmarkTimestampAttribute]; got != fmt.Sprint(sentAt.UnixMilli()) {
+		t.Errorf("want %s in milliseconds, got %v", BenchmarkTimestampAttribute, got)
+	}
+}
+
+func TestStateManagerStreaming(t *testing.T) {
+
+	sent := make(chan ce.Event, 10)
+	received := make(chan ReceivedEvent, 10)
+
+	sm := newTestStateManager(t, Config{
+		DeliveryGuarantee: ExactlyOnce,
+		Verification:      VerificationConfig{Mode: VerificationModeStreaming},
+	})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	sentAt := time.UnixMilli(time.Now().UnixMilli())
+	event := func(id string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(sentAt.UnixMilli()))
+		return e
+	}
+
+	// "1" is received before being sent, "2" is received twice before being sent, "3" is lost, "4" is received
+	// after being matched and "5" is never sent.
+	for _, id := range []string{"1", "2", "2"} {
+		received <- ReceivedEvent{Event: event(id), ReceivedAt: sentAt.Add(time.Second)}
+	}
+	_ = wait.PollInfinite(10*time.Millisecond, func() (done bool, err error) {
+		return len(received) == 0, nil
+	})
+	for _, id := range []string{"1", "2", "3", "4"} {
+		sent <- event(id)
+	}
+	close(sent)
+	<-sentSignal
+	for _, id := range []string{"4", "4", "5"} {
+		received <- ReceivedEvent{Event: event(id), ReceivedAt: sentAt.Add(2 * time.Second)}
+	}
+	close(received)
+	<-receivedSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 4})
+	report := sm.GenerateReport()
+
+	if report.ReceivedCount != 3 {
+		t.Errorf("expected received count 3, got %d", report.ReceivedCount)
+	}
+	if report.LostCount != 1 || report.LostEventsByPartitionKey[unknownPartitionKey][0] != "3" {
+		t.Errorf("expected event 3 to be lost, got %+v", report.LostEventsByPartitionKey)
+	}
+	if report.DuplicateCount != 2 {
+		t.Errorf("expected 2 duplicates, got %d", report.DuplicateCount)
+	}
+	if report.UnmatchedCount != 1 {
+		t.Errorf("expected 1 unmatched event, got %d", report.UnmatchedCount)
+	}
+	if report.Latency.Count != 3 || report.Latency.Max != 2*time.Second {
+		t.Errorf("unexpected latency %+v", report.Latency)
+	}
+
+	diff := sm.Diff()
+	p := diff.Partitions[unknownPartitionKey]
+	if len(p.Missing) != 1 || len(p.Unexpected) != 1 || len(p.Duplicates) != 2 {
+		t.Errorf("unexpected diff %s", diff)
+	}
+
+	if got := len(sm.streaming.outstanding); got != 1 {
+		t.Errorf("expected matched events to be pruned, got %d outstanding events", got)
+	}
+}
+
+func TestStateManagerStreamingRedelivery(t *testing.T) {
+
+	ordered := &OrderedConfig{NumPartitionKeys: 1}
+	event := func(seq int) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(seq))
+		e.SetExtension(ordered.partitionKeyExtension(), "0")
+		e.SetExtension(SequenceExtension, fmt.Sprint(seq))
+		return e
+	}
+
+	tests := []struct {
+		name           string
+		mode           VerificationMode
+		maxMatchedIDs  int
+		wantDuplicates int
+		wantUnexpected int
+		wantViolations int
+	}{
+		{
+			name:           "full",
+			mode:           VerificationModeFull,
+			wantDuplicates: 2,
+		},
+		{
+			name:           "streaming",
+			mode:           VerificationModeStreaming,
+			wantDuplicates: 2,
+		},
+		{
+			name:           "streaming, older redelivery forgotten",
+			mode:           VerificationModeStreaming,
+			maxMatchedIDs:  2,
+			wantDuplicates: 1,
+			wantUnexpected: 1,
+			wantViolations: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{
+				DeliveryGuarantee: ExactlyOnce,
+				Ordered:           ordered,
+				Verification:      VerificationConfig{Mode: tt.mode, MaxMatchedIDs: tt.maxMatchedIDs},
+			}
+			sm := newTestStateManager(t, config)
+
+			// Events 1 and 3 are received twice after being matched.
+			sm.lock.Lock()
+			for seq := 1; seq <= 3; seq++ {
+				e := event(seq)
+				sm.recordSent(&e)
+			}
+			for _, seq := range []int{1, 2, 3, 1, 3} {
+				sm.recordReceived(&ReceivedEvent{Event: event(seq), ReceivedAt: time.Now()})
+			}
+			sm.lock.Unlock()
+			sm.Terminated(Metrics{AcceptedCount: 3})
+
+			report := sm.GenerateReport()
+			if report.ReceivedCount != 3 || report.LostCount != 0 {
+				t.Errorf("expected 3 received events and none lost, got %d received and %d lost", report.ReceivedCount, report.LostCount)
+			}
+			if report.DuplicateCount != tt.wantDuplicates {
+				t.Errorf("expected %d duplicates, got %v", tt.wantDuplicates, report.DuplicateEventsByPartitionKey)
+			}
+			if report.UnexpectedCount != tt.wantUnexpected {
+				t.Errorf("expected %d unexpected events, got %v", tt.wantUnexpected, report.UnexpectedEventsByPartitionKey)
+			}
+			if report.OrderingViolationCount != tt.wantViolations {
+				t.Errorf("expected %d ordering violations, got %v", tt.wantViolations, report.OrderingViolationsByPartitionKey)
+			}
+
+			if err := verify(config, report); err == nil || !strings.Contains(err.Error(), "duplicates detected") {
+				t.Errorf("expected duplicates to fail the verification with the %s delivery guarantee, got %v", ExactlyOnce, err)
+			}
+		})
+	}
+}
+
+func TestStateManagerNacked(t *testing.T) {
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 5)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	// "1" is nacked twice before being acked, "2" is acked on the first attempt.
+	for _, r := range []struct {
+		id     string
+		nacked bool
+	}{{"1", true}, {"2", false}, {"1", true}, {"1", false}} {
+		e := cetest.FullEvent()
+		e.SetID(r.id)
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now(), Nacked: r.nacked}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	sm.Terminated(Metrics{AcceptedCount: 2})
+	report := sm.GenerateReport()
+
+	if report.ReceivedCount != 2 || report.DuplicateCount != 0 || report.LostCount != 0 {
+		t.Errorf("expected nacked deliveries to be ignored, got received %d, duplicates %d, lost %d", report.ReceivedCount, report.DuplicateCount, report.LostCount)
+	}
+	if report.NackedCount != 2 {
+		t.Errorf("expected nacked count 2, got %d", report.NackedCount)
+	}
+	if got := fmt.Sprint(report.NackedEventsByPartitionKey[unknownPartitionKey]); got != "[1]" {
+		t.Errorf("expected event 1 to be nacked, got %s", got)
+	}
+	if report.RetriesByEvent["1"] != 2 || report.RetryCount != 2 {
+		t.Errorf("expected 2 retries for event 1, got %v", report.RetriesByEvent)
+	}
+}
+
+func TestStateManagerDeadLettered(t *testing.T) {
+
+	sent := make(chan ce.Event, 3)
+	received := make(chan ReceivedEvent, 4)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for _, id := range []string{"1", "2", "3"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		sent <- e
+	}
+	// "1" is received, "2" is dead-lettered, "3" is both dead-lettered and received.
+	for _, r := range []struct {
+		id           string
+		deadLettered bool
+	}{{"1", false}, {"2", true}, {"3", true}, {"3", false}} {
+		e := cetest.FullEvent()
+		e.SetID(r.id)
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now(), DeadLettered: r.deadLettered}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	if diff := sm.Diff(); !diff.Empty() {
+		t.Errorf("expected dead-lettered events to be accounted for, got %s", diff)
+	}
+
+	sm.Terminated(Metrics{AcceptedCount: 3})
+	report := sm.GenerateReport()
+	if report.LostCount != 0 || report.ReceivedCount != 2 {
+		t.Errorf("expected no lost events and 2 received events, got lost %d, received %d", report.LostCount, report.ReceivedCount)
+	}
+	if got := fmt.Sprint(report.DeadLetteredEventsByPartitionKey[unknownPartitionKey]); report.DeadLetteredCount != 1 || got != "[2]" {
+		t.Errorf("expected event 2 to be dead-lettered, got %s", got)
+	}
+}
+
+func TestStateManagerUnexpected(t *testing.T) {
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 4)
+
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 2}})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	event := func(id, pk string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(DefaultPartitionKeyExtension, pk)
+		return e
+	}
+	for _, id := range []string{"1", "2"} {
+		sent <- event(id, "a")
+	}
+	// "3" is unexpected in a partition with sent events, "4" in a partition without sent events.
+	for _, e := range []ce.Event{event("1", "a"), event("2", "a"), event("3", "a"), event("4", "b")} {
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	report := sm.GenerateReport()
+	if report.ReceivedCount != 2 {
+		t.Errorf("expected unexpected events not to be counted as received, got received count %d", report.ReceivedCount)
+	}
+	if report.UnexpectedCount != 2 ||
+		fmt.Sprint(report.UnexpectedEventsByPartitionKey["a"]) != "[3]" ||
+		fmt.Sprint(report.UnexpectedEventsByPartitionKey["b"]) != "[4]" {
+		t.Errorf("expected unexpected events 3 and 4, got %v", report.UnexpectedEventsByPartitionKey)
+	}
+
+	diff := sm.Diff()
+	if len(diff.Partitions["a"].Unexpected) != 1 || len(diff.Partitions["b"].Unexpected) != 1 {
+		t.Errorf("expected diff to flag unexpected events, got %s", diff)
+	}
+}
+
+func TestStateManagerCorrupted(t *testing.T) {
+
+	sent := make(chan ce.Event, 2)
+	received := make(chan ReceivedEvent, 2)
+
+	sm := newTestStateManager(t, Config{Verification: VerificationConfig{Integrity: true}})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	for _, id := range []string{"1", "2"} {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setChecksum(&e)
+		sent <- e
+
+		r := cetest.FullEvent()
+		r.SetID(id)
+		r.SetExtension(ChecksumExtension, e.Extensions()[ChecksumExtension])
+		if id == "2" {
+			if err := r.SetData("text/json", "mutated"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		received <- ReceivedEvent{Event: r, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	report := sm.GenerateReport()
+	if got := fmt.Sprint(report.CorruptedEventsByPartitionKey[unknownPartitionKey]); report.CorruptedCount != 1 || got != "[2]" {
+		t.Errorf("expected event 2 to be corrupted, got %s", got)
+	}
+}
+
+func TestStateManagerOrderingViolations(t *testing.T) {
+
+	sent := make(chan ce.Event, 6)
+	received := make(chan ReceivedEvent, 6)
+
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	events := make(map[string]ce.Event, 6)
+	for i := 1; i <= 6; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension(DefaultPartitionKeyExtension, "0")
+		events[e.ID()] = e
+		sent <- e
+	}
+	for _, id := range []string{"1", "4", "2", "3", "6", "5"} {
+		received <- ReceivedEvent{Event: events[id], ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	report := sm.GenerateReport()
+
+	want := OrderingReport{
+		Violations: []OrderingViolation{
+			{ID: "2", ExpectedPosition: 1, ActualPosition: 2, Displacement: 2, Previous: "4", Next: "3"},
+			{ID: "3", ExpectedPosition: 2, ActualPosition: 3, Displacement: 1, Previous: "2", Next: "6"},
+			{ID: "5", ExpectedPosition: 4, ActualPosition: 5, Displacement: 1, Previous: "6"},
+		},
+		MaxDisplacement:  2,
+		MeanDisplacement: 4.0 / 3,
+	}
+	if report.OrderingViolationCount != 3 {
+		t.Errorf("expected 3 ordering violations, got %d", report.OrderingViolationCount)
+	}
+	if diff := cmp.Diff(want, report.OrderingViolationsByPartitionKey["0"]); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestStateManagerLiveOrderingViolations(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   int64
+	}{
+		{name: "full", config: Config{Ordered: &OrderedConfig{NumPartitionKeys: 2}}, want: 3},
+		{name: "tolerance window", config: Config{Ordered: &OrderedConfig{NumPartitionKeys: 2, ToleranceWindow: 1}}, want: 1},
+		{
+			name:   "streaming",
+			config: Config{Ordered: &OrderedConfig{NumPartitionKeys: 2}, Verification: VerificationConfig{Mode: VerificationModeStreaming}},
+			want:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sm := newTestStateManager(t, tt.config)
+			event := func(pk string, seq int) ce.Event {
+				e := cetest.FullEvent()
+				e.SetID(fmt.Sprintf("%s-%d", pk, seq))
+				e.SetExtension(DefaultPartitionKeyExtension, pk)
+				e.SetExtension(SequenceExtension, fmt.Sprint(seq))
+				return e
+			}
+			sm.lock.Lock()
+			defer sm.lock.Unlock()
+			for _, pk := range []string{"0", "1"} {
+				for seq := 1; seq <= 4; seq++ {
+					e := event(pk, seq)
+					sm.recordSent(&e)
+				}
+			}
+			for _, e := range []ce.Event{
+				// Partitions are ordered independently, redeliveries are not violations.
+				event("0", 1), event("1", 2), event("0", 4), event("0", 2), event("0", 2), event("1", 1), event("0", 3), event("1", 3),
+			} {
+				e := e
+				sm.recordReceived(&ReceivedEvent{Event: e, ReceivedAt: time.Now()})
+			}
+			if got := sm.orderingViolationCount.Load(); got != tt.want {
+				t.Errorf("want %d ordering violations, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStateManagerConcurrentIngestion(t *testing.T) {
+
+	n := 3 * DefaultIngestBatchSize
+
+	sent := make(chan ce.Event, n)
+	received := make(chan ReceivedEvent, n)
+
+	sm := newTestStateManager(t, Config{Ordered: &OrderedConfig{NumPartitionKeys: 4}})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				_ = sm.ReceivedCount()
+				_ = sm.InterimReport(time.Now(), nil)
+			}
+		}
+	}()
+
+	for i := 0; i < n; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension(DefaultPartitionKeyExtension, fmt.Sprint(i%4))
+		sent <- e
+		received <- ReceivedEvent{Event: e, ReceivedAt: time.Now()}
+	}
+	close(sent)
+	close(received)
+	<-sentSignal
+	<-receivedSignal
+	close(done)
+	wg.Wait()
+
+	report := sm.GenerateReport()
+	if report.ReceivedCount != n || report.LostCount != 0 || report.DuplicateCount != 0 || report.OrderingViolationCount != 0 {
+		t.Errorf("expected %d received events without loss, duplicates and ordering violations, got received %d, lost %d, duplicates %d, ordering violations %d",
+			n, report.ReceivedCount, report.LostCount, report.DuplicateCount, report.OrderingViolationCount)
+	}
+}
+
+// benchmarkEvents returns n events with distinct IDs spread over 4 partition keys.
+func benchmarkEvents(n int) []ce.Event {
+	events := make([]ce.Event, n)
+	for i := range events {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		e.SetExtension(DefaultPartitionKeyExtension, fmt.Sprint(i%4))
+		events[i] = e
+	}
+	return events
+}
+
+func benchmarkStateManager(b *testing.B, persistent bool) *StateManager {
+	config := Config{Ordered: &OrderedConfig{NumPartitionKeys: 4}}
+	if !persistent {
+		return newTestStateManager(b, config)
+	}
+	config.State = &StateConfig{Path: filepath.Join(b.TempDir(), "state.db")}
+	sm, err := OpenStateManager(config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return sm
+}
+
+func newTestStateManager(tb testing.TB, config Config) *StateManager {
+	tb.Helper()
+	sm, err := NewStateManager(config)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return sm
+}
+
+func reportEventsPerSecond(b *testing.B, n int, start time.Time) {
+	b.ReportMetric(float64(n)/time.Since(start).Seconds(), "events/s")
+}
+
+func BenchmarkReadSent(b *testing.B) {
+	for _, persistent := range []bool{false, true} {
+		b.Run(fmt.Sprintf("persistent=%v", persistent), func(b *testing.B) {
+			sm := benchmarkStateManager(b, persistent)
+			events := benchmarkEvents(b.N)
+			sent := make(chan ce.Event, DefaultIngestBufferSize)
+			signal := sm.ReadSent(sent)
+
+			b.ResetTimer()
+			start := time.Now()
+			for i := range events {
+				sent <- events[i]
+			}
+			close(sent)
+			<-signal
+			reportEventsPerSecond(b, b.N, start)
+			b.StopTimer()
+
+			sm.Terminated(Metrics{AcceptedCount: b.N})
+		})
+	}
+}
+
+func BenchmarkReadReceived(b *testing.B) {
+	for _, persistent := range []bool{false, true} {
+		b.Run(fmt.Sprintf("persistent=%v", persistent), func(b *testing.B) {
+			sm := benchmarkStateManager(b, persistent)
+			events := benchmarkEvents(b.N)
+			sent := make(chan ce.Event, DefaultIngestBufferSize)
+			received := make(chan ReceivedEvent, DefaultIngestBufferSize)
+			sentSignal := sm.ReadSent(sent)
+			receivedSignal := sm.ReadReceived(received)
+
+			b.ResetTimer()
+			start := time.Now()
+			go func() {
+				for i := range events {
+					sent <- events[i]
+				}
+				close(sent)
+			}()
+			for i := range events {
+				received <- ReceivedEvent{Event: events[i], ReceivedAt: time.Now()}
+			}
+			close(received)
+			<-sentSignal
+			<-receivedSignal
+			reportEventsPerSecond(b, b.N, start)
+			b.StopTimer()
+
+			sm.Terminated(Metrics{AcceptedCount: b.N})
+			if report := sm.GenerateReport(); report.ReceivedCount != b.N || report.LostCount != 0 {
+				b.Fatalf("want %d received events, got received %d, lost %d", b.N, report.ReceivedCount, report.LostCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,351 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/go-yaml/yaml"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// StreamExtension is the extension carrying the name of the stream events have been sent by.
+const StreamExtension = "sacurastream"
+
+// StreamConfig is a logical stream of a multi-tenant test, for example a tenant with its own Broker: streams run in
+// parallel in a single process, each with its own sender, and share the receiver, which routes events to their stream
+// by request path.
+//
+// Each stream runs the config with the fields set by the stream config and its state is kept apart from the state of
+// other streams, so that each stream is verified on its own.
+type StreamConfig struct {
+	// Name is the name of the stream, it is carried by the StreamExtension of events.
+	Name string `json:"name" yaml:"name"`
+	// Target is the target URL events of the stream are sent to.
+	//
+	// Defaults to sender.target.
+	Target string `json:"target" yaml:"target"`
+	// Path is the request path on which the receiver expects events of the stream, for example "/tenant-a".
+	Path string `json:"path" yaml:"path"`
+	// FrequencyPerSecond is the rate of the stream.
+	//
+	// Defaults to sender.frequency.
+	FrequencyPerSecond int `json:"frequency" yaml:"frequency"`
+	// Ordered is the ordering expectation of the stream, when not specified events of the stream aren't expected in
+	// order.
+	Ordered *OrderedConfig `json:"ordered" yaml:"ordered"`
+
+	// Parsed is the validated config of the stream.
+	Parsed *Config `json:"config" yaml:"-"`
+}
+
+func validateStreams(config *Config) error {
+	for _, f := range []struct {
+		field string
+		set   bool
+	}{
+		{"ordered", config.Ordered != nil},
+		{"sender.disabled", config.Sender.Disabled},
+		{"sender.handshake", config.Sender.Handshake != nil},
+		{"sender.targets", config.Sender.Targets != nil},
+		{"sender.closedLoop", config.Sender.ClosedLoop != nil},
+		{"receiver.disabled", config.Receiver.Disabled},
+		{"receiver.fanOut", config.Receiver.FanOut != nil},
+		{"receiver.disruptions", config.Receiver.Disruptions != nil},
+		{"receiver.lateArrivals", config.Receiver.LateArrivals != nil},
+		{"receiver.clockSync", config.Receiver.ClockSync != nil},
+		{"report.interim", config.Report.Interim != nil},
+		{"report.progress", config.Report.Progress != nil},
+		{"distributed", config.Distributed != nil},
+		{"benchmark", config.Benchmark != nil},
+		{"knative", config.Knative != nil},
+		{"serialization", config.Serialization != nil},
+		{"admin", config.Admin != nil},
+		{"diagnostics", config.Diagnostics != nil},
+	} {
+		if f.set {
+			return invalidErr(f.field, errors.New("cannot be used with streams"))
+		}
+	}
+	if config.Receiver.Protocol != "" && config.Receiver.Protocol != ProtocolHTTP {
+		return invalidErr("receiver.protocol", fmt.Errorf("streams are routed by request path, expected %s", ProtocolHTTP))
+	}
+
+	// Streams inherit everything but the streams and the report destinations, which receive the combined report.
+	base := *config
+	base.Streams = nil
+	base.Report.Writers = nil
+	base.Report.Kubernetes = nil
+	b, err := yaml.Marshal(&base)
+	if err != nil {
+		return invalidErr("streams", err)
+	}
+
+	names := sets.NewString()
+	paths := make(map[string]string)
+	for i := range config.Streams {
+		s := &config.Streams[i]
+		field := fmt.Sprintf("streams[%d]", i)
+		if !isDNSSubdomain(s.Name) {
+			return invalidErr(field+".name", fmt.Errorf("%q must be a lowercase RFC 1123 subdomain", s.Name))
+		}
+		if names.Has(s.Name) {
+			return invalidErr(field+".name", fmt.Errorf("duplicate stream %q", s.Name))
+		}
+		names.Insert(s.Name)
+
+		if !strings.HasPrefix(s.Path, "/") {
+			return invalidErr(field+".path", fmt.Errorf("%q must start with /", s.Path))
+		}
+		if s.Path == config.Receiver.DeadLetterSinkPath {
+			return invalidErr(field+".path", errors.New("is the receiver.deadLetterSinkPath"))
+		}
+		if other, ok := paths[s.Path]; ok {
+			return invalidErr(field+".path", fmt.Errorf("%q is also the path of stream %q", s.Path, other))
+		}
+		paths[s.Path] = s.Name
+
+		if s.FrequencyPerSecond < 0 {
+			return invalidErr(field+".frequency", fmt.Errorf("%d cannot be negative", s.FrequencyPerSecond))
+		}
+
+		parsed := &Config{}
+		if err := yaml.Unmarshal(b, parsed); err != nil {
+			return invalidErr(field, err)
+		}
+		if s.Target != "" {
+			parsed.Sender.Target = s.Target
+		}
+		if s.FrequencyPerSecond != 0 {
+			parsed.Sender.FrequencyPerSecond = s.FrequencyPerSecond
+		}
+		parsed.Ordered = s.Ordered
+		// Streams keep their files apart.
+		if parsed.State != nil {
+			parsed.State.Path = streamFilePath(parsed.State.Path, s.Name)
+		}
+		if parsed.Report.EventLog != nil {
+			parsed.Report.EventLog.Path = streamFilePath(parsed.Report.EventLog.Path, s.Name)
+		}
+		if parsed.Sender.Record != nil {
+			parsed.Sender.Record.Path = streamFilePath(parsed.Sender.Record.Path, s.Name)
+		}
+		if err := parsed.validate(); err != nil {
+			return fmt.Errorf("stream %q: %w", s.Name, err)
+		}
+
+		// The stream extension is reserved, so it is set once the stream config is validated.
+		if parsed.Sender.Attributes == nil {
+			parsed.Sender.Attributes = &EventAttributesConfig{}
+		}
+		extensions := make(map[string]string, len(parsed.Sender.Attributes.Extensions)+1)
+		for k, v := range parsed.Sender.Attributes.Extensions {
+			extensions[k] = v
+		}
+		extensions[StreamExtension] = s.Name
+		parsed.Sender.Attributes.Extensions = extensions
+		s.Parsed = parsed
+	}
+	return nil
+}
+
+// streamFilePath returns the path of the file of the given stream, for example state.orders.json for state.json.
+func streamFilePath(path, stream string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + stream + ext
+}
+
+// StreamReport is the section of a stream in the combined report of a multi-tenant test.
+type StreamReport struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+	// MisroutedCount is the number of events of the stream received on another request path than the path of the
+	// stream, they aren't counted as received by the stream.
+	MisroutedCount int `json:"misroutedCount,omitempty"`
+	// MisroutedByPath is the number of misrouted events of the stream by the request path they have been received on.
+	MisroutedByPath map[string]int `json:"misroutedByPath,omitempty"`
+	Report          Report         `json:"report"`
+}
+
+// stream is a running stream of a multi-tenant test.
+type stream struct {
+	config   *Config
+	path     string
+	sm       *StateManager
+	sent     chan ce.Event
+	received chan ReceivedEvent
+	metrics  Metrics
+	// ctx is the context of the sender of the stream, stop stops the sender.
+	ctx  context.Context
+	stop context.CancelFunc
+	// misroutedByPath is only accessed by routeStreams until received is closed.
+	misroutedByPath map[string]int
+}
+
+// routeStreams routes events received by the shared receiver to the stream they have been sent by, events received
+// on another path than the path of their stream are misrouted. It closes the received channels of the streams once
+// received is closed.
+func routeStreams(received <-chan ReceivedEvent, streams map[string]*stream) {
+	defer func() {
+		for _, s := range streams {
+			close(s.received)
+		}
+	}()
+	for e := range received {
+		name, _ := eventAttribute(&e.Event, StreamExtension)
+		s, ok := streams[name]
+		if !ok {
+			logger(LogComponentReceiver).Warnw("Received event of no stream", "id", e.Event.ID(), "path", e.Path, "stream", name)
+			continue
+		}
+		if !e.DeadLettered && e.Path != s.path {
+			logger(LogComponentReceiver).Warnw("Received event on the path of another stream", "id", e.Event.ID(), "path", e.Path, "stream", name)
+			s.misroutedByPath[e.Path]++
+			continue
+		}
+		s.received <- e
+	}
+}
+
+// runStreams runs the streams of the given config in parallel with a shared receiver and verifies each stream, the
+// returned error lists the failed streams.
+func runStreams(ctx context.Context, config Config) (Report, error) {
+	streams := make(map[string]*stream, len(config.Streams))
+	for _, c := range config.Streams {
+		sm, err := OpenStateManager(*c.Parsed)
+		if err != nil {
+			return Report{}, fmt.Errorf("stream %q: %w", c.Name, err)
+		}
+		s := &stream{
+			config:          c.Parsed,
+			path:            c.Path,
+			sm:              sm,
+			sent:            make(chan ce.Event, c.Parsed.Ingest.bufferSize()),
+			received:        make(chan ReceivedEvent, c.Parsed.Ingest.bufferSize()),
+			misroutedByPath: make(map[string]int),
+		}
+		// The sender of a stream is stopped early when too many of its events are not received within the max
+		// delivery age.
+		s.ctx, s.stop = context.WithCancel(context.Background())
+		defer s.stop()
+		streams[c.Name] = s
+	}
+
+	exporter := newSpanExporter(config.Tracing)
+	defer exporter.shutdown()
+
+	parent := ctx
+	aborted := make(chan struct{})
+	ctx, cancel := context.WithCancel(contextWithAborted(contextWithSpanExporter(ctx, exporter), aborted))
+	defer cancel()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-parent.Done():
+			logger(logComponentRun).Infow("Test aborted, stopping the senders", "error", parent.Err())
+			close(aborted)
+			for _, s := range streams {
+				s.stop()
+			}
+			cancel()
+		case <-done:
+		}
+	}()
+
+	var senders sync.WaitGroup
+	signals := make([]<-chan struct{}, 0, 2*len(streams))
+	stopExpirations := make([]func(), 0, len(streams))
+	for name, s := range streams {
+		senders.Add(1)
+		go func(name string, s *stream) {
+			defer senders.Done()
+			defer close(s.sent)
+			logger(logComponentRun).Infow("Starting attacker ...", "stream", name)
+			time.Sleep(s.config.Sender.startDelay()) // Waiting for receiver to start
+			s.metrics = startSender(contextWithSpanExporter(s.ctx, exporter), *s.config, s.sent)
+		}(name, s)
+		signals = append(signals, s.sm.ReadReceived(s.received), s.sm.ReadSent(s.sent))
+		stopExpirations = append(stopExpirations, s.sm.startExpiration(s.stop))
+	}
+	go func() {
+		senders.Wait()
+		cancel()
+	}()
+
+	received := make(chan ReceivedEvent, config.Ingest.bufferSize())
+	go routeStreams(received, streams)
+
+	logger(logComponentRun).Info("Starting receiver ...")
+	// The receiver exports the metrics of the state of the first stream.
+	if err := StartReceiver(ctx, config.Receiver, received, streams[config.Streams[0].Name].sm); err != nil {
+		return Report{}, fmt.Errorf("failed to start receiver: %w", err)
+	}
+
+	logger(logComponentRun).Info("Waiting for attackers to finish ...")
+	<-ctx.Done()
+	logger(logComponentRun).Info("Waiting for sent and received channel signals")
+	for _, signal := range signals {
+		<-signal
+	}
+	for _, stop := range stopExpirations {
+		stop()
+	}
+
+	reports := make([]StreamReport, len(config.Streams))
+	var failed []string
+	for i, c := range config.Streams {
+		s := streams[c.Name]
+		s.sm.Terminated(s.metrics)
+		r := StreamReport{Name: c.Name, Path: c.Path, Report: s.sm.GenerateReport()}
+		select {
+		case <-aborted:
+			r.Report.Aborted = true
+		default:
+		}
+		logger(LogComponentReport).Infow("Stream report", "stream", c.Name, "report", config.Report.Limits.limited(r.Report))
+
+		err := verifyReport(*s.config, &r.Report)
+		for _, n := range s.misroutedByPath {
+			r.MisroutedCount += n
+		}
+		if r.MisroutedCount > 0 {
+			r.MisroutedByPath = s.misroutedByPath
+			if err == nil {
+				err = fmt.Errorf("%d events received on another path than %s", r.MisroutedCount, c.Path)
+			}
+		}
+		r.Passed = err == nil
+		if err != nil {
+			r.Error = err.Error()
+			failed = append(failed, c.Name)
+		}
+		reports[i] = r
+	}
+
+	report := Report{Streams: reports}
+	for _, r := range reports {
+		report.Aborted = report.Aborted || r.Report.Aborted
+	}
+	var verificationErr error
+	if len(failed) > 0 {
+		verificationErr = fmt.Errorf("%d of %d streams failed: %s", len(failed), len(reports), strings.Join(failed, ", "))
+	}
+	logger(LogComponentReport).Infow("Streams done", "passed", verificationErr == nil, "failed", failed)
+
+	if err := writeReports(config.Report, report, verificationErr); err != nil {
+		if verificationErr != nil {
+			logger(LogComponentReport).Errorw("Failed to write reports", "error", err)
+			return report, verificationErr
+		}
+		return report, err
+	}
+	return report, verificationErr
+}
@@ -0,0 +1,264 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	"github.com/google/go-cmp/cmp"
+)
+
+const streamsTestConfig = `
+sender:
+  target: http://localhost:8080/a
+  frequency: 10
+  workers: 1
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+state:
+  path: /tmp/state.json
+report:
+  writers:
+  - format: json
+    path: /tmp/report.json
+`
+
+func TestStreamsConfig(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		streams string
+		check   func(t *testing.T, c Config)
+		wantErr bool
+	}{
+		{
+			name: "streams override the config",
+			streams: `
+streams:
+- name: a
+  path: /a
+- name: b
+  target: http://localhost:8080/b
+  path: /b
+  frequency: 20
+  ordered:
+    numPartitionKeys: 4
+`,
+			check: func(t *testing.T, c Config) {
+				a, b := c.Streams[0].Parsed, c.Streams[1].Parsed
+				if a.Sender.Target != "http://localhost:8080/a" || a.Sender.FrequencyPerSecond != 10 || a.Ordered != nil {
+					t.Errorf("unexpected stream a config %+v", a.Sender)
+				}
+				if b.Sender.Target != "http://localhost:8080/b" || b.Sender.FrequencyPerSecond != 20 || b.Ordered == nil || b.Ordered.PartitionKeyExtension != DefaultPartitionKeyExtension {
+					t.Errorf("unexpected stream b config %+v", b.Sender)
+				}
+				if diff := cmp.Diff(map[string]string{StreamExtension: "b"}, b.Sender.Attributes.Extensions); diff != "" {
+					t.Error("unexpected stream b extensions (-want, +got)", diff)
+				}
+				if a.State.Path != "/tmp/state.a.json" || c.State.Path != "/tmp/state.json" {
+					t.Errorf("expected stream state journals apart, got %s and %s", a.State.Path, c.State.Path)
+				}
+				if len(a.Report.Writers) != 0 || len(c.Report.Writers) != 1 {
+					t.Errorf("expected only the combined report to be written, got %v and %v", a.Report.Writers, c.Report.Writers)
+				}
+			},
+		},
+		{
+			name: "duplicate path",
+			streams: `
+streams:
+- name: a
+  path: /a
+- name: b
+  path: /a
+`,
+			wantErr: true,
+		},
+		{
+			name: "duplicate name",
+			streams: `
+streams:
+- name: a
+  path: /a
+- name: a
+  path: /b
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid name",
+			streams: `
+streams:
+- name: A
+  path: /a
+`,
+			wantErr: true,
+		},
+		{
+			name: "relative path",
+			streams: `
+streams:
+- name: a
+  path: a
+`,
+			wantErr: true,
+		},
+		{
+			name: "top level ordered",
+			streams: `
+ordered:
+  numPartitionKeys: 4
+streams:
+- name: a
+  path: /a
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid stream ordered",
+			streams: `
+streams:
+- name: a
+  path: /a
+  ordered:
+    numPartitionKeys: 4
+    toleranceWindow: -1
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileConfig(strings.NewReader(streamsTestConfig + tt.streams))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestRouteStreams(t *testing.T) {
+
+	event := func(id, stream string) ce.Event {
+		e := ce.NewEvent()
+		e.SetID(id)
+		if stream != "" {
+			e.SetExtension(StreamExtension, stream)
+		}
+		return e
+	}
+
+	streams := map[string]*stream{
+		"a": {path: "/a", received: make(chan ReceivedEvent, 10), misroutedByPath: map[string]int{}},
+		"b": {path: "/b", received: make(chan ReceivedEvent, 10), misroutedByPath: map[string]int{}},
+	}
+	received := make(chan ReceivedEvent, 10)
+	received <- ReceivedEvent{Event: event("1", "a"), Path: "/a"}
+	received <- ReceivedEvent{Event: event("2", "b"), Path: "/b"}
+	received <- ReceivedEvent{Event: event("3", "b"), Path: "/a"}
+	received <- ReceivedEvent{Event: event("4", "a"), Path: "/dls", DeadLettered: true}
+	received <- ReceivedEvent{Event: event("5", ""), Path: "/a"}
+	close(received)
+
+	routeStreams(received, streams)
+
+	for name, want := range map[string][]string{"a": {"1", "4"}, "b": {"2"}} {
+		var got []string
+		for e := range streams[name].received {
+			got = append(got, e.Event.ID())
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Errorf("unexpected events routed to stream %s (-want, +got) %s", name, diff)
+		}
+	}
+	if diff := cmp.Diff(map[string]int{"/a": 1}, streams["b"].misroutedByPath); diff != "" {
+		t.Error("unexpected misrouted events of stream b (-want, +got)", diff)
+	}
+	if len(streams["a"].misroutedByPath) != 0 {
+		t.Errorf("expected no misrouted events of stream a, got %v", streams["a"].misroutedByPath)
+	}
+}
+
+func TestRunStreams(t *testing.T) {
+
+	// Stream b sends to the path of stream a, so that its events are misrouted.
+	config, err := FileConfig(strings.NewReader(`
+sender:
+  target: http://localhost:9234/a
+  frequency: 10
+  workers: 1
+  startDelay: 500ms
+receiver:
+  port: 9234
+  timeout: 5s
+  quietPeriod: 500ms
+duration: 1s
+streams:
+- name: a
+  path: /a
+- name: b
+  path: /b
+  frequency: 20
+  ordered:
+    numPartitionKeys: 1
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(context.Background(), config)
+	if err == nil || err.Error() != "1 of 2 streams failed: b" {
+		t.Fatalf("expected stream b to fail, got %v", err)
+	}
+	if len(report.Streams) != 2 || report.Streams[0].Name != "a" || report.Streams[1].Name != "b" {
+		t.Fatalf("expected a report per stream, got %+v", report.Streams)
+	}
+	a, b := report.Streams[0], report.Streams[1]
+	if !a.Passed || a.Report.Metrics.AcceptedCount == 0 || a.Report.ReceivedCount != a.Report.Metrics.AcceptedCount {
+		t.Errorf("expected stream a to receive all its events and pass, got %+v", a)
+	}
+	if b.Passed || b.MisroutedCount != b.Report.Metrics.AcceptedCount || b.MisroutedByPath["/a"] != b.MisroutedCount || b.Report.ReceivedCount != 0 {
+		t.Errorf("expected all events of stream b to be misrouted, got %+v", b)
+	}
+	if b.Report.Metrics.AcceptedCount <= a.Report.Metrics.AcceptedCount {
+		t.Errorf("expected stream b to send at a higher rate, got %d and %d accepted events", b.Report.Metrics.AcceptedCount, a.Report.Metrics.AcceptedCount)
+	}
+}
+
+func TestWriteStreamsReports(t *testing.T) {
+
+	report := Report{Streams: []StreamReport{
+		{Name: "tenant-a", Path: "/tenant-a", Passed: true, Report: Report{ReceivedCount: 10}},
+		{Name: "tenant-b", Path: "/tenant-b", Error: "3 events received on another path", MisroutedCount: 3},
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := writeJUnitReport(buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	junit := buf.String()
+	for _, want := range []string{`tests="2"`, `failures="1"`, `<testcase name="tenant-a"`, `<testcase name="tenant-b"`, "3 events received on another path"} {
+		if !strings.Contains(junit, want) {
+			t.Errorf("expected JUnit report to contain %q, got %s", want, junit)
+		}
+	}
+
+	buf.Reset()
+	if err := writeHTMLReport(buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{"<h2>Streams</h2>", "<td>tenant-a</td><td>/tenant-a</td>", "<td>3</td>"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected HTML report to contain %q", want)
+		}
+	}
+}
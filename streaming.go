@@ -0,0 +1,438 @@
+package sacura
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+type VerificationMode string
+
+const (
+	// VerificationModeFull keeps every sent and received event ID in memory until the end of the test.
+	VerificationModeFull VerificationMode = "full"
+	// VerificationModeStreaming matches received events against sent events as they arrive and prunes matched
+	// events, keeping only outstanding events and counters in memory.
+	VerificationModeStreaming VerificationMode = "streaming"
+	// VerificationModeSoak is VerificationModeStreaming over the sliding window of VerificationConfig.Soak, events
+	// unmatched within the window are reported as they age out and pruned as well.
+	VerificationModeSoak VerificationMode = "soak"
+	// VerificationModeApproximate is VerificationModeStreaming storing fingerprints of outstanding events in cuckoo
+	// filters instead of their IDs, lost and unexpected counts are estimates within the error bound stated in the
+	// report and lost events aren't listed.
+	VerificationModeApproximate VerificationMode = "approximate"
+)
+
+// DefaultMaxMatchedIDs is the number of matched events remembered in streaming verification mode when none is
+// configured.
+const DefaultMaxMatchedIDs = 100_000
+
+// streams returns true if received events are matched against sent events as they arrive.
+func (m VerificationMode) streams() bool {
+	return m == VerificationModeStreaming || m == VerificationModeSoak || m == VerificationModeApproximate
+}
+
+type UnexpectedEventsPolicy string
+
+const (
+	// UnexpectedEventsIgnore reports unexpected events without failing the verification.
+	UnexpectedEventsIgnore UnexpectedEventsPolicy = "ignore"
+	// UnexpectedEventsFail fails the verification when unexpected events are received.
+	UnexpectedEventsFail UnexpectedEventsPolicy = "fail"
+)
+
+type VerificationConfig struct {
+	// Mode is the verification mode.
+	//
+	// Defaults to VerificationModeFull.
+	Mode VerificationMode `json:"mode" yaml:"mode"`
+
+	// UnexpectedEvents is the policy for events received but never sent, for example events from a misconfigured
+	// trigger or from a previous run.
+	//
+	// Defaults to UnexpectedEventsIgnore.
+	UnexpectedEvents UnexpectedEventsPolicy `json:"unexpectedEvents" yaml:"unexpectedEvents"`
+
+	// Integrity embeds a checksum of the data of sent events, received events whose data doesn't match the
+	// checksum are reported as corrupted and fail the verification.
+	Integrity bool `json:"integrity" yaml:"integrity"`
+
+	// MaxDeliveryAge is the maximum time between the send and the receive time of an event, sent events not
+	// received within it are immediately recorded as lost.
+	MaxDeliveryAge string `json:"maxDeliveryAge" yaml:"maxDeliveryAge"`
+	// MaxExpiredEvents is the maximum number of events not received within MaxDeliveryAge, the test stops as soon
+	// as it is exceeded and the verification fails.
+	MaxExpiredEvents *int `json:"maxExpiredEvents" yaml:"maxExpiredEvents"`
+	// MaxOrderingViolations is the maximum number of events received out of order in ordered mode, see
+	// Report.OrderingViolationCount.
+	//
+	// Defaults to no limit, ordering violations are reported without failing the verification.
+	MaxOrderingViolations *int `json:"maxOrderingViolations" yaml:"maxOrderingViolations"`
+
+	// Filter is the predicate of the filter under test, like the filter of a Trigger: sent events not matching it
+	// are expected not to be received and received events not matching it fail the verification.
+	Filter *FilterPredicate `json:"filter" yaml:"filter"`
+
+	// Assertions are assertions over the content of received events, events failing them are reported and fail the
+	// verification.
+	Assertions []EventAssertionConfig `json:"assertions" yaml:"assertions"`
+
+	// Attributes compares the attributes of received events with the attributes of the sent events.
+	Attributes *AttributeAuditConfig `json:"attributes" yaml:"attributes"`
+
+	// DeliveryAttempts verifies the number of delivery attempts of received events against the retry policy of the
+	// system under test.
+	DeliveryAttempts *DeliveryAttemptsConfig `json:"deliveryAttempts" yaml:"deliveryAttempts"`
+
+	// DuplicateBudget is the number of duplicates tolerated with the at-least-once and at-most-once delivery
+	// guarantees, so that brokers with a known small duplicate rate pass the verification. It's invalid with the
+	// exactly-once delivery guarantee.
+	DuplicateBudget *BudgetConfig `json:"duplicateBudget" yaml:"duplicateBudget"`
+
+	// LossBudget is the number of lost events tolerated, regardless of the delivery guarantee, so that environments
+	// with a known small loss, like spot nodes or chaos tests, pass the verification.
+	LossBudget *BudgetConfig `json:"lossBudget" yaml:"lossBudget"`
+
+	// Topology verifies that received events passed through the steps of the topology under test, in order.
+	Topology *TopologyConfig `json:"topology" yaml:"topology"`
+
+	// SpecConformance fails the verification when received events violate the CloudEvents v1.0 specification,
+	// violations are reported regardless.
+	SpecConformance bool `json:"specConformance" yaml:"specConformance"`
+
+	// MaxListedIDs is the maximum number of missing events listed for each partition with sender.sequentialIds,
+	// missing events are summarized as ranges regardless.
+	//
+	// Defaults to 0, no limit.
+	MaxListedIDs int `json:"maxListedIds" yaml:"maxListedIds"`
+
+	// Soak configures the window of VerificationModeSoak, it is required in soak verification mode.
+	Soak *SoakConfig `json:"soak" yaml:"soak"`
+
+	// Approximate configures the filters of VerificationModeApproximate.
+	Approximate *ApproximateConfig `json:"approximate" yaml:"approximate"`
+
+	// MaxMatchedIDs is the number of most recently matched events remembered in streaming and soak verification
+	// modes, so that their redeliveries are counted as duplicates, redeliveries of older events are counted as
+	// unexpected events.
+	//
+	// Defaults to DefaultMaxMatchedIDs.
+	MaxMatchedIDs int `json:"maxMatchedIds" yaml:"maxMatchedIds"`
+
+	ParsedMaxDeliveryAge time.Duration
+}
+
+// streamingState is the state of the streaming verification mode.
+//
+// Since matched events are pruned, only the most recently matched events are remembered, duplicates received after an
+// event has been forgotten can't be told apart from unexpected events and are counted as unmatched.
+type streamingState struct {
+	// outstanding are events sent and not received yet.
+	outstanding map[string]streamingEntry
+	// unmatched are events received and not sent (yet).
+	unmatched map[string]streamingEntry
+
+	// matched are the most recently matched events, matchedQueue is a ring of their IDs in match order and
+	// matchedNext is the oldest one once the ring is full.
+	matched      map[string]struct{}
+	matchedQueue []string
+	matchedNext  int
+	maxMatched   int
+
+	partitions map[string]*streamingPartition
+	// duplicateCount and orderingViolationCount count the duplicates and the ordering violations of all partitions.
+	duplicateCount         int
+	orderingViolationCount int
+
+	latencies *latencyHistogram
+
+	// sentQueue and receivedQueue are unmatched sent and received events in arrival order, waiting to age out of the
+	// soak window, they are only populated in soak verification mode.
+	sentQueue     []soakEntry
+	receivedQueue []soakEntry
+	// maxRetained is the maximum number of IDs retained by partition for each kind of failure, 0 when unbounded.
+	maxRetained int
+	soak        bool
+
+	// approximate replaces outstanding, unmatched and matched in approximate verification mode.
+	approximate *approximateState
+}
+
+type streamingEntry struct {
+	partitionKey string
+	at           time.Time
+	// received is the number of times an unmatched event has been received.
+	received int
+}
+
+type streamingPartition struct {
+	sent    int
+	matched int
+	// duplicates are the retained duplicate events, duplicateCount counts them all.
+	duplicates     []string
+	duplicateCount int
+
+	// received is the number of unique events received, used as position for ordering violations.
+	received           int
+	lastReceived       string
+	maxSequence        uint64
+	orderingViolations []OrderingViolation
+	// orderingViolationCount counts all the ordering violations, including the ones not retained.
+	orderingViolationCount int
+
+	// lost and unexpected count the events aged out of the soak window, lostEvents and unexpectedEvents are the
+	// retained ones, unexpectedReceived counts their deliveries.
+	lost               int
+	lostEvents         []string
+	unexpected         int
+	unexpectedReceived int
+	unexpectedEvents   []string
+
+	latencies *latencyHistogram
+}
+
+func newStreamingState(soak *SoakConfig, maxMatched int) *streamingState {
+	if maxMatched == 0 {
+		maxMatched = DefaultMaxMatchedIDs
+	}
+	s := &streamingState{
+		outstanding: make(map[string]streamingEntry, 1024),
+		unmatched:   make(map[string]streamingEntry, 1024),
+		matched:     make(map[string]struct{}, 1024),
+		maxMatched:  maxMatched,
+		partitions:  make(map[string]*streamingPartition, 8),
+		latencies:   newLatencyHistogram(),
+	}
+	if soak != nil {
+		s.soak = true
+		s.maxRetained = soak.MaxRetainedEvents
+	}
+	return s
+}
+
+func (s *streamingState) partition(pk string) *streamingPartition {
+	p, ok := s.partitions[pk]
+	if !ok {
+		p = &streamingPartition{latencies: newLatencyHistogram()}
+		s.partitions[pk] = p
+	}
+	return p
+}
+
+// sent records a sent event and returns true if it matched a previously received event.
+func (s *streamingState) sent(e *ce.Event, config *StateManagerConfig) bool {
+	pk := partitionKey(e, config)
+	sentAt, _ := sentTimestamp(e)
+	p := s.partition(pk)
+	p.sent++
+	if s.approximate != nil {
+		return s.approximateSent(e.ID(), p)
+	}
+
+	r, ok := s.unmatched[e.ID()]
+	if !ok {
+		s.outstanding[e.ID()] = streamingEntry{partitionKey: pk, at: sentAt}
+		if s.soak {
+			s.sentQueue = append(s.sentQueue, soakEntry{id: e.ID(), at: time.Now()})
+		}
+		return false
+	}
+
+	delete(s.unmatched, e.ID())
+	s.remember(e.ID())
+	p.matched++
+	for i := 1; i < r.received; i++ {
+		p.duplicates = retain(p.duplicates, e.ID(), s.maxRetained)
+		p.duplicateCount++
+		s.duplicateCount++
+	}
+	s.recordLatency(p, sentAt, r.at)
+	return true
+}
+
+// received records a received event and returns true if it matched a previously sent event.
+func (s *streamingState) received(e *ReceivedEvent, config *StateManagerConfig) bool {
+	id := e.Event.ID()
+	pk := partitionKey(&e.Event, config)
+	p := s.partition(pk)
+	if s.approximate != nil {
+		return s.approximateReceived(e, p, config)
+	}
+
+	if u, ok := s.unmatched[id]; ok {
+		u.received++
+		s.unmatched[id] = u
+		return false
+	}
+	if _, ok := s.matched[id]; ok {
+		// Redeliveries don't move the position of the partition, like in full verification mode.
+		p.duplicates = retain(p.duplicates, id, s.maxRetained)
+		p.duplicateCount++
+		s.duplicateCount++
+		return false
+	}
+
+	p.received++
+	s.checkOrdering(&e.Event, p, config)
+
+	sent, ok := s.outstanding[id]
+	if !ok {
+		s.unmatched[id] = streamingEntry{partitionKey: pk, at: e.ReceivedAt, received: 1}
+		if s.soak {
+			s.receivedQueue = append(s.receivedQueue, soakEntry{id: id, at: e.ReceivedAt})
+		}
+		return false
+	}
+
+	delete(s.outstanding, id)
+	s.remember(id)
+	p.matched++
+	s.recordLatency(p, sent.at, e.ReceivedAt)
+	return true
+}
+
+// checkOrdering records an ordering violation if the given unique event is received out of order in its partition.
+func (s *streamingState) checkOrdering(e *ce.Event, p *streamingPartition, config *StateManagerConfig) {
+	if !config.Ordered {
+		return
+	}
+	if v, ok := e.Extensions()[SequenceExtension]; ok {
+		if seq, err := strconv.ParseUint(fmt.Sprint(v), 10, 64); err == nil {
+			if seq < p.maxSequence {
+				if displacement := int(p.maxSequence - seq); displacement > config.ToleranceWindow {
+					p.orderingViolations = append(p.orderingViolations, OrderingViolation{
+						ID:               e.ID(),
+						ExpectedPosition: int(seq) - 1,
+						ActualPosition:   p.received - 1,
+						Displacement:     displacement,
+						Previous:         p.lastReceived,
+					})
+					if s.maxRetained > 0 && len(p.orderingViolations) > s.maxRetained {
+						p.orderingViolations = append(p.orderingViolations[:0], p.orderingViolations[1:]...)
+					}
+					p.orderingViolationCount++
+					s.orderingViolationCount++
+				}
+			} else {
+				p.maxSequence = seq
+			}
+		}
+	}
+	p.lastReceived = e.ID()
+}
+
+// remember remembers a matched event, forgetting the oldest matched event once maxMatched events are remembered.
+func (s *streamingState) remember(id string) {
+	if len(s.matchedQueue) < s.maxMatched {
+		s.matchedQueue = append(s.matchedQueue, id)
+	} else {
+		delete(s.matched, s.matchedQueue[s.matchedNext])
+		s.matchedQueue[s.matchedNext] = id
+		s.matchedNext = (s.matchedNext + 1) % s.maxMatched
+	}
+	s.matched[id] = struct{}{}
+}
+
+func (s *streamingState) recordLatency(p *streamingPartition, sentAt, receivedAt time.Time) {
+	if sentAt.IsZero() {
+		return
+	}
+	latency := receivedAt.Sub(sentAt)
+	p.latencies.record(latency)
+	s.latencies.record(latency)
+}
+
+func (s *streamingState) report(r *Report) {
+	for pk, p := range s.partitions {
+		r.ReceivedCount += p.matched
+		if len(p.orderingViolations) > 0 {
+			r.OrderingViolationsByPartitionKey[pk] = newOrderingReport(append([]OrderingViolation{}, p.orderingViolations...))
+			r.OrderingViolationCount += p.orderingViolationCount
+		}
+		if p.matched > 0 {
+			r.LatencyByPartitionKey[pk] = p.latencies.stats()
+		}
+		if len(p.duplicates) > 0 {
+			r.DuplicateEventsByPartitionKey[pk] = append([]string{}, p.duplicates...)
+			r.DuplicateCount += p.duplicateCount
+		}
+		if p.lost > 0 {
+			r.LostEventsByPartitionKey[pk] = append(r.LostEventsByPartitionKey[pk], p.lostEvents...)
+			r.LostCount += p.lost
+		}
+		if p.unexpected > 0 {
+			r.UnexpectedEventsByPartitionKey[pk] = append(r.UnexpectedEventsByPartitionKey[pk], p.unexpectedEvents...)
+			r.UnexpectedCount += p.unexpected
+			r.UnmatchedCount += p.unexpectedReceived
+		}
+	}
+	for id, e := range s.outstanding {
+		r.LostEventsByPartitionKey[e.partitionKey] = append(r.LostEventsByPartitionKey[e.partitionKey], id)
+		r.LostCount++
+	}
+	for _, ids := range r.LostEventsByPartitionKey {
+		sort.Strings(ids)
+	}
+	for id, e := range s.unmatched {
+		r.UnmatchedCount += e.received
+		r.UnexpectedEventsByPartitionKey[e.partitionKey] = append(r.UnexpectedEventsByPartitionKey[e.partitionKey], id)
+		r.UnexpectedCount++
+	}
+	for _, ids := range r.UnexpectedEventsByPartitionKey {
+		sort.Strings(ids)
+	}
+	r.Latency = s.latencies.stats()
+	if s.approximate != nil {
+		s.approximateReport(r)
+	}
+}
+
+func (s *streamingState) diff(config *StateManagerConfig) DiffReport {
+	d := DiffReport{Partitions: make(map[string]PartitionDiff, len(s.partitions))}
+
+	update := func(pk string, f func(p *PartitionDiff)) {
+		p := d.Partitions[pk]
+		f(&p)
+		d.Partitions[pk] = p
+	}
+
+	for id, e := range s.outstanding {
+		update(e.partitionKey, func(p *PartitionDiff) { p.Missing = append(p.Missing, id) })
+	}
+	for id, e := range s.unmatched {
+		update(e.partitionKey, func(p *PartitionDiff) { p.Unexpected = append(p.Unexpected, id) })
+	}
+	for pk, sp := range s.partitions {
+		if len(sp.lostEvents) > 0 {
+			update(pk, func(p *PartitionDiff) { p.Missing = append(p.Missing, sp.lostEvents...) })
+		}
+		if len(sp.unexpectedEvents) > 0 {
+			update(pk, func(p *PartitionDiff) { p.Unexpected = append(p.Unexpected, sp.unexpectedEvents...) })
+		}
+		if len(sp.orderingViolations) > 0 {
+			update(pk, func(p *PartitionDiff) { p.OrderingViolations = append([]OrderingViolation{}, sp.orderingViolations...) })
+		}
+		if !config.DeliveryGuarantee.allowsDuplicates() && len(sp.duplicates) > 0 {
+			update(pk, func(p *PartitionDiff) { p.Duplicates = append([]string{}, sp.duplicates...) })
+		}
+	}
+
+	for pk, p := range d.Partitions {
+		sort.Strings(p.Missing)
+		sort.Strings(p.Unexpected)
+		d.Partitions[pk] = p
+	}
+
+	return d
+}
+
+func (s *streamingState) receivedCount() int {
+	count := 0
+	for _, p := range s.partitions {
+		count += p.matched
+	}
+	return count
+}
@@ -0,0 +1,203 @@
+package sacura
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-yaml/yaml"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// SuiteConfig runs multiple named scenarios, for example with different rates, orderings or durations, and produces
+// a combined report with a section per scenario and a single verdict.
+//
+// Each scenario runs the suite config with the fields set by the scenario config, the suite report writers receive
+// the combined report.
+type SuiteConfig struct {
+	// Parallel runs scenarios concurrently, otherwise they run one after the other in order.
+	//
+	// At most one scenario can run the receiver in parallel, since receivers share the metrics server.
+	Parallel  bool             `json:"parallel" yaml:"parallel"`
+	Scenarios []ScenarioConfig `json:"scenarios" yaml:"scenarios"`
+}
+
+type ScenarioConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// Config are the fields of the suite config overridden by the scenario, with the layout of the config file.
+	Config map[string]interface{} `json:"-" yaml:"config"`
+
+	// Parsed is the validated config of the scenario.
+	Parsed *Config `json:"config" yaml:"-"`
+}
+
+func (c *SuiteConfig) validate(config *Config) error {
+	if len(c.Scenarios) == 0 {
+		return invalidErr("suite.scenarios", errors.New("at least one scenario is required"))
+	}
+
+	// Scenarios inherit everything but the suite and the report destinations, which receive the combined report.
+	base := *config
+	base.Suite = nil
+	base.Report.Writers = nil
+	base.Report.Kubernetes = nil
+	b, err := yaml.Marshal(&base)
+	if err != nil {
+		return invalidErr("suite", err)
+	}
+
+	names := sets.NewString()
+	receivers := 0
+	ports := make(map[int]string)
+	for i := range c.Scenarios {
+		s := &c.Scenarios[i]
+		field := fmt.Sprintf("suite.scenarios[%d]", i)
+		if s.Name == "" {
+			return invalidErr(field+".name", errors.New("cannot be empty"))
+		}
+		if names.Has(s.Name) {
+			return invalidErr(field+".name", fmt.Errorf("duplicate scenario %q", s.Name))
+		}
+		names.Insert(s.Name)
+
+		parsed := &Config{}
+		if err := yaml.Unmarshal(b, parsed); err != nil {
+			return invalidErr(field, err)
+		}
+		if len(s.Config) > 0 {
+			overrides, err := yaml.Marshal(s.Config)
+			if err != nil {
+				return invalidErr(field+".config", err)
+			}
+			if err := yaml.UnmarshalStrict(overrides, parsed); err != nil {
+				return invalidErr(field+".config", err)
+			}
+		}
+		if parsed.Suite != nil {
+			return invalidErr(field+".config.suite", errors.New("scenarios cannot be nested"))
+		}
+		if err := parsed.validate(); err != nil {
+			return fmt.Errorf("scenario %q: %w", s.Name, err)
+		}
+		s.Parsed = parsed
+
+		if !c.Parallel {
+			continue
+		}
+		if !parsed.Receiver.Disabled {
+			receivers++
+			if receivers > 1 {
+				return invalidErr(field+".config.receiver.disabled", errors.New("at most one scenario can run the receiver in parallel"))
+			}
+		}
+		for _, p := range scenarioPorts(parsed) {
+			if other, ok := ports[p]; ok {
+				return invalidErr(field+".config", fmt.Errorf("port %d is also used by scenario %q", p, other))
+			}
+			ports[p] = s.Name
+		}
+	}
+
+	for i, w := range config.Report.Writers {
+		if _, err := newReportWriter(w); err != nil {
+			return invalidErr(fmt.Sprintf("report.writers[%d]", i), err)
+		}
+	}
+	if config.Report.Kubernetes != nil {
+		if err := config.Report.Kubernetes.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scenarioPorts returns the ports a scenario listens on.
+func scenarioPorts(config *Config) []int {
+	var ports []int
+	if !config.Receiver.Disabled {
+		ports = append(ports, config.Receiver.Port)
+	}
+	if config.Admin != nil {
+		ports = append(ports, config.Admin.Port)
+	}
+	if config.Diagnostics != nil {
+		ports = append(ports, config.Diagnostics.Port)
+	}
+	return ports
+}
+
+// ScenarioReport is the section of a scenario in the combined report of a suite.
+type ScenarioReport struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+	// Skipped is true when the suite has been aborted before the scenario started.
+	Skipped bool   `json:"skipped,omitempty"`
+	Report  Report `json:"report"`
+}
+
+// runSuite runs the scenarios of the given suite config and verifies the combined report, the returned error lists
+// the failed scenarios.
+func runSuite(ctx context.Context, config Config) (Report, error) {
+	scenarios := config.Suite.Scenarios
+	reports := make([]ScenarioReport, len(scenarios))
+	run := func(i int) {
+		s := scenarios[i]
+		reports[i].Name = s.Name
+		if ctx.Err() != nil {
+			reports[i].Skipped = true
+			return
+		}
+		logger(logComponentRun).Infow("Starting scenario", "scenario", s.Name)
+		report, err := Run(ctx, *s.Parsed)
+		reports[i].Report = report
+		reports[i].Passed = err == nil
+		if err != nil {
+			reports[i].Error = err.Error()
+		}
+		logger(logComponentRun).Infow("Scenario done", "scenario", s.Name, "passed", err == nil)
+	}
+
+	if config.Suite.Parallel {
+		var wg sync.WaitGroup
+		for i := range scenarios {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				run(i)
+			}(i)
+		}
+		wg.Wait()
+	} else {
+		for i := range scenarios {
+			run(i)
+		}
+	}
+	// Scenarios configure logging in turn, restore the suite one.
+	_ = configureLogging(config.Logging)
+
+	report := Report{Scenarios: reports}
+	var failed []string
+	for _, r := range reports {
+		report.Aborted = report.Aborted || r.Skipped || r.Report.Aborted
+		if !r.Passed {
+			failed = append(failed, r.Name)
+		}
+	}
+	var verificationErr error
+	if len(failed) > 0 {
+		verificationErr = fmt.Errorf("%d of %d scenarios failed: %s", len(failed), len(reports), strings.Join(failed, ", "))
+	}
+	logger(LogComponentReport).Infow("Suite done", "passed", verificationErr == nil, "failed", failed)
+
+	if err := writeReports(config.Report, report, verificationErr); err != nil {
+		if verificationErr != nil {
+			logger(LogComponentReport).Errorw("Failed to write reports", "error", err)
+			return report, verificationErr
+		}
+		return report, err
+	}
+	return report, verificationErr
+}
@@ -0,0 +1,299 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+const suiteTestConfig = `
+sender:
+  target: http://localhost:8080
+  frequency: 10
+  workers: 1
+receiver:
+  port: 8080
+  timeout: 1m
+duration: 1m
+report:
+  writers:
+  - format: json
+    path: /tmp/report.json
+`
+
+func TestSuiteConfig(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		suite   string
+		check   func(t *testing.T, c Config)
+		wantErr bool
+	}{
+		{
+			name: "scenarios override the suite config",
+			suite: `
+suite:
+  scenarios:
+  - name: slow
+    config:
+      sender:
+        frequency: 5
+  - name: ordered
+    config:
+      duration: 2m
+      ordered:
+        numPartitionKeys: 4
+`,
+			check: func(t *testing.T, c Config) {
+				slow, ordered := c.Suite.Scenarios[0].Parsed, c.Suite.Scenarios[1].Parsed
+				if slow.Sender.FrequencyPerSecond != 5 || slow.Sender.Target != "http://localhost:8080" || slow.ParsedDuration != time.Minute || slow.Ordered != nil {
+					t.Errorf("unexpected slow scenario config %+v", slow)
+				}
+				if ordered.Sender.FrequencyPerSecond != 10 || ordered.ParsedDuration != 2*time.Minute || ordered.Ordered == nil || ordered.Ordered.PartitionKeyExtension != DefaultPartitionKeyExtension {
+					t.Errorf("unexpected ordered scenario config %+v", ordered)
+				}
+				if len(slow.Report.Writers) != 0 || len(c.Report.Writers) != 1 {
+					t.Errorf("expected only the suite to write reports, got %v and %v", slow.Report.Writers, c.Report.Writers)
+				}
+			},
+		},
+		{
+			name: "parallel scenarios with a single receiver",
+			suite: `
+suite:
+  parallel: true
+  scenarios:
+  - name: receiver
+    config:
+      sender:
+        disabled: true
+  - name: sender
+    config:
+      receiver:
+        disabled: true
+`,
+		},
+		{
+			name:    "no scenarios",
+			suite:   "suite: {}",
+			wantErr: true,
+		},
+		{
+			name: "missing name",
+			suite: `
+suite:
+  scenarios:
+  - config:
+      duration: 2m
+`,
+			wantErr: true,
+		},
+		{
+			name: "duplicate name",
+			suite: `
+suite:
+  scenarios:
+  - name: a
+  - name: a
+`,
+			wantErr: true,
+		},
+		{
+			name: "unknown field",
+			suite: `
+suite:
+  scenarios:
+  - name: a
+    config:
+      sender:
+        rate: 5
+`,
+			wantErr: true,
+		},
+		{
+			name: "invalid scenario",
+			suite: `
+suite:
+  scenarios:
+  - name: a
+    config:
+      sender:
+        frequency: 0
+`,
+			wantErr: true,
+		},
+		{
+			name: "nested suite",
+			suite: `
+suite:
+  scenarios:
+  - name: a
+    config:
+      suite:
+        scenarios:
+        - name: b
+`,
+			wantErr: true,
+		},
+		{
+			name: "parallel receivers",
+			suite: `
+suite:
+  parallel: true
+  scenarios:
+  - name: a
+  - name: b
+    config:
+      receiver:
+        port: 8081
+`,
+			wantErr: true,
+		},
+		{
+			name: "parallel port conflict",
+			suite: `
+suite:
+  parallel: true
+  scenarios:
+  - name: a
+    config:
+      sender:
+        disabled: true
+  - name: b
+    config:
+      receiver:
+        disabled: true
+      admin:
+        port: 8080
+`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FileConfig(strings.NewReader(suiteTestConfig + tt.suite))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expected error %v, got %v", tt.wantErr, err)
+			}
+			if tt.check != nil {
+				tt.check(t, got)
+			}
+		})
+	}
+}
+
+func TestRunSuite(t *testing.T) {
+
+	requests := atomic.NewInt64(0)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Inc()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer s.Close()
+
+	config, err := FileConfig(strings.NewReader(`
+sender:
+  target: ` + s.URL + `
+  frequency: 10
+  workers: 1
+  startDelay: 0s
+receiver:
+  disabled: true
+  timeout: 1m
+duration: 1s
+suite:
+  parallel: true
+  scenarios:
+  - name: a
+  - name: b
+    config:
+      sender:
+        frequency: 20
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := Run(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Scenarios) != 2 || report.Scenarios[0].Name != "a" || report.Scenarios[1].Name != "b" {
+		t.Fatalf("expected a report per scenario, got %+v", report.Scenarios)
+	}
+	for _, r := range report.Scenarios {
+		if !r.Passed || r.Report.Metrics.AcceptedCount == 0 {
+			t.Errorf("expected scenario %s to send events and pass, got %+v", r.Name, r)
+		}
+	}
+	if got := report.Scenarios[0].Report.Metrics.AcceptedCount + report.Scenarios[1].Report.Metrics.AcceptedCount; int64(got) != requests.Load() {
+		t.Errorf("expected %d accepted events, got %d", requests.Load(), got)
+	}
+}
+
+func TestRunSuiteAborted(t *testing.T) {
+
+	config, err := FileConfig(strings.NewReader(suiteTestConfig + `
+suite:
+  scenarios:
+  - name: a
+  - name: b
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Report.Writers = nil
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err := Run(ctx, config)
+	if err == nil || !strings.Contains(err.Error(), "a, b") {
+		t.Errorf("expected both scenarios to fail, got %v", err)
+	}
+	if !report.Aborted {
+		t.Error("expected report to be marked as aborted")
+	}
+	for _, r := range report.Scenarios {
+		if !r.Skipped || r.Passed {
+			t.Errorf("expected scenario %s to be skipped, got %+v", r.Name, r)
+		}
+	}
+}
+
+func TestWriteSuiteReports(t *testing.T) {
+
+	report := Report{Scenarios: []ScenarioReport{
+		{Name: "slow", Passed: true, Report: Report{ReceivedCount: 10}},
+		{Name: "fast", Error: "1 lost events", Report: Report{LostCount: 1}},
+	}}
+
+	buf := &bytes.Buffer{}
+	if err := writeJUnitReport(buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	junit := buf.String()
+	for _, want := range []string{`tests="2"`, `failures="1"`, `<testcase name="slow"`, `<testcase name="fast"`, "1 lost events"} {
+		if !strings.Contains(junit, want) {
+			t.Errorf("expected JUnit report to contain %q, got %s", want, junit)
+		}
+	}
+
+	buf.Reset()
+	if err := writeHTMLReport(buf, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{"<h2>Scenarios</h2>", "<td>slow</td>", "<td>fast</td>", "1 lost events"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("expected HTML report to contain %q", want)
+		}
+	}
+}
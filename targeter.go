@@ -1,9 +1,11 @@
 package sacura
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
-	"math/rand"
 	"net/http"
+	"sync"
 	"time"
 
 	ce "github.com/cloudevents/sdk-go/v2"
@@ -12,41 +14,250 @@ import (
 	cetest "github.com/cloudevents/sdk-go/v2/test"
 	"github.com/google/uuid"
 	vegeta "github.com/tsenart/vegeta/v12/lib"
+	"go.uber.org/atomic"
 )
 
-const CloudEventIdHeader = "Cloudevent-Id"
+const (
+	CloudEventIdHeader = "Cloudevent-Id"
+
+	// SequenceExtension is the extension carrying the per-partition sequence number of events sent in ordered mode,
+	// sequence numbers start at 1.
+	SequenceExtension = "sequence"
+)
 
 func NewTargeterGenerator(config Config, newUIID func() uuid.UUID, out chan<- ce.Event) vegeta.Targeter {
+	var nextPartitionKey func() string
+	if config.Ordered != nil {
+		nextPartitionKey = newPartitionKeyGenerator(config.Ordered, newRand(config.Seed, "partitionKeys"))
+	}
+	return newTargeterGenerator(config, newUIID, nextPartitionKey, out)
+}
 
-	return func(target *vegeta.Target) error {
+// newTargeterGenerator returns a targeter generating events with the partition keys returned by nextPartitionKey in
+// ordered mode.
+func newTargeterGenerator(config Config, newUIID func() uuid.UUID, nextPartitionKey func() string, out chan<- ce.Event) vegeta.Targeter {
+
+	var sequencesLock sync.Mutex
+	sequences := make(map[string]uint64)
 
-		id := newUIID().String()
+	nextSequence := func(pk string) uint64 {
+		sequencesLock.Lock()
+		defer sequencesLock.Unlock()
+
+		sequences[pk]++
+		return sequences[pk]
+	}
+
+	var payload *payloadGenerator
+	var payloadErr error
+	if config.Sender.Payload != nil {
+		payload, payloadErr = newPayloadGenerator(config.Sender.Payload, newRand(config.Seed, "payload"))
+	}
+	var serialization *serializer
+	if config.Serialization != nil && payloadErr == nil {
+		serialization, payloadErr = newSerializer(config.Serialization, newRand(config.Seed, "serialization"))
+	}
+	var attributes *attributesGenerator
+	var attributesErr error
+	if config.Sender.Attributes != nil {
+		attributes, attributesErr = config.Sender.Attributes.generator()
+	}
+	index := atomic.NewUint64(0)
+	ids, idsErr := newIDGenerator(config.Sender.IDs, config.Sender.SequentialIDs, newUIID)
+
+	start := time.Now()
+
+	var loadPhases []loadPhase
+	if config.Sender.LoadProfile != nil {
+		loadPhases = config.Sender.LoadProfile.phases(config.ParsedDuration)
+	}
+
+	var tokens tokenSource
+	if config.Sender.Auth != nil {
+		tokens = newTokenSource(config.Sender.Auth)
+	}
+	var identities *identityRotation
+	if config.Sender.IdentityRotation != nil {
+		identities = newIdentityRotation(config.Sender.IdentityRotation, start)
+	}
+
+	var replay *replaySource
+	if config.Sender.Replay != nil {
+		replay = newReplaySource(config.Sender.Replay)
+	}
+
+	var nextTarget func() string
+	if config.Sender.Targets != nil {
+		nextTarget = newTargetPicker(config.Sender.Targets, newRand(config.Seed, "targets"))
+	}
+
+	applyVariant := newVariantGenerator(config.Sender.Variants)
+	overrides := newOverridesGenerator(config.Sender.Overrides, config.Seed)
+	markExpectedLoss := newExpectedLossGenerator(config.Sender.ExpectedLoss, config.Seed)
+	setTTL := newTTLGenerator(config.Sender.TTL, config.Seed)
+	scheduleDelivery := newDelayedDeliveryGenerator(config.Sender.DelayedDelivery, config.Seed)
+
+	newEvent := func() (ce.Event, error) {
+		if replay != nil {
+			return replay.nextEvent(time.Now())
+		}
+
+		now := time.Now()
+
+		var pk string
+		if config.Ordered != nil {
+			pk = nextPartitionKey()
+		}
+		var seq uint64
+		if config.Ordered != nil || ids.sequential() {
+			seq = nextSequence(pk)
+		}
+		i := index.Inc() - 1
+		id, err := ids.nextID(IDTemplateData{Index: i, Sequence: seq, PartitionKey: pk, Timestamp: now})
+		if err != nil {
+			return ce.Event{}, err
+		}
+		data := PayloadTemplateData{Index: i, ID: id, PartitionKey: pk, Timestamp: now}
 
 		event := cetest.FullEvent()
 		event.SetID(id)
-		event.SetExtension(BenchmarkTimestampAttribute, fmt.Sprint(time.Now().UnixMilli()))
+		if attributes != nil {
+			if err := attributes.setAttributes(&event, data); err != nil {
+				return event, err
+			}
+		}
+		applyVariant(&event)
+		overrides.apply(&event)
+		markExpectedLoss(&event)
+		setTTL(&event, now)
+		setSentTimestamp(&event, now)
+		scheduleDelivery(&event, now)
+		if now.Sub(start) < config.Sender.ParsedWarmup {
+			event.SetExtension(WarmupExtension, "true")
+		}
+		if len(loadPhases) > 0 {
+			event.SetExtension(LoadPhaseExtension, loadPhases[loadPhaseIndex(loadPhases, now.Sub(start))].name)
+		}
 
 		if config.Ordered != nil {
-			event.SetExtension("partitionkey", fmt.Sprint(rand.Int()%int(config.Ordered.NumPartitionKeys)))
+			setEventPartitionKey(&event, config.Ordered.partitionKeyAttribute(), pk)
+			event.SetExtension(SequenceExtension, fmt.Sprint(seq))
+		}
+
+		if payload != nil {
+			if err := payload.setData(&event, data); err != nil {
+				return event, err
+			}
+		} else if serialization != nil {
+			// The data is generated from the schema.
+			event.DataEncoded = nil
+		}
+		if serialization != nil {
+			if err := serialization.setData(&event); err != nil {
+				return event, err
+			}
+		}
+
+		if _, ok := event.Extensions()[ChecksumExtension]; config.Verification.Integrity && !ok {
+			setChecksum(&event)
+		}
+		return event, nil
+	}
+
+	batchSize := config.Sender.BatchSize
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+
+	return func(target *vegeta.Target) error {
+		if payloadErr != nil {
+			return payloadErr
+		}
+		if attributesErr != nil {
+			return attributesErr
+		}
+		if idsErr != nil {
+			return idsErr
+		}
+
+		url := config.Sender.Target
+		if nextTarget != nil {
+			url = nextTarget()
+		}
+
+		tokens := tokens
+		var identity string
+		if identities != nil {
+			identity, tokens = identities.identity(time.Now())
 		}
 
 		hdr := http.Header{}
-		hdr.Set(cehttp.ContentType, ceformat.JSON.MediaType())
-		hdr.Set(CloudEventIdHeader, id)
+		events := make([]ce.Event, 0, batchSize)
+		for i := 0; i < batchSize; i++ {
+			event, err := newEvent()
+			if errors.Is(err, errReplayed) && len(events) > 0 {
+				// The last recorded batch may be incomplete.
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if nextTarget != nil {
+				event.SetExtension(TargetExtension, url)
+			}
+			if identity != "" {
+				event.SetExtension(IdentityExtension, identity)
+			}
+			config.setRunID(&event)
+			events = append(events, event)
+			hdr.Add(CloudEventIdHeader, event.ID())
+			overrides.setHeaders(hdr, &event)
+		}
+		config.Sender.DelayedDelivery.setHeader(hdr, &events[0])
+		config.Sender.IdempotencyKey.setHeader(hdr, &events[0])
+		if config.Tracing != nil {
+			injectTraceParent(hdr)
+		}
+		if tokens != nil {
+			token, err := tokens.token()
+			if err != nil {
+				return err
+			}
+			hdr.Set("Authorization", "Bearer "+token)
+		}
 
-		body, err := ceformat.JSON.Marshal(&event)
+		var body []byte
+		var err error
+		if config.Sender.Payload != nil && len(config.Sender.Payload.SizeClasses) > 0 {
+			body, err = streamedRequestBody(hdr, &events[0])
+		} else if batchSize == 1 && config.Sender.ContentMode != nil && config.Sender.ContentMode.modeOf(events[0].ID()) == ContentModeBinary {
+			body, err = binaryRequestBody(hdr, &events[0])
+		} else if batchSize == 1 {
+			hdr.Set(cehttp.ContentType, ceformat.JSON.MediaType())
+			body, err = ceformat.JSON.Marshal(&events[0])
+		} else {
+			hdr.Set(cehttp.ContentType, ce.ApplicationCloudEventsBatchJSON)
+			body, err = json.Marshal(events)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to marshal event %v: %w", event, err)
+			return fmt.Errorf("failed to marshal events %v: %w", events, err)
+		}
+		if config.Sender.Compression != nil {
+			if body, err = config.Sender.Compression.compress(hdr, body); err != nil {
+				return fmt.Errorf("failed to compress events %v: %w", events, err)
+			}
 		}
 
 		*target = vegeta.Target{
 			Method: "POST",
-			URL:    config.Sender.Target,
+			URL:    url,
 			Body:   body,
 			Header: hdr,
 		}
 
-		out <- event
+		for _, event := range events {
+			out <- event
+		}
 
 		return nil
 	}
@@ -1,6 +1,8 @@
 package sacura
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"testing"
 
@@ -57,3 +59,126 @@ func TestNewTargeterGenerator(t *testing.T) {
 		})
 	}
 }
+
+func TestNewTargeterGeneratorSequence(t *testing.T) {
+
+	n := 10
+	out := make(chan ce.Event, n)
+	config := Config{
+		Sender:  SenderConfig{Target: "http://localhost:9090"},
+		Ordered: &OrderedConfig{NumPartitionKeys: 1},
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	for i := 0; i < n; i++ {
+		if err := f(&vegeta.Target{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(out)
+
+	want := 1
+	for e := range out {
+		if got := e.Extensions()[SequenceExtension]; got != fmt.Sprint(want) {
+			t.Errorf("expected sequence %d, got %v", want, got)
+		}
+		if got := e.Extensions()[DefaultPartitionKeyExtension]; got != "0" {
+			t.Errorf("expected partition key 0, got %v", got)
+		}
+		want++
+	}
+}
+
+func TestNewTargeterGeneratorPayloadTemplate(t *testing.T) {
+
+	out := make(chan ce.Event, 2)
+	config := Config{
+		Sender: SenderConfig{
+			Target:  "http://localhost:9090",
+			Payload: &PayloadConfig{Template: `{"index":{{.Index}},"pk":"{{.PartitionKey}}"}`},
+		},
+		Ordered: &OrderedConfig{NumPartitionKeys: 1},
+	}
+	if err := config.Sender.Payload.validate(); err != nil {
+		t.Fatal(err)
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	for i := 0; i < 2; i++ {
+		target := &vegeta.Target{}
+		if err := f(target); err != nil {
+			t.Fatal(err)
+		}
+		e := <-out
+		if want := fmt.Sprintf(`{"index":%d,"pk":"0"}`, i); string(e.Data()) != want {
+			t.Errorf("expected data %s, got %s", want, string(e.Data()))
+		}
+	}
+}
+
+func TestNewTargeterGeneratorTraceParent(t *testing.T) {
+
+	out := make(chan ce.Event, 2)
+	config := Config{
+		Sender:  SenderConfig{Target: "http://localhost:9090"},
+		Tracing: &TracingConfig{Endpoint: "http://localhost:4318/v1/traces"},
+	}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	traceIDs := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		target := vegeta.Target{}
+		if err := f(&target); err != nil {
+			t.Fatal(err)
+		}
+		sc := extractTraceParent(target.Header)
+		if !sc.IsValid() || !sc.IsSampled() {
+			t.Fatalf("expected valid sampled traceparent, got %q", target.Header.Get("traceparent"))
+		}
+		traceIDs[sc.TraceID().String()] = true
+	}
+	if len(traceIDs) != 2 {
+		t.Errorf("expected a new trace for each event, got %v", traceIDs)
+	}
+}
+
+func TestNewTargeterGeneratorBatch(t *testing.T) {
+
+	n := 3
+	out := make(chan ce.Event, n)
+	config := Config{Sender: SenderConfig{Target: "http://localhost:9090", BatchSize: n}}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	target := vegeta.Target{}
+	if err := f(&target); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+
+	if got := target.Header.Get(cehttp.ContentType); got != ce.ApplicationCloudEventsBatchJSON {
+		t.Errorf("expected content type %s, got %s", ce.ApplicationCloudEventsBatchJSON, got)
+	}
+	var batch []ce.Event
+	if err := json.Unmarshal(target.Body, &batch); err != nil {
+		t.Fatal(err)
+	}
+
+	ids := target.Header.Values(CloudEventIdHeader)
+	var sent []string
+	for e := range out {
+		sent = append(sent, e.ID())
+	}
+	var got []string
+	for _, e := range batch {
+		got = append(got, e.ID())
+	}
+	if len(sent) != n {
+		t.Fatalf("expected %d sent events, got %v", n, sent)
+	}
+	if diff := cmp.Diff(sent, got); diff != "" {
+		t.Error("batch (-want, +got)", diff)
+	}
+	if diff := cmp.Diff(sent, ids); diff != "" {
+		t.Error("headers (-want, +got)", diff)
+	}
+}
@@ -0,0 +1,405 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// TargetExtension is the extension carrying the target URL events have been sent to with sender.targets.
+const TargetExtension = "sacuratarget"
+
+// TargetsStrategy is the strategy distributing events across sender.targets.
+type TargetsStrategy string
+
+const (
+	// TargetsStrategyFailover sends events to the first healthy target, in order.
+	TargetsStrategyFailover TargetsStrategy = "failover"
+	// TargetsStrategyWeighted sends events to random targets proportionally to their weight.
+	TargetsStrategyWeighted TargetsStrategy = "weighted"
+)
+
+const (
+	// DefaultTargetsFailureThreshold is the default number of consecutive failed requests after which the sender
+	// fails over to the next target.
+	DefaultTargetsFailureThreshold = 3
+	// DefaultTargetsFailback is the default time after which the sender fails back to the first target.
+	DefaultTargetsFailback = 30 * time.Second
+)
+
+// TargetsConfig sends events to multiple targets, for example the ingresses of a highly available broker, each
+// event carries the URL of its target in the TargetExtension and the report breaks down the events by target.
+//
+// Requests are retried on the same target, the failover strategy moves subsequent requests to the next target.
+type TargetsConfig struct {
+	// URLs are the targets, in failover order.
+	URLs []string `json:"urls" yaml:"urls"`
+	// Strategy distributes events across targets.
+	//
+	// Defaults to TargetsStrategyFailover.
+	Strategy TargetsStrategy `json:"strategy" yaml:"strategy"`
+	// Weights are the weights of URLs with the weighted strategy, in the same order.
+	//
+	// Defaults to the same weight for all targets.
+	Weights []int `json:"weights" yaml:"weights"`
+	// FailureThreshold is the number of consecutive requests failing with a transport error or a 5xx status code
+	// after which the failover strategy moves to the next target.
+	//
+	// Defaults to DefaultTargetsFailureThreshold.
+	FailureThreshold int `json:"failureThreshold" yaml:"failureThreshold"`
+	// Failback is the time after which the failover strategy tries the first target again, for example 30s.
+	//
+	// Defaults to DefaultTargetsFailback.
+	Failback string `json:"failback" yaml:"failback"`
+
+	ParsedFailback time.Duration
+	// Health tracks the target of the failover strategy.
+	Health *targetHealth `json:"-" yaml:"-"`
+}
+
+func (c *TargetsConfig) validate(sender *SenderConfig) error {
+	if sender.Target != "" {
+		return invalidErr("sender.targets", errors.New("cannot be used with sender.target"))
+	}
+	if sender.Protocol != "" && sender.Protocol != ProtocolHTTP {
+		return invalidErr("sender.targets", fmt.Errorf("is only supported with the %s protocol", ProtocolHTTP))
+	}
+	if len(c.URLs) < 2 {
+		return invalidErr("sender.targets.urls", errors.New("at least 2 targets must be specified"))
+	}
+	var scheme string
+	seen := make(map[string]bool, len(c.URLs))
+	for i, target := range c.URLs {
+		field := fmt.Sprintf("sender.targets.urls[%d]", i)
+		u, err := url.Parse(target)
+		if err != nil {
+			return invalidErr(field, err)
+		}
+		if !u.IsAbs() {
+			return invalidErr(field, errors.New("target must be an absolute URL"))
+		}
+		if i == 0 {
+			scheme = u.Scheme
+		} else if u.Scheme != scheme {
+			return invalidErr(field, fmt.Errorf("scheme %q differs from the %q scheme of the first target", u.Scheme, scheme))
+		}
+		if seen[target] {
+			return invalidErr(field, fmt.Errorf("%q is a duplicate target", target))
+		}
+		seen[target] = true
+	}
+
+	switch c.Strategy {
+	case "":
+		c.Strategy = TargetsStrategyFailover
+	case TargetsStrategyFailover, TargetsStrategyWeighted:
+	default:
+		return invalidErr("sender.targets.strategy", fmt.Errorf("unknown strategy %q, expected %s or %s", c.Strategy, TargetsStrategyFailover, TargetsStrategyWeighted))
+	}
+	if len(c.Weights) > 0 {
+		if c.Strategy != TargetsStrategyWeighted {
+			return invalidErr("sender.targets.weights", fmt.Errorf("is only supported with the %s strategy", TargetsStrategyWeighted))
+		}
+		if len(c.Weights) != len(c.URLs) {
+			return invalidErr("sender.targets.weights", fmt.Errorf("%d weights for %d targets", len(c.Weights), len(c.URLs)))
+		}
+		total := 0
+		for i, w := range c.Weights {
+			if w < 0 {
+				return invalidErr(fmt.Sprintf("sender.targets.weights[%d]", i), fmt.Errorf("%d cannot be negative", w))
+			}
+			total += w
+		}
+		if total == 0 {
+			return invalidErr("sender.targets.weights", errors.New("at least one weight must be positive"))
+		}
+	}
+
+	if c.FailureThreshold < 0 {
+		return invalidErr("sender.targets.failureThreshold", fmt.Errorf("%d cannot be negative", c.FailureThreshold))
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = DefaultTargetsFailureThreshold
+	}
+	c.ParsedFailback = DefaultTargetsFailback
+	if c.Failback != "" {
+		var err error
+		c.ParsedFailback, err = time.ParseDuration(c.Failback)
+		if err != nil {
+			return invalidErr("sender.targets.failback", err)
+		}
+		if c.ParsedFailback <= 0 {
+			return invalidErr("sender.targets.failback", fmt.Errorf("%v must be positive", c.ParsedFailback))
+		}
+	}
+	c.Health = newTargetHealth(c)
+	return nil
+}
+
+// newTargetPicker returns a function returning the target of the next request.
+func newTargetPicker(config *TargetsConfig, r *rand.Rand) func() string {
+	if config.Strategy == TargetsStrategyFailover {
+		return func() string { return config.Health.target(time.Now()) }
+	}
+
+	weights := config.Weights
+	if len(weights) == 0 {
+		weights = make([]int, len(config.URLs))
+		for i := range weights {
+			weights[i] = 1
+		}
+	}
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	return func() string {
+		n := r.Intn(total)
+		for i, w := range weights {
+			if n < w {
+				return config.URLs[i]
+			}
+			n -= w
+		}
+		return config.URLs[len(config.URLs)-1]
+	}
+}
+
+// targetHealth tracks the consecutive failures of the target of the failover strategy.
+type targetHealth struct {
+	config *TargetsConfig
+
+	lock         sync.Mutex
+	active       int
+	failures     int
+	failedOverAt time.Time
+	failovers    int
+}
+
+func newTargetHealth(config *TargetsConfig) *targetHealth {
+	return &targetHealth{config: config}
+}
+
+// target returns the target of requests sent at the given time.
+func (h *targetHealth) target(now time.Time) string {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.active != 0 && now.Sub(h.failedOverAt) >= h.config.ParsedFailback {
+		logger(LogComponentSender).Infow("Failing back to the first target", "target", h.config.URLs[0])
+		h.active = 0
+		h.failures = 0
+	}
+	return h.config.URLs[h.active]
+}
+
+// observe records the outcome of a request sent to the given target at the given time.
+func (h *targetHealth) observe(target string, failed bool, now time.Time) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if target != h.config.URLs[h.active] {
+		// In-flight requests to a previous target.
+		return
+	}
+	if !failed {
+		h.failures = 0
+		return
+	}
+	h.failures++
+	if h.failures < h.config.FailureThreshold {
+		return
+	}
+	next := (h.active + 1) % len(h.config.URLs)
+	logger(LogComponentSender).Warnw("Failing over to the next target", "target", h.config.URLs[h.active], "next", h.config.URLs[next], "failures", h.failures)
+	h.active = next
+	h.failures = 0
+	h.failedOverAt = now
+	h.failovers++
+}
+
+func (h *targetHealth) metrics(m *Metrics) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	m.TargetFailoverCount = h.failovers
+}
+
+// targetHealthTransport is an http.RoundTripper observing the outcome of requests for the failover strategy.
+type targetHealthTransport struct {
+	health *targetHealth
+	next   http.RoundTripper
+}
+
+func newTargetHealthTransport(health *targetHealth, next http.RoundTripper) *targetHealthTransport {
+	return &targetHealthTransport{health: health, next: next}
+}
+
+// targetSendMetrics accumulates the metrics of the requests sent to each target.
+type targetSendMetrics struct {
+	protocol Protocol
+	targets  map[string]metricsRecorder
+}
+
+// newTargetSendMetrics returns the metrics of the requests of each target, it returns nil without sender.targets.
+func newTargetSendMetrics(config *Config) *targetSendMetrics {
+	if config.Sender.Targets == nil {
+		return nil
+	}
+	m := &targetSendMetrics{protocol: config.Sender.Protocol, targets: make(map[string]metricsRecorder, len(config.Sender.Targets.URLs))}
+	for _, target := range config.Sender.Targets.URLs {
+		m.targets[target] = newSendMetrics(m.protocol)
+	}
+	return m
+}
+
+// record records the result of a request to the metrics of the given target.
+func (m *targetSendMetrics) record(target string, res sendResult) {
+	if m == nil {
+		return
+	}
+	tm, found := m.targets[target]
+	if !found {
+		tm = newSendMetrics(m.protocol)
+		m.targets[target] = tm
+	}
+	tm.record(res)
+}
+
+func (m *targetSendMetrics) metrics(out *Metrics) {
+	if m == nil {
+		return
+	}
+	out.TargetMetrics = make(map[string]SendMetrics, len(m.targets))
+	for target, tm := range m.targets {
+		out.TargetMetrics[target] = tm.close()
+	}
+}
+
+func (t *targetHealthTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target := req.URL.String()
+	resp, err := t.next.RoundTrip(req)
+	if req.Context().Err() == nil {
+		t.health.observe(target, err != nil || resp.StatusCode >= http.StatusInternalServerError, time.Now())
+	}
+	return resp, err
+}
+
+// TargetReport reports the events sent to a target.
+type TargetReport struct {
+	SentCount     int `json:"sentCount"`
+	ReceivedCount int `json:"receivedCount"`
+	// LostCount is the number of events sent to the target and never received, excluding events the sender failed
+	// to send and dead-lettered events.
+	LostCount int `json:"lostCount"`
+	// Latency is the end-to-end latency of the events sent to the target.
+	Latency LatencyStats `json:"latency"`
+	// Send are the metrics of the requests sent to the target, like their latency and status codes.
+	Send *SendMetrics `json:"send,omitempty"`
+}
+
+// targetState tracks the events sent to a target.
+type targetState struct {
+	sent     int
+	received int
+	latency  *latencyHistogram
+}
+
+// targetsState tracks the events sent to each target.
+type targetsState struct {
+	targets map[string]*targetState
+	// pending are the targets of sent events not received yet by ID.
+	pending map[string]string
+}
+
+// newTargetsState returns the state of the given targets, it returns nil without sender.targets.
+func newTargetsState(config *TargetsConfig) *targetsState {
+	if config == nil {
+		return nil
+	}
+	targets := make(map[string]*targetState, len(config.URLs))
+	for _, target := range config.URLs {
+		targets[target] = &targetState{latency: newLatencyHistogram()}
+	}
+	return &targetsState{targets: targets, pending: make(map[string]string)}
+}
+
+// recordSentTarget records the target of the given sent event, it must be called while holding the lock.
+func (s *StateManager) recordSentTarget(e *ce.Event) {
+	if s.targets == nil {
+		return
+	}
+	v, ok := e.Extensions()[TargetExtension]
+	if !ok {
+		return
+	}
+	target := fmt.Sprint(v)
+	ts, ok := s.targets.targets[target]
+	if !ok {
+		return
+	}
+	ts.sent++
+	if receivedAt, ok := s.receivedAt[e.ID()]; ok {
+		// Received before being recorded as sent.
+		ts.received++
+		if sentAt, ok := sentTimestamp(e); ok {
+			ts.latency.record(receivedAt.Sub(sentAt))
+		}
+		return
+	}
+	s.targets.pending[e.ID()] = target
+}
+
+// recordReceivedTarget records the delivery of the given event to the receiver, it must be called while holding the
+// lock. Only the first delivery is recorded, according to the target recorded by the sender since brokers can drop
+// extensions.
+func (s *StateManager) recordReceivedTarget(e *ReceivedEvent) {
+	if s.targets == nil {
+		return
+	}
+	target, ok := s.targets.pending[e.Event.ID()]
+	if !ok {
+		return
+	}
+	delete(s.targets.pending, e.Event.ID())
+	if e.DeadLettered {
+		return
+	}
+	ts := s.targets.targets[target]
+	ts.received++
+	if sentAt, ok := sentTimestamp(&e.Event); ok && !e.ReceivedAt.IsZero() {
+		ts.latency.record(e.ReceivedAt.Sub(sentAt))
+	}
+}
+
+// targetsReport sets the targets section of the report, it must be called while holding the lock.
+func (s *StateManager) targetsReport(r *Report) {
+	if s.targets == nil {
+		return
+	}
+	lost := make(map[string]int, len(s.targets.targets))
+	for id, target := range s.targets.pending {
+		if _, ok := s.failedSends[id]; !ok {
+			lost[target]++
+		}
+	}
+	r.Targets = make(map[string]TargetReport, len(s.targets.targets))
+	for target, ts := range s.targets.targets {
+		tr := TargetReport{
+			SentCount:     ts.sent,
+			ReceivedCount: ts.received,
+			LostCount:     lost[target],
+			Latency:       ts.latency.stats(),
+		}
+		if m, ok := s.metrics.TargetMetrics[target]; ok {
+			tr.Send = &m
+		}
+		r.Targets[target] = tr
+	}
+}
@@ -0,0 +1,271 @@
+package sacura
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestTargetsConfigValidate(t *testing.T) {
+	urls := []string{"http://a.example.com", "http://b.example.com"}
+	tests := []struct {
+		name    string
+		config  TargetsConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "failover", config: TargetsConfig{URLs: urls, Failback: "10s"}},
+		{name: "weighted", config: TargetsConfig{URLs: urls, Strategy: TargetsStrategyWeighted, Weights: []int{3, 1}}},
+		{name: "with target", config: TargetsConfig{URLs: urls}, sender: SenderConfig{Target: "http://c.example.com"}, wantErr: true},
+		{name: "unsupported protocol", config: TargetsConfig{URLs: urls}, sender: SenderConfig{Protocol: ProtocolKafka}, wantErr: true},
+		{name: "single target", config: TargetsConfig{URLs: urls[:1]}, wantErr: true},
+		{name: "relative target", config: TargetsConfig{URLs: []string{"http://a.example.com", "/b"}}, wantErr: true},
+		{name: "mixed schemes", config: TargetsConfig{URLs: []string{"http://a.example.com", "https://b.example.com"}}, wantErr: true},
+		{name: "duplicate target", config: TargetsConfig{URLs: []string{urls[0], urls[0]}}, wantErr: true},
+		{name: "unknown strategy", config: TargetsConfig{URLs: urls, Strategy: "random"}, wantErr: true},
+		{name: "weights with failover", config: TargetsConfig{URLs: urls, Weights: []int{1, 1}}, wantErr: true},
+		{name: "weights count", config: TargetsConfig{URLs: urls, Strategy: TargetsStrategyWeighted, Weights: []int{1}}, wantErr: true},
+		{name: "negative weight", config: TargetsConfig{URLs: urls, Strategy: TargetsStrategyWeighted, Weights: []int{2, -1}}, wantErr: true},
+		{name: "zero weights", config: TargetsConfig{URLs: urls, Strategy: TargetsStrategyWeighted, Weights: []int{0, 0}}, wantErr: true},
+		{name: "negative failure threshold", config: TargetsConfig{URLs: urls, FailureThreshold: -1}, wantErr: true},
+		{name: "invalid failback", config: TargetsConfig{URLs: urls, Failback: "0s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.sender)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if tt.config.Strategy == "" || tt.config.FailureThreshold == 0 || tt.config.ParsedFailback == 0 || tt.config.Health == nil {
+				t.Errorf("expected defaults to be set, got %+v", tt.config)
+			}
+		})
+	}
+}
+
+func TestTargetHealth(t *testing.T) {
+	config := &TargetsConfig{URLs: []string{"http://a", "http://b", "http://c"}, FailureThreshold: 2, Failback: "1m"}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	h := config.Health
+	now := time.Now()
+
+	if got := h.target(now); got != "http://a" {
+		t.Fatalf("want first target, got %s", got)
+	}
+	// A success resets the consecutive failures.
+	h.observe("http://a", true, now)
+	h.observe("http://a", false, now)
+	h.observe("http://a", true, now)
+	if got := h.target(now); got != "http://a" {
+		t.Fatalf("want first target, got %s", got)
+	}
+	h.observe("http://a", true, now)
+	if got := h.target(now); got != "http://b" {
+		t.Fatalf("want second target, got %s", got)
+	}
+	// Failures of in-flight requests to the previous target are ignored.
+	h.observe("http://a", true, now)
+	h.observe("http://a", true, now)
+	if got := h.target(now); got != "http://b" {
+		t.Fatalf("want second target, got %s", got)
+	}
+	h.observe("http://b", true, now)
+	h.observe("http://b", true, now)
+	if got := h.target(now.Add(30 * time.Second)); got != "http://c" {
+		t.Fatalf("want third target, got %s", got)
+	}
+	if got := h.target(now.Add(time.Minute)); got != "http://a" {
+		t.Fatalf("want failback to the first target, got %s", got)
+	}
+
+	var m Metrics
+	h.metrics(&m)
+	if m.TargetFailoverCount != 2 {
+		t.Errorf("want 2 failovers, got %d", m.TargetFailoverCount)
+	}
+}
+
+func TestTargetHealthTransport(t *testing.T) {
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer healthy.Close()
+
+	config := &TargetsConfig{URLs: []string{failing.URL, healthy.URL}, FailureThreshold: 1}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: newTargetHealthTransport(config.Health, http.DefaultTransport)}
+	next := newTargetPicker(config, newRand(nil, "targets"))
+
+	var statusCodes []int
+	for i := 0; i < 3; i++ {
+		resp, err := client.Post(next(), "application/json", strings.NewReader("{}"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		statusCodes = append(statusCodes, resp.StatusCode)
+	}
+	want := []int{http.StatusServiceUnavailable, http.StatusAccepted, http.StatusAccepted}
+	if diff := cmp.Diff(want, statusCodes); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestNewTargetPickerWeighted(t *testing.T) {
+	config := &TargetsConfig{URLs: []string{"http://a", "http://b", "http://c"}, Strategy: TargetsStrategyWeighted, Weights: []int{3, 1, 0}}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	seed := int64(1)
+	next := newTargetPicker(config, newRand(&seed, "targets"))
+
+	counts := make(map[string]int)
+	for i := 0; i < 4000; i++ {
+		counts[next()]++
+	}
+	if counts["http://c"] != 0 {
+		t.Errorf("want no events to the zero weight target, got %d", counts["http://c"])
+	}
+	if counts["http://a"] < 2700 || counts["http://a"] > 3300 {
+		t.Errorf("want about 3000 events to the first target, got %d", counts["http://a"])
+	}
+}
+
+func TestNewTargeterGeneratorTargets(t *testing.T) {
+	config := Config{Sender: SenderConfig{Targets: &TargetsConfig{URLs: []string{"http://a", "http://b"}, Strategy: TargetsStrategyWeighted}}}
+	if err := config.Sender.Targets.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	out := make(chan ce.Event, 10)
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	for i := 0; i < 10; i++ {
+		target := &vegeta.Target{}
+		if err := f(target); err != nil {
+			t.Fatal(err)
+		}
+		e := <-out
+		if got := e.Extensions()[TargetExtension]; got != target.URL {
+			t.Errorf("want extension %s, got %v", target.URL, got)
+		}
+	}
+}
+
+func TestStateManagerTargets(t *testing.T) {
+	config := Config{Sender: SenderConfig{Targets: &TargetsConfig{URLs: []string{"http://a", "http://b"}}}}
+	sm := newTestStateManager(t, config)
+
+	now := time.Now()
+	event := func(id, target string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(TargetExtension, target)
+		setSentTimestamp(&e, now)
+		return e
+	}
+	sent := []ce.Event{event("1", "http://a"), event("2", "http://a"), event("3", "http://b"), event("4", "http://b"), event("5", "http://b")}
+	sm.lock.Lock()
+	// Received before being recorded as sent.
+	sm.recordReceived(&ReceivedEvent{Event: sent[0], ReceivedAt: now.Add(10 * time.Millisecond)})
+	for i := range sent {
+		sm.recordSent(&sent[i])
+	}
+	sm.recordReceived(&ReceivedEvent{Event: sent[2], ReceivedAt: now.Add(20 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[2], ReceivedAt: now.Add(30 * time.Millisecond)})
+	sm.recordReceived(&ReceivedEvent{Event: sent[3], ReceivedAt: now.Add(20 * time.Millisecond), DeadLettered: true})
+	sm.lock.Unlock()
+	sm.recordFailedSends([]FailedSend{{ID: "5"}})
+
+	report := sm.GenerateReport()
+	got := make(map[string][3]int, len(report.Targets))
+	for target, r := range report.Targets {
+		got[target] = [3]int{r.SentCount, r.ReceivedCount, r.LostCount}
+	}
+	want := map[string][3]int{
+		"http://a": {2, 1, 1},
+		"http://b": {3, 1, 0},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.Targets["http://a"].Latency.Count != 1 {
+		t.Errorf("want 1 latency sample, got %+v", report.Targets["http://a"].Latency)
+	}
+}
+
+func TestSenderTargetMetrics(t *testing.T) {
+	accepting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer accepting.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	config := Config{
+		Sender: SenderConfig{
+			Targets:            &TargetsConfig{URLs: []string{accepting.URL, failing.URL}, Strategy: TargetsStrategyWeighted},
+			FrequencyPerSecond: 20,
+			Workers:            1,
+		},
+		ParsedDuration: time.Second,
+	}
+	if err := config.Sender.Targets.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	sent := make(chan ce.Event, 20)
+	metrics := startSender(context.Background(), config, sent)
+	close(sent)
+
+	if len(metrics.TargetMetrics) != 2 {
+		t.Fatalf("want the metrics of 2 targets, got %+v", metrics.TargetMetrics)
+	}
+	statusCodes := map[string]map[string]int{
+		accepting.URL: {"202": metrics.TargetMetrics[accepting.URL].Requests},
+		failing.URL:   {"503": metrics.TargetMetrics[failing.URL].Requests},
+	}
+	requests := 0
+	for target, m := range metrics.TargetMetrics {
+		if diff := cmp.Diff(statusCodes[target], m.StatusCodes); diff != "" {
+			t.Errorf("%s: (-want, +got) %s", target, diff)
+		}
+		if m.Requests == 0 || m.Latencies.Count != m.Requests {
+			t.Errorf("%s: want the latency of every request, got %+v", target, m)
+		}
+		requests += m.Requests
+	}
+	if requests != metrics.Metrics.Requests {
+		t.Errorf("want %d requests across targets, got %d", metrics.Metrics.Requests, requests)
+	}
+
+	sm := newTestStateManager(t, config)
+	sm.Terminated(metrics)
+	report := sm.GenerateReport()
+	for _, target := range config.Sender.Targets.URLs {
+		if send := report.Targets[target].Send; send == nil || send.Requests != metrics.TargetMetrics[target].Requests {
+			t.Errorf("%s: want the send metrics of the target in the report, got %+v", target, send)
+		}
+	}
+}
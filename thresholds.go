@@ -0,0 +1,124 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ThresholdsConfig struct {
+	// MaxLostPercentage is the maximum percentage of accepted events that are neither received nor dead-lettered,
+	// lost events are verified against it rather than the delivery guarantee.
+	MaxLostPercentage *float64 `json:"maxLostPercentage" yaml:"maxLostPercentage"`
+	// MaxDuplicatePercentage is the maximum percentage of duplicates over all received events, duplicates are verified
+	// against it rather than the delivery guarantee.
+	MaxDuplicatePercentage *float64 `json:"maxDuplicatePercentage" yaml:"maxDuplicatePercentage"`
+	// MaxP99Latency is the maximum 99th percentile of the end-to-end latency.
+	MaxP99Latency string `json:"maxP99Latency" yaml:"maxP99Latency"`
+	// MinThroughput is the minimum rate of requests accepted by the target per second.
+	MinThroughput *float64 `json:"minThroughput" yaml:"minThroughput"`
+
+	ParsedMaxP99Latency time.Duration
+}
+
+func (c *ThresholdsConfig) validate() error {
+	for field, p := range map[string]*float64{"maxLostPercentage": c.MaxLostPercentage, "maxDuplicatePercentage": c.MaxDuplicatePercentage} {
+		if p != nil && (*p < 0 || *p > 100) {
+			return invalidErr("thresholds."+field, fmt.Errorf("%v must be between 0 and 100", *p))
+		}
+	}
+	if c.MaxP99Latency != "" {
+		var err error
+		c.ParsedMaxP99Latency, err = time.ParseDuration(c.MaxP99Latency)
+		if err != nil {
+			return invalidErr("thresholds.maxP99Latency", err)
+		}
+		if c.ParsedMaxP99Latency <= 0 {
+			return invalidErr("thresholds.maxP99Latency", errors.New("must be greater than 0"))
+		}
+	}
+	if c.MinThroughput != nil && *c.MinThroughput <= 0 {
+		return invalidErr("thresholds.minThroughput", errors.New("must be greater than 0"))
+	}
+	return nil
+}
+
+// gatesLoss reports whether lost events are verified against MaxLostPercentage rather than the delivery guarantee.
+func (c *ThresholdsConfig) gatesLoss() bool {
+	return c != nil && c.MaxLostPercentage != nil
+}
+
+// gatesDuplicates reports whether duplicates are verified against MaxDuplicatePercentage rather than the delivery
+// guarantee.
+func (c *ThresholdsConfig) gatesDuplicates() bool {
+	return c != nil && c.MaxDuplicatePercentage != nil
+}
+
+const (
+	ThresholdMaxLostPercentage      = "maxLostPercentage"
+	ThresholdMaxDuplicatePercentage = "maxDuplicatePercentage"
+	ThresholdMaxP99Latency          = "maxP99Latency"
+	ThresholdMinThroughput          = "minThroughput"
+)
+
+// ThresholdViolation describes a threshold the final report doesn't meet.
+type ThresholdViolation struct {
+	// Threshold is the name of the violated threshold, as in the config.
+	Threshold string `json:"threshold"`
+	// Limit is the configured value, latencies are in milliseconds.
+	Limit float64 `json:"limit"`
+	// Actual is the observed value, latencies are in milliseconds.
+	Actual float64 `json:"actual"`
+}
+
+// ThresholdsError is returned when the final report violates the configured thresholds.
+type ThresholdsError struct {
+	Violations []ThresholdViolation `json:"violations"`
+}
+
+func (e *ThresholdsError) Error() string {
+	b, _ := json.Marshal(e.Violations)
+	return fmt.Sprintf("%d thresholds violated: %s", len(e.Violations), b)
+}
+
+// evaluateThresholds returns the thresholds the given report violates, in the order they are declared in the config.
+func evaluateThresholds(config Config, report Report) []ThresholdViolation {
+	c := config.Thresholds
+	if c == nil {
+		return nil
+	}
+
+	var violations []ThresholdViolation
+	violated := func(threshold string, limit, actual float64) {
+		violations = append(violations, ThresholdViolation{Threshold: threshold, Limit: limit, Actual: actual})
+	}
+
+	sent := !config.Sender.Disabled && report.Metrics.AcceptedCount > 0
+
+	if c.MaxLostPercentage != nil && sent {
+		if p := report.lostPercentage(); p > 0 && p > *c.MaxLostPercentage {
+			violated(ThresholdMaxLostPercentage, *c.MaxLostPercentage, p)
+		}
+	}
+
+	if c.MaxDuplicatePercentage != nil && report.ReceivedCount > 0 {
+		if p := report.duplicatePercentage(); p > *c.MaxDuplicatePercentage {
+			violated(ThresholdMaxDuplicatePercentage, *c.MaxDuplicatePercentage, p)
+		}
+	}
+
+	if c.ParsedMaxP99Latency > 0 && report.Latency.P99 > c.ParsedMaxP99Latency {
+		violated(ThresholdMaxP99Latency, milliseconds(c.ParsedMaxP99Latency), milliseconds(report.Latency.P99))
+	}
+
+	if c.MinThroughput != nil && !config.Sender.Disabled && report.Metrics.Metrics.Throughput < *c.MinThroughput {
+		violated(ThresholdMinThroughput, *c.MinThroughput, report.Metrics.Metrics.Throughput)
+	}
+
+	return violations
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,217 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestThresholdsConfigValidate(t *testing.T) {
+	negative := -1.0
+	over := 101.0
+	zero := 0.0
+
+	tests := []struct {
+		name    string
+		config  ThresholdsConfig
+		wantErr bool
+	}{
+		{
+			name:   "empty",
+			config: ThresholdsConfig{},
+		},
+		{
+			name:   "zero loss",
+			config: ThresholdsConfig{MaxLostPercentage: &zero, MaxDuplicatePercentage: &zero},
+		},
+		{
+			name:    "negative lost percentage",
+			config:  ThresholdsConfig{MaxLostPercentage: &negative},
+			wantErr: true,
+		},
+		{
+			name:    "duplicate percentage over 100",
+			config:  ThresholdsConfig{MaxDuplicatePercentage: &over},
+			wantErr: true,
+		},
+		{
+			name:    "invalid p99 latency",
+			config:  ThresholdsConfig{MaxP99Latency: "1"},
+			wantErr: true,
+		},
+		{
+			name:    "zero min throughput",
+			config:  ThresholdsConfig{MinThroughput: &zero},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	one := 1.0
+	ten := 10.0
+	hundred := 100.0
+
+	report := Report{
+		ReceivedCount:  95,
+		DuplicateCount: 5,
+		Latency:        LatencyStats{P99: 1500 * time.Millisecond},
+		Metrics:        Metrics{AcceptedCount: 100, Metrics: SendMetrics{Throughput: 50}},
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		want   []ThresholdViolation
+	}{
+		{
+			name:   "no thresholds",
+			config: Config{},
+		},
+		{
+			name: "all met",
+			config: Config{Thresholds: &ThresholdsConfig{
+				MaxLostPercentage:      &ten,
+				MaxDuplicatePercentage: &ten,
+				ParsedMaxP99Latency:    2 * time.Second,
+				MinThroughput:          &ten,
+			}},
+		},
+		{
+			name: "all violated",
+			config: Config{Thresholds: &ThresholdsConfig{
+				MaxLostPercentage:      &one,
+				MaxDuplicatePercentage: &one,
+				ParsedMaxP99Latency:    time.Second,
+				MinThroughput:          &hundred,
+			}},
+			want: []ThresholdViolation{
+				{Threshold: ThresholdMaxLostPercentage, Limit: 1, Actual: 5},
+				{Threshold: ThresholdMaxDuplicatePercentage, Limit: 1, Actual: 5},
+				{Threshold: ThresholdMaxP99Latency, Limit: 1000, Actual: 1500},
+				{Threshold: ThresholdMinThroughput, Limit: 100, Actual: 50},
+			},
+		},
+		{
+			name: "sender disabled",
+			config: Config{
+				Sender:     SenderConfig{Disabled: true},
+				Thresholds: &ThresholdsConfig{MaxLostPercentage: &one, MinThroughput: &hundred},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.want, evaluateThresholds(tt.config, report)); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestVerifyAndWriteReportsThresholds(t *testing.T) {
+	one := 1.0
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	config := Config{
+		DeliveryGuarantee: AtMostOnce,
+		Report:            ReportConfig{Writers: []ReportWriterConfig{{Format: ReportFormatJSON, Path: path}}},
+		Thresholds:        &ThresholdsConfig{MaxLostPercentage: &one},
+	}
+	report := Report{ReceivedCount: 90, Metrics: Metrics{AcceptedCount: 100}}
+
+	err := verifyAndWriteReports(config, &report)
+	var thresholdsErr *ThresholdsError
+	if !errors.As(err, &thresholdsErr) {
+		t.Fatalf("expected thresholds error, got %v", err)
+	}
+	want := []ThresholdViolation{{Threshold: ThresholdMaxLostPercentage, Limit: 1, Actual: 10}}
+	if diff := cmp.Diff(want, thresholdsErr.Violations); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := struct {
+		Passed              bool                 `json:"passed"`
+		ThresholdViolations []ThresholdViolation `json:"thresholdViolations"`
+	}{}
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Passed {
+		t.Error("expected report not to pass")
+	}
+	if diff := cmp.Diff(want, got.ThresholdViolations); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestVerifyReportThresholdsRelaxGuarantee(t *testing.T) {
+	one := 1.0
+	tenth := 0.1
+
+	tests := []struct {
+		name    string
+		config  ThresholdsConfig
+		report  Report
+		wantErr bool
+	}{
+		{
+			name:   "loss within threshold",
+			config: ThresholdsConfig{MaxLostPercentage: &one},
+			report: Report{ReceivedCount: 995, Metrics: Metrics{AcceptedCount: 1000}},
+		},
+		{
+			name:    "loss over threshold",
+			config:  ThresholdsConfig{MaxLostPercentage: &tenth},
+			report:  Report{ReceivedCount: 995, Metrics: Metrics{AcceptedCount: 1000}},
+			wantErr: true,
+		},
+		{
+			name:   "duplicates within threshold",
+			config: ThresholdsConfig{MaxDuplicatePercentage: &one},
+			report: Report{ReceivedCount: 1000, DuplicateCount: 5, Metrics: Metrics{AcceptedCount: 1000}},
+		},
+		{
+			name:    "duplicates over threshold",
+			config:  ThresholdsConfig{MaxDuplicatePercentage: &tenth},
+			report:  Report{ReceivedCount: 1000, DuplicateCount: 5, Metrics: Metrics{AcceptedCount: 1000}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Config{DeliveryGuarantee: ExactlyOnce, Thresholds: &tt.config}
+			err := verifyReport(config, &tt.report)
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatal("expected nil, got", err)
+				}
+				return
+			}
+			// The threshold is violated, not the delivery guarantee.
+			var thresholdsErr *ThresholdsError
+			if !errors.As(err, &thresholdsErr) {
+				t.Fatalf("expected thresholds error, got %v", err)
+			}
+		})
+	}
+}
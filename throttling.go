@@ -0,0 +1,185 @@
+package sacura
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultThrottlingPause is the default time a worker pauses after a 429 response without Retry-After.
+	DefaultThrottlingPause = time.Second
+	// DefaultThrottlingMaxPause is the default maximum time a worker pauses after a 429 response.
+	DefaultThrottlingMaxPause = 30 * time.Second
+)
+
+// ThrottlingConfig pauses the sender worker receiving a 429 Too Many Requests response for the time requested by
+// its Retry-After header, so that the sender backs off instead of hammering a throttling broker.
+//
+// The other workers keep sending, each of them pauses on its own 429 responses. With sender.retry, throttled requests
+// are retried after the pause without further backoff.
+type ThrottlingConfig struct {
+	// Pause is the time to pause after 429 responses without Retry-After header, for example 1s.
+	//
+	// Defaults to DefaultThrottlingPause.
+	Pause string `json:"pause" yaml:"pause"`
+	// MaxPause caps the time requested by Retry-After headers, for example 30s.
+	//
+	// Defaults to DefaultThrottlingMaxPause.
+	MaxPause string `json:"maxPause" yaml:"maxPause"`
+
+	ParsedPause    time.Duration
+	ParsedMaxPause time.Duration
+}
+
+func (c *ThrottlingConfig) validate() error {
+	var err error
+	c.ParsedPause = DefaultThrottlingPause
+	if c.Pause != "" {
+		c.ParsedPause, err = time.ParseDuration(c.Pause)
+		if err != nil {
+			return invalidErr("sender.throttling.pause", err)
+		}
+		if c.ParsedPause < 0 {
+			return invalidErr("sender.throttling.pause", fmt.Errorf("%v cannot be negative", c.ParsedPause))
+		}
+	}
+	c.ParsedMaxPause = DefaultThrottlingMaxPause
+	if c.MaxPause != "" {
+		c.ParsedMaxPause, err = time.ParseDuration(c.MaxPause)
+		if err != nil {
+			return invalidErr("sender.throttling.maxPause", err)
+		}
+	}
+	if c.ParsedMaxPause < c.ParsedPause {
+		return invalidErr("sender.throttling.maxPause", fmt.Errorf("%v must be greater or equal to sender.throttling.pause %v", c.ParsedMaxPause, c.ParsedPause))
+	}
+	return nil
+}
+
+// pause returns the time to pause after the given 429 response at the given time.
+func (c *ThrottlingConfig) pause(resp *http.Response, now time.Time) time.Duration {
+	pause := c.ParsedPause
+	if v := resp.Header.Get("Retry-After"); v != "" {
+		if seconds, err := strconv.Atoi(v); err == nil && seconds >= 0 {
+			pause = time.Duration(seconds) * time.Second
+		} else if t, err := http.ParseTime(v); err == nil {
+			pause = t.Sub(now)
+			if pause < 0 {
+				pause = 0
+			}
+		}
+	}
+	if pause > c.ParsedMaxPause {
+		return c.ParsedMaxPause
+	}
+	return pause
+}
+
+// ThrottlingMetrics reports how much the target throttled the sender.
+type ThrottlingMetrics struct {
+	// ThrottledCount is the number of 429 responses, including retried attempts.
+	ThrottledCount int `json:"throttledCount"`
+	// EpisodeCount is the number of throttling episodes, periods with at least one paused worker.
+	EpisodeCount int `json:"episodeCount"`
+	// Duration is the total duration of the throttling episodes.
+	Duration time.Duration `json:"duration"`
+	// LongestEpisode is the duration of the longest throttling episode.
+	LongestEpisode time.Duration `json:"longestEpisode"`
+	// PausedDuration is the time paused by workers, summed across workers.
+	PausedDuration time.Duration `json:"pausedDuration"`
+}
+
+// throttling tracks the throttling episodes of the sender.
+type throttling struct {
+	lock      sync.Mutex
+	paused    int
+	startedAt time.Time
+	metrics   ThrottlingMetrics
+}
+
+func newThrottling() *throttling {
+	return &throttling{}
+}
+
+// start records a worker pausing at the given time.
+func (t *throttling) start(now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.metrics.ThrottledCount++
+	if t.paused == 0 {
+		t.metrics.EpisodeCount++
+		t.startedAt = now
+	}
+	t.paused++
+}
+
+// stop records a worker paused since the given time resuming at the given time.
+func (t *throttling) stop(pausedAt, now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.metrics.PausedDuration += now.Sub(pausedAt)
+	t.paused--
+	if t.paused == 0 {
+		episode := now.Sub(t.startedAt)
+		t.metrics.Duration += episode
+		if episode > t.metrics.LongestEpisode {
+			t.metrics.LongestEpisode = episode
+		}
+	}
+}
+
+func (t *throttling) report(m *Metrics) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.metrics.ThrottledCount == 0 {
+		return
+	}
+	metrics := t.metrics
+	m.Throttling = &metrics
+}
+
+// throttlingTransport is an http.RoundTripper pausing after 429 responses according to the sender throttling config.
+type throttlingTransport struct {
+	config     *ThrottlingConfig
+	next       http.RoundTripper
+	throttling *throttling
+}
+
+func newThrottlingTransport(config *ThrottlingConfig, next http.RoundTripper, throttling *throttling) *throttlingTransport {
+	return &throttlingTransport{config: config, next: next, throttling: throttling}
+}
+
+func (t *throttlingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		return resp, err
+	}
+
+	// Drain the body before pausing, so that the connection is released to the other workers.
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+	_ = resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	pausedAt := time.Now()
+	t.throttling.start(pausedAt)
+	timer := time.NewTimer(t.config.pause(resp, pausedAt))
+	defer timer.Stop()
+	select {
+	case <-req.Context().Done():
+	case <-timer.C:
+	}
+	t.throttling.stop(pausedAt, time.Now())
+	return resp, nil
+}
@@ -0,0 +1,161 @@
+package sacura
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestThrottlingConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ThrottlingConfig
+		want    ThrottlingConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: ThrottlingConfig{}, want: ThrottlingConfig{ParsedPause: DefaultThrottlingPause, ParsedMaxPause: DefaultThrottlingMaxPause}},
+		{name: "custom", config: ThrottlingConfig{Pause: "10ms", MaxPause: "1s"}, want: ThrottlingConfig{Pause: "10ms", MaxPause: "1s", ParsedPause: 10 * time.Millisecond, ParsedMaxPause: time.Second}},
+		{name: "invalid pause", config: ThrottlingConfig{Pause: "1"}, wantErr: true},
+		{name: "negative pause", config: ThrottlingConfig{Pause: "-1s"}, wantErr: true},
+		{name: "max pause less than pause", config: ThrottlingConfig{Pause: "2s", MaxPause: "1s"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err != nil {
+				return
+			}
+			if diff := cmp.Diff(tt.want, tt.config); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
+
+func TestThrottlingConfigPause(t *testing.T) {
+	now := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	config := &ThrottlingConfig{Pause: "1s", MaxPause: "10s"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		want       time.Duration
+	}{
+		{name: "no retry after", want: time.Second},
+		{name: "seconds", retryAfter: "3", want: 3 * time.Second},
+		{name: "seconds capped", retryAfter: "120", want: 10 * time.Second},
+		{name: "date", retryAfter: now.Add(5 * time.Second).Format(http.TimeFormat), want: 5 * time.Second},
+		{name: "past date", retryAfter: now.Add(-time.Minute).Format(http.TimeFormat), want: 0},
+		{name: "invalid", retryAfter: "soon", want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+			if got := config.pause(resp, now); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestThrottlingTransport(t *testing.T) {
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	// Without Retry-After sender.throttling.pause applies, a zero Retry-After doesn't pause.
+	throttlingConfig := &ThrottlingConfig{Pause: "1h", MaxPause: "1h"}
+	if err := throttlingConfig.validate(); err != nil {
+		t.Fatal(err)
+	}
+	// The retry backoff is skipped for throttled requests.
+	retryConfig := &RetryConfig{InitialBackoff: "1h", MaxBackoff: "1h", MaxAttempts: 3}
+	if err := retryConfig.validate(); err != nil {
+		t.Fatal(err)
+	}
+	th := newThrottling()
+	sa := newSendAttempts()
+	transport := newRetryTransport(retryConfig, newThrottlingTransport(throttlingConfig, http.DefaultTransport, th), sa, true)
+	client := &http.Client{Transport: transport, Timeout: 10 * time.Second}
+
+	req, err := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Add(CloudEventIdHeader, "1")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("want status code %d, got %d", http.StatusAccepted, resp.StatusCode)
+	}
+
+	var m Metrics
+	th.report(&m)
+	sa.metrics(&m)
+	if m.Throttling == nil || m.Throttling.ThrottledCount != 2 || m.Throttling.EpisodeCount != 2 {
+		t.Errorf("want 2 throttled responses in 2 episodes, got %+v", m.Throttling)
+	}
+	if m.SendRetryCount != 2 {
+		t.Errorf("want 2 retries, got %d", m.SendRetryCount)
+	}
+}
+
+func TestThrottlingEpisodes(t *testing.T) {
+	th := newThrottling()
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// Two overlapping pauses make a single episode.
+	th.start(at(0))
+	th.start(at(time.Second))
+	th.stop(at(0), at(2*time.Second))
+	th.stop(at(time.Second), at(4*time.Second))
+	// Then a separate one.
+	th.start(at(10 * time.Second))
+	th.stop(at(10*time.Second), at(11*time.Second))
+
+	var m Metrics
+	th.report(&m)
+	want := &ThrottlingMetrics{
+		ThrottledCount: 3,
+		EpisodeCount:   2,
+		Duration:       5 * time.Second,
+		LongestEpisode: 4 * time.Second,
+		PausedDuration: 6 * time.Second,
+	}
+	if diff := cmp.Diff(want, m.Throttling); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	m = Metrics{}
+	newThrottling().report(&m)
+	if m.Throttling != nil {
+		t.Errorf("want no throttling metrics, got %+v", m.Throttling)
+	}
+}
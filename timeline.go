@@ -0,0 +1,77 @@
+package sacura
+
+import (
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// maxTimelineSamples is the maximum number of samples of the throughput timeline when report.throughputInterval is
+// not set, the sample interval grows with the duration of the test.
+const maxTimelineSamples = 300
+
+// ThroughputSample is the number of events sent and received during an interval of the test.
+type ThroughputSample struct {
+	// Offset is the start of the interval from the first sent event.
+	Offset        time.Duration `json:"offset"`
+	SentCount     int           `json:"sentCount"`
+	ReceivedCount int           `json:"receivedCount"`
+	// LostCount is the number of events sent during the interval that have never been received.
+	LostCount int `json:"lostCount"`
+}
+
+// throughputTimeline returns the number of events sent and received over time, events are attributed to intervals by
+// send time and by first receive time, lost events are attributed to intervals by send time. It must be called while
+// holding the lock.
+func (s *StateManager) throughputTimeline(lost sets.String) (time.Duration, []ThroughputSample) {
+	var start, end time.Time
+	observe := func(t time.Time) {
+		if t.IsZero() {
+			return
+		}
+		if start.IsZero() || t.Before(start) {
+			start = t
+		}
+		if t.After(end) {
+			end = t
+		}
+	}
+	for _, t := range s.sentAt {
+		observe(t)
+	}
+	if start.IsZero() {
+		return 0, nil
+	}
+	for _, t := range s.receivedAt {
+		observe(t)
+	}
+
+	interval := s.config.Report.ParsedThroughputInterval
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if span := end.Sub(start); s.config.Report.ParsedThroughputInterval <= 0 && span/interval >= maxTimelineSamples {
+		interval = (span/maxTimelineSamples + time.Second).Truncate(time.Second)
+	}
+	samples := make([]ThroughputSample, int(end.Sub(start)/interval)+1)
+	for i := range samples {
+		samples[i].Offset = time.Duration(i) * interval
+	}
+	for id, t := range s.sentAt {
+		if t.IsZero() {
+			continue
+		}
+		i := int(t.Sub(start) / interval)
+		samples[i].SentCount++
+		if lost.Has(id) {
+			samples[i].LostCount++
+		}
+	}
+	for _, t := range s.receivedAt {
+		// Events received before the earliest send time are unexpected events.
+		if !t.Before(start) {
+			samples[int(t.Sub(start)/interval)].ReceivedCount++
+		}
+	}
+	return interval, samples
+}
@@ -0,0 +1,100 @@
+package sacura
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+func TestThroughputTimeline(t *testing.T) {
+
+	start := time.Now()
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	tests := []struct {
+		name         string
+		interval     time.Duration
+		sentAt       []time.Duration
+		receivedAt   []time.Duration
+		lost         []string
+		wantInterval time.Duration
+		want         []ThroughputSample
+	}{
+		{
+			name: "no sent events",
+		},
+		{
+			name:         "one second interval",
+			sentAt:       []time.Duration{0, 500 * time.Millisecond, 1500 * time.Millisecond},
+			receivedAt:   []time.Duration{100 * time.Millisecond, 1200 * time.Millisecond, 2100 * time.Millisecond},
+			wantInterval: time.Second,
+			want: []ThroughputSample{
+				{Offset: 0, SentCount: 2, ReceivedCount: 1},
+				{Offset: time.Second, SentCount: 1, ReceivedCount: 1},
+				{Offset: 2 * time.Second, ReceivedCount: 1},
+			},
+		},
+		{
+			name:         "interval grows with the duration",
+			sentAt:       []time.Duration{0, 10 * time.Minute},
+			receivedAt:   []time.Duration{time.Second, 10*time.Minute + time.Second},
+			wantInterval: 3 * time.Second,
+			want: func() []ThroughputSample {
+				samples := make([]ThroughputSample, 201)
+				for i := range samples {
+					samples[i].Offset = time.Duration(i) * 3 * time.Second
+				}
+				samples[0] = ThroughputSample{SentCount: 1, ReceivedCount: 1}
+				samples[200].SentCount, samples[200].ReceivedCount = 1, 1
+				return samples
+			}(),
+		},
+		{
+			name:         "fixed interval",
+			interval:     10 * time.Minute,
+			sentAt:       []time.Duration{0, time.Second, 10 * time.Minute},
+			receivedAt:   []time.Duration{time.Second, 10*time.Minute + time.Second},
+			lost:         []string{"2"},
+			wantInterval: 10 * time.Minute,
+			want: []ThroughputSample{
+				{Offset: 0, SentCount: 2, ReceivedCount: 1},
+				{Offset: 10 * time.Minute, SentCount: 1, ReceivedCount: 1, LostCount: 1},
+			},
+		},
+		{
+			name:         "lost events by send time",
+			sentAt:       []time.Duration{0, 100 * time.Millisecond, time.Second},
+			receivedAt:   []time.Duration{1500 * time.Millisecond},
+			lost:         []string{"1", "2"},
+			wantInterval: time.Second,
+			want: []ThroughputSample{
+				{Offset: 0, SentCount: 2, ReceivedCount: 0, LostCount: 1},
+				{Offset: time.Second, SentCount: 1, ReceivedCount: 1, LostCount: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &StateManager{sentAt: make(map[string]time.Time), receivedAt: make(map[string]time.Time)}
+			s.config.Report.ParsedThroughputInterval = tt.interval
+			for i, d := range tt.sentAt {
+				s.sentAt[fmt.Sprint(i)] = at(d)
+			}
+			for i, d := range tt.receivedAt {
+				s.receivedAt[fmt.Sprint(i)] = at(d)
+			}
+
+			interval, got := s.throughputTimeline(sets.NewString(tt.lost...))
+			if interval != tt.wantInterval {
+				t.Errorf("expected interval %v, got %v", tt.wantInterval, interval)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
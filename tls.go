@@ -0,0 +1,103 @@
+package sacura
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+type TLSConfig struct {
+	// CertFile is the path of the PEM encoded certificate, the server certificate of the receiver or the client
+	// certificate presented by the sender.
+	//
+	// It is required for the receiver.
+	CertFile string `json:"certFile" yaml:"certFile"`
+	// KeyFile is the path of the PEM encoded private key of CertFile.
+	KeyFile string `json:"keyFile" yaml:"keyFile"`
+	// CAFile is the path of a PEM encoded CA bundle, the sender trusts it to verify the target and the receiver
+	// requires and verifies client certificates signed by it.
+	//
+	// When not specified, the sender trusts the system CAs and the receiver doesn't request client certificates.
+	CAFile string `json:"caFile" yaml:"caFile"`
+	// ServerName overrides the name used by the sender to verify the target certificate.
+	ServerName string `json:"serverName" yaml:"serverName"`
+
+	Parsed *tls.Config `json:"-" yaml:"-"`
+}
+
+func (c *TLSConfig) validateClient(field string) error {
+	if err := c.validateKeyPair(field); err != nil {
+		return err
+	}
+
+	c.Parsed = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.ServerName,
+	}
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return invalidErr(field+".certFile", err)
+		}
+		c.Parsed.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return invalidErr(field+".caFile", err)
+		}
+		c.Parsed.RootCAs = pool
+	}
+	return nil
+}
+
+func (c *TLSConfig) validateServer(field string) error {
+	if c.CertFile == "" {
+		return invalidErr(field+".certFile", errors.New("certificate is required"))
+	}
+	if c.ServerName != "" {
+		return invalidErr(field+".serverName", errors.New("server name is only supported by the sender"))
+	}
+	if err := c.validateKeyPair(field); err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return invalidErr(field+".certFile", err)
+	}
+	c.Parsed = &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if c.CAFile != "" {
+		pool, err := loadCertPool(c.CAFile)
+		if err != nil {
+			return invalidErr(field+".caFile", err)
+		}
+		c.Parsed.ClientCAs = pool
+		c.Parsed.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return nil
+}
+
+func (c *TLSConfig) validateKeyPair(field string) error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return invalidErr(field, errors.New("certFile and keyFile must be specified together"))
+	}
+	return nil
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM encoded certificates found in %s", path)
+	}
+	return pool, nil
+}
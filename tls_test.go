@@ -0,0 +1,230 @@
+package sacura
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+type testCerts struct {
+	caFile, serverCertFile, serverKeyFile, clientCertFile, clientKeyFile string
+}
+
+// newTestCerts writes a CA and server and client key pairs signed by it to the given directory.
+func newTestCerts(t *testing.T, dir string) testCerts {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "sacura-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certs := testCerts{caFile: filepath.Join(dir, "ca.pem")}
+	writePEM(t, certs.caFile, "CERTIFICATE", caDER)
+
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certFile, keyFile := filepath.Join(dir, name+".pem"), filepath.Join(dir, name+"-key.pem")
+		writePEM(t, certFile, "CERTIFICATE", der)
+		writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+	certs.serverCertFile, certs.serverKeyFile = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	certs.clientCertFile, certs.clientKeyFile = issue("client", 3, x509.ExtKeyUsageClientAuth)
+	return certs
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLSConfigValidate(t *testing.T) {
+
+	certs := newTestCerts(t, t.TempDir())
+
+	tests := []struct {
+		name    string
+		config  TLSConfig
+		server  bool
+		wantErr bool
+	}{
+		{
+			name:   "client CA only",
+			config: TLSConfig{CAFile: certs.caFile},
+		},
+		{
+			name:   "client certificate",
+			config: TLSConfig{CertFile: certs.clientCertFile, KeyFile: certs.clientKeyFile, CAFile: certs.caFile, ServerName: "localhost"},
+		},
+		{
+			name:    "client certificate without key",
+			config:  TLSConfig{CertFile: certs.clientCertFile},
+			wantErr: true,
+		},
+		{
+			name:    "client invalid CA",
+			config:  TLSConfig{CAFile: certs.clientKeyFile},
+			wantErr: true,
+		},
+		{
+			name:   "server",
+			config: TLSConfig{CertFile: certs.serverCertFile, KeyFile: certs.serverKeyFile, CAFile: certs.caFile},
+			server: true,
+		},
+		{
+			name:    "server without certificate",
+			config:  TLSConfig{CAFile: certs.caFile},
+			server:  true,
+			wantErr: true,
+		},
+		{
+			name:    "server with server name",
+			config:  TLSConfig{CertFile: certs.serverCertFile, KeyFile: certs.serverKeyFile, ServerName: "localhost"},
+			server:  true,
+			wantErr: true,
+		},
+		{
+			name:    "server missing key file",
+			config:  TLSConfig{CertFile: certs.serverCertFile, KeyFile: filepath.Join(t.TempDir(), "missing.pem")},
+			server:  true,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.server {
+				err = tt.config.validateServer("receiver.tls")
+			} else {
+				err = tt.config.validateClient("sender.tls")
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Parsed == nil {
+				t.Error("expected parsed TLS config")
+			}
+		})
+	}
+}
+
+func TestStartReceiverMutualTLS(t *testing.T) {
+
+	certs := newTestCerts(t, t.TempDir())
+
+	serverTLS := &TLSConfig{CertFile: certs.serverCertFile, KeyFile: certs.serverKeyFile, CAFile: certs.caFile}
+	if err := serverTLS.validateServer("receiver.tls"); err != nil {
+		t.Fatal(err)
+	}
+	clientTLS := &TLSConfig{CertFile: certs.clientCertFile, KeyFile: certs.clientKeyFile, CAFile: certs.caFile}
+	if err := clientTLS.validateClient("sender.tls"); err != nil {
+		t.Fatal(err)
+	}
+	noCertTLS := &TLSConfig{CAFile: certs.caFile}
+	if err := noCertTLS.validateClient("sender.tls"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan *ce.Event, 1)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- startReceiver(ctx, &ReceiverConfig{Port: 9205, TLS: serverTLS}, nil, func(ctx context.Context, e *ce.Event, r *http.Request) error {
+			received <- e
+			return nil
+		})
+	}()
+
+	e := cetest.FullEvent()
+	body, err := e.MarshalJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(client *http.Client) (*http.Response, error) {
+		return client.Post("https://localhost:9205", "application/cloudevents+json", strings.NewReader(string(body)))
+	}
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientTLS.Parsed}}
+	err = wait.PollImmediate(100*time.Millisecond, 10*time.Second, func() (done bool, err error) {
+		resp, err := post(client)
+		if err != nil {
+			return false, nil
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal("failed to send event", err)
+	}
+	if r := <-received; r.ID() != e.ID() {
+		t.Errorf("expected event %s, got %s", e.ID(), r.ID())
+	}
+
+	if resp, err := post(&http.Client{Transport: &http.Transport{TLSClientConfig: noCertTLS.Parsed}}); err == nil {
+		resp.Body.Close()
+		t.Error("expected client without certificate to be rejected")
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
@@ -0,0 +1,69 @@
+package sacura
+
+import (
+	"errors"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+// TokenBucketConfig paces requests with a token bucket: tokens accumulate at sender.frequency and each request
+// consumes one. When the sender falls behind, for example because all workers are busy waiting for slow responses,
+// it catches up by sending the accumulated requests back-to-back, up to the capacity of the bucket, and the requests
+// beyond are not sent instead of being sent in an unbounded burst.
+type TokenBucketConfig struct {
+	// Capacity is the maximum number of requests sent back-to-back to catch up with the rate.
+	Capacity int `json:"capacity" yaml:"capacity"`
+}
+
+func (c *TokenBucketConfig) validate(sender *SenderConfig) error {
+	if sender.LoadProfile != nil {
+		return invalidErr("sender.tokenBucket", errors.New("cannot be used with sender.loadProfile"))
+	}
+	if sender.Replay != nil {
+		return invalidErr("sender.tokenBucket", errors.New("cannot be used with sender.replay, which follows the recorded pacing"))
+	}
+	if c.Capacity <= 0 {
+		return invalidErr("sender.tokenBucket.capacity", errors.New("must be greater than 0"))
+	}
+	return nil
+}
+
+// pacer returns a pacer sending requests at the given frequency.
+func (c *TokenBucketConfig) pacer(frequency int) vegeta.Pacer {
+	return &tokenBucketPacer{frequency: float64(frequency), capacity: uint64(c.Capacity)}
+}
+
+// tokenBucketPacer sends requests at a constant frequency and catches up with at most capacity requests.
+//
+// It is not safe for concurrent use, vegeta calls Pace from a single goroutine.
+type tokenBucketPacer struct {
+	frequency float64
+	capacity  uint64
+	// skipped is the number of requests that were due but have not been sent since the bucket was full.
+	skipped uint64
+}
+
+var _ vegeta.Pacer = &tokenBucketPacer{}
+
+// Pace implements vegeta.Pacer.
+func (p *tokenBucketPacer) Pace(elapsed time.Duration, hits uint64) (time.Duration, bool) {
+	if p.frequency <= 0 {
+		return 0, false
+	}
+	// due is the number of requests due by elapsed, like vegeta.Rate the first one is due after one interval.
+	due := uint64(elapsed.Seconds() * p.frequency)
+	if sent := hits + p.skipped; due > sent+p.capacity {
+		p.skipped += due - sent - p.capacity
+	}
+	next := time.Duration(float64(hits+p.skipped+1) / p.frequency * float64(time.Second))
+	if next <= elapsed {
+		return 0, false
+	}
+	return next - elapsed, false
+}
+
+// Rate implements vegeta.Pacer.
+func (p *tokenBucketPacer) Rate(time.Duration) float64 {
+	return p.frequency
+}
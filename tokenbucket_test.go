@@ -0,0 +1,102 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestTokenBucketPacer(t *testing.T) {
+	config := &TokenBucketConfig{Capacity: 3}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// On time, the pacer sends at the frequency like vegeta.Rate.
+	p := config.pacer(10)
+	if got, want := len(simulatePacer(p, 3*time.Second)), len(simulatePacer(vegeta.Rate{Freq: 10, Per: time.Second}, 3*time.Second)); got != want {
+		t.Errorf("want %d hits, got %d", want, got)
+	}
+	if got := p.Rate(time.Second); got != 10 {
+		t.Errorf("want rate 10, got %v", got)
+	}
+
+	// After falling behind by 10 requests, the pacer catches up with 3 requests only.
+	p = config.pacer(10)
+	elapsed := time.Second
+	hits := uint64(0)
+	for {
+		wait, stop := p.Pace(elapsed, hits)
+		if stop {
+			t.Fatal("unexpected stop")
+		}
+		if wait > 0 {
+			break
+		}
+		hits++
+	}
+	if hits != 3 {
+		t.Errorf("want 3 hits to catch up, got %d", hits)
+	}
+	// The next request is due one interval later.
+	if wait, _ := p.Pace(elapsed, hits); wait != 100*time.Millisecond {
+		t.Errorf("want to wait 100ms, got %v", wait)
+	}
+}
+
+func TestTokenBucketConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  TokenBucketConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "valid", config: TokenBucketConfig{Capacity: 1}},
+		{name: "zero capacity", config: TokenBucketConfig{}, wantErr: true},
+		{name: "load profile", config: TokenBucketConfig{Capacity: 1}, sender: SenderConfig{LoadProfile: &LoadProfileConfig{}}, wantErr: true},
+		{name: "replay", config: TokenBucketConfig{Capacity: 1}, sender: SenderConfig{Replay: &ReplayConfig{}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.sender); (err != nil) != tt.wantErr {
+				t.Errorf("want error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestSendMetricsRates(t *testing.T) {
+	start := time.Now()
+	m := newSendMetrics(ProtocolHTTP)
+	m.paced(start, vegeta.Rate{Freq: 10, Per: time.Second}, vegeta.Rate{Freq: 5, Per: time.Second})
+	// 15 requests during the first second, 6 during the second one.
+	for i := 0; i < 15; i++ {
+		m.record(sendResult{Status: "200", Accepted: true, Timestamp: start.Add(time.Duration(i) * 60 * time.Millisecond)})
+	}
+	for i := 0; i < 6; i++ {
+		m.record(sendResult{Status: "200", Accepted: true, Timestamp: start.Add(time.Second + time.Duration(i)*150*time.Millisecond)})
+	}
+
+	got := m.close()
+	if got.TargetRate != 15 {
+		t.Errorf("want target rate 15, got %v", got.TargetRate)
+	}
+	want := []RateSample{
+		{Offset: 0, Target: 15, Achieved: 15},
+		{Offset: time.Second, Target: 15, Achieved: 6},
+	}
+	if len(got.Rates) != len(want) {
+		t.Fatalf("want %+v, got %+v", want, got.Rates)
+	}
+	for i := range want {
+		if got.Rates[i] != want[i] {
+			t.Errorf("want %+v, got %+v", want[i], got.Rates[i])
+		}
+	}
+
+	merged := mergeSendMetrics(got, got)
+	if merged.TargetRate != 30 || len(merged.Rates) != 2 || merged.Rates[1].Achieved != 12 {
+		t.Errorf("want merged rates, got %v %+v", merged.TargetRate, merged.Rates)
+	}
+}
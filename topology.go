@@ -0,0 +1,231 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// DefaultStepsExtension is the default extension steps of the topology under test append their name to.
+const DefaultStepsExtension = "sacurasteps"
+
+// TopologyConfig verifies that received events passed through the steps of the topology under test, for example the
+// steps of a Sequence, each step appending its name to the steps extension of the event, separated by commas, like
+// "enrich,filter,route".
+//
+// The verification fails when events are received without the evidence of a step, with steps out of order or with
+// steps they are not expected to pass through, and the report lists the offending events by step.
+type TopologyConfig struct {
+	// StepsExtension is the extension steps append their name to.
+	//
+	// Defaults to DefaultStepsExtension.
+	StepsExtension string `json:"stepsExtension" yaml:"stepsExtension"`
+	// Steps are the steps every event is expected to pass through, in order.
+	Steps []string `json:"steps" yaml:"steps"`
+	// Branches are the steps events received on each endpoint are expected to pass through, in order, for example the
+	// branches of a Parallel, they override Steps. The keys are endpoints of receiver.endpoints.
+	Branches map[string][]string `json:"branches" yaml:"branches"`
+}
+
+func (c *TopologyConfig) validate(config *Config) error {
+	if c.StepsExtension == "" {
+		c.StepsExtension = DefaultStepsExtension
+	}
+	if !isValidExtensionName(c.StepsExtension) {
+		return invalidErr("verification.topology.stepsExtension", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", c.StepsExtension))
+	}
+	if len(c.Steps) == 0 && len(c.Branches) == 0 {
+		return invalidErr("verification.topology", errors.New("steps or branches must be specified"))
+	}
+	if err := validateSteps("verification.topology.steps", c.Steps); err != nil {
+		return err
+	}
+	if len(c.Branches) > 0 && config.Receiver.Endpoints == nil {
+		return invalidErr("verification.topology.branches", errors.New("branches are endpoints, receiver.endpoints must be enabled"))
+	}
+	for endpoint, steps := range c.Branches {
+		field := fmt.Sprintf("verification.topology.branches[%s]", endpoint)
+		if len(steps) == 0 {
+			return invalidErr(field, errors.New("at least one step is required"))
+		}
+		if err := validateSteps(field, steps); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateSteps(field string, steps []string) error {
+	seen := sets.NewString()
+	for i, s := range steps {
+		if s == "" || strings.ContainsAny(s, ", ") {
+			return invalidErr(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("%q cannot be empty nor contain commas or spaces", s))
+		}
+		if seen.Has(s) {
+			return invalidErr(fmt.Sprintf("%s[%d]", field, i), fmt.Errorf("%q is a duplicate step", s))
+		}
+		seen.Insert(s)
+	}
+	return nil
+}
+
+// expectedSteps returns the steps expected for events received on the given endpoint.
+func (c *TopologyConfig) expectedSteps(endpoint string) []string {
+	if steps, ok := c.Branches[endpoint]; ok {
+		return steps
+	}
+	return c.Steps
+}
+
+// TopologyReport reports the deliveries that didn't pass through the expected steps.
+type TopologyReport struct {
+	// CheckedCount is the number of checked deliveries, excluding failure responses and the dead-letter sink.
+	CheckedCount int `json:"checkedCount"`
+	// ViolationCount is the number of deliveries that didn't pass through the expected steps.
+	ViolationCount int `json:"violationCount"`
+	// Steps reports the violations of each step.
+	Steps map[string]TopologyStepReport `json:"steps,omitempty"`
+}
+
+// TopologyStepReport reports the deliveries a step skipped, reordered or unexpectedly handled.
+type TopologyStepReport struct {
+	// SkippedCount is the number of deliveries without the evidence of the step.
+	SkippedCount int `json:"skippedCount,omitempty"`
+	// ReorderedCount is the number of deliveries where the step comes before a step expected earlier.
+	ReorderedCount int `json:"reorderedCount,omitempty"`
+	// UnexpectedCount is the number of deliveries with the evidence of the step while not expected to pass through
+	// it, for example events routed to the wrong branch.
+	UnexpectedCount int `json:"unexpectedCount,omitempty"`
+	// EventsByPartitionKey are the events of the violations of the step.
+	EventsByPartitionKey map[string][]string `json:"events"`
+}
+
+// topologyState tracks the violations of the expected steps.
+type topologyState struct {
+	config     *TopologyConfig
+	checked    int
+	violations int
+	steps      map[string]*TopologyStepReport
+}
+
+func newTopologyState(config *TopologyConfig) *topologyState {
+	if config == nil {
+		return nil
+	}
+	return &topologyState{config: config, steps: make(map[string]*TopologyStepReport)}
+}
+
+// observedSteps returns the steps recorded in the given value of the steps extension, in order.
+func observedSteps(v string) []string {
+	var steps []string
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			steps = append(steps, s)
+		}
+	}
+	return steps
+}
+
+// recordTopology checks the steps of the given delivery, it must be called while holding the lock.
+func (s *StateManager) recordTopology(e *ReceivedEvent) {
+	t := s.topology
+	if t == nil {
+		return
+	}
+	expected := t.config.expectedSteps(e.Endpoint)
+	if len(expected) == 0 {
+		return
+	}
+	t.checked++
+
+	v, _ := eventAttribute(&e.Event, t.config.StepsExtension)
+	observed := observedSteps(v)
+	position := make(map[string]int, len(observed))
+	for i, step := range observed {
+		if _, ok := position[step]; !ok {
+			position[step] = i
+		}
+	}
+
+	violated := false
+	violation := func(step string, count func(r *TopologyStepReport)) {
+		r, ok := t.steps[step]
+		if !ok {
+			r = &TopologyStepReport{EventsByPartitionKey: make(map[string][]string)}
+			t.steps[step] = r
+		}
+		count(r)
+		insert(&e.Event, r.EventsByPartitionKey, &s.stateManagerConfig)
+		violated = true
+	}
+
+	last := -1
+	for _, step := range expected {
+		p, ok := position[step]
+		if !ok {
+			violation(step, func(r *TopologyStepReport) { r.SkippedCount++ })
+			continue
+		}
+		if p < last {
+			violation(step, func(r *TopologyStepReport) { r.ReorderedCount++ })
+			continue
+		}
+		last = p
+	}
+	known := sets.NewString(expected...)
+	for step := range position {
+		if !known.Has(step) {
+			violation(step, func(r *TopologyStepReport) { r.UnexpectedCount++ })
+		}
+	}
+	if violated {
+		t.violations++
+	}
+}
+
+// topologyReport sets the topology section of the report, it must be called while holding the lock.
+func (s *StateManager) topologyReport(r *Report) {
+	t := s.topology
+	if t == nil {
+		return
+	}
+	report := &TopologyReport{CheckedCount: t.checked, ViolationCount: t.violations}
+	if len(t.steps) > 0 {
+		report.Steps = make(map[string]TopologyStepReport, len(t.steps))
+		for step, sr := range t.steps {
+			events := make(map[string][]string, len(sr.EventsByPartitionKey))
+			for pk, ids := range sr.EventsByPartitionKey {
+				ids, _ = removeDuplicates(ids)
+				sort.Strings(ids)
+				events[pk] = ids
+			}
+			report.Steps[step] = TopologyStepReport{
+				SkippedCount:         sr.SkippedCount,
+				ReorderedCount:       sr.ReorderedCount,
+				UnexpectedCount:      sr.UnexpectedCount,
+				EventsByPartitionKey: events,
+			}
+		}
+	}
+	r.Topology = report
+}
+
+// verifyTopology verifies received events passed through the expected steps, when enabled.
+func verifyTopology(report Report) error {
+	if report.Topology == nil || report.Topology.ViolationCount == 0 {
+		return nil
+	}
+	steps := make([]string, 0, len(report.Topology.Steps))
+	for step := range report.Topology.Steps {
+		steps = append(steps, step)
+	}
+	sort.Strings(steps)
+	return fmt.Errorf("%d of %d deliveries didn't pass through the expected steps, violated steps %v",
+		report.Topology.ViolationCount,
+		report.Topology.CheckedCount,
+		steps,
+	)
+}
@@ -0,0 +1,100 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateManagerTopology(t *testing.T) {
+
+	config := Config{
+		Receiver: ReceiverConfig{Endpoints: &EndpointsConfig{}},
+		Verification: VerificationConfig{Topology: &TopologyConfig{
+			Steps:    []string{"enrich", "filter", "route"},
+			Branches: map[string][]string{"/audit": {"enrich", "audit"}},
+		}},
+	}
+	if err := config.Verification.Topology.validate(&config); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	event := func(id, steps string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		if steps != "" {
+			e.SetExtension(DefaultStepsExtension, steps)
+		}
+		return e
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1", "enrich,filter,route"), Endpoint: "/sink"},
+		{Event: event("2", "enrich, route"), Endpoint: "/sink"},
+		{Event: event("3", "filter,enrich,route"), Endpoint: "/sink"},
+		{Event: event("4", ""), Endpoint: "/sink"},
+		{Event: event("5", "enrich,audit"), Endpoint: "/audit"},
+		{Event: event("6", "enrich,filter"), Endpoint: "/audit"},
+		{Event: event("7", "enrich"), Endpoint: "/sink", Nacked: true},
+	} {
+		r := r
+		r.ReceivedAt = time.Now()
+		sm.lock.Lock()
+		sm.recordReceived(&r)
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	// Event 3 passed through filter before enrich, event 6 through filter instead of audit.
+	want := &TopologyReport{
+		CheckedCount:   6,
+		ViolationCount: 4,
+		Steps: map[string]TopologyStepReport{
+			"enrich": {SkippedCount: 1, EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"4"}}},
+			"filter": {SkippedCount: 2, ReorderedCount: 1, UnexpectedCount: 1, EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"2", "3", "4", "6"}}},
+			"route":  {SkippedCount: 1, EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"4"}}},
+			"audit":  {SkippedCount: 1, EventsByPartitionKey: map[string][]string{unknownPartitionKey: {"6"}}},
+		},
+	}
+	if diff := cmp.Diff(want, report.Topology); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+
+	if err := verifyTopology(report); err == nil || !strings.Contains(err.Error(), "4 of 6 deliveries") {
+		t.Errorf("expected topology violations, got %v", err)
+	}
+}
+
+func TestTopologyConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  TopologyConfig
+		root    Config
+		wantErr bool
+	}{
+		{name: "steps", config: TopologyConfig{Steps: []string{"a", "b"}}},
+		{name: "branches", config: TopologyConfig{Branches: map[string][]string{"/a": {"a"}}}, root: Config{Receiver: ReceiverConfig{Endpoints: &EndpointsConfig{}}}},
+		{name: "branches without endpoints", config: TopologyConfig{Branches: map[string][]string{"/a": {"a"}}}, wantErr: true},
+		{name: "empty branch", config: TopologyConfig{Branches: map[string][]string{"/a": {}}}, root: Config{Receiver: ReceiverConfig{Endpoints: &EndpointsConfig{}}}, wantErr: true},
+		{name: "no steps", config: TopologyConfig{}, wantErr: true},
+		{name: "duplicate step", config: TopologyConfig{Steps: []string{"a", "a"}}, wantErr: true},
+		{name: "step with comma", config: TopologyConfig{Steps: []string{"a,b"}}, wantErr: true},
+		{name: "invalid extension", config: TopologyConfig{StepsExtension: "steps-ext", Steps: []string{"a"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate(&tt.root)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.StepsExtension != DefaultStepsExtension {
+				t.Errorf("want default steps extension, got %q", tt.config.StepsExtension)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// DefaultTracingServiceName is the service name of exported spans when none is configured.
+	DefaultTracingServiceName = "sacura"
+
+	spanExporterBatchSize     = 512
+	spanExporterBufferSize    = 8 * spanExporterBatchSize
+	spanExporterFlushInterval = time.Second
+	spanExporterTimeout       = 10 * time.Second
+)
+
+type TracingConfig struct {
+	// Endpoint is the URL of the OTLP/HTTP traces endpoint spans are exported to, for example
+	// http://otel-collector:4318/v1/traces.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// ServiceName is the service.name resource attribute of exported spans.
+	//
+	// Defaults to DefaultTracingServiceName.
+	ServiceName string `json:"serviceName" yaml:"serviceName"`
+}
+
+func (c *TracingConfig) validate() error {
+	if u, err := url.Parse(c.Endpoint); err != nil || !u.IsAbs() {
+		return invalidErr("tracing.endpoint", fmt.Errorf("%q must be an absolute URL: %v", c.Endpoint, err))
+	}
+	if c.ServiceName == "" {
+		c.ServiceName = DefaultTracingServiceName
+	}
+	return nil
+}
+
+var traceContext = propagation.TraceContext{}
+
+// newTraceParent returns a new sampled span context with random trace and span IDs.
+func newTraceParent() trace.SpanContext {
+	var traceID trace.TraceID
+	var spanID trace.SpanID
+	_, _ = rand.Read(traceID[:])
+	_, _ = rand.Read(spanID[:])
+	return trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})
+}
+
+// injectTraceParent sets the W3C traceparent header of a new trace in the given headers.
+func injectTraceParent(hdr http.Header) {
+	ctx := trace.ContextWithSpanContext(context.Background(), newTraceParent())
+	traceContext.Inject(ctx, propagation.HeaderCarrier(hdr))
+}
+
+// extractTraceParent returns the span context of the W3C traceparent header in the given headers.
+func extractTraceParent(hdr http.Header) trace.SpanContext {
+	return trace.SpanContextFromContext(traceContext.Extract(context.Background(), propagation.HeaderCarrier(hdr)))
+}
+
+// span is a finished span.
+type span struct {
+	name string
+	kind trace.SpanKind
+	// context is the span context of root spans, whose IDs are propagated, like the ones of sent requests.
+	context trace.SpanContext
+	// parent is the span context of the parent of child spans, whose span ID is random.
+	parent     trace.SpanContext
+	start      time.Time
+	end        time.Time
+	attributes map[string]string
+	failed     bool
+}
+
+// newChildSpan returns a span with a random span ID, child of the given span context.
+func newChildSpan(name string, kind trace.SpanKind, parent trace.SpanContext, start, end time.Time, attributes map[string]string) span {
+	return span{
+		name:       name,
+		kind:       kind,
+		parent:     parent,
+		start:      start,
+		end:        end,
+		attributes: attributes,
+	}
+}
+
+// spanExporter exports spans to an OTLP/HTTP endpoint with the OpenTelemetry SDK, a nil spanExporter drops spans.
+type spanExporter struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+}
+
+type spanExporterKey struct{}
+
+// contextWithSpanExporter returns a context carrying the given exporter.
+func contextWithSpanExporter(ctx context.Context, e *spanExporter) context.Context {
+	return context.WithValue(ctx, spanExporterKey{}, e)
+}
+
+// spanExporterFromContext returns the exporter carried by the given context, or nil.
+func spanExporterFromContext(ctx context.Context) *spanExporter {
+	e, _ := ctx.Value(spanExporterKey{}).(*spanExporter)
+	return e
+}
+
+// newSpanExporter starts an exporter for the given config, it returns nil when tracing is disabled.
+//
+// Spans are exported in batches, they are dropped when the exporter can't keep up or when the export fails.
+func newSpanExporter(config *TracingConfig) *spanExporter {
+	if config == nil {
+		return nil
+	}
+	// The endpoint is validated.
+	u, _ := url.Parse(config.Endpoint)
+	options := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(u.Host),
+		otlptracehttp.WithTimeout(spanExporterTimeout),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	}
+	if u.Path != "" {
+		options = append(options, otlptracehttp.WithURLPath(u.Path))
+	}
+	if u.Scheme != "https" {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(otlptracehttp.NewUnstarted(options...),
+			sdktrace.WithMaxQueueSize(spanExporterBufferSize),
+			sdktrace.WithMaxExportBatchSize(spanExporterBatchSize),
+			sdktrace.WithBatchTimeout(spanExporterFlushInterval),
+		),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", config.ServiceName))),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithIDGenerator(spanIDGenerator{}),
+	)
+	return &spanExporter{provider: provider, tracer: provider.Tracer("sacura")}
+}
+
+// export records the given span for export.
+func (e *spanExporter) export(s span) {
+	if e == nil {
+		return
+	}
+	ctx := context.Background()
+	if s.parent.IsValid() {
+		ctx = trace.ContextWithRemoteSpanContext(ctx, s.parent)
+	} else {
+		ctx = context.WithValue(ctx, spanContextKey{}, s.context)
+	}
+	attributes := make([]attribute.KeyValue, 0, len(s.attributes))
+	for k, v := range s.attributes {
+		attributes = append(attributes, attribute.String(k, v))
+	}
+
+	_, recorded := e.tracer.Start(ctx, s.name, trace.WithSpanKind(s.kind), trace.WithTimestamp(s.start), trace.WithAttributes(attributes...))
+	if s.failed {
+		recorded.SetStatus(codes.Error, "")
+	}
+	recorded.End(trace.WithTimestamp(s.end))
+}
+
+// shutdown flushes recorded spans and stops the exporter, spans can't be exported after shutdown.
+func (e *spanExporter) shutdown() {
+	if e == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), spanExporterTimeout)
+	defer cancel()
+	if err := e.provider.Shutdown(ctx); err != nil {
+		logger(LogComponentSender).Warnw("Failed to export spans", "error", err)
+	}
+}
+
+type spanContextKey struct{}
+
+// spanIDGenerator generates random IDs, except for root spans started with a context carrying the span context of the
+// span, so that the IDs of sent requests propagated with the traceparent header are the ones of their span.
+type spanIDGenerator struct{}
+
+func (spanIDGenerator) NewIDs(ctx context.Context) (trace.TraceID, trace.SpanID) {
+	sc, ok := ctx.Value(spanContextKey{}).(trace.SpanContext)
+	if !ok || !sc.IsValid() {
+		sc = newTraceParent()
+	}
+	return sc.TraceID(), sc.SpanID()
+}
+
+func (spanIDGenerator) NewSpanID(context.Context, trace.TraceID) trace.SpanID {
+	var spanID trace.SpanID
+	_, _ = rand.Read(spanID[:])
+	return spanID
+}
+
+// sendSpan returns the span of a request sent by the sender, identified by the traceparent header of the request,
+// it returns false when the request has no valid traceparent header.
+func sendSpan(hdr http.Header, start time.Time, latency time.Duration, statusCode int, failed bool) (span, bool) {
+	sc := extractTraceParent(hdr)
+	if !sc.IsValid() {
+		return span{}, false
+	}
+	return span{
+		name:    "send",
+		kind:    trace.SpanKindProducer,
+		context: sc,
+		start:   start,
+		end:     start.Add(latency),
+		attributes: map[string]string{
+			"cloudevents.event_id": hdr.Get(CloudEventIdHeader),
+			"http.status_code":     strconv.Itoa(statusCode),
+		},
+		failed: failed,
+	}, true
+}
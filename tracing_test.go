@@ -0,0 +1,104 @@
+package sacura
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestSpanExporter(t *testing.T) {
+
+	var lock sync.Mutex
+	var resourceSpans []*tracepb.ResourceSpans
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		req := &collectortracepb.ExportTraceServiceRequest{}
+		if err := proto.Unmarshal(b, req); err != nil {
+			t.Error(err)
+		}
+		lock.Lock()
+		resourceSpans = append(resourceSpans, req.ResourceSpans...)
+		lock.Unlock()
+	}))
+	defer server.Close()
+
+	config := &TracingConfig{Endpoint: server.URL + "/v1/traces"}
+	if err := config.validate(); err != nil {
+		t.Fatal(err)
+	}
+	exporter := newSpanExporter(config)
+
+	hdr := http.Header{}
+	hdr.Set(CloudEventIdHeader, "1")
+	injectTraceParent(hdr)
+	sent := time.Now()
+
+	send, ok := sendSpan(hdr, sent, time.Millisecond, http.StatusAccepted, false)
+	if !ok {
+		t.Fatal("expected send span")
+	}
+	exporter.export(send)
+	exporter.export(newChildSpan("receive", trace.SpanKindConsumer, extractTraceParent(hdr), sent, sent.Add(time.Millisecond), nil))
+	exporter.shutdown()
+	exporter.shutdown()
+
+	lock.Lock()
+	defer lock.Unlock()
+	var spans []*tracepb.Span
+	for _, rs := range resourceSpans {
+		found := false
+		for _, a := range rs.GetResource().GetAttributes() {
+			found = found || (a.GetKey() == "service.name" && a.GetValue().GetStringValue() == DefaultTracingServiceName)
+		}
+		if !found {
+			t.Errorf("expected service name %s, got resource %+v", DefaultTracingServiceName, rs.GetResource())
+		}
+		for _, ss := range rs.GetScopeSpans() {
+			spans = append(spans, ss.GetSpans()...)
+		}
+	}
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %+v", spans)
+	}
+	traceParent := extractTraceParent(hdr)
+	if spans[0].GetName() != "send" || spans[0].GetKind() != tracepb.Span_SPAN_KIND_PRODUCER || len(spans[0].GetParentSpanId()) != 0 {
+		t.Errorf("unexpected send span %+v", spans[0])
+	}
+	if tid, sid := traceParent.TraceID(), traceParent.SpanID(); !bytes.Equal(spans[0].GetTraceId(), tid[:]) || !bytes.Equal(spans[0].GetSpanId(), sid[:]) {
+		t.Errorf("expected send span with the IDs of the traceparent header %s, got %+v", hdr.Get("traceparent"), spans[0])
+	}
+	if !bytes.Equal(spans[1].GetTraceId(), spans[0].GetTraceId()) || !bytes.Equal(spans[1].GetParentSpanId(), spans[0].GetSpanId()) || bytes.Equal(spans[1].GetSpanId(), spans[0].GetSpanId()) {
+		t.Errorf("expected receive span to be a child of the send span, got %+v", spans)
+	}
+}
+
+func TestSendSpanWithoutTraceParent(t *testing.T) {
+	if _, ok := sendSpan(http.Header{}, time.Now(), time.Millisecond, http.StatusAccepted, false); ok {
+		t.Error("expected no span without traceparent")
+	}
+}
+
+func TestNilSpanExporter(t *testing.T) {
+	var exporter *spanExporter
+	exporter.export(span{})
+	exporter.shutdown()
+
+	if newSpanExporter(nil) != nil {
+		t.Error("expected nil exporter when tracing is disabled")
+	}
+}
@@ -0,0 +1,205 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// DefaultTTLExtension is the default extension carrying the time to live of events sent with sender.ttl.
+const DefaultTTLExtension = "ttl"
+
+// TTLFormat is the format of the value of the TTL extension.
+type TTLFormat string
+
+const (
+	// TTLFormatSeconds is the time to live in seconds, for example 5.
+	TTLFormatSeconds TTLFormat = "seconds"
+	// TTLFormatMilliseconds is the time to live in milliseconds, for example 5000.
+	TTLFormatMilliseconds TTLFormat = "milliseconds"
+	// TTLFormatExpiry is the RFC 3339 time at which events expire, for example 2021-01-01T00:00:05Z.
+	TTLFormatExpiry TTLFormat = "expiry"
+)
+
+// TTLConfig sends a share of events with a time to live an intermediate component of the system under test is
+// expected to enforce, for example a broker holding events longer than their TTL. The verification passes only when
+// exactly those events are missing, any of them received is reported as a violation.
+type TTLConfig struct {
+	// Percentage is the percentage of sent events with a TTL, for example 10.
+	Percentage float64 `json:"percentage" yaml:"percentage"`
+	// TTL is the time to live of events, for example 1s.
+	TTL string `json:"ttl" yaml:"ttl"`
+	// Extension is the extension carrying the TTL.
+	//
+	// Defaults to DefaultTTLExtension.
+	Extension string `json:"extension" yaml:"extension"`
+	// Format is the format of the TTL extension.
+	//
+	// Defaults to TTLFormatSeconds.
+	Format TTLFormat `json:"format" yaml:"format"`
+
+	ParsedTTL time.Duration
+}
+
+func (c *TTLConfig) validate(sender *SenderConfig) error {
+	if c.Percentage <= 0 || c.Percentage >= 100 {
+		return invalidErr("sender.ttl.percentage", fmt.Errorf("%v must be greater than 0 and less than 100", c.Percentage))
+	}
+	var err error
+	c.ParsedTTL, err = time.ParseDuration(c.TTL)
+	if err != nil {
+		return invalidErr("sender.ttl.ttl", err)
+	}
+	if c.ParsedTTL <= 0 {
+		return invalidErr("sender.ttl.ttl", fmt.Errorf("%v must be positive", c.ParsedTTL))
+	}
+	if c.Extension == "" {
+		c.Extension = DefaultTTLExtension
+	}
+	if !isValidExtensionName(c.Extension) {
+		return invalidErr("sender.ttl.extension", fmt.Errorf("%q is not a valid extension name, expected lowercase letters and digits", c.Extension))
+	}
+	for _, reserved := range reservedExtensions {
+		if c.Extension == reserved {
+			return invalidErr("sender.ttl.extension", fmt.Errorf("%s is reserved", c.Extension))
+		}
+	}
+	if sender.Attributes != nil {
+		if _, ok := sender.Attributes.Extensions[c.Extension]; ok {
+			return invalidErr("sender.ttl.extension", fmt.Errorf("%s is already set by sender.attributes.extensions", c.Extension))
+		}
+	}
+
+	switch c.Format {
+	case "":
+		c.Format = TTLFormatSeconds
+	case TTLFormatSeconds, TTLFormatMilliseconds, TTLFormatExpiry:
+	default:
+		return invalidErr("sender.ttl.format", fmt.Errorf("unknown format %q, expected %s, %s or %s", c.Format, TTLFormatSeconds, TTLFormatMilliseconds, TTLFormatExpiry))
+	}
+	if c.Format == TTLFormatSeconds && c.ParsedTTL%time.Second != 0 {
+		return invalidErr("sender.ttl.ttl", errors.New("must be a whole number of seconds with the seconds format"))
+	}
+	if c.Format == TTLFormatMilliseconds && c.ParsedTTL%time.Millisecond != 0 {
+		return invalidErr("sender.ttl.ttl", errors.New("must be a whole number of milliseconds with the milliseconds format"))
+	}
+	return nil
+}
+
+// value returns the value of the TTL extension of events sent at the given time.
+func (c *TTLConfig) value(sentAt time.Time) string {
+	switch c.Format {
+	case TTLFormatMilliseconds:
+		return strconv.FormatInt(c.ParsedTTL.Milliseconds(), 10)
+	case TTLFormatExpiry:
+		return sentAt.Add(c.ParsedTTL).UTC().Format(time.RFC3339Nano)
+	default:
+		return strconv.FormatInt(int64(c.ParsedTTL/time.Second), 10)
+	}
+}
+
+// newTTLGenerator returns a function setting the TTL extension on the given share of events, the choice is
+// deterministic with a seed. Events expected not to be delivered for other reasons don't get a TTL.
+func newTTLGenerator(config *TTLConfig, seed *int64) func(e *ce.Event, sentAt time.Time) {
+	if config == nil {
+		return func(*ce.Event, time.Time) {}
+	}
+	r := newRand(seed, "ttl")
+	return func(e *ce.Event, sentAt time.Time) {
+		if r.Float64()*100 >= config.Percentage || isExpectedLossEvent(e) {
+			return
+		}
+		e.SetExtension(config.Extension, config.value(sentAt))
+	}
+}
+
+// TTLReport reports the events sent with a TTL.
+type TTLReport struct {
+	// ExpiringCount is the number of accepted events sent with a TTL, these events are expected not to be delivered.
+	ExpiringCount int `json:"expiringCount"`
+	// ViolationCount is the number of unique received events sent with a TTL.
+	ViolationCount int `json:"violationCount"`
+	// ViolationsByPartitionKey collects received events sent with a TTL by partition key.
+	ViolationsByPartitionKey map[string][]string `json:"violations,omitempty"`
+	// MaxOverdue is the maximum time after their expiry at which events sent with a TTL have been received, it is
+	// zero when they have all been received before they expired.
+	MaxOverdue time.Duration `json:"maxOverdue,omitempty"`
+}
+
+// ttlState tracks the events sent with a TTL.
+type ttlState struct {
+	config     *TTLConfig
+	expiring   int
+	violations map[string][]string
+	maxOverdue time.Duration
+}
+
+// newTTLState returns the state of the events sent with a TTL, it returns nil without sender.ttl.
+func newTTLState(config *TTLConfig) *ttlState {
+	if config == nil {
+		return nil
+	}
+	return &ttlState{config: config, violations: make(map[string][]string)}
+}
+
+// hasTTL returns true when the given event has been sent with a TTL.
+func (t *ttlState) hasTTL(e *ce.Event) bool {
+	_, ok := e.Extensions()[t.config.Extension]
+	return ok
+}
+
+// recordExpiring records sent events with a TTL, it returns true when the event has a TTL. It must be called while
+// holding the lock.
+func (s *StateManager) recordExpiring(e *ce.Event) bool {
+	if s.ttl == nil || !s.ttl.hasTTL(e) {
+		return false
+	}
+	s.ttl.expiring++
+	return true
+}
+
+// recordTTLViolation records received events sent with a TTL, it returns true when the event has a TTL. It must be
+// called while holding the lock.
+func (s *StateManager) recordTTLViolation(e *ReceivedEvent) bool {
+	if s.ttl == nil || !s.ttl.hasTTL(&e.Event) {
+		return false
+	}
+	logger(LogComponentState).Warnw("Received event sent with a TTL", "id", e.Event.ID(), "ttl", s.ttl.config.ParsedTTL)
+	insert(&e.Event, s.ttl.violations, &s.stateManagerConfig)
+	if sentAt, ok := sentTimestamp(&e.Event); ok && !e.ReceivedAt.IsZero() {
+		if overdue := e.ReceivedAt.Sub(sentAt.Add(s.ttl.config.ParsedTTL)); overdue > s.ttl.maxOverdue {
+			s.ttl.maxOverdue = overdue
+		}
+	}
+	return true
+}
+
+// ttlReport sets the TTL section of the report, it must be called while holding the lock.
+func (s *StateManager) ttlReport(r *Report) {
+	if s.ttl == nil {
+		return
+	}
+	report := &TTLReport{ExpiringCount: s.ttl.expiring, MaxOverdue: s.ttl.maxOverdue}
+	if len(s.ttl.violations) > 0 {
+		report.ViolationsByPartitionKey = make(map[string][]string, len(s.ttl.violations))
+		for k, v := range s.ttl.violations {
+			violations, _ := removeDuplicates(v)
+			sort.Strings(violations)
+			report.ViolationsByPartitionKey[k] = violations
+			report.ViolationCount += len(violations)
+		}
+	}
+	r.TTL = report
+}
+
+// verifyTTL verifies none of the events sent with a TTL has been received, when enabled.
+func verifyTTL(report Report) error {
+	if report.TTL == nil || report.TTL.ViolationCount == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d events sent with a TTL received, up to %v after they expired", report.TTL.ViolationCount, report.TTL.MaxOverdue)
+}
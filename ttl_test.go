@@ -0,0 +1,164 @@
+package sacura
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTTLConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  TTLConfig
+		sender  SenderConfig
+		wantErr bool
+	}{
+		{name: "defaults", config: TTLConfig{Percentage: 10, TTL: "1s"}},
+		{name: "milliseconds", config: TTLConfig{Percentage: 10, TTL: "1500ms", Format: TTLFormatMilliseconds}},
+		{name: "expiry", config: TTLConfig{Percentage: 10, TTL: "1500ms", Format: TTLFormatExpiry, Extension: "expiry"}},
+		{name: "no percentage", config: TTLConfig{TTL: "1s"}, wantErr: true},
+		{name: "all events", config: TTLConfig{Percentage: 100, TTL: "1s"}, wantErr: true},
+		{name: "invalid ttl", config: TTLConfig{Percentage: 10, TTL: "1"}, wantErr: true},
+		{name: "negative ttl", config: TTLConfig{Percentage: 10, TTL: "-1s"}, wantErr: true},
+		{name: "fractional seconds", config: TTLConfig{Percentage: 10, TTL: "1500ms"}, wantErr: true},
+		{name: "invalid extension", config: TTLConfig{Percentage: 10, TTL: "1s", Extension: "Bad-Name"}, wantErr: true},
+		{name: "reserved extension", config: TTLConfig{Percentage: 10, TTL: "1s", Extension: ExpectedLossExtension}, wantErr: true},
+		{name: "unknown format", config: TTLConfig{Percentage: 10, TTL: "1s", Format: "minutes"}, wantErr: true},
+		{
+			name:    "extension set by attributes",
+			config:  TTLConfig{Percentage: 10, TTL: "1s"},
+			sender:  SenderConfig{Attributes: &EventAttributesConfig{Extensions: map[string]string{"ttl": "10"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(&tt.sender); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestTTLConfigValue(t *testing.T) {
+	sentAt := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		format TTLFormat
+		want   string
+	}{
+		{format: TTLFormatSeconds, want: "2"},
+		{format: TTLFormatMilliseconds, want: "2000"},
+		{format: TTLFormatExpiry, want: "2021-01-01T00:00:02Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.format), func(t *testing.T) {
+			config := &TTLConfig{Percentage: 10, TTL: "2s", Format: tt.format}
+			if err := config.validate(&SenderConfig{}); err != nil {
+				t.Fatal(err)
+			}
+			if got := config.value(sentAt); got != tt.want {
+				t.Errorf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestTTLGenerator(t *testing.T) {
+	seed := int64(42)
+	config := &TTLConfig{Percentage: 10, TTL: "1s"}
+	if err := config.validate(&SenderConfig{}); err != nil {
+		t.Fatal(err)
+	}
+	setTTL := newTTLGenerator(config, &seed)
+
+	withTTL := 0
+	for i := 0; i < 1000; i++ {
+		e := cetest.FullEvent()
+		setTTL(&e, time.Now())
+		if v, ok := e.Extensions()[DefaultTTLExtension]; ok {
+			withTTL++
+			if v != "1" {
+				t.Fatalf("want TTL 1, got %v", v)
+			}
+		}
+	}
+	if withTTL < 50 || withTTL > 150 {
+		t.Errorf("want about 10%% of events with a TTL, got %d", withTTL)
+	}
+
+	e := cetest.FullEvent()
+	e.SetExtension(ExpectedLossExtension, "true")
+	for i := 0; i < 100; i++ {
+		setTTL(&e, time.Now())
+	}
+	if _, ok := e.Extensions()[DefaultTTLExtension]; ok {
+		t.Error("want no TTL on events expected not to be delivered")
+	}
+}
+
+func TestStateManagerTTL(t *testing.T) {
+	config := Config{Sender: SenderConfig{TTL: &TTLConfig{Percentage: 10, TTL: "1s"}}}
+	if err := config.Sender.TTL.validate(&config.Sender); err != nil {
+		t.Fatal(err)
+	}
+	sm := newTestStateManager(t, config)
+
+	sentAt := time.Now()
+	event := func(id string, ttl bool) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		setSentTimestamp(&e, sentAt)
+		if ttl {
+			e.SetExtension(DefaultTTLExtension, "1")
+		}
+		return e
+	}
+	for _, e := range []ce.Event{event("1", false), event("2", true), event("3", false), event("4", true)} {
+		e := e
+		sm.lock.Lock()
+		sm.recordSent(&e)
+		sm.lock.Unlock()
+	}
+	for _, r := range []ReceivedEvent{
+		{Event: event("1", false), ReceivedAt: sentAt.Add(time.Millisecond)},
+		{Event: event("3", false), ReceivedAt: sentAt.Add(time.Millisecond)},
+		{Event: event("4", true), ReceivedAt: sentAt.Add(3 * time.Second)},
+		{Event: event("4", true), ReceivedAt: sentAt.Add(2 * time.Second)},
+	} {
+		r := r
+		sm.lock.Lock()
+		sm.recordReceived(&r)
+		sm.lock.Unlock()
+	}
+
+	report := sm.GenerateReport()
+	want := &TTLReport{
+		ExpiringCount:            2,
+		ViolationCount:           1,
+		ViolationsByPartitionKey: map[string][]string{unknownPartitionKey: {"4"}},
+		MaxOverdue:               2 * time.Second,
+	}
+	if diff := cmp.Diff(want, report.TTL); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	if report.ReceivedCount != 2 || report.LostCount != 0 {
+		t.Errorf("expected 2 received and 0 lost events, got %d and %d", report.ReceivedCount, report.LostCount)
+	}
+	report.Metrics.AcceptedCount = 4
+	if got := report.expectedCount(); got != 2 {
+		t.Errorf("expected 2 events to be received, got %d", got)
+	}
+
+	if err := verifyTTL(report); err == nil || !strings.Contains(err.Error(), "1 events sent with a TTL") {
+		t.Errorf("expected TTL violations error, got %v", err)
+	}
+	if err := verifyTTL(Report{}); err != nil {
+		t.Error("unexpected error", err)
+	}
+}
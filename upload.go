@@ -0,0 +1,317 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/option"
+)
+
+type ObjectStoreProvider string
+
+const (
+	// ObjectStoreS3 uploads to Amazon S3 or to an S3-compatible object store, like MinIO.
+	ObjectStoreS3 ObjectStoreProvider = "s3"
+	// ObjectStoreGCS uploads to Google Cloud Storage.
+	ObjectStoreGCS ObjectStoreProvider = "gcs"
+
+	// DefaultAWSRegion is the region of S3 uploads when neither the config nor the environment specifies it.
+	DefaultAWSRegion = "us-east-1"
+	// DefaultGCSEndpoint is the endpoint of Google Cloud Storage uploads.
+	DefaultGCSEndpoint = "https://storage.googleapis.com"
+
+	// UploadReportObject is the name of the JSON report object, relative to the prefix.
+	UploadReportObject = "report.json"
+)
+
+// ReportUploadConfig uploads the final JSON report, the files written by report writers and the event log to an object
+// store bucket, since in-cluster pods often have no persistent volume.
+//
+// S3 credentials are resolved by the default chain of the AWS SDK, like AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY,
+// the web identity (IRSA) of AWS_WEB_IDENTITY_TOKEN_FILE and AWS_ROLE_ARN, shared config files or the instance role.
+// GCS credentials are the access token of GOOGLE_OAUTH_ACCESS_TOKEN or the application default credentials, like the
+// key file of GOOGLE_APPLICATION_CREDENTIALS or the workload identity of the metadata server.
+type ReportUploadConfig struct {
+	// Provider is the object store, one of ObjectStoreS3 or ObjectStoreGCS.
+	Provider ObjectStoreProvider `json:"provider" yaml:"provider"`
+	// Bucket is the bucket objects are uploaded to.
+	Bucket string `json:"bucket" yaml:"bucket"`
+	// Prefix is prepended to the name of objects, for example runs/nightly/, files are uploaded with their base name.
+	Prefix string `json:"prefix" yaml:"prefix"`
+	// Endpoint is the URL of the object store, for example http://minio.minio.svc:9000, buckets are addressed in the
+	// path.
+	//
+	// Defaults to https://s3.<region>.amazonaws.com for S3 and DefaultGCSEndpoint for GCS.
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// Region is the region of the S3 bucket.
+	//
+	// Defaults to AWS_REGION, AWS_DEFAULT_REGION or DefaultAWSRegion.
+	Region string `json:"region" yaml:"region"`
+}
+
+func (c *ReportUploadConfig) validate() error {
+	if c.Provider != ObjectStoreS3 && c.Provider != ObjectStoreGCS {
+		return invalidErr("report.upload.provider", fmt.Errorf("unknown provider %q, expected one of %q or %q", c.Provider, ObjectStoreS3, ObjectStoreGCS))
+	}
+	if c.Bucket == "" {
+		return invalidErr("report.upload.bucket", errors.New("cannot be empty"))
+	}
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil {
+			return invalidErr("report.upload.endpoint", err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return invalidErr("report.upload.endpoint", fmt.Errorf("%q must be an http or https URL", c.Endpoint))
+		}
+	}
+	if c.Region != "" && c.Provider != ObjectStoreS3 {
+		return invalidErr("report.upload.region", fmt.Errorf("can only be used with provider %q", ObjectStoreS3))
+	}
+	return nil
+}
+
+// uploadObject is a file or an in-memory object to upload.
+type uploadObject struct {
+	name        string
+	contentType string
+	path        string
+	data        []byte
+}
+
+// uploadReports uploads the given JSON report together with the files written by report writers, the event log and the
+// lost events.
+func uploadReports(ctx context.Context, config ReportConfig, report Report, verificationErr error) error {
+	b := &bytes.Buffer{}
+	if err := writeJSONReport(b, report, verificationErr); err != nil {
+		return err
+	}
+	objects := []uploadObject{{name: UploadReportObject, contentType: "application/json", data: b.Bytes()}}
+	for _, w := range config.Writers {
+		objects = append(objects, uploadObject{name: filepath.Base(w.Path), contentType: reportContentType(w.Format), path: w.Path})
+	}
+	if config.EventLog != nil {
+		contentType := "application/x-ndjson"
+		if config.EventLog.Format == EventLogFormatCSV {
+			contentType = "text/csv"
+		}
+		files, err := outputFiles(config.EventLog.Path, config.EventLog.Shards)
+		if err != nil {
+			return fmt.Errorf("failed to upload event log: %w", err)
+		}
+		objects = append(objects, outputObjects(files, contentType)...)
+	}
+	if config.LostEvents != nil {
+		files, err := outputFiles(config.LostEvents.Path, config.LostEvents.Shards)
+		if err != nil {
+			return fmt.Errorf("failed to upload lost events: %w", err)
+		}
+		objects = append(objects, outputObjects(files, "application/x-ndjson")...)
+	}
+
+	store, err := newObjectStore(ctx, config.Upload)
+	if err != nil {
+		return fmt.Errorf("failed to upload reports to bucket %s: %w", config.Upload.Bucket, err)
+	}
+	defer store.close()
+	for _, o := range objects {
+		name := config.Upload.Prefix + o.name
+		if err := putObject(ctx, store, name, o); err != nil {
+			return fmt.Errorf("failed to upload %s to bucket %s: %w", name, config.Upload.Bucket, err)
+		}
+	}
+	return nil
+}
+
+// outputFiles returns the files of the output at the given path, the index and the files of its shards when it is
+// sharded.
+func outputFiles(path string, shards *OutputShardsConfig) ([]string, error) {
+	if shards == nil {
+		return []string{path}, nil
+	}
+	return shardedOutputFiles(path)
+}
+
+// outputObjects returns the objects uploading the given files, indexes are JSON.
+func outputObjects(files []string, contentType string) []uploadObject {
+	objects := make([]uploadObject, 0, len(files))
+	for _, f := range files {
+		ct := contentType
+		if strings.HasSuffix(f, ".index.json") {
+			ct = "application/json"
+		}
+		objects = append(objects, uploadObject{name: filepath.Base(f), contentType: ct, path: f})
+	}
+	return objects
+}
+
+func reportContentType(format ReportFormat) string {
+	switch format {
+	case ReportFormatJUnit:
+		return "application/xml"
+	case ReportFormatHTML:
+		return "text/html"
+	default:
+		return "application/json"
+	}
+}
+
+func putObject(ctx context.Context, store objectStore, name string, o uploadObject) error {
+	if o.path == "" {
+		return store.put(ctx, name, o.contentType, bytes.NewReader(o.data), int64(len(o.data)))
+	}
+	f, err := os.Open(o.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return store.put(ctx, name, o.contentType, f, info.Size())
+}
+
+// objectStore uploads objects to a bucket.
+type objectStore interface {
+	put(ctx context.Context, name string, contentType string, body io.ReadSeeker, size int64) error
+	close() error
+}
+
+func newObjectStore(ctx context.Context, config *ReportUploadConfig) (objectStore, error) {
+	if config.Provider == ObjectStoreGCS {
+		return newGCSStore(ctx, config.Bucket, config.Endpoint)
+	}
+	return newS3Store(ctx, config.Bucket, config.Endpoint, config.Region)
+}
+
+// newS3Store returns the store of the given S3 bucket, the endpoint and the region default as documented by
+// ReportUploadConfig.
+func newS3Store(ctx context.Context, bucket, endpoint, region string) (*s3Store, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = DefaultAWSRegion
+	}
+	// AWS_ENDPOINT_URL_STS overrides the endpoint of the web identity exchange, like newer SDKs do.
+	stsEndpoint := os.Getenv("AWS_ENDPOINT_URL_STS")
+	resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		switch {
+		case service == s3.ServiceID && endpoint != "":
+			return aws.Endpoint{URL: endpoint, SigningRegion: region}, nil
+		case service == sts.ServiceID && stsEndpoint != "":
+			return aws.Endpoint{URL: stsEndpoint, SigningRegion: region}, nil
+		}
+		return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+	})
+	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+		awsconfig.WithRegion(region),
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(5*time.Minute)),
+		awsconfig.WithEndpointResolverWithOptions(resolver),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	// Credentials are retrieved upfront so that missing credentials fail before any upload.
+	if _, err := cfg.Credentials.Retrieve(ctx); err != nil {
+		return nil, fmt.Errorf("failed to retrieve AWS credentials: %w", err)
+	}
+	return &s3Store{
+		bucket: bucket,
+		client: s3.NewFromConfig(cfg, func(o *s3.Options) {
+			o.UsePathStyle = endpoint != ""
+		}),
+	}, nil
+}
+
+// s3Store uploads objects with the S3 API, buckets are addressed in the path with a custom endpoint.
+type s3Store struct {
+	bucket string
+	client *s3.Client
+}
+
+func (s *s3Store) put(ctx context.Context, name string, contentType string, body io.ReadSeeker, size int64) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(name),
+		Body:          body,
+		ContentLength: size,
+		ContentType:   aws.String(contentType),
+	})
+	return err
+}
+
+func (s *s3Store) close() error {
+	return nil
+}
+
+// newGCSStore returns the store of the given GCS bucket, credentials are the access token of GOOGLE_OAUTH_ACCESS_TOKEN
+// or the application default credentials.
+func newGCSStore(ctx context.Context, bucket, endpoint string) (*gcsStore, error) {
+	var opts []option.ClientOption
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		opts = append(opts, option.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})))
+	}
+	if endpoint != "" {
+		opts = append(opts, option.WithEndpoint(strings.TrimSuffix(endpoint, "/")+"/storage/v1/"))
+	}
+	client, err := storage.NewClient(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCS client: %w", err)
+	}
+	return &gcsStore{bucket: client.Bucket(bucket), client: client}, nil
+}
+
+// gcsStore uploads objects with the Cloud Storage client.
+type gcsStore struct {
+	bucket *storage.BucketHandle
+	client *storage.Client
+}
+
+func (s *gcsStore) put(ctx context.Context, name string, contentType string, body io.ReadSeeker, _ int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	w := s.bucket.Object(name).NewWriter(ctx)
+	w.ContentType = contentType
+	if _, err := io.Copy(w, body); err != nil {
+		// Canceling the context aborts the upload.
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *gcsStore) close() error {
+	return s.client.Close()
+}
+
+// checkHTTPResponse returns an error when the given response is not successful.
+func checkHTTPResponse(resp *http.Response) error {
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, msg)
+	}
+	return nil
+}
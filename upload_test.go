@@ -0,0 +1,263 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// objectStoreServer records the objects uploaded to it.
+type objectStoreServer struct {
+	lock    sync.Mutex
+	objects map[string]string
+	headers map[string]http.Header
+}
+
+func newObjectStoreServer(t *testing.T, name func(r *http.Request) string) (*httptest.Server, *objectStoreServer) {
+	s := &objectStoreServer{objects: make(map[string]string), headers: make(map[string]http.Header)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil || int64(len(b)) != r.ContentLength {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		n := name(r)
+		s.objects[n] = string(b)
+		s.headers[n] = r.Header
+	}))
+	t.Cleanup(server.Close)
+	return server, s
+}
+
+// names returns the sorted names of the uploaded objects.
+func (s *objectStoreServer) names() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := make([]string, 0, len(s.objects))
+	for n := range s.objects {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeUploadedFiles writes a JSON report with a writer and an event log and returns the report config.
+func writeUploadedFiles(t *testing.T, upload *ReportUploadConfig) ReportConfig {
+	dir := t.TempDir()
+	config := ReportConfig{
+		Writers:  []ReportWriterConfig{{Format: ReportFormatJUnit, Path: filepath.Join(dir, "junit.xml")}},
+		EventLog: &EventLogConfig{Path: filepath.Join(dir, "events.csv"), Format: EventLogFormatCSV},
+		Upload:   upload,
+	}
+	if err := os.WriteFile(config.EventLog.Path, []byte("kind,id\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestWriteReportsUploadS3(t *testing.T) {
+	server, s := newObjectStoreServer(t, func(r *http.Request) string {
+		if r.Method != http.MethodPut {
+			return "unexpected method " + r.Method
+		}
+		return r.URL.Path
+	})
+	t.Setenv("AWS_ACCESS_KEY_ID", "minio")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "minio123")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	upload := &ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Prefix: "runs/1/", Endpoint: server.URL}
+	if err := upload.validate(); err != nil {
+		t.Fatal(err)
+	}
+	config := writeUploadedFiles(t, upload)
+	if err := writeReports(config, Report{LostCount: 1}, errors.New("lost count: 1")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"/reports/runs/1/events.csv", "/reports/runs/1/junit.xml", "/reports/runs/1/report.json"}
+	if diff := cmp.Diff(want, s.names()); diff != "" {
+		t.Fatalf("unexpected objects (-want, +got) %s", diff)
+	}
+	if got := s.objects["/reports/runs/1/events.csv"]; got != "kind,id\n" {
+		t.Errorf("unexpected event log object %q", got)
+	}
+	if got := s.objects["/reports/runs/1/report.json"]; !strings.Contains(got, `"lostCount": 1`) || !strings.Contains(got, `"passed": false`) {
+		t.Errorf("unexpected report object %s", got)
+	}
+	h := s.headers["/reports/runs/1/report.json"]
+	if auth := h.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") || !strings.Contains(auth, "/us-east-1/s3/aws4_request") {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+	if h.Get("Content-Type") != "application/json" || h.Get("X-Amz-Content-Sha256") == "" {
+		t.Errorf("unexpected headers %v", h)
+	}
+}
+
+func TestWriteReportsUploadS3WebIdentity(t *testing.T) {
+	var gotForm map[string][]string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		gotForm = r.Form
+		fmt.Fprint(w, `<AssumeRoleWithWebIdentityResponse><AssumeRoleWithWebIdentityResult><Credentials>`+
+			`<AccessKeyId>ASIA</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>session</SessionToken>`+
+			`<Expiration>2100-01-01T00:00:00Z</Expiration>`+
+			`</Credentials></AssumeRoleWithWebIdentityResult></AssumeRoleWithWebIdentityResponse>`)
+	}))
+	defer sts.Close()
+	server, s := newObjectStoreServer(t, func(r *http.Request) string { return r.URL.Path })
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("jwt"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/sacura")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	t.Setenv("AWS_ENDPOINT_URL_STS", sts.URL)
+
+	config := ReportConfig{Upload: &ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Endpoint: server.URL, Region: "eu-west-1"}}
+	if err := writeReports(config, Report{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotForm["Action"][0] != "AssumeRoleWithWebIdentity" || gotForm["WebIdentityToken"][0] != "jwt" || gotForm["RoleArn"][0] != "arn:aws:iam::123456789012:role/sacura" {
+		t.Errorf("unexpected STS request %v", gotForm)
+	}
+	h := s.headers["/reports/report.json"]
+	if auth := h.Get("Authorization"); !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=ASIA/") || !strings.Contains(auth, "/eu-west-1/s3/") {
+		t.Errorf("unexpected authorization %q", auth)
+	}
+	if got := h.Get("X-Amz-Security-Token"); got != "session" {
+		t.Errorf("want session token, got %q", got)
+	}
+}
+
+func TestWriteReportsUploadGCS(t *testing.T) {
+	metadata := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Metadata-Flavor") != "Google" || r.URL.Path != "/computeMetadata/v1/instance/service-accounts/default/token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "ya29", "expires_in": 3600, "token_type": "Bearer"})
+	}))
+	defer metadata.Close()
+
+	// Objects are uploaded with multipart requests, the metadata part and the media part.
+	var lock sync.Mutex
+	objects := make(map[string]string)
+	contentTypes := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/upload/storage/v1/b/reports/o" || r.Header.Get("Authorization") != "Bearer ya29" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var object struct {
+			Name        string `json:"name"`
+			ContentType string `json:"contentType"`
+		}
+		p, err := mr.NextPart()
+		if err == nil {
+			err = json.NewDecoder(p).Decode(&object)
+		}
+		if err == nil {
+			p, err = mr.NextPart()
+		}
+		var media []byte
+		if err == nil {
+			media, err = io.ReadAll(p)
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		lock.Lock()
+		objects[object.Name] = string(media)
+		contentTypes[object.Name] = object.ContentType
+		lock.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]string{"bucket": "reports", "name": object.Name})
+	}))
+	defer server.Close()
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "")
+	t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", "")
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(metadata.URL, "http://"))
+
+	upload := &ReportUploadConfig{Provider: ObjectStoreGCS, Bucket: "reports", Prefix: "runs/1/", Endpoint: server.URL}
+	config := writeUploadedFiles(t, upload)
+	if err := writeReports(config, Report{}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	want := map[string]string{"runs/1/events.csv": "text/csv", "runs/1/junit.xml": "application/xml", "runs/1/report.json": "application/json"}
+	if diff := cmp.Diff(want, contentTypes); diff != "" {
+		t.Fatalf("unexpected objects (-want, +got) %s", diff)
+	}
+	if got := objects["runs/1/events.csv"]; got != "kind,id\n" {
+		t.Errorf("unexpected event log object %q", got)
+	}
+}
+
+func TestWriteReportsUploadNoCredentials(t *testing.T) {
+	for _, env := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_PROFILE"} {
+		t.Setenv(env, "")
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	t.Setenv("AWS_CONFIG_FILE", missing)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", missing)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	config := ReportConfig{Upload: &ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Endpoint: "http://localhost:1"}}
+	if err := writeReports(config, Report{}, nil); err == nil || !strings.Contains(err.Error(), "failed to retrieve AWS credentials") {
+		t.Errorf("want missing credentials error, got %v", err)
+	}
+}
+
+func TestReportUploadConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ReportUploadConfig
+		wantErr bool
+	}{
+		{name: "s3", config: ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Region: "eu-west-1"}},
+		{name: "minio", config: ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Endpoint: "http://minio:9000"}},
+		{name: "gcs", config: ReportUploadConfig{Provider: ObjectStoreGCS, Bucket: "reports", Prefix: "runs/"}},
+		{name: "unknown provider", config: ReportUploadConfig{Provider: "azure", Bucket: "reports"}, wantErr: true},
+		{name: "no bucket", config: ReportUploadConfig{Provider: ObjectStoreS3}, wantErr: true},
+		{name: "invalid endpoint", config: ReportUploadConfig{Provider: ObjectStoreS3, Bucket: "reports", Endpoint: "minio:9000"}, wantErr: true},
+		{name: "region with gcs", config: ReportUploadConfig{Provider: ObjectStoreGCS, Bucket: "reports", Region: "eu-west-1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
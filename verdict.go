@@ -0,0 +1,144 @@
+package sacura
+
+import (
+	"errors"
+	"sort"
+)
+
+// VerdictResult is the result of the verification of a report.
+type VerdictResult string
+
+const (
+	VerdictPass VerdictResult = "Pass"
+	VerdictFail VerdictResult = "Fail"
+)
+
+// VerdictReason is a class of verification failures, so that automation can branch on the failure class without
+// parsing the verification error.
+type VerdictReason string
+
+const (
+	// VerdictReasonLossExceeded is reported when events are lost beyond the delivery guarantee, the lost percentage
+	// or the loss budget.
+	VerdictReasonLossExceeded VerdictReason = "LOSS_EXCEEDED"
+	// VerdictReasonDuplicatesFound is reported when duplicates are received beyond the delivery guarantee, the
+	// duplicates percentage or the duplicate budget.
+	VerdictReasonDuplicatesFound VerdictReason = "DUPLICATES_FOUND"
+	// VerdictReasonOrderingViolation is reported when more events than verification.maxOrderingViolations are
+	// received out of order.
+	VerdictReasonOrderingViolation VerdictReason = "ORDERING_VIOLATION"
+	// VerdictReasonSenderErrors is reported when the target accepted no event or rejected the requests of an identity.
+	VerdictReasonSenderErrors VerdictReason = "SENDER_ERRORS"
+	// VerdictReasonTimeout is reported when more events than verification.maxExpiredEvents are not received within
+	// verification.maxDeliveryAge.
+	VerdictReasonTimeout VerdictReason = "TIMEOUT"
+	// VerdictReasonThresholdViolated is reported when the latency or the throughput thresholds are violated, the loss
+	// and the duplicate thresholds are reported as VerdictReasonLossExceeded and VerdictReasonDuplicatesFound.
+	VerdictReasonThresholdViolated VerdictReason = "THRESHOLD_VIOLATED"
+	// VerdictReasonStateWriteFailed is reported when events couldn't be written to state.path or state.redis, so
+	// that the report is incomplete.
+	VerdictReasonStateWriteFailed VerdictReason = "STATE_WRITE_FAILED"
+	// VerdictReasonOther is reported for the other verification failures, for example corrupted events.
+	VerdictReasonOther VerdictReason = "OTHER"
+)
+
+// verdictReasonsOrder is the order of reasons in a verdict.
+var verdictReasonsOrder = map[VerdictReason]int{
+	VerdictReasonLossExceeded:      0,
+	VerdictReasonDuplicatesFound:   1,
+	VerdictReasonOrderingViolation: 2,
+	VerdictReasonSenderErrors:      3,
+	VerdictReasonTimeout:           4,
+	VerdictReasonThresholdViolated: 5,
+	VerdictReasonStateWriteFailed:  6,
+	VerdictReasonOther:             7,
+}
+
+// Verdict is the outcome of the verification of a report.
+type Verdict struct {
+	Result VerdictResult `json:"result"`
+	// Reasons are the classes of the verification failures, they are empty when the verification passed.
+	Reasons []VerdictReason `json:"reasons,omitempty"`
+}
+
+// Verdict returns the outcome of the verification of the report.
+//
+// Reports that haven't been verified, like the reports of receive-only runs and of the instances of a distributed
+// test, pass.
+func (r Report) Verdict() Verdict {
+	if len(r.FailureReasons) == 0 {
+		return Verdict{Result: VerdictPass}
+	}
+	return Verdict{Result: VerdictFail, Reasons: append([]VerdictReason(nil), r.FailureReasons...)}
+}
+
+// verdictError is a verification failure of a class of failures.
+type verdictError struct {
+	reason VerdictReason
+	err    error
+}
+
+func (e *verdictError) Error() string {
+	return e.err.Error()
+}
+
+func (e *verdictError) Unwrap() error {
+	return e.err
+}
+
+// failure returns the given verification error classified with the given reason.
+func failure(reason VerdictReason, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &verdictError{reason: reason, err: err}
+}
+
+// budgetReason returns the class of the failures exceeding the given budget.
+func budgetReason(budget string) VerdictReason {
+	switch budget {
+	case BudgetLoss:
+		return VerdictReasonLossExceeded
+	case BudgetDuplicates:
+		return VerdictReasonDuplicatesFound
+	default:
+		return VerdictReasonOther
+	}
+}
+
+// failureReasons returns the classes of the given verification error of the given report. The exceeded budgets and
+// the violated thresholds of the report are included since they fail the verification regardless of the failure
+// reported by the error.
+func failureReasons(report Report, err error) []VerdictReason {
+	if err == nil {
+		return nil
+	}
+	reasons := make(map[VerdictReason]struct{})
+	var ve *verdictError
+	var te *ThresholdsError
+	if errors.As(err, &ve) {
+		reasons[ve.reason] = struct{}{}
+	} else if !errors.As(err, &te) {
+		reasons[VerdictReasonOther] = struct{}{}
+	}
+	for _, v := range report.BudgetViolations {
+		reasons[budgetReason(v.Budget)] = struct{}{}
+	}
+	for _, v := range report.ThresholdViolations {
+		switch v.Threshold {
+		case ThresholdMaxLostPercentage:
+			reasons[VerdictReasonLossExceeded] = struct{}{}
+		case ThresholdMaxDuplicatePercentage:
+			reasons[VerdictReasonDuplicatesFound] = struct{}{}
+		default:
+			reasons[VerdictReasonThresholdViolated] = struct{}{}
+		}
+	}
+
+	sorted := make([]VerdictReason, 0, len(reasons))
+	for r := range reasons {
+		sorted = append(sorted, r)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return verdictReasonsOrder[sorted[i]] < verdictReasonsOrder[sorted[j]] })
+	return sorted
+}
@@ -0,0 +1,102 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestReportVerdict(t *testing.T) {
+	if diff := cmp.Diff(Verdict{Result: VerdictPass}, (Report{}).Verdict()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+	report := Report{FailureReasons: []VerdictReason{VerdictReasonLossExceeded, VerdictReasonTimeout}}
+	want := Verdict{Result: VerdictFail, Reasons: []VerdictReason{VerdictReasonLossExceeded, VerdictReasonTimeout}}
+	if diff := cmp.Diff(want, report.Verdict()); diff != "" {
+		t.Error("(-want, +got)", diff)
+	}
+}
+
+func TestVerifyReportFailureReasons(t *testing.T) {
+	zero := 0
+	accepted := Metrics{AcceptedCount: 10}
+	tests := []struct {
+		name   string
+		config Config
+		report Report
+		want   []VerdictReason
+	}{
+		{
+			name:   "pass",
+			report: Report{Metrics: accepted, ReceivedCount: 10},
+		},
+		{
+			name:   "no accepted event",
+			report: Report{},
+			want:   []VerdictReason{VerdictReasonSenderErrors},
+		},
+		{
+			name:   "lost",
+			report: Report{Metrics: accepted, ReceivedCount: 9},
+			want:   []VerdictReason{VerdictReasonLossExceeded},
+		},
+		{
+			name:   "duplicates",
+			config: Config{DeliveryGuarantee: ExactlyOnce},
+			report: Report{Metrics: accepted, ReceivedCount: 10, DuplicateCount: 1},
+			want:   []VerdictReason{VerdictReasonDuplicatesFound},
+		},
+		{
+			name:   "retried duplicates",
+			config: Config{DeliveryGuarantee: AtLeastOnce},
+			report: Report{Metrics: accepted, ReceivedCount: 10, DuplicateCount: 1, Idempotency: &IdempotencyReport{RetriedCount: 1, DuplicateCount: 1}},
+			want:   []VerdictReason{VerdictReasonDuplicatesFound},
+		},
+		{
+			name:   "ordering violations",
+			config: Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}, Verification: VerificationConfig{MaxOrderingViolations: &zero}},
+			report: Report{Metrics: accepted, ReceivedCount: 10, OrderingViolationCount: 1},
+			want:   []VerdictReason{VerdictReasonOrderingViolation},
+		},
+		{
+			name:   "ordering violations without limit",
+			config: Config{Ordered: &OrderedConfig{NumPartitionKeys: 1}},
+			report: Report{Metrics: accepted, ReceivedCount: 10, OrderingViolationCount: 1},
+		},
+		{
+			name:   "expired",
+			config: Config{Verification: VerificationConfig{MaxExpiredEvents: &zero}},
+			report: Report{Metrics: accepted, ReceivedCount: 10, ExpiredCount: 1},
+			want:   []VerdictReason{VerdictReasonTimeout},
+		},
+		{
+			name:   "corrupted",
+			report: Report{Metrics: accepted, ReceivedCount: 10, CorruptedCount: 1},
+			want:   []VerdictReason{VerdictReasonOther},
+		},
+		{
+			name:   "lost and exceeded duplicate budget",
+			report: Report{Metrics: accepted, ReceivedCount: 9, BudgetViolations: []BudgetViolation{{Budget: BudgetDuplicates, Limit: "maxCount"}}},
+			want:   []VerdictReason{VerdictReasonLossExceeded, VerdictReasonDuplicatesFound},
+		},
+		{
+			name:   "thresholds",
+			config: Config{Thresholds: &ThresholdsConfig{ParsedMaxP99Latency: time.Second, MaxDuplicatePercentage: new(float64)}},
+			report: Report{Metrics: accepted, ReceivedCount: 10, DuplicateCount: 1, Latency: LatencyStats{P99: 2 * time.Second}},
+			want:   []VerdictReason{VerdictReasonDuplicatesFound, VerdictReasonThresholdViolated},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyReport(tt.config, &tt.report)
+			if (err != nil) != (len(tt.want) > 0) {
+				t.Fatalf("want failure %v, got %v", tt.want, err)
+			}
+			if diff := cmp.Diff(tt.want, tt.report.FailureReasons); diff != "" {
+				t.Error("(-want, +got)", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,153 @@
+package sacura
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// maxVerifierFailures is the maximum number of failures listed in the report of each verifier.
+const maxVerifierFailures = 100
+
+// Verifier plugs custom verification logic, for example domain-specific payload checks, into a test run with Run when
+// sacura is used as a library, see Config.Verifiers.
+type Verifier interface {
+	// Name is the name of the verifier in the report.
+	Name() string
+	// VerifyPair verifies a delivery of a received event against the event sent with the same ID, an error fails the
+	// test. It is called for each delivery, including redeliveries, once both events are known. Calls are serialized
+	// with the recording of events, they must be fast.
+	VerifyPair(sent, received ce.Event) error
+	// VerifyReport verifies the final report, an error fails the test.
+	VerifyReport(report Report) error
+}
+
+// VerifierReport reports the results of a Verifier.
+type VerifierReport struct {
+	// PairCount is the number of verified pairs of sent and received events.
+	PairCount int `json:"pairCount"`
+	// FailureCount is the number of pairs that failed the verification.
+	FailureCount int `json:"failureCount"`
+	// Failures are the first failures.
+	Failures []VerifierFailure `json:"failures,omitempty"`
+	// Error is the error of the verification of the final report.
+	Error string `json:"error,omitempty"`
+}
+
+// VerifierFailure is a pair of sent and received events that failed the verification of a Verifier.
+type VerifierFailure struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// verifiersState pairs sent and received events for the verifiers.
+type verifiersState struct {
+	verifiers []Verifier
+	reports   []VerifierReport
+	// sent are the sent events by ID.
+	sent map[string]ce.Event
+	// early are the deliveries of events received before being recorded as sent by ID.
+	early map[string][]ce.Event
+}
+
+// newVerifiersState returns the state of the given verifiers, it returns nil without verifiers.
+func newVerifiersState(verifiers []Verifier) *verifiersState {
+	if len(verifiers) == 0 {
+		return nil
+	}
+	return &verifiersState{
+		verifiers: verifiers,
+		reports:   make([]VerifierReport, len(verifiers)),
+		sent:      make(map[string]ce.Event),
+		early:     make(map[string][]ce.Event),
+	}
+}
+
+// recordSentPair records the given sent event and verifies the deliveries received before it, it must be called
+// while holding the lock.
+func (s *StateManager) recordSentPair(e *ce.Event) {
+	if s.verifiers == nil {
+		return
+	}
+	s.verifiers.sent[e.ID()] = *e
+	for _, received := range s.verifiers.early[e.ID()] {
+		s.verifiers.verify(*e, received)
+	}
+	delete(s.verifiers.early, e.ID())
+}
+
+// recordReceivedPair verifies the given delivery against the sent event, it must be called while holding the lock.
+func (s *StateManager) recordReceivedPair(e *ReceivedEvent) {
+	if s.verifiers == nil {
+		return
+	}
+	sent, ok := s.verifiers.sent[e.Event.ID()]
+	if !ok {
+		s.verifiers.early[e.Event.ID()] = append(s.verifiers.early[e.Event.ID()], e.Event)
+		return
+	}
+	s.verifiers.verify(sent, e.Event)
+}
+
+func (v *verifiersState) verify(sent, received ce.Event) {
+	for i, verifier := range v.verifiers {
+		r := &v.reports[i]
+		r.PairCount++
+		if err := verifier.VerifyPair(sent, received); err != nil {
+			r.FailureCount++
+			if len(r.Failures) < maxVerifierFailures {
+				r.Failures = append(r.Failures, VerifierFailure{ID: sent.ID(), Error: err.Error()})
+			}
+		}
+	}
+}
+
+// verifiersReport sets the verifiers section of the report, it must be called while holding the lock.
+func (s *StateManager) verifiersReport(r *Report) {
+	if s.verifiers == nil {
+		return
+	}
+	r.Verifiers = make(map[string]VerifierReport, len(s.verifiers.verifiers))
+	for i, verifier := range s.verifiers.verifiers {
+		report := s.verifiers.reports[i]
+		report.Failures = append([]VerifierFailure(nil), report.Failures...)
+		r.Verifiers[verifier.Name()] = report
+	}
+}
+
+// runReportVerifiers verifies the given final report with the verifiers of the given config and records their
+// errors in the report.
+func runReportVerifiers(config Config, report *Report) {
+	for _, verifier := range config.Verifiers {
+		err := verifier.VerifyReport(*report)
+		if err == nil {
+			continue
+		}
+		if report.Verifiers == nil {
+			report.Verifiers = make(map[string]VerifierReport, len(config.Verifiers))
+		}
+		r := report.Verifiers[verifier.Name()]
+		r.Error = err.Error()
+		report.Verifiers[verifier.Name()] = r
+	}
+}
+
+// verifyVerifiers verifies no pair of events nor the final report failed the verification of a Verifier.
+func verifyVerifiers(report Report) error {
+	var failed []string
+	for name, r := range report.Verifiers {
+		if r.FailureCount > 0 {
+			failed = append(failed, fmt.Sprintf("%s: %d events failed, listing first failures: %+v", name, r.FailureCount, r.Failures))
+		}
+		if r.Error != "" {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, r.Error))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("verifiers failed:\n%s", strings.Join(failed, "\n"))
+}
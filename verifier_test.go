@@ -0,0 +1,90 @@
+package sacura
+
+import (
+	"errors"
+	"testing"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/go-cmp/cmp"
+)
+
+type dataVerifier struct {
+	reportErr error
+}
+
+func (v *dataVerifier) Name() string {
+	return "data"
+}
+
+func (v *dataVerifier) VerifyPair(sent, received ce.Event) error {
+	if string(sent.Data()) != string(received.Data()) {
+		return errors.New("data mismatch")
+	}
+	return nil
+}
+
+func (v *dataVerifier) VerifyReport(Report) error {
+	return v.reportErr
+}
+
+func TestVerifiers(t *testing.T) {
+	verifier := &dataVerifier{}
+	config := Config{Verifiers: []Verifier{verifier}}
+	sm := newTestStateManager(t, config)
+
+	event := func(id, data string) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		_ = e.SetData(ce.TextPlain, data)
+		return e
+	}
+	sent := []ce.Event{event("1", "a"), event("2", "b"), event("3", "c")}
+	sm.lock.Lock()
+	sm.recordSent(&sent[0])
+	sm.recordSent(&sent[1])
+	sm.recordReceived(&ReceivedEvent{Event: sent[0]})
+	sm.recordReceived(&ReceivedEvent{Event: event("2", "corrupted")})
+	// Received before being recorded as sent.
+	sm.recordReceived(&ReceivedEvent{Event: sent[2]})
+	sm.recordSent(&sent[2])
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	want := map[string]VerifierReport{
+		"data": {
+			PairCount:    3,
+			FailureCount: 1,
+			Failures:     []VerifierFailure{{ID: "2", Error: "data mismatch"}},
+		},
+	}
+	if diff := cmp.Diff(want, report.Verifiers); diff != "" {
+		t.Fatal("(-want, +got)", diff)
+	}
+	if err := verifyVerifiers(report); err == nil {
+		t.Error("expected failed pairs to fail the verification")
+	}
+
+	verifier.reportErr = errors.New("unexpected latency")
+	runReportVerifiers(config, &report)
+	if got := report.Verifiers["data"].Error; got != "unexpected latency" {
+		t.Errorf("want report error %q, got %q", "unexpected latency", got)
+	}
+}
+
+func TestVerifiersUnset(t *testing.T) {
+	sm := newTestStateManager(t, Config{})
+	e := cetest.FullEvent()
+	sm.lock.Lock()
+	sm.recordSent(&e)
+	sm.recordReceived(&ReceivedEvent{Event: e})
+	sm.lock.Unlock()
+
+	report := sm.GenerateReport()
+	if report.Verifiers != nil {
+		t.Errorf("want no verifiers, got %+v", report.Verifiers)
+	}
+	if err := verifyVerifiers(report); err != nil {
+		t.Error(err)
+	}
+}
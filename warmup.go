@@ -0,0 +1,36 @@
+package sacura
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+)
+
+// WarmupExtension is the extension marking events sent during the sender warmup, these events are excluded from the
+// verification.
+const WarmupExtension = "sacurawarmup"
+
+func (c *SenderConfig) validateWarmup(duration time.Duration) error {
+	if c.Warmup == "" {
+		return nil
+	}
+	var err error
+	c.ParsedWarmup, err = time.ParseDuration(c.Warmup)
+	if err != nil {
+		return invalidErr("sender.warmup", err)
+	}
+	if c.ParsedWarmup <= 0 {
+		return invalidErr("sender.warmup", errors.New("must be greater than 0"))
+	}
+	if duration > 0 && c.ParsedWarmup >= duration {
+		return invalidErr("sender.warmup", fmt.Errorf("%v must be less than the duration %v", c.ParsedWarmup, duration))
+	}
+	return nil
+}
+
+func isWarmupEvent(e *ce.Event) bool {
+	v, ok := e.Extensions()[WarmupExtension]
+	return ok && fmt.Sprint(v) == "true"
+}
@@ -0,0 +1,136 @@
+package sacura
+
+import (
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"github.com/google/uuid"
+	vegeta "github.com/tsenart/vegeta/v12/lib"
+)
+
+func TestSenderConfigValidateWarmup(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		warmup  string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name: "no warmup",
+		},
+		{
+			name:   "warmup",
+			warmup: "10s",
+			want:   10 * time.Second,
+		},
+		{
+			name:    "invalid warmup",
+			warmup:  "10",
+			wantErr: true,
+		},
+		{
+			name:    "negative warmup",
+			warmup:  "-10s",
+			wantErr: true,
+		},
+		{
+			name:    "warmup longer than the duration",
+			warmup:  "1m",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := SenderConfig{Warmup: tt.warmup}
+			err := c.validateWarmup(time.Minute)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if !tt.wantErr && c.ParsedWarmup != tt.want {
+				t.Errorf("expected warmup %v, got %v", tt.want, c.ParsedWarmup)
+			}
+		})
+	}
+}
+
+func TestNewTargeterGeneratorWarmup(t *testing.T) {
+
+	out := make(chan ce.Event, 2)
+	config := Config{Sender: SenderConfig{Target: "http://localhost:9090", ParsedWarmup: 50 * time.Millisecond}}
+	f := NewTargeterGenerator(config, uuid.New, out)
+
+	if err := f(&vegeta.Target{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-out; !isWarmupEvent(&e) {
+		t.Errorf("expected event sent during the warmup to be marked, got %v", e.Extensions())
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if err := f(&vegeta.Target{}); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-out; isWarmupEvent(&e) {
+		t.Errorf("expected event sent after the warmup not to be marked, got %v", e.Extensions())
+	}
+}
+
+func TestStateManagerWarmup(t *testing.T) {
+
+	sent := make(chan ce.Event, 4)
+	received := make(chan ReceivedEvent, 4)
+
+	sm := newTestStateManager(t, Config{})
+	receivedSignal := sm.ReadReceived(received)
+	sentSignal := sm.ReadSent(sent)
+
+	event := func(id string, warmup bool) ce.Event {
+		e := cetest.FullEvent()
+		e.SetID(id)
+		e.SetExtension(BenchmarkTimestampAttribute, "0")
+		if warmup {
+			e.SetExtension(WarmupExtension, "true")
+		}
+		return e
+	}
+	// Warmup events "w1" and "w2" are lost and duplicated, with a latency way higher than "1" and "2".
+	for _, e := range []ce.Event{event("w1", true), event("w2", true), event("1", false), event("2", false)} {
+		sent <- e
+	}
+	now := time.UnixMilli(0)
+	for _, r := range []ReceivedEvent{
+		{Event: event("w2", true), ReceivedAt: now.Add(time.Hour)},
+		{Event: event("w2", true), ReceivedAt: now.Add(time.Hour)},
+		{Event: event("1", false), ReceivedAt: now.Add(time.Millisecond)},
+		{Event: event("2", false), ReceivedAt: now.Add(time.Millisecond)},
+	} {
+		received <- r
+	}
+	close(sent)
+	close(received)
+	<-receivedSignal
+	<-sentSignal
+
+	if diff := sm.Diff(); !diff.Empty() {
+		t.Errorf("expected warmup events to be excluded from the diff, got %s", diff)
+	}
+
+	sm.Terminated(Metrics{AcceptedCount: 2, WarmupAcceptedCount: 2})
+	report := sm.GenerateReport()
+	if report.LostCount != 0 || report.DuplicateCount != 0 || report.ReceivedCount != 2 {
+		t.Errorf("expected warmup events to be excluded, got lost %d, duplicates %d, received %d", report.LostCount, report.DuplicateCount, report.ReceivedCount)
+	}
+	if report.WarmupSentCount != 2 || report.WarmupReceivedCount != 2 {
+		t.Errorf("expected 2 warmup events sent and received, got %d and %d", report.WarmupSentCount, report.WarmupReceivedCount)
+	}
+	if report.Latency.Max != time.Millisecond {
+		t.Errorf("expected warmup events to be excluded from latency, got %+v", report.Latency)
+	}
+	if err := verify(Config{DeliveryGuarantee: ExactlyOnce}, report); err != nil {
+		t.Error("expected warmup events not to fail the verification", err)
+	}
+}
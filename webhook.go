@@ -0,0 +1,130 @@
+package sacura
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+type WebhookFormat string
+
+const (
+	// WebhookFormatJSON posts the summary of the report as JSON, with the passed and error fields.
+	WebhookFormatJSON WebhookFormat = "json"
+	// WebhookFormatSlack posts a message compatible with Slack incoming webhooks.
+	WebhookFormatSlack WebhookFormat = "slack"
+
+	// maxWebhookErrorSize bounds the verification error in notifications, since it may list events.
+	maxWebhookErrorSize = 2048
+)
+
+// WebhookConfig posts the outcome of the test to a webhook once the report is written, so that teams get notified
+// when long soak tests finish or fail.
+type WebhookConfig struct {
+	// URL is the URL the notification is posted to.
+	URL string `json:"url" yaml:"url"`
+	// URLFile is the path of a file containing the URL, it is an alternative to URL for webhooks with a secret URL,
+	// like Slack incoming webhooks.
+	URLFile string `json:"urlFile" yaml:"urlFile"`
+	// Format is the format of the notification, one of WebhookFormatJSON or WebhookFormatSlack.
+	//
+	// Defaults to WebhookFormatJSON.
+	Format WebhookFormat `json:"format" yaml:"format"`
+	// OnFailure posts the notification only when the verification fails.
+	OnFailure bool `json:"onFailure" yaml:"onFailure"`
+}
+
+func (c *WebhookConfig) validate(field string) error {
+	if (c.URL == "") == (c.URLFile == "") {
+		return invalidErr(field, errors.New("exactly one of url or urlFile must be specified"))
+	}
+	if c.URL != "" {
+		if u, err := url.Parse(c.URL); err != nil || !u.IsAbs() {
+			return invalidErr(field+".url", fmt.Errorf("%q must be an absolute URL: %v", c.URL, err))
+		}
+	}
+	switch c.Format {
+	case "":
+		c.Format = WebhookFormatJSON
+	case WebhookFormatJSON, WebhookFormatSlack:
+	default:
+		return invalidErr(field+".format", fmt.Errorf("unknown format %q, expected one of %q or %q", c.Format, WebhookFormatJSON, WebhookFormatSlack))
+	}
+	return nil
+}
+
+// notifyWebhooks posts the outcome of the given report to the given webhooks.
+func notifyWebhooks(ctx context.Context, webhooks []WebhookConfig, report Report, verificationErr error) error {
+	summary := newReportSummary(report, verificationErr, maxWebhookErrorSize)
+	client := &http.Client{Timeout: 30 * time.Second}
+	for i := range webhooks {
+		w := &webhooks[i]
+		if w.OnFailure && verificationErr == nil {
+			continue
+		}
+		if err := postWebhook(ctx, client, w, summary); err != nil {
+			return fmt.Errorf("failed to notify webhook %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func postWebhook(ctx context.Context, client *http.Client, config *WebhookConfig, summary reportSummary) error {
+	u := config.URL
+	if config.URLFile != "" {
+		b, err := os.ReadFile(config.URLFile)
+		if err != nil {
+			return fmt.Errorf("failed to read webhook URL: %w", err)
+		}
+		u = strings.TrimSpace(string(b))
+	}
+
+	var payload interface{} = summary
+	if config.Format == WebhookFormatSlack {
+		payload = map[string]string{"text": slackMessage(summary)}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		// The URL may be secret, errors of the client include it.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return urlErr.Err
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	return checkHTTPResponse(resp)
+}
+
+// slackMessage returns the text of the Slack message of the given summary.
+func slackMessage(s reportSummary) string {
+	b := &strings.Builder{}
+	if s.Passed {
+		b.WriteString(":white_check_mark: sacura passed")
+	} else {
+		b.WriteString(":x: sacura failed")
+	}
+	fmt.Fprintf(b, "\naccepted %d, received %d, lost %d, duplicates %d, unexpected %d, corrupted %d, dead-lettered %d",
+		s.AcceptedCount, s.ReceivedCount, s.LostCount, s.DuplicateCount, s.UnexpectedCount, s.CorruptedCount, s.DeadLetteredCount)
+	if s.Error != "" {
+		fmt.Fprintf(b, "\n```%s```", s.Error)
+	}
+	return b.String()
+}
@@ -0,0 +1,128 @@
+package sacura
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWriteReportsWebhooks(t *testing.T) {
+	var bodies []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(b, &body) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body["path"] = r.URL.Path
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	urlFile := filepath.Join(t.TempDir(), "url")
+	if err := os.WriteFile(urlFile, []byte(server.URL+"/slack\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config := ReportConfig{Webhooks: []WebhookConfig{
+		{URL: server.URL + "/json"},
+		{URLFile: urlFile, Format: WebhookFormatSlack},
+		{URL: server.URL + "/failures", OnFailure: true},
+	}}
+	for i := range config.Webhooks {
+		if err := config.Webhooks[i].validate("report.webhooks"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	report := Report{ReceivedCount: 9, LostCount: 1}
+	report.Metrics.AcceptedCount = 10
+	if err := writeReports(config, report, nil); err != nil {
+		t.Fatal(err)
+	}
+	want := []map[string]interface{}{
+		{
+			"path":              "/json",
+			"passed":            true,
+			"acceptedCount":     float64(10),
+			"receivedCount":     float64(9),
+			"lostCount":         float64(1),
+			"duplicateCount":    float64(0),
+			"unexpectedCount":   float64(0),
+			"corruptedCount":    float64(0),
+			"deadLetteredCount": float64(0),
+		},
+		{
+			"path": "/slack",
+			"text": ":white_check_mark: sacura passed\naccepted 10, received 9, lost 1, duplicates 0, unexpected 0, corrupted 0, dead-lettered 0",
+		},
+	}
+	if diff := cmp.Diff(want, bodies); diff != "" {
+		t.Fatalf("unexpected notifications (-want, +got) %s", diff)
+	}
+
+	bodies = nil
+	if err := writeReports(config, report, errors.New("lost count: 1")); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 3 || bodies[2]["path"] != "/failures" || bodies[2]["error"] != "lost count: 1" {
+		t.Errorf("want failures notified, got %v", bodies)
+	}
+	if text := bodies[1]["text"].(string); !strings.HasPrefix(text, ":x: sacura failed") || !strings.Contains(text, "lost count: 1") {
+		t.Errorf("unexpected Slack message %q", text)
+	}
+}
+
+func TestWriteReportsWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	config := ReportConfig{Webhooks: []WebhookConfig{{URL: server.URL + "/secret", Format: WebhookFormatJSON}}}
+	if err := writeReports(config, Report{}, nil); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("want status code error, got %v", err)
+	}
+
+	server.Close()
+	err := writeReports(config, Report{}, nil)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("want an error without the URL, got %v", err)
+	}
+}
+
+func TestWebhookConfigValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     WebhookConfig
+		wantFormat WebhookFormat
+		wantErr    bool
+	}{
+		{name: "default format", config: WebhookConfig{URL: "https://example.com/hook"}, wantFormat: WebhookFormatJSON},
+		{name: "slack", config: WebhookConfig{URLFile: "/etc/sacura/slack", Format: WebhookFormatSlack}, wantFormat: WebhookFormatSlack},
+		{name: "no url", config: WebhookConfig{}, wantErr: true},
+		{name: "url and url file", config: WebhookConfig{URL: "https://example.com/hook", URLFile: "/etc/sacura/slack"}, wantErr: true},
+		{name: "relative url", config: WebhookConfig{URL: "/hook"}, wantErr: true},
+		{name: "unknown format", config: WebhookConfig{URL: "https://example.com/hook", Format: "teams"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate("report.webhooks[0]")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err == nil && tt.config.Format != tt.wantFormat {
+				t.Errorf("want format %q, got %q", tt.wantFormat, tt.config.Format)
+			}
+		})
+	}
+}
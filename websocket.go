@@ -0,0 +1,430 @@
+package sacura
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	ceformat "github.com/cloudevents/sdk-go/v2/binding/format"
+	"golang.org/x/net/websocket"
+)
+
+// ReceiverWebSocketConfig configures how the receiver gets the events pushed over WebSocket connections.
+type ReceiverWebSocketConfig struct {
+	// URL is the ws:// or wss:// URL of the gateway the receiver connects to, the receiver receives the events the
+	// gateway pushes on the connection.
+	//
+	// When not specified, the receiver accepts WebSocket connections on receiver.port and receives the events sent on
+	// them.
+	URL string `json:"url" yaml:"url"`
+}
+
+const (
+	// wsSubprotocol is the subprotocol of the CloudEvents WebSocket protocol binding with the JSON event format, every
+	// message is an event in the structured content mode.
+	wsSubprotocol = "cloudevents.json"
+
+	// wsMaxMessageSize bounds the size of received messages.
+	wsMaxMessageSize = 64 << 20
+
+	wsHandshakeTimeout = 30 * time.Second
+)
+
+func validateWebSocketURL(field, target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return invalidErr(field, err)
+	}
+	if (u.Scheme != "ws" && u.Scheme != "wss") || u.Hostname() == "" {
+		return invalidErr(field, fmt.Errorf("%q must be a ws:// or wss:// URL", target))
+	}
+	return nil
+}
+
+func (c *SenderConfig) validateWebSocket() error {
+	if err := validateWebSocketURL("sender.target", c.Target); err != nil {
+		return err
+	}
+	if c.BatchSize > 1 {
+		return invalidErr("sender.batchSize", fmt.Errorf("batches are not supported with the %s protocol", ProtocolWebSocket))
+	}
+	return nil
+}
+
+func (c *ReceiverConfig) validateWebSocket() error {
+	if c.DeadLetterSinkPath != "" {
+		return invalidErr("receiver.deadLetterSinkPath", fmt.Errorf("the dead-letter sink is not supported with the %s protocol", ProtocolWebSocket))
+	}
+	if c.WebSocket == nil || c.WebSocket.URL == "" {
+		return nil
+	}
+	if err := validateWebSocketURL("receiver.webSocket.url", c.WebSocket.URL); err != nil {
+		return err
+	}
+	if c.TLS != nil {
+		return invalidErr("receiver.tls", fmt.Errorf("the receiver doesn't terminate TLS when it connects to a gateway, use a wss:// URL"))
+	}
+	if c.Auth != nil {
+		return invalidErr("receiver.auth", errors.New("bearer tokens are not supported when the receiver connects to a gateway"))
+	}
+	return nil
+}
+
+// newWebSocketServer returns a server completing the opening handshake of the connections and passing them to the
+// given handler. The handshake is rejected when the client doesn't offer the subprotocol of the JSON event format,
+// clients offering no subprotocol are assumed to send JSON.
+func newWebSocketServer(handler func(*websocket.Conn)) websocket.Server {
+	return websocket.Server{
+		Handshake: func(config *websocket.Config, r *http.Request) error {
+			if len(config.Protocol) == 0 {
+				return nil
+			}
+			for _, p := range config.Protocol {
+				if p == wsSubprotocol {
+					config.Protocol = []string{wsSubprotocol}
+					return nil
+				}
+			}
+			logger(LogComponentReceiver).Warnw("Rejected WebSocket handshake", "remoteAddr", r.RemoteAddr, "protocols", config.Protocol)
+			return fmt.Errorf("unsupported subprotocols %v, expected %s", config.Protocol, wsSubprotocol)
+		},
+		Handler: func(c *websocket.Conn) {
+			c.MaxPayloadBytes = wsMaxMessageSize
+			handler(c)
+		},
+	}
+}
+
+// dialWebSocket connects to the given ws:// or wss:// URL offering the subprotocol of the JSON event format, hdr are
+// additional headers of the handshake.
+func dialWebSocket(ctx context.Context, target string, tlsConfig *tls.Config, hdr http.Header) (*websocket.Conn, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	origin := "http://" + u.Host
+	if u.Scheme == "wss" {
+		origin = "https://" + u.Host
+	}
+	config, err := websocket.NewConfig(target, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Protocol = []string{wsSubprotocol}
+	if hdr != nil {
+		config.Header = hdr.Clone()
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, wsHandshakeTimeout)
+	defer cancel()
+
+	addr := u.Host
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		addr = net.JoinHostPort(u.Hostname(), port)
+	}
+	d := net.Dialer{}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		tc := &tls.Config{}
+		if tlsConfig != nil {
+			tc = tlsConfig.Clone()
+		}
+		if tc.ServerName == "" {
+			tc.ServerName = u.Hostname()
+		}
+		tlsConn := tls.Client(conn, tc)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c, err := websocket.NewClient(config, conn)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("WebSocket handshake with %s failed: %w", target, err)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	c.MaxPayloadBytes = wsMaxMessageSize
+	return c, nil
+}
+
+// wsEvent returns the event of a message in the structured content mode.
+func wsEvent(msg []byte) (*ce.Event, error) {
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(msg, &e); err != nil {
+		return nil, err
+	}
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// webSocketBinding is the protocolBinding of ProtocolWebSocket.
+type webSocketBinding struct{}
+
+func (webSocketBinding) validateSender(c *SenderConfig) error {
+	return c.validateWebSocket()
+}
+
+func (webSocketBinding) validateReceiver(c *ReceiverConfig) error {
+	return c.validateWebSocket()
+}
+
+func (webSocketBinding) newTransport(config *Config) senderTransport {
+	return newWebSocketTransport(config)
+}
+
+func (webSocketBinding) startReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	return startWebSocketReceiver(ctx, config, h)
+}
+
+func (webSocketBinding) resumes() bool {
+	return false
+}
+
+// webSocketTransport is an http.RoundTripper sending the events of the requests built by the targeter as messages of a
+// WebSocket connection, so that events sent with WebSocket are paced, measured and accounted for like with HTTP.
+//
+// Events are accepted once they are written to the connection since the binding has no acknowledgements.
+type webSocketTransport struct {
+	target    string
+	tlsConfig *tls.Config
+
+	lock sync.Mutex
+	conn *websocket.Conn
+	// closed is closed once the connection is lost.
+	closed chan struct{}
+}
+
+func newWebSocketTransport(config *Config) *webSocketTransport {
+	t := &webSocketTransport{target: config.Sender.Target}
+	if config.Sender.TLS != nil {
+		t.tlsConfig = config.Sender.TLS.Parsed
+	}
+	return t
+}
+
+func (t *webSocketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	e := ce.NewEvent()
+	if err := ceformat.JSON.Unmarshal(body, &e); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal event: %w", err)
+	}
+
+	c, err := t.connect(req)
+	if err != nil {
+		return nil, err
+	}
+	// Events are sent in the structured content mode as text messages.
+	if err := websocket.Message.Send(c, string(body)); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	return acceptedResponse(req), nil
+}
+
+// connect returns the connection, the target is dialed again when the connection has been lost. The handshake carries
+// the Authorization header of the request opening the connection.
+func (t *webSocketTransport) connect(req *http.Request) (*websocket.Conn, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn != nil {
+		select {
+		case <-t.closed:
+		default:
+			return t.conn, nil
+		}
+	}
+	hdr := http.Header{}
+	if v := req.Header.Get("Authorization"); v != "" {
+		hdr.Set("Authorization", v)
+	}
+	c, err := dialWebSocket(req.Context(), t.target, t.tlsConfig, hdr)
+	if err != nil {
+		return nil, err
+	}
+	closed := make(chan struct{})
+	// Messages of the target are discarded, reading them answers pings and detects closed connections.
+	go func() {
+		defer close(closed)
+		var msg []byte
+		for {
+			if err := websocket.Message.Receive(c, &msg); err != nil && !errors.Is(err, websocket.ErrFrameTooLarge) {
+				_ = c.Close()
+				return
+			}
+		}
+	}()
+	t.conn, t.closed = c, closed
+	return c, nil
+}
+
+func (t *webSocketTransport) close() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.conn != nil {
+		_ = t.conn.Close()
+	}
+}
+
+// startWebSocketReceiver receives the events sent on WebSocket connections until the given context is done, either
+// accepting connections on the receiver port or connecting to the configured gateway.
+//
+// The binding has no acknowledgements, events failing the handler are logged and they aren't delivered again.
+func startWebSocketReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	if config.WebSocket != nil && config.WebSocket.URL != "" {
+		return dialWebSocketReceiver(ctx, config, h)
+	}
+
+	var tlsConfig *tls.Config
+	if config.TLS != nil {
+		tlsConfig = config.TLS.Parsed
+	}
+
+	var wg sync.WaitGroup
+	s := http.Server{
+		Addr:      fmt.Sprintf(":%d", config.Port),
+		TLSConfig: tlsConfig,
+		Handler: newWebSocketServer(func(c *websocket.Conn) {
+			wg.Add(1)
+			defer wg.Done()
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-ctx.Done():
+					_ = c.Close()
+				case <-done:
+				}
+			}()
+
+			// Events are handled with the headers of the handshake, like the bearer token of the client.
+			r := c.Request()
+			req := &http.Request{
+				Method:     http.MethodPost,
+				URL:        r.URL,
+				Host:       r.Host,
+				Header:     r.Header,
+				RemoteAddr: r.RemoteAddr,
+			}
+			if err := receiveWebSocket(ctx, config, c, req, h); err != nil {
+				logger(LogComponentReceiver).Warnw("WebSocket connection failed", "remoteAddr", r.RemoteAddr, "error", err)
+			}
+		}),
+	}
+
+	l, err := net.Listen("tcp", s.Addr)
+	if err != nil {
+		return err
+	}
+	markReceiverReady(ctx)
+
+	errChan := make(chan error, 1)
+	go func() {
+		if s.TLSConfig != nil {
+			errChan <- s.ServeTLS(l, "", "")
+			return
+		}
+		errChan <- s.Serve(l)
+	}()
+
+	select {
+	case <-ctx.Done():
+		// Hijacked connections aren't closed by the server, they are closed once the context is done.
+		err := s.Close()
+		wg.Wait()
+		return err
+	case err := <-errChan:
+		return err
+	}
+}
+
+// dialWebSocketReceiver connects to the gateway and handles the events it pushes until the given context is done.
+func dialWebSocketReceiver(ctx context.Context, config *ReceiverConfig, h func(context.Context, *ce.Event, *http.Request) error) error {
+	u, _ := url.Parse(config.WebSocket.URL)
+
+	c, err := dialWebSocket(ctx, config.WebSocket.URL, nil, nil)
+	if err != nil {
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-done:
+		}
+	}()
+	markReceiverReady(ctx)
+
+	req := &http.Request{
+		Method:     http.MethodPost,
+		URL:        &url.URL{Path: u.Path},
+		Host:       u.Host,
+		Header:     http.Header{},
+		RemoteAddr: u.Host,
+	}
+	err = receiveWebSocket(ctx, config, c, req, h)
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// receiveWebSocket handles the events of the messages of the given connection, req is the request the events are
+// handled with. It returns nil once the peer closes the connection.
+func receiveWebSocket(ctx context.Context, config *ReceiverConfig, c *websocket.Conn, req *http.Request, h func(context.Context, *ce.Event, *http.Request) error) error {
+	defer c.Close()
+
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(c, &msg); err != nil {
+			if errors.Is(err, websocket.ErrFrameTooLarge) {
+				logger(LogComponentReceiver).Warnw("Message too large", "remoteAddr", req.RemoteAddr, "maxBytes", wsMaxMessageSize)
+				continue
+			}
+			if errors.Is(err, io.EOF) || ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		start := time.Now()
+		e, err := wsEvent(msg)
+		if err != nil {
+			logger(LogComponentReceiver).Warnw("Invalid event", "remoteAddr", req.RemoteAddr, "error", err)
+			continue
+		}
+		if err := h(ctx, e, req); err != nil {
+			logger(LogComponentReceiver).Debugw("Failed to handle event", "id", e.ID(), "error", err)
+		}
+		processingLatencyHistogram.Record(ctx, time.Since(start).Milliseconds(), addRequestLabels(req, config, processingLatencyHistogramLabels)...)
+	}
+}
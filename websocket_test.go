@@ -0,0 +1,206 @@
+package sacura
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	ce "github.com/cloudevents/sdk-go/v2"
+	cetest "github.com/cloudevents/sdk-go/v2/test"
+	"golang.org/x/net/websocket"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestWebSocketConfigValidate(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		sender   SenderConfig
+		receiver ReceiverConfig
+		wantErr  bool
+	}{
+		{
+			name:     "valid",
+			sender:   SenderConfig{Target: "wss://gateway/events"},
+			receiver: ReceiverConfig{WebSocket: &ReceiverWebSocketConfig{URL: "ws://gateway:8080/subscriptions/sacura"}},
+		},
+		{
+			name:     "receiver accepting connections",
+			sender:   SenderConfig{Target: "ws://localhost:8080"},
+			receiver: ReceiverConfig{Auth: &ReceiverAuthConfig{}},
+		},
+		{
+			name:     "http target and gateway",
+			sender:   SenderConfig{Target: "http://localhost:8080"},
+			receiver: ReceiverConfig{WebSocket: &ReceiverWebSocketConfig{URL: "http://gateway"}},
+			wantErr:  true,
+		},
+		{
+			name:     "sender batches and receiver dead-letter sink",
+			sender:   SenderConfig{Target: "ws://localhost:8080", BatchSize: 10},
+			receiver: ReceiverConfig{DeadLetterSinkPath: "/dls"},
+			wantErr:  true,
+		},
+		{
+			name:     "sender batches and receiver bearer tokens with a gateway",
+			sender:   SenderConfig{Target: "ws://localhost:8080", BatchSize: 2},
+			receiver: ReceiverConfig{WebSocket: &ReceiverWebSocketConfig{URL: "ws://gateway"}, Auth: &ReceiverAuthConfig{}},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.sender.validateWebSocket(); (err != nil) != tt.wantErr {
+				t.Errorf("sender wantErr %v, got %v", tt.wantErr, err)
+			}
+			if err := tt.receiver.validateWebSocket(); (err != nil) != tt.wantErr {
+				t.Errorf("receiver wantErr %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWebSocketLargeMessage(t *testing.T) {
+	received := make(chan []byte, 1)
+	server := httptest.NewServer(newWebSocketServer(func(c *websocket.Conn) {
+		var msg []byte
+		if err := websocket.Message.Receive(c, &msg); err != nil {
+			received <- nil
+			return
+		}
+		received <- msg
+	}))
+	defer server.Close()
+
+	c, err := dialWebSocket(context.Background(), "ws"+strings.TrimPrefix(server.URL, "http"), nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if p := c.Config().Protocol; len(p) != 1 || p[0] != wsSubprotocol {
+		t.Errorf("want subprotocol %s, got %v", wsSubprotocol, p)
+	}
+
+	// A message of more than 64KiB.
+	large := strings.Repeat("x", 70000)
+	if err := websocket.Message.Send(c, large); err != nil {
+		t.Fatal(err)
+	}
+	if msg := <-received; string(msg) != large {
+		t.Errorf("want a message of %d bytes, got %d bytes", len(large), len(msg))
+	}
+}
+
+func TestWebSocketServerUnsupportedSubprotocol(t *testing.T) {
+	server := httptest.NewServer(newWebSocketServer(func(*websocket.Conn) {}))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	req.Header.Set("Sec-WebSocket-Protocol", "cloudevents.avro")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("want status %d, got %d", http.StatusForbidden, resp.StatusCode)
+	}
+}
+
+func TestStartReceiverWebSocket(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{Port: 9240, Protocol: ProtocolWebSocket}, received, nil)
+	}()
+
+	err := wait.PollImmediate(10*time.Millisecond, 10*time.Second, func() (bool, error) {
+		c, err := dialWebSocket(context.Background(), "ws://localhost:9240", nil, nil)
+		if err != nil {
+			return false, nil
+		}
+		_ = c.Close()
+		return true, nil
+	})
+	if err != nil {
+		t.Fatal("receiver didn't accept connections", err)
+	}
+
+	sent := make(chan ce.Event, 10)
+	metrics := startSender(context.Background(), Config{
+		Sender: SenderConfig{
+			Target:             "ws://localhost:9240/events",
+			FrequencyPerSecond: 10,
+			Workers:            1,
+			Protocol:           ProtocolWebSocket,
+		},
+		Ordered:        &OrderedConfig{NumPartitionKeys: 2},
+		ParsedDuration: time.Second,
+	}, sent)
+	close(sent)
+
+	if metrics.AcceptedCount != 10 {
+		t.Errorf("expected 10 accepted events, got %+v", metrics)
+	}
+	for e := range sent {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}
+
+func TestStartReceiverWebSocketGateway(t *testing.T) {
+
+	var events []ce.Event
+	for i := 0; i < 3; i++ {
+		e := cetest.FullEvent()
+		e.SetID(fmt.Sprint(i))
+		events = append(events, e)
+	}
+	gateway := httptest.NewServer(newWebSocketServer(func(c *websocket.Conn) {
+		for _, e := range events {
+			b, _ := e.MarshalJSON()
+			if err := websocket.Message.Send(c, string(b)); err != nil {
+				return
+			}
+		}
+	}))
+	defer gateway.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	received := make(chan ReceivedEvent, 10)
+	errChan := make(chan error, 1)
+	go func() {
+		errChan <- StartReceiver(ctx, ReceiverConfig{
+			Protocol:  ProtocolWebSocket,
+			WebSocket: &ReceiverWebSocketConfig{URL: "ws" + strings.TrimPrefix(gateway.URL, "http") + "/subscriptions/sacura"},
+		}, received, nil)
+	}()
+
+	for _, e := range events {
+		if r := <-received; r.Event.ID() != e.ID() {
+			t.Errorf("expected event %s, got %s", e.ID(), r.Event.ID())
+		}
+	}
+
+	cancel()
+	if err := <-errChan; err != nil {
+		t.Fatal("expected nil, got", err)
+	}
+}